@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// AuditCmd defines audit command.
+func AuditCmd() *cobra.Command {
+	var object, actor, since string
+	var limit int
+	cmd := &cobra.Command{
+		Use:     "audit",
+		Short:   "List audit entries of administration changes, from the newest to the oldest",
+		Example: "egctl audit --object <object_name> --since 24h",
+		Run: func(cmd *cobra.Command, args []string) {
+			query := url.Values{}
+			if object != "" {
+				query.Set("object", object)
+			}
+			if actor != "" {
+				query.Set("actor", actor)
+			}
+			if since != "" {
+				query.Set("since", since)
+			}
+			if limit > 0 {
+				query.Set("limit", strconv.Itoa(limit))
+			}
+
+			u := makeURL(auditURL)
+			if len(query) > 0 {
+				u += "?" + query.Encode()
+			}
+			handleRequest(http.MethodGet, u, nil, cmd)
+		},
+	}
+
+	cmd.Flags().StringVar(&object, "object", "", "Only list changes of the object.")
+	cmd.Flags().StringVar(&actor, "actor", "", "Only list changes by the actor.")
+	cmd.Flags().StringVar(&since, "since", "", "Only list changes after a RFC3339 time or a duration before now, e.g. 24h.")
+	cmd.Flags().IntVar(&limit, "limit", 0, "The max number of entries, defaults to 100.")
+
+	return cmd
+}
@@ -52,10 +52,32 @@ const (
 	membersURL = apiURL + "/status/members"
 	memberURL  = apiURL + "/status/members/%s"
 
+	etcdMembersURL       = apiURL + "/cluster/members"
+	etcdMemberURL        = apiURL + "/cluster/members/%s"
+	etcdMemberPromoteURL = apiURL + "/cluster/members/%s/promote"
+	etcdMemberReplaceURL = apiURL + "/cluster/members/%s/replace"
+
 	objectKindsURL = apiURL + "/object-kinds"
 	objectsURL     = apiURL + "/objects"
 	objectURL      = apiURL + "/objects/%s"
 
+	objectHistoryURL  = apiURL + "/objects/%s/history"
+	objectDiffURL     = apiURL + "/objects/%s/diff"
+	objectRollbackURL = apiURL + "/objects/rollback"
+	objectApplyURL    = apiURL + "/objects/apply"
+
+	auditURL = apiURL + "/audit"
+
+	snapshotsURL       = apiURL + "/snapshots"
+	snapshotURL        = apiURL + "/snapshots/%s"
+	snapshotRestoreURL = apiURL + "/snapshots/%s/restore"
+	restoreURL         = apiURL + "/snapshots/restore"
+
+	trafficURL = apiURL + "/status/traffic"
+
+	pipelineDryRunURL = apiURL + "/pipelines/%s/dryrun"
+	pipelineGraphURL  = apiURL + "/pipelines/%s/graph"
+
 	statusObjectURL  = apiURL + "/status/objects/%s"
 	statusObjectsURL = apiURL + "/status/objects"
 
@@ -67,6 +89,9 @@ const (
 	customDataURL         = apiURL + "/customdata/%s"
 	customDataItemURL     = apiURL + "/customdata/%s/%s"
 
+	secretsURL = apiURL + "/secrets"
+	secretURL  = apiURL + "/secrets/%s"
+
 	profileURL      = apiURL + "/profile"
 	profileStartURL = apiURL + "/profile/start/%s"
 	profileStopURL  = apiURL + "/profile/stop"
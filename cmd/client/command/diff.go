@@ -0,0 +1,237 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+
+	"github.com/fatih/color"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/spf13/cobra"
+
+	"github.com/megaease/easegress/pkg/secret"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// diffExitCodeChanged is the exit code if there are differences,
+	// it follows diff(1), 0 for no difference and 2 for errors.
+	diffExitCodeChanged = 1
+	diffExitCodeError   = 2
+
+	diffActionCreate = "create"
+	diffActionUpdate = "update"
+	diffActionDelete = "delete"
+)
+
+type (
+	// specDiff is the difference of an object between the local spec and
+	// the live one in the cluster.
+	specDiff struct {
+		Name   string `json:"name"`
+		Kind   string `json:"kind"`
+		Action string `json:"action"`
+		Diff   string `json:"diff"`
+	}
+
+	diffResult struct {
+		Changed   bool        `json:"changed"`
+		Unchanged int         `json:"unchanged"`
+		Diffs     []*specDiff `json:"diffs"`
+	}
+)
+
+// DiffCmd defines diff command.
+func DiffCmd() *cobra.Command {
+	var specFile string
+	var prune bool
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Show the differences between local specs and the live objects in the cluster",
+		Long: "Show the differences between local specs and the live objects in the cluster. " +
+			"The local specs are normalized with the default values of the fields before comparing. " +
+			"It exits with 0 if there are no differences, 1 if there are differences and 2 on errors. " +
+			"The unified diffs are printed by default, or the structured result if the output format is specified.",
+		Example: "egctl diff -f specs/ --prune",
+		Run: func(cmd *cobra.Command, args []string) {
+			result := diffSpecs(specFile, prune, cmd)
+
+			if cmd.Flags().Changed("output") {
+				printBody(codectool.MustMarshalJSON(result))
+			} else {
+				printDiffs(result)
+			}
+
+			if result.Changed {
+				os.Exit(diffExitCodeChanged)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file or a directory of yaml files, defaults to stdin.")
+	cmd.Flags().BoolVar(&prune, "prune", false, "Also show the objects in the cluster which are not in the local specs.")
+
+	return cmd
+}
+
+func exitDiffWithErrorf(format string, a ...interface{}) {
+	color.New(color.FgRed).Fprint(os.Stderr, "Error: ")
+	fmt.Fprintf(os.Stderr, format+"\n", a...)
+	os.Exit(diffExitCodeError)
+}
+
+func diffSpecs(specFile string, prune bool, cmd *cobra.Command) *diffResult {
+	specs, loadResult := loadLintSpecs(specFile, cmd)
+	for _, f := range loadResult.Findings {
+		exitDiffWithErrorf("%s: %s", f.File, f.Message)
+	}
+
+	live := fetchLiveObjects(cmd)
+
+	result := &diffResult{Diffs: []*specDiff{}}
+	local := map[string]bool{}
+	for _, s := range specs {
+		if local[s.name] {
+			exitDiffWithErrorf("%s: duplicated object %s", s.file, s.name)
+		}
+		local[s.name] = true
+
+		to := normalizeLocalSpec(s)
+		from, ok := live[s.name]
+		action := diffActionUpdate
+		if !ok {
+			action = diffActionCreate
+		} else if reflect.DeepEqual(from, to) {
+			result.Unchanged++
+			continue
+		}
+
+		result.Diffs = append(result.Diffs, &specDiff{
+			Name:   s.name,
+			Kind:   s.kind,
+			Action: action,
+			Diff:   specUnifiedDiff(s.name, from, to),
+		})
+	}
+
+	if prune {
+		for name, from := range live {
+			if local[name] {
+				continue
+			}
+			kind, _ := from["kind"].(string)
+			result.Diffs = append(result.Diffs, &specDiff{
+				Name:   name,
+				Kind:   kind,
+				Action: diffActionDelete,
+				Diff:   specUnifiedDiff(name, from, nil),
+			})
+		}
+	}
+
+	sort.Slice(result.Diffs, func(i, j int) bool {
+		return result.Diffs[i].Name < result.Diffs[j].Name
+	})
+	result.Changed = len(result.Diffs) > 0
+
+	return result
+}
+
+// fetchLiveObjects returns the live objects in the cluster by name.
+func fetchLiveObjects(cmd *cobra.Command) map[string]map[string]interface{} {
+	resp, err := http.Get(makeURL(objectsURL))
+	if err != nil {
+		exitDiffWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		exitDiffWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+	if !successfulStatusCode(resp.StatusCode) {
+		exitDiffWithErrorf("%s failed: %d: %s", cmd.Short, resp.StatusCode, body)
+	}
+
+	var objects []map[string]interface{}
+	if err = codectool.UnmarshalJSON(body, &objects); err != nil {
+		exitDiffWithErrorf("unmarshal %s to json failed: %v", body, err)
+	}
+
+	live := make(map[string]map[string]interface{}, len(objects))
+	for _, obj := range objects {
+		name, _ := obj["name"].(string)
+		live[name] = obj
+	}
+	return live
+}
+
+// normalizeLocalSpec fills the default values of the fields as the cluster
+// does, so that only the meaningful differences are reported.
+func normalizeLocalSpec(s *lintSpec) map[string]interface{} {
+	config := string(codectool.MustMarshalJSON(s.raw))
+
+	// NOTE: The specs referencing secrets can't be validated offline, they
+	// are compared without the default values.
+	if !secret.HasReference(s.raw) {
+		spec, err := supervisor.NewSpec(config)
+		if err != nil {
+			exitDiffWithErrorf("%s: %s: %v", s.file, s.name, err)
+		}
+		config = spec.JSONConfig()
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: %s references secrets, default values are not normalized\n", s.name)
+	}
+
+	m := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(config), &m)
+	return m
+}
+
+func specUnifiedDiff(name string, from, to map[string]interface{}) string {
+	toYAML := func(m map[string]interface{}) []string {
+		if m == nil {
+			return nil
+		}
+		buff := codectool.MustJSONToYAML(codectool.MustMarshalJSON(m))
+		return difflib.SplitLines(string(buff))
+	}
+
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        toYAML(from),
+		B:        toYAML(to),
+		FromFile: name + "@live",
+		ToFile:   name + "@local",
+		Context:  3,
+	})
+	return diff
+}
+
+func printDiffs(result *diffResult) {
+	for _, d := range result.Diffs {
+		fmt.Printf("%s %s (%s)\n", d.Action, d.Name, d.Kind)
+		fmt.Print(d.Diff)
+	}
+	fmt.Fprintf(os.Stderr, "%d changed, %d unchanged\n", len(result.Diffs), result.Unchanged)
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func newDiffTestServer(t *testing.T, docs ...string) *httptest.Server {
+	var objects []map[string]interface{}
+	for _, doc := range docs {
+		spec, err := supervisor.NewSpec(doc)
+		if err != nil {
+			t.Fatalf("create spec failed: %v", err)
+		}
+		obj := map[string]interface{}{}
+		codectool.MustUnmarshal([]byte(spec.JSONConfig()), &obj)
+		objects = append(objects, obj)
+	}
+
+	return newTestAPIServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != objectsURL {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(codectool.MustMarshalJSON(objects))
+	})
+}
+
+func TestDiffSpecs(t *testing.T) {
+	assert := assert.New(t)
+
+	pipelineB := strings.Replace(lintTestPipeline, "pipeline-a", "pipeline-b", 1)
+	pipelineZ := strings.Replace(lintTestPipeline, "pipeline-a", "pipeline-z", 1)
+	liveB := strings.Replace(pipelineB, "code: 200", "code: 404", 1)
+	newDiffTestServer(t, lintTestPipeline, liveB, pipelineZ)
+
+	dir := t.TempDir()
+	assert.NoError(os.WriteFile(filepath.Join(dir, "specs.yaml"),
+		[]byte(lintTestPipeline+"---\n"+pipelineB+"---\n"+lintTestServer), 0o644))
+
+	cmd := &cobra.Command{Short: "diff"}
+	result := diffSpecs(dir, false, cmd)
+	assert.True(result.Changed)
+	assert.Equal(1, result.Unchanged)
+	assert.Len(result.Diffs, 2)
+
+	assert.Equal("pipeline-b", result.Diffs[0].Name)
+	assert.Equal(diffActionUpdate, result.Diffs[0].Action)
+	assert.Contains(result.Diffs[0].Diff, "--- pipeline-b@live")
+	assert.Contains(result.Diffs[0].Diff, "+++ pipeline-b@local")
+	assert.Regexp(`(?m)^-.*code: 404$`, result.Diffs[0].Diff)
+	assert.Regexp(`(?m)^\+.*code: 200$`, result.Diffs[0].Diff)
+
+	assert.Equal("server-a", result.Diffs[1].Name)
+	assert.Equal("HTTPServer", result.Diffs[1].Kind)
+	assert.Equal(diffActionCreate, result.Diffs[1].Action)
+
+	result = diffSpecs(dir, true, cmd)
+	assert.Len(result.Diffs, 3)
+	assert.Equal("pipeline-z", result.Diffs[2].Name)
+	assert.Equal(diffActionDelete, result.Diffs[2].Action)
+	assert.Contains(result.Diffs[2].Diff, "-name: pipeline-z")
+}
+
+func TestSpecUnifiedDiff(t *testing.T) {
+	assert := assert.New(t)
+
+	from := map[string]interface{}{"name": "a", "kind": "Pipeline"}
+	to := map[string]interface{}{"name": "a", "kind": "Pipeline"}
+	assert.Empty(specUnifiedDiff("a", from, to))
+
+	to["flow"] = []interface{}{}
+	diff := specUnifiedDiff("a", from, to)
+	assert.Contains(diff, "+flow: []")
+
+	diff = specUnifiedDiff("a", nil, to)
+	assert.Contains(diff, "+name: a")
+}
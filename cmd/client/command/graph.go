@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/spf13/cobra"
+
+	"github.com/megaease/easegress/pkg/object/pipeline"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// GraphCmd defines graph command.
+func GraphCmd() *cobra.Command {
+	var specFile, format string
+	cmd := &cobra.Command{
+		Use:   "graph [<pipeline_name>]",
+		Short: "Export the flow of a pipeline as a Graphviz DOT or Mermaid graph",
+		Long: "Export the flow of a pipeline as a Graphviz DOT or Mermaid graph, including the filters, " +
+			"the jumpIf edges and the resilience policies wrapping the filters. The pipeline is the live " +
+			"one in the cluster, or the one in the local spec file if the file is specified, the name " +
+			"could be omitted if there is only one pipeline in the file.",
+		Example: "egctl graph pipeline-demo --format mermaid",
+		Args:    cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			name := ""
+			if len(args) == 1 {
+				name = args[0]
+			}
+
+			if specFile == "" {
+				if name == "" {
+					ExitWithErrorf("pipeline name is required")
+				}
+				u := makeURL(pipelineGraphURL, name) + "?format=" + url.QueryEscape(format)
+				fmt.Print(string(getJSON(u, cmd)))
+				return
+			}
+
+			graph, err := localPipelineGraph(specFile, name, format, cmd)
+			if err != nil {
+				ExitWithError(err)
+			}
+			fmt.Print(graph)
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file or a directory of yaml files containing the pipeline.")
+	cmd.Flags().StringVar(&format, "format", pipeline.GraphFormatDOT, "The format of the graph, dot or mermaid.")
+
+	return cmd
+}
+
+func localPipelineGraph(specFile, name, format string, cmd *cobra.Command) (string, error) {
+	specs, result := loadLintSpecs(specFile, cmd)
+	if len(result.Findings) > 0 {
+		f := result.Findings[0]
+		return "", fmt.Errorf("%s: %s", f.File, f.Message)
+	}
+
+	var found *lintSpec
+	for _, s := range specs {
+		if s.kind != pipeline.Kind || (name != "" && s.name != name) {
+			continue
+		}
+		if found != nil {
+			return "", fmt.Errorf("more than one pipeline in %s, please specify the name", specFile)
+		}
+		found = s
+	}
+	if found == nil {
+		return "", fmt.Errorf("pipeline %s not found in %s", name, specFile)
+	}
+
+	spec := &pipeline.Spec{}
+	if err := codectool.UnmarshalJSON(codectool.MustMarshalJSON(found.raw), spec); err != nil {
+		return "", fmt.Errorf("%s: %s: %v", found.file, found.name, err)
+	}
+	return spec.Graph().Format(found.name, format)
+}
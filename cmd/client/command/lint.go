@@ -0,0 +1,437 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/filters/proxy"
+	"github.com/megaease/easegress/pkg/object/easemonitormetrics"
+	"github.com/megaease/easegress/pkg/object/globalfilter"
+	"github.com/megaease/easegress/pkg/object/httpserver"
+	"github.com/megaease/easegress/pkg/object/pipeline"
+	"github.com/megaease/easegress/pkg/secret"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+
+	// NOTE: Register all objects and filters for validating specs offline.
+	_ "github.com/megaease/easegress/pkg/registry"
+)
+
+const (
+	lintSeverityError   = "error"
+	lintSeverityWarning = "warning"
+
+	lintRuleParse      = "parse"
+	lintRuleDuplicate  = "duplicate"
+	lintRuleSchema     = "schema"
+	lintRuleReference  = "reference"
+	lintRuleJumpIf     = "jumpIf"
+	lintRuleDeprecated = "deprecated"
+	lintRuleSecret     = "secret"
+)
+
+type (
+	// lintFinding is a problem found in the specs.
+	lintFinding struct {
+		File     string `json:"file"`
+		Object   string `json:"object,omitempty"`
+		Kind     string `json:"kind,omitempty"`
+		Severity string `json:"severity"`
+		Rule     string `json:"rule"`
+		Message  string `json:"message"`
+	}
+
+	lintSpec struct {
+		file string
+		name string
+		kind string
+		doc  []byte
+		raw  map[string]interface{}
+	}
+
+	lintResult struct {
+		Files    int            `json:"files"`
+		Objects  int            `json:"objects"`
+		Errors   int            `json:"errors"`
+		Warnings int            `json:"warnings"`
+		Findings []*lintFinding `json:"findings"`
+	}
+
+	// deprecatedField is a field kept for compatibility, path is the
+	// dot separated path of the field in the spec.
+	deprecatedField struct {
+		path        string
+		replacement string
+	}
+)
+
+// deprecatedFields are the deprecated fields of the object kinds.
+var deprecatedFields = map[string][]*deprecatedField{
+	httpserver.Kind: {
+		{path: "certBase64", replacement: "certs"},
+		{path: "keyBase64", replacement: "keys"},
+	},
+	easemonitormetrics.Kind: {
+		{path: "kafka", replacement: "sinks"},
+	},
+}
+
+// deprecatedFilterFields are the deprecated fields of the filter kinds.
+var deprecatedFilterFields = map[string][]*deprecatedField{
+	proxy.Kind: {
+		{path: "mirrorPool", replacement: "mirror"},
+	},
+}
+
+// LintCmd defines lint command.
+func LintCmd() *cobra.Command {
+	var specFile string
+	var strict bool
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Validate object specs offline, without a running cluster",
+		Long: "Validate object specs offline, including the schema, the references between objects, " +
+			"the jumpIf of pipelines and the deprecated fields. It exits with 1 if there are errors, " +
+			"or warnings in strict mode.",
+		Example: "egctl lint -f specs/ -o json",
+		Run: func(cmd *cobra.Command, args []string) {
+			specs, result := loadLintSpecs(specFile, cmd)
+			result.Findings = append(result.Findings, lintSpecs(specs)...)
+			sort.SliceStable(result.Findings, func(i, j int) bool {
+				fi, fj := result.Findings[i], result.Findings[j]
+				if fi.File != fj.File {
+					return fi.File < fj.File
+				}
+				return fi.Object < fj.Object
+			})
+
+			result.Objects = len(specs)
+			for _, f := range result.Findings {
+				if f.Severity == lintSeverityError {
+					result.Errors++
+				} else {
+					result.Warnings++
+				}
+			}
+
+			printBody(codectool.MustMarshalJSON(result))
+			if result.Errors > 0 || (strict && result.Warnings > 0) {
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file or a directory of yaml files, defaults to stdin.")
+	cmd.Flags().BoolVar(&strict, "strict", false, "Treat warnings as errors.")
+
+	return cmd
+}
+
+// loadLintSpecs loads the specs from a file, all yaml and json files of a
+// directory recursively, or stdin.
+func loadLintSpecs(specFile string, cmd *cobra.Command) ([]*lintSpec, *lintResult) {
+	result := &lintResult{Findings: []*lintFinding{}}
+
+	files := []string{specFile}
+	if specFile != "" {
+		info, err := os.Stat(specFile)
+		if err != nil {
+			ExitWithErrorf("%s failed: %v", cmd.Short, err)
+		}
+		if info.IsDir() {
+			files = nil
+			err = filepath.WalkDir(specFile, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				switch strings.ToLower(filepath.Ext(path)) {
+				case ".yaml", ".yml", ".json":
+					if !d.IsDir() {
+						files = append(files, path)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				ExitWithErrorf("%s failed: %v", cmd.Short, err)
+			}
+		}
+	}
+
+	var specs []*lintSpec
+	for _, file := range files {
+		result.Files++
+		name := file
+		if name == "" {
+			name = "<stdin>"
+		}
+
+		visitor := buildYAMLVisitor(file, cmd)
+		err := visitor.Visit(func(doc []byte) error {
+			raw := map[string]interface{}{}
+			if err := codectool.Unmarshal(doc, &raw); err != nil {
+				result.Findings = append(result.Findings, &lintFinding{
+					File:     name,
+					Severity: lintSeverityError,
+					Rule:     lintRuleParse,
+					Message:  err.Error(),
+				})
+				return nil
+			}
+			if len(raw) == 0 {
+				return nil
+			}
+
+			s := &lintSpec{file: name, doc: doc, raw: raw}
+			s.name, _ = raw["name"].(string)
+			s.kind, _ = raw["kind"].(string)
+			if s.name == "" || s.kind == "" {
+				result.Findings = append(result.Findings, &lintFinding{
+					File:     name,
+					Object:   s.name,
+					Kind:     s.kind,
+					Severity: lintSeverityError,
+					Rule:     lintRuleParse,
+					Message:  "name and kind are required",
+				})
+				return nil
+			}
+			specs = append(specs, s)
+			return nil
+		})
+		visitor.Close()
+
+		if err != nil {
+			result.Findings = append(result.Findings, &lintFinding{
+				File:     name,
+				Severity: lintSeverityError,
+				Rule:     lintRuleParse,
+				Message:  err.Error(),
+			})
+		}
+	}
+
+	return specs, result
+}
+
+func lintSpecs(specs []*lintSpec) []*lintFinding {
+	var findings []*lintFinding
+
+	byName := map[string]*lintSpec{}
+	for _, s := range specs {
+		finding := func(severity, rule, format string, a ...interface{}) {
+			findings = append(findings, &lintFinding{
+				File:     s.file,
+				Object:   s.name,
+				Kind:     s.kind,
+				Severity: severity,
+				Rule:     rule,
+				Message:  fmt.Sprintf(format, a...),
+			})
+		}
+
+		if first, ok := byName[s.name]; ok {
+			finding(lintSeverityError, lintRuleDuplicate, "duplicated with the object in %s", first.file)
+			continue
+		}
+		byName[s.name] = s
+
+		jumpIfErrs := lintJumpIf(s)
+		for _, msg := range jumpIfErrs {
+			finding(lintSeverityError, lintRuleJumpIf, "%s", msg)
+		}
+
+		if secret.HasReference(s.raw) {
+			// NOTE: The values of secrets are only available in the cluster.
+			finding(lintSeverityWarning, lintRuleSecret,
+				"schema is not validated, as secret references can't be resolved offline")
+		} else if _, err := supervisor.NewSpec(string(s.doc)); err != nil {
+			// The flow errors are reported by the jumpIf rule in detail.
+			if len(jumpIfErrs) == 0 || !strings.Contains(err.Error(), "flow:") {
+				finding(lintSeverityError, lintRuleSchema, "%v", err)
+			}
+		}
+
+		for _, df := range deprecatedFields[s.kind] {
+			if _, ok := lookupField(s.raw, df.path); ok {
+				finding(lintSeverityWarning, lintRuleDeprecated,
+					"%s is deprecated, use %s instead", df.path, df.replacement)
+			}
+		}
+
+		if s.kind == pipeline.Kind {
+			filterSpecs, _ := s.raw["filters"].([]interface{})
+			for _, filterSpec := range filterSpecs {
+				f, _ := filterSpec.(map[string]interface{})
+				kind, _ := f["kind"].(string)
+				name, _ := f["name"].(string)
+				for _, df := range deprecatedFilterFields[kind] {
+					if _, ok := lookupField(f, df.path); ok {
+						finding(lintSeverityWarning, lintRuleDeprecated,
+							"filter %s: %s is deprecated, use %s instead", name, df.path, df.replacement)
+					}
+				}
+			}
+		}
+	}
+
+	for _, s := range specs {
+		if byName[s.name] != s || s.kind != httpserver.Kind {
+			continue
+		}
+		findings = append(findings, lintHTTPServerReferences(s, byName)...)
+	}
+
+	return findings
+}
+
+// lintJumpIf checks the flow of a pipeline, all problems are reported
+// instead of the first one only.
+func lintJumpIf(s *lintSpec) []string {
+	if s.kind != pipeline.Kind {
+		return nil
+	}
+
+	spec := &pipeline.Spec{}
+	if err := codectool.Unmarshal(s.doc, spec); err != nil {
+		return nil
+	}
+
+	kinds := map[string]string{}
+	for _, f := range spec.Filters {
+		name, _ := f["name"].(string)
+		kind, _ := f["kind"].(string)
+		kinds[name] = kind
+	}
+
+	var errs []string
+	validTargets := map[string]int{pipeline.BuiltInFilterEnd: 1}
+	for i := len(spec.Flow) - 1; i >= 0; i-- {
+		node := &spec.Flow[i]
+		if node.FilterName == pipeline.BuiltInFilterEnd {
+			continue
+		}
+
+		kind, ok := kinds[node.FilterName]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("flow: filter %s not found", node.FilterName))
+		}
+
+		var results []string
+		if k := filters.GetKind(kind); k != nil {
+			results = k.Results
+		}
+		for result, target := range node.JumpIf {
+			if ok && result != "" && !stringtool.StrInSlice(result, results) {
+				errs = append(errs, fmt.Sprintf("flow: filter %s: result %s is not in %v",
+					node.FilterName, result, results))
+			}
+			if count := validTargets[target]; count == 0 {
+				errs = append(errs, fmt.Sprintf("flow: filter %s: target %s not found after it",
+					node.FilterName, target))
+			} else if count > 1 {
+				errs = append(errs, fmt.Sprintf("flow: filter %s: target %s is ambiguous",
+					node.FilterName, target))
+			}
+		}
+
+		alias := node.FilterAlias
+		if alias == "" {
+			alias = node.FilterName
+		}
+		validTargets[alias]++
+	}
+
+	sort.Strings(errs)
+	return errs
+}
+
+// lintHTTPServerReferences checks the backends and the global filter of an
+// HTTPServer. The referenced objects which are not in the specs may exist
+// in the cluster, so they are warnings only.
+func lintHTTPServerReferences(s *lintSpec, byName map[string]*lintSpec) []*lintFinding {
+	var findings []*lintFinding
+	finding := func(severity, format string, a ...interface{}) {
+		findings = append(findings, &lintFinding{
+			File:     s.file,
+			Object:   s.name,
+			Kind:     s.kind,
+			Severity: severity,
+			Rule:     lintRuleReference,
+			Message:  fmt.Sprintf(format, a...),
+		})
+	}
+
+	check := func(what, name, kind string) {
+		target, ok := byName[name]
+		if !ok {
+			finding(lintSeverityWarning, "%s %s not found in the specs", what, name)
+		} else if target.kind != kind {
+			finding(lintSeverityError, "%s %s is a %s, not a %s", what, name, target.kind, kind)
+		}
+	}
+
+	spec := &httpserver.Spec{}
+	if err := codectool.Unmarshal(s.doc, spec); err != nil {
+		return nil
+	}
+
+	backends := map[string]struct{}{}
+	for _, rule := range spec.Rules {
+		for _, path := range rule.Paths {
+			if path.Backend == "" {
+				continue
+			}
+			if _, ok := backends[path.Backend]; ok {
+				continue
+			}
+			backends[path.Backend] = struct{}{}
+			check("backend", path.Backend, pipeline.Kind)
+		}
+	}
+	if spec.GlobalFilter != "" {
+		check("global filter", spec.GlobalFilter, globalfilter.Kind)
+	}
+
+	return findings
+}
+
+// lookupField returns the value of the field at the dot separated path.
+func lookupField(m map[string]interface{}, path string) (interface{}, bool) {
+	var value interface{} = m
+	for _, key := range strings.Split(path, ".") {
+		mm, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = mm[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, value != nil && value != ""
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const lintTestPipeline = `
+name: pipeline-a
+kind: Pipeline
+flow:
+- filter: mock
+  jumpIf: {mocked: END}
+- filter: proxy
+filters:
+- name: mock
+  kind: Mock
+  rules:
+  - match:
+      path: /mock
+    code: 200
+- name: proxy
+  kind: Proxy
+  pools:
+  - servers:
+    - url: http://127.0.0.1:9095
+`
+
+const lintTestServer = `
+name: server-a
+kind: HTTPServer
+port: 10080
+certBase64: YQ==
+globalFilter: pipeline-a
+rules:
+- paths:
+  - pathPrefix: /a
+    backend: pipeline-a
+  - pathPrefix: /b
+    backend: pipeline-b
+  - pathPrefix: /c
+    backend: pipeline-b
+`
+
+func newLintSpecs(t *testing.T, file string, docs ...string) []*lintSpec {
+	var specs []*lintSpec
+	for _, doc := range docs {
+		raw := map[string]interface{}{}
+		if err := codectool.Unmarshal([]byte(doc), &raw); err != nil {
+			t.Fatalf("unmarshal %s failed: %v", doc, err)
+		}
+		s := &lintSpec{file: file, doc: []byte(doc), raw: raw}
+		s.name, _ = raw["name"].(string)
+		s.kind, _ = raw["kind"].(string)
+		specs = append(specs, s)
+	}
+	return specs
+}
+
+// lintFindingsOf returns the messages of the findings of the rule.
+func lintFindingsOf(findings []*lintFinding, rule string) []string {
+	var msgs []string
+	for _, f := range findings {
+		if f.Rule == rule {
+			msgs = append(msgs, f.Severity+": "+f.Message)
+		}
+	}
+	return msgs
+}
+
+func TestLintJumpIf(t *testing.T) {
+	assert := assert.New(t)
+
+	specs := newLintSpecs(t, "a.yaml", lintTestPipeline)
+	assert.Empty(lintJumpIf(specs[0]))
+
+	doc := strings.Replace(lintTestPipeline, `
+- filter: mock
+  jumpIf: {mocked: END}
+- filter: proxy
+`, `
+- filter: mock
+  jumpIf: {invalid: proxy}
+- filter: proxy
+  jumpIf: {"": mock}
+- filter: unknown
+`, 1)
+	specs = newLintSpecs(t, "a.yaml", doc)
+	assert.Equal([]string{
+		"flow: filter mock: result invalid is not in [mocked]",
+		"flow: filter proxy: target mock not found after it",
+		"flow: filter unknown not found",
+	}, lintJumpIf(specs[0]))
+
+	// the flow errors are reported by the jumpIf rule only.
+	findings := lintSpecs(specs)
+	assert.Len(lintFindingsOf(findings, lintRuleJumpIf), 3)
+	assert.Empty(lintFindingsOf(findings, lintRuleSchema))
+}
+
+func TestLintSpecs(t *testing.T) {
+	assert := assert.New(t)
+
+	secretDoc := strings.Replace(lintTestPipeline, "pipeline-a", "pipeline-c", 1)
+	secretDoc = strings.Replace(secretDoc, "path: /mock", "path: $secret:mock-path", 1)
+	specs := append(newLintSpecs(t, "a.yaml", lintTestPipeline, lintTestServer),
+		newLintSpecs(t, "b.yaml", lintTestPipeline, secretDoc, "name: unknown-a\nkind: Unknown\n")...)
+	findings := lintSpecs(specs)
+
+	assert.Equal([]string{"error: duplicated with the object in a.yaml"},
+		lintFindingsOf(findings, lintRuleDuplicate))
+	assert.Equal([]string{"warning: schema is not validated, as secret references can't be resolved offline"},
+		lintFindingsOf(findings, lintRuleSecret))
+	assert.Equal([]string{"warning: certBase64 is deprecated, use certs instead"},
+		lintFindingsOf(findings, lintRuleDeprecated))
+	assert.Equal([]string{
+		"warning: backend pipeline-b not found in the specs",
+		"error: global filter pipeline-a is a Pipeline, not a GlobalFilter",
+	}, lintFindingsOf(findings, lintRuleReference))
+
+	schemaErrs := lintFindingsOf(findings, lintRuleSchema)
+	assert.Len(schemaErrs, 1)
+	for _, f := range findings {
+		if f.Rule == lintRuleSchema {
+			assert.Equal("unknown-a", f.Object)
+		}
+	}
+
+	// the deprecated fields of the filters.
+	doc := strings.Replace(lintTestPipeline, `
+  pools:
+`, `
+  mirrorPool:
+    servers:
+    - url: http://127.0.0.1:9096
+  pools:
+`, 1)
+	findings = lintSpecs(newLintSpecs(t, "c.yaml", doc))
+	assert.Equal([]string{"warning: filter proxy: mirrorPool is deprecated, use mirror instead"},
+		lintFindingsOf(findings, lintRuleDeprecated))
+}
+
+func TestLoadLintSpecs(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	assert.NoError(os.MkdirAll(filepath.Join(dir, "sub"), 0o755))
+	assert.NoError(os.WriteFile(filepath.Join(dir, "a.yaml"),
+		[]byte(lintTestPipeline+"---\n"+lintTestServer), 0o644))
+	assert.NoError(os.WriteFile(filepath.Join(dir, "sub", "b.yml"),
+		[]byte("name: no-kind\n"), 0o644))
+	assert.NoError(os.WriteFile(filepath.Join(dir, "c.txt"),
+		[]byte(lintTestPipeline), 0o644))
+
+	specs, result := loadLintSpecs(dir, &cobra.Command{Short: "lint"})
+	assert.Equal(2, result.Files)
+	assert.Len(specs, 2)
+	assert.Equal("pipeline-a", specs[0].name)
+	assert.Equal("server-a", specs[1].name)
+
+	assert.Len(result.Findings, 1)
+	assert.Equal(lintRuleParse, result.Findings[0].Rule)
+	assert.Equal("no-kind", result.Findings[0].Object)
+	assert.Equal(filepath.Join(dir, "sub", "b.yml"), result.Findings[0].File)
+}
@@ -21,6 +21,7 @@ import (
 	"errors"
 	"net/http"
 
+	"github.com/megaease/easegress/pkg/util/codectool"
 	"github.com/spf13/cobra"
 )
 
@@ -28,11 +29,16 @@ import (
 func MemberCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "member",
-		Short: "View Easegress members",
+		Short: "View and manage Easegress members",
 	}
 
 	cmd.AddCommand(listMemberCmd())
 	cmd.AddCommand(purgeMemberCmd())
+	cmd.AddCommand(listEtcdMemberCmd())
+	cmd.AddCommand(addLearnerCmd())
+	cmd.AddCommand(promoteMemberCmd())
+	cmd.AddCommand(removeMemberCmd())
+	cmd.AddCommand(replaceMemberCmd())
 	return cmd
 }
 
@@ -67,3 +73,95 @@ func purgeMemberCmd() *cobra.Command {
 
 	return cmd
 }
+
+func listEtcdMemberCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list-etcd",
+		Short: "List etcd members formed by primary members, with their roles and health",
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(etcdMembersURL), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func requireOneMember(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("requires one member name")
+	}
+	return nil
+}
+
+func addMemberBody(name string, peerURLs []string) []byte {
+	return codectool.MustMarshalJSON(map[string]interface{}{
+		"name":     name,
+		"peerURLs": peerURLs,
+	})
+}
+
+func addLearnerCmd() *cobra.Command {
+	var peerURLs []string
+	cmd := &cobra.Command{
+		Use:     "add-learner <member name>",
+		Short:   "Add a primary member as a learner, which doesn't vote until promoted",
+		Example: "egctl member add-learner machine-4 --peer-urls http://machine-4:2380",
+		Args:    requireOneMember,
+		Run: func(cmd *cobra.Command, args []string) {
+			body := addMemberBody(args[0], peerURLs)
+			handleRequest(http.MethodPost, makeURL(etcdMembersURL), body, cmd)
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&peerURLs, "peer-urls", nil, "The peer URLs of the new member.")
+
+	return cmd
+}
+
+func promoteMemberCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "promote <member name>",
+		Short:   "Promote a learner to a voting member after it is in sync with the leader",
+		Example: "egctl member promote machine-4",
+		Args:    requireOneMember,
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodPost, makeURL(etcdMemberPromoteURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func removeMemberCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "remove <member name>",
+		Short:   "Remove a primary member if the cluster keeps its quorum without it",
+		Example: "egctl member remove machine-3",
+		Args:    requireOneMember,
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodDelete, makeURL(etcdMemberURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func replaceMemberCmd() *cobra.Command {
+	var name string
+	var peerURLs []string
+	cmd := &cobra.Command{
+		Use:     "replace <member name>",
+		Short:   "Replace a failed primary member with a new one, which is added as a learner",
+		Example: "egctl member replace machine-3 --name machine-5 --peer-urls http://machine-5:2380",
+		Args:    requireOneMember,
+		Run: func(cmd *cobra.Command, args []string) {
+			body := addMemberBody(name, peerURLs)
+			handleRequest(http.MethodPost, makeURL(etcdMemberReplaceURL, args[0]), body, cmd)
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "The name of the new member.")
+	cmd.Flags().StringSliceVar(&peerURLs, "peer-urls", nil, "The peer URLs of the new member.")
+
+	return cmd
+}
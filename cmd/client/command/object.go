@@ -20,8 +20,12 @@ package command
 import (
 	"errors"
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/spf13/cobra"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
 )
 
 // ObjectCmd defines object command.
@@ -39,6 +43,10 @@ func ObjectCmd() *cobra.Command {
 	cmd.AddCommand(updateObjectCmd())
 	cmd.AddCommand(deleteObjectCmd())
 	cmd.AddCommand(statusObjectCmd())
+	cmd.AddCommand(objectHistoryCmd())
+	cmd.AddCommand(diffObjectCmd())
+	cmd.AddCommand(rollbackObjectsCmd())
+	cmd.AddCommand(applyObjectsCmd())
 
 	return cmd
 }
@@ -196,3 +204,129 @@ func listStatusObjectsCmd() *cobra.Command {
 
 	return cmd
 }
+
+func objectHistoryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "history",
+		Short:   "List revisions of an object",
+		Example: "egctl object history <object_name>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one object name to be retrieved")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(objectHistoryURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func diffObjectCmd() *cobra.Command {
+	var from, to int64
+	cmd := &cobra.Command{
+		Use:     "diff",
+		Short:   "Show the difference of an object between two revisions",
+		Example: "egctl object diff <object_name> --from <revision> --to <revision>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one object name to be retrieved")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			query := url.Values{}
+			if from > 0 {
+				query.Set("from", strconv.FormatInt(from, 10))
+			}
+			if to > 0 {
+				query.Set("to", strconv.FormatInt(to, 10))
+			}
+
+			u := makeURL(objectDiffURL, args[0])
+			if len(query) > 0 {
+				u += "?" + query.Encode()
+			}
+			handleRequest(http.MethodGet, u, nil, cmd)
+		},
+	}
+
+	cmd.Flags().Int64Var(&from, "from", 0, "The revision to compare from, defaults to the one before --to.")
+	cmd.Flags().Int64Var(&to, "to", 0, "The revision to compare to, defaults to the latest one.")
+
+	return cmd
+}
+
+func rollbackObjectsCmd() *cobra.Command {
+	var revision int64
+	cmd := &cobra.Command{
+		Use:     "rollback",
+		Short:   "Roll back objects to a revision atomically, all objects with history are rolled back if no name is given",
+		Example: "egctl object rollback [<object_name>...] --revision <revision>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if revision <= 0 {
+				return errors.New("requires a positive revision to roll back to")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			body := codectool.MustMarshalJSON(map[string]interface{}{
+				"revision": revision,
+				"objects":  args,
+			})
+			handleRequest(http.MethodPost, makeURL(objectRollbackURL), body, cmd)
+		},
+	}
+
+	cmd.Flags().Int64VarP(&revision, "revision", "r", 0, "The revision to roll back to.")
+
+	return cmd
+}
+
+func applyObjectsCmd() *cobra.Command {
+	var specFile string
+	var prune, dryRun bool
+	cmd := &cobra.Command{
+		Use:     "apply",
+		Short:   "Apply objects from a yaml file or stdin all-or-nothing",
+		Example: "egctl object apply -f <bundle.yaml> --dry-run",
+		Run: func(cmd *cobra.Command, args []string) {
+			objects := []map[string]interface{}{}
+			visitor := buildSpecVisitor(specFile, cmd)
+			visitor.Visit(func(s *spec) error {
+				obj := map[string]interface{}{}
+				jsonDoc, err := codectool.YAMLToJSON([]byte(s.doc))
+				if err == nil {
+					err = codectool.UnmarshalJSON(jsonDoc, &obj)
+				}
+				if err != nil {
+					ExitWithErrorf("read object %s failed: %v", s.Name, err)
+				}
+				objects = append(objects, obj)
+				return nil
+			})
+			visitor.Close()
+
+			body := codectool.MustMarshalJSON(map[string]interface{}{
+				"objects": objects,
+				"prune":   prune,
+				"dryRun":  dryRun,
+			})
+			handleRequest(http.MethodPost, makeURL(objectApplyURL), body, cmd)
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file specifying the objects.")
+	cmd.Flags().BoolVar(&prune, "prune", false, "Delete the objects which are not in the file.")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Validate the objects and show the changes without applying them.")
+
+	return cmd
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/spf13/cobra"
+)
+
+// SecretCmd defines secret command.
+func SecretCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secret",
+		Short: "View and change secrets, the values of secrets are never returned",
+	}
+
+	cmd.AddCommand(listSecretsCmd())
+	cmd.AddCommand(getSecretCmd())
+	cmd.AddCommand(createSecretCmd())
+	cmd.AddCommand(updateSecretCmd())
+	cmd.AddCommand(deleteSecretCmd())
+
+	return cmd
+}
+
+func listSecretsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List all secrets",
+		Example: "egctl secret list",
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(secretsURL), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func getSecretCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "get",
+		Short:   "Get the information of a secret",
+		Example: "egctl secret get <name>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires secret name to be retrieved")
+			}
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(secretURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func createSecretCmd() *cobra.Command {
+	var specFile string
+	cmd := &cobra.Command{
+		Use:     "create",
+		Short:   "Create a secret from a yaml file or stdin",
+		Example: "egctl secret create -f <secret file>",
+		Run: func(cmd *cobra.Command, args []string) {
+			visitor := buildYAMLVisitor(specFile, cmd)
+			visitor.Visit(func(yamlDoc []byte) error {
+				handleRequest(http.MethodPost, makeURL(secretsURL), yamlDoc, cmd)
+				return nil
+			})
+			visitor.Close()
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file specifying the secret.")
+
+	return cmd
+}
+
+func updateSecretCmd() *cobra.Command {
+	var specFile string
+	cmd := &cobra.Command{
+		Use:     "update",
+		Short:   "Update a secret from a yaml file or stdin",
+		Example: "egctl secret update <name> -f <secret file>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires secret name to be updated")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			visitor := buildYAMLVisitor(specFile, cmd)
+			visitor.Visit(func(yamlDoc []byte) error {
+				handleRequest(http.MethodPut, makeURL(secretURL, args[0]), yamlDoc, cmd)
+				return nil
+			})
+			visitor.Close()
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file specifying the secret.")
+
+	return cmd
+}
+
+func deleteSecretCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "delete",
+		Short:   "Delete a secret",
+		Example: "egctl secret delete <name>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires secret name to be deleted")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodDelete, makeURL(secretURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,377 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/megaease/easegress/pkg/object/httpserver"
+	"github.com/megaease/easegress/pkg/object/pipeline"
+	"github.com/megaease/easegress/pkg/secret"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+type (
+	sendOptions struct {
+		method      string
+		path        string
+		host        string
+		headers     []string
+		body        string
+		address     string
+		namespace   string
+		debugSecret string
+		include     bool
+		insecure    bool
+	}
+
+	// sendReport is the response and the execution report of the filters
+	// of a request, it is the same as the response of the dry run API.
+	sendReport struct {
+		Route      string        `json:"route,omitempty"`
+		Backend    string        `json:"backend,omitempty"`
+		Upstream   string        `json:"upstream,omitempty"`
+		Result     string        `json:"result,omitempty"`
+		StatusCode int           `json:"statusCode"`
+		Header     http.Header   `json:"header,omitempty"`
+		Body       string        `json:"body,omitempty"`
+		Truncated  bool          `json:"truncated,omitempty"`
+		Duration   string        `json:"duration"`
+		Filters    []*sendFilter `json:"filters"`
+	}
+
+	sendFilter struct {
+		Name     string `json:"name"`
+		Kind     string `json:"kind,omitempty"`
+		Result   string `json:"result,omitempty"`
+		Duration string `json:"duration"`
+	}
+)
+
+// SendCmd defines send command.
+func SendCmd() *cobra.Command {
+	opt := &sendOptions{}
+	cmd := &cobra.Command{
+		Use:   "send <HTTPServer or Pipeline name>",
+		Short: "Send a request to an HTTPServer or a pipeline and show the execution report of the filters",
+		Long: "Send a request to an HTTPServer or a pipeline and show the execution report of the filters. " +
+			"The request to an HTTPServer is sent to its port with a signed debug header, so the debug " +
+			"of the HTTPServer must be enabled to get the report. The request to a pipeline is run " +
+			"through the dry run API on the member, without an HTTPServer, but the filters are executed " +
+			"for real, e.g. the proxies send the request to the backends.",
+		Example: "egctl send http-server-example --path /pipeline -X POST -H 'Content-Type: application/json' -d '{}'",
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			// NOTE: The pipelines in other namespaces, e.g. the ones of
+			// the mesh, are not objects.
+			kind := pipeline.Kind
+			if opt.namespace == "" {
+				kind = getObjectKind(args[0], cmd)
+			}
+
+			var report *sendReport
+			switch kind {
+			case httpserver.Kind:
+				report = sendToHTTPServer(args[0], opt, cmd)
+			case pipeline.Kind:
+				report = sendToPipeline(args[0], opt, cmd)
+			default:
+				ExitWithErrorf("%s is a %s, only %s and %s are supported",
+					args[0], kind, httpserver.Kind, pipeline.Kind)
+			}
+
+			if cmd.Flags().Changed("output") {
+				printBody(codectool.MustMarshalJSON(report))
+			} else {
+				printSendReport(report, opt.include)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&opt.method, "request", "X", http.MethodGet, "The method of the request.")
+	cmd.Flags().StringVar(&opt.path, "path", "/", "The path of the request, including the query.")
+	cmd.Flags().StringVar(&opt.host, "host", "", "The host of the request.")
+	cmd.Flags().StringArrayVarP(&opt.headers, "header", "H", nil, "The headers of the request, e.g. 'Content-Type: application/json'.")
+	cmd.Flags().StringVarP(&opt.body, "data", "d", "", "The body of the request, read from a file if it starts with @.")
+	cmd.Flags().StringVar(&opt.address, "address", "", "The address of the HTTPServer, defaults to the host of the Easegress endpoint.")
+	cmd.Flags().StringVar(&opt.namespace, "namespace", "", "The traffic namespace of the pipeline.")
+	cmd.Flags().StringVar(&opt.debugSecret, "debug-secret", "", "The debug secret of the HTTPServer, defaults to the one in its spec.")
+	cmd.Flags().BoolVarP(&opt.include, "include", "i", false, "Show the headers of the response.")
+	cmd.Flags().BoolVarP(&opt.insecure, "insecure", "k", false, "Skip verifying the certificate of an HTTPS server.")
+
+	return cmd
+}
+
+func getObjectKind(name string, cmd *cobra.Command) string {
+	body := getJSON(makeURL(objectURL, name), cmd)
+	meta := &struct {
+		Kind string `json:"kind"`
+	}{}
+	if err := codectool.UnmarshalJSON(body, meta); err != nil {
+		ExitWithErrorf("unmarshal %s to json failed: %v", body, err)
+	}
+	return meta.Kind
+}
+
+func getJSON(u string, cmd *cobra.Command) []byte {
+	resp, err := http.Get(u)
+	if err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+	if !successfulStatusCode(resp.StatusCode) {
+		msg := string(body)
+		apiErr := &APIErr{}
+		if err = codectool.Unmarshal(body, apiErr); err == nil {
+			msg = apiErr.Message
+		}
+		ExitWithErrorf("%d: %s", resp.StatusCode, msg)
+	}
+	return body
+}
+
+func (opt *sendOptions) requestBody() []byte {
+	if !strings.HasPrefix(opt.body, "@") {
+		return []byte(opt.body)
+	}
+	body, err := os.ReadFile(opt.body[1:])
+	if err != nil {
+		ExitWithErrorf("read %s failed: %v", opt.body[1:], err)
+	}
+	return body
+}
+
+func (opt *sendOptions) requestHeader() http.Header {
+	header := http.Header{}
+	for _, h := range opt.headers {
+		k, v, ok := strings.Cut(h, ":")
+		if !ok {
+			ExitWithErrorf("invalid header %s, expecting 'Key: Value'", h)
+		}
+		header.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+	return header
+}
+
+func sendToPipeline(name string, opt *sendOptions, cmd *cobra.Command) *sendReport {
+	dr := map[string]interface{}{
+		"namespace": opt.namespace,
+		"method":    opt.method,
+		"path":      opt.path,
+		"host":      opt.host,
+		"header":    opt.requestHeader(),
+		"body":      string(opt.requestBody()),
+	}
+
+	resp, err := http.Post(makeURL(pipelineDryRunURL, name), "application/json",
+		bytes.NewReader(codectool.MustMarshalJSON(dr)))
+	if err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+	if !successfulStatusCode(resp.StatusCode) {
+		msg := string(body)
+		apiErr := &APIErr{}
+		if err = codectool.Unmarshal(body, apiErr); err == nil {
+			msg = apiErr.Message
+		}
+		ExitWithErrorf("%d: %s", resp.StatusCode, msg)
+	}
+
+	report := &sendReport{Backend: name}
+	if err = codectool.UnmarshalJSON(body, report); err != nil {
+		ExitWithErrorf("unmarshal %s to json failed: %v", body, err)
+	}
+	return report
+}
+
+func sendToHTTPServer(name string, opt *sendOptions, cmd *cobra.Command) *sendReport {
+	body := getJSON(makeURL(objectURL, name), cmd)
+	spec := &httpserver.Spec{}
+	if err := codectool.UnmarshalJSON(body, spec); err != nil {
+		ExitWithErrorf("unmarshal %s to json failed: %v", body, err)
+	}
+
+	debugSecret := opt.debugSecret
+	if debugSecret == "" && spec.Debug != nil {
+		debugSecret = spec.Debug.Secret
+		if _, ok := secret.ParseReference(debugSecret); ok {
+			ExitWithErrorf("the debug secret of %s is a secret reference, please specify it by --debug-secret", name)
+		}
+	}
+
+	address := opt.address
+	if address == "" {
+		host, _, err := net.SplitHostPort(CommandlineGlobalFlags.Server)
+		if err != nil {
+			host = CommandlineGlobalFlags.Server
+		}
+		address = net.JoinHostPort(host, strconv.Itoa(int(spec.Port)))
+	}
+	scheme := "http"
+	if spec.HTTPS {
+		scheme = "https"
+	}
+
+	req, err := http.NewRequest(opt.method, scheme+"://"+address+opt.path, bytes.NewReader(opt.requestBody()))
+	if err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+	req.Header = opt.requestHeader()
+	if opt.host != "" {
+		req.Host = opt.host
+	}
+	if debugSecret != "" {
+		req.Header.Set(httpserver.DebugHeader, httpserver.SignDebugHeader(debugSecret, time.Now()))
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: debug of %s is not enabled, the filters are not reported\n", name)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: opt.insecure},
+		},
+		// Report the redirections instead of following them.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	startAt := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+
+	report := &sendReport{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       string(respBody),
+		Duration:   time.Since(startAt).String(),
+		Filters:    []*sendFilter{},
+	}
+	parseDebugInfo(resp.Header.Get(httpserver.DebugInfoHeader), report)
+	resp.Header.Del(httpserver.DebugInfoHeader)
+
+	return report
+}
+
+// parseDebugInfo parses the debug info of HTTPServer into the report, its
+// format is "route=...; backend=...; upstream=...; filters=a(result,1ms)->b(2ms)".
+func parseDebugInfo(info string, report *sendReport) {
+	for _, field := range strings.Split(info, "; ") {
+		k, v, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "route":
+			report.Route = v
+		case "backend":
+			report.Backend = v
+		case "upstream":
+			report.Upstream = v
+		case "filters":
+			for _, f := range strings.Split(v, "->") {
+				name, detail, ok := strings.Cut(f, "(")
+				if !ok {
+					continue
+				}
+				filter := &sendFilter{Name: name}
+				detail = strings.TrimSuffix(detail, ")")
+				if i := strings.LastIndex(detail, ","); i >= 0 {
+					filter.Result, filter.Duration = detail[:i], detail[i+1:]
+				} else {
+					filter.Duration = detail
+				}
+				report.Filters = append(report.Filters, filter)
+			}
+		}
+	}
+}
+
+func printSendReport(report *sendReport, include bool) {
+	fmt.Printf("%d %s (%s)\n", report.StatusCode, http.StatusText(report.StatusCode), report.Duration)
+	if report.Route != "" {
+		fmt.Printf("route: %s\n", report.Route)
+	}
+	if report.Backend != "" {
+		fmt.Printf("backend: %s\n", report.Backend)
+	}
+	if report.Upstream != "" {
+		fmt.Printf("upstream: %s\n", report.Upstream)
+	}
+
+	if len(report.Filters) > 0 {
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "FILTER\tKIND\tRESULT\tDURATION")
+		for _, f := range report.Filters {
+			kind, result := f.Kind, f.Result
+			if kind == "" {
+				kind = "-"
+			}
+			if result == "" {
+				result = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.Name, kind, result, f.Duration)
+		}
+		w.Flush()
+	}
+
+	if include {
+		fmt.Println()
+		report.Header.Write(os.Stdout)
+	}
+
+	if report.Body != "" {
+		fmt.Println()
+		fmt.Println(report.Body)
+		if report.Truncated {
+			fmt.Println("... (truncated)")
+		}
+	}
+}
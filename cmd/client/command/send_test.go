@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/object/httpserver"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// newTestAPIServer starts a server of the handler as the Easegress
+// endpoint of the commands.
+func newTestAPIServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	server := httptest.NewServer(handler)
+
+	oldServer := CommandlineGlobalFlags.Server
+	CommandlineGlobalFlags.Server = strings.TrimPrefix(server.URL, "http://")
+	t.Cleanup(func() {
+		CommandlineGlobalFlags.Server = oldServer
+		server.Close()
+	})
+	return server
+}
+
+func TestParseDebugInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	report := &sendReport{}
+	parseDebugInfo("route=/api; backend=pipeline-a; upstream=http://127.0.0.1:9095; "+
+		"filters=validator(2ms)->mock(mocked,1ms)->proxy(a,b,3ms)", report)
+	assert.Equal("/api", report.Route)
+	assert.Equal("pipeline-a", report.Backend)
+	assert.Equal("http://127.0.0.1:9095", report.Upstream)
+	assert.Equal([]*sendFilter{
+		{Name: "validator", Duration: "2ms"},
+		{Name: "mock", Result: "mocked", Duration: "1ms"},
+		{Name: "proxy", Result: "a,b", Duration: "3ms"},
+	}, report.Filters)
+
+	report = &sendReport{}
+	parseDebugInfo("", report)
+	parseDebugInfo("invalid; filters=invalid", report)
+	assert.Empty(report.Route)
+	assert.Empty(report.Filters)
+}
+
+func TestSendOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	opt := &sendOptions{
+		headers: []string{"Content-Type: application/json", "X-A:1", "X-A: 2"},
+		body:    "hello",
+	}
+	header := opt.requestHeader()
+	assert.Equal("application/json", header.Get("Content-Type"))
+	assert.Equal([]string{"1", "2"}, header.Values("X-A"))
+	assert.Equal("hello", string(opt.requestBody()))
+
+	file := filepath.Join(t.TempDir(), "body.json")
+	assert.NoError(os.WriteFile(file, []byte(`{"a":1}`), 0o644))
+	opt.body = "@" + file
+	assert.Equal(`{"a":1}`, string(opt.requestBody()))
+}
+
+func TestSendToPipeline(t *testing.T) {
+	assert := assert.New(t)
+
+	var dr map[string]interface{}
+	newTestAPIServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(http.MethodPost, r.Method)
+		assert.Equal("/apis/v2/pipelines/pipeline-a/dryrun", r.URL.Path)
+		body, _ := io.ReadAll(r.Body)
+		codectool.MustUnmarshal(body, &dr)
+		w.Write([]byte(`{"result":"mocked","statusCode":200,"body":"hello","duration":"1ms",` +
+			`"filters":[{"name":"mock","kind":"Mock","result":"mocked","duration":"1ms"}]}`))
+	})
+
+	opt := &sendOptions{
+		method:  http.MethodPut,
+		path:    "/mock",
+		headers: []string{"X-A: 1"},
+		body:    "body",
+	}
+	report := sendToPipeline("pipeline-a", opt, &cobra.Command{Short: "send"})
+
+	assert.Equal(http.MethodPut, dr["method"])
+	assert.Equal("/mock", dr["path"])
+	assert.Equal("body", dr["body"])
+	assert.Equal(map[string]interface{}{"X-A": []interface{}{"1"}}, dr["header"])
+
+	assert.Equal("pipeline-a", report.Backend)
+	assert.Equal("mocked", report.Result)
+	assert.Equal(200, report.StatusCode)
+	assert.Equal("hello", report.Body)
+	assert.Len(report.Filters, 1)
+	assert.Equal("Mock", report.Filters[0].Kind)
+}
+
+func TestSendToHTTPServer(t *testing.T) {
+	assert := assert.New(t)
+
+	var port string
+	var debugHeader string
+	server := newTestAPIServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/apis/v2/objects/server-a" {
+			w.Write([]byte(`{"name":"server-a","kind":"HTTPServer","port":` + port +
+				`,"debug":{"secret":"secret"}}`))
+			return
+		}
+
+		assert.Equal("/api", r.URL.Path)
+		assert.Equal("example.com", r.Host)
+		debugHeader = r.Header.Get(httpserver.DebugHeader)
+		w.Header().Set(httpserver.DebugInfoHeader, "route=/api; backend=pipeline-a; filters=mock(mocked,1ms)")
+		w.Header().Set("Location", "/other")
+		w.WriteHeader(http.StatusFound)
+		w.Write([]byte("moved"))
+	})
+	port = server.URL[strings.LastIndex(server.URL, ":")+1:]
+
+	opt := &sendOptions{method: http.MethodGet, path: "/api", host: "example.com"}
+	report := sendToHTTPServer("server-a", opt, &cobra.Command{Short: "send"})
+
+	assert.NotEmpty(debugHeader)
+	assert.Equal(http.StatusFound, report.StatusCode)
+	assert.Equal("moved", report.Body)
+	assert.Equal("/other", report.Header.Get("Location"))
+	assert.Empty(report.Header.Get(httpserver.DebugInfoHeader))
+	assert.Equal("/api", report.Route)
+	assert.Equal("pipeline-a", report.Backend)
+	assert.Equal([]*sendFilter{{Name: "mock", Result: "mocked", Duration: "1ms"}}, report.Filters)
+
+	// the debug secret specified by the option takes precedence.
+	opt.debugSecret = "other"
+	sendToHTTPServer("server-a", opt, &cobra.Command{Short: "send"})
+	assert.NotEmpty(debugHeader)
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/spf13/cobra"
+)
+
+// SnapshotCmd defines snapshot command.
+func SnapshotCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "List, take, download and restore snapshots of the cluster configuration",
+	}
+
+	cmd.AddCommand(listSnapshotsCmd())
+	cmd.AddCommand(createSnapshotCmd())
+	cmd.AddCommand(downloadSnapshotCmd())
+	cmd.AddCommand(restoreSnapshotCmd())
+	return cmd
+}
+
+func listSnapshotsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List snapshots from the newest to the oldest",
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(snapshotsURL), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func createSnapshotCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Take a snapshot now",
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodPost, makeURL(snapshotsURL), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func downloadSnapshotCmd() *cobra.Command {
+	var file string
+	cmd := &cobra.Command{
+		Use:     "download",
+		Short:   "Download a snapshot",
+		Example: "egctl snapshot download <snapshot_name> --file <path/to/file>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one snapshot name")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			body := doSnapshotRequest(http.MethodGet, makeURL(snapshotURL, args[0]), nil, cmd)
+			if file == "" {
+				file = args[0]
+			}
+			if err := os.WriteFile(file, body, 0o600); err != nil {
+				ExitWithErrorf("%s failed: %v", cmd.Short, err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "The file to save the snapshot, defaults to the snapshot name.")
+
+	return cmd
+}
+
+func restoreSnapshotCmd() *cobra.Command {
+	var file string
+	cmd := &cobra.Command{
+		Use:   "restore",
+		Short: "Restore the cluster configuration from a stored snapshot or a snapshot file",
+		Example: "egctl snapshot restore <snapshot_name>\n" +
+			"egctl snapshot restore --file <path/to/snapshot-file>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if (file == "" && len(args) == 1) || (file != "" && len(args) == 0) {
+				return nil
+			}
+			return errors.New("requires one snapshot name or a snapshot file")
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			var body []byte
+			if file == "" {
+				body = doSnapshotRequest(http.MethodPost, makeURL(snapshotRestoreURL, args[0]), nil, cmd)
+			} else {
+				data, err := os.ReadFile(file)
+				if err != nil {
+					ExitWithErrorf("%s failed: %v", cmd.Short, err)
+				}
+				body = doSnapshotRequest(http.MethodPost, makeURL(restoreURL), data, cmd)
+			}
+			printBody(body)
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "The snapshot file to restore from.")
+
+	return cmd
+}
+
+// doSnapshotRequest sends the body as is and returns the raw response
+// body, as snapshots are gzipped files rather than yaml documents.
+func doSnapshotRequest(httpMethod string, url string, body []byte, cmd *cobra.Command) []byte {
+	req, err := http.NewRequest(httpMethod, url, bytes.NewReader(body))
+	if err != nil {
+		ExitWithError(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+
+	if !successfulStatusCode(resp.StatusCode) {
+		msg := string(respBody)
+		apiErr := &APIErr{}
+		if err := codectool.Unmarshal(respBody, apiErr); err == nil {
+			msg = apiErr.Message
+		}
+		ExitWithErrorf("%d: %s", resp.StatusCode, msg)
+	}
+
+	return respBody
+}
@@ -0,0 +1,248 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// clearScreen moves the cursor to the top left and clears the screen.
+	clearScreen = "\033[H\033[2J"
+	hideCursor  = "\033[?25l"
+	showCursor  = "\033[?25h"
+)
+
+type (
+	trafficSnapshot struct {
+		Timestamp int64              `json:"timestamp"`
+		Servers   []*trafficServer   `json:"servers"`
+		Pipelines []*trafficPipeline `json:"pipelines"`
+	}
+
+	trafficStat struct {
+		RPS        float64        `json:"rps"`
+		Count      uint64         `json:"count"`
+		ErrCount   uint64         `json:"errCount"`
+		ErrPercent float64        `json:"errPercent"`
+		P50        float64        `json:"p50"`
+		P95        float64        `json:"p95"`
+		P99        float64        `json:"p99"`
+		Codes      map[int]uint64 `json:"codes"`
+	}
+
+	trafficServer struct {
+		Name string `json:"name"`
+		trafficStat
+		TopN []*trafficRoute `json:"topN"`
+	}
+
+	trafficRoute struct {
+		Path string `json:"path"`
+		trafficStat
+	}
+
+	trafficPipeline struct {
+		Name string `json:"name"`
+		trafficStat
+	}
+)
+
+// TopCmd defines top command.
+func TopCmd() *cobra.Command {
+	var interval string
+	var topN int
+	var once bool
+	cmd := &cobra.Command{
+		Use:     "top",
+		Short:   "Watch the live traffic of HTTP servers and pipelines",
+		Example: "egctl top --interval 5s --top 5",
+		Run: func(cmd *cobra.Command, args []string) {
+			query := url.Values{}
+			if interval != "" {
+				if _, err := time.ParseDuration(interval); err != nil {
+					ExitWithErrorf("invalid interval %s: %v", interval, err)
+				}
+				query.Set("interval", interval)
+			}
+			if topN > 0 {
+				query.Set("topN", strconv.Itoa(topN))
+			}
+
+			u := makeURL(trafficURL)
+			if len(query) > 0 {
+				u += "?" + query.Encode()
+			}
+			watchTraffic(u, once, cmd)
+		},
+	}
+
+	cmd.Flags().StringVar(&interval, "interval", "", "The refresh interval, defaults to and no shorter than 5s.")
+	cmd.Flags().IntVar(&topN, "top", 0, "The max number of top routes of each HTTP server, defaults to 10.")
+	cmd.Flags().BoolVar(&once, "once", false, "Print one snapshot and exit, instead of refreshing the screen.")
+
+	return cmd
+}
+
+func watchTraffic(u string, once bool, cmd *cobra.Command) {
+	resp, err := http.Get(u)
+	if err != nil {
+		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+	}
+	defer resp.Body.Close()
+
+	if !successfulStatusCode(resp.StatusCode) {
+		body, _ := io.ReadAll(resp.Body)
+		msg := string(body)
+		apiErr := &APIErr{}
+		if err = codectool.Unmarshal(body, apiErr); err == nil {
+			msg = apiErr.Message
+		}
+		ExitWithErrorf("%d: %s", resp.StatusCode, msg)
+	}
+
+	if !once {
+		fmt.Print(hideCursor)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-signals
+			fmt.Print(showCursor)
+			os.Exit(0)
+		}()
+		defer fmt.Print(showCursor)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			if err == io.EOF {
+				return
+			}
+			ExitWithErrorf("%s failed: %v", cmd.Short, err)
+		}
+
+		snapshot := &trafficSnapshot{}
+		if err := codectool.UnmarshalJSON(line, snapshot); err != nil {
+			ExitWithErrorf("unmarshal %s to json failed: %v", line, err)
+		}
+
+		if once {
+			fmt.Print(renderTraffic(snapshot))
+			return
+		}
+		fmt.Print(clearScreen + renderTraffic(snapshot))
+	}
+}
+
+func renderTraffic(snapshot *trafficSnapshot) string {
+	buff := &bytes.Buffer{}
+
+	fmt.Fprintf(buff, "egctl top - %s, %s, %d servers, %d pipelines\n\n",
+		time.Unix(snapshot.Timestamp, 0).Format("15:04:05"), CommandlineGlobalFlags.Server,
+		len(snapshot.Servers), len(snapshot.Pipelines))
+
+	servers := snapshot.Servers
+	sort.SliceStable(servers, func(i, j int) bool {
+		return servers[i].RPS > servers[j].RPS
+	})
+
+	w := tabwriter.NewWriter(buff, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVER\tRPS\tREQUESTS\tERR%\tP50(ms)\tP95(ms)\tP99(ms)\tCODES")
+	for _, svr := range servers {
+		fmt.Fprintf(w, "%s\t%s\n", svr.Name, svr.trafficStat.columns())
+	}
+	w.Flush()
+
+	for _, svr := range servers {
+		if len(svr.TopN) == 0 {
+			continue
+		}
+		fmt.Fprintf(buff, "\nTOP ROUTES OF %s\n", svr.Name)
+		w = tabwriter.NewWriter(buff, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PATH\tRPS\tREQUESTS\tERR%\tP50(ms)\tP95(ms)\tP99(ms)\tCODES")
+		for _, route := range svr.TopN {
+			fmt.Fprintf(w, "%s\t%s\n", route.Path, route.trafficStat.columns())
+		}
+		w.Flush()
+	}
+
+	pipelines := snapshot.Pipelines
+	sort.SliceStable(pipelines, func(i, j int) bool {
+		return pipelines[i].RPS > pipelines[j].RPS
+	})
+
+	buff.WriteString("\n")
+	w = tabwriter.NewWriter(buff, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PIPELINE\tRPS\tREQUESTS\tERR%\tP50(ms)\tP95(ms)\tP99(ms)\tCODES")
+	for _, p := range pipelines {
+		fmt.Fprintf(w, "%s\t%s\n", p.Name, p.trafficStat.columns())
+	}
+	w.Flush()
+
+	return buff.String()
+}
+
+func (ts *trafficStat) columns() string {
+	return fmt.Sprintf("%.1f\t%d\t%.1f\t%.1f\t%.1f\t%.1f\t%s",
+		ts.RPS, ts.Count, ts.ErrPercent, ts.P50, ts.P95, ts.P99, ts.codeClasses())
+}
+
+// codeClasses returns the percentages of the status code classes,
+// e.g. 2xx:99.0% 5xx:1.0%.
+func (ts *trafficStat) codeClasses() string {
+	var total uint64
+	classes := map[int]uint64{}
+	for code, count := range ts.Codes {
+		classes[code/100] += count
+		total += count
+	}
+	if total == 0 {
+		return "-"
+	}
+
+	keys := make([]int, 0, len(classes))
+	for k := range classes {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%dxx:%.1f%%", k, float64(classes[k])/float64(total)*100))
+	}
+	return strings.Join(parts, " ")
+}
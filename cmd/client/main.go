@@ -70,6 +70,39 @@ var exampleUsage = `  # List APIs.
 
   # Get object status
   egctl object status get <object_name>
+
+  # List revisions of an object.
+  egctl object history <object_name>
+
+  # Show the difference of an object between two revisions.
+  egctl object diff <object_name> --from <revision> --to <revision>
+
+  # Roll back objects to a revision.
+  egctl object rollback [<object_name>...] --revision <revision>
+
+  # Show the changes of applying objects from a yaml file.
+  egctl object apply -f <bundle.yaml> --dry-run
+
+  # Apply objects from a yaml file all-or-nothing, and delete other objects.
+  egctl object apply -f <bundle.yaml> --prune
+
+  # List changes of an object in the last 24 hours.
+  egctl audit --object <object_name> --since 24h
+
+  # Watch the live traffic of HTTP servers and pipelines.
+  egctl top
+
+  # Validate specs of a directory offline.
+  egctl lint -f <spec_dir> -o json
+
+  # Show the differences between local specs and the live objects.
+  egctl diff -f <spec_dir>
+
+  # Send a request to an HTTPServer and show the report of the filters.
+  egctl send <http_server_name> --path <path>
+
+  # Export the flow of a pipeline as a Mermaid graph.
+  egctl graph <pipeline_name> --format mermaid
 `
 
 func main() {
@@ -112,7 +145,15 @@ func main() {
 		command.WasmCmd(),
 		command.CustomDataKindCmd(),
 		command.CustomDataCmd(),
+		command.SecretCmd(),
 		command.ProfileCmd(),
+		command.AuditCmd(),
+		command.SnapshotCmd(),
+		command.TopCmd(),
+		command.LintCmd(),
+		command.DiffCmd(),
+		command.SendCmd(),
+		command.GraphCmd(),
 		completionCmd,
 	)
 
@@ -28,6 +28,7 @@ import (
 	"github.com/megaease/easegress/pkg/cluster"
 	"github.com/megaease/easegress/pkg/common"
 	"github.com/megaease/easegress/pkg/env"
+	"github.com/megaease/easegress/pkg/filters"
 	"github.com/megaease/easegress/pkg/graceupdate"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/option"
@@ -35,6 +36,7 @@ import (
 	"github.com/megaease/easegress/pkg/profile"
 	_ "github.com/megaease/easegress/pkg/registry"
 	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/prometheushelper"
 	"github.com/megaease/easegress/pkg/version"
 )
 
@@ -60,6 +62,8 @@ func main() {
 	defer logger.Sync()
 	logger.Infof("%s", version.Long)
 
+	prometheushelper.Init(opt.MetricsLabels, opt.MetricsMaxLabelValues)
+
 	if opt.SignalUpgrade {
 		pid, err := pidfile.Read(opt)
 
@@ -78,6 +82,8 @@ func main() {
 		return
 	}
 
+	graceupdate.SetDrainTimeout(opt.GetUpgradeDrainTimeout())
+
 	// disable force-new-cluster for graceful update
 	if graceupdate.IsInherit() {
 		opt.ForceNewCluster = false
@@ -89,6 +95,11 @@ func main() {
 		}
 	}
 
+	if err := filters.LoadPlugins(opt.Plugins); err != nil {
+		logger.Errorf("%v", err)
+		os.Exit(1)
+	}
+
 	profile, err := profile.New(opt)
 	if err != nil {
 		logger.Errorf("new profile failed: %v", err)
@@ -100,11 +100,19 @@ func (s *Server) registerAPIs() {
 	group.Entries = append(group.Entries, s.listAPIEntries()...)
 	group.Entries = append(group.Entries, s.memberAPIEntries()...)
 	group.Entries = append(group.Entries, s.objectAPIEntries()...)
+	group.Entries = append(group.Entries, s.historyAPIEntries()...)
+	group.Entries = append(group.Entries, s.bundleAPIEntries()...)
+	group.Entries = append(group.Entries, s.auditAPIEntries()...)
+	group.Entries = append(group.Entries, s.snapshotAPIEntries()...)
 	group.Entries = append(group.Entries, s.metadataAPIEntries()...)
 	group.Entries = append(group.Entries, s.healthAPIEntries()...)
 	group.Entries = append(group.Entries, s.aboutAPIEntries()...)
 	group.Entries = append(group.Entries, s.customDataAPIEntries()...)
+	group.Entries = append(group.Entries, s.secretAPIEntries()...)
 	group.Entries = append(group.Entries, s.profileAPIEntries()...)
+	group.Entries = append(group.Entries, s.metricsAPIEntries()...)
+	group.Entries = append(group.Entries, s.trafficAPIEntries()...)
+	group.Entries = append(group.Entries, s.openAPIAPIEntries()...)
 
 	for _, fn := range appendAddonAPIs {
 		fn(s, group)
@@ -123,17 +131,6 @@ func (s *Server) listAPIEntries() []*Entry {
 	}
 }
 
-func (s *Server) healthAPIEntries() []*Entry {
-	return []*Entry{
-		{
-			// https://stackoverflow.com/a/43381061/1705845
-			Path:    "/healthz",
-			Method:  "GET",
-			Handler: func(w http.ResponseWriter, r *http.Request) { /* 200 by default */ },
-		},
-	}
-}
-
 func (s *Server) aboutAPIEntries() []*Entry {
 	return []*Entry{
 		{
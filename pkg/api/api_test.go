@@ -0,0 +1,176 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+type (
+	// testCluster is an in-memory cluster for the API tests.
+	testCluster struct {
+		*clustertest.MockedCluster
+
+		mutex sync.Mutex
+		kvs   map[string]string
+	}
+
+	testMutex struct{}
+)
+
+func (m *testMutex) Lock() error   { return nil }
+func (m *testMutex) Unlock() error { return nil }
+
+func newTestCluster() *testCluster {
+	c := &testCluster{
+		MockedCluster: clustertest.NewMockedCluster(),
+		kvs:           map[string]string{},
+	}
+
+	c.MockedGet = func(key string) (*string, error) {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if v, ok := c.kvs[key]; ok {
+			return &v, nil
+		}
+		return nil, nil
+	}
+	c.MockedGetPrefix = func(prefix string) (map[string]string, error) {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		kvs := map[string]string{}
+		for k, v := range c.kvs {
+			if strings.HasPrefix(k, prefix) {
+				kvs[k] = v
+			}
+		}
+		return kvs, nil
+	}
+	c.MockedGetWithOp = func(key string, ops ...cluster.ClientOp) (map[string]string, error) {
+		for _, op := range ops {
+			if op == cluster.OpPrefix {
+				return c.MockedGetPrefix(key)
+			}
+		}
+		kvs := map[string]string{}
+		if v, _ := c.MockedGet(key); v != nil {
+			kvs[key] = *v
+		}
+		return kvs, nil
+	}
+	c.MockedGetPrefixBefore = func(prefix, before string, limit int) ([]*mvccpb.KeyValue, error) {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		keys := []string{}
+		for k := range c.kvs {
+			if strings.HasPrefix(k, prefix) && (before == "" || k < before) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+		if len(keys) > limit {
+			keys = keys[:limit]
+		}
+		kvs := make([]*mvccpb.KeyValue, 0, len(keys))
+		for _, k := range keys {
+			kvs = append(kvs, &mvccpb.KeyValue{Key: []byte(k), Value: []byte(c.kvs[k])})
+		}
+		return kvs, nil
+	}
+	c.MockedPut = func(key, value string) error {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		c.kvs[key] = value
+		return nil
+	}
+	c.MockedPutAndDelete = func(kvs map[string]*string) error {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		for k, v := range kvs {
+			if v == nil {
+				delete(c.kvs, k)
+			} else {
+				c.kvs[k] = *v
+			}
+		}
+		return nil
+	}
+	c.MockedDelete = func(key string) error {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		delete(c.kvs, key)
+		return nil
+	}
+	c.MockedDeletePrefix = func(prefix string) error {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		for k := range c.kvs {
+			if strings.HasPrefix(k, prefix) {
+				delete(c.kvs, k)
+			}
+		}
+		return nil
+	}
+	c.MockedMutex = func(name string) (cluster.Mutex, error) {
+		return &testMutex{}, nil
+	}
+
+	return c
+}
+
+// keys returns the sorted keys with the prefix.
+func (c *testCluster) keys(prefix string) []string {
+	kvs, _ := c.GetPrefix(prefix)
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func newTestServer(cls *testCluster) *Server {
+	return &Server{cluster: cls, super: supervisor.NewDefaultMock()}
+}
+
+// serve calls the handler with a request of the method and the body.
+func serve(handler http.HandlerFunc, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	handler(w, r)
+	return w
+}
@@ -0,0 +1,361 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// AuditPrefix is the path to query audit entries.
+	AuditPrefix = "/audit"
+
+	defaultAuditLimit   = 100
+	auditPageSize       = 128
+	auditPruneInterval  = 10 * time.Minute
+	auditPruneBatchSize = 128
+
+	actorSourceMTLS      = "mtls"
+	actorSourceToken     = "token"
+	actorSourceBasic     = "basic"
+	actorSourceAnonymous = "anonymous"
+)
+
+type (
+	// AuditEntry is the audit entry of a change by the administration API.
+	AuditEntry struct {
+		Time       string      `json:"time"`
+		Member     string      `json:"member"`
+		Actor      *AuditActor `json:"actor"`
+		Method     string      `json:"method"`
+		Path       string      `json:"path"`
+		StatusCode int         `json:"statusCode"`
+		// Revision is the config version after the change, it is empty if
+		// no object was changed.
+		Revision int64          `json:"revision,omitempty"`
+		Objects  []*AuditObject `json:"objects,omitempty"`
+	}
+
+	// AuditActor is the identity of who made the change.
+	//
+	// NOTE: The administration API doesn't authenticate the requests by
+	// itself, so only the identity of a mTLS peer certificate verified by
+	// the server is Verified. Otherwise, it is taken from the unverified
+	// peer certificate, bearer token or basic auth of the request.
+	AuditActor struct {
+		Name       string `json:"name,omitempty"`
+		Source     string `json:"source"`
+		Verified   bool   `json:"verified"`
+		RemoteAddr string `json:"remoteAddr"`
+	}
+
+	// AuditObject is a changed object in an audit entry.
+	AuditObject struct {
+		Name    string `json:"name"`
+		Action  string `json:"action"`
+		Summary string `json:"summary"`
+	}
+
+	// auditRecord collects the details of a change from the handlers.
+	auditRecord struct {
+		mutex    sync.Mutex
+		revision int64
+		objects  []*AuditObject
+	}
+
+	auditRecordKey struct{}
+)
+
+func (s *Server) auditAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    AuditPrefix,
+			Method:  "GET",
+			Handler: s.listAuditEntries,
+		},
+	}
+}
+
+// auditChanges attaches the changed objects to the audit entry of the request.
+func auditChanges(r *http.Request, revision int64, changes []*objectChange) {
+	record, ok := r.Context().Value(auditRecordKey{}).(*auditRecord)
+	if !ok {
+		return
+	}
+
+	record.mutex.Lock()
+	defer record.mutex.Unlock()
+
+	record.revision = revision
+	for _, c := range changes {
+		record.objects = append(record.objects, &AuditObject{
+			Name:    c.name,
+			Action:  c.action,
+			Summary: c.summary,
+		})
+	}
+}
+
+func isMutation(r *http.Request) bool {
+	return r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions
+}
+
+// tokenIdentity returns the fingerprint of the token, the claims of the
+// token are never trusted as it is not verified here.
+func tokenIdentity(token string) string {
+	// NOTE: Never record the token itself.
+	sum := sha256.Sum256([]byte(token))
+	return "sha256:" + hex.EncodeToString(sum[:])[:16]
+}
+
+func auditActor(r *http.Request) *AuditActor {
+	actor := &AuditActor{Source: actorSourceAnonymous, RemoteAddr: r.RemoteAddr}
+
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		cert := r.TLS.PeerCertificates[0]
+		actor.Source = actorSourceMTLS
+		actor.Name = cert.Subject.CommonName
+		// prefer the SPIFFE ID.
+		if len(cert.URIs) > 0 {
+			actor.Name = cert.URIs[0].String()
+		}
+		// the certificate is verified only if the server requires it.
+		actor.Verified = len(r.TLS.VerifiedChains) > 0
+		return actor
+	}
+
+	const prefix = "Bearer "
+	if auth := r.Header.Get("Authorization"); len(auth) > len(prefix) &&
+		strings.EqualFold(auth[:len(prefix)], prefix) {
+		actor.Source = actorSourceToken
+		actor.Name = tokenIdentity(auth[len(prefix):])
+		return actor
+	}
+
+	if user, _, ok := r.BasicAuth(); ok {
+		actor.Source = actorSourceBasic
+		actor.Name = user
+	}
+
+	return actor
+}
+
+func (m *dynamicMux) newAuditor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isMutation(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		record := &auditRecord{}
+		r = r.WithContext(context.WithValue(r.Context(), auditRecordKey{}, record))
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		defer func() {
+			record.mutex.Lock()
+			defer record.mutex.Unlock()
+
+			m.server.recordAudit(&AuditEntry{
+				Time:       time.Now().Format(time.RFC3339Nano),
+				Member:     m.server.opt.Name,
+				Actor:      auditActor(r),
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				StatusCode: ww.Status(),
+				Revision:   record.revision,
+				Objects:    record.objects,
+			})
+		}()
+
+		next.ServeHTTP(ww, r)
+	})
+}
+
+// recordAudit streams the audit entry to the log, and stores it in the
+// cluster if the retention is not zero.
+func (s *Server) recordAudit(entry *AuditEntry) {
+	data := codectool.MustMarshalJSON(entry)
+	logger.AdminAudit(string(data))
+
+	if s.opt.GetAuditRetention() == 0 {
+		return
+	}
+
+	key := s.cluster.Layout().AuditKey(time.Now().UnixNano())
+	if err := s.cluster.Put(key, string(data)); err != nil {
+		logger.Errorf("store audit entry failed: %v", err)
+	}
+}
+
+// runAuditPruner removes the expired audit entries in the leader.
+func (s *Server) runAuditPruner() {
+	retention := s.opt.GetAuditRetention()
+	if retention == 0 {
+		return
+	}
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-time.After(auditPruneInterval):
+		}
+
+		if !s.cluster.IsLeader() {
+			continue
+		}
+
+		if err := s.pruneAudit(time.Now().Add(-retention)); err != nil {
+			logger.Errorf("prune audit entries failed: %v", err)
+		}
+	}
+}
+
+func (s *Server) pruneAudit(before time.Time) error {
+	layout := s.cluster.Layout()
+	kvs, err := s.cluster.GetWithOp(layout.AuditPrefix(), cluster.OpPrefix, cluster.OpKeysOnly)
+	if err != nil {
+		return err
+	}
+
+	// keys are ordered by time, the member name doesn't matter here.
+	boundary := layout.AuditKey(before.UnixNano())
+	deletions := map[string]*string{}
+	for k := range kvs {
+		if k >= boundary {
+			continue
+		}
+		deletions[k] = nil
+		if len(deletions) < auditPruneBatchSize {
+			continue
+		}
+		if err := s.cluster.PutAndDelete(deletions); err != nil {
+			return err
+		}
+		deletions = map[string]*string{}
+	}
+
+	if len(deletions) == 0 {
+		return nil
+	}
+	return s.cluster.PutAndDelete(deletions)
+}
+
+func parseSince(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func (e *AuditEntry) hasObject(name string) bool {
+	for _, o := range e.Objects {
+		if o.Name == name {
+			return true
+		}
+	}
+	// changes of secrets, custom data, etc.
+	return strings.HasSuffix(e.Path, "/"+name)
+}
+
+// listAuditEntries lists audit entries from the newest to the oldest, they
+// can be filtered by object, actor and since, which is a RFC3339 time or a
+// duration before now.
+func (s *Server) listAuditEntries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	since, err := parseSince(query.Get("since"))
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid since: %v", err))
+		return
+	}
+
+	limit := defaultAuditLimit
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid limit: %s", value))
+			return
+		}
+	}
+
+	// the keys are ordered by time, so the entries are read page by page
+	// from the newest, until there are enough entries or all are read.
+	prefix := s.cluster.Layout().AuditPrefix()
+	object, actor := query.Get("object"), query.Get("actor")
+	entries := []*AuditEntry{}
+	before := ""
+
+pages:
+	for {
+		kvs, err := s.cluster.GetPrefixBefore(prefix, before, auditPageSize)
+		if err != nil {
+			ClusterPanic(err)
+		}
+
+		for _, kv := range kvs {
+			entry := &AuditEntry{}
+			if err := codectool.UnmarshalJSON(kv.Value, entry); err != nil {
+				logger.Errorf("bad audit entry(err: %v) from json: %s", err, kv.Value)
+				continue
+			}
+
+			if !since.IsZero() {
+				t, err := time.Parse(time.RFC3339Nano, entry.Time)
+				if err == nil && t.Before(since) {
+					break pages
+				}
+			}
+			if object != "" && !entry.hasObject(object) {
+				continue
+			}
+			if actor != "" && (entry.Actor == nil || entry.Actor.Name != actor) {
+				continue
+			}
+
+			entries = append(entries, entry)
+			if len(entries) >= limit {
+				break pages
+			}
+		}
+
+		if len(kvs) < auditPageSize {
+			break
+		}
+		before = string(kvs[len(kvs)-1].Key)
+	}
+
+	WriteBody(w, r, entries)
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func newAuditTestServer() (*Server, *testCluster) {
+	cls := newTestCluster()
+	cls.MockedLayout = func() *cluster.Layout {
+		return &cluster.Layout{}
+	}
+	s := newTestServer(cls)
+	s.opt = &option.Options{Name: "member-1", AuditRetention: "1h"}
+	return s, cls
+}
+
+func listTestAuditEntries(s *Server, query string) []*AuditEntry {
+	w := serve(s.listAuditEntries, http.MethodGet, AuditPrefix+"?"+query, "")
+	entries := []*AuditEntry{}
+	codectool.MustUnmarshal(w.Body.Bytes(), &entries)
+	return entries
+}
+
+func TestAuditActor(t *testing.T) {
+	assert := assert.New(t)
+	s, _ := newAuditTestServer()
+	m := &dynamicMux{server: s}
+
+	audit := func(r *http.Request) *AuditActor {
+		noop := func(w http.ResponseWriter, r *http.Request) {}
+		m.newAuditor(http.HandlerFunc(noop)).ServeHTTP(httptest.NewRecorder(), r)
+
+		entries := listTestAuditEntries(s, "limit=1")
+		if !assert.Len(entries, 1) {
+			return nil
+		}
+		return entries[0].Actor
+	}
+	newRequest := func() *http.Request {
+		return httptest.NewRequest(http.MethodPost, "/objects", nil)
+	}
+
+	// the claims of an unverified token are never trusted, even if it
+	// is a JWT, the unsigned token here claims to be alice.
+	token := "eyJhbGciOiJub25lIn0.eyJzdWIiOiJhbGljZSJ9."
+	req := newRequest()
+	req.Header.Set("Authorization", "Bearer "+token)
+	actor := audit(req)
+	assert.Equal(actorSourceToken, actor.Source)
+	assert.Equal(tokenIdentity(token), actor.Name)
+	assert.NotEqual("alice", actor.Name)
+	assert.False(actor.Verified)
+
+	// the peer certificate is preferred, and it is verified only if the
+	// server verified its chain.
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "bob"}}
+	req = newRequest()
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	actor = audit(req)
+	assert.Equal(actorSourceMTLS, actor.Source)
+	assert.Equal("bob", actor.Name)
+	assert.False(actor.Verified)
+
+	spiffeID, _ := url.Parse("spiffe://example.org/bob")
+	cert.URIs = []*url.URL{spiffeID}
+	req = newRequest()
+	req.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+	actor = audit(req)
+	assert.Equal("spiffe://example.org/bob", actor.Name)
+	assert.True(actor.Verified)
+
+	req = newRequest()
+	req.SetBasicAuth("carol", "password")
+	actor = audit(req)
+	assert.Equal(actorSourceBasic, actor.Source)
+	assert.Equal("carol", actor.Name)
+	assert.False(actor.Verified)
+
+	actor = audit(newRequest())
+	assert.Equal(actorSourceAnonymous, actor.Source)
+	assert.False(actor.Verified)
+}
+
+func TestListAuditEntries(t *testing.T) {
+	assert := assert.New(t)
+	s, cls := newAuditTestServer()
+
+	start := time.Now().Add(-time.Hour)
+	total := auditPageSize*2 + 10
+	for i := 0; i < total; i++ {
+		actor := "alice"
+		if i%2 == 1 {
+			actor = "bob"
+		}
+		entry := &AuditEntry{
+			Time:   start.Add(time.Duration(i) * time.Second).Format(time.RFC3339Nano),
+			Actor:  &AuditActor{Name: actor},
+			Method: http.MethodPut,
+			Path:   fmt.Sprintf("/objects/object-%d", i),
+		}
+		key := cls.Layout().AuditKey(start.UnixNano() + int64(i))
+		cls.Put(key, string(codectool.MustMarshalJSON(entry)))
+	}
+
+	pages := 0
+	getPage := cls.MockedGetPrefixBefore
+	cls.MockedGetPrefixBefore = func(prefix, before string, limit int) ([]*mvccpb.KeyValue, error) {
+		pages++
+		return getPage(prefix, before, limit)
+	}
+
+	// the newest entries are read from the first page only.
+	entries := listTestAuditEntries(s, "limit=10")
+	assert.Len(entries, 10)
+	assert.Equal(fmt.Sprintf("/objects/object-%d", total-1), entries[0].Path)
+	assert.Equal(1, pages)
+
+	// entries are read across pages.
+	pages = 0
+	entries = listTestAuditEntries(s, fmt.Sprintf("limit=%d", total))
+	assert.Len(entries, total)
+	assert.Equal("/objects/object-0", entries[total-1].Path)
+	assert.Equal(3, pages)
+
+	entries = listTestAuditEntries(s, "actor=bob&limit=1000")
+	assert.Len(entries, total/2)
+	for _, e := range entries {
+		assert.Equal("bob", e.Actor.Name)
+	}
+
+	entries = listTestAuditEntries(s, "object=object-3")
+	assert.Len(entries, 1)
+
+	// reading stops at the first entry older than since.
+	pages = 0
+	since := start.Add(time.Duration(total-5) * time.Second).Format(time.RFC3339)
+	entries = listTestAuditEntries(s, "since="+since)
+	assert.Len(entries, 5)
+	assert.Equal(1, pages)
+
+	w := serve(s.listAuditEntries, http.MethodGet, AuditPrefix+"?limit=0", "")
+	assert.Equal(http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,326 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/megaease/easegress/pkg/filters/proxy"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	defaultBlueGreenSwitchTimeout = 10 * time.Second
+	blueGreenAckPollInterval      = 200 * time.Millisecond
+)
+
+type (
+	// BlueGreenRouteStatus is the status of a blue/green route.
+	BlueGreenRouteStatus struct {
+		Route        string                                 `json:"route"`
+		Active       *proxy.BlueGreenState                  `json:"active,omitempty"`
+		Pending      *proxy.BlueGreenPrepare                `json:"pending,omitempty"`
+		Participants map[string]*proxy.BlueGreenParticipant `json:"participants"`
+	}
+
+	// BlueGreenSwitchResult is the result of a blue/green switch.
+	BlueGreenSwitchResult struct {
+		State *proxy.BlueGreenState `json:"state"`
+		Acks  []*proxy.BlueGreenAck `json:"acks"`
+	}
+)
+
+func (s *Server) blueGreenParticipants(route string) map[string]*proxy.BlueGreenParticipant {
+	prefix := s.cluster.Layout().BlueGreenParticipantPrefix(route)
+	kvs, err := s.cluster.GetPrefix(prefix)
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	participants := make(map[string]*proxy.BlueGreenParticipant, len(kvs))
+	for k, v := range kvs {
+		p := &proxy.BlueGreenParticipant{}
+		if err = codectool.UnmarshalJSON([]byte(v), p); err != nil {
+			continue
+		}
+		participants[strings.TrimPrefix(k, prefix)] = p
+	}
+	return participants
+}
+
+func (s *Server) blueGreenState(route string) *proxy.BlueGreenState {
+	value, err := s.cluster.Get(s.cluster.Layout().BlueGreenActiveKey(route))
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if value == nil {
+		return nil
+	}
+
+	state := &proxy.BlueGreenState{}
+	if err = codectool.UnmarshalJSON([]byte(*value), state); err != nil {
+		return nil
+	}
+	return state
+}
+
+// blueGreenPending returns the prepare of the switch in progress of the
+// route, or nil if there's none.
+func (s *Server) blueGreenPending(route string) *proxy.BlueGreenPrepare {
+	value, err := s.cluster.Get(s.cluster.Layout().BlueGreenPrepareKey(route))
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if value == nil {
+		return nil
+	}
+
+	prepare := &proxy.BlueGreenPrepare{}
+	if err = codectool.UnmarshalJSON([]byte(*value), prepare); err != nil {
+		return nil
+	}
+	return prepare
+}
+
+func (s *Server) blueGreenGetRoute(w http.ResponseWriter, r *http.Request) {
+	route := chi.URLParam(r, "route")
+
+	status := &BlueGreenRouteStatus{
+		Route:        route,
+		Active:       s.blueGreenState(route),
+		Participants: s.blueGreenParticipants(route),
+	}
+	if len(status.Participants) == 0 && status.Active == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("route %s not found", route))
+		return
+	}
+
+	status.Pending = s.blueGreenPending(route)
+	WriteBody(w, r, status)
+}
+
+// blueGreenPrepare starts the prepare phase of a switch. The cluster lock
+// is only held while writing the prepare, which marks the switch in
+// progress of the route, so that the acknowledgements are waited for
+// without blocking other changes.
+func (s *Server) blueGreenPrepare(route, color string, timeout time.Duration) (map[string]*proxy.BlueGreenParticipant, *proxy.BlueGreenPrepare, int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	participants := s.blueGreenParticipants(route)
+	if len(participants) == 0 {
+		return nil, nil, http.StatusNotFound, fmt.Errorf("route %s has no participants", route)
+	}
+
+	now := time.Now()
+	if pending := s.blueGreenPending(route); pending != nil && now.Before(pending.Deadline) {
+		return nil, nil, http.StatusConflict, fmt.Errorf("route %s is being switched to %s", route, pending.Color)
+	}
+
+	// clear acknowledgements of previous switches before preparing.
+	layout := s.cluster.Layout()
+	if err := s.cluster.DeletePrefix(layout.BlueGreenAckPrefix(route)); err != nil {
+		ClusterPanic(err)
+	}
+	prepare := &proxy.BlueGreenPrepare{TxID: uuid.NewString(), Color: color, Deadline: now.Add(timeout)}
+	if err := s.cluster.Put(layout.BlueGreenPrepareKey(route), string(codectool.MustMarshalJSON(prepare))); err != nil {
+		ClusterPanic(err)
+	}
+
+	return participants, prepare, 0, nil
+}
+
+// blueGreenAbort removes the prepare of the switch, unless it has been
+// taken over by another switch after its deadline.
+func (s *Server) blueGreenAbort(route string, prepare *proxy.BlueGreenPrepare) {
+	s.Lock()
+	defer s.Unlock()
+
+	if pending := s.blueGreenPending(route); pending == nil || pending.TxID != prepare.TxID {
+		return
+	}
+	if err := s.cluster.Delete(s.cluster.Layout().BlueGreenPrepareKey(route)); err != nil {
+		ClusterPanic(err)
+	}
+}
+
+// blueGreenCommit commits the new color and cleans up the prepare phase
+// atomically, it fails if the switch has been taken over by another one.
+func (s *Server) blueGreenCommit(route string, prepare *proxy.BlueGreenPrepare, ids []string) (*proxy.BlueGreenState, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if pending := s.blueGreenPending(route); pending == nil || pending.TxID != prepare.TxID {
+		return nil, fmt.Errorf("switch of route %s is taken over by another switch", route)
+	}
+
+	state := &proxy.BlueGreenState{Color: prepare.Color, Version: 1, TxID: prepare.TxID, UpdatedAt: time.Now()}
+	if old := s.blueGreenState(route); old != nil {
+		state.Version = old.Version + 1
+	}
+
+	layout := s.cluster.Layout()
+	ackPrefix := layout.BlueGreenAckPrefix(route)
+	value := string(codectool.MustMarshalJSON(state))
+	kvs := map[string]*string{
+		layout.BlueGreenActiveKey(route):  &value,
+		layout.BlueGreenPrepareKey(route): nil,
+	}
+	for _, id := range ids {
+		kvs[ackPrefix+id] = nil
+	}
+	if err := s.cluster.PutAndDelete(kvs); err != nil {
+		ClusterPanic(err)
+	}
+
+	return state, nil
+}
+
+// blueGreenSwitch switches a blue/green route by two-phase commit. In the
+// prepare phase, every participant of the route acknowledges whether it is
+// ready to serve the new color, and the new color is committed only if all
+// participants are ready, otherwise, the switch is aborted and nothing
+// changes. Only one switch of a route is in progress at a time.
+func (s *Server) blueGreenSwitch(w http.ResponseWriter, r *http.Request) {
+	route := chi.URLParam(r, "route")
+	color := r.URL.Query().Get("color")
+	if color != proxy.ColorBlue && color != proxy.ColorGreen {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("color must be %s or %s", proxy.ColorBlue, proxy.ColorGreen))
+		return
+	}
+
+	timeout := defaultBlueGreenSwitchTimeout
+	if t := r.URL.Query().Get("timeout"); t != "" {
+		d, err := time.ParseDuration(t)
+		if err != nil || d <= 0 {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid timeout %s", t))
+			return
+		}
+		timeout = d
+	}
+	if timeout < blueGreenAckPollInterval {
+		HandleAPIError(w, r, http.StatusBadRequest,
+			fmt.Errorf("timeout %s is shorter than the poll interval %s", timeout, blueGreenAckPollInterval))
+		return
+	}
+
+	participants, prepare, code, err := s.blueGreenPrepare(route, color, timeout)
+	if err != nil {
+		HandleAPIError(w, r, code, err)
+		return
+	}
+
+	abort := func(code int, reason string) {
+		s.blueGreenAbort(route, prepare)
+		HandleAPIError(w, r, code, fmt.Errorf("switch of route %s aborted: %s", route, reason))
+	}
+
+	ackPrefix := s.cluster.Layout().BlueGreenAckPrefix(route)
+	acks := map[string]*proxy.BlueGreenAck{}
+	for {
+		kvs, err := s.cluster.GetPrefix(ackPrefix)
+		if err != nil {
+			abort(http.StatusInternalServerError, err.Error())
+			return
+		}
+		for k, v := range kvs {
+			ack := &proxy.BlueGreenAck{}
+			if codectool.UnmarshalJSON([]byte(v), ack) != nil || ack.TxID != prepare.TxID {
+				continue
+			}
+			acks[strings.TrimPrefix(k, ackPrefix)] = ack
+		}
+
+		// participants gone during the switch are not waited for.
+		current := s.blueGreenParticipants(route)
+		done := true
+		for id := range participants {
+			if _, ok := current[id]; !ok {
+				delete(participants, id)
+			} else if _, ok = acks[id]; !ok {
+				done = false
+			}
+		}
+		if done || time.Now().After(prepare.Deadline) {
+			break
+		}
+		time.Sleep(blueGreenAckPollInterval)
+	}
+
+	ids := make([]string, 0, len(participants))
+	for id := range participants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	result := &BlueGreenSwitchResult{}
+	var notReady, noAck []string
+	for _, id := range ids {
+		ack := acks[id]
+		if ack == nil {
+			noAck = append(noAck, id)
+			continue
+		}
+		result.Acks = append(result.Acks, ack)
+		if ack.Error != "" {
+			notReady = append(notReady, fmt.Sprintf("%s: %s", id, ack.Error))
+		}
+	}
+
+	if len(notReady) > 0 {
+		abort(http.StatusConflict, "participants not ready: "+strings.Join(notReady, "; "))
+		return
+	}
+	if len(noAck) > 0 {
+		abort(http.StatusGatewayTimeout, "no acknowledgement from: "+strings.Join(noAck, ", "))
+		return
+	}
+
+	result.State, err = s.blueGreenCommit(route, prepare, ids)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusConflict, err)
+		return
+	}
+	WriteBody(w, r, result)
+}
+
+func appendBlueGreenAPI(s *Server, group *Group) {
+	group.Entries = append(group.Entries,
+		&Entry{
+			Path:    "/blue-green/{route}",
+			Method:  http.MethodGet,
+			Handler: s.blueGreenGetRoute,
+		},
+		&Entry{
+			Path:    "/blue-green/{route}/switch",
+			Method:  http.MethodPost,
+			Handler: s.blueGreenSwitch,
+		},
+	)
+}
+
+func init() {
+	appendAddonAPIs = append(appendAddonAPIs, appendBlueGreenAPI)
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/filters/proxy"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// serveBlueGreenSwitch calls blueGreenSwitch with the route in the URL.
+func serveBlueGreenSwitch(s *Server, route, query string) *httptest.ResponseRecorder {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("route", route)
+	r := httptest.NewRequest(http.MethodPost, "/blue-green/"+route+"/switch?"+query, nil)
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+	w := httptest.NewRecorder()
+	s.blueGreenSwitch(w, r)
+	return w
+}
+
+func TestBlueGreenSwitch(t *testing.T) {
+	assert := assert.New(t)
+
+	cls := newTestCluster()
+	cls.MockedLayout = func() *cluster.Layout {
+		return &cluster.Layout{}
+	}
+	s := newTestServer(cls)
+	layout := cls.Layout()
+
+	// the timeout must not be shorter than the poll interval.
+	w := serveBlueGreenSwitch(s, "web", "color=green&timeout=10ms")
+	assert.Equal(http.StatusBadRequest, w.Code)
+
+	w = serveBlueGreenSwitch(s, "web", "color=green")
+	assert.Equal(http.StatusNotFound, w.Code)
+
+	participant := string(codectool.MustMarshalJSON(&proxy.BlueGreenParticipant{Pipeline: "pipeline", Filter: "proxy"}))
+	cls.Put(layout.BlueGreenParticipantPrefix("web")+"p1", participant)
+
+	// the participant acknowledges the prepare, after another switch of
+	// the route is rejected as the first one is in progress.
+	concurrent := make(chan int, 1)
+	go func() {
+		var prepare *proxy.BlueGreenPrepare
+		for prepare == nil {
+			time.Sleep(10 * time.Millisecond)
+			prepare = s.blueGreenPending("web")
+		}
+		concurrent <- serveBlueGreenSwitch(s, "web", "color=blue").Code
+
+		ack := &proxy.BlueGreenAck{TxID: prepare.TxID, Participant: "p1"}
+		cls.Put(layout.BlueGreenAckPrefix("web")+"p1", string(codectool.MustMarshalJSON(ack)))
+	}()
+
+	w = serveBlueGreenSwitch(s, "web", "color=green&timeout=5s")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal(http.StatusConflict, <-concurrent)
+
+	result := &BlueGreenSwitchResult{}
+	codectool.MustUnmarshal(w.Body.Bytes(), result)
+	assert.Equal(proxy.ColorGreen, result.State.Color)
+	assert.Equal(proxy.ColorGreen, s.blueGreenState("web").Color)
+	assert.Nil(s.blueGreenPending("web"))
+
+	// no acknowledgement, the switch is aborted after the timeout.
+	w = serveBlueGreenSwitch(s, "web", "color=blue&timeout=300ms")
+	assert.Equal(http.StatusGatewayTimeout, w.Code)
+	assert.Equal(proxy.ColorGreen, s.blueGreenState("web").Color)
+	assert.Nil(s.blueGreenPending("web"))
+
+	// a prepare after its deadline doesn't block new switches.
+	abandoned := &proxy.BlueGreenPrepare{TxID: "tx", Color: proxy.ColorBlue, Deadline: time.Now().Add(-time.Second)}
+	cls.Put(layout.BlueGreenPrepareKey("web"), string(codectool.MustMarshalJSON(abandoned)))
+	w = serveBlueGreenSwitch(s, "web", "color=blue&timeout=300ms")
+	assert.Equal(http.StatusGatewayTimeout, w.Code)
+	assert.Nil(s.blueGreenPending("web"))
+}
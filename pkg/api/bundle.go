@@ -0,0 +1,218 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/object/httpserver"
+	"github.com/megaease/easegress/pkg/object/pipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// ObjectApplyPrefix is the path to apply a bundle of objects.
+const ObjectApplyPrefix = "/objects/apply"
+
+type (
+	// ApplyRequest is the request to apply a bundle of objects.
+	ApplyRequest struct {
+		Objects []map[string]interface{} `json:"objects" jsonschema:"required"`
+		// Prune deletes the objects which are not in the bundle.
+		Prune bool `json:"prune" jsonschema:"omitempty"`
+		// DryRun validates the bundle and returns the changes without
+		// applying them.
+		DryRun bool `json:"dryRun" jsonschema:"omitempty"`
+	}
+
+	// ApplyResponse is the result of applying a bundle of objects.
+	ApplyResponse struct {
+		// Revision is the new config version, it is 0 if nothing changed
+		// or in dry run.
+		Revision int64          `json:"revision"`
+		DryRun   bool           `json:"dryRun"`
+		Changes  []*ApplyChange `json:"changes"`
+	}
+
+	// ApplyChange is the change of an object in a bundle.
+	ApplyChange struct {
+		Name   string `json:"name"`
+		Kind   string `json:"kind"`
+		Action string `json:"action"`
+		Diff   string `json:"diff"`
+	}
+)
+
+func (s *Server) bundleAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    ObjectApplyPrefix,
+			Method:  "POST",
+			Handler: s.applyBundle,
+		},
+	}
+}
+
+// httpServerBackends returns the backends of an HTTPServer.
+func httpServerBackends(spec *supervisor.Spec) []string {
+	serverSpec, ok := spec.ObjectSpec().(*httpserver.Spec)
+	if !ok {
+		return nil
+	}
+
+	var backends []string
+	for _, rule := range serverSpec.Rules {
+		for _, path := range rule.Paths {
+			backends = append(backends, path.Backend)
+		}
+	}
+	return backends
+}
+
+// validateReferences checks the references between objects in the final
+// state. Only references related to the changed objects are checked, so
+// that a bundle is not rejected by the existing problems.
+func validateReferences(final map[string]*supervisor.Spec, changed map[string]bool) []string {
+	var errs []string
+	for name, spec := range final {
+		if spec.Kind() != httpserver.Kind {
+			continue
+		}
+		for _, backend := range httpServerBackends(spec) {
+			if !changed[name] && !changed[backend] {
+				continue
+			}
+			target, ok := final[backend]
+			if !ok {
+				errs = append(errs, fmt.Sprintf("%s: backend %s not found", name, backend))
+			} else if target.Kind() != pipeline.Kind {
+				errs = append(errs, fmt.Sprintf("%s: backend %s is a %s, not a %s",
+					name, backend, target.Kind(), pipeline.Kind))
+			}
+		}
+	}
+
+	sort.Strings(errs)
+	return errs
+}
+
+// applyBundle applies a bundle of objects all-or-nothing, after validating
+// all objects together, including the references between them.
+func (s *Server) applyBundle(w http.ResponseWriter, r *http.Request) {
+	req := &ApplyRequest{}
+	if err := codectool.Decode(r.Body, req); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("decode apply request failed: %v", err))
+		return
+	}
+
+	var errs []string
+	bundle := map[string]*supervisor.Spec{}
+	for i, obj := range req.Objects {
+		spec, err := s.super.NewSpec(string(codectool.MustMarshalJSON(obj)))
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("object %d: %v", i, err))
+			continue
+		}
+		if _, exists := bundle[spec.Name()]; exists {
+			errs = append(errs, fmt.Sprintf("%s: duplicated name", spec.Name()))
+			continue
+		}
+		bundle[spec.Name()] = spec
+	}
+	if len(errs) > 0 {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid bundle: %s", strings.Join(errs, "; ")))
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	current := map[string]*supervisor.Spec{}
+	for _, spec := range s._listObjects() {
+		current[spec.Name()] = spec
+	}
+
+	var changes []*objectChange
+	final := map[string]*supervisor.Spec{}
+	changed := map[string]bool{}
+	for name, spec := range current {
+		if _, ok := bundle[name]; ok {
+			continue
+		}
+		if req.Prune {
+			changes = append(changes, &objectChange{name: name, action: actionDelete})
+			changed[name] = true
+			continue
+		}
+		final[name] = spec
+	}
+	for name, spec := range bundle {
+		final[name] = spec
+		old, exists := current[name]
+		switch {
+		case !exists:
+			changes = append(changes, &objectChange{name: name, action: actionCreate, spec: spec})
+		case old.Kind() != spec.Kind():
+			errs = append(errs, fmt.Sprintf("%s: different kinds: %s, %s", name, old.Kind(), spec.Kind()))
+			continue
+		case old.JSONConfig() == spec.JSONConfig():
+			continue
+		default:
+			changes = append(changes, &objectChange{name: name, action: actionUpdate, spec: spec})
+		}
+		changed[name] = true
+	}
+
+	errs = append(errs, validateReferences(final, changed)...)
+	if len(errs) > 0 {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid bundle: %s", strings.Join(errs, "; ")))
+		return
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].name < changes[j].name })
+
+	resp := &ApplyResponse{DryRun: req.DryRun, Changes: []*ApplyChange{}}
+	for _, c := range changes {
+		from, to, kind := "", "", ""
+		if old, ok := current[c.name]; ok {
+			from = configToYAML(old.JSONConfig())
+			kind = old.Kind()
+		}
+		if c.spec != nil {
+			to = configToYAML(c.spec.JSONConfig())
+			kind = c.spec.Kind()
+		}
+		resp.Changes = append(resp.Changes, &ApplyChange{
+			Name:   c.name,
+			Kind:   kind,
+			Action: c.action,
+			Diff:   unifiedDiff(c.name+"@current", c.name+"@bundle", from, to),
+		})
+	}
+
+	if !req.DryRun && len(changes) > 0 {
+		resp.Revision = s._applyObjects(changes, 0)
+		auditChanges(r, resp.Revision, changes)
+		w.Header().Set(ConfigVersionKey, fmt.Sprintf("%d", resp.Revision))
+	}
+
+	WriteBody(w, r, resp)
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/megaease/easegress/pkg/filters/mock"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	testPipelineConfig = `{"name": "pipeline-a", "kind": "Pipeline", "filters": [{"name": "mock", "kind": "Mock"}]}`
+	testServerConfig   = `{"name": "server-a", "kind": "HTTPServer", "port": 10080, "keepAlive": true, "https": false, "rules": [{"paths": [{"pathPrefix": "/", "backend": "pipeline-a"}]}]}`
+)
+
+func putTestObject(t *testing.T, s *Server, cls *testCluster, config string) {
+	spec, err := s.super.NewSpec(config)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+	cls.Put(cls.Layout().ConfigObjectKey(spec.Name()), spec.JSONConfig())
+}
+
+func applyTestBundle(s *Server, req *ApplyRequest) (int, *ApplyResponse) {
+	w := serve(s.applyBundle, http.MethodPost, ObjectApplyPrefix, string(codectool.MustMarshalJSON(req)))
+	resp := &ApplyResponse{}
+	if w.Code == http.StatusOK {
+		codectool.MustUnmarshal(w.Body.Bytes(), resp)
+	}
+	return w.Code, resp
+}
+
+func testBundleObject(config string) map[string]interface{} {
+	obj := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(config), &obj)
+	return obj
+}
+
+func TestApplyBundleRejectBadSpec(t *testing.T) {
+	assert := assert.New(t)
+	cls := newTestCluster()
+	s := newTestServer(cls)
+
+	code, _ := applyTestBundle(s, &ApplyRequest{Objects: []map[string]interface{}{
+		testBundleObject(testPipelineConfig),
+		{"name": "server-bad", "kind": "HTTPServer", "port": 0},
+	}})
+	assert.Equal(http.StatusBadRequest, code)
+
+	// nothing is applied, including the valid pipeline.
+	assert.Empty(cls.keys(cls.Layout().ConfigObjectPrefix()))
+}
+
+func TestApplyBundleRejectDanglingReference(t *testing.T) {
+	assert := assert.New(t)
+	cls := newTestCluster()
+	s := newTestServer(cls)
+
+	code, _ := applyTestBundle(s, &ApplyRequest{Objects: []map[string]interface{}{
+		testBundleObject(testServerConfig),
+	}})
+	assert.Equal(http.StatusBadRequest, code)
+
+	// pruning the pipeline used by an existing server is rejected too.
+	putTestObject(t, s, cls, testPipelineConfig)
+	putTestObject(t, s, cls, testServerConfig)
+	code, _ = applyTestBundle(s, &ApplyRequest{
+		Objects: []map[string]interface{}{testBundleObject(testServerConfig)},
+		Prune:   true,
+	})
+	assert.Equal(http.StatusBadRequest, code)
+	assert.Len(cls.keys(cls.Layout().ConfigObjectPrefix()), 2)
+}
+
+func TestApplyBundleMixedChanges(t *testing.T) {
+	assert := assert.New(t)
+	cls := newTestCluster()
+	s := newTestServer(cls)
+
+	putTestObject(t, s, cls, testPipelineConfig)
+	putTestObject(t, s, cls, `{"name": "pipeline-old", "kind": "Pipeline", "filters": [{"name": "mock", "kind": "Mock"}]}`)
+
+	req := &ApplyRequest{
+		Objects: []map[string]interface{}{
+			testBundleObject(`{"name": "pipeline-a", "kind": "Pipeline", "filters": [{"name": "mock2", "kind": "Mock"}]}`),
+			testBundleObject(testServerConfig),
+		},
+		Prune:  true,
+		DryRun: true,
+	}
+
+	code, resp := applyTestBundle(s, req)
+	assert.Equal(http.StatusOK, code)
+	assert.True(resp.DryRun)
+	assert.Equal(int64(0), resp.Revision)
+	assert.Len(resp.Changes, 3)
+	version, _ := cls.Get(cls.Layout().ConfigVersion())
+	assert.Nil(version)
+
+	req.DryRun = false
+	code, resp = applyTestBundle(s, req)
+	assert.Equal(http.StatusOK, code)
+	assert.Equal(int64(1), resp.Revision)
+
+	actions := map[string]string{}
+	for _, c := range resp.Changes {
+		actions[c.Name] = c.Action
+	}
+	assert.Equal(map[string]string{
+		"pipeline-a":   actionUpdate,
+		"pipeline-old": actionDelete,
+		"server-a":     actionCreate,
+	}, actions)
+
+	layout := cls.Layout()
+	assert.Equal([]string{layout.ConfigObjectKey("pipeline-a"), layout.ConfigObjectKey("server-a")},
+		cls.keys(layout.ConfigObjectPrefix()))
+	value, _ := cls.Get(layout.ConfigObjectKey("pipeline-a"))
+	assert.Contains(*value, "mock2")
+
+	// applying the same bundle again changes nothing.
+	code, resp = applyTestBundle(s, req)
+	assert.Equal(http.StatusOK, code)
+	assert.Empty(resp.Changes)
+	assert.Equal(int64(0), resp.Revision)
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/object/canary"
+)
+
+const canaryAPIPrefix = "/canaries/{name}"
+
+// getCanary returns the Canary of the name in the path, it responds 404 if
+// the Canary doesn't exist in this member.
+func (s *Server) getCanary(w http.ResponseWriter, r *http.Request) *canary.Canary {
+	name := chi.URLParam(r, "name")
+	entity, exists := s.super.GetBusinessController(name)
+	if exists {
+		if c, ok := entity.Instance().(*canary.Canary); ok {
+			return c
+		}
+	}
+	HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("canary %s not found", name))
+	return nil
+}
+
+func (s *Server) canaryStatus(w http.ResponseWriter, r *http.Request) {
+	if c := s.getCanary(w, r); c != nil {
+		WriteBody(w, r, c.Status().ObjectStatus)
+	}
+}
+
+func (s *Server) canaryPause(w http.ResponseWriter, r *http.Request) {
+	c := s.getCanary(w, r)
+	if c == nil {
+		return
+	}
+	if err := c.Pause(time.Now()); err != nil {
+		HandleAPIError(w, r, http.StatusConflict, err)
+		return
+	}
+	WriteBody(w, r, c.Status().ObjectStatus)
+}
+
+func (s *Server) canaryResume(w http.ResponseWriter, r *http.Request) {
+	c := s.getCanary(w, r)
+	if c == nil {
+		return
+	}
+	if err := c.Resume(time.Now()); err != nil {
+		HandleAPIError(w, r, http.StatusConflict, err)
+		return
+	}
+	WriteBody(w, r, c.Status().ObjectStatus)
+}
+
+func (s *Server) canaryPromote(w http.ResponseWriter, r *http.Request) {
+	if c := s.getCanary(w, r); c != nil {
+		c.Promote()
+		WriteBody(w, r, c.Status().ObjectStatus)
+	}
+}
+
+func (s *Server) canaryRollback(w http.ResponseWriter, r *http.Request) {
+	if c := s.getCanary(w, r); c != nil {
+		c.Rollback()
+		WriteBody(w, r, c.Status().ObjectStatus)
+	}
+}
+
+func appendCanaryAPI(s *Server, group *Group) {
+	group.Entries = append(group.Entries,
+		&Entry{Path: canaryAPIPrefix, Method: http.MethodGet, Handler: s.canaryStatus},
+		&Entry{Path: canaryAPIPrefix + "/pause", Method: http.MethodPost, Handler: s.canaryPause},
+		&Entry{Path: canaryAPIPrefix + "/resume", Method: http.MethodPost, Handler: s.canaryResume},
+		&Entry{Path: canaryAPIPrefix + "/promote", Method: http.MethodPost, Handler: s.canaryPromote},
+		&Entry{Path: canaryAPIPrefix + "/rollback", Method: http.MethodPost, Handler: s.canaryRollback},
+	)
+}
+
+func init() {
+	appendAddonAPIs = append(appendAddonAPIs, appendCanaryAPI)
+}
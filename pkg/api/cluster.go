@@ -21,7 +21,9 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/megaease/easegress/pkg/object/statussynccontroller"
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/util/codectool"
 )
@@ -51,19 +53,6 @@ func (s *Server) _getVersion() int64 {
 	return version
 }
 
-func (s *Server) _plusOneVersion() int64 {
-	version := s._getVersion()
-	version++
-	value := fmt.Sprintf("%d", version)
-
-	err := s.cluster.Put(s.cluster.Layout().ConfigVersion(), value)
-	if err != nil {
-		ClusterPanic(err)
-	}
-
-	return version
-}
-
 func (s *Server) _getObject(name string) *supervisor.Spec {
 	value, err := s.cluster.Get(s.cluster.Layout().ConfigObjectKey(name))
 	if err != nil {
@@ -100,32 +89,85 @@ func (s *Server) _listObjects() []*supervisor.Spec {
 	return specs
 }
 
-func (s *Server) _putObject(spec *supervisor.Spec) {
-	err := s.cluster.Put(s.cluster.Layout().ConfigObjectKey(spec.Name()),
-		spec.JSONConfig())
+// _getStatusHeartbeats returns the timestamps of the latest heartbeats of
+// the members.
+func (s *Server) _getStatusHeartbeats() map[string]int64 {
+	prefix := s.cluster.Layout().StatusHeartbeatPrefix()
+	kvs, err := s.cluster.GetPrefix(prefix)
 	if err != nil {
 		ClusterPanic(err)
 	}
+
+	heartbeats := make(map[string]int64, len(kvs))
+	for k, v := range kvs {
+		hb := struct {
+			Timestamp int64 `json:"timestamp"`
+		}{}
+		if err = codectool.Unmarshal([]byte(v), &hb); err != nil {
+			ClusterPanic(fmt.Errorf("unmarshal %s to json failed: %v", v, err))
+		}
+		heartbeats[strings.TrimPrefix(k, prefix)] = hb.Timestamp
+	}
+
+	return heartbeats
 }
 
-func (s *Server) _deleteObject(name string) {
-	err := s.cluster.Delete(s.cluster.Layout().ConfigObjectKey(name))
+// statusKeyObjectName returns the object name of the status key, the key
+// is in the format of namespace/objectName/memberName.
+func statusKeyObjectName(key string) string {
+	parts := strings.Split(key, "/")
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[len(parts)-2]
+}
+
+// decorateStatus adds the staleness indicator to the status, lastUpdated
+// is the time when the status changed last time, stale is true if the
+// member stops sending heartbeats.
+func decorateStatus(key, value string, heartbeats map[string]int64, now int64) map[string]interface{} {
+	// NOTE: This needs top-level of the status to be a map.
+	m := map[string]interface{}{}
+	err := codectool.Unmarshal([]byte(value), &m)
 	if err != nil {
-		ClusterPanic(err)
+		ClusterPanic(fmt.Errorf("unmarshal %s to json failed: %v", value, err))
+	}
+	if m == nil {
+		m = map[string]interface{}{}
+	}
+
+	member := key[strings.LastIndex(key, "/")+1:]
+	heartbeat, ok := heartbeats[member]
+	if !ok {
+		// Members of old versions don't send heartbeats.
+		if ts, ok := m["timestamp"].(float64); ok {
+			heartbeat = int64(ts)
+		}
 	}
+
+	m["lastUpdated"] = m["timestamp"]
+	m["heartbeat"] = heartbeat
+	m["stale"] = now-heartbeat > statussynccontroller.StaleAfterSeconds
+	return m
 }
 
-func (s *Server) _getStatusObject(name string) map[string]string {
+func (s *Server) _getStatusObject(name string) map[string]interface{} {
 	prefix := s.cluster.Layout().StatusObjectPrefix(name)
 	kvs, err := s.cluster.GetPrefix(prefix)
 	if err != nil {
 		ClusterPanic(err)
 	}
 
-	status := make(map[string]string)
+	heartbeats := s._getStatusHeartbeats()
+	now := time.Now().Unix()
+
+	status := make(map[string]interface{})
 	for k, v := range kvs {
-		// NOTE: Here omitting the step json.Unmarshal in _listStatusObjects.
-		status[strings.TrimPrefix(k, prefix)] = v
+		k = strings.TrimPrefix(k, prefix)
+		if statusKeyObjectName(k) != name {
+			continue
+		}
+		status[k] = decorateStatus(k, v, heartbeats, now)
 	}
 
 	return status
@@ -138,17 +180,13 @@ func (s *Server) _listStatusObjects() map[string]interface{} {
 		ClusterPanic(err)
 	}
 
+	heartbeats := s._getStatusHeartbeats()
+	now := time.Now().Unix()
+
 	status := make(map[string]interface{})
 	for k, v := range kvs {
 		k = strings.TrimPrefix(k, prefix)
-
-		// NOTE: This needs top-level of the status to be a map.
-		m := map[string]interface{}{}
-		err = codectool.Unmarshal([]byte(v), &m)
-		if err != nil {
-			ClusterPanic(fmt.Errorf("unmarshal %s to json failed: %v", v, err))
-		}
-		status[k] = m
+		status[k] = decorateStatus(k, v, heartbeats, now)
 	}
 
 	return status
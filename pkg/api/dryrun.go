@@ -0,0 +1,193 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/pipeline"
+	"github.com/megaease/easegress/pkg/object/trafficcontroller"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// PipelineDryRunPath is the path to run a request through a pipeline.
+	PipelineDryRunPath = "/pipelines/{name}/dryrun"
+
+	dryRunDefaultNamespace = "default"
+	dryRunMaxBodySize      = 1024 * 1024
+)
+
+type (
+	// DryRunRequest is the request to run through a pipeline.
+	DryRunRequest struct {
+		// Namespace is the traffic namespace of the pipeline, defaults to
+		// the namespace of the pipelines created by the API.
+		Namespace string      `json:"namespace,omitempty"`
+		Method    string      `json:"method,omitempty"`
+		Path      string      `json:"path,omitempty"`
+		Host      string      `json:"host,omitempty"`
+		Header    http.Header `json:"header,omitempty"`
+		Body      string      `json:"body,omitempty"`
+	}
+
+	// DryRunResponse is the response and the execution report of the
+	// filters of a request run through a pipeline.
+	DryRunResponse struct {
+		Result     string          `json:"result"`
+		StatusCode int             `json:"statusCode"`
+		Header     http.Header     `json:"header,omitempty"`
+		Body       string          `json:"body,omitempty"`
+		Truncated  bool            `json:"truncated,omitempty"`
+		Duration   string          `json:"duration"`
+		Filters    []*DryRunFilter `json:"filters"`
+	}
+
+	// DryRunFilter is the execution report of a filter.
+	DryRunFilter struct {
+		Name     string `json:"name"`
+		Kind     string `json:"kind"`
+		Result   string `json:"result,omitempty"`
+		Duration string `json:"duration"`
+	}
+)
+
+func appendDryRunAPI(s *Server, group *Group) {
+	entry := &Entry{
+		Path:    PipelineDryRunPath,
+		Method:  http.MethodPost,
+		Handler: s.dryRunPipeline,
+	}
+	group.Entries = append(group.Entries, entry)
+}
+
+func init() {
+	appendAddonAPIs = append(appendAddonAPIs, appendDryRunAPI)
+}
+
+// dryRunPipeline runs a request through a pipeline on this member, without
+// going through an HTTPServer, and returns the report of the filters.
+//
+// NOTE: The filters are executed for real, e.g. the proxies send the
+// request to the backends, so it is a dry run of the traffic entry only.
+func (s *Server) dryRunPipeline(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	dr := &DryRunRequest{}
+	if err := codectool.Decode(r.Body, dr); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("decode dry run request failed: %v", err))
+		return
+	}
+	if dr.Namespace == "" {
+		dr.Namespace = dryRunDefaultNamespace
+	}
+	if dr.Method == "" {
+		dr.Method = http.MethodGet
+	}
+	if dr.Path == "" {
+		dr.Path = "/"
+	}
+	if dr.Host == "" {
+		dr.Host = "localhost"
+	}
+
+	entity, exists := s.super.GetSystemController(trafficcontroller.Kind)
+	if !exists {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("traffic controller not found"))
+		return
+	}
+	tc := entity.Instance().(*trafficcontroller.TrafficController)
+
+	p, exists := tc.GetPipeline(dr.Namespace, name)
+	if !exists {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("pipeline %s/%s not found", dr.Namespace, name))
+		return
+	}
+
+	resp, err := dryRun(r, p.Instance().(*pipeline.Pipeline), dr)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	WriteBody(w, r, resp)
+}
+
+// dryRun runs the request of dr through the pipeline, r is the request of
+// the dry run API.
+func dryRun(r *http.Request, p *pipeline.Pipeline, dr *DryRunRequest) (*DryRunResponse, error) {
+	stdr, err := http.NewRequestWithContext(r.Context(), dr.Method,
+		"http://"+dr.Host+dr.Path, strings.NewReader(dr.Body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %v", err)
+	}
+	for k, v := range dr.Header {
+		stdr.Header[http.CanonicalHeaderKey(k)] = v
+	}
+	stdr.RemoteAddr = r.RemoteAddr
+
+	// httpprot.NewRequest never returns an error.
+	req, _ := httpprot.NewRequest(stdr)
+	if err = req.FetchPayload(0); err != nil {
+		return nil, fmt.Errorf("read request body failed: %v", err)
+	}
+
+	ctx := context.New(tracing.NoopSpan)
+	ctx.SetRequest(context.DefaultNamespace, req)
+	defer ctx.Finish()
+
+	startAt := time.Now()
+	result := p.Handle(ctx)
+
+	resp := &DryRunResponse{
+		Result:   result,
+		Duration: time.Since(startAt).String(),
+		Filters:  []*DryRunFilter{},
+	}
+	if stats, ok := ctx.GetData(pipeline.DataFilterStats).([]pipeline.FilterStat); ok {
+		for _, stat := range stats {
+			resp.Filters = append(resp.Filters, &DryRunFilter{
+				Name:     stat.Name,
+				Kind:     stat.Kind,
+				Result:   stat.Result,
+				Duration: stat.Duration.String(),
+			})
+		}
+	}
+
+	if httpResp, ok := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response); ok {
+		resp.StatusCode = httpResp.StatusCode()
+		resp.Header = httpResp.HTTPHeader()
+		body, _ := io.ReadAll(io.LimitReader(httpResp.GetPayload(), dryRunMaxBodySize+1))
+		if len(body) > dryRunMaxBodySize {
+			body, resp.Truncated = body[:dryRunMaxBodySize], true
+		}
+		resp.Body = string(body)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/megaease/easegress/pkg/filters/mock"
+	"github.com/megaease/easegress/pkg/object/pipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func newDryRunPipeline(t *testing.T, body string) *pipeline.Pipeline {
+	spec, err := supervisor.NewSpec(`
+name: pipeline-a
+kind: Pipeline
+flow:
+- filter: mock
+filters:
+- name: mock
+  kind: Mock
+  rules:
+  - match:
+      pathPrefix: /mock
+    code: 202
+    headers:
+      X-Mock: mocked
+    body: ` + body + `
+`)
+	if err != nil {
+		t.Fatalf("failed to create spec: %v", err)
+	}
+	p := &pipeline.Pipeline{}
+	p.Init(spec, nil)
+	return p
+}
+
+func TestDryRun(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newDryRunPipeline(t, "hello")
+	defer p.Close()
+	r := httptest.NewRequest(http.MethodPost, "/pipelines/pipeline-a/dryrun", nil)
+
+	resp, err := dryRun(r, p, &DryRunRequest{Method: http.MethodGet, Path: "/mock", Host: "localhost"})
+	assert.NoError(err)
+	assert.Equal("mocked", resp.Result)
+	assert.Equal(202, resp.StatusCode)
+	assert.Equal("mocked", resp.Header.Get("X-Mock"))
+	assert.Equal("hello", resp.Body)
+	assert.False(resp.Truncated)
+	assert.Len(resp.Filters, 1)
+	assert.Equal("mock", resp.Filters[0].Name)
+	assert.Equal("Mock", resp.Filters[0].Kind)
+	assert.Equal("mocked", resp.Filters[0].Result)
+
+	// the request is not mocked.
+	resp, err = dryRun(r, p, &DryRunRequest{Method: http.MethodGet, Path: "/other", Host: "localhost"})
+	assert.NoError(err)
+	assert.Equal("", resp.Result)
+	assert.Len(resp.Filters, 1)
+	assert.Equal("", resp.Filters[0].Result)
+
+	_, err = dryRun(r, p, &DryRunRequest{Method: "BAD METHOD", Path: "/mock", Host: "localhost"})
+	assert.Error(err)
+}
+
+func TestDryRunTruncated(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newDryRunPipeline(t, strings.Repeat("a", dryRunMaxBodySize+10))
+	defer p.Close()
+	r := httptest.NewRequest(http.MethodPost, "/pipelines/pipeline-a/dryrun", nil)
+
+	resp, err := dryRun(r, p, &DryRunRequest{Method: http.MethodGet, Path: "/mock", Host: "localhost"})
+	assert.NoError(err)
+	assert.True(resp.Truncated)
+	assert.Len(resp.Body, dryRunMaxBodySize)
+}
+
+func TestDryRunPipelineErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newTestServer(newTestCluster())
+
+	w := serve(s.dryRunPipeline, http.MethodPost, "/pipelines/pipeline-a/dryrun", "{invalid")
+	assert.Equal(http.StatusBadRequest, w.Code)
+
+	// there is no traffic controller in the mocked supervisor.
+	w = serve(s.dryRunPipeline, http.MethodPost, "/pipelines/pipeline-a/dryrun", `{"path":"/mock"}`)
+	assert.Equal(http.StatusInternalServerError, w.Code)
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/prometheushelper"
 )
 
 type (
@@ -79,7 +80,15 @@ func (m *dynamicMux) reloadAPIs() {
 	router.Use(middleware.StripSlashes)
 	router.Use(m.newAPILogger)
 	router.Use(m.newConfigVersionAttacher)
+	router.Use(m.newAuditor)
 	router.Use(m.newRecoverer)
+	if m.server.opt.IsConfigReadOnly() {
+		router.Use(m.newReadOnlyGuard)
+	}
+
+	router.Method(http.MethodGet, MetricsPath, prometheushelper.Handler())
+	router.Method(http.MethodGet, HealthzPath, http.HandlerFunc(m.server.healthz))
+	router.Method(http.MethodGet, ReadyzPath, http.HandlerFunc(m.server.readyz))
 
 	for _, apiGroup := range apiGroups {
 		for _, api := range apiGroup.Entries {
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// HealthzPath is the path of the liveness probe, it is served without
+	// the API prefix too, like MetricsPath.
+	HealthzPath = "/healthz"
+	// ReadyzPath is the path of the readiness probe, it is served without
+	// the API prefix too, like MetricsPath.
+	ReadyzPath = "/readyz"
+)
+
+func (s *Server) healthAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			// https://stackoverflow.com/a/43381061/1705845
+			Path:    HealthzPath,
+			Method:  "GET",
+			Handler: s.healthz,
+		},
+		{
+			Path:    ReadyzPath,
+			Method:  "GET",
+			Handler: s.readyz,
+		},
+	}
+}
+
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	/* 200 by default */
+}
+
+// readyz responds 503 if the member is not ready, the body is the result
+// of all readiness checks.
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	readiness := s.super.CheckReadiness()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !readiness.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(codectool.MustMarshalJSON(readiness))
+}
@@ -0,0 +1,462 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pmezard/go-difflib/difflib"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// ObjectRollbackPrefix is the path to roll back objects.
+	ObjectRollbackPrefix = "/objects/rollback"
+
+	// maxObjectRevisions is the max number of revisions kept for an object.
+	maxObjectRevisions = 20
+
+	actionCreate = "create"
+	actionUpdate = "update"
+	actionDelete = "delete"
+)
+
+type (
+	// ObjectRevision is a revision in the history of an object, the
+	// revision is the config version after the change.
+	ObjectRevision struct {
+		Revision int64  `json:"revision"`
+		Action   string `json:"action"`
+		Time     string `json:"time"`
+		// Rollback is the revision rolled back to, if the change is a
+		// rollback.
+		Rollback int64 `json:"rollback,omitempty"`
+		// Spec is the JSON config of the object, it is empty if the
+		// object is deleted.
+		Spec string `json:"spec,omitempty"`
+	}
+
+	// RollbackRequest is the request to roll back objects.
+	RollbackRequest struct {
+		// Revision is the config version to roll back to.
+		Revision int64 `json:"revision" jsonschema:"required,minimum=1"`
+		// Objects are the names of objects to roll back, all objects with
+		// history are rolled back if it is empty.
+		Objects []string `json:"objects" jsonschema:"omitempty"`
+	}
+
+	// RollbackResponse is the result of a rollback.
+	RollbackResponse struct {
+		// Revision is the new config version, it is 0 if nothing changed.
+		Revision int64 `json:"revision"`
+		// Changes maps the names of objects to the actions.
+		Changes map[string]string `json:"changes"`
+	}
+
+	// ObjectDiff is the difference between two revisions of an object.
+	ObjectDiff struct {
+		From int64  `json:"from"`
+		To   int64  `json:"to"`
+		Diff string `json:"diff"`
+	}
+
+	// objectChange is a change of an object, spec is nil for deletion.
+	objectChange struct {
+		name   string
+		action string
+		spec   *supervisor.Spec
+		// summary is filled when the change is applied.
+		summary string
+	}
+)
+
+func (s *Server) historyAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    ObjectPrefix + "/{name}/history",
+			Method:  "GET",
+			Handler: s.getObjectHistory,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}/diff",
+			Method:  "GET",
+			Handler: s.diffObject,
+		},
+		{
+			Path:    ObjectRollbackPrefix,
+			Method:  "POST",
+			Handler: s.rollbackObjects,
+		},
+	}
+}
+
+// _applyObjects applies the changes of objects, upgrades the config version
+// and records the history in one transaction, and returns the new version.
+func (s *Server) _applyObjects(changes []*objectChange, rollback int64) int64 {
+	layout := s.cluster.Layout()
+	version := s._getVersion() + 1
+	now := time.Now().Format(time.RFC3339)
+
+	versionStr := strconv.FormatInt(version, 10)
+	kvs := map[string]*string{layout.ConfigVersion(): &versionStr}
+	for _, c := range changes {
+		old, err := s.cluster.Get(layout.ConfigObjectKey(c.name))
+		if err != nil {
+			ClusterPanic(err)
+		}
+
+		rev := &ObjectRevision{
+			Revision: version,
+			Action:   c.action,
+			Time:     now,
+			Rollback: rollback,
+		}
+
+		if c.spec == nil {
+			kvs[layout.ConfigObjectKey(c.name)] = nil
+		} else {
+			config := c.spec.JSONConfig()
+			kvs[layout.ConfigObjectKey(c.name)] = &config
+			rev.Spec = config
+		}
+
+		oldConfig := ""
+		if old != nil {
+			oldConfig = *old
+		}
+		c.summary = diffSummary(configToYAML(oldConfig), configToYAML(rev.Spec))
+
+		buff := string(codectool.MustMarshalJSON(rev))
+		kvs[layout.ConfigHistoryKey(c.name, version)] = &buff
+	}
+
+	if err := s.cluster.PutAndDelete(kvs); err != nil {
+		ClusterPanic(err)
+	}
+
+	for _, c := range changes {
+		s._pruneHistory(c.name)
+	}
+
+	return version
+}
+
+// _pruneHistory removes the oldest revisions of an object.
+func (s *Server) _pruneHistory(name string) {
+	prefix := s.cluster.Layout().ConfigHistoryPrefix(name)
+	kvs, err := s.cluster.GetWithOp(prefix, cluster.OpPrefix, cluster.OpKeysOnly)
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if len(kvs) <= maxObjectRevisions {
+		return
+	}
+
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	deletions := map[string]*string{}
+	for _, k := range keys[:len(keys)-maxObjectRevisions] {
+		deletions[k] = nil
+	}
+	if err := s.cluster.PutAndDelete(deletions); err != nil {
+		ClusterPanic(err)
+	}
+}
+
+// _getHistory returns the revisions of an object in ascending order.
+func (s *Server) _getHistory(name string) []*ObjectRevision {
+	kvs, err := s.cluster.GetPrefix(s.cluster.Layout().ConfigHistoryPrefix(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	revs := make([]*ObjectRevision, 0, len(kvs))
+	for _, v := range kvs {
+		rev := &ObjectRevision{}
+		if err := codectool.UnmarshalJSON([]byte(v), rev); err != nil {
+			panic(fmt.Errorf("bad object revision(err: %v) from json: %s", err, v))
+		}
+		revs = append(revs, rev)
+	}
+
+	sort.Slice(revs, func(i, j int) bool { return revs[i].Revision < revs[j].Revision })
+	return revs
+}
+
+// _listHistoryObjects returns the names of all objects with history.
+func (s *Server) _listHistoryObjects() []string {
+	prefix := s.cluster.Layout().ConfigHistoriesPrefix()
+	kvs, err := s.cluster.GetWithOp(prefix, cluster.OpPrefix, cluster.OpKeysOnly)
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	names := map[string]struct{}{}
+	for k := range kvs {
+		name := strings.SplitN(strings.TrimPrefix(k, prefix), "/", 2)[0]
+		names[name] = struct{}{}
+	}
+
+	result := make([]string, 0, len(names))
+	for name := range names {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// revisionAt returns the revision of the object at the config version, a
+// nil revision means the object didn't exist.
+func revisionAt(revs []*ObjectRevision, version int64) (*ObjectRevision, error) {
+	var found *ObjectRevision
+	for _, rev := range revs {
+		if rev.Revision > version {
+			break
+		}
+		found = rev
+	}
+
+	if found != nil {
+		if found.Action == actionDelete {
+			return nil, nil
+		}
+		return found, nil
+	}
+
+	// the object was created after the version.
+	if len(revs) > 0 && revs[0].Action == actionCreate {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("revision %d is not in the history", version)
+}
+
+func (s *Server) getObjectHistory(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	revs := s._getHistory(name)
+	if len(revs) == 0 {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("no history of %s", name))
+		return
+	}
+
+	WriteBody(w, r, revs)
+}
+
+func parseRevision(r *http.Request, name string) (int64, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	rev, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || rev <= 0 {
+		return 0, fmt.Errorf("invalid %s revision: %s", name, value)
+	}
+	return rev, nil
+}
+
+func configToYAML(config string) string {
+	if config == "" {
+		return ""
+	}
+	return string(codectool.MustJSONToYAML([]byte(config)))
+}
+
+func specToYAML(rev *ObjectRevision) string {
+	if rev == nil {
+		return ""
+	}
+	return configToYAML(rev.Spec)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return difflib.SplitLines(s)
+}
+
+// unifiedDiff returns the unified diff between two YAML configs.
+func unifiedDiff(fromFile, toFile, from, to string) string {
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(from),
+		B:        splitLines(to),
+		FromFile: fromFile,
+		ToFile:   toFile,
+		Context:  3,
+	})
+	return diff
+}
+
+// diffSummary returns the numbers of added and removed lines.
+func diffSummary(from, to string) string {
+	added, removed := 0, 0
+	for _, op := range difflib.NewMatcher(splitLines(from), splitLines(to)).GetOpCodes() {
+		switch op.Tag {
+		case 'r':
+			added += op.J2 - op.J1
+			removed += op.I2 - op.I1
+		case 'd':
+			removed += op.I2 - op.I1
+		case 'i':
+			added += op.J2 - op.J1
+		}
+	}
+	return fmt.Sprintf("+%d -%d lines", added, removed)
+}
+
+// diffObject returns the difference of an object between the from and to
+// revisions. The to revision is the latest one by default, and the from
+// revision is the one before the to revision by default.
+func (s *Server) diffObject(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	from, err := parseRevision(r, "from")
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	to, err := parseRevision(r, "to")
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	revs := s._getHistory(name)
+	if len(revs) == 0 {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("no history of %s", name))
+		return
+	}
+
+	if to == 0 {
+		to = revs[len(revs)-1].Revision
+	}
+	if from == 0 {
+		from = to - 1
+	}
+	if from >= to {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("from revision must be less than to revision"))
+		return
+	}
+
+	fromRev, err := revisionAt(revs, from)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	toRev, err := revisionAt(revs, to)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	diff := unifiedDiff(fmt.Sprintf("%s@%d", name, from), fmt.Sprintf("%s@%d", name, to),
+		specToYAML(fromRev), specToYAML(toRev))
+
+	WriteBody(w, r, &ObjectDiff{From: from, To: to, Diff: diff})
+}
+
+// rollbackObjects rolls back objects to a config version atomically, so
+// that dependent objects, like an HTTPServer and its pipelines, are always
+// consistent.
+func (s *Server) rollbackObjects(w http.ResponseWriter, r *http.Request) {
+	req := &RollbackRequest{}
+	if err := codectool.Decode(r.Body, req); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("decode rollback request failed: %v", err))
+		return
+	}
+	if req.Revision <= 0 {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid revision: %d", req.Revision))
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if req.Revision > s._getVersion() {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("revision %d is newer than current config version", req.Revision))
+		return
+	}
+
+	names := req.Objects
+	if len(names) == 0 {
+		names = s._listHistoryObjects()
+	}
+
+	var changes []*objectChange
+	resp := &RollbackResponse{Changes: map[string]string{}}
+	for _, name := range names {
+		revs := s._getHistory(name)
+		if len(revs) == 0 {
+			HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("no history of %s", name))
+			return
+		}
+
+		target, err := revisionAt(revs, req.Revision)
+		if err != nil {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("roll back %s failed: %v", name, err))
+			return
+		}
+
+		current := s._getObject(name)
+		c := &objectChange{name: name}
+		switch {
+		case target == nil && current == nil:
+			continue
+		case target == nil:
+			c.action = actionDelete
+		case current != nil && current.JSONConfig() == target.Spec:
+			continue
+		default:
+			spec, err := s.super.NewSpec(target.Spec)
+			if err != nil {
+				HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("roll back %s failed: %v", name, err))
+				return
+			}
+			c.spec = spec
+			c.action = actionUpdate
+			if current == nil {
+				c.action = actionCreate
+			}
+		}
+
+		changes = append(changes, c)
+		resp.Changes[name] = c.action
+	}
+
+	if len(changes) > 0 {
+		resp.Revision = s._applyObjects(changes, req.Revision)
+		auditChanges(r, resp.Revision, changes)
+		w.Header().Set(ConfigVersionKey, fmt.Sprintf("%d", resp.Revision))
+	}
+
+	WriteBody(w, r, resp)
+}
@@ -25,6 +25,9 @@ import (
 	"github.com/go-chi/chi/v5"
 
 	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/common"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
 	"github.com/megaease/easegress/pkg/util/codectool"
 )
 
@@ -40,12 +43,52 @@ func (s *Server) memberAPIEntries() []*Entry {
 			Method:  "DELETE",
 			Handler: s.purgeMember,
 		},
+		{
+			Path:    "/cluster/members",
+			Method:  "GET",
+			Handler: s.listEtcdMembers,
+		},
+		{
+			Path:    "/cluster/members",
+			Method:  "POST",
+			Handler: s.addLearner,
+		},
+		{
+			Path:    "/cluster/members/{member}/promote",
+			Method:  "POST",
+			Handler: s.promoteMember,
+		},
+		{
+			Path:    "/cluster/members/{member}/replace",
+			Method:  "POST",
+			Handler: s.replaceMember,
+		},
+		{
+			Path:    "/cluster/members/{member}",
+			Method:  "DELETE",
+			Handler: s.removeMember,
+		},
 	}
 }
 
 type (
 	// ListMembersResp is the response of list member.
 	ListMembersResp []cluster.MemberStatus
+
+	// AddMemberRequest is the request to add a primary member as a
+	// learner, or to replace a member with it.
+	AddMemberRequest struct {
+		Name     string   `json:"name"`
+		PeerURLs []string `json:"peerURLs"`
+	}
+
+	// AddMemberResponse is the response of adding or replacing a member,
+	// InitialCluster is the initial-cluster option to start the new member
+	// with, together with state-flag existing.
+	AddMemberResponse struct {
+		Members        []*cluster.EtcdMember `json:"members"`
+		InitialCluster map[string]string     `json:"initialCluster"`
+	}
 )
 
 func (r ListMembersResp) Len() int           { return len(r) }
@@ -98,3 +141,181 @@ func (s *Server) purgeMember(w http.ResponseWriter, r *http.Request) {
 
 	s._purgeMember(memberName)
 }
+
+func (s *Server) _etcdMembers() []*cluster.EtcdMember {
+	members, err := s.cluster.EtcdMembers()
+	if err != nil {
+		ClusterPanic(err)
+	}
+	return members
+}
+
+func decodeAddMemberRequest(w http.ResponseWriter, r *http.Request) (*AddMemberRequest, bool) {
+	req := &AddMemberRequest{}
+	if err := codectool.Decode(r.Body, req); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("decode request failed: %v", err))
+		return nil, false
+	}
+	if err := common.ValidateName(req.Name); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return nil, false
+	}
+	if _, err := option.ParseURLs(req.PeerURLs); err != nil || len(req.PeerURLs) == 0 {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid peerURLs: %v", req.PeerURLs))
+		return nil, false
+	}
+	return req, true
+}
+
+func (s *Server) listEtcdMembers(w http.ResponseWriter, r *http.Request) {
+	WriteBody(w, r, s._etcdMembers())
+}
+
+// addLearner adds a primary member as a learner, which receives the data
+// but doesn't vote, so it never affects the quorum until promoted.
+func (s *Server) addLearner(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeAddMemberRequest(w, r)
+	if !ok {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if cluster.FindEtcdMember(s._etcdMembers(), req.Name) != nil {
+		HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("member %s already exists", req.Name))
+		return
+	}
+
+	members, err := s.cluster.AddLearner(req.Name, req.PeerURLs)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("add learner %s failed: %v", req.Name, err))
+		return
+	}
+
+	WriteBody(w, r, &AddMemberResponse{
+		Members:        members,
+		InitialCluster: cluster.InitialClusterOf(members),
+	})
+}
+
+func (s *Server) promoteMember(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "member")
+
+	s.Lock()
+	defer s.Unlock()
+
+	member := cluster.FindEtcdMember(s._etcdMembers(), name)
+	if member == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("member %s not found", name))
+		return
+	}
+
+	// etcd rejects promoting a learner which is not in sync with the
+	// leader, so the error is likely to be temporary.
+	if err := s.cluster.PromoteMember(name); err != nil {
+		HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("promote member %s failed: %v", name, err))
+		return
+	}
+}
+
+// _removeMember removes the member from the etcd cluster, and purges its
+// data in the cluster if it has ever started.
+func (s *Server) _removeMember(name string) error {
+	if err := s.cluster.RemoveMember(name); err != nil {
+		return err
+	}
+
+	leaseStr, err := s.cluster.Get(s.cluster.Layout().OtherLease(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if leaseStr != nil {
+		s._purgeMember(name)
+	}
+	return nil
+}
+
+// checkRemoval checks the member could be removed without losing the
+// quorum, the member serving the request is never removed by itself.
+func (s *Server) checkRemoval(w http.ResponseWriter, r *http.Request, members []*cluster.EtcdMember, name string) bool {
+	if cluster.FindEtcdMember(members, name) == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("member %s not found", name))
+		return false
+	}
+	if name == s.opt.Name {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("member %s can't remove itself, please send the request to another member", name))
+		return false
+	}
+	if err := cluster.CheckRemoval(members, name); err != nil {
+		HandleAPIError(w, r, http.StatusConflict, err)
+		return false
+	}
+	return true
+}
+
+func (s *Server) removeMember(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "member")
+
+	s.Lock()
+	defer s.Unlock()
+
+	if !s.checkRemoval(w, r, s._etcdMembers(), name) {
+		return
+	}
+
+	if err := s._removeMember(name); err != nil {
+		HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("remove member %s failed: %v", name, err))
+		return
+	}
+}
+
+// replaceMember adds the new member as a learner first, then removes the
+// old one, the new member should be promoted after it is started and in
+// sync with the leader.
+func (s *Server) replaceMember(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "member")
+	req, ok := decodeAddMemberRequest(w, r)
+	if !ok {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	members := s._etcdMembers()
+	if !s.checkRemoval(w, r, members, name) {
+		return
+	}
+	if cluster.FindEtcdMember(members, req.Name) != nil {
+		HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("member %s already exists", req.Name))
+		return
+	}
+
+	members, err := s.cluster.AddLearner(req.Name, req.PeerURLs)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("add learner %s failed: %v", req.Name, err))
+		return
+	}
+
+	if err := s._removeMember(name); err != nil {
+		// roll back, so the failed replacement leaves nothing behind.
+		learner := cluster.FindEtcdMember(members, req.Name)
+		if err := s.cluster.RemoveMember(learner.ID); err != nil {
+			logger.Errorf("remove learner %s failed: %v", req.Name, err)
+		}
+		HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("remove member %s failed: %v", name, err))
+		return
+	}
+
+	remaining := make([]*cluster.EtcdMember, 0, len(members))
+	for _, m := range members {
+		if m.Name != name {
+			remaining = append(remaining, m)
+		}
+	}
+	WriteBody(w, r, &AddMemberResponse{
+		Members:        remaining,
+		InitialCluster: cluster.InitialClusterOf(remaining),
+	})
+}
@@ -0,0 +1,36 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"github.com/megaease/easegress/pkg/util/prometheushelper"
+)
+
+// MetricsPath is the path of the Prometheus metrics, it is served without
+// the API prefix too, as it is the default path of Prometheus.
+const MetricsPath = "/metrics"
+
+func (s *Server) metricsAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    MetricsPath,
+			Method:  "GET",
+			Handler: prometheushelper.Handler().ServeHTTP,
+		},
+	}
+}
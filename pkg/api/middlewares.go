@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"net/http"
 	"runtime/debug"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
@@ -69,3 +70,36 @@ func (m *dynamicMux) newConfigVersionAttacher(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// readOnlyPrefixes are the APIs which change the configuration mirrored
+// from the upstream cluster.
+var readOnlyPrefixes = []string{ObjectPrefix, SecretPrefix, CustomDataKindPrefix, "/customdata"}
+
+func isConfigChange(r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return false
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, APIPrefixV1)
+	path = strings.TrimPrefix(path, APIPrefixV2)
+	for _, prefix := range readOnlyPrefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *dynamicMux) newReadOnlyGuard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isConfigChange(r) {
+			err := fmt.Errorf("configuration is read-only in this cluster, please change it in the upstream cluster")
+			if dir := m.server.opt.ObjectsDir; dir != "" {
+				err = fmt.Errorf("configuration is read-only in this cluster, please change the objects in %s", dir)
+			}
+			HandleAPIError(w, r, http.StatusForbidden, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
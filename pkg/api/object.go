@@ -38,6 +38,10 @@ const (
 
 	// StatusObjectPrefix is the prefix of object status.
 	StatusObjectPrefix = "/status/objects"
+
+	// StatusDependencyPath is the path of the dependency graph of the
+	// objects, with their readiness.
+	StatusDependencyPath = "/status/dependencies"
 )
 
 func (s *Server) objectAPIEntries() []*Entry {
@@ -82,6 +86,11 @@ func (s *Server) objectAPIEntries() []*Entry {
 			Method:  "GET",
 			Handler: s.getStatusObject,
 		},
+		{
+			Path:    StatusDependencyPath,
+			Method:  "GET",
+			Handler: s.getDependencyGraph,
+		},
 	}
 }
 
@@ -104,8 +113,10 @@ func (s *Server) readObjectSpec(w http.ResponseWriter, r *http.Request) (*superv
 	return spec, err
 }
 
-func (s *Server) upgradeConfigVersion(w http.ResponseWriter, r *http.Request) {
-	version := s._plusOneVersion()
+func (s *Server) applyObject(w http.ResponseWriter, r *http.Request, change *objectChange) {
+	changes := []*objectChange{change}
+	version := s._applyObjects(changes, 0)
+	auditChanges(r, version, changes)
 	w.Header().Set(ConfigVersionKey, fmt.Sprintf("%d", version))
 }
 
@@ -127,8 +138,7 @@ func (s *Server) createObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s._putObject(spec)
-	s.upgradeConfigVersion(w, r)
+	s.applyObject(w, r, &objectChange{name: name, action: actionCreate, spec: spec})
 
 	w.WriteHeader(http.StatusCreated)
 	location := fmt.Sprintf("%s/%s", r.URL.Path, name)
@@ -147,8 +157,7 @@ func (s *Server) deleteObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s._deleteObject(name)
-	s.upgradeConfigVersion(w, r)
+	s.applyObject(w, r, &objectChange{name: name, action: actionDelete})
 }
 
 func (s *Server) getObject(w http.ResponseWriter, r *http.Request) {
@@ -190,12 +199,17 @@ func (s *Server) updateObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s._putObject(spec)
-	s.upgradeConfigVersion(w, r)
+	s.applyObject(w, r, &objectChange{name: name, action: actionUpdate, spec: spec})
 }
 
 func (s *Server) listObjects(w http.ResponseWriter, r *http.Request) {
 	// No need to lock.
+
+	if r.URL.Query().Get("watch") == "true" {
+		s.watchObjects(w, r)
+		return
+	}
+
 	specs := specList(s._listObjects())
 	// NOTE: Keep it consistent.
 	sort.Sort(specs)
@@ -213,6 +227,11 @@ func (s *Server) getStatusObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.URL.Query().Get("watch") == "true" {
+		s.watchStatusObjects(w, r, name)
+		return
+	}
+
 	status := s._getStatusObject(name)
 
 	WriteBody(w, r, status)
@@ -221,11 +240,28 @@ func (s *Server) getStatusObject(w http.ResponseWriter, r *http.Request) {
 func (s *Server) listStatusObjects(w http.ResponseWriter, r *http.Request) {
 	// No need to lock.
 
+	if r.URL.Query().Get("watch") == "true" {
+		s.watchStatusObjects(w, r, "")
+		return
+	}
+
 	status := s._listStatusObjects()
 
 	WriteBody(w, r, status)
 }
 
+// getDependencyGraph returns the dependency graph of the objects of the
+// member serving the request, the readiness is evaluated locally.
+func (s *Server) getDependencyGraph(w http.ResponseWriter, r *http.Request) {
+	graph := s.super.DependencyGraph()
+	if graph == nil {
+		HandleAPIError(w, r, http.StatusServiceUnavailable, fmt.Errorf("dependency graph is not evaluated yet"))
+		return
+	}
+
+	WriteBody(w, r, graph)
+}
+
 type specList []*supervisor.Spec
 
 func (s specList) Less(i, j int) bool { return s[i].Name() < s[j].Name() }
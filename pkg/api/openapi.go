@@ -0,0 +1,454 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/v"
+	"github.com/megaease/easegress/pkg/version"
+)
+
+const (
+	// OpenAPIPath is the path of the OpenAPI document of the admin API.
+	OpenAPIPath = "/openapi"
+
+	// NOTE: OpenAPI 3.1 is fully compatible with JSON Schema, so the
+	// schemas generated from the jsonschema tags are used as they are.
+	openAPIVersion = "3.1.0"
+
+	openAPISchemaRefPrefix = "#/components/schemas/"
+)
+
+type (
+	openAPIDocument struct {
+		OpenAPI    string                                  `json:"openapi"`
+		Info       *openAPIInfo                            `json:"info"`
+		Servers    []*openAPIServer                        `json:"servers"`
+		Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+		Components *openAPIComponents                      `json:"components"`
+	}
+
+	openAPIInfo struct {
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	}
+
+	openAPIServer struct {
+		URL string `json:"url"`
+	}
+
+	openAPIComponents struct {
+		Schemas map[string]openAPISchema `json:"schemas"`
+	}
+
+	openAPIOperation struct {
+		OperationID string                      `json:"operationId"`
+		Summary     string                      `json:"summary,omitempty"`
+		Tags        []string                    `json:"tags"`
+		Parameters  []*openAPIParameter         `json:"parameters,omitempty"`
+		RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+		Responses   map[string]*openAPIResponse `json:"responses"`
+	}
+
+	openAPIParameter struct {
+		Name        string        `json:"name"`
+		In          string        `json:"in"`
+		Description string        `json:"description,omitempty"`
+		Required    bool          `json:"required,omitempty"`
+		Schema      openAPISchema `json:"schema"`
+	}
+
+	openAPIRequestBody struct {
+		Required bool                         `json:"required"`
+		Content  map[string]*openAPIMediaType `json:"content"`
+	}
+
+	openAPIResponse struct {
+		Description string                       `json:"description"`
+		Content     map[string]*openAPIMediaType `json:"content,omitempty"`
+	}
+
+	openAPIMediaType struct {
+		Schema openAPISchema `json:"schema"`
+	}
+
+	openAPISchema = map[string]interface{}
+
+	// openAPIOperationMeta is the knowledge of an operation which can't be
+	// discovered from the registered API entries.
+	openAPIOperationMeta struct {
+		summary     string
+		query       []*openAPIParameter
+		request     openAPISchema
+		status      string
+		response    openAPISchema
+		contentType string
+	}
+)
+
+var (
+	openAPIPathParamRegexp = regexp.MustCompile(`{([^}]+)}`)
+
+	// openAPIAPITypes are the types of the requests and responses, whose
+	// schemas are put in the components.
+	openAPIAPITypes = map[string]interface{}{
+		"Error":            Err{},
+		"ApplyRequest":     ApplyRequest{},
+		"ApplyResponse":    ApplyResponse{},
+		"ObjectRevision":   ObjectRevision{},
+		"ObjectDiff":       ObjectDiff{},
+		"RollbackRequest":  RollbackRequest{},
+		"RollbackResponse": RollbackResponse{},
+		"AuditEntry":       AuditEntry{},
+		"DryRunRequest":    DryRunRequest{},
+		"DryRunResponse":   DryRunResponse{},
+		"TrafficSnapshot":  TrafficSnapshot{},
+		"DependencyGraph":  supervisor.DependencyGraph{},
+	}
+
+	openAPIWatchParam = &openAPIParameter{
+		Name:        "watch",
+		In:          "query",
+		Description: "Stream the changes as newline delimited JSON, Server-Sent Events or WebSocket messages.",
+		Schema:      openAPISchema{"type": "boolean"},
+	}
+
+	openAPIOperationMetas = map[string]*openAPIOperationMeta{
+		"GET " + ObjectKindsPrefix: {
+			summary:  "List the kinds of objects",
+			response: openAPIArrayOf(openAPISchema{"type": "string"}),
+		},
+		"POST " + ObjectPrefix: {
+			summary: "Create an object",
+			request: openAPISchemaRef("ObjectSpec"),
+			status:  "201",
+		},
+		"GET " + ObjectPrefix: {
+			summary:  "List objects",
+			query:    []*openAPIParameter{openAPIWatchParam},
+			response: openAPIArrayOf(openAPISchemaRef("ObjectSpec")),
+		},
+		"GET " + ObjectPrefix + "/{name}": {
+			summary:  "Get an object",
+			response: openAPISchemaRef("ObjectSpec"),
+		},
+		"PUT " + ObjectPrefix + "/{name}": {
+			summary: "Update an object",
+			request: openAPISchemaRef("ObjectSpec"),
+		},
+		"DELETE " + ObjectPrefix + "/{name}": {
+			summary: "Delete an object",
+		},
+		"GET " + StatusObjectPrefix: {
+			summary:  "List the statuses of objects",
+			query:    []*openAPIParameter{openAPIWatchParam},
+			response: openAPISchema{"type": "object"},
+		},
+		"GET " + StatusObjectPrefix + "/{name}": {
+			summary:  "Get the status of an object",
+			query:    []*openAPIParameter{openAPIWatchParam},
+			response: openAPISchema{"type": "object"},
+		},
+		"GET " + ObjectPrefix + "/{name}/history": {
+			summary:  "List the revisions of an object",
+			response: openAPIArrayOf(openAPISchemaRef("ObjectRevision")),
+		},
+		"GET " + ObjectPrefix + "/{name}/diff": {
+			summary: "Diff two revisions of an object",
+			query: []*openAPIParameter{
+				{Name: "from", In: "query", Schema: openAPISchema{"type": "integer"}},
+				{Name: "to", In: "query", Schema: openAPISchema{"type": "integer"}},
+			},
+			response: openAPISchemaRef("ObjectDiff"),
+		},
+		"POST " + ObjectRollbackPrefix: {
+			summary:  "Roll back objects to a revision",
+			request:  openAPISchemaRef("RollbackRequest"),
+			response: openAPISchemaRef("RollbackResponse"),
+		},
+		"POST " + ObjectApplyPrefix: {
+			summary:  "Apply a bundle of objects",
+			request:  openAPISchemaRef("ApplyRequest"),
+			response: openAPISchemaRef("ApplyResponse"),
+		},
+		"GET " + AuditPrefix: {
+			summary: "List the audit entries",
+			query: []*openAPIParameter{
+				{Name: "since", In: "query", Description: "RFC3339 time or a duration before now.", Schema: openAPISchema{"type": "string"}},
+				{Name: "limit", In: "query", Schema: openAPISchema{"type": "integer"}},
+				{Name: "object", In: "query", Schema: openAPISchema{"type": "string"}},
+				{Name: "actor", In: "query", Schema: openAPISchema{"type": "string"}},
+			},
+			response: openAPIArrayOf(openAPISchemaRef("AuditEntry")),
+		},
+		"GET " + FilterMetaPrefix: {
+			summary:  "List the kinds of filters",
+			response: openAPIArrayOf(openAPISchema{"type": "string"}),
+		},
+		"GET " + FilterMetaPrefix + "/{kind}/schema": {
+			summary:  "Get the JSON schema of a filter kind",
+			response: openAPISchema{"type": "object"},
+		},
+		"GET " + HealthzPath: {
+			summary: "Check the liveness of the member",
+		},
+		"GET " + ReadyzPath: {
+			summary:  "Check the readiness of the member",
+			response: openAPISchema{"type": "object"},
+		},
+		"GET " + StatusDependencyPath: {
+			summary:  "Get the dependency graph and the readiness of the objects",
+			response: openAPISchemaRef("DependencyGraph"),
+		},
+		"GET " + TrafficStatusPath: {
+			summary: "Stream the traffic statistics",
+			query: []*openAPIParameter{
+				{Name: "interval", In: "query", Schema: openAPISchema{"type": "string"}},
+				{Name: "topN", In: "query", Schema: openAPISchema{"type": "integer"}},
+			},
+			response:    openAPISchemaRef("TrafficSnapshot"),
+			contentType: "application/x-ndjson",
+		},
+		"POST " + PipelineDryRunPath: {
+			summary:  "Run a request through a pipeline",
+			request:  openAPISchemaRef("DryRunRequest"),
+			response: openAPISchemaRef("DryRunResponse"),
+		},
+		"GET " + PipelineGraphPath: {
+			summary: "Export the flow of a pipeline as a graph",
+			query: []*openAPIParameter{
+				{Name: "format", In: "query", Schema: openAPISchema{"type": "string", "enum": []string{"dot", "mermaid"}}},
+			},
+			response:    openAPISchema{"type": "string"},
+			contentType: "text/plain",
+		},
+		"GET " + OpenAPIPath: {
+			summary:  "Get the OpenAPI document of the admin API",
+			response: openAPISchema{"type": "object"},
+		},
+	}
+)
+
+func (s *Server) openAPIAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    OpenAPIPath,
+			Method:  "GET",
+			Handler: s.getOpenAPI,
+		},
+	}
+}
+
+// getOpenAPI generates the document on every request, since the API groups
+// and the kinds of objects and filters are registered dynamically.
+func (s *Server) getOpenAPI(w http.ResponseWriter, r *http.Request) {
+	WriteBody(w, r, newOpenAPIDocument())
+}
+
+func newOpenAPIDocument() *openAPIDocument {
+	doc := &openAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info: &openAPIInfo{
+			Title:   "Easegress Admin API",
+			Version: version.RELEASE,
+		},
+		Servers: []*openAPIServer{{URL: APIPrefixV2}},
+		Paths:   map[string]map[string]*openAPIOperation{},
+		Components: &openAPIComponents{
+			Schemas: openAPISchemas(),
+		},
+	}
+
+	apisMutex.Lock()
+	defer apisMutex.Unlock()
+
+	for _, group := range apis {
+		for _, entry := range group.Entries {
+			path := entry.Path
+			if path == "" {
+				path = "/"
+			}
+			method := strings.ToLower(entry.Method)
+
+			item := doc.Paths[path]
+			if item == nil {
+				item = map[string]*openAPIOperation{}
+				doc.Paths[path] = item
+			}
+			item[method] = newOpenAPIOperation(group.Group, entry.Method, path)
+		}
+	}
+
+	return doc
+}
+
+func newOpenAPIOperation(group, method, path string) *openAPIOperation {
+	op := &openAPIOperation{
+		OperationID: openAPIOperationID(method, path),
+		Tags:        []string{group},
+		Responses: map[string]*openAPIResponse{
+			"default": {
+				Description: "Error",
+				Content:     openAPIJSONContent(openAPISchemaRef("Error")),
+			},
+		},
+	}
+
+	for _, match := range openAPIPathParamRegexp.FindAllStringSubmatch(path, -1) {
+		op.Parameters = append(op.Parameters, &openAPIParameter{
+			Name:     match[1],
+			In:       "path",
+			Required: true,
+			Schema:   openAPISchema{"type": "string"},
+		})
+	}
+
+	status, resp := "200", &openAPIResponse{Description: "OK"}
+	op.Responses[status] = resp
+
+	meta := openAPIOperationMetas[method+" "+path]
+	if meta == nil {
+		return op
+	}
+
+	op.Summary = meta.summary
+	op.Parameters = append(op.Parameters, meta.query...)
+	if meta.request != nil {
+		op.RequestBody = &openAPIRequestBody{
+			Required: true,
+			Content:  openAPIJSONContent(meta.request),
+		}
+	}
+	if meta.status != "" {
+		delete(op.Responses, status)
+		op.Responses[meta.status] = resp
+	}
+	if meta.response != nil {
+		resp.Content = openAPIJSONContent(meta.response)
+		if meta.contentType != "" {
+			resp.Content = map[string]*openAPIMediaType{
+				meta.contentType: {Schema: meta.response},
+			}
+		}
+	}
+
+	return op
+}
+
+// openAPIOperationID converts the method and path to an operation id,
+// e.g. GET /objects/{name} to getObjectsByName.
+func openAPIOperationID(method, path string) string {
+	id := strings.ToLower(method)
+	segments := strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '-'
+	})
+	for _, seg := range segments {
+		if strings.HasPrefix(seg, "{") {
+			id += "By"
+			seg = strings.Trim(seg, "{}")
+		}
+		if seg != "" {
+			id += strings.ToUpper(seg[:1]) + seg[1:]
+		}
+	}
+	return id
+}
+
+// openAPISchemas returns the schemas of the requests and responses, the
+// objects, whose names are prefixed with objects., and the filters, whose
+// names are prefixed with filters.
+func openAPISchemas() map[string]openAPISchema {
+	schemas := map[string]openAPISchema{}
+
+	for name, t := range openAPIAPITypes {
+		if schema := openAPITypeSchema(name, t); schema != nil {
+			schemas[name] = schema
+		}
+	}
+
+	meta := openAPITypeSchema("MetaSpec", supervisor.MetaSpec{})
+	resource := openAPITypeSchema("ResourceSpec", supervisor.ResourceSpec{})
+	kinds := supervisor.ObjectKinds()
+	sort.Strings(kinds)
+	objectRefs := []interface{}{}
+	for _, kind := range kinds {
+		spec, _ := supervisor.ObjectDefaultSpec(kind)
+		schema := openAPITypeSchema(kind, spec)
+		if schema == nil {
+			continue
+		}
+
+		name := "objects." + kind
+		schemas[name] = openAPISchema{"allOf": []interface{}{meta, resource, schema}}
+		objectRefs = append(objectRefs, openAPISchemaRef(name))
+	}
+	schemas["ObjectSpec"] = openAPISchema{"oneOf": objectRefs}
+
+	filters.WalkKind(func(k *filters.Kind) bool {
+		if schema := openAPITypeSchema(k.Name, k.DefaultSpec()); schema != nil {
+			schemas["filters."+k.Name] = schema
+		}
+		return true
+	})
+
+	return schemas
+}
+
+func openAPITypeSchema(name string, t interface{}) openAPISchema {
+	if t == nil {
+		return nil
+	}
+
+	buff, err := v.GetSchemaInJSON(reflect.TypeOf(t))
+	if err != nil {
+		logger.Errorf("get schema for %s failed: %v", name, err)
+		return nil
+	}
+
+	schema := openAPISchema{}
+	if err = codectool.UnmarshalJSON(buff, &schema); err != nil {
+		logger.Errorf("unmarshal schema of %s failed: %v", name, err)
+		return nil
+	}
+	delete(schema, "$schema")
+
+	return schema
+}
+
+func openAPISchemaRef(name string) openAPISchema {
+	return openAPISchema{"$ref": openAPISchemaRefPrefix + name}
+}
+
+func openAPIArrayOf(items openAPISchema) openAPISchema {
+	return openAPISchema{"type": "array", "items": items}
+}
+
+func openAPIJSONContent(schema openAPISchema) map[string]*openAPIMediaType {
+	return map[string]*openAPIMediaType{
+		"application/json": {Schema: schema},
+	}
+}
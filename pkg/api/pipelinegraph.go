@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/object/pipeline"
+)
+
+// PipelineGraphPath is the path to export the flow of a pipeline as a graph.
+const PipelineGraphPath = "/pipelines/{name}/graph"
+
+func appendPipelineGraphAPI(s *Server, group *Group) {
+	entry := &Entry{
+		Path:    PipelineGraphPath,
+		Method:  http.MethodGet,
+		Handler: s.getPipelineGraph,
+	}
+	group.Entries = append(group.Entries, entry)
+}
+
+func init() {
+	appendAddonAPIs = append(appendAddonAPIs, appendPipelineGraphAPI)
+}
+
+// getPipelineGraph exports the flow of the pipeline in the format of the
+// query parameter format, which is dot by default or mermaid.
+func (s *Server) getPipelineGraph(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	spec := s._getObject(name)
+	if spec == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	if spec.Kind() != pipeline.Kind {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("%s is a %s, not a %s", name, spec.Kind(), pipeline.Kind))
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = pipeline.GraphFormatDOT
+	}
+
+	graph, err := spec.ObjectSpec().(*pipeline.Spec).Graph().Format(name, format)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	contentType := "text/plain; charset=utf-8"
+	if format == pipeline.GraphFormatDOT {
+		contentType = "text/vnd.graphviz"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write([]byte(graph))
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/filters/quota"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func (s *Server) quotaListUsages(w http.ResponseWriter, r *http.Request) {
+	pipeline := chi.URLParam(r, "pipeline")
+	filter := chi.URLParam(r, "filter")
+	if !s.isFilterExist(pipeline, filter, quota.Kind) {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	layout := s.cluster.Layout()
+	if consumer := r.URL.Query().Get("consumer"); consumer != "" {
+		value, err := s.cluster.Get(layout.QuotaUsageKey(pipeline, filter, consumer))
+		if err != nil {
+			ClusterPanic(err)
+		}
+		if value == nil {
+			HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("usage of %s not found", consumer))
+			return
+		}
+
+		usage := &quota.Usage{}
+		if err = codectool.UnmarshalJSON([]byte(*value), usage); err != nil {
+			HandleAPIError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		WriteBody(w, r, usage)
+		return
+	}
+
+	kvs, err := s.cluster.GetPrefix(layout.QuotaPrefix(pipeline, filter))
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	usages := make([]*quota.Usage, 0, len(kvs))
+	for _, v := range kvs {
+		usage := &quota.Usage{}
+		if err = codectool.UnmarshalJSON([]byte(v), usage); err != nil {
+			continue
+		}
+		usages = append(usages, usage)
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].Consumer < usages[j].Consumer
+	})
+
+	WriteBody(w, r, usages)
+}
+
+func (s *Server) quotaResetUsages(w http.ResponseWriter, r *http.Request) {
+	pipeline := chi.URLParam(r, "pipeline")
+	filter := chi.URLParam(r, "filter")
+	if !s.isFilterExist(pipeline, filter, quota.Kind) {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	// reset the usage of the consumer if specified, all usages otherwise.
+	layout := s.cluster.Layout()
+	var err error
+	if consumer := r.URL.Query().Get("consumer"); consumer != "" {
+		err = s.cluster.Delete(layout.QuotaUsageKey(pipeline, filter, consumer))
+	} else {
+		err = s.cluster.DeletePrefix(layout.QuotaPrefix(pipeline, filter))
+	}
+	if err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func appendQuotaAPI(s *Server, group *Group) {
+	group.Entries = append(group.Entries,
+		&Entry{
+			Path:    "/quotas/{pipeline}/{filter}",
+			Method:  http.MethodGet,
+			Handler: s.quotaListUsages,
+		},
+		&Entry{
+			Path:    "/quotas/{pipeline}/{filter}",
+			Method:  http.MethodDelete,
+			Handler: s.quotaResetUsages,
+		},
+	)
+}
+
+func init() {
+	appendAddonAPIs = append(appendAddonAPIs, appendQuotaAPI)
+}
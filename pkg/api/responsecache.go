@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/filters/responsecache"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func (s *Server) responseCachePurge(w http.ResponseWriter, r *http.Request) {
+	pipeline := chi.URLParam(r, "pipeline")
+	filter := chi.URLParam(r, "filter")
+	if !s.isFilterExist(pipeline, filter, responsecache.Kind) {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	event := &responsecache.PurgeEvent{
+		Key:    r.URL.Query().Get("key"),
+		Prefix: r.URL.Query().Get("prefix"),
+		Time:   time.Now(),
+	}
+	if event.Key == "" && event.Prefix == "" {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("key or prefix is required"))
+		return
+	}
+
+	key := s.cluster.Layout().ResponseCachePurgeEvent(pipeline, filter)
+	if e := s.cluster.Put(key, string(codectool.MustMarshalJSON(event))); e != nil {
+		ClusterPanic(e)
+	}
+}
+
+func appendResponseCacheAPI(s *Server, group *Group) {
+	entry := &Entry{
+		Path:    "/response-cache/{pipeline}/{filter}",
+		Method:  http.MethodDelete,
+		Handler: s.responseCachePurge,
+	}
+	group.Entries = append(group.Entries, entry)
+}
+
+func init() {
+	appendAddonAPIs = append(appendAddonAPIs, appendResponseCacheAPI)
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/megaease/easegress/pkg/secret"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/v"
+)
+
+// SecretPrefix is the URL prefix of APIs for secrets
+const SecretPrefix = "/secrets"
+
+// NOTE: there's no API to read the value of a secret, values are only
+// used by resolving the secret references in specs.
+func (s *Server) secretAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    SecretPrefix,
+			Method:  http.MethodGet,
+			Handler: s.listSecrets,
+		},
+		{
+			Path:    SecretPrefix + "/{name}",
+			Method:  http.MethodGet,
+			Handler: s.getSecret,
+		},
+		{
+			Path:    SecretPrefix,
+			Method:  http.MethodPost,
+			Handler: s.createSecret,
+		},
+		{
+			Path:    SecretPrefix + "/{name}",
+			Method:  http.MethodPut,
+			Handler: s.updateSecret,
+		},
+		{
+			Path:    SecretPrefix + "/{name}",
+			Method:  http.MethodDelete,
+			Handler: s.deleteSecret,
+		},
+	}
+}
+
+// secrets returns the secret store, it responds 503 and returns nil if the
+// store is unavailable.
+func (s *Server) secrets(w http.ResponseWriter, r *http.Request) *secret.Store {
+	store := s.super.Secrets()
+	if store == nil {
+		HandleAPIError(w, r, http.StatusServiceUnavailable, fmt.Errorf("secrets are not available"))
+	}
+	return store
+}
+
+func (s *Server) listSecrets(w http.ResponseWriter, r *http.Request) {
+	store := s.secrets(w, r)
+	if store == nil {
+		return
+	}
+
+	infos, err := store.List()
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+
+	WriteBody(w, r, infos)
+}
+
+func (s *Server) getSecret(w http.ResponseWriter, r *http.Request) {
+	store := s.secrets(w, r)
+	if store == nil {
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	info, err := store.Info(name)
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if info == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", name))
+		return
+	}
+
+	WriteBody(w, r, info)
+}
+
+func (s *Server) readSecret(w http.ResponseWriter, r *http.Request) *secret.Secret {
+	sec := &secret.Secret{}
+	if err := codectool.Decode(r.Body, sec); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("decode secret failed: %v", err))
+		return nil
+	}
+
+	if vr := v.Validate(sec); !vr.Valid() {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("%v", vr))
+		return nil
+	}
+
+	if name := chi.URLParam(r, "name"); name != "" && name != sec.Name {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("inconsistent name in url and secret"))
+		return nil
+	}
+
+	return sec
+}
+
+func (s *Server) createSecret(w http.ResponseWriter, r *http.Request) {
+	store := s.secrets(w, r)
+	if store == nil {
+		return
+	}
+
+	sec := s.readSecret(w, r)
+	if sec == nil {
+		return
+	}
+
+	if err := store.Put(sec, false); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s/%s", r.URL.Path, sec.Name))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) updateSecret(w http.ResponseWriter, r *http.Request) {
+	store := s.secrets(w, r)
+	if store == nil {
+		return
+	}
+
+	sec := s.readSecret(w, r)
+	if sec == nil {
+		return
+	}
+
+	if err := store.Put(sec, true); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+	}
+}
+
+func (s *Server) deleteSecret(w http.ResponseWriter, r *http.Request) {
+	store := s.secrets(w, r)
+	if store == nil {
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	if err := store.Delete(name); err != nil {
+		HandleAPIError(w, r, http.StatusNotFound, err)
+	}
+}
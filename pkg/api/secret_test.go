@@ -0,0 +1,46 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretsUnavailable(t *testing.T) {
+	assert := assert.New(t)
+	s := newTestServer(newTestCluster())
+
+	secret := `{"name": "db-password", "value": "secret"}`
+	for _, c := range []struct {
+		handler http.HandlerFunc
+		method  string
+		body    string
+	}{
+		{s.listSecrets, http.MethodGet, ""},
+		{s.getSecret, http.MethodGet, ""},
+		{s.createSecret, http.MethodPost, secret},
+		{s.updateSecret, http.MethodPut, secret},
+		{s.deleteSecret, http.MethodDelete, ""},
+	} {
+		w := serve(c.handler, c.method, SecretPrefix, c.body)
+		assert.Equal(http.StatusServiceUnavailable, w.Code, c.method)
+	}
+}
@@ -41,6 +41,10 @@ type (
 		super   *supervisor.Supervisor
 		cds     *customdata.Store
 		profile pprof.Profile
+		done    chan struct{}
+
+		// snapshots is nil if the snapshot store failed to create.
+		snapshots snapshotStore
 
 		mutex      cluster.Mutex
 		mutexMutex sync.Mutex
@@ -67,6 +71,7 @@ func MustNewServer(opt *option.Options, cls cluster.Cluster, super *supervisor.S
 		cluster: cls,
 		super:   super,
 		profile: profile,
+		done:    make(chan struct{}),
 	}
 	s.router = newDynamicMux(s)
 	s.server = http.Server{Addr: opt.APIAddr, Handler: s.router}
@@ -80,8 +85,16 @@ func MustNewServer(opt *option.Options, cls cluster.Cluster, super *supervisor.S
 	dataPrefix := cls.Layout().CustomDataPrefix()
 	s.cds = customdata.NewStore(cls, kindPrefix, dataPrefix)
 
+	s.snapshots, err = newSnapshotStore(opt)
+	if err != nil {
+		logger.Errorf("create snapshot store failed: %v", err)
+	}
+
 	s.registerAPIs()
 
+	go s.runAuditPruner()
+	go s.runSnapshotScheduler()
+
 	go func() {
 		logger.Infof("api server running in %s", opt.APIAddr)
 		s.server.ListenAndServe()
@@ -94,6 +107,8 @@ func MustNewServer(opt *option.Options, cls cluster.Cluster, super *supervisor.S
 func (s *Server) Close(wg *sync.WaitGroup) {
 	defer wg.Done()
 
+	close(s.done)
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
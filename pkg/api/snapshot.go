@@ -0,0 +1,500 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// SnapshotPrefix is the path to list and take snapshots.
+	SnapshotPrefix = "/snapshots"
+	// SnapshotRestorePrefix is the path to restore the cluster from an
+	// uploaded snapshot.
+	SnapshotRestorePrefix = "/snapshots/restore"
+
+	snapshotTimeFormat = "20060102T150405Z"
+	snapshotBatchSize  = 128
+)
+
+var snapshotNameRegexp = regexp.MustCompile(`^snapshot-\d{8}T\d{6}Z\.json\.gz$`)
+
+type (
+	// Snapshot is a logical snapshot of the configuration in the cluster,
+	// it is stored as gzipped JSON.
+	Snapshot struct {
+		ClusterName string `json:"clusterName"`
+		Member      string `json:"member"`
+		CreatedAt   string `json:"createdAt"`
+		// Version is the config version when the snapshot was taken.
+		Version int64             `json:"version"`
+		KVs     map[string]string `json:"kvs"`
+	}
+
+	// SnapshotInfo is the information of a stored snapshot.
+	SnapshotInfo struct {
+		Name      string `json:"name"`
+		Size      int64  `json:"size"`
+		CreatedAt string `json:"createdAt"`
+	}
+
+	// RestoreResponse is the response of restoring a snapshot.
+	RestoreResponse struct {
+		Snapshot string `json:"snapshot,omitempty"`
+		// Version is the config version after restoring.
+		Version int64 `json:"version"`
+		Updated int   `json:"updated"`
+		Deleted int   `json:"deleted"`
+	}
+)
+
+func (s *Server) snapshotAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    SnapshotPrefix,
+			Method:  "GET",
+			Handler: s.listSnapshots,
+		},
+		{
+			Path:    SnapshotPrefix,
+			Method:  "POST",
+			Handler: s.createSnapshot,
+		},
+		{
+			Path:    SnapshotRestorePrefix,
+			Method:  "POST",
+			Handler: s.restoreUploadedSnapshot,
+		},
+		{
+			Path:    SnapshotPrefix + "/{name}",
+			Method:  "GET",
+			Handler: s.downloadSnapshot,
+		},
+		{
+			Path:    SnapshotPrefix + "/{name}/restore",
+			Method:  "POST",
+			Handler: s.restoreStoredSnapshot,
+		},
+	}
+}
+
+func isSnapshotName(name string) bool {
+	return snapshotNameRegexp.MatchString(name)
+}
+
+func snapshotName(t time.Time) string {
+	return "snapshot-" + t.UTC().Format(snapshotTimeFormat) + ".json.gz"
+}
+
+func newSnapshotInfo(name string, size int64) *SnapshotInfo {
+	info := &SnapshotInfo{Name: name, Size: size}
+	value := strings.TrimSuffix(strings.TrimPrefix(name, "snapshot-"), ".json.gz")
+	if t, err := time.Parse(snapshotTimeFormat, value); err == nil {
+		info.CreatedAt = t.Format(time.RFC3339)
+	}
+	return info
+}
+
+func encodeSnapshot(snapshot *Snapshot) ([]byte, error) {
+	buff := bytes.Buffer{}
+	zw := gzip.NewWriter(&buff)
+	if _, err := zw.Write(codectool.MustMarshalJSON(snapshot)); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buff.Bytes(), nil
+}
+
+// decodeSnapshot decodes the snapshot and validates its keys, so restoring
+// it never touches the data out of the snapshot prefixes.
+func (s *Server) decodeSnapshot(data []byte) (*Snapshot, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	snapshot := &Snapshot{}
+	if err := codectool.Decode(zr, snapshot); err != nil {
+		return nil, err
+	}
+
+	prefixes := s.cluster.Layout().SnapshotPrefixes()
+	for k := range snapshot.KVs {
+		if !hasAnyPrefix(k, prefixes) {
+			return nil, fmt.Errorf("unexpected key %s", k)
+		}
+	}
+
+	return snapshot, nil
+}
+
+func hasAnyPrefix(key string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseVersion(value string) int64 {
+	version, _ := strconv.ParseInt(value, 10, 64)
+	return version
+}
+
+// takeSnapshot reads the snapshot prefixes while holding the cluster
+// mutex, so no change from the administration API is half included.
+func (s *Server) takeSnapshot() (*Snapshot, error) {
+	mutex, err := s.getMutex()
+	if err != nil {
+		return nil, err
+	}
+	if err := mutex.Lock(); err != nil {
+		return nil, err
+	}
+	defer mutex.Unlock()
+
+	snapshot := &Snapshot{
+		ClusterName: s.opt.ClusterName,
+		Member:      s.opt.Name,
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+		KVs:         map[string]string{},
+	}
+	for _, prefix := range s.cluster.Layout().SnapshotPrefixes() {
+		kvs, err := s.cluster.GetPrefix(prefix)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range kvs {
+			snapshot.KVs[k] = v
+		}
+	}
+	snapshot.Version = parseVersion(snapshot.KVs[s.cluster.Layout().ConfigVersion()])
+
+	return snapshot, nil
+}
+
+// saveSnapshot takes a snapshot, stores it and removes the snapshots
+// beyond the retention.
+func (s *Server) saveSnapshot() (*SnapshotInfo, error) {
+	if s.snapshots == nil {
+		return nil, fmt.Errorf("snapshot store is unavailable, please check the server log")
+	}
+
+	snapshot, err := s.takeSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	data, err := encodeSnapshot(snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	name := snapshotName(time.Now())
+	if err := s.snapshots.put(name, data); err != nil {
+		return nil, err
+	}
+	logger.Infof("snapshot %s of config version %d saved", name, snapshot.Version)
+
+	if err := s.pruneSnapshots(); err != nil {
+		logger.Errorf("prune snapshots failed: %v", err)
+	}
+
+	return newSnapshotInfo(name, int64(len(data))), nil
+}
+
+func (s *Server) pruneSnapshots() error {
+	retention := s.opt.SnapshotRetention
+	if retention == 0 {
+		return nil
+	}
+
+	infos, err := s.snapshots.list()
+	if err != nil {
+		return err
+	}
+	for len(infos) > retention {
+		if err := s.snapshots.delete(infos[0].Name); err != nil {
+			return err
+		}
+		infos = infos[1:]
+	}
+	return nil
+}
+
+// runSnapshotScheduler takes snapshots periodically in the leader.
+func (s *Server) runSnapshotScheduler() {
+	interval := s.opt.GetSnapshotInterval()
+	if interval == 0 {
+		return
+	}
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-time.After(interval):
+		}
+
+		if !s.cluster.IsLeader() {
+			continue
+		}
+
+		if _, err := s.saveSnapshot(); err != nil {
+			logger.Errorf("take scheduled snapshot failed: %v", err)
+		}
+	}
+}
+
+// _restoreSnapshot makes the snapshot prefixes the same as the snapshot,
+// and bumps the config version beyond both the current one and the one
+// in the snapshot, so all members reload the configuration.
+//
+// The changes are written in batches, if any batch fails, the keys already
+// written are rolled back to their current values, so the cluster is never
+// left half restored.
+func (s *Server) _restoreSnapshot(snapshot *Snapshot) *RestoreResponse {
+	layout := s.cluster.Layout()
+	versionKey := layout.ConfigVersion()
+
+	resp := &RestoreResponse{}
+	changes := map[string]*string{}
+	kvs := map[string]string{}
+	for k, v := range snapshot.KVs {
+		kvs[k] = v
+	}
+	current := map[string]string{}
+	for _, prefix := range layout.SnapshotPrefixes() {
+		prefixKVs, err := s.cluster.GetPrefix(prefix)
+		if err != nil {
+			ClusterPanic(err)
+		}
+		for k, v := range prefixKVs {
+			current[k] = v
+		}
+	}
+	for k, v := range current {
+		sv, ok := kvs[k]
+		switch {
+		case k == versionKey:
+		case !ok:
+			changes[k] = nil
+			resp.Deleted++
+		case sv != v:
+			changes[k] = &sv
+			resp.Updated++
+		}
+		delete(kvs, k)
+	}
+	for k, v := range kvs {
+		if k == versionKey {
+			continue
+		}
+		v := v
+		changes[k] = &v
+		resp.Updated++
+	}
+
+	version := s._getVersion()
+	if snapshot.Version > version {
+		version = snapshot.Version
+	}
+	resp.Version = version + 1
+
+	keys := make([]string, 0, len(changes)+1)
+	for k := range changes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// the version is changed in the last batch.
+	versionStr := strconv.FormatInt(resp.Version, 10)
+	changes[versionKey] = &versionStr
+	keys = append(keys, versionKey)
+
+	err := s.putInBatches(keys, func(k string) *string { return changes[k] }, func(written []string) {
+		rollback := func(k string) *string {
+			if v, ok := current[k]; ok {
+				return &v
+			}
+			return nil
+		}
+		if err := s.putInBatches(written, rollback, nil); err != nil {
+			logger.Errorf("roll back restoring snapshot failed: %v", err)
+		} else {
+			logger.Warnf("restoring snapshot failed, %d keys are rolled back", len(written))
+		}
+	})
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	return resp
+}
+
+// putInBatches puts or deletes the keys in batches of snapshotBatchSize,
+// the values are returned by valueOf, and nil means deleting. If a batch
+// fails, onError is called with the keys of the succeeded batches.
+func (s *Server) putInBatches(keys []string, valueOf func(string) *string, onError func(written []string)) error {
+	for start := 0; start < len(keys); start += snapshotBatchSize {
+		end := start + snapshotBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		batch := map[string]*string{}
+		for _, k := range keys[start:end] {
+			batch[k] = valueOf(k)
+		}
+		if err := s.cluster.PutAndDelete(batch); err != nil {
+			if onError != nil {
+				onError(keys[:start])
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) restoreSnapshot(w http.ResponseWriter, r *http.Request, name string, data []byte) {
+	if s.opt.IsConfigReadOnly() {
+		HandleAPIError(w, r, http.StatusForbidden, fmt.Errorf("configuration is read-only in this cluster"))
+		return
+	}
+
+	snapshot, err := s.decodeSnapshot(data)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid snapshot: %v", err))
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	resp := s._restoreSnapshot(snapshot)
+	resp.Snapshot = name
+	auditChanges(r, resp.Version, nil)
+	logger.Infof("restored snapshot %s taken at %s, config version %d",
+		name, snapshot.CreatedAt, resp.Version)
+
+	w.Header().Set(ConfigVersionKey, fmt.Sprintf("%d", resp.Version))
+	WriteBody(w, r, resp)
+}
+
+func (s *Server) getSnapshot(w http.ResponseWriter, r *http.Request) (string, []byte, bool) {
+	if s.snapshots == nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("snapshot store is unavailable, please check the server log"))
+		return "", nil, false
+	}
+
+	name := chi.URLParam(r, "name")
+	if !isSnapshotName(name) {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid snapshot name %s", name))
+		return "", nil, false
+	}
+
+	data, err := s.snapshots.get(name)
+	if err == errSnapshotNotFound {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("snapshot %s not found", name))
+		return "", nil, false
+	}
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("get snapshot %s failed: %v", name, err))
+		return "", nil, false
+	}
+
+	return name, data, true
+}
+
+func (s *Server) listSnapshots(w http.ResponseWriter, r *http.Request) {
+	if s.snapshots == nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("snapshot store is unavailable, please check the server log"))
+		return
+	}
+
+	infos, err := s.snapshots.list()
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("list snapshots failed: %v", err))
+		return
+	}
+
+	// from the newest to the oldest.
+	result := make([]*SnapshotInfo, 0, len(infos))
+	for i := len(infos) - 1; i >= 0; i-- {
+		result = append(result, infos[i])
+	}
+
+	WriteBody(w, r, result)
+}
+
+func (s *Server) createSnapshot(w http.ResponseWriter, r *http.Request) {
+	info, err := s.saveSnapshot()
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("take snapshot failed: %v", err))
+		return
+	}
+
+	WriteBody(w, r, info)
+}
+
+func (s *Server) downloadSnapshot(w http.ResponseWriter, r *http.Request) {
+	name, data, ok := s.getSnapshot(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Write(data)
+}
+
+func (s *Server) restoreStoredSnapshot(w http.ResponseWriter, r *http.Request) {
+	name, data, ok := s.getSnapshot(w, r)
+	if !ok {
+		return
+	}
+
+	s.restoreSnapshot(w, r, name, data)
+}
+
+func (s *Server) restoreUploadedSnapshot(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read snapshot failed: %v", err))
+		return
+	}
+
+	s.restoreSnapshot(w, r, "", data)
+}
@@ -0,0 +1,396 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/signer"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSnapshotTestServer(t *testing.T) (*Server, *testCluster) {
+	cls := newTestCluster()
+	cls.MockedLayout = func() *cluster.Layout {
+		return &cluster.Layout{}
+	}
+	cls.kvs = map[string]string{
+		"/config/version":          "5",
+		"/config/objects/a":        "a",
+		"/config/objects/b":        "b",
+		"/secrets/s":               "s",
+		"/custom-data/kind/d":      "d",
+		"/webhook-subscribers/w":   "w",
+		"/status/objects/a/member": "status",
+		"/leases/member":           "lease",
+	}
+
+	s := newTestServer(cls)
+	s.opt = &option.Options{ClusterName: "eg", Name: "member", SnapshotRetention: 3}
+	s.snapshots = &diskSnapshotStore{dir: t.TempDir()}
+	return s, cls
+}
+
+// serveSnapshot calls the handler with the name of the snapshot in the URL.
+func serveSnapshot(handler http.HandlerFunc, name string) *httptest.ResponseRecorder {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("name", name)
+	r := httptest.NewRequest(http.MethodPost, SnapshotPrefix+"/"+name, nil)
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func (c *testCluster) snapshotKVs() map[string]string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	kvs := map[string]string{}
+	for k, v := range c.kvs {
+		kvs[k] = v
+	}
+	return kvs
+}
+
+func TestCreateSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	s, _ := newSnapshotTestServer(t)
+
+	// the old snapshots beyond the retention are removed.
+	store := s.snapshots.(*diskSnapshotStore)
+	for _, name := range []string{
+		"snapshot-20200101T000000Z.json.gz",
+		"snapshot-20200102T000000Z.json.gz",
+		"snapshot-20200103T000000Z.json.gz",
+		"not-a-snapshot.json.gz",
+	} {
+		assert.NoError(store.put(name, []byte("old")))
+	}
+
+	w := serve(s.createSnapshot, http.MethodPost, SnapshotPrefix, "")
+	assert.Equal(http.StatusOK, w.Code)
+	info := &SnapshotInfo{}
+	assert.NoError(codectool.UnmarshalJSON(w.Body.Bytes(), info))
+	assert.True(isSnapshotName(info.Name))
+	assert.NotEmpty(info.CreatedAt)
+
+	w = serve(s.listSnapshots, http.MethodGet, SnapshotPrefix, "")
+	assert.Equal(http.StatusOK, w.Code)
+	infos := []*SnapshotInfo{}
+	assert.NoError(codectool.UnmarshalJSON(w.Body.Bytes(), &infos))
+	assert.Len(infos, 3)
+	assert.Equal(info.Name, infos[0].Name)
+	assert.Equal("snapshot-20200103T000000Z.json.gz", infos[1].Name)
+	assert.Equal("snapshot-20200102T000000Z.json.gz", infos[2].Name)
+	_, err := os.Stat(filepath.Join(store.dir, "not-a-snapshot.json.gz"))
+	assert.NoError(err)
+
+	// only the snapshot prefixes are saved.
+	w = serveSnapshot(s.downloadSnapshot, info.Name)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("application/gzip", w.Header().Get("Content-Type"))
+	snapshot, err := s.decodeSnapshot(w.Body.Bytes())
+	assert.NoError(err)
+	assert.Equal("eg", snapshot.ClusterName)
+	assert.Equal("member", snapshot.Member)
+	assert.Equal(int64(5), snapshot.Version)
+	assert.Equal(map[string]string{
+		"/config/version":        "5",
+		"/config/objects/a":      "a",
+		"/config/objects/b":      "b",
+		"/secrets/s":             "s",
+		"/custom-data/kind/d":    "d",
+		"/webhook-subscribers/w": "w",
+	}, snapshot.KVs)
+
+	w = serveSnapshot(s.downloadSnapshot, "snapshot-20000101T000000Z.json.gz")
+	assert.Equal(http.StatusNotFound, w.Code)
+	w = serveSnapshot(s.downloadSnapshot, "../config.yaml")
+	assert.Equal(http.StatusBadRequest, w.Code)
+
+	s.snapshots = nil
+	w = serve(s.createSnapshot, http.MethodPost, SnapshotPrefix, "")
+	assert.Equal(http.StatusInternalServerError, w.Code)
+}
+
+func TestRestoreSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	s, cls := newSnapshotTestServer(t)
+
+	info, err := s.saveSnapshot()
+	assert.NoError(err)
+	saved := cls.snapshotKVs()
+
+	// change the cluster after the snapshot.
+	assert.NoError(cls.PutAndDelete(map[string]*string{
+		"/config/version":          strPtr("8"),
+		"/config/objects/a":        strPtr("a2"),
+		"/config/objects/b":        nil,
+		"/config/objects/c":        strPtr("c"),
+		"/secrets/s":               nil,
+		"/status/objects/a/member": strPtr("status2"),
+	}))
+
+	w := serveSnapshot(s.restoreStoredSnapshot, info.Name)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("9", w.Header().Get(ConfigVersionKey))
+	resp := &RestoreResponse{}
+	assert.NoError(codectool.UnmarshalJSON(w.Body.Bytes(), resp))
+	assert.Equal(&RestoreResponse{Snapshot: info.Name, Version: 9, Updated: 3, Deleted: 1}, resp)
+
+	// the keys out of the snapshot prefixes are not touched.
+	saved["/config/version"] = "9"
+	saved["/status/objects/a/member"] = "status2"
+	assert.Equal(saved, cls.snapshotKVs())
+
+	// the version of the snapshot is newer.
+	data, err := encodeSnapshot(&Snapshot{Version: 20, KVs: map[string]string{"/config/objects/x": "x"}})
+	assert.NoError(err)
+	w = serve(s.restoreUploadedSnapshot, http.MethodPost, SnapshotRestorePrefix, string(data))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("21", w.Header().Get(ConfigVersionKey))
+	assert.Equal([]string{"/config/objects/x", "/config/version"}, cls.keys("/config/"))
+	assert.Equal([]string{"/status/objects/a/member"}, cls.keys("/status/"))
+
+	// the snapshot with keys out of the snapshot prefixes is rejected.
+	data, err = encodeSnapshot(&Snapshot{KVs: map[string]string{"/status/objects/a/member": "x"}})
+	assert.NoError(err)
+	w = serve(s.restoreUploadedSnapshot, http.MethodPost, SnapshotRestorePrefix, string(data))
+	assert.Equal(http.StatusBadRequest, w.Code)
+	w = serve(s.restoreUploadedSnapshot, http.MethodPost, SnapshotRestorePrefix, "not gzipped")
+	assert.Equal(http.StatusBadRequest, w.Code)
+	assert.Equal("x", cls.snapshotKVs()["/config/objects/x"])
+
+	s.opt.Cluster.ReadOnly = true
+	w = serveSnapshot(s.restoreStoredSnapshot, info.Name)
+	assert.Equal(http.StatusForbidden, w.Code)
+}
+
+func TestRestoreSnapshotRollback(t *testing.T) {
+	assert := assert.New(t)
+	s, cls := newSnapshotTestServer(t)
+
+	// more changes than a batch.
+	snapshot := &Snapshot{Version: 3, KVs: map[string]string{}}
+	for i := 0; i < snapshotBatchSize*2+10; i++ {
+		snapshot.KVs[fmt.Sprintf("/config/objects/o%03d", i)] = "v"
+	}
+	original := cls.snapshotKVs()
+
+	putAndDelete := cls.MockedPutAndDelete
+	calls := 0
+	cls.MockedPutAndDelete = func(kvs map[string]*string) error {
+		calls++
+		if calls == 3 {
+			return fmt.Errorf("etcd unavailable")
+		}
+		return putAndDelete(kvs)
+	}
+
+	assert.Panics(func() { s._restoreSnapshot(snapshot) })
+	assert.Equal(original, cls.snapshotKVs())
+	// two batches written, the failed one, and two batches to roll back.
+	assert.Equal(5, calls)
+
+	// the restoring succeeds without errors.
+	resp := s._restoreSnapshot(snapshot)
+	assert.Equal(int64(6), resp.Version)
+	assert.Equal(len(snapshot.KVs), resp.Updated)
+	assert.Len(cls.keys("/config/objects/"), len(snapshot.KVs))
+}
+
+// testS3Server is an S3-compatible server keeping the objects in memory,
+// the requests must be signed.
+type testS3Server struct {
+	mutex    sync.Mutex
+	bucket   string
+	objects  map[string][]byte
+	signer   *signer.Signer
+	rejected int
+}
+
+func (s *testS3Server) object(key string) ([]byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	data, ok := s.objects[key]
+	return data, ok
+}
+
+func (s *testS3Server) rejectedRequests() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.rejected
+}
+
+func (s *testS3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.signer.NewVerificationContext().Verify(r, nil); err != nil {
+		s.rejected++
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/"+s.bucket+"/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/"+s.bucket+"/")
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		prefix := r.URL.Query().Get("prefix")
+		result := &s3ListResult{}
+		keys := []string{}
+		for k := range s.objects {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		// return one object per page to test the pagination.
+		if token := r.URL.Query().Get("continuation-token"); token != "" {
+			for len(keys) > 0 && keys[0] <= token {
+				keys = keys[1:]
+			}
+		}
+		if len(keys) > 1 {
+			result.IsTruncated = true
+			result.NextContinuationToken = keys[0]
+			keys = keys[:1]
+		}
+		for _, k := range keys {
+			result.Contents = append(result.Contents, struct {
+				Key  string `xml:"Key"`
+				Size int64  `xml:"Size"`
+			}{Key: k, Size: int64(len(s.objects[k]))})
+		}
+		xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodGet:
+		data, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		s.objects[key] = data
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestS3SnapshotStore(t *testing.T) {
+	assert := assert.New(t)
+
+	s3 := &testS3Server{
+		bucket:  "backup",
+		objects: map[string][]byte{"other/snapshot-20200101T000000Z.json.gz": []byte("other")},
+		signer: signer.CreateFromSpec(&signer.Spec{
+			Literal:         awsLiteral,
+			AccessKeyID:     "key-id",
+			AccessKeySecret: "secret",
+		}),
+	}
+	server := httptest.NewServer(s3)
+	defer server.Close()
+
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	assert.NoError(os.WriteFile(secretFile, []byte("secret\n"), 0o600))
+	opt := &option.Options{
+		SnapshotS3Endpoint:            server.URL + "/",
+		SnapshotS3Region:              "us-east-1",
+		SnapshotS3Bucket:              "backup",
+		SnapshotS3Prefix:              "/eg/",
+		SnapshotS3AccessKeyID:         "key-id",
+		SnapshotS3SecretAccessKeyFile: secretFile,
+	}
+	store, err := newSnapshotStore(opt)
+	assert.NoError(err)
+
+	names := []string{
+		"snapshot-20200102T000000Z.json.gz",
+		"snapshot-20200101T000000Z.json.gz",
+		"snapshot-20200103T000000Z.json.gz",
+	}
+	for _, name := range names {
+		assert.NoError(store.put(name, []byte(name)))
+	}
+	assert.NoError(store.put("not-a-snapshot", []byte("x")))
+	data, _ := s3.object("eg/" + names[0])
+	assert.Equal([]byte(names[0]), data)
+
+	data, err = store.get(names[0])
+	assert.NoError(err)
+	assert.Equal([]byte(names[0]), data)
+	_, err = store.get("snapshot-20000101T000000Z.json.gz")
+	assert.Equal(errSnapshotNotFound, err)
+
+	// the snapshots out of the prefix are not listed.
+	infos, err := store.list()
+	assert.NoError(err)
+	assert.Len(infos, 3)
+	sort.Strings(names)
+	for i, info := range infos {
+		assert.Equal(names[i], info.Name)
+		assert.Equal(int64(len(names[i])), info.Size)
+	}
+
+	assert.NoError(store.delete(names[0]))
+	infos, err = store.list()
+	assert.NoError(err)
+	assert.Len(infos, 2)
+	_, ok := s3.object("other/snapshot-20200101T000000Z.json.gz")
+	assert.True(ok)
+	assert.Equal(0, s3.rejectedRequests())
+
+	// a wrong secret is rejected.
+	opt.SnapshotS3SecretAccessKeyFile = ""
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "wrong")
+	store, err = newSnapshotStore(opt)
+	assert.NoError(err)
+	assert.Error(store.put(names[0], []byte("x")))
+	assert.Equal(1, s3.rejectedRequests())
+}
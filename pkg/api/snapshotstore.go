@@ -0,0 +1,298 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/util/signer"
+)
+
+const s3RequestTimeout = 60 * time.Second
+
+type (
+	// snapshotStore stores the snapshot files by their names.
+	snapshotStore interface {
+		put(name string, data []byte) error
+		// get returns errSnapshotNotFound if the snapshot doesn't exist.
+		get(name string) ([]byte, error)
+		// list returns the snapshots ordered by names, i.e. from the
+		// oldest to the newest.
+		list() ([]*SnapshotInfo, error)
+		delete(name string) error
+	}
+
+	diskSnapshotStore struct {
+		dir string
+	}
+
+	// s3SnapshotStore stores the snapshots in an S3-compatible bucket, the
+	// requests are path-style and signed with AWS signature version 4.
+	s3SnapshotStore struct {
+		endpoint string
+		region   string
+		bucket   string
+		prefix   string
+		signer   *signer.Signer
+		client   *http.Client
+	}
+
+	s3ListResult struct {
+		Contents []struct {
+			Key  string `xml:"Key"`
+			Size int64  `xml:"Size"`
+		} `xml:"Contents"`
+		IsTruncated           bool   `xml:"IsTruncated"`
+		NextContinuationToken string `xml:"NextContinuationToken"`
+	}
+)
+
+var errSnapshotNotFound = fmt.Errorf("snapshot not found")
+
+var awsLiteral = &signer.Literal{
+	ScopeSuffix:      "aws4_request",
+	AlgorithmName:    "X-Amz-Algorithm",
+	AlgorithmValue:   "AWS4-HMAC-SHA256",
+	SignedHeaders:    "X-Amz-SignedHeaders",
+	Signature:        "X-Amz-Signature",
+	Date:             "X-Amz-Date",
+	Expires:          "X-Amz-Expires",
+	Credential:       "X-Amz-Credential",
+	ContentSHA256:    "X-Amz-Content-Sha256",
+	SigningKeyPrefix: "AWS4",
+}
+
+func newSnapshotStore(opt *option.Options) (snapshotStore, error) {
+	if opt.SnapshotS3Bucket == "" {
+		return &diskSnapshotStore{dir: opt.AbsSnapshotDir}, nil
+	}
+
+	accessKeyID := opt.SnapshotS3AccessKeyID
+	if accessKeyID == "" {
+		accessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	secret := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if opt.SnapshotS3SecretAccessKeyFile != "" {
+		data, err := os.ReadFile(opt.SnapshotS3SecretAccessKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read S3 secret access key failed: %v", err)
+		}
+		secret = strings.TrimSpace(string(data))
+	}
+	if accessKeyID == "" || secret == "" {
+		return nil, fmt.Errorf("no S3 credential, please set snapshot-s3-access-key-id and snapshot-s3-secret-access-key-file, or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+
+	prefix := strings.Trim(opt.SnapshotS3Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return &s3SnapshotStore{
+		endpoint: strings.TrimSuffix(opt.SnapshotS3Endpoint, "/"),
+		region:   opt.SnapshotS3Region,
+		bucket:   opt.SnapshotS3Bucket,
+		prefix:   prefix,
+		signer: signer.CreateFromSpec(&signer.Spec{
+			Literal:         awsLiteral,
+			AccessKeyID:     accessKeyID,
+			AccessKeySecret: secret,
+		}),
+		client: &http.Client{Timeout: s3RequestTimeout},
+	}, nil
+}
+
+func (s *diskSnapshotStore) put(name string, data []byte) error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so a crash never leaves a
+	// partial snapshot.
+	tmp := filepath.Join(s.dir, "."+name+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, name))
+}
+
+func (s *diskSnapshotStore) get(name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return nil, errSnapshotNotFound
+	}
+	return data, err
+}
+
+func (s *diskSnapshotStore) list() ([]*SnapshotInfo, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []*SnapshotInfo
+	for _, e := range entries {
+		if e.IsDir() || !isSnapshotName(e.Name()) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		infos = append(infos, newSnapshotInfo(e.Name(), fi.Size()))
+	}
+
+	// ReadDir returns the entries ordered by names already.
+	return infos, nil
+}
+
+func (s *diskSnapshotStore) delete(name string) error {
+	err := os.Remove(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *s3SnapshotStore) do(method, key string, query url.Values, body []byte) (*http.Response, error) {
+	u := s.endpoint + "/" + s.bucket + "/"
+	if key != "" {
+		u += (&url.URL{Path: key}).EscapedPath()
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	// S3 requires the payload hash header, the signer uses it as is.
+	sum := sha256.Sum256(body)
+	req.Header.Set(awsLiteral.ContentSHA256, hex.EncodeToString(sum[:]))
+	ctx := s.signer.NewSigningContext(time.Now(), s.region, "s3")
+	if err := ctx.Sign(req, nil); err != nil {
+		return nil, err
+	}
+
+	return s.client.Do(req)
+}
+
+func s3Error(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("S3 responded %d: %s", resp.StatusCode, body)
+}
+
+func (s *s3SnapshotStore) put(name string, data []byte) error {
+	resp, err := s.do(http.MethodPut, s.prefix+name, nil, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func (s *s3SnapshotStore) get(name string) ([]byte, error) {
+	resp, err := s.do(http.MethodGet, s.prefix+name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusNotFound:
+		return nil, errSnapshotNotFound
+	default:
+		return nil, s3Error(resp)
+	}
+}
+
+func (s *s3SnapshotStore) list() ([]*SnapshotInfo, error) {
+	var infos []*SnapshotInfo
+
+	query := url.Values{"list-type": {"2"}, "prefix": {s.prefix}}
+	for {
+		result, err := func() (*s3ListResult, error) {
+			resp, err := s.do(http.MethodGet, "", query, nil)
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				return nil, s3Error(resp)
+			}
+			result := &s3ListResult{}
+			return result, xml.NewDecoder(resp.Body).Decode(result)
+		}()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range result.Contents {
+			name := strings.TrimPrefix(c.Key, s.prefix)
+			if isSnapshotName(name) {
+				infos = append(infos, newSnapshotInfo(name, c.Size))
+			}
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
+
+func (s *s3SnapshotStore) delete(name string) error {
+	resp, err := s.do(http.MethodDelete, s.prefix+name, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
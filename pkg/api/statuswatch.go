@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	statusEventPut    = "put"
+	statusEventDelete = "delete"
+)
+
+type statusEvent struct {
+	Key    string                 `json:"key"`
+	Type   string                 `json:"type"`
+	Status map[string]interface{} `json:"status,omitempty"`
+}
+
+// watchStatusObjects streams the changes of the statuses of the object, or
+// all objects if name is empty, see eventStream for the formats. Only the
+// changed statuses are pushed by members, so the events are status changes
+// rather than full dumps.
+func (s *Server) watchStatusObjects(w http.ResponseWriter, r *http.Request, name string) {
+	watcher, err := s.cluster.Watcher()
+	if err != nil {
+		ClusterPanic(err)
+	}
+	defer watcher.Close()
+
+	prefix := s.cluster.Layout().StatusObjectsPrefix()
+	ch, err := watcher.WatchPrefix(prefix)
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	stream, ok := newEventStream(w, r)
+	if !ok {
+		return
+	}
+	defer stream.close()
+
+	for {
+		select {
+		case <-stream.done():
+			return
+		case kvs, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			heartbeats := s._getStatusHeartbeats()
+			now := time.Now().Unix()
+
+			for k, v := range kvs {
+				k = strings.TrimPrefix(k, prefix)
+				if name != "" && statusKeyObjectName(k) != name {
+					continue
+				}
+
+				event := &statusEvent{Key: k, Type: statusEventDelete}
+				if v != nil {
+					event.Type = statusEventPut
+					event.Status = decorateStatus(k, *v, heartbeats, now)
+				}
+
+				if err := stream.send(event.Type, event); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/object/statussynccontroller"
+)
+
+func newStatusTestCluster() *testCluster {
+	cls := newTestCluster()
+	cls.MockedLayout = func() *cluster.Layout {
+		return &cluster.Layout{}
+	}
+	return cls
+}
+
+func putHeartbeat(cls *testCluster, member string, ts int64) {
+	cls.Put(cls.Layout().StatusHeartbeatPrefix()+member, `{"timestamp":`+strconv.FormatInt(ts, 10)+`}`)
+}
+
+func TestStatusKeyObjectName(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("object-a", statusKeyObjectName("default/object-a/member-a"))
+	assert.Equal("object-a", statusKeyObjectName("/status/objects/default/object-a/member-a"))
+	assert.Equal("", statusKeyObjectName("object-a/member-a"))
+}
+
+func TestDecorateStatus(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now().Unix()
+	heartbeats := map[string]int64{"member-a": now}
+	old := now - statussynccontroller.StaleAfterSeconds - 1
+	value := `{"timestamp":` + strconv.FormatInt(old, 10) + `,"health":"ok"}`
+
+	// the status is not changed for a while, but the member is alive.
+	m := decorateStatus("default/object-a/member-a", value, heartbeats, now)
+	assert.Equal("ok", m["health"])
+	assert.Equal(float64(old), m["lastUpdated"])
+	assert.Equal(now, m["heartbeat"])
+	assert.Equal(false, m["stale"])
+
+	// members of old versions don't send heartbeats.
+	m = decorateStatus("default/object-a/member-b", value, heartbeats, now)
+	assert.Equal(old, m["heartbeat"])
+	assert.Equal(true, m["stale"])
+
+	m = decorateStatus("default/object-a/member-b", "null", heartbeats, now)
+	assert.Equal(int64(0), m["heartbeat"])
+	assert.Equal(true, m["stale"])
+}
+
+func TestGetStatusObject(t *testing.T) {
+	assert := assert.New(t)
+
+	cls := newStatusTestCluster()
+	s := newTestServer(cls)
+	now := time.Now().Unix()
+	prefix := cls.Layout().StatusObjectsPrefix()
+	ts := strconv.FormatInt(now, 10)
+
+	putHeartbeat(cls, "member-a", now)
+	cls.Put(prefix+"default/object-a/member-a", `{"timestamp":`+ts+`}`)
+	cls.Put(prefix+"default/object-a/member-b", `{"timestamp":`+ts+`}`)
+	cls.Put(prefix+"default/object-ab/member-a", `{"timestamp":`+ts+`}`)
+
+	status := s._getStatusObject("object-a")
+	assert.Len(status, 2)
+	assert.Contains(status, "default/object-a/member-a")
+	assert.Contains(status, "default/object-a/member-b")
+
+	heartbeats := s._getStatusHeartbeats()
+	assert.Equal(map[string]int64{"member-a": now}, heartbeats)
+
+	assert.Len(s._listStatusObjects(), 3)
+}
+
+func TestWatchStatusObjects(t *testing.T) {
+	assert := assert.New(t)
+
+	cls := newStatusTestCluster()
+	s := newTestServer(cls)
+	prefix := cls.Layout().StatusObjectsPrefix()
+	now := time.Now().Unix()
+	putHeartbeat(cls, "member-a", now)
+
+	ch := make(chan map[string]*string, 2)
+	watcher := clustertest.NewMockedWatcher()
+	watcher.MockedWatchPrefix = func(p string) (<-chan map[string]*string, error) {
+		assert.Equal(prefix, p)
+		return ch, nil
+	}
+	cls.MockedWatcher = func() (cluster.Watcher, error) {
+		return watcher, nil
+	}
+
+	value := `{"timestamp":` + strconv.FormatInt(now, 10) + `}`
+	ch <- map[string]*string{
+		prefix + "default/object-a/member-a":  &value,
+		prefix + "default/object-ab/member-a": &value,
+	}
+	ch <- map[string]*string{prefix + "default/object-a/member-b": nil}
+	close(ch)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/status/objects/object-a?watch=true", nil)
+	s.watchStatusObjects(w, r, "object-a")
+
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("application/x-ndjson", w.Header().Get("Content-Type"))
+
+	events := []*statusEvent{}
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		event := &statusEvent{}
+		assert.NoError(json.Unmarshal(scanner.Bytes(), event))
+		events = append(events, event)
+	}
+
+	assert.Len(events, 2)
+	assert.Equal("default/object-a/member-a", events[0].Key)
+	assert.Equal(statusEventPut, events[0].Type)
+	assert.Equal(false, events[0].Status["stale"])
+	assert.Equal("default/object-a/member-b", events[1].Key)
+	assert.Equal(statusEventDelete, events[1].Type)
+	assert.Nil(events[1].Status)
+}
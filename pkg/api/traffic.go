@@ -0,0 +1,329 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/object/statussynccontroller"
+	"github.com/megaease/easegress/pkg/protocols/httpprot/httpstat"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// TrafficStatusPath is the path to stream the live traffic statistics.
+	TrafficStatusPath = "/status/traffic"
+
+	defaultTrafficTopN = 10
+)
+
+type (
+	// TrafficSnapshot is the traffic statistics of the whole cluster at a
+	// point of time, the statistics of all members are merged.
+	TrafficSnapshot struct {
+		Timestamp int64              `json:"timestamp"`
+		Servers   []*TrafficServer   `json:"servers"`
+		Pipelines []*TrafficPipeline `json:"pipelines"`
+	}
+
+	// TrafficStat is the statistics of a traffic object.
+	//
+	// NOTE: The latencies are the max ones among the members, as
+	// percentiles can't be merged.
+	TrafficStat struct {
+		RPS        float64        `json:"rps"`
+		Count      uint64         `json:"count"`
+		ErrCount   uint64         `json:"errCount"`
+		ErrPercent float64        `json:"errPercent"`
+		P50        float64        `json:"p50"`
+		P95        float64        `json:"p95"`
+		P99        float64        `json:"p99"`
+		Codes      map[int]uint64 `json:"codes,omitempty"`
+	}
+
+	// TrafficServer is the statistics of an HTTPServer.
+	TrafficServer struct {
+		Name string `json:"name"`
+		TrafficStat
+		TopN []*TrafficRoute `json:"topN,omitempty"`
+	}
+
+	// TrafficRoute is the statistics of a path of an HTTPServer.
+	TrafficRoute struct {
+		Path string `json:"path"`
+		TrafficStat
+	}
+
+	// TrafficPipeline is the statistics of a pipeline, it is the sum of
+	// the main pools of its proxies.
+	TrafficPipeline struct {
+		Name string `json:"name"`
+		TrafficStat
+	}
+
+	// trafficObjectStatus is the part of the statuses of HTTPServers and
+	// Pipelines used by the traffic statistics.
+	trafficObjectStatus struct {
+		Timestamp int64  `json:"timestamp"`
+		State     string `json:"state"`
+		*httpstat.Status
+		TopN    []*httpstat.Item           `json:"topN"`
+		Filters map[string]json.RawMessage `json:"filters"`
+	}
+
+	trafficProxyStatus struct {
+		MainPool *struct {
+			Stat *httpstat.Status `json:"stat"`
+		} `json:"mainPool"`
+	}
+
+	// trafficCounter calculates the RPS by the increments of the counts
+	// between two snapshots, which is much more real-time than the
+	// moving averages.
+	trafficCounter struct {
+		counts    map[string]uint64
+		timestamp time.Time
+	}
+)
+
+func (s *Server) trafficAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    TrafficStatusPath,
+			Method:  "GET",
+			Handler: s.streamTraffic,
+		},
+	}
+}
+
+// streamTraffic pushes a snapshot of the traffic statistics every interval,
+// one JSON snapshot per line.
+func (s *Server) streamTraffic(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	// NOTE: The statuses are synced every SyncStatusPaceInUnixSeconds,
+	// a shorter interval only pushes the same statistics again.
+	interval := statussynccontroller.SyncStatusPaceInUnixSeconds * time.Second
+	if v := r.URL.Query().Get("interval"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid interval %s: %v", v, err))
+			return
+		}
+		if d > interval {
+			interval = d
+		}
+	}
+
+	topN := defaultTrafficTopN
+	if v := r.URL.Query().Get("topN"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid topN %s", v))
+			return
+		}
+		topN = n
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	counter := &trafficCounter{}
+	for {
+		snapshot := s._getTrafficSnapshot(counter, topN)
+		buff := codectool.MustMarshalJSON(snapshot)
+		if _, err := w.Write(append(buff, '\n')); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) _getTrafficSnapshot(counter *trafficCounter, topN int) *TrafficSnapshot {
+	prefix := s.cluster.Layout().StatusObjectsPrefix()
+	kvs, err := s.cluster.GetPrefix(prefix)
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	heartbeats := s._getStatusHeartbeats()
+	now := time.Now()
+
+	servers := map[string]*TrafficServer{}
+	routes := map[string]map[string]*TrafficRoute{}
+	pipelines := map[string]*TrafficPipeline{}
+
+	for k, v := range kvs {
+		k = strings.TrimPrefix(k, prefix)
+		status := &trafficObjectStatus{}
+		if err := codectool.UnmarshalJSON([]byte(v), status); err != nil {
+			continue
+		}
+
+		// Members of old versions don't send heartbeats.
+		member := k[strings.LastIndex(k, "/")+1:]
+		heartbeat, ok := heartbeats[member]
+		if !ok {
+			heartbeat = status.Timestamp
+		}
+		if now.Unix()-heartbeat > statussynccontroller.StaleAfterSeconds {
+			continue
+		}
+
+		name := trafficObjectName(k)
+		switch {
+		case status.Filters != nil:
+			p := pipelines[name]
+			if p == nil {
+				p = &TrafficPipeline{Name: name}
+				pipelines[name] = p
+			}
+			for _, raw := range status.Filters {
+				ps := &trafficProxyStatus{}
+				if err := codectool.UnmarshalJSON(raw, ps); err != nil {
+					continue
+				}
+				if ps.MainPool != nil && ps.MainPool.Stat != nil {
+					p.merge(ps.MainPool.Stat)
+				}
+			}
+		case status.State != "" && status.Status != nil:
+			svr := servers[name]
+			if svr == nil {
+				svr = &TrafficServer{Name: name}
+				servers[name] = svr
+				routes[name] = map[string]*TrafficRoute{}
+			}
+			svr.merge(status.Status)
+			for _, item := range status.TopN {
+				if item.Status == nil {
+					continue
+				}
+				route := routes[name][item.Path]
+				if route == nil {
+					route = &TrafficRoute{Path: item.Path}
+					routes[name][item.Path] = route
+				}
+				route.merge(item.Status)
+			}
+		}
+	}
+
+	elapsed := now.Sub(counter.timestamp).Seconds()
+	counts := map[string]uint64{}
+	rps := func(key string, ts *TrafficStat) {
+		counts[key] = ts.Count
+		if last, ok := counter.counts[key]; ok && ts.Count >= last && elapsed > 0 {
+			ts.RPS = float64(ts.Count-last) / elapsed
+		}
+		if ts.Count > 0 {
+			ts.ErrPercent = float64(ts.ErrCount) / float64(ts.Count) * 100
+		}
+	}
+
+	snapshot := &TrafficSnapshot{
+		Timestamp: now.Unix(),
+		Servers:   []*TrafficServer{},
+		Pipelines: []*TrafficPipeline{},
+	}
+	for name, svr := range servers {
+		rps("server/"+name, &svr.TrafficStat)
+		for path, route := range routes[name] {
+			rps("route/"+name+"/"+path, &route.TrafficStat)
+			svr.TopN = append(svr.TopN, route)
+		}
+		sort.Slice(svr.TopN, func(i, j int) bool {
+			return svr.TopN[i].Count > svr.TopN[j].Count
+		})
+		if len(svr.TopN) > topN {
+			svr.TopN = svr.TopN[:topN]
+		}
+		snapshot.Servers = append(snapshot.Servers, svr)
+	}
+	for name, p := range pipelines {
+		rps("pipeline/"+name, &p.TrafficStat)
+		snapshot.Pipelines = append(snapshot.Pipelines, p)
+	}
+	sort.Slice(snapshot.Servers, func(i, j int) bool {
+		return snapshot.Servers[i].Name < snapshot.Servers[j].Name
+	})
+	sort.Slice(snapshot.Pipelines, func(i, j int) bool {
+		return snapshot.Pipelines[i].Name < snapshot.Pipelines[j].Name
+	})
+
+	counter.counts, counter.timestamp = counts, now
+
+	return snapshot
+}
+
+// merge merges the statistics of a member into ts, the RPS is the sum of
+// the 1-minute rates, it is replaced by the real-time one if possible.
+func (ts *TrafficStat) merge(status *httpstat.Status) {
+	ts.RPS += status.M1
+	ts.Count += status.Count
+	ts.ErrCount += status.ErrCount
+	if status.P50 > ts.P50 {
+		ts.P50 = status.P50
+	}
+	if status.P95 > ts.P95 {
+		ts.P95 = status.P95
+	}
+	if status.P99 > ts.P99 {
+		ts.P99 = status.P99
+	}
+	for code, count := range status.Codes {
+		if ts.Codes == nil {
+			ts.Codes = map[int]uint64{}
+		}
+		ts.Codes[code] += count
+	}
+}
+
+// trafficObjectName returns the object name of the status key, the
+// namespace is kept unless it is the default one.
+func trafficObjectName(key string) string {
+	parts := strings.Split(key, "/")
+	if len(parts) < 3 {
+		return key
+	}
+	namespace, name := parts[len(parts)-3], parts[len(parts)-2]
+	if namespace == cluster.NamespaceDefault {
+		return name
+	}
+	return namespace + "/" + name
+}
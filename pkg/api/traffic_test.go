@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func putTrafficStatus(cls *testCluster, key, value string) {
+	cls.Put(cls.Layout().StatusObjectsPrefix()+key, value)
+}
+
+func newTrafficTestCluster(now int64, count int) *testCluster {
+	cls := newStatusTestCluster()
+	ts := strconv.FormatInt(now, 10)
+	n := strconv.Itoa(count)
+
+	putHeartbeat(cls, "member-a", now)
+	putHeartbeat(cls, "member-b", now)
+	putHeartbeat(cls, "member-c", now-3600)
+
+	server := `{"timestamp":` + ts + `,"state":"running","count":` + n + `,"errCount":5,"m1":1,"p99":10,` +
+		`"codes":{"200":` + n + `},"topN":[{"path":"/a","count":` + n + `},{"path":"/b","count":1}]}`
+	putTrafficStatus(cls, "default/server-a/member-a", server)
+	putTrafficStatus(cls, "default/server-a/member-b", strings.Replace(server, `"p99":10`, `"p99":20`, 1))
+	putTrafficStatus(cls, "default/server-a/member-c", server)
+
+	pipeline := `{"timestamp":` + ts + `,"filters":{"proxy":{"mainPool":{"stat":{"count":` + n + `,"errCount":1}}},` +
+		`"mock":{"rules":[]}}}`
+	putTrafficStatus(cls, "default/pipeline-a/member-a", pipeline)
+	putTrafficStatus(cls, "mesh/pipeline-a/member-a", pipeline)
+
+	return cls
+}
+
+func TestTrafficObjectName(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("server-a", trafficObjectName("default/server-a/member-a"))
+	assert.Equal("mesh/server-a", trafficObjectName("mesh/server-a/member-a"))
+	assert.Equal("server-a", trafficObjectName("server-a"))
+}
+
+func TestTrafficSnapshot(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now().Unix()
+	cls := newTrafficTestCluster(now, 100)
+	s := newTestServer(cls)
+
+	counter := &trafficCounter{}
+	snapshot := s._getTrafficSnapshot(counter, 1)
+
+	// the stale member-c is ignored.
+	assert.Len(snapshot.Servers, 1)
+	svr := snapshot.Servers[0]
+	assert.Equal("server-a", svr.Name)
+	assert.Equal(uint64(200), svr.Count)
+	assert.Equal(uint64(10), svr.ErrCount)
+	assert.Equal(float64(5), svr.ErrPercent)
+	assert.Equal(float64(2), svr.RPS)
+	assert.Equal(float64(20), svr.P99)
+	assert.Equal(map[int]uint64{200: 200}, svr.Codes)
+	assert.Len(svr.TopN, 1)
+	assert.Equal("/a", svr.TopN[0].Path)
+	assert.Equal(uint64(200), svr.TopN[0].Count)
+
+	assert.Len(snapshot.Pipelines, 2)
+	assert.Equal("mesh/pipeline-a", snapshot.Pipelines[0].Name)
+	assert.Equal("pipeline-a", snapshot.Pipelines[1].Name)
+	assert.Equal(uint64(100), snapshot.Pipelines[1].Count)
+	assert.Equal(float64(1), snapshot.Pipelines[1].ErrPercent)
+
+	// the RPS is calculated by the increments of the counts.
+	counter.timestamp = counter.timestamp.Add(-10 * time.Second)
+	cls = newTrafficTestCluster(now, 150)
+	s = newTestServer(cls)
+	snapshot = s._getTrafficSnapshot(counter, 10)
+
+	svr = snapshot.Servers[0]
+	assert.InDelta(10, svr.RPS, 0.5)
+	assert.Len(svr.TopN, 2)
+	assert.InDelta(5, snapshot.Pipelines[1].RPS, 0.5)
+}
+
+func TestStreamTraffic(t *testing.T) {
+	assert := assert.New(t)
+
+	cls := newTrafficTestCluster(time.Now().Unix(), 100)
+	s := newTestServer(cls)
+
+	w := serve(s.streamTraffic, http.MethodGet, TrafficStatusPath+"?interval=invalid", "")
+	assert.Equal(http.StatusBadRequest, w.Code)
+
+	w = serve(s.streamTraffic, http.MethodGet, TrafficStatusPath+"?topN=0", "")
+	assert.Equal(http.StatusBadRequest, w.Code)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, TrafficStatusPath+"?topN=1", nil).WithContext(ctx)
+	s.streamTraffic(w, r)
+
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("application/x-ndjson", w.Header().Get("Content-Type"))
+
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Len(lines, 1)
+	snapshot := &TrafficSnapshot{}
+	assert.NoError(json.Unmarshal([]byte(lines[0]), snapshot))
+	assert.Len(snapshot.Servers, 1)
+	assert.Len(snapshot.Servers[0].TopN, 1)
+}
@@ -0,0 +1,253 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	objectEventCreate = "create"
+	objectEventUpdate = "update"
+	objectEventDelete = "delete"
+)
+
+type (
+	// eventStream sends the events of a watch to the client, in one of
+	// the formats below, chosen by the request:
+	//   - WebSocket, if the request is a WebSocket upgrade, one JSON
+	//     event per text message.
+	//   - Server-Sent Events, if the request accepts text/event-stream,
+	//     the event field is the type of the event.
+	//   - Newline delimited JSON otherwise.
+	eventStream interface {
+		// send sends an event of the type.
+		send(typ string, event interface{}) error
+		// done is closed when the client goes away.
+		done() <-chan struct{}
+		close()
+	}
+
+	ndjsonStream struct {
+		w       http.ResponseWriter
+		flusher http.Flusher
+		ctx     context.Context
+	}
+
+	sseStream struct {
+		ndjsonStream
+	}
+
+	websocketStream struct {
+		conn      *websocket.Conn
+		closed    chan struct{}
+		closeOnce sync.Once
+	}
+
+	objectEvent struct {
+		Name string                 `json:"name"`
+		Type string                 `json:"type"`
+		Spec map[string]interface{} `json:"spec,omitempty"`
+	}
+)
+
+var websocketUpgrader = websocket.Upgrader{}
+
+// newEventStream creates the event stream of the request, it writes the
+// error response if it fails.
+func newEventStream(w http.ResponseWriter, r *http.Request) (eventStream, bool) {
+	if websocket.IsWebSocketUpgrade(r) {
+		conn, err := websocketUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// NOTE: Upgrade has replied to the client with an HTTP error.
+			return nil, false
+		}
+
+		ws := &websocketStream{conn: conn, closed: make(chan struct{})}
+		// The messages from the client are discarded, reading them is
+		// required to process the control messages, e.g. close.
+		go func() {
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					ws.close()
+					return
+				}
+			}
+		}()
+		return ws, true
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return nil, false
+	}
+
+	ns := ndjsonStream{w: w, flusher: flusher, ctx: r.Context()}
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		return &sseStream{ns}, true
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &ns, true
+}
+
+func (s *ndjsonStream) send(typ string, event interface{}) error {
+	buff := codectool.MustMarshalJSON(event)
+	if _, err := s.w.Write(append(buff, '\n')); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+func (s *ndjsonStream) done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+func (s *ndjsonStream) close() {}
+
+func (s *sseStream) send(typ string, event interface{}) error {
+	buff := codectool.MustMarshalJSON(event)
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", typ, buff); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+func (s *websocketStream) send(typ string, event interface{}) error {
+	return s.conn.WriteMessage(websocket.TextMessage, codectool.MustMarshalJSON(event))
+}
+
+func (s *websocketStream) done() <-chan struct{} {
+	return s.closed
+}
+
+func (s *websocketStream) close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.conn.Close()
+	})
+}
+
+// watchObjects streams the changes of the objects, the current objects are
+// sent as create events first, so that clients don't need to list them
+// separately, which could miss the changes between the list and the watch.
+func (s *Server) watchObjects(w http.ResponseWriter, r *http.Request) {
+	watcher, err := s.cluster.Watcher()
+	if err != nil {
+		ClusterPanic(err)
+	}
+	defer watcher.Close()
+
+	// Watch before listing, so that no change is missed.
+	prefix := s.cluster.Layout().ConfigObjectPrefix()
+	ch, err := watcher.WatchPrefix(prefix)
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	kvs, err := s.cluster.GetPrefix(prefix)
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	stream, ok := newEventStream(w, r)
+	if !ok {
+		return
+	}
+	defer stream.close()
+
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	existing := make(map[string]bool, len(kvs))
+	for _, k := range keys {
+		name := strings.TrimPrefix(k, prefix)
+		existing[name] = true
+		if err := stream.send(objectEventCreate, newObjectEvent(name, objectEventCreate, kvs[k])); err != nil {
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-stream.done():
+			return
+		case changes, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			for k, v := range changes {
+				name := strings.TrimPrefix(k, prefix)
+				typ := objectEventCreate
+				switch {
+				case v == nil:
+					if !existing[name] {
+						continue
+					}
+					typ = objectEventDelete
+					delete(existing, name)
+				case existing[name]:
+					typ = objectEventUpdate
+				default:
+					existing[name] = true
+				}
+
+				value := ""
+				if v != nil {
+					value = *v
+				}
+				if err := stream.send(typ, newObjectEvent(name, typ, value)); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func newObjectEvent(name, typ, value string) *objectEvent {
+	event := &objectEvent{Name: name, Type: typ}
+	if value != "" {
+		spec := map[string]interface{}{}
+		if err := codectool.UnmarshalJSON([]byte(value), &spec); err == nil {
+			event.Spec = spec
+		}
+	}
+	return event
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+)
+
+// newWatchTestCluster returns a cluster with two objects, whose watcher
+// sends the changes from ch.
+func newWatchTestCluster(ch chan map[string]*string) *testCluster {
+	cls := newStatusTestCluster()
+	prefix := cls.Layout().ConfigObjectPrefix()
+	cls.Put(prefix+"object-b", `{"name":"object-b","kind":"Pipeline"}`)
+	cls.Put(prefix+"object-a", `{"name":"object-a","kind":"Pipeline"}`)
+
+	watcher := clustertest.NewMockedWatcher()
+	watcher.MockedWatchPrefix = func(p string) (<-chan map[string]*string, error) {
+		return ch, nil
+	}
+	cls.MockedWatcher = func() (cluster.Watcher, error) {
+		return watcher, nil
+	}
+	return cls
+}
+
+// sendWatchTestChanges sends the changes of the objects to ch.
+func sendWatchTestChanges(cls *testCluster, ch chan map[string]*string) {
+	prefix := cls.Layout().ConfigObjectPrefix()
+	updated := `{"name":"object-a","kind":"Pipeline","data":"updated"}`
+	created := `{"name":"object-c","kind":"Pipeline"}`
+	ch <- map[string]*string{prefix + "object-a": &updated}
+	ch <- map[string]*string{prefix + "object-c": &created}
+	ch <- map[string]*string{prefix + "object-b": nil}
+	// the deletion of an unknown object is ignored.
+	ch <- map[string]*string{prefix + "object-d": nil}
+}
+
+func assertWatchTestEvents(t *testing.T, events []*objectEvent) {
+	assert := assert.New(t)
+
+	assert.Len(events, 5)
+	expected := [][2]string{
+		{"object-a", objectEventCreate},
+		{"object-b", objectEventCreate},
+		{"object-a", objectEventUpdate},
+		{"object-c", objectEventCreate},
+		{"object-b", objectEventDelete},
+	}
+	for i, e := range events {
+		assert.Equal(expected[i][0], e.Name)
+		assert.Equal(expected[i][1], e.Type)
+	}
+	assert.Equal("updated", events[2].Spec["data"])
+	assert.Nil(events[4].Spec)
+}
+
+func TestWatchObjectsNDJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	ch := make(chan map[string]*string, 4)
+	cls := newWatchTestCluster(ch)
+	s := newTestServer(cls)
+	sendWatchTestChanges(cls, ch)
+	close(ch)
+
+	w := serve(s.watchObjects, http.MethodGet, "/objects?watch=true", "")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("application/x-ndjson", w.Header().Get("Content-Type"))
+
+	events := []*objectEvent{}
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		event := &objectEvent{}
+		assert.NoError(json.Unmarshal(scanner.Bytes(), event))
+		events = append(events, event)
+	}
+	assertWatchTestEvents(t, events)
+}
+
+func TestWatchObjectsSSE(t *testing.T) {
+	assert := assert.New(t)
+
+	ch := make(chan map[string]*string, 4)
+	cls := newWatchTestCluster(ch)
+	s := newTestServer(cls)
+	sendWatchTestChanges(cls, ch)
+	close(ch)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/objects?watch=true", nil)
+	r.Header.Set("Accept", "text/event-stream")
+	s.watchObjects(w, r)
+
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("text/event-stream", w.Header().Get("Content-Type"))
+
+	events := []*objectEvent{}
+	for _, msg := range strings.Split(strings.TrimSpace(w.Body.String()), "\n\n") {
+		lines := strings.Split(msg, "\n")
+		assert.Len(lines, 2)
+		event := &objectEvent{}
+		assert.NoError(json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), event))
+		assert.Equal("event: "+event.Type, lines[0])
+		events = append(events, event)
+	}
+	assertWatchTestEvents(t, events)
+}
+
+func TestWatchObjectsWebSocket(t *testing.T) {
+	assert := assert.New(t)
+
+	ch := make(chan map[string]*string, 4)
+	cls := newWatchTestCluster(ch)
+	s := newTestServer(cls)
+	sendWatchTestChanges(cls, ch)
+
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.watchObjects(w, r)
+		close(done)
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	assert.NoError(err)
+
+	events := []*objectEvent{}
+	for i := 0; i < 5; i++ {
+		typ, data, err := conn.ReadMessage()
+		assert.NoError(err)
+		assert.Equal(websocket.TextMessage, typ)
+		event := &objectEvent{}
+		assert.NoError(json.Unmarshal(data, event))
+		events = append(events, event)
+	}
+	assertWatchTestEvents(t, events)
+
+	// the watch stops when the client goes away, even if the channel of
+	// the changes is still open.
+	conn.Close()
+	<-done
+}
@@ -0,0 +1,252 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package client is the typed client of the Easegress admin API, the full
+// API is described by the OpenAPI document served at /apis/v2/openapi.
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	apiPrefix = "/apis/v2"
+
+	objectKindsPath    = "/object-kinds"
+	objectsPath        = "/objects"
+	objectPath         = "/objects/%s"
+	objectHistoryPath  = "/objects/%s/history"
+	objectApplyPath    = "/objects/apply"
+	objectRollbackPath = "/objects/rollback"
+	statusObjectsPath  = "/status/objects"
+	statusObjectPath   = "/status/objects/%s"
+	auditPath          = "/audit"
+	pipelineDryRunPath = "/pipelines/%s/dryrun"
+	healthzPath        = "/healthz"
+	openAPIPath        = "/openapi"
+)
+
+// Client is the client of the admin API of an Easegress member.
+type Client struct {
+	// Server is the address of the admin API, e.g. http://127.0.0.1:2381.
+	Server string
+	// Header is added to every request, e.g. Authorization.
+	Header     http.Header
+	HTTPClient *http.Client
+}
+
+// New creates a client of the admin API served at server.
+func New(server string) *Client {
+	if !strings.HasPrefix(server, "http://") && !strings.HasPrefix(server, "https://") {
+		server = "http://" + server
+	}
+	return &Client{
+		Server:     strings.TrimSuffix(server, "/"),
+		Header:     http.Header{},
+		HTTPClient: &http.Client{},
+	}
+}
+
+// Health checks the liveness of the member.
+func (c *Client) Health(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, healthzPath, nil, nil)
+}
+
+// ObjectKinds returns the kinds of objects supported by the member.
+func (c *Client) ObjectKinds(ctx context.Context) ([]string, error) {
+	kinds := []string{}
+	err := c.do(ctx, http.MethodGet, objectKindsPath, nil, &kinds)
+	return kinds, err
+}
+
+// ListObjects returns all objects sorted by name.
+func (c *Client) ListObjects(ctx context.Context) ([]Object, error) {
+	objects := []Object{}
+	err := c.do(ctx, http.MethodGet, objectsPath, nil, &objects)
+	return objects, err
+}
+
+// GetObject returns the object, use IsNotFound to check the absence.
+func (c *Client) GetObject(ctx context.Context, name string) (Object, error) {
+	object := Object{}
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf(objectPath, url.PathEscape(name)), nil, &object)
+	if err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// CreateObject creates the object, use IsConflict to check the existence.
+func (c *Client) CreateObject(ctx context.Context, object Object) error {
+	return c.do(ctx, http.MethodPost, objectsPath, object, nil)
+}
+
+// UpdateObject updates the object, whose kind can't be changed.
+func (c *Client) UpdateObject(ctx context.Context, object Object) error {
+	path := fmt.Sprintf(objectPath, url.PathEscape(object.Name()))
+	return c.do(ctx, http.MethodPut, path, object, nil)
+}
+
+// DeleteObject deletes the object.
+func (c *Client) DeleteObject(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf(objectPath, url.PathEscape(name)), nil, nil)
+}
+
+// ListObjectStatuses returns the statuses of all objects, by object name
+// and then by member name.
+func (c *Client) ListObjectStatuses(ctx context.Context) (map[string]interface{}, error) {
+	statuses := map[string]interface{}{}
+	err := c.do(ctx, http.MethodGet, statusObjectsPath, nil, &statuses)
+	return statuses, err
+}
+
+// GetObjectStatus returns the statuses of the object by member name.
+func (c *Client) GetObjectStatus(ctx context.Context, name string) (map[string]interface{}, error) {
+	status := map[string]interface{}{}
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf(statusObjectPath, url.PathEscape(name)), nil, &status)
+	return status, err
+}
+
+// ObjectHistory returns the revisions of the object.
+func (c *Client) ObjectHistory(ctx context.Context, name string) ([]*ObjectRevision, error) {
+	revs := []*ObjectRevision{}
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf(objectHistoryPath, url.PathEscape(name)), nil, &revs)
+	return revs, err
+}
+
+// Apply applies a bundle of objects in one transaction.
+func (c *Client) Apply(ctx context.Context, req *ApplyRequest) (*ApplyResponse, error) {
+	resp := &ApplyResponse{}
+	if err := c.do(ctx, http.MethodPost, objectApplyPath, req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Rollback rolls back the objects to a revision.
+func (c *Client) Rollback(ctx context.Context, req *RollbackRequest) (*RollbackResponse, error) {
+	resp := &RollbackResponse{}
+	if err := c.do(ctx, http.MethodPost, objectRollbackPath, req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ListAudit returns the audit entries, the newest first.
+func (c *Client) ListAudit(ctx context.Context, query *AuditQuery) ([]*AuditEntry, error) {
+	path := auditPath
+	if query != nil {
+		values := url.Values{}
+		if query.Object != "" {
+			values.Set("object", query.Object)
+		}
+		if query.Actor != "" {
+			values.Set("actor", query.Actor)
+		}
+		if query.Since != "" {
+			values.Set("since", query.Since)
+		}
+		if query.Limit > 0 {
+			values.Set("limit", strconv.Itoa(query.Limit))
+		}
+		if len(values) > 0 {
+			path += "?" + values.Encode()
+		}
+	}
+
+	entries := []*AuditEntry{}
+	err := c.do(ctx, http.MethodGet, path, nil, &entries)
+	return entries, err
+}
+
+// DryRun runs a request through the pipeline.
+func (c *Client) DryRun(ctx context.Context, pipeline string, req *DryRunRequest) (*DryRunResponse, error) {
+	resp := &DryRunResponse{}
+	path := fmt.Sprintf(pipelineDryRunPath, url.PathEscape(pipeline))
+	if err := c.do(ctx, http.MethodPost, path, req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// OpenAPI returns the OpenAPI document of the admin API.
+func (c *Client) OpenAPI(ctx context.Context) (map[string]interface{}, error) {
+	doc := map[string]interface{}{}
+	err := c.do(ctx, http.MethodGet, openAPIPath, nil, &doc)
+	return doc, err
+}
+
+// do sends the request with the JSON body of in if it's not nil, and
+// decodes the JSON response body to out if it's not nil.
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		buff, err := codectool.MarshalJSON(in)
+		if err != nil {
+			return fmt.Errorf("marshal %#v to json failed: %v", in, err)
+		}
+		body = bytes.NewReader(buff)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.Server+apiPrefix+path, body)
+	if err != nil {
+		return err
+	}
+	for k, v := range c.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	buff, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response body failed: %v", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		if err := codectool.UnmarshalJSON(buff, apiErr); err != nil || apiErr.Message == "" {
+			apiErr.Message = string(buff)
+		}
+		return apiErr
+	}
+
+	if out == nil || len(buff) == 0 {
+		return nil
+	}
+	if err := codectool.UnmarshalJSON(buff, out); err != nil {
+		return fmt.Errorf("unmarshal %s to json failed: %v", buff, err)
+	}
+	return nil
+}
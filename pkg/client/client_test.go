@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("Bearer token", r.Header.Get("Authorization"))
+
+		switch r.Method + " " + r.URL.Path {
+		case "GET /apis/v2/objects/pipeline-demo":
+			w.Write([]byte(`{"name":"pipeline-demo","kind":"Pipeline"}`))
+		case "GET /apis/v2/objects/missing":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":404,"message":"not found"}`))
+		case "POST /apis/v2/objects":
+			body, _ := io.ReadAll(r.Body)
+			assert.JSONEq(`{"name":"pipeline-demo","kind":"Pipeline"}`, string(body))
+			w.WriteHeader(http.StatusCreated)
+		case "GET /apis/v2/audit":
+			assert.Equal("limit=2&object=pipeline-demo", r.URL.RawQuery)
+			w.Write([]byte(`[{"method":"POST","statusCode":201}]`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("unexpected"))
+		}
+	}))
+	defer server.Close()
+
+	c := New(server.URL)
+	c.Header.Set("Authorization", "Bearer token")
+	ctx := context.Background()
+
+	obj, err := c.GetObject(ctx, "pipeline-demo")
+	assert.NoError(err)
+	assert.Equal("pipeline-demo", obj.Name())
+	assert.Equal("Pipeline", obj.Kind())
+
+	_, err = c.GetObject(ctx, "missing")
+	assert.True(IsNotFound(err))
+	assert.Equal("not found", err.(*APIError).Message)
+
+	assert.NoError(c.CreateObject(ctx, obj))
+
+	entries, err := c.ListAudit(ctx, &AuditQuery{Object: "pipeline-demo", Limit: 2})
+	assert.NoError(err)
+	assert.Len(entries, 1)
+	assert.Equal(201, entries[0].StatusCode)
+
+	err = c.Health(ctx)
+	assert.Error(err)
+	assert.Equal("500: unexpected", err.Error())
+}
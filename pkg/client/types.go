@@ -0,0 +1,175 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// NOTE: The types mirror the ones of package api, they are defined here so
+// that the client doesn't depend on the server side packages.
+
+type (
+	// Object is the spec of an object, the fields other than name and kind
+	// depend on the kind, whose schema is in the OpenAPI document.
+	Object map[string]interface{}
+
+	// APIError is the error returned by the admin API.
+	APIError struct {
+		StatusCode int    `json:"-"`
+		Code       int    `json:"code"`
+		Message    string `json:"message"`
+	}
+
+	// ApplyRequest is the request to apply a bundle of objects.
+	ApplyRequest struct {
+		Objects []Object `json:"objects"`
+		Prune   bool     `json:"prune"`
+		DryRun  bool     `json:"dryRun"`
+	}
+
+	// ApplyResponse is the response of applying a bundle of objects.
+	ApplyResponse struct {
+		Revision int64          `json:"revision"`
+		DryRun   bool           `json:"dryRun"`
+		Changes  []*ApplyChange `json:"changes"`
+	}
+
+	// ApplyChange is the change of an object in a bundle.
+	ApplyChange struct {
+		Name   string `json:"name"`
+		Kind   string `json:"kind"`
+		Action string `json:"action"`
+		Diff   string `json:"diff"`
+	}
+
+	// ObjectRevision is a revision in the history of an object.
+	ObjectRevision struct {
+		Revision int64  `json:"revision"`
+		Action   string `json:"action"`
+		Time     string `json:"time"`
+		Rollback int64  `json:"rollback,omitempty"`
+		Spec     string `json:"spec,omitempty"`
+	}
+
+	// RollbackRequest is the request to roll back objects to a revision.
+	RollbackRequest struct {
+		Revision int64    `json:"revision"`
+		Objects  []string `json:"objects,omitempty"`
+	}
+
+	// RollbackResponse is the response of rolling back objects.
+	RollbackResponse struct {
+		Revision int64             `json:"revision"`
+		Changes  map[string]string `json:"changes"`
+	}
+
+	// AuditQuery is the filter of the audit entries, zero values are ignored.
+	AuditQuery struct {
+		Object string
+		Actor  string
+		// Since is a RFC3339 time or a duration before now, e.g. 1h.
+		Since string
+		Limit int
+	}
+
+	// AuditEntry is an entry of the audit log.
+	AuditEntry struct {
+		Time       string         `json:"time"`
+		Member     string         `json:"member"`
+		Actor      *AuditActor    `json:"actor"`
+		Method     string         `json:"method"`
+		Path       string         `json:"path"`
+		StatusCode int            `json:"statusCode"`
+		Revision   int64          `json:"revision,omitempty"`
+		Objects    []*AuditObject `json:"objects,omitempty"`
+	}
+
+	// AuditActor is the actor of an audit entry.
+	AuditActor struct {
+		Name       string `json:"name,omitempty"`
+		Source     string `json:"source"`
+		RemoteAddr string `json:"remoteAddr"`
+	}
+
+	// AuditObject is an object changed by an audited request.
+	AuditObject struct {
+		Name    string `json:"name"`
+		Action  string `json:"action"`
+		Summary string `json:"summary"`
+	}
+
+	// DryRunRequest is the request to run through a pipeline.
+	DryRunRequest struct {
+		Namespace string      `json:"namespace,omitempty"`
+		Method    string      `json:"method,omitempty"`
+		Path      string      `json:"path,omitempty"`
+		Host      string      `json:"host,omitempty"`
+		Header    http.Header `json:"header,omitempty"`
+		Body      string      `json:"body,omitempty"`
+	}
+
+	// DryRunResponse is the response and the execution report of the
+	// filters of a request run through a pipeline.
+	DryRunResponse struct {
+		Result     string          `json:"result"`
+		StatusCode int             `json:"statusCode"`
+		Header     http.Header     `json:"header,omitempty"`
+		Body       string          `json:"body,omitempty"`
+		Truncated  bool            `json:"truncated,omitempty"`
+		Duration   string          `json:"duration"`
+		Filters    []*DryRunFilter `json:"filters"`
+	}
+
+	// DryRunFilter is the execution report of a filter.
+	DryRunFilter struct {
+		Name     string `json:"name"`
+		Kind     string `json:"kind"`
+		Result   string `json:"result,omitempty"`
+		Duration string `json:"duration"`
+	}
+)
+
+// Name returns the name of the object.
+func (o Object) Name() string {
+	name, _ := o["name"].(string)
+	return name
+}
+
+// Kind returns the kind of the object.
+func (o Object) Kind() string {
+	kind, _ := o["kind"].(string)
+	return kind
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%d: %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound returns true if err is an APIError of status 404.
+func IsNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+// IsConflict returns true if err is an APIError of status 409.
+func IsConflict(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == http.StatusConflict
+}
@@ -23,6 +23,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	clientv3 "go.etcd.io/etcd/client/v3"
@@ -68,6 +69,10 @@ type (
 
 		// Etcd is non-nil only if it's cluster status is primary.
 		Etcd *EtcdStatus `json:"etcd,omitempty"`
+
+		// Upstream is non-nil only if the configuration is mirrored from
+		// an upstream cluster.
+		Upstream *UpstreamStatus `json:"upstream,omitempty"`
 	}
 
 	// EtcdStatus is the etcd status,
@@ -120,8 +125,10 @@ type cluster struct {
 	layout *Layout
 
 	members *members
+	metrics *metrics
 
 	server       *embed.Etcd
+	mirror       *mirror
 	client       *clientv3.Client
 	lease        *clientv3.LeaseID
 	session      *concurrency.Session
@@ -130,12 +137,24 @@ type cluster struct {
 	leaseMutex   sync.RWMutex
 	sessionMutex sync.RWMutex
 
+	// leader is 1 if the member is elected as the leader, it is only used
+	// with external etcd.
+	leader int32
+
 	done chan struct{}
 }
 
 // New creates a cluster asynchronously,
 // return non-nil err only if reaching hard limit.
 func New(opt *option.Options) (Cluster, error) {
+	if opt.Standalone {
+		c, err := newStandaloneCluster(opt)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+
 	// defensive programming
 	requestTimeout, err := time.ParseDuration(opt.ClusterRequestTimeout)
 	if err != nil {
@@ -146,7 +165,7 @@ func New(opt *option.Options) (Cluster, error) {
 	// When the new configuration way (cluster.initial-cluster or cluster.primary-listen-peer-urls) is used, let's not create member
 	// instance but let's read member information from pkg/option/options.go's Options.ClusterOptions directly.
 	var membersFile *members
-	if len(opt.GetPeerURLs()) == 0 {
+	if !opt.UseExternalEtcd() && len(opt.GetPeerURLs()) == 0 {
 		membersFile, err = newMembers(opt)
 		if err != nil {
 			return nil, fmt.Errorf("new members failed: %v", err)
@@ -157,6 +176,7 @@ func New(opt *option.Options) (Cluster, error) {
 		opt:            opt,
 		requestTimeout: requestTimeout,
 		members:        membersFile,
+		metrics:        newMetrics(),
 		done:           make(chan struct{}),
 	}
 
@@ -168,6 +188,10 @@ func New(opt *option.Options) (Cluster, error) {
 }
 
 func (c *cluster) IsLeader() bool {
+	if c.opt.UseExternalEtcd() {
+		return atomic.LoadInt32(&c.leader) == 1
+	}
+
 	server, err := c.getServer()
 	if err != nil {
 		return false
@@ -216,15 +240,25 @@ func (c *cluster) run() {
 
 	logger.Infof("cluster is ready")
 
-	if c.opt.ClusterRole == "primary" {
+	// NOTE: The external etcd is maintained by its operators.
+	if c.opt.UseExternalEtcd() {
+		if c.opt.ClusterRole == "primary" {
+			go c.campaign()
+		}
+	} else if c.opt.ClusterRole == "primary" {
 		go c.defrag()
 	}
 
+	if len(c.opt.Cluster.UpstreamClientURLs) > 0 {
+		c.mirror = newMirror(c)
+		go c.mirror.run()
+	}
+
 	go c.heartbeat()
 }
 
 func (c *cluster) getReady() error {
-	if c.opt.ClusterRole == "secondary" {
+	if c.opt.ClusterRole == "secondary" || c.opt.UseExternalEtcd() {
 		_, err := c.getClient()
 		if err != nil {
 			return err
@@ -289,7 +323,7 @@ func (c *cluster) checkClusterName() error {
 			logger.Errorf("%v", err)
 			panic(err)
 		}
-	} else if c.opt.UseStandaloneEtcd {
+	} else if c.opt.UseExternalEtcd() {
 		err := c.Put(c.Layout().ClusterNameKey(), c.opt.ClusterName)
 		if err != nil {
 			return fmt.Errorf("register cluster name %s failed: %v",
@@ -319,6 +353,16 @@ func (c *cluster) getClient() (*clientv3.Client, error) {
 		return c.client, nil
 	}
 
+	if c.opt.UseExternalEtcd() {
+		client, err := c.newExternalClient()
+		if err != nil {
+			return nil, fmt.Errorf("create client failed: %v", err)
+		}
+		logger.Infof("client is ready")
+		c.client = client
+		return client, nil
+	}
+
 	var endpoints []string
 	if c.members == nil {
 		endpoints = c.opt.GetPeerURLs()
@@ -674,6 +718,11 @@ func (c *cluster) heartbeat() {
 			if err != nil {
 				logger.Errorf("sync status failed: %v", err)
 			}
+			c.metrics.updateHeartbeat(err == nil, c.IsLeader())
+
+			if c.opt.UseExternalEtcd() {
+				continue
+			}
 			err = c.updateMembers()
 			if err != nil {
 				logger.Errorf("update members failed: %v", err)
@@ -727,7 +776,7 @@ func (c *cluster) syncStatus() error {
 		Options: *c.opt,
 	}
 
-	if c.opt.ClusterRole == "primary" {
+	if c.opt.ClusterRole == "primary" && !c.opt.UseExternalEtcd() {
 		server, err := c.getServer()
 		if err != nil {
 			return err
@@ -741,6 +790,10 @@ func (c *cluster) syncStatus() error {
 		status.Etcd = stats.toEtcdStatus()
 	}
 
+	if c.mirror != nil {
+		status.Upstream = c.mirror.getStatus()
+	}
+
 	status.LastHeartbeatTime = time.Now().Format(time.RFC3339)
 
 	buff, err := codectool.MarshalJSON(status)
@@ -773,6 +826,7 @@ func (c *cluster) updateMembers() error {
 	if c.members != nil {
 		c.members.updateClusterMembers(resp.Members)
 	}
+	c.metrics.updateMembers(len(resp.Members))
 	return nil
 }
 
@@ -782,28 +836,10 @@ func (c *cluster) PurgeMember(memberName string) error {
 		return err
 	}
 
-	// remove etcd member if there is it.
-	respList, err := func() (*clientv3.MemberListResponse, error) {
-		ctx, cancel := c.requestContext()
-		defer cancel()
-		return client.MemberList(ctx)
-	}()
-	if err != nil {
-		return err
-	}
-	var id *uint64
-	for _, member := range respList.Members {
-		if member.Name == memberName {
-			id = &member.ID
-		}
-	}
-	if id != nil {
-		_, err = func() (*clientv3.MemberRemoveResponse, error) {
-			ctx, cancel := c.requestContext()
-			defer cancel()
-			return client.MemberRemove(ctx, *id)
-		}()
-		if err != nil {
+	// remove etcd member if there is it, the members of external etcd
+	// are never touched.
+	if !c.opt.UseExternalEtcd() {
+		if err := c.removeEtcdMemberByName(client, memberName); err != nil {
 			return err
 		}
 	}
@@ -834,6 +870,33 @@ func (c *cluster) PurgeMember(memberName string) error {
 	return nil
 }
 
+func (c *cluster) removeEtcdMemberByName(client *clientv3.Client, memberName string) error {
+	respList, err := func() (*clientv3.MemberListResponse, error) {
+		ctx, cancel := c.requestContext()
+		defer cancel()
+		return client.MemberList(ctx)
+	}()
+	if err != nil {
+		return err
+	}
+	var id *uint64
+	for _, member := range respList.Members {
+		if member.Name == memberName {
+			id = &member.ID
+		}
+	}
+	if id == nil {
+		return nil
+	}
+
+	_, err = func() (*clientv3.MemberRemoveResponse, error) {
+		ctx, cancel := c.requestContext()
+		defer cancel()
+		return client.MemberRemove(ctx, *id)
+	}()
+	return err
+}
+
 func (c *cluster) Close(wg *sync.WaitGroup) {
 	defer wg.Done()
 
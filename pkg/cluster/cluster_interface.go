@@ -40,6 +40,11 @@ type (
 		GetRaw(key string) (*mvccpb.KeyValue, error)
 		GetRawPrefix(prefix string) (map[string]*mvccpb.KeyValue, error)
 		GetWithOp(key string, ops ...ClientOp) (map[string]string, error)
+		// GetPrefixBefore returns at most limit key-values with the prefix
+		// from the greatest key to the least, only keys less than before
+		// are returned if before is not empty, so the last key of a page
+		// is the before of the next page.
+		GetPrefixBefore(prefix, before string, limit int) ([]*mvccpb.KeyValue, error)
 
 		Put(key, value string) error
 		PutUnderLease(key, value string) error
@@ -65,6 +70,13 @@ type (
 		Close(wg *sync.WaitGroup)
 
 		PurgeMember(member string) error
+
+		// EtcdMembers, AddLearner, PromoteMember and RemoveMember manage
+		// the membership of the etcd cluster formed by primary members.
+		EtcdMembers() ([]*EtcdMember, error)
+		AddLearner(name string, peerURLs []string) ([]*EtcdMember, error)
+		PromoteMember(member string) error
+		RemoveMember(member string) error
 	}
 
 	// ClientOp is client operation option type for etcd client used in cluster and watcher
@@ -36,6 +36,7 @@ type MockedCluster struct {
 	MockedGetRaw                 func(key string) (*mvccpb.KeyValue, error)
 	MockedGetRawPrefix           func(prefix string) (map[string]*mvccpb.KeyValue, error)
 	MockedGetWithOp              func(key string, ops ...cluster.ClientOp) (map[string]string, error)
+	MockedGetPrefixBefore        func(prefix, before string, limit int) ([]*mvccpb.KeyValue, error)
 	MockedPut                    func(key, value string) error
 	MockedPutUnderLease          func(key, value string) error
 	MockedPutAndDelete           func(map[string]*string) error
@@ -50,6 +51,10 @@ type MockedCluster struct {
 	MockedStartServer            func() (chan struct{}, chan struct{}, error)
 	MockedClose                  func(wg *sync.WaitGroup)
 	MockedPurgeMember            func(member string) error
+	MockedEtcdMembers            func() ([]*cluster.EtcdMember, error)
+	MockedAddLearner             func(name string, peerURLs []string) ([]*cluster.EtcdMember, error)
+	MockedPromoteMember          func(member string) error
+	MockedRemoveMember           func(member string) error
 }
 
 var _ cluster.Cluster = (*MockedCluster)(nil)
@@ -115,6 +120,14 @@ func (mc *MockedCluster) GetWithOp(key string, ops ...cluster.ClientOp) (map[str
 	return nil, nil
 }
 
+// GetPrefixBefore implements interface function GetPrefixBefore
+func (mc *MockedCluster) GetPrefixBefore(prefix, before string, limit int) ([]*mvccpb.KeyValue, error) {
+	if mc.MockedGetPrefixBefore != nil {
+		return mc.MockedGetPrefixBefore(prefix, before, limit)
+	}
+	return nil, nil
+}
+
 // Put implements interface function Put
 func (mc *MockedCluster) Put(key, value string) error {
 	if mc.MockedPut != nil {
@@ -225,6 +238,38 @@ func (mc *MockedCluster) PurgeMember(member string) error {
 	return nil
 }
 
+// EtcdMembers implements interface function EtcdMembers
+func (mc *MockedCluster) EtcdMembers() ([]*cluster.EtcdMember, error) {
+	if mc.MockedEtcdMembers != nil {
+		return mc.MockedEtcdMembers()
+	}
+	return nil, nil
+}
+
+// AddLearner implements interface function AddLearner
+func (mc *MockedCluster) AddLearner(name string, peerURLs []string) ([]*cluster.EtcdMember, error) {
+	if mc.MockedAddLearner != nil {
+		return mc.MockedAddLearner(name, peerURLs)
+	}
+	return nil, nil
+}
+
+// PromoteMember implements interface function PromoteMember
+func (mc *MockedCluster) PromoteMember(member string) error {
+	if mc.MockedPromoteMember != nil {
+		return mc.MockedPromoteMember(member)
+	}
+	return nil
+}
+
+// RemoveMember implements interface function RemoveMember
+func (mc *MockedCluster) RemoveMember(member string) error {
+	if mc.MockedRemoveMember != nil {
+		return mc.MockedRemoveMember(member)
+	}
+	return nil
+}
+
 // MockedSTM is a mocked cocurrency.STM
 type MockedSTM struct {
 	// embed concurrency.STM for commit & reset
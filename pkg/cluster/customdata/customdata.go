@@ -20,6 +20,7 @@ package customdata
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/megaease/easegress/pkg/cluster"
@@ -53,6 +54,24 @@ func (k *Kind) dataID(data Data) string {
 	return id
 }
 
+// validate validates the data against the JSON schema of the kind.
+func (k *Kind) validate(data Data) error {
+	if len(k.JSONSchema) == 0 {
+		return nil
+	}
+
+	schema := gojsonschema.NewGoLoader(k.JSONSchema)
+	doc := gojsonschema.NewGoLoader(data)
+	res, err := gojsonschema.Validate(schema, doc)
+	if err != nil {
+		return fmt.Errorf("error occurs during validation: %v", err)
+	}
+	if !res.Valid() {
+		return fmt.Errorf("validation failed: %v", res.Errors())
+	}
+	return nil
+}
+
 // Store defines the storage for custom data
 type Store struct {
 	cluster    cluster.Cluster
@@ -136,6 +155,24 @@ func (s *Store) PutKind(kind *Kind, update bool) error {
 		return fmt.Errorf("%s existed", kind.Name)
 	}
 
+	// the schema applies to the existing data too, so it can't be changed
+	// to reject them.
+	if update && len(kind.JSONSchema) > 0 {
+		kvs, err := s.cluster.GetRawPrefix(s.dataPrefix(kind.Name))
+		if err != nil {
+			return err
+		}
+		for key, kv := range kvs {
+			data, err := unmarshalData(kv.Value)
+			if err != nil {
+				return err
+			}
+			if err = kind.validate(data); err != nil {
+				return fmt.Errorf("existing data %s: %v", strings.TrimPrefix(key, s.dataPrefix(kind.Name)), err)
+			}
+		}
+	}
+
 	buf, err := codectool.MarshalJSON(kind)
 	if err != nil {
 		return fmt.Errorf("BUG: marshal %#v to json failed: %v", kind, err)
@@ -230,16 +267,8 @@ func (s *Store) PutData(kind string, data Data, update bool) (string, error) {
 		return "", fmt.Errorf("data id is empty")
 	}
 
-	if len(k.JSONSchema) > 0 {
-		schema := gojsonschema.NewGoLoader(k.JSONSchema)
-		doc := gojsonschema.NewGoLoader(data)
-		res, err := gojsonschema.Validate(schema, doc)
-		if err != nil {
-			return "", fmt.Errorf("error occurs during validation: %v", err)
-		}
-		if !res.Valid() {
-			return "", fmt.Errorf("validation failed: %v", res.Errors())
-		}
+	if err = k.validate(data); err != nil {
+		return "", err
 	}
 
 	oldData, err := s.GetData(kind, id)
@@ -277,17 +306,9 @@ func (s *Store) BatchUpdateData(kind string, del []string, update []Data) error
 		return fmt.Errorf("kind %s not found", kind)
 	}
 
-	if len(update) > 0 && len(k.JSONSchema) > 0 {
-		schema := gojsonschema.NewGoLoader(k.JSONSchema)
-		for _, data := range update {
-			doc := gojsonschema.NewGoLoader(data)
-			res, err := gojsonschema.Validate(schema, doc)
-			if err != nil {
-				return fmt.Errorf("error occurs during validation: %v", err)
-			}
-			if !res.Valid() {
-				return fmt.Errorf("validation failed: %v", res.Errors())
-			}
+	for _, data := range update {
+		if err = k.validate(data); err != nil {
+			return err
 		}
 	}
 
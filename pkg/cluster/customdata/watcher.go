@@ -0,0 +1,211 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package customdata
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+type (
+	// DecodeFunc decodes the value of a custom data item to the type used
+	// by the consumer, an error marks the item invalid.
+	DecodeFunc func(key string, value []byte) (interface{}, error)
+
+	// InvalidData is a custom data item rejected by a watcher.
+	InvalidData struct {
+		Key   string `json:"key"`
+		Error string `json:"error"`
+	}
+
+	// WatcherStatus is the status of a watcher, the invalid items are
+	// reported here instead of being ignored silently.
+	WatcherStatus struct {
+		Prefix       string         `json:"prefix"`
+		Valid        int            `json:"valid"`
+		Invalid      []*InvalidData `json:"invalid,omitempty"`
+		LastSyncTime string         `json:"lastSyncTime,omitempty"`
+	}
+
+	// Watcher watches the custom data items with a key prefix, validates
+	// them against the JSON schema of their kind, and decodes them for
+	// the consumer, e.g. filters reading credentials from custom data.
+	Watcher struct {
+		store    *Store
+		prefix   string
+		kind     string
+		decode   DecodeFunc
+		onChange func(map[string]interface{})
+
+		mutex  sync.RWMutex
+		status *WatcherStatus
+
+		stopCtx context.Context
+		cancel  context.CancelFunc
+	}
+)
+
+// NewWatcher creates a watcher of the items whose keys start with prefix,
+// which is relative to the data prefix of the store, e.g. "credentials/",
+// and its first segment is the kind. The items are loaded before it
+// returns, then onChange is called with the valid items, keyed by their
+// full keys, after every change until the watcher is closed. The items are
+// passed as Data if decode is nil.
+func (s *Store) NewWatcher(prefix string, decode DecodeFunc, onChange func(map[string]interface{})) *Watcher {
+	prefix = strings.TrimPrefix(prefix, "/")
+	w := &Watcher{
+		store:    s,
+		prefix:   s.DataPrefix + prefix,
+		kind:     strings.SplitN(prefix, "/", 2)[0],
+		decode:   decode,
+		onChange: onChange,
+	}
+	w.status = &WatcherStatus{Prefix: w.prefix}
+	w.stopCtx, w.cancel = context.WithCancel(context.Background())
+
+	kvs, err := s.cluster.GetPrefix(w.prefix)
+	if err != nil {
+		logger.Errorf("get custom data %s failed: %v", w.prefix, err)
+	} else {
+		w.update(kvs)
+	}
+
+	go w.run()
+	return w
+}
+
+func (w *Watcher) run() {
+	var (
+		syncer cluster.Syncer
+		err    error
+		ch     <-chan map[string]string
+	)
+
+	for {
+		syncer, err = w.store.cluster.Syncer(30 * time.Minute)
+		if err != nil {
+			logger.Errorf("failed to create syncer: %v", err)
+		} else if ch, err = syncer.SyncPrefix(w.prefix); err != nil {
+			logger.Errorf("failed to sync prefix: %v", err)
+			syncer.Close()
+		} else {
+			break
+		}
+
+		select {
+		case <-time.After(10 * time.Second):
+		case <-w.stopCtx.Done():
+			return
+		}
+	}
+
+	defer syncer.Close()
+	for {
+		select {
+		case <-w.stopCtx.Done():
+			return
+		case kvs, ok := <-ch:
+			if !ok {
+				return
+			}
+			w.update(kvs)
+		}
+	}
+}
+
+// update validates and decodes the items, records the invalid ones in
+// the status, and passes the valid ones to the consumer.
+func (w *Watcher) update(kvs map[string]string) {
+	var kind *Kind
+	if w.kind != "" {
+		k, err := w.store.GetKind(w.kind)
+		if err != nil {
+			logger.Errorf("get custom data kind %s failed: %v", w.kind, err)
+		}
+		kind = k
+	}
+
+	items := make(map[string]interface{}, len(kvs))
+	invalid := []*InvalidData{}
+	for key, value := range kvs {
+		item, err := w.parse(kind, key, []byte(value))
+		if err != nil {
+			invalid = append(invalid, &InvalidData{Key: key, Error: err.Error()})
+			continue
+		}
+		items[key] = item
+	}
+
+	sort.Slice(invalid, func(i, j int) bool {
+		return invalid[i].Key < invalid[j].Key
+	})
+	if len(invalid) > 0 {
+		logger.Warnf("%d invalid custom data of %s are ignored, the first one is %s: %s",
+			len(invalid), w.prefix, invalid[0].Key, invalid[0].Error)
+	}
+
+	w.mutex.Lock()
+	w.status = &WatcherStatus{
+		Prefix:       w.prefix,
+		Valid:        len(items),
+		Invalid:      invalid,
+		LastSyncTime: time.Now().Format(time.RFC3339),
+	}
+	w.mutex.Unlock()
+
+	w.onChange(items)
+}
+
+func (w *Watcher) parse(kind *Kind, key string, value []byte) (interface{}, error) {
+	data := Data{}
+	if err := codectool.Unmarshal(value, &data); err != nil {
+		return nil, fmt.Errorf("unmarshal failed: %v", err)
+	}
+
+	if kind != nil {
+		if err := kind.validate(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if w.decode == nil {
+		return data, nil
+	}
+	return w.decode(key, value)
+}
+
+// Status returns the status of the watcher.
+func (w *Watcher) Status() *WatcherStatus {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	return w.status
+}
+
+// Close closes the watcher.
+func (w *Watcher) Close() {
+	w.cancel()
+}
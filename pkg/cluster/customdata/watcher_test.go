@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package customdata
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+func TestWatcher(t *testing.T) {
+	cls := clustertest.NewMockedCluster()
+	s := NewStore(cls, "/kind/", "/data/")
+
+	cls.MockedGetRaw = func(key string) (*mvccpb.KeyValue, error) {
+		if key != "/kind/users" {
+			return nil, nil
+		}
+		return &mvccpb.KeyValue{Value: []byte(`name: users
+jsonSchema:
+  type: object
+  properties:
+    password:
+      type: string
+  required: [password]`)}, nil
+	}
+
+	prefix := ""
+	cls.MockedGetPrefix = func(key string) (map[string]string, error) {
+		prefix = key
+		return map[string]string{
+			"/data/users/alice": "name: alice\npassword: a",
+			"/data/users/bob":   "name: bob",
+			"/data/users/carol": "name: carol\npassword: c",
+		}, nil
+	}
+
+	syncer := clustertest.NewMockedSyncer()
+	ch := make(chan map[string]string)
+	syncer.MockedSyncPrefix = func(prefix string) (<-chan map[string]string, error) {
+		return ch, nil
+	}
+	cls.MockedSyncer = func(pullInterval time.Duration) (cluster.Syncer, error) {
+		return syncer, nil
+	}
+
+	changes := make(chan map[string]interface{}, 1)
+	decode := func(key string, value []byte) (interface{}, error) {
+		if strings.HasSuffix(key, "carol") {
+			return nil, fmt.Errorf("carol is banned")
+		}
+		return string(value), nil
+	}
+	w := s.NewWatcher("/users/", decode, func(items map[string]interface{}) {
+		changes <- items
+	})
+	defer w.Close()
+
+	if prefix != "/data/users/" {
+		t.Errorf("prefix should be /data/users/ instead of %q", prefix)
+	}
+
+	items := <-changes
+	if len(items) != 1 || items["/data/users/alice"] != "name: alice\npassword: a" {
+		t.Errorf("only alice should be valid, got %v", items)
+	}
+	status := w.Status()
+	if status.Valid != 1 || len(status.Invalid) != 2 {
+		t.Fatalf("status should have 1 valid and 2 invalid items, got %+v", status)
+	}
+	if status.Invalid[0].Key != "/data/users/bob" || status.Invalid[1].Key != "/data/users/carol" {
+		t.Errorf("bob and carol should be invalid, got %+v", status.Invalid)
+	}
+	if !strings.Contains(status.Invalid[1].Error, "banned") {
+		t.Errorf("error of carol should come from decode, got %q", status.Invalid[1].Error)
+	}
+
+	ch <- map[string]string{"/data/users/bob": "name: bob\npassword: b"}
+	items = <-changes
+	if len(items) != 1 || items["/data/users/bob"] == nil {
+		t.Errorf("bob should be valid now, got %v", items)
+	}
+	if status = w.Status(); status.Valid != 1 || len(status.Invalid) != 0 {
+		t.Errorf("status should have no invalid items, got %+v", status)
+	}
+
+	// items are passed as Data without decode.
+	w2 := s.NewWatcher("users/", nil, func(items map[string]interface{}) {
+		changes <- items
+	})
+	defer w2.Close()
+	items = <-changes
+	if data, ok := items["/data/users/alice"].(Data); !ok || data["password"] != "a" {
+		t.Errorf("alice should be passed as Data, got %v", items)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+// electionTTL is the TTL in seconds of the election session, the leader
+// is replaced in about this long after it is gone.
+const electionTTL = 15
+
+// campaign elects the leader among primary members with external etcd, in
+// which case there is no embedded etcd server to tell the leader.
+//
+// NOTE: The election has its own session rather than the member lease,
+// whose TTL is so long that a crashed leader would never be replaced.
+func (c *cluster) campaign() {
+	for {
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+
+		err := c.runElection()
+		if err == nil {
+			continue
+		}
+
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+		logger.Errorf("leader election failed: %v", err)
+		select {
+		case <-c.done:
+			return
+		case <-time.After(HeartbeatInterval):
+		}
+	}
+}
+
+func (c *cluster) runElection() error {
+	client, err := c.getClient()
+	if err != nil {
+		return err
+	}
+
+	session, err := concurrency.NewSession(client, concurrency.WithTTL(electionTTL))
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.done:
+		case <-session.Done():
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+
+	election := concurrency.NewElection(session, c.Layout().LeaderElectionPrefix())
+	if err := election.Campaign(ctx, c.opt.Name); err != nil {
+		return err
+	}
+
+	atomic.StoreInt32(&c.leader, 1)
+	logger.Infof("became the leader")
+	<-ctx.Done()
+	atomic.StoreInt32(&c.leader, 0)
+	logger.Infof("not the leader anymore")
+
+	// resign explicitly, so others don't wait for the session to expire.
+	resignCtx, resignCancel := c.requestContext()
+	defer resignCancel()
+	election.Resign(resignCtx)
+	return nil
+}
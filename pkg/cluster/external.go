@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/namespace"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+// newClientTLSConfig returns the TLS config to connect to an etcd cluster
+// which is not embedded, it returns nil if none of the files is specified.
+func newClientTLSConfig(certFile, keyFile, trustedCAFile string) (*tls.Config, error) {
+	if certFile == "" && trustedCAFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate failed: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if trustedCAFile != "" {
+		pem, err := os.ReadFile(trustedCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read trusted CA file failed: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in trusted CA file")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// newExternalClient creates the client of the external etcd cluster, the
+// keys are under the namespace transparently if it is specified.
+func (c *cluster) newExternalClient() (*clientv3.Client, error) {
+	opt := c.opt.Cluster
+
+	tlsConfig, err := newClientTLSConfig(opt.ExternalEtcdCertFile,
+		opt.ExternalEtcdKeyFile, opt.ExternalEtcdTrustedCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE: The password is never put in the options, which are visible
+	// in the member status.
+	password := os.Getenv("EG_ETCD_PASSWORD")
+	if opt.ExternalEtcdPasswordFile != "" {
+		data, err := os.ReadFile(opt.ExternalEtcdPasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("read external etcd password failed: %v", err)
+		}
+		password = strings.TrimSpace(string(data))
+	}
+
+	logger.Infof("client connect with external etcd endpoints: %v", opt.ExternalEtcdEndpoints)
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:            opt.ExternalEtcdEndpoints,
+		AutoSyncInterval:     autoSyncInterval,
+		DialTimeout:          dialTimeout,
+		DialKeepAliveTime:    dialKeepAliveTime,
+		DialKeepAliveTimeout: dialKeepAliveTimeout,
+		TLS:                  tlsConfig,
+		Username:             opt.ExternalEtcdUsername,
+		Password:             password,
+		LogConfig:            logger.EtcdClientLoggerConfig(c.opt, logger.EtcdClientFilename),
+		MaxCallSendMsgSize:   opt.MaxCallSendMsgSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if ns := opt.ExternalEtcdNamespace; ns != "" {
+		client.KV = namespace.NewKV(client.KV, ns)
+		client.Watcher = namespace.NewWatcher(client.Watcher, ns)
+		client.Lease = namespace.NewLease(client.Lease, ns)
+	}
+
+	return client, nil
+}
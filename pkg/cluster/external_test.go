@@ -0,0 +1,45 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewClientTLSConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	tlsConfig, err := newClientTLSConfig("", "", "")
+	assert.NoError(err)
+	assert.Nil(tlsConfig)
+
+	_, err = newClientTLSConfig("", "", filepath.Join(t.TempDir(), "missing.pem"))
+	assert.Error(err)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	assert.NoError(os.WriteFile(caFile, []byte("not a certificate"), 0o600))
+	_, err = newClientTLSConfig("", "", caFile)
+	assert.Error(err)
+
+	_, err = newClientTLSConfig(caFile, caFile, "")
+	assert.Error(err)
+}
@@ -17,7 +17,10 @@
 
 package cluster
 
-import "fmt"
+import (
+	"fmt"
+	"net/url"
+)
 
 // Cluster store tree layout.
 // Status means dynamic, different in every member.
@@ -31,18 +34,36 @@ const (
 	NamespaceSystemPrefix  = "eg-"
 	NamespacetrafficPrefix = "eg-traffic-"
 
-	leaseFormat          = "/leases/%s" //+memberName
-	statusMemberPrefix   = "/status/members/"
-	statusMemberFormat   = "/status/members/%s" // +memberName
-	statusObjectPrefix   = "/status/objects/"
-	statusObjectFormat   = "/status/objects/%s/%s/%s" // +namespace +objectName +memberName
-	configObjectPrefix   = "/config/objects/"
-	configObjectFormat   = "/config/objects/%s" // +objectName
-	configVersion        = "/config/version"
-	wasmCodeEvent        = "/wasm/code"
-	wasmDataPrefixFormat = "/wasm/data/%s/%s/" // + pipelineName + filterName
-	customDataKindPrefix = "/custom-data-kinds/"
-	customDataPrefix     = "/custom-data/"
+	leaseFormat                   = "/leases/%s" //+memberName
+	leaderElectionPrefix          = "/leader-election/"
+	statusMemberPrefix            = "/status/members/"
+	statusMemberFormat            = "/status/members/%s" // +memberName
+	statusObjectPrefix            = "/status/objects/"
+	statusHeartbeatPrefix         = "/status/heartbeats/"
+	statusHeartbeatFormat         = "/status/heartbeats/%s"    // +memberName
+	statusObjectFormat            = "/status/objects/%s/%s/%s" // +namespace +objectName +memberName
+	configObjectPrefix            = "/config/objects/"
+	configObjectFormat            = "/config/objects/%s" // +objectName
+	configPrefix                  = "/config/"
+	configVersion                 = "/config/version"
+	configHistoryPrefix           = "/config/history/"
+	configHistoryFormat           = "/config/history/%s/%020d" // +objectName +revision
+	auditPrefix                   = "/audit/"
+	auditFormat                   = "/audit/%020d-%s" // +unixNano +memberName
+	wasmCodeEvent                 = "/wasm/code"
+	wasmDataPrefixFormat          = "/wasm/data/%s/%s/"           // + pipelineName + filterName
+	responseCachePurgeEventFormat = "/response-cache/purge/%s/%s" // + pipelineName + filterName
+	rateLimiterPrefixFormat       = "/rate-limiter/%s/%s/"        // + pipelineName + filterName
+	quotaPrefixFormat             = "/quota/%s/%s/"               // + pipelineName + filterName
+	mockRecordingPrefixFormat     = "/mock/recordings/%s/%s/"     // + pipelineName + filterName
+	idempotencyPrefixFormat       = "/idempotency/%s/%s/"         // + pipelineName + filterName
+	outboxPrefixFormat            = "/outbox/%s/%s/"              // + pipelineName + filterName
+	blueGreenPrefixFormat         = "/blue-green/%s/"             // + routeName
+	webhookSubscriberPrefixFormat = "/webhook-subscribers/%s/"    // + dispatcherName
+	webhookSubscriberPrefix       = "/webhook-subscribers/"
+	customDataKindPrefix          = "/custom-data-kinds/"
+	secretPrefix                  = "/secrets/"
+	customDataPrefix              = "/custom-data/"
 
 	// the cluster name of this eg group will be registered under this path in etcd
 	// any new member(primary or secondary ) will be rejected if it is configured a different cluster name
@@ -92,6 +113,12 @@ func (l *Layout) OtherLease(memberName string) string {
 	return fmt.Sprintf(leaseFormat, memberName)
 }
 
+// LeaderElectionPrefix returns the prefix of the leader election, which is
+// only used with external etcd.
+func (l *Layout) LeaderElectionPrefix() string {
+	return leaderElectionPrefix
+}
+
 // StatusMemberPrefix returns the prefix of member status.
 func (l *Layout) StatusMemberPrefix() string {
 	return statusMemberPrefix
@@ -122,6 +149,18 @@ func (l *Layout) StatusObjectKey(namespace, name string) string {
 	return fmt.Sprintf(statusObjectFormat, namespace, name, l.memberName)
 }
 
+// StatusHeartbeatPrefix returns the prefix of the status heartbeats.
+func (l *Layout) StatusHeartbeatPrefix() string {
+	return statusHeartbeatPrefix
+}
+
+// StatusHeartbeatKey returns the key of own status heartbeat, it is
+// updated every time the statuses are synchronized, even if no status
+// changed.
+func (l *Layout) StatusHeartbeatKey() string {
+	return fmt.Sprintf(statusHeartbeatFormat, l.memberName)
+}
+
 // ConfigObjectPrefix returns the prefix of object config.
 func (l *Layout) ConfigObjectPrefix() string {
 	return configObjectPrefix
@@ -132,6 +171,32 @@ func (l *Layout) ConfigObjectKey(name string) string {
 	return fmt.Sprintf(configObjectFormat, name)
 }
 
+// ConfigHistoryPrefix returns the prefix of the history of an object.
+func (l *Layout) ConfigHistoryPrefix(name string) string {
+	return configHistoryPrefix + name + "/"
+}
+
+// ConfigHistoryKey returns the key of a revision of an object, revisions
+// are padded with zeros to keep them in order.
+func (l *Layout) ConfigHistoryKey(name string, revision int64) string {
+	return fmt.Sprintf(configHistoryFormat, name, revision)
+}
+
+// ConfigHistoriesPrefix returns the prefix of the history of all objects.
+func (l *Layout) ConfigHistoriesPrefix() string {
+	return configHistoryPrefix
+}
+
+// AuditPrefix returns the prefix of audit entries.
+func (l *Layout) AuditPrefix() string {
+	return auditPrefix
+}
+
+// AuditKey returns the key of an audit entry, entries are ordered by time.
+func (l *Layout) AuditKey(unixNano int64) string {
+	return fmt.Sprintf(auditFormat, unixNano, l.memberName)
+}
+
 // ConfigVersion returns the key of config version.
 func (l *Layout) ConfigVersion() string {
 	return configVersion
@@ -147,6 +212,101 @@ func (l *Layout) WasmDataPrefix(pipeline string, name string) string {
 	return fmt.Sprintf(wasmDataPrefixFormat, pipeline, name)
 }
 
+// RateLimiterPrefix returns the prefix of rate limiter counters
+func (l *Layout) RateLimiterPrefix(pipeline string, name string) string {
+	return fmt.Sprintf(rateLimiterPrefixFormat, pipeline, name)
+}
+
+// RateLimiterKey returns the key of rate limiter counters of own member
+func (l *Layout) RateLimiterKey(pipeline string, name string) string {
+	return l.RateLimiterPrefix(pipeline, name) + l.memberName
+}
+
+// QuotaPrefix returns the prefix of quota usages
+func (l *Layout) QuotaPrefix(pipeline string, name string) string {
+	return fmt.Sprintf(quotaPrefixFormat, pipeline, name)
+}
+
+// QuotaUsageKey returns the key of quota usage of a consumer
+func (l *Layout) QuotaUsageKey(pipeline string, name string, consumer string) string {
+	return l.QuotaPrefix(pipeline, name) + url.PathEscape(consumer)
+}
+
+// MockRecordingPrefix returns the prefix of mock recordings
+func (l *Layout) MockRecordingPrefix(pipeline string, name string) string {
+	return fmt.Sprintf(mockRecordingPrefixFormat, pipeline, name)
+}
+
+// MockRecordingKey returns the key of a mock recording
+func (l *Layout) MockRecordingKey(pipeline string, name string, key string) string {
+	return l.MockRecordingPrefix(pipeline, name) + url.PathEscape(key)
+}
+
+// IdempotencyPrefix returns the prefix of idempotency records
+func (l *Layout) IdempotencyPrefix(pipeline string, name string) string {
+	return fmt.Sprintf(idempotencyPrefixFormat, pipeline, name)
+}
+
+// IdempotencyKey returns the key of an idempotency record
+func (l *Layout) IdempotencyKey(pipeline string, name string, key string) string {
+	return l.IdempotencyPrefix(pipeline, name) + url.PathEscape(key)
+}
+
+// OutboxPrefix returns the prefix of outbox messages
+func (l *Layout) OutboxPrefix(pipeline string, name string) string {
+	return fmt.Sprintf(outboxPrefixFormat, pipeline, name)
+}
+
+// OutboxKey returns the key of an outbox message
+func (l *Layout) OutboxKey(pipeline string, name string, id string) string {
+	return l.OutboxPrefix(pipeline, name) + url.PathEscape(id)
+}
+
+// BlueGreenPrefix returns the prefix of a blue/green route
+func (l *Layout) BlueGreenPrefix(route string) string {
+	return fmt.Sprintf(blueGreenPrefixFormat, url.PathEscape(route))
+}
+
+// BlueGreenActiveKey returns the key of the committed color of a blue/green route
+func (l *Layout) BlueGreenActiveKey(route string) string {
+	return l.BlueGreenPrefix(route) + "active"
+}
+
+// BlueGreenPrepareKey returns the key of the pending switch of a blue/green route
+func (l *Layout) BlueGreenPrepareKey(route string) string {
+	return l.BlueGreenPrefix(route) + "prepare"
+}
+
+// BlueGreenParticipantPrefix returns the prefix of the participants of a blue/green route
+func (l *Layout) BlueGreenParticipantPrefix(route string) string {
+	return l.BlueGreenPrefix(route) + "participants/"
+}
+
+// BlueGreenParticipantID returns the ID of a filter instance of own member
+func (l *Layout) BlueGreenParticipantID(pipeline string, name string, instance string) string {
+	return url.PathEscape(l.memberName + "/" + pipeline + "/" + name + "/" + instance)
+}
+
+// BlueGreenAckPrefix returns the prefix of the acknowledgements of a blue/green route
+func (l *Layout) BlueGreenAckPrefix(route string) string {
+	return l.BlueGreenPrefix(route) + "acks/"
+}
+
+// WebhookSubscriberPrefix returns the prefix of the subscribers of a webhook dispatcher
+func (l *Layout) WebhookSubscriberPrefix(dispatcher string) string {
+	return fmt.Sprintf(webhookSubscriberPrefixFormat, url.PathEscape(dispatcher))
+}
+
+// WebhookSubscriberKey returns the key of a subscriber of a webhook dispatcher
+func (l *Layout) WebhookSubscriberKey(dispatcher string, subscriber string) string {
+	return l.WebhookSubscriberPrefix(dispatcher) + url.PathEscape(subscriber)
+}
+
+// ResponseCachePurgeEvent returns the key of response cache purge event
+func (l *Layout) ResponseCachePurgeEvent(pipeline string, name string) string {
+	return fmt.Sprintf(responseCachePurgeEventFormat, pipeline, name)
+}
+
 // CustomDataPrefix returns the prefix of all custom data
 func (l *Layout) CustomDataPrefix() string {
 	return customDataPrefix
@@ -156,3 +316,20 @@ func (l *Layout) CustomDataPrefix() string {
 func (l *Layout) CustomDataKindPrefix() string {
 	return customDataKindPrefix
 }
+
+// SecretPrefix returns the prefix of all secrets
+func (l *Layout) SecretPrefix() string {
+	return secretPrefix
+}
+
+// MirroredPrefixes returns the prefixes of the configuration which are
+// mirrored from the upstream cluster in multi-region deployments.
+func (l *Layout) MirroredPrefixes() []string {
+	return []string{configPrefix, secretPrefix, customDataKindPrefix, customDataPrefix}
+}
+
+// SnapshotPrefixes returns the prefixes of the data saved in snapshots,
+// which are the configuration and the subscribers of webhook dispatchers.
+func (l *Layout) SnapshotPrefixes() []string {
+	return append(l.MirroredPrefixes(), webhookSubscriberPrefix)
+}
@@ -18,6 +18,7 @@
 package cluster
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -69,4 +70,12 @@ func TestLayout(t *testing.T) {
 
 	assert.Equal(customDataPrefix, l.CustomDataPrefix())
 	assert.Equal(customDataKindPrefix, l.CustomDataKindPrefix())
+	assert.Equal(secretPrefix, l.SecretPrefix())
+
+	assert.Equal("/config/history/demo/00000000000000000012", l.ConfigHistoryKey("demo", 12))
+	assert.True(strings.HasPrefix(l.ConfigHistoryKey("demo", 12), l.ConfigHistoryPrefix("demo")))
+	assert.False(strings.HasPrefix(l.ConfigHistoryKey("demo-2", 12), l.ConfigHistoryPrefix("demo")))
+
+	assert.True(strings.HasPrefix(l.AuditKey(12), l.AuditPrefix()))
+	assert.Less(l.AuditKey(9), l.AuditKey(12))
 }
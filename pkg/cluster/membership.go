@@ -0,0 +1,245 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// EtcdMember is a member of the etcd cluster formed by primary members.
+type EtcdMember struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	PeerURLs   []string `json:"peerURLs"`
+	ClientURLs []string `json:"clientURLs"`
+	IsLearner  bool     `json:"isLearner"`
+	// Healthy is true if the member responds to the status request, a
+	// member added but not started yet is never healthy.
+	Healthy bool `json:"healthy"`
+
+	id uint64
+}
+
+func newEtcdMember(m *pb.Member) *EtcdMember {
+	return &EtcdMember{
+		ID:         strconv.FormatUint(m.ID, 16),
+		Name:       m.Name,
+		PeerURLs:   m.PeerURLs,
+		ClientURLs: m.ClientURLs,
+		IsLearner:  m.IsLearner,
+		id:         m.ID,
+	}
+}
+
+// FindEtcdMember returns the member with the name or the ID, or nil if not
+// found. The ID is required to find members added but not started yet,
+// whose names are empty.
+func FindEtcdMember(members []*EtcdMember, name string) *EtcdMember {
+	for _, m := range members {
+		if m.Name == name || m.ID == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// CheckRemoval checks whether the cluster keeps its quorum after removing
+// the member. Learners don't vote, so they can always be removed.
+func CheckRemoval(members []*EtcdMember, name string) error {
+	target := FindEtcdMember(members, name)
+	if target == nil {
+		return fmt.Errorf("member %s not found", name)
+	}
+	if target.IsLearner {
+		return nil
+	}
+
+	voters, healthy := 0, 0
+	for _, m := range members {
+		if m.IsLearner || m == target {
+			continue
+		}
+		voters++
+		if m.Healthy {
+			healthy++
+		}
+	}
+
+	if voters == 0 {
+		return fmt.Errorf("member %s is the last voting member", name)
+	}
+	if quorum := voters/2 + 1; healthy < quorum {
+		return fmt.Errorf("removing member %s loses the quorum: %d of the %d remaining voting members are healthy, %d required",
+			name, healthy, voters, quorum)
+	}
+	return nil
+}
+
+// InitialClusterOf returns the initial-cluster option of a new member to
+// join the cluster, members without names are skipped.
+func InitialClusterOf(members []*EtcdMember) map[string]string {
+	result := map[string]string{}
+	for _, m := range members {
+		if m.Name != "" && len(m.PeerURLs) > 0 {
+			result[m.Name] = m.PeerURLs[0]
+		}
+	}
+	return result
+}
+
+func (c *cluster) EtcdMembers() ([]*EtcdMember, error) {
+	client, err := c.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := func() (*clientv3.MemberListResponse, error) {
+		ctx, cancel := c.requestContext()
+		defer cancel()
+		return client.MemberList(ctx)
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]*EtcdMember, 0, len(resp.Members))
+	wg := &sync.WaitGroup{}
+	for _, pbMember := range resp.Members {
+		m := newEtcdMember(pbMember)
+		members = append(members, m)
+		if len(m.ClientURLs) == 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := c.requestContext()
+			defer cancel()
+			_, err := client.Status(ctx, m.ClientURLs[0])
+			m.Healthy = err == nil
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+	return members, nil
+}
+
+// checkMembershipManaged returns an error if the etcd membership is not
+// managed by Easegress.
+func (c *cluster) checkMembershipManaged() error {
+	if c.opt.UseExternalEtcd() {
+		return fmt.Errorf("the membership of external etcd is managed by its operators")
+	}
+	return nil
+}
+
+func (c *cluster) findEtcdMember(name string) (*EtcdMember, error) {
+	members, err := c.EtcdMembers()
+	if err != nil {
+		return nil, err
+	}
+	m := FindEtcdMember(members, name)
+	if m == nil {
+		return nil, fmt.Errorf("member %s not found", name)
+	}
+	return m, nil
+}
+
+func (c *cluster) AddLearner(name string, peerURLs []string) ([]*EtcdMember, error) {
+	if err := c.checkMembershipManaged(); err != nil {
+		return nil, err
+	}
+
+	client, err := c.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := func() (*clientv3.MemberAddResponse, error) {
+		ctx, cancel := c.requestContext()
+		defer cancel()
+		return client.MemberAddAsLearner(ctx, peerURLs)
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE: The name of the new member is empty until it is started.
+	members := make([]*EtcdMember, 0, len(resp.Members))
+	for _, pbMember := range resp.Members {
+		m := newEtcdMember(pbMember)
+		if m.id == resp.Member.ID {
+			m.Name = name
+		}
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+func (c *cluster) PromoteMember(name string) error {
+	if err := c.checkMembershipManaged(); err != nil {
+		return err
+	}
+
+	m, err := c.findEtcdMember(name)
+	if err != nil {
+		return err
+	}
+	if !m.IsLearner {
+		return fmt.Errorf("member %s is not a learner", name)
+	}
+
+	client, err := c.getClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := c.requestContext()
+	defer cancel()
+	_, err = client.MemberPromote(ctx, m.id)
+	return err
+}
+
+func (c *cluster) RemoveMember(name string) error {
+	if err := c.checkMembershipManaged(); err != nil {
+		return err
+	}
+
+	m, err := c.findEtcdMember(name)
+	if err != nil {
+		return err
+	}
+
+	client, err := c.getClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := c.requestContext()
+	defer cancel()
+	_, err = client.MemberRemove(ctx, m.id)
+	return err
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckRemoval(t *testing.T) {
+	assert := assert.New(t)
+
+	members := []*EtcdMember{
+		{ID: "a1", Name: "a", Healthy: true},
+		{ID: "b2", Name: "b", Healthy: true},
+		{ID: "c3", Name: "c", Healthy: false},
+		{ID: "d4", Name: "", IsLearner: true},
+	}
+
+	assert.Error(CheckRemoval(members, "x"))
+	// 2 remaining voting members with 1 healthy.
+	assert.Error(CheckRemoval(members, "a"))
+	assert.Error(CheckRemoval(members, "b"))
+	assert.NoError(CheckRemoval(members, "c"))
+	// learners are found by ID and never vote.
+	assert.NoError(CheckRemoval(members, "d4"))
+
+	members[2].Healthy = true
+	assert.NoError(CheckRemoval(members, "a"))
+
+	assert.Error(CheckRemoval([]*EtcdMember{{Name: "a", Healthy: true}}, "a"))
+}
+
+func TestInitialClusterOf(t *testing.T) {
+	assert := assert.New(t)
+
+	members := []*EtcdMember{
+		{Name: "a", PeerURLs: []string{"http://a:2380", "http://a2:2380"}},
+		{Name: "b", PeerURLs: []string{"http://b:2380"}, IsLearner: true},
+		{PeerURLs: []string{"http://c:2380"}},
+	}
+	assert.Equal(map[string]string{
+		"a": "http://a:2380",
+		"b": "http://b:2380",
+	}, InitialClusterOf(members))
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/megaease/easegress/pkg/util/prometheushelper"
+)
+
+// metrics are the Prometheus metrics of the cluster, they are updated on
+// every heartbeat.
+type metrics struct {
+	healthy prometheus.Gauge
+	members prometheus.Gauge
+	leader  prometheus.Gauge
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		healthy: prometheushelper.NewGauge("cluster_healthy",
+			"whether the member synchronizes its status to the cluster successfully", nil).WithLabelValues(),
+		members: prometheushelper.NewGauge("cluster_members",
+			"the number of etcd members of the cluster", nil).WithLabelValues(),
+		leader: prometheushelper.NewGauge("cluster_leader",
+			"whether the member is the leader of the cluster", nil).WithLabelValues(),
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (m *metrics) updateHeartbeat(healthy, leader bool) {
+	if m == nil {
+		return
+	}
+	m.healthy.Set(boolToFloat(healthy))
+	m.leader.Set(boolToFloat(leader))
+}
+
+func (m *metrics) updateMembers(n int) {
+	if m == nil {
+		return
+	}
+	m.members.Set(float64(n))
+}
@@ -0,0 +1,305 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+// the max number of operations in a transaction of the full sync.
+const mirrorBatchSize = 128
+
+type (
+	// UpstreamStatus is the status of mirroring the configuration from the
+	// cluster of the primary region.
+	UpstreamStatus struct {
+		Endpoints []string `json:"endpoints"`
+		// Mirroring is true only in the leader of the local cluster.
+		Mirroring bool `json:"mirroring"`
+		// Revision is the revision of the upstream cluster which has been
+		// mirrored.
+		Revision     int64  `json:"revision,omitempty"`
+		LastSyncTime string `json:"lastSyncTime,omitempty"`
+		Error        string `json:"error,omitempty"`
+	}
+
+	// mirror mirrors the configuration from the upstream cluster to the
+	// local cluster. Only the leader of the local cluster mirrors, and the
+	// local cluster keeps serving the mirrored configuration when the
+	// upstream cluster is unreachable.
+	mirror struct {
+		c        *cluster
+		prefixes []string
+
+		mutex  sync.Mutex
+		status UpstreamStatus
+	}
+)
+
+func newMirror(c *cluster) *mirror {
+	return &mirror{
+		c:        c,
+		prefixes: c.Layout().MirroredPrefixes(),
+		status:   UpstreamStatus{Endpoints: c.opt.Cluster.UpstreamClientURLs},
+	}
+}
+
+func (m *mirror) getStatus() *UpstreamStatus {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	status := m.status
+	return &status
+}
+
+func (m *mirror) setMirroring(mirroring bool, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.status.Mirroring = mirroring
+	m.status.Error = ""
+	if err != nil {
+		m.status.Error = err.Error()
+	}
+}
+
+func (m *mirror) setRevision(revision int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.status.Revision = revision
+	m.status.LastSyncTime = time.Now().Format(time.RFC3339)
+}
+
+func (m *mirror) run() {
+	for {
+		select {
+		case <-m.c.done:
+			return
+		case <-time.After(HeartbeatInterval):
+		}
+
+		if !m.c.IsLeader() {
+			m.setMirroring(false, nil)
+			continue
+		}
+
+		m.setMirroring(true, nil)
+		err := m.mirror()
+		if errors.Is(err, context.Canceled) {
+			err = nil
+		} else if err != nil {
+			logger.Errorf("mirror configuration from upstream cluster failed: %v", err)
+		}
+		m.setMirroring(false, err)
+	}
+}
+
+func (m *mirror) newUpstreamClient() (*clientv3.Client, error) {
+	opt := m.c.opt
+
+	tlsConfig, err := newClientTLSConfig(opt.Cluster.UpstreamCertFile,
+		opt.Cluster.UpstreamKeyFile, opt.Cluster.UpstreamTrustedCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return clientv3.New(clientv3.Config{
+		Endpoints:            opt.Cluster.UpstreamClientURLs,
+		AutoSyncInterval:     autoSyncInterval,
+		DialTimeout:          dialTimeout,
+		DialKeepAliveTime:    dialKeepAliveTime,
+		DialKeepAliveTimeout: dialKeepAliveTimeout,
+		TLS:                  tlsConfig,
+		LogConfig:            logger.EtcdClientLoggerConfig(opt, logger.EtcdClientFilename),
+		MaxCallSendMsgSize:   opt.Cluster.MaxCallSendMsgSize,
+	})
+}
+
+// mirror does a full sync and then applies the changes of the upstream
+// cluster, until it fails or the local member is not the leader anymore.
+func (m *mirror) mirror() error {
+	upstream, err := m.newUpstreamClient()
+	if err != nil {
+		return fmt.Errorf("create upstream client failed: %v", err)
+	}
+	defer upstream.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-m.c.done:
+				cancel()
+				return
+			case <-time.After(HeartbeatInterval):
+				if !m.c.IsLeader() {
+					logger.Infof("stop mirroring configuration: not the leader anymore")
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	revision, err := m.fullSync(ctx, upstream)
+	if err != nil {
+		return fmt.Errorf("full sync failed: %v", err)
+	}
+	m.setRevision(revision)
+	logger.Infof("configuration is mirrored from upstream cluster at revision %d", revision)
+
+	return m.watch(ctx, upstream, revision)
+}
+
+// fullSync makes the mirrored prefixes of the local cluster the same as the
+// upstream cluster, and returns the revision of the upstream cluster.
+func (m *mirror) fullSync(ctx context.Context, upstream *clientv3.Client) (int64, error) {
+	var revision int64
+	upstreamKVs := map[string]string{}
+	for _, prefix := range m.prefixes {
+		opts := []clientv3.OpOption{clientv3.WithPrefix()}
+		// get all prefixes at the same revision.
+		if revision > 0 {
+			opts = append(opts, clientv3.WithRev(revision))
+		}
+
+		resp, err := func() (*clientv3.GetResponse, error) {
+			ctx, cancel := context.WithTimeout(ctx, 3*m.c.requestTimeout)
+			defer cancel()
+			return upstream.Get(ctx, prefix, opts...)
+		}()
+		if err != nil {
+			return 0, err
+		}
+
+		revision = resp.Header.Revision
+		for _, kv := range resp.Kvs {
+			upstreamKVs[string(kv.Key)] = string(kv.Value)
+		}
+	}
+
+	changes := map[string]*string{}
+	for _, prefix := range m.prefixes {
+		localKVs, err := m.c.GetPrefix(prefix)
+		if err != nil {
+			return 0, err
+		}
+		for k, v := range localKVs {
+			if uv, ok := upstreamKVs[k]; !ok {
+				changes[k] = nil
+			} else if uv != v {
+				uv := uv
+				changes[k] = &uv
+			}
+			delete(upstreamKVs, k)
+		}
+	}
+	for k, v := range upstreamKVs {
+		v := v
+		changes[k] = &v
+	}
+
+	return revision, m.apply(changes)
+}
+
+// apply applies the changes to the local cluster in batches.
+func (m *mirror) apply(changes map[string]*string) error {
+	batch := map[string]*string{}
+	for k, v := range changes {
+		batch[k] = v
+		if len(batch) < mirrorBatchSize {
+			continue
+		}
+		if err := m.c.PutAndDelete(batch); err != nil {
+			return err
+		}
+		batch = map[string]*string{}
+	}
+
+	if len(batch) == 0 {
+		return nil
+	}
+	return m.c.PutAndDelete(batch)
+}
+
+// watch applies the changes of the upstream cluster after the revision.
+func (m *mirror) watch(ctx context.Context, upstream *clientv3.Client, revision int64) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	responses := make(chan clientv3.WatchResponse)
+	watchCtx := clientv3.WithRequireLeader(ctx)
+	for _, prefix := range m.prefixes {
+		wc := upstream.Watch(watchCtx, prefix, clientv3.WithPrefix(),
+			clientv3.WithRev(revision+1), clientv3.WithProgressNotify())
+
+		go func() {
+			// NOTE: The watch channel is closed on unrecoverable errors,
+			// cancel the others to start over.
+			defer cancel()
+			for resp := range wc {
+				select {
+				case responses <- resp:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case resp := <-responses:
+			if err := resp.Err(); err != nil {
+				return fmt.Errorf("watch upstream cluster failed: %v", err)
+			}
+
+			changes := map[string]*string{}
+			for _, event := range resp.Events {
+				key := string(event.Kv.Key)
+				switch event.Type {
+				case clientv3.EventTypePut:
+					value := string(event.Kv.Value)
+					changes[key] = &value
+				case clientv3.EventTypeDelete:
+					changes[key] = nil
+				}
+			}
+
+			if err := m.apply(changes); err != nil {
+				return fmt.Errorf("apply changes failed: %v", err)
+			}
+			m.setRevision(resp.Header.Revision)
+		}
+	}
+}
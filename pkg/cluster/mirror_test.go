@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func waitValue(c Cluster, key string, value *string) bool {
+	for i := 0; i < 60; i++ {
+		v, err := c.Get(key)
+		if err == nil && ((v == nil && value == nil) || (v != nil && value != nil && *v == *value)) {
+			return true
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return false
+}
+
+func TestMirror(t *testing.T) {
+	assert := assert.New(t)
+
+	upstreamDir, err := ioutil.TempDir("", "cluster-test")
+	check(err)
+	defer os.RemoveAll(upstreamDir)
+	followerDir, err := ioutil.TempDir("", "cluster-test")
+	check(err)
+	defer os.RemoveAll(followerDir)
+
+	upstream := CreateClusterForTest(upstreamDir).(*cluster)
+	layout := upstream.Layout()
+	objectKey := layout.ConfigObjectKey("pipeline-demo")
+	assert.NoError(upstream.Put(objectKey, "v1"))
+	assert.NoError(upstream.Put(layout.StatusMemberKey()+"-other", "not mirrored"))
+
+	opt := CreateOptionsForTest(followerDir)
+	opt.Cluster.UpstreamClientURLs = upstream.opt.Cluster.AdvertiseClientURLs
+	cls, err := New(opt)
+	assert.NoError(err)
+	follower := cls.(*cluster)
+	defer closeClusters([]*cluster{upstream, follower})
+
+	// the stale configuration is removed by the full sync.
+	staleKey := layout.ConfigObjectKey("stale")
+	assert.NoError(follower.Put(staleKey, "stale"))
+
+	v1, v2 := "v1", "v2"
+	assert.True(waitValue(follower, objectKey, &v1))
+	assert.True(waitValue(follower, staleKey, nil))
+	v, err := follower.Get(layout.StatusMemberKey() + "-other")
+	assert.NoError(err)
+	assert.Nil(v)
+
+	// changes are applied by the watch.
+	secretKey := layout.SecretPrefix() + "db-password"
+	assert.NoError(upstream.PutAndDelete(map[string]*string{objectKey: &v2, secretKey: &v1}))
+	assert.True(waitValue(follower, objectKey, &v2))
+	assert.True(waitValue(follower, secretKey, &v1))
+	assert.NoError(upstream.Delete(objectKey))
+	assert.True(waitValue(follower, objectKey, nil))
+
+	status := follower.mirror.getStatus()
+	assert.True(status.Mirroring)
+	assert.Empty(status.Error)
+	assert.NotZero(status.Revision)
+
+	// the follower keeps the configuration when the upstream is down.
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	upstream.CloseServer(wg)
+	wg.Wait()
+	v, err = follower.Get(secretKey)
+	assert.NoError(err)
+	assert.Equal(v1, *v)
+}
+
+func TestMirrorApply(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "cluster-test")
+	check(err)
+	defer os.RemoveAll(dir)
+
+	c := CreateClusterForTest(dir).(*cluster)
+	defer closeClusters([]*cluster{c})
+
+	m := newMirror(c)
+	changes := map[string]*string{}
+	for i := 0; i < 2*mirrorBatchSize+1; i++ {
+		v := "value"
+		changes[c.Layout().ConfigObjectKey(fmt.Sprintf("object-%d", i))] = &v
+	}
+	assert.NoError(m.apply(changes))
+
+	kvs, err := c.GetPrefix(c.Layout().ConfigObjectPrefix())
+	assert.NoError(err)
+	assert.Len(kvs, len(changes))
+}
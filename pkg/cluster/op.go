@@ -186,6 +186,29 @@ func (c *cluster) GetRawPrefix(prefix string) (map[string]*mvccpb.KeyValue, erro
 	return kvs, nil
 }
 
+func (c *cluster) GetPrefixBefore(prefix, before string, limit int) ([]*mvccpb.KeyValue, error) {
+	client, err := c.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	end := clientv3.GetPrefixRangeEnd(prefix)
+	if before != "" {
+		end = before
+	}
+
+	resp, err := func() (*clientv3.GetResponse, error) {
+		ctx, cancel := c.requestContext()
+		defer cancel()
+		return client.Get(ctx, prefix, clientv3.WithRange(end), clientv3.WithLimit(int64(limit)),
+			clientv3.WithSort(clientv3.SortByKey, clientv3.SortDescend))
+	}()
+	if err != nil {
+		return nil, err
+	}
+	return resp.Kvs, nil
+}
+
 func (c *cluster) GetWithOp(key string, op ...ClientOp) (map[string]string, error) {
 	kvs := make(map[string]string)
 
@@ -0,0 +1,758 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+type (
+	// standaloneCluster is the cluster of a single member without etcd,
+	// the data is kept in memory and written through the store, which
+	// may persist it. Leases are emulated by never persisting the keys
+	// put under lease, so they live as long as the member.
+	standaloneCluster struct {
+		opt    *option.Options
+		layout *Layout
+		store  standaloneStore
+
+		mutex       sync.RWMutex
+		kvs         map[string]*mvccpb.KeyValue
+		revision    int64
+		subscribers map[*subscriber]struct{}
+
+		locksMutex sync.Mutex
+		locks      map[string]*sync.Mutex
+
+		done chan struct{}
+	}
+
+	// subscriber receives the events of a key or the keys with a prefix,
+	// the events are queued so the writers are never blocked by it.
+	subscriber struct {
+		key    string
+		prefix bool
+
+		mutex  sync.Mutex
+		events []*clientv3.Event
+		notify chan struct{}
+	}
+
+	standaloneWatcher struct {
+		cluster *standaloneCluster
+		done    chan struct{}
+	}
+
+	standaloneSyncer struct {
+		cluster *standaloneCluster
+		done    chan struct{}
+	}
+
+	standaloneMutex struct {
+		m *sync.Mutex
+	}
+
+	// standaloneSTM is the software transactional memory of the
+	// standalone cluster, it runs with the cluster locked, and the writes
+	// are buffered until the transaction commits.
+	standaloneSTM struct {
+		cluster *standaloneCluster
+		writes  map[string]*string
+	}
+)
+
+var (
+	_ Cluster = (*standaloneCluster)(nil)
+	_ Watcher = (*standaloneWatcher)(nil)
+	_ Syncer  = (*standaloneSyncer)(nil)
+	_ Mutex   = (*standaloneMutex)(nil)
+
+	_ concurrency.STM = (*standaloneSTM)(nil)
+)
+
+// newStandaloneCluster creates a standalone cluster.
+func newStandaloneCluster(opt *option.Options) (*standaloneCluster, error) {
+	store, err := newStandaloneStore(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	kvs, revision, err := store.load()
+	if err != nil {
+		store.close()
+		return nil, fmt.Errorf("load standalone store failed: %v", err)
+	}
+
+	c := &standaloneCluster{
+		opt:         opt,
+		layout:      &Layout{memberName: opt.Name},
+		store:       store,
+		kvs:         kvs,
+		revision:    revision,
+		subscribers: map[*subscriber]struct{}{},
+		locks:       map[string]*sync.Mutex{},
+		done:        make(chan struct{}),
+	}
+
+	if err := c.syncStatus(); err != nil {
+		logger.Errorf("sync status failed: %v", err)
+	}
+	go c.heartbeat()
+
+	return c, nil
+}
+
+func (c *standaloneCluster) heartbeat() {
+	for {
+		select {
+		case <-time.After(HeartbeatInterval):
+			if err := c.syncStatus(); err != nil {
+				logger.Errorf("sync status failed: %v", err)
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *standaloneCluster) syncStatus() error {
+	status := MemberStatus{
+		Options:           *c.opt,
+		LastHeartbeatTime: time.Now().Format(time.RFC3339),
+	}
+
+	buff, err := codectool.MarshalJSON(status)
+	if err != nil {
+		return err
+	}
+
+	return c.PutUnderLease(c.layout.StatusMemberKey(), string(buff))
+}
+
+func (c *standaloneCluster) IsLeader() bool {
+	return true
+}
+
+func (c *standaloneCluster) Layout() *Layout {
+	return c.layout
+}
+
+func (c *standaloneCluster) Get(key string) (*string, error) {
+	kv, _ := c.GetRaw(key)
+	if kv == nil {
+		return nil, nil
+	}
+
+	value := string(kv.Value)
+	return &value, nil
+}
+
+func (c *standaloneCluster) GetPrefix(prefix string) (map[string]string, error) {
+	kvs, _ := c.GetRawPrefix(prefix)
+
+	result := make(map[string]string, len(kvs))
+	for k, kv := range kvs {
+		result[k] = string(kv.Value)
+	}
+	return result, nil
+}
+
+func (c *standaloneCluster) GetRaw(key string) (*mvccpb.KeyValue, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.kvs[key], nil
+}
+
+func (c *standaloneCluster) GetRawPrefix(prefix string) (map[string]*mvccpb.KeyValue, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.getRaw(prefix, true), nil
+}
+
+// getRaw returns the key values of the key, or the keys with the prefix,
+// the caller must hold the lock.
+func (c *standaloneCluster) getRaw(key string, prefix bool) map[string]*mvccpb.KeyValue {
+	result := make(map[string]*mvccpb.KeyValue)
+	if !prefix {
+		if kv := c.kvs[key]; kv != nil {
+			result[key] = kv
+		}
+		return result
+	}
+
+	for k, kv := range c.kvs {
+		if strings.HasPrefix(k, key) {
+			result[k] = kv
+		}
+	}
+	return result
+}
+
+func (c *standaloneCluster) GetWithOp(key string, ops ...ClientOp) (map[string]string, error) {
+	prefix, keysOnly := false, false
+	for _, op := range ops {
+		switch op {
+		case OpPrefix:
+			prefix = true
+		case OpKeysOnly:
+			keysOnly = true
+		}
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	kvs := make(map[string]string)
+	for k, kv := range c.getRaw(key, prefix) {
+		if keysOnly {
+			kvs[k] = ""
+		} else {
+			kvs[k] = string(kv.Value)
+		}
+	}
+	return kvs, nil
+}
+
+func (c *standaloneCluster) GetPrefixBefore(prefix, before string, limit int) ([]*mvccpb.KeyValue, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	kvs := []*mvccpb.KeyValue{}
+	for k, kv := range c.getRaw(prefix, true) {
+		if before == "" || k < before {
+			kvs = append(kvs, kv)
+		}
+	}
+
+	sort.Slice(kvs, func(i, j int) bool {
+		return string(kvs[i].Key) > string(kvs[j].Key)
+	})
+	if limit > 0 && len(kvs) > limit {
+		kvs = kvs[:limit]
+	}
+	return kvs, nil
+}
+
+func (c *standaloneCluster) Put(key, value string) error {
+	return c.PutAndDelete(map[string]*string{key: &value})
+}
+
+func (c *standaloneCluster) PutUnderLease(key, value string) error {
+	return c.PutAndDeleteUnderLease(map[string]*string{key: &value})
+}
+
+func (c *standaloneCluster) PutAndDelete(kvs map[string]*string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.commit(kvs, false)
+}
+
+func (c *standaloneCluster) PutAndDeleteUnderLease(kvs map[string]*string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.commit(kvs, true)
+}
+
+func (c *standaloneCluster) Delete(key string) error {
+	return c.PutAndDelete(map[string]*string{key: nil})
+}
+
+func (c *standaloneCluster) DeletePrefix(prefix string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	kvs := make(map[string]*string)
+	for k := range c.getRaw(prefix, true) {
+		kvs[k] = nil
+	}
+	return c.commit(kvs, false)
+}
+
+// commit puts the keys with non-nil values and deletes the others in one
+// revision, and publishes the events to the subscribers, the caller must
+// hold the lock. The changes are applied only if the store saves them,
+// except the keys put under lease, which are never saved.
+func (c *standaloneCluster) commit(kvs map[string]*string, underLease bool) error {
+	revision := c.revision + 1
+	events := make([]*clientv3.Event, 0, len(kvs))
+	changes := make(map[string]*mvccpb.KeyValue, len(kvs))
+
+	for k, v := range kvs {
+		prev := c.kvs[k]
+		if v == nil {
+			if prev == nil {
+				continue
+			}
+			changes[k] = nil
+			events = append(events, &clientv3.Event{
+				Type:   mvccpb.DELETE,
+				Kv:     &mvccpb.KeyValue{Key: []byte(k), ModRevision: revision},
+				PrevKv: prev,
+			})
+			continue
+		}
+
+		kv := &mvccpb.KeyValue{
+			Key:            []byte(k),
+			Value:          []byte(*v),
+			CreateRevision: revision,
+			ModRevision:    revision,
+			Version:        1,
+		}
+		if prev != nil {
+			kv.CreateRevision = prev.CreateRevision
+			kv.Version = prev.Version + 1
+		}
+		changes[k] = kv
+		events = append(events, &clientv3.Event{Type: mvccpb.PUT, Kv: kv, PrevKv: prev})
+	}
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	saved := changes
+	if underLease {
+		saved = make(map[string]*mvccpb.KeyValue)
+		for k, kv := range changes {
+			if kv == nil {
+				saved[k] = nil
+			}
+		}
+	}
+	if err := c.store.save(saved, revision); err != nil {
+		return fmt.Errorf("save to standalone store failed: %v", err)
+	}
+
+	for k, kv := range changes {
+		if kv == nil {
+			delete(c.kvs, k)
+		} else {
+			c.kvs[k] = kv
+		}
+	}
+	c.revision = revision
+
+	for s := range c.subscribers {
+		s.push(events)
+	}
+	return nil
+}
+
+func (c *standaloneCluster) subscribe(key string, prefix bool) *subscriber {
+	s := &subscriber{
+		key:    key,
+		prefix: prefix,
+		notify: make(chan struct{}, 1),
+	}
+
+	c.mutex.Lock()
+	c.subscribers[s] = struct{}{}
+	c.mutex.Unlock()
+
+	return s
+}
+
+func (c *standaloneCluster) unsubscribe(s *subscriber) {
+	c.mutex.Lock()
+	delete(c.subscribers, s)
+	c.mutex.Unlock()
+}
+
+func (s *subscriber) push(events []*clientv3.Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	matched := false
+	for _, e := range events {
+		key := string(e.Kv.Key)
+		if key == s.key || (s.prefix && strings.HasPrefix(key, s.key)) {
+			s.events = append(s.events, e)
+			matched = true
+		}
+	}
+	if !matched {
+		return
+	}
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscriber) pop() []*clientv3.Event {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	events := s.events
+	s.events = nil
+	return events
+}
+
+func (c *standaloneCluster) STM(apply func(concurrency.STM) error) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stm := &standaloneSTM{cluster: c, writes: map[string]*string{}}
+	if err := apply(stm); err != nil {
+		return err
+	}
+	return c.commit(stm.writes, false)
+}
+
+// Get returns the value of the first key, the rest keys are for
+// prefetching in etcd, which is meaningless here.
+func (s *standaloneSTM) Get(keys ...string) string {
+	if len(keys) == 0 {
+		return ""
+	}
+
+	if v, ok := s.writes[keys[0]]; ok {
+		if v == nil {
+			return ""
+		}
+		return *v
+	}
+	if kv := s.cluster.kvs[keys[0]]; kv != nil {
+		return string(kv.Value)
+	}
+	return ""
+}
+
+func (s *standaloneSTM) Put(key, val string, opts ...clientv3.OpOption) {
+	s.writes[key] = &val
+}
+
+func (s *standaloneSTM) Rev(key string) int64 {
+	if kv := s.cluster.kvs[key]; kv != nil {
+		return kv.ModRevision
+	}
+	return 0
+}
+
+func (s *standaloneSTM) Del(key string) {
+	s.writes[key] = nil
+}
+
+func (c *standaloneCluster) Watcher() (Watcher, error) {
+	return &standaloneWatcher{
+		cluster: c,
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// run sends the events of the key, or the keys with the prefix, until the
+// watcher is closed, and then calls closeFn.
+func (w *standaloneWatcher) run(key string, prefix bool, send func(*clientv3.Event), closeFn func()) {
+	s := w.cluster.subscribe(key, prefix)
+
+	go func() {
+		defer closeFn()
+		defer w.cluster.unsubscribe(s)
+
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-s.notify:
+				for _, e := range s.pop() {
+					send(e)
+				}
+			}
+		}
+	}()
+}
+
+func (w *standaloneWatcher) Watch(key string) (<-chan *string, error) {
+	keyChan := make(chan *string, 10)
+
+	w.run(key, false, func(e *clientv3.Event) {
+		if e.Type == mvccpb.DELETE {
+			keyChan <- nil
+			return
+		}
+		value := string(e.Kv.Value)
+		keyChan <- &value
+	}, func() { close(keyChan) })
+
+	return keyChan, nil
+}
+
+func (w *standaloneWatcher) WatchRaw(key string) (<-chan *clientv3.Event, error) {
+	eventChan := make(chan *clientv3.Event, 10)
+
+	w.run(key, false, func(e *clientv3.Event) {
+		if e.Type == mvccpb.DELETE {
+			eventChan <- nil
+			return
+		}
+		eventChan <- e
+	}, func() { close(eventChan) })
+
+	return eventChan, nil
+}
+
+func (w *standaloneWatcher) WatchPrefix(prefix string) (<-chan map[string]*string, error) {
+	return w.WatchWithOp(prefix, OpPrefix)
+}
+
+func (w *standaloneWatcher) WatchRawPrefix(prefix string) (<-chan map[string]*clientv3.Event, error) {
+	prefixChan := make(chan map[string]*clientv3.Event, 10)
+
+	w.run(prefix, true, func(e *clientv3.Event) {
+		if e.Type == mvccpb.DELETE {
+			prefixChan <- map[string]*clientv3.Event{string(e.Kv.Key): nil}
+			return
+		}
+		prefixChan <- map[string]*clientv3.Event{string(e.Kv.Key): e}
+	}, func() { close(prefixChan) })
+
+	return prefixChan, nil
+}
+
+func (w *standaloneWatcher) WatchWithOp(key string, ops ...ClientOp) (<-chan map[string]*string, error) {
+	prefix, noPut, noDelete := false, false, false
+	for _, op := range ops {
+		switch op {
+		case OpPrefix:
+			prefix = true
+		case OpNotWatchPut:
+			noPut = true
+		case OpNotWatchDelete:
+			noDelete = true
+		default:
+			logger.Errorf("unsupported client operation: %v", op)
+		}
+	}
+
+	prefixChan := make(chan map[string]*string, 10)
+
+	w.run(key, prefix, func(e *clientv3.Event) {
+		if e.Type == mvccpb.DELETE {
+			if !noDelete {
+				prefixChan <- map[string]*string{string(e.Kv.Key): nil}
+			}
+			return
+		}
+		if !noPut {
+			value := string(e.Kv.Value)
+			prefixChan <- map[string]*string{string(e.Kv.Key): &value}
+		}
+	}, func() { close(prefixChan) })
+
+	return prefixChan, nil
+}
+
+func (w *standaloneWatcher) Close() {
+	close(w.done)
+}
+
+func (c *standaloneCluster) Syncer(pullInterval time.Duration) (Syncer, error) {
+	return &standaloneSyncer{
+		cluster: c,
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// run sends the full data of the key, or the keys with the prefix, at the
+// beginning and after every change, the pull interval is unnecessary since
+// the events are never lost.
+func (s *standaloneSyncer) run(key string, prefix bool, send func(data map[string]*mvccpb.KeyValue)) {
+	sub := s.cluster.subscribe(key, prefix)
+	defer s.cluster.unsubscribe(sub)
+
+	data := make(map[string]*mvccpb.KeyValue)
+
+	pullCompareSend := func() {
+		s.cluster.mutex.RLock()
+		newData := s.cluster.getRaw(key, prefix)
+		s.cluster.mutex.RUnlock()
+
+		if !isDataEqual(data, newData) {
+			data = newData
+			send(data)
+		}
+	}
+
+	pullCompareSend()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-sub.notify:
+			sub.pop()
+			pullCompareSend()
+		}
+	}
+}
+
+func (s *standaloneSyncer) Sync(key string) (<-chan *string, error) {
+	ch := make(chan *string, 10)
+
+	fn := func(data map[string]*mvccpb.KeyValue) {
+		if kv := data[key]; kv == nil {
+			ch <- nil
+		} else {
+			value := string(kv.Value)
+			ch <- &value
+		}
+	}
+
+	go func() {
+		defer close(ch)
+		s.run(key, false, fn)
+	}()
+
+	return ch, nil
+}
+
+func (s *standaloneSyncer) SyncRaw(key string) (<-chan *mvccpb.KeyValue, error) {
+	ch := make(chan *mvccpb.KeyValue, 10)
+
+	fn := func(data map[string]*mvccpb.KeyValue) {
+		ch <- data[key]
+	}
+
+	go func() {
+		defer close(ch)
+		s.run(key, false, fn)
+	}()
+
+	return ch, nil
+}
+
+func (s *standaloneSyncer) SyncPrefix(prefix string) (<-chan map[string]string, error) {
+	ch := make(chan map[string]string, 10)
+
+	fn := func(data map[string]*mvccpb.KeyValue) {
+		m := make(map[string]string, len(data))
+		for k, v := range data {
+			m[k] = string(v.Value)
+		}
+		ch <- m
+	}
+
+	go func() {
+		defer close(ch)
+		s.run(prefix, true, fn)
+	}()
+
+	return ch, nil
+}
+
+func (s *standaloneSyncer) SyncRawPrefix(prefix string) (<-chan map[string]*mvccpb.KeyValue, error) {
+	ch := make(chan map[string]*mvccpb.KeyValue, 10)
+
+	fn := func(data map[string]*mvccpb.KeyValue) {
+		ch <- data
+	}
+
+	go func() {
+		defer close(ch)
+		s.run(prefix, true, fn)
+	}()
+
+	return ch, nil
+}
+
+func (s *standaloneSyncer) Close() {
+	close(s.done)
+}
+
+func (c *standaloneCluster) Mutex(name string) (Mutex, error) {
+	c.locksMutex.Lock()
+	defer c.locksMutex.Unlock()
+
+	m, ok := c.locks[name]
+	if !ok {
+		m = &sync.Mutex{}
+		c.locks[name] = m
+	}
+	return &standaloneMutex{m: m}, nil
+}
+
+func (m *standaloneMutex) Lock() error {
+	m.m.Lock()
+	return nil
+}
+
+func (m *standaloneMutex) Unlock() error {
+	m.m.Unlock()
+	return nil
+}
+
+func (c *standaloneCluster) CloseServer(wg *sync.WaitGroup) {
+	wg.Done()
+}
+
+// StartServer returns a closed done channel since there's no server.
+func (c *standaloneCluster) StartServer() (chan struct{}, chan struct{}, error) {
+	done := make(chan struct{})
+	close(done)
+	return done, make(chan struct{}), nil
+}
+
+func (c *standaloneCluster) Close(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	close(c.done)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.store.close(); err != nil {
+		logger.Errorf("close standalone store failed: %v", err)
+	}
+}
+
+func (c *standaloneCluster) PurgeMember(member string) error {
+	return fmt.Errorf("purge member is not supported in standalone mode")
+}
+
+func (c *standaloneCluster) EtcdMembers() ([]*EtcdMember, error) {
+	return nil, fmt.Errorf("etcd members are not supported in standalone mode")
+}
+
+func (c *standaloneCluster) AddLearner(name string, peerURLs []string) ([]*EtcdMember, error) {
+	return nil, fmt.Errorf("add learner is not supported in standalone mode")
+}
+
+func (c *standaloneCluster) PromoteMember(member string) error {
+	return fmt.Errorf("promote member is not supported in standalone mode")
+}
+
+func (c *standaloneCluster) RemoveMember(member string) error {
+	return fmt.Errorf("remove member is not supported in standalone mode")
+}
@@ -0,0 +1,241 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/pkg/option"
+)
+
+func newTestStandaloneCluster() *standaloneCluster {
+	opt := option.New()
+	opt.Name = "standalone-test"
+	opt.Standalone = true
+	c, err := newStandaloneCluster(opt)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func closeTestStandaloneCluster(c *standaloneCluster) {
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	c.Close(wg)
+}
+
+func TestStandaloneClusterKV(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newTestStandaloneCluster()
+	defer closeTestStandaloneCluster(c)
+
+	assert.True(c.IsLeader())
+	assert.NotNil(c.Layout())
+
+	status, err := c.Get(c.Layout().StatusMemberKey())
+	assert.NoError(err)
+	assert.NotNil(status)
+
+	assert.NoError(c.Put("/a/1", "v1"))
+	assert.NoError(c.Put("/a/2", "v2"))
+	assert.NoError(c.Put("/b/1", "v3"))
+
+	v, err := c.Get("/a/1")
+	assert.NoError(err)
+	assert.Equal("v1", *v)
+
+	kv, err := c.GetRaw("/a/1")
+	assert.NoError(err)
+	assert.Equal(int64(1), kv.Version)
+	assert.NoError(c.Put("/a/1", "v1-1"))
+	kv2, _ := c.GetRaw("/a/1")
+	assert.Equal(int64(2), kv2.Version)
+	assert.Equal(kv.CreateRevision, kv2.CreateRevision)
+	assert.Greater(kv2.ModRevision, kv.ModRevision)
+
+	kvs, err := c.GetPrefix("/a/")
+	assert.NoError(err)
+	assert.Equal(map[string]string{"/a/1": "v1-1", "/a/2": "v2"}, kvs)
+
+	kvs, err = c.GetWithOp("/a/", OpPrefix, OpKeysOnly)
+	assert.NoError(err)
+	assert.Equal(map[string]string{"/a/1": "", "/a/2": ""}, kvs)
+
+	assert.NoError(c.Put("/a/3", "v3"))
+	page, err := c.GetPrefixBefore("/a/", "", 2)
+	assert.NoError(err)
+	assert.Len(page, 2)
+	assert.Equal("/a/3", string(page[0].Key))
+	assert.Equal("/a/2", string(page[1].Key))
+	page, _ = c.GetPrefixBefore("/a/", string(page[1].Key), 2)
+	assert.Len(page, 1)
+	assert.Equal("/a/1", string(page[0].Key))
+	assert.NoError(c.Delete("/a/3"))
+
+	v4 := "v4"
+	assert.NoError(c.PutAndDelete(map[string]*string{"/a/1": nil, "/b/2": &v4}))
+	v, _ = c.Get("/a/1")
+	assert.Nil(v)
+	v, _ = c.Get("/b/2")
+	assert.Equal("v4", *v)
+
+	assert.NoError(c.DeletePrefix("/b/"))
+	kvs, _ = c.GetPrefix("/b/")
+	assert.Empty(kvs)
+
+	assert.Error(c.PurgeMember("member"))
+}
+
+func TestStandaloneClusterWatcher(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newTestStandaloneCluster()
+	defer closeTestStandaloneCluster(c)
+
+	w, err := c.Watcher()
+	assert.NoError(err)
+	defer w.Close()
+
+	keyChan, _ := w.Watch("/key")
+	prefixChan, _ := w.WatchPrefix("/prefix/")
+	deleteChan, _ := w.WatchWithOp("/prefix/", OpPrefix, OpNotWatchPut)
+
+	c.Put("/key", "v1")
+	c.Put("/prefix/1", "v2")
+	c.Delete("/prefix/1")
+	c.Delete("/key")
+
+	assert.Equal("v1", *<-keyChan)
+	assert.Nil(<-keyChan)
+
+	m := <-prefixChan
+	assert.Equal("v2", *m["/prefix/1"])
+	m = <-prefixChan
+	assert.Nil(m["/prefix/1"])
+	assert.Contains(m, "/prefix/1")
+
+	m = <-deleteChan
+	assert.Contains(m, "/prefix/1")
+	assert.Nil(m["/prefix/1"])
+}
+
+func TestStandaloneClusterSyncer(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newTestStandaloneCluster()
+	defer closeTestStandaloneCluster(c)
+
+	c.Put("/prefix/1", "v1")
+
+	s, err := c.Syncer(time.Minute)
+	assert.NoError(err)
+	defer s.Close()
+
+	ch, _ := s.SyncPrefix("/prefix/")
+	assert.Equal(map[string]string{"/prefix/1": "v1"}, <-ch)
+
+	c.Put("/prefix/2", "v2")
+	assert.Equal(map[string]string{"/prefix/1": "v1", "/prefix/2": "v2"}, <-ch)
+
+	c.Put("/other", "v3")
+	c.Delete("/prefix/1")
+	assert.Equal(map[string]string{"/prefix/2": "v2"}, <-ch)
+}
+
+func TestStandaloneClusterSTMAndMutex(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newTestStandaloneCluster()
+	defer closeTestStandaloneCluster(c)
+
+	mutex, err := c.Mutex("lock")
+	assert.NoError(err)
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			assert.NoError(mutex.Lock())
+			defer mutex.Unlock()
+
+			c.STM(func(stm concurrency.STM) error {
+				n, _ := strconv.Atoi(stm.Get("/counter"))
+				stm.Put("/counter", strconv.Itoa(n+1))
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+
+	v, _ := c.Get("/counter")
+	assert.Equal("10", *v)
+}
+
+func TestStandaloneClusterBoltStore(t *testing.T) {
+	assert := assert.New(t)
+
+	opt := option.New()
+	opt.Name = "standalone-test"
+	opt.Standalone = true
+	opt.StandaloneStore = "bbolt"
+	opt.AbsDataDir = t.TempDir()
+
+	c, err := newStandaloneCluster(opt)
+	assert.NoError(err)
+	assert.NoError(c.Put("/a/1", "v1"))
+	assert.NoError(c.Put("/a/2", "v2"))
+	assert.NoError(c.Put("/a/1", "v1-1"))
+	assert.NoError(c.Delete("/a/2"))
+	assert.NoError(c.PutUnderLease("/lease/1", "v3"))
+	kv, _ := c.GetRaw("/a/1")
+	closeTestStandaloneCluster(c)
+
+	// the keys put under lease are lost after restart.
+	c, err = newStandaloneCluster(opt)
+	assert.NoError(err)
+	defer closeTestStandaloneCluster(c)
+
+	kv2, err := c.GetRaw("/a/1")
+	assert.NoError(err)
+	assert.Equal(kv, kv2)
+
+	kvs, _ := c.GetPrefix("/a/")
+	assert.Equal(map[string]string{"/a/1": "v1-1"}, kvs)
+	v, _ := c.Get("/lease/1")
+	assert.Nil(v)
+	status, _ := c.Get(c.Layout().StatusMemberKey())
+	assert.NotNil(status)
+
+	assert.NoError(c.Put("/a/3", "v3"))
+	kv3, _ := c.GetRaw("/a/3")
+	assert.Greater(kv3.ModRevision, kv.ModRevision)
+
+	opt.StandaloneStore = "unknown"
+	_, err = newStandaloneCluster(opt)
+	assert.Error(err)
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cluster
+
+import (
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+
+	"github.com/megaease/easegress/pkg/option"
+)
+
+const standaloneDBFile = "standalone.db"
+
+var (
+	boltKVsBucket   = []byte("kvs")
+	boltMetaBucket  = []byte("meta")
+	boltRevisionKey = []byte("revision")
+
+	_ standaloneStore = memoryStore{}
+	_ standaloneStore = (*boltStore)(nil)
+)
+
+type (
+	// standaloneStore persists the data of the standalone cluster, the
+	// cluster keeps all the data in memory and writes through the store,
+	// so the store is only read once at startup.
+	standaloneStore interface {
+		// load returns all the key values and the current revision.
+		load() (map[string]*mvccpb.KeyValue, int64, error)
+		// save puts the key values and deletes the keys with nil values
+		// in one transaction, together with the revision.
+		save(kvs map[string]*mvccpb.KeyValue, revision int64) error
+		close() error
+	}
+
+	// memoryStore persists nothing, the data is lost after the member
+	// exits.
+	memoryStore struct{}
+
+	// boltStore persists the data in a bbolt database in the data dir,
+	// which is much lighter than etcd for single node deployments.
+	boltStore struct {
+		db *bolt.DB
+	}
+)
+
+func newStandaloneStore(opt *option.Options) (standaloneStore, error) {
+	switch opt.StandaloneStore {
+	case "", "memory":
+		return memoryStore{}, nil
+	case "bbolt":
+		return newBoltStore(filepath.Join(opt.AbsDataDir, standaloneDBFile))
+	default:
+		return nil, fmt.Errorf("unknown standalone store %s", opt.StandaloneStore)
+	}
+}
+
+func (memoryStore) load() (map[string]*mvccpb.KeyValue, int64, error) {
+	return map[string]*mvccpb.KeyValue{}, 0, nil
+}
+
+func (memoryStore) save(kvs map[string]*mvccpb.KeyValue, revision int64) error {
+	return nil
+}
+
+func (memoryStore) close() error {
+	return nil
+}
+
+func newBoltStore(path string) (*boltStore, error) {
+	// the timeout avoids blocking forever if another process holds the
+	// file lock of the database.
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open %s failed: %v", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(boltKVsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(boltMetaBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("init %s failed: %v", path, err)
+	}
+
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) load() (map[string]*mvccpb.KeyValue, int64, error) {
+	kvs := map[string]*mvccpb.KeyValue{}
+	revision := int64(0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(boltMetaBucket).Get(boltRevisionKey); len(v) == 8 {
+			revision = int64(binary.BigEndian.Uint64(v))
+		}
+
+		return tx.Bucket(boltKVsBucket).ForEach(func(k, v []byte) error {
+			kv := &mvccpb.KeyValue{}
+			if err := kv.Unmarshal(v); err != nil {
+				return fmt.Errorf("unmarshal %s failed: %v", k, err)
+			}
+			kvs[string(k)] = kv
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return kvs, revision, nil
+}
+
+func (s *boltStore) save(kvs map[string]*mvccpb.KeyValue, revision int64) error {
+	if len(kvs) == 0 {
+		return nil
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltKVsBucket)
+		for k, kv := range kvs {
+			if kv == nil {
+				if err := bucket.Delete([]byte(k)); err != nil {
+					return err
+				}
+				continue
+			}
+
+			buff, err := kv.Marshal()
+			if err != nil {
+				return err
+			}
+			if err = bucket.Put([]byte(k), buff); err != nil {
+				return err
+			}
+		}
+
+		buff := make([]byte, 8)
+		binary.BigEndian.PutUint64(buff, uint64(revision))
+		return tx.Bucket(boltMetaBucket).Put(boltRevisionKey, buff)
+	})
+}
+
+func (s *boltStore) close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,411 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package embed runs Easegress as a library inside another Go process.
+//
+// The embedded Easegress runs in the standalone mode, the objects are kept
+// in memory and managed by the Go API, and the requests could be run
+// through the pipelines directly, without going through an HTTPServer.
+//
+// NOTE: Easegress has process level states, e.g. the logger and the object
+// registry, so there should be only one embedded Easegress in a process.
+package embed
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/env"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/pipeline"
+	"github.com/megaease/easegress/pkg/object/rawconfigtrafficcontroller"
+	"github.com/megaease/easegress/pkg/object/trafficcontroller"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/profile"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	_ "github.com/megaease/easegress/pkg/registry"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+const (
+	defaultName         = "eg-embed"
+	defaultApplyTimeout = 10 * time.Second
+	applyCheckInterval  = 10 * time.Millisecond
+)
+
+type (
+	// Options are the options of the embedded Easegress.
+	Options struct {
+		// Name is the name of the member, defaults to eg-embed.
+		Name string
+		// HomeDir is the home directory for the logs and the data, defaults
+		// to the current directory.
+		HomeDir string
+		// APIAddr is the address of the administration API, the API is not
+		// served if it is empty.
+		APIAddr string
+		// ObjectsDir is the directory of the yaml files of the objects, which
+		// are watched and reloaded on changes, the configuration is read-only
+		// if it is specified.
+		ObjectsDir string
+		// ApplyTimeout is the timeout to wait for the objects to be running
+		// after applying them, defaults to 10s.
+		ApplyTimeout time.Duration
+		// Debug sets the log level to debug.
+		Debug bool
+		// Args are the extra command line arguments of easegress-server,
+		// e.g. --metrics-labels.
+		Args []string
+	}
+
+	// Easegress is an embedded Easegress.
+	Easegress struct {
+		opt          *option.Options
+		applyTimeout time.Duration
+
+		cls     cluster.Cluster
+		super   *supervisor.Supervisor
+		profile profile.Profile
+		api     *api.Server
+
+		// mutex serializes the changes of the objects.
+		mutex sync.Mutex
+	}
+)
+
+// Start starts an embedded Easegress.
+func Start(opts *Options) (*Easegress, error) {
+	args := []string{"--standalone"}
+
+	name := opts.Name
+	if name == "" {
+		name = defaultName
+	}
+	args = append(args, "--name", name)
+	if opts.HomeDir != "" {
+		args = append(args, "--home-dir", opts.HomeDir)
+	}
+	if opts.APIAddr != "" {
+		args = append(args, "--api-addr", opts.APIAddr)
+	}
+	if opts.ObjectsDir != "" {
+		args = append(args, "--objects-dir", opts.ObjectsDir)
+	}
+	if opts.Debug {
+		args = append(args, "--debug")
+	}
+	args = append(args, opts.Args...)
+
+	opt := option.New()
+	if _, err := opt.ParseArgs(args); err != nil {
+		return nil, fmt.Errorf("invalid options: %v", err)
+	}
+
+	if err := env.InitServerDir(opt); err != nil {
+		return nil, fmt.Errorf("init env failed: %v", err)
+	}
+	logger.Init(opt)
+
+	cls, err := cluster.New(opt)
+	if err != nil {
+		return nil, fmt.Errorf("new cluster failed: %v", err)
+	}
+
+	eg := &Easegress{
+		opt:          opt,
+		applyTimeout: opts.ApplyTimeout,
+		cls:          cls,
+		super:        supervisor.MustNew(opt, cls),
+	}
+	if eg.applyTimeout <= 0 {
+		eg.applyTimeout = defaultApplyTimeout
+	}
+
+	if opts.APIAddr != "" {
+		eg.profile, err = profile.New(opt)
+		if err != nil {
+			eg.Close()
+			return nil, fmt.Errorf("new profile failed: %v", err)
+		}
+		eg.api = api.MustNewServer(opt, cls, eg.super, eg.profile)
+	}
+
+	return eg, nil
+}
+
+// Supervisor returns the supervisor of the embedded Easegress.
+func (eg *Easegress) Supervisor() *supervisor.Supervisor {
+	return eg.super
+}
+
+// Apply creates or updates the objects in the yaml specs, each spec could
+// contain multiple objects separated by ---. The objects are validated
+// together before anything is changed, and Apply returns after all of them
+// are running.
+func (eg *Easegress) Apply(specs ...string) error {
+	if eg.opt.IsConfigReadOnly() {
+		return fmt.Errorf("configuration is read-only, please change the objects in %s", eg.opt.ObjectsDir)
+	}
+
+	var objs []*supervisor.Spec
+	names := map[string]bool{}
+	for _, spec := range specs {
+		r := k8syaml.NewYAMLReader(bufio.NewReader(strings.NewReader(spec)))
+		for {
+			doc, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("read yaml failed: %v", err)
+			}
+			if len(bytes.TrimSpace(doc)) == 0 {
+				continue
+			}
+
+			s, err := eg.super.NewSpec(string(doc))
+			if err != nil {
+				return err
+			}
+			if names[s.Name()] {
+				return fmt.Errorf("%s: duplicated name", s.Name())
+			}
+			names[s.Name()] = true
+			objs = append(objs, s)
+		}
+	}
+
+	eg.mutex.Lock()
+	defer eg.mutex.Unlock()
+
+	layout := eg.cls.Layout()
+	kvs := map[string]*string{}
+	for _, s := range objs {
+		config := s.JSONConfig()
+		kvs[layout.ConfigObjectKey(s.Name())] = &config
+	}
+	if err := eg.commit(kvs); err != nil {
+		return err
+	}
+
+	return eg.wait(func() bool {
+		for _, s := range objs {
+			entity := eg.getEntity(s.Name())
+			if entity == nil || !entity.Spec().Equals(s) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Delete deletes the objects, and returns after all of them are closed.
+func (eg *Easegress) Delete(names ...string) error {
+	if eg.opt.IsConfigReadOnly() {
+		return fmt.Errorf("configuration is read-only, please change the objects in %s", eg.opt.ObjectsDir)
+	}
+
+	eg.mutex.Lock()
+	defer eg.mutex.Unlock()
+
+	layout := eg.cls.Layout()
+	kvs := map[string]*string{}
+	for _, name := range names {
+		kvs[layout.ConfigObjectKey(name)] = nil
+	}
+	if err := eg.commit(kvs); err != nil {
+		return err
+	}
+
+	return eg.wait(func() bool {
+		for _, name := range names {
+			if eg.getEntity(name) != nil {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// commit puts the changes of the objects and upgrades the config version.
+func (eg *Easegress) commit(kvs map[string]*string) error {
+	layout := eg.cls.Layout()
+
+	version := int64(0)
+	value, err := eg.cls.Get(layout.ConfigVersion())
+	if err != nil {
+		return err
+	}
+	if value != nil {
+		version, _ = strconv.ParseInt(*value, 10, 64)
+	}
+	versionStr := strconv.FormatInt(version+1, 10)
+	kvs[layout.ConfigVersion()] = &versionStr
+
+	return eg.cls.PutAndDelete(kvs)
+}
+
+func (eg *Easegress) wait(done func() bool) error {
+	deadline := time.Now().Add(eg.applyTimeout)
+	for !done() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout to wait for the objects, please check the logs for errors")
+		}
+		time.Sleep(applyCheckInterval)
+	}
+	return nil
+}
+
+func (eg *Easegress) trafficController() *trafficcontroller.TrafficController {
+	entity, exists := eg.super.GetSystemController(trafficcontroller.Kind)
+	if !exists {
+		return nil
+	}
+	return entity.Instance().(*trafficcontroller.TrafficController)
+}
+
+// getEntity returns the running entity of the object, it is nil if the
+// object is not running.
+func (eg *Easegress) getEntity(name string) *supervisor.ObjectEntity {
+	if entity, exists := eg.super.GetBusinessController(name); exists {
+		return entity
+	}
+
+	tc := eg.trafficController()
+	if tc == nil {
+		return nil
+	}
+	if entity, exists := tc.GetPipeline(rawconfigtrafficcontroller.DefaultNamespace, name); exists {
+		return entity
+	}
+	if entity, exists := tc.GetTrafficGate(rawconfigtrafficcontroller.DefaultNamespace, name); exists {
+		return entity
+	}
+	return nil
+}
+
+// Get returns the spec of the running object.
+func (eg *Easegress) Get(name string) (*supervisor.Spec, bool) {
+	entity := eg.getEntity(name)
+	if entity == nil {
+		return nil, false
+	}
+	return entity.Spec(), true
+}
+
+// serve runs the request through the pipeline, and calls send with the
+// response before the context is finished.
+func (eg *Easegress) serve(pipelineName string, stdr *http.Request, send func(resp *httpprot.Response)) error {
+	tc := eg.trafficController()
+	if tc == nil {
+		return fmt.Errorf("traffic controller not found")
+	}
+	p, exists := tc.GetPipeline(rawconfigtrafficcontroller.DefaultNamespace, pipelineName)
+	if !exists {
+		return fmt.Errorf("pipeline %s not found", pipelineName)
+	}
+
+	// httpprot.NewRequest never returns an error.
+	req, _ := httpprot.NewRequest(stdr)
+	if err := req.FetchPayload(0); err != nil {
+		return fmt.Errorf("read request body failed: %v", err)
+	}
+
+	ctx := context.New(tracing.NoopSpan)
+	ctx.SetRequest(context.DefaultNamespace, req)
+	defer ctx.Finish()
+
+	p.Instance().(*pipeline.Pipeline).Handle(ctx)
+
+	resp, ok := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response)
+	if !ok {
+		return fmt.Errorf("pipeline %s returns no HTTP response", pipelineName)
+	}
+	send(resp)
+	return nil
+}
+
+// HandleHTTP runs the request through the pipeline and returns the
+// response, the body of the response is read into memory.
+func (eg *Easegress) HandleHTTP(pipelineName string, req *http.Request) (*http.Response, error) {
+	var result *http.Response
+	err := eg.serve(pipelineName, req, func(resp *httpprot.Response) {
+		body, _ := io.ReadAll(resp.GetPayload())
+		result = &http.Response{
+			Status:        fmt.Sprintf("%d %s", resp.StatusCode(), http.StatusText(resp.StatusCode())),
+			StatusCode:    resp.StatusCode(),
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        resp.HTTPHeader().Clone(),
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}
+	})
+	return result, err
+}
+
+// Handler returns an http.Handler serving the requests with the pipeline,
+// so the pipeline could be mounted to the HTTP server of the application.
+func (eg *Easegress) Handler(pipelineName string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := eg.serve(pipelineName, r, func(resp *httpprot.Response) {
+			header := w.Header()
+			for k, v := range resp.HTTPHeader() {
+				header[k] = v
+			}
+			w.WriteHeader(resp.StatusCode())
+			io.Copy(w, resp.GetPayload())
+		})
+		if err != nil {
+			logger.Errorf("serve %s %s with pipeline %s failed: %v", r.Method, r.URL.Path, pipelineName, err)
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// Close closes the embedded Easegress.
+func (eg *Easegress) Close() {
+	wg := &sync.WaitGroup{}
+	if eg.api != nil {
+		wg.Add(1)
+		eg.api.Close(wg)
+	}
+	wg.Add(2)
+	eg.super.Close(wg)
+	eg.cls.Close(wg)
+	if eg.profile != nil {
+		wg.Add(1)
+		eg.profile.Close(wg)
+	}
+	wg.Wait()
+	logger.Sync()
+}
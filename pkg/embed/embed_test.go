@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package embed
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const pipelineSpec = `
+name: pipeline-embed
+kind: Pipeline
+filters:
+- name: mock
+  kind: Mock
+  rules:
+  - match:
+      pathPrefix: /
+    code: 202
+    body: hello
+`
+
+func TestEmbed(t *testing.T) {
+	assert := assert.New(t)
+
+	eg, err := Start(&Options{HomeDir: t.TempDir()})
+	assert.NoError(err)
+	defer eg.Close()
+
+	assert.Error(eg.Apply("name: invalid\nkind: Pipeline\nflow: 1"))
+	assert.NoError(eg.Apply(pipelineSpec))
+
+	spec, ok := eg.Get("pipeline-embed")
+	assert.True(ok)
+	assert.Equal("Pipeline", spec.Kind())
+
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/demo", nil)
+	resp, err := eg.HandleHTTP("pipeline-embed", req)
+	assert.NoError(err)
+	assert.Equal(202, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal("hello", string(body))
+
+	_, err = eg.HandleHTTP("not-exist", req)
+	assert.Error(err)
+
+	w := httptest.NewRecorder()
+	eg.Handler("pipeline-embed").ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/demo", nil))
+	assert.Equal(202, w.Code)
+	assert.Equal("hello", w.Body.String())
+
+	assert.NoError(eg.Delete("pipeline-embed"))
+	_, ok = eg.Get("pipeline-embed")
+	assert.False(ok)
+}
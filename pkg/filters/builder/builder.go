@@ -35,6 +35,7 @@ type (
 	// Builder is the base HTTP builder.
 	Builder struct {
 		template *template.Template
+		codec    *protobufCodec
 	}
 
 	// Spec is the spec of Builder.
@@ -43,6 +44,8 @@ type (
 		RightDelim      string `json:"rightDelim" jsonschema:"omitempty"`
 		SourceNamespace string `json:"sourceNamespace" jsonschema:"omitempty"`
 		Template        string `json:"template" jsonschema:"omitempty"`
+
+		Protobuf *ProtobufSpec `json:"protobuf,omitempty" jsonschema:"omitempty"`
 	}
 )
 
@@ -64,9 +67,19 @@ func (b *Builder) reload(spec *Spec) {
 		return
 	}
 
+	// the codec has been validated, so no error here, and the functions
+	// of a nil codec report errors when called.
+	if spec.Protobuf != nil {
+		b.codec, _ = newProtobufCodec(spec.Protobuf)
+	}
+
+	b.template = template.Must(b.newTemplate(spec).Parse(spec.Template))
+}
+
+// newTemplate creates a template with the delimiters and the functions.
+func (b *Builder) newTemplate(spec *Spec) *template.Template {
 	t := template.New("").Delims(spec.LeftDelim, spec.RightDelim)
-	t.Funcs(sprig.TxtFuncMap()).Funcs(extraFuncs)
-	b.template = template.Must(t.Parse(spec.Template))
+	return t.Funcs(sprig.TxtFuncMap()).Funcs(extraFuncs).Funcs(b.codec.funcs())
 }
 
 func (b *Builder) build(data map[string]interface{}, v interface{}) error {
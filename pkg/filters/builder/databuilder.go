@@ -0,0 +1,297 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package builder
+
+import (
+	"bytes"
+	stdcontext "context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// DataBuilderKind is the kind of DataBuilder.
+	DataBuilderKind = "DataBuilder"
+
+	defaultCallTimeout = 5 * time.Second
+
+	// the max size of the response body of a call.
+	maxCallBodySize = 4 * 1024 * 1024
+)
+
+var dataBuilderKind = &filters.Kind{
+	Name:        DataBuilderKind,
+	Description: "DataBuilder builds data, optionally from the responses of HTTP calls",
+	Results:     []string{resultBuildErr},
+	DefaultSpec: func() filters.Spec {
+		return &DataBuilderSpec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &DataBuilder{spec: spec.(*DataBuilderSpec)}
+	},
+}
+
+func init() {
+	filters.Register(dataBuilderKind)
+}
+
+type (
+	// DataBuilder is filter DataBuilder.
+	DataBuilder struct {
+		spec *DataBuilderSpec
+		Builder
+
+		calls  []*call
+		client *http.Client
+	}
+
+	// DataBuilderSpec is DataBuilder Spec.
+	DataBuilderSpec struct {
+		filters.BaseSpec `json:",inline"`
+		Spec             `json:",inline"`
+		DataKey          string      `json:"dataKey" jsonschema:"required"`
+		Calls            []*CallSpec `json:"calls,omitempty" jsonschema:"omitempty"`
+	}
+
+	// CallSpec describes an HTTP call, its response can be accessed in
+	// the templates of the subsequent calls and the DataBuilder by
+	// .calls.<name>.
+	CallSpec struct {
+		Name    string            `json:"name" jsonschema:"required"`
+		Method  string            `json:"method" jsonschema:"omitempty,format=httpmethod"`
+		URL     string            `json:"url" jsonschema:"required"`
+		Headers map[string]string `json:"headers" jsonschema:"omitempty"`
+		Body    string            `json:"body" jsonschema:"omitempty"`
+		Timeout string            `json:"timeout" jsonschema:"omitempty,format=duration"`
+	}
+
+	call struct {
+		spec    *CallSpec
+		url     *template.Template
+		headers map[string]*template.Template
+		body    *template.Template
+		timeout time.Duration
+	}
+)
+
+// Validate validates the DataBuilder Spec.
+func (spec *DataBuilderSpec) Validate() error {
+	if spec.SourceNamespace != "" {
+		return fmt.Errorf("sourceNamespace is not supported by DataBuilder")
+	}
+	if err := spec.Spec.Validate(); err != nil {
+		return err
+	}
+
+	b := &Builder{}
+	names := map[string]struct{}{}
+	for _, cs := range spec.Calls {
+		if _, ok := names[cs.Name]; ok {
+			return fmt.Errorf("duplicated call name: %s", cs.Name)
+		}
+		names[cs.Name] = struct{}{}
+		if _, err := b.newCall(&spec.Spec, cs); err != nil {
+			return fmt.Errorf("call %s: %v", cs.Name, err)
+		}
+	}
+
+	_, err := b.newTemplate(&spec.Spec).Parse(spec.Template)
+	return err
+}
+
+// Name returns the name of the DataBuilder filter instance.
+func (db *DataBuilder) Name() string {
+	return db.spec.Name()
+}
+
+// Kind returns the kind of DataBuilder.
+func (db *DataBuilder) Kind() *filters.Kind {
+	return dataBuilderKind
+}
+
+// Spec returns the spec used by the DataBuilder
+func (db *DataBuilder) Spec() filters.Spec {
+	return db.spec
+}
+
+// Init initializes DataBuilder.
+func (db *DataBuilder) Init() {
+	db.reload()
+}
+
+// Inherit inherits previous generation of DataBuilder.
+func (db *DataBuilder) Inherit(previousGeneration filters.Filter) {
+	db.Init()
+}
+
+func (db *DataBuilder) reload() {
+	db.Builder.reload(&db.spec.Spec)
+	db.client = &http.Client{}
+
+	db.calls = nil
+	for _, cs := range db.spec.Calls {
+		// the calls have been validated, so no error here.
+		c, _ := db.newCall(&db.spec.Spec, cs)
+		db.calls = append(db.calls, c)
+	}
+}
+
+func (b *Builder) newCall(spec *Spec, cs *CallSpec) (*call, error) {
+	c := &call{spec: cs, headers: map[string]*template.Template{}, timeout: defaultCallTimeout}
+
+	var err error
+	if c.url, err = b.newTemplate(spec).Parse(cs.URL); err != nil {
+		return nil, fmt.Errorf("invalid url template: %v", err)
+	}
+	if c.body, err = b.newTemplate(spec).Parse(cs.Body); err != nil {
+		return nil, fmt.Errorf("invalid body template: %v", err)
+	}
+	for k, v := range cs.Headers {
+		t, err := b.newTemplate(spec).Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template of header %s: %v", k, err)
+		}
+		c.headers[k] = t
+	}
+
+	if cs.Timeout != "" {
+		c.timeout, _ = time.ParseDuration(cs.Timeout)
+	}
+	return c, nil
+}
+
+func executeTemplate(t *template.Template, data map[string]interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// do sends the request of the call and returns the response.
+func (c *call) do(stdctx stdcontext.Context, client *http.Client, data map[string]interface{}) (*httpprot.Response, error) {
+	url, err := executeTemplate(c.url, data)
+	if err != nil {
+		return nil, err
+	}
+	body, err := executeTemplate(c.body, data)
+	if err != nil {
+		return nil, err
+	}
+
+	method := http.MethodGet
+	if c.spec.Method != "" {
+		method = strings.ToUpper(c.spec.Method)
+	}
+
+	stdctx, cancel := stdcontext.WithTimeout(stdctx, c.timeout)
+	defer cancel()
+
+	stdr, err := http.NewRequestWithContext(stdctx, method, strings.TrimSpace(url), strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, t := range c.headers {
+		v, err := executeTemplate(t, data)
+		if err != nil {
+			return nil, err
+		}
+		stdr.Header.Set(k, v)
+	}
+
+	stdResp, err := client.Do(stdr)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpprot.NewResponse(stdResp)
+	if err != nil {
+		stdResp.Body.Close()
+		return nil, err
+	}
+	// the body is read before the context is canceled.
+	err = resp.FetchPayload(maxCallBodySize)
+	stdResp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Handle builds data.
+func (db *DataBuilder) Handle(ctx *context.Context) (result string) {
+	defer func() {
+		if err := recover(); err != nil {
+			msgFmt := "panic: %s, stacktrace: %s\n"
+			logger.Errorf(msgFmt, err, string(debug.Stack()))
+			result = resultBuildErr
+		}
+	}()
+
+	data, err := prepareBuilderData(ctx)
+	if err != nil {
+		logger.Warnf("prepareBuilderData failed: %v", err)
+		return resultBuildErr
+	}
+
+	if len(db.calls) > 0 {
+		stdctx := stdcontext.Background()
+		if req, ok := ctx.GetInputRequest().(*httpprot.Request); ok {
+			stdctx = req.Context()
+		}
+
+		calls := map[string]interface{}{}
+		data["calls"] = calls
+		for _, c := range db.calls {
+			resp, err := c.do(stdctx, db.client, data)
+			if err != nil {
+				msgFmt := "DataBuilder(%s): call %s failed: %v"
+				logger.Warnf(msgFmt, db.Name(), c.spec.Name, err)
+				return resultBuildErr
+			}
+			calls[c.spec.Name] = resp.ToBuilderResponse(c.spec.Name)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = db.template.Execute(&buf, data); err != nil {
+		msgFmt := "DataBuilder(%s): failed to execute template: %v"
+		logger.Warnf(msgFmt, db.Name(), err)
+		return resultBuildErr
+	}
+
+	var v interface{}
+	if err = codectool.Unmarshal(buf.Bytes(), &v); err != nil {
+		msgFmt := "DataBuilder(%s): failed to unmarshal data: %v"
+		logger.Warnf(msgFmt, db.Name(), err)
+		return resultBuildErr
+	}
+
+	ctx.SetData(db.spec.DataKey, v)
+	return ""
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package builder
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func getDataBuilder(t *testing.T, yamlConfig string) *DataBuilder {
+	spec := &DataBuilderSpec{}
+	codectool.MustUnmarshal([]byte(yamlConfig), spec)
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("invalid spec: %v", err)
+	}
+	db := &DataBuilder{spec: spec}
+	db.Init()
+	return db
+}
+
+func TestDataBuilder(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users/1":
+			assert.Equal("token", r.Header.Get("X-Token"))
+			w.Write([]byte(`{"name": "alice", "group": 10}`))
+		case "/groups/10":
+			w.Write([]byte(`{"name": "admin"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	db := getDataBuilder(t, `
+dataKey: profile
+calls:
+- name: user
+  url: '`+server.URL+`/users/{{.requests.DEFAULT.Header.Get "X-User"}}'
+  headers:
+    X-Token: token
+- name: group
+  url: '`+server.URL+`/groups/{{.calls.user.JSONBody.group}}'
+  timeout: 1s
+template: |
+  user: {{.calls.user.JSONBody.name}}
+  group: {{.calls.group.JSONBody.name}}
+  status: {{.calls.group.StatusCode}}
+`)
+	defer db.Close()
+
+	ctx := context.New(nil)
+	req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/profile", nil)
+	req.Header.Set("X-User", "1")
+	setRequest(t, ctx, context.DefaultNamespace, req)
+
+	assert.Empty(db.Handle(ctx))
+	profile := ctx.GetData("profile").(map[string]interface{})
+	assert.Equal("alice", profile["user"])
+	assert.Equal("admin", profile["group"])
+	assert.Equal(float64(200), profile["status"])
+
+	// a failed call.
+	db = getDataBuilder(t, `
+dataKey: profile
+calls:
+- name: user
+  url: http://127.0.0.1:1/users
+  timeout: 100ms
+template: |
+  user: {{.calls.user.JSONBody.name}}
+`)
+	assert.Equal(resultBuildErr, db.Handle(ctx))
+}
+
+func TestDataBuilderValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &DataBuilderSpec{}
+	codectool.MustUnmarshal([]byte(`
+dataKey: data
+calls:
+- name: a
+  url: http://127.0.0.1/
+- name: a
+  url: http://127.0.0.1/
+template: 'a: 1'
+`), spec)
+	assert.Error(spec.Validate())
+
+	spec = &DataBuilderSpec{}
+	codectool.MustUnmarshal([]byte(`
+dataKey: data
+calls:
+- name: a
+  url: http://127.0.0.1/{{
+template: 'a: 1'
+`), spec)
+	assert.Error(spec.Validate())
+
+	spec = &DataBuilderSpec{}
+	codectool.MustUnmarshal([]byte(`
+dataKey: data
+sourceNamespace: DEFAULT
+`), spec)
+	assert.Error(spec.Validate())
+}
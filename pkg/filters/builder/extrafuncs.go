@@ -18,12 +18,23 @@
 package builder
 
 import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"hash"
+	"net/url"
 	"strconv"
 	"strings"
 	"text/template"
 
+	"github.com/google/uuid"
+
 	"github.com/megaease/easegress/pkg/logger"
 )
 
@@ -90,6 +101,26 @@ func mergeObject(objs ...map[string]interface{}) interface{} {
 	return out
 }
 
+func hashFunc(algorithm string) func() hash.Hash {
+	switch strings.ToLower(algorithm) {
+	case "md5":
+		return md5.New
+	case "sha1":
+		return sha1.New
+	case "sha256":
+		return sha256.New
+	case "sha512":
+		return sha512.New
+	}
+	panic(fmt.Errorf("unknown hash algorithm: %s", algorithm))
+}
+
+func hmacSum(algorithm, key, msg string) []byte {
+	mac := hmac.New(hashFunc(algorithm), []byte(key))
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
+
 var extraFuncs = template.FuncMap{
 	"addf": func(a, b interface{}) float64 {
 		x, y := toFloat64(a), toFloat64(b)
@@ -130,6 +161,44 @@ var extraFuncs = template.FuncMap{
 
 	"mergeObject": mergeObject,
 
+	"hmac": func(algorithm, key, msg string) string {
+		return hex.EncodeToString(hmacSum(algorithm, key, msg))
+	},
+
+	"hmacBase64": func(algorithm, key, msg string) string {
+		return base64.StdEncoding.EncodeToString(hmacSum(algorithm, key, msg))
+	},
+
+	"md5sum": func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	},
+
+	"sha512sum": func(s string) string {
+		sum := sha512.Sum512([]byte(s))
+		return hex.EncodeToString(sum[:])
+	},
+
+	"b64urlenc": func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	},
+
+	"b64urldec": func(s string) string {
+		b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+		if err != nil {
+			panic(err)
+		}
+		return string(b)
+	},
+
+	"urlQueryEscape": url.QueryEscape,
+
+	"urlPathEscape": url.PathEscape,
+
+	"uuidv4": func() string {
+		return uuid.NewString()
+	},
+
 	"jsonEscape": func(s string) string {
 		b, err := json.Marshal(s)
 		if err != nil {
@@ -58,6 +58,23 @@ func TestExtraFuncs(t *testing.T) {
 	assert.Equal("", extraFuncs["log"].(func(level, msg string) string)("error", "error"))
 
 	assert.Equal(`abcd\"ABCD`, extraFuncs["jsonEscape"].(func(s string) string)(`abcd"ABCD`))
+
+	hmacFn := extraFuncs["hmac"].(func(algorithm, key, msg string) string)
+	assert.Equal("f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8",
+		hmacFn("sha256", "key", "The quick brown fox jumps over the lazy dog"))
+	assert.Panics(func() { hmacFn("unknown", "key", "msg") })
+	assert.Equal("97yD9DBThCSxMpjmqm+xQ+9NWaFJRhdZl0edvC0aPNg=",
+		extraFuncs["hmacBase64"].(func(algorithm, key, msg string) string)("sha256", "key", "The quick brown fox jumps over the lazy dog"))
+
+	assert.Equal("900150983cd24fb0d6963f7d28e17f72", extraFuncs["md5sum"].(func(s string) string)("abc"))
+	assert.Equal(128, len(extraFuncs["sha512sum"].(func(s string) string)("abc")))
+
+	assert.Equal("Pz8-", extraFuncs["b64urlenc"].(func(s string) string)("??>"))
+	assert.Equal("??>", extraFuncs["b64urldec"].(func(s string) string)("Pz8-"))
+	assert.Panics(func() { extraFuncs["b64urldec"].(func(s string) string)("!!") })
+
+	assert.Equal("a+b%26c", extraFuncs["urlQueryEscape"].(func(s string) string)("a b&c"))
+	assert.Equal(36, len(extraFuncs["uuidv4"].(func() string)()))
 }
 
 func TestMergeObject(t *testing.T) {
@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package builder
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+type (
+	// ProtobufSpec is the spec of the protobuf codec.
+	ProtobufSpec struct {
+		// Descriptors is the base64 encoded FileDescriptorSet, which could
+		// be generated by: protoc --include_imports --descriptor_set_out=FILE
+		Descriptors string `json:"descriptors" jsonschema:"required,format=base64"`
+	}
+
+	// protobufCodec converts protobuf messages from/to JSON objects.
+	protobufCodec struct {
+		files *protoregistry.Files
+	}
+)
+
+// Validate validates the ProtobufSpec.
+func (spec *ProtobufSpec) Validate() error {
+	_, err := newProtobufCodec(spec)
+	return err
+}
+
+func newProtobufCodec(spec *ProtobufSpec) (*protobufCodec, error) {
+	data, err := base64.StdEncoding.DecodeString(spec.Descriptors)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptors: %v", err)
+	}
+
+	fds := &descriptorpb.FileDescriptorSet{}
+	if err = proto.Unmarshal(data, fds); err != nil {
+		return nil, fmt.Errorf("invalid descriptors: %v", err)
+	}
+
+	files, err := protodesc.NewFiles(fds)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptors: %v", err)
+	}
+
+	return &protobufCodec{files: files}, nil
+}
+
+func (c *protobufCodec) newMessage(name string) (*dynamicpb.Message, error) {
+	if c == nil {
+		return nil, fmt.Errorf("protobuf descriptors are not configured")
+	}
+
+	d, err := c.files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("message %s not found: %v", name, err)
+	}
+
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message", name)
+	}
+	return dynamicpb.NewMessage(md), nil
+}
+
+// decode decodes data, which is a string or a byte slice, as a message
+// of the given name, and returns it as a JSON object.
+func (c *protobufCodec) decode(name string, data interface{}) map[string]interface{} {
+	msg, err := c.newMessage(name)
+	if err != nil {
+		panic(err)
+	}
+
+	var b []byte
+	switch v := data.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		panic(fmt.Errorf("cannot decode %T as protobuf message", data))
+	}
+
+	if err = proto.Unmarshal(b, msg); err != nil {
+		panic(err)
+	}
+
+	j, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+
+	result := map[string]interface{}{}
+	if err = json.Unmarshal(j, &result); err != nil {
+		panic(err)
+	}
+	return result
+}
+
+// encode encodes obj, which is a JSON string or an object, as a message
+// of the given name, and returns the base64 encoded result.
+func (c *protobufCodec) encode(name string, obj interface{}) string {
+	msg, err := c.newMessage(name)
+	if err != nil {
+		panic(err)
+	}
+
+	var j []byte
+	if s, ok := obj.(string); ok {
+		j = []byte(s)
+	} else if j, err = json.Marshal(obj); err != nil {
+		panic(err)
+	}
+
+	if err = protojson.Unmarshal(j, msg); err != nil {
+		panic(err)
+	}
+
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// funcs returns the template functions of the codec.
+func (c *protobufCodec) funcs() template.FuncMap {
+	return template.FuncMap{
+		"protoDecode": c.decode,
+		"protoEncode": c.encode,
+	}
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package builder
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// testDescriptors returns the descriptors of:
+//
+//	syntax = "proto3";
+//	package test;
+//	message Pet { string name = 1; int32 age = 2; }
+func testDescriptors() string {
+	fds := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{{
+			Name:    proto.String("pet.proto"),
+			Package: proto.String("test"),
+			Syntax:  proto.String("proto3"),
+			MessageType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("Pet"),
+				Field: []*descriptorpb.FieldDescriptorProto{{
+					Name:     proto.String("name"),
+					JsonName: proto.String("name"),
+					Number:   proto.Int32(1),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				}, {
+					Name:     proto.String("age"),
+					JsonName: proto.String("age"),
+					Number:   proto.Int32(2),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(),
+				}},
+			}},
+		}},
+	}
+	data, _ := proto.Marshal(fds)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func TestProtobufCodec(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error((&ProtobufSpec{Descriptors: "not base64"}).Validate())
+
+	codec, err := newProtobufCodec(&ProtobufSpec{Descriptors: testDescriptors()})
+	assert.NoError(err)
+
+	encoded := codec.encode("test.Pet", map[string]interface{}{"name": "kitty", "age": 3})
+	data, _ := base64.StdEncoding.DecodeString(encoded)
+	pet := codec.decode("test.Pet", data)
+	assert.Equal("kitty", pet["name"])
+	assert.Equal(float64(3), pet["age"])
+
+	assert.Panics(func() { codec.encode("test.Unknown", "{}") })
+	assert.Panics(func() { (*protobufCodec)(nil).decode("test.Pet", data) })
+}
+
+func TestResponseBuilderProtobuf(t *testing.T) {
+	assert := assert.New(t)
+
+	// convert a JSON response to a protobuf one.
+	yamlConfig := `template: |
+  headers:
+    Content-Type: [application/x-protobuf]
+  body: {{protoEncode "test.Pet" .responses.DEFAULT.JSONBody}}
+  bodyEncoding: base64
+protobuf:
+  descriptors: ` + testDescriptors()
+
+	spec := &ResponseBuilderSpec{}
+	codectool.MustUnmarshal([]byte(yamlConfig), spec)
+	rb := getResponseBuilder(spec)
+	defer rb.Close()
+
+	ctx := context.New(nil)
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetPayload([]byte(`{"name": "kitty", "age": 3}`))
+	ctx.SetOutputResponse(resp)
+
+	assert.Empty(rb.Handle(ctx))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	pet := rb.Builder.codec.decode("test.Pet", resp.RawPayload())
+	assert.Equal("kitty", pet["name"])
+}
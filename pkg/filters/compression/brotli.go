@@ -0,0 +1,46 @@
+//go:build brotli
+// +build brotli
+
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compression
+
+import (
+	"io"
+
+	"github.com/andybalholm/brotli"
+)
+
+// encodingBrotli is only supported when built with the brotli tag, as it
+// brings an extra dependency.
+const encodingBrotli = "br"
+
+func init() {
+	codecs[encodingBrotli] = &codec{
+		maxLevel: brotli.BestCompression,
+		newEncoder: func(level int, w io.Writer) io.WriteCloser {
+			if level == 0 {
+				level = brotli.DefaultCompression
+			}
+			return brotli.NewWriterLevel(w, level)
+		},
+		newDecoder: func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(brotli.NewReader(r)), nil
+		},
+	}
+}
@@ -0,0 +1,38 @@
+//go:build brotli
+// +build brotli
+
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compression
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBrotli(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Contains(supportedEncodings(), encodingBrotli)
+	assert.NoError(validateEncoding(encodingBrotli, 11))
+	assert.Error(validateEncoding(encodingBrotli, 12))
+
+	candidates := []string{encodingBrotli, encodingGzip}
+	assert.Equal(encodingBrotli, negotiateEncoding([]string{"gzip, br"}, candidates))
+}
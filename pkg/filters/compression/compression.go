@@ -0,0 +1,191 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package compression implements the ResponseCompressor and
+// RequestDecompressor filters.
+package compression
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+	encodingZstd    = "zstd"
+
+	keyAcceptEncoding  = "Accept-Encoding"
+	keyContentEncoding = "Content-Encoding"
+	keyContentLength   = "Content-Length"
+	keyContentType     = "Content-Type"
+	keyVary            = "Vary"
+)
+
+// codec is a supported encoding, more encodings could be registered by
+// the files with build tags, e.g. brotli.
+type codec struct {
+	// maxLevel is the max compression level of the encoding.
+	maxLevel int
+	// newEncoder creates an encoder which writes the compressed data to w,
+	// level 0 means the default level of the encoding.
+	newEncoder func(level int, w io.Writer) io.WriteCloser
+	// newDecoder creates a decoder which reads the compressed data from r.
+	newDecoder func(r io.Reader) (io.ReadCloser, error)
+}
+
+var codecs = map[string]*codec{
+	encodingGzip: {
+		maxLevel: gzip.BestCompression,
+		newEncoder: func(level int, w io.Writer) io.WriteCloser {
+			if level == 0 {
+				level = gzip.DefaultCompression
+			}
+			gw, _ := gzip.NewWriterLevel(w, level)
+			return gw
+		},
+		newDecoder: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	},
+	encodingDeflate: {
+		maxLevel: zlib.BestCompression,
+		newEncoder: func(level int, w io.Writer) io.WriteCloser {
+			if level == 0 {
+				level = zlib.DefaultCompression
+			}
+			zw, _ := zlib.NewWriterLevel(w, level)
+			return zw
+		},
+		newDecoder: func(r io.Reader) (io.ReadCloser, error) {
+			return zlib.NewReader(r)
+		},
+	},
+	encodingZstd: {
+		maxLevel: 22,
+		newEncoder: func(level int, w io.Writer) io.WriteCloser {
+			opts := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+			if level > 0 {
+				opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+			}
+			zw, _ := zstd.NewWriter(w, opts...)
+			return zw
+		},
+		newDecoder: func(r io.Reader) (io.ReadCloser, error) {
+			zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			return zr.IOReadCloser(), nil
+		},
+	},
+}
+
+// supportedEncodings returns the sorted names of the supported encodings.
+func supportedEncodings() []string {
+	encodings := make([]string, 0, len(codecs))
+	for e := range codecs {
+		encodings = append(encodings, e)
+	}
+	sort.Strings(encodings)
+	return encodings
+}
+
+func validateEncoding(encoding string, level int) error {
+	c, ok := codecs[encoding]
+	if !ok {
+		return fmt.Errorf("unsupported encoding %q, supported ones are %s",
+			encoding, strings.Join(supportedEncodings(), ", "))
+	}
+	if level < 0 || level > c.maxLevel {
+		return fmt.Errorf("level of %s must be in [0, %d]", encoding, c.maxLevel)
+	}
+	return nil
+}
+
+// newEncoder creates an encoder which writes the compressed data to w,
+// level 0 means the default level of the encoding.
+func newEncoder(encoding string, level int, w io.Writer) io.WriteCloser {
+	c, ok := codecs[encoding]
+	if !ok {
+		panic(fmt.Errorf("BUG: unsupported encoding %s", encoding))
+	}
+	return c.newEncoder(level, w)
+}
+
+// newDecoder creates a decoder which reads the compressed data from r.
+func newDecoder(encoding string, r io.Reader) (io.ReadCloser, error) {
+	c, ok := codecs[encoding]
+	if !ok {
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+	return c.newDecoder(r)
+}
+
+// negotiateEncoding selects an encoding from candidates according to the
+// Accept-Encoding header values, it returns an empty string if none is
+// acceptable. Candidates with the same quality value are preferred in
+// their order.
+func negotiateEncoding(acceptEncodings []string, candidates []string) string {
+	// Reference: https://datatracker.ietf.org/doc/html/rfc7231#section-5.3.4
+	qvalues := map[string]float64{}
+	for _, value := range acceptEncodings {
+		for _, item := range strings.Split(value, ",") {
+			name, q := parseQValue(item)
+			if name != "" {
+				qvalues[name] = q
+			}
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, c := range candidates {
+		q, ok := qvalues[c]
+		if !ok {
+			q = qvalues["*"]
+		}
+		if q > bestQ {
+			best, bestQ = c, q
+		}
+	}
+	return best
+}
+
+func parseQValue(item string) (string, float64) {
+	parts := strings.Split(item, ";")
+	name := strings.ToLower(strings.TrimSpace(parts[0]))
+	q := 1.0
+	for _, p := range parts[1:] {
+		p = strings.TrimSpace(p)
+		if !strings.HasPrefix(p, "q=") {
+			continue
+		}
+		v, err := strconv.ParseFloat(p[2:], 64)
+		if err != nil {
+			return "", 0
+		}
+		q = v
+	}
+	return name, q
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package compression
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	assert := assert.New(t)
+
+	candidates := []string{"zstd", "gzip"}
+	assert.Equal("zstd", negotiateEncoding([]string{"gzip, zstd"}, candidates))
+	assert.Equal("gzip", negotiateEncoding([]string{"gzip;q=1.0, zstd;q=0.5"}, candidates))
+	assert.Equal("gzip", negotiateEncoding([]string{"gzip", "zstd;q=0"}, candidates))
+	assert.Equal("zstd", negotiateEncoding([]string{"*"}, candidates))
+	assert.Equal("", negotiateEncoding([]string{"br"}, candidates))
+	assert.Equal("", negotiateEncoding(nil, candidates))
+}
+
+func TestEncoderDecoder(t *testing.T) {
+	assert := assert.New(t)
+
+	data := bytes.Repeat([]byte("easegress compression "), 100)
+	for _, encoding := range supportedEncodings() {
+		buf := bytes.NewBuffer(nil)
+		w := newEncoder(encoding, codecs[encoding].maxLevel, buf)
+		w.Write(data)
+		assert.NoError(w.Close())
+		assert.Less(buf.Len(), len(data))
+
+		r, err := newDecoder(encoding, buf)
+		assert.NoError(err)
+		decoded, err := io.ReadAll(r)
+		assert.NoError(err)
+		assert.Equal(data, decoded)
+		r.Close()
+	}
+
+	assert.Error(validateEncoding("compress", 0))
+	assert.Error(validateEncoding("gzip", 10))
+	assert.NoError(validateEncoding("zstd", 19))
+}
@@ -0,0 +1,244 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compression
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/readers"
+)
+
+const (
+	// ResponseCompressorKind is the kind of ResponseCompressor.
+	ResponseCompressorKind = "ResponseCompressor"
+)
+
+var responseCompressorKind = &filters.Kind{
+	Name:        ResponseCompressorKind,
+	Description: "ResponseCompressor compresses the response body",
+	Results:     []string{},
+	DefaultSpec: func() filters.Spec {
+		return &ResponseCompressorSpec{
+			Encodings: []*EncodingSpec{
+				{Name: encodingZstd},
+				{Name: encodingGzip},
+			},
+			MinLength: 1024,
+			ContentTypes: []string{
+				"text/",
+				"application/json",
+				"application/javascript",
+				"application/xml",
+				"image/svg+xml",
+			},
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &ResponseCompressor{spec: spec.(*ResponseCompressorSpec)}
+	},
+}
+
+func init() {
+	filters.Register(responseCompressorKind)
+}
+
+type (
+	// ResponseCompressor is filter ResponseCompressor.
+	ResponseCompressor struct {
+		spec      *ResponseCompressorSpec
+		encodings []string
+		levels    map[string]int
+	}
+
+	// ResponseCompressorSpec is ResponseCompressor Spec.
+	ResponseCompressorSpec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Encodings    []*EncodingSpec `json:"encodings" jsonschema:"omitempty"`
+		MinLength    int64           `json:"minLength" jsonschema:"omitempty,minimum=0"`
+		ContentTypes []string        `json:"contentTypes" jsonschema:"omitempty,uniqueItems=true"`
+	}
+
+	// EncodingSpec describes an encoding and its compression level.
+	EncodingSpec struct {
+		Name  string `json:"name" jsonschema:"required"`
+		Level int    `json:"level" jsonschema:"omitempty"`
+	}
+)
+
+// Validate validates the ResponseCompressor Spec.
+func (spec *ResponseCompressorSpec) Validate() error {
+	if len(spec.Encodings) == 0 {
+		return fmt.Errorf("encodings must not be empty")
+	}
+	for _, e := range spec.Encodings {
+		if err := validateEncoding(e.Name, e.Level); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the ResponseCompressor filter instance.
+func (rc *ResponseCompressor) Name() string {
+	return rc.spec.Name()
+}
+
+// Kind returns the kind of ResponseCompressor.
+func (rc *ResponseCompressor) Kind() *filters.Kind {
+	return responseCompressorKind
+}
+
+// Spec returns the spec used by the ResponseCompressor
+func (rc *ResponseCompressor) Spec() filters.Spec {
+	return rc.spec
+}
+
+// Init initializes ResponseCompressor.
+func (rc *ResponseCompressor) Init() {
+	rc.reload()
+}
+
+// Inherit inherits previous generation of ResponseCompressor.
+func (rc *ResponseCompressor) Inherit(previousGeneration filters.Filter) {
+	rc.Init()
+}
+
+func (rc *ResponseCompressor) reload() {
+	rc.encodings = nil
+	rc.levels = map[string]int{}
+	for _, e := range rc.spec.Encodings {
+		rc.encodings = append(rc.encodings, e.Name)
+		rc.levels[e.Name] = e.Level
+	}
+}
+
+// Handle compresses the response body if the client accepts it.
+func (rc *ResponseCompressor) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil || !rc.shouldCompress(req, resp) {
+		return ""
+	}
+
+	encoding := negotiateEncoding(req.HTTPHeader().Values(keyAcceptEncoding), rc.encodings)
+	if encoding == "" {
+		return ""
+	}
+	level := rc.levels[encoding]
+
+	if resp.IsStream() {
+		newWriter := func(w io.Writer) io.WriteCloser {
+			return newEncoder(encoding, level, w)
+		}
+		resp.SetPayload(readers.NewCompressReader(resp.GetPayload(), newWriter))
+	} else {
+		buf := bytes.NewBuffer(nil)
+		w := newEncoder(encoding, level, buf)
+		w.Write(resp.RawPayload())
+		w.Close()
+		resp.SetPayload(buf.Bytes())
+	}
+
+	header := resp.HTTPHeader()
+	header.Del(keyContentLength)
+	resp.Std().ContentLength = -1
+	header.Set(keyContentEncoding, encoding)
+	header.Add(keyVary, keyAcceptEncoding)
+
+	// the compressed body is not byte-for-byte identical to the original,
+	// so a strong ETag must be weakened.
+	// Reference: https://datatracker.ietf.org/doc/html/rfc7232#section-2.1
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+
+	return ""
+}
+
+func (rc *ResponseCompressor) shouldCompress(req *httpprot.Request, resp *httpprot.Response) bool {
+	if req.Method() == http.MethodHead {
+		return false
+	}
+
+	switch resp.StatusCode() {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+
+	header := resp.HTTPHeader()
+	if header.Get(keyContentEncoding) != "" {
+		return false
+	}
+	for _, cc := range header.Values("Cache-Control") {
+		if strings.Contains(cc, "no-transform") {
+			return false
+		}
+	}
+
+	if !rc.matchContentType(header.Get(keyContentType)) {
+		return false
+	}
+
+	if !resp.IsStream() {
+		return int64(len(resp.RawPayload())) >= rc.spec.MinLength
+	}
+
+	// the length of a stream is unknown if there's no Content-Length.
+	if cl := header.Get(keyContentLength); cl != "" {
+		if n, err := strconv.ParseInt(cl, 10, 64); err == nil && n < rc.spec.MinLength {
+			return false
+		}
+	}
+	return true
+}
+
+func (rc *ResponseCompressor) matchContentType(contentType string) bool {
+	if len(rc.spec.ContentTypes) == 0 {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, ct := range rc.spec.ContentTypes {
+		if strings.HasPrefix(mediaType, ct) {
+			return true
+		}
+	}
+	return false
+}
+
+// Status returns status.
+func (rc *ResponseCompressor) Status() interface{} {
+	return nil
+}
+
+// Close closes ResponseCompressor.
+func (rc *ResponseCompressor) Close() {
+}
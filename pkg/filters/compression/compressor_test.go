@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package compression
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFilter(t *testing.T, yamlConfig string) filters.Filter {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	f := filters.GetKind(spec.Kind()).CreateInstance(spec)
+	f.Init()
+	return f
+}
+
+func TestResponseCompressor(t *testing.T) {
+	assert := assert.New(t)
+
+	f := newFilter(t, `
+kind: ResponseCompressor
+name: compressor
+minLength: 10
+`)
+
+	body := strings.Repeat("hello world ", 100)
+	newContext := func(acceptEncoding, contentType, body string, stream bool) *context.Context {
+		ctx := context.New(nil)
+		stdr, _ := http.NewRequest(http.MethodGet, "http://megaease.com/abc", nil)
+		stdr.Header.Set("Accept-Encoding", acceptEncoding)
+		req, _ := httpprot.NewRequest(stdr)
+		ctx.SetInputRequest(req)
+
+		resp, _ := httpprot.NewResponse(nil)
+		resp.HTTPHeader().Set("Content-Type", contentType)
+		resp.HTTPHeader().Set("ETag", `"v1"`)
+		if stream {
+			resp.SetPayload(strings.NewReader(body))
+		} else {
+			resp.SetPayload(body)
+		}
+		ctx.SetOutputResponse(resp)
+		return ctx
+	}
+
+	decode := func(resp *httpprot.Response) string {
+		r, err := newDecoder(resp.HTTPHeader().Get("Content-Encoding"), resp.GetPayload())
+		assert.NoError(err)
+		data, err := io.ReadAll(r)
+		assert.NoError(err)
+		return string(data)
+	}
+
+	ctx := newContext("gzip, zstd", "application/json; charset=utf-8", body, false)
+	assert.Equal("", f.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("zstd", resp.HTTPHeader().Get("Content-Encoding"))
+	assert.Equal("Accept-Encoding", resp.HTTPHeader().Get("Vary"))
+	assert.Equal(`W/"v1"`, resp.HTTPHeader().Get("ETag"))
+	assert.Equal(body, decode(resp))
+
+	ctx = newContext("gzip", "text/html", body, true)
+	f.Handle(ctx)
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("gzip", resp.HTTPHeader().Get("Content-Encoding"))
+	assert.Equal(body, decode(resp))
+
+	// content type not allowed.
+	ctx = newContext("gzip", "image/png", body, false)
+	f.Handle(ctx)
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("", resp.HTTPHeader().Get("Content-Encoding"))
+
+	// too short.
+	ctx = newContext("gzip", "text/plain", "hello", false)
+	f.Handle(ctx)
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("", resp.HTTPHeader().Get("Content-Encoding"))
+	assert.True(bytes.Equal([]byte("hello"), resp.RawPayload()))
+
+	// client does not accept any of the encodings.
+	ctx = newContext("br", "text/plain", body, false)
+	f.Handle(ctx)
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("", resp.HTTPHeader().Get("Content-Encoding"))
+}
@@ -0,0 +1,187 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compression
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// RequestDecompressorKind is the kind of RequestDecompressor.
+	RequestDecompressorKind = "RequestDecompressor"
+
+	resultDecompressFailed = "decompressFailed"
+
+	defaultMaxDecompressedSize = 4 * 1024 * 1024
+)
+
+var requestDecompressorKind = &filters.Kind{
+	Name:        RequestDecompressorKind,
+	Description: "RequestDecompressor decompresses the request body",
+	Results:     []string{resultDecompressFailed},
+	DefaultSpec: func() filters.Spec {
+		return &RequestDecompressorSpec{
+			Encodings:           supportedEncodings(),
+			MaxDecompressedSize: defaultMaxDecompressedSize,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &RequestDecompressor{spec: spec.(*RequestDecompressorSpec)}
+	},
+}
+
+func init() {
+	filters.Register(requestDecompressorKind)
+}
+
+type (
+	// RequestDecompressor is filter RequestDecompressor.
+	RequestDecompressor struct {
+		spec      *RequestDecompressorSpec
+		encodings map[string]bool
+	}
+
+	// RequestDecompressorSpec is RequestDecompressor Spec.
+	RequestDecompressorSpec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Encodings           []string `json:"encodings" jsonschema:"omitempty,uniqueItems=true"`
+		MaxDecompressedSize int64    `json:"maxDecompressedSize" jsonschema:"omitempty,minimum=1"`
+	}
+)
+
+// Validate validates the RequestDecompressor Spec.
+func (spec *RequestDecompressorSpec) Validate() error {
+	for _, e := range spec.Encodings {
+		if err := validateEncoding(e, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the RequestDecompressor filter instance.
+func (rd *RequestDecompressor) Name() string {
+	return rd.spec.Name()
+}
+
+// Kind returns the kind of RequestDecompressor.
+func (rd *RequestDecompressor) Kind() *filters.Kind {
+	return requestDecompressorKind
+}
+
+// Spec returns the spec used by the RequestDecompressor
+func (rd *RequestDecompressor) Spec() filters.Spec {
+	return rd.spec
+}
+
+// Init initializes RequestDecompressor.
+func (rd *RequestDecompressor) Init() {
+	rd.reload()
+}
+
+// Inherit inherits previous generation of RequestDecompressor.
+func (rd *RequestDecompressor) Inherit(previousGeneration filters.Filter) {
+	rd.Init()
+}
+
+func (rd *RequestDecompressor) reload() {
+	rd.encodings = map[string]bool{}
+	for _, e := range rd.spec.Encodings {
+		rd.encodings[e] = true
+	}
+	if rd.spec.MaxDecompressedSize <= 0 {
+		rd.spec.MaxDecompressedSize = defaultMaxDecompressedSize
+	}
+}
+
+// Handle decompresses the request body, the decompressed body is always
+// loaded into memory, so that the following filters could inspect it.
+func (rd *RequestDecompressor) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	var encodings []string
+	for _, value := range req.HTTPHeader().Values(keyContentEncoding) {
+		for _, e := range strings.Split(value, ",") {
+			e = strings.ToLower(strings.TrimSpace(e))
+			if e != "" && e != "identity" {
+				encodings = append(encodings, e)
+			}
+		}
+	}
+	if len(encodings) == 0 {
+		return ""
+	}
+
+	prepareErrorResponse := func(status int, err error) string {
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(status)
+		ctx.SetOutputResponse(resp)
+		ctx.AddTag(stringtool.Cat("request decompressor: ", err.Error()))
+		return resultDecompressFailed
+	}
+
+	for _, e := range encodings {
+		if !rd.encodings[e] {
+			return prepareErrorResponse(http.StatusUnsupportedMediaType, fmt.Errorf("unsupported encoding %q", e))
+		}
+	}
+
+	// the encodings are listed in the order they were applied.
+	r := req.GetPayload()
+	for i := len(encodings) - 1; i >= 0; i-- {
+		dr, err := newDecoder(encodings[i], r)
+		if err != nil {
+			return prepareErrorResponse(http.StatusBadRequest, err)
+		}
+		defer dr.Close()
+		r = dr
+	}
+
+	max := rd.spec.MaxDecompressedSize
+	data, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return prepareErrorResponse(http.StatusBadRequest, err)
+	}
+	if int64(len(data)) > max {
+		return prepareErrorResponse(http.StatusRequestEntityTooLarge, fmt.Errorf("decompressed body exceeds %d bytes", max))
+	}
+
+	req.SetPayload(data)
+	req.HTTPHeader().Del(keyContentEncoding)
+	req.HTTPHeader().Del(keyContentLength)
+	req.Std().ContentLength = int64(len(data))
+	return ""
+}
+
+// Status returns status.
+func (rd *RequestDecompressor) Status() interface{} {
+	return nil
+}
+
+// Close closes RequestDecompressor.
+func (rd *RequestDecompressor) Close() {
+}
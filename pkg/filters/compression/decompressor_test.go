@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package compression
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestDecompressor(t *testing.T) {
+	assert := assert.New(t)
+
+	f := newFilter(t, `
+kind: RequestDecompressor
+name: decompressor
+encodings: ["gzip", "zstd"]
+maxDecompressedSize: 2000
+`)
+
+	compress := func(encoding, data string) []byte {
+		buf := bytes.NewBuffer(nil)
+		w := newEncoder(encoding, 0, buf)
+		w.Write([]byte(data))
+		w.Close()
+		return buf.Bytes()
+	}
+
+	newContext := func(contentEncoding string, body []byte) *context.Context {
+		ctx := context.New(nil)
+		stdr, _ := http.NewRequest(http.MethodPost, "http://megaease.com/abc", bytes.NewReader(body))
+		stdr.Header.Set("Content-Encoding", contentEncoding)
+		req, _ := httpprot.NewRequest(stdr)
+		req.FetchPayload(0)
+		ctx.SetInputRequest(req)
+		return ctx
+	}
+
+	body := strings.Repeat("a", 1000)
+	ctx := newContext("gzip", compress("gzip", body))
+	assert.Equal("", f.Handle(ctx))
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal(body, string(req.RawPayload()))
+	assert.Equal("", req.HTTPHeader().Get("Content-Encoding"))
+
+	// multiple encodings.
+	ctx = newContext("zstd, gzip", compress("gzip", string(compress("zstd", body))))
+	assert.Equal("", f.Handle(ctx))
+	req = ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal(body, string(req.RawPayload()))
+
+	// not compressed.
+	ctx = newContext("", []byte(body))
+	assert.Equal("", f.Handle(ctx))
+
+	ctx = newContext("deflate", compress("deflate", body))
+	assert.Equal(resultDecompressFailed, f.Handle(ctx))
+	assert.Equal(http.StatusUnsupportedMediaType, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	ctx = newContext("gzip", []byte(body))
+	assert.Equal(resultDecompressFailed, f.Handle(ctx))
+	assert.Equal(http.StatusBadRequest, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	ctx = newContext("gzip", compress("gzip", strings.Repeat("a", 3000)))
+	assert.Equal(resultDecompressFailed, f.Handle(ctx))
+	assert.Equal(http.StatusRequestEntityTooLarge, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+}
@@ -18,8 +18,12 @@
 package corsadaptor
 
 import (
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 
 	"github.com/rs/cors"
 
@@ -56,25 +60,86 @@ type (
 	// CORSAdaptor is filter for CORS request.
 	CORSAdaptor struct {
 		spec *Spec
-		cors *cors.Cors
+
+		policies      []*policy
+		defaultPolicy *policy
 	}
 
 	// Spec describes of CORSAdaptor.
 	Spec struct {
 		filters.BaseSpec `json:",inline"`
 
-		AllowedOrigins   []string `json:"allowedOrigins" jsonschema:"omitempty"`
-		AllowedMethods   []string `json:"allowedMethods" jsonschema:"omitempty,uniqueItems=true,format=httpmethod-array"`
-		AllowedHeaders   []string `json:"allowedHeaders" jsonschema:"omitempty"`
-		AllowCredentials bool     `json:"allowCredentials" jsonschema:"omitempty"`
-		ExposedHeaders   []string `json:"exposedHeaders" jsonschema:"omitempty"`
-		MaxAge           int      `json:"maxAge" jsonschema:"omitempty"`
+		// PolicySpec is the default policy, which is used if the request
+		// matches none of the Policies.
+		PolicySpec `json:",inline"`
+		Policies   []*Policy `json:"policies" jsonschema:"omitempty"`
+
 		// If true, handle requests with 'Origin' header. https://fetch.spec.whatwg.org/#http-requests
 		// By default, only CORS-preflight requests are handled.
 		SupportCORSRequest bool `json:"supportCORSRequest" jsonschema:"omitempty"`
 	}
+
+	// PolicySpec describes a CORS policy.
+	PolicySpec struct {
+		AllowedOrigins []string `json:"allowedOrigins" jsonschema:"omitempty"`
+		// AllowedOriginRegexps are regular expressions matching the allowed
+		// origins, in addition to AllowedOrigins.
+		AllowedOriginRegexps []string `json:"allowedOriginRegexps" jsonschema:"omitempty"`
+		AllowedMethods       []string `json:"allowedMethods" jsonschema:"omitempty,uniqueItems=true,format=httpmethod-array"`
+		AllowedHeaders       []string `json:"allowedHeaders" jsonschema:"omitempty"`
+		AllowCredentials     bool     `json:"allowCredentials" jsonschema:"omitempty"`
+		ExposedHeaders       []string `json:"exposedHeaders" jsonschema:"omitempty"`
+		// MaxAge is the seconds the preflight results are cached, 0 means
+		// the header is not sent, and -1 disables caching.
+		MaxAge int `json:"maxAge" jsonschema:"omitempty,minimum=-1"`
+		// AllowPrivateNetwork allows requests from public websites to
+		// private networks. https://wicg.github.io/private-network-access/
+		AllowPrivateNetwork bool `json:"allowPrivateNetwork" jsonschema:"omitempty"`
+	}
+
+	// Policy is a CORS policy used by the requests it matches.
+	Policy struct {
+		Match      MatchSpec `json:"match" jsonschema:"required"`
+		PolicySpec `json:",inline"`
+	}
+
+	// MatchSpec describes the requests a policy is used by, all the
+	// specified conditions must be met.
+	MatchSpec struct {
+		// Hosts are the hosts of the requests, a host could start with a
+		// wildcard, e.g. *.megaease.com.
+		Hosts      []string `json:"hosts" jsonschema:"omitempty"`
+		Path       string   `json:"path,omitempty" jsonschema:"omitempty,pattern=^/"`
+		PathPrefix string   `json:"pathPrefix,omitempty" jsonschema:"omitempty,pattern=^/"`
+		PathRegexp string   `json:"pathRegexp,omitempty" jsonschema:"omitempty,format=regexp"`
+	}
+
+	policy struct {
+		spec      *PolicySpec
+		match     *MatchSpec
+		pathRE    *regexp.Regexp
+		originREs []*regexp.Regexp
+		cors      *cors.Cors
+	}
 )
 
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	specs := []*PolicySpec{&spec.PolicySpec}
+	for _, p := range spec.Policies {
+		specs = append(specs, &p.PolicySpec)
+	}
+
+	for _, ps := range specs {
+		for _, expr := range ps.AllowedOriginRegexps {
+			if _, err := regexp.Compile(expr); err != nil {
+				return fmt.Errorf("invalid origin regexp %s: %v", expr, err)
+			}
+		}
+	}
+	return nil
+}
+
 // Name returns the name of the CORSAdaptor filter instance.
 func (a *CORSAdaptor) Name() string {
 	return a.spec.Name()
@@ -101,14 +166,129 @@ func (a *CORSAdaptor) Inherit(previousGeneration filters.Filter) {
 }
 
 func (a *CORSAdaptor) reload() {
-	a.cors = cors.New(cors.Options{
-		AllowedOrigins:   a.spec.AllowedOrigins,
-		AllowedMethods:   a.spec.AllowedMethods,
-		AllowedHeaders:   a.spec.AllowedHeaders,
-		AllowCredentials: a.spec.AllowCredentials,
-		ExposedHeaders:   a.spec.ExposedHeaders,
-		MaxAge:           a.spec.MaxAge,
-	})
+	a.defaultPolicy = newPolicy(&a.spec.PolicySpec, nil)
+	a.policies = nil
+	for _, p := range a.spec.Policies {
+		a.policies = append(a.policies, newPolicy(&p.PolicySpec, &p.Match))
+	}
+}
+
+func newPolicy(spec *PolicySpec, match *MatchSpec) *policy {
+	p := &policy{spec: spec, match: match}
+
+	if match != nil && match.PathRegexp != "" {
+		p.pathRE = regexp.MustCompile(match.PathRegexp)
+	}
+	for _, expr := range spec.AllowedOriginRegexps {
+		p.originREs = append(p.originREs, regexp.MustCompile(expr))
+	}
+
+	opts := cors.Options{
+		AllowedOrigins:   spec.AllowedOrigins,
+		AllowedMethods:   spec.AllowedMethods,
+		AllowedHeaders:   spec.AllowedHeaders,
+		AllowCredentials: spec.AllowCredentials,
+		ExposedHeaders:   spec.ExposedHeaders,
+		MaxAge:           spec.MaxAge,
+	}
+
+	// Browsers reject the wildcard origin for requests with credentials,
+	// so the origin is checked by us and is reflected in this case.
+	if len(p.originREs) > 0 || (spec.AllowCredentials && p.allowAllOrigins()) {
+		opts.AllowedOrigins = nil
+		opts.AllowOriginRequestFunc = func(r *http.Request, origin string) bool {
+			return p.allowOrigin(origin)
+		}
+	}
+
+	p.cors = cors.New(opts)
+	return p
+}
+
+func (p *policy) allowAllOrigins() bool {
+	if len(p.spec.AllowedOrigins) == 0 {
+		return len(p.spec.AllowedOriginRegexps) == 0
+	}
+	for _, o := range p.spec.AllowedOrigins {
+		if o == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// allowOrigin checks the origin like rs/cors, plus the regexps. The 'null'
+// origin of sandboxed documents is never reflected with credentials by the
+// wildcard.
+func (p *policy) allowOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	if p.allowAllOrigins() {
+		return !p.spec.AllowCredentials || origin != "null"
+	}
+
+	for _, o := range p.spec.AllowedOrigins {
+		o = strings.ToLower(o)
+		if i := strings.IndexByte(o, '*'); i >= 0 {
+			prefix, suffix := o[:i], o[i+1:]
+			if len(origin) >= len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+				return true
+			}
+		} else if o == origin {
+			return true
+		}
+	}
+
+	for _, re := range p.originREs {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *policy) matches(req *httpprot.Request) bool {
+	m := p.match
+
+	if len(m.Hosts) > 0 {
+		host := strings.ToLower(req.Host())
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		matched := false
+		for _, h := range m.Hosts {
+			h = strings.ToLower(h)
+			if h == host || (strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:])) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	path := req.Path()
+	if m.Path != "" && m.Path != path {
+		return false
+	}
+	if m.PathPrefix != "" && !strings.HasPrefix(path, m.PathPrefix) {
+		return false
+	}
+	if p.pathRE != nil && !p.pathRE.MatchString(path) {
+		return false
+	}
+	return true
+}
+
+// selectPolicy returns the first policy the request matches, or the
+// default policy.
+func (a *CORSAdaptor) selectPolicy(req *httpprot.Request) *policy {
+	for _, p := range a.policies {
+		if p.matches(req) {
+			return p
+		}
+	}
+	return a.defaultPolicy
 }
 
 // Handle handles cross-origin requests.
@@ -126,8 +306,9 @@ func (a *CORSAdaptor) Handle(ctx *context.Context) string {
 		return ""
 	}
 
+	p := a.selectPolicy(req)
 	rw := httptest.NewRecorder()
-	a.cors.HandlerFunc(rw, req.Std())
+	p.cors.HandlerFunc(rw, req.Std())
 
 	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
 	if resp == nil {
@@ -145,6 +326,16 @@ func (a *CORSAdaptor) Handle(ctx *context.Context) string {
 	}
 
 	if isPreflight {
+		// the preflight is accepted if the origin is allowed.
+		if rw.Header().Get("Access-Control-Allow-Origin") != "" {
+			h := resp.HTTPHeader()
+			if p.spec.MaxAge < 0 {
+				h.Set("Access-Control-Max-Age", "0")
+			}
+			if p.spec.AllowPrivateNetwork && req.HTTPHeader().Get("Access-Control-Request-Private-Network") == "true" {
+				h.Set("Access-Control-Allow-Private-Network", "true")
+			}
+		}
 		return resultPreflighted
 	}
 
@@ -132,3 +132,78 @@ allowedOrigins:
 		}
 	})
 }
+
+func newTestCORSAdaptor(t *testing.T, yamlConfig string) filters.Filter {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cors := kind.CreateInstance(spec)
+	cors.Init()
+	return cors
+}
+
+func preflight(cors filters.Filter, url, origin string) (string, http.Header) {
+	ctx := context.New(nil)
+	stdReq, _ := http.NewRequest(http.MethodOptions, url, nil)
+	stdReq.Header.Set("Origin", origin)
+	stdReq.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	stdReq.Header.Set("Access-Control-Request-Private-Network", "true")
+	req, _ := httpprot.NewRequest(stdReq)
+	ctx.SetInputRequest(req)
+
+	result := cors.Handle(ctx)
+	return result, ctx.GetOutputResponse().(*httpprot.Response).HTTPHeader()
+}
+
+func TestCORSPolicies(t *testing.T) {
+	assert := assert.New(t)
+
+	cors := newTestCORSAdaptor(t, `
+kind: CORSAdaptor
+name: cors
+allowedOrigins: ["http://*.megaease.com"]
+maxAge: 600
+policies:
+- match:
+    hosts: ["*.admin.megaease.com"]
+    pathPrefix: /api/
+  allowedOriginRegexps: ['^https://(dev|test)-[0-9]+\.megaease\.com$']
+  allowCredentials: true
+  allowPrivateNetwork: true
+  maxAge: -1
+- match:
+    pathRegexp: ^/public/
+  allowCredentials: true
+`)
+
+	// the default policy.
+	result, h := preflight(cors, "http://www.megaease.com/api/", "http://app.megaease.com")
+	assert.Equal(resultPreflighted, result)
+	assert.Equal("http://app.megaease.com", h.Get("Access-Control-Allow-Origin"))
+	assert.Equal("600", h.Get("Access-Control-Max-Age"))
+	assert.Equal("", h.Get("Access-Control-Allow-Private-Network"))
+
+	// the first policy.
+	_, h = preflight(cors, "http://x.admin.megaease.com:8080/api/users", "https://dev-1.megaease.com")
+	assert.Equal("https://dev-1.megaease.com", h.Get("Access-Control-Allow-Origin"))
+	assert.Equal("true", h.Get("Access-Control-Allow-Credentials"))
+	assert.Equal("true", h.Get("Access-Control-Allow-Private-Network"))
+	assert.Equal("0", h.Get("Access-Control-Max-Age"))
+
+	_, h = preflight(cors, "http://x.admin.megaease.com/api/users", "https://prod-1.megaease.com")
+	assert.Equal("", h.Get("Access-Control-Allow-Origin"))
+	assert.Equal("", h.Get("Access-Control-Allow-Private-Network"))
+
+	// the origin is reflected instead of the wildcard with credentials.
+	_, h = preflight(cors, "http://www.megaease.com/public/a", "http://foo.com")
+	assert.Equal("http://foo.com", h.Get("Access-Control-Allow-Origin"))
+	_, h = preflight(cors, "http://www.megaease.com/public/a", "null")
+	assert.Equal("", h.Get("Access-Control-Allow-Origin"))
+
+	assert.Error((&Spec{PolicySpec: PolicySpec{AllowedOriginRegexps: []string{"("}}}).Validate())
+}
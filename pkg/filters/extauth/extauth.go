@@ -0,0 +1,382 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package extauth implements the ExtAuth filter, which delegates the
+// authorization of requests to an external HTTP or gRPC service, like the
+// ext_authz filter of Envoy.
+package extauth
+
+import (
+	stdcontext "context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of ExtAuth.
+	Kind = "ExtAuth"
+
+	resultDenied = "denied"
+	resultFailed = "failed"
+
+	failureModeOpen   = "open"
+	failureModeClosed = "closed"
+
+	defaultTimeout   = time.Second
+	defaultCacheSize = 1024
+)
+
+var errBodyTooLarge = errors.New("request body is too large")
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "ExtAuth delegates the authorization of requests to an external HTTP or gRPC service",
+	Results:     []string{resultDenied, resultFailed},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{FailureMode: failureModeClosed, StatusOnError: http.StatusForbidden}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &ExtAuth{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// ExtAuth is the filter ExtAuth.
+	ExtAuth struct {
+		spec     *Spec
+		service  service
+		timeout  time.Duration
+		headers  []string
+		cache    *lru.Cache
+		cacheTTL time.Duration
+	}
+
+	// Spec describes the ExtAuth.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		HTTP *HTTPServiceSpec `json:"http,omitempty" jsonschema:"omitempty"`
+		GRPC *GRPCServiceSpec `json:"grpc,omitempty" jsonschema:"omitempty"`
+
+		Timeout string `json:"timeout" jsonschema:"omitempty,format=duration"`
+		// AllowedHeaders are the request headers sent to the service, all
+		// headers are sent if it is empty.
+		AllowedHeaders []string  `json:"allowedHeaders" jsonschema:"omitempty"`
+		Body           *BodySpec `json:"body,omitempty" jsonschema:"omitempty"`
+
+		CacheTTL  string `json:"cacheTTL" jsonschema:"omitempty,format=duration"`
+		CacheSize int    `json:"cacheSize" jsonschema:"omitempty,minimum=1"`
+
+		// FailureMode is open or closed, requests are allowed in the open
+		// mode and rejected with StatusOnError in the closed mode if the
+		// service is unavailable.
+		FailureMode   string `json:"failureMode" jsonschema:"omitempty,enum=,enum=open,enum=closed"`
+		StatusOnError int    `json:"statusOnError" jsonschema:"omitempty,minimum=400,maximum=599"`
+	}
+
+	// BodySpec describes how the request body is sent to the service.
+	BodySpec struct {
+		MaxBytes     int  `json:"maxBytes" jsonschema:"required,minimum=1"`
+		AllowPartial bool `json:"allowPartial" jsonschema:"omitempty"`
+		// PackAsBytes sends the body as raw_body instead of body in the
+		// CheckRequest, it must be true if the body is not UTF-8 encoded.
+		PackAsBytes bool `json:"packAsBytes" jsonschema:"omitempty"`
+	}
+
+	// service is the external authorization service.
+	service interface {
+		check(ctx stdcontext.Context, cr *checkRequest) (*decision, error)
+		close()
+	}
+
+	// checkRequest is the attributes of a request sent to the service.
+	checkRequest struct {
+		realIP   string
+		method   string
+		scheme   string
+		host     string
+		path     string
+		query    string
+		protocol string
+		size     int64
+		headers  map[string]string
+		body     []byte
+	}
+
+	// headerOption is a header to set, or to add if append is true.
+	headerOption struct {
+		key    string
+		value  string
+		append bool
+	}
+
+	// decision is the decision of the service. If the request is allowed,
+	// the headers are applied to the request, otherwise, they are applied
+	// to the response.
+	decision struct {
+		allow           bool
+		statusCode      int
+		body            []byte
+		headers         []*headerOption
+		headersToRemove []string
+	}
+
+	cacheEntry struct {
+		decision *decision
+		expireAt time.Time
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if (spec.HTTP == nil) == (spec.GRPC == nil) {
+		return fmt.Errorf("one and only one of http and grpc is required")
+	}
+	if spec.HTTP != nil && spec.Body != nil && spec.Body.PackAsBytes {
+		return fmt.Errorf("packAsBytes is only for grpc")
+	}
+	return nil
+}
+
+// Name returns the name of the ExtAuth filter instance.
+func (ea *ExtAuth) Name() string {
+	return ea.spec.Name()
+}
+
+// Kind returns the kind of ExtAuth.
+func (ea *ExtAuth) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the ExtAuth.
+func (ea *ExtAuth) Spec() filters.Spec {
+	return ea.spec
+}
+
+// Init initializes ExtAuth.
+func (ea *ExtAuth) Init() {
+	ea.reload()
+}
+
+// Inherit inherits previous generation of ExtAuth.
+func (ea *ExtAuth) Inherit(previousGeneration filters.Filter) {
+	ea.reload()
+}
+
+func (ea *ExtAuth) reload() {
+	spec := ea.spec
+
+	ea.timeout = defaultTimeout
+	if spec.Timeout != "" {
+		ea.timeout, _ = time.ParseDuration(spec.Timeout)
+	}
+
+	for _, h := range spec.AllowedHeaders {
+		ea.headers = append(ea.headers, http.CanonicalHeaderKey(h))
+	}
+
+	if spec.CacheTTL != "" {
+		ea.cacheTTL, _ = time.ParseDuration(spec.CacheTTL)
+	}
+	if ea.cacheTTL > 0 {
+		size := spec.CacheSize
+		if size <= 0 {
+			size = defaultCacheSize
+		}
+		ea.cache, _ = lru.New(size)
+	}
+
+	if spec.HTTP != nil {
+		ea.service = newHTTPService(spec.HTTP)
+		return
+	}
+
+	packAsBytes := spec.Body != nil && spec.Body.PackAsBytes
+	svc, err := newGRPCService(spec.GRPC, packAsBytes)
+	if err != nil {
+		logger.Errorf("ExtAuth %s: create grpc service failed: %v", ea.Name(), err)
+		return
+	}
+	ea.service = svc
+}
+
+func (ea *ExtAuth) buildCheckRequest(req *httpprot.Request) (*checkRequest, error) {
+	cr := &checkRequest{
+		realIP:   req.RealIP(),
+		method:   req.Method(),
+		scheme:   req.Scheme(),
+		host:     req.Host(),
+		path:     req.Path(),
+		query:    req.URL().RawQuery,
+		protocol: req.Proto(),
+		size:     req.Std().ContentLength,
+		headers:  map[string]string{},
+	}
+
+	// header names are in lower case like HTTP/2.
+	header := req.HTTPHeader()
+	if len(ea.headers) == 0 {
+		for k, vs := range header {
+			cr.headers[strings.ToLower(k)] = strings.Join(vs, ",")
+		}
+	} else {
+		for _, k := range ea.headers {
+			if vs := header.Values(k); len(vs) > 0 {
+				cr.headers[strings.ToLower(k)] = strings.Join(vs, ",")
+			}
+		}
+	}
+
+	if ea.spec.Body != nil && !req.IsStream() {
+		body := req.RawPayload()
+		if len(body) > ea.spec.Body.MaxBytes {
+			if !ea.spec.Body.AllowPartial {
+				return nil, errBodyTooLarge
+			}
+			body = body[:ea.spec.Body.MaxBytes]
+		}
+		cr.body = body
+	}
+
+	return cr, nil
+}
+
+// key returns the cache key of the check request.
+func (cr *checkRequest) key() [sha256.Size]byte {
+	return sha256.Sum256(encodeCheckRequest(cr, nil, false))
+}
+
+// decide returns the decision of the request, from the cache if possible.
+func (ea *ExtAuth) decide(cr *checkRequest) (*decision, error) {
+	if ea.service == nil {
+		return nil, fmt.Errorf("service is unavailable")
+	}
+
+	check := func() (*decision, error) {
+		ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), ea.timeout)
+		defer cancel()
+		return ea.service.check(ctx, cr)
+	}
+
+	if ea.cache == nil {
+		return check()
+	}
+
+	key := cr.key()
+	now := fasttime.Now()
+	if v, ok := ea.cache.Get(key); ok {
+		entry := v.(*cacheEntry)
+		if now.Before(entry.expireAt) {
+			return entry.decision, nil
+		}
+	}
+
+	d, err := check()
+	if err != nil {
+		return nil, err
+	}
+	ea.cache.Add(key, &cacheEntry{decision: d, expireAt: now.Add(ea.cacheTTL)})
+	return d, nil
+}
+
+// Handle authorizes the request by the external service.
+func (ea *ExtAuth) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	cr, err := ea.buildCheckRequest(req)
+	if err == errBodyTooLarge {
+		ctx.AddTag("extAuth: request body is too large")
+		ea.reject(ctx, &decision{statusCode: http.StatusRequestEntityTooLarge})
+		return resultDenied
+	}
+
+	d, err := ea.decide(cr)
+	if err != nil {
+		if ea.spec.FailureMode == failureModeOpen {
+			logger.Warnf("ExtAuth %s failed, request is allowed in open mode: %v", ea.Name(), err)
+			ctx.AddTag(stringtool.Cat("extAuth: failed but allowed: ", err.Error()))
+			return ""
+		}
+		ctx.AddTag(stringtool.Cat("extAuth: ", err.Error()))
+		ea.reject(ctx, &decision{statusCode: ea.spec.StatusOnError})
+		return resultFailed
+	}
+
+	if !d.allow {
+		ctx.AddTag("extAuth: request denied")
+		ea.reject(ctx, d)
+		return resultDenied
+	}
+
+	header := req.HTTPHeader()
+	applyHeaders(header, d.headers)
+	for _, k := range d.headersToRemove {
+		header.Del(k)
+	}
+	return ""
+}
+
+func applyHeaders(header http.Header, headers []*headerOption) {
+	for _, h := range headers {
+		if h.append {
+			header.Add(h.key, h.value)
+		} else {
+			header.Set(h.key, h.value)
+		}
+	}
+}
+
+func (ea *ExtAuth) reject(ctx *context.Context, d *decision) {
+	resp, _ := httpprot.NewResponse(nil)
+	code := d.statusCode
+	if code < 400 || code >= 600 {
+		code = http.StatusForbidden
+	}
+	resp.SetStatusCode(code)
+	applyHeaders(resp.HTTPHeader(), d.headers)
+	if len(d.body) > 0 {
+		resp.SetPayload(d.body)
+	}
+	ctx.SetOutputResponse(resp)
+}
+
+// Status returns status.
+func (ea *ExtAuth) Status() interface{} { return nil }
+
+// Close closes ExtAuth.
+func (ea *ExtAuth) Close() {
+	if ea.service != nil {
+		ea.service.close()
+	}
+}
@@ -0,0 +1,410 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package extauth
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+// newTestHTTPServer returns an authorization service which allows user
+// alice and denies others with 401.
+func newTestHTTPServer(calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		if r.Header.Get("X-Api-Key") != "secret" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case r.Header.Get("X-User") == "alice" && r.URL.Path == "/orders":
+			w.Header().Set("X-User-Id", "1")
+			w.Header().Set("X-Envoy-Auth-Headers-To-Remove", "Authorization")
+			w.WriteHeader(http.StatusOK)
+		case string(body) == "let me in":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.Header().Set("X-Debug", "denied")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("who are you"))
+		}
+	}))
+}
+
+func newTestExtAuth(t *testing.T, yamlConfig string) *ExtAuth {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "pipeline", rawSpec)
+	if err != nil {
+		t.Fatalf("failed to create spec: %v", err)
+	}
+	ea := kind.CreateInstance(spec).(*ExtAuth)
+	ea.Init()
+	return ea
+}
+
+func newContext(user, body string) *context.Context {
+	ctx := context.New(nil)
+	stdReq, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1/orders?id=1", strings.NewReader(body))
+	if user != "" {
+		stdReq.Header.Set("X-User", user)
+	}
+	stdReq.Header.Set("Authorization", "Bearer token")
+	req, _ := httpprot.NewRequest(stdReq)
+	req.FetchPayload(0)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error((&Spec{}).Validate())
+	assert.Error((&Spec{HTTP: &HTTPServiceSpec{}, GRPC: &GRPCServiceSpec{}}).Validate())
+	assert.NoError((&Spec{HTTP: &HTTPServiceSpec{}}).Validate())
+	assert.NoError((&Spec{GRPC: &GRPCServiceSpec{}, Body: &BodySpec{PackAsBytes: true}}).Validate())
+	assert.Error((&Spec{HTTP: &HTTPServiceSpec{}, Body: &BodySpec{PackAsBytes: true}}).Validate())
+}
+
+func TestHTTPService(t *testing.T) {
+	assert := assert.New(t)
+
+	var calls int32
+	srv := newTestHTTPServer(&calls)
+	defer srv.Close()
+
+	ea := newTestExtAuth(t, `
+kind: ExtAuth
+name: extauth
+http:
+  url: `+srv.URL+`
+  headers:
+    X-Api-Key: secret
+  upstreamHeaders: [X-User-Id]
+  clientHeaders: [WWW-Authenticate]
+body:
+  maxBytes: 16
+`)
+	defer ea.Close()
+
+	ctx := newContext("alice", "")
+	assert.Equal("", ea.Handle(ctx))
+	header := ctx.GetInputRequest().(*httpprot.Request).HTTPHeader()
+	assert.Equal("1", header.Get("X-User-Id"))
+	assert.Equal("", header.Get("Authorization"))
+
+	ctx = newContext("bob", "")
+	assert.Equal(resultDenied, ea.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusUnauthorized, resp.StatusCode())
+	assert.Equal("Bearer", resp.HTTPHeader().Get("WWW-Authenticate"))
+	assert.Equal("", resp.HTTPHeader().Get("X-Debug"))
+	assert.Equal("who are you", string(resp.RawPayload()))
+
+	assert.Equal("", ea.Handle(newContext("", "let me in")))
+
+	ctx = newContext("", "the body is too large")
+	assert.Equal(resultDenied, ea.Handle(ctx))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusRequestEntityTooLarge, resp.StatusCode())
+
+	// no cache by default.
+	atomic.StoreInt32(&calls, 0)
+	ea.Handle(newContext("alice", ""))
+	ea.Handle(newContext("alice", ""))
+	assert.Equal(int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestHTTPServiceAllHeaders(t *testing.T) {
+	assert := assert.New(t)
+
+	var calls int32
+	srv := newTestHTTPServer(&calls)
+	defer srv.Close()
+
+	ea := newTestExtAuth(t, `
+kind: ExtAuth
+name: extauth
+http:
+  url: `+srv.URL+`
+  headers:
+    X-Api-Key: secret
+allowedHeaders: [Authorization]
+`)
+	defer ea.Close()
+
+	// X-User is not sent to the service, so alice is denied.
+	ctx := newContext("alice", "")
+	assert.Equal(resultDenied, ea.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("Bearer", resp.HTTPHeader().Get("WWW-Authenticate"))
+	assert.Equal("denied", resp.HTTPHeader().Get("X-Debug"))
+}
+
+func TestCache(t *testing.T) {
+	assert := assert.New(t)
+
+	var calls int32
+	srv := newTestHTTPServer(&calls)
+	defer srv.Close()
+
+	ea := newTestExtAuth(t, `
+kind: ExtAuth
+name: extauth
+http:
+  url: `+srv.URL+`
+  headers:
+    X-Api-Key: secret
+  upstreamHeaders: [X-User-Id]
+cacheTTL: 1m
+cacheSize: 10
+`)
+	defer ea.Close()
+
+	for i := 0; i < 3; i++ {
+		assert.Equal("", ea.Handle(newContext("alice", "")))
+		assert.Equal(resultDenied, ea.Handle(newContext("bob", "")))
+	}
+	assert.Equal(int32(2), atomic.LoadInt32(&calls))
+
+	// the headers of the cached decision are still set.
+	ctx := newContext("alice", "")
+	ea.Handle(ctx)
+	assert.Equal("1", ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Get("X-User-Id"))
+}
+
+func TestFailureMode(t *testing.T) {
+	assert := assert.New(t)
+
+	var calls int32
+	srv := newTestHTTPServer(&calls)
+	defer srv.Close()
+
+	// the service responds 500 without the API key.
+	yamlConfig := `
+kind: ExtAuth
+name: extauth
+http:
+  url: ` + srv.URL + `
+cacheTTL: 1m
+`
+	ea := newTestExtAuth(t, yamlConfig)
+	ctx := newContext("alice", "")
+	assert.Equal(resultFailed, ea.Handle(ctx))
+	assert.Equal(http.StatusForbidden, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	// failures are not cached.
+	assert.Equal(resultFailed, ea.Handle(newContext("alice", "")))
+	assert.Equal(int32(2), atomic.LoadInt32(&calls))
+
+	ea = newTestExtAuth(t, yamlConfig+"statusOnError: 503\n")
+	ctx = newContext("alice", "")
+	assert.Equal(resultFailed, ea.Handle(ctx))
+	assert.Equal(http.StatusServiceUnavailable, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	ea = newTestExtAuth(t, yamlConfig+"failureMode: open\n")
+	ctx = newContext("alice", "")
+	assert.Equal("", ea.Handle(ctx))
+	assert.Nil(ctx.GetOutputResponse())
+
+	// the service is unavailable.
+	srv.Close()
+	ea = newTestExtAuth(t, yamlConfig)
+	assert.Equal(resultFailed, ea.Handle(newContext("alice", "")))
+}
+
+func appendHeaderOption(b []byte, key, value string, append bool) []byte {
+	var hv, bv, opt []byte
+	hv = appendString(hv, 1, key)
+	hv = appendString(hv, 2, value)
+	opt = appendMessage(opt, 1, hv)
+	if append {
+		bv = protowire.AppendTag(bv, 1, protowire.VarintType)
+		bv = protowire.AppendVarint(bv, 1)
+		opt = appendMessage(opt, 2, bv)
+	}
+	return appendMessage(b, 2, opt)
+}
+
+// parseTestCheckRequest returns the headers, path, body and context
+// extensions of a CheckRequest.
+func parseTestCheckRequest(b []byte) (headers map[string]string, path, body string, extensions map[string]string) {
+	headers, extensions = map[string]string{}, map[string]string{}
+	parseEntry := func(b []byte, m map[string]string) {
+		var k, v string
+		walkFields(b, func(num protowire.Number, value []byte, _ uint64) {
+			if num == 1 {
+				k = string(value)
+			} else if num == 2 {
+				v = string(value)
+			}
+		})
+		m[k] = v
+	}
+
+	walkFields(b, func(_ protowire.Number, attrs []byte, _ uint64) {
+		walkFields(attrs, func(num protowire.Number, value []byte, _ uint64) {
+			switch num {
+			case 4:
+				walkFields(value, func(_ protowire.Number, httpReq []byte, _ uint64) {
+					walkFields(httpReq, func(num protowire.Number, value []byte, _ uint64) {
+						switch num {
+						case 3:
+							parseEntry(value, headers)
+						case 4:
+							path = string(value)
+						case 11, 12:
+							body = string(value)
+						}
+					})
+				})
+			case 10:
+				parseEntry(value, extensions)
+			}
+		})
+	})
+	return
+}
+
+// newTestGRPCServer returns an Envoy authorization service which allows
+// user alice and denies others.
+func newTestGRPCServer(t *testing.T) (string, func()) {
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		var req []byte
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+
+		headers, path, body, extensions := parseTestCheckRequest(req)
+		var resp []byte
+		if (headers["x-user"] == "alice" && path == "/orders?id=1" && extensions["tenant"] == "megaease") || body == "let me in" {
+			var ok []byte
+			ok = appendHeaderOption(ok, "X-User-Id", "1", false)
+			ok = appendHeaderOption(ok, "X-Role", "admin", true)
+			ok = appendString(ok, 5, "authorization")
+			resp = appendMessage(resp, 3, ok)
+		} else {
+			var status, httpStatus, denied []byte
+			status = protowire.AppendTag(status, 1, protowire.VarintType)
+			status = protowire.AppendVarint(status, 7)
+			httpStatus = protowire.AppendTag(httpStatus, 1, protowire.VarintType)
+			httpStatus = protowire.AppendVarint(httpStatus, http.StatusUnauthorized)
+			denied = appendMessage(denied, 1, httpStatus)
+			denied = appendHeaderOption(denied, "WWW-Authenticate", "Bearer", false)
+			denied = appendString(denied, 3, "who are you")
+			resp = appendMessage(resp, 1, status)
+			resp = appendMessage(resp, 2, denied)
+		}
+		return stream.SendMsg(&resp)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	s := grpc.NewServer(grpc.ForceServerCodec(rawCodec{}), grpc.UnknownServiceHandler(handler))
+	go s.Serve(l)
+	return l.Addr().String(), s.Stop
+}
+
+func TestGRPCService(t *testing.T) {
+	assert := assert.New(t)
+
+	addr, stop := newTestGRPCServer(t)
+	defer stop()
+
+	ea := newTestExtAuth(t, `
+kind: ExtAuth
+name: extauth
+grpc:
+  address: `+addr+`
+  contextExtensions:
+    tenant: megaease
+body:
+  maxBytes: 16
+  packAsBytes: true
+`)
+	defer ea.Close()
+
+	ctx := newContext("alice", "")
+	ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Set("X-Role", "user")
+	assert.Equal("", ea.Handle(ctx))
+	header := ctx.GetInputRequest().(*httpprot.Request).HTTPHeader()
+	assert.Equal("1", header.Get("X-User-Id"))
+	assert.Equal([]string{"user", "admin"}, header.Values("X-Role"))
+	assert.Equal("", header.Get("Authorization"))
+
+	ctx = newContext("bob", "")
+	assert.Equal(resultDenied, ea.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusUnauthorized, resp.StatusCode())
+	assert.Equal("Bearer", resp.HTTPHeader().Get("WWW-Authenticate"))
+	assert.Equal("who are you", string(resp.RawPayload()))
+
+	assert.Equal("", ea.Handle(newContext("", "let me in")))
+
+	stop()
+	assert.Equal(resultFailed, ea.Handle(newContext("alice", "")))
+}
+
+func TestParseCheckResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	// an empty response is OK.
+	d, err := parseCheckResponse(nil)
+	assert.NoError(err)
+	assert.True(d.allow)
+
+	// denied without denied_response.
+	var status, resp []byte
+	status = protowire.AppendTag(status, 1, protowire.VarintType)
+	status = protowire.AppendVarint(status, 7)
+	resp = appendMessage(resp, 1, status)
+	d, err = parseCheckResponse(resp)
+	assert.NoError(err)
+	assert.False(d.allow)
+	assert.Equal(http.StatusForbidden, d.statusCode)
+
+	_, err = parseCheckResponse([]byte{0xff})
+	assert.Error(err)
+}
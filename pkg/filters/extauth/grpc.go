@@ -0,0 +1,350 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package extauth
+
+import (
+	stdcontext "context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const checkMethod = "/envoy.service.auth.v3.Authorization/Check"
+
+type (
+	// GRPCServiceSpec describes the gRPC authorization service, which
+	// implements the Authorization service of Envoy.
+	GRPCServiceSpec struct {
+		// Address is the address of the service, e.g. 127.0.0.1:9001.
+		Address string `json:"address" jsonschema:"required"`
+		TLS     bool   `json:"tls" jsonschema:"omitempty"`
+		// ContextExtensions are passed to the service in the
+		// context_extensions of the CheckRequest.
+		ContextExtensions map[string]string `json:"contextExtensions" jsonschema:"omitempty"`
+	}
+
+	grpcService struct {
+		spec        *GRPCServiceSpec
+		packAsBytes bool
+		conn        *grpc.ClientConn
+	}
+
+	// rawCodec passes through the messages which are encoded by protowire,
+	// so there's no need of the generated code of Envoy.
+	rawCodec struct{}
+)
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	return *(v.(*[]byte)), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	*(v.(*[]byte)) = append([]byte(nil), data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+func newGRPCService(spec *GRPCServiceSpec, packAsBytes bool) (*grpcService, error) {
+	creds := insecure.NewCredentials()
+	if spec.TLS {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+
+	// the connection is established in background, failures are reported
+	// by the calls.
+	conn, err := grpc.Dial(spec.Address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+
+	return &grpcService{spec: spec, packAsBytes: packAsBytes, conn: conn}, nil
+}
+
+func (gs *grpcService) check(ctx stdcontext.Context, cr *checkRequest) (*decision, error) {
+	req := encodeCheckRequest(cr, gs.spec.ContextExtensions, gs.packAsBytes)
+	var resp []byte
+	err := gs.conn.Invoke(ctx, checkMethod, &req, &resp, grpc.ForceCodec(rawCodec{}))
+	if err != nil {
+		return nil, err
+	}
+	return parseCheckResponse(resp)
+}
+
+func (gs *grpcService) close() {
+	gs.conn.Close()
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// appendMap appends a map<string, string> field, the entries are sorted by
+// keys to make the encoding deterministic.
+func appendMap(b []byte, num protowire.Number, m map[string]string) []byte {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		var entry []byte
+		entry = appendString(entry, 1, k)
+		entry = appendString(entry, 2, m[k])
+		b = appendMessage(b, num, entry)
+	}
+	return b
+}
+
+// encodeCheckRequest encodes the CheckRequest message, only the fields
+// known by Easegress are set.
+//
+//	message CheckRequest {
+//	  AttributeContext attributes = 1;
+//	}
+//
+//	message AttributeContext {
+//	  Peer source = 1;
+//	  Request request = 4;
+//	  map<string, string> context_extensions = 10;
+//	}
+//
+//	message Peer { Address address = 1; }
+//	message Address { SocketAddress socket_address = 1; }
+//	message SocketAddress { string address = 2; }
+//	message Request { HttpRequest http = 2; }
+//
+//	message HttpRequest {
+//	  string method = 2;
+//	  map<string, string> headers = 3;
+//	  string path = 4;
+//	  string host = 5;
+//	  string scheme = 6;
+//	  int64 size = 9;
+//	  string protocol = 10;
+//	  string body = 11;
+//	  bytes raw_body = 12;
+//	}
+func encodeCheckRequest(cr *checkRequest, extensions map[string]string, packAsBytes bool) []byte {
+	var socketAddr, addr, peer []byte
+	socketAddr = appendString(socketAddr, 2, cr.realIP)
+	addr = appendMessage(addr, 1, socketAddr)
+	peer = appendMessage(peer, 1, addr)
+
+	// like Envoy, the path includes the query string.
+	path := cr.path
+	if cr.query != "" {
+		path += "?" + cr.query
+	}
+
+	var httpReq []byte
+	httpReq = appendString(httpReq, 2, cr.method)
+	httpReq = appendMap(httpReq, 3, cr.headers)
+	httpReq = appendString(httpReq, 4, path)
+	httpReq = appendString(httpReq, 5, cr.host)
+	httpReq = appendString(httpReq, 6, cr.scheme)
+	httpReq = protowire.AppendTag(httpReq, 9, protowire.VarintType)
+	httpReq = protowire.AppendVarint(httpReq, uint64(cr.size))
+	httpReq = appendString(httpReq, 10, cr.protocol)
+	if len(cr.body) > 0 {
+		if packAsBytes {
+			httpReq = appendMessage(httpReq, 12, cr.body)
+		} else {
+			httpReq = appendMessage(httpReq, 11, cr.body)
+		}
+	}
+
+	var req, attrs, b []byte
+	req = appendMessage(req, 2, httpReq)
+	attrs = appendMessage(attrs, 1, peer)
+	attrs = appendMessage(attrs, 4, req)
+	attrs = appendMap(attrs, 10, extensions)
+	return appendMessage(b, 1, attrs)
+}
+
+// walkFields calls fn for each field of a message, value is the content of
+// length delimited fields, and n is the value of varint fields, fields of
+// other wire types are skipped.
+func walkFields(b []byte, fn func(num protowire.Number, value []byte, n uint64)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch typ {
+		case protowire.BytesType:
+			value, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			fn(num, value, 0)
+			b = b[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			fn(num, nil, v)
+			b = b[n:]
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return nil
+}
+
+// parseCheckResponse parses the CheckResponse message, the request is
+// allowed if the status code is OK.
+//
+//	message CheckResponse {
+//	  google.rpc.Status status = 1;          // int32 code = 1;
+//	  DeniedHttpResponse denied_response = 2;
+//	  OkHttpResponse ok_response = 3;
+//	}
+//
+//	message DeniedHttpResponse {
+//	  HttpStatus status = 1;                 // StatusCode code = 1;
+//	  repeated HeaderValueOption headers = 2;
+//	  string body = 3;
+//	}
+//
+//	message OkHttpResponse {
+//	  repeated HeaderValueOption headers = 2;
+//	  repeated string headers_to_remove = 5;
+//	}
+func parseCheckResponse(b []byte) (*decision, error) {
+	var code uint64
+	var status, denied, ok []byte
+	err := walkFields(b, func(num protowire.Number, value []byte, _ uint64) {
+		switch num {
+		case 1:
+			status = value
+		case 2:
+			denied = value
+		case 3:
+			ok = value
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = walkFields(status, func(num protowire.Number, _ []byte, n uint64) {
+		if num == 1 {
+			code = n
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	d := &decision{allow: code == 0}
+	if d.allow {
+		err = walkFields(ok, func(num protowire.Number, value []byte, _ uint64) {
+			switch num {
+			case 2:
+				if h := parseHeaderValueOption(value); h != nil {
+					d.headers = append(d.headers, h)
+				}
+			case 5:
+				d.headersToRemove = append(d.headersToRemove, string(value))
+			}
+		})
+		return d, err
+	}
+
+	d.statusCode = http.StatusForbidden
+	err = walkFields(denied, func(num protowire.Number, value []byte, _ uint64) {
+		switch num {
+		case 1:
+			walkFields(value, func(num protowire.Number, _ []byte, n uint64) {
+				if num == 1 && n > 0 {
+					d.statusCode = int(n)
+				}
+			})
+		case 2:
+			if h := parseHeaderValueOption(value); h != nil {
+				d.headers = append(d.headers, h)
+			}
+		case 3:
+			d.body = append([]byte(nil), value...)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid denied response: %v", err)
+	}
+	return d, nil
+}
+
+// parseHeaderValueOption parses the HeaderValueOption message, append is
+// false by default in check responses.
+//
+//	message HeaderValueOption {
+//	  HeaderValue header = 1;   // string key = 1; string value = 2; bytes raw_value = 3;
+//	  BoolValue append = 2;     // bool value = 1;
+//	}
+func parseHeaderValueOption(b []byte) *headerOption {
+	h := &headerOption{}
+	err := walkFields(b, func(num protowire.Number, value []byte, _ uint64) {
+		switch num {
+		case 1:
+			walkFields(value, func(num protowire.Number, value []byte, _ uint64) {
+				switch num {
+				case 1:
+					h.key = string(value)
+				case 2, 3:
+					h.value = string(value)
+				}
+			})
+		case 2:
+			walkFields(value, func(num protowire.Number, _ []byte, n uint64) {
+				if num == 1 {
+					h.append = n != 0
+				}
+			})
+		}
+	})
+	if err != nil || h.key == "" {
+		return nil
+	}
+	return h
+}
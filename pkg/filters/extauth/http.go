@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package extauth
+
+import (
+	"bytes"
+	stdcontext "context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// headersToRemove is the response header of the service which lists
+	// the request headers to remove, the same as Envoy.
+	headersToRemove = "X-Envoy-Auth-Headers-To-Remove"
+
+	// the max size of the response body of the service.
+	maxResponseBodySize = 64 * 1024
+)
+
+// skippedHeaders are the request headers not sent to the service, they are
+// about the connection or the body, which are different in the check
+// request.
+var skippedHeaders = map[string]bool{
+	"connection":        true,
+	"content-length":    true,
+	"keep-alive":        true,
+	"transfer-encoding": true,
+	"upgrade":           true,
+}
+
+type (
+	// HTTPServiceSpec describes the HTTP authorization service. The check
+	// request has the method, path and headers of the original request, the
+	// request is allowed if the service responds 200, and denied with the
+	// response of the service otherwise, except 5xx which are failures.
+	HTTPServiceSpec struct {
+		// URL is the address of the service, the path of the original
+		// request is appended to it.
+		URL     string            `json:"url" jsonschema:"required,format=url"`
+		Headers map[string]string `json:"headers" jsonschema:"omitempty"`
+		// UpstreamHeaders are the headers of the authorization response set
+		// to the request if it is allowed.
+		UpstreamHeaders []string `json:"upstreamHeaders" jsonschema:"omitempty"`
+		// ClientHeaders are the headers of the authorization response sent
+		// to the client if the request is denied, all headers are sent if
+		// it is empty.
+		ClientHeaders []string `json:"clientHeaders" jsonschema:"omitempty"`
+	}
+
+	httpService struct {
+		spec   *HTTPServiceSpec
+		url    string
+		client *http.Client
+	}
+)
+
+func newHTTPService(spec *HTTPServiceSpec) *httpService {
+	return &httpService{
+		spec: spec,
+		url:  strings.TrimSuffix(spec.URL, "/"),
+		// the timeout is controlled by the context.
+		client: &http.Client{},
+	}
+}
+
+func (hs *httpService) check(ctx stdcontext.Context, cr *checkRequest) (*decision, error) {
+	url := hs.url + cr.path
+	if cr.query != "" {
+		url += "?" + cr.query
+	}
+
+	req, err := http.NewRequestWithContext(ctx, cr.method, url, bytes.NewReader(cr.body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range cr.headers {
+		if !skippedHeaders[k] {
+			req.Header.Set(k, v)
+		}
+	}
+	for k, v := range hs.spec.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := hs.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return nil, fmt.Errorf("unexpected status code %d from service", resp.StatusCode)
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		return hs.allow(resp), nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBodySize))
+	if err != nil {
+		return nil, err
+	}
+	return hs.deny(resp, body), nil
+}
+
+func (hs *httpService) allow(resp *http.Response) *decision {
+	d := &decision{allow: true}
+	for _, k := range hs.spec.UpstreamHeaders {
+		d.headers = appendHeaderValues(d.headers, k, resp.Header.Values(k))
+	}
+	for _, v := range resp.Header.Values(headersToRemove) {
+		for _, k := range strings.Split(v, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				d.headersToRemove = append(d.headersToRemove, k)
+			}
+		}
+	}
+	return d
+}
+
+func (hs *httpService) deny(resp *http.Response, body []byte) *decision {
+	d := &decision{statusCode: resp.StatusCode, body: body}
+	if len(hs.spec.ClientHeaders) == 0 {
+		for k, vs := range resp.Header {
+			if !skippedHeaders[strings.ToLower(k)] {
+				d.headers = appendHeaderValues(d.headers, k, vs)
+			}
+		}
+		return d
+	}
+	for _, k := range hs.spec.ClientHeaders {
+		d.headers = appendHeaderValues(d.headers, k, resp.Header.Values(k))
+	}
+	return d
+}
+
+// appendHeaderValues appends the options which replace the header by the
+// values.
+func appendHeaderValues(headers []*headerOption, key string, values []string) []*headerOption {
+	for i, v := range values {
+		headers = append(headers, &headerOption{key: key, value: v, append: i > 0})
+	}
+	return headers
+}
+
+func (hs *httpService) close() {
+	hs.client.CloseIdleConnections()
+}
@@ -0,0 +1,298 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package externalfilter implements the ExternalFilter filter, which
+// delegates the handling of requests to an external plugin process over
+// gRPC, plugins are built with the SDKs in the sdk directory.
+package externalfilter
+
+import (
+	stdcontext "context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/filters/externalfilter/sdk"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of ExternalFilter.
+	Kind = "ExternalFilter"
+
+	resultFailed          = "failed"
+	resultResponseAlready = "responseAlready"
+
+	failureModeOpen   = "open"
+	failureModeClosed = "closed"
+
+	defaultTimeout = time.Second
+	// 64KB
+	defaultMaxBodyBytes = 64 * 1024
+)
+
+var results = []string{resultFailed, resultResponseAlready}
+
+func externalResultToFilterResult(r int) string {
+	if r == 0 {
+		return ""
+	}
+	return fmt.Sprintf("externalResult%d", r)
+}
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "ExternalFilter delegates the handling of requests to an external plugin over gRPC",
+	Results:     results,
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			MaxBodyBytes:  defaultMaxBodyBytes,
+			FailureMode:   failureModeClosed,
+			StatusOnError: http.StatusServiceUnavailable,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &ExternalFilter{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	for i := 1; i <= sdk.MaxResult; i++ {
+		results = append(results, externalResultToFilterResult(i))
+	}
+
+	kind.Results = results
+	filters.Register(kind)
+}
+
+type (
+	// ExternalFilter is the filter ExternalFilter.
+	ExternalFilter struct {
+		spec    *Spec
+		timeout time.Duration
+		conn    *grpc.ClientConn
+	}
+
+	// Spec describes the ExternalFilter.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// Address is the address of the plugin, e.g. 127.0.0.1:9100.
+		Address string `json:"address" jsonschema:"required"`
+		TLS     bool   `json:"tls" jsonschema:"omitempty"`
+		Timeout string `json:"timeout" jsonschema:"omitempty,format=duration"`
+		// Config is passed to the plugin in every call.
+		Config map[string]string `json:"config" jsonschema:"omitempty"`
+		// MaxBodyBytes is the max size of the body sent to the plugin,
+		// larger bodies and streams are omitted.
+		MaxBodyBytes int `json:"maxBodyBytes" jsonschema:"omitempty,minimum=0"`
+
+		// FailureMode is open or closed, requests continue in the open
+		// mode and are rejected with StatusOnError in the closed mode if
+		// the plugin is unavailable.
+		FailureMode   string `json:"failureMode" jsonschema:"omitempty,enum=,enum=open,enum=closed"`
+		StatusOnError int    `json:"statusOnError" jsonschema:"omitempty,minimum=400,maximum=599"`
+	}
+)
+
+// Name returns the name of the ExternalFilter filter instance.
+func (ef *ExternalFilter) Name() string {
+	return ef.spec.Name()
+}
+
+// Kind returns the kind of ExternalFilter.
+func (ef *ExternalFilter) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the ExternalFilter.
+func (ef *ExternalFilter) Spec() filters.Spec {
+	return ef.spec
+}
+
+// Init initializes ExternalFilter.
+func (ef *ExternalFilter) Init() {
+	ef.reload()
+}
+
+// Inherit inherits previous generation of ExternalFilter.
+func (ef *ExternalFilter) Inherit(previousGeneration filters.Filter) {
+	ef.reload()
+}
+
+func (ef *ExternalFilter) reload() {
+	ef.timeout = defaultTimeout
+	if ef.spec.Timeout != "" {
+		ef.timeout, _ = time.ParseDuration(ef.spec.Timeout)
+	}
+
+	creds := insecure.NewCredentials()
+	if ef.spec.TLS {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+
+	// the connection is established in background, failures are reported
+	// by the calls.
+	conn, err := grpc.Dial(ef.spec.Address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		logger.Errorf("ExternalFilter %s: dial %s failed: %v", ef.Name(), ef.spec.Address, err)
+		return
+	}
+	ef.conn = conn
+}
+
+func (ef *ExternalFilter) buildRequest(req *httpprot.Request) *sdk.Request {
+	r := &sdk.Request{
+		Method: req.Method(),
+		Path:   req.Path(),
+		Query:  req.URL().RawQuery,
+		Host:   req.Host(),
+		Scheme: req.Scheme(),
+		RealIP: req.RealIP(),
+		Header: req.HTTPHeader(),
+	}
+
+	if req.IsStream() || len(req.RawPayload()) > ef.spec.MaxBodyBytes {
+		r.BodyOmitted = true
+	} else {
+		r.Body = req.RawPayload()
+	}
+	return r
+}
+
+func (ef *ExternalFilter) call(req *httpprot.Request) (*sdk.HandleResponse, error) {
+	if ef.conn == nil {
+		return nil, fmt.Errorf("plugin is unavailable")
+	}
+
+	in := sdk.MarshalHandleRequest(&sdk.HandleRequest{
+		Filter:  ef.Name(),
+		Config:  ef.spec.Config,
+		Request: ef.buildRequest(req),
+	})
+
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), ef.timeout)
+	defer cancel()
+
+	var out []byte
+	err := ef.conn.Invoke(ctx, sdk.HandleMethod, &in, &out, grpc.ForceCodec(sdk.Codec{}))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := sdk.UnmarshalHandleResponse(out)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Result < 0 || resp.Result > sdk.MaxResult {
+		return nil, fmt.Errorf("invalid result %d", resp.Result)
+	}
+	return resp, nil
+}
+
+// Handle handles the request by the plugin.
+func (ef *ExternalFilter) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	resp, err := ef.call(req)
+	if err != nil {
+		if ef.spec.FailureMode == failureModeOpen {
+			logger.Warnf("ExternalFilter %s failed, request continues in open mode: %v", ef.Name(), err)
+			ctx.AddTag(stringtool.Cat("externalFilter: failed but continued: ", err.Error()))
+			return ""
+		}
+		ctx.AddTag(stringtool.Cat("externalFilter: ", err.Error()))
+		r, _ := httpprot.NewResponse(nil)
+		r.SetStatusCode(ef.spec.StatusOnError)
+		ctx.SetOutputResponse(r)
+		return resultFailed
+	}
+
+	if resp.Request != nil {
+		applyRequest(req, resp.Request)
+	}
+
+	result := externalResultToFilterResult(resp.Result)
+	if resp.Response == nil {
+		return result
+	}
+
+	r, _ := httpprot.NewResponse(nil)
+	code := resp.Response.StatusCode
+	if code == 0 {
+		code = http.StatusOK
+	}
+	r.SetStatusCode(code)
+	for k, vs := range resp.Response.Header {
+		r.HTTPHeader()[k] = vs
+	}
+	if len(resp.Response.Body) > 0 {
+		r.SetPayload(resp.Response.Body)
+	}
+	ctx.SetOutputResponse(r)
+
+	if result == "" {
+		return resultResponseAlready
+	}
+	return result
+}
+
+// applyRequest applies the request returned by the plugin, the headers
+// are replaced as a whole.
+func applyRequest(req *httpprot.Request, r *sdk.Request) {
+	if r.Method != "" {
+		req.SetMethod(r.Method)
+	}
+	if r.Host != "" {
+		req.SetHost(r.Host)
+	}
+	if r.Path != "" {
+		req.SetPath(r.Path)
+	}
+	req.URL().RawQuery = r.Query
+
+	header := req.HTTPHeader()
+	for k := range header {
+		delete(header, k)
+	}
+	for k, vs := range r.Header {
+		header[k] = vs
+	}
+
+	if !r.BodyOmitted {
+		req.SetPayload(r.Body)
+	}
+}
+
+// Status returns status.
+func (ef *ExternalFilter) Status() interface{} { return nil }
+
+// Close closes ExternalFilter.
+func (ef *ExternalFilter) Close() {
+	if ef.conn != nil {
+		ef.conn.Close()
+	}
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package externalfilter
+
+import (
+	stdcontext "context"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/filters/externalfilter/sdk"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+// newTestPlugin returns a plugin which rewrites requests of alice, denies
+// requests of bob, and returns result 3 for others.
+func newTestPlugin(t *testing.T) (string, func()) {
+	h := sdk.HandlerFunc(func(ctx stdcontext.Context, req *sdk.HandleRequest) (*sdk.HandleResponse, error) {
+		r := req.Request
+		switch r.Header.Get("X-User") {
+		case "alice":
+			r.Header.Set("X-Tenant", req.Config["tenant"])
+			r.Header.Del("Authorization")
+			r.Path = "/v2" + r.Path
+			r.Body = []byte(strings.ToUpper(string(r.Body)))
+			return &sdk.HandleResponse{Request: r}, nil
+		case "bob":
+			return &sdk.HandleResponse{Response: &sdk.Response{
+				StatusCode: http.StatusForbidden,
+				Header:     http.Header{"X-Filter": {req.Filter}},
+				Body:       []byte("go away"),
+			}}, nil
+		case "carol":
+			return &sdk.HandleResponse{Result: 3}, nil
+		default:
+			return &sdk.HandleResponse{Result: 10}, nil
+		}
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	s := sdk.NewServer(h)
+	go s.Serve(l)
+	return l.Addr().String(), s.Stop
+}
+
+func newTestExternalFilter(t *testing.T, yamlConfig string) *ExternalFilter {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "pipeline", rawSpec)
+	if err != nil {
+		t.Fatalf("failed to create spec: %v", err)
+	}
+	ef := kind.CreateInstance(spec).(*ExternalFilter)
+	ef.Init()
+	return ef
+}
+
+func newContext(user, body string) *context.Context {
+	ctx := context.New(nil)
+	stdReq, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1/orders?id=1", strings.NewReader(body))
+	stdReq.Header.Set("X-User", user)
+	stdReq.Header.Set("Authorization", "Bearer token")
+	req, _ := httpprot.NewRequest(stdReq)
+	req.FetchPayload(0)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestExternalFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	addr, stop := newTestPlugin(t)
+	defer stop()
+
+	ef := newTestExternalFilter(t, `
+kind: ExternalFilter
+name: external
+address: `+addr+`
+maxBodyBytes: 8
+config:
+  tenant: megaease
+`)
+	defer ef.Close()
+
+	ctx := newContext("alice", "hello")
+	assert.Equal("", ef.Handle(ctx))
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("/v2/orders", req.Path())
+	assert.Equal("id=1", req.URL().RawQuery)
+	assert.Equal("megaease", req.HTTPHeader().Get("X-Tenant"))
+	assert.Equal("", req.HTTPHeader().Get("Authorization"))
+	assert.Equal("HELLO", string(req.RawPayload()))
+
+	// the body is omitted and kept as is.
+	ctx = newContext("alice", "a large body")
+	assert.Equal("", ef.Handle(ctx))
+	req = ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("a large body", string(req.RawPayload()))
+
+	ctx = newContext("bob", "")
+	assert.Equal(resultResponseAlready, ef.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusForbidden, resp.StatusCode())
+	assert.Equal("external", resp.HTTPHeader().Get("X-Filter"))
+	assert.Equal("go away", string(resp.RawPayload()))
+
+	assert.Equal("externalResult3", ef.Handle(newContext("carol", "")))
+	assert.Equal(resultFailed, ef.Handle(newContext("dave", "")))
+
+	stop()
+	ctx = newContext("alice", "")
+	assert.Equal(resultFailed, ef.Handle(ctx))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusServiceUnavailable, resp.StatusCode())
+}
+
+func TestFailureModeOpen(t *testing.T) {
+	assert := assert.New(t)
+
+	ef := newTestExternalFilter(t, `
+kind: ExternalFilter
+name: external
+address: 127.0.0.1:1
+timeout: 100ms
+failureMode: open
+`)
+	defer ef.Close()
+
+	ctx := newContext("alice", "")
+	assert.Equal("", ef.Handle(ctx))
+	assert.Nil(ctx.GetOutputResponse())
+}
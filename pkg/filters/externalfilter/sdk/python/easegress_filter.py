@@ -0,0 +1,91 @@
+# Copyright (c) 2017, MegaEase
+# All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+"""Python SDK of the external filter plugins of Easegress.
+
+The messages are generated from filter.proto by grpc_tools:
+
+    python -m grpc_tools.protoc -I ../../proto --python_out=. \
+        --grpc_python_out=. ../../proto/filter.proto
+
+A plugin subclasses Filter and overrides handle:
+
+    class MyFilter(Filter):
+        def handle(self, req, context):
+            set_header(req.request, "X-Plugin", "hello")
+            return HandleResponse(request=req.request)
+
+    serve(MyFilter(), "127.0.0.1:9100")
+"""
+
+from concurrent import futures
+
+import grpc
+
+import filter_pb2
+import filter_pb2_grpc
+
+HandleRequest = filter_pb2.HandleRequest
+HandleResponse = filter_pb2.HandleResponse
+HTTPRequest = filter_pb2.HTTPRequest
+HTTPResponse = filter_pb2.HTTPResponse
+
+# MAX_RESULT is the max result a plugin can return, result 1 to 9 are
+# returned as externalResult1 to externalResult9 by the ExternalFilter.
+MAX_RESULT = 9
+
+
+def get_header(msg, key):
+    """Returns the first value of the header, or None."""
+    key = key.lower()
+    for h in msg.headers:
+        if h.key.lower() == key and h.values:
+            return h.values[0]
+    return None
+
+
+def set_header(msg, key, *values):
+    """Replaces the values of the header, it is deleted if no values."""
+    del_header(msg, key)
+    if values:
+        msg.headers.add(key=key, values=values)
+
+
+def del_header(msg, key):
+    """Deletes the header."""
+    key = key.lower()
+    kept = [h for h in msg.headers if h.key.lower() != key]
+    del msg.headers[:]
+    msg.headers.extend(kept)
+
+
+class Filter(filter_pb2_grpc.FilterServicer):
+    """Filter is the base class of plugins, the request continues by
+    default."""
+
+    def handle(self, req, context):
+        return HandleResponse()
+
+    def Handle(self, request, context):
+        return self.handle(request, context) or HandleResponse()
+
+
+def serve(filter, address, max_workers=16):
+    """Serves the filter on the address until the process is killed."""
+    server = grpc.server(futures.ThreadPoolExecutor(max_workers=max_workers))
+    filter_pb2_grpc.add_FilterServicer_to_server(filter, server)
+    server.add_insecure_port(address)
+    server.start()
+    server.wait_for_termination()
@@ -0,0 +1,516 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package sdk is the Go SDK of the external filter plugins, a plugin is a
+// gRPC server implementing the Filter service defined in
+// pkg/filters/externalfilter/proto/filter.proto.
+//
+// The package depends on gRPC only, the messages are encoded by protowire,
+// so plugins don't need the generated code:
+//
+//	func main() {
+//		sdk.Serve("127.0.0.1:9100", sdk.HandlerFunc(func(ctx context.Context, req *sdk.HandleRequest) (*sdk.HandleResponse, error) {
+//			req.Request.Header.Set("X-Plugin", "hello")
+//			return &sdk.HandleResponse{Request: req.Request}, nil
+//		}))
+//	}
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// ServiceName is the full name of the Filter service.
+	ServiceName = "easegress.filter.v1.Filter"
+	// HandleMethod is the full method name of Filter.Handle.
+	HandleMethod = "/" + ServiceName + "/Handle"
+
+	// MaxResult is the max result a plugin can return.
+	MaxResult = 9
+)
+
+type (
+	// HandleRequest is the request to the plugin.
+	HandleRequest struct {
+		// Filter is the name of the ExternalFilter.
+		Filter string
+		// Config is the config of the ExternalFilter.
+		Config  map[string]string
+		Request *Request
+		// Response is the current response, it is only set by the
+		// RemoteFilter.
+		Response *Response
+	}
+
+	// HandleResponse is the response of the plugin.
+	HandleResponse struct {
+		// Result is the result of the filter, 0 means the pipeline
+		// continues, 1 to MaxResult are returned as externalResult1 to
+		// externalResult9.
+		Result int
+		// Request replaces the request if it is not nil.
+		Request *Request
+		// Response is the response to the client if it is not nil.
+		Response *Response
+	}
+
+	// Request is the HTTP request.
+	Request struct {
+		Method string
+		Path   string
+		Query  string
+		Host   string
+		Scheme string
+		RealIP string
+		Header http.Header
+		Body   []byte
+		// BodyOmitted is true if the body is not sent, or only a prefix of
+		// it is sent, to the plugin, the body of the request is kept if it
+		// is true in HandleResponse.
+		BodyOmitted bool
+	}
+
+	// Response is the HTTP response.
+	Response struct {
+		StatusCode int
+		Header     http.Header
+		Body       []byte
+	}
+
+	// Handler handles the requests of the ExternalFilter.
+	Handler interface {
+		Handle(ctx context.Context, req *HandleRequest) (*HandleResponse, error)
+	}
+
+	// HandlerFunc is an adapter to use functions as Handler.
+	HandlerFunc func(ctx context.Context, req *HandleRequest) (*HandleResponse, error)
+
+	// Codec is the gRPC codec which passes through the messages encoded by
+	// protowire, values must be of type *[]byte.
+	Codec struct{}
+)
+
+// Handle calls f(ctx, req).
+func (f HandlerFunc) Handle(ctx context.Context, req *HandleRequest) (*HandleResponse, error) {
+	return f(ctx, req)
+}
+
+// Marshal returns the message as is.
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	return *(v.(*[]byte)), nil
+}
+
+// Unmarshal copies the message to v.
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	*(v.(*[]byte)) = append([]byte(nil), data...)
+	return nil
+}
+
+// Name returns the name of the codec.
+func (Codec) Name() string {
+	return "proto"
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*Handler)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Handle",
+		Handler:    handle,
+	}},
+	Metadata: "filter.proto",
+}
+
+func handle(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	var in []byte
+	if err := dec(&in); err != nil {
+		return nil, err
+	}
+
+	call := func(ctx context.Context, in interface{}) (interface{}, error) {
+		req, err := UnmarshalHandleRequest(*(in.(*[]byte)))
+		if err != nil {
+			return nil, err
+		}
+		resp, err := srv.(Handler).Handle(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		out := MarshalHandleResponse(resp)
+		return &out, nil
+	}
+
+	if interceptor == nil {
+		return call(ctx, &in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: HandleMethod}
+	return interceptor(ctx, &in, info, call)
+}
+
+// NewServer creates a gRPC server serving the Filter service by h.
+func NewServer(h Handler, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.ForceServerCodec(Codec{}))
+	s := grpc.NewServer(opts...)
+	s.RegisterService(&serviceDesc, h)
+	return s
+}
+
+// Serve listens on the TCP address and serves the Filter service by h,
+// it always returns a non-nil error.
+func Serve(addr string, h Handler) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return NewServer(h).Serve(l)
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	return appendMessage(b, num, v)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// appendHeader appends the repeated Header field, the keys are sorted to
+// make the encoding deterministic.
+//
+//	message Header {
+//	  string key = 1;
+//	  repeated string values = 2;
+//	}
+func appendHeader(b []byte, num protowire.Number, h http.Header) []byte {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		var entry []byte
+		entry = appendString(entry, 1, k)
+		for _, v := range h[k] {
+			entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+			entry = protowire.AppendString(entry, v)
+		}
+		b = appendMessage(b, num, entry)
+	}
+	return b
+}
+
+// walkFields calls fn for each field of a message, value is the content of
+// length delimited fields, and n is the value of varint fields, fields of
+// other wire types are skipped.
+func walkFields(b []byte, fn func(num protowire.Number, value []byte, n uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch typ {
+		case protowire.BytesType:
+			value, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			if err := fn(num, value, 0); err != nil {
+				return err
+			}
+			b = b[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			if err := fn(num, nil, v); err != nil {
+				return err
+			}
+			b = b[n:]
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return nil
+}
+
+func parseHeader(h http.Header, b []byte) error {
+	var key string
+	var values []string
+	err := walkFields(b, func(num protowire.Number, value []byte, _ uint64) error {
+		switch num {
+		case 1:
+			key = string(value)
+		case 2:
+			values = append(values, string(value))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if key != "" {
+		h[http.CanonicalHeaderKey(key)] = append(h[http.CanonicalHeaderKey(key)], values...)
+	}
+	return nil
+}
+
+// marshalRequest encodes the HTTPRequest message.
+//
+//	message HTTPRequest {
+//	  string method = 1;
+//	  string path = 2;
+//	  string query = 3;
+//	  string host = 4;
+//	  string scheme = 5;
+//	  string real_ip = 6;
+//	  repeated Header headers = 7;
+//	  bytes body = 8;
+//	  bool body_omitted = 9;
+//	}
+func marshalRequest(r *Request) []byte {
+	var b []byte
+	b = appendString(b, 1, r.Method)
+	b = appendString(b, 2, r.Path)
+	b = appendString(b, 3, r.Query)
+	b = appendString(b, 4, r.Host)
+	b = appendString(b, 5, r.Scheme)
+	b = appendString(b, 6, r.RealIP)
+	b = appendHeader(b, 7, r.Header)
+	b = appendBytes(b, 8, r.Body)
+	if r.BodyOmitted {
+		b = appendVarint(b, 9, 1)
+	}
+	return b
+}
+
+func unmarshalRequest(b []byte) (*Request, error) {
+	r := &Request{Header: http.Header{}}
+	err := walkFields(b, func(num protowire.Number, value []byte, n uint64) error {
+		switch num {
+		case 1:
+			r.Method = string(value)
+		case 2:
+			r.Path = string(value)
+		case 3:
+			r.Query = string(value)
+		case 4:
+			r.Host = string(value)
+		case 5:
+			r.Scheme = string(value)
+		case 6:
+			r.RealIP = string(value)
+		case 7:
+			return parseHeader(r.Header, value)
+		case 8:
+			r.Body = append([]byte(nil), value...)
+		case 9:
+			r.BodyOmitted = n != 0
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %v", err)
+	}
+	return r, nil
+}
+
+// marshalResponse encodes the HTTPResponse message.
+//
+//	message HTTPResponse {
+//	  int32 status_code = 1;
+//	  repeated Header headers = 2;
+//	  bytes body = 3;
+//	}
+func marshalResponse(r *Response) []byte {
+	var b []byte
+	b = appendVarint(b, 1, uint64(r.StatusCode))
+	b = appendHeader(b, 2, r.Header)
+	return appendBytes(b, 3, r.Body)
+}
+
+func unmarshalResponse(b []byte) (*Response, error) {
+	r := &Response{Header: http.Header{}}
+	err := walkFields(b, func(num protowire.Number, value []byte, n uint64) error {
+		switch num {
+		case 1:
+			r.StatusCode = int(int32(n))
+		case 2:
+			return parseHeader(r.Header, value)
+		case 3:
+			r.Body = append([]byte(nil), value...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid response: %v", err)
+	}
+	return r, nil
+}
+
+// MarshalHandleRequest encodes the HandleRequest message.
+//
+//	message HandleRequest {
+//	  string filter = 1;
+//	  map<string, string> config = 2;
+//	  HTTPRequest request = 3;
+//	  HTTPResponse response = 4;
+//	}
+func MarshalHandleRequest(req *HandleRequest) []byte {
+	var b []byte
+	b = appendString(b, 1, req.Filter)
+
+	keys := make([]string, 0, len(req.Config))
+	for k := range req.Config {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var entry []byte
+		entry = appendString(entry, 1, k)
+		entry = appendString(entry, 2, req.Config[k])
+		b = appendMessage(b, 2, entry)
+	}
+
+	if req.Request != nil {
+		b = appendMessage(b, 3, marshalRequest(req.Request))
+	}
+	if req.Response != nil {
+		b = appendMessage(b, 4, marshalResponse(req.Response))
+	}
+	return b
+}
+
+// UnmarshalHandleRequest decodes the HandleRequest message.
+func UnmarshalHandleRequest(b []byte) (*HandleRequest, error) {
+	req := &HandleRequest{Config: map[string]string{}}
+	err := walkFields(b, func(num protowire.Number, value []byte, _ uint64) error {
+		switch num {
+		case 1:
+			req.Filter = string(value)
+		case 2:
+			var k, v string
+			err := walkFields(value, func(num protowire.Number, value []byte, _ uint64) error {
+				switch num {
+				case 1:
+					k = string(value)
+				case 2:
+					v = string(value)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			req.Config[k] = v
+		case 3:
+			r, err := unmarshalRequest(value)
+			if err != nil {
+				return err
+			}
+			req.Request = r
+		case 4:
+			r, err := unmarshalResponse(value)
+			if err != nil {
+				return err
+			}
+			req.Response = r
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// MarshalHandleResponse encodes the HandleResponse message.
+//
+//	message HandleResponse {
+//	  int32 result = 1;
+//	  HTTPRequest request = 2;
+//	  HTTPResponse response = 3;
+//	}
+func MarshalHandleResponse(resp *HandleResponse) []byte {
+	var b []byte
+	if resp == nil {
+		return b
+	}
+	b = appendVarint(b, 1, uint64(resp.Result))
+	if resp.Request != nil {
+		b = appendMessage(b, 2, marshalRequest(resp.Request))
+	}
+	if resp.Response != nil {
+		b = appendMessage(b, 3, marshalResponse(resp.Response))
+	}
+	return b
+}
+
+// UnmarshalHandleResponse decodes the HandleResponse message.
+func UnmarshalHandleResponse(b []byte) (*HandleResponse, error) {
+	resp := &HandleResponse{}
+	err := walkFields(b, func(num protowire.Number, value []byte, n uint64) error {
+		var err error
+		switch num {
+		case 1:
+			resp.Result = int(int32(n))
+		case 2:
+			resp.Request, err = unmarshalRequest(value)
+		case 3:
+			resp.Response, err = unmarshalResponse(value)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sdk
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalHandleRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	req := &HandleRequest{
+		Filter: "external",
+		Config: map[string]string{"a": "1", "b": "2"},
+		Request: &Request{
+			Method: http.MethodPost,
+			Path:   "/orders",
+			Query:  "id=1",
+			Host:   "example.com",
+			Scheme: "https",
+			RealIP: "10.0.0.1",
+			Header: http.Header{"X-A": {"1", "2"}, "X-B": {"3"}},
+			Body:   []byte("hello"),
+		},
+		Response: &Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"text/plain"}},
+		},
+	}
+
+	b := MarshalHandleRequest(req)
+	assert.Equal(b, MarshalHandleRequest(req))
+
+	req2, err := UnmarshalHandleRequest(b)
+	assert.NoError(err)
+	assert.Equal(req, req2)
+
+	_, err = UnmarshalHandleRequest([]byte{0x1a, 0xff})
+	assert.Error(err)
+}
+
+func TestMarshalHandleResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	resp := &HandleResponse{
+		Result: 2,
+		Request: &Request{
+			Path:        "/v2/orders",
+			Header:      http.Header{},
+			BodyOmitted: true,
+		},
+		Response: &Response{
+			StatusCode: http.StatusForbidden,
+			Header:     http.Header{"Www-Authenticate": {"Bearer"}},
+			Body:       []byte("go away"),
+		},
+	}
+
+	resp2, err := UnmarshalHandleResponse(MarshalHandleResponse(resp))
+	assert.NoError(err)
+	assert.Equal(resp, resp2)
+
+	resp2, err = UnmarshalHandleResponse(MarshalHandleResponse(nil))
+	assert.NoError(err)
+	assert.Equal(&HandleResponse{}, resp2)
+
+	resp = &HandleResponse{Result: -1}
+	resp2, _ = UnmarshalHandleResponse(MarshalHandleResponse(resp))
+	assert.Equal(-1, resp2.Result)
+}
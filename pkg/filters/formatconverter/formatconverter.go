@@ -0,0 +1,336 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package formatconverter implements the FormatConverter filter.
+package formatconverter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// Kind is the kind of FormatConverter.
+	Kind = "FormatConverter"
+
+	resultConvertFailed = "convertFailed"
+
+	targetRequest  = "request"
+	targetResponse = "response"
+
+	formatJSON = "json"
+	formatXML  = "xml"
+	formatYAML = "yaml"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "FormatConverter converts the body of the request or response between JSON, XML and YAML",
+	Results:     []string{resultConvertFailed},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{Target: targetResponse}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &FormatConverter{spec: spec.(*Spec)}
+	},
+}
+
+// mediaTypes are the media types of the converted bodies.
+var mediaTypes = map[string]string{
+	formatJSON: "application/json",
+	formatXML:  "application/xml",
+	formatYAML: "application/yaml",
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// FormatConverter is filter FormatConverter.
+	FormatConverter struct {
+		spec *Spec
+		xml  *xmlCodec
+	}
+
+	// Spec describes the FormatConverter.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Target string   `json:"target" jsonschema:"omitempty,enum=request,enum=response"`
+		To     string   `json:"to" jsonschema:"omitempty,enum=,enum=json,enum=xml,enum=yaml"`
+		XML    *XMLSpec `json:"xml,omitempty" jsonschema:"omitempty"`
+	}
+
+	// XMLSpec describes how XML documents are mapped to JSON and YAML.
+	XMLSpec struct {
+		// AttributePrefix is prepended to the names of the attributes,
+		// default is @.
+		AttributePrefix string `json:"attributePrefix" jsonschema:"omitempty"`
+		// TextKey is the key of the text of an element with attributes
+		// or child elements, default is #text.
+		TextKey string `json:"textKey" jsonschema:"omitempty"`
+		// ArrayElements are the names of the elements which are always
+		// converted to arrays, even if there's only one of them.
+		ArrayElements []string `json:"arrayElements" jsonschema:"omitempty,uniqueItems=true"`
+		// InferTypes converts the texts like numbers or booleans to
+		// numbers or booleans, they are strings otherwise.
+		InferTypes bool `json:"inferTypes" jsonschema:"omitempty"`
+		// RootElement is the name of the root element when converting to
+		// XML, default is root.
+		RootElement string `json:"rootElement" jsonschema:"omitempty"`
+		// ItemElement is the name of the elements of an array document
+		// when converting to XML, default is item.
+		ItemElement string `json:"itemElement" jsonschema:"omitempty"`
+		Indent      bool   `json:"indent" jsonschema:"omitempty"`
+	}
+
+	// message is the common part of httpprot.Request and
+	// httpprot.Response used by FormatConverter.
+	message interface {
+		HTTPHeader() http.Header
+		IsStream() bool
+		RawPayload() []byte
+		SetPayload(payload interface{})
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if spec.Target == targetRequest && spec.To == "" {
+		return fmt.Errorf("to must be specified when target is request")
+	}
+	return nil
+}
+
+// Name returns the name of the FormatConverter filter instance.
+func (fc *FormatConverter) Name() string {
+	return fc.spec.Name()
+}
+
+// Kind returns the kind of FormatConverter.
+func (fc *FormatConverter) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the FormatConverter.
+func (fc *FormatConverter) Spec() filters.Spec {
+	return fc.spec
+}
+
+// Init initializes FormatConverter.
+func (fc *FormatConverter) Init() {
+	fc.reload()
+}
+
+// Inherit inherits previous generation of FormatConverter.
+func (fc *FormatConverter) Inherit(previousGeneration filters.Filter) {
+	fc.reload()
+}
+
+func (fc *FormatConverter) reload() {
+	spec := XMLSpec{}
+	if fc.spec.XML != nil {
+		spec = *fc.spec.XML
+	}
+	if spec.AttributePrefix == "" {
+		spec.AttributePrefix = "@"
+	}
+	if spec.TextKey == "" {
+		spec.TextKey = "#text"
+	}
+	if spec.RootElement == "" {
+		spec.RootElement = "root"
+	}
+	if spec.ItemElement == "" {
+		spec.ItemElement = "item"
+	}
+	fc.xml = newXMLCodec(&spec)
+}
+
+// formatOf returns the format of the media type, or an empty string if
+// the format is not supported.
+func formatOf(mediaType string) string {
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return formatJSON
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return formatXML
+	case mediaType == "application/yaml" || mediaType == "application/x-yaml" ||
+		mediaType == "text/yaml" || mediaType == "text/x-yaml" || strings.HasSuffix(mediaType, "+yaml"):
+		return formatYAML
+	}
+	return ""
+}
+
+// negotiate returns the format to convert to according to the Accept
+// header, it returns the current format if it is acceptable, or an empty
+// string if none of the formats is acceptable.
+func negotiate(accept string, current string) string {
+	type acceptItem struct {
+		mediaType string
+		q         float64
+	}
+
+	var items []acceptItem
+	for _, s := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(s))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			items = append(items, acceptItem{mediaType: mediaType, q: q})
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].q > items[j].q
+	})
+
+	for _, item := range items {
+		if item.mediaType == "*/*" {
+			return current
+		}
+		if f := formatOf(item.mediaType); f != "" {
+			return f
+		}
+	}
+	return ""
+}
+
+// Handle converts the body.
+func (fc *FormatConverter) Handle(ctx *context.Context) string {
+	req, ok := ctx.GetInputRequest().(*httpprot.Request)
+	if !ok {
+		return resultConvertFailed
+	}
+
+	var msg message = req
+	if fc.spec.Target == targetResponse {
+		resp, ok := ctx.GetOutputResponse().(*httpprot.Response)
+		if !ok {
+			return resultConvertFailed
+		}
+		msg = resp
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(msg.HTTPHeader().Get("Content-Type"))
+	from := formatOf(mediaType)
+	if from == "" {
+		return ""
+	}
+
+	to := fc.spec.To
+	if to == "" {
+		accept := req.HTTPHeader().Get("Accept")
+		if accept == "" {
+			return ""
+		}
+		to = negotiate(accept, from)
+	}
+	if to == "" || to == from {
+		return ""
+	}
+
+	if msg.IsStream() {
+		logger.Warnf("%s: cannot convert a stream body", fc.Name())
+		return resultConvertFailed
+	}
+
+	body := msg.RawPayload()
+	if len(bytes.TrimSpace(body)) == 0 {
+		return ""
+	}
+
+	data, err := fc.convert(body, from, to)
+	if err != nil {
+		logger.Debugf("%s: failed to convert body from %s to %s: %v", fc.Name(), from, to, err)
+		return resultConvertFailed
+	}
+
+	msg.SetPayload(data)
+	msg.HTTPHeader().Set("Content-Type", mediaTypes[to])
+	msg.HTTPHeader().Del("Content-Length")
+	return ""
+}
+
+func (fc *FormatConverter) convert(body []byte, from, to string) ([]byte, error) {
+	var doc interface{}
+	var err error
+
+	switch from {
+	case formatXML:
+		doc, err = fc.xml.decode(body)
+	case formatYAML:
+		if body, err = codectool.YAMLToJSON(body); err == nil {
+			doc, err = decodeJSON(body)
+		}
+	default:
+		doc, err = decodeJSON(body)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch to {
+	case formatXML:
+		return fc.xml.encode(doc)
+	case formatYAML:
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		return codectool.JSONToYAML(data)
+	default:
+		return json.Marshal(doc)
+	}
+}
+
+func decodeJSON(data []byte) (interface{}, error) {
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// keep numbers as is, large integers would lose precision otherwise.
+	decoder.UseNumber()
+	err := decoder.Decode(&doc)
+	return doc, err
+}
+
+// Status returns status.
+func (fc *FormatConverter) Status() interface{} {
+	return nil
+}
+
+// Close closes FormatConverter.
+func (fc *FormatConverter) Close() {
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package formatconverter
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newFormatConverter(t *testing.T, yamlConfig string) *FormatConverter {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	fc := kind.CreateInstance(spec).(*FormatConverter)
+	fc.Init()
+	return fc
+}
+
+func newContext(accept, contentType, body string) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://megaease.com/abc", nil)
+	stdr.Header.Set("Accept", accept)
+	req, _ := httpprot.NewRequest(stdr)
+	ctx.SetInputRequest(req)
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.HTTPHeader().Set("Content-Type", contentType)
+	resp.SetPayload(body)
+	ctx.SetOutputResponse(resp)
+	return ctx
+}
+
+func TestXMLToJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	fc := newFormatConverter(t, `
+kind: FormatConverter
+name: converter
+xml:
+  arrayElements: [tag]
+  inferTypes: true
+`)
+
+	body := `<?xml version="1.0" encoding="UTF-8"?>
+<order id="7">
+  <item>a</item>
+  <item>b</item>
+  <tag>new</tag>
+  <price currency="USD">9.5</price>
+</order>`
+	ctx := newContext("application/json", "text/xml; charset=utf-8", body)
+	assert.Equal("", fc.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("application/json", resp.HTTPHeader().Get("Content-Type"))
+	assert.JSONEq(`{"@id":7,"item":["a","b"],"tag":["new"],"price":{"@currency":"USD","#text":9.5}}`, string(resp.RawPayload()))
+
+	// the current format is acceptable.
+	ctx = newContext("application/json;q=0.5, */*", "application/xml", body)
+	assert.Equal("", fc.Handle(ctx))
+	assert.Equal(body, string(ctx.GetOutputResponse().RawPayload()))
+
+	// no format is acceptable.
+	ctx = newContext("text/html", "application/xml", body)
+	assert.Equal("", fc.Handle(ctx))
+	assert.Equal(body, string(ctx.GetOutputResponse().RawPayload()))
+
+	ctx = newContext("application/json", "application/xml", "<order>")
+	assert.Equal(resultConvertFailed, fc.Handle(ctx))
+}
+
+func TestJSONToXMLAndYAML(t *testing.T) {
+	assert := assert.New(t)
+
+	fc := newFormatConverter(t, `
+kind: FormatConverter
+name: converter
+target: request
+to: xml
+xml:
+  rootElement: order
+`)
+
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodPost, "http://megaease.com/abc", nil)
+	stdr.Header.Set("Content-Type", "application/json")
+	req, _ := httpprot.NewRequest(stdr)
+	req.SetPayload(`{"@id": 7, "item": ["a", "b"], "price": {"@currency": "USD", "#text": 9.5}, "note": null}`)
+	ctx.SetInputRequest(req)
+
+	assert.Equal("", fc.Handle(ctx))
+	assert.Equal("application/xml", req.HTTPHeader().Get("Content-Type"))
+	assert.Equal(`<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<order id="7"><item>a</item><item>b</item><note></note><price currency="USD">9.5</price></order>`,
+		string(req.RawPayload()))
+
+	fc = newFormatConverter(t, `
+kind: FormatConverter
+name: converter
+to: yaml
+`)
+	ctx = newContext("", "application/json", `{"name": "easegress", "ports": [80, 443]}`)
+	assert.Equal("", fc.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("application/yaml", resp.HTTPHeader().Get("Content-Type"))
+	assert.Equal("name: easegress\nports:\n- 80\n- 443\n", string(resp.RawPayload()))
+
+	// to is required when target is request.
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte("kind: FormatConverter\nname: converter\ntarget: request"), &rawSpec)
+	_, err := filters.NewSpec(nil, "", rawSpec)
+	assert.Error(err)
+}
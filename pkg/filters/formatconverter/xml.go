@@ -0,0 +1,257 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package formatconverter
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// xmlCodec converts XML documents from and to generic values, which are
+// the values decoded from JSON.
+//
+// An element is converted to a string if it has neither attributes nor
+// child elements, otherwise, it is converted to a map, its attributes
+// are saved with the attribute prefix, its text is saved with the text
+// key, and its child elements are saved with their names, children of
+// the same name are saved as an array. The root element is omitted, that
+// is, the value of the root element is the document.
+type xmlCodec struct {
+	spec   *XMLSpec
+	arrays map[string]struct{}
+}
+
+func newXMLCodec(spec *XMLSpec) *xmlCodec {
+	c := &xmlCodec{spec: spec, arrays: map[string]struct{}{}}
+	for _, name := range spec.ArrayElements {
+		c.arrays[name] = struct{}{}
+	}
+	return c
+}
+
+// xmlElement is an element being decoded.
+type xmlElement struct {
+	name     string
+	attrs    []xml.Attr
+	children map[string]interface{}
+	text     strings.Builder
+}
+
+func (c *xmlCodec) decode(data []byte) (interface{}, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	// the charset is not supported by the standard library, the data is
+	// treated as UTF-8.
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	var stack []*xmlElement
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no root element")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, &xmlElement{name: t.Name.Local, attrs: t.Attr})
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		case xml.EndElement:
+			e := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			v := c.elementValue(e)
+			if len(stack) == 0 {
+				return v, nil
+			}
+			c.addChild(stack[len(stack)-1], e.name, v)
+		}
+	}
+}
+
+func (c *xmlCodec) addChild(parent *xmlElement, name string, v interface{}) {
+	if parent.children == nil {
+		parent.children = map[string]interface{}{}
+	}
+
+	old, ok := parent.children[name]
+	if !ok {
+		if _, array := c.arrays[name]; array {
+			v = []interface{}{v}
+		}
+		parent.children[name] = v
+		return
+	}
+
+	if a, ok := old.([]interface{}); ok {
+		parent.children[name] = append(a, v)
+	} else {
+		parent.children[name] = []interface{}{old, v}
+	}
+}
+
+func (c *xmlCodec) elementValue(e *xmlElement) interface{} {
+	text := strings.TrimSpace(e.text.String())
+	if len(e.attrs) == 0 && len(e.children) == 0 {
+		return c.scalar(text)
+	}
+
+	m := make(map[string]interface{}, len(e.attrs)+len(e.children)+1)
+	for _, attr := range e.attrs {
+		// namespace declarations are not data.
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		m[c.spec.AttributePrefix+attr.Name.Local] = c.scalar(attr.Value)
+	}
+	for name, v := range e.children {
+		m[name] = v
+	}
+	if text != "" {
+		m[c.spec.TextKey] = c.scalar(text)
+	}
+	return m
+}
+
+// scalar converts text to a number or a boolean if types are inferred.
+func (c *xmlCodec) scalar(text string) interface{} {
+	if !c.spec.InferTypes {
+		return text
+	}
+	switch text {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if _, err := strconv.ParseFloat(text, 64); err == nil && json.Valid([]byte(text)) {
+		return json.Number(text)
+	}
+	return text
+}
+
+func (c *xmlCodec) encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	encoder := xml.NewEncoder(&buf)
+	if c.spec.Indent {
+		encoder.Indent("", "  ")
+	}
+
+	// an array document is encoded as the items of the root element.
+	if a, ok := v.([]interface{}); ok {
+		v = map[string]interface{}{c.spec.ItemElement: a}
+	}
+	if err := c.encodeElement(encoder, c.spec.RootElement, v); err != nil {
+		return nil, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *xmlCodec) encodeElement(encoder *xml.Encoder, name string, v interface{}) error {
+	// an array is encoded as elements of the same name.
+	if a, ok := v.([]interface{}); ok {
+		for _, item := range a {
+			if err := c.encodeElement(encoder, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		if err := encoder.EncodeToken(start); err != nil {
+			return err
+		}
+		if v != nil {
+			if err := encoder.EncodeToken(xml.CharData(formatScalar(v))); err != nil {
+				return err
+			}
+		}
+		return encoder.EncodeToken(start.End())
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	prefix := c.spec.AttributePrefix
+	var children []string
+	for _, k := range keys {
+		if prefix != "" && strings.HasPrefix(k, prefix) {
+			attr := xml.Attr{Name: xml.Name{Local: k[len(prefix):]}, Value: formatScalar(m[k])}
+			start.Attr = append(start.Attr, attr)
+		} else if k != c.spec.TextKey {
+			children = append(children, k)
+		}
+	}
+
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	if text, ok := m[c.spec.TextKey]; ok && text != nil {
+		if err := encoder.EncodeToken(xml.CharData(formatScalar(text))); err != nil {
+			return err
+		}
+	}
+	for _, k := range children {
+		if err := c.encodeElement(encoder, k, m[k]); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+// formatScalar formats a scalar value as text, composite values are
+// formatted as JSON.
+func formatScalar(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
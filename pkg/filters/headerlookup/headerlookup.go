@@ -18,16 +18,15 @@
 package headerlookup
 
 import (
-	stdcontext "context"
 	"fmt"
 	"net/http"
 	"regexp"
 	"strings"
-	"time"
 
 	lru "github.com/hashicorp/golang-lru"
 
 	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/customdata"
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/filters"
 	"github.com/megaease/easegress/pkg/logger"
@@ -46,7 +45,7 @@ const (
 
 var kind = &filters.Kind{
 	Name:        Kind,
-	Description: "HeaderLookup enriches request headers per request, looking up values from etcd.",
+	Description: "HeaderLookup enriches request headers per request, looking up values from etcd or an HTTP endpoint.",
 	Results:     []string{},
 	DefaultSpec: func() filters.Spec {
 		return &Spec{}
@@ -61,23 +60,34 @@ func init() {
 }
 
 type (
-	// HeaderLookup retrieves values from etcd to headers.
+	// HeaderLookup retrieves values from etcd or an HTTP endpoint to
+	// headers or context data.
 	HeaderLookup struct {
 		spec       *Spec
 		etcdPrefix string
 		headerKey  string
 		pathRegExp *regexp.Regexp
+		httpSource *httpSource
 
 		cache   *lru.Cache
 		cluster cluster.Cluster
-		stopCtx stdcontext.Context
-		cancel  stdcontext.CancelFunc
+		watcher *customdata.Watcher
 	}
 
-	// HeaderSetterSpec defines etcd source key and request destination header.
+	// Status is the status of HeaderLookup.
+	Status struct {
+		// Data lists the invalid items under the etcd prefix, which
+		// are ignored by the filter.
+		Data *customdata.WatcherStatus `json:"data,omitempty"`
+	}
+
+	// HeaderSetterSpec defines the source key and the request destination
+	// header or context data. Though named EtcdKey, the source key is also
+	// used for other sources.
 	HeaderSetterSpec struct {
 		EtcdKey   string `json:"etcdKey,omitempty" jsonschema:"omitempty"`
 		HeaderKey string `json:"headerKey,omitempty" jsonschema:"omitempty"`
+		DataKey   string `json:"dataKey,omitempty" jsonschema:"omitempty"`
 	}
 
 	// Spec defines header key and etcd prefix that form etcd key like /custom-data/{etcdPrefix}/{headerKey's value}.
@@ -88,11 +98,14 @@ type (
 	// /custom-data/{etcdPrefix}/{headerKey's value}-{regex group} . For example, for path
 	// "/api/bananas/33" and pathRegExp: "^/api/([a-z]+)/[0-9]*", the group "bananas" is extracted and etcd key is
 	// /custom-data/{etcdPrefix}/{headerKey's value}-bananas.
+	// When HTTP is defined, the values are retrieved from an HTTP endpoint
+	// instead of etcd, and EtcdPrefix must be empty.
 	Spec struct {
 		filters.BaseSpec `json:",inline"`
 
 		HeaderKey     string              `json:"headerKey" jsonschema:"required"`
-		EtcdPrefix    string              `json:"etcdPrefix" jsonschema:"required"`
+		EtcdPrefix    string              `json:"etcdPrefix" jsonschema:"omitempty"`
+		HTTP          *HTTPSourceSpec     `json:"http,omitempty" jsonschema:"omitempty"`
 		PathRegExp    string              `json:"pathRegExp" jsonschema:"omitempty"`
 		HeaderSetters []*HeaderSetterSpec `json:"headerSetters" jsonschema:"required"`
 	}
@@ -103,8 +116,11 @@ func (spec Spec) Validate() error {
 	if spec.HeaderKey == "" {
 		return fmt.Errorf("headerKey is required")
 	}
-	if spec.EtcdPrefix == "" {
-		return fmt.Errorf("etcdPrefix is required")
+	if spec.EtcdPrefix == "" && spec.HTTP == nil {
+		return fmt.Errorf("etcdPrefix or http is required")
+	}
+	if spec.EtcdPrefix != "" && spec.HTTP != nil {
+		return fmt.Errorf("etcdPrefix and http are mutually exclusive")
 	}
 	if len(spec.HeaderSetters) < 1 {
 		return fmt.Errorf("at least one headerSetter is required")
@@ -113,8 +129,8 @@ func (spec Spec) Validate() error {
 		if hs.EtcdKey == "" {
 			return fmt.Errorf("headerSetters[i].etcdKey is required")
 		}
-		if hs.HeaderKey == "" {
-			return fmt.Errorf("headerSetters[i].headerKey is required")
+		if hs.HeaderKey == "" && hs.DataKey == "" {
+			return fmt.Errorf("headerSetters[i].headerKey or headerSetters[i].dataKey is required")
 		}
 	}
 
@@ -148,8 +164,11 @@ func (hl *HeaderLookup) Init() {
 	hl.etcdPrefix = customDataPrefix + strings.TrimPrefix(hl.spec.EtcdPrefix, "/")
 	hl.headerKey = http.CanonicalHeaderKey(hl.spec.HeaderKey)
 	hl.cache, _ = lru.New(cacheSize)
-	hl.stopCtx, hl.cancel = stdcontext.WithCancel(stdcontext.Background())
 	hl.pathRegExp = regexp.MustCompile(hl.spec.PathRegExp)
+	if spec.HTTP != nil {
+		hl.httpSource = newHTTPSource(spec.HTTP)
+		return
+	}
 	hl.watchChanges()
 }
 
@@ -158,7 +177,12 @@ func (hl *HeaderLookup) Inherit(previousGeneration filters.Filter) {
 	hl.Init()
 }
 
+// lookup returns the values of the source keys of the header setters.
 func (hl *HeaderLookup) lookup(headerVal string) (map[string]string, error) {
+	if hl.httpSource != nil {
+		return hl.lookupHTTP(headerVal)
+	}
+
 	if val, ok := hl.cache.Get(hl.etcdPrefix + headerVal); ok {
 		return val.(map[string]string), nil
 	}
@@ -170,19 +194,28 @@ func (hl *HeaderLookup) lookup(headerVal string) (map[string]string, error) {
 	if etcdVal == nil {
 		return nil, fmt.Errorf("no data for key %s found", hl.etcdPrefix+headerVal)
 	}
-	result := make(map[string]string, len(hl.spec.HeaderSetters))
-	etcdValues := make(map[string]string)
-	err = codectool.Unmarshal([]byte(*etcdVal), &etcdValues)
+	result, err := hl.extract([]byte(*etcdVal))
 	if err != nil {
 		return nil, err
 	}
+
+	hl.cache.Add(hl.etcdPrefix+headerVal, result)
+	return result, nil
+}
+
+// extract decodes data and returns the values of the source keys.
+func (hl *HeaderLookup) extract(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	if err := codectool.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(hl.spec.HeaderSetters))
 	for _, setter := range hl.spec.HeaderSetters {
-		if val, ok := etcdValues[setter.EtcdKey]; ok {
-			result[setter.HeaderKey] = val
+		if val, ok := values[setter.EtcdKey]; ok {
+			result[setter.EtcdKey] = val
 		}
 	}
-
-	hl.cache.Add(hl.etcdPrefix+headerVal, result)
 	return result, nil
 }
 
@@ -206,52 +239,34 @@ func findKeysToDelete(kvs map[string]string, cache *lru.Cache) []string {
 	return keysToDelete
 }
 
+// watchChanges purges the changed items from the cache, the items which
+// can't be extracted are reported by the status.
 func (hl *HeaderLookup) watchChanges() {
-	var (
-		syncer cluster.Syncer
-		err    error
-		ch     <-chan map[string]string
-	)
-
-	for {
-		syncer, err = hl.cluster.Syncer(30 * time.Minute)
-		if err != nil {
-			logger.Errorf("failed to create syncer: %v", err)
-		} else if ch, err = syncer.SyncPrefix(hl.etcdPrefix); err != nil {
-			logger.Errorf("failed to sync prefix: %v", err)
-			syncer.Close()
-		} else {
-			break
-		}
-
-		select {
-		case <-time.After(10 * time.Second):
-		case <-hl.stopCtx.Done():
-			return
+	layout := hl.cluster.Layout()
+	store := customdata.NewStore(hl.cluster, layout.CustomDataKindPrefix(), layout.CustomDataPrefix())
+	decode := func(key string, value []byte) (interface{}, error) {
+		if _, err := hl.extract(value); err != nil {
+			return nil, err
 		}
+		return string(value), nil
 	}
-	// start listening in background
-	go func() {
-		defer syncer.Close()
-
-		for {
-			select {
-			case <-hl.stopCtx.Done():
-				return
-			case kvs := <-ch:
-				logger.Infof("HeaderLookup update")
-				keysToDelete := findKeysToDelete(kvs, hl.cache)
-				for _, cacheKey := range keysToDelete {
-					hl.cache.Remove(cacheKey)
-				}
-			}
+	hl.watcher = store.NewWatcher(strings.TrimPrefix(hl.etcdPrefix, customDataPrefix), decode, func(items map[string]interface{}) {
+		logger.Infof("HeaderLookup update")
+		kvs := make(map[string]string, len(items))
+		for k, item := range items {
+			kvs[k] = item.(string)
+		}
+		for _, cacheKey := range findKeysToDelete(kvs, hl.cache) {
+			hl.cache.Remove(cacheKey)
 		}
-	}()
+	})
 }
 
 // Close closes HeaderLookup.
 func (hl *HeaderLookup) Close() {
-	hl.cancel()
+	if hl.watcher != nil {
+		hl.watcher.Close()
+	}
 }
 
 // Handle retrieves header values and sets request headers.
@@ -271,16 +286,30 @@ func (hl *HeaderLookup) Handle(ctx *context.Context) string {
 			headerVal = headerVal + "-" + match[1]
 		}
 	}
-	headersToAdd, err := hl.lookup(headerVal)
+	values, err := hl.lookup(headerVal)
 	if err != nil {
 		logger.Errorf(err.Error())
 		return ""
 	}
-	for hk, hv := range headersToAdd {
-		header.Set(hk, hv)
+	for _, setter := range hl.spec.HeaderSetters {
+		val, ok := values[setter.EtcdKey]
+		if !ok {
+			continue
+		}
+		if setter.HeaderKey != "" {
+			header.Set(setter.HeaderKey, val)
+		}
+		if setter.DataKey != "" {
+			ctx.SetData(setter.DataKey, val)
+		}
 	}
 	return ""
 }
 
 // Status returns status.
-func (hl *HeaderLookup) Status() interface{} { return nil }
+func (hl *HeaderLookup) Status() interface{} {
+	if hl.watcher == nil {
+		return nil
+	}
+	return &Status{Data: hl.watcher.Status()}
+}
@@ -19,9 +19,11 @@ package headerlookup
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -255,7 +257,7 @@ extra-entry: "extra"
 	hl.Handle(ctx) // get updated value
 	assert.Equal(0, len(header.Get("user-ext-id")))
 
-	assert.Nil(hl.Status())
+	assert.NotNil(hl.Status().(*Status).Data)
 	assert.NotEqual(0, len(hl.Kind().Description))
 	close(syncerChannel)
 }
@@ -313,3 +315,68 @@ extra-entry: "extra"
 
 	hl.Close()
 }
+
+func TestHandleHTTPSource(t *testing.T) {
+	assert := assert.New(t)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		assert.Equal("secret", r.Header.Get("X-Token"))
+		if r.URL.Path != "/tenants/t1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"plan": "gold", "region": "eu"}`))
+	}))
+	defer server.Close()
+
+	config := `
+name: headerLookup
+kind: HeaderLookup
+headerKey: "X-Tenant"
+http:
+  url: ` + server.URL + `/tenants/{key}
+  headers:
+    X-Token: secret
+headerSetters:
+  - etcdKey: plan
+    headerKey: X-Plan
+  - etcdKey: region
+    dataKey: region
+`
+	hl, err := createHeaderLookup(config, nil, nil)
+	assert.Nil(err)
+	defer hl.Close()
+
+	ctx, header := prepareCtxAndHeader(t)
+	header.Set("X-Tenant", "t1")
+	hl.Handle(ctx)
+	assert.Equal("gold", header.Get("X-Plan"))
+	assert.Equal("eu", ctx.GetData("region"))
+
+	// from cache
+	hl.Handle(ctx)
+	assert.Equal(int32(1), atomic.LoadInt32(&calls))
+
+	// not found
+	ctx, header = prepareCtxAndHeader(t)
+	header.Set("X-Tenant", "t2")
+	hl.Handle(ctx)
+	hl.Handle(ctx)
+	assert.Equal("", header.Get("X-Plan"))
+	assert.Equal(int32(2), atomic.LoadInt32(&calls))
+
+	invalid := `
+name: headerLookup
+kind: HeaderLookup
+headerKey: "X-Tenant"
+http:
+  url: http://127.0.0.1/tenants
+headerSetters:
+  - etcdKey: plan
+    headerKey: X-Plan
+`
+	_, err = createHeaderLookup(invalid, nil, nil)
+	assert.NotNil(err)
+}
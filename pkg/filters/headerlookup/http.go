@@ -0,0 +1,144 @@
+/*
+* Copyright (c) 2017, MegaEase
+* All rights reserved.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package headerlookup
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+const (
+	keyPlaceholder = "{key}"
+
+	defaultHTTPTimeout  = 3 * time.Second
+	defaultHTTPCacheTTL = time.Minute
+
+	// the max size of the response body of the HTTP source.
+	maxHTTPBodySize = 1024 * 1024
+)
+
+type (
+	// HTTPSourceSpec defines an HTTP endpoint to look up values from.
+	// The endpoint must return a JSON or YAML object in the body, and
+	// 404 means there's no data for the key.
+	HTTPSourceSpec struct {
+		// URL is the URL of the endpoint, {key} in it is replaced with
+		// the (escaped) lookup key, for example: http://127.0.0.1:8080/tenants/{key}
+		URL      string            `json:"url" jsonschema:"required,format=url"`
+		Headers  map[string]string `json:"headers" jsonschema:"omitempty"`
+		Timeout  string            `json:"timeout" jsonschema:"omitempty,format=duration"`
+		CacheTTL string            `json:"cacheTTL" jsonschema:"omitempty,format=duration"`
+	}
+
+	httpSource struct {
+		spec     *HTTPSourceSpec
+		client   *http.Client
+		cacheTTL time.Duration
+	}
+
+	httpCacheEntry struct {
+		values   map[string]string
+		expireAt time.Time
+	}
+)
+
+// Validate validates HTTPSourceSpec.
+func (spec *HTTPSourceSpec) Validate() error {
+	if !strings.Contains(spec.URL, keyPlaceholder) {
+		return fmt.Errorf("url must contain %s", keyPlaceholder)
+	}
+	return nil
+}
+
+func newHTTPSource(spec *HTTPSourceSpec) *httpSource {
+	timeout := defaultHTTPTimeout
+	if spec.Timeout != "" {
+		timeout, _ = time.ParseDuration(spec.Timeout)
+	}
+
+	cacheTTL := defaultHTTPCacheTTL
+	if spec.CacheTTL != "" {
+		cacheTTL, _ = time.ParseDuration(spec.CacheTTL)
+	}
+
+	return &httpSource{
+		spec:     spec,
+		client:   &http.Client{Timeout: timeout},
+		cacheTTL: cacheTTL,
+	}
+}
+
+// fetch fetches the data of key, nil is returned if there's no data.
+func (hs *httpSource) fetch(key string) ([]byte, error) {
+	u := strings.ReplaceAll(hs.spec.URL, keyPlaceholder, url.PathEscape(key))
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range hs.spec.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := hs.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, u)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxHTTPBodySize))
+}
+
+// lookupHTTP looks up the values of key from the HTTP source, results
+// (including the not found ones) are cached for cacheTTL.
+func (hl *HeaderLookup) lookupHTTP(key string) (map[string]string, error) {
+	now := fasttime.Now()
+	if v, ok := hl.cache.Get(key); ok {
+		entry := v.(*httpCacheEntry)
+		if now.Before(entry.expireAt) {
+			return entry.values, nil
+		}
+	}
+
+	data, err := hl.httpSource.fetch(key)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	if data != nil {
+		if values, err = hl.extract(data); err != nil {
+			return nil, err
+		}
+	}
+
+	hl.cache.Add(key, &httpCacheEntry{values: values, expireAt: now.Add(hl.httpSource.cacheTTL)})
+	return values, nil
+}
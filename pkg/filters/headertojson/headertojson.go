@@ -18,9 +18,13 @@
 package headertojson
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 
 	json "github.com/goccy/go-json"
 	"github.com/megaease/easegress/pkg/context"
@@ -41,7 +45,7 @@ var (
 
 var kind = &filters.Kind{
 	Name:        Kind,
-	Description: "HeaderToJSON convert http request header to json",
+	Description: "HeaderToJSON convert http request header to json, or json to header",
 	Results: []string{
 		resultJSONEncodeDecodeErr,
 		resultBodyReadErr,
@@ -59,10 +63,24 @@ func init() {
 }
 
 type (
-	// HeaderToJSON put http request headers into body as JSON fields.
+	// HeaderToJSON put http request headers into body as JSON fields, or
+	// lifts JSON fields of the body into headers in the jsonToHeader mode.
 	HeaderToJSON struct {
-		spec      *Spec
-		headerMap map[string]string
+		spec   *Spec
+		fields []*field
+	}
+
+	// field is a header and its JSON field.
+	field struct {
+		header string
+		path   []string
+		typ    string
+	}
+
+	// fieldValue is the value of a JSON field.
+	fieldValue struct {
+		path  []string
+		value interface{}
 	}
 )
 
@@ -84,9 +102,13 @@ func (h *HeaderToJSON) Spec() filters.Spec {
 }
 
 func (h *HeaderToJSON) init() {
-	h.headerMap = make(map[string]string)
+	h.fields = nil
 	for _, header := range h.spec.HeaderMap {
-		h.headerMap[http.CanonicalHeaderKey(header.Header)] = header.JSON
+		h.fields = append(h.fields, &field{
+			header: http.CanonicalHeaderKey(header.Header),
+			path:   strings.Split(header.JSON, "."),
+			typ:    header.Type,
+		})
 	}
 }
 
@@ -111,15 +133,27 @@ func (h *HeaderToJSON) Status() interface{} {
 
 // Handle handle Context
 func (h *HeaderToJSON) Handle(ctx *context.Context) string {
+	if h.spec.Mode == modeJSONToHeader {
+		return h.jsonToHeader(ctx)
+	}
+	return h.headerToJSON(ctx)
+}
+
+func (h *HeaderToJSON) headerToJSON(ctx *context.Context) string {
 	req := ctx.GetInputRequest()
-	headerMap := make(map[string]interface{})
-	for header, json := range h.headerMap {
-		value := req.Header().Get(header)
-		if value != "" {
-			headerMap[json] = value
+	var values []*fieldValue
+	for _, f := range h.fields {
+		value := req.Header().Get(f.header)
+		if value == "" {
+			continue
 		}
+		v, err := convertValue(value, f.typ)
+		if err != nil {
+			return resultJSONEncodeDecodeErr
+		}
+		values = append(values, &fieldValue{path: f.path, value: v})
 	}
-	if len(headerMap) == 0 {
+	if len(values) == 0 {
 		return ""
 	}
 
@@ -131,10 +165,14 @@ func (h *HeaderToJSON) Handle(ctx *context.Context) string {
 
 	var body interface{}
 	if len(reqBody) == 0 {
-		body = headerMap
+		m := make(map[string]interface{})
+		if err := setFields(m, values); err != nil {
+			return resultJSONEncodeDecodeErr
+		}
+		body = m
 	} else {
 		var err error
-		if body, err = getNewBody(reqBody, headerMap); err != nil {
+		if body, err = getNewBody(reqBody, values); err != nil {
 			return resultJSONEncodeDecodeErr
 		}
 	}
@@ -148,9 +186,118 @@ func (h *HeaderToJSON) Handle(ctx *context.Context) string {
 	return ""
 }
 
+// jsonToHeader sets the headers to the values of the JSON fields, the
+// fields not exist or are null are skipped, and the body is kept as is.
+func (h *HeaderToJSON) jsonToHeader(ctx *context.Context) string {
+	req := ctx.GetInputRequest()
+	if req.IsStream() {
+		return resultBodyReadErr
+	}
+
+	reqBody := req.RawPayload()
+	if len(reqBody) == 0 {
+		return ""
+	}
+	if firstNonBlandByte(reqBody) != '{' {
+		return resultJSONEncodeDecodeErr
+	}
+	bodyMap, err := decodeMapJSON(reqBody)
+	if err != nil {
+		return resultJSONEncodeDecodeErr
+	}
+
+	for _, f := range h.fields {
+		v, ok := getField(bodyMap, f.path)
+		if !ok || v == nil {
+			continue
+		}
+		value, err := formatValue(v)
+		if err != nil {
+			return resultJSONEncodeDecodeErr
+		}
+		req.Header().Set(f.header, value)
+	}
+	return ""
+}
+
+// convertValue converts the header value to the type.
+func convertValue(value string, typ string) (interface{}, error) {
+	switch typ {
+	case typeInt:
+		return strconv.ParseInt(value, 10, 64)
+	case typeFloat:
+		return strconv.ParseFloat(value, 64)
+	case typeBool:
+		return strconv.ParseBool(value)
+	}
+	return value, nil
+}
+
+// formatValue formats the JSON value as a header value, objects and
+// arrays are in JSON.
+func formatValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// getField returns the value of the field at the path.
+func getField(m map[string]interface{}, path []string) (interface{}, bool) {
+	for _, k := range path[:len(path)-1] {
+		child, ok := m[k].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		m = child
+	}
+	v, ok := m[path[len(path)-1]]
+	return v, ok
+}
+
+// setField sets the value of the field at the path, the missing objects
+// on the path are created.
+func setField(m map[string]interface{}, path []string, value interface{}) error {
+	for _, k := range path[:len(path)-1] {
+		v, exists := m[k]
+		if !exists || v == nil {
+			child := make(map[string]interface{})
+			m[k] = child
+			m = child
+			continue
+		}
+		child, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s is not an object", k)
+		}
+		m = child
+	}
+	m[path[len(path)-1]] = value
+	return nil
+}
+
+func setFields(m map[string]interface{}, values []*fieldValue) error {
+	for _, v := range values {
+		if err := setField(m, v.path, v.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeMapJSON decodes the JSON object, numbers are kept as is to avoid
+// the loss of precision.
 func decodeMapJSON(body []byte) (map[string]interface{}, error) {
 	res := make(map[string]interface{})
-	err := json.Unmarshal(body, &res)
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	err := dec.Decode(&res)
 	if err != nil && err != io.EOF {
 		return nil, err
 	}
@@ -159,27 +306,15 @@ func decodeMapJSON(body []byte) (map[string]interface{}, error) {
 
 func decodeArrayJSON(body []byte) ([]map[string]interface{}, error) {
 	res := []map[string]interface{}{}
-	err := json.Unmarshal(body, &res)
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	err := dec.Decode(&res)
 	if err != nil && err != io.EOF {
 		return nil, err
 	}
 	return res, nil
 }
 
-func mergeMap(m1 map[string]interface{}, m2 map[string]interface{}) map[string]interface{} {
-	for k, v := range m2 {
-		m1[k] = v
-	}
-	return m1
-}
-
-func mergeMapToArrayMap(arrayMap []map[string]interface{}, m map[string]interface{}) []map[string]interface{} {
-	for i := range arrayMap {
-		arrayMap[i] = mergeMap(arrayMap[i], m)
-	}
-	return arrayMap
-}
-
 func firstNonBlandByte(bytes []byte) byte {
 	for _, b := range bytes {
 		switch b {
@@ -191,7 +326,7 @@ func firstNonBlandByte(bytes []byte) byte {
 	return 0
 }
 
-func getNewBody(reqBody []byte, headerMap map[string]interface{}) (interface{}, error) {
+func getNewBody(reqBody []byte, values []*fieldValue) (interface{}, error) {
 	char := firstNonBlandByte(reqBody)
 
 	if char == '{' {
@@ -199,14 +334,26 @@ func getNewBody(reqBody []byte, headerMap map[string]interface{}) (interface{},
 		if err != nil {
 			return nil, errJSONEncodeDecode
 		}
-		return mergeMap(bodyMap, headerMap), nil
+		if err = setFields(bodyMap, values); err != nil {
+			return nil, errJSONEncodeDecode
+		}
+		return bodyMap, nil
 
 	} else if char == '[' {
 		bodyArray, err := decodeArrayJSON(reqBody)
 		if err != nil {
 			return nil, errJSONEncodeDecode
 		}
-		return mergeMapToArrayMap(bodyArray, headerMap), nil
+		for i, m := range bodyArray {
+			if m == nil {
+				m = make(map[string]interface{})
+				bodyArray[i] = m
+			}
+			if err = setFields(m, values); err != nil {
+				return nil, errJSONEncodeDecode
+			}
+		}
+		return bodyArray, nil
 	}
 	return nil, errJSONEncodeDecode
 }
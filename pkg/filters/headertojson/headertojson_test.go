@@ -202,3 +202,77 @@ func TestHandleHTTP(t *testing.T) {
 		assert.Equal(resultBodyReadErr, ans)
 	}
 }
+
+func TestNestedTypedFields(t *testing.T) {
+	assert := assert.New(t)
+	spec := defaultFilterSpec(&Spec{
+		HeaderMap: []*HeaderMap{
+			{Header: "X-User-Id", JSON: "user.id", Type: "int"},
+			{Header: "X-User-Admin", JSON: "user.admin", Type: "bool"},
+			{Header: "X-Score", JSON: "score", Type: "float"},
+		},
+	})
+	h2j := kind.CreateInstance(spec)
+	h2j.Init()
+
+	handle := func(body string, headers map[string]string) (string, string) {
+		req, _ := http.NewRequest(http.MethodPost, "127.0.0.1", strings.NewReader(body))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		ctx := context.New(nil)
+		setRequest(t, ctx, req)
+		result := h2j.Handle(ctx)
+		return result, string(ctx.GetInputRequest().(*httpprot.Request).RawPayload())
+	}
+
+	headers := map[string]string{"X-User-Id": "12345678901234567", "X-User-Admin": "true", "X-Score": "1.5"}
+	result, body := handle(`{"user":{"name":"alice"},"big":12345678901234567890}`, headers)
+	assert.Equal("", result)
+	assert.JSONEq(`{"user":{"name":"alice","id":12345678901234567,"admin":true},"score":1.5,"big":12345678901234567890}`, body)
+
+	result, body = handle("", headers)
+	assert.Equal("", result)
+	assert.JSONEq(`{"user":{"id":12345678901234567,"admin":true},"score":1.5}`, body)
+
+	result, _ = handle(`{"user":"alice"}`, headers)
+	assert.Equal(resultJSONEncodeDecodeErr, result)
+
+	result, _ = handle("", map[string]string{"X-User-Id": "abc"})
+	assert.Equal(resultJSONEncodeDecodeErr, result)
+}
+
+func TestJSONToHeader(t *testing.T) {
+	assert := assert.New(t)
+	spec := defaultFilterSpec(&Spec{
+		Mode: "jsonToHeader",
+		HeaderMap: []*HeaderMap{
+			{Header: "X-User-Id", JSON: "user.id"},
+			{Header: "X-User-Admin", JSON: "user.admin"},
+			{Header: "X-Roles", JSON: "user.roles"},
+			{Header: "X-Topic", JSON: "topic"},
+			{Header: "X-Missing", JSON: "user.missing"},
+		},
+	})
+	j2h := kind.CreateInstance(spec)
+	j2h.Init()
+
+	body := `{"topic":"log","user":{"id":12345678901234567,"admin":false,"roles":["a","b"]}}`
+	req, _ := http.NewRequest(http.MethodPost, "127.0.0.1", strings.NewReader(body))
+	ctx := context.New(nil)
+	setRequest(t, ctx, req)
+
+	assert.Equal("", j2h.Handle(ctx))
+	r := ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("log", r.HTTPHeader().Get("X-Topic"))
+	assert.Equal("12345678901234567", r.HTTPHeader().Get("X-User-Id"))
+	assert.Equal("false", r.HTTPHeader().Get("X-User-Admin"))
+	assert.Equal(`["a","b"]`, r.HTTPHeader().Get("X-Roles"))
+	assert.Equal("", r.HTTPHeader().Get("X-Missing"))
+	assert.Equal(body, string(r.RawPayload()))
+
+	req, _ = http.NewRequest(http.MethodPost, "127.0.0.1", strings.NewReader("[1]"))
+	ctx = context.New(nil)
+	setRequest(t, ctx, req)
+	assert.Equal(resultJSONEncodeDecodeErr, j2h.Handle(ctx))
+}
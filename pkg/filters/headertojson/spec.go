@@ -19,16 +19,35 @@ package headertojson
 
 import "github.com/megaease/easegress/pkg/filters"
 
+const (
+	// modeHeaderToJSON puts the headers into the body.
+	modeHeaderToJSON = "headerToJSON"
+	// modeJSONToHeader lifts the fields of the body into the headers.
+	modeJSONToHeader = "jsonToHeader"
+
+	typeString = "string"
+	typeInt    = "int"
+	typeFloat  = "float"
+	typeBool   = "bool"
+)
+
 type (
 	// Spec is spec of HeaderToJson
 	Spec struct {
 		filters.BaseSpec `json:",inline"`
 		HeaderMap        []*HeaderMap `json:"headerMap" jsonschema:"required"`
+		// Mode is headerToJSON (default) or jsonToHeader.
+		Mode string `json:"mode" jsonschema:"omitempty,enum=,enum=headerToJSON,enum=jsonToHeader"`
 	}
 
 	// HeaderMap defines relationship between http header and json
 	HeaderMap struct {
 		Header string `json:"header" jsonschema:"required"`
-		JSON   string `json:"json" jsonschema:"required"`
+		// JSON is the path of the field, the parts of nested fields are
+		// separated by dots, e.g. user.id.
+		JSON string `json:"json" jsonschema:"required"`
+		// Type is the type of the field in the headerToJSON mode, the
+		// header value is converted to it.
+		Type string `json:"type" jsonschema:"omitempty,enum=,enum=string,enum=int,enum=float,enum=bool"`
 	}
 )
@@ -0,0 +1,357 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package idempotency implements the Idempotency filter.
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/filters/ratelimiter"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of Idempotency.
+	Kind = "Idempotency"
+
+	resultKeyMissing = "keyMissing"
+	resultConflict   = "conflict"
+	resultMismatch   = "mismatch"
+	resultReplayed   = "replayed"
+
+	// StorageMemory stores the records in memory.
+	StorageMemory = "memory"
+	// StorageCluster stores the records in the cluster, i.e. etcd.
+	StorageCluster = "cluster"
+
+	replayedHeader = "Idempotent-Replayed"
+
+	defaultHeader      = "Idempotency-Key"
+	defaultTTL         = 24 * time.Hour
+	defaultLockTimeout = time.Minute
+	defaultMaxEntries  = 10000
+	defaultMaxBodySize = 1024 * 1024
+	pruneInterval      = time.Minute
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "Idempotency replays the responses of the requests with the same idempotency key.",
+	Results:     []string{resultKeyMissing, resultConflict, resultMismatch, resultReplayed},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			Header:     defaultHeader,
+			Methods:    []string{http.MethodPost, http.MethodPatch},
+			Storage:    StorageMemory,
+			MaxEntries: defaultMaxEntries,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &Idempotency{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// Idempotency is filter Idempotency.
+	//
+	// replays, conflicts and stores are updated atomically by concurrent
+	// requests; placing them at offset zero keeps them 64-bit aligned
+	// even where the spec pointer is only 4 bytes wide.
+	Idempotency struct {
+		replays   uint64
+		conflicts uint64
+		stores    uint64
+
+		spec        *Spec
+		ttl         time.Duration
+		lockTimeout time.Duration
+		methods     map[string]bool
+		store       store
+		done        chan struct{}
+	}
+
+	// Spec describes the Idempotency.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Header  string   `json:"header" jsonschema:"omitempty"`
+		Methods []string `json:"methods" jsonschema:"omitempty,uniqueItems=true,format=httpmethod-array"`
+		// Required rejects the requests of the methods without a key.
+		Required bool `json:"required" jsonschema:"omitempty"`
+		// Consumer extracts the consumer of the request, the keys are scoped
+		// by consumers if it is specified, besides the method and path.
+		Consumer *ratelimiter.KeyExtractor `json:"consumer,omitempty" jsonschema:"omitempty"`
+		TTL      string                    `json:"ttl" jsonschema:"omitempty,format=duration"`
+		// LockTimeout is how long a request in flight blocks the requests
+		// with the same key, in case it never finishes.
+		LockTimeout string `json:"lockTimeout" jsonschema:"omitempty,format=duration"`
+		MaxBodySize int64  `json:"maxBodySize" jsonschema:"omitempty,minimum=1"`
+		Storage     string `json:"storage" jsonschema:"omitempty,enum=memory,enum=cluster"`
+		MaxEntries  int    `json:"maxEntries" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// Status is the status of Idempotency.
+	Status struct {
+		Entries   int    `json:"entries,omitempty"`
+		Replays   uint64 `json:"replays"`
+		Conflicts uint64 `json:"conflicts"`
+		Stores    uint64 `json:"stores"`
+	}
+)
+
+// Name returns the name of the Idempotency filter instance.
+func (idem *Idempotency) Name() string {
+	return idem.spec.Name()
+}
+
+// Kind returns the kind of Idempotency.
+func (idem *Idempotency) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the Idempotency
+func (idem *Idempotency) Spec() filters.Spec {
+	return idem.spec
+}
+
+// Init initializes Idempotency.
+func (idem *Idempotency) Init() {
+	idem.reload(nil)
+}
+
+// Inherit inherits previous generation of Idempotency.
+func (idem *Idempotency) Inherit(previousGeneration filters.Filter) {
+	idem.reload(previousGeneration.(*Idempotency))
+}
+
+func (idem *Idempotency) reload(prev *Idempotency) {
+	idem.ttl = defaultTTL
+	if d, err := time.ParseDuration(idem.spec.TTL); err == nil && d > 0 {
+		idem.ttl = d
+	}
+	idem.lockTimeout = defaultLockTimeout
+	if d, err := time.ParseDuration(idem.spec.LockTimeout); err == nil && d > 0 {
+		idem.lockTimeout = d
+	}
+	if idem.spec.MaxBodySize == 0 {
+		idem.spec.MaxBodySize = defaultMaxBodySize
+	}
+	if idem.spec.Header == "" {
+		idem.spec.Header = defaultHeader
+	}
+
+	idem.methods = map[string]bool{}
+	for _, m := range idem.spec.Methods {
+		idem.methods[m] = true
+	}
+	if ke := idem.spec.Consumer; ke != nil {
+		ke.Init()
+	}
+
+	idem.done = make(chan struct{})
+	if idem.spec.Storage == StorageCluster {
+		if super := idem.spec.Super(); super != nil && super.Cluster() != nil {
+			cs := &clusterStore{cluster: super.Cluster(), pipeline: idem.spec.Pipeline(), name: idem.Name()}
+			idem.store = cs
+			go idem.runPrune(cs)
+			return
+		}
+		logger.Warnf("%s: cluster is not available, records are stored in memory", idem.Name())
+	}
+
+	// the records in memory are kept if the storage is not changed.
+	if prev != nil {
+		if ms, ok := prev.store.(*memoryStore); ok && prev.spec.MaxEntries == idem.spec.MaxEntries {
+			idem.store = ms
+			return
+		}
+	}
+	maxEntries := idem.spec.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxEntries
+	}
+	idem.store = newMemoryStore(maxEntries)
+}
+
+func (idem *Idempotency) runPrune(cs *clusterStore) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-idem.done:
+			return
+		case <-ticker.C:
+			cs.prune()
+		}
+	}
+}
+
+// key returns the key of the request in the store, the idempotency key is
+// scoped by the method, path and consumer of the request.
+func (idem *Idempotency) key(req *httpprot.Request, idemKey string) string {
+	consumer := ""
+	if ke := idem.spec.Consumer; ke != nil {
+		consumer = ke.Extract(req)
+	}
+
+	h := sha256.New()
+	for _, s := range []string{req.Method(), req.Path(), consumer, idemKey} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func fingerprint(req *httpprot.Request) string {
+	sum := sha256.Sum256(req.RawPayload())
+	return hex.EncodeToString(sum[:])
+}
+
+// Handle replays the response of the first request with the same key, or
+// arranges to store the response once the request is finished.
+func (idem *Idempotency) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	if !idem.methods[req.Method()] {
+		return ""
+	}
+
+	idemKey := req.HTTPHeader().Get(idem.spec.Header)
+	if idemKey == "" {
+		if idem.spec.Required {
+			msg := fmt.Sprintf("header %s is required", idem.spec.Header)
+			return idem.respondError(ctx, http.StatusBadRequest, msg, resultKeyMissing)
+		}
+		return ""
+	}
+
+	// the fingerprint of a stream body is not available, so only the key
+	// is checked.
+	fp := ""
+	if !req.IsStream() {
+		fp = fingerprint(req)
+	}
+
+	key := idem.key(req, idemKey)
+	rec := &record{Fingerprint: fp, Expires: time.Now().Add(idem.lockTimeout)}
+	existing, err := idem.store.acquire(key, rec)
+	if err != nil {
+		// the request is not protected, but it is better than rejecting.
+		logger.Errorf("%s: failed to acquire key: %v", idem.Name(), err)
+		return ""
+	}
+
+	if existing != nil {
+		switch {
+		case existing.Fingerprint != fp:
+			return idem.respondError(ctx, http.StatusUnprocessableEntity, "the key is used by another request", resultMismatch)
+		case existing.Response == nil:
+			atomic.AddUint64(&idem.conflicts, 1)
+			return idem.respondError(ctx, http.StatusConflict, "a request with the same key is in progress", resultConflict)
+		default:
+			atomic.AddUint64(&idem.replays, 1)
+			idem.replay(ctx, existing.Response)
+			return resultReplayed
+		}
+	}
+
+	ctx.OnFinish(func() {
+		resp, _ := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response)
+		idem.storeResponse(key, fp, resp)
+	})
+	return ""
+}
+
+func (idem *Idempotency) replay(ctx *context.Context, r *response) {
+	resp, _ := httpprot.NewResponse(nil)
+
+	header := resp.HTTPHeader()
+	for k, v := range r.Header {
+		header[k] = append([]string(nil), v...)
+	}
+	header.Set(replayedHeader, "true")
+	resp.SetStatusCode(r.StatusCode)
+	resp.SetPayload(r.Body)
+
+	ctx.SetOutputResponse(resp)
+}
+
+// storeResponse stores the response of the first request, the key is
+// released if the response could not be replayed, so that the request
+// could be retried.
+func (idem *Idempotency) storeResponse(key, fp string, resp *httpprot.Response) {
+	var err error
+	if resp == nil || resp.IsStream() || resp.StatusCode() >= 500 ||
+		int64(len(resp.RawPayload())) > idem.spec.MaxBodySize {
+		err = idem.store.release(key)
+	} else {
+		header := resp.HTTPHeader().Clone()
+		header.Del("Set-Cookie")
+		err = idem.store.complete(key, &record{
+			Fingerprint: fp,
+			Response: &response{
+				StatusCode: resp.StatusCode(),
+				Header:     header,
+				Body:       resp.RawPayload(),
+			},
+			Expires: time.Now().Add(idem.ttl),
+		})
+		if err == nil {
+			atomic.AddUint64(&idem.stores, 1)
+		}
+	}
+
+	if err != nil {
+		logger.Errorf("%s: failed to update key: %v", idem.Name(), err)
+	}
+}
+
+func (idem *Idempotency) respondError(ctx *context.Context, code int, msg, result string) string {
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(code)
+	resp.SetPayload(msg)
+	ctx.SetOutputResponse(resp)
+	return result
+}
+
+// Status returns the status of Idempotency.
+func (idem *Idempotency) Status() interface{} {
+	return &Status{
+		Entries:   idem.store.len(),
+		Replays:   atomic.LoadUint64(&idem.replays),
+		Conflicts: atomic.LoadUint64(&idem.conflicts),
+		Stores:    atomic.LoadUint64(&idem.stores),
+	}
+}
+
+// Close closes Idempotency.
+func (idem *Idempotency) Close() {
+	close(idem.done)
+}
@@ -0,0 +1,240 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package idempotency
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newIdempotency(t *testing.T, yamlConfig string) *Idempotency {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "pipeline", rawSpec)
+	if err != nil {
+		t.Fatalf("failed to create spec: %v", err)
+	}
+	idem := kind.CreateInstance(spec).(*Idempotency)
+	idem.Init()
+	return idem
+}
+
+func newContext(t *testing.T, method, path, key, body string) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(method, "http://megaease.com"+path, strings.NewReader(body))
+	if key != "" {
+		stdr.Header.Set("Idempotency-Key", key)
+	}
+	stdr.Header.Set("X-Tenant", "a")
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	req.FetchPayload(0)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+// serveBackend simulates a backend filter which sets the response.
+func serveBackend(ctx *context.Context, code int, body string) {
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(code)
+	resp.Std().Header.Set("X-Order", "1")
+	resp.SetPayload([]byte(body))
+	ctx.SetOutputResponse(resp)
+}
+
+func TestIdempotency(t *testing.T) {
+	assert := assert.New(t)
+
+	idem := newIdempotency(t, `
+kind: Idempotency
+name: idem
+required: true
+consumer:
+  source: header
+  name: X-Tenant
+`)
+	defer idem.Close()
+
+	ctx := newContext(t, http.MethodPost, "/orders", "k1", "order")
+	assert.Equal("", idem.Handle(ctx))
+
+	// concurrent duplicate.
+	ctx2 := newContext(t, http.MethodPost, "/orders", "k1", "order")
+	assert.Equal(resultConflict, idem.Handle(ctx2))
+	assert.Equal(http.StatusConflict, ctx2.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	serveBackend(ctx, http.StatusCreated, "created")
+	ctx.Finish()
+
+	// retry.
+	ctx = newContext(t, http.MethodPost, "/orders", "k1", "order")
+	assert.Equal(resultReplayed, idem.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusCreated, resp.StatusCode())
+	assert.Equal("created", string(resp.RawPayload()))
+	assert.Equal("1", resp.HTTPHeader().Get("X-Order"))
+	assert.Equal("true", resp.HTTPHeader().Get(replayedHeader))
+
+	// the key is reused with a different body.
+	ctx = newContext(t, http.MethodPost, "/orders", "k1", "another order")
+	assert.Equal(resultMismatch, idem.Handle(ctx))
+	assert.Equal(http.StatusUnprocessableEntity, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	// the key is scoped by path and consumer.
+	ctx = newContext(t, http.MethodPost, "/payments", "k1", "order")
+	assert.Equal("", idem.Handle(ctx))
+	ctx = newContext(t, http.MethodPost, "/orders", "k1", "order")
+	ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Set("X-Tenant", "b")
+	assert.Equal("", idem.Handle(ctx))
+
+	// server errors are not stored, so the request could be retried.
+	ctx = newContext(t, http.MethodPost, "/orders", "k2", "order")
+	assert.Equal("", idem.Handle(ctx))
+	serveBackend(ctx, http.StatusBadGateway, "")
+	ctx.Finish()
+	ctx = newContext(t, http.MethodPost, "/orders", "k2", "order")
+	assert.Equal("", idem.Handle(ctx))
+
+	assert.Equal(resultKeyMissing, idem.Handle(newContext(t, http.MethodPost, "/orders", "", "order")))
+	assert.Equal("", idem.Handle(newContext(t, http.MethodGet, "/orders", "", "")))
+
+	status := idem.Status().(*Status)
+	assert.Equal(uint64(1), status.Replays)
+	assert.Equal(uint64(1), status.Conflicts)
+	assert.Equal(uint64(1), status.Stores)
+}
+
+type failingStore struct {
+	*memoryStore
+}
+
+func (fs *failingStore) complete(key string, rec *record) error {
+	return fmt.Errorf("store unavailable")
+}
+
+func TestStoreFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	idem := newIdempotency(t, "kind: Idempotency\nname: idem\n")
+	defer idem.Close()
+	idem.store = &failingStore{newMemoryStore(idem.spec.MaxEntries)}
+
+	ctx := newContext(t, http.MethodPost, "/orders", "k1", "order")
+	assert.Equal("", idem.Handle(ctx))
+	serveBackend(ctx, http.StatusOK, "done")
+	ctx.Finish()
+
+	// failed stores are not counted.
+	assert.Equal(uint64(0), idem.Status().(*Status).Stores)
+}
+
+func TestClusterStore(t *testing.T) {
+	assert := assert.New(t)
+
+	var lock sync.Mutex
+	kvs := map[string]string{}
+
+	mc := clustertest.NewMockedCluster()
+	mc.MockedLayout = func() *cluster.Layout {
+		return &cluster.Layout{}
+	}
+	mc.MockedIsLeader = func() bool {
+		return true
+	}
+	mc.MockedPut = func(key, value string) error {
+		lock.Lock()
+		defer lock.Unlock()
+		kvs[key] = value
+		return nil
+	}
+	mc.MockedDelete = func(key string) error {
+		lock.Lock()
+		defer lock.Unlock()
+		delete(kvs, key)
+		return nil
+	}
+	mc.MockedGetPrefix = func(prefix string) (map[string]string, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		result := map[string]string{}
+		for k, v := range kvs {
+			if strings.HasPrefix(k, prefix) {
+				result[k] = v
+			}
+		}
+		return result, nil
+	}
+	mc.MockedSTM = func(apply func(concurrency.STM) error) error {
+		lock.Lock()
+		defer lock.Unlock()
+		return apply(&clustertest.MockedSTM{
+			MockedGet: func(key ...string) string {
+				return kvs[key[0]]
+			},
+			MockedPut: func(key, val string, opts ...clientv3.OpOption) {
+				kvs[key] = val
+			},
+		})
+	}
+
+	// two members share the same cluster.
+	idem1 := newIdempotency(t, "kind: Idempotency\nname: idem\n")
+	defer idem1.Close()
+	idem1.store = &clusterStore{cluster: mc, pipeline: "pipeline", name: "idem"}
+	idem2 := newIdempotency(t, "kind: Idempotency\nname: idem\n")
+	defer idem2.Close()
+	idem2.store = &clusterStore{cluster: mc, pipeline: "pipeline", name: "idem"}
+
+	ctx := newContext(t, http.MethodPost, "/orders", "k1", "order")
+	assert.Equal("", idem1.Handle(ctx))
+	assert.Equal(resultConflict, idem2.Handle(newContext(t, http.MethodPost, "/orders", "k1", "order")))
+	serveBackend(ctx, http.StatusOK, "done")
+	ctx.Finish()
+
+	ctx = newContext(t, http.MethodPost, "/orders", "k1", "order")
+	assert.Equal(resultReplayed, idem2.Handle(ctx))
+	assert.Equal("done", string(ctx.GetOutputResponse().(*httpprot.Response).RawPayload()))
+
+	// expired records are pruned.
+	key := mc.Layout().IdempotencyPrefix("pipeline", "idem") + "expired"
+	kvs[key] = `{"fingerprint":"","expires":"2020-01-01T00:00:00Z"}`
+	idem1.store.(*clusterStore).prune()
+	assert.Equal(1, len(kvs))
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package idempotency
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+type (
+	// record is the record of an idempotency key, the response is nil if
+	// the first request is still in flight.
+	record struct {
+		Fingerprint string    `json:"fingerprint"`
+		Response    *response `json:"response,omitempty"`
+		Expires     time.Time `json:"expires"`
+	}
+
+	// response is a stored response.
+	response struct {
+		StatusCode int         `json:"statusCode"`
+		Header     http.Header `json:"header"`
+		Body       []byte      `json:"body"`
+	}
+
+	// store is the storage of the idempotency records.
+	store interface {
+		// acquire returns the existing record of the key if it is not
+		// expired, otherwise, it saves rec as the record of the key and
+		// returns nil.
+		acquire(key string, rec *record) (*record, error)
+		// complete saves the record of a finished request.
+		complete(key string, rec *record) error
+		// release deletes the record of the key, so that the request
+		// could be retried.
+		release(key string) error
+		len() int
+	}
+
+	memoryStore struct {
+		mutex sync.Mutex
+		cache *lru.Cache
+	}
+
+	// clusterStore stores the records in the cluster, so the keys are
+	// shared by all members.
+	clusterStore struct {
+		cluster  cluster.Cluster
+		pipeline string
+		name     string
+	}
+)
+
+func (r *record) expired(now time.Time) bool {
+	return !now.Before(r.Expires)
+}
+
+func newMemoryStore(maxEntries int) *memoryStore {
+	cache, _ := lru.New(maxEntries)
+	return &memoryStore{cache: cache}
+}
+
+func (ms *memoryStore) acquire(key string, rec *record) (*record, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if v, ok := ms.cache.Get(key); ok {
+		if existing := v.(*record); !existing.expired(time.Now()) {
+			return existing, nil
+		}
+	}
+	ms.cache.Add(key, rec)
+	return nil, nil
+}
+
+func (ms *memoryStore) complete(key string, rec *record) error {
+	ms.cache.Add(key, rec)
+	return nil
+}
+
+func (ms *memoryStore) release(key string) error {
+	ms.cache.Remove(key)
+	return nil
+}
+
+func (ms *memoryStore) len() int {
+	return ms.cache.Len()
+}
+
+func (cs *clusterStore) key(key string) string {
+	return cs.cluster.Layout().IdempotencyKey(cs.pipeline, cs.name, key)
+}
+
+func (cs *clusterStore) acquire(key string, rec *record) (*record, error) {
+	key = cs.key(key)
+	data := string(codectool.MustMarshalJSON(rec))
+
+	var existing *record
+	err := cs.cluster.STM(func(stm concurrency.STM) error {
+		existing = nil
+		if v := stm.Get(key); v != "" {
+			r := &record{}
+			if err := codectool.UnmarshalJSON([]byte(v), r); err == nil && !r.expired(time.Now()) {
+				existing = r
+				return nil
+			}
+		}
+		stm.Put(key, data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+func (cs *clusterStore) complete(key string, rec *record) error {
+	return cs.cluster.Put(cs.key(key), string(codectool.MustMarshalJSON(rec)))
+}
+
+func (cs *clusterStore) release(key string) error {
+	return cs.cluster.Delete(cs.key(key))
+}
+
+// len is not counted for the cluster store, as it is called to report the
+// status periodically, and reading all records from the cluster is costly.
+func (cs *clusterStore) len() int {
+	return 0
+}
+
+// prune deletes the expired records, it is only done by the leader.
+func (cs *clusterStore) prune() {
+	if !cs.cluster.IsLeader() {
+		return
+	}
+
+	kvs, err := cs.cluster.GetPrefix(cs.cluster.Layout().IdempotencyPrefix(cs.pipeline, cs.name))
+	if err != nil {
+		logger.Errorf("failed to get idempotency records: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for k, v := range kvs {
+		r := &record{}
+		if err = codectool.UnmarshalJSON([]byte(v), r); err == nil && !r.expired(now) {
+			continue
+		}
+		if err = cs.cluster.Delete(k); err != nil {
+			logger.Errorf("failed to delete idempotency record %s: %v", k, err)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package jsontransformer implements the JSONTransformer filter.
+package jsontransformer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jmespath/go-jmespath"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols"
+)
+
+const (
+	// Kind is the kind of JSONTransformer.
+	Kind = "JSONTransformer"
+
+	resultTransformFailed = "transformFailed"
+
+	targetRequest  = "request"
+	targetResponse = "response"
+
+	opAdd     = "add"
+	opRemove  = "remove"
+	opRename  = "rename"
+	opDefault = "default"
+	opProject = "project"
+
+	wildcard = "*"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "JSONTransformer transforms the JSON body of the request or response",
+	Results:     []string{resultTransformFailed},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{Target: targetResponse}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &JSONTransformer{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// JSONTransformer is filter JSONTransformer.
+	JSONTransformer struct {
+		spec *Spec
+		ops  []*operation
+	}
+
+	// Spec describes the JSONTransformer.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Target     string           `json:"target" jsonschema:"omitempty,enum=request,enum=response"`
+		Operations []*OperationSpec `json:"operations" jsonschema:"required,minItems=1"`
+	}
+
+	// OperationSpec describes a transform operation.
+	OperationSpec struct {
+		Op         string      `json:"op" jsonschema:"required,enum=add,enum=remove,enum=rename,enum=default,enum=project"`
+		Path       string      `json:"path" jsonschema:"omitempty"`
+		To         string      `json:"to" jsonschema:"omitempty"`
+		Value      interface{} `json:"value" jsonschema:"omitempty"`
+		Expression string      `json:"expression" jsonschema:"omitempty"`
+	}
+
+	// message is the common part of protocols.Request and
+	// protocols.Response used by JSONTransformer.
+	message interface {
+		Header() protocols.Header
+		IsStream() bool
+		RawPayload() []byte
+		SetPayload(payload interface{})
+	}
+
+	operation struct {
+		spec *OperationSpec
+		path []string
+		to   []string
+		expr *jmespath.JMESPath
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	for i, op := range spec.Operations {
+		if _, err := newOperation(op); err != nil {
+			return fmt.Errorf("operation %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func splitPath(path string) []string {
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, ".")
+}
+
+func newOperation(spec *OperationSpec) (*operation, error) {
+	op := &operation{
+		spec: spec,
+		path: splitPath(spec.Path),
+		to:   splitPath(spec.To),
+	}
+
+	switch spec.Op {
+	case opAdd, opRemove, opDefault:
+		if len(op.path) == 0 {
+			return nil, fmt.Errorf("path is required for %s", spec.Op)
+		}
+	case opRename:
+		if len(op.path) == 0 || len(op.to) == 0 {
+			return nil, fmt.Errorf("path and to are required for %s", spec.Op)
+		}
+		if strings.Contains(spec.Path, wildcard) || strings.Contains(spec.To, wildcard) {
+			return nil, fmt.Errorf("wildcard is not allowed for %s", spec.Op)
+		}
+	case opProject:
+		expr, err := jmespath.Compile(spec.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression %q: %v", spec.Expression, err)
+		}
+		op.expr = expr
+	default:
+		return nil, fmt.Errorf("unknown op %q", spec.Op)
+	}
+
+	return op, nil
+}
+
+// Name returns the name of the JSONTransformer filter instance.
+func (jt *JSONTransformer) Name() string {
+	return jt.spec.Name()
+}
+
+// Kind returns the kind of JSONTransformer.
+func (jt *JSONTransformer) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the JSONTransformer
+func (jt *JSONTransformer) Spec() filters.Spec {
+	return jt.spec
+}
+
+// Init initializes JSONTransformer.
+func (jt *JSONTransformer) Init() {
+	jt.reload()
+}
+
+// Inherit inherits previous generation of JSONTransformer.
+func (jt *JSONTransformer) Inherit(previousGeneration filters.Filter) {
+	jt.Init()
+}
+
+func (jt *JSONTransformer) reload() {
+	jt.ops = nil
+	for _, s := range jt.spec.Operations {
+		// the spec has been validated, so no error here.
+		op, _ := newOperation(s)
+		jt.ops = append(jt.ops, op)
+	}
+}
+
+// Handle transforms the JSON body.
+func (jt *JSONTransformer) Handle(ctx *context.Context) string {
+	var msg message
+	if jt.spec.Target == targetRequest {
+		if req := ctx.GetInputRequest(); req != nil {
+			msg = req
+		}
+	} else if resp := ctx.GetOutputResponse(); resp != nil {
+		msg = resp
+	}
+
+	if msg == nil {
+		return resultTransformFailed
+	}
+	if msg.IsStream() {
+		logger.Warnf("%s: cannot transform a stream body", jt.Name())
+		return resultTransformFailed
+	}
+
+	body := msg.RawPayload()
+	if len(bytes.TrimSpace(body)) == 0 {
+		return ""
+	}
+
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// keep numbers as is, large integers would lose precision otherwise.
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		logger.Debugf("%s: failed to decode body: %v", jt.Name(), err)
+		return resultTransformFailed
+	}
+
+	for _, op := range jt.ops {
+		var err error
+		if doc, err = op.apply(doc); err != nil {
+			logger.Debugf("%s: operation %s failed: %v", jt.Name(), op.spec.Op, err)
+			return resultTransformFailed
+		}
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		logger.Debugf("%s: failed to encode body: %v", jt.Name(), err)
+		return resultTransformFailed
+	}
+
+	msg.SetPayload(data)
+	msg.Header().Del("Content-Length")
+	return ""
+}
+
+// apply applies the operation to doc and returns the new doc.
+func (op *operation) apply(doc interface{}) (interface{}, error) {
+	switch op.spec.Op {
+	case opAdd:
+		return doc, setValue(doc, op.path, op.spec.Value, true)
+	case opDefault:
+		return doc, setValue(doc, op.path, op.spec.Value, false)
+	case opRemove:
+		removeValue(doc, op.path)
+		return doc, nil
+	case opRename:
+		v, ok := getValue(doc, op.path)
+		if !ok {
+			return doc, nil
+		}
+		removeValue(doc, op.path)
+		return doc, setValue(doc, op.to, v, true)
+	case opProject:
+		v, err := op.expr.Search(normalizeNumbers(doc))
+		if err != nil {
+			return nil, err
+		}
+		if len(op.path) == 0 {
+			return v, nil
+		}
+		return doc, setValue(doc, op.path, v, true)
+	}
+	return doc, nil
+}
+
+func getValue(doc interface{}, path []string) (interface{}, bool) {
+	for _, key := range path {
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if doc, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// walk calls fn with every object which holds the last field of path,
+// and the name of the field. A "*" in path matches all elements of an
+// array. The missing objects on the path are created if create is true.
+func walk(doc interface{}, path []string, create bool, fn func(m map[string]interface{}, key string)) error {
+	if path[0] == wildcard {
+		if a, ok := doc.([]interface{}); ok {
+			for _, elem := range a {
+				if err := walk(elem, path[1:], create, fn); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	m, ok := doc.(map[string]interface{})
+	if !ok {
+		if create {
+			return fmt.Errorf("not a JSON object")
+		}
+		return nil
+	}
+
+	if len(path) == 1 {
+		fn(m, path[0])
+		return nil
+	}
+
+	child, ok := m[path[0]]
+	if !ok {
+		if !create {
+			return nil
+		}
+		child = map[string]interface{}{}
+		m[path[0]] = child
+	}
+	return walk(child, path[1:], create, fn)
+}
+
+// setValue sets value at path. The existing value is kept if overwrite
+// is false.
+func setValue(doc interface{}, path []string, value interface{}, overwrite bool) error {
+	return walk(doc, path, true, func(m map[string]interface{}, key string) {
+		if _, exists := m[key]; exists && !overwrite {
+			return
+		}
+		m[key] = value
+	})
+}
+
+func removeValue(doc interface{}, path []string) {
+	walk(doc, path, false, func(m map[string]interface{}, key string) {
+		delete(m, key)
+	})
+}
+
+// normalizeNumbers converts json.Number to float64 recursively, as
+// JMESPath functions and comparisons work with float64 only.
+func normalizeNumbers(v interface{}) interface{} {
+	switch x := v.(type) {
+	case json.Number:
+		f, _ := x.Float64()
+		return f
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, val := range x {
+			m[k] = normalizeNumbers(val)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(x))
+		for i, val := range x {
+			a[i] = normalizeNumbers(val)
+		}
+		return a
+	}
+	return v
+}
+
+// Status returns status.
+func (jt *JSONTransformer) Status() interface{} {
+	return nil
+}
+
+// Close closes JSONTransformer.
+func (jt *JSONTransformer) Close() {
+}
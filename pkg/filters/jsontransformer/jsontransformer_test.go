@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package jsontransformer
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newJSONTransformer(t *testing.T, yamlConfig string) *JSONTransformer {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	jt := kind.CreateInstance(spec).(*JSONTransformer)
+	jt.Init()
+	return jt
+}
+
+func newContext(body string) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://megaease.com/abc", nil)
+	req, _ := httpprot.NewRequest(stdr)
+	ctx.SetInputRequest(req)
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetPayload(body)
+	ctx.SetOutputResponse(resp)
+	return ctx
+}
+
+func TestJSONTransformer(t *testing.T) {
+	assert := assert.New(t)
+
+	jt := newJSONTransformer(t, `
+kind: JSONTransformer
+name: transformer
+operations:
+- op: remove
+  path: internal
+- op: remove
+  path: items.*.secret
+- op: rename
+  path: user.pwd
+  to: credentials.password
+- op: add
+  path: meta.gateway
+  value: easegress
+- op: default
+  path: page.size
+  value: 20
+- op: default
+  path: page.number
+  value: 1
+`)
+
+	ctx := newContext(`{"id": 12345678901234567890, "internal": {"a": 1}, "page": {"size": 50},
+"items": [{"name": "a", "secret": 1}, {"name": "b"}], "user": {"pwd": "x"}}`)
+	assert.Equal("", jt.Handle(ctx))
+	body := ctx.GetOutputResponse().RawPayload()
+	assert.JSONEq(`{"id": 12345678901234567890, "page": {"size": 50, "number": 1},
+"items": [{"name": "a"}, {"name": "b"}], "user": {}, "credentials": {"password": "x"},
+"meta": {"gateway": "easegress"}}`, string(body))
+
+	ctx = newContext(`not json`)
+	assert.Equal(resultTransformFailed, jt.Handle(ctx))
+
+	ctx = newContext(`[1, 2]`)
+	assert.Equal(resultTransformFailed, jt.Handle(ctx))
+}
+
+func TestProject(t *testing.T) {
+	assert := assert.New(t)
+
+	jt := newJSONTransformer(t, `
+kind: JSONTransformer
+name: transformer
+operations:
+- op: project
+  expression: "items[?price > to_number('10')].name"
+  path: names
+- op: project
+  expression: "{names: names, total: length(items)}"
+`)
+
+	ctx := newContext(`{"items": [{"name": "a", "price": 5}, {"name": "b", "price": 20}]}`)
+	assert.Equal("", jt.Handle(ctx))
+	assert.JSONEq(`{"names": ["b"], "total": 2}`, string(ctx.GetOutputResponse().RawPayload()))
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Operations: []*OperationSpec{{Op: "add"}}}
+	assert.Error(spec.Validate())
+
+	spec.Operations[0] = &OperationSpec{Op: "rename", Path: "a.*.b", To: "c"}
+	assert.Error(spec.Validate())
+
+	spec.Operations[0] = &OperationSpec{Op: "project", Expression: "a[?"}
+	assert.Error(spec.Validate())
+
+	spec.Operations[0] = &OperationSpec{Op: "unknown"}
+	assert.Error(spec.Validate())
+
+	spec.Operations[0] = &OperationSpec{Op: "remove", Path: "a.b"}
+	assert.NoError(spec.Validate())
+}
@@ -18,9 +18,11 @@
 package kafka
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"text/template"
 
 	"github.com/Shopify/sarama"
 	"github.com/megaease/easegress/pkg/context"
@@ -59,6 +61,7 @@ type (
 		producer sarama.AsyncProducer
 		done     chan struct{}
 		header   string
+		key      *template.Template
 	}
 )
 
@@ -88,15 +91,80 @@ func (k *Kafka) setHeader(spec *Spec) {
 	}
 }
 
-// Init init Kafka
-func (k *Kafka) Init() {
+func (k *Kafka) initRules() {
+	for _, r := range k.spec.Topic.Rules {
+		if r.Path != nil {
+			r.Path.Init()
+		}
+		for _, h := range r.Headers {
+			h.Init()
+		}
+	}
+	if k.spec.Key != "" {
+		// the template has been validated, so no error here.
+		k.key, _ = template.New("").Parse(k.spec.Key)
+	}
+}
+
+func (k *Kafka) newConfig() (*sarama.Config, error) {
 	spec := k.spec
-	k.done = make(chan struct{})
-	k.setHeader(k.spec)
 
 	config := sarama.NewConfig()
 	config.ClientID = spec.Name()
 	config.Version = sarama.V1_0_0_0
+
+	if spec.TLS != nil {
+		tlsConfig, err := spec.TLS.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+
+	if spec.SASL != nil {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = spec.SASL.Username
+		config.Net.SASL.Password = spec.SASL.Password
+		config.Net.SASL.Mechanism = sarama.SASLMechanism(spec.SASL.Mechanism)
+		if spec.SASL.Mechanism != saslPlain {
+			config.Net.SASL.SCRAMClientGeneratorFunc = newSCRAMClientGenerator(spec.SASL.Mechanism)
+		}
+	}
+
+	if p := spec.Producer; p != nil {
+		switch p.RequiredAcks {
+		case acksNone:
+			config.Producer.RequiredAcks = sarama.NoResponse
+		case acksLocal:
+			config.Producer.RequiredAcks = sarama.WaitForLocal
+		case acksAll:
+			config.Producer.RequiredAcks = sarama.WaitForAll
+		}
+
+		// idempotent producer requires waiting for all replicas and at
+		// most one in-flight request per connection.
+		if p.Idempotent {
+			config.Producer.Idempotent = true
+			config.Producer.RequiredAcks = sarama.WaitForAll
+			config.Net.MaxOpenRequests = 1
+		}
+	}
+
+	return config, nil
+}
+
+// Init init Kafka
+func (k *Kafka) Init() {
+	k.done = make(chan struct{})
+	k.setHeader(k.spec)
+	k.initRules()
+
+	config, err := k.newConfig()
+	if err != nil {
+		panic(fmt.Errorf("create sarama config failed: %v", err))
+	}
+
 	producer, err := sarama.NewAsyncProducer(k.spec.Backend, config)
 	if err != nil {
 		panic(fmt.Errorf("start sarama producer with address %v failed: %v", k.spec.Backend, err))
@@ -139,7 +207,27 @@ func (k *Kafka) Status() interface{} {
 	return nil
 }
 
+func (r *TopicRule) match(req *httpprot.Request) bool {
+	if r.Path != nil && !r.Path.Match(req.Path()) {
+		return false
+	}
+	for name, sm := range r.Headers {
+		if !sm.Match(req.HTTPHeader().Get(name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// getTopic returns the topic of the request, the rules are checked first,
+// then the dynamic header, and the default topic is used at last.
 func (k *Kafka) getTopic(req *httpprot.Request) string {
+	for _, r := range k.spec.Topic.Rules {
+		if r.match(req) {
+			return r.Topic
+		}
+	}
+
 	if k.header == "" {
 		return k.spec.Topic.Default
 	}
@@ -150,6 +238,24 @@ func (k *Kafka) getTopic(req *httpprot.Request) string {
 	return topic
 }
 
+// getKey returns the partition key of the request, nil means no key and
+// the messages are distributed to the partitions randomly.
+func (k *Kafka) getKey(req *httpprot.Request) sarama.Encoder {
+	if k.key == nil {
+		return nil
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := k.key.Execute(buf, req); err != nil {
+		logger.Warnf("execute key template of %s failed: %v", k.spec.Name(), err)
+		return nil
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	return sarama.ByteEncoder(buf.Bytes())
+}
+
 // Handle handles the context.
 func (k *Kafka) Handle(ctx *context.Context) (result string) {
 	req := ctx.GetInputRequest().(*httpprot.Request)
@@ -162,6 +268,7 @@ func (k *Kafka) Handle(ctx *context.Context) (result string) {
 
 	msg := &sarama.ProducerMessage{
 		Topic: topic,
+		Key:   k.getKey(req),
 		Value: sarama.ByteEncoder(body),
 	}
 	k.producer.Input() <- msg
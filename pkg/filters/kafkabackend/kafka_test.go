@@ -28,6 +28,7 @@ import (
 	"github.com/megaease/easegress/pkg/filters"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/urlrule"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -146,3 +147,98 @@ func TestHandleHTTP(t *testing.T) {
 	assert.Nil(err)
 	assert.Equal("text", string(value))
 }
+
+func TestTopicRulesAndKey(t *testing.T) {
+	assert := assert.New(t)
+	kafka := Kafka{
+		spec: &Spec{
+			Key: `{{.HTTPHeader.Get "X-User"}}`,
+			Topic: &Topic{
+				Default: "default-topic",
+				Dynamic: &Dynamic{
+					Header: "x-kafka-topic",
+				},
+				Rules: []*TopicRule{{
+					Path:  &urlrule.StringMatch{Prefix: "/orders"},
+					Topic: "orders",
+				}, {
+					Headers: map[string]*urlrule.StringMatch{
+						"X-Event": {RegEx: "^user\\."},
+					},
+					Topic: "users",
+				}},
+			},
+		},
+		producer: newMockAsyncProducer(),
+		done:     make(chan struct{}),
+	}
+	kafka.setHeader(kafka.spec)
+	kafka.initRules()
+	go kafka.checkProduceError()
+	defer kafka.Close()
+
+	send := func(path string, headers map[string]string) *sarama.ProducerMessage {
+		ctx := context.New(nil)
+		req, err := http.NewRequest(http.MethodPost, "http://127.0.0.1"+path, strings.NewReader("text"))
+		assert.Nil(err)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		setRequest(t, ctx, req)
+		assert.Equal("", kafka.Handle(ctx))
+		return <-kafka.producer.(*mockAsyncProducer).ch
+	}
+
+	msg := send("/orders/1", map[string]string{"X-User": "u1", "x-kafka-topic": "kafka"})
+	assert.Equal("orders", msg.Topic)
+	key, err := msg.Key.Encode()
+	assert.Nil(err)
+	assert.Equal("u1", string(key))
+
+	msg = send("/events", map[string]string{"X-Event": "user.created"})
+	assert.Equal("users", msg.Topic)
+	assert.Nil(msg.Key)
+
+	msg = send("/events", map[string]string{"X-Event": "order.created", "x-kafka-topic": "kafka"})
+	assert.Equal("kafka", msg.Topic)
+
+	msg = send("/events", nil)
+	assert.Equal("default-topic", msg.Topic)
+}
+
+func TestNewConfig(t *testing.T) {
+	assert := assert.New(t)
+	k := &Kafka{spec: &Spec{
+		Topic: &Topic{Default: "default-topic"},
+		TLS:   &TLSSpec{InsecureSkipVerify: true},
+		SASL: &SASLSpec{
+			Mechanism: saslSCRAMSHA512,
+			Username:  "user",
+			Password:  "pencil",
+		},
+		Producer: &ProducerSpec{Idempotent: true},
+	}}
+
+	config, err := k.newConfig()
+	assert.Nil(err)
+	assert.True(config.Net.TLS.Enable)
+	assert.True(config.Net.TLS.Config.InsecureSkipVerify)
+	assert.True(config.Net.SASL.Enable)
+	assert.Equal(sarama.SASLMechanism(saslSCRAMSHA512), config.Net.SASL.Mechanism)
+	assert.NotNil(config.Net.SASL.SCRAMClientGeneratorFunc)
+	assert.True(config.Producer.Idempotent)
+	assert.Equal(sarama.WaitForAll, config.Producer.RequiredAcks)
+	assert.Equal(1, config.Net.MaxOpenRequests)
+	assert.Nil(config.Validate())
+
+	k.spec.SASL.Mechanism = saslPlain
+	k.spec.Producer = &ProducerSpec{RequiredAcks: acksNone}
+	config, err = k.newConfig()
+	assert.Nil(err)
+	assert.Nil(config.Net.SASL.SCRAMClientGeneratorFunc)
+	assert.Equal(sarama.NoResponse, config.Producer.RequiredAcks)
+
+	assert.NotNil((&ProducerSpec{Idempotent: true, RequiredAcks: acksLocal}).Validate())
+	assert.NotNil((&TopicRule{Topic: "t"}).Validate())
+	assert.NotNil((&Spec{Key: "{{"}).Validate())
+}
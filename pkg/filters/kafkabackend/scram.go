@@ -0,0 +1,183 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// scramClient is a SCRAM client defined in RFC 5802, the SASLprep of the
+// username and password is not performed.
+type scramClient struct {
+	hashFunc func() hash.Hash
+
+	username string
+	password string
+	authzID  string
+
+	step            int
+	nonce           string
+	clientFirstBare string
+	serverSignature []byte
+	done            bool
+}
+
+var _ sarama.SCRAMClient = (*scramClient)(nil)
+
+// newSCRAMNonce generates the client nonce, it is a variable for testing.
+var newSCRAMNonce = defaultSCRAMNonce
+
+func defaultSCRAMNonce() string {
+	buf := make([]byte, 24)
+	rand.Read(buf)
+	return base64.RawStdEncoding.EncodeToString(buf)
+}
+
+func newSCRAMClientGenerator(mechanism string) func() sarama.SCRAMClient {
+	hashFunc := sha256.New
+	if mechanism == saslSCRAMSHA512 {
+		hashFunc = sha512.New
+	}
+	return func() sarama.SCRAMClient {
+		return &scramClient{hashFunc: hashFunc}
+	}
+}
+
+// Begin prepares the client for the SCRAM exchange.
+func (c *scramClient) Begin(username, password, authzID string) error {
+	c.username = username
+	c.password = password
+	c.authzID = authzID
+	c.step = 0
+	c.done = false
+	return nil
+}
+
+func (c *scramClient) gs2Header() string {
+	if c.authzID == "" {
+		return "n,,"
+	}
+	return "n,a=" + escapeSCRAMName(c.authzID) + ","
+}
+
+// Step processes a challenge from the server and returns the response.
+func (c *scramClient) Step(challenge string) (string, error) {
+	c.step++
+	switch c.step {
+	case 1:
+		c.nonce = newSCRAMNonce()
+		c.clientFirstBare = "n=" + escapeSCRAMName(c.username) + ",r=" + c.nonce
+		return c.gs2Header() + c.clientFirstBare, nil
+	case 2:
+		return c.clientFinal(challenge)
+	case 3:
+		c.done = true
+		return "", c.verifyServerFinal(challenge)
+	}
+	return "", fmt.Errorf("unexpected SCRAM step %d", c.step)
+}
+
+// Done returns whether the SCRAM exchange is finished.
+func (c *scramClient) Done() bool {
+	return c.done
+}
+
+func (c *scramClient) clientFinal(serverFirst string) (string, error) {
+	attrs := parseSCRAMAttributes(serverFirst)
+
+	nonce := attrs["r"]
+	if !strings.HasPrefix(nonce, c.nonce) {
+		return "", fmt.Errorf("invalid server nonce")
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil {
+		return "", fmt.Errorf("invalid salt: %v", err)
+	}
+
+	iterations, err := strconv.Atoi(attrs["i"])
+	if err != nil || iterations <= 0 {
+		return "", fmt.Errorf("invalid iteration count: %s", attrs["i"])
+	}
+
+	channelBinding := base64.StdEncoding.EncodeToString([]byte(c.gs2Header()))
+	withoutProof := "c=" + channelBinding + ",r=" + nonce
+	authMessage := c.clientFirstBare + "," + serverFirst + "," + withoutProof
+
+	saltedPassword := pbkdf2.Key([]byte(c.password), salt, iterations, c.hashFunc().Size(), c.hashFunc)
+	clientKey := c.hmac(saltedPassword, "Client Key")
+	h := c.hashFunc()
+	h.Write(clientKey)
+	storedKey := h.Sum(nil)
+	clientSignature := c.hmac(storedKey, authMessage)
+
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ clientSignature[i]
+	}
+
+	serverKey := c.hmac(saltedPassword, "Server Key")
+	c.serverSignature = c.hmac(serverKey, authMessage)
+
+	return withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+func (c *scramClient) verifyServerFinal(serverFinal string) error {
+	attrs := parseSCRAMAttributes(serverFinal)
+	if e, ok := attrs["e"]; ok {
+		return fmt.Errorf("SCRAM authentication failed: %s", e)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(attrs["v"])
+	if err != nil || !hmac.Equal(signature, c.serverSignature) {
+		return fmt.Errorf("invalid server signature")
+	}
+	return nil
+}
+
+func (c *scramClient) hmac(key []byte, msg string) []byte {
+	mac := hmac.New(c.hashFunc, key)
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
+
+func escapeSCRAMName(name string) string {
+	name = strings.ReplaceAll(name, "=", "=3D")
+	return strings.ReplaceAll(name, ",", "=2C")
+}
+
+func parseSCRAMAttributes(msg string) map[string]string {
+	attrs := map[string]string{}
+	for _, field := range strings.Split(msg, ",") {
+		if len(field) > 2 && field[1] == '=' {
+			attrs[field[:1]] = field[2:]
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSCRAMClient(t *testing.T) {
+	assert := assert.New(t)
+
+	// the test vector of SCRAM-SHA-256 in RFC 7677.
+	newSCRAMNonce = func() string { return "rOprNGfwEbeRWgbNEkqO" }
+	defer func() { newSCRAMNonce = defaultSCRAMNonce }()
+
+	c := newSCRAMClientGenerator(saslSCRAMSHA256)()
+	assert.Nil(c.Begin("user", "pencil", ""))
+
+	msg, err := c.Step("")
+	assert.Nil(err)
+	assert.Equal("n,,n=user,r=rOprNGfwEbeRWgbNEkqO", msg)
+	assert.False(c.Done())
+
+	msg, err = c.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	assert.Nil(err)
+	assert.Equal("c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=", msg)
+
+	_, err = c.Step("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=")
+	assert.Nil(err)
+	assert.True(c.Done())
+
+	// wrong server signature and server nonce.
+	assert.Nil(c.Begin("user", "pencil", ""))
+	c.Step("")
+	c.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	_, err = c.Step("v=AAAA")
+	assert.NotNil(err)
+
+	assert.Nil(c.Begin("user", "pencil", ""))
+	c.Step("")
+	_, err = c.Step("r=other,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	assert.NotNil(err)
+}
@@ -17,25 +17,140 @@
 
 package kafka
 
-import "github.com/megaease/easegress/pkg/filters"
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"text/template"
+
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/util/urlrule"
+)
+
+const (
+	saslPlain       = "PLAIN"
+	saslSCRAMSHA256 = "SCRAM-SHA-256"
+	saslSCRAMSHA512 = "SCRAM-SHA-512"
+
+	acksNone  = "none"
+	acksLocal = "local"
+	acksAll   = "all"
+)
 
 type (
 	// Spec is spec of Kafka
 	Spec struct {
 		filters.BaseSpec `json:",inline"`
 
-		Backend []string `json:"backend" jsonschema:"required,uniqueItems=true"`
-		Topic   *Topic   `json:"topic" jsonschema:"required"`
+		Backend  []string      `json:"backend" jsonschema:"required,uniqueItems=true"`
+		Topic    *Topic        `json:"topic" jsonschema:"required"`
+		Key      string        `json:"key" jsonschema:"omitempty"`
+		TLS      *TLSSpec      `json:"tls" jsonschema:"omitempty"`
+		SASL     *SASLSpec     `json:"sasl" jsonschema:"omitempty"`
+		Producer *ProducerSpec `json:"producer" jsonschema:"omitempty"`
 	}
 
 	// Topic defined ways to get Kafka topic
 	Topic struct {
-		Default string   `json:"default" jsonschema:"required"`
-		Dynamic *Dynamic `json:"dynamic" jsonschema:"omitempty"`
+		Default string       `json:"default" jsonschema:"required"`
+		Dynamic *Dynamic     `json:"dynamic" jsonschema:"omitempty"`
+		Rules   []*TopicRule `json:"rules" jsonschema:"omitempty"`
 	}
 
 	// Dynamic defines dynamic ways to get Kafka topic from http request
 	Dynamic struct {
 		Header string `json:"header" jsonschema:"omitempty"`
 	}
+
+	// TopicRule routes the requests matching the path and headers to a
+	// topic.
+	TopicRule struct {
+		Path    *urlrule.StringMatch            `json:"path" jsonschema:"omitempty"`
+		Headers map[string]*urlrule.StringMatch `json:"headers" jsonschema:"omitempty"`
+		Topic   string                          `json:"topic" jsonschema:"required"`
+	}
+
+	// TLSSpec is the configuration of the TLS connections to the Kafka
+	// backend.
+	TLSSpec struct {
+		CertBase64         string `json:"certBase64" jsonschema:"omitempty,format=base64"`
+		KeyBase64          string `json:"keyBase64" jsonschema:"omitempty,format=base64"`
+		RootCertBase64     string `json:"rootCertBase64" jsonschema:"omitempty,format=base64"`
+		InsecureSkipVerify bool   `json:"insecureSkipVerify" jsonschema:"omitempty"`
+	}
+
+	// SASLSpec is the configuration of the SASL authentication.
+	SASLSpec struct {
+		Mechanism string `json:"mechanism" jsonschema:"required,enum=PLAIN,enum=SCRAM-SHA-256,enum=SCRAM-SHA-512"`
+		Username  string `json:"username" jsonschema:"required"`
+		Password  string `json:"password" jsonschema:"required"`
+	}
+
+	// ProducerSpec is the configuration of the Kafka producer.
+	ProducerSpec struct {
+		RequiredAcks string `json:"requiredAcks" jsonschema:"omitempty,enum=,enum=none,enum=local,enum=all"`
+		Idempotent   bool   `json:"idempotent" jsonschema:"omitempty"`
+	}
 )
+
+// Validate validates the Spec.
+func (s *Spec) Validate() error {
+	if s.Key != "" {
+		if _, err := template.New("").Parse(s.Key); err != nil {
+			return fmt.Errorf("invalid key template: %v", err)
+		}
+	}
+	return nil
+}
+
+// Validate validates the TopicRule.
+func (r *TopicRule) Validate() error {
+	if r.Path == nil && len(r.Headers) == 0 {
+		return fmt.Errorf("at least one of path and headers must be specified")
+	}
+	return nil
+}
+
+// Validate validates the TLSSpec.
+func (s *TLSSpec) Validate() error {
+	if (s.CertBase64 == "") != (s.KeyBase64 == "") {
+		return fmt.Errorf("certBase64 and keyBase64 must be both empty or both not empty")
+	}
+
+	_, err := s.tlsConfig()
+	return err
+}
+
+func (s *TLSSpec) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: s.InsecureSkipVerify}
+
+	if s.CertBase64 != "" {
+		certPem, _ := base64.StdEncoding.DecodeString(s.CertBase64)
+		keyPem, _ := base64.StdEncoding.DecodeString(s.KeyBase64)
+		cert, err := tls.X509KeyPair(certPem, keyPem)
+		if err != nil {
+			return nil, fmt.Errorf("generate x509 key pair failed: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if s.RootCertBase64 != "" {
+		rootCertPem, _ := base64.StdEncoding.DecodeString(s.RootCertBase64)
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(rootCertPem) {
+			return nil, fmt.Errorf("no valid certificate found in rootCertBase64")
+		}
+		cfg.RootCAs = pool
+	}
+
+	return cfg, nil
+}
+
+// Validate validates the ProducerSpec.
+func (s *ProducerSpec) Validate() error {
+	if s.Idempotent && s.RequiredAcks != "" && s.RequiredAcks != acksAll {
+		return fmt.Errorf("requiredAcks must be all for idempotent producer")
+	}
+	return nil
+}
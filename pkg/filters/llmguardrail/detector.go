@@ -0,0 +1,233 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package llmguardrail
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	detectorRegexp  = "regexp"
+	detectorKeyword = "keyword"
+	detectorPII     = "pii"
+
+	actionBlock    = "block"
+	actionMask     = "mask"
+	actionAnnotate = "annotate"
+
+	defaultMask = "***"
+)
+
+type (
+	// DetectorSpec describes a detector.
+	DetectorSpec struct {
+		Name string `json:"name" jsonschema:"required"`
+		Type string `json:"type" jsonschema:"required,enum=regexp,enum=keyword,enum=pii"`
+		// Patterns are the regular expressions of the regexp detectors.
+		Patterns []string `json:"patterns" jsonschema:"omitempty"`
+		// Keywords are matched case-insensitively by the keyword detectors.
+		Keywords []string `json:"keywords" jsonschema:"omitempty"`
+		// PII are the kinds of personal information detected by the pii
+		// detectors, all kinds are detected if it is empty.
+		PII    []string `json:"pii" jsonschema:"omitempty,uniqueItems=true"`
+		Action string   `json:"action" jsonschema:"omitempty,enum=,enum=block,enum=mask,enum=annotate"`
+		Mask   string   `json:"mask" jsonschema:"omitempty"`
+	}
+
+	// detector finds the sensitive contents in texts.
+	detector struct {
+		spec *DetectorSpec
+		re   *regexp.Regexp
+		// valid further checks the matches if it is not nil, e.g. the
+		// checksum of credit card numbers.
+		valid func(s string) bool
+	}
+
+	piiKind struct {
+		pattern string
+		valid   func(s string) bool
+	}
+)
+
+// piiKinds are the supported kinds of personal information.
+var piiKinds = map[string]*piiKind{
+	"email": {pattern: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`},
+	"phone": {pattern: `(?:\+\d{1,3}[-. ]?)?\(?\b\d{3}\)?[-. ]?\d{3}[-. ]?\d{4}\b`},
+	"creditCard": {
+		pattern: `\b(?:\d[ -]?){12,18}\d\b`,
+		valid:   luhnValid,
+	},
+	"ssn":  {pattern: `\b\d{3}-\d{2}-\d{4}\b`},
+	"ipv4": {pattern: `\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`},
+}
+
+// piiOrder is the order to detect the personal information, credit card
+// numbers are detected before phone numbers, as they may look alike.
+var piiOrder = []string{"email", "creditCard", "ssn", "phone", "ipv4"}
+
+// Validate validates the DetectorSpec.
+func (spec *DetectorSpec) Validate() error {
+	_, err := newDetector(spec)
+	return err
+}
+
+func newDetector(spec *DetectorSpec) (*detector, error) {
+	d := &detector{spec: spec}
+
+	var patterns []string
+	flags := ""
+	switch spec.Type {
+	case detectorRegexp:
+		if len(spec.Patterns) == 0 {
+			return nil, fmt.Errorf("detector %s: patterns are required", spec.Name)
+		}
+		patterns = spec.Patterns
+	case detectorKeyword:
+		if len(spec.Keywords) == 0 {
+			return nil, fmt.Errorf("detector %s: keywords are required", spec.Name)
+		}
+		for _, kw := range spec.Keywords {
+			patterns = append(patterns, keywordPattern(kw))
+		}
+		flags = "(?i)"
+	case detectorPII:
+		kinds := spec.PII
+		if len(kinds) == 0 {
+			kinds = piiOrder
+		}
+		for _, name := range kinds {
+			kind := piiKinds[name]
+			if kind == nil {
+				return nil, fmt.Errorf("detector %s: unknown pii %s", spec.Name, name)
+			}
+			patterns = append(patterns, kind.pattern)
+			if kind.valid != nil {
+				d.valid = kind.valid
+			}
+		}
+	}
+
+	for i, p := range patterns {
+		patterns[i] = "(?:" + p + ")"
+	}
+	re, err := regexp.Compile(flags + strings.Join(patterns, "|"))
+	if err != nil {
+		return nil, fmt.Errorf("detector %s: %v", spec.Name, err)
+	}
+	if re.MatchString("") {
+		return nil, fmt.Errorf("detector %s: patterns must not match empty text", spec.Name)
+	}
+	d.re = re
+	return d, nil
+}
+
+// keywordPattern returns the pattern of a keyword, which only matches
+// whole words if the keyword begins or ends with a letter or a digit.
+func keywordPattern(kw string) string {
+	p := regexp.QuoteMeta(kw)
+	isWord := func(r rune) bool {
+		return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+	}
+	runes := []rune(kw)
+	if len(runes) > 0 && isWord(runes[0]) {
+		p = `\b` + p
+	}
+	if len(runes) > 0 && isWord(runes[len(runes)-1]) {
+		p += `\b`
+	}
+	return p
+}
+
+// luhnValid checks the checksum of a credit card number.
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n > 0 && sum%10 == 0
+}
+
+func (d *detector) action() string {
+	if d.spec.Action == "" {
+		return actionBlock
+	}
+	return d.spec.Action
+}
+
+// find returns the locations of the matches in text.
+func (d *detector) find(text string) [][]int {
+	matches := d.re.FindAllStringIndex(text, -1)
+	if d.valid == nil || len(matches) == 0 {
+		return matches
+	}
+
+	// the validation only applies to the matches of the credit card
+	// pattern, but it is harmless to other matches, as they contain
+	// separators other than spaces and hyphens, or fewer digits.
+	valid := matches[:0]
+	for _, m := range matches {
+		s := text[m[0]:m[1]]
+		if digits(s) < 13 || d.valid(s) {
+			valid = append(valid, m)
+		}
+	}
+	return valid
+}
+
+func digits(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			n++
+		}
+	}
+	return n
+}
+
+// mask replaces the matches in text with the mask.
+func (d *detector) mask(text string, matches [][]int) string {
+	mask := d.spec.Mask
+	if mask == "" {
+		mask = defaultMask
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, m := range matches {
+		sb.WriteString(text[last:m[0]])
+		sb.WriteString(mask)
+		last = m[1]
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
@@ -0,0 +1,502 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package llmguardrail
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of LLMGuardrail.
+	Kind = "LLMGuardrail"
+
+	resultBlocked     = "blocked"
+	resultInvalidBody = "invalidBody"
+
+	targetRequest  = "request"
+	targetResponse = "response"
+
+	// DataFindings is the context data key of the names of the detectors
+	// finding sensitive contents, and the flagged moderation categories.
+	DataFindings = "GUARDRAIL_FINDINGS"
+
+	defaultAnnotationHeader = "X-Guardrail-Findings"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "LLMGuardrail detects, blocks and masks sensitive contents in prompts and responses of LLMs.",
+	Results:     []string{resultBlocked, resultInvalidBody},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			Target:           targetRequest,
+			BlockStatusCode:  http.StatusBadRequest,
+			AnnotationHeader: defaultAnnotationHeader,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &LLMGuardrail{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// LLMGuardrail is the filter guarding the prompts and responses of LLMs.
+	LLMGuardrail struct {
+		spec *Spec
+
+		detectors []*detector
+		moderator *moderator
+		stats     *stats
+	}
+
+	// Spec describes the LLMGuardrail.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// Target is request or response, a guardrail guards the prompts
+		// of the requests or the completions of the responses.
+		Target           string          `json:"target" jsonschema:"omitempty,enum=,enum=request,enum=response"`
+		Detectors        []*DetectorSpec `json:"detectors" jsonschema:"omitempty"`
+		Moderation       *ModerationSpec `json:"moderation,omitempty" jsonschema:"omitempty"`
+		BlockStatusCode  int             `json:"blockStatusCode" jsonschema:"omitempty,minimum=400,maximum=599"`
+		AnnotationHeader string          `json:"annotationHeader" jsonschema:"omitempty"`
+		// Audit logs the findings, but not the contents, for each request
+		// with any findings.
+		Audit bool `json:"audit" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of LLMGuardrail.
+	Status struct {
+		Inspected uint64            `json:"inspected"`
+		Blocked   uint64            `json:"blocked"`
+		Masked    uint64            `json:"masked"`
+		Findings  map[string]uint64 `json:"findings"`
+	}
+
+	// stats is shared by the generations of an LLMGuardrail, as the
+	// streaming responses of the previous generation may still be being
+	// read.
+	stats struct {
+		lock   sync.Mutex
+		status Status
+	}
+
+	// inspection is the result of inspecting the texts of a message.
+	inspection struct {
+		findings  []string
+		blocked   bool
+		blockedBy string
+		masked    bool
+	}
+
+	// auditEntry is the audit log of an inspection.
+	auditEntry struct {
+		Time      time.Time `json:"time"`
+		Filter    string    `json:"filter"`
+		Target    string    `json:"target"`
+		Method    string    `json:"method"`
+		Path      string    `json:"path"`
+		RealIP    string    `json:"realIP"`
+		Findings  []string  `json:"findings"`
+		Blocked   bool      `json:"blocked"`
+		BlockedBy string    `json:"blockedBy,omitempty"`
+		Masked    bool      `json:"masked"`
+	}
+
+	// message is the common interface of httpprot.Request and
+	// httpprot.Response used by the guardrail.
+	message interface {
+		HTTPHeader() http.Header
+		IsStream() bool
+		RawPayload() []byte
+		SetPayload(payload interface{})
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if len(spec.Detectors) == 0 && spec.Moderation == nil {
+		return fmt.Errorf("detectors or moderation is required")
+	}
+	names := map[string]struct{}{}
+	for _, d := range spec.Detectors {
+		if _, ok := names[d.Name]; ok {
+			return fmt.Errorf("duplicated detector %s", d.Name)
+		}
+		names[d.Name] = struct{}{}
+	}
+	return nil
+}
+
+// Name returns the name of the LLMGuardrail filter instance.
+func (g *LLMGuardrail) Name() string {
+	return g.spec.Name()
+}
+
+// Kind returns the kind of LLMGuardrail.
+func (g *LLMGuardrail) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the LLMGuardrail
+func (g *LLMGuardrail) Spec() filters.Spec {
+	return g.spec
+}
+
+// Init initializes LLMGuardrail.
+func (g *LLMGuardrail) Init() {
+	g.stats = &stats{status: Status{Findings: map[string]uint64{}}}
+	g.reload()
+}
+
+// Inherit inherits previous generation of LLMGuardrail.
+func (g *LLMGuardrail) Inherit(previousGeneration filters.Filter) {
+	g.stats = previousGeneration.(*LLMGuardrail).stats
+	g.reload()
+}
+
+func (g *LLMGuardrail) reload() {
+	for _, spec := range g.spec.Detectors {
+		// the spec has been validated, so no error here.
+		d, _ := newDetector(spec)
+		g.detectors = append(g.detectors, d)
+	}
+	if g.spec.Moderation != nil {
+		g.moderator = newModerator(g.spec.Moderation)
+	}
+	if g.spec.BlockStatusCode == 0 {
+		g.spec.BlockStatusCode = http.StatusBadRequest
+	}
+}
+
+// inspect inspects the text, and returns the text with the sensitive
+// contents masked.
+func (g *LLMGuardrail) inspect(text string, ins *inspection) string {
+	for _, d := range g.detectors {
+		matches := d.find(text)
+		if len(matches) == 0 {
+			continue
+		}
+
+		ins.addFinding(d.spec.Name)
+		switch d.action() {
+		case actionBlock:
+			if !ins.blocked {
+				ins.blocked, ins.blockedBy = true, d.spec.Name
+			}
+		case actionMask:
+			text = d.mask(text, matches)
+			ins.masked = true
+		}
+	}
+	return text
+}
+
+func (ins *inspection) addFinding(name string) {
+	for _, f := range ins.findings {
+		if f == name {
+			return
+		}
+	}
+	ins.findings = append(ins.findings, name)
+}
+
+// moderate checks the texts with the moderation API.
+func (g *LLMGuardrail) moderate(ctx *context.Context, texts []string, ins *inspection) {
+	if g.moderator == nil || ins.blocked || len(texts) == 0 {
+		return
+	}
+
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	flagged, err := g.moderator.check(req.Context(), texts)
+	if err != nil {
+		logger.Warnf("%s: moderation failed: %v", g.Name(), err)
+		if g.spec.Moderation.FailureMode != failureModeOpen {
+			ins.blocked, ins.blockedBy = true, "moderation"
+		}
+		return
+	}
+	for _, c := range flagged {
+		ins.addFinding("moderation:" + c)
+	}
+	if len(flagged) > 0 {
+		ins.blocked, ins.blockedBy = true, "moderation"
+	}
+}
+
+// Handle inspects the prompts of the request, or the completions of the
+// response.
+func (g *LLMGuardrail) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	if g.spec.Target == targetResponse {
+		resp, ok := ctx.GetOutputResponse().(*httpprot.Response)
+		if !ok {
+			return ""
+		}
+		return g.handleResponse(ctx, req, resp)
+	}
+	return g.handleRequest(ctx, req)
+}
+
+func (g *LLMGuardrail) handleRequest(ctx *context.Context, req *httpprot.Request) string {
+	if req.IsStream() {
+		return g.respondError(ctx, http.StatusRequestEntityTooLarge, "request body too large", resultInvalidBody)
+	}
+
+	body, err := decodeBody(req.RawPayload())
+	if err != nil {
+		return g.respondError(ctx, http.StatusBadRequest, "invalid request body", resultInvalidBody)
+	}
+
+	ins := &inspection{}
+	var texts []string
+	visitPrompts(body, func(s string) string {
+		texts = append(texts, s)
+		return g.inspect(s, ins)
+	})
+	g.moderate(ctx, texts, ins)
+	g.record(ctx, targetRequest, ins)
+
+	if ins.blocked {
+		return g.respondError(ctx, g.spec.BlockStatusCode, "the request is blocked by the content policy", resultBlocked)
+	}
+	if ins.masked {
+		setBody(req, body)
+	}
+	return ""
+}
+
+func (g *LLMGuardrail) handleResponse(ctx *context.Context, req *httpprot.Request, resp *httpprot.Response) string {
+	mediaType, _, _ := mime.ParseMediaType(resp.HTTPHeader().Get("Content-Type"))
+	if resp.IsStream() {
+		if mediaType == "text/event-stream" {
+			resp.SetPayload(newSSEGuard(g, ctx, resp.GetPayload()))
+			resp.HTTPHeader().Del("Content-Length")
+		}
+		return ""
+	}
+
+	// error responses of the providers are not inspected.
+	if mediaType != "application/json" || resp.StatusCode()/100 != 2 {
+		return ""
+	}
+	body, err := decodeBody(resp.RawPayload())
+	if err != nil {
+		return ""
+	}
+
+	ins := &inspection{}
+	var texts []string
+	visitCompletions(body, func(s string) string {
+		texts = append(texts, s)
+		return g.inspect(s, ins)
+	})
+	g.moderate(ctx, texts, ins)
+	g.record(ctx, targetResponse, ins)
+
+	if ins.blocked {
+		return g.respondError(ctx, g.spec.BlockStatusCode, "the response is blocked by the content policy", resultBlocked)
+	}
+	if ins.masked {
+		setBody(resp, body)
+	}
+	return ""
+}
+
+// record records the inspection to the statistics, the context data and
+// the audit log, and annotates the message.
+func (g *LLMGuardrail) record(ctx *context.Context, target string, ins *inspection) {
+	g.stats.lock.Lock()
+	g.stats.status.Inspected++
+	if ins.blocked {
+		g.stats.status.Blocked++
+	}
+	if ins.masked {
+		g.stats.status.Masked++
+	}
+	for _, f := range ins.findings {
+		g.stats.status.Findings[f]++
+	}
+	g.stats.lock.Unlock()
+
+	if len(ins.findings) == 0 && !ins.blocked {
+		return
+	}
+
+	findings := ins.findings
+	if prev, ok := ctx.GetData(DataFindings).([]string); ok {
+		findings = append(append([]string{}, prev...), findings...)
+	}
+	ctx.SetData(DataFindings, findings)
+
+	if g.spec.AnnotationHeader != "" && len(ins.findings) > 0 {
+		var msg message = ctx.GetInputRequest().(*httpprot.Request)
+		if target == targetResponse {
+			msg = ctx.GetOutputResponse().(*httpprot.Response)
+		}
+		// the header of a streaming response has been sent.
+		if !msg.IsStream() {
+			msg.HTTPHeader().Set(g.spec.AnnotationHeader, strings.Join(ins.findings, ","))
+		}
+	}
+
+	if g.spec.Audit {
+		req := ctx.GetInputRequest().(*httpprot.Request)
+		entry := &auditEntry{
+			Time:      time.Now(),
+			Filter:    g.Name(),
+			Target:    target,
+			Method:    req.Method(),
+			Path:      req.Path(),
+			RealIP:    req.RealIP(),
+			Findings:  ins.findings,
+			Blocked:   ins.blocked,
+			BlockedBy: ins.blockedBy,
+			Masked:    ins.masked,
+		}
+		data, _ := json.Marshal(entry)
+		logger.Infof("guardrail audit: %s", data)
+	}
+}
+
+// respondError responds an OpenAI style error to the client.
+func (g *LLMGuardrail) respondError(ctx *context.Context, code int, msg, result string) string {
+	body, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": msg,
+			"type":    "content_filter",
+			"code":    result,
+		},
+	})
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(code)
+	resp.Std().Header.Set("Content-Type", "application/json")
+	resp.SetPayload(body)
+	ctx.SetOutputResponse(resp)
+	return result
+}
+
+// Status returns the status of LLMGuardrail.
+func (g *LLMGuardrail) Status() interface{} {
+	g.stats.lock.Lock()
+	defer g.stats.lock.Unlock()
+
+	s := g.stats.status
+	s.Findings = make(map[string]uint64, len(g.stats.status.Findings))
+	for k, v := range g.stats.status.Findings {
+		s.Findings[k] = v
+	}
+	return &s
+}
+
+// Close closes LLMGuardrail.
+func (g *LLMGuardrail) Close() {
+	if g.moderator != nil {
+		g.moderator.close()
+	}
+}
+
+func decodeBody(data []byte) (map[string]interface{}, error) {
+	body := map[string]interface{}{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func setBody(msg message, body map[string]interface{}) {
+	data, _ := json.Marshal(body)
+	msg.SetPayload(data)
+	msg.HTTPHeader().Del("Content-Length")
+}
+
+// rewrite calls fn for the string, or the strings in the array, of key in
+// m, and replaces them with the results.
+func rewrite(m map[string]interface{}, key string, fn func(string) string) {
+	switch v := m[key].(type) {
+	case string:
+		m[key] = fn(v)
+	case []interface{}:
+		for i, item := range v {
+			if s, ok := item.(string); ok {
+				v[i] = fn(s)
+			}
+		}
+	}
+}
+
+// visitPrompts visits the texts in the prompts of chat completions,
+// completions and embeddings requests.
+func visitPrompts(body map[string]interface{}, fn func(string) string) {
+	messages, _ := body["messages"].([]interface{})
+	for _, msg := range messages {
+		m, ok := msg.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if parts, ok := m["content"].([]interface{}); ok {
+			// multimodal contents, only the text parts are inspected.
+			for _, part := range parts {
+				if p, ok := part.(map[string]interface{}); ok {
+					rewrite(p, "text", fn)
+				}
+			}
+			continue
+		}
+		rewrite(m, "content", fn)
+	}
+	rewrite(body, "prompt", fn)
+	rewrite(body, "input", fn)
+}
+
+// visitCompletions visits the texts in the choices of completions, and of
+// the chunks of streaming completions.
+func visitCompletions(body map[string]interface{}, fn func(string) string) {
+	choices, _ := body["choices"].([]interface{})
+	for _, choice := range choices {
+		c, ok := choice.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		rewrite(c, "text", fn)
+		for _, key := range []string{"message", "delta"} {
+			if m, ok := c[key].(map[string]interface{}); ok {
+				rewrite(m, "content", fn)
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package llmguardrail
+
+import (
+	"bytes"
+	stdcontext "context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	failureModeOpen   = "open"
+	failureModeClosed = "closed"
+
+	defaultModerationTimeout = 5 * time.Second
+)
+
+type (
+	// ModerationSpec describes an external moderation API compatible with
+	// the moderation API of OpenAI.
+	ModerationSpec struct {
+		URL     string `json:"url" jsonschema:"required,format=uri"`
+		APIKey  string `json:"apiKey" jsonschema:"omitempty"`
+		Timeout string `json:"timeout" jsonschema:"omitempty,format=duration"`
+		// Categories are the categories to block, texts flagged in any
+		// category are blocked if it is empty.
+		Categories []string `json:"categories" jsonschema:"omitempty"`
+		// FailureMode is open or closed, texts are allowed in the open mode
+		// and blocked in the closed mode if the API is unavailable.
+		FailureMode string `json:"failureMode" jsonschema:"omitempty,enum=,enum=open,enum=closed"`
+	}
+
+	moderator struct {
+		spec    *ModerationSpec
+		client  *http.Client
+		timeout time.Duration
+	}
+
+	moderationResponse struct {
+		Results []struct {
+			Flagged    bool            `json:"flagged"`
+			Categories map[string]bool `json:"categories"`
+		} `json:"results"`
+	}
+)
+
+func newModerator(spec *ModerationSpec) *moderator {
+	m := &moderator{spec: spec, client: &http.Client{}, timeout: defaultModerationTimeout}
+	if d, err := time.ParseDuration(spec.Timeout); err == nil && d > 0 {
+		m.timeout = d
+	}
+	return m
+}
+
+// check checks the texts, and returns the flagged categories.
+func (m *moderator) check(ctx stdcontext.Context, texts []string) ([]string, error) {
+	body, _ := json.Marshal(map[string]interface{}{"input": texts})
+
+	ctx, cancel := stdcontext.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.spec.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.spec.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+m.spec.APIKey)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("moderation api responded %d", resp.StatusCode)
+	}
+
+	mr := &moderationResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(mr); err != nil {
+		return nil, fmt.Errorf("invalid moderation response: %v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, r := range mr.Results {
+		if !r.Flagged {
+			continue
+		}
+		if len(m.spec.Categories) == 0 {
+			seen["flagged"] = true
+		}
+		for c, v := range r.Categories {
+			if v {
+				seen[c] = true
+			}
+		}
+	}
+
+	var flagged []string
+	if seen["flagged"] {
+		for c := range seen {
+			flagged = append(flagged, c)
+		}
+		sort.Strings(flagged)
+		return flagged, nil
+	}
+	for _, c := range m.spec.Categories {
+		if seen[c] {
+			flagged = append(flagged, c)
+		}
+	}
+	return flagged, nil
+}
+
+func (m *moderator) close() {
+	m.client.CloseIdleConnections()
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package llmguardrail
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/megaease/easegress/pkg/context"
+)
+
+// maxTailSize is the size of the tail of the previous completion, which is
+// inspected together with the current chunk to find the contents split
+// into chunks.
+const maxTailSize = 256
+
+// sseGuard inspects the chunks of a streaming (Server-Sent Events)
+// completion. The masking only applies to each chunk, but the blocking
+// also applies to contents split into chunks. The stream is terminated
+// with an error event if it is blocked.
+type sseGuard struct {
+	g   *LLMGuardrail
+	ctx *context.Context
+
+	r      *bufio.Reader
+	closer io.Closer
+	out    bytes.Buffer
+	err    error
+
+	tail string
+	ins  *inspection
+	once sync.Once
+}
+
+func newSSEGuard(g *LLMGuardrail, ctx *context.Context, r io.Reader) *sseGuard {
+	sg := &sseGuard{g: g, ctx: ctx, r: bufio.NewReader(r), ins: &inspection{}}
+	if c, ok := r.(io.Closer); ok {
+		sg.closer = c
+	}
+	return sg
+}
+
+func (sg *sseGuard) Read(p []byte) (int, error) {
+	for sg.out.Len() == 0 && sg.err == nil {
+		line, err := sg.r.ReadBytes('\n')
+		if len(line) > 0 {
+			sg.process(line)
+		}
+		if err != nil && sg.err == nil {
+			sg.err = err
+		}
+	}
+
+	if sg.out.Len() > 0 {
+		return sg.out.Read(p)
+	}
+	sg.finish()
+	return 0, sg.err
+}
+
+// process inspects a line of the stream, and writes the result to out.
+func (sg *sseGuard) process(line []byte) {
+	trimmed := bytes.TrimSpace(line)
+	if !bytes.HasPrefix(trimmed, []byte("data:")) {
+		sg.out.Write(line)
+		return
+	}
+	data := bytes.TrimSpace(trimmed[len("data:"):])
+	body, err := decodeBody(data)
+	if err != nil {
+		// [DONE] or something else not inspected.
+		sg.out.Write(line)
+		return
+	}
+
+	masked := false
+	visitCompletions(body, func(s string) string {
+		// the chunk is inspected together with the tail of the previous
+		// ones for blocking, the masking only applies to the chunk.
+		blocking := &inspection{}
+		sg.g.inspect(sg.tail+s, blocking)
+		if blocking.blocked && !sg.ins.blocked {
+			sg.ins.blocked, sg.ins.blockedBy = true, blocking.blockedBy
+		}
+		for _, f := range blocking.findings {
+			sg.ins.addFinding(f)
+		}
+
+		sg.tail += s
+		if len(sg.tail) > maxTailSize {
+			sg.tail = sg.tail[len(sg.tail)-maxTailSize:]
+		}
+
+		ins := &inspection{}
+		s = sg.g.inspect(s, ins)
+		if ins.masked {
+			masked = true
+			sg.ins.masked = true
+		}
+		return s
+	})
+
+	if sg.ins.blocked {
+		sg.out.WriteString(`data: {"error":{"message":"the response is blocked by the content policy","type":"content_filter","code":"blocked"}}` + "\n\n")
+		sg.out.WriteString("data: [DONE]\n\n")
+		sg.err = io.EOF
+		return
+	}
+	if !masked {
+		sg.out.Write(line)
+		return
+	}
+
+	data, _ = json.Marshal(body)
+	sg.out.WriteString("data: ")
+	sg.out.Write(data)
+	sg.out.WriteByte('\n')
+}
+
+// finish records the inspection when the stream ends or is closed.
+func (sg *sseGuard) finish() {
+	sg.once.Do(func() {
+		sg.g.record(sg.ctx, targetResponse, sg.ins)
+	})
+}
+
+// Close implements io.Closer.
+func (sg *sseGuard) Close() error {
+	sg.finish()
+	if sg.closer != nil {
+		return sg.closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,351 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package llmproxy
+
+import (
+	"bytes"
+	stdcontext "context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	// StorageMemory stores the cached responses in memory.
+	StorageMemory = "memory"
+
+	defaultCacheThreshold  = 0.95
+	defaultCacheTTL        = time.Hour
+	defaultCacheMaxEntries = 1000
+	defaultEmbedTimeout    = 5 * time.Second
+)
+
+type (
+	// SemanticCacheSpec describes the semantic cache, which serves the
+	// cached responses of similar prompts.
+	SemanticCacheSpec struct {
+		Embedding *EmbeddingSpec `json:"embedding" jsonschema:"required"`
+		// Threshold is the minimum cosine similarity of the embeddings of
+		// the prompts to serve a cached response.
+		Threshold  float64 `json:"threshold" jsonschema:"omitempty,minimum=0,maximum=1"`
+		TTL        string  `json:"ttl" jsonschema:"omitempty,format=duration"`
+		MaxEntries int     `json:"maxEntries" jsonschema:"omitempty,minimum=1"`
+		Storage    string  `json:"storage" jsonschema:"omitempty,enum=,enum=memory"`
+		// PerKey partitions the cache by the keys extracted by the
+		// KeyExtractor, so that responses are not shared among consumers.
+		PerKey bool `json:"perKey" jsonschema:"omitempty"`
+	}
+
+	// EmbeddingSpec describes the OpenAI-compatible embeddings endpoint.
+	EmbeddingSpec struct {
+		URL     string `json:"url" jsonschema:"required,format=uri"`
+		APIKey  string `json:"apiKey" jsonschema:"omitempty"`
+		Model   string `json:"model" jsonschema:"required"`
+		Timeout string `json:"timeout" jsonschema:"omitempty,format=duration"`
+	}
+
+	// CacheStatus is the status of the semantic cache.
+	CacheStatus struct {
+		Entries int    `json:"entries"`
+		Hits    uint64 `json:"hits"`
+		Misses  uint64 `json:"misses"`
+		Stores  uint64 `json:"stores"`
+	}
+
+	semanticCache struct {
+		// counters come first to keep them 64-bit aligned.
+		hits   uint64
+		misses uint64
+		stores uint64
+
+		spec      *SemanticCacheSpec
+		client    *http.Client
+		threshold float64
+		ttl       time.Duration
+		timeout   time.Duration
+		store     vectorStore
+	}
+
+	// cacheEntry is a cached response.
+	cacheEntry struct {
+		partition  string
+		vector     []float32
+		statusCode int
+		header     http.Header
+		body       []byte
+		expires    time.Time
+	}
+
+	// vectorStore is the storage of cached responses, which finds the
+	// entry with the most similar embedding.
+	vectorStore interface {
+		search(partition string, vector []float32, now time.Time) (*cacheEntry, float64)
+		add(e *cacheEntry)
+		len() int
+	}
+
+	memoryVectorStore struct {
+		nextID uint64
+		cache  *lru.Cache
+	}
+
+	embeddingResponse struct {
+		Data []struct {
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+)
+
+// equal checks whether the cached entries of spec could be served with
+// other, so that the cache is kept when the filter is updated.
+func (spec *SemanticCacheSpec) equal(other *SemanticCacheSpec) bool {
+	if spec == nil || other == nil {
+		return false
+	}
+	return spec.Embedding.URL == other.Embedding.URL &&
+		spec.Embedding.Model == other.Embedding.Model &&
+		spec.MaxEntries == other.MaxEntries && spec.Storage == other.Storage &&
+		spec.PerKey == other.PerKey
+}
+
+func newSemanticCache(spec *SemanticCacheSpec, client *http.Client, store vectorStore) *semanticCache {
+	sc := &semanticCache{
+		spec:      spec,
+		client:    client,
+		threshold: spec.Threshold,
+		ttl:       defaultCacheTTL,
+		timeout:   defaultEmbedTimeout,
+		store:     store,
+	}
+	if sc.threshold == 0 {
+		sc.threshold = defaultCacheThreshold
+	}
+	if d, err := time.ParseDuration(spec.TTL); err == nil && d > 0 {
+		sc.ttl = d
+	}
+	if d, err := time.ParseDuration(spec.Embedding.Timeout); err == nil && d > 0 {
+		sc.timeout = d
+	}
+	if sc.store == nil {
+		maxEntries := spec.MaxEntries
+		if maxEntries <= 0 {
+			maxEntries = defaultCacheMaxEntries
+		}
+		sc.store = newMemoryVectorStore(maxEntries)
+	}
+	return sc
+}
+
+// embed returns the normalized embedding of the text.
+func (sc *semanticCache) embed(ctx stdcontext.Context, text string) ([]float32, error) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"model": sc.spec.Embedding.Model,
+		"input": text,
+	})
+
+	ctx, cancel := stdcontext.WithTimeout(ctx, sc.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sc.spec.Embedding.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if sc.spec.Embedding.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+sc.spec.Embedding.APIKey)
+	}
+
+	resp, err := sc.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embedding endpoint responded %d", resp.StatusCode)
+	}
+
+	er := &embeddingResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(er); err != nil {
+		return nil, fmt.Errorf("invalid embedding response: %v", err)
+	}
+	if len(er.Data) == 0 || len(er.Data[0].Embedding) == 0 {
+		return nil, fmt.Errorf("no embedding in response")
+	}
+	return normalize(er.Data[0].Embedding), nil
+}
+
+// lookup returns the cached response of the most similar prompt, if its
+// similarity is not less than the threshold.
+func (sc *semanticCache) lookup(partition string, vector []float32) *cacheEntry {
+	e, similarity := sc.store.search(partition, vector, time.Now())
+	if e == nil || similarity < sc.threshold {
+		atomic.AddUint64(&sc.misses, 1)
+		return nil
+	}
+	atomic.AddUint64(&sc.hits, 1)
+	return e
+}
+
+func (sc *semanticCache) add(partition string, vector []float32, statusCode int, header http.Header, body []byte) {
+	sc.store.add(&cacheEntry{
+		partition:  partition,
+		vector:     vector,
+		statusCode: statusCode,
+		header:     header,
+		body:       body,
+		expires:    time.Now().Add(sc.ttl),
+	})
+	atomic.AddUint64(&sc.stores, 1)
+}
+
+func (sc *semanticCache) status() *CacheStatus {
+	return &CacheStatus{
+		Entries: sc.store.len(),
+		Hits:    atomic.LoadUint64(&sc.hits),
+		Misses:  atomic.LoadUint64(&sc.misses),
+		Stores:  atomic.LoadUint64(&sc.stores),
+	}
+}
+
+// cacheable checks whether the response of the request could be cached,
+// only non-streaming completions are cached.
+func (lr *llmRequest) cacheable() bool {
+	return !lr.stream && lr.endpoint != "/embeddings"
+}
+
+// promptText returns the text to compute the embedding of, which are the
+// messages, or the prompt, of the request.
+func (lr *llmRequest) promptText() string {
+	var sb strings.Builder
+	if messages, ok := lr.body["messages"].([]interface{}); ok {
+		for _, m := range messages {
+			m, _ := m.(map[string]interface{})
+			role, _ := m["role"].(string)
+			content, ok := m["content"].(string)
+			if !ok {
+				data, _ := json.Marshal(m["content"])
+				content = string(data)
+			}
+			sb.WriteString(role)
+			sb.WriteString(": ")
+			sb.WriteString(content)
+			sb.WriteByte('\n')
+		}
+		return sb.String()
+	}
+
+	if prompt, ok := lr.body["prompt"].(string); ok {
+		return prompt
+	}
+	data, _ := json.Marshal(lr.body["prompt"])
+	return string(data)
+}
+
+// partition returns the partition of the request, only requests with
+// the same endpoint, model and parameters share cached responses.
+func (lr *llmRequest) partition(key string) string {
+	params := make(map[string]interface{}, len(lr.body))
+	for k, v := range lr.body {
+		switch k {
+		case "messages", "prompt", "user":
+		default:
+			params[k] = v
+		}
+	}
+	// the keys of maps are sorted by json.Marshal.
+	data, _ := json.Marshal(params)
+	return key + "\x00" + lr.endpoint + "\x00" + string(data)
+}
+
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	norm := math.Sqrt(sum)
+	if norm == 0 {
+		return v
+	}
+	for i := range v {
+		v[i] = float32(float64(v[i]) / norm)
+	}
+	return v
+}
+
+// similarity returns the cosine similarity of the normalized vectors.
+func similarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+func newMemoryVectorStore(maxEntries int) *memoryVectorStore {
+	cache, _ := lru.New(maxEntries)
+	return &memoryVectorStore{cache: cache}
+}
+
+// search scans the entries of the partition, which is fine for the
+// moderate number of entries of an in-memory cache.
+func (ms *memoryVectorStore) search(partition string, vector []float32, now time.Time) (*cacheEntry, float64) {
+	var best *cacheEntry
+	var bestID interface{}
+	bestSimilarity := -1.0
+
+	for _, id := range ms.cache.Keys() {
+		v, ok := ms.cache.Peek(id)
+		if !ok {
+			continue
+		}
+		e := v.(*cacheEntry)
+		if !now.Before(e.expires) {
+			ms.cache.Remove(id)
+			continue
+		}
+		if e.partition != partition {
+			continue
+		}
+		if s := similarity(vector, e.vector); s > bestSimilarity {
+			best, bestID, bestSimilarity = e, id, s
+		}
+	}
+
+	if best != nil {
+		// mark the entry as recently used.
+		ms.cache.Get(bestID)
+	}
+	return best, bestSimilarity
+}
+
+func (ms *memoryVectorStore) add(e *cacheEntry) {
+	ms.cache.Add(atomic.AddUint64(&ms.nextID, 1), e)
+}
+
+func (ms *memoryVectorStore) len() int {
+	return ms.cache.Len()
+}
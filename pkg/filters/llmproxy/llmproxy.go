@@ -0,0 +1,649 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package llmproxy
+
+import (
+	"bytes"
+	stdcontext "context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/filters/ratelimiter"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/readers"
+)
+
+const (
+	// Kind is the kind of LLMProxy.
+	Kind = "LLMProxy"
+
+	resultInvalidRequest = "invalidRequest"
+	resultRateLimited    = "rateLimited"
+	resultProviderFailed = "providerFailed"
+
+	// DataProvider is the context data key of the name of the provider
+	// serving the request.
+	DataProvider = "LLM_PROVIDER"
+	// DataModel is the context data key of the model requested by the
+	// client.
+	DataModel = "LLM_MODEL"
+	// DataPromptTokens is the context data key of the prompt tokens, it is
+	// not available until the response body is read for streaming
+	// responses.
+	DataPromptTokens = "LLM_PROMPT_TOKENS"
+	// DataCompletionTokens is the context data key of the completion
+	// tokens, it is not available until the response body is read for
+	// streaming responses.
+	DataCompletionTokens = "LLM_COMPLETION_TOKENS"
+	// DataCacheHit is the context data key of whether the response is
+	// served from the semantic cache.
+	DataCacheHit = "LLM_CACHE_HIT"
+
+	cacheHeader = "X-LLM-Cache"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "LLMProxy proxies OpenAI-compatible requests to LLM providers with failover and token accounting.",
+	Results:     []string{resultInvalidRequest, resultRateLimited, resultProviderFailed},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			FailoverCodes: []int{
+				http.StatusTooManyRequests,
+				http.StatusInternalServerError,
+				http.StatusBadGateway,
+				http.StatusServiceUnavailable,
+				http.StatusGatewayTimeout,
+			},
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &LLMProxy{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+// endpoints are the supported OpenAI-compatible endpoints.
+var endpoints = []string{"/chat/completions", "/completions", "/embeddings"}
+
+type (
+	// LLMProxy is the filter proxying requests to LLM providers.
+	LLMProxy struct {
+		spec *Spec
+
+		client  *http.Client
+		limiter *tokenLimiter
+		cache   *semanticCache
+		stats   *stats
+	}
+
+	// Spec describes the LLMProxy.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// Providers are tried in order, the next one serving the model is
+		// tried if one fails.
+		Providers     []*ProviderSpec           `json:"providers" jsonschema:"required,minItems=1"`
+		FailoverCodes []int                     `json:"failoverCodes" jsonschema:"omitempty,uniqueItems=true"`
+		KeyExtractor  *ratelimiter.KeyExtractor `json:"keyExtractor,omitempty" jsonschema:"omitempty"`
+		TokenLimit    *TokenLimitSpec           `json:"tokenLimit,omitempty" jsonschema:"omitempty"`
+		SemanticCache *SemanticCacheSpec        `json:"semanticCache,omitempty" jsonschema:"omitempty"`
+	}
+
+	// ProviderSpec describes a provider, or a deployment of a provider.
+	ProviderSpec struct {
+		Name string `json:"name" jsonschema:"required"`
+		// BaseURL is the URL the endpoints are appended to, for example,
+		// https://api.openai.com/v1.
+		BaseURL      string `json:"baseURL" jsonschema:"required,format=uri"`
+		APIKey       string `json:"apiKey" jsonschema:"omitempty"`
+		APIKeyHeader string `json:"apiKeyHeader" jsonschema:"omitempty"`
+		// Models are the models served by the provider, all models are
+		// served if it is empty.
+		Models []string `json:"models" jsonschema:"omitempty"`
+		// ModelMapping maps the models requested by clients to the models,
+		// or deployments, of the provider.
+		ModelMapping map[string]string `json:"modelMapping" jsonschema:"omitempty"`
+		// Query is added to the query of the requests, e.g. api-version.
+		Query       map[string]string `json:"query" jsonschema:"omitempty"`
+		Timeout     string            `json:"timeout" jsonschema:"omitempty,format=duration"`
+		StreamUsage bool              `json:"streamUsage" jsonschema:"omitempty"`
+
+		timeout time.Duration
+	}
+
+	// TokenLimitSpec describes the token rate limit of the keys.
+	TokenLimitSpec struct {
+		TokensPerMinute int64 `json:"tokensPerMinute" jsonschema:"required,minimum=1"`
+	}
+
+	// Stat is the statistics of a model of a provider.
+	Stat struct {
+		Provider         string `json:"provider"`
+		Model            string `json:"model"`
+		Requests         uint64 `json:"requests"`
+		Failures         uint64 `json:"failures"`
+		PromptTokens     int64  `json:"promptTokens"`
+		CompletionTokens int64  `json:"completionTokens"`
+	}
+
+	// Status is the status of the LLMProxy.
+	Status struct {
+		Stats []*Stat      `json:"stats"`
+		Cache *CacheStatus `json:"cache,omitempty"`
+	}
+
+	statKey struct {
+		provider string
+		model    string
+	}
+
+	// stats is shared by the generations of an LLMProxy, as the streaming
+	// responses of the previous generation may still be being read.
+	stats struct {
+		lock sync.Mutex
+		m    map[statKey]*Stat
+	}
+
+	// llmRequest is the parsed request of the client.
+	llmRequest struct {
+		endpoint    string
+		model       string
+		stream      bool
+		body        map[string]interface{}
+		promptChars int
+
+		// cachePartition and cacheVector are set if the response should
+		// be stored into the semantic cache.
+		cachePartition string
+		cacheVector    []float32
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	names := map[string]struct{}{}
+	for _, p := range spec.Providers {
+		if _, ok := names[p.Name]; ok {
+			return fmt.Errorf("duplicated provider %s", p.Name)
+		}
+		names[p.Name] = struct{}{}
+	}
+	if spec.TokenLimit != nil && spec.KeyExtractor == nil {
+		return fmt.Errorf("keyExtractor is required by tokenLimit")
+	}
+	if sc := spec.SemanticCache; sc != nil && sc.PerKey && spec.KeyExtractor == nil {
+		return fmt.Errorf("keyExtractor is required by semanticCache.perKey")
+	}
+	return nil
+}
+
+// serves checks whether the provider serves the model.
+func (p *ProviderSpec) serves(model string) bool {
+	if len(p.Models) == 0 {
+		return true
+	}
+	for _, m := range p.Models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+// Name returns the name of the LLMProxy filter instance.
+func (lp *LLMProxy) Name() string {
+	return lp.spec.Name()
+}
+
+// Kind returns the kind of LLMProxy.
+func (lp *LLMProxy) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the LLMProxy
+func (lp *LLMProxy) Spec() filters.Spec {
+	return lp.spec
+}
+
+// Init initializes LLMProxy.
+func (lp *LLMProxy) Init() {
+	lp.stats = &stats{m: map[statKey]*Stat{}}
+	lp.reload(nil)
+}
+
+// Inherit inherits previous generation of LLMProxy.
+func (lp *LLMProxy) Inherit(previousGeneration filters.Filter) {
+	prev := previousGeneration.(*LLMProxy)
+	lp.stats = prev.stats
+	lp.reload(prev)
+}
+
+func (lp *LLMProxy) reload(prev *LLMProxy) {
+	for _, p := range lp.spec.Providers {
+		p.timeout, _ = time.ParseDuration(p.Timeout)
+		p.BaseURL = strings.TrimSuffix(p.BaseURL, "/")
+	}
+
+	if ke := lp.spec.KeyExtractor; ke != nil {
+		ke.Init()
+	}
+	if tl := lp.spec.TokenLimit; tl != nil {
+		lp.limiter = newTokenLimiter(tl.TokensPerMinute, lp.spec.KeyExtractor.MaxKeys)
+	}
+
+	lp.client = &http.Client{
+		// the timeout of the providers is applied to each request, as the
+		// streaming responses may last long.
+		Timeout: 0,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 60 * time.Second,
+			}).DialContext,
+			MaxIdleConns:          1024,
+			MaxIdleConnsPerHost:   128,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}
+
+	if sc := lp.spec.SemanticCache; sc != nil {
+		// the cached responses are kept if they are still valid.
+		var store vectorStore
+		if prev != nil && prev.cache != nil && sc.equal(prev.spec.SemanticCache) {
+			store = prev.cache.store
+		}
+		lp.cache = newSemanticCache(sc, lp.client, store)
+	}
+}
+
+// parseRequest parses the request of the client.
+func parseRequest(req *httpprot.Request) (*llmRequest, error) {
+	lr := &llmRequest{}
+	for _, ep := range endpoints {
+		if strings.HasSuffix(req.Path(), ep) {
+			lr.endpoint = ep
+			break
+		}
+	}
+	if lr.endpoint == "" {
+		return nil, fmt.Errorf("unsupported endpoint %s", req.Path())
+	}
+
+	d := json.NewDecoder(bytes.NewReader(req.RawPayload()))
+	d.UseNumber()
+	if err := d.Decode(&lr.body); err != nil {
+		return nil, fmt.Errorf("invalid request body: %v", err)
+	}
+
+	lr.model, _ = lr.body["model"].(string)
+	if lr.model == "" {
+		return nil, fmt.Errorf("model is required")
+	}
+	lr.stream, _ = lr.body["stream"].(bool)
+
+	// the prompt is only used to estimate the tokens if the provider
+	// doesn't report the usage.
+	if messages, ok := lr.body["messages"].([]interface{}); ok {
+		for _, m := range messages {
+			if m, ok := m.(map[string]interface{}); ok {
+				content, _ := m["content"].(string)
+				lr.promptChars += len(content)
+			}
+		}
+	} else {
+		prompt, _ := json.Marshal(lr.body["prompt"])
+		lr.promptChars = len(prompt)
+		input, _ := json.Marshal(lr.body["input"])
+		lr.promptChars += len(input)
+	}
+
+	return lr, nil
+}
+
+// Handle proxies the request to the providers.
+func (lp *LLMProxy) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	if req.IsStream() {
+		// the body has not been read, as it is larger than the max payload
+		// size of the server.
+		return lp.respondError(ctx, http.StatusRequestEntityTooLarge, "request body too large", resultInvalidRequest)
+	}
+
+	lr, err := parseRequest(req)
+	if err != nil {
+		return lp.respondError(ctx, http.StatusBadRequest, err.Error(), resultInvalidRequest)
+	}
+	ctx.SetData(DataModel, lr.model)
+
+	key := ""
+	if ke := lp.spec.KeyExtractor; ke != nil {
+		key = ke.Extract(req)
+	}
+	if lp.limiter != nil {
+		if ok, wait := lp.limiter.allow(key, time.Now()); !ok {
+			seconds := int(wait.Seconds()) + 1
+			lp.respondError(ctx, http.StatusTooManyRequests, "token rate limit exceeded", resultRateLimited)
+			resp := ctx.GetOutputResponse().(*httpprot.Response)
+			resp.Std().Header.Set("Retry-After", strconv.Itoa(seconds))
+			return resultRateLimited
+		}
+	}
+
+	if lp.cache != nil && lr.cacheable() && lp.serveFromCache(ctx, lr, key) {
+		return ""
+	}
+
+	for _, p := range lp.spec.Providers {
+		if !p.serves(lr.model) {
+			continue
+		}
+
+		stdResp, cancel, err := lp.forward(req, lr, p)
+		if err != nil {
+			logger.Warnf("%s: provider %s failed: %v", lp.Name(), p.Name, err)
+			lp.addStat(p.Name, lr.model, nil, true)
+			continue
+		}
+		if lp.isFailoverCode(stdResp.StatusCode) {
+			logger.Warnf("%s: provider %s responded %d", lp.Name(), p.Name, stdResp.StatusCode)
+			stdResp.Body.Close()
+			cancel()
+			lp.addStat(p.Name, lr.model, nil, true)
+			continue
+		}
+
+		ctx.SetData(DataProvider, p.Name)
+		if err = lp.setResponse(ctx, lr, p, key, stdResp, cancel); err != nil {
+			logger.Warnf("%s: failed to read response of provider %s: %v", lp.Name(), p.Name, err)
+			lp.addStat(p.Name, lr.model, nil, true)
+			continue
+		}
+		return ""
+	}
+
+	return lp.respondError(ctx, http.StatusBadGateway, "no provider available", resultProviderFailed)
+}
+
+func (lp *LLMProxy) isFailoverCode(code int) bool {
+	for _, c := range lp.spec.FailoverCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// forward sends the request to the provider, cancel must be called after
+// the response body is read.
+func (lp *LLMProxy) forward(req *httpprot.Request, lr *llmRequest, p *ProviderSpec) (*http.Response, stdcontext.CancelFunc, error) {
+	body := make(map[string]interface{}, len(lr.body)+1)
+	for k, v := range lr.body {
+		body[k] = v
+	}
+	if model, ok := p.ModelMapping[lr.model]; ok {
+		body["model"] = model
+	}
+	if lr.stream && p.StreamUsage {
+		body["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	u, err := url.Parse(p.BaseURL + lr.endpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(p.Query) > 0 {
+		q := u.Query()
+		for k, v := range p.Query {
+			q.Set(k, v)
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	stdctx, cancel := stdcontext.WithCancel(req.Context())
+	stdReq, err := http.NewRequestWithContext(stdctx, http.MethodPost, u.String(), bytes.NewReader(data))
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	stdReq.Header.Set("Content-Type", "application/json")
+	if accept := req.HTTPHeader().Get("Accept"); accept != "" {
+		stdReq.Header.Set("Accept", accept)
+	}
+	if p.APIKey != "" {
+		switch p.APIKeyHeader {
+		case "", "Authorization":
+			stdReq.Header.Set("Authorization", "Bearer "+p.APIKey)
+		default:
+			stdReq.Header.Set(p.APIKeyHeader, p.APIKey)
+		}
+	}
+
+	// the timeout only limits the time to the response header, streaming
+	// responses are not interrupted.
+	var timer *time.Timer
+	if p.timeout > 0 {
+		timer = time.AfterFunc(p.timeout, cancel)
+	}
+	stdResp, err := lp.client.Do(stdReq)
+	if timer != nil && !timer.Stop() {
+		if err == nil {
+			stdResp.Body.Close()
+		}
+		cancel()
+		return nil, nil, fmt.Errorf("timeout after %s", p.timeout)
+	}
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return stdResp, cancel, nil
+}
+
+// setResponse sets the response of the provider as the output response,
+// the tokens are counted when the body is read.
+func (lp *LLMProxy) setResponse(ctx *context.Context, lr *llmRequest, p *ProviderSpec, key string, stdResp *http.Response, cancel stdcontext.CancelFunc) error {
+	resp, _ := httpprot.NewResponse(stdResp)
+	resp.Std().Header.Del("Content-Length")
+
+	isSSE := strings.HasPrefix(stdResp.Header.Get("Content-Type"), "text/event-stream")
+	if !isSSE {
+		defer cancel()
+		defer stdResp.Body.Close()
+
+		body, err := io.ReadAll(stdResp.Body)
+		if err != nil {
+			return err
+		}
+		resp.SetPayload(body)
+		ctx.SetOutputResponse(resp)
+
+		if stdResp.StatusCode/100 != 2 {
+			lp.addStat(p.Name, lr.model, nil, true)
+			return nil
+		}
+		lp.account(ctx, lr, p, key, parseUsage(body))
+		if lr.cacheVector != nil {
+			lp.cache.add(lr.cachePartition, lr.cacheVector, stdResp.StatusCode, resp.HTTPHeader().Clone(), body)
+			resp.HTTPHeader().Set(cacheHeader, "miss")
+		}
+		return nil
+	}
+
+	sc := &sseCounter{}
+	once := sync.Once{}
+	finish := func() {
+		once.Do(func() {
+			lp.account(ctx, lr, p, key, sc.result(lr.promptChars))
+			cancel()
+		})
+	}
+
+	cr := readers.NewCallbackReader(stdResp.Body)
+	cr.OnAfter(func(total int, data []byte, err error) {
+		sc.feed(data)
+		if err != nil {
+			finish()
+		}
+	})
+	cr.OnClose(finish)
+
+	resp.SetPayload(cr)
+	ctx.SetOutputResponse(resp)
+	return nil
+}
+
+// serveFromCache serves the request with the cached response of a similar
+// prompt, the request is proxied if the embedding of the prompt is not
+// available.
+func (lp *LLMProxy) serveFromCache(ctx *context.Context, lr *llmRequest, key string) bool {
+	if !lp.cache.spec.PerKey {
+		key = ""
+	}
+	partition := lr.partition(key)
+
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	vector, err := lp.cache.embed(req.Context(), lr.promptText())
+	if err != nil {
+		logger.Warnf("%s: failed to get embedding: %v", lp.Name(), err)
+		return false
+	}
+
+	e := lp.cache.lookup(partition, vector)
+	if e == nil {
+		lr.cachePartition, lr.cacheVector = partition, vector
+		return false
+	}
+
+	resp, _ := httpprot.NewResponse(nil)
+	header := resp.HTTPHeader()
+	for k, v := range e.header {
+		header[k] = append([]string(nil), v...)
+	}
+	header.Set(cacheHeader, "hit")
+	resp.SetStatusCode(e.statusCode)
+	resp.SetPayload(e.body)
+	ctx.SetOutputResponse(resp)
+	ctx.SetData(DataCacheHit, true)
+	return true
+}
+
+// account records the usage of a successful request.
+func (lp *LLMProxy) account(ctx *context.Context, lr *llmRequest, p *ProviderSpec, key string, usage *Usage) {
+	if usage == nil {
+		usage = &Usage{PromptTokens: estimateTokens(lr.promptChars), Estimated: true}
+		usage.TotalTokens = usage.PromptTokens
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+
+	ctx.SetData(DataPromptTokens, usage.PromptTokens)
+	ctx.SetData(DataCompletionTokens, usage.CompletionTokens)
+	lp.addStat(p.Name, lr.model, usage, false)
+	if lp.limiter != nil {
+		lp.limiter.consume(key, usage.TotalTokens, time.Now())
+	}
+}
+
+func (lp *LLMProxy) addStat(provider, model string, usage *Usage, failed bool) {
+	lp.stats.lock.Lock()
+	defer lp.stats.lock.Unlock()
+
+	k := statKey{provider: provider, model: model}
+	s := lp.stats.m[k]
+	if s == nil {
+		s = &Stat{Provider: provider, Model: model}
+		lp.stats.m[k] = s
+	}
+
+	s.Requests++
+	if failed {
+		s.Failures++
+	}
+	if usage != nil {
+		s.PromptTokens += usage.PromptTokens
+		s.CompletionTokens += usage.CompletionTokens
+	}
+}
+
+// respondError responds an OpenAI style error to the client.
+func (lp *LLMProxy) respondError(ctx *context.Context, code int, msg, result string) string {
+	body, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": msg,
+			"type":    result,
+		},
+	})
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(code)
+	resp.Std().Header.Set("Content-Type", "application/json")
+	resp.SetPayload(body)
+	ctx.SetOutputResponse(resp)
+	return result
+}
+
+// Status returns the status of LLMProxy.
+func (lp *LLMProxy) Status() interface{} {
+	lp.stats.lock.Lock()
+	defer lp.stats.lock.Unlock()
+
+	s := &Status{}
+	for _, stat := range lp.stats.m {
+		copied := *stat
+		s.Stats = append(s.Stats, &copied)
+	}
+	sort.Slice(s.Stats, func(i, j int) bool {
+		if s.Stats[i].Provider != s.Stats[j].Provider {
+			return s.Stats[i].Provider < s.Stats[j].Provider
+		}
+		return s.Stats[i].Model < s.Stats[j].Model
+	})
+	if lp.cache != nil {
+		s.Cache = lp.cache.status()
+	}
+	return s
+}
+
+// Close closes LLMProxy.
+func (lp *LLMProxy) Close() {
+	lp.client.CloseIdleConnections()
+}
@@ -0,0 +1,314 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package llmproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newTestLLMProxy(t *testing.T, yamlConfig string) *LLMProxy {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		t.Fatalf("failed to create spec: %v", err)
+	}
+	lp := kind.CreateInstance(spec).(*LLMProxy)
+	lp.Init()
+	return lp
+}
+
+func newContext(path, body string) *context.Context {
+	ctx := context.New(nil)
+	stdReq, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1"+path, strings.NewReader(body))
+	stdReq.Header.Set("X-Api-Key", "alice")
+	req, _ := httpprot.NewRequest(stdReq)
+	req.FetchPayload(0)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestSSECounter(t *testing.T) {
+	assert := assert.New(t)
+
+	sc := &sseCounter{}
+	sc.feed([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\ndata: {\"cho"))
+	sc.feed([]byte("ices\":[{\"delta\":{\"content\":\" world!\"}}]}\n\ndata: [DONE]"))
+	u := sc.result(40)
+	assert.True(u.Estimated)
+	assert.Equal(int64(10), u.PromptTokens)
+	assert.Equal(int64(3), u.CompletionTokens)
+
+	sc = &sseCounter{}
+	sc.feed([]byte("data: {\"choices\":[],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":7,\"total_tokens\":12}}\n"))
+	u = sc.result(40)
+	assert.False(u.Estimated)
+	assert.Equal(int64(12), u.TotalTokens)
+}
+
+func TestTokenLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	tl := newTokenLimiter(60, 0)
+	ok, _ := tl.allow("alice", now)
+	assert.True(ok)
+
+	tl.consume("alice", 90, now)
+	ok, wait := tl.allow("alice", now)
+	assert.False(ok)
+	assert.InDelta(float64(31*time.Second), float64(wait), float64(time.Millisecond))
+
+	ok, _ = tl.allow("bob", now)
+	assert.True(ok)
+
+	ok, _ = tl.allow("alice", now.Add(31*time.Second))
+	assert.True(ok)
+}
+
+func TestFailover(t *testing.T) {
+	assert := assert.New(t)
+
+	failed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failed.Close()
+
+	var received map[string]interface{}
+	var query, auth string
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		query = r.URL.Query().Get("api-version")
+		auth = r.Header.Get("Api-Key")
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"choices":[{"message":{"content":"Hi"}}],"usage":{"prompt_tokens":9,"completion_tokens":1,"total_tokens":10}}`)
+	}))
+	defer ok.Close()
+
+	lp := newTestLLMProxy(t, `
+kind: LLMProxy
+name: llm
+providers:
+- name: openai
+  baseURL: `+failed.URL+`/v1
+  apiKey: sk-1
+- name: other
+  baseURL: `+failed.URL+`/v1
+  models: [claude]
+- name: azure
+  baseURL: `+ok.URL+`/openai/deployments/gpt
+  apiKey: az-1
+  apiKeyHeader: Api-Key
+  modelMapping:
+    gpt-4o: gpt4o-deployment
+  query:
+    api-version: "2024-06-01"
+`)
+	defer lp.Close()
+
+	ctx := newContext("/v1/chat/completions", `{"model":"gpt-4o","messages":[{"role":"user","content":"Hello"}],"temperature":0.5}`)
+	assert.Equal("", lp.Handle(ctx))
+	assert.Equal("gpt4o-deployment", received["model"])
+	assert.Equal(0.5, received["temperature"])
+	assert.Equal("2024-06-01", query)
+	assert.Equal("az-1", auth)
+
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Contains(string(resp.RawPayload()), `"content":"Hi"`)
+	assert.Equal("azure", ctx.GetData(DataProvider))
+	assert.Equal(int64(9), ctx.GetData(DataPromptTokens))
+	assert.Equal(int64(1), ctx.GetData(DataCompletionTokens))
+
+	status := lp.Status().(*Status)
+	assert.Equal(2, len(status.Stats))
+	assert.Equal(Stat{Provider: "azure", Model: "gpt-4o", Requests: 1, PromptTokens: 9, CompletionTokens: 1}, *status.Stats[0])
+	assert.Equal(Stat{Provider: "openai", Model: "gpt-4o", Requests: 1, Failures: 1}, *status.Stats[1])
+
+	// no provider serves the model.
+	ctx = newContext("/v1/chat/completions", `{"model":"claude","messages":[]}`)
+	assert.Equal(resultProviderFailed, lp.Handle(ctx))
+	assert.Equal(http.StatusBadGateway, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	ctx = newContext("/v1/images/generations", `{"model":"dall-e"}`)
+	assert.Equal(resultInvalidRequest, lp.Handle(ctx))
+	ctx = newContext("/v1/chat/completions", `{"messages":[]}`)
+	assert.Equal(resultInvalidRequest, lp.Handle(ctx))
+	assert.Equal(http.StatusBadRequest, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+}
+
+func TestStreamAndTokenLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, s := range []string{"Hel", "lo"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", s)
+			w.(http.Flusher).Flush()
+		}
+		io.WriteString(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":20,\"completion_tokens\":2,\"total_tokens\":22}}\n\ndata: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	lp := newTestLLMProxy(t, `
+kind: LLMProxy
+name: llm
+providers:
+- name: openai
+  baseURL: `+server.URL+`/v1
+  streamUsage: true
+keyExtractor:
+  source: header
+  name: X-Api-Key
+tokenLimit:
+  tokensPerMinute: 20
+`)
+	defer lp.Close()
+
+	ctx := newContext("/v1/chat/completions", `{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"Hi"}]}`)
+	assert.Equal("", lp.Handle(ctx))
+	assert.Equal(map[string]interface{}{"include_usage": true}, received["stream_options"])
+
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.True(resp.IsStream())
+	body, err := io.ReadAll(resp.GetPayload())
+	assert.NoError(err)
+	assert.Contains(string(body), "data: [DONE]")
+	resp.Close()
+
+	assert.Equal(int64(20), ctx.GetData(DataPromptTokens))
+	assert.Equal(int64(2), ctx.GetData(DataCompletionTokens))
+
+	// 22 tokens consumed, alice is limited, but bob is not.
+	ctx = newContext("/v1/chat/completions", `{"model":"gpt-4o","messages":[]}`)
+	assert.Equal(resultRateLimited, lp.Handle(ctx))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusTooManyRequests, resp.StatusCode())
+	assert.NotEmpty(resp.HTTPHeader().Get("Retry-After"))
+
+	ctx = newContext("/v1/chat/completions", `{"model":"gpt-4o","stream":true,"messages":[]}`)
+	ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Set("X-Api-Key", "bob")
+	assert.Equal("", lp.Handle(ctx))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	io.ReadAll(resp.GetPayload())
+	resp.Close()
+
+	status := lp.Status().(*Status)
+	assert.Equal(int64(40), status.Stats[0].PromptTokens)
+	assert.Equal(uint64(2), status.Stats[0].Requests)
+}
+
+func TestSemanticCache(t *testing.T) {
+	assert := assert.New(t)
+
+	embedding := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		input := strings.ToLower(body["input"].(string))
+		vector := []float32{0, 1}
+		if strings.Contains(input, "weather") {
+			vector = []float32{1, 0.1}
+			if strings.Contains(input, "today") {
+				vector = []float32{1, 0.12}
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": []interface{}{map[string]interface{}{"embedding": vector}}})
+	}))
+	defer embedding.Close()
+
+	calls := 0
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"choices":[{"message":{"content":"answer %d"}}]}`, calls)
+	}))
+	defer provider.Close()
+
+	spec := `
+kind: LLMProxy
+name: llm
+providers:
+- name: openai
+  baseURL: ` + provider.URL + `
+semanticCache:
+  embedding:
+    url: ` + embedding.URL + `
+    model: text-embedding-3-small
+  threshold: 0.99
+`
+	lp := newTestLLMProxy(t, spec)
+
+	handle := func(lp *LLMProxy, body string) (*context.Context, string) {
+		ctx := newContext("/v1/chat/completions", body)
+		assert.Equal("", lp.Handle(ctx))
+		resp := ctx.GetOutputResponse().(*httpprot.Response)
+		return ctx, string(resp.RawPayload())
+	}
+
+	ctx, body := handle(lp, `{"model":"gpt-4o","messages":[{"role":"user","content":"How is the weather?"}]}`)
+	assert.Contains(body, "answer 1")
+	assert.Equal("miss", ctx.GetOutputResponse().(*httpprot.Response).HTTPHeader().Get(cacheHeader))
+
+	// similar prompt.
+	ctx, body = handle(lp, `{"model":"gpt-4o","messages":[{"role":"user","content":"How is the weather today?"}]}`)
+	assert.Contains(body, "answer 1")
+	assert.Equal(true, ctx.GetData(DataCacheHit))
+	assert.Equal("hit", ctx.GetOutputResponse().(*httpprot.Response).HTTPHeader().Get(cacheHeader))
+
+	// different prompt, model or parameters.
+	_, body = handle(lp, `{"model":"gpt-4o","messages":[{"role":"user","content":"Tell me a joke"}]}`)
+	assert.Contains(body, "answer 2")
+	_, body = handle(lp, `{"model":"gpt-4o-mini","messages":[{"role":"user","content":"How is the weather?"}]}`)
+	assert.Contains(body, "answer 3")
+	_, body = handle(lp, `{"model":"gpt-4o","temperature":0,"messages":[{"role":"user","content":"How is the weather?"}]}`)
+	assert.Contains(body, "answer 4")
+
+	assert.Equal(&CacheStatus{Entries: 4, Hits: 1, Misses: 4, Stores: 4}, lp.Status().(*Status).Cache)
+
+	// the cache is kept by the next generation.
+	lp2 := newTestLLMProxy(t, spec)
+	lp2.Inherit(lp)
+	lp.Close()
+	defer lp2.Close()
+	_, body = handle(lp2, `{"model":"gpt-4o","messages":[{"role":"user","content":"Tell me a joke"}]}`)
+	assert.Contains(body, "answer 2")
+}
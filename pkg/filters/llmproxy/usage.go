@@ -0,0 +1,197 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package llmproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const defaultMaxKeys = 10000
+
+type (
+	// Usage is the token usage of a request, it is estimated from the
+	// length of the texts if the provider doesn't report it.
+	Usage struct {
+		PromptTokens     int64 `json:"prompt_tokens"`
+		CompletionTokens int64 `json:"completion_tokens"`
+		TotalTokens      int64 `json:"total_tokens"`
+		Estimated        bool  `json:"-"`
+	}
+
+	// completion is the part of a completion, or a chunk of a streaming
+	// completion, used by token accounting.
+	completion struct {
+		Usage   *Usage `json:"usage"`
+		Choices []struct {
+			Text  string `json:"text"`
+			Delta struct {
+				Content string `json:"content"`
+			} `json:"delta"`
+		} `json:"choices"`
+	}
+
+	// sseCounter counts the tokens of a streaming (SSE) response as the
+	// data passes through.
+	sseCounter struct {
+		line       []byte
+		usage      *Usage
+		completion int
+	}
+
+	// tokenBucket is a token bucket whose tokens are LLM tokens, it can go
+	// into debt, as the tokens of a request are only known after the
+	// response.
+	tokenBucket struct {
+		tokens float64
+		last   time.Time
+	}
+
+	// tokenLimiter limits the token rate of the keys.
+	tokenLimiter struct {
+		perMinute float64
+		lock      sync.Mutex
+		buckets   *lru.Cache
+	}
+)
+
+// estimateTokens estimates the number of tokens of a text, about four
+// characters per token for English texts.
+func estimateTokens(n int) int64 {
+	return int64((n + 3) / 4)
+}
+
+// parseUsage parses the usage of a non-streaming completion.
+func parseUsage(body []byte) *Usage {
+	c := &completion{}
+	if err := json.Unmarshal(body, c); err != nil || c.Usage == nil {
+		return nil
+	}
+	return c.Usage
+}
+
+// feed parses the complete lines in p, the events look like:
+//
+//	data: {"choices":[{"delta":{"content":"Hi"}}]}
+//
+//	data: [DONE]
+func (sc *sseCounter) feed(p []byte) {
+	sc.line = append(sc.line, p...)
+	for {
+		i := bytes.IndexByte(sc.line, '\n')
+		if i < 0 {
+			return
+		}
+		sc.parseLine(bytes.TrimSpace(sc.line[:i]))
+		sc.line = sc.line[i+1:]
+	}
+}
+
+func (sc *sseCounter) parseLine(line []byte) {
+	if !bytes.HasPrefix(line, []byte("data:")) {
+		return
+	}
+	data := bytes.TrimSpace(line[len("data:"):])
+	if bytes.Equal(data, []byte("[DONE]")) {
+		return
+	}
+
+	c := &completion{}
+	if json.Unmarshal(data, c) != nil {
+		return
+	}
+	if c.Usage != nil {
+		sc.usage = c.Usage
+	}
+	for _, choice := range c.Choices {
+		sc.completion += len(choice.Delta.Content) + len(choice.Text)
+	}
+}
+
+// result returns the usage reported by the provider, or an estimated one
+// if the provider doesn't report it.
+func (sc *sseCounter) result(promptChars int) *Usage {
+	if sc.line != nil {
+		sc.parseLine(bytes.TrimSpace(sc.line))
+		sc.line = nil
+	}
+	if sc.usage != nil {
+		return sc.usage
+	}
+
+	u := &Usage{
+		PromptTokens:     estimateTokens(promptChars),
+		CompletionTokens: estimateTokens(sc.completion),
+		Estimated:        true,
+	}
+	u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	return u
+}
+
+func newTokenLimiter(perMinute int64, maxKeys int) *tokenLimiter {
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+	buckets, _ := lru.New(maxKeys)
+	return &tokenLimiter{perMinute: float64(perMinute), buckets: buckets}
+}
+
+// refill returns the bucket of key with the tokens refilled, the caller
+// must hold the lock.
+func (tl *tokenLimiter) refill(key string, now time.Time) *tokenBucket {
+	v, ok := tl.buckets.Get(key)
+	if !ok {
+		b := &tokenBucket{tokens: tl.perMinute, last: now}
+		tl.buckets.Add(key, b)
+		return b
+	}
+
+	b := v.(*tokenBucket)
+	b.tokens += now.Sub(b.last).Minutes() * tl.perMinute
+	if b.tokens > tl.perMinute {
+		b.tokens = tl.perMinute
+	}
+	b.last = now
+	return b
+}
+
+// allow checks whether key has tokens left, it returns the duration to
+// wait if not.
+func (tl *tokenLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	tl.lock.Lock()
+	defer tl.lock.Unlock()
+
+	b := tl.refill(key, now)
+	if b.tokens > 0 {
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / tl.perMinute * float64(time.Minute))
+	return false, wait
+}
+
+// consume takes n tokens from the bucket of key.
+func (tl *tokenLimiter) consume(key string, n int64, now time.Time) {
+	tl.lock.Lock()
+	defer tl.lock.Unlock()
+
+	tl.refill(key, now).tokens -= float64(n)
+}
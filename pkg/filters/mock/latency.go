@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mock
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const (
+	distributionUniform     = "uniform"
+	distributionNormal      = "normal"
+	distributionExponential = "exponential"
+)
+
+// Latency describes the distribution of the latency of mocked responses.
+type Latency struct {
+	Distribution string `json:"distribution" jsonschema:"required,enum=uniform,enum=normal,enum=exponential"`
+	Min          string `json:"min" jsonschema:"omitempty,format=duration"`
+	Max          string `json:"max" jsonschema:"omitempty,format=duration"`
+	Mean         string `json:"mean" jsonschema:"omitempty,format=duration"`
+	StdDev       string `json:"stdDev" jsonschema:"omitempty,format=duration"`
+
+	min, max, mean, stdDev time.Duration
+}
+
+// Validate validates the Latency.
+func (l *Latency) Validate() error {
+	l.init()
+	min, max, mean := l.min, l.max, l.mean
+
+	switch l.Distribution {
+	case distributionUniform:
+		if l.Max == "" {
+			return fmt.Errorf("max is required for uniform distribution")
+		}
+	case distributionNormal, distributionExponential:
+		if l.Mean == "" {
+			return fmt.Errorf("mean is required for %s distribution", l.Distribution)
+		}
+		if mean < min || (l.Max != "" && mean > max) {
+			return fmt.Errorf("mean must be between min and max")
+		}
+	}
+
+	if l.Max != "" && max < min {
+		return fmt.Errorf("max must not be less than min")
+	}
+	return nil
+}
+
+func (l *Latency) init() {
+	parse := func(s string) time.Duration {
+		d, _ := time.ParseDuration(s)
+		return d
+	}
+	l.min, l.max, l.mean, l.stdDev = parse(l.Min), parse(l.Max), parse(l.Mean), parse(l.StdDev)
+}
+
+// sample returns a random latency following the distribution, the result
+// is always between min and max (if specified).
+func (l *Latency) sample() time.Duration {
+	min, max, mean, stdDev := l.min, l.max, l.mean, l.stdDev
+
+	var d time.Duration
+	switch l.Distribution {
+	case distributionUniform:
+		d = min + time.Duration(rand.Int63n(int64(max-min)+1))
+	case distributionNormal:
+		d = mean + time.Duration(rand.NormFloat64()*float64(stdDev))
+	case distributionExponential:
+		d = time.Duration(rand.ExpFloat64() * float64(mean))
+	}
+
+	if d < min {
+		d = min
+	}
+	if l.Max != "" && d > max {
+		d = max
+	}
+	return d
+}
@@ -18,9 +18,15 @@
 package mock
 
 import (
+	"bytes"
+	"fmt"
 	"strings"
+	"sync/atomic"
+	"text/template"
 	"time"
 
+	sprig "github.com/go-task/slim-sprig"
+
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/filters"
 	"github.com/megaease/easegress/pkg/logger"
@@ -54,25 +60,50 @@ func init() {
 type (
 	// Mock is filter Mock.
 	Mock struct {
-		spec *Spec
+		spec     *Spec
+		recorder *recorder
 	}
 
 	// Spec describes the Mock.
 	Spec struct {
 		filters.BaseSpec `json:",inline"`
 
-		Rules []*Rule `json:"rules"`
+		Rules     []*Rule        `json:"rules"`
+		Recording *RecordingSpec `json:"recording,omitempty" jsonschema:"omitempty"`
 	}
 
 	// Rule is the mock rule.
 	Rule struct {
 		Match   MatchRule         `json:"match" jsonschema:"required"`
+		Code    int               `json:"code" jsonschema:"omitempty,format=httpcode"`
+		Headers map[string]string `json:"headers" jsonschema:"omitempty"`
+		Body    string            `json:"body" jsonschema:"omitempty"`
+		Delay   string            `json:"delay" jsonschema:"omitempty,format=duration"`
+		Latency *Latency          `json:"latency,omitempty" jsonschema:"omitempty"`
+		// Template makes the body and the header values of the responses
+		// templates, which are executed with the request.
+		Template bool `json:"template" jsonschema:"omitempty"`
+		// Sequence is the responses of successive calls, the first call
+		// gets the first response, the second call gets the second one,
+		// and so on. After the sequence is exhausted, the last response
+		// is returned repeatedly, unless LoopSequence is true.
+		Sequence     []*Step `json:"sequence,omitempty" jsonschema:"omitempty"`
+		LoopSequence bool    `json:"loopSequence" jsonschema:"omitempty"`
+
+		steps []*Step
+		calls uint64
+	}
+
+	// Step is a response in the sequence of a rule.
+	Step struct {
 		Code    int               `json:"code" jsonschema:"required,format=httpcode"`
 		Headers map[string]string `json:"headers" jsonschema:"omitempty"`
 		Body    string            `json:"body" jsonschema:"omitempty"`
 		Delay   string            `json:"delay" jsonschema:"omitempty,format=duration"`
 
-		delay time.Duration
+		delay   time.Duration
+		body    *template.Template
+		headers map[string]*template.Template
 	}
 
 	// MatchRule is the rule to match a request
@@ -84,6 +115,73 @@ type (
 	}
 )
 
+// Validate validates the Rule.
+func (r *Rule) Validate() error {
+	if len(r.Sequence) == 0 && r.Code == 0 {
+		return fmt.Errorf("code or sequence must be specified")
+	}
+	if len(r.Sequence) > 0 && (r.Code != 0 || r.Body != "" || len(r.Headers) > 0 || r.Delay != "") {
+		return fmt.Errorf("code, headers, body and delay are not allowed when sequence is specified")
+	}
+	if r.Delay != "" && r.Latency != nil {
+		return fmt.Errorf("delay and latency are mutually exclusive")
+	}
+
+	if !r.Template {
+		return nil
+	}
+	for _, step := range r.allSteps() {
+		if err := step.parseTemplates(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allSteps returns the sequence of the rule, or a single step built from
+// the rule itself if there's no sequence.
+func (r *Rule) allSteps() []*Step {
+	if len(r.Sequence) > 0 {
+		return r.Sequence
+	}
+	return []*Step{{Code: r.Code, Headers: r.Headers, Body: r.Body, Delay: r.Delay}}
+}
+
+// step returns the step for the n-th (starting from 0) call of the rule.
+func (r *Rule) step(n uint64) *Step {
+	count := uint64(len(r.steps))
+	if n < count {
+		return r.steps[n]
+	}
+	if r.LoopSequence {
+		return r.steps[n%count]
+	}
+	return r.steps[count-1]
+}
+
+func (s *Step) parseTemplates() error {
+	newTemplate := func(text string) (*template.Template, error) {
+		return template.New("").Funcs(sprig.TxtFuncMap()).Parse(text)
+	}
+
+	body, err := newTemplate(s.Body)
+	if err != nil {
+		return fmt.Errorf("invalid body template: %v", err)
+	}
+
+	headers := map[string]*template.Template{}
+	for k, v := range s.Headers {
+		t, err := newTemplate(v)
+		if err != nil {
+			return fmt.Errorf("invalid template of header %s: %v", k, err)
+		}
+		headers[k] = t
+	}
+
+	s.body, s.headers = body, headers
+	return nil
+}
+
 // Name returns the name of the Mock filter instance.
 func (m *Mock) Name() string {
 	return m.spec.Name()
@@ -107,25 +205,52 @@ func (m *Mock) Init() {
 // Inherit inherits previous generation of Mock.
 func (m *Mock) Inherit(previousGeneration filters.Filter) {
 	m.Init()
+
+	// recordings are reloaded from the cluster, but they could only be
+	// inherited if there's no cluster.
+	prev := previousGeneration.(*Mock)
+	if m.recorder != nil && prev.recorder != nil && m.recorder.cluster == nil {
+		m.recorder.inherit(prev.recorder)
+	}
 }
 
 func (m *Mock) reload() {
 	for _, r := range m.spec.Rules {
-		if r.Delay == "" {
-			continue
+		if r.Latency != nil {
+			r.Latency.init()
+		}
+		r.steps = r.allSteps()
+		for _, step := range r.steps {
+			if step.Delay != "" {
+				step.delay, _ = time.ParseDuration(step.Delay)
+			}
+			if r.Template {
+				// templates have been validated, so no error here.
+				step.parseTemplates()
+			}
 		}
-		r.delay, _ = time.ParseDuration(r.Delay)
+	}
+
+	if m.spec.Recording != nil {
+		m.recorder = newRecorder(m.spec)
 	}
 }
 
 // Handle mocks Context.
 func (m *Mock) Handle(ctx *context.Context) string {
-	result := ""
+	if m.recorder != nil && m.recorder.replay(ctx) {
+		return resultMocked
+	}
+
 	if rule := m.match(ctx); rule != nil {
 		m.mock(ctx, rule)
-		result = resultMocked
+		return resultMocked
 	}
-	return result
+
+	if m.recorder != nil {
+		m.recorder.record(ctx)
+	}
+	return ""
 }
 
 func (m *Mock) match(ctx *context.Context) *Rule {
@@ -197,30 +322,60 @@ func (m *Mock) match(ctx *context.Context) *Rule {
 }
 
 func (m *Mock) mock(ctx *context.Context, rule *Rule) {
+	n := atomic.AddUint64(&rule.calls, 1) - 1
+	step := rule.step(n)
+
+	req := ctx.GetInputRequest().(*httpprot.Request)
 	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(step.Code)
 
-	resp.SetStatusCode(rule.Code)
-	for key, value := range rule.Headers {
-		resp.Std().Header.Set(key, value)
+	if rule.Template {
+		data := map[string]interface{}{
+			"request": req.ToBuilderRequest(""),
+			"call":    n + 1,
+		}
+		for key, t := range step.headers {
+			resp.Std().Header.Set(key, executeTemplate(t, data))
+		}
+		resp.SetPayload([]byte(executeTemplate(step.body, data)))
+	} else {
+		for key, value := range step.Headers {
+			resp.Std().Header.Set(key, value)
+		}
+		resp.SetPayload([]byte(step.Body))
 	}
-	resp.SetPayload([]byte(rule.Body))
 	ctx.SetOutputResponse(resp)
 
-	if rule.delay <= 0 {
+	delay := step.delay
+	if delay <= 0 && rule.Latency != nil {
+		delay = rule.Latency.sample()
+	}
+	if delay <= 0 {
 		return
 	}
 
-	req := ctx.GetInputRequest().(*httpprot.Request)
-	logger.Debugf("delay for %v ...", rule.delay)
+	logger.Debugf("delay for %v ...", delay)
 	select {
 	case <-req.Context().Done():
 		logger.Debugf("request cancelled in the middle of delay mocking")
-	case <-time.After(rule.delay):
+	case <-time.After(delay):
+	}
+}
+
+func executeTemplate(t *template.Template, data map[string]interface{}) string {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		logger.Warnf("failed to execute mock template: %v", err)
+		return ""
 	}
+	return buf.String()
 }
 
 // Status returns status.
 func (m *Mock) Status() interface{} {
+	if m.recorder != nil {
+		return m.recorder.status()
+	}
 	return nil
 }
 
@@ -21,8 +21,12 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/filters"
 	"github.com/megaease/easegress/pkg/logger"
@@ -213,3 +217,198 @@ rules:
 		assert.Equal(204, resp.StatusCode())
 	}
 }
+
+func newTestMock(t *testing.T, yamlConfig string) *Mock {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+	spec, err := filters.NewSpec(nil, "pipeline", rawSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	m := kind.CreateInstance(spec).(*Mock)
+	m.Init()
+	return m
+}
+
+func newTestContext(t *testing.T, method, url string) *context.Context {
+	ctx := context.New(nil)
+	req, err := http.NewRequest(method, url, nil)
+	assert.Nil(t, err)
+	setRequest(t, ctx, context.DefaultNamespace, req)
+	return ctx
+}
+
+func TestMockSequence(t *testing.T) {
+	assert := assert.New(t)
+
+	m := newTestMock(t, `
+kind: Mock
+name: mock
+rules:
+- match:
+    path: /jobs
+  sequence:
+  - code: 202
+  - code: 200
+    body: done
+- match:
+    path: /loop
+  loopSequence: true
+  sequence:
+  - code: 200
+  - code: 503
+`)
+	defer m.Close()
+
+	codes := func(path string, n int) []int {
+		var result []int
+		for i := 0; i < n; i++ {
+			ctx := newTestContext(t, http.MethodGet, "http://example.com"+path)
+			assert.Equal(resultMocked, m.Handle(ctx))
+			result = append(result, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+		}
+		return result
+	}
+
+	assert.Equal([]int{202, 200, 200}, codes("/jobs", 3))
+	assert.Equal([]int{200, 503, 200, 503}, codes("/loop", 4))
+
+	assert.Error((&Rule{}).Validate())
+	assert.Error((&Rule{Code: 200, Sequence: []*Step{{Code: 200}}}).Validate())
+	assert.Error((&Rule{Code: 200, Delay: "1ms", Latency: &Latency{}}).Validate())
+}
+
+func TestMockTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	m := newTestMock(t, `
+kind: Mock
+name: mock
+rules:
+- match:
+    pathPrefix: /users/
+  template: true
+  code: 200
+  headers:
+    X-Call: '{{.call}}'
+  body: '{"path": "{{.request.URL.Path}}", "name": "{{.request.URL.Query.Get "name" | upper}}"}'
+`)
+	defer m.Close()
+
+	ctx := newTestContext(t, http.MethodGet, "http://example.com/users/1?name=bob")
+	m.Handle(ctx)
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(`{"path": "/users/1", "name": "BOB"}`, string(resp.RawPayload()))
+	assert.Equal("1", resp.HTTPHeader().Get("X-Call"))
+
+	assert.Error((&Rule{Code: 200, Template: true, Body: "{{"}).Validate())
+}
+
+func TestLatency(t *testing.T) {
+	assert := assert.New(t)
+
+	l := &Latency{Distribution: distributionUniform, Min: "10ms", Max: "20ms"}
+	assert.NoError(l.Validate())
+	for i := 0; i < 100; i++ {
+		d := l.sample()
+		assert.True(d >= 10*time.Millisecond && d <= 20*time.Millisecond)
+	}
+
+	l = &Latency{Distribution: distributionNormal, Mean: "10ms", StdDev: "5ms", Max: "15ms"}
+	assert.NoError(l.Validate())
+	for i := 0; i < 100; i++ {
+		d := l.sample()
+		assert.True(d >= 0 && d <= 15*time.Millisecond)
+	}
+
+	l = &Latency{Distribution: distributionExponential, Mean: "10ms", Min: "1ms"}
+	assert.NoError(l.Validate())
+	for i := 0; i < 100; i++ {
+		assert.True(l.sample() >= time.Millisecond)
+	}
+
+	assert.Error((&Latency{Distribution: distributionUniform}).Validate())
+	assert.Error((&Latency{Distribution: distributionNormal}).Validate())
+	assert.Error((&Latency{Distribution: distributionUniform, Min: "2s", Max: "1s"}).Validate())
+}
+
+func TestRecording(t *testing.T) {
+	assert := assert.New(t)
+
+	kvs := map[string]string{}
+	mc := clustertest.NewMockedCluster()
+	mc.MockedLayout = func() *cluster.Layout {
+		return &cluster.Layout{}
+	}
+	mc.MockedPut = func(key, value string) error {
+		kvs[key] = value
+		return nil
+	}
+	mc.MockedGetPrefix = func(prefix string) (map[string]string, error) {
+		result := map[string]string{}
+		for k, v := range kvs {
+			if strings.HasPrefix(k, prefix) {
+				result[k] = v
+			}
+		}
+		return result, nil
+	}
+
+	m := newTestMock(t, `
+kind: Mock
+name: mock
+recording:
+  mode: record
+rules:
+- match:
+    path: /mocked
+  code: 200
+`)
+	defer m.Close()
+	m.recorder.cluster = mc
+
+	// the response set by the following filters, e.g. Proxy, is recorded.
+	ctx := newTestContext(t, http.MethodGet, "http://example.com/pets?id=1")
+	assert.Equal("", m.Handle(ctx))
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(201)
+	resp.HTTPHeader().Set("X-Pet", "dog")
+	resp.SetPayload([]byte("pets"))
+	ctx.SetOutputResponse(resp)
+	ctx.Finish()
+
+	// mocked requests are not recorded.
+	ctx = newTestContext(t, http.MethodGet, "http://example.com/mocked")
+	assert.Equal(resultMocked, m.Handle(ctx))
+	ctx.Finish()
+
+	assert.Equal(1, len(kvs))
+	assert.Equal(1, m.Status().(*RecordingStatus).Recordings)
+
+	// replay the recordings.
+	m2 := newTestMock(t, `
+kind: Mock
+name: mock
+recording:
+  mode: replay
+rules:
+- match:
+    path: /mocked
+  code: 200
+`)
+	defer m2.Close()
+	m2.recorder.cluster = mc
+	m2.recorder.load()
+
+	ctx = newTestContext(t, http.MethodGet, "http://example.com/pets?id=2")
+	assert.Equal(resultMocked, m2.Handle(ctx))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(201, resp.StatusCode())
+	assert.Equal("dog", resp.HTTPHeader().Get("X-Pet"))
+	assert.Equal("pets", string(resp.RawPayload()))
+
+	ctx = newTestContext(t, http.MethodGet, "http://example.com/cats")
+	assert.Equal("", m2.Handle(ctx))
+}
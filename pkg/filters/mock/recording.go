@@ -0,0 +1,210 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mock
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	recordingModeRecord = "record"
+	recordingModeReplay = "replay"
+)
+
+type (
+	// RecordingSpec describes how to record the responses of the backends
+	// and replay them later.
+	RecordingSpec struct {
+		Mode string `json:"mode" jsonschema:"required,enum=record,enum=replay"`
+		// MatchQuery includes the query string in the key of recordings,
+		// otherwise, requests are identified by method and path only.
+		MatchQuery bool `json:"matchQuery" jsonschema:"omitempty"`
+	}
+
+	// Recording is a recorded response.
+	Recording struct {
+		Code    int         `json:"code"`
+		Headers http.Header `json:"headers"`
+		Body    []byte      `json:"body"`
+	}
+
+	// RecordingStatus is the status of the recordings.
+	RecordingStatus struct {
+		Mode       string `json:"mode"`
+		Recordings int    `json:"recordings"`
+	}
+
+	recorder struct {
+		spec     *RecordingSpec
+		pipeline string
+		name     string
+		cluster  cluster.Cluster
+
+		lock       sync.RWMutex
+		recordings map[string]*Recording
+	}
+)
+
+func newRecorder(spec *Spec) *recorder {
+	r := &recorder{
+		spec:       spec.Recording,
+		pipeline:   spec.Pipeline(),
+		name:       spec.Name(),
+		recordings: map[string]*Recording{},
+	}
+
+	if super := spec.Super(); super != nil && super.Cluster() != nil {
+		r.cluster = super.Cluster()
+		r.load()
+	}
+
+	return r
+}
+
+// load loads the recordings from the cluster.
+func (r *recorder) load() {
+	prefix := r.cluster.Layout().MockRecordingPrefix(r.pipeline, r.name)
+	kvs, err := r.cluster.GetPrefix(prefix)
+	if err != nil {
+		logger.Errorf("failed to load mock recordings: %v", err)
+		return
+	}
+
+	for k, v := range kvs {
+		key, err := url.PathUnescape(strings.TrimPrefix(k, prefix))
+		if err != nil {
+			continue
+		}
+		rec := &Recording{}
+		if err = json.Unmarshal([]byte(v), rec); err != nil {
+			logger.Errorf("failed to unmarshal mock recording %s: %v", k, err)
+			continue
+		}
+		r.recordings[key] = rec
+	}
+}
+
+func (r *recorder) inherit(prev *recorder) {
+	prev.lock.RLock()
+	for k, v := range prev.recordings {
+		r.recordings[k] = v
+	}
+	prev.lock.RUnlock()
+}
+
+func (r *recorder) key(req *httpprot.Request) string {
+	key := req.Method() + " " + req.Path()
+	if r.spec.MatchQuery && req.URL().RawQuery != "" {
+		key += "?" + req.URL().RawQuery
+	}
+	return key
+}
+
+// replay mocks the response with the recording of the request, it
+// returns false if not in replay mode or there's no such a recording.
+func (r *recorder) replay(ctx *context.Context) bool {
+	if r.spec.Mode != recordingModeReplay {
+		return false
+	}
+
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	r.lock.RLock()
+	rec := r.recordings[r.key(req)]
+	r.lock.RUnlock()
+	if rec == nil {
+		return false
+	}
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(rec.Code)
+	for k, v := range rec.Headers {
+		resp.Std().Header[k] = append([]string(nil), v...)
+	}
+	resp.SetPayload(rec.Body)
+	ctx.SetOutputResponse(resp)
+	return true
+}
+
+// record records the response sent to the client when the request is
+// finished, a request is only recorded once.
+func (r *recorder) record(ctx *context.Context) {
+	if r.spec.Mode != recordingModeRecord {
+		return
+	}
+
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	key := r.key(req)
+	r.lock.RLock()
+	_, ok := r.recordings[key]
+	r.lock.RUnlock()
+	if ok {
+		return
+	}
+
+	ctx.OnFinish(func() {
+		resp, _ := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response)
+		if resp == nil || resp.IsStream() {
+			return
+		}
+		r.save(key, &Recording{
+			Code:    resp.StatusCode(),
+			Headers: resp.HTTPHeader().Clone(),
+			Body:    resp.RawPayload(),
+		})
+	})
+}
+
+func (r *recorder) save(key string, rec *Recording) {
+	r.lock.Lock()
+	if _, ok := r.recordings[key]; ok {
+		r.lock.Unlock()
+		return
+	}
+	r.recordings[key] = rec
+	r.lock.Unlock()
+
+	if r.cluster == nil {
+		return
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		logger.Errorf("failed to marshal mock recording: %v", err)
+		return
+	}
+
+	k := r.cluster.Layout().MockRecordingKey(r.pipeline, r.name, key)
+	if err = r.cluster.Put(k, string(data)); err != nil {
+		logger.Errorf("failed to save mock recording %s: %v", k, err)
+	}
+}
+
+func (r *recorder) status() *RecordingStatus {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return &RecordingStatus{Mode: r.spec.Mode, Recordings: len(r.recordings)}
+}
@@ -0,0 +1,370 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package opa implements the OPA filter, which authorizes requests by the
+// policies of the Open Policy Agent.
+package opa
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of OPA.
+	Kind = "OPA"
+
+	resultDenied = "denied"
+	resultFailed = "failed"
+
+	failureModeOpen   = "open"
+	failureModeClosed = "closed"
+
+	defaultTimeout   = time.Second
+	defaultCacheSize = 1024
+
+	// the max size of the request body in the input.
+	maxBodySize = 64 * 1024
+	// the max size of the response body of OPA.
+	maxDecisionSize = 1024 * 1024
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "OPA authorizes requests by the policies of the Open Policy Agent",
+	Results:     []string{resultDenied, resultFailed},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{FailureMode: failureModeClosed}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &OPA{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// OPA is the filter OPA.
+	OPA struct {
+		spec     *Spec
+		url      string
+		client   *http.Client
+		headers  []string
+		cache    *lru.Cache
+		cacheTTL time.Duration
+	}
+
+	// Spec describes the OPA.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// URL is the address of the OPA server, which usually runs as a
+		// sidecar, e.g. http://127.0.0.1:8181.
+		URL string `json:"url" jsonschema:"required,format=url"`
+		// Decision is the path of the decision document, e.g. httpapi/authz
+		// for the package httpapi.authz.
+		Decision string            `json:"decision" jsonschema:"required"`
+		Headers  map[string]string `json:"headers" jsonschema:"omitempty"`
+		Timeout  string            `json:"timeout" jsonschema:"omitempty,format=duration"`
+
+		// IncludedHeaders are the request headers in the input, all headers
+		// are included if it is empty.
+		IncludedHeaders []string `json:"includedHeaders" jsonschema:"omitempty"`
+		IncludeBody     bool     `json:"includeBody" jsonschema:"omitempty"`
+
+		// CacheTTL is how long the decisions are cached, the decisions are
+		// not cached if it is empty.
+		CacheTTL  string `json:"cacheTTL" jsonschema:"omitempty,format=duration"`
+		CacheSize int    `json:"cacheSize" jsonschema:"omitempty,minimum=1"`
+
+		// FailureMode is open or closed, requests are allowed in the open
+		// mode and rejected in the closed mode if OPA is unavailable.
+		FailureMode string `json:"failureMode" jsonschema:"omitempty,enum=,enum=open,enum=closed"`
+	}
+
+	// input is the input document of the decision.
+	input struct {
+		Method  string              `json:"method"`
+		Scheme  string              `json:"scheme"`
+		Host    string              `json:"host"`
+		Path    string              `json:"path"`
+		Query   map[string][]string `json:"query"`
+		Headers map[string]string   `json:"headers"`
+		RealIP  string              `json:"realIP"`
+		Body    string              `json:"body,omitempty"`
+	}
+
+	// decision is the decision of a request. The result of the decision
+	// document could be a boolean or an object with these fields.
+	decision struct {
+		Allow      bool              `json:"allow"`
+		StatusCode int               `json:"statusCode"`
+		Reason     string            `json:"reason"`
+		Headers    map[string]string `json:"headers"`
+	}
+
+	cacheEntry struct {
+		decision *decision
+		expireAt time.Time
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if strings.Trim(spec.Decision, "/") == "" {
+		return fmt.Errorf("decision is required")
+	}
+	return nil
+}
+
+// Name returns the name of the OPA filter instance.
+func (o *OPA) Name() string {
+	return o.spec.Name()
+}
+
+// Kind returns the kind of OPA.
+func (o *OPA) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the OPA.
+func (o *OPA) Spec() filters.Spec {
+	return o.spec
+}
+
+// Init initializes OPA.
+func (o *OPA) Init() {
+	o.reload()
+}
+
+// Inherit inherits previous generation of OPA.
+func (o *OPA) Inherit(previousGeneration filters.Filter) {
+	o.reload()
+}
+
+func (o *OPA) reload() {
+	spec := o.spec
+
+	o.url = strings.TrimSuffix(spec.URL, "/") + "/v1/data/" + strings.Trim(spec.Decision, "/")
+
+	timeout := defaultTimeout
+	if spec.Timeout != "" {
+		timeout, _ = time.ParseDuration(spec.Timeout)
+	}
+	o.client = &http.Client{Timeout: timeout}
+
+	for _, h := range spec.IncludedHeaders {
+		o.headers = append(o.headers, http.CanonicalHeaderKey(h))
+	}
+
+	if spec.CacheTTL != "" {
+		o.cacheTTL, _ = time.ParseDuration(spec.CacheTTL)
+	}
+	if o.cacheTTL > 0 {
+		size := spec.CacheSize
+		if size <= 0 {
+			size = defaultCacheSize
+		}
+		o.cache, _ = lru.New(size)
+	}
+}
+
+func (o *OPA) buildInput(req *httpprot.Request) ([]byte, error) {
+	in := &input{
+		Method:  req.Method(),
+		Scheme:  req.Scheme(),
+		Host:    req.Host(),
+		Path:    req.Path(),
+		Query:   req.URL().Query(),
+		Headers: map[string]string{},
+		RealIP:  req.RealIP(),
+	}
+
+	// header names are in lower case, so that policies don't need to
+	// care about the canonical form.
+	header := req.HTTPHeader()
+	if len(o.headers) == 0 {
+		for k, vs := range header {
+			in.Headers[strings.ToLower(k)] = strings.Join(vs, ",")
+		}
+	} else {
+		for _, k := range o.headers {
+			if vs := header.Values(k); len(vs) > 0 {
+				in.Headers[strings.ToLower(k)] = strings.Join(vs, ",")
+			}
+		}
+	}
+
+	if o.spec.IncludeBody && !req.IsStream() {
+		body := req.RawPayload()
+		if len(body) > maxBodySize {
+			return nil, fmt.Errorf("request body is larger than %dB", maxBodySize)
+		}
+		in.Body = string(body)
+	}
+
+	return codectool.MarshalJSON(map[string]interface{}{"input": in})
+}
+
+// query queries OPA for the decision of the input.
+func (o *OPA) query(in []byte) (*decision, error) {
+	req, err := http.NewRequest(http.MethodPost, o.url, bytes.NewReader(in))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range o.spec.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d from OPA", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDecisionSize))
+	if err != nil {
+		return nil, err
+	}
+	return parseDecision(body)
+}
+
+// parseDecision parses the response of the data API, an undefined
+// decision denies the request.
+func parseDecision(body []byte) (*decision, error) {
+	var resp struct {
+		Result interface{} `json:"result"`
+	}
+	if err := codectool.UnmarshalJSON(body, &resp); err != nil {
+		return nil, fmt.Errorf("invalid response from OPA: %v", err)
+	}
+
+	switch r := resp.Result.(type) {
+	case nil:
+		return &decision{Reason: "undefined decision"}, nil
+	case bool:
+		return &decision{Allow: r}, nil
+	case map[string]interface{}:
+		d := &decision{}
+		buff, _ := codectool.MarshalJSON(r)
+		if err := codectool.UnmarshalJSON(buff, d); err != nil {
+			return nil, fmt.Errorf("invalid decision: %v", err)
+		}
+		return d, nil
+	default:
+		return nil, fmt.Errorf("invalid decision type %T", r)
+	}
+}
+
+// decide returns the decision of the input, from the cache if possible.
+func (o *OPA) decide(in []byte) (*decision, error) {
+	if o.cache == nil {
+		return o.query(in)
+	}
+
+	key := sha256.Sum256(in)
+	now := fasttime.Now()
+	if v, ok := o.cache.Get(key); ok {
+		entry := v.(*cacheEntry)
+		if now.Before(entry.expireAt) {
+			return entry.decision, nil
+		}
+	}
+
+	d, err := o.query(in)
+	if err != nil {
+		return nil, err
+	}
+	o.cache.Add(key, &cacheEntry{decision: d, expireAt: now.Add(o.cacheTTL)})
+	return d, nil
+}
+
+// Handle authorizes the request by OPA.
+func (o *OPA) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	in, err := o.buildInput(req)
+	var d *decision
+	if err == nil {
+		d, err = o.decide(in)
+	}
+
+	if err != nil {
+		if o.spec.FailureMode == failureModeOpen {
+			logger.Warnf("OPA %s failed, request is allowed in open mode: %v", o.Name(), err)
+			ctx.AddTag(stringtool.Cat("opa: failed but allowed: ", err.Error()))
+			return ""
+		}
+		ctx.AddTag(stringtool.Cat("opa: ", err.Error()))
+		o.reject(ctx, http.StatusServiceUnavailable, "")
+		return resultFailed
+	}
+
+	if !d.Allow {
+		ctx.AddTag("opa: request denied")
+		code := d.StatusCode
+		if code < 400 || code >= 600 {
+			code = http.StatusForbidden
+		}
+		o.reject(ctx, code, d.Reason)
+		return resultDenied
+	}
+
+	// the headers are passed to the backend, e.g. the user identified
+	// by the policy.
+	for k, v := range d.Headers {
+		req.HTTPHeader().Set(k, v)
+	}
+	return ""
+}
+
+func (o *OPA) reject(ctx *context.Context, code int, reason string) {
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(code)
+	if reason != "" {
+		resp.SetPayload([]byte(reason))
+	}
+	ctx.SetOutputResponse(resp)
+}
+
+// Status returns status.
+func (o *OPA) Status() interface{} { return nil }
+
+// Close closes OPA.
+func (o *OPA) Close() {}
@@ -0,0 +1,274 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package opa
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+// newTestOPAServer returns an OPA server which allows requests of user
+// alice to GET, and returns a custom denial for bob.
+func newTestOPAServer(t *testing.T, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		if r.URL.Path != "/v1/data/httpapi/authz" || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer opa-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		doc := struct {
+			Input *input `json:"input"`
+		}{}
+		if err := codectool.UnmarshalJSON(body, &doc); err != nil {
+			t.Errorf("unmarshal input failed: %v", err)
+		}
+		in := doc.Input
+
+		switch {
+		case in.Headers["x-user"] == "alice" && in.Method == http.MethodGet:
+			w.Write([]byte(`{"result": {"allow": true, "headers": {"X-Role": "admin"}}}`))
+		case in.Headers["x-user"] == "bob":
+			w.Write([]byte(`{"result": {"allow": false, "statusCode": 401, "reason": "bob is not welcome"}}`))
+		case in.Headers["x-user"] == "carol":
+			w.Write([]byte(`{"result": true}`))
+		case in.Body == "let me in":
+			w.Write([]byte(`{"result": true}`))
+		case in.Headers["x-user"] == "undefined":
+			w.Write([]byte(`{}`))
+		default:
+			w.Write([]byte(`{"result": false}`))
+		}
+	}))
+}
+
+func newTestOPA(t *testing.T, yamlConfig string) *OPA {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "pipeline", rawSpec)
+	if err != nil {
+		t.Fatalf("failed to create spec: %v", err)
+	}
+	o := kind.CreateInstance(spec).(*OPA)
+	o.Init()
+	return o
+}
+
+func newContext(method, user, body string) *context.Context {
+	ctx := context.New(nil)
+	stdReq, _ := http.NewRequest(method, "http://127.0.0.1/orders?id=1", strings.NewReader(body))
+	if user != "" {
+		stdReq.Header.Set("X-User", user)
+	}
+	req, _ := httpprot.NewRequest(stdReq)
+	req.FetchPayload(0)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&Spec{Decision: "httpapi/authz"}).Validate())
+	assert.Error((&Spec{Decision: "/"}).Validate())
+}
+
+func TestOPA(t *testing.T) {
+	assert := assert.New(t)
+
+	var calls int32
+	srv := newTestOPAServer(t, &calls)
+	defer srv.Close()
+
+	o := newTestOPA(t, `
+kind: OPA
+name: opa
+url: `+srv.URL+`
+decision: /httpapi/authz
+headers:
+  Authorization: Bearer opa-token
+includeBody: true
+`)
+	defer o.Close()
+
+	ctx := newContext(http.MethodGet, "alice", "")
+	assert.Equal("", o.Handle(ctx))
+	assert.Equal("admin", ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Get("X-Role"))
+
+	ctx = newContext(http.MethodPost, "alice", "")
+	assert.Equal(resultDenied, o.Handle(ctx))
+	assert.Equal(http.StatusForbidden, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	ctx = newContext(http.MethodGet, "bob", "")
+	assert.Equal(resultDenied, o.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusUnauthorized, resp.StatusCode())
+	assert.Equal("bob is not welcome", string(resp.RawPayload()))
+
+	assert.Equal("", o.Handle(newContext(http.MethodGet, "carol", "")))
+	assert.Equal("", o.Handle(newContext(http.MethodPost, "", "let me in")))
+	assert.Equal(resultDenied, o.Handle(newContext(http.MethodGet, "undefined", "")))
+
+	// no cache by default.
+	atomic.StoreInt32(&calls, 0)
+	o.Handle(newContext(http.MethodGet, "alice", ""))
+	o.Handle(newContext(http.MethodGet, "alice", ""))
+	assert.Equal(int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestOPAIncludedHeaders(t *testing.T) {
+	assert := assert.New(t)
+
+	var calls int32
+	srv := newTestOPAServer(t, &calls)
+	defer srv.Close()
+
+	o := newTestOPA(t, `
+kind: OPA
+name: opa
+url: `+srv.URL+`
+decision: httpapi/authz
+headers:
+  Authorization: Bearer opa-token
+includedHeaders: [x-user]
+`)
+	defer o.Close()
+
+	req := newContext(http.MethodGet, "alice", "").GetInputRequest().(*httpprot.Request)
+	req.HTTPHeader().Set("X-Request-Id", "123")
+	buff, err := o.buildInput(req)
+	assert.NoError(err)
+	assert.Contains(string(buff), `"x-user":"alice"`)
+	assert.NotContains(string(buff), "x-request-id")
+}
+
+func TestOPACache(t *testing.T) {
+	assert := assert.New(t)
+
+	var calls int32
+	srv := newTestOPAServer(t, &calls)
+	defer srv.Close()
+
+	o := newTestOPA(t, `
+kind: OPA
+name: opa
+url: `+srv.URL+`
+decision: httpapi/authz
+headers:
+  Authorization: Bearer opa-token
+cacheTTL: 1m
+cacheSize: 10
+`)
+	defer o.Close()
+
+	for i := 0; i < 3; i++ {
+		assert.Equal("", o.Handle(newContext(http.MethodGet, "alice", "")))
+		assert.Equal(resultDenied, o.Handle(newContext(http.MethodGet, "bob", "")))
+	}
+	assert.Equal(int32(2), atomic.LoadInt32(&calls))
+
+	// the headers of the cached decision are still set.
+	ctx := newContext(http.MethodGet, "alice", "")
+	o.Handle(ctx)
+	assert.Equal("admin", ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Get("X-Role"))
+}
+
+func TestOPAFailureMode(t *testing.T) {
+	assert := assert.New(t)
+
+	var calls int32
+	srv := newTestOPAServer(t, &calls)
+	defer srv.Close()
+
+	// OPA rejects the request without the token.
+	yamlConfig := `
+kind: OPA
+name: opa
+url: ` + srv.URL + `
+decision: httpapi/authz
+cacheTTL: 1m
+`
+	o := newTestOPA(t, yamlConfig)
+	ctx := newContext(http.MethodGet, "alice", "")
+	assert.Equal(resultFailed, o.Handle(ctx))
+	assert.Equal(http.StatusServiceUnavailable, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	// failures are not cached.
+	assert.Equal(resultFailed, o.Handle(newContext(http.MethodGet, "alice", "")))
+	assert.Equal(int32(2), atomic.LoadInt32(&calls))
+
+	o = newTestOPA(t, yamlConfig+"failureMode: open\n")
+	ctx = newContext(http.MethodGet, "alice", "")
+	assert.Equal("", o.Handle(ctx))
+	assert.Nil(ctx.GetOutputResponse())
+
+	// OPA is unavailable.
+	srv.Close()
+	o = newTestOPA(t, yamlConfig)
+	assert.Equal(resultFailed, o.Handle(newContext(http.MethodGet, "alice", "")))
+}
+
+func TestParseDecision(t *testing.T) {
+	assert := assert.New(t)
+
+	d, err := parseDecision([]byte(`{"result": true}`))
+	assert.NoError(err)
+	assert.True(d.Allow)
+
+	d, err = parseDecision([]byte(`{"result": {"allow": false, "statusCode": 429}}`))
+	assert.NoError(err)
+	assert.False(d.Allow)
+	assert.Equal(429, d.StatusCode)
+
+	d, err = parseDecision([]byte(`{}`))
+	assert.NoError(err)
+	assert.False(d.Allow)
+
+	_, err = parseDecision([]byte(`{"result": "yes"}`))
+	assert.Error(err)
+
+	_, err = parseDecision([]byte(`{"result": {"allow": "yes"}}`))
+	assert.Error(err)
+
+	_, err = parseDecision([]byte(`not json`))
+	assert.Error(err)
+}
@@ -0,0 +1,567 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package outbox implements the Outbox filter.
+package outbox
+
+import (
+	"bytes"
+	stdcontext "context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// Kind is the kind of Outbox.
+	Kind = "Outbox"
+
+	resultInvalidRequest = "invalidRequest"
+	resultEnqueueFailed  = "enqueueFailed"
+
+	// StorageDisk stores the messages in files.
+	StorageDisk = "disk"
+	// StorageCluster stores the messages in the cluster, i.e. etcd.
+	StorageCluster = "cluster"
+
+	trackingHeader = "X-Tracking-ID"
+
+	defaultMaxBodySize         = 1024 * 1024
+	defaultMaxAttempts         = 5
+	defaultInitialBackoff      = time.Second
+	defaultMaxBackoff          = time.Minute
+	defaultTimeout             = 10 * time.Second
+	defaultWorkers             = 4
+	defaultRetention           = time.Hour
+	defaultDeadLetterRetention = 7 * 24 * time.Hour
+	pollInterval               = time.Second
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "Outbox queues requests durably and delivers them to the backend asynchronously.",
+	Results:     []string{resultInvalidRequest, resultEnqueueFailed},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			Storage:     StorageDisk,
+			MaxBodySize: defaultMaxBodySize,
+			Workers:     defaultWorkers,
+			Retry:       &RetrySpec{MaxAttempts: defaultMaxAttempts},
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &Outbox{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+// hopHeaders are not queued with the requests.
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade", "Content-Length",
+}
+
+type (
+	// Outbox is filter Outbox.
+	//
+	// The delivery counters and the pending gauge are the first five
+	// words of the struct, they are used with sync/atomic, which requires
+	// 64-bit alignment on 32-bit platforms.
+	Outbox struct {
+		enqueued  uint64
+		delivered uint64
+		retried   uint64
+		dead      uint64
+		pending   int64
+
+		spec        *Spec
+		queue       queue
+		cluster     cluster.Cluster
+		client      *http.Client
+		delay       time.Duration
+		backoff     time.Duration
+		maxBackoff  time.Duration
+		retention   time.Duration
+		deadLetters time.Duration
+
+		wakeup   chan struct{}
+		done     chan struct{}
+		stopOnce sync.Once
+		wg       sync.WaitGroup
+	}
+
+	// Spec describes the Outbox.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// URL is the backend, the path and query of the requests are
+		// appended to it.
+		URL         string `json:"url" jsonschema:"required,format=uri"`
+		Storage     string `json:"storage" jsonschema:"omitempty,enum=disk,enum=cluster"`
+		DiskPath    string `json:"diskPath" jsonschema:"omitempty"`
+		MaxBodySize int64  `json:"maxBodySize" jsonschema:"omitempty,minimum=1"`
+		// Delay delays the delivery of the requests, DelayHeader overrides
+		// it for a request.
+		Delay       string     `json:"delay" jsonschema:"omitempty,format=duration"`
+		DelayHeader string     `json:"delayHeader" jsonschema:"omitempty"`
+		Timeout     string     `json:"timeout" jsonschema:"omitempty,format=duration"`
+		Workers     int        `json:"workers" jsonschema:"omitempty,minimum=1"`
+		Retry       *RetrySpec `json:"retry,omitempty" jsonschema:"omitempty"`
+		// TrackingPath is the path prefix to query the state of the
+		// messages by their tracking IDs with GET requests.
+		TrackingPath        string `json:"trackingPath" jsonschema:"omitempty,pattern=^/"`
+		Retention           string `json:"retention" jsonschema:"omitempty,format=duration"`
+		DeadLetterRetention string `json:"deadLetterRetention" jsonschema:"omitempty,format=duration"`
+	}
+
+	// RetrySpec describes how the deliveries are retried.
+	RetrySpec struct {
+		MaxAttempts    int    `json:"maxAttempts" jsonschema:"omitempty,minimum=1"`
+		InitialBackoff string `json:"initialBackoff" jsonschema:"omitempty,format=duration"`
+		MaxBackoff     string `json:"maxBackoff" jsonschema:"omitempty,format=duration"`
+	}
+
+	// Status is the status of Outbox.
+	Status struct {
+		Pending   int64  `json:"pending"`
+		Enqueued  uint64 `json:"enqueued"`
+		Delivered uint64 `json:"delivered"`
+		Retried   uint64 `json:"retried"`
+		Dead      uint64 `json:"dead"`
+	}
+
+	// tracking is the state of a message reported to the clients.
+	tracking struct {
+		ID          string     `json:"id"`
+		State       string     `json:"state"`
+		Attempts    int        `json:"attempts"`
+		NextAttempt *time.Time `json:"nextAttempt,omitempty"`
+		LastStatus  int        `json:"lastStatus,omitempty"`
+		LastError   string     `json:"lastError,omitempty"`
+		CreatedAt   time.Time  `json:"createdAt"`
+		UpdatedAt   time.Time  `json:"updatedAt"`
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if spec.Storage != StorageCluster && spec.DiskPath == "" {
+		return fmt.Errorf("diskPath is required when storage is disk")
+	}
+	return nil
+}
+
+func parseDuration(s string, defaultValue time.Duration) time.Duration {
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d
+	}
+	return defaultValue
+}
+
+// Name returns the name of the Outbox filter instance.
+func (ob *Outbox) Name() string {
+	return ob.spec.Name()
+}
+
+// Kind returns the kind of Outbox.
+func (ob *Outbox) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the Outbox
+func (ob *Outbox) Spec() filters.Spec {
+	return ob.spec
+}
+
+// Init initializes Outbox.
+func (ob *Outbox) Init() {
+	ob.reload(nil)
+}
+
+// Inherit inherits previous generation of Outbox.
+func (ob *Outbox) Inherit(previousGeneration filters.Filter) {
+	prev := previousGeneration.(*Outbox)
+	// stop the delivery of the previous generation first, so that no
+	// message is delivered by both generations.
+	prev.stop()
+	ob.reload(prev)
+}
+
+func (ob *Outbox) reload(prev *Outbox) {
+	spec := ob.spec
+	if spec.Retry == nil {
+		spec.Retry = &RetrySpec{}
+	}
+	if spec.Retry.MaxAttempts == 0 {
+		spec.Retry.MaxAttempts = defaultMaxAttempts
+	}
+	if spec.Workers == 0 {
+		spec.Workers = defaultWorkers
+	}
+	if spec.MaxBodySize == 0 {
+		spec.MaxBodySize = defaultMaxBodySize
+	}
+	spec.URL = strings.TrimSuffix(spec.URL, "/")
+
+	ob.delay = parseDuration(spec.Delay, 0)
+	ob.backoff = parseDuration(spec.Retry.InitialBackoff, defaultInitialBackoff)
+	ob.maxBackoff = parseDuration(spec.Retry.MaxBackoff, defaultMaxBackoff)
+	ob.retention = parseDuration(spec.Retention, defaultRetention)
+	ob.deadLetters = parseDuration(spec.DeadLetterRetention, defaultDeadLetterRetention)
+	ob.client = &http.Client{Timeout: parseDuration(spec.Timeout, defaultTimeout)}
+
+	ob.wakeup = make(chan struct{}, 1)
+	ob.done = make(chan struct{})
+
+	if spec.Storage == StorageCluster {
+		if super := spec.Super(); super != nil && super.Cluster() != nil {
+			ob.cluster = super.Cluster()
+			ob.queue = &clusterQueue{cluster: ob.cluster, pipeline: spec.Pipeline(), name: ob.Name()}
+		} else {
+			logger.Errorf("%s: cluster is not available, requests could not be queued", ob.Name())
+		}
+	} else {
+		// the queue is kept if the directory is not changed.
+		if prev != nil && prev.spec.Storage == StorageDisk && prev.spec.DiskPath == spec.DiskPath {
+			ob.queue = prev.queue
+		} else if dq, err := newDiskQueue(spec.DiskPath); err != nil {
+			logger.Errorf("%s: failed to open disk queue: %v", ob.Name(), err)
+		} else {
+			ob.queue = dq
+		}
+	}
+
+	if ob.queue != nil {
+		ob.wg.Add(1)
+		go ob.runDelivery()
+	}
+}
+
+// Handle queues the request, or responds the state of a message if it is a
+// tracking request.
+func (ob *Outbox) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	if ob.spec.TrackingPath != "" && req.Method() == http.MethodGet &&
+		strings.HasPrefix(req.Path(), ob.spec.TrackingPath) {
+		ob.track(ctx, strings.TrimPrefix(req.Path(), ob.spec.TrackingPath))
+		return ""
+	}
+
+	if req.IsStream() || int64(len(req.RawPayload())) > ob.spec.MaxBodySize {
+		return ob.respond(ctx, http.StatusRequestEntityTooLarge, "request body too large", resultInvalidRequest)
+	}
+
+	delay := ob.delay
+	if ob.spec.DelayHeader != "" {
+		if v := req.HTTPHeader().Get(ob.spec.DelayHeader); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				return ob.respond(ctx, http.StatusBadRequest, "invalid delay "+v, resultInvalidRequest)
+			}
+			delay = d
+		}
+	}
+
+	if ob.queue == nil {
+		return ob.respond(ctx, http.StatusServiceUnavailable, "queue is not available", resultEnqueueFailed)
+	}
+
+	header := req.HTTPHeader().Clone()
+	for _, h := range hopHeaders {
+		header.Del(h)
+	}
+	if ob.spec.DelayHeader != "" {
+		header.Del(ob.spec.DelayHeader)
+	}
+
+	now := time.Now()
+	m := &message{
+		ID:          uuid.NewString(),
+		State:       stateQueued,
+		NextAttempt: now.Add(delay),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Request: &request{
+			Method: req.Method(),
+			Path:   req.Path(),
+			Query:  req.Std().URL.RawQuery,
+			Header: header,
+			Body:   req.RawPayload(),
+		},
+	}
+	if err := ob.queue.put(m); err != nil {
+		logger.Errorf("%s: failed to queue request: %v", ob.Name(), err)
+		return ob.respond(ctx, http.StatusServiceUnavailable, "failed to queue request", resultEnqueueFailed)
+	}
+	atomic.AddUint64(&ob.enqueued, 1)
+	atomic.AddInt64(&ob.pending, 1)
+
+	if delay == 0 {
+		select {
+		case ob.wakeup <- struct{}{}:
+		default:
+		}
+	}
+
+	resp := ob.respondJSON(ctx, http.StatusAccepted, &tracking{ID: m.ID, State: m.State, CreatedAt: m.CreatedAt, UpdatedAt: m.UpdatedAt})
+	resp.HTTPHeader().Set(trackingHeader, m.ID)
+	if ob.spec.TrackingPath != "" {
+		resp.HTTPHeader().Set("Location", ob.spec.TrackingPath+m.ID)
+	}
+	return ""
+}
+
+func (ob *Outbox) track(ctx *context.Context, id string) {
+	var m *message
+	var err error
+	if ob.queue != nil && id != "" {
+		m, err = ob.queue.get(id)
+	}
+	if err != nil {
+		ob.respond(ctx, http.StatusServiceUnavailable, err.Error(), "")
+		return
+	}
+	if m == nil {
+		ob.respond(ctx, http.StatusNotFound, "message not found", "")
+		return
+	}
+
+	t := &tracking{
+		ID:         m.ID,
+		State:      m.State,
+		Attempts:   m.Attempts,
+		LastStatus: m.LastStatus,
+		LastError:  m.LastError,
+		CreatedAt:  m.CreatedAt,
+		UpdatedAt:  m.UpdatedAt,
+	}
+	if m.State == stateQueued {
+		t.NextAttempt = &m.NextAttempt
+	}
+	ob.respondJSON(ctx, http.StatusOK, t)
+}
+
+func (ob *Outbox) respond(ctx *context.Context, code int, msg, result string) string {
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(code)
+	resp.SetPayload(msg)
+	ctx.SetOutputResponse(resp)
+	return result
+}
+
+func (ob *Outbox) respondJSON(ctx *context.Context, code int, v interface{}) *httpprot.Response {
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(code)
+	resp.HTTPHeader().Set("Content-Type", "application/json")
+	resp.SetPayload(codectool.MustMarshalJSON(v))
+	ctx.SetOutputResponse(resp)
+	return resp
+}
+
+func (ob *Outbox) runDelivery() {
+	defer ob.wg.Done()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ob.done:
+			return
+		case <-ticker.C:
+		case <-ob.wakeup:
+		}
+		ob.deliverDue(time.Now())
+	}
+}
+
+// deliverDue delivers the due messages, and deletes the delivered and dead
+// messages which are out of retention. Only the leader delivers messages
+// if they are stored in the cluster.
+func (ob *Outbox) deliverDue(now time.Time) {
+	if ob.cluster != nil && !ob.cluster.IsLeader() {
+		return
+	}
+
+	messages, err := ob.queue.list()
+	if err != nil {
+		logger.Errorf("%s: failed to list messages: %v", ob.Name(), err)
+		return
+	}
+
+	var due []*message
+	pending := int64(0)
+	for _, m := range messages {
+		switch m.State {
+		case stateQueued:
+			pending++
+			if !now.Before(m.NextAttempt) {
+				due = append(due, m)
+			}
+		case stateDelivered, stateDead:
+			retention := ob.retention
+			if m.State == stateDead {
+				retention = ob.deadLetters
+			}
+			if !now.Before(m.UpdatedAt.Add(retention)) {
+				if err = ob.queue.delete(m.ID); err != nil {
+					logger.Errorf("%s: failed to delete message %s: %v", ob.Name(), m.ID, err)
+				}
+			}
+		}
+	}
+	atomic.StoreInt64(&ob.pending, pending)
+
+	sem := make(chan struct{}, ob.spec.Workers)
+	wg := sync.WaitGroup{}
+	for _, m := range due {
+		select {
+		case <-ob.done:
+			wg.Wait()
+			return
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(m *message) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			ob.deliver(m)
+		}(m)
+	}
+	wg.Wait()
+}
+
+// deliver sends the message to the backend, and updates its state.
+func (ob *Outbox) deliver(m *message) {
+	r := m.Request
+	url := ob.spec.URL + r.Path
+	if r.Query != "" {
+		url += "?" + r.Query
+	}
+
+	m.Attempts++
+	retryable := true
+	stdReq, err := http.NewRequestWithContext(stdcontext.Background(), r.Method, url, bytes.NewReader(r.Body))
+	if err == nil {
+		for k, v := range r.Header {
+			stdReq.Header[k] = v
+		}
+		stdReq.Header.Set("X-Outbox-ID", m.ID)
+		stdReq.Header.Set("X-Outbox-Attempt", fmt.Sprint(m.Attempts))
+
+		var resp *http.Response
+		resp, err = ob.client.Do(stdReq)
+		if err == nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+
+			m.LastStatus = resp.StatusCode
+			switch {
+			case resp.StatusCode/100 == 2:
+			case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+				err = fmt.Errorf("backend responded %d", resp.StatusCode)
+			default:
+				// other client errors would never succeed.
+				err = fmt.Errorf("backend responded %d", resp.StatusCode)
+				retryable = false
+			}
+		}
+	} else {
+		retryable = false
+	}
+
+	now := time.Now()
+	m.UpdatedAt = now
+	switch {
+	case err == nil:
+		m.State = stateDelivered
+		m.LastError = ""
+		m.Request = nil
+		atomic.AddUint64(&ob.delivered, 1)
+	case !retryable || m.Attempts >= ob.spec.Retry.MaxAttempts:
+		m.State = stateDead
+		m.LastError = err.Error()
+		atomic.AddUint64(&ob.dead, 1)
+		logger.Warnf("%s: message %s is dead after %d attempts: %v", ob.Name(), m.ID, m.Attempts, err)
+	default:
+		m.LastError = err.Error()
+		m.NextAttempt = now.Add(ob.backoffOf(m.Attempts))
+		atomic.AddUint64(&ob.retried, 1)
+	}
+
+	if err = ob.queue.put(m); err != nil {
+		logger.Errorf("%s: failed to update message %s: %v", ob.Name(), m.ID, err)
+	}
+}
+
+// backoffOf returns the backoff after the attempts, which is doubled after
+// each attempt.
+func (ob *Outbox) backoffOf(attempts int) time.Duration {
+	d := ob.backoff
+	for i := 1; i < attempts && d < ob.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > ob.maxBackoff {
+		d = ob.maxBackoff
+	}
+	return d
+}
+
+// Status returns the status of Outbox.
+func (ob *Outbox) Status() interface{} {
+	return &Status{
+		Pending:   atomic.LoadInt64(&ob.pending),
+		Enqueued:  atomic.LoadUint64(&ob.enqueued),
+		Delivered: atomic.LoadUint64(&ob.delivered),
+		Retried:   atomic.LoadUint64(&ob.retried),
+		Dead:      atomic.LoadUint64(&ob.dead),
+	}
+}
+
+// stop stops the delivery and waits for the messages being delivered.
+func (ob *Outbox) stop() {
+	ob.stopOnce.Do(func() {
+		close(ob.done)
+		ob.wg.Wait()
+	})
+}
+
+// Close closes Outbox.
+func (ob *Outbox) Close() {
+	ob.stop()
+	ob.client.CloseIdleConnections()
+}
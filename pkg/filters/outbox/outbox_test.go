@@ -0,0 +1,302 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package outbox
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newOutbox(t *testing.T, yamlConfig string) *Outbox {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "pipeline", rawSpec)
+	if err != nil {
+		t.Fatalf("failed to create spec: %v", err)
+	}
+	ob := kind.CreateInstance(spec).(*Outbox)
+	ob.Init()
+	// the messages are delivered by the tests.
+	ob.stop()
+	return ob
+}
+
+func newContext(t *testing.T, method, path, body string) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(method, "http://megaease.com"+path, strings.NewReader(body))
+	stdr.Header.Set("X-Tenant", "a")
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	req.FetchPayload(0)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func enqueue(t *testing.T, ob *Outbox, path, body string) string {
+	ctx := newContext(t, http.MethodPost, path, body)
+	assert.Equal(t, "", ob.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode())
+	id := resp.HTTPHeader().Get(trackingHeader)
+	assert.NotEmpty(t, id)
+	return id
+}
+
+func track(t *testing.T, ob *Outbox, id string) (int, *tracking) {
+	ctx := newContext(t, http.MethodGet, "/outbox/"+id, "")
+	assert.Equal(t, "", ob.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp.StatusCode() != http.StatusOK {
+		return resp.StatusCode(), nil
+	}
+	tr := &tracking{}
+	codectool.MustUnmarshalJSON(resp.RawPayload(), tr)
+	return resp.StatusCode(), tr
+}
+
+func TestDelivery(t *testing.T) {
+	assert := assert.New(t)
+
+	var lock sync.Mutex
+	calls := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lock.Lock()
+		calls[r.URL.Path]++
+		n := calls[r.URL.Path]
+		lock.Unlock()
+
+		assert.Equal("a", r.Header.Get("X-Tenant"))
+		assert.NotEmpty(r.Header.Get("X-Outbox-ID"))
+		switch r.URL.Path {
+		case "/ok":
+			assert.Equal("id=1", r.URL.RawQuery)
+			assert.Equal("order", string(body))
+		case "/flaky":
+			if n == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		case "/bad":
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		case "/down":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	yamlConfig := `
+kind: Outbox
+name: outbox
+url: ` + server.URL + `
+diskPath: ` + dir + `
+trackingPath: /outbox/
+retry:
+  maxAttempts: 2
+  initialBackoff: 10s
+`
+	ob := newOutbox(t, yamlConfig)
+	defer ob.Close()
+
+	ok := enqueue(t, ob, "/ok?id=1", "order")
+	flaky := enqueue(t, ob, "/flaky", "")
+	bad := enqueue(t, ob, "/bad", "")
+	down := enqueue(t, ob, "/down", "")
+
+	code, tr := track(t, ob, ok)
+	assert.Equal(http.StatusOK, code)
+	assert.Equal(stateQueued, tr.State)
+	code, _ = track(t, ob, "unknown")
+	assert.Equal(http.StatusNotFound, code)
+
+	now := time.Now()
+	ob.deliverDue(now)
+	_, tr = track(t, ob, ok)
+	assert.Equal(stateDelivered, tr.State)
+	assert.Equal(1, tr.Attempts)
+	_, tr = track(t, ob, bad)
+	assert.Equal(stateDead, tr.State)
+	assert.Equal(http.StatusBadRequest, tr.LastStatus)
+	_, tr = track(t, ob, flaky)
+	assert.Equal(stateQueued, tr.State)
+	assert.Equal(http.StatusServiceUnavailable, tr.LastStatus)
+
+	// the retries are not due yet.
+	ob.deliverDue(now.Add(time.Second))
+	assert.Equal(1, calls["/flaky"])
+
+	// the messages survive restarts.
+	ob2 := newOutbox(t, yamlConfig)
+	defer ob2.Close()
+	ob2.deliverDue(now.Add(time.Minute))
+	_, tr = track(t, ob2, flaky)
+	assert.Equal(stateDelivered, tr.State)
+	assert.Equal(2, tr.Attempts)
+	_, tr = track(t, ob2, down)
+	assert.Equal(stateDead, tr.State)
+	assert.Equal(2, calls["/down"])
+
+	// delivered messages are deleted after the retention.
+	ob2.deliverDue(now.Add(2 * time.Hour))
+	code, _ = track(t, ob2, ok)
+	assert.Equal(http.StatusNotFound, code)
+	_, tr = track(t, ob2, bad)
+	assert.Equal(stateDead, tr.State)
+
+	status := ob2.Status().(*Status)
+	assert.Equal(int64(0), status.Pending)
+	assert.Equal(uint64(1), status.Delivered)
+	assert.Equal(uint64(1), status.Dead)
+}
+
+func TestInvalidRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	ob := newOutbox(t, `
+kind: Outbox
+name: outbox
+url: http://127.0.0.1:9095
+diskPath: `+t.TempDir()+`
+maxBodySize: 4
+delayHeader: X-Delay
+`)
+	defer ob.Close()
+
+	ctx := newContext(t, http.MethodPost, "/orders", "too large")
+	assert.Equal(resultInvalidRequest, ob.Handle(ctx))
+	assert.Equal(http.StatusRequestEntityTooLarge, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	ctx = newContext(t, http.MethodPost, "/orders", "")
+	ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Set("X-Delay", "soon")
+	assert.Equal(resultInvalidRequest, ob.Handle(ctx))
+
+	ctx = newContext(t, http.MethodPost, "/orders", "")
+	ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Set("X-Delay", "1m")
+	assert.Equal("", ob.Handle(ctx))
+	id := ctx.GetOutputResponse().(*httpprot.Response).HTTPHeader().Get(trackingHeader)
+	m, _ := ob.queue.get(id)
+	assert.True(m.NextAttempt.After(time.Now().Add(50 * time.Second)))
+	assert.Empty(m.Request.Header.Get("X-Delay"))
+
+	assert.Error((&Spec{URL: "http://127.0.0.1"}).Validate())
+	assert.NoError((&Spec{URL: "http://127.0.0.1", Storage: StorageCluster}).Validate())
+}
+
+func TestClusterQueue(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var lock sync.Mutex
+	kvs := map[string]string{}
+	leader := false
+
+	mc := clustertest.NewMockedCluster()
+	mc.MockedLayout = func() *cluster.Layout {
+		return &cluster.Layout{}
+	}
+	mc.MockedIsLeader = func() bool {
+		return leader
+	}
+	mc.MockedPut = func(key, value string) error {
+		lock.Lock()
+		defer lock.Unlock()
+		kvs[key] = value
+		return nil
+	}
+	mc.MockedGet = func(key string) (*string, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if v, ok := kvs[key]; ok {
+			return &v, nil
+		}
+		return nil, nil
+	}
+	mc.MockedDelete = func(key string) error {
+		lock.Lock()
+		defer lock.Unlock()
+		delete(kvs, key)
+		return nil
+	}
+	mc.MockedGetPrefix = func(prefix string) (map[string]string, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		result := map[string]string{}
+		for k, v := range kvs {
+			if strings.HasPrefix(k, prefix) {
+				result[k] = v
+			}
+		}
+		return result, nil
+	}
+
+	ob := newOutbox(t, `
+kind: Outbox
+name: outbox
+url: `+server.URL+`
+storage: cluster
+trackingPath: /outbox/
+`)
+	defer ob.Close()
+	// the cluster is not available in the test, so the queue is set here.
+	assert.Nil(ob.queue)
+	ob.cluster = mc
+	ob.queue = &clusterQueue{cluster: mc, pipeline: "pipeline", name: "outbox"}
+
+	id := enqueue(t, ob, "/orders", "order")
+	assert.Len(kvs, 1)
+	for k := range kvs {
+		assert.True(strings.HasPrefix(k, (&cluster.Layout{}).OutboxPrefix("pipeline", "outbox")))
+	}
+
+	// only the leader delivers the messages.
+	ob.deliverDue(time.Now())
+	_, tr := track(t, ob, id)
+	assert.Equal(stateQueued, tr.State)
+
+	leader = true
+	ob.deliverDue(time.Now())
+	_, tr = track(t, ob, id)
+	assert.Equal(stateDelivered, tr.State)
+}
@@ -0,0 +1,237 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package outbox
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	stateQueued    = "queued"
+	stateDelivered = "delivered"
+	stateDead      = "dead"
+
+	messageFileExt = ".msg"
+)
+
+type (
+	// message is a request queued for delivery.
+	message struct {
+		ID          string    `json:"id"`
+		State       string    `json:"state"`
+		Attempts    int       `json:"attempts"`
+		NextAttempt time.Time `json:"nextAttempt"`
+		LastStatus  int       `json:"lastStatus,omitempty"`
+		LastError   string    `json:"lastError,omitempty"`
+		CreatedAt   time.Time `json:"createdAt"`
+		UpdatedAt   time.Time `json:"updatedAt"`
+		// Request is dropped once the message is delivered.
+		Request *request `json:"request,omitempty"`
+	}
+
+	request struct {
+		Method string      `json:"method"`
+		Path   string      `json:"path"`
+		Query  string      `json:"query"`
+		Header http.Header `json:"header"`
+		Body   []byte      `json:"body"`
+	}
+
+	// queue is the durable storage of the messages.
+	queue interface {
+		put(m *message) error
+		get(id string) (*message, error)
+		delete(id string) error
+		// list returns all messages in the order of creation.
+		list() ([]*message, error)
+	}
+
+	// diskQueue stores each message in a file, all messages are also kept
+	// in memory, as the delivered ones are small and the queued ones are
+	// expected to be delivered soon.
+	diskQueue struct {
+		dir      string
+		mutex    sync.Mutex
+		messages map[string]*message
+	}
+
+	// clusterQueue stores the messages in the cluster, i.e. etcd.
+	clusterQueue struct {
+		cluster  cluster.Cluster
+		pipeline string
+		name     string
+	}
+)
+
+func sortMessages(messages []*message) {
+	sort.Slice(messages, func(i, j int) bool {
+		if messages[i].CreatedAt.Equal(messages[j].CreatedAt) {
+			return messages[i].ID < messages[j].ID
+		}
+		return messages[i].CreatedAt.Before(messages[j].CreatedAt)
+	})
+}
+
+// newDiskQueue creates a disk queue, the messages persisted by previous
+// runs are loaded.
+func newDiskQueue(dir string) (*diskQueue, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+
+	dq := &diskQueue{dir: dir, messages: map[string]*message{}}
+	files, err := filepath.Glob(filepath.Join(dir, "*"+messageFileExt))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			logger.Warnf("failed to read outbox file %s: %v", file, err)
+			continue
+		}
+		m := &message{}
+		if err = codectool.UnmarshalJSON(data, m); err != nil {
+			logger.Warnf("failed to decode outbox file %s: %v", file, err)
+			continue
+		}
+		dq.messages[m.ID] = m
+	}
+	return dq, nil
+}
+
+func (dq *diskQueue) fileName(id string) string {
+	return filepath.Join(dq.dir, id+messageFileExt)
+}
+
+func (dq *diskQueue) put(m *message) error {
+	data, err := codectool.MarshalJSON(m)
+	if err != nil {
+		return err
+	}
+
+	dq.mutex.Lock()
+	defer dq.mutex.Unlock()
+
+	// write to a temporary file and then rename it, so that a crash never
+	// leaves a partial file.
+	file := dq.fileName(m.ID)
+	tmp := file + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o640); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	copied := *m
+	dq.messages[m.ID] = &copied
+	return nil
+}
+
+func (dq *diskQueue) get(id string) (*message, error) {
+	dq.mutex.Lock()
+	defer dq.mutex.Unlock()
+
+	if m := dq.messages[id]; m != nil {
+		copied := *m
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (dq *diskQueue) delete(id string) error {
+	dq.mutex.Lock()
+	defer dq.mutex.Unlock()
+
+	delete(dq.messages, id)
+	if err := os.Remove(dq.fileName(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (dq *diskQueue) list() ([]*message, error) {
+	dq.mutex.Lock()
+	messages := make([]*message, 0, len(dq.messages))
+	for _, m := range dq.messages {
+		copied := *m
+		messages = append(messages, &copied)
+	}
+	dq.mutex.Unlock()
+
+	sortMessages(messages)
+	return messages, nil
+}
+
+func (cq *clusterQueue) key(id string) string {
+	return cq.cluster.Layout().OutboxKey(cq.pipeline, cq.name, id)
+}
+
+func (cq *clusterQueue) put(m *message) error {
+	data, err := codectool.MarshalJSON(m)
+	if err != nil {
+		return err
+	}
+	return cq.cluster.Put(cq.key(m.ID), string(data))
+}
+
+func (cq *clusterQueue) get(id string) (*message, error) {
+	v, err := cq.cluster.Get(cq.key(id))
+	if err != nil || v == nil {
+		return nil, err
+	}
+	m := &message{}
+	if err = codectool.UnmarshalJSON([]byte(*v), m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (cq *clusterQueue) delete(id string) error {
+	return cq.cluster.Delete(cq.key(id))
+}
+
+func (cq *clusterQueue) list() ([]*message, error) {
+	kvs, err := cq.cluster.GetPrefix(cq.cluster.Layout().OutboxPrefix(cq.pipeline, cq.name))
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*message, 0, len(kvs))
+	for k, v := range kvs {
+		m := &message{}
+		if err = codectool.UnmarshalJSON([]byte(v), m); err != nil {
+			logger.Warnf("failed to decode outbox message %s: %v", k, err)
+			continue
+		}
+		messages = append(messages, m)
+	}
+	sortMessages(messages)
+	return messages, nil
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filters
+
+import (
+	"fmt"
+	"plugin"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+// LoadPlugins loads the Go plugins of filters, a plugin registers its
+// filter kinds by calling Register in the init function, just like the
+// builtin filters. Plugins must be built with the same Go version and the
+// same versions of the packages as Easegress:
+//
+//	go build -buildmode=plugin -o myfilter.so ./myfilter
+func LoadPlugins(paths []string) error {
+	for _, path := range paths {
+		n := len(kinds)
+		if _, err := plugin.Open(path); err != nil {
+			return fmt.Errorf("load plugin %s failed: %v", path, err)
+		}
+		if len(kinds) == n {
+			logger.Warnf("plugin %s registers no filter kind", path)
+			continue
+		}
+		logger.Infof("plugin %s is loaded, %d filter kinds are registered", path, len(kinds)-n)
+	}
+	return nil
+}
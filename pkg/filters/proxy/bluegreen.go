@@ -0,0 +1,338 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// ColorBlue is the blue color of a blue/green route.
+	ColorBlue = "blue"
+	// ColorGreen is the green color of a blue/green route.
+	ColorGreen = "green"
+)
+
+const (
+	colorNone int32 = iota
+	colorBlue
+	colorGreen
+)
+
+type (
+	// BlueGreenSpec describes a blue/green route. The blue and green pools
+	// take the place of the main pool, and the active color is switched
+	// atomically across the cluster by the admin API.
+	BlueGreenSpec struct {
+		// Route is the cluster wide name of the route, all proxies with the
+		// same route are switched together.
+		Route string          `json:"route" jsonschema:"required"`
+		Blue  *ServerPoolSpec `json:"blue" jsonschema:"required"`
+		Green *ServerPoolSpec `json:"green" jsonschema:"required"`
+		// Active is the color before the first switch of the route.
+		Active string `json:"active" jsonschema:"omitempty,enum=,enum=blue,enum=green"`
+		// PreviewHosts are the hosts of the requests that are sent to the
+		// idle color, so the new version could be verified before a switch.
+		PreviewHosts []string `json:"previewHosts,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+	}
+
+	// BlueGreenState is the committed state of a blue/green route.
+	BlueGreenState struct {
+		Color     string    `json:"color"`
+		Version   int64     `json:"version"`
+		TxID      string    `json:"txID"`
+		UpdatedAt time.Time `json:"updatedAt"`
+	}
+
+	// BlueGreenPrepare is the first phase of a switch, every participant
+	// of the route acknowledges whether it is ready to switch.
+	BlueGreenPrepare struct {
+		TxID  string `json:"txID"`
+		Color string `json:"color"`
+		// Deadline is when the switch gives up waiting for the
+		// acknowledgements, a prepare after its deadline is abandoned.
+		Deadline time.Time `json:"deadline"`
+	}
+
+	// BlueGreenAck is the acknowledgement of a participant to a prepare.
+	BlueGreenAck struct {
+		TxID        string `json:"txID"`
+		Participant string `json:"participant"`
+		Error       string `json:"error,omitempty"`
+	}
+
+	// BlueGreenParticipant is a proxy serving a blue/green route.
+	BlueGreenParticipant struct {
+		Pipeline string `json:"pipeline"`
+		Filter   string `json:"filter"`
+	}
+
+	// BlueGreenStatus is the status of the blue/green route of a proxy.
+	BlueGreenStatus struct {
+		Route  string            `json:"route"`
+		Active string            `json:"active"`
+		Blue   *ServerPoolStatus `json:"blue"`
+		Green  *ServerPoolStatus `json:"green"`
+	}
+
+	blueGreen struct {
+		proxy *Proxy
+		spec  *BlueGreenSpec
+		blue  *ServerPool
+		green *ServerPool
+
+		// active is the committed color, it is colorNone if the route has
+		// never been switched, and the color in spec is used.
+		active       int32
+		previewHosts map[string]struct{}
+
+		cluster     cluster.Cluster
+		participant string
+		done        chan struct{}
+	}
+)
+
+// Validate validates BlueGreenSpec.
+func (s *BlueGreenSpec) Validate() error {
+	if s.Blue.Filter != nil || s.Green.Filter != nil {
+		return fmt.Errorf("filter must be empty in blue and green pools")
+	}
+	if err := s.Blue.Validate(); err != nil {
+		return fmt.Errorf("blue: %v", err)
+	}
+	if err := s.Green.Validate(); err != nil {
+		return fmt.Errorf("green: %v", err)
+	}
+	return nil
+}
+
+func colorToInt(color string) int32 {
+	switch color {
+	case ColorBlue:
+		return colorBlue
+	case ColorGreen:
+		return colorGreen
+	}
+	return colorNone
+}
+
+func newBlueGreen(p *Proxy, spec *BlueGreenSpec) *blueGreen {
+	bg := &blueGreen{
+		proxy:        p,
+		spec:         spec,
+		blue:         NewServerPool(p, spec.Blue, fmt.Sprintf("proxy#%s#blue", p.Name())),
+		green:        NewServerPool(p, spec.Green, fmt.Sprintf("proxy#%s#green", p.Name())),
+		previewHosts: map[string]struct{}{},
+		done:         make(chan struct{}),
+	}
+
+	for _, host := range spec.PreviewHosts {
+		bg.previewHosts[strings.ToLower(host)] = struct{}{}
+	}
+
+	if super := p.super; super != nil && super.Cluster() != nil {
+		bg.cluster = super.Cluster()
+		go bg.run()
+	}
+
+	return bg
+}
+
+func (bg *blueGreen) activeColor() string {
+	switch atomic.LoadInt32(&bg.active) {
+	case colorBlue:
+		return ColorBlue
+	case colorGreen:
+		return ColorGreen
+	}
+	if bg.spec.Active == ColorGreen {
+		return ColorGreen
+	}
+	return ColorBlue
+}
+
+func (bg *blueGreen) pool(color string) *ServerPool {
+	if color == ColorGreen {
+		return bg.green
+	}
+	return bg.blue
+}
+
+// choosePool returns the pool of the active color, or the pool of the idle
+// color if the request is sent to a preview host.
+func (bg *blueGreen) choosePool(req *httpprot.Request) *ServerPool {
+	active := bg.activeColor()
+	if len(bg.previewHosts) > 0 {
+		host := req.Host()
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if _, ok := bg.previewHosts[strings.ToLower(host)]; ok {
+			if active == ColorBlue {
+				return bg.green
+			}
+			return bg.blue
+		}
+	}
+	return bg.pool(active)
+}
+
+// ready reports whether the pool of the color could receive traffic.
+func (bg *blueGreen) ready(color string) error {
+	if colorToInt(color) == colorNone {
+		return fmt.Errorf("unknown color %s", color)
+	}
+	lb, ok := bg.pool(color).LoadBalancer().(interface{ serverCount() int })
+	if ok && lb.serverCount() == 0 {
+		return fmt.Errorf("no servers in %s pool", color)
+	}
+	return nil
+}
+
+func (bg *blueGreen) run() {
+	var (
+		syncer    cluster.Syncer
+		err       error
+		activeCh  <-chan *string
+		prepareCh <-chan *string
+	)
+
+	layout := bg.cluster.Layout()
+	route := bg.spec.Route
+	// every generation of the filter is a different participant, as the
+	// previous generation unregisters itself after the new one started.
+	bg.participant = layout.BlueGreenParticipantID(bg.proxy.spec.Pipeline(), bg.proxy.Name(), uuid.NewString())
+
+	for {
+		syncer, err = bg.cluster.Syncer(time.Minute)
+		if err != nil {
+			logger.Errorf("failed to create syncer: %v", err)
+		} else if activeCh, err = syncer.Sync(layout.BlueGreenActiveKey(route)); err != nil {
+			logger.Errorf("failed to sync blue/green route %s: %v", route, err)
+			syncer.Close()
+		} else if prepareCh, err = syncer.Sync(layout.BlueGreenPrepareKey(route)); err != nil {
+			logger.Errorf("failed to sync blue/green route %s: %v", route, err)
+			syncer.Close()
+		} else {
+			break
+		}
+
+		select {
+		case <-time.After(10 * time.Second):
+		case <-bg.done:
+			return
+		}
+	}
+
+	defer syncer.Close()
+
+	// the participant is put under the lease of the member, so it is
+	// removed when the member is gone, and the switch doesn't wait for it.
+	data, _ := codectool.MarshalJSON(&BlueGreenParticipant{
+		Pipeline: bg.proxy.spec.Pipeline(),
+		Filter:   bg.proxy.Name(),
+	})
+	participantKey := layout.BlueGreenParticipantPrefix(route) + bg.participant
+	if err = bg.cluster.PutUnderLease(participantKey, string(data)); err != nil {
+		logger.Errorf("%s: failed to register to blue/green route %s: %v", bg.proxy.Name(), route, err)
+	}
+	defer func() {
+		if err := bg.cluster.Delete(participantKey); err != nil {
+			logger.Errorf("%s: failed to unregister from blue/green route %s: %v", bg.proxy.Name(), route, err)
+		}
+	}()
+
+	for {
+		select {
+		case <-bg.done:
+			return
+		case value := <-activeCh:
+			bg.onActive(value)
+		case value := <-prepareCh:
+			bg.onPrepare(value)
+		}
+	}
+}
+
+func (bg *blueGreen) onActive(value *string) {
+	if value == nil {
+		atomic.StoreInt32(&bg.active, colorNone)
+		return
+	}
+
+	state := &BlueGreenState{}
+	if err := codectool.UnmarshalJSON([]byte(*value), state); err != nil {
+		logger.Errorf("%s: failed to decode blue/green state: %v", bg.proxy.Name(), err)
+		return
+	}
+
+	old := atomic.SwapInt32(&bg.active, colorToInt(state.Color))
+	if old != colorToInt(state.Color) {
+		logger.Infof("%s: blue/green route %s switched to %s (version %d)",
+			bg.proxy.Name(), bg.spec.Route, state.Color, state.Version)
+	}
+}
+
+func (bg *blueGreen) onPrepare(value *string) {
+	if value == nil {
+		return
+	}
+
+	prepare := &BlueGreenPrepare{}
+	if err := codectool.UnmarshalJSON([]byte(*value), prepare); err != nil {
+		logger.Errorf("%s: failed to decode blue/green prepare: %v", bg.proxy.Name(), err)
+		return
+	}
+
+	ack := &BlueGreenAck{TxID: prepare.TxID, Participant: bg.participant}
+	if err := bg.ready(prepare.Color); err != nil {
+		ack.Error = err.Error()
+	}
+
+	data, _ := codectool.MarshalJSON(ack)
+	key := bg.cluster.Layout().BlueGreenAckPrefix(bg.spec.Route) + bg.participant
+	if err := bg.cluster.PutUnderLease(key, string(data)); err != nil {
+		logger.Errorf("%s: failed to acknowledge blue/green prepare %s: %v", bg.proxy.Name(), prepare.TxID, err)
+	}
+}
+
+func (bg *blueGreen) status() *BlueGreenStatus {
+	return &BlueGreenStatus{
+		Route:  bg.spec.Route,
+		Active: bg.activeColor(),
+		Blue:   bg.blue.status(),
+		Green:  bg.green.status(),
+	}
+}
+
+func (bg *blueGreen) close() {
+	close(bg.done)
+	bg.blue.close()
+	bg.green.close()
+}
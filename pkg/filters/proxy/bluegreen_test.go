@@ -0,0 +1,176 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+const blueGreenConfig = `
+name: proxy
+kind: Proxy
+blueGreen:
+  route: web
+  previewHosts: ["preview.example.com"]
+  blue:
+    servers:
+    - url: http://127.0.0.1:9095
+  green:
+    servers:
+    - url: http://127.0.0.2:9095
+pools:
+- filter:
+    headers:
+      "X-Test":
+        exact: candidate
+  servers:
+  - url: http://127.0.0.3:9095
+`
+
+func TestBlueGreenSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, yamlConfig := range []string{`
+name: proxy
+kind: Proxy
+blueGreen:
+  route: web
+  blue:
+    servers:
+    - url: http://127.0.0.1:9095
+  green:
+    servers:
+    - url: http://127.0.0.2:9095
+pools:
+- servers:
+  - url: http://127.0.0.3:9095
+`, `
+name: proxy
+kind: Proxy
+blueGreen:
+  route: web
+  blue:
+    servers:
+    - url: http://127.0.0.1:9095
+  green:
+    filter:
+      headers:
+        "X-Test":
+          exact: green
+    servers:
+    - url: http://127.0.0.2:9095
+`, `
+name: proxy
+kind: Proxy
+blueGreen:
+  route: web
+  blue:
+    servers:
+    - url: http://127.0.0.1:9095
+  green:
+    serviceName: ""
+`} {
+		rawSpec := make(map[string]interface{})
+		assert.NoError(codectool.Unmarshal([]byte(yamlConfig), &rawSpec))
+		_, err := filters.NewSpec(nil, "", rawSpec)
+		assert.Error(err)
+	}
+}
+
+func TestBlueGreenChoosePool(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newTestProxy(blueGreenConfig, assert)
+	defer p.Close()
+	bg := p.blueGreen
+
+	newRequest := func(host string) *httpprot.Request {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://"+host+"/", nil)
+		req, _ := httpprot.NewRequest(stdr)
+		return req
+	}
+
+	assert.Equal(ColorBlue, bg.activeColor())
+	assert.Equal(bg.blue, bg.choosePool(newRequest("www.example.com")))
+	assert.Equal(bg.green, bg.choosePool(newRequest("preview.example.com")))
+	assert.Equal(bg.green, bg.choosePool(newRequest("PREVIEW.example.com:8080")))
+
+	state := string(codectool.MustMarshalJSON(&BlueGreenState{Color: ColorGreen, Version: 1}))
+	bg.onActive(&state)
+	assert.Equal(ColorGreen, bg.activeColor())
+	assert.Equal(bg.green, bg.choosePool(newRequest("www.example.com")))
+	assert.Equal(bg.blue, bg.choosePool(newRequest("preview.example.com")))
+
+	bg.onActive(nil)
+	assert.Equal(ColorBlue, bg.activeColor())
+
+	status := p.Status().(*Status)
+	assert.Nil(status.MainPool)
+	assert.Equal("web", status.BlueGreen.Route)
+	assert.Equal(ColorBlue, status.BlueGreen.Active)
+}
+
+func TestBlueGreenPrepare(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newTestProxy(blueGreenConfig, assert)
+	defer p.Close()
+	bg := p.blueGreen
+
+	kvs := map[string]string{}
+	mc := clustertest.NewMockedCluster()
+	mc.MockedLayout = func() *cluster.Layout {
+		return &cluster.Layout{}
+	}
+	mc.MockedPutUnderLease = func(key, value string) error {
+		kvs[key] = value
+		return nil
+	}
+	bg.cluster = mc
+	bg.participant = "participant"
+	key := mc.Layout().BlueGreenAckPrefix("web") + "participant"
+
+	prepare := string(codectool.MustMarshalJSON(&BlueGreenPrepare{TxID: "tx1", Color: ColorGreen}))
+	bg.onPrepare(&prepare)
+	ack := &BlueGreenAck{}
+	assert.NoError(codectool.UnmarshalJSON([]byte(kvs[key]), ack))
+	assert.Equal("tx1", ack.TxID)
+	assert.Equal("participant", ack.Participant)
+	assert.Empty(ack.Error)
+
+	bg.green.createLoadBalancer(nil)
+	prepare = string(codectool.MustMarshalJSON(&BlueGreenPrepare{TxID: "tx2", Color: ColorGreen}))
+	bg.onPrepare(&prepare)
+	assert.NoError(codectool.UnmarshalJSON([]byte(kvs[key]), ack))
+	assert.Equal("tx2", ack.TxID)
+	assert.NotEmpty(ack.Error)
+
+	prepare = string(codectool.MustMarshalJSON(&BlueGreenPrepare{TxID: "tx3", Color: "red"}))
+	bg.onPrepare(&prepare)
+	assert.NoError(codectool.UnmarshalJSON([]byte(kvs[key]), ack))
+	assert.Equal("tx3", ack.TxID)
+	assert.NotEmpty(ack.Error)
+}
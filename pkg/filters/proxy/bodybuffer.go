@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const defaultMaxBufferedBodySize = 4 * 1024 * 1024
+
+type (
+	// BodyBufferSpec describes how a server pool buffers stream request
+	// bodies. A buffered body can be sent more than once, which is
+	// required by retries and mirroring.
+	BodyBufferSpec struct {
+		MaxBufferedBodySize int64  `json:"maxBufferedBodySize" jsonschema:"omitempty,minimum=0"`
+		SpillToDisk         bool   `json:"spillToDisk" jsonschema:"omitempty"`
+		MaxSpilledBodySize  int64  `json:"maxSpilledBodySize" jsonschema:"omitempty,minimum=0"`
+		TempDir             string `json:"tempDir" jsonschema:"omitempty"`
+	}
+
+	// spooledBody is a request body spilled to a temporary file, it is
+	// released when all its users release it.
+	spooledBody struct {
+		refs int32
+		file *os.File
+		size int64
+	}
+)
+
+// Validate validates BodyBufferSpec.
+func (s *BodyBufferSpec) Validate() error {
+	if !s.SpillToDisk && (s.MaxSpilledBodySize > 0 || s.TempDir != "") {
+		return fmt.Errorf("maxSpilledBodySize and tempDir require spillToDisk")
+	}
+	return nil
+}
+
+func (s *BodyBufferSpec) maxBufferedBodySize() int64 {
+	if s.MaxBufferedBodySize <= 0 {
+		return defaultMaxBufferedBodySize
+	}
+	return s.MaxBufferedBodySize
+}
+
+// bufferBody buffers the stream body of the request according to spec.
+//
+// If the body fits in memory, the payload of the request is replaced with
+// the buffered data and the request is no longer a stream. If the body is
+// spilled to disk, a spooledBody is returned and the caller must release
+// it, and the payload of the request is replaced with a seekable reader of
+// the spooled body, which can be read more than once. If the body is larger
+// than the limits, the request keeps streaming, unless it is spilled to
+// disk, in which case an error is returned.
+func bufferBody(spec *BodyBufferSpec, req *httpprot.Request) (*spooledBody, error) {
+	if !req.IsStream() {
+		return nil, nil
+	}
+
+	stream := req.GetPayload()
+	maxMem := spec.maxBufferedBodySize()
+
+	buf := bytes.NewBuffer(nil)
+	n, err := io.Copy(buf, io.LimitReader(stream, maxMem+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if n <= maxMem {
+		req.SetPayload(buf.Bytes())
+		return nil, nil
+	}
+
+	if !spec.SpillToDisk {
+		req.SetPayload(io.MultiReader(buf, stream))
+		return nil, nil
+	}
+
+	sb, err := spillBody(spec, buf, stream)
+	if err != nil {
+		return nil, err
+	}
+	req.SetPayload(sb.reader())
+	return sb, nil
+}
+
+func spillBody(spec *BodyBufferSpec, buf *bytes.Buffer, stream io.Reader) (*spooledBody, error) {
+	f, err := os.CreateTemp(spec.TempDir, "easegress-body-")
+	if err != nil {
+		return nil, err
+	}
+
+	sb := &spooledBody{refs: 1, file: f}
+
+	var r io.Reader = io.MultiReader(buf, stream)
+	if spec.MaxSpilledBodySize > 0 {
+		r = io.LimitReader(r, spec.MaxSpilledBodySize+1)
+	}
+
+	sb.size, err = io.Copy(f, r)
+	if err == nil && spec.MaxSpilledBodySize > 0 && sb.size > spec.MaxSpilledBodySize {
+		err = httpprot.ErrRequestEntityTooLarge
+	}
+	if err != nil {
+		sb.release()
+		return nil, err
+	}
+
+	return sb, nil
+}
+
+// reader returns a new reader of the full body.
+func (sb *spooledBody) reader() *io.SectionReader {
+	return io.NewSectionReader(sb.file, 0, sb.size)
+}
+
+func (sb *spooledBody) acquire() {
+	atomic.AddInt32(&sb.refs, 1)
+}
+
+func (sb *spooledBody) release() {
+	if atomic.AddInt32(&sb.refs, -1) > 0 {
+		return
+	}
+
+	name := sb.file.Name()
+	sb.file.Close()
+	if err := os.Remove(name); err != nil {
+		logger.Warnf("failed to remove spooled body %s: %v", name, err)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/stretchr/testify/assert"
+)
+
+func newStreamRequest(body string) *httpprot.Request {
+	stdr, _ := http.NewRequest(http.MethodPost, "http://megaease.com/abc", strings.NewReader(body))
+	req, _ := httpprot.NewRequest(stdr)
+	req.FetchPayload(-1)
+	return req
+}
+
+func TestBodyBufferSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &BodyBufferSpec{MaxSpilledBodySize: 100}
+	assert.Error(spec.Validate())
+
+	spec.SpillToDisk = true
+	assert.NoError(spec.Validate())
+}
+
+func TestBufferBody(t *testing.T) {
+	assert := assert.New(t)
+
+	// fits in memory.
+	req := newStreamRequest("0123456789")
+	sb, err := bufferBody(&BodyBufferSpec{MaxBufferedBodySize: 10}, req)
+	assert.NoError(err)
+	assert.Nil(sb)
+	assert.False(req.IsStream())
+	assert.Equal("0123456789", string(req.RawPayload()))
+
+	// too large and keep streaming.
+	req = newStreamRequest("0123456789")
+	sb, err = bufferBody(&BodyBufferSpec{MaxBufferedBodySize: 5}, req)
+	assert.NoError(err)
+	assert.Nil(sb)
+	assert.True(req.IsStream())
+	data, _ := io.ReadAll(req.GetPayload())
+	assert.Equal("0123456789", string(data))
+
+	// spill to disk.
+	req = newStreamRequest("0123456789")
+	spec := &BodyBufferSpec{MaxBufferedBodySize: 5, SpillToDisk: true, TempDir: t.TempDir()}
+	sb, err = bufferBody(spec, req)
+	assert.NoError(err)
+	assert.NotNil(sb)
+	assert.Equal(int64(10), sb.size)
+	for i := 0; i < 2; i++ {
+		data, _ = io.ReadAll(sb.reader())
+		assert.Equal("0123456789", string(data))
+	}
+	assert.True(req.IsStream())
+	for i := 0; i < 2; i++ {
+		data, err = io.ReadAll(req.GetPayload())
+		assert.NoError(err)
+		assert.Equal("0123456789", string(data))
+	}
+
+	name := sb.file.Name()
+	sb.acquire()
+	sb.release()
+	_, err = os.Stat(name)
+	assert.NoError(err)
+	sb.release()
+	_, err = os.Stat(name)
+	assert.True(os.IsNotExist(err))
+
+	// too large to spill.
+	req = newStreamRequest("0123456789")
+	spec.MaxSpilledBodySize = 8
+	_, err = bufferBody(spec, req)
+	assert.Equal(httpprot.ErrRequestEntityTooLarge, err)
+}
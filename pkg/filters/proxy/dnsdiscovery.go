@@ -0,0 +1,378 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	// ServiceDiscoveryDNS discovers the servers of a pool by DNS.
+	ServiceDiscoveryDNS = "dns"
+
+	dnsRecordA    = "A"
+	dnsRecordAAAA = "AAAA"
+	dnsRecordSRV  = "SRV"
+
+	defaultDNSRefreshInterval = 30 * time.Second
+	minDNSRefreshInterval     = time.Second
+	dnsQueryTimeout           = 5 * time.Second
+	resolvConfPath            = "/etc/resolv.conf"
+)
+
+type (
+	// DNSDiscoverySpec is the spec to discover the servers of a pool by
+	// DNS records.
+	DNSDiscoverySpec struct {
+		// Name is the domain name to resolve, it is always treated as a
+		// fully qualified name, the search domains are not used.
+		Name string `json:"name" jsonschema:"required"`
+		// RecordType is the type of the records, the default is A.
+		RecordType string `json:"recordType" jsonschema:"omitempty,enum=,enum=A,enum=AAAA,enum=SRV"`
+		// Port is the port of the servers, it is required for A and AAAA
+		// records, the port of SRV records is in the records.
+		Port uint16 `json:"port" jsonschema:"omitempty"`
+		// Scheme is the scheme of the servers, the default is http.
+		Scheme string `json:"scheme" jsonschema:"omitempty,enum=,enum=http,enum=https"`
+		// Server is the address of the DNS server, the first nameserver in
+		// /etc/resolv.conf is used if it is empty.
+		Server string `json:"server" jsonschema:"omitempty"`
+		// RefreshInterval is the maximum interval to resolve the records,
+		// they are resolved earlier if their TTL is shorter.
+		RefreshInterval string `json:"refreshInterval" jsonschema:"omitempty,format=duration"`
+	}
+
+	// dnsDiscovery resolves the servers of a pool.
+	dnsDiscovery struct {
+		spec            *DNSDiscoverySpec
+		client          *dns.Client
+		refreshInterval time.Duration
+	}
+)
+
+// Validate validates DNSDiscoverySpec.
+func (s *DNSDiscoverySpec) Validate() error {
+	if s.recordType() != dnsRecordSRV && s.Port == 0 {
+		return fmt.Errorf("port is required for %s records", s.recordType())
+	}
+
+	if s.Server != "" {
+		if _, _, err := net.SplitHostPort(s.Server); err != nil {
+			return fmt.Errorf("invalid server %s: %v", s.Server, err)
+		}
+	}
+
+	if s.RefreshInterval != "" {
+		d, err := time.ParseDuration(s.RefreshInterval)
+		if err != nil {
+			return fmt.Errorf("invalid refreshInterval: %v", err)
+		}
+		if d < minDNSRefreshInterval {
+			return fmt.Errorf("refreshInterval must not be less than %v", minDNSRefreshInterval)
+		}
+	}
+
+	return nil
+}
+
+func (s *DNSDiscoverySpec) recordType() string {
+	if s.RecordType == "" {
+		return dnsRecordA
+	}
+	return s.RecordType
+}
+
+func (s *DNSDiscoverySpec) scheme() string {
+	if s.Scheme == "" {
+		return "http"
+	}
+	return s.Scheme
+}
+
+func newDNSDiscovery(spec *DNSDiscoverySpec) *dnsDiscovery {
+	d := &dnsDiscovery{
+		spec:            spec,
+		client:          &dns.Client{Timeout: dnsQueryTimeout},
+		refreshInterval: defaultDNSRefreshInterval,
+	}
+	if spec.RefreshInterval != "" {
+		d.refreshInterval, _ = time.ParseDuration(spec.RefreshInterval)
+	}
+	return d
+}
+
+func (d *dnsDiscovery) server() (string, error) {
+	if d.spec.Server != "" {
+		return d.spec.Server, nil
+	}
+
+	cfg, err := dns.ClientConfigFromFile(resolvConfPath)
+	if err != nil {
+		return "", fmt.Errorf("read %s failed: %v", resolvConfPath, err)
+	}
+	if len(cfg.Servers) == 0 {
+		return "", fmt.Errorf("no nameserver in %s", resolvConfPath)
+	}
+	return net.JoinHostPort(cfg.Servers[0], cfg.Port), nil
+}
+
+// query queries the records of the name, and returns the answers, the
+// additional records and the minimum TTL of the answers.
+func (d *dnsDiscovery) query(server, name string, qtype uint16) ([]dns.RR, []dns.RR, time.Duration, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(name), qtype)
+
+	resp, _, err := d.client.Exchange(msg, server)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("query %s %s failed: %v", dns.TypeToString[qtype], name, err)
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, nil, 0, fmt.Errorf("query %s %s failed: %s", dns.TypeToString[qtype], name, dns.RcodeToString[resp.Rcode])
+	}
+
+	ttl := time.Duration(0)
+	for _, rr := range resp.Answer {
+		t := time.Duration(rr.Header().Ttl) * time.Second
+		if ttl == 0 || t < ttl {
+			ttl = t
+		}
+	}
+	return resp.Answer, resp.Extra, ttl, nil
+}
+
+// ips returns the IPs of the name in the records.
+func ips(rrs []dns.RR, name string) []net.IP {
+	var result []net.IP
+	for _, rr := range rrs {
+		if !strings.EqualFold(rr.Header().Name, name) {
+			continue
+		}
+		switch r := rr.(type) {
+		case *dns.A:
+			result = append(result, r.A)
+		case *dns.AAAA:
+			result = append(result, r.AAAA)
+		}
+	}
+	return result
+}
+
+// resolve resolves the servers, and returns the interval to the next
+// resolution, which is the minimum of the TTL and the refresh interval.
+func (d *dnsDiscovery) resolve() ([]*Server, time.Duration, error) {
+	server, err := d.server()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var servers []*Server
+	var ttl time.Duration
+	switch d.spec.recordType() {
+	case dnsRecordSRV:
+		servers, ttl, err = d.resolveSRV(server)
+	case dnsRecordAAAA:
+		servers, ttl, err = d.resolveIP(server, dns.TypeAAAA)
+	default:
+		servers, ttl, err = d.resolveIP(server, dns.TypeA)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	interval := d.refreshInterval
+	if ttl > 0 && ttl < interval {
+		interval = ttl
+	}
+	if interval < minDNSRefreshInterval {
+		interval = minDNSRefreshInterval
+	}
+	return servers, interval, nil
+}
+
+func (d *dnsDiscovery) serverURL(ip net.IP, port uint16) string {
+	host := net.JoinHostPort(ip.String(), strconv.Itoa(int(port)))
+	return d.spec.scheme() + "://" + host
+}
+
+func (d *dnsDiscovery) resolveIP(server string, qtype uint16) ([]*Server, time.Duration, error) {
+	name := dns.Fqdn(d.spec.Name)
+	answers, _, ttl, err := d.query(server, name, qtype)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var servers []*Server
+	// the answers may contain CNAME records, the names of the addresses
+	// are the canonical names.
+	for _, rr := range answers {
+		var ip net.IP
+		switch r := rr.(type) {
+		case *dns.A:
+			ip = r.A
+		case *dns.AAAA:
+			ip = r.AAAA
+		default:
+			continue
+		}
+		servers = append(servers, &Server{URL: d.serverURL(ip, d.spec.Port)})
+	}
+	return servers, ttl, nil
+}
+
+// resolveSRV resolves SRV records, only the targets of the lowest priority
+// are used, and their weights are the weights of the servers.
+func (d *dnsDiscovery) resolveSRV(server string) ([]*Server, time.Duration, error) {
+	answers, extra, ttl, err := d.query(server, d.spec.Name, dns.TypeSRV)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var records []*dns.SRV
+	for _, rr := range answers {
+		if srv, ok := rr.(*dns.SRV); ok {
+			records = append(records, srv)
+		}
+	}
+	if len(records) == 0 {
+		return nil, ttl, nil
+	}
+
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Priority < records[j].Priority })
+	priority := records[0].Priority
+
+	weighted := false
+	var servers []*Server
+	for _, srv := range records {
+		if srv.Priority != priority {
+			break
+		}
+
+		addrs := ips(extra, srv.Target)
+		if len(addrs) == 0 {
+			var answers []dns.RR
+			var targetTTL time.Duration
+			answers, _, targetTTL, err = d.query(server, srv.Target, dns.TypeA)
+			if err != nil {
+				return nil, 0, err
+			}
+			if targetTTL > 0 && targetTTL < ttl {
+				ttl = targetTTL
+			}
+			addrs = ips(answers, srv.Target)
+		}
+
+		for _, ip := range addrs {
+			servers = append(servers, &Server{
+				URL:    d.serverURL(ip, srv.Port),
+				Weight: int(srv.Weight),
+			})
+		}
+		weighted = weighted || srv.Weight > 0
+	}
+
+	// a server of weight 0 gets very few requests instead of none, and all
+	// servers must have weights to be balanced by weights.
+	if weighted {
+		for _, s := range servers {
+			if s.Weight == 0 {
+				s.Weight = 1
+			}
+		}
+	}
+
+	return servers, ttl, nil
+}
+
+// sameServers returns whether the two lists have the same servers.
+func sameServers(a, b []*Server) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	keys := func(servers []*Server) []string {
+		result := make([]string, 0, len(servers))
+		for _, s := range servers {
+			result = append(result, s.String())
+		}
+		sort.Strings(result)
+		return result
+	}
+
+	ka, kb := keys(a), keys(b)
+	for i := range ka {
+		if ka[i] != kb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (sp *ServerPool) watchDNS() {
+	d := newDNSDiscovery(sp.spec.DNS)
+
+	servers, interval, err := d.resolve()
+	if err != nil {
+		logger.Warnf("%s: first try to resolve %s failed(will try again): %v", sp.name, sp.spec.DNS.Name, err)
+		interval = minDNSRefreshInterval
+	}
+	sp.useDNSServers(servers)
+
+	sp.wg.Add(1)
+	go func() {
+		defer sp.wg.Done()
+
+		for {
+			select {
+			case <-sp.done:
+				return
+			case <-time.After(interval):
+			}
+
+			newServers, newInterval, err := d.resolve()
+			if err != nil {
+				logger.Warnf("%s: resolve %s failed: %v", sp.name, sp.spec.DNS.Name, err)
+				continue
+			}
+			interval = newInterval
+
+			if !sameServers(servers, newServers) {
+				servers = newServers
+				sp.useDNSServers(servers)
+			}
+		}
+	}()
+}
+
+// useDNSServers updates the load balancer with the resolved servers, the
+// static servers are used if no server is resolved.
+func (sp *ServerPool) useDNSServers(servers []*Server) {
+	if len(servers) == 0 {
+		logger.Warnf("%s: no server resolved from %s", sp.name, sp.spec.DNS.Name)
+		servers = sp.spec.Servers
+	}
+	sp.createLoadBalancer(servers)
+}
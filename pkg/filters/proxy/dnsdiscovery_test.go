@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func startDNSServer(t *testing.T, records map[uint16][]string) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		for _, s := range records[req.Question[0].Qtype] {
+			rr, err := dns.NewRR(s)
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			if rr.Header().Name == req.Question[0].Name {
+				resp.Answer = append(resp.Answer, rr)
+			}
+		}
+		w.WriteMsg(resp)
+	})
+
+	started := make(chan struct{})
+	server := &dns.Server{PacketConn: conn, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+
+	return conn.LocalAddr().String()
+}
+
+func TestDNSDiscoverySpec(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &DNSDiscoverySpec{Name: "example.com"}
+	assert.Error(spec.Validate())
+
+	spec.Port = 80
+	assert.NoError(spec.Validate())
+
+	spec.Server = "127.0.0.1"
+	assert.Error(spec.Validate())
+	spec.Server = "127.0.0.1:53"
+	assert.NoError(spec.Validate())
+
+	spec.RefreshInterval = "100ms"
+	assert.Error(spec.Validate())
+	spec.RefreshInterval = "10s"
+	assert.NoError(spec.Validate())
+
+	spec = &DNSDiscoverySpec{Name: "example.com", RecordType: "SRV"}
+	assert.NoError(spec.Validate())
+
+	pool := &ServerPoolSpec{ServiceDiscovery: ServiceDiscoveryDNS}
+	assert.Error(pool.Validate())
+	pool.DNS = spec
+	assert.NoError(pool.Validate())
+}
+
+func TestDNSDiscoveryResolve(t *testing.T) {
+	assert := assert.New(t)
+
+	server := startDNSServer(t, map[uint16][]string{
+		dns.TypeA: {
+			"web.example.com. 5 IN A 10.0.0.1",
+			"web.example.com. 60 IN A 10.0.0.2",
+			"a.example.com. 60 IN A 10.0.1.1",
+			"b.example.com. 60 IN A 10.0.1.2",
+			"c.example.com. 60 IN A 10.0.1.3",
+		},
+		dns.TypeAAAA: {
+			"web.example.com. 60 IN AAAA ::1",
+		},
+		dns.TypeSRV: {
+			"_http._tcp.example.com. 60 IN SRV 10 30 8080 a.example.com.",
+			"_http._tcp.example.com. 60 IN SRV 10 0 8081 b.example.com.",
+			"_http._tcp.example.com. 60 IN SRV 20 10 8082 c.example.com.",
+		},
+	})
+
+	d := newDNSDiscovery(&DNSDiscoverySpec{Name: "web.example.com", Port: 80, Server: server})
+	servers, interval, err := d.resolve()
+	assert.NoError(err)
+	assert.Equal(5*time.Second, interval)
+	assert.Len(servers, 2)
+	assert.Equal("http://10.0.0.1:80", servers[0].URL)
+	assert.Equal("http://10.0.0.2:80", servers[1].URL)
+
+	d = newDNSDiscovery(&DNSDiscoverySpec{
+		Name: "web.example.com", RecordType: "AAAA", Port: 443, Scheme: "https",
+		Server: server, RefreshInterval: "10s",
+	})
+	servers, interval, err = d.resolve()
+	assert.NoError(err)
+	assert.Equal(10*time.Second, interval)
+	assert.Len(servers, 1)
+	assert.Equal("https://[::1]:443", servers[0].URL)
+
+	d = newDNSDiscovery(&DNSDiscoverySpec{Name: "_http._tcp.example.com", RecordType: "SRV", Server: server})
+	servers, _, err = d.resolve()
+	assert.NoError(err)
+	assert.Len(servers, 2)
+	assert.Equal("http://10.0.1.1:8080", servers[0].URL)
+	assert.Equal(30, servers[0].Weight)
+	assert.Equal("http://10.0.1.2:8081", servers[1].URL)
+	assert.Equal(1, servers[1].Weight)
+
+	d = newDNSDiscovery(&DNSDiscoverySpec{Name: "unknown.example.com", Port: 80, Server: server})
+	servers, interval, err = d.resolve()
+	assert.NoError(err)
+	assert.Empty(servers)
+	assert.Equal(defaultDNSRefreshInterval, interval)
+}
+
+func TestSameServers(t *testing.T) {
+	assert := assert.New(t)
+
+	a := []*Server{{URL: "http://10.0.0.1:80"}, {URL: "http://10.0.0.2:80"}}
+	b := []*Server{{URL: "http://10.0.0.2:80"}, {URL: "http://10.0.0.1:80"}}
+	assert.True(sameServers(a, b))
+
+	b[0].Weight = 10
+	assert.False(sameServers(a, b))
+	assert.False(sameServers(a, a[:1]))
+}
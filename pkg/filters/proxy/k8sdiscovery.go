@@ -0,0 +1,303 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	apidiscoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	// ServiceDiscoveryKubernetes discovers the servers of a pool by the
+	// EndpointSlices of a Kubernetes Service.
+	ServiceDiscoveryKubernetes = "kubernetes"
+
+	k8sResyncPeriod = 10 * time.Minute
+)
+
+type (
+	// KubernetesDiscoverySpec is the spec to discover the servers of a pool
+	// by the EndpointSlices of a Kubernetes Service, requests are sent to
+	// the pods directly instead of through kube-proxy.
+	KubernetesDiscoverySpec struct {
+		// KubeConfig and MasterURL are used to connect to Kubernetes, both
+		// are optional when Easegress runs in the cluster.
+		KubeConfig string `json:"kubeConfig" jsonschema:"omitempty"`
+		MasterURL  string `json:"masterURL" jsonschema:"omitempty"`
+		// Namespace is the namespace of the Service, the default is default.
+		Namespace string `json:"namespace" jsonschema:"omitempty"`
+		Service   string `json:"service" jsonschema:"required"`
+		// Port is the name of the Service port, or the port number of the
+		// pods. It could be empty if the Service has only one port.
+		Port string `json:"port" jsonschema:"omitempty"`
+		// Scheme is the scheme of the servers, the default is http.
+		Scheme string `json:"scheme" jsonschema:"omitempty,enum=,enum=http,enum=https"`
+		// Zone is the zone of Easegress, endpoints hinted for the zone are
+		// preferred if topology aware hints are enabled for the Service.
+		Zone string `json:"zone" jsonschema:"omitempty"`
+	}
+
+	// k8sDiscovery watches the EndpointSlices of a Service.
+	k8sDiscovery struct {
+		spec     *KubernetesDiscoverySpec
+		factory  informers.SharedInformerFactory
+		notifyCh chan struct{}
+	}
+)
+
+var (
+	k8sClientsetsLock sync.Mutex
+	k8sClientsets     = map[string]*kubernetes.Clientset{}
+)
+
+// Validate validates KubernetesDiscoverySpec.
+func (s *KubernetesDiscoverySpec) Validate() error {
+	if s.Service == "" {
+		return fmt.Errorf("service is required")
+	}
+	return nil
+}
+
+func (s *KubernetesDiscoverySpec) namespace() string {
+	if s.Namespace == "" {
+		return metav1.NamespaceDefault
+	}
+	return s.Namespace
+}
+
+func (s *KubernetesDiscoverySpec) scheme() string {
+	if s.Scheme == "" {
+		return "http"
+	}
+	return s.Scheme
+}
+
+// getK8sClientset returns the clientset of the config, clientsets are
+// shared by all pools using the same config.
+func getK8sClientset(masterURL, kubeConfig string) (*kubernetes.Clientset, error) {
+	k8sClientsetsLock.Lock()
+	defer k8sClientsetsLock.Unlock()
+
+	key := masterURL + "|" + kubeConfig
+	if cs := k8sClientsets[key]; cs != nil {
+		return cs, nil
+	}
+
+	cfg, err := clientcmd.BuildConfigFromFlags(masterURL, kubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("build kubeconfig failed: %v", err)
+	}
+	cs, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("build kubernetes clientset failed: %v", err)
+	}
+
+	k8sClientsets[key] = cs
+	return cs, nil
+}
+
+func newK8sDiscovery(spec *KubernetesDiscoverySpec) (*k8sDiscovery, error) {
+	clientset, err := getK8sClientset(spec.MasterURL, spec.KubeConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	selector := apidiscoveryv1.LabelServiceName + "=" + spec.Service
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, k8sResyncPeriod,
+		informers.WithNamespace(spec.namespace()),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = selector
+		}),
+	)
+
+	d := &k8sDiscovery{
+		spec:     spec,
+		factory:  factory,
+		notifyCh: make(chan struct{}, 1),
+	}
+
+	notify := func() {
+		select {
+		case d.notifyCh <- struct{}{}:
+		default:
+		}
+	}
+	factory.Discovery().V1().EndpointSlices().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { notify() },
+		UpdateFunc: func(interface{}, interface{}) { notify() },
+		DeleteFunc: func(interface{}) { notify() },
+	})
+
+	return d, nil
+}
+
+func (d *k8sDiscovery) servers() ([]*Server, error) {
+	slices, err := d.factory.Discovery().V1().EndpointSlices().Lister().
+		EndpointSlices(d.spec.namespace()).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	return endpointSliceServers(d.spec, slices), nil
+}
+
+// slicePort returns the port of the EndpointSlice matching the spec.
+func slicePort(spec *KubernetesDiscoverySpec, slice *apidiscoveryv1.EndpointSlice) (int32, bool) {
+	if spec.Port == "" {
+		if len(slice.Ports) == 1 && slice.Ports[0].Port != nil {
+			return *slice.Ports[0].Port, true
+		}
+		return 0, false
+	}
+
+	for _, p := range slice.Ports {
+		if p.Port == nil {
+			continue
+		}
+		if p.Name != nil && *p.Name == spec.Port {
+			return *p.Port, true
+		}
+		if strconv.Itoa(int(*p.Port)) == spec.Port {
+			return *p.Port, true
+		}
+	}
+	return 0, false
+}
+
+// endpointSliceServers returns the servers of the ready endpoints, the
+// readiness of an endpoint respects the readiness gates of its pod. If the
+// zone is specified and all ready endpoints have hints, only the endpoints
+// hinted for the zone are used, like kube-proxy does.
+func endpointSliceServers(spec *KubernetesDiscoverySpec, slices []*apidiscoveryv1.EndpointSlice) []*Server {
+	type endpoint struct {
+		addr  string
+		port  int32
+		zones []apidiscoveryv1.ForZone
+	}
+
+	var ready []*endpoint
+	allHinted := true
+	for _, slice := range slices {
+		port, ok := slicePort(spec, slice)
+		if !ok {
+			continue
+		}
+
+		for _, ep := range slice.Endpoints {
+			// nil means unknown, which should be interpreted as ready.
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
+			}
+			if ep.Conditions.Terminating != nil && *ep.Conditions.Terminating {
+				continue
+			}
+			if len(ep.Addresses) == 0 {
+				continue
+			}
+
+			e := &endpoint{addr: ep.Addresses[0], port: port}
+			if ep.Hints != nil && len(ep.Hints.ForZones) > 0 {
+				e.zones = ep.Hints.ForZones
+			} else {
+				allHinted = false
+			}
+			ready = append(ready, e)
+		}
+	}
+
+	selected := ready
+	if spec.Zone != "" && allHinted {
+		var inZone []*endpoint
+		for _, e := range ready {
+			for _, z := range e.zones {
+				if z.Name == spec.Zone {
+					inZone = append(inZone, e)
+					break
+				}
+			}
+		}
+		if len(inZone) > 0 {
+			selected = inZone
+		}
+	}
+
+	servers := make([]*Server, 0, len(selected))
+	for _, e := range selected {
+		host := net.JoinHostPort(e.addr, strconv.Itoa(int(e.port)))
+		servers = append(servers, &Server{URL: spec.scheme() + "://" + host})
+	}
+	return servers
+}
+
+func (sp *ServerPool) watchKubernetes() {
+	// use the static servers until the EndpointSlices are synced.
+	sp.createLoadBalancer(sp.spec.Servers)
+
+	d, err := newK8sDiscovery(sp.spec.Kubernetes)
+	if err != nil {
+		logger.Errorf("%s: watch service %s failed: %v", sp.name, sp.spec.Kubernetes.Service, err)
+		return
+	}
+
+	stopCh := make(chan struct{})
+	d.factory.Start(stopCh)
+
+	sp.wg.Add(1)
+	go func() {
+		defer sp.wg.Done()
+		defer close(stopCh)
+
+		var servers []*Server
+		for {
+			select {
+			case <-sp.done:
+				return
+			case <-d.notifyCh:
+			}
+
+			newServers, err := d.servers()
+			if err != nil {
+				logger.Errorf("%s: list endpoint slices of %s failed: %v", sp.name, sp.spec.Kubernetes.Service, err)
+				continue
+			}
+			if servers != nil && sameServers(servers, newServers) {
+				continue
+			}
+
+			servers = newServers
+			if len(servers) == 0 {
+				logger.Warnf("%s: no ready endpoint of service %s", sp.name, sp.spec.Kubernetes.Service)
+				sp.createLoadBalancer(sp.spec.Servers)
+				continue
+			}
+			sp.createLoadBalancer(servers)
+		}
+	}()
+}
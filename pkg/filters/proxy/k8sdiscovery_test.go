@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apidiscoveryv1 "k8s.io/api/discovery/v1"
+)
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func newTestEndpoint(addr string, ready *bool, zones ...string) apidiscoveryv1.Endpoint {
+	ep := apidiscoveryv1.Endpoint{
+		Addresses:  []string{addr},
+		Conditions: apidiscoveryv1.EndpointConditions{Ready: ready},
+	}
+	if len(zones) > 0 {
+		ep.Hints = &apidiscoveryv1.EndpointHints{}
+		for _, z := range zones {
+			ep.Hints.ForZones = append(ep.Hints.ForZones, apidiscoveryv1.ForZone{Name: z})
+		}
+	}
+	return ep
+}
+
+func newTestSlice(ports map[string]int32, endpoints ...apidiscoveryv1.Endpoint) *apidiscoveryv1.EndpointSlice {
+	slice := &apidiscoveryv1.EndpointSlice{Endpoints: endpoints}
+	for name, port := range ports {
+		name, port := name, port
+		slice.Ports = append(slice.Ports, apidiscoveryv1.EndpointPort{Name: &name, Port: &port})
+	}
+	return slice
+}
+
+func serverURLs(servers []*Server) []string {
+	var urls []string
+	for _, s := range servers {
+		urls = append(urls, s.URL)
+	}
+	return urls
+}
+
+func TestKubernetesDiscoverySpec(t *testing.T) {
+	assert := assert.New(t)
+
+	pool := &ServerPoolSpec{ServiceDiscovery: ServiceDiscoveryKubernetes}
+	assert.Error(pool.Validate())
+
+	pool.Kubernetes = &KubernetesDiscoverySpec{}
+	assert.Error(pool.Validate())
+
+	pool.Kubernetes.Service = "web"
+	assert.NoError(pool.Validate())
+	assert.Equal("default", pool.Kubernetes.namespace())
+	assert.Equal("http", pool.Kubernetes.scheme())
+}
+
+func TestEndpointSliceServers(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &KubernetesDiscoverySpec{Service: "web"}
+	slices := []*apidiscoveryv1.EndpointSlice{
+		newTestSlice(map[string]int32{"http": 8080},
+			newTestEndpoint("10.0.0.1", boolPtr(true)),
+			newTestEndpoint("10.0.0.2", boolPtr(false)),
+			newTestEndpoint("10.0.0.3", nil),
+		),
+	}
+	assert.Equal([]string{"http://10.0.0.1:8080", "http://10.0.0.3:8080"},
+		serverURLs(endpointSliceServers(spec, slices)))
+
+	// port by name or number.
+	slices = []*apidiscoveryv1.EndpointSlice{
+		newTestSlice(map[string]int32{"http": 8080, "metrics": 9090},
+			newTestEndpoint("10.0.0.1", nil),
+		),
+	}
+	assert.Empty(endpointSliceServers(spec, slices))
+	spec.Port = "metrics"
+	assert.Equal([]string{"http://10.0.0.1:9090"}, serverURLs(endpointSliceServers(spec, slices)))
+	spec.Port = "8080"
+	assert.Equal([]string{"http://10.0.0.1:8080"}, serverURLs(endpointSliceServers(spec, slices)))
+
+	// topology aware hints.
+	spec = &KubernetesDiscoverySpec{Service: "web", Zone: "zone-a", Scheme: "https"}
+	slices = []*apidiscoveryv1.EndpointSlice{
+		newTestSlice(map[string]int32{"": 443},
+			newTestEndpoint("10.0.0.1", nil, "zone-a"),
+			newTestEndpoint("10.0.0.2", nil, "zone-b"),
+		),
+	}
+	assert.Equal([]string{"https://10.0.0.1:443"}, serverURLs(endpointSliceServers(spec, slices)))
+
+	// hints are ignored if not all endpoints have them.
+	slices[0].Endpoints = append(slices[0].Endpoints, newTestEndpoint("10.0.0.3", nil))
+	assert.Len(endpointSliceServers(spec, slices), 3)
+
+	// all endpoints are used if none is hinted for the zone.
+	spec.Zone = "zone-c"
+	slices[0].Endpoints = slices[0].Endpoints[:2]
+	assert.Len(endpointSliceServers(spec, slices), 2)
+}
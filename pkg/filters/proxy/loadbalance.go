@@ -47,27 +47,34 @@ type LoadBalancer interface {
 
 // LoadBalanceSpec is the spec to create a load balancer.
 type LoadBalanceSpec struct {
-	Policy        string `json:"policy" jsonschema:"omitempty,enum=,enum=roundRobin,enum=random,enum=weightedRandom,enum=ipHash,enum=headerHash"`
-	HeaderHashKey string `json:"headerHashKey" jsonschema:"omitempty"`
+	Policy        string             `json:"policy" jsonschema:"omitempty,enum=,enum=roundRobin,enum=random,enum=weightedRandom,enum=ipHash,enum=headerHash"`
+	HeaderHashKey string             `json:"headerHashKey" jsonschema:"omitempty"`
+	StickySession *StickySessionSpec `json:"stickySession,omitempty" jsonschema:"omitempty"`
 }
 
 // NewLoadBalancer creates a load balancer for servers according to spec.
 func NewLoadBalancer(spec *LoadBalanceSpec, servers []*Server) LoadBalancer {
+	var lb LoadBalancer
 	switch spec.Policy {
 	case LoadBalancePolicyRoundRobin, "":
-		return newRoundRobinLoadBalancer(servers)
+		lb = newRoundRobinLoadBalancer(servers)
 	case LoadBalancePolicyRandom:
-		return newRandomLoadBalancer(servers)
+		lb = newRandomLoadBalancer(servers)
 	case LoadBalancePolicyWeightedRandom:
-		return newWeightedRandomLoadBalancer(servers)
+		lb = newWeightedRandomLoadBalancer(servers)
 	case LoadBalancePolicyIPHash:
-		return newIPHashLoadBalancer(servers)
+		lb = newIPHashLoadBalancer(servers)
 	case LoadBalancePolicyHeaderHash:
-		return newHeaderHashLoadBalancer(servers, spec.HeaderHashKey)
+		lb = newHeaderHashLoadBalancer(servers, spec.HeaderHashKey)
 	default:
 		logger.Errorf("unsupported load balancing policy: %s", spec.Policy)
-		return newRoundRobinLoadBalancer(servers)
+		lb = newRoundRobinLoadBalancer(servers)
 	}
+
+	if spec.StickySession != nil {
+		lb = newStickySessionLoadBalancer(spec.StickySession, lb, servers)
+	}
+	return lb
 }
 
 // BaseLoadBalancer implement the common part of load balancer.
@@ -75,6 +82,10 @@ type BaseLoadBalancer struct {
 	Servers []*Server
 }
 
+func (blb *BaseLoadBalancer) serverCount() int {
+	return len(blb.Servers)
+}
+
 // randomLoadBalancer does load balancing in a random manner.
 type randomLoadBalancer struct {
 	BaseLoadBalancer
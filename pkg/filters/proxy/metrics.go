@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot/httpstat"
+	"github.com/megaease/easegress/pkg/resilience"
+	"github.com/megaease/easegress/pkg/util/prometheushelper"
+)
+
+// metricsOwners are the latest metrics of the pools, the key is the
+// labels. A new pool is created before the old one of the same labels is
+// closed, and the old one must not delete the gauges of the new one.
+var (
+	metricsOwnersLock sync.Mutex
+	metricsOwners     = map[string]*metrics{}
+)
+
+// metrics are the Prometheus metrics of a server pool.
+type metrics struct {
+	key    string
+	labels prometheus.Labels
+
+	requests       *prometheus.CounterVec
+	duration       *prometheus.HistogramVec
+	servers        *prometheus.GaugeVec
+	circuitBreaker *prometheus.GaugeVec
+}
+
+func newMetrics(pipeline, filter, pool string) *metrics {
+	labels := []string{"pipeline", "filter", "pool"}
+	m := &metrics{
+		key: pipeline + "#" + filter + "#" + pool,
+		labels: prometheus.Labels{
+			"pipeline": pipeline,
+			"filter":   filter,
+			"pool":     pool,
+		},
+
+		requests: prometheushelper.NewCounter("proxy_upstream_requests_total",
+			"the total count of requests to the upstream servers",
+			append(labels, "status_class")),
+		duration: prometheushelper.NewHistogram("proxy_upstream_request_duration_seconds",
+			"the duration of requests to the upstream servers",
+			append(labels, "status_class"), nil),
+		servers: prometheushelper.NewGauge("proxy_upstream_servers",
+			"the number of the upstream servers in the load balancer", labels),
+		circuitBreaker: prometheushelper.NewGauge("proxy_circuit_breaker_state",
+			"the state of the circuit breaker, 0: disabled, 1: closed, 2: half open, 3: open, 4: force open",
+			labels),
+	}
+
+	metricsOwnersLock.Lock()
+	metricsOwners[m.key] = m
+	metricsOwnersLock.Unlock()
+
+	return m
+}
+
+func (m *metrics) withStatusClass(code int) prometheus.Labels {
+	labels := prometheus.Labels{"status_class": prometheushelper.StatusClass(code)}
+	for k, v := range m.labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+func (m *metrics) stat(metric *httpstat.Metric, cb resilience.Wrapper) {
+	labels := m.withStatusClass(metric.StatusCode)
+	m.requests.With(labels).Inc()
+	m.duration.With(labels).Observe(metric.Duration.Seconds())
+
+	if w, ok := cb.(*resilience.CircuitBreakerWrapper); ok {
+		m.circuitBreaker.With(m.labels).Set(float64(w.State()))
+	}
+}
+
+func (m *metrics) setServers(n int) {
+	m.servers.With(m.labels).Set(float64(n))
+}
+
+// close deletes the gauges if no new pool of the same labels is created,
+// as the pool may not exist anymore.
+func (m *metrics) close() {
+	metricsOwnersLock.Lock()
+	defer metricsOwnersLock.Unlock()
+
+	if metricsOwners[m.key] != m {
+		return
+	}
+	delete(metricsOwners, m.key)
+
+	m.servers.Delete(m.labels)
+	m.circuitBreaker.Delete(m.labels)
+}
@@ -0,0 +1,272 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/protocols/httpprot/httpheader"
+	"github.com/megaease/easegress/pkg/protocols/httpprot/httpstat"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+const (
+	defaultMirrorQueueSize = 1024
+	defaultMirrorWorkers   = 16
+	defaultMirrorTimeout   = 30 * time.Second
+)
+
+type (
+	// MirrorSpec describes the traffic mirroring of the Proxy.
+	MirrorSpec struct {
+		Pools     []*MirrorPoolSpec `json:"pools" jsonschema:"required,minItems=1"`
+		QueueSize int               `json:"queueSize" jsonschema:"omitempty,minimum=1"`
+		Workers   int               `json:"workers" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// MirrorPoolSpec describes a shadow pool which receives copies of
+	// the requests.
+	MirrorPoolSpec struct {
+		ServerPoolSpec `json:",inline"`
+		SamplePercent  float64               `json:"samplePercent" jsonschema:"omitempty,minimum=0,maximum=100"`
+		Header         *httpheader.AdaptSpec `json:"header,omitempty" jsonschema:"omitempty"`
+	}
+
+	// MirrorStatus is the status of the traffic mirroring.
+	MirrorStatus struct {
+		Sampled uint64              `json:"sampled"`
+		Dropped uint64              `json:"dropped"`
+		Failed  uint64              `json:"failed"`
+		Pools   []*ServerPoolStatus `json:"pools,omitempty"`
+	}
+
+	// mirrorer sends copies of requests to shadow pools asynchronously,
+	// the latency of shadow pools never affects the primary request.
+	mirrorer struct {
+		// counters are put first to keep them 64-bit aligned.
+		sampled uint64
+		dropped uint64
+		failed  uint64
+
+		proxy *Proxy
+		pools []*mirrorPool
+		queue chan *mirrorTask
+		done  chan struct{}
+		wg    sync.WaitGroup
+	}
+
+	mirrorPool struct {
+		pool    *ServerPool
+		percent float64
+		header  *httpheader.AdaptSpec
+	}
+
+	mirrorTask struct {
+		mp      *mirrorPool
+		stdReq  *http.Request
+		reqSize uint64
+		body    *spooledBody
+	}
+)
+
+// Validate validates MirrorSpec.
+func (s *MirrorSpec) Validate() error {
+	for i, pool := range s.Pools {
+		if err := pool.ServerPoolSpec.Validate(); err != nil {
+			return fmt.Errorf("mirror pool %d: %v", i, err)
+		}
+		if pool.MemoryCache != nil {
+			return fmt.Errorf("mirror pool %d: memoryCache must be empty", i)
+		}
+	}
+	return nil
+}
+
+func newMirrorer(proxy *Proxy, spec *MirrorSpec) *mirrorer {
+	queueSize, workers := defaultMirrorQueueSize, defaultMirrorWorkers
+	if spec != nil && spec.QueueSize > 0 {
+		queueSize = spec.QueueSize
+	}
+	if spec != nil && spec.Workers > 0 {
+		workers = spec.Workers
+	}
+
+	m := &mirrorer{
+		proxy: proxy,
+		queue: make(chan *mirrorTask, queueSize),
+		done:  make(chan struct{}),
+	}
+
+	for i := 0; i < workers; i++ {
+		m.wg.Add(1)
+		go m.run()
+	}
+
+	return m
+}
+
+func (m *mirrorer) addPool(pool *ServerPool, percent float64, header *httpheader.AdaptSpec) {
+	if percent <= 0 {
+		percent = 100
+	}
+	m.pools = append(m.pools, &mirrorPool{
+		pool:    pool,
+		percent: percent,
+		header:  header,
+	})
+}
+
+// mirror samples the request and enqueues copies of it, it never blocks.
+// body is the spooled body of the request, it could be nil.
+func (m *mirrorer) mirror(req *httpprot.Request, body *spooledBody) {
+	for _, mp := range m.pools {
+		if mp.pool.filter != nil && !mp.pool.filter.Match(req) {
+			continue
+		}
+		if mp.percent < 100 && rand.Float64()*100 >= mp.percent {
+			continue
+		}
+
+		atomic.AddUint64(&m.sampled, 1)
+
+		task := m.newTask(mp, req, body)
+		if task == nil {
+			atomic.AddUint64(&m.failed, 1)
+			continue
+		}
+
+		select {
+		case m.queue <- task:
+		default:
+			atomic.AddUint64(&m.dropped, 1)
+			task.release()
+		}
+	}
+}
+
+func (m *mirrorer) newTask(mp *mirrorPool, req *httpprot.Request, body *spooledBody) *mirrorTask {
+	svr := mp.pool.LoadBalancer().ChooseServer(req)
+	if svr == nil {
+		return nil
+	}
+
+	// the request is prepared with a background context, so that it is
+	// not canceled when the primary request completes.
+	spCtx := &serverPoolContext{req: req, body: body}
+	if err := spCtx.prepareRequest(svr, stdcontext.Background(), true); err != nil {
+		logger.Debugf("%s: failed to prepare request: %v", mp.pool.name, err)
+		return nil
+	}
+
+	if mp.header != nil {
+		h := httpheader.New(spCtx.stdReq.Header)
+		h.Adapt(mp.header)
+	}
+
+	if body != nil {
+		body.acquire()
+	}
+
+	return &mirrorTask{
+		mp:      mp,
+		stdReq:  spCtx.stdReq,
+		reqSize: uint64(req.MetaSize()),
+		body:    body,
+	}
+}
+
+func (task *mirrorTask) release() {
+	if task.body != nil {
+		task.body.release()
+	}
+}
+
+func (m *mirrorer) run() {
+	defer m.wg.Done()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case task := <-m.queue:
+			m.send(task)
+		}
+	}
+}
+
+func (m *mirrorer) send(task *mirrorTask) {
+	defer task.release()
+	sp := task.mp.pool
+
+	timeout := sp.timeout
+	if timeout <= 0 {
+		timeout = defaultMirrorTimeout
+	}
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), timeout)
+	defer cancel()
+
+	startTime := fasttime.Now()
+	metric := &httpstat.Metric{ReqSize: task.reqSize}
+
+	resp, err := fnSendRequest(task.stdReq.WithContext(ctx), sp.httpClient())
+	if err != nil {
+		atomic.AddUint64(&m.failed, 1)
+		metric.StatusCode = http.StatusServiceUnavailable
+	} else {
+		n, _ := io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		metric.StatusCode = resp.StatusCode
+		metric.RespSize = uint64(n)
+	}
+
+	metric.Duration = fasttime.Since(startTime)
+	sp.httpStat.Stat(metric)
+}
+
+func (m *mirrorer) status() *MirrorStatus {
+	s := &MirrorStatus{
+		Sampled: atomic.LoadUint64(&m.sampled),
+		Dropped: atomic.LoadUint64(&m.dropped),
+		Failed:  atomic.LoadUint64(&m.failed),
+	}
+	for _, mp := range m.pools {
+		// status of the legacy mirror pool is reported separately.
+		if mp.pool != m.proxy.mirrorPool {
+			s.Pools = append(s.Pools, mp.pool.status())
+		}
+	}
+	return s
+}
+
+func (m *mirrorer) close() {
+	close(m.done)
+	m.wg.Wait()
+
+	for _, mp := range m.pools {
+		mp.pool.close()
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/protocols/httpprot/httpheader"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirrorSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &MirrorSpec{Pools: []*MirrorPoolSpec{{}}}
+	assert.Error(spec.Validate())
+
+	spec.Pools[0].Servers = []*Server{{URL: "http://127.0.0.1:9095"}}
+	assert.NoError(spec.Validate())
+
+	spec.Pools[0].MemoryCache = &MemoryCacheSpec{}
+	assert.Error(spec.Validate())
+}
+
+func TestMirrorer(t *testing.T) {
+	assert := assert.New(t)
+
+	// no workers are consuming the queue, so tasks stay in it.
+	m := &mirrorer{
+		queue: make(chan *mirrorTask, 1),
+		done:  make(chan struct{}),
+	}
+
+	spec := &ServerPoolSpec{Servers: []*Server{{URL: "http://127.0.0.1:9095"}}}
+	m.addPool(NewServerPool(nil, spec, "mirror"), 0, &httpheader.AdaptSpec{
+		Del: []string{"Authorization"},
+		Set: map[string]string{"X-Shadow": "true"},
+	})
+	assert.Equal(float64(100), m.pools[0].percent)
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://megaease.com/abc", nil)
+	stdr.Header.Set("Authorization", "secret")
+	req, _ := httpprot.NewRequest(stdr)
+	req.FetchPayload(0)
+
+	m.mirror(req, nil)
+	m.mirror(req, nil)
+
+	assert.Equal(uint64(2), m.sampled)
+	assert.Equal(uint64(1), m.dropped)
+
+	task := <-m.queue
+	assert.Equal("", task.stdReq.Header.Get("Authorization"))
+	assert.Equal("true", task.stdReq.Header.Get("X-Shadow"))
+	assert.Equal("secret", req.HTTPHeader().Get("Authorization"))
+
+	// sample nothing.
+	m.pools[0].percent = 0.000001
+	for i := 0; i < 10; i++ {
+		m.mirror(req, nil)
+	}
+	assert.LessOrEqual(m.sampled, uint64(3))
+}
@@ -0,0 +1,231 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+const (
+	defaultConsecutiveFailures = 5
+	defaultBaseEjectionTime    = 30 * time.Second
+	defaultMaxEjectionTime     = 300 * time.Second
+	defaultMaxEjectionPercent  = 10
+)
+
+type (
+	// OutlierDetectionSpec describes the passive health checking of the
+	// servers in a server pool. A server is ejected from load balancing
+	// after it fails for ConsecutiveFailures times in a row, and it is
+	// added back after the ejection time, which is BaseEjectionTime
+	// multiplied by the number of times it has been ejected, but no more
+	// than MaxEjectionTime.
+	OutlierDetectionSpec struct {
+		ConsecutiveFailures int    `json:"consecutiveFailures" jsonschema:"omitempty,minimum=1"`
+		BaseEjectionTime    string `json:"baseEjectionTime" jsonschema:"omitempty,format=duration"`
+		MaxEjectionTime     string `json:"maxEjectionTime" jsonschema:"omitempty,format=duration"`
+		// MaxEjectionPercent is the max percentage of the servers could be
+		// ejected at the same time, but at least one server is allowed to
+		// be ejected.
+		MaxEjectionPercent int `json:"maxEjectionPercent" jsonschema:"omitempty,minimum=0,maximum=100"`
+	}
+
+	outlierDetector struct {
+		lock                sync.Mutex
+		consecutiveFailures int
+		baseEjectionTime    time.Duration
+		maxEjectionTime     time.Duration
+		maxEjectionPercent  int
+		servers             map[string]*outlierServer
+		total               int
+		now                 func() time.Time
+	}
+
+	outlierServer struct {
+		failures     int
+		ejections    int
+		ejectedUntil time.Time
+	}
+)
+
+// Validate validates OutlierDetectionSpec.
+func (s *OutlierDetectionSpec) Validate() error {
+	var base, max time.Duration
+	if s.BaseEjectionTime != "" {
+		base, _ = time.ParseDuration(s.BaseEjectionTime)
+	}
+	if s.MaxEjectionTime != "" {
+		max, _ = time.ParseDuration(s.MaxEjectionTime)
+	}
+	if base > 0 && max > 0 && base > max {
+		return fmt.Errorf("baseEjectionTime is greater than maxEjectionTime")
+	}
+	return nil
+}
+
+func newOutlierDetector(spec *OutlierDetectionSpec) *outlierDetector {
+	od := &outlierDetector{
+		consecutiveFailures: spec.ConsecutiveFailures,
+		baseEjectionTime:    defaultBaseEjectionTime,
+		maxEjectionTime:     defaultMaxEjectionTime,
+		maxEjectionPercent:  spec.MaxEjectionPercent,
+		servers:             map[string]*outlierServer{},
+		now:                 fasttime.Now,
+	}
+
+	if od.consecutiveFailures <= 0 {
+		od.consecutiveFailures = defaultConsecutiveFailures
+	}
+	if od.maxEjectionPercent <= 0 {
+		od.maxEjectionPercent = defaultMaxEjectionPercent
+	}
+	if d, _ := time.ParseDuration(spec.BaseEjectionTime); d > 0 {
+		od.baseEjectionTime = d
+	}
+	if d, _ := time.ParseDuration(spec.MaxEjectionTime); d > 0 {
+		od.maxEjectionTime = d
+	}
+	if od.maxEjectionTime < od.baseEjectionTime {
+		od.maxEjectionTime = od.baseEjectionTime
+	}
+
+	return od
+}
+
+// setServers updates the servers being detected, the states of the
+// servers no longer in the pool are dropped.
+func (od *outlierDetector) setServers(servers []*Server) {
+	od.lock.Lock()
+	defer od.lock.Unlock()
+
+	states := make(map[string]*outlierServer, len(servers))
+	for _, svr := range servers {
+		if s := od.servers[svr.URL]; s != nil {
+			states[svr.URL] = s
+		}
+	}
+	od.servers = states
+	od.total = len(servers)
+}
+
+// chooseServer chooses a server which is not ejected from the load
+// balancer. To keep the traffic flowing, a server is still returned even
+// if all the chosen ones are ejected.
+func (od *outlierDetector) chooseServer(lb LoadBalancer, req *httpprot.Request) *Server {
+	od.lock.Lock()
+	attempts := od.total
+	od.lock.Unlock()
+
+	var svr *Server
+	for i := 0; i < attempts || i == 0; i++ {
+		svr = lb.ChooseServer(req)
+		if svr == nil || !od.isEjected(svr) {
+			return svr
+		}
+	}
+	return svr
+}
+
+func (od *outlierDetector) isEjected(svr *Server) bool {
+	od.lock.Lock()
+	defer od.lock.Unlock()
+
+	s := od.servers[svr.URL]
+	return s != nil && od.now().Before(s.ejectedUntil)
+}
+
+// ejectedCount returns the number of servers being ejected, the caller
+// must hold the lock.
+func (od *outlierDetector) ejectedCount(now time.Time) int {
+	count := 0
+	for _, s := range od.servers {
+		if now.Before(s.ejectedUntil) {
+			count++
+		}
+	}
+	return count
+}
+
+// record records the result of a request sent to the server, and ejects
+// the server if it fails too many times in a row.
+func (od *outlierDetector) record(svr *Server, failed bool) {
+	od.lock.Lock()
+	defer od.lock.Unlock()
+
+	s := od.servers[svr.URL]
+	if s == nil {
+		if !failed {
+			return
+		}
+		s = &outlierServer{}
+		od.servers[svr.URL] = s
+	}
+
+	if !failed {
+		s.failures = 0
+		return
+	}
+
+	s.failures++
+	if s.failures < od.consecutiveFailures {
+		return
+	}
+
+	now := od.now()
+	if now.Before(s.ejectedUntil) {
+		return
+	}
+
+	maxEjected := od.total * od.maxEjectionPercent / 100
+	if maxEjected < 1 {
+		maxEjected = 1
+	}
+	if od.ejectedCount(now) >= maxEjected {
+		return
+	}
+
+	s.failures = 0
+	s.ejections++
+	d := od.baseEjectionTime * time.Duration(s.ejections)
+	if d > od.maxEjectionTime || d <= 0 {
+		d = od.maxEjectionTime
+	}
+	s.ejectedUntil = now.Add(d)
+}
+
+// ejectedServers returns the URLs of the servers being ejected.
+func (od *outlierDetector) ejectedServers() []string {
+	od.lock.Lock()
+	defer od.lock.Unlock()
+
+	now := od.now()
+	var urls []string
+	for url, s := range od.servers {
+		if now.Before(s.ejectedUntil) {
+			urls = append(urls, url)
+		}
+	}
+	sort.Strings(urls)
+	return urls
+}
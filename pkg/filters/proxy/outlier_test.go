@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutlierDetectionSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &OutlierDetectionSpec{BaseEjectionTime: "1m", MaxEjectionTime: "10s"}
+	assert.Error(spec.Validate())
+
+	spec = &OutlierDetectionSpec{BaseEjectionTime: "10s", MaxEjectionTime: "1m"}
+	assert.NoError(spec.Validate())
+}
+
+func TestOutlierDetector(t *testing.T) {
+	assert := assert.New(t)
+
+	servers := prepareServers(4)
+	lb := NewLoadBalancer(&LoadBalanceSpec{Policy: LoadBalancePolicyRoundRobin}, servers)
+
+	now := time.Now()
+	od := newOutlierDetector(&OutlierDetectionSpec{
+		ConsecutiveFailures: 2,
+		BaseEjectionTime:    "10s",
+		MaxEjectionTime:     "15s",
+		MaxEjectionPercent:  50,
+	})
+	od.now = func() time.Time { return now }
+	od.setServers(servers)
+
+	// a success resets the consecutive failures.
+	od.record(servers[0], true)
+	od.record(servers[0], false)
+	od.record(servers[0], true)
+	assert.False(od.isEjected(servers[0]))
+
+	od.record(servers[0], true)
+	assert.True(od.isEjected(servers[0]))
+	assert.Equal([]string{servers[0].URL}, od.ejectedServers())
+
+	for i := 0; i < 8; i++ {
+		assert.NotEqual(servers[0], od.chooseServer(lb, nil))
+	}
+
+	// at most 2 of the 4 servers could be ejected.
+	for _, svr := range servers[1:] {
+		od.record(svr, true)
+		od.record(svr, true)
+	}
+	assert.Len(od.ejectedServers(), 2)
+
+	// the ejection time grows with the number of ejections.
+	now = now.Add(10 * time.Second)
+	assert.False(od.isEjected(servers[0]))
+	od.record(servers[0], true)
+	od.record(servers[0], true)
+	assert.True(od.isEjected(servers[0]))
+	now = now.Add(14 * time.Second)
+	assert.True(od.isEjected(servers[0]))
+	now = now.Add(time.Second)
+	assert.False(od.isEjected(servers[0]))
+
+	// states of the removed servers are dropped.
+	od.setServers(servers[2:])
+	assert.NotContains(od.servers, servers[0].URL)
+	assert.Len(od.servers, 2)
+}
@@ -23,6 +23,7 @@ import (
 	"io"
 	"net/http"
 	"net/textproto"
+	"net/url"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -37,6 +38,7 @@ import (
 	"github.com/megaease/easegress/pkg/protocols/httpprot/httpstat"
 	"github.com/megaease/easegress/pkg/resilience"
 	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/accesslog"
 	"github.com/megaease/easegress/pkg/util/fasttime"
 	"github.com/megaease/easegress/pkg/util/readers"
 	"github.com/megaease/easegress/pkg/util/stringtool"
@@ -77,6 +79,15 @@ type serverPoolContext struct {
 	stdResp *http.Response
 
 	respCallbackBody *readers.CallbackReader
+
+	// body is the spooled request body, it is nil if the body is not
+	// spilled to disk.
+	body *spooledBody
+}
+
+// replayable returns whether the request body can be sent more than once.
+func (spCtx *serverPoolContext) replayable() bool {
+	return spCtx.body != nil || !spCtx.req.IsStream()
 }
 
 // Hop-by-hop headers. These are removed when sent to the backend.
@@ -133,7 +144,9 @@ func (spCtx *serverPoolContext) prepareRequest(svr *Server, ctx stdcontext.Conte
 	}
 
 	var payload io.Reader
-	if mirror && spCtx.req.IsStream() {
+	if spCtx.body != nil {
+		payload = spCtx.body.reader()
+	} else if mirror && spCtx.req.IsStream() {
 		payload = strings.NewReader("cannot send a stream body to mirror")
 	} else {
 		payload = req.GetPayload()
@@ -142,13 +155,17 @@ func (spCtx *serverPoolContext) prepareRequest(svr *Server, ctx stdcontext.Conte
 	if err != nil {
 		return err
 	}
+	if spCtx.body != nil {
+		stdr.ContentLength = spCtx.body.size
+	}
 
 	stdr.Header = req.HTTPHeader().Clone()
 	removeHopByHopHeaders(stdr.Header)
 
 	// only set host when server address is not host name OR
-	// server is explicitly told to keep the host of the request.
-	if !svr.addrIsHostName || svr.KeepHost {
+	// server is explicitly told to keep the host of the request OR
+	// the host of the request is rewritten by a filter.
+	if !svr.addrIsHostName || svr.KeepHost || spCtx.GetData(httpprot.DataHostRewritten) == req {
 		stdr.Host = req.Host()
 	}
 
@@ -174,37 +191,72 @@ type ServerPool struct {
 	timeout               time.Duration
 	retryWrapper          resilience.Wrapper
 	circuitBreakerWrapper resilience.Wrapper
+	retryer               *retryer
+	outlierDetector       *outlierDetector
 
 	httpStat    *httpstat.HTTPStat
+	metrics     *metrics
 	memoryCache *MemoryCache
+
+	// client is the HTTP client dedicated to this pool, it is nil if the
+	// pool shares the client of the proxy.
+	client *http.Client
 }
 
 // ServerPoolSpec is the spec for a server pool.
 type ServerPoolSpec struct {
-	SpanName             string              `json:"spanName" jsonschema:"omitempty"`
-	Filter               *RequestMatcherSpec `json:"filter" jsonschema:"omitempty"`
-	ServerMaxBodySize    int64               `json:"serverMaxBodySize" jsonschema:"omitempty"`
-	ServerTags           []string            `json:"serverTags" jsonschema:"omitempty,uniqueItems=true"`
-	Servers              []*Server           `json:"servers" jsonschema:"omitempty"`
-	ServiceRegistry      string              `json:"serviceRegistry" jsonschema:"omitempty"`
-	ServiceName          string              `json:"serviceName" jsonschema:"omitempty"`
-	LoadBalance          *LoadBalanceSpec    `json:"loadBalance" jsonschema:"omitempty"`
-	Timeout              string              `json:"timeout" jsonschema:"omitempty,format=duration"`
-	RetryPolicy          string              `json:"retryPolicy" jsonschema:"omitempty"`
-	CircuitBreakerPolicy string              `json:"circuitBreakerPolicy" jsonschema:"omitempty"`
-	FailureCodes         []int               `json:"failureCodes" jsonschema:"omitempty"`
-	MemoryCache          *MemoryCacheSpec    `json:"memoryCache,omitempty" jsonschema:"omitempty"`
+	SpanName             string                   `json:"spanName" jsonschema:"omitempty"`
+	Filter               *RequestMatcherSpec      `json:"filter" jsonschema:"omitempty"`
+	ServerMaxBodySize    int64                    `json:"serverMaxBodySize" jsonschema:"omitempty"`
+	ServerTags           []string                 `json:"serverTags" jsonschema:"omitempty,uniqueItems=true"`
+	Servers              []*Server                `json:"servers" jsonschema:"omitempty"`
+	ServiceRegistry      string                   `json:"serviceRegistry" jsonschema:"omitempty"`
+	ServiceName          string                   `json:"serviceName" jsonschema:"omitempty"`
+	ServiceDiscovery     string                   `json:"serviceDiscovery" jsonschema:"omitempty,enum=,enum=dns,enum=kubernetes"`
+	DNS                  *DNSDiscoverySpec        `json:"dns,omitempty" jsonschema:"omitempty"`
+	Kubernetes           *KubernetesDiscoverySpec `json:"kubernetes,omitempty" jsonschema:"omitempty"`
+	LoadBalance          *LoadBalanceSpec         `json:"loadBalance" jsonschema:"omitempty"`
+	Timeout              string                   `json:"timeout" jsonschema:"omitempty,format=duration"`
+	TimeoutOverrides     []*TimeoutOverride       `json:"timeoutOverrides,omitempty" jsonschema:"omitempty"`
+	DeadlineHeaders      []*DeadlineHeader        `json:"deadlineHeaders,omitempty" jsonschema:"omitempty"`
+	RetryPolicy          string                   `json:"retryPolicy" jsonschema:"omitempty"`
+	Retry                *RetrySpec               `json:"retry,omitempty" jsonschema:"omitempty"`
+	OutlierDetection     *OutlierDetectionSpec    `json:"outlierDetection,omitempty" jsonschema:"omitempty"`
+	CircuitBreakerPolicy string                   `json:"circuitBreakerPolicy" jsonschema:"omitempty"`
+	FailureCodes         []int                    `json:"failureCodes" jsonschema:"omitempty"`
+	MemoryCache          *MemoryCacheSpec         `json:"memoryCache,omitempty" jsonschema:"omitempty"`
+	BodyBuffer           *BodyBufferSpec          `json:"bodyBuffer,omitempty" jsonschema:"omitempty"`
+	TLS                  *TLSSpec                 `json:"tls,omitempty" jsonschema:"omitempty"`
 }
 
 // ServerPoolStatus is the status of Pool.
 type ServerPoolStatus struct {
-	Stat *httpstat.Status `json:"stat"`
+	Stat           *httpstat.Status                 `json:"stat"`
+	CircuitBreaker *resilience.CircuitBreakerStatus `json:"circuitBreaker,omitempty"`
+	EjectedServers []string                         `json:"ejectedServers,omitempty"`
 }
 
 // Validate validates ServerPoolSpec.
 func (sps *ServerPoolSpec) Validate() error {
-	if sps.ServiceName == "" && len(sps.Servers) == 0 {
-		return fmt.Errorf("both serviceName and servers are empty")
+	switch sps.ServiceDiscovery {
+	case ServiceDiscoveryDNS:
+		if sps.DNS == nil {
+			return fmt.Errorf("dns is required when serviceDiscovery is dns")
+		}
+		if err := sps.DNS.Validate(); err != nil {
+			return fmt.Errorf("dns: %v", err)
+		}
+	case ServiceDiscoveryKubernetes:
+		if sps.Kubernetes == nil {
+			return fmt.Errorf("kubernetes is required when serviceDiscovery is kubernetes")
+		}
+		if err := sps.Kubernetes.Validate(); err != nil {
+			return fmt.Errorf("kubernetes: %v", err)
+		}
+	default:
+		if sps.ServiceName == "" && len(sps.Servers) == 0 {
+			return fmt.Errorf("both serviceName and servers are empty")
+		}
 	}
 
 	serversGotWeight := 0
@@ -218,6 +270,33 @@ func (sps *ServerPoolSpec) Validate() error {
 		return fmt.Errorf(msgFmt, serversGotWeight, len(sps.Servers))
 	}
 
+	if sps.Retry != nil {
+		if sps.RetryPolicy != "" {
+			return fmt.Errorf("retry and retryPolicy are mutually exclusive")
+		}
+		if err := sps.Retry.Validate(); err != nil {
+			return fmt.Errorf("retry: %v", err)
+		}
+	}
+
+	if sps.OutlierDetection != nil {
+		if err := sps.OutlierDetection.Validate(); err != nil {
+			return fmt.Errorf("outlierDetection: %v", err)
+		}
+	}
+
+	if sps.BodyBuffer != nil {
+		if err := sps.BodyBuffer.Validate(); err != nil {
+			return fmt.Errorf("bodyBuffer: %v", err)
+		}
+	}
+
+	if sps.TLS != nil {
+		if err := sps.TLS.Validate(); err != nil {
+			return fmt.Errorf("tls: %v", err)
+		}
+	}
+
 	return nil
 }
 
@@ -231,6 +310,12 @@ func NewServerPool(proxy *Proxy, spec *ServerPoolSpec, name string) *ServerPool
 		httpStat: httpstat.New(),
 	}
 
+	pipeline, filter := "", ""
+	if proxy != nil && proxy.spec != nil {
+		pipeline, filter = proxy.spec.Pipeline(), proxy.spec.Name()
+	}
+	sp.metrics = newMetrics(pipeline, filter, strings.TrimPrefix(name, "proxy#"+filter+"#"))
+
 	if spec.Filter != nil {
 		sp.filter = NewRequestMatcher(spec.Filter)
 	}
@@ -239,15 +324,49 @@ func NewServerPool(proxy *Proxy, spec *ServerPoolSpec, name string) *ServerPool
 		sp.memoryCache = NewMemoryCache(spec.MemoryCache)
 	}
 
-	if spec.ServiceRegistry == "" || spec.ServiceName == "" {
+	// the outlier detector must be ready before the load balancer is
+	// created, as it tracks the servers of the load balancer.
+	if spec.OutlierDetection != nil {
+		sp.outlierDetector = newOutlierDetector(spec.OutlierDetection)
+	}
+
+	switch {
+	case spec.ServiceDiscovery == ServiceDiscoveryDNS:
+		sp.watchDNS()
+	case spec.ServiceDiscovery == ServiceDiscoveryKubernetes:
+		sp.watchKubernetes()
+	case spec.ServiceRegistry == "" || spec.ServiceName == "":
 		sp.createLoadBalancer(sp.spec.Servers)
-	} else {
+	default:
 		sp.watchServers()
 	}
 
 	if spec.Timeout != "" {
 		sp.timeout, _ = time.ParseDuration(spec.Timeout)
 	}
+	for _, to := range spec.TimeoutOverrides {
+		to.init()
+	}
+
+	if spec.Retry != nil {
+		sp.retryer = newRetryer(spec.Retry)
+	}
+
+	if spec.TLS != nil {
+		tlsCfg, err := spec.TLS.tlsConfig()
+		if err != nil {
+			logger.Errorf("%s: create tls config failed: %v", name, err)
+		} else {
+			sp.client = proxy.newHTTPClient(tlsCfg)
+		}
+	} else if spec.ServiceRegistry != "" && spec.ServiceName != "" {
+		// use the mTLS of the service mesh if the registry provides it.
+		entity := proxy.super.MustGetSystemController(serviceregistry.Kind)
+		registry := entity.Instance().(*serviceregistry.ServiceRegistry)
+		if tlsCfg := registry.ClientTLSConfig(spec.ServiceRegistry, spec.ServiceName); tlsCfg != nil {
+			sp.client = proxy.newHTTPClient(tlsCfg)
+		}
+	}
 
 	sp.failureCodes = map[int]struct{}{}
 	for _, code := range spec.FailureCodes {
@@ -257,6 +376,14 @@ func NewServerPool(proxy *Proxy, spec *ServerPoolSpec, name string) *ServerPool
 	return sp
 }
 
+// httpClient returns the HTTP client to send requests to the servers.
+func (sp *ServerPool) httpClient() *http.Client {
+	if sp.client != nil {
+		return sp.client
+	}
+	return sp.proxy.client
+}
+
 // LoadBalancer returns the load balancer of the server pool.
 func (sp *ServerPool) LoadBalancer() LoadBalancer {
 	return sp.loadBalancer.Load().(LoadBalancer)
@@ -273,7 +400,11 @@ func (sp *ServerPool) createLoadBalancer(servers []*Server) {
 	}
 
 	lb := NewLoadBalancer(spec, servers)
+	if sp.outlierDetector != nil {
+		sp.outlierDetector.setServers(servers)
+	}
 	sp.loadBalancer.Store(lb)
+	sp.metrics.setServers(len(servers))
 }
 
 func (sp *ServerPool) watchServers() {
@@ -338,6 +469,12 @@ func (sp *ServerPool) useService(instances map[string]*serviceregistry.ServiceIn
 
 func (sp *ServerPool) status() *ServerPoolStatus {
 	s := &ServerPoolStatus{Stat: sp.httpStat.Status()}
+	if w, ok := sp.circuitBreakerWrapper.(*resilience.CircuitBreakerWrapper); ok {
+		s.CircuitBreaker = w.Status()
+	}
+	if sp.outlierDetector != nil {
+		s.EjectedServers = sp.outlierDetector.ejectedServers()
+	}
 	return s
 }
 
@@ -366,8 +503,56 @@ func (sp *ServerPool) InjectResiliencePolicy(policies map[string]resilience.Poli
 		if !ok {
 			panic(fmt.Errorf("policy %s is not a circuitBreaker policy", name))
 		}
-		sp.circuitBreakerWrapper = policy.CreateWrapper()
+		w := policy.CreateWrapper()
+		if cbw, ok := w.(*resilience.CircuitBreakerWrapper); ok {
+			cbw.SetProber(sp.sendProbe)
+		}
+		sp.circuitBreakerWrapper = w
+	}
+}
+
+// sendProbe sends a probe request of the circuit breaker to one of the
+// servers, the probe fails if the request fails or the status code of
+// the response is 5xx or one of the failure codes.
+func (sp *ServerPool) sendProbe(ctx stdcontext.Context, probe *resilience.CircuitBreakerProbe) error {
+	method := probe.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	stdReq, err := http.NewRequestWithContext(ctx, method, "http://probe"+probe.Path, strings.NewReader(probe.Body))
+	if err != nil {
+		return err
 	}
+	for k, v := range probe.Headers {
+		stdReq.Header.Set(k, v)
+	}
+
+	// the request is also used by the load balancer to choose a server.
+	req, _ := httpprot.NewRequest(stdReq)
+	svr := sp.LoadBalancer().ChooseServer(req)
+	if svr == nil {
+		return fmt.Errorf("no available server")
+	}
+
+	u, err := url.Parse(svr.URL + probe.Path)
+	if err != nil {
+		return err
+	}
+	stdReq.URL = u
+	stdReq.Host = u.Host
+
+	resp, err := sp.httpClient().Do(stdReq)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if _, ok := sp.failureCodes[resp.StatusCode]; ok || resp.StatusCode >= 500 {
+		return fmt.Errorf("probe failed with status code %d", resp.StatusCode)
+	}
+	return nil
 }
 
 func (sp *ServerPool) collectMetrics(spCtx *serverPoolContext) {
@@ -381,6 +566,7 @@ func (sp *ServerPool) collectMetrics(spCtx *serverPoolContext) {
 	collect := func() {
 		metric.Duration = fasttime.Since(spCtx.startTime)
 		sp.httpStat.Stat(metric)
+		sp.metrics.stat(metric, sp.circuitBreakerWrapper)
 		spCtx.LazyAddTag(func() string {
 			return sp.name + "#duration: " + metric.Duration.String()
 		})
@@ -410,36 +596,36 @@ func (sp *ServerPool) collectMetrics(spCtx *serverPoolContext) {
 	})
 }
 
-func (sp *ServerPool) handleMirror(spCtx *serverPoolContext) {
-	svr := sp.LoadBalancer().ChooseServer(spCtx.req)
-	if svr == nil {
-		return
+// bufferBody buffers the stream request body if the server pool is
+// configured to do so. The result is not empty if it fails.
+func (sp *ServerPool) bufferBody(ctx *context.Context, req *httpprot.Request) (*spooledBody, string) {
+	if sp.spec.BodyBuffer == nil {
+		return nil, ""
 	}
 
-	err := spCtx.prepareRequest(svr, spCtx.req.Context(), true)
-	if err != nil {
-		logger.Debugf("%s: failed to prepare request: %v", sp.name, err)
-		return
+	body, err := bufferBody(sp.spec.BodyBuffer, req)
+	if err == nil {
+		if body != nil {
+			ctx.OnFinish(body.release)
+		}
+		return body, ""
 	}
 
-	resp, err := fnSendRequest(spCtx.stdReq, sp.proxy.client)
-	if err != nil {
-		return
+	logger.Debugf("%s: failed to buffer request body: %v", sp.name, err)
+	spCtx := &serverPoolContext{Context: ctx, req: req}
+	if err == httpprot.ErrRequestEntityTooLarge {
+		sp.buildFailureResponse(spCtx, http.StatusRequestEntityTooLarge)
+	} else {
+		sp.buildFailureResponse(spCtx, http.StatusBadRequest)
 	}
-
-	io.Copy(io.Discard, resp.Body)
-	resp.Body.Close()
+	return nil, resultClientError
 }
 
-func (sp *ServerPool) handle(ctx *context.Context, mirror bool) string {
+func (sp *ServerPool) handle(ctx *context.Context, body *spooledBody) string {
 	spCtx := &serverPoolContext{
 		Context: ctx,
 		req:     ctx.GetInputRequest().(*httpprot.Request),
-	}
-
-	if mirror {
-		sp.handleMirror(spCtx)
-		return ""
+		body:    body,
 	}
 
 	spCtx.startTime = fasttime.Now()
@@ -454,10 +640,11 @@ func (sp *ServerPool) handle(ctx *context.Context, mirror bool) string {
 
 	// wrap the handler function to meet the requirement of resilience
 	// wrappers.
+	timeout := sp.timeoutOf(spCtx.req)
 	handler := func(stdctx stdcontext.Context) error {
-		if sp.timeout > 0 {
+		if timeout > 0 {
 			var cancel stdcontext.CancelFunc
-			stdctx, cancel = stdcontext.WithTimeout(stdctx, sp.timeout)
+			stdctx, cancel = stdcontext.WithTimeout(stdctx, timeout)
 			defer cancel()
 		}
 
@@ -480,7 +667,9 @@ func (sp *ServerPool) handle(ctx *context.Context, mirror bool) string {
 
 	// resilience wrappers, note that it is impossible to retry a stream
 	// request as its body can only be read once.
-	if sp.retryWrapper != nil && !spCtx.req.IsStream() {
+	if sp.retryer != nil && sp.retryer.canRetry(spCtx) {
+		handler = sp.retryer.wrap(spCtx, handler)
+	} else if sp.retryWrapper != nil && spCtx.replayable() {
 		handler = sp.retryWrapper.Wrap(handler)
 	}
 	if sp.circuitBreakerWrapper != nil {
@@ -515,14 +704,24 @@ func (sp *ServerPool) handle(ctx *context.Context, mirror bool) string {
 	panic(fmt.Errorf("should not reach here"))
 }
 
+// chooseServer chooses a server from the load balancer, skipping the
+// servers ejected by the outlier detector.
+func (sp *ServerPool) chooseServer(req *httpprot.Request) *Server {
+	if sp.outlierDetector != nil {
+		return sp.outlierDetector.chooseServer(sp.LoadBalancer(), req)
+	}
+	return sp.LoadBalancer().ChooseServer(req)
+}
+
 func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolContext) error {
-	svr := sp.LoadBalancer().ChooseServer(spCtx.req)
+	svr := sp.chooseServer(spCtx.req)
 
 	// if there's no available server.
 	if svr == nil {
 		logger.Debugf("%s: no available server", sp.name)
 		return serverPoolError{http.StatusServiceUnavailable, resultInternalError}
 	}
+	spCtx.SetData(accesslog.DataUpstreamAddr, svr.URL)
 
 	// prepare the request to send.
 	statResult := &gohttpstat.Result{}
@@ -531,8 +730,9 @@ func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolConte
 		logger.Debugf("%s: failed to prepare request: %v", sp.name, err)
 		return serverPoolError{http.StatusInternalServerError, resultInternalError}
 	}
+	sp.setDeadlineHeaders(stdctx, spCtx.stdReq)
 
-	resp, err := fnSendRequest(spCtx.stdReq, sp.proxy.client)
+	resp, err := fnSendRequest(spCtx.stdReq, sp.httpClient())
 	if err != nil {
 		logger.Debugf("%s: failed to send request: %v", sp.name, err)
 
@@ -542,8 +742,10 @@ func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolConte
 		})
 
 		if err := spCtx.stdReq.Context().Err(); err == nil {
+			sp.recordOutlier(svr, true)
 			return serverPoolError{http.StatusServiceUnavailable, resultServerError}
 		} else if err == stdcontext.DeadlineExceeded {
+			sp.recordOutlier(svr, true)
 			return serverPoolError{http.StatusRequestTimeout, resultTimeout}
 		}
 
@@ -552,11 +754,18 @@ func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolConte
 		return serverPoolError{499, resultClientError}
 	}
 
+	_, isFailureCode := sp.failureCodes[resp.StatusCode]
+	sp.recordOutlier(svr, isFailureCode || resp.StatusCode >= 500)
+
 	spCtx.stdResp = resp
 	if err = sp.buildResponse(spCtx); err != nil {
 		return serverPoolError{http.StatusInternalServerError, resultInternalError}
 	}
 
+	if lb, ok := sp.LoadBalancer().(*stickySessionLoadBalancer); ok {
+		lb.setCookie(spCtx.req, spCtx.resp, svr)
+	}
+
 	spCtx.LazyAddTag(func() string {
 		return fmt.Sprintf("status code: %d", resp.StatusCode)
 	})
@@ -566,13 +775,20 @@ func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolConte
 	//
 	// This may be incorrect, but failure code is different from other
 	// errors, and it seems impossible to find a perfect solution.
-	if _, ok := sp.failureCodes[resp.StatusCode]; ok {
+	if isFailureCode {
 		return serverPoolError{resp.StatusCode, resultFailureCode}
 	}
 
 	return nil
 }
 
+// recordOutlier records the result of a request to the outlier detector.
+func (sp *ServerPool) recordOutlier(svr *Server, failed bool) {
+	if sp.outlierDetector != nil {
+		sp.outlierDetector.record(svr, failed)
+	}
+}
+
 func (sp *ServerPool) mergeResponseHeader(dst, src http.Header) http.Header {
 	for k, v := range src {
 		// CORS Headers
@@ -700,4 +916,14 @@ func (sp *ServerPool) buildFailureResponse(spCtx *serverPoolContext, statusCode
 func (sp *ServerPool) close() {
 	close(sp.done)
 	sp.wg.Wait()
+
+	if w, ok := sp.circuitBreakerWrapper.(*resilience.CircuitBreakerWrapper); ok {
+		w.Close()
+	}
+
+	sp.metrics.close()
+
+	if sp.client != nil {
+		sp.client.CloseIdleConnections()
+	}
 }
@@ -33,6 +33,7 @@ import (
 	"github.com/megaease/easegress/pkg/resilience"
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/util/easemonitor"
+	"github.com/megaease/easegress/pkg/util/spiffe"
 )
 
 const (
@@ -94,6 +95,8 @@ type (
 		mainPool       *ServerPool
 		candidatePools []*ServerPool
 		mirrorPool     *ServerPool
+		mirror         *mirrorer
+		blueGreen      *blueGreen
 
 		client *http.Client
 
@@ -104,10 +107,13 @@ type (
 	Spec struct {
 		filters.BaseSpec `json:",inline"`
 
-		Pools               []*ServerPoolSpec `json:"pools" jsonschema:"required"`
+		Pools               []*ServerPoolSpec `json:"pools" jsonschema:"omitempty"`
+		BlueGreen           *BlueGreenSpec    `json:"blueGreen,omitempty" jsonschema:"omitempty"`
 		MirrorPool          *ServerPoolSpec   `json:"mirrorPool,omitempty" jsonschema:"omitempty"`
+		Mirror              *MirrorSpec       `json:"mirror,omitempty" jsonschema:"omitempty"`
 		Compression         *CompressionSpec  `json:"compression,omitempty" jsonschema:"omitempty"`
 		MTLS                *MTLS             `json:"mtls,omitempty" jsonschema:"omitempty"`
+		SPIFFE              *spiffe.Spec      `json:"spiffe,omitempty" jsonschema:"omitempty"`
 		MaxIdleConns        int               `json:"maxIdleConns" jsonschema:"omitempty"`
 		MaxIdleConnsPerHost int               `json:"maxIdleConnsPerHost" jsonschema:"omitempty"`
 		ServerMaxBodySize   int64             `json:"serverMaxBodySize" jsonschema:"omitempty"`
@@ -115,9 +121,11 @@ type (
 
 	// Status is the status of Proxy.
 	Status struct {
-		MainPool       *ServerPoolStatus   `json:"mainPool"`
+		MainPool       *ServerPoolStatus   `json:"mainPool,omitempty"`
+		BlueGreen      *BlueGreenStatus    `json:"blueGreen,omitempty"`
 		CandidatePools []*ServerPoolStatus `json:"candidatePools,omitempty"`
 		MirrorPool     *ServerPoolStatus   `json:"mirrorPool,omitempty"`
+		Mirror         *MirrorStatus       `json:"mirror,omitempty"`
 	}
 
 	// MTLS is the configuration for client side mTLS.
@@ -140,7 +148,15 @@ func (s *Spec) Validate() error {
 		}
 	}
 
-	if numMainPool != 1 {
+	// the blue and green pools take the place of the main pool.
+	if s.BlueGreen != nil {
+		if numMainPool != 0 {
+			return fmt.Errorf("mainPool must be empty when blueGreen is specified")
+		}
+		if err := s.BlueGreen.Validate(); err != nil {
+			return fmt.Errorf("blueGreen: %v", err)
+		}
+	} else if numMainPool != 1 {
 		return fmt.Errorf("one and only one mainPool is required")
 	}
 
@@ -153,6 +169,21 @@ func (s *Spec) Validate() error {
 		}
 	}
 
+	if s.Mirror != nil {
+		if err := s.Mirror.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if s.SPIFFE != nil {
+		if s.MTLS != nil {
+			return fmt.Errorf("mtls and spiffe are mutually exclusive")
+		}
+		if err := s.SPIFFE.Validate(); err != nil {
+			return fmt.Errorf("spiffe: %v", err)
+		}
+	}
+
 	return nil
 }
 
@@ -182,6 +213,10 @@ func (p *Proxy) Inherit(previousGeneration filters.Filter) {
 }
 
 func (p *Proxy) tlsConfig() (*tls.Config, error) {
+	if p.spec.SPIFFE != nil {
+		return p.spec.SPIFFE.ClientTLSConfig(), nil
+	}
+
 	mtls := p.spec.MTLS
 
 	if mtls == nil {
@@ -225,9 +260,26 @@ func (p *Proxy) reload() {
 		}
 	}
 
+	if p.spec.BlueGreen != nil {
+		p.blueGreen = newBlueGreen(p, p.spec.BlueGreen)
+	}
+
+	if p.spec.MirrorPool != nil || p.spec.Mirror != nil {
+		p.mirror = newMirrorer(p, p.spec.Mirror)
+	}
+
 	if p.spec.MirrorPool != nil {
 		name := fmt.Sprintf("proxy#%s#mirror", p.Name())
 		p.mirrorPool = NewServerPool(p, p.spec.MirrorPool, name)
+		p.mirror.addPool(p.mirrorPool, 100, nil)
+	}
+
+	if p.spec.Mirror != nil {
+		for i, spec := range p.spec.Mirror.Pools {
+			name := fmt.Sprintf("proxy#%s#mirror#%d", p.Name(), i)
+			pool := NewServerPool(p, &spec.ServerPoolSpec, name)
+			p.mirror.addPool(pool, spec.SamplePercent, spec.Header)
+		}
 	}
 
 	if p.spec.Compression != nil {
@@ -235,7 +287,11 @@ func (p *Proxy) reload() {
 	}
 
 	tlsCfg, _ := p.tlsConfig()
-	p.client = &http.Client{
+	p.client = p.newHTTPClient(tlsCfg)
+}
+
+func (p *Proxy) newHTTPClient(tlsCfg *tls.Config) *http.Client {
+	return &http.Client{
 		// NOTE: Timeout could be no limit, real client or server could cancel it.
 		Timeout: 0,
 		Transport: &http.Transport{
@@ -263,8 +319,14 @@ func (p *Proxy) reload() {
 
 // Status returns Proxy status.
 func (p *Proxy) Status() interface{} {
-	s := &Status{
-		MainPool: p.mainPool.status(),
+	s := &Status{}
+
+	if p.mainPool != nil {
+		s.MainPool = p.mainPool.status()
+	}
+
+	if p.blueGreen != nil {
+		s.BlueGreen = p.blueGreen.status()
 	}
 
 	for _, pool := range p.candidatePools {
@@ -275,19 +337,29 @@ func (p *Proxy) Status() interface{} {
 		s.MirrorPool = p.mirrorPool.status()
 	}
 
+	if p.mirror != nil {
+		s.Mirror = p.mirror.status()
+	}
+
 	return s
 }
 
 // Close closes Proxy.
 func (p *Proxy) Close() {
-	p.mainPool.close()
+	if p.mainPool != nil {
+		p.mainPool.close()
+	}
+
+	if p.blueGreen != nil {
+		p.blueGreen.close()
+	}
 
 	for _, v := range p.candidatePools {
 		v.close()
 	}
 
-	if p.mirrorPool != nil {
-		p.mirrorPool.close()
+	if p.mirror != nil {
+		p.mirror.close()
 	}
 }
 
@@ -295,11 +367,10 @@ func (p *Proxy) Close() {
 func (p *Proxy) Handle(ctx *context.Context) (result string) {
 	req := ctx.GetInputRequest().(*httpprot.Request)
 
-	if p.mirrorPool != nil && p.mirrorPool.filter.Match(req) {
-		go p.mirrorPool.handle(ctx, true)
-	}
-
 	sp := p.mainPool
+	if p.blueGreen != nil {
+		sp = p.blueGreen.choosePool(req)
+	}
 	for _, v := range p.candidatePools {
 		if v.filter.Match(req) {
 			sp = v
@@ -307,12 +378,28 @@ func (p *Proxy) Handle(ctx *context.Context) (result string) {
 		}
 	}
 
-	return sp.handle(ctx, false)
+	body, result := sp.bufferBody(ctx, req)
+	if result != "" {
+		return result
+	}
+
+	if p.mirror != nil {
+		p.mirror.mirror(req, body)
+	}
+
+	return sp.handle(ctx, body)
 }
 
 // InjectResiliencePolicy injects resilience policies to the proxy.
 func (p *Proxy) InjectResiliencePolicy(policies map[string]resilience.Policy) {
-	p.mainPool.InjectResiliencePolicy(policies)
+	if p.mainPool != nil {
+		p.mainPool.InjectResiliencePolicy(policies)
+	}
+
+	if p.blueGreen != nil {
+		p.blueGreen.blue.InjectResiliencePolicy(policies)
+		p.blueGreen.green.InjectResiliencePolicy(policies)
+	}
 
 	for _, sp := range p.candidatePools {
 		sp.InjectResiliencePolicy(policies)
@@ -328,6 +415,11 @@ func (s *Status) ToMetrics(service string) []*easemonitor.Metrics {
 		results = append(results, s.MainPool.Stat.ToMetrics(svc)...)
 	}
 
+	if s.BlueGreen != nil {
+		results = append(results, s.BlueGreen.Blue.Stat.ToMetrics(service+"/blue")...)
+		results = append(results, s.BlueGreen.Green.Stat.ToMetrics(service+"/green")...)
+	}
+
 	for i := range s.CandidatePools {
 		svc := fmt.Sprintf("%s/candidatePool/%d", service, i)
 		p := s.CandidatePools[i]
@@ -339,6 +431,13 @@ func (s *Status) ToMetrics(service string) []*easemonitor.Metrics {
 		results = append(results, s.MirrorPool.Stat.ToMetrics(svc)...)
 	}
 
+	if s.Mirror != nil {
+		for i, p := range s.Mirror.Pools {
+			svc := fmt.Sprintf("%s/mirror/%d", service, i)
+			results = append(results, p.Stat.ToMetrics(svc)...)
+		}
+	}
+
 	for _, m := range results {
 		m.Resource = "PROXY"
 	}
@@ -311,6 +311,28 @@ mirrorPool:
 	err = codectool.Unmarshal([]byte(yamlConfig), spec)
 	assert.NoError(err)
 	assert.Error(spec.Validate())
+
+	// spiffe: mutually exclusive with mtls
+	yamlConfig = `
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: https://127.0.0.1:9095
+spiffe:
+  allowedIDs: ["spiffe://megaease.com/backend"]
+`
+	spec = &Spec{}
+	err = codectool.Unmarshal([]byte(yamlConfig), spec)
+	assert.NoError(err)
+	assert.NoError(spec.Validate())
+
+	spec.MTLS = &MTLS{}
+	assert.Error(spec.Validate())
+
+	spec.MTLS = nil
+	spec.SPIFFE.AllowedIDs = []string{"megaease.com/backend"}
+	assert.Error(spec.Validate())
 }
 
 func TestTLSConfig(t *testing.T) {
@@ -0,0 +1,500 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jmespath/go-jmespath"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/resilience"
+	"github.com/megaease/easegress/pkg/util/accesslog"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+const (
+	// DefaultRetriedHeader is the header added to responses which were
+	// produced after at least one retry, its value is the number of retries.
+	DefaultRetriedHeader = "X-Eg-Retried"
+
+	retryOnServerError = "serverError"
+	retryOnTimeout     = "timeout"
+
+	retryBudgetBuckets = 10
+
+	defaultMaxRetryAfter = 10 * time.Second
+
+	// maxDrainSize is the maximum number of bytes read from a discarded
+	// stream response, the connection is not reused if the remaining
+	// body is larger than this.
+	maxDrainSize = 64 * 1024
+)
+
+var idempotentMethods = map[string]struct{}{
+	http.MethodGet:     {},
+	http.MethodHead:    {},
+	http.MethodPut:     {},
+	http.MethodDelete:  {},
+	http.MethodOptions: {},
+	http.MethodTrace:   {},
+}
+
+type (
+	// RetrySpec describes the retry policy of a server pool. Different
+	// from the retry resilience policy, it is aware of the HTTP semantics
+	// of the request and the response.
+	RetrySpec struct {
+		MaxAttempts   int      `json:"maxAttempts" jsonschema:"omitempty,minimum=1"`
+		RetryOnCodes  []int    `json:"retryOnCodes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
+		RetryOnErrors []string `json:"retryOnErrors" jsonschema:"omitempty,uniqueItems=true"`
+		PerTryTimeout string   `json:"perTryTimeout" jsonschema:"omitempty,format=duration"`
+		BaseInterval  string   `json:"baseInterval" jsonschema:"omitempty,format=duration"`
+		MaxInterval   string   `json:"maxInterval" jsonschema:"omitempty,format=duration"`
+		// BudgetPercent limits retries to a percentage of the requests
+		// handled in the last 10 seconds, 0 means no limit.
+		BudgetPercent float64 `json:"budgetPercent" jsonschema:"omitempty,minimum=0,maximum=100"`
+		// MinRetriesPerSecond is the number of retries always allowed per
+		// second regardless of the budget, it keeps retries working when
+		// the traffic is low.
+		MinRetriesPerSecond int    `json:"minRetriesPerSecond" jsonschema:"omitempty,minimum=0"`
+		RetryNonIdempotent  bool   `json:"retryNonIdempotent" jsonschema:"omitempty"`
+		RetriedHeader       string `json:"retriedHeader" jsonschema:"omitempty"`
+		// RetryOnBodies retries responses whose body matches any of the
+		// matchers, it is for servers returning transient errors with a
+		// success status code.
+		RetryOnBodies []*RetryBodyMatcher `json:"retryOnBodies,omitempty" jsonschema:"omitempty"`
+		// HonorRetryAfter uses the Retry-After header of the response as
+		// the wait duration before the next attempt, but it never waits
+		// longer than MaxRetryAfter.
+		HonorRetryAfter bool   `json:"honorRetryAfter" jsonschema:"omitempty"`
+		MaxRetryAfter   string `json:"maxRetryAfter" jsonschema:"omitempty,format=duration"`
+	}
+
+	// RetryBodyMatcher matches the body of a response, either by a regular
+	// expression, or by the value of a JSON field selected by a JMESPath
+	// expression.
+	RetryBodyMatcher struct {
+		Regexp   string `json:"regexp" jsonschema:"omitempty,format=regexp"`
+		JMESPath string `json:"jmespath" jsonschema:"omitempty"`
+		// Values are the values of the JSON field to be retried, if empty,
+		// any non-null value is retried.
+		Values []string `json:"values" jsonschema:"omitempty"`
+
+		re   *regexp.Regexp
+		expr *jmespath.JMESPath
+	}
+
+	retryer struct {
+		spec          *RetrySpec
+		codes         map[int]struct{}
+		errors        map[string]struct{}
+		perTryTimeout time.Duration
+		baseInterval  time.Duration
+		maxInterval   time.Duration
+		maxRetryAfter time.Duration
+		budget        *retryBudget
+	}
+
+	// retryBudget counts requests and retries in a rolling window of
+	// one second buckets.
+	retryBudget struct {
+		lock     sync.Mutex
+		percent  float64
+		minRetry int
+		buckets  [retryBudgetBuckets]retryBudgetBucket
+	}
+
+	retryBudgetBucket struct {
+		second   int64
+		requests int
+		retries  int
+	}
+)
+
+// Validate validates RetrySpec.
+func (s *RetrySpec) Validate() error {
+	for _, e := range s.RetryOnErrors {
+		if e != retryOnServerError && e != retryOnTimeout {
+			return fmt.Errorf("unknown retry on error: %s", e)
+		}
+	}
+
+	if s.BaseInterval != "" && s.MaxInterval != "" {
+		base, _ := time.ParseDuration(s.BaseInterval)
+		max, _ := time.ParseDuration(s.MaxInterval)
+		if max < base {
+			return fmt.Errorf("maxInterval must not be less than baseInterval")
+		}
+	}
+
+	if s.MaxRetryAfter != "" && !s.HonorRetryAfter {
+		return fmt.Errorf("maxRetryAfter requires honorRetryAfter to be true")
+	}
+
+	return nil
+}
+
+// Validate validates RetryBodyMatcher.
+func (m *RetryBodyMatcher) Validate() error {
+	if (m.Regexp == "") == (m.JMESPath == "") {
+		return fmt.Errorf("one and only one of regexp and jmespath must be specified")
+	}
+
+	if m.Regexp != "" {
+		if len(m.Values) > 0 {
+			return fmt.Errorf("values is only allowed for jmespath")
+		}
+		return nil
+	}
+
+	if _, err := jmespath.Compile(m.JMESPath); err != nil {
+		return fmt.Errorf("invalid jmespath %q: %v", m.JMESPath, err)
+	}
+	return nil
+}
+
+func (m *RetryBodyMatcher) init() {
+	// the matcher has been validated, so no error here.
+	if m.Regexp != "" {
+		m.re = regexp.MustCompile(m.Regexp)
+	} else {
+		m.expr, _ = jmespath.Compile(m.JMESPath)
+	}
+}
+
+// match checks whether the body matches, data is the decoded JSON body,
+// it is decoded on demand.
+func (m *RetryBodyMatcher) match(body []byte, data *interface{}) bool {
+	if m.re != nil {
+		return m.re.Match(body)
+	}
+
+	if *data == nil {
+		if err := json.Unmarshal(body, data); err != nil || *data == nil {
+			return false
+		}
+	}
+
+	v, err := m.expr.Search(*data)
+	if err != nil || v == nil {
+		return false
+	}
+	if len(m.Values) == 0 {
+		return true
+	}
+
+	var str string
+	if s, ok := v.(string); ok {
+		str = s
+	} else {
+		str = fmt.Sprint(v)
+	}
+	for _, value := range m.Values {
+		if value == str {
+			return true
+		}
+	}
+	return false
+}
+
+func newRetryer(spec *RetrySpec) *retryer {
+	r := &retryer{
+		spec:   spec,
+		codes:  map[int]struct{}{},
+		errors: map[string]struct{}{},
+	}
+
+	for _, code := range spec.RetryOnCodes {
+		r.codes[code] = struct{}{}
+	}
+
+	// retry on server errors by default, including connection failures.
+	if len(spec.RetryOnErrors) == 0 && len(spec.RetryOnCodes) == 0 {
+		r.errors[retryOnServerError] = struct{}{}
+	}
+	for _, e := range spec.RetryOnErrors {
+		r.errors[e] = struct{}{}
+	}
+
+	if spec.PerTryTimeout != "" {
+		r.perTryTimeout, _ = time.ParseDuration(spec.PerTryTimeout)
+	}
+
+	r.baseInterval = 25 * time.Millisecond
+	if spec.BaseInterval != "" {
+		r.baseInterval, _ = time.ParseDuration(spec.BaseInterval)
+	}
+
+	r.maxInterval = 10 * r.baseInterval
+	if spec.MaxInterval != "" {
+		r.maxInterval, _ = time.ParseDuration(spec.MaxInterval)
+	}
+
+	r.maxRetryAfter = defaultMaxRetryAfter
+	if spec.MaxRetryAfter != "" {
+		r.maxRetryAfter, _ = time.ParseDuration(spec.MaxRetryAfter)
+	}
+
+	for _, m := range spec.RetryOnBodies {
+		m.init()
+	}
+
+	if spec.BudgetPercent > 0 {
+		r.budget = &retryBudget{
+			percent:  spec.BudgetPercent,
+			minRetry: spec.MinRetriesPerSecond,
+		}
+	}
+
+	return r
+}
+
+func (r *retryer) maxAttempts() int {
+	if r.spec.MaxAttempts <= 0 {
+		return 2
+	}
+	return r.spec.MaxAttempts
+}
+
+func (r *retryer) retriedHeader() string {
+	if r.spec.RetriedHeader == "" {
+		return DefaultRetriedHeader
+	}
+	return r.spec.RetriedHeader
+}
+
+// canRetry returns whether the request is allowed to be retried.
+func (r *retryer) canRetry(spCtx *serverPoolContext) bool {
+	if !spCtx.replayable() {
+		return false
+	}
+	if r.spec.RetryNonIdempotent {
+		return true
+	}
+	_, ok := idempotentMethods[spCtx.req.Method()]
+	return ok
+}
+
+// shouldRetry checks the result of the last attempt.
+func (r *retryer) shouldRetry(spCtx *serverPoolContext, err error) bool {
+	// the response is available on success and on failure codes.
+	if spCtx.resp != nil {
+		if _, ok := r.codes[spCtx.resp.StatusCode()]; ok {
+			return true
+		}
+		return r.matchBody(spCtx.resp)
+	}
+
+	spe, ok := err.(serverPoolError)
+	if !ok {
+		return false
+	}
+
+	switch spe.result {
+	case resultServerError:
+		_, ok = r.errors[retryOnServerError]
+	case resultTimeout:
+		_, ok = r.errors[retryOnTimeout]
+	default:
+		ok = false
+	}
+	return ok
+}
+
+// matchBody checks whether the body of the response matches any of the
+// body matchers, stream bodies are never matched.
+func (r *retryer) matchBody(resp *httpprot.Response) bool {
+	if len(r.spec.RetryOnBodies) == 0 || resp.IsStream() {
+		return false
+	}
+
+	body := resp.RawPayload()
+	var data interface{}
+	for _, m := range r.spec.RetryOnBodies {
+		if m.match(body, &data) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryAfter returns the wait duration specified by the Retry-After
+// header of the response, which is either a number of seconds or an
+// HTTP date. The result is capped by maxRetryAfter, and false is returned
+// if the header is absent or invalid.
+func (r *retryer) retryAfter(resp *httpprot.Response) (time.Duration, bool) {
+	if !r.spec.HonorRetryAfter || resp == nil {
+		return 0, false
+	}
+
+	value := resp.HTTPHeader().Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	var d time.Duration
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		d = time.Duration(seconds) * time.Second
+		// overflow
+		if d/time.Second != time.Duration(seconds) {
+			d = r.maxRetryAfter
+		}
+	} else if t, err := http.ParseTime(value); err == nil {
+		d = time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+	} else {
+		return 0, false
+	}
+
+	if d > r.maxRetryAfter {
+		d = r.maxRetryAfter
+	}
+	return d, true
+}
+
+// backoff returns the wait duration before the next attempt, it is an
+// exponential backoff with full jitter.
+func (r *retryer) backoff(attempt int) time.Duration {
+	d := r.baseInterval << uint(attempt)
+	if d <= 0 || d > r.maxInterval {
+		d = r.maxInterval
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// wrap wraps the handler with the retry logic.
+func (r *retryer) wrap(spCtx *serverPoolContext, handler resilience.HandlerFunc) resilience.HandlerFunc {
+	return func(ctx stdcontext.Context) error {
+		if r.budget != nil {
+			r.budget.addRequest()
+		}
+
+		var err error
+		attempt := 0
+		for {
+			err = r.try(ctx, handler)
+			if attempt+1 >= r.maxAttempts() || !r.shouldRetry(spCtx, err) {
+				break
+			}
+			if r.budget != nil && !r.budget.acquireRetry() {
+				spCtx.AddTag("retry budget exhausted")
+				break
+			}
+
+			wait, ok := r.retryAfter(spCtx.resp)
+			if !ok {
+				wait = r.backoff(attempt)
+			}
+
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(wait):
+			}
+			r.discard(spCtx)
+			attempt++
+		}
+
+		if attempt > 0 {
+			spCtx.SetData(accesslog.DataRetryCount, attempt)
+		}
+		if attempt > 0 && spCtx.resp != nil {
+			spCtx.resp.HTTPHeader().Set(r.retriedHeader(), strconv.Itoa(attempt))
+		}
+		return err
+	}
+}
+
+// discard drains and closes the response of the last attempt, so that the
+// upstream connection can be reused by the next attempt.
+func (r *retryer) discard(spCtx *serverPoolContext) {
+	resp := spCtx.resp
+	if resp == nil {
+		return
+	}
+	if resp.IsStream() {
+		io.Copy(io.Discard, io.LimitReader(resp.GetPayload(), maxDrainSize))
+	}
+	resp.Close()
+}
+
+func (r *retryer) try(ctx stdcontext.Context, handler resilience.HandlerFunc) error {
+	if r.perTryTimeout > 0 {
+		var cancel stdcontext.CancelFunc
+		ctx, cancel = stdcontext.WithTimeout(ctx, r.perTryTimeout)
+		defer cancel()
+	}
+	return handler(ctx)
+}
+
+func (b *retryBudget) bucket(now int64) *retryBudgetBucket {
+	bucket := &b.buckets[now%retryBudgetBuckets]
+	if bucket.second != now {
+		*bucket = retryBudgetBucket{second: now}
+	}
+	return bucket
+}
+
+func (b *retryBudget) addRequest() {
+	b.lock.Lock()
+	b.bucket(fasttime.Now().Unix()).requests++
+	b.lock.Unlock()
+}
+
+// acquireRetry returns whether a retry is allowed and records it if true.
+func (b *retryBudget) acquireRetry() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := fasttime.Now().Unix()
+	current := b.bucket(now)
+
+	requests, retries := 0, 0
+	for i := range b.buckets {
+		bucket := &b.buckets[i]
+		if now-bucket.second < retryBudgetBuckets {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+
+	if current.retries < b.minRetry || float64(retries+1) <= float64(requests)*b.percent/100 {
+		current.retries++
+		return true
+	}
+
+	return false
+}
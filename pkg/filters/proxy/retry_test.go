@@ -0,0 +1,292 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRetryTestContext(method string) *serverPoolContext {
+	stdr, _ := http.NewRequest(method, "http://megaease.com/abc", nil)
+	req, _ := httpprot.NewRequest(stdr)
+	req.FetchPayload(0)
+	return &serverPoolContext{
+		Context: context.New(tracing.NoopSpan),
+		req:     req,
+	}
+}
+
+func TestRetrySpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &RetrySpec{RetryOnErrors: []string{"unknown"}}
+	assert.Error(spec.Validate())
+
+	spec = &RetrySpec{BaseInterval: "1s", MaxInterval: "100ms"}
+	assert.Error(spec.Validate())
+
+	spec = &RetrySpec{RetryOnErrors: []string{"timeout"}, BaseInterval: "10ms", MaxInterval: "100ms"}
+	assert.NoError(spec.Validate())
+}
+
+func TestRetryerCanRetry(t *testing.T) {
+	assert := assert.New(t)
+
+	r := newRetryer(&RetrySpec{})
+	assert.True(r.canRetry(newRetryTestContext(http.MethodGet)))
+	assert.False(r.canRetry(newRetryTestContext(http.MethodPost)))
+
+	r = newRetryer(&RetrySpec{RetryNonIdempotent: true})
+	assert.True(r.canRetry(newRetryTestContext(http.MethodPost)))
+}
+
+func TestRetryerWrap(t *testing.T) {
+	assert := assert.New(t)
+
+	r := newRetryer(&RetrySpec{
+		MaxAttempts:  3,
+		RetryOnCodes: []int{503},
+		BaseInterval: "1ms",
+	})
+
+	spCtx := newRetryTestContext(http.MethodGet)
+	calls := 0
+	handler := func(ctx stdcontext.Context) error {
+		calls++
+		spCtx.resp, _ = httpprot.NewResponse(nil)
+		if calls < 3 {
+			spCtx.resp.SetStatusCode(503)
+		}
+		return nil
+	}
+
+	err := r.wrap(spCtx, handler)(stdcontext.Background())
+	assert.NoError(err)
+	assert.Equal(3, calls)
+	assert.Equal("2", spCtx.resp.HTTPHeader().Get(DefaultRetriedHeader))
+
+	// server errors are retried by default.
+	r = newRetryer(&RetrySpec{MaxAttempts: 2, BaseInterval: "1ms"})
+	spCtx = newRetryTestContext(http.MethodGet)
+	calls = 0
+	handler = func(ctx stdcontext.Context) error {
+		calls++
+		return serverPoolError{http.StatusServiceUnavailable, resultServerError}
+	}
+	err = r.wrap(spCtx, handler)(stdcontext.Background())
+	assert.Error(err)
+	assert.Equal(2, calls)
+
+	// timeout is not retried by default.
+	calls = 0
+	handler = func(ctx stdcontext.Context) error {
+		calls++
+		return serverPoolError{http.StatusRequestTimeout, resultTimeout}
+	}
+	r.wrap(spCtx, handler)(stdcontext.Background())
+	assert.Equal(1, calls)
+}
+
+type retryTestBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *retryTestBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestRetryerDiscardResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	r := newRetryer(&RetrySpec{
+		MaxAttempts:  2,
+		RetryOnCodes: []int{503},
+		BaseInterval: "1ms",
+	})
+
+	spCtx := newRetryTestContext(http.MethodGet)
+	var bodies []*retryTestBody
+	handler := func(ctx stdcontext.Context) error {
+		body := &retryTestBody{Reader: strings.NewReader("unavailable")}
+		bodies = append(bodies, body)
+
+		stdr := &http.Response{
+			StatusCode: 503,
+			Header:     http.Header{},
+			Body:       body,
+		}
+		if len(bodies) > 1 {
+			stdr.StatusCode = 200
+		}
+		spCtx.resp, _ = httpprot.NewResponse(stdr)
+		spCtx.resp.FetchPayload(-1)
+		return nil
+	}
+
+	assert.NoError(r.wrap(spCtx, handler)(stdcontext.Background()))
+	assert.Len(bodies, 2)
+
+	// the body of the retried response is drained and closed.
+	assert.True(bodies[0].closed)
+	n, _ := bodies[0].Read(make([]byte, 1))
+	assert.Zero(n)
+
+	// the body of the final response is left to the caller.
+	assert.False(bodies[1].closed)
+	assert.Equal(200, spCtx.resp.StatusCode())
+}
+
+func TestRetryerPerTryTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	r := newRetryer(&RetrySpec{PerTryTimeout: "10ms"})
+	err := r.try(stdcontext.Background(), func(ctx stdcontext.Context) error {
+		_, ok := ctx.Deadline()
+		assert.True(ok)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.Equal(stdcontext.DeadlineExceeded, err)
+}
+
+func TestRetryBudget(t *testing.T) {
+	assert := assert.New(t)
+
+	b := &retryBudget{percent: 50}
+	for i := 0; i < 4; i++ {
+		b.addRequest()
+	}
+	assert.True(b.acquireRetry())
+	assert.True(b.acquireRetry())
+	assert.False(b.acquireRetry())
+
+	b = &retryBudget{percent: 1, minRetry: 1}
+	b.addRequest()
+	assert.True(b.acquireRetry())
+	assert.False(b.acquireRetry())
+}
+
+func TestRetryerBackoff(t *testing.T) {
+	assert := assert.New(t)
+
+	r := newRetryer(&RetrySpec{BaseInterval: "10ms", MaxInterval: "40ms"})
+	for i := 0; i < 10; i++ {
+		assert.LessOrEqual(r.backoff(i), 40*time.Millisecond)
+	}
+}
+
+func TestRetryBodyMatcher(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error((&RetryBodyMatcher{}).Validate())
+	assert.Error((&RetryBodyMatcher{Regexp: "a", JMESPath: "b"}).Validate())
+	assert.Error((&RetryBodyMatcher{Regexp: "a", Values: []string{"b"}}).Validate())
+	assert.Error((&RetryBodyMatcher{JMESPath: "a["}).Validate())
+
+	r := newRetryer(&RetrySpec{
+		RetryOnBodies: []*RetryBodyMatcher{
+			{Regexp: "(?i)try again"},
+			{JMESPath: "error.code", Values: []string{"5001", "BUSY"}},
+		},
+	})
+
+	newResp := func(body string) *httpprot.Response {
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetPayload([]byte(body))
+		return resp
+	}
+
+	assert.True(r.matchBody(newResp("please TRY AGAIN later")))
+	assert.True(r.matchBody(newResp(`{"error": {"code": 5001}}`)))
+	assert.True(r.matchBody(newResp(`{"error": {"code": "BUSY"}}`)))
+	assert.False(r.matchBody(newResp(`{"error": {"code": 4001}}`)))
+	assert.False(r.matchBody(newResp(`not a json`)))
+
+	r = newRetryer(&RetrySpec{
+		RetryOnBodies: []*RetryBodyMatcher{{JMESPath: "error"}},
+	})
+	assert.True(r.matchBody(newResp(`{"error": "busy"}`)))
+	assert.False(r.matchBody(newResp(`{"error": null}`)))
+	assert.False(r.matchBody(newResp(`{"data": 1}`)))
+}
+
+func TestRetryerRetryAfter(t *testing.T) {
+	assert := assert.New(t)
+
+	resp, _ := httpprot.NewResponse(nil)
+
+	r := newRetryer(&RetrySpec{})
+	resp.HTTPHeader().Set("Retry-After", "1")
+	_, ok := r.retryAfter(resp)
+	assert.False(ok)
+
+	assert.Error((&RetrySpec{MaxRetryAfter: "1s"}).Validate())
+
+	r = newRetryer(&RetrySpec{HonorRetryAfter: true, MaxRetryAfter: "5s"})
+	d, ok := r.retryAfter(resp)
+	assert.True(ok)
+	assert.Equal(time.Second, d)
+
+	resp.HTTPHeader().Set("Retry-After", "3600")
+	d, _ = r.retryAfter(resp)
+	assert.Equal(5*time.Second, d)
+
+	resp.HTTPHeader().Set("Retry-After", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat))
+	d, ok = r.retryAfter(resp)
+	assert.True(ok)
+	assert.Equal(time.Duration(0), d)
+
+	resp.HTTPHeader().Set("Retry-After", "invalid")
+	_, ok = r.retryAfter(resp)
+	assert.False(ok)
+
+	// the Retry-After header is used as the wait duration.
+	r = newRetryer(&RetrySpec{
+		MaxAttempts:     2,
+		RetryOnCodes:    []int{429},
+		BaseInterval:    "1s",
+		HonorRetryAfter: true,
+	})
+	spCtx := newRetryTestContext(http.MethodGet)
+	calls := 0
+	handler := func(ctx stdcontext.Context) error {
+		calls++
+		spCtx.resp, _ = httpprot.NewResponse(nil)
+		if calls == 1 {
+			spCtx.resp.SetStatusCode(429)
+			spCtx.resp.HTTPHeader().Set("Retry-After", "0")
+		}
+		return nil
+	}
+	start := time.Now()
+	assert.NoError(r.wrap(spCtx, handler)(stdcontext.Background()))
+	assert.Equal(2, calls)
+	assert.Less(time.Since(start), 500*time.Millisecond)
+}
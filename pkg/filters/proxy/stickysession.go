@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const defaultStickySessionCookieName = "EG_SESSION"
+
+// StickySessionSpec is the spec of sticky session, the server of the first
+// request of a client is saved in a cookie, and the following requests with
+// the cookie are sent to the same server as long as it is in the pool.
+type StickySessionSpec struct {
+	CookieName string `json:"cookieName" jsonschema:"omitempty"`
+	// TTL is the max age of the cookie, the cookie is a session cookie if
+	// it is empty.
+	TTL      string `json:"ttl" jsonschema:"omitempty,format=duration"`
+	Path     string `json:"path" jsonschema:"omitempty"`
+	HTTPOnly bool   `json:"httpOnly" jsonschema:"omitempty"`
+	Secure   bool   `json:"secure" jsonschema:"omitempty"`
+}
+
+// stickySessionLoadBalancer chooses the server saved in the affinity cookie,
+// and falls back to the wrapped load balancer if there's no cookie or the
+// server is not in the pool anymore.
+type stickySessionLoadBalancer struct {
+	LoadBalancer
+	spec    *StickySessionSpec
+	servers map[string]*Server
+	maxAge  int
+}
+
+// Validate validates StickySessionSpec.
+func (s *StickySessionSpec) Validate() error {
+	if s.TTL != "" {
+		if d, _ := time.ParseDuration(s.TTL); d < time.Second {
+			return fmt.Errorf("ttl must be at least 1s")
+		}
+	}
+	return nil
+}
+
+func (s *StickySessionSpec) cookieName() string {
+	if s.CookieName == "" {
+		return defaultStickySessionCookieName
+	}
+	return s.CookieName
+}
+
+// serverID returns the ID of the server in the affinity cookie, it only
+// depends on the URL of the server, so the ID is the same in all members
+// and doesn't change when other servers are added or removed.
+func serverID(svr *Server) string {
+	hash := fnv.New64a()
+	hash.Write([]byte(svr.URL))
+	return strconv.FormatUint(hash.Sum64(), 36)
+}
+
+func newStickySessionLoadBalancer(spec *StickySessionSpec, lb LoadBalancer, servers []*Server) *stickySessionLoadBalancer {
+	sslb := &stickySessionLoadBalancer{
+		LoadBalancer: lb,
+		spec:         spec,
+		servers:      make(map[string]*Server, len(servers)),
+	}
+	for _, svr := range servers {
+		sslb.servers[serverID(svr)] = svr
+	}
+	if spec.TTL != "" {
+		d, _ := time.ParseDuration(spec.TTL)
+		sslb.maxAge = int(d / time.Second)
+	}
+	return sslb
+}
+
+// ChooseServer implements the LoadBalancer interface.
+func (lb *stickySessionLoadBalancer) ChooseServer(req *httpprot.Request) *Server {
+	if req != nil {
+		if c, err := req.Cookie(lb.spec.cookieName()); err == nil {
+			if svr := lb.servers[c.Value]; svr != nil {
+				return svr
+			}
+		}
+	}
+	return lb.LoadBalancer.ChooseServer(req)
+}
+
+func (lb *stickySessionLoadBalancer) serverCount() int {
+	return len(lb.servers)
+}
+
+// setCookie sets the affinity cookie to the response if the request has no
+// cookie or the cookie refers to another server, which happens when the
+// pinned server was removed from the pool and the client is re-balanced.
+func (lb *stickySessionLoadBalancer) setCookie(req *httpprot.Request, resp *httpprot.Response, svr *Server) {
+	name, id := lb.spec.cookieName(), serverID(svr)
+	if c, err := req.Cookie(name); err == nil && c.Value == id && lb.maxAge == 0 {
+		return
+	}
+
+	path := lb.spec.Path
+	if path == "" {
+		path = "/"
+	}
+
+	// the cookie is always refreshed if it has a max age, so that active
+	// clients don't lose their sessions.
+	resp.SetCookie(&http.Cookie{
+		Name:     name,
+		Value:    id,
+		Path:     path,
+		MaxAge:   lb.maxAge,
+		HttpOnly: lb.spec.HTTPOnly,
+		Secure:   lb.spec.Secure,
+	})
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStickySession(t *testing.T) {
+	assert := assert.New(t)
+
+	svrs := make([]*Server, 0, 5)
+	for i := 0; i < 5; i++ {
+		svrs = append(svrs, &Server{URL: fmt.Sprintf("http://127.0.0.1:%d", 9090+i)})
+	}
+
+	spec := &LoadBalanceSpec{
+		StickySession: &StickySessionSpec{HTTPOnly: true, Secure: true},
+	}
+	lb := NewLoadBalancer(spec, svrs)
+
+	newRequest := func(cookie string) *httpprot.Request {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+		if cookie != "" {
+			stdr.AddCookie(&http.Cookie{Name: defaultStickySessionCookieName, Value: cookie})
+		}
+		req, _ := httpprot.NewRequest(stdr)
+		return req
+	}
+	newResponse := func() *httpprot.Response {
+		resp, _ := httpprot.NewResponse(nil)
+		return resp
+	}
+
+	// the first request gets a cookie of the chosen server.
+	req := newRequest("")
+	svr := lb.ChooseServer(req)
+	resp := newResponse()
+	lb.(*stickySessionLoadBalancer).setCookie(req, resp, svr)
+	cookies := resp.Std().Cookies()
+	assert.Len(cookies, 1)
+	c := cookies[0]
+	assert.Equal(defaultStickySessionCookieName, c.Name)
+	assert.Equal(serverID(svr), c.Value)
+	assert.Equal("/", c.Path)
+	assert.True(c.HttpOnly)
+	assert.True(c.Secure)
+
+	// the following requests are sent to the same server, and the session
+	// cookie is not set again.
+	for i := 0; i < 10; i++ {
+		req = newRequest(c.Value)
+		assert.Equal(svr, lb.ChooseServer(req))
+		resp = newResponse()
+		lb.(*stickySessionLoadBalancer).setCookie(req, resp, svr)
+		assert.Empty(resp.Std().Cookies())
+	}
+
+	// the pinned server is removed, the client is re-balanced.
+	others := make([]*Server, 0, len(svrs)-1)
+	for _, s := range svrs {
+		if s != svr {
+			others = append(others, s)
+		}
+	}
+	lb = NewLoadBalancer(spec, others)
+	req = newRequest(c.Value)
+	newSvr := lb.ChooseServer(req)
+	assert.NotEqual(svr, newSvr)
+	resp = newResponse()
+	lb.(*stickySessionLoadBalancer).setCookie(req, resp, newSvr)
+	cookies = resp.Std().Cookies()
+	assert.Len(cookies, 1)
+	assert.Equal(serverID(newSvr), cookies[0].Value)
+
+	// the cookie with max age is always refreshed.
+	spec = &LoadBalanceSpec{
+		Policy:        LoadBalancePolicyRandom,
+		StickySession: &StickySessionSpec{CookieName: "affinity", TTL: "1h", Path: "/api"},
+	}
+	lb = NewLoadBalancer(spec, svrs)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	stdr.AddCookie(&http.Cookie{Name: "affinity", Value: serverID(svrs[2])})
+	req, _ = httpprot.NewRequest(stdr)
+	assert.Equal(svrs[2], lb.ChooseServer(req))
+	resp = newResponse()
+	lb.(*stickySessionLoadBalancer).setCookie(req, resp, svrs[2])
+	cookies = resp.Std().Cookies()
+	assert.Len(cookies, 1)
+	assert.Equal("affinity", cookies[0].Name)
+	assert.Equal(3600, cookies[0].MaxAge)
+	assert.Equal("/api", cookies[0].Path)
+
+	assert.Error((&StickySessionSpec{TTL: "100ms"}).Validate())
+	assert.NoError((&StickySessionSpec{TTL: "10m"}).Validate())
+}
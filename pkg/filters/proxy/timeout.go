@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	deadlineFormatGRPC         = "grpc"
+	deadlineFormatMilliseconds = "milliseconds"
+	deadlineFormatSeconds      = "seconds"
+)
+
+// TimeoutOverride overrides the timeout of the server pool for the
+// requests it matches.
+type TimeoutOverride struct {
+	MethodAndURLMatcher `json:",inline"`
+	Timeout             string `json:"timeout" jsonschema:"required,format=duration"`
+	timeout             time.Duration
+}
+
+// DeadlineHeader is a header to propagate the remaining time before the
+// deadline of a request to the servers, so that the servers could cancel
+// the work which could not be finished in time.
+type DeadlineHeader struct {
+	Name   string `json:"name" jsonschema:"required"`
+	Format string `json:"format" jsonschema:"omitempty,enum=grpc,enum=milliseconds,enum=seconds"`
+}
+
+func (to *TimeoutOverride) init() {
+	to.MethodAndURLMatcher.init()
+	to.timeout, _ = time.ParseDuration(to.Timeout)
+}
+
+// timeoutOf returns the timeout of the request, the first matched
+// override takes effect.
+func (sp *ServerPool) timeoutOf(req *httpprot.Request) time.Duration {
+	for _, to := range sp.spec.TimeoutOverrides {
+		if to.Match(req) {
+			return to.timeout
+		}
+	}
+	return sp.timeout
+}
+
+// setDeadlineHeaders sets the deadline headers of the request according
+// to the deadline of ctx.
+func (sp *ServerPool) setDeadlineHeaders(ctx stdcontext.Context, stdr *http.Request) {
+	if len(sp.spec.DeadlineHeaders) == 0 {
+		return
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return
+	}
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return
+	}
+
+	for _, h := range sp.spec.DeadlineHeaders {
+		stdr.Header.Set(h.Name, formatDeadline(h.Format, remaining))
+	}
+}
+
+// formatDeadline formats the remaining time d, the default format is
+// milliseconds.
+func formatDeadline(format string, d time.Duration) string {
+	switch format {
+	case deadlineFormatGRPC:
+		// the value of grpc-timeout has at most 8 digits.
+		// Reference: https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md
+		const max = 100000000
+		if us := d.Microseconds(); us < max {
+			return strconv.FormatInt(us, 10) + "u"
+		}
+		if ms := d.Milliseconds(); ms < max {
+			return strconv.FormatInt(ms, 10) + "m"
+		}
+		if s := int64(d / time.Second); s < max {
+			return strconv.FormatInt(s, 10) + "S"
+		}
+		return strconv.FormatInt(int64(d/time.Hour), 10) + "H"
+	case deadlineFormatSeconds:
+		return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+	default:
+		return strconv.FormatInt(d.Milliseconds(), 10)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatDeadline(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("1500000u", formatDeadline(deadlineFormatGRPC, 1500*time.Millisecond))
+	assert.Equal("200000m", formatDeadline(deadlineFormatGRPC, 200*time.Second))
+	assert.Equal("1500", formatDeadline(deadlineFormatMilliseconds, 1500*time.Millisecond))
+	assert.Equal("1500", formatDeadline("", 1500*time.Millisecond))
+	assert.Equal("1.500", formatDeadline(deadlineFormatSeconds, 1500*time.Millisecond))
+}
+
+func TestTimeoutOverrides(t *testing.T) {
+	assert := assert.New(t)
+
+	const yamlConfig = `
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: http://127.0.0.1:9095
+  timeout: 1s
+  timeoutOverrides:
+  - methods: [POST]
+    url:
+      prefix: /slow
+    timeout: 10s
+  deadlineHeaders:
+  - name: grpc-timeout
+    format: grpc
+  - name: X-Request-Timeout
+`
+
+	var header http.Header
+	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+		header = r.Header.Clone()
+		return httptest.NewRecorder().Result(), nil
+	}
+	defer func() {
+		fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+			return client.Do(r)
+		}
+	}()
+
+	proxy := newTestProxy(yamlConfig, assert)
+	defer proxy.Close()
+
+	remaining := func() int {
+		v, _ := strconv.Atoi(header.Get("X-Request-Timeout"))
+		return v
+	}
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/slow", nil)
+	assert.Equal("", proxy.Handle(getCtx(stdr)))
+	assert.True(remaining() > 900 && remaining() <= 1000)
+	assert.True(strings.HasSuffix(header.Get("grpc-timeout"), "u"))
+
+	stdr, _ = http.NewRequest(http.MethodPost, "http://127.0.0.1/slow/api", nil)
+	assert.Equal("", proxy.Handle(getCtx(stdr)))
+	assert.True(remaining() > 9900 && remaining() <= 10000)
+}
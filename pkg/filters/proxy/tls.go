@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/megaease/easegress/pkg/secret"
+)
+
+// TLSSpec is the configuration of the TLS connections from a server pool
+// to its upstream servers.
+type TLSSpec struct {
+	CertBase64 string `json:"certBase64" jsonschema:"omitempty,format=base64"`
+	KeyBase64  string `json:"keyBase64" jsonschema:"omitempty,format=base64"`
+	// CertSecret and KeySecret reference the secrets of the PEM encoded
+	// client certificate and key, e.g. `$secret:upstream-key`, they are
+	// replaced with the values of the secrets when the spec is created.
+	CertSecret         string `json:"certSecret" jsonschema:"omitempty"`
+	KeySecret          string `json:"keySecret" jsonschema:"omitempty"`
+	RootCertBase64     string `json:"rootCertBase64" jsonschema:"omitempty,format=base64"`
+	ServerName         string `json:"serverName" jsonschema:"omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify" jsonschema:"omitempty"`
+}
+
+// Validate validates TLSSpec.
+func (s *TLSSpec) Validate() error {
+	if (s.CertBase64 == "") != (s.KeyBase64 == "") {
+		return fmt.Errorf("certBase64 and keyBase64 must be both empty or both not empty")
+	}
+	if (s.CertSecret == "") != (s.KeySecret == "") {
+		return fmt.Errorf("certSecret and keySecret must be both empty or both not empty")
+	}
+	if s.CertBase64 != "" && s.CertSecret != "" {
+		return fmt.Errorf("certBase64 and certSecret are mutually exclusive")
+	}
+
+	_, err := s.tlsConfig()
+	return err
+}
+
+// TLSConfig returns the TLS config of the spec.
+func (s *TLSSpec) TLSConfig() (*tls.Config, error) {
+	return s.tlsConfig()
+}
+
+func (s *TLSSpec) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         s.ServerName,
+		InsecureSkipVerify: s.InsecureSkipVerify,
+	}
+
+	if s.CertBase64 != "" {
+		certPem, _ := base64.StdEncoding.DecodeString(s.CertBase64)
+		keyPem, _ := base64.StdEncoding.DecodeString(s.KeyBase64)
+		cert, err := tls.X509KeyPair(certPem, keyPem)
+		if err != nil {
+			return nil, fmt.Errorf("generate x509 key pair failed: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if s.CertSecret != "" {
+		for _, v := range []string{s.CertSecret, s.KeySecret} {
+			if name, ok := secret.ParseReference(v); ok {
+				return nil, fmt.Errorf("secret %s is not resolved", name)
+			}
+		}
+		cert, err := tls.X509KeyPair([]byte(s.CertSecret), []byte(s.KeySecret))
+		if err != nil {
+			return nil, fmt.Errorf("generate x509 key pair from secrets failed: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if s.RootCertBase64 != "" {
+		rootCertPem, _ := base64.StdEncoding.DecodeString(s.RootCertBase64)
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(rootCertPem) {
+			return nil, fmt.Errorf("no valid certificate found in rootCertBase64")
+		}
+		cfg.RootCAs = pool
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLSSpec(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &TLSSpec{CertBase64: "YWJjZGVmZw=="}
+	assert.Error(spec.Validate())
+
+	spec.KeyBase64 = "YWJjZGVmZ2FkZg=="
+	assert.Error(spec.Validate())
+
+	spec = &TLSSpec{RootCertBase64: "YWJjM2VmZ2FkZg=="}
+	assert.Error(spec.Validate())
+
+	spec = &TLSSpec{ServerName: "megaease.com", InsecureSkipVerify: true}
+	assert.NoError(spec.Validate())
+	cfg, err := spec.tlsConfig()
+	assert.NoError(err)
+	assert.Equal("megaease.com", cfg.ServerName)
+	assert.True(cfg.InsecureSkipVerify)
+}
+
+func TestTLSSpecSecrets(t *testing.T) {
+	assert := assert.New(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(err)
+	certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+
+	spec := &TLSSpec{CertSecret: certPEM}
+	assert.Error(spec.Validate())
+
+	spec = &TLSSpec{CertBase64: "YWJjZGVmZw==", KeyBase64: "YWJjZGVmZw==", CertSecret: certPEM, KeySecret: keyPEM}
+	assert.Error(spec.Validate())
+
+	// the references are resolved by the supervisor before validation.
+	spec = &TLSSpec{CertSecret: "$secret:cert", KeySecret: "$secret:key"}
+	assert.Error(spec.Validate())
+
+	spec = &TLSSpec{CertSecret: certPEM, KeySecret: keyPEM}
+	assert.NoError(spec.Validate())
+	cfg, err := spec.tlsConfig()
+	assert.NoError(err)
+	assert.Len(cfg.Certificates, 1)
+}
+
+func TestPoolHTTPClient(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &Proxy{spec: &Spec{}}
+	p.client = p.newHTTPClient(nil)
+
+	spec := &ServerPoolSpec{Servers: []*Server{{URL: "https://127.0.0.1:9095"}}}
+	sp := NewServerPool(p, spec, "test")
+	assert.Equal(p.client, sp.httpClient())
+	sp.close()
+
+	spec.TLS = &TLSSpec{ServerName: "megaease.com"}
+	sp = NewServerPool(p, spec, "test")
+	assert.NotEqual(p.client, sp.httpClient())
+	sp.close()
+}
@@ -0,0 +1,521 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package quota implements the Quota filter.
+package quota
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/filters/ratelimiter"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// Kind is the kind of Quota.
+	Kind = "Quota"
+
+	resultQuotaExceeded = "quotaExceeded"
+
+	periodDay   = "day"
+	periodMonth = "month"
+
+	// an STM transaction puts and compares every key, the batch size
+	// keeps the transaction within the default limit of etcd (128 ops).
+	stmBatchSize = 50
+
+	// usages of expired windows are pruned from the cluster by the leader
+	// at this interval.
+	pruneInterval = time.Hour
+)
+
+// for unit testing cases to mock 'time.Now' only
+var nowFunc = time.Now
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "Quota enforces long-horizon quotas of consumers",
+	Results:     []string{resultQuotaExceeded},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{SyncInterval: "5s"}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &Quota{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// Quota is filter Quota.
+	Quota struct {
+		spec    *Spec
+		cluster cluster.Cluster
+		done    chan struct{}
+
+		lock      sync.Mutex
+		usages    map[string]*usage
+		lastPrune time.Time
+	}
+
+	// Spec describes the Quota.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		KeyExtractor *ratelimiter.KeyExtractor `json:"keyExtractor" jsonschema:"required"`
+		Limits       []*Limit                  `json:"limits" jsonschema:"required,minItems=1"`
+		SyncInterval string                    `json:"syncInterval" jsonschema:"omitempty,format=duration"`
+	}
+
+	// Limit is the max number of requests of a consumer in a period.
+	Limit struct {
+		Period string `json:"period" jsonschema:"required,enum=day,enum=month"`
+		Max    int64  `json:"max" jsonschema:"required,minimum=1"`
+	}
+
+	// Usage is the usage of a consumer, it is persisted in the cluster.
+	Usage struct {
+		Consumer string              `json:"consumer"`
+		Counters map[string]*Counter `json:"counters"`
+	}
+
+	// Counter is the number of requests in a window of a period, the
+	// window is the date or the month in UTC, e.g. 2022-08-01 or 2022-08.
+	Counter struct {
+		Window string `json:"window"`
+		Used   int64  `json:"used"`
+	}
+
+	// usage is the local view of the usage of a consumer, synced is empty
+	// until it is loaded from the cluster.
+	usage struct {
+		synced   *Usage
+		loaded   bool
+		pending  int64
+		accessed bool
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	periods := map[string]bool{}
+	for _, l := range spec.Limits {
+		if periods[l.Period] {
+			return fmt.Errorf("duplicated limits of period %s", l.Period)
+		}
+		periods[l.Period] = true
+	}
+	return nil
+}
+
+func window(period string, now time.Time) string {
+	if period == periodMonth {
+		return now.UTC().Format("2006-01")
+	}
+	return now.UTC().Format("2006-01-02")
+}
+
+// resetTime returns the time when the window of now ends.
+func resetTime(period string, now time.Time) time.Time {
+	y, m, d := now.UTC().Date()
+	if period == periodMonth {
+		return time.Date(y, m+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+}
+
+func newUsage(consumer string) *Usage {
+	return &Usage{Consumer: consumer, Counters: map[string]*Counter{}}
+}
+
+func decodeUsage(consumer string, data string) *Usage {
+	u := newUsage(consumer)
+	if data == "" {
+		return u
+	}
+	if err := codectool.UnmarshalJSON([]byte(data), u); err != nil {
+		logger.Errorf("failed to unmarshal quota usage of %s: %v", consumer, err)
+		return newUsage(consumer)
+	}
+	if u.Counters == nil {
+		u.Counters = map[string]*Counter{}
+	}
+	return u
+}
+
+func (u *Usage) clone() *Usage {
+	c := newUsage(u.Consumer)
+	for period, counter := range u.Counters {
+		c.Counters[period] = &Counter{Window: counter.Window, Used: counter.Used}
+	}
+	return c
+}
+
+func (u *Usage) used(period string, now time.Time) int64 {
+	c := u.Counters[period]
+	if c == nil || c.Window != window(period, now) {
+		return 0
+	}
+	return c.Used
+}
+
+// expired returns whether all the counters of the usage are in expired
+// windows.
+func (u *Usage) expired(now time.Time) bool {
+	for period, c := range u.Counters {
+		if c.Window == window(period, now) {
+			return false
+		}
+	}
+	return true
+}
+
+func (u *Usage) add(limits []*Limit, now time.Time, n int64) {
+	for _, l := range limits {
+		w := window(l.Period, now)
+		c := u.Counters[l.Period]
+		if c == nil || c.Window != w {
+			c = &Counter{Window: w}
+			u.Counters[l.Period] = c
+		}
+		c.Used += n
+	}
+}
+
+// Name returns the name of the Quota filter instance.
+func (q *Quota) Name() string {
+	return q.spec.Name()
+}
+
+// Kind returns the kind of Quota.
+func (q *Quota) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the Quota
+func (q *Quota) Spec() filters.Spec {
+	return q.spec
+}
+
+// Init initializes Quota.
+func (q *Quota) Init() {
+	q.reload()
+}
+
+// Inherit inherits previous generation of Quota.
+func (q *Quota) Inherit(previousGeneration filters.Filter) {
+	q.reload()
+
+	// the pending numbers of the previous generation are flushed to the
+	// cluster when it is closed, so only the synced usages are inherited,
+	// unless there's no cluster.
+	prev := previousGeneration.(*Quota)
+	prev.lock.Lock()
+	for consumer, u := range prev.usages {
+		inherited := &usage{synced: u.synced.clone(), loaded: u.loaded}
+		if q.cluster == nil {
+			inherited.pending, u.pending = u.pending, 0
+		}
+		q.usages[consumer] = inherited
+	}
+	prev.lock.Unlock()
+}
+
+func (q *Quota) reload() {
+	q.spec.KeyExtractor.Init()
+	q.usages = map[string]*usage{}
+	q.done = make(chan struct{})
+
+	if super := q.spec.Super(); super != nil && super.Cluster() != nil {
+		q.cluster = super.Cluster()
+	} else {
+		logger.Warnf("%s: cluster is not available, usages are not persisted", q.Name())
+	}
+
+	go q.runSync()
+}
+
+func (q *Quota) syncInterval() time.Duration {
+	if d, err := time.ParseDuration(q.spec.SyncInterval); err == nil && d > 0 {
+		return d
+	}
+	return 5 * time.Second
+}
+
+// Handle enforces the quotas of the consumer of the request.
+func (q *Quota) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	consumer := q.spec.KeyExtractor.Extract(req)
+	if consumer == "" {
+		return ""
+	}
+
+	now := nowFunc()
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	u := q.getUsage(consumer)
+	u.accessed = true
+	for _, l := range q.spec.Limits {
+		if u.synced.used(l.Period, now)+u.pending >= l.Max {
+			return q.reject(ctx, l, now)
+		}
+	}
+	u.pending++
+
+	return ""
+}
+
+func (q *Quota) reject(ctx *context.Context, l *Limit, now time.Time) string {
+	ctx.AddTag("quota: quota exceeded")
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusTooManyRequests)
+
+	reset := strconv.FormatInt(int64(resetTime(l.Period, now).Sub(now)/time.Second)+1, 10)
+	header := resp.HTTPHeader()
+	header.Set("X-RateLimit-Limit", strconv.FormatInt(l.Max, 10))
+	header.Set("X-RateLimit-Remaining", "0")
+	header.Set("X-RateLimit-Reset", reset)
+	header.Set("Retry-After", reset)
+
+	ctx.SetOutputResponse(resp)
+	return resultQuotaExceeded
+}
+
+// getUsage returns the local view of the usage of consumer, the caller
+// must hold the lock. If the consumer is not in the local view, the usage
+// is loaded from the cluster in background, so the first requests of the
+// consumer are only limited by the local numbers until it is loaded.
+func (q *Quota) getUsage(consumer string) *usage {
+	if u := q.usages[consumer]; u != nil {
+		return u
+	}
+
+	u := &usage{synced: newUsage(consumer), loaded: q.cluster == nil}
+	q.usages[consumer] = u
+	if !u.loaded {
+		go q.load(consumer, u)
+	}
+	return u
+}
+
+// load loads the usage of consumer from the cluster, unless it has been
+// refreshed by sync.
+func (q *Quota) load(consumer string, u *usage) {
+	key := q.cluster.Layout().QuotaUsageKey(q.spec.Pipeline(), q.Name(), consumer)
+	v, err := q.cluster.Get(key)
+	if err != nil {
+		logger.Errorf("%s: failed to get usage of %s: %v", q.Name(), consumer, err)
+		return
+	}
+
+	synced := newUsage(consumer)
+	if v != nil {
+		synced = decodeUsage(consumer, *v)
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if !u.loaded {
+		u.synced, u.loaded = synced, true
+	}
+}
+
+func (q *Quota) runSync() {
+	ticker := time.NewTicker(q.syncInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.done:
+			q.sync()
+			return
+		case <-ticker.C:
+			q.sync()
+		}
+	}
+}
+
+// sync flushes the pending numbers to the cluster, and refreshes the
+// local view with the usages in the cluster, which includes the numbers
+// of other members and the resets by the admin API. Usages not accessed
+// since last sync are removed from the local view.
+func (q *Quota) sync() {
+	q.lock.Lock()
+	consumers := make([]string, 0, len(q.usages))
+	pending := map[string]int64{}
+	for consumer, u := range q.usages {
+		consumers = append(consumers, consumer)
+		if u.pending > 0 {
+			pending[consumer] = u.pending
+		}
+	}
+	q.lock.Unlock()
+
+	latest, err := q.flush(consumers, pending)
+	if err != nil {
+		logger.Errorf("%s: failed to sync usages: %v", q.Name(), err)
+	}
+
+	q.lock.Lock()
+	for consumer, u := range q.usages {
+		u.pending -= pending[consumer]
+
+		if l := latest[consumer]; l != nil {
+			u.synced, u.loaded = l, true
+		}
+
+		if !u.accessed && u.pending == 0 {
+			delete(q.usages, consumer)
+		}
+		u.accessed = false
+	}
+	q.lock.Unlock()
+
+	q.prune()
+}
+
+// flush adds the pending numbers to the usages of consumers in the
+// cluster, and returns the latest usages of consumers. The usages are
+// updated locally if there's no cluster. The numbers of consumers which
+// fail to flush are removed from pending, so that they are kept pending.
+func (q *Quota) flush(consumers []string, pending map[string]int64) (map[string]*Usage, error) {
+	now := nowFunc()
+	latest := map[string]*Usage{}
+
+	if q.cluster == nil {
+		q.lock.Lock()
+		defer q.lock.Unlock()
+		for consumer, n := range pending {
+			u := q.usages[consumer].synced
+			u.add(q.spec.Limits, now, n)
+			latest[consumer] = u
+		}
+		return latest, nil
+	}
+
+	layout := q.cluster.Layout()
+	for len(consumers) > 0 {
+		batch := consumers
+		if len(batch) > stmBatchSize {
+			batch = batch[:stmBatchSize]
+		}
+		consumers = consumers[len(batch):]
+
+		result := map[string]*Usage{}
+		err := q.cluster.STM(func(stm concurrency.STM) error {
+			for _, consumer := range batch {
+				key := layout.QuotaUsageKey(q.spec.Pipeline(), q.Name(), consumer)
+				u := decodeUsage(consumer, stm.Get(key))
+				if n := pending[consumer]; n > 0 {
+					u.add(q.spec.Limits, now, n)
+					stm.Put(key, string(codectool.MustMarshalJSON(u)))
+				}
+				result[consumer] = u
+			}
+			return nil
+		})
+		if err != nil {
+			for _, consumer := range append(batch, consumers...) {
+				delete(pending, consumer)
+			}
+			return latest, err
+		}
+
+		for consumer, u := range result {
+			latest[consumer] = u
+		}
+	}
+
+	return latest, nil
+}
+
+// prune deletes the usages of expired windows from the cluster, it is
+// done by the leader only, at most once every pruneInterval.
+func (q *Quota) prune() {
+	if q.cluster == nil || !q.cluster.IsLeader() {
+		return
+	}
+
+	now := nowFunc()
+	if now.Sub(q.lastPrune) < pruneInterval {
+		return
+	}
+	q.lastPrune = now
+
+	prefix := q.cluster.Layout().QuotaPrefix(q.spec.Pipeline(), q.Name())
+	kvs, err := q.cluster.GetPrefix(prefix)
+	if err != nil {
+		logger.Errorf("%s: failed to get usages: %v", q.Name(), err)
+		return
+	}
+
+	keys := []string{}
+	for key, value := range kvs {
+		if decodeUsage(key, value).expired(now) {
+			keys = append(keys, key)
+		}
+	}
+
+	for len(keys) > 0 {
+		batch := keys
+		if len(batch) > stmBatchSize {
+			batch = batch[:stmBatchSize]
+		}
+		keys = keys[len(batch):]
+
+		// the usages are checked again in the transaction, in case they
+		// are updated by other members after they were got.
+		err := q.cluster.STM(func(stm concurrency.STM) error {
+			for _, key := range batch {
+				if v := stm.Get(key); v != "" && decodeUsage(key, v).expired(now) {
+					stm.Del(key)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			logger.Errorf("%s: failed to prune usages: %v", q.Name(), err)
+			return
+		}
+	}
+}
+
+// Status returns status.
+func (q *Quota) Status() interface{} {
+	return nil
+}
+
+// Close closes Quota.
+func (q *Quota) Close() {
+	close(q.done)
+}
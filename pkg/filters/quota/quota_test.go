@@ -0,0 +1,272 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package quota
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+const yamlConfig = `
+kind: Quota
+name: quota
+keyExtractor:
+  source: header
+  name: X-Api-Key
+limits:
+- period: day
+  max: 2
+- period: month
+  max: 3
+`
+
+func newTestQuota(t *testing.T) *Quota {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "pipeline", rawSpec)
+	if err != nil {
+		t.Fatalf("failed to create spec: %v", err)
+	}
+	q := kind.CreateInstance(spec).(*Quota)
+	q.Init()
+	return q
+}
+
+func newContext(key string) *context.Context {
+	ctx := context.New(nil)
+	stdReq, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	stdReq.Header.Set("X-Api-Key", key)
+	req, _ := httpprot.NewRequest(stdReq)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Limits: []*Limit{{Period: periodDay, Max: 1}, {Period: periodDay, Max: 2}}}
+	assert.Error(spec.Validate())
+}
+
+func TestQuotaLocal(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2022, 8, 1, 10, 0, 0, 0, time.UTC)
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	q := newTestQuota(t)
+	defer q.Close()
+
+	assert.Equal("", q.Handle(newContext("")))
+	assert.Equal("", q.Handle(newContext("a")))
+	assert.Equal("", q.Handle(newContext("a")))
+
+	ctx := newContext("a")
+	assert.Equal(resultQuotaExceeded, q.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusTooManyRequests, resp.StatusCode())
+	assert.Equal("2", resp.HTTPHeader().Get("X-RateLimit-Limit"))
+	assert.Equal("0", resp.HTTPHeader().Get("X-RateLimit-Remaining"))
+	assert.Equal("50401", resp.HTTPHeader().Get("Retry-After"))
+
+	assert.Equal("", q.Handle(newContext("b")))
+
+	q.sync()
+	assert.Equal(int64(2), q.usages["a"].synced.used(periodMonth, now))
+
+	// the next day, the daily quota is reset, but the monthly one is not.
+	now = now.Add(24 * time.Hour)
+	assert.Equal("", q.Handle(newContext("a")))
+	ctx = newContext("a")
+	assert.Equal(resultQuotaExceeded, q.Handle(ctx))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("3", resp.HTTPHeader().Get("X-RateLimit-Limit"))
+
+	// b is not accessed, so it is removed after two syncs.
+	q.sync()
+	q.sync()
+	_, ok := q.usages["b"]
+	assert.False(ok)
+}
+
+type fakeSTM struct {
+	kvs map[string]string
+}
+
+func (s *fakeSTM) Get(key ...string) string {
+	return s.kvs[key[0]]
+}
+
+func (s *fakeSTM) Put(key, val string, opts ...clientv3.OpOption) {
+	s.kvs[key] = val
+}
+
+func (s *fakeSTM) Rev(key string) int64 {
+	return 0
+}
+
+func (s *fakeSTM) Del(key string) {
+	delete(s.kvs, key)
+}
+
+func newMockedCluster() (*clustertest.MockedCluster, map[string]string) {
+	var lock sync.Mutex
+	kvs := map[string]string{}
+
+	mc := clustertest.NewMockedCluster()
+	mc.MockedLayout = func() *cluster.Layout {
+		return &cluster.Layout{}
+	}
+	mc.MockedGet = func(key string) (*string, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if v, ok := kvs[key]; ok {
+			return &v, nil
+		}
+		return nil, nil
+	}
+	mc.MockedGetPrefix = func(prefix string) (map[string]string, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		result := map[string]string{}
+		for k, v := range kvs {
+			if strings.HasPrefix(k, prefix) {
+				result[k] = v
+			}
+		}
+		return result, nil
+	}
+	mc.MockedSTM = func(apply func(concurrency.STM) error) error {
+		lock.Lock()
+		defer lock.Unlock()
+		return apply(&fakeSTM{kvs: kvs})
+	}
+	return mc, kvs
+}
+
+func TestQuotaCluster(t *testing.T) {
+	assert := assert.New(t)
+
+	mc, kvs := newMockedCluster()
+	mc.MockedIsLeader = func() bool { return false }
+
+	// two members share the same cluster.
+	q1 := newTestQuota(t)
+	defer q1.Close()
+	q1.cluster = mc
+
+	q2 := newTestQuota(t)
+	defer q2.Close()
+	q2.cluster = mc
+
+	assert.Equal("", q1.Handle(newContext("a/b")))
+	assert.Equal("", q1.Handle(newContext("a/b")))
+	q1.sync()
+
+	key := mc.Layout().QuotaUsageKey("pipeline", "quota", "a/b")
+	usage := decodeUsage("a/b", kvs[key])
+	assert.Equal(int64(2), usage.used(periodDay, time.Now()))
+
+	// the usage is loaded in background, the first request is only
+	// limited by the local numbers.
+	assert.Equal("", q2.Handle(newContext("a/b")))
+	assert.Eventually(func() bool {
+		q2.lock.Lock()
+		defer q2.lock.Unlock()
+		return q2.usages["a/b"].loaded
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(resultQuotaExceeded, q2.Handle(newContext("a/b")))
+
+	// reset by the admin API.
+	delete(kvs, key)
+	q2.sync()
+	assert.Equal("", q2.Handle(newContext("a/b")))
+
+	// only the consumers in the local view are refreshed.
+	mc.MockedGetPrefix = func(prefix string) (map[string]string, error) {
+		t.Fatalf("usages of all consumers should not be got")
+		return nil, nil
+	}
+	q1.sync()
+}
+
+func TestQuotaPrune(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2022, 8, 31, 23, 30, 0, 0, time.UTC)
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	mc, kvs := newMockedCluster()
+	isLeader := false
+	mc.MockedIsLeader = func() bool { return isLeader }
+
+	q := newTestQuota(t)
+	defer q.Close()
+	q.cluster = mc
+
+	layout := mc.Layout()
+	expired := newUsage("expired")
+	expired.add(q.spec.Limits, now.AddDate(0, -1, 0), 1)
+	kvs[layout.QuotaUsageKey("pipeline", "quota", "expired")] = string(codectool.MustMarshalJSON(expired))
+	current := newUsage("current")
+	current.add(q.spec.Limits, now.Add(-time.Hour), 1)
+	kvs[layout.QuotaUsageKey("pipeline", "quota", "current")] = string(codectool.MustMarshalJSON(current))
+
+	// only the leader prunes the usages.
+	q.sync()
+	assert.Len(kvs, 2)
+
+	isLeader = true
+	q.sync()
+	assert.Len(kvs, 1)
+	assert.Contains(kvs, layout.QuotaUsageKey("pipeline", "quota", "current"))
+
+	// the usage is expired in the next month, but it is not pruned until
+	// the prune interval elapses.
+	now = now.Add(40 * time.Minute)
+	q.sync()
+	assert.Len(kvs, 1)
+
+	now = now.Add(pruneInterval)
+	q.sync()
+	assert.Len(kvs, 0)
+}
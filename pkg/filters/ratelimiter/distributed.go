@@ -0,0 +1,210 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimiter
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// for unit testing cases to mock 'time.Now' only
+var nowFunc = time.Now
+
+type (
+	// DistributedSpec is the configuration of the distributed mode, in
+	// which the limits are shared by all members of the cluster.
+	DistributedSpec struct {
+		SyncInterval string `json:"syncInterval" jsonschema:"omitempty,format=duration"`
+		LocalBurst   int    `json:"localBurst" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// distributedLimiter is a fixed window rate limiter, the windows are
+	// aligned to the wall clock, so that they are the same on all members.
+	// It permits a request if the number of requests permitted by all
+	// members in current window is less than the limit, the numbers of
+	// other members are the ones of the last sync.
+	distributedLimiter struct {
+		lock      sync.Mutex
+		period    time.Duration
+		limit     int
+		burst     int
+		window    int64
+		local     int
+		others    int
+		sinceSync int
+	}
+
+	// counter is the number of requests permitted by a member in a window.
+	counter struct {
+		Window int64 `json:"window"`
+		Count  int   `json:"count"`
+	}
+)
+
+func (spec *DistributedSpec) syncInterval() time.Duration {
+	if d, err := time.ParseDuration(spec.SyncInterval); err == nil && d > 0 {
+		return d
+	}
+	return time.Second
+}
+
+func newDistributedLimiter(policy *Policy, spec *DistributedSpec) *distributedLimiter {
+	dl := &distributedLimiter{
+		limit: policy.LimitForPeriod,
+		burst: spec.LocalBurst,
+	}
+
+	if dl.limit == 0 {
+		dl.limit = 50
+	}
+
+	// the period has been validated to be not less than the sync interval.
+	dl.period, _ = time.ParseDuration(policy.LimitRefreshPeriod)
+	dl.window = nowFunc().UnixNano() / int64(dl.period)
+
+	return dl
+}
+
+// rotate moves the limiter to the window of now, the caller must hold
+// the lock.
+func (dl *distributedLimiter) rotate(now time.Time) {
+	window := now.UnixNano() / int64(dl.period)
+	if window == dl.window {
+		return
+	}
+	dl.window = window
+	dl.local = 0
+	dl.others = 0
+	dl.sinceSync = 0
+}
+
+// acquirePermission tries to acquire a permission, a member permits at
+// most burst requests between two syncs if burst is not zero, so that
+// the requests permitted in excess of the limit are bounded when the
+// numbers of other members are out of date.
+func (dl *distributedLimiter) acquirePermission() bool {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	dl.rotate(nowFunc())
+
+	if dl.local+dl.others >= dl.limit {
+		return false
+	}
+	if dl.burst > 0 && dl.sinceSync >= dl.burst {
+		return false
+	}
+
+	dl.local++
+	dl.sinceSync++
+	return true
+}
+
+// snapshot returns the counter of this member in current window.
+func (dl *distributedLimiter) snapshot() *counter {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	dl.rotate(nowFunc())
+	return &counter{Window: dl.window, Count: dl.local}
+}
+
+// update updates the numbers of other members, the counters of other
+// windows are ignored.
+func (dl *distributedLimiter) update(counters []*counter) {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	dl.rotate(nowFunc())
+
+	others := 0
+	for _, c := range counters {
+		if c.Window == dl.window {
+			others += c.Count
+		}
+	}
+	dl.others = others
+	dl.sinceSync = 0
+}
+
+func (rl *RateLimiter) runSync() {
+	ticker := time.NewTicker(rl.spec.Distributed.syncInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rl.done:
+			return
+		case <-ticker.C:
+			rl.sync()
+		}
+	}
+}
+
+// sync publishes the counters of this member to the cluster, and pulls
+// the counters of other members. The counters are put under the lease
+// of the member, so they are removed when the member is gone.
+func (rl *RateLimiter) sync() {
+	layout := rl.cluster.Layout()
+	key := layout.RateLimiterKey(rl.spec.Pipeline(), rl.spec.Name())
+	prefix := layout.RateLimiterPrefix(rl.spec.Pipeline(), rl.spec.Name())
+
+	own := map[string]*counter{}
+	for i, u := range rl.spec.URLs {
+		own[strconv.Itoa(i)] = u.drl.snapshot()
+	}
+
+	data, err := codectool.MarshalJSON(own)
+	if err != nil {
+		logger.Errorf("%s: failed to marshal counters: %v", rl.Name(), err)
+		return
+	}
+	if err = rl.cluster.PutUnderLease(key, string(data)); err != nil {
+		logger.Errorf("%s: failed to put counters: %v", rl.Name(), err)
+		return
+	}
+
+	kvs, err := rl.cluster.GetPrefix(prefix)
+	if err != nil {
+		logger.Errorf("%s: failed to get counters: %v", rl.Name(), err)
+		return
+	}
+
+	others := map[string][]*counter{}
+	for k, v := range kvs {
+		if k == key {
+			continue
+		}
+		counters := map[string]*counter{}
+		if err = codectool.UnmarshalJSON([]byte(v), &counters); err != nil {
+			logger.Errorf("%s: failed to unmarshal counters of %s: %v", rl.Name(), k, err)
+			continue
+		}
+		for id, c := range counters {
+			others[id] = append(others[id], c)
+		}
+	}
+
+	for i, u := range rl.spec.URLs {
+		u.drl.update(others[strconv.Itoa(i)])
+	}
+}
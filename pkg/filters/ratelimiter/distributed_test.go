@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimiter
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newTestRateLimiter(t *testing.T, yamlConfig string) *RateLimiter {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		t.Fatalf("failed to create spec: %v", err)
+	}
+	return kind.CreateInstance(spec).(*RateLimiter)
+}
+
+const distributedConfig = `
+kind: RateLimiter
+name: rl
+policies:
+- name: policy
+  limitRefreshPeriod: 10s
+  limitForPeriod: 3
+defaultPolicyRef: policy
+urls:
+- url:
+    prefix: /
+distributed:
+  syncInterval: 1s
+`
+
+func TestDistributedValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(`
+kind: RateLimiter
+name: rl
+policies:
+- name: policy
+  limitRefreshPeriod: 10ms
+defaultPolicyRef: policy
+urls:
+- url:
+    prefix: /
+distributed:
+  syncInterval: 1s
+`), &rawSpec)
+	_, err := filters.NewSpec(nil, "", rawSpec)
+	assert.Error(err)
+}
+
+func TestDistributedLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(1000, 0)
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	dl := newDistributedLimiter(&Policy{LimitRefreshPeriod: "10s", LimitForPeriod: 5}, &DistributedSpec{LocalBurst: 2})
+
+	assert.True(dl.acquirePermission())
+	assert.True(dl.acquirePermission())
+	// burst is exhausted until next sync.
+	assert.False(dl.acquirePermission())
+
+	dl.update([]*counter{{Window: dl.window, Count: 2}, {Window: dl.window - 1, Count: 100}})
+	assert.Equal(2, dl.others)
+	assert.True(dl.acquirePermission())
+	// 2 (local) + 2 (others) + 1 (local) reaches the limit.
+	assert.False(dl.acquirePermission())
+	assert.Equal(&counter{Window: dl.window, Count: 3}, dl.snapshot())
+
+	// next window
+	now = now.Add(10 * time.Second)
+	assert.True(dl.acquirePermission())
+	assert.Equal(1, dl.snapshot().Count)
+}
+
+func TestDistributedSync(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(1000, 0)
+	nowFunc = func() time.Time { return now }
+	defer func() { nowFunc = time.Now }()
+
+	rl := newTestRateLimiter(t, distributedConfig)
+	rl.Init()
+	defer rl.Close()
+
+	// no cluster, the limits are not shared.
+	assert.Nil(rl.done)
+
+	ctx := context.New(nil)
+	stdReq, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/pets", nil)
+	req, _ := httpprot.NewRequest(stdReq)
+	ctx.SetInputRequest(req)
+
+	assert.Equal("", rl.Handle(ctx))
+
+	var put string
+	mc := clustertest.NewMockedCluster()
+	mc.MockedLayout = func() *cluster.Layout {
+		return &cluster.Layout{}
+	}
+	mc.MockedPutUnderLease = func(key, value string) error {
+		put = value
+		return nil
+	}
+	mc.MockedGetPrefix = func(prefix string) (map[string]string, error) {
+		window := rl.spec.URLs[0].drl.snapshot().Window
+		data, _ := codectool.MarshalJSON(map[string]*counter{
+			"0": {Window: window, Count: 2},
+		})
+		return map[string]string{
+			prefix + "member-2": string(data),
+		}, nil
+	}
+	rl.cluster = mc
+
+	rl.sync()
+	assert.Contains(put, `"count":1`)
+
+	assert.Equal(resultRateLimited, rl.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusTooManyRequests, resp.StatusCode())
+}
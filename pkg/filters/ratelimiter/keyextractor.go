@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimiter
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/golang-jwt/jwt"
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	librl "github.com/megaease/easegress/pkg/util/ratelimiter"
+)
+
+const (
+	keySourceClientIP = "clientIP"
+	keySourceHeader   = "header"
+	keySourceCookie   = "cookie"
+	keySourceJWTClaim = "jwtClaim"
+	keySourceTemplate = "template"
+
+	defaultMaxKeys = 10000
+)
+
+type (
+	// KeyExtractor extracts a key from the request, requests are limited
+	// separately by their keys.
+	KeyExtractor struct {
+		Source   string `json:"source" jsonschema:"required,enum=clientIP,enum=header,enum=cookie,enum=jwtClaim,enum=template"`
+		Name     string `json:"name" jsonschema:"omitempty"`
+		Template string `json:"template" jsonschema:"omitempty"`
+		MaxKeys  int    `json:"maxKeys" jsonschema:"omitempty,minimum=1"`
+
+		tmpl *template.Template
+	}
+
+	// keyedLimiters holds the rate limiters of the active keys, the least
+	// recently used ones are evicted when there are too many keys.
+	keyedLimiters struct {
+		policy *librl.Policy
+		cache  *lru.Cache
+	}
+)
+
+// Validate validates the KeyExtractor.
+func (ke *KeyExtractor) Validate() error {
+	switch ke.Source {
+	case keySourceHeader, keySourceCookie, keySourceJWTClaim:
+		if ke.Name == "" {
+			return fmt.Errorf("name is required for key source %s", ke.Source)
+		}
+	case keySourceTemplate:
+		if _, err := template.New("").Parse(ke.Template); err != nil {
+			return fmt.Errorf("invalid template: %v", err)
+		}
+	}
+	return nil
+}
+
+// equal checks whether the configurations of ke and other are the same,
+// both of them could be nil.
+func (ke *KeyExtractor) equal(other *KeyExtractor) bool {
+	if ke == nil || other == nil {
+		return ke == other
+	}
+	return ke.Source == other.Source && ke.Name == other.Name &&
+		ke.Template == other.Template && ke.MaxKeys == other.MaxKeys
+}
+
+// Init initializes the KeyExtractor.
+func (ke *KeyExtractor) Init() {
+	if ke.Source == keySourceTemplate {
+		// the template has been validated, so no error here.
+		ke.tmpl, _ = template.New("").Parse(ke.Template)
+	}
+}
+
+// Extract extracts the key from the request, an empty key means the
+// request has no key.
+func (ke *KeyExtractor) Extract(req *httpprot.Request) string {
+	switch ke.Source {
+	case keySourceClientIP:
+		return req.RealIP()
+	case keySourceHeader:
+		return req.HTTPHeader().Get(ke.Name)
+	case keySourceCookie:
+		if c, err := req.Cookie(ke.Name); err == nil {
+			return c.Value
+		}
+	case keySourceJWTClaim:
+		return ke.extractJWTClaim(req)
+	case keySourceTemplate:
+		// the template is executed with the request as data, for example:
+		// {{.HTTPHeader.Get "X-Tenant"}}/{{.RealIP}}
+		buf := bytes.NewBuffer(nil)
+		if err := ke.tmpl.Execute(buf, req); err == nil {
+			return buf.String()
+		}
+	}
+	return ""
+}
+
+// extractJWTClaim extracts the claim from the bearer token. The token is
+// not verified here, a Validator should be placed before the RateLimiter
+// if verification is required.
+func (ke *KeyExtractor) extractJWTClaim(req *httpprot.Request) string {
+	const prefix = "Bearer "
+
+	auth := req.HTTPHeader().Get("Authorization")
+	if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return ""
+	}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(auth[len(prefix):], claims); err != nil {
+		return ""
+	}
+
+	if v, ok := claims[ke.Name]; ok && v != nil {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+func newKeyedLimiters(policy *librl.Policy, maxKeys int) *keyedLimiters {
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+	cache, _ := lru.New(maxKeys)
+	return &keyedLimiters{policy: policy, cache: cache}
+}
+
+// get returns the rate limiter of key, it creates one if not exists.
+func (kl *keyedLimiters) get(key string) *librl.RateLimiter {
+	if v, ok := kl.cache.Get(key); ok {
+		return v.(*librl.RateLimiter)
+	}
+
+	rl := librl.New(kl.policy)
+	if prev, ok, _ := kl.cache.PeekOrAdd(key, rl); ok {
+		return prev.(*librl.RateLimiter)
+	}
+	return rl
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimiter
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+func newKeyedTestContext(setup func(r *http.Request)) *context.Context {
+	ctx := context.New(nil)
+	stdReq, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/pets", nil)
+	setup(stdReq)
+	req, _ := httpprot.NewRequest(stdReq)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestKeyExtractorHeader(t *testing.T) {
+	assert := assert.New(t)
+
+	rl := newTestRateLimiter(t, `
+kind: RateLimiter
+name: rl
+policies:
+- name: policy
+  timeoutDuration: 1ms
+  limitRefreshPeriod: 1h
+  limitForPeriod: 1
+defaultPolicyRef: policy
+urls:
+- url:
+    prefix: /
+  keyExtractor:
+    source: header
+    name: X-Api-Key
+    maxKeys: 10
+`)
+	rl.Init()
+	defer rl.Close()
+
+	withKey := func(key string) *context.Context {
+		return newKeyedTestContext(func(r *http.Request) {
+			r.Header.Set("X-Api-Key", key)
+		})
+	}
+
+	assert.Equal("", rl.Handle(withKey("a")))
+	assert.Equal(resultRateLimited, rl.Handle(withKey("a")))
+	assert.Equal("", rl.Handle(withKey("b")))
+
+	// requests without a key share one limiter.
+	assert.Equal("", rl.Handle(withKey("")))
+	assert.Equal(resultRateLimited, rl.Handle(withKey("")))
+
+	// the limiters are kept after reloading.
+	rl2 := newTestRateLimiter(t, rl.spec.JSONConfig())
+	rl2.Inherit(rl)
+	defer rl2.Close()
+	assert.Equal(resultRateLimited, rl2.Handle(withKey("a")))
+}
+
+func TestKeyExtractorSources(t *testing.T) {
+	assert := assert.New(t)
+
+	ke := &KeyExtractor{Source: keySourceClientIP}
+	ctx := newKeyedTestContext(func(r *http.Request) {
+		r.Header.Set("X-Real-Ip", "8.8.8.8")
+	})
+	assert.Equal("8.8.8.8", ke.Extract(ctx.GetInputRequest().(*httpprot.Request)))
+
+	ke = &KeyExtractor{Source: keySourceCookie, Name: "session"}
+	ctx = newKeyedTestContext(func(r *http.Request) {
+		r.AddCookie(&http.Cookie{Name: "session", Value: "s1"})
+	})
+	assert.Equal("s1", ke.Extract(ctx.GetInputRequest().(*httpprot.Request)))
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "user1"})
+	signed, _ := token.SignedString([]byte("secret"))
+	ke = &KeyExtractor{Source: keySourceJWTClaim, Name: "sub"}
+	ctx = newKeyedTestContext(func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer "+signed)
+	})
+	assert.Equal("user1", ke.Extract(ctx.GetInputRequest().(*httpprot.Request)))
+
+	ke = &KeyExtractor{Source: keySourceTemplate, Template: `{{.HTTPHeader.Get "X-Tenant"}}/{{.Path}}`}
+	assert.NoError(ke.Validate())
+	ke.Init()
+	ctx = newKeyedTestContext(func(r *http.Request) {
+		r.Header.Set("X-Tenant", "t1")
+	})
+	assert.Equal("t1//pets", ke.Extract(ctx.GetInputRequest().(*httpprot.Request)))
+
+	assert.Error((&KeyExtractor{Source: keySourceHeader}).Validate())
+	assert.Error((&KeyExtractor{Source: keySourceTemplate, Template: "{{"}).Validate())
+}
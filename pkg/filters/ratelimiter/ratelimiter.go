@@ -23,10 +23,14 @@ import (
 	"reflect"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/megaease/easegress/pkg/cluster"
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/filters"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/prometheushelper"
 	librl "github.com/megaease/easegress/pkg/util/ratelimiter"
 	"github.com/megaease/easegress/pkg/util/urlrule"
 )
@@ -65,14 +69,18 @@ type (
 	// URLRule defines the rate limiter rule for a URL pattern
 	URLRule struct {
 		urlrule.URLRule `json:",inline"`
+		KeyExtractor    *KeyExtractor `json:"keyExtractor,omitempty" jsonschema:"omitempty"`
 		policy          *Policy
 		rl              *librl.RateLimiter
+		drl             *distributedLimiter
+		keyed           *keyedLimiters
 	}
 
 	// Spec is the configuration of a rate limiter
 	Spec struct {
 		filters.BaseSpec `json:",inline"`
 		Rule             `json:",inline"`
+		Distributed      *DistributedSpec `json:"distributed,omitempty" jsonschema:"omitempty"`
 	}
 
 	// Rule is the detailed config of RateLimiter.
@@ -84,7 +92,11 @@ type (
 
 	// RateLimiter defines the rate limiter
 	RateLimiter struct {
-		spec *Spec
+		spec    *Spec
+		cluster cluster.Cluster
+		done    chan struct{}
+
+		rejections *prometheus.CounterVec
 	}
 )
 
@@ -106,6 +118,26 @@ URLLoop:
 		return fmt.Errorf("policy '%s' is not defined", name)
 	}
 
+	if spec.Distributed == nil {
+		return nil
+	}
+
+	for _, u := range spec.URLs {
+		if u.KeyExtractor != nil {
+			return fmt.Errorf("keyExtractor is not supported in distributed mode")
+		}
+	}
+
+	// the window of the distributed mode must be long enough to sync the
+	// counters of the members.
+	interval := spec.Distributed.syncInterval()
+	for _, p := range spec.Policies {
+		d, _ := time.ParseDuration(p.LimitRefreshPeriod)
+		if d < interval {
+			return fmt.Errorf("limitRefreshPeriod of policy '%s' must not be less than %s in distributed mode", p.Name, interval)
+		}
+	}
+
 	return nil
 }
 
@@ -131,6 +163,10 @@ func (url *URLRule) createRateLimiter() {
 	}
 
 	url.rl = librl.New(&policy)
+	if url.KeyExtractor != nil {
+		url.KeyExtractor.Init()
+		url.keyed = newKeyedLimiters(&policy, url.KeyExtractor.MaxKeys)
+	}
 }
 
 // Name returns the name of the RateLimiter filter instance.
@@ -176,6 +212,10 @@ func (rl *RateLimiter) bindPolicyToURL(u *URLRule) {
 func (rl *RateLimiter) createRateLimiterForURL(u *URLRule) {
 	u.Init()
 	rl.bindPolicyToURL(u)
+	if rl.spec.Distributed != nil {
+		u.drl = newDistributedLimiter(u.policy, rl.spec.Distributed)
+		return
+	}
 	u.createRateLimiter()
 	rl.setStateListenerForURL(u)
 }
@@ -207,6 +247,12 @@ func isSamePolicy(spec1, spec2 *Spec, policyName string) bool {
 }
 
 func (rl *RateLimiter) reload(previousGeneration *RateLimiter) {
+	rl.rejections = prometheushelper.NewCounter("ratelimiter_rejections_total",
+		"the total count of requests rejected by rate limiters",
+		[]string{"pipeline", "filter"})
+
+	rl.startSync()
+
 	if previousGeneration == nil {
 		for _, u := range rl.spec.URLs {
 			rl.createRateLimiterForURL(u)
@@ -214,27 +260,52 @@ func (rl *RateLimiter) reload(previousGeneration *RateLimiter) {
 		return
 	}
 
+	sameMode := reflect.DeepEqual(rl.spec.Distributed, previousGeneration.spec.Distributed)
+
 OuterLoop:
 	for _, url := range rl.spec.URLs {
 		for _, prev := range previousGeneration.spec.URLs {
-			if !url.DeepEqual(&prev.URLRule) {
+			if !url.DeepEqual(&prev.URLRule) || !url.KeyExtractor.equal(prev.KeyExtractor) {
 				continue
 			}
-			if !isSamePolicy(rl.spec, previousGeneration.spec, url.PolicyRef) {
+			if !sameMode || !isSamePolicy(rl.spec, previousGeneration.spec, url.PolicyRef) {
 				continue
 			}
 
 			url.Init()
 			rl.bindPolicyToURL(url)
-			url.rl = prev.rl
-			prev.rl = nil
-			rl.setStateListenerForURL(url)
+			url.rl, url.drl, url.keyed = prev.rl, prev.drl, prev.keyed
+			prev.rl, prev.drl, prev.keyed = nil, nil, nil
+			if url.KeyExtractor != nil {
+				url.KeyExtractor.Init()
+			}
+			if url.rl != nil {
+				rl.setStateListenerForURL(url)
+			}
 			continue OuterLoop
 		}
 		rl.createRateLimiterForURL(url)
 	}
 }
 
+// startSync starts syncing the counters with other members in the
+// distributed mode.
+func (rl *RateLimiter) startSync() {
+	if rl.spec.Distributed == nil {
+		return
+	}
+
+	super := rl.spec.Super()
+	if super == nil || super.Cluster() == nil {
+		logger.Warnf("%s: cluster is not available, limits are not shared", rl.Name())
+		return
+	}
+
+	rl.cluster = super.Cluster()
+	rl.done = make(chan struct{})
+	go rl.runSync()
+}
+
 // Init initializes RateLimiter.
 func (rl *RateLimiter) Init() {
 	rl.reload(nil)
@@ -253,20 +324,24 @@ func (rl *RateLimiter) Handle(ctx *context.Context) string {
 			continue
 		}
 
-		permitted, d := u.rl.AcquirePermission()
-		if !permitted {
-			ctx.AddTag("rateLimiter: too many requests")
-
-			resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
-			if resp == nil {
-				resp, _ = httpprot.NewResponse(nil)
+		if u.drl != nil {
+			if !u.drl.acquirePermission() {
+				return rl.rejectRequest(ctx)
 			}
+			break
+		}
 
-			resp.SetStatusCode(http.StatusTooManyRequests)
-			resp.HTTPHeader().Set("X-EG-Rate-Limiter", "too-many-requests")
+		limiter := u.rl
+		if u.keyed != nil {
+			// requests without a key share the limiter of the URL.
+			if key := u.KeyExtractor.Extract(req); key != "" {
+				limiter = u.keyed.get(key)
+			}
+		}
 
-			ctx.SetOutputResponse(resp)
-			return resultRateLimited
+		permitted, d := limiter.AcquirePermission()
+		if !permitted {
+			return rl.rejectRequest(ctx)
 		}
 
 		if d <= 0 {
@@ -286,6 +361,22 @@ func (rl *RateLimiter) Handle(ctx *context.Context) string {
 	return ""
 }
 
+func (rl *RateLimiter) rejectRequest(ctx *context.Context) string {
+	ctx.AddTag("rateLimiter: too many requests")
+	rl.rejections.WithLabelValues(rl.spec.Pipeline(), rl.Name()).Inc()
+
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+
+	resp.SetStatusCode(http.StatusTooManyRequests)
+	resp.HTTPHeader().Set("X-EG-Rate-Limiter", "too-many-requests")
+
+	ctx.SetOutputResponse(resp)
+	return resultRateLimited
+}
+
 // Status returns Status generated by Runtime.
 func (rl *RateLimiter) Status() interface{} {
 	return nil
@@ -293,4 +384,7 @@ func (rl *RateLimiter) Status() interface{} {
 
 // Close closes RateLimiter.
 func (rl *RateLimiter) Close() {
+	if rl.done != nil {
+		close(rl.done)
+	}
 }
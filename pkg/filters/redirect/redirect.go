@@ -0,0 +1,250 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package redirect implements the Redirect filter.
+package redirect
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of Redirect.
+	Kind = "Redirect"
+
+	resultRedirected = "redirected"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "Redirect redirects requests by 3xx responses.",
+	Results:     []string{resultRedirected},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &Redirect{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// Redirect is filter Redirect.
+	Redirect struct {
+		spec *Spec
+	}
+
+	// Spec describes the Redirect.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Rules []*Rule `json:"rules" jsonschema:"required,minItems=1"`
+	}
+
+	// Rule is the redirect rule.
+	Rule struct {
+		Match        MatchRule `json:"match" jsonschema:"omitempty"`
+		Scheme       string    `json:"scheme" jsonschema:"omitempty,enum=http,enum=https"`
+		Host         string    `json:"host" jsonschema:"omitempty"`
+		Path         string    `json:"path" jsonschema:"omitempty"`
+		StatusCode   int       `json:"statusCode" jsonschema:"omitempty"`
+		DiscardQuery bool      `json:"discardQuery" jsonschema:"omitempty"`
+
+		pathRegexp *regexp.Regexp
+	}
+
+	// MatchRule is the rule to match a request, all the non-empty fields
+	// must be matched.
+	MatchRule struct {
+		Schemes    []string `json:"schemes" jsonschema:"omitempty,uniqueItems=true"`
+		Hosts      []string `json:"hosts" jsonschema:"omitempty,uniqueItems=true"`
+		PathRegexp string   `json:"pathRegexp" jsonschema:"omitempty,format=regexp"`
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	for i, r := range spec.Rules {
+		switch r.StatusCode {
+		case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+			http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			return fmt.Errorf("rule %d: invalid status code %d", i, r.StatusCode)
+		}
+
+		if r.Scheme == "" && r.Host == "" && r.Path == "" {
+			return fmt.Errorf("rule %d: at least one of scheme, host and path must be specified", i)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the Redirect filter instance.
+func (r *Redirect) Name() string {
+	return r.spec.Name()
+}
+
+// Kind returns the kind of Redirect.
+func (r *Redirect) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the Redirect
+func (r *Redirect) Spec() filters.Spec {
+	return r.spec
+}
+
+// Init initializes Redirect.
+func (r *Redirect) Init() {
+	r.reload()
+}
+
+// Inherit inherits previous generation of Redirect.
+func (r *Redirect) Inherit(previousGeneration filters.Filter) {
+	r.Init()
+}
+
+func (r *Redirect) reload() {
+	for _, rule := range r.spec.Rules {
+		if rule.StatusCode == 0 {
+			rule.StatusCode = http.StatusMovedPermanently
+		}
+		if rule.Match.PathRegexp != "" {
+			rule.pathRegexp = regexp.MustCompile(rule.Match.PathRegexp)
+		}
+	}
+}
+
+// Handle redirects the request if it matches one of the rules.
+func (r *Redirect) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	for _, rule := range r.spec.Rules {
+		if !rule.match(req) {
+			continue
+		}
+
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(rule.StatusCode)
+		resp.HTTPHeader().Set("Location", rule.location(req))
+		ctx.SetOutputResponse(resp)
+		return resultRedirected
+	}
+
+	return ""
+}
+
+func (rule *Rule) match(req *httpprot.Request) bool {
+	m := &rule.Match
+
+	if len(m.Schemes) > 0 && !containsFold(m.Schemes, req.Scheme()) {
+		return false
+	}
+
+	if len(m.Hosts) > 0 && !matchHost(m.Hosts, hostname(req.Host())) {
+		return false
+	}
+
+	if rule.pathRegexp != nil && !rule.pathRegexp.MatchString(req.Path()) {
+		return false
+	}
+
+	return true
+}
+
+// location builds the redirect location of the request.
+func (rule *Rule) location(req *httpprot.Request) string {
+	scheme := rule.Scheme
+	if scheme == "" {
+		scheme = req.Scheme()
+	}
+
+	host := rule.Host
+	if host == "" {
+		host = req.Host()
+	}
+
+	path := req.Path()
+	if rule.Path != "" {
+		if rule.pathRegexp != nil {
+			// capture groups could be referenced as $1, ${name} etc.
+			path = rule.pathRegexp.ReplaceAllString(path, rule.Path)
+		} else {
+			path = rule.Path
+		}
+	}
+
+	query := req.Std().URL.RawQuery
+	if rule.DiscardQuery || query == "" {
+		return scheme + "://" + host + path
+	}
+	if strings.Contains(path, "?") {
+		return scheme + "://" + host + path + "&" + query
+	}
+	return scheme + "://" + host + path + "?" + query
+}
+
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// matchHost matches host with the patterns, a pattern is either an exact
+// host name, or a wildcard one like *.megaease.com.
+func matchHost(patterns []string, host string) bool {
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "*.") {
+			if strings.HasSuffix(strings.ToLower(host), strings.ToLower(p[1:])) {
+				return true
+			}
+		} else if strings.EqualFold(p, host) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Status returns status.
+func (r *Redirect) Status() interface{} {
+	return nil
+}
+
+// Close closes Redirect.
+func (r *Redirect) Close() {
+}
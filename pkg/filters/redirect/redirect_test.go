@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package redirect
+
+import (
+	"crypto/tls"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func TestRedirect(t *testing.T) {
+	assert := assert.New(t)
+
+	const yamlConfig = `
+kind: Redirect
+name: redirect
+rules:
+- match:
+    schemes: ["http"]
+    hosts: ["megaease.com"]
+  scheme: https
+  statusCode: 308
+- match:
+    hosts: ["*.megaease.cn"]
+    pathRegexp: ^/blog/(\d+)/(?P<slug>.*)$
+  host: blog.megaease.com
+  path: /articles/${slug}?id=$1
+- match:
+    pathRegexp: ^/old
+  path: /new
+  discardQuery: true
+`
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+
+	r := kind.CreateInstance(spec)
+	r.Init()
+
+	handle := func(url string, https bool) (string, *httpprot.Response) {
+		ctx := context.New(nil)
+		stdr, _ := http.NewRequest(http.MethodGet, url, nil)
+		if https {
+			stdr.TLS = &tls.ConnectionState{}
+		}
+		req, _ := httpprot.NewRequest(stdr)
+		ctx.SetInputRequest(req)
+		result := r.Handle(ctx)
+		resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+		return result, resp
+	}
+
+	result, resp := handle("http://megaease.com/abc?x=1", false)
+	assert.Equal(resultRedirected, result)
+	assert.Equal(http.StatusPermanentRedirect, resp.StatusCode())
+	assert.Equal("https://megaease.com/abc?x=1", resp.HTTPHeader().Get("Location"))
+
+	result, _ = handle("https://megaease.com/abc", true)
+	assert.Equal("", result)
+
+	result, resp = handle("https://www.megaease.cn:8443/blog/12/hello?x=1", true)
+	assert.Equal(resultRedirected, result)
+	assert.Equal(http.StatusMovedPermanently, resp.StatusCode())
+	assert.Equal("https://blog.megaease.com/articles/hello?id=12&x=1", resp.HTTPHeader().Get("Location"))
+
+	result, resp = handle("http://megaease.io/old?x=1", false)
+	assert.Equal(resultRedirected, result)
+	assert.Equal("http://megaease.io/new", resp.HTTPHeader().Get("Location"))
+
+	result, _ = handle("http://megaease.io/other", false)
+	assert.Equal("", result)
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Rules: []*Rule{{Scheme: "https", StatusCode: 200}}}
+	assert.Error(spec.Validate())
+
+	spec.Rules[0] = &Rule{}
+	assert.Error(spec.Validate())
+
+	spec.Rules[0] = &Rule{Path: "/new", StatusCode: http.StatusFound}
+	assert.NoError(spec.Validate())
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package remotefilter
+
+import (
+	"crypto/tls"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+type (
+	// GRPCSpec describes the remote gRPC service, which implements the
+	// Filter service of the ExternalFilter.
+	GRPCSpec struct {
+		// Address is the address of the service, e.g. 127.0.0.1:9100.
+		Address string `json:"address" jsonschema:"required"`
+		TLS     bool   `json:"tls" jsonschema:"omitempty"`
+	}
+
+	// connPool shares the persistent connections among the RemoteFilters,
+	// including the different generations of the same filter, so updating
+	// a pipeline doesn't reconnect.
+	connPool struct {
+		mutex sync.Mutex
+		conns map[GRPCSpec]*pooledConn
+	}
+
+	pooledConn struct {
+		conn *grpc.ClientConn
+		refs int
+	}
+)
+
+var globalConnPool = &connPool{conns: map[GRPCSpec]*pooledConn{}}
+
+// get returns the connection to the service, the caller must call put to
+// release it.
+func (p *connPool) get(spec GRPCSpec) (*grpc.ClientConn, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if pc := p.conns[spec]; pc != nil {
+		pc.refs++
+		return pc.conn, nil
+	}
+
+	creds := insecure.NewCredentials()
+	if spec.TLS {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+
+	// the connection is established in background, failures are reported
+	// by the calls.
+	conn, err := grpc.Dial(spec.Address,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                30 * time.Second,
+			Timeout:             10 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	p.conns[spec] = &pooledConn{conn: conn, refs: 1}
+	return conn, nil
+}
+
+// put releases the connection, it is closed if no one uses it.
+func (p *connPool) put(spec GRPCSpec) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	pc := p.conns[spec]
+	if pc == nil {
+		return
+	}
+	pc.refs--
+	if pc.refs == 0 {
+		pc.conn.Close()
+		delete(p.conns, spec)
+	}
+}
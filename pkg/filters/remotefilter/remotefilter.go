@@ -27,11 +27,16 @@ import (
 	"net/http"
 	"time"
 
+	"google.golang.org/grpc"
+
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/filters/externalfilter/sdk"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/protocols/httpprot/httpstat"
 	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/fasttime"
 	"github.com/megaease/easegress/pkg/util/stringtool"
 )
 
@@ -111,18 +116,44 @@ type (
 	// RemoteFilter is the filter making remote service acting like internal filter.
 	RemoteFilter struct {
 		spec *Spec
+
+		// headers are the canonical names of the forwarded headers, all
+		// headers are forwarded if it is empty.
+		headers  map[string]struct{}
+		conn     *grpc.ClientConn
+		httpStat *httpstat.HTTPStat
 	}
 
 	// Spec describes RemoteFilter.
 	Spec struct {
 		filters.BaseSpec `json:",inline"`
 
-		URL     string `json:"url" jsonschema:"required,format=uri"`
-		Timeout string `json:"timeout" jsonschema:"omitempty,format=duration"`
+		URL     string    `json:"url,omitempty" jsonschema:"omitempty,format=uri"`
+		GRPC    *GRPCSpec `json:"grpc,omitempty" jsonschema:"omitempty"`
+		Timeout string    `json:"timeout" jsonschema:"omitempty,format=duration"`
+
+		// AllowedHeaders are the request headers forwarded to the remote
+		// service, all headers are forwarded if it is empty.
+		AllowedHeaders []string  `json:"allowedHeaders" jsonschema:"omitempty"`
+		Body           *BodySpec `json:"body,omitempty" jsonschema:"omitempty"`
 
 		timeout time.Duration
 	}
 
+	// BodySpec describes how the request body is forwarded.
+	BodySpec struct {
+		MaxBytes int `json:"maxBytes" jsonschema:"required,minimum=0"`
+		// AllowPartial forwards the first MaxBytes of larger bodies instead
+		// of failing.
+		AllowPartial bool `json:"allowPartial" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of RemoteFilter.
+	Status struct {
+		Endpoint string           `json:"endpoint"`
+		Stat     *httpstat.Status `json:"stat"`
+	}
+
 	contextEntity struct {
 		Request  *requestEntity  `json:"request"`
 		Response *responseEntity `json:"response"`
@@ -144,6 +175,9 @@ type (
 		Header http.Header `json:"header"`
 
 		Body []byte `json:"body"`
+		// BodyTruncated is true if the body is not forwarded as a whole,
+		// the body of the request is kept then.
+		BodyTruncated bool `json:"bodyTruncated,omitempty"`
 	}
 
 	responseEntity struct {
@@ -153,14 +187,37 @@ type (
 	}
 )
 
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if (spec.URL == "") == (spec.GRPC == nil) {
+		return fmt.Errorf("one and only one of url and grpc is required")
+	}
+	return nil
+}
+
 // Init initializes RemoteFilter.
 func (rf *RemoteFilter) Init() {
+	rf.httpStat = httpstat.New()
 	rf.reload()
 }
 
 // Inherit inherits previous generation of RemoteFilter.
 func (rf *RemoteFilter) Inherit(previousGeneration filters.Filter) {
-	rf.Init()
+	// keep the statistics if the endpoint doesn't change.
+	prev := previousGeneration.(*RemoteFilter)
+	if prev.endpoint() == rf.endpoint() {
+		rf.httpStat = prev.httpStat
+	} else {
+		rf.httpStat = httpstat.New()
+	}
+	rf.reload()
+}
+
+func (rf *RemoteFilter) endpoint() string {
+	if rf.spec.GRPC != nil {
+		return "grpc://" + rf.spec.GRPC.Address
+	}
+	return rf.spec.URL
 }
 
 func (rf *RemoteFilter) reload() {
@@ -171,6 +228,20 @@ func (rf *RemoteFilter) reload() {
 			logger.Errorf("BUG: parse duration %s failed: %v", rf.spec.Timeout, err)
 		}
 	}
+
+	if len(rf.spec.AllowedHeaders) > 0 {
+		rf.headers = map[string]struct{}{}
+		for _, h := range rf.spec.AllowedHeaders {
+			rf.headers[http.CanonicalHeaderKey(h)] = struct{}{}
+		}
+	}
+
+	if rf.spec.GRPC != nil {
+		rf.conn, err = globalConnPool.get(*rf.spec.GRPC)
+		if err != nil {
+			logger.Errorf("RemoteFilter %s: dial %s failed: %v", rf.Name(), rf.spec.GRPC.Address, err)
+		}
+	}
 }
 
 func (rf *RemoteFilter) limitRead(reader io.Reader, n int64) []byte {
@@ -191,6 +262,52 @@ func (rf *RemoteFilter) limitRead(reader io.Reader, n int64) []byte {
 	return buff.Bytes()
 }
 
+// readRequestBody reads the forwarded request body, truncated is true if
+// the body is not forwarded as a whole.
+func (rf *RemoteFilter) readRequestBody(r *httpprot.Request) (body []byte, truncated bool) {
+	if rf.spec.Body == nil {
+		return rf.limitRead(r.GetPayload(), maxBodyBytes), false
+	}
+
+	// the stream is never read, so it is kept for the following filters.
+	if r.IsStream() {
+		return nil, true
+	}
+
+	body = r.RawPayload()
+	if len(body) <= rf.spec.Body.MaxBytes {
+		return body, false
+	}
+	if !rf.spec.Body.AllowPartial {
+		panic(fmt.Errorf("larger than %dB", rf.spec.Body.MaxBytes))
+	}
+	return body[:rf.spec.Body.MaxBytes], true
+}
+
+// forwardedHeader returns the forwarded request headers.
+func (rf *RemoteFilter) forwardedHeader(r *httpprot.Request) http.Header {
+	if rf.headers == nil {
+		return r.Std().Header
+	}
+
+	header := http.Header{}
+	for k := range rf.headers {
+		if vs := r.HTTPHeader().Values(k); len(vs) > 0 {
+			header[k] = vs
+		}
+	}
+	return header
+}
+
+func (rf *RemoteFilter) stat(startTime time.Time, statusCode int, reqSize, respSize int) {
+	rf.httpStat.Stat(&httpstat.Metric{
+		StatusCode: statusCode,
+		Duration:   fasttime.Since(startTime),
+		ReqSize:    uint64(reqSize),
+		RespSize:   uint64(respSize),
+	})
+}
+
 // Handle handles Context by calling remote service.
 func (rf *RemoteFilter) Handle(ctx *context.Context) (result string) {
 	r := ctx.GetInputRequest().(*httpprot.Request)
@@ -216,13 +333,18 @@ func (rf *RemoteFilter) Handle(ctx *context.Context) (result string) {
 	}()
 
 	errPrefix = "read request body"
-	reqBody := rf.limitRead(r.GetPayload(), maxBodyBytes)
+	reqBody, truncated := rf.readRequestBody(r)
 
 	errPrefix = "read response body"
 	respBody := rf.limitRead(w.GetPayload(), maxBodyBytes)
 
+	if rf.spec.GRPC != nil {
+		errPrefix = "call grpc service"
+		return rf.handleGRPC(r, w, reqBody, respBody, truncated)
+	}
+
 	errPrefix = "marshal context"
-	ctxBuff := rf.marshalHTTPContext(r, w, reqBody, respBody)
+	ctxBuff := rf.marshalHTTPContext(r, w, reqBody, respBody, truncated)
 
 	var (
 		req *http.Request
@@ -245,20 +367,24 @@ func (rf *RemoteFilter) Handle(ctx *context.Context) (result string) {
 	}
 
 	errPrefix = "do request"
+	startTime := fasttime.Now()
 	resp, err := globalClient.Do(req)
 	if err != nil {
+		rf.stat(startTime, http.StatusServiceUnavailable, len(ctxBuff), 0)
 		panic(err)
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode >= 300 {
+		rf.stat(startTime, resp.StatusCode, len(ctxBuff), 0)
 		panic(fmt.Errorf("not 2xx status code: %d", resp.StatusCode))
 	}
 
 	errPrefix = "read remote body"
-	ctxBuff = rf.limitRead(resp.Body, maxContextBytes)
+	respBuff := rf.limitRead(resp.Body, maxContextBytes)
+	rf.stat(startTime, resp.StatusCode, len(ctxBuff), len(respBuff))
 
 	errPrefix = "unmarshal context"
-	rf.unmarshalHTTPContext(r, w, ctxBuff)
+	rf.unmarshalHTTPContext(r, w, respBuff, truncated)
 
 	if resp.StatusCode == 205 {
 		return resultResponseAlready
@@ -267,25 +393,102 @@ func (rf *RemoteFilter) Handle(ctx *context.Context) (result string) {
 	return ""
 }
 
+// handleGRPC calls the Handle method of the Filter service, the returned
+// request is applied like the HTTP mode, and the filter returns
+// responseAlready if a response is returned.
+func (rf *RemoteFilter) handleGRPC(r *httpprot.Request, w *httpprot.Response, reqBody, respBody []byte, truncated bool) string {
+	if rf.conn == nil {
+		panic(fmt.Errorf("connection is unavailable"))
+	}
+
+	in := sdk.MarshalHandleRequest(&sdk.HandleRequest{
+		Filter: rf.Name(),
+		Request: &sdk.Request{
+			Method:      r.Method(),
+			Path:        r.Path(),
+			Query:       r.URL().RawQuery,
+			Host:        r.Host(),
+			Scheme:      r.Scheme(),
+			RealIP:      r.RealIP(),
+			Header:      rf.forwardedHeader(r),
+			Body:        reqBody,
+			BodyOmitted: truncated,
+		},
+		Response: &sdk.Response{
+			StatusCode: w.StatusCode(),
+			Header:     w.Std().Header,
+			Body:       respBody,
+		},
+	})
+
+	ctx := stdcontext.Background()
+	if rf.spec.timeout > 0 {
+		var cancel stdcontext.CancelFunc
+		ctx, cancel = stdcontext.WithTimeout(ctx, rf.spec.timeout)
+		defer cancel()
+	}
+
+	var out []byte
+	startTime := fasttime.Now()
+	err := rf.conn.Invoke(ctx, sdk.HandleMethod, &in, &out, grpc.ForceCodec(sdk.Codec{}))
+	if err != nil {
+		rf.stat(startTime, http.StatusServiceUnavailable, len(in), 0)
+		panic(err)
+	}
+	rf.stat(startTime, http.StatusOK, len(in), len(out))
+
+	hr, err := sdk.UnmarshalHandleResponse(out)
+	if err != nil {
+		panic(err)
+	}
+
+	if hr.Request != nil {
+		rf.applyRequest(r, &requestEntity{
+			Method: hr.Request.Method,
+			Path:   hr.Request.Path,
+			Query:  hr.Request.Query,
+			Header: hr.Request.Header,
+			Body:   hr.Request.Body,
+		}, truncated || hr.Request.BodyOmitted)
+	}
+
+	if hr.Response == nil {
+		return ""
+	}
+	applyResponse(w, &responseEntity{
+		StatusCode: hr.Response.StatusCode,
+		Header:     hr.Response.Header,
+		Body:       hr.Response.Body,
+	})
+	return resultResponseAlready
+}
+
 // Status returns status.
-func (rf *RemoteFilter) Status() interface{} { return nil }
+func (rf *RemoteFilter) Status() interface{} {
+	return &Status{Endpoint: rf.endpoint(), Stat: rf.httpStat.Status()}
+}
 
 // Close closes RemoteFilter.
-func (rf *RemoteFilter) Close() {}
+func (rf *RemoteFilter) Close() {
+	if rf.conn != nil {
+		globalConnPool.put(*rf.spec.GRPC)
+	}
+}
 
-func (rf *RemoteFilter) marshalHTTPContext(r *httpprot.Request, w *httpprot.Response, reqBody, respBody []byte) []byte {
+func (rf *RemoteFilter) marshalHTTPContext(r *httpprot.Request, w *httpprot.Response, reqBody, respBody []byte, truncated bool) []byte {
 	ctxEntity := contextEntity{
 		Request: &requestEntity{
-			RealIP:   r.RealIP(),
-			Method:   r.Method(),
-			Scheme:   r.Scheme(),
-			Host:     r.Host(),
-			Path:     r.Path(),
-			Query:    r.URL().RawQuery,
-			Fragment: r.URL().Fragment,
-			Proto:    r.Proto(),
-			Header:   r.Std().Header,
-			Body:     reqBody,
+			RealIP:        r.RealIP(),
+			Method:        r.Method(),
+			Scheme:        r.Scheme(),
+			Host:          r.Host(),
+			Path:          r.Path(),
+			Query:         r.URL().RawQuery,
+			Fragment:      r.URL().Fragment,
+			Proto:         r.Proto(),
+			Header:        rf.forwardedHeader(r),
+			Body:          reqBody,
+			BodyTruncated: truncated,
 		},
 		Response: &responseEntity{
 			StatusCode: w.StatusCode(),
@@ -302,7 +505,7 @@ func (rf *RemoteFilter) marshalHTTPContext(r *httpprot.Request, w *httpprot.Resp
 	return buff
 }
 
-func (rf *RemoteFilter) unmarshalHTTPContext(r *httpprot.Request, w *httpprot.Response, buff []byte) {
+func (rf *RemoteFilter) unmarshalHTTPContext(r *httpprot.Request, w *httpprot.Response, buff []byte, truncated bool) {
 	ctxEntity := &contextEntity{}
 
 	err := codectool.Unmarshal(buff, ctxEntity)
@@ -312,11 +515,35 @@ func (rf *RemoteFilter) unmarshalHTTPContext(r *httpprot.Request, w *httpprot.Re
 
 	re, we := ctxEntity.Request, ctxEntity.Response
 
-	r.SetMethod(re.Method)
-	r.SetPath(re.Path)
+	// the request is kept if the remote service doesn't return it.
+	if re != nil {
+		rf.applyRequest(r, re, truncated)
+	}
+
+	if we == nil {
+		return
+	}
+
+	applyResponse(w, we)
+}
+
+// applyRequest applies the request returned by the remote service, only
+// the forwarded headers are replaced, and the body is kept if it was not
+// forwarded as a whole.
+func (rf *RemoteFilter) applyRequest(r *httpprot.Request, re *requestEntity, truncated bool) {
+	if re.Method != "" {
+		r.SetMethod(re.Method)
+	}
+	if re.Path != "" {
+		r.SetPath(re.Path)
+	}
 	r.URL().RawQuery = re.Query
 	r.Header().Walk(func(key string, values interface{}) bool {
-		r.Header().Del(key)
+		if rf.headers == nil {
+			r.Header().Del(key)
+		} else if _, ok := rf.headers[http.CanonicalHeaderKey(key)]; ok {
+			r.Header().Del(key)
+		}
 		return true
 	})
 	for k, vs := range re.Header {
@@ -325,17 +552,19 @@ func (rf *RemoteFilter) unmarshalHTTPContext(r *httpprot.Request, w *httpprot.Re
 		}
 	}
 
+	if truncated {
+		return
+	}
+
 	if r.IsStream() {
 		if c, ok := r.GetPayload().(io.Closer); ok {
 			c.Close()
 		}
 	}
 	r.SetPayload(re.Body)
+}
 
-	if we == nil {
-		return
-	}
-
+func applyResponse(w *httpprot.Response, we *responseEntity) {
 	if we.StatusCode < 200 || we.StatusCode >= 600 {
 		panic(fmt.Errorf("invalid status code: %d", we.StatusCode))
 	}
@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package remotefilter
+
+import (
+	stdcontext "context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/filters/externalfilter/sdk"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newTestRemoteFilter(t *testing.T, yamlConfig string) *RemoteFilter {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "pipeline", rawSpec)
+	if err != nil {
+		t.Fatalf("failed to create spec: %v", err)
+	}
+	rf := kind.CreateInstance(spec).(*RemoteFilter)
+	rf.Init()
+	return rf
+}
+
+func newContext(body string) *context.Context {
+	ctx := context.New(nil)
+	stdReq, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1/orders?id=1", strings.NewReader(body))
+	stdReq.Header.Set("X-User", "alice")
+	stdReq.Header.Set("Authorization", "Bearer token")
+	req, _ := httpprot.NewRequest(stdReq)
+	req.FetchPayload(0)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error((&Spec{}).Validate())
+	assert.Error((&Spec{URL: "http://127.0.0.1", GRPC: &GRPCSpec{}}).Validate())
+	assert.NoError((&Spec{URL: "http://127.0.0.1"}).Validate())
+	assert.NoError((&Spec{GRPC: &GRPCSpec{Address: "127.0.0.1:9100"}}).Validate())
+}
+
+func TestHTTPPartialForwarding(t *testing.T) {
+	assert := assert.New(t)
+
+	var received *contextEntity
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = &contextEntity{}
+		json.Unmarshal(body, received)
+
+		re := received.Request
+		re.Header.Set("X-User", strings.ToUpper(re.Header.Get("X-User")))
+		re.Body = []byte("replaced")
+		json.NewEncoder(w).Encode(&contextEntity{Request: re})
+	}))
+	defer server.Close()
+
+	rf := newTestRemoteFilter(t, `
+kind: RemoteFilter
+name: remote
+url: `+server.URL+`
+allowedHeaders: [X-User]
+body:
+  maxBytes: 4
+  allowPartial: true
+`)
+	defer rf.Close()
+
+	ctx := newContext("hello")
+	assert.Equal("", rf.Handle(ctx))
+	assert.Equal(http.Header{"X-User": {"alice"}}, received.Request.Header)
+	assert.Equal("hell", string(received.Request.Body))
+	assert.True(received.Request.BodyTruncated)
+
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("ALICE", req.HTTPHeader().Get("X-User"))
+	assert.Equal("Bearer token", req.HTTPHeader().Get("Authorization"))
+	assert.Equal("hello", string(req.RawPayload()))
+
+	// the whole body is forwarded and replaced.
+	ctx = newContext("hi")
+	assert.Equal("", rf.Handle(ctx))
+	assert.False(received.Request.BodyTruncated)
+	assert.Equal("replaced", string(ctx.GetInputRequest().(*httpprot.Request).RawPayload()))
+
+	status := rf.Status().(*Status)
+	assert.Equal(server.URL, status.Endpoint)
+	assert.Equal(uint64(2), status.Stat.Count)
+	assert.Equal(uint64(0), status.Stat.ErrCount)
+}
+
+func TestGRPC(t *testing.T) {
+	assert := assert.New(t)
+
+	h := sdk.HandlerFunc(func(ctx stdcontext.Context, req *sdk.HandleRequest) (*sdk.HandleResponse, error) {
+		r := req.Request
+		if r.Header.Get("X-User") != "alice" {
+			return &sdk.HandleResponse{Response: &sdk.Response{
+				StatusCode: http.StatusForbidden,
+				Body:       []byte("go away"),
+			}}, nil
+		}
+		r.Path = "/v2" + r.Path
+		r.Header.Set("X-Filter", req.Filter)
+		return &sdk.HandleResponse{Request: r}, nil
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	s := sdk.NewServer(h)
+	go s.Serve(l)
+	defer s.Stop()
+
+	rf := newTestRemoteFilter(t, `
+kind: RemoteFilter
+name: remote
+grpc:
+  address: `+l.Addr().String()+`
+timeout: 1s
+`)
+	rf2 := newTestRemoteFilter(t, `
+kind: RemoteFilter
+name: remote2
+grpc:
+  address: `+l.Addr().String()+`
+`)
+	assert.Same(rf.conn, rf2.conn)
+	rf2.Close()
+	defer rf.Close()
+
+	ctx := newContext("hello")
+	assert.Equal("", rf.Handle(ctx))
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("/v2/orders", req.Path())
+	assert.Equal("remote", req.HTTPHeader().Get("X-Filter"))
+	assert.Equal("Bearer token", req.HTTPHeader().Get("Authorization"))
+	assert.Equal("hello", string(req.RawPayload()))
+
+	ctx = newContext("")
+	ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Set("X-User", "bob")
+	assert.Equal(resultResponseAlready, rf.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusForbidden, resp.StatusCode())
+	assert.Equal("go away", string(resp.RawPayload()))
+
+	s.Stop()
+	assert.Equal(resultFailed, rf.Handle(newContext("")))
+
+	status := rf.Status().(*Status)
+	assert.Equal(uint64(3), status.Stat.Count)
+	assert.Equal(uint64(1), status.Stat.ErrCount)
+}
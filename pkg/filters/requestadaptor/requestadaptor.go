@@ -18,10 +18,16 @@
 package requestadaptor
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"net/http"
+	"sort"
+	"text/template"
 	"time"
 
+	sprig "github.com/go-task/slim-sprig"
+
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/filters"
 	"github.com/megaease/easegress/pkg/logger"
@@ -129,8 +135,9 @@ type (
 	RequestAdaptor struct {
 		spec *Spec
 
-		pa     *pathadaptor.PathAdaptor
-		signer *signer.Signer
+		pa        *pathadaptor.PathAdaptor
+		signer    *signer.Signer
+		templates map[string]*template.Template
 	}
 
 	// Spec is HTTPAdaptor Spec.
@@ -141,10 +148,17 @@ type (
 		Method     string                `json:"method" jsonschema:"omitempty,format=httpmethod"`
 		Path       *pathadaptor.Spec     `json:"path,omitempty" jsonschema:"omitempty"`
 		Header     *httpheader.AdaptSpec `json:"header,omitempty" jsonschema:"omitempty"`
+		Query      *httpheader.AdaptSpec `json:"query,omitempty" jsonschema:"omitempty"`
+		Cookie     *httpheader.AdaptSpec `json:"cookie,omitempty" jsonschema:"omitempty"`
 		Body       string                `json:"body" jsonschema:"omitempty"`
 		Compress   string                `json:"compress" jsonschema:"omitempty"`
 		Decompress string                `json:"decompress" jsonschema:"omitempty"`
 		Sign       *SignerSpec           `json:"sign,omitempty" jsonschema:"omitempty"`
+		// Template makes the host, the replace and addPrefix of the path,
+		// and the values to set or add of the header, query and cookie
+		// templates, which are executed with the request and the context
+		// data.
+		Template bool `json:"template" jsonschema:"omitempty"`
 	}
 
 	// SignerSpec is the spec of the request signer.
@@ -174,6 +188,16 @@ func (spec *Spec) Validate() error {
 	if spec.Body != "" && spec.Decompress != "" {
 		return fmt.Errorf("No need to decompress when body is specified in RequestAdaptor spec")
 	}
+	if spec.Template {
+		if _, err := parseTemplates(spec); err != nil {
+			return err
+		}
+		if spec.Path != nil {
+			if _, err := pathadaptor.NewWithTemplate(spec.Path); err != nil {
+				return fmt.Errorf("invalid path template: %v", err)
+			}
+		}
+	}
 	if spec.Sign == nil {
 		return nil
 	}
@@ -213,7 +237,13 @@ func (ra *RequestAdaptor) Inherit(previousGeneration filters.Filter) {
 }
 
 func (ra *RequestAdaptor) reload() {
-	if ra.spec.Path != nil {
+	if ra.spec.Template {
+		// templates have been validated, so no error here.
+		ra.templates, _ = parseTemplates(ra.spec)
+		if ra.spec.Path != nil {
+			ra.pa, _ = pathadaptor.NewWithTemplate(ra.spec.Path)
+		}
+	} else if ra.spec.Path != nil {
 		ra.pa = pathadaptor.New(ra.spec.Path)
 	}
 	if s := ra.spec.Sign; s != nil {
@@ -226,6 +256,89 @@ func (ra *RequestAdaptor) reload() {
 	}
 }
 
+// parseTemplates parses the templates of the spec, the returned map is
+// keyed by the text of the templates.
+func parseTemplates(spec *Spec) (map[string]*template.Template, error) {
+	templates := map[string]*template.Template{}
+
+	parse := func(text string) error {
+		if _, ok := templates[text]; ok {
+			return nil
+		}
+		t, err := template.New("").Funcs(sprig.TxtFuncMap()).Parse(text)
+		if err != nil {
+			return fmt.Errorf("invalid template %q: %v", text, err)
+		}
+		templates[text] = t
+		return nil
+	}
+
+	if spec.Host != "" {
+		if err := parse(spec.Host); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, as := range []*httpheader.AdaptSpec{spec.Header, spec.Query, spec.Cookie} {
+		if as == nil {
+			continue
+		}
+		for _, value := range as.Set {
+			if err := parse(value); err != nil {
+				return nil, err
+			}
+		}
+		for _, value := range as.Add {
+			if err := parse(value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return templates, nil
+}
+
+// render returns the text itself if templates are not enabled, otherwise
+// it returns the result of the template of the text.
+func (ra *RequestAdaptor) render(text string, data map[string]interface{}) string {
+	t := ra.templates[text]
+	if t == nil {
+		return text
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		logger.Warnf("failed to execute template of RequestAdaptor %s: %v", ra.Name(), err)
+		return ""
+	}
+	return buf.String()
+}
+
+// renderSpec returns the adapt spec whose values to set or add are
+// rendered.
+func (ra *RequestAdaptor) renderSpec(as *httpheader.AdaptSpec, data map[string]interface{}) *httpheader.AdaptSpec {
+	if ra.templates == nil {
+		return as
+	}
+
+	render := func(m map[string]string) map[string]string {
+		if m == nil {
+			return nil
+		}
+		result := make(map[string]string, len(m))
+		for key, value := range m {
+			result[key] = ra.render(value, data)
+		}
+		return result
+	}
+
+	return &httpheader.AdaptSpec{
+		Del: as.Del,
+		Set: render(as.Set),
+		Add: render(as.Add),
+	}
+}
+
 func adaptHeader(req *httpprot.Request, as *httpheader.AdaptSpec) {
 	h := req.Std().Header
 	for _, key := range as.Del {
@@ -239,18 +352,95 @@ func adaptHeader(req *httpprot.Request, as *httpheader.AdaptSpec) {
 	}
 }
 
+func adaptQuery(req *httpprot.Request, as *httpheader.AdaptSpec) {
+	u := req.Std().URL
+	q := u.Query()
+	for _, key := range as.Del {
+		q.Del(key)
+	}
+	for key, value := range as.Set {
+		q.Set(key, value)
+	}
+	for key, value := range as.Add {
+		q.Add(key, value)
+	}
+	u.RawQuery = q.Encode()
+}
+
+// sortedKeys returns the keys of m in order, so the cookies are always
+// added in the same order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// adaptCookie adapts the cookies of the request, a cookie to set replaces
+// the first cookie of the same name and removes the others, or is appended
+// if there's no such cookie.
+func adaptCookie(req *httpprot.Request, as *httpheader.AdaptSpec) {
+	del := make(map[string]struct{}, len(as.Del))
+	for _, name := range as.Del {
+		del[name] = struct{}{}
+	}
+
+	set := make(map[string]bool, len(as.Set))
+	cookies := make([]*http.Cookie, 0)
+	for _, c := range req.Cookies() {
+		if _, ok := del[c.Name]; ok {
+			continue
+		}
+		if value, ok := as.Set[c.Name]; ok {
+			if set[c.Name] {
+				continue
+			}
+			set[c.Name] = true
+			c = &http.Cookie{Name: c.Name, Value: value}
+		}
+		cookies = append(cookies, c)
+	}
+
+	for _, name := range sortedKeys(as.Set) {
+		if !set[name] {
+			cookies = append(cookies, &http.Cookie{Name: name, Value: as.Set[name]})
+		}
+	}
+	for _, name := range sortedKeys(as.Add) {
+		cookies = append(cookies, &http.Cookie{Name: name, Value: as.Add[name]})
+	}
+
+	stdr := req.Std()
+	stdr.Header.Del("Cookie")
+	for _, c := range cookies {
+		stdr.AddCookie(c)
+	}
+}
+
 // Handle adapts request.
 func (ra *RequestAdaptor) Handle(ctx *context.Context) string {
 	req := ctx.GetInputRequest().(*httpprot.Request)
 	method, path := req.Method(), req.Path()
 
+	// the template data is prepared before any change of the request, so
+	// all templates see the original request.
+	var data map[string]interface{}
+	if ra.spec.Template {
+		data = map[string]interface{}{
+			"request": req.ToBuilderRequest(""),
+			"data":    ctx.Data(),
+		}
+	}
+
 	if ra.spec.Method != "" && ra.spec.Method != method {
 		ctx.AddTag(stringtool.Cat("requestAdaptor: method ", method, " adapted to ", ra.spec.Method))
 		req.SetMethod(ra.spec.Method)
 	}
 
 	if ra.pa != nil {
-		adaptedPath := ra.pa.Adapt(path)
+		adaptedPath := ra.pa.AdaptWithData(path, data)
 		if adaptedPath != path {
 			ctx.AddTag(stringtool.Cat("requestAdaptor: path ", path, " adapted to ", adaptedPath))
 		}
@@ -258,7 +448,15 @@ func (ra *RequestAdaptor) Handle(ctx *context.Context) string {
 	}
 
 	if ra.spec.Header != nil {
-		adaptHeader(req, ra.spec.Header)
+		adaptHeader(req, ra.renderSpec(ra.spec.Header, data))
+	}
+
+	if ra.spec.Query != nil {
+		adaptQuery(req, ra.renderSpec(ra.spec.Query, data))
+	}
+
+	if ra.spec.Cookie != nil {
+		adaptCookie(req, ra.renderSpec(ra.spec.Cookie, data))
 	}
 
 	if len(ra.spec.Body) != 0 {
@@ -267,7 +465,10 @@ func (ra *RequestAdaptor) Handle(ctx *context.Context) string {
 	}
 
 	if len(ra.spec.Host) != 0 {
-		req.SetHost(ra.spec.Host)
+		req.SetHost(ra.render(ra.spec.Host, data))
+		// let the proxy keep the host even if the server address is a
+		// host name.
+		ctx.SetData(httpprot.DataHostRewritten, req)
 	}
 
 	if ra.spec.Compress != "" {
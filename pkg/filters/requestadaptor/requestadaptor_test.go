@@ -311,3 +311,70 @@ func TestHandle(t *testing.T) {
 
 	assert.Contains(req.Header.Get("Authorization"), " SignedHeaders=host;x-add;x-amz-date;x-set,")
 }
+
+func TestQueryCookieAndHost(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := defaultFilterSpec(&Spec{
+		Host: "{{.request.Header.Get \"X-Tenant\"}}.example.com",
+		Path: &pathadaptor.Spec{AddPrefix: "/{{.data.version}}"},
+		Query: &httpheader.AdaptSpec{
+			Del: []string{"debug"},
+			Set: map[string]string{"id": "2"},
+			Add: map[string]string{"tenant": "{{.request.Header.Get \"X-Tenant\"}}"},
+		},
+		Cookie: &httpheader.AdaptSpec{
+			Del: []string{"tracking"},
+			Set: map[string]string{"session": "{{.request.URL.Query.Get \"id\"}}", "lang": "en"},
+			Add: map[string]string{"via": "easegress"},
+		},
+		Template: true,
+	})
+	ra := kind.CreateInstance(spec)
+	ra.Init()
+
+	req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1/orders?id=1&debug=true", nil)
+	assert.Nil(err)
+	req.Header.Set("X-Tenant", "acme")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "old"})
+	req.AddCookie(&http.Cookie{Name: "tracking", Value: "t"})
+	req.AddCookie(&http.Cookie{Name: "theme", Value: "dark"})
+
+	ctx := context.New(nil)
+	ctx.SetData("version", "v2")
+	setRequest(t, ctx, req)
+
+	assert.Equal("", ra.Handle(ctx))
+	r := ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("acme.example.com", r.Host())
+	assert.Same(r, ctx.GetData(httpprot.DataHostRewritten))
+	assert.Equal("/v2/orders", r.Path())
+	assert.Equal("id=2&tenant=acme", r.Std().URL.RawQuery)
+	assert.Equal("session=1; theme=dark; lang=en; via=easegress", r.HTTPHeader().Get("Cookie"))
+
+	// templates are not enabled.
+	spec = defaultFilterSpec(&Spec{
+		Query:  &httpheader.AdaptSpec{Set: map[string]string{"q": "{{.x}}"}},
+		Cookie: &httpheader.AdaptSpec{Del: []string{"session"}},
+	})
+	ra = kind.CreateInstance(spec)
+	ra.Init()
+
+	req, err = http.NewRequest(http.MethodGet, "http://127.0.0.1/orders", nil)
+	assert.Nil(err)
+	req.AddCookie(&http.Cookie{Name: "session", Value: "old"})
+	ctx = context.New(nil)
+	setRequest(t, ctx, req)
+
+	assert.Equal("", ra.Handle(ctx))
+	r = ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("q=%7B%7B.x%7D%7D", r.Std().URL.RawQuery)
+	assert.Equal("", r.HTTPHeader().Get("Cookie"))
+	assert.Nil(ctx.GetData(httpprot.DataHostRewritten))
+
+	// invalid template.
+	assert.Nil(defaultFilterSpec(&Spec{
+		Query:    &httpheader.AdaptSpec{Set: map[string]string{"q": "{{.x"}},
+		Template: true,
+	}))
+}
@@ -18,7 +18,10 @@
 package responseadaptor
 
 import (
+	"fmt"
 	"io"
+	"mime"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -40,8 +43,18 @@ const (
 
 	keyContentLength   = "Content-Length"
 	keyContentEncoding = "Content-Encoding"
+	keyContentType     = "Content-Type"
 )
 
+// defaultReplaceContentTypes are the content types of the responses whose
+// body is replaced by default.
+var defaultReplaceContentTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+}
+
 var kind = &filters.Kind{
 	Name:        Kind,
 	Description: "ResponseAdaptor adapts response.",
@@ -66,6 +79,8 @@ type (
 	// ResponseAdaptor is filter ResponseAdaptor.
 	ResponseAdaptor struct {
 		spec *Spec
+
+		rules []*replaceRule
 	}
 
 	// Spec is HTTPAdaptor Spec.
@@ -76,9 +91,68 @@ type (
 		Body       string                `json:"body" jsonschema:"omitempty"`
 		Compress   string                `json:"compress" jsonschema:"omitempty"`
 		Decompress string                `json:"decompress" jsonschema:"omitempty"`
+		Replace    *ReplaceSpec          `json:"replace,omitempty" jsonschema:"omitempty"`
+	}
+
+	// ReplaceSpec describes the find and replace of the response body.
+	ReplaceSpec struct {
+		Rules []*ReplaceRule `json:"rules" jsonschema:"required,minItems=1"`
+		// ContentTypes are the media types of the responses to replace,
+		// a type like text/* matches all its subtypes.
+		ContentTypes []string `json:"contentTypes" jsonschema:"omitempty"`
+		// MaxBodySize is the max size of the bodies to replace, larger
+		// bodies, including streams with a larger Content-Length, are
+		// left unchanged. 0 means no limit.
+		MaxBodySize int64 `json:"maxBodySize" jsonschema:"omitempty,minimum=0"`
+		// Window is the max length of the matches in a streaming body,
+		// default is 4096.
+		Window int `json:"window" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// ReplaceRule replaces the text matching Find or Regexp with Replace.
+	// Replace could refer the groups of Regexp, like $1 or ${name}.
+	ReplaceRule struct {
+		Find    string `json:"find,omitempty" jsonschema:"omitempty"`
+		Regexp  string `json:"regexp,omitempty" jsonschema:"omitempty,format=regexp"`
+		Replace string `json:"replace" jsonschema:"omitempty"`
+	}
+
+	replaceRule struct {
+		re      *regexp.Regexp
+		repl    string
+		literal bool
 	}
 )
 
+// Validate validates the ReplaceRule.
+func (r *ReplaceRule) Validate() error {
+	if (r.Find == "") == (r.Regexp == "") {
+		return fmt.Errorf("one and only one of find and regexp must be specified")
+	}
+	if r.Regexp != "" {
+		re, err := regexp.Compile(r.Regexp)
+		if err != nil {
+			return err
+		}
+		if re.MatchString("") {
+			return fmt.Errorf("regexp %q matches empty string", r.Regexp)
+		}
+	}
+	return nil
+}
+
+func (r *ReplaceRule) compile() *replaceRule {
+	if r.Find != "" {
+		return &replaceRule{
+			re:      regexp.MustCompile(regexp.QuoteMeta(r.Find)),
+			repl:    r.Replace,
+			literal: true,
+		}
+	}
+	// the regexp has been validated, so no error here.
+	return &replaceRule{re: regexp.MustCompile(r.Regexp), repl: r.Replace}
+}
+
 // Name returns the name of the ResponseAdaptor filter instance.
 func (ra *ResponseAdaptor) Name() string {
 	return ra.spec.Name()
@@ -117,7 +191,13 @@ func (ra *ResponseAdaptor) Inherit(previousGeneration filters.Filter) {
 }
 
 func (ra *ResponseAdaptor) reload() {
-	// Nothing to do.
+	if ra.spec.Replace == nil {
+		return
+	}
+	ra.rules = nil
+	for _, r := range ra.spec.Replace.Rules {
+		ra.rules = append(ra.rules, r.compile())
+	}
 }
 
 func adaptHeader(req *httpprot.Response, as *httpheader.AdaptSpec) {
@@ -150,14 +230,20 @@ func (ra *ResponseAdaptor) Handle(ctx *context.Context) string {
 		egresp.HTTPHeader().Del("Content-Encoding")
 	}
 
-	if ra.spec.Compress != "" {
-		if res := ra.compress(egresp); res != "" {
+	// decompress, replace and compress are in this order, so that the
+	// replacement could work on compressed bodies.
+	if ra.spec.Decompress != "" {
+		if res := ra.decompress(egresp); res != "" {
 			return res
 		}
 	}
 
-	if ra.spec.Decompress != "" {
-		if res := ra.decompress(egresp); res != "" {
+	if ra.spec.Replace != nil {
+		ra.replace(egresp)
+	}
+
+	if ra.spec.Compress != "" {
+		if res := ra.compress(egresp); res != "" {
 			return res
 		}
 	}
@@ -165,6 +251,72 @@ func (ra *ResponseAdaptor) Handle(ctx *context.Context) string {
 	return ""
 }
 
+// shouldReplace checks whether the body of the response should be
+// replaced according to the guards of the spec.
+func (ra *ResponseAdaptor) shouldReplace(resp *httpprot.Response) bool {
+	spec := ra.spec.Replace
+
+	// a compressed body is unreadable.
+	if ce := resp.HTTPHeader().Get(keyContentEncoding); ce != "" && ce != "identity" {
+		return false
+	}
+
+	if spec.MaxBodySize > 0 {
+		if resp.IsStream() {
+			if resp.Std().ContentLength > spec.MaxBodySize {
+				return false
+			}
+		} else if int64(len(resp.RawPayload())) > spec.MaxBodySize {
+			return false
+		}
+	}
+
+	mediaType, _, err := mime.ParseMediaType(resp.HTTPHeader().Get(keyContentType))
+	if err != nil {
+		return false
+	}
+
+	contentTypes := spec.ContentTypes
+	if len(contentTypes) == 0 {
+		contentTypes = defaultReplaceContentTypes
+	}
+	for _, ct := range contentTypes {
+		ct = strings.ToLower(ct)
+		if ct == mediaType {
+			return true
+		}
+		if strings.HasSuffix(ct, "/*") && strings.HasPrefix(mediaType, ct[:len(ct)-1]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (ra *ResponseAdaptor) replace(resp *httpprot.Response) {
+	if !ra.shouldReplace(resp) {
+		return
+	}
+
+	if !resp.IsStream() {
+		data := resp.RawPayload()
+		for _, r := range ra.rules {
+			data = readers.ReplaceAll(data, r.re, r.repl, r.literal)
+		}
+		resp.SetPayload(data)
+		resp.HTTPHeader().Set(keyContentLength, strconv.Itoa(len(data)))
+		return
+	}
+
+	// the body is replaced in a sliding window, so it is not buffered.
+	r := resp.GetPayload()
+	for _, rule := range ra.rules {
+		r = readers.NewReplaceReader(r, rule.re, rule.repl, rule.literal, ra.spec.Replace.Window)
+	}
+	resp.SetPayload(r)
+	resp.HTTPHeader().Del(keyContentLength)
+}
+
 func (ra *ResponseAdaptor) compress(resp *httpprot.Response) string {
 	for _, ce := range resp.HTTPHeader().Values(keyContentEncoding) {
 		if strings.Contains(ce, "gzip") {
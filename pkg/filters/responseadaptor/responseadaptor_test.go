@@ -22,6 +22,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -226,3 +227,73 @@ func TestCompressDecompress(t *testing.T) {
 		assert.Equal(resultDecompressFailed, res)
 	}
 }
+
+func TestReplace(t *testing.T) {
+	assert := assert.New(t)
+
+	yamlSpec := `
+kind: ResponseAdaptor
+name: ra
+replace:
+  maxBodySize: 1024
+  window: 64
+  rules:
+  - find: http://backend:8080
+    replace: https://gateway.example.com
+  - regexp: '"id":\s*(\d+)'
+    replace: '"id": "$1"'
+`
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlSpec), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.Nil(err)
+	ra := kind.CreateInstance(spec)
+	ra.Init()
+
+	body := `{"id": 1, "url": "http://backend:8080/orders/1"}`
+	want := `{"id": "1", "url": "https://gateway.example.com/orders/1"}`
+	newResponse := func(contentType, body string) *http.Response {
+		w := httptest.NewRecorder()
+		w.Header().Set("Content-Type", contentType)
+		w.WriteString(body)
+		return w.Result()
+	}
+
+	ctx := getCtx(t, newResponse("application/json; charset=utf-8", body))
+	assert.Equal("", ra.Handle(ctx))
+	resp := ctx.GetInputResponse().(*httpprot.Response)
+	assert.Equal(want, string(resp.RawPayload()))
+	assert.Equal(strconv.Itoa(len(want)), resp.HTTPHeader().Get("Content-Length"))
+
+	// content type guard.
+	ctx = getCtx(t, newResponse("image/png", body))
+	ra.Handle(ctx)
+	assert.Equal(body, string(ctx.GetInputResponse().RawPayload()))
+
+	// size guard.
+	large := body + strings.Repeat(" ", 1024)
+	ctx = getCtx(t, newResponse("text/plain", large))
+	ra.Handle(ctx)
+	assert.Equal(large, string(ctx.GetInputResponse().RawPayload()))
+
+	// streaming body.
+	ctx = context.New(tracing.NoopSpan)
+	r := newResponse("text/plain", strings.Repeat(body, 10))
+	r.ContentLength = -1
+	resp, _ = httpprot.NewResponse(r)
+	resp.FetchPayload(-1)
+	ctx.SetInputResponse(resp)
+	ra.Handle(ctx)
+	data, err := io.ReadAll(resp.GetPayload())
+	assert.Nil(err)
+	assert.Equal(strings.Repeat(want, 10), string(data))
+	assert.Equal("", resp.HTTPHeader().Get("Content-Length"))
+
+	// invalid rules.
+	for _, rule := range []string{"{}", "{find: a, regexp: b}", "{regexp: 'a*'}"} {
+		rawSpec := make(map[string]interface{})
+		codectool.MustUnmarshal([]byte("kind: ResponseAdaptor\nname: ra\nreplace:\n  rules: ["+rule+"]"), &rawSpec)
+		_, err := filters.NewSpec(nil, "", rawSpec)
+		assert.Error(err, rule)
+	}
+}
@@ -0,0 +1,629 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package responsecache implements the ResponseCache filter.
+package responsecache
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/rawconfigtrafficcontroller"
+	"github.com/megaease/easegress/pkg/object/trafficcontroller"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// Kind is the kind of ResponseCache.
+	Kind = "ResponseCache"
+
+	resultCacheHit = "cacheHit"
+
+	// StorageMemory stores the cached responses in memory.
+	StorageMemory = "memory"
+	// StorageDisk stores the cached responses in files.
+	StorageDisk = "disk"
+
+	defaultMaxEntries = 10000
+	defaultTTL        = time.Minute
+
+	// dataRefresh marks the context of refreshing a stale entry in the
+	// background, its request bypasses the cached entry.
+	dataRefresh = "RESPONSE_CACHE_REFRESH"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "ResponseCache caches backend responses and serves them for later requests.",
+	Results:     []string{resultCacheHit},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			Storage:    StorageMemory,
+			MaxEntries: defaultMaxEntries,
+			Methods:    []string{http.MethodGet, http.MethodHead},
+			Codes:      []int{http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusMovedPermanently, http.StatusNotFound, http.StatusGone},
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &ResponseCache{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// ResponseCache is filter ResponseCache.
+	//
+	// The hit, miss and store counters are accessed with sync/atomic, so
+	// they are the leading fields of the struct, which guarantees their
+	// 64-bit alignment on 32-bit platforms as well.
+	ResponseCache struct {
+		hits      uint64
+		staleHits uint64
+		misses    uint64
+		stores    uint64
+
+		spec      *Spec
+		ttl       time.Duration
+		swr       time.Duration
+		methods   map[string]bool
+		codes     map[int]bool
+		store     store
+		startTime time.Time
+
+		// revalidating holds the keys of the stale entries being refreshed.
+		revalidating sync.Map
+		// getPipeline returns the pipeline to refresh the stale entries
+		// with, it is replaced in tests.
+		getPipeline func() context.Handler
+
+		cluster cluster.Cluster
+		done    chan struct{}
+	}
+
+	// Spec describes the ResponseCache.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Storage              string   `json:"storage" jsonschema:"omitempty,enum=memory,enum=disk"`
+		DiskPath             string   `json:"diskPath" jsonschema:"omitempty"`
+		MaxEntries           int      `json:"maxEntries" jsonschema:"omitempty,minimum=1"`
+		MaxEntryBytes        int64    `json:"maxEntryBytes" jsonschema:"omitempty,minimum=0"`
+		TTL                  string   `json:"ttl" jsonschema:"omitempty,format=duration"`
+		StaleWhileRevalidate string   `json:"staleWhileRevalidate" jsonschema:"omitempty,format=duration"`
+		KeyHeaders           []string `json:"keyHeaders" jsonschema:"omitempty,uniqueItems=true"`
+		Methods              []string `json:"methods" jsonschema:"omitempty,uniqueItems=true,format=httpmethod-array"`
+		Codes                []int    `json:"codes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
+	}
+
+	// Status is the status of ResponseCache.
+	Status struct {
+		Entries   int    `json:"entries"`
+		Hits      uint64 `json:"hits"`
+		StaleHits uint64 `json:"staleHits"`
+		Misses    uint64 `json:"misses"`
+		Stores    uint64 `json:"stores"`
+	}
+
+	// PurgeEvent is the event to purge cached responses, it is posted to
+	// the cluster by the admin API and received by all members.
+	PurgeEvent struct {
+		Key    string    `json:"key,omitempty"`
+		Prefix string    `json:"prefix,omitempty"`
+		Time   time.Time `json:"time"`
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if spec.Storage == StorageDisk && spec.DiskPath == "" {
+		return fmt.Errorf("diskPath is required when storage is disk")
+	}
+	return nil
+}
+
+// Name returns the name of the ResponseCache filter instance.
+func (rc *ResponseCache) Name() string {
+	return rc.spec.Name()
+}
+
+// Kind returns the kind of ResponseCache.
+func (rc *ResponseCache) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the ResponseCache
+func (rc *ResponseCache) Spec() filters.Spec {
+	return rc.spec
+}
+
+// Init initializes ResponseCache.
+func (rc *ResponseCache) Init() {
+	rc.reload(nil)
+}
+
+// Inherit inherits previous generation of ResponseCache.
+func (rc *ResponseCache) Inherit(previousGeneration filters.Filter) {
+	prev := previousGeneration.(*ResponseCache)
+	ps := prev.spec
+	if ps.Storage == rc.spec.Storage && ps.DiskPath == rc.spec.DiskPath && ps.MaxEntries == rc.spec.MaxEntries {
+		rc.reload(prev.store)
+	} else {
+		rc.reload(nil)
+	}
+}
+
+func (rc *ResponseCache) reload(s store) {
+	spec := rc.spec
+
+	rc.ttl = defaultTTL
+	if spec.TTL != "" {
+		rc.ttl, _ = time.ParseDuration(spec.TTL)
+	}
+	if spec.StaleWhileRevalidate != "" {
+		rc.swr, _ = time.ParseDuration(spec.StaleWhileRevalidate)
+	}
+
+	rc.methods = map[string]bool{}
+	for _, m := range spec.Methods {
+		rc.methods[m] = true
+	}
+	rc.codes = map[int]bool{}
+	for _, c := range spec.Codes {
+		rc.codes[c] = true
+	}
+
+	maxEntries := spec.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxEntries
+	}
+
+	rc.store = s
+	if rc.store == nil && spec.Storage == StorageDisk {
+		ds, err := newDiskStore(spec.DiskPath, maxEntries)
+		if err != nil {
+			logger.Errorf("failed to create disk store at %s, fallback to memory: %v", spec.DiskPath, err)
+		} else {
+			rc.store = ds
+		}
+	}
+	if rc.store == nil {
+		rc.store = newMemoryStore(maxEntries)
+	}
+
+	rc.getPipeline = rc.pipelineHandler
+	rc.startTime = time.Now()
+	rc.done = make(chan struct{})
+	if spec.Super() != nil && spec.Super().Cluster() != nil {
+		rc.cluster = spec.Super().Cluster()
+		go rc.watchPurgeEvent()
+	}
+}
+
+func (rc *ResponseCache) watchPurgeEvent() {
+	var (
+		syncer cluster.Syncer
+		err    error
+		ch     <-chan *string
+	)
+
+	key := rc.cluster.Layout().ResponseCachePurgeEvent(rc.spec.Pipeline(), rc.spec.Name())
+	for {
+		syncer, err = rc.cluster.Syncer(time.Minute)
+		if err != nil {
+			logger.Errorf("failed to create syncer: %v", err)
+		} else if ch, err = syncer.Sync(key); err != nil {
+			logger.Errorf("failed to sync key %s: %v", key, err)
+			syncer.Close()
+		} else {
+			break
+		}
+
+		select {
+		case <-time.After(10 * time.Second):
+		case <-rc.done:
+			return
+		}
+	}
+
+	defer syncer.Close()
+	for {
+		select {
+		case <-rc.done:
+			return
+		case value := <-ch:
+			if value == nil {
+				continue
+			}
+			event := &PurgeEvent{}
+			if err := codectool.UnmarshalJSON([]byte(*value), event); err != nil {
+				logger.Errorf("failed to decode purge event: %v", err)
+				continue
+			}
+			// ignore the events posted before this filter instance was
+			// created, the syncer always sends the current value first.
+			if event.Time.Before(rc.startTime) {
+				continue
+			}
+			rc.purge(event)
+		}
+	}
+}
+
+func (rc *ResponseCache) purge(event *PurgeEvent) {
+	if event.Key != "" {
+		rc.store.delete(event.Key)
+		logger.Infof("%s: purged cache key %s", rc.Name(), event.Key)
+	}
+	if event.Prefix != "" {
+		n := rc.store.deletePrefix(event.Prefix)
+		logger.Infof("%s: purged %d cache entries with prefix %s", rc.Name(), n, event.Prefix)
+	}
+}
+
+// key returns the cache key of the request, it is in format:
+//
+//	METHOD scheme://host/path?query
+//	Header-1: value
+//	Header-2: value
+func (rc *ResponseCache) key(req *httpprot.Request) string {
+	sb := strings.Builder{}
+	sb.WriteString(req.Method())
+	sb.WriteString(" ")
+	sb.WriteString(req.Scheme())
+	sb.WriteString("://")
+	sb.WriteString(req.Host())
+	sb.WriteString(req.Std().URL.RequestURI())
+	for _, h := range rc.spec.KeyHeaders {
+		sb.WriteString("\n")
+		sb.WriteString(http.CanonicalHeaderKey(h))
+		sb.WriteString(": ")
+		sb.WriteString(req.HTTPHeader().Get(h))
+	}
+	return sb.String()
+}
+
+// Handle serves the request from the cache if possible, otherwise, it
+// arranges to store the response once the request is finished.
+func (rc *ResponseCache) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	if !rc.methods[req.Method()] {
+		return ""
+	}
+
+	// Reference: https://datatracker.ietf.org/doc/html/rfc7234#section-5.2.1
+	reqCC := parseCacheControl(req.HTTPHeader())
+	if _, ok := reqCC["no-store"]; ok {
+		return ""
+	}
+
+	key := rc.key(req)
+	revalidating := false
+
+	_, noCache := reqCC["no-cache"]
+	if ctx.GetData(dataRefresh) != nil {
+		noCache = true
+	}
+	if !noCache {
+		if e := rc.store.get(key); e != nil && e.matchVary(req.HTTPHeader()) {
+			now := time.Now()
+			switch {
+			case now.Before(e.Expires):
+				atomic.AddUint64(&rc.hits, 1)
+				rc.serve(ctx, req, e, now)
+				return resultCacheHit
+			case e.expired(now, rc.swr):
+				rc.store.delete(key)
+			default:
+				// The stale entry is served, and only one request refreshes
+				// it in the background. The request itself refreshes it if
+				// the pipeline is not found.
+				_, loaded := rc.revalidating.LoadOrStore(key, true)
+				if loaded || rc.refresh(key, req) {
+					atomic.AddUint64(&rc.staleHits, 1)
+					rc.serve(ctx, req, e, now)
+					return resultCacheHit
+				}
+				revalidating = true
+			}
+		}
+	}
+
+	atomic.AddUint64(&rc.misses, 1)
+
+	// The header could be modified by the following filters.
+	reqHeader := req.HTTPHeader().Clone()
+	ctx.OnFinish(func() {
+		if revalidating {
+			defer rc.revalidating.Delete(key)
+		}
+		resp, _ := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response)
+		rc.storeResponse(key, reqHeader, resp)
+	})
+	return ""
+}
+
+// refresh handles a copy of the request with the pipeline in the
+// background to refresh the stale entry, it returns false if the refresh
+// is not started, e.g. the pipeline is not found.
+func (rc *ResponseCache) refresh(key string, req *httpprot.Request) bool {
+	pipeline := rc.getPipeline()
+	if pipeline == nil || req.IsStream() {
+		rc.revalidating.Delete(key)
+		return false
+	}
+
+	// The request is released once the original one is finished, so it
+	// is copied now.
+	payload := append([]byte(nil), req.RawPayload()...)
+	stdr := req.Std().Clone(stdcontext.Background())
+	stdr.Body = http.NoBody
+	r, err := httpprot.NewRequest(stdr)
+	if err != nil {
+		rc.revalidating.Delete(key)
+		return false
+	}
+	r.SetPayload(payload)
+
+	go func() {
+		defer rc.revalidating.Delete(key)
+		defer func() {
+			if err := recover(); err != nil {
+				logger.Errorf("%s: recover from refreshing %s, err: %v, stack trace:\n%s\n",
+					rc.Name(), key, err, debug.Stack())
+			}
+		}()
+
+		ctx := context.New(tracing.NoopSpan)
+		ctx.SetData(dataRefresh, true)
+		ctx.SetRequest(context.DefaultNamespace, r)
+		pipeline.Handle(ctx)
+		ctx.Finish()
+	}()
+	return true
+}
+
+// pipelineHandler returns the pipeline of the filter, it is only found
+// in the namespace of the pipelines created by users.
+func (rc *ResponseCache) pipelineHandler() context.Handler {
+	super := rc.spec.Super()
+	if super == nil {
+		return nil
+	}
+	entity, exists := super.GetSystemController(trafficcontroller.Kind)
+	if !exists {
+		return nil
+	}
+	tc, ok := entity.Instance().(*trafficcontroller.TrafficController)
+	if !ok {
+		return nil
+	}
+	pipeline, exists := tc.GetPipeline(rawconfigtrafficcontroller.DefaultNamespace, rc.spec.Pipeline())
+	if !exists {
+		return nil
+	}
+	handler, _ := pipeline.Instance().(context.Handler)
+	return handler
+}
+
+func (rc *ResponseCache) serve(ctx *context.Context, req *httpprot.Request, e *entry, now time.Time) {
+	resp, _ := httpprot.NewResponse(nil)
+
+	header := resp.HTTPHeader()
+	for k, v := range e.Header {
+		header[k] = append([]string(nil), v...)
+	}
+	header.Set("Age", strconv.Itoa(int(now.Sub(e.StoredAt).Seconds())))
+
+	etag := e.Header.Get("ETag")
+	if etag != "" && matchETag(req.HTTPHeader().Get("If-None-Match"), etag) {
+		header.Del("Content-Length")
+		resp.SetStatusCode(http.StatusNotModified)
+	} else {
+		resp.SetStatusCode(e.StatusCode)
+		resp.SetPayload(e.Body)
+	}
+
+	ctx.SetOutputResponse(resp)
+}
+
+func (rc *ResponseCache) storeResponse(key string, reqHeader http.Header, resp *httpprot.Response) {
+	if resp == nil || resp.IsStream() || !rc.codes[resp.StatusCode()] {
+		return
+	}
+
+	body := resp.RawPayload()
+	if rc.spec.MaxEntryBytes > 0 && int64(len(body)) > rc.spec.MaxEntryBytes {
+		return
+	}
+
+	header := resp.HTTPHeader()
+	if header.Get("Set-Cookie") != "" {
+		return
+	}
+
+	// Reference: https://datatracker.ietf.org/doc/html/rfc7234#section-3.2
+	if reqHeader.Get("Authorization") != "" && !sharedWithAuthorization(header) {
+		return
+	}
+
+	vary, ok := varyValues(header, reqHeader)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	ttl, ok := freshnessLifetime(header, now, rc.ttl)
+	if !ok || ttl <= 0 {
+		return
+	}
+
+	rc.store.set(&entry{
+		Key:        key,
+		StatusCode: resp.StatusCode(),
+		Header:     header.Clone(),
+		Vary:       vary,
+		Body:       body,
+		StoredAt:   now,
+		Expires:    now.Add(ttl),
+	})
+	atomic.AddUint64(&rc.stores, 1)
+}
+
+// freshnessLifetime returns how long a response could be cached, the
+// second return value is false if the response must not be cached.
+func freshnessLifetime(header http.Header, now time.Time, defaultTTL time.Duration) (time.Duration, bool) {
+	// Reference: https://datatracker.ietf.org/doc/html/rfc7234#section-4.2.1
+	cc := parseCacheControl(header)
+	for _, d := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := cc[d]; ok {
+			return 0, false
+		}
+	}
+
+	for _, d := range []string{"s-maxage", "max-age"} {
+		if v, ok := cc[d]; ok {
+			seconds, err := strconv.Atoi(v)
+			if err != nil {
+				return 0, false
+			}
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+
+	if v := header.Get("Expires"); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil {
+			return 0, false
+		}
+		if date, err := http.ParseTime(header.Get("Date")); err == nil {
+			now = date
+		}
+		return expires.Sub(now), true
+	}
+
+	return defaultTTL, true
+}
+
+// sharedWithAuthorization returns whether the response to a request with
+// the Authorization header could be stored by a shared cache.
+func sharedWithAuthorization(header http.Header) bool {
+	cc := parseCacheControl(header)
+	for _, d := range []string{"public", "s-maxage", "must-revalidate"} {
+		if _, ok := cc[d]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// varyValues returns the values of the request headers nominated by the
+// Vary header of the response, the cached response is only served for the
+// requests with the same values. The second return value is false if the
+// response must not be cached, i.e. Vary is "*".
+//
+// Reference: https://datatracker.ietf.org/doc/html/rfc7234#section-4.1
+func varyValues(header, reqHeader http.Header) (map[string]string, bool) {
+	var vary map[string]string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if name == "*" {
+				return nil, false
+			}
+			if vary == nil {
+				vary = map[string]string{}
+			}
+			name = http.CanonicalHeaderKey(name)
+			vary[name] = strings.Join(reqHeader.Values(name), ", ")
+		}
+	}
+	return vary, true
+}
+
+// parseCacheControl parses the Cache-Control headers into a map of
+// directive name to value.
+func parseCacheControl(header http.Header) map[string]string {
+	cc := map[string]string{}
+	for _, value := range header.Values("Cache-Control") {
+		for _, d := range strings.Split(value, ",") {
+			d = strings.TrimSpace(d)
+			if d == "" {
+				continue
+			}
+			name, v := d, ""
+			if idx := strings.IndexByte(d, '='); idx >= 0 {
+				name, v = d[:idx], strings.Trim(d[idx+1:], `"`)
+			}
+			cc[strings.ToLower(name)] = v
+		}
+	}
+	return cc
+}
+
+// matchETag reports whether the If-None-Match header value matches etag,
+// using the weak comparison.
+func matchETag(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, t := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(t), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Status returns Status.
+func (rc *ResponseCache) Status() interface{} {
+	return &Status{
+		Entries:   rc.store.len(),
+		Hits:      atomic.LoadUint64(&rc.hits),
+		StaleHits: atomic.LoadUint64(&rc.staleHits),
+		Misses:    atomic.LoadUint64(&rc.misses),
+		Stores:    atomic.LoadUint64(&rc.stores),
+	}
+}
+
+// Close closes ResponseCache.
+func (rc *ResponseCache) Close() {
+	close(rc.done)
+}
@@ -0,0 +1,320 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package responsecache
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newResponseCache(t *testing.T, yamlConfig string) *ResponseCache {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	rc := kind.CreateInstance(spec).(*ResponseCache)
+	rc.Init()
+	return rc
+}
+
+func newContext(t *testing.T, header http.Header) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://megaease.com/abc?x=1", nil)
+	for k, v := range header {
+		stdr.Header[k] = v
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+// serveBackend simulates a backend filter which sets the response.
+func serveBackend(ctx *context.Context, header http.Header, body string) {
+	resp, _ := httpprot.NewResponse(nil)
+	for k, v := range header {
+		resp.Std().Header[k] = v
+	}
+	resp.SetPayload([]byte(body))
+	ctx.SetOutputResponse(resp)
+}
+
+func TestResponseCache(t *testing.T) {
+	assert := assert.New(t)
+
+	rc := newResponseCache(t, `
+kind: ResponseCache
+name: cache
+ttl: 10s
+keyHeaders: ["X-Tenant"]
+`)
+	defer rc.Close()
+
+	ctx := newContext(t, http.Header{"X-Tenant": {"a"}})
+	assert.Equal("", rc.Handle(ctx))
+	serveBackend(ctx, http.Header{"Etag": {`"v1"`}}, "hello")
+	ctx.Finish()
+	assert.Equal(1, rc.store.len())
+
+	ctx = newContext(t, http.Header{"X-Tenant": {"a"}})
+	assert.Equal(resultCacheHit, rc.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Equal("hello", string(resp.RawPayload()))
+	assert.Equal("0", resp.HTTPHeader().Get("Age"))
+
+	// conditional request.
+	ctx = newContext(t, http.Header{"X-Tenant": {"a"}, "If-None-Match": {`W/"v1"`}})
+	assert.Equal(resultCacheHit, rc.Handle(ctx))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusNotModified, resp.StatusCode())
+
+	// different key header value.
+	ctx = newContext(t, http.Header{"X-Tenant": {"b"}})
+	assert.Equal("", rc.Handle(ctx))
+
+	// request asks to bypass the cache.
+	ctx = newContext(t, http.Header{"X-Tenant": {"a"}, "Cache-Control": {"no-cache"}})
+	assert.Equal("", rc.Handle(ctx))
+
+	// responses that must not be stored.
+	ctx = newContext(t, http.Header{"X-Tenant": {"c"}})
+	assert.Equal("", rc.Handle(ctx))
+	serveBackend(ctx, http.Header{"Cache-Control": {"private, max-age=60"}}, "private")
+	ctx.Finish()
+	assert.Equal(1, rc.store.len())
+
+	status := rc.Status().(*Status)
+	assert.Equal(uint64(2), status.Hits)
+	assert.Equal(uint64(1), status.Stores)
+
+	rc.purge(&PurgeEvent{Prefix: "GET http://megaease.com/"})
+	assert.Equal(0, rc.store.len())
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	assert := assert.New(t)
+
+	rc := newResponseCache(t, `
+kind: ResponseCache
+name: cache
+staleWhileRevalidate: 1m
+`)
+	defer rc.Close()
+
+	setStale := func() string {
+		ctx := newContext(t, nil)
+		key := rc.key(ctx.GetInputRequest().(*httpprot.Request))
+		now := time.Now()
+		rc.store.set(&entry{
+			Key:        key,
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       []byte("stale"),
+			StoredAt:   now.Add(-time.Minute),
+			Expires:    now.Add(-time.Second),
+		})
+		return key
+	}
+	assertBody := func(ctx *context.Context, body string) {
+		assert.Equal(body, string(ctx.GetOutputResponse().(*httpprot.Response).RawPayload()))
+	}
+
+	// the pipeline refreshes the entry in the background, it is blocked
+	// until release is closed.
+	release := make(chan struct{})
+	refreshed := make(chan struct{})
+	rc.getPipeline = func() context.Handler {
+		return &contexttest.MockedHandler{
+			MockedHandle: func(ctx *context.Context) string {
+				<-release
+				assert.Equal("", rc.Handle(ctx))
+				serveBackend(ctx, nil, "fresh")
+				close(refreshed)
+				return ""
+			},
+		}
+	}
+	key := setStale()
+
+	// the first request is served with the stale entry without waiting
+	// for the refresh, so are the others meanwhile.
+	for i := 0; i < 2; i++ {
+		ctx := newContext(t, nil)
+		assert.Equal(resultCacheHit, rc.Handle(ctx))
+		assertBody(ctx, "stale")
+		ctx.Finish()
+	}
+	assert.Equal(uint64(2), rc.Status().(*Status).StaleHits)
+
+	close(release)
+	<-refreshed
+	assert.Eventually(func() bool {
+		ctx := newContext(t, nil)
+		if rc.Handle(ctx) != resultCacheHit {
+			return false
+		}
+		return string(ctx.GetOutputResponse().(*httpprot.Response).RawPayload()) == "fresh"
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Eventually(func() bool {
+		_, ok := rc.revalidating.Load(key)
+		return !ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the request refreshes the entry itself if the pipeline is not found.
+	rc.getPipeline = func() context.Handler { return nil }
+	setStale()
+
+	ctx := newContext(t, nil)
+	assert.Equal("", rc.Handle(ctx))
+
+	ctx2 := newContext(t, nil)
+	assert.Equal(resultCacheHit, rc.Handle(ctx2))
+	assertBody(ctx2, "stale")
+
+	serveBackend(ctx, nil, "fresh")
+	ctx.Finish()
+
+	ctx = newContext(t, nil)
+	assert.Equal(resultCacheHit, rc.Handle(ctx))
+	assertBody(ctx, "fresh")
+}
+
+func TestSharedCacheRules(t *testing.T) {
+	assert := assert.New(t)
+
+	rc := newResponseCache(t, `
+kind: ResponseCache
+name: cache
+`)
+	defer rc.Close()
+
+	// the responses to the requests with Authorization are not shared,
+	// unless they are allowed explicitly.
+	auth := http.Header{"Authorization": {"Bearer alice"}}
+	ctx := newContext(t, auth)
+	assert.Equal("", rc.Handle(ctx))
+	serveBackend(ctx, http.Header{"Cache-Control": {"max-age=60"}}, "alice")
+	ctx.Finish()
+	assert.Equal(0, rc.store.len())
+
+	ctx = newContext(t, http.Header{"Authorization": {"Bearer bob"}})
+	assert.Equal("", rc.Handle(ctx))
+
+	for _, cc := range []string{"public", "s-maxage=60", "must-revalidate"} {
+		rc.store.deletePrefix("")
+		ctx = newContext(t, auth)
+		assert.Equal("", rc.Handle(ctx))
+		serveBackend(ctx, http.Header{"Cache-Control": {cc}}, "shared")
+		ctx.Finish()
+		assert.Equal(1, rc.store.len(), cc)
+	}
+
+	// the response is only served for the same values of the headers
+	// nominated by Vary.
+	rc.store.deletePrefix("")
+	gzip := http.Header{"Accept-Encoding": {"gzip"}, "Accept-Language": {"en"}}
+	ctx = newContext(t, gzip)
+	assert.Equal("", rc.Handle(ctx))
+	// the headers modified by the following filters don't matter.
+	ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Set("Accept-Encoding", "identity")
+	serveBackend(ctx, http.Header{"Vary": {"accept-encoding, Accept-Language"}}, "gzipped")
+	ctx.Finish()
+
+	ctx = newContext(t, gzip)
+	assert.Equal(resultCacheHit, rc.Handle(ctx))
+	assert.Equal("gzipped", string(ctx.GetOutputResponse().(*httpprot.Response).RawPayload()))
+
+	ctx = newContext(t, http.Header{"Accept-Encoding": {"br"}, "Accept-Language": {"en"}})
+	assert.Equal("", rc.Handle(ctx))
+	ctx = newContext(t, http.Header{"Accept-Encoding": {"gzip"}})
+	assert.Equal("", rc.Handle(ctx))
+
+	// Vary: * is never cached.
+	rc.store.deletePrefix("")
+	ctx = newContext(t, nil)
+	assert.Equal("", rc.Handle(ctx))
+	serveBackend(ctx, http.Header{"Vary": {"*"}}, "any")
+	ctx.Finish()
+	assert.Equal(0, rc.store.len())
+}
+
+func TestFreshnessLifetime(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now()
+
+	ttl, ok := freshnessLifetime(http.Header{}, now, time.Minute)
+	assert.True(ok)
+	assert.Equal(time.Minute, ttl)
+
+	ttl, ok = freshnessLifetime(http.Header{"Cache-Control": {"public, max-age=30, s-maxage=20"}}, now, time.Minute)
+	assert.True(ok)
+	assert.Equal(20*time.Second, ttl)
+
+	_, ok = freshnessLifetime(http.Header{"Cache-Control": {"no-store"}}, now, time.Minute)
+	assert.False(ok)
+
+	header := http.Header{}
+	header.Set("Date", now.UTC().Format(http.TimeFormat))
+	header.Set("Expires", now.Add(time.Hour).UTC().Format(http.TimeFormat))
+	ttl, ok = freshnessLifetime(header, now, time.Minute)
+	assert.True(ok)
+	assert.Equal(time.Hour, ttl)
+}
+
+func TestDiskStore(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	ds, err := newDiskStore(dir, 2)
+	assert.NoError(err)
+
+	now := time.Now()
+	for _, k := range []string{"GET /a", "GET /b", "GET /c"} {
+		ds.set(&entry{Key: k, StatusCode: 200, Body: []byte(k), StoredAt: now, Expires: now.Add(time.Minute)})
+	}
+	assert.Equal(2, ds.len())
+	assert.Nil(ds.get("GET /c"))
+	assert.Equal("GET /a", string(ds.get("GET /a").Body))
+
+	// entries are loaded by a new store.
+	ds, err = newDiskStore(dir, 2)
+	assert.NoError(err)
+	assert.Equal(2, ds.len())
+
+	assert.Equal(2, ds.deletePrefix("GET /"))
+	assert.Nil(ds.get("GET /a"))
+}
@@ -0,0 +1,272 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package responsecache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const cacheFileExt = ".cache"
+
+type (
+	// entry is a cached response.
+	entry struct {
+		Key        string      `json:"key"`
+		StatusCode int         `json:"statusCode"`
+		Header     http.Header `json:"header"`
+		// Vary are the values of the request headers nominated by the
+		// Vary header of the response.
+		Vary     map[string]string `json:"vary,omitempty"`
+		Body     []byte            `json:"body"`
+		StoredAt time.Time         `json:"storedAt"`
+		Expires  time.Time         `json:"expires"`
+	}
+
+	// store is the storage of cached responses.
+	store interface {
+		get(key string) *entry
+		set(e *entry)
+		delete(key string)
+		deletePrefix(prefix string) int
+		len() int
+	}
+
+	memoryStore struct {
+		cache *lru.Cache
+	}
+
+	diskStore struct {
+		dir        string
+		maxEntries int
+
+		mutex sync.Mutex
+		index map[string]*diskItem
+	}
+
+	diskItem struct {
+		file    string
+		expires time.Time
+	}
+)
+
+// matchVary returns whether the entry could be served for the request with
+// the header, i.e. the values of the headers nominated by Vary are the same.
+func (e *entry) matchVary(reqHeader http.Header) bool {
+	for name, value := range e.Vary {
+		if strings.Join(reqHeader.Values(name), ", ") != value {
+			return false
+		}
+	}
+	return true
+}
+
+// expired returns whether the entry could no longer be served, even as a
+// stale one.
+func (e *entry) expired(now time.Time, swr time.Duration) bool {
+	return !now.Before(e.Expires.Add(swr))
+}
+
+func newMemoryStore(maxEntries int) *memoryStore {
+	cache, _ := lru.New(maxEntries)
+	return &memoryStore{cache: cache}
+}
+
+func (ms *memoryStore) get(key string) *entry {
+	if v, ok := ms.cache.Get(key); ok {
+		return v.(*entry)
+	}
+	return nil
+}
+
+func (ms *memoryStore) set(e *entry) {
+	ms.cache.Add(e.Key, e)
+}
+
+func (ms *memoryStore) delete(key string) {
+	ms.cache.Remove(key)
+}
+
+func (ms *memoryStore) deletePrefix(prefix string) int {
+	count := 0
+	for _, k := range ms.cache.Keys() {
+		if strings.HasPrefix(k.(string), prefix) {
+			ms.cache.Remove(k)
+			count++
+		}
+	}
+	return count
+}
+
+func (ms *memoryStore) len() int {
+	return ms.cache.Len()
+}
+
+// newDiskStore creates a disk store, the entries persisted by previous
+// runs are loaded into the index.
+func newDiskStore(dir string, maxEntries int) (*diskStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+
+	ds := &diskStore{
+		dir:        dir,
+		maxEntries: maxEntries,
+		index:      map[string]*diskItem{},
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+cacheFileExt))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, file := range files {
+		e := ds.readFile(file)
+		if e == nil || !now.Before(e.Expires) {
+			os.Remove(file)
+			continue
+		}
+		ds.index[e.Key] = &diskItem{file: file, expires: e.Expires}
+	}
+
+	return ds, nil
+}
+
+func (ds *diskStore) fileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(ds.dir, hex.EncodeToString(sum[:])+cacheFileExt)
+}
+
+func (ds *diskStore) readFile(file string) *entry {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		logger.Warnf("failed to read cache file %s: %v", file, err)
+		return nil
+	}
+
+	e := &entry{}
+	if err = codectool.UnmarshalJSON(data, e); err != nil {
+		logger.Warnf("failed to decode cache file %s: %v", file, err)
+		return nil
+	}
+	return e
+}
+
+func (ds *diskStore) get(key string) *entry {
+	ds.mutex.Lock()
+	item := ds.index[key]
+	ds.mutex.Unlock()
+
+	if item == nil {
+		return nil
+	}
+
+	e := ds.readFile(item.file)
+	if e == nil || e.Key != key {
+		return nil
+	}
+	return e
+}
+
+func (ds *diskStore) set(e *entry) {
+	data, err := codectool.MarshalJSON(e)
+	if err != nil {
+		logger.Errorf("failed to encode cache entry %s: %v", e.Key, err)
+		return
+	}
+
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	if _, ok := ds.index[e.Key]; !ok && len(ds.index) >= ds.maxEntries {
+		ds.evictExpired(e.StoredAt)
+		if len(ds.index) >= ds.maxEntries {
+			return
+		}
+	}
+
+	// write to a temporary file and then rename it, so that readers never
+	// see a partial file.
+	file := ds.fileName(e.Key)
+	tmp := file + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o640); err != nil {
+		logger.Errorf("failed to write cache file %s: %v", tmp, err)
+		return
+	}
+	if err = os.Rename(tmp, file); err != nil {
+		logger.Errorf("failed to rename cache file %s: %v", tmp, err)
+		os.Remove(tmp)
+		return
+	}
+
+	ds.index[e.Key] = &diskItem{file: file, expires: e.Expires}
+}
+
+// evictExpired removes expired entries, the caller must hold the lock.
+func (ds *diskStore) evictExpired(now time.Time) {
+	for k, item := range ds.index {
+		if now.Before(item.expires) {
+			continue
+		}
+		os.Remove(item.file)
+		delete(ds.index, k)
+	}
+}
+
+func (ds *diskStore) delete(key string) {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	if item := ds.index[key]; item != nil {
+		os.Remove(item.file)
+		delete(ds.index, key)
+	}
+}
+
+func (ds *diskStore) deletePrefix(prefix string) int {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	count := 0
+	for k, item := range ds.index {
+		if strings.HasPrefix(k, prefix) {
+			os.Remove(item.file)
+			delete(ds.index, k)
+			count++
+		}
+	}
+	return count
+}
+
+func (ds *diskStore) len() int {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+	return len(ds.index)
+}
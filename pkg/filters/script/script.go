@@ -0,0 +1,241 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package script implements the Script filter, which runs Lua scripts in
+// sandboxed interpreters for small custom logic.
+package script
+
+import (
+	stdcontext "context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of Script.
+	Kind = "Script"
+
+	maxScriptResult = 9
+
+	defaultMaxConcurrency   = 10
+	defaultTimeout          = 100 * time.Millisecond
+	defaultMaxCallStackSize = 128
+	defaultMaxRegistrySize  = 64 * 1024
+)
+
+var (
+	resultOutOfVM     = "outOfVM"
+	resultScriptError = "scriptError"
+	results           = []string{resultOutOfVM, resultScriptError}
+)
+
+func scriptResultToFilterResult(r int) string {
+	if r == 0 {
+		return ""
+	}
+	return fmt.Sprintf("scriptResult%d", r)
+}
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "Script runs Lua scripts in sandboxed interpreters",
+	Results:     results,
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			MaxConcurrency: defaultMaxConcurrency,
+			Timeout:        defaultTimeout.String(),
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &Script{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	for i := 1; i <= maxScriptResult; i++ {
+		results = append(results, scriptResultToFilterResult(i))
+	}
+
+	kind.Results = results
+	filters.Register(kind)
+}
+
+type (
+	// Script is the filter Script.
+	Script struct {
+		spec    *Spec
+		timeout time.Duration
+		pool    *vmPool
+
+		numOfRequest     int64
+		numOfScriptError int64
+	}
+
+	// Spec describes the Script.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// Code is the Lua code, which is executed for each request.
+		Code string `json:"code" jsonschema:"required"`
+		// MaxConcurrency is the number of interpreters, which is the
+		// maximum requests the filter can process concurrently.
+		MaxConcurrency int32  `json:"maxConcurrency" jsonschema:"omitempty,minimum=1"`
+		Timeout        string `json:"timeout" jsonschema:"omitempty,format=duration"`
+
+		// MaxCallStackSize and MaxRegistrySize bound the memory of an
+		// interpreter, by the depth of calls and the number of values on
+		// the stack.
+		MaxCallStackSize int `json:"maxCallStackSize" jsonschema:"omitempty,minimum=1"`
+		MaxRegistrySize  int `json:"maxRegistrySize" jsonschema:"omitempty,minimum=1024"`
+	}
+
+	// Status is the status of Script.
+	Status struct {
+		NumOfRequest     int64 `json:"numOfRequest"`
+		NumOfScriptError int64 `json:"numOfScriptError"`
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if _, err := compile(spec.Code, spec.Name()); err != nil {
+		return err
+	}
+	if spec.Timeout != "" {
+		if _, err := time.ParseDuration(spec.Timeout); err != nil {
+			return fmt.Errorf("invalid timeout: %v", err)
+		}
+	}
+	return nil
+}
+
+// compile compiles the code into a function prototype, which is shared by
+// all interpreters.
+func compile(code, name string) (*lua.FunctionProto, error) {
+	chunk, err := parse.Parse(strings.NewReader(code), name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid script: %v", err)
+	}
+	return lua.Compile(chunk, name)
+}
+
+// Name returns the name of the Script filter instance.
+func (s *Script) Name() string {
+	return s.spec.Name()
+}
+
+// Kind returns the kind of Script.
+func (s *Script) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the Script.
+func (s *Script) Spec() filters.Spec {
+	return s.spec
+}
+
+// Init initializes Script.
+func (s *Script) Init() {
+	s.reload()
+}
+
+// Inherit inherits previous generation of Script.
+func (s *Script) Inherit(previousGeneration filters.Filter) {
+	s.reload()
+}
+
+func (s *Script) reload() {
+	spec := s.spec
+
+	s.timeout = defaultTimeout
+	if spec.Timeout != "" {
+		s.timeout, _ = time.ParseDuration(spec.Timeout)
+	}
+
+	proto, err := compile(spec.Code, spec.Name())
+	if err != nil {
+		// should not happen as the code is validated.
+		logger.Errorf("BUG: script %s: %v", s.Name(), err)
+		return
+	}
+	s.pool = newVMPool(spec, proto)
+}
+
+// Handle runs the script for the request.
+func (s *Script) Handle(ctx *context.Context) (result string) {
+	atomic.AddInt64(&s.numOfRequest, 1)
+
+	if s.pool == nil {
+		ctx.AddTag("script: not initialized")
+		return resultOutOfVM
+	}
+
+	// the timeout covers both waiting for an interpreter and running the
+	// script.
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	timeoutCtx, cancel := stdcontext.WithTimeout(req.Context(), s.timeout)
+	defer cancel()
+
+	vm, err := s.pool.get(timeoutCtx)
+	if err != nil {
+		logger.Errorf("script %s: %v", s.Name(), err)
+		ctx.AddTag(stringtool.Cat("script: ", err.Error()))
+		return resultOutOfVM
+	}
+
+	r, err := vm.run(timeoutCtx, ctx)
+	if err != nil {
+		// the interpreter may be in an inconsistent state, it is closed
+		// and a new one will be created later.
+		vm.close()
+		s.pool.put(nil)
+
+		atomic.AddInt64(&s.numOfScriptError, 1)
+		logger.Errorf("script %s failed: %v", s.Name(), err)
+		ctx.AddTag(stringtool.Cat("script: ", err.Error()))
+		return resultScriptError
+	}
+
+	s.pool.put(vm)
+	return scriptResultToFilterResult(r)
+}
+
+// Status returns Status generated by the filter.
+func (s *Script) Status() interface{} {
+	return &Status{
+		NumOfRequest:     atomic.LoadInt64(&s.numOfRequest),
+		NumOfScriptError: atomic.LoadInt64(&s.numOfScriptError),
+	}
+}
+
+// Close closes Script.
+func (s *Script) Close() {
+	if s.pool != nil {
+		s.pool.close()
+	}
+}
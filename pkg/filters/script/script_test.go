@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package script
+
+import (
+	stdcontext "context"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newTestScript(t *testing.T, yamlConfig string) *Script {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "pipeline", rawSpec)
+	if err != nil {
+		t.Fatalf("failed to create spec: %v", err)
+	}
+	s := kind.CreateInstance(spec).(*Script)
+	s.Init()
+	return s
+}
+
+func newContext(user, body string) *context.Context {
+	ctx := context.New(nil)
+	stdReq, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1/orders?id=1", strings.NewReader(body))
+	if user != "" {
+		stdReq.Header.Set("X-User", user)
+	}
+	req, _ := httpprot.NewRequest(stdReq)
+	req.FetchPayload(0)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&Spec{Code: "return 0"}).Validate())
+	assert.Error((&Spec{Code: "return ("}).Validate())
+	assert.Error((&Spec{Code: "return 0", Timeout: "1x"}).Validate())
+}
+
+func TestScript(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newTestScript(t, `
+kind: Script
+name: script
+maxConcurrency: 2
+code: |
+  local user = request.header("X-User")
+  if user == "" then
+    response.setStatus(401)
+    response.setBody("who are you?")
+    return 1
+  end
+  request.setHeader("X-Order-Id", request.query("id"))
+  request.setPath("/v2" .. request.path())
+  ctx.set("script.user", user)
+  if request.body() ~= "" then
+    request.setBody(string.upper(request.body()))
+  end
+`)
+	defer s.Close()
+
+	ctx := newContext("alice", "hello")
+	assert.Equal("", s.Handle(ctx))
+	req := ctx.GetOutputRequest().(*httpprot.Request)
+	assert.Equal("1", req.HTTPHeader().Get("X-Order-Id"))
+	assert.Equal("/v2/orders", req.Path())
+	assert.Equal("HELLO", string(req.RawPayload()))
+	assert.Equal("alice", ctx.GetData("script.user"))
+
+	ctx = newContext("", "")
+	assert.Equal("scriptResult1", s.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(401, resp.StatusCode())
+	assert.Equal("who are you?", string(resp.RawPayload()))
+
+	status := s.Status().(*Status)
+	assert.Equal(int64(2), status.NumOfRequest)
+	assert.Equal(int64(0), status.NumOfScriptError)
+}
+
+func TestScriptError(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newTestScript(t, `
+kind: Script
+name: script
+maxConcurrency: 1
+timeout: 50ms
+code: |
+  local mode = request.header("X-User")
+  if mode == "loop" then
+    while true do end
+  elseif mode == "error" then
+    error("failed")
+  elseif mode == "file" then
+    return dofile("/etc/passwd")
+  elseif mode == "invalid" then
+    return 10
+  end
+  return 0
+`)
+	defer s.Close()
+
+	for _, mode := range []string{"loop", "error", "file", "invalid"} {
+		assert.Equal(resultScriptError, s.Handle(newContext(mode, "")), mode)
+	}
+
+	// a new interpreter is created after the errors.
+	assert.Equal("", s.Handle(newContext("ok", "")))
+
+	// the only interpreter is busy, the request doesn't wait for it
+	// longer than the timeout.
+	vm, err := s.pool.get(stdcontext.Background())
+	assert.NoError(err)
+	start := time.Now()
+	assert.Equal(resultOutOfVM, s.Handle(newContext("ok", "")))
+	assert.Less(time.Since(start), time.Second)
+	s.pool.put(vm)
+
+	status := s.Status().(*Status)
+	assert.Equal(int64(6), status.NumOfRequest)
+	assert.Equal(int64(4), status.NumOfScriptError)
+}
@@ -0,0 +1,462 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package script
+
+import (
+	stdcontext "context"
+	"fmt"
+	"io"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+// unsafeGlobals are the globals removed from the interpreters, which access
+// the file system or load code dynamically.
+var unsafeGlobals = []string{
+	"dofile", "loadfile", "load", "loadstring", "require", "module", "print",
+}
+
+type (
+	// vm is a Lua interpreter, the context of the request being processed
+	// is attached to it.
+	vm struct {
+		name  string
+		state *lua.LState
+		fn    *lua.LFunction
+		ctx   *context.Context
+	}
+
+	// vmPool is a pool of interpreters, a nil interpreter in the pool is
+	// replaced by a new one when it is got.
+	vmPool struct {
+		spec  *Spec
+		proto *lua.FunctionProto
+		chVM  chan *vm
+	}
+)
+
+func newVMPool(spec *Spec, proto *lua.FunctionProto) *vmPool {
+	n := spec.MaxConcurrency
+	if n <= 0 {
+		n = defaultMaxConcurrency
+	}
+
+	p := &vmPool{spec: spec, proto: proto, chVM: make(chan *vm, n)}
+	for i := int32(0); i < n; i++ {
+		p.chVM <- nil
+	}
+	return p
+}
+
+// get gets an interpreter from the pool, it waits until an interpreter is
+// available or ctx is done.
+func (p *vmPool) get(ctx stdcontext.Context) (*vm, error) {
+	var v *vm
+	select {
+	case v = <-p.chVM:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("no interpreter available: %v", ctx.Err())
+	}
+	if v != nil {
+		return v, nil
+	}
+
+	v, err := newVM(p.spec, p.proto)
+	if err != nil {
+		p.chVM <- nil
+		return nil, fmt.Errorf("failed to create interpreter: %v", err)
+	}
+	return v, nil
+}
+
+// put puts an interpreter to the pool, putting a nil interpreter is
+// allowed and will cause get to create a new one later.
+func (p *vmPool) put(v *vm) {
+	if v != nil {
+		v.ctx = nil
+	}
+	p.chVM <- v
+}
+
+// close closes the idle interpreters in the pool.
+func (p *vmPool) close() {
+	for {
+		select {
+		case v := <-p.chVM:
+			if v != nil {
+				v.close()
+			}
+		default:
+			return
+		}
+	}
+}
+
+func newVM(spec *Spec, proto *lua.FunctionProto) (*vm, error) {
+	callStackSize := spec.MaxCallStackSize
+	if callStackSize <= 0 {
+		callStackSize = defaultMaxCallStackSize
+	}
+	registrySize := spec.MaxRegistrySize
+	if registrySize <= 0 {
+		registrySize = defaultMaxRegistrySize
+	}
+
+	L := lua.NewState(lua.Options{
+		SkipOpenLibs:        true,
+		CallStackSize:       callStackSize,
+		RegistrySize:        1024,
+		RegistryMaxSize:     registrySize,
+		MinimizeStackMemory: true,
+	})
+
+	for _, lib := range []struct {
+		name string
+		fn   lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		err := L.CallByParam(lua.P{Fn: L.NewFunction(lib.fn), NRet: 0, Protect: true}, lua.LString(lib.name))
+		if err != nil {
+			L.Close()
+			return nil, err
+		}
+	}
+	for _, name := range unsafeGlobals {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	v := &vm{name: spec.Name(), state: L, fn: L.NewFunctionFromProto(proto)}
+	v.registerAPI()
+	return v, nil
+}
+
+// run runs the script for the context, and returns the result of the
+// script, which must be nil or an integer in [0, 9].
+func (v *vm) run(timeoutCtx stdcontext.Context, ctx *context.Context) (int, error) {
+	v.ctx = ctx
+	L := v.state
+	L.SetContext(timeoutCtx)
+	defer L.RemoveContext()
+
+	if err := L.CallByParam(lua.P{Fn: v.fn, NRet: 1, Protect: true}); err != nil {
+		if e := timeoutCtx.Err(); e != nil {
+			return 0, e
+		}
+		return 0, err
+	}
+
+	ret := L.Get(-1)
+	L.Pop(1)
+
+	switch r := ret.(type) {
+	case *lua.LNilType:
+		return 0, nil
+	case lua.LNumber:
+		n := int(r)
+		if lua.LNumber(n) == r && n >= 0 && n <= maxScriptResult {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid script result: %s", ret.String())
+}
+
+func (v *vm) close() {
+	v.state.Close()
+}
+
+// registerAPI registers the tables request, response, ctx and log.
+func (v *vm) registerAPI() {
+	L := v.state
+
+	L.SetGlobal("request", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"method":    v.requestMethod,
+		"setMethod": v.requestSetMethod,
+		"scheme":    v.requestScheme,
+		"host":      v.requestHost,
+		"setHost":   v.requestSetHost,
+		"path":      v.requestPath,
+		"setPath":   v.requestSetPath,
+		"query":     v.requestQuery,
+		"realIP":    v.requestRealIP,
+		"header":    v.requestHeader,
+		"setHeader": v.requestSetHeader,
+		"addHeader": v.requestAddHeader,
+		"delHeader": v.requestDelHeader,
+		"body":      v.requestBody,
+		"setBody":   v.requestSetBody,
+	}))
+
+	L.SetGlobal("response", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"status":    v.responseStatus,
+		"setStatus": v.responseSetStatus,
+		"header":    v.responseHeader,
+		"setHeader": v.responseSetHeader,
+		"addHeader": v.responseAddHeader,
+		"delHeader": v.responseDelHeader,
+		"body":      v.responseBody,
+		"setBody":   v.responseSetBody,
+	}))
+
+	L.SetGlobal("ctx", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"get":    v.ctxGet,
+		"set":    v.ctxSet,
+		"addTag": v.ctxAddTag,
+	}))
+
+	L.SetGlobal("log", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"debug": v.logFunc(logger.Debugf),
+		"info":  v.logFunc(logger.Infof),
+		"warn":  v.logFunc(logger.Warnf),
+		"error": v.logFunc(logger.Errorf),
+	}))
+}
+
+// request functions
+
+func (v *vm) inputRequest() *httpprot.Request {
+	return v.ctx.GetInputRequest().(*httpprot.Request)
+}
+
+func (v *vm) outputRequest() *httpprot.Request {
+	return v.ctx.GetOutputRequest().(*httpprot.Request)
+}
+
+func (v *vm) requestMethod(L *lua.LState) int {
+	L.Push(lua.LString(v.inputRequest().Method()))
+	return 1
+}
+
+func (v *vm) requestSetMethod(L *lua.LState) int {
+	v.outputRequest().SetMethod(L.CheckString(1))
+	return 0
+}
+
+func (v *vm) requestScheme(L *lua.LState) int {
+	L.Push(lua.LString(v.inputRequest().Scheme()))
+	return 1
+}
+
+func (v *vm) requestHost(L *lua.LState) int {
+	L.Push(lua.LString(v.inputRequest().Host()))
+	return 1
+}
+
+func (v *vm) requestSetHost(L *lua.LState) int {
+	v.outputRequest().SetHost(L.CheckString(1))
+	return 0
+}
+
+func (v *vm) requestPath(L *lua.LState) int {
+	L.Push(lua.LString(v.inputRequest().Path()))
+	return 1
+}
+
+func (v *vm) requestSetPath(L *lua.LState) int {
+	v.outputRequest().SetPath(L.CheckString(1))
+	return 0
+}
+
+func (v *vm) requestQuery(L *lua.LState) int {
+	L.Push(lua.LString(v.inputRequest().URL().Query().Get(L.CheckString(1))))
+	return 1
+}
+
+func (v *vm) requestRealIP(L *lua.LState) int {
+	L.Push(lua.LString(v.inputRequest().RealIP()))
+	return 1
+}
+
+func (v *vm) requestHeader(L *lua.LState) int {
+	L.Push(lua.LString(v.inputRequest().HTTPHeader().Get(L.CheckString(1))))
+	return 1
+}
+
+func (v *vm) requestSetHeader(L *lua.LState) int {
+	v.outputRequest().HTTPHeader().Set(L.CheckString(1), L.CheckString(2))
+	return 0
+}
+
+func (v *vm) requestAddHeader(L *lua.LState) int {
+	v.outputRequest().HTTPHeader().Add(L.CheckString(1), L.CheckString(2))
+	return 0
+}
+
+func (v *vm) requestDelHeader(L *lua.LState) int {
+	v.outputRequest().HTTPHeader().Del(L.CheckString(1))
+	return 0
+}
+
+func (v *vm) requestBody(L *lua.LState) int {
+	req := v.inputRequest()
+	if req.IsStream() {
+		L.RaiseError("the body of a streaming request is not accessible")
+		return 0
+	}
+	L.Push(lua.LString(req.RawPayload()))
+	return 1
+}
+
+func (v *vm) requestSetBody(L *lua.LState) int {
+	req := v.outputRequest()
+	if req.IsStream() {
+		if c, ok := req.GetPayload().(io.Closer); ok {
+			c.Close()
+		}
+	}
+	req.SetPayload([]byte(L.CheckString(1)))
+	return 0
+}
+
+// response functions
+
+// outputResponse returns the output response, it is created if absent,
+// e.g. the script responds to the request before the proxy.
+func (v *vm) outputResponse() *httpprot.Response {
+	if resp := v.ctx.GetOutputResponse(); resp != nil {
+		return resp.(*httpprot.Response)
+	}
+	resp, _ := httpprot.NewResponse(nil)
+	v.ctx.SetOutputResponse(resp)
+	return resp
+}
+
+func (v *vm) responseStatus(L *lua.LState) int {
+	resp := v.ctx.GetOutputResponse()
+	if resp == nil {
+		L.Push(lua.LNumber(0))
+	} else {
+		L.Push(lua.LNumber(resp.(*httpprot.Response).StatusCode()))
+	}
+	return 1
+}
+
+func (v *vm) responseSetStatus(L *lua.LState) int {
+	v.outputResponse().SetStatusCode(L.CheckInt(1))
+	return 0
+}
+
+func (v *vm) responseHeader(L *lua.LState) int {
+	resp := v.ctx.GetOutputResponse()
+	if resp == nil {
+		L.Push(lua.LString(""))
+	} else {
+		L.Push(lua.LString(resp.(*httpprot.Response).HTTPHeader().Get(L.CheckString(1))))
+	}
+	return 1
+}
+
+func (v *vm) responseSetHeader(L *lua.LState) int {
+	v.outputResponse().HTTPHeader().Set(L.CheckString(1), L.CheckString(2))
+	return 0
+}
+
+func (v *vm) responseAddHeader(L *lua.LState) int {
+	v.outputResponse().HTTPHeader().Add(L.CheckString(1), L.CheckString(2))
+	return 0
+}
+
+func (v *vm) responseDelHeader(L *lua.LState) int {
+	v.outputResponse().HTTPHeader().Del(L.CheckString(1))
+	return 0
+}
+
+func (v *vm) responseBody(L *lua.LState) int {
+	resp := v.ctx.GetOutputResponse()
+	if resp == nil {
+		L.Push(lua.LString(""))
+		return 1
+	}
+	if resp.IsStream() {
+		L.RaiseError("the body of a streaming response is not accessible")
+		return 0
+	}
+	L.Push(lua.LString(resp.RawPayload()))
+	return 1
+}
+
+func (v *vm) responseSetBody(L *lua.LState) int {
+	resp := v.outputResponse()
+	if resp.IsStream() {
+		if c, ok := resp.GetPayload().(io.Closer); ok {
+			c.Close()
+		}
+	}
+	resp.SetPayload([]byte(L.CheckString(1)))
+	return 0
+}
+
+// context functions
+
+// ctxGet returns the data of the context, only strings, numbers and
+// booleans are accessible.
+func (v *vm) ctxGet(L *lua.LState) int {
+	switch d := v.ctx.GetData(L.CheckString(1)).(type) {
+	case string:
+		L.Push(lua.LString(d))
+	case bool:
+		L.Push(lua.LBool(d))
+	case int:
+		L.Push(lua.LNumber(d))
+	case int64:
+		L.Push(lua.LNumber(d))
+	case float64:
+		L.Push(lua.LNumber(d))
+	default:
+		L.Push(lua.LNil)
+	}
+	return 1
+}
+
+func (v *vm) ctxSet(L *lua.LState) int {
+	key := L.CheckString(1)
+	switch d := L.Get(2).(type) {
+	case lua.LString:
+		v.ctx.SetData(key, string(d))
+	case lua.LBool:
+		v.ctx.SetData(key, bool(d))
+	case lua.LNumber:
+		v.ctx.SetData(key, float64(d))
+	case *lua.LNilType:
+		v.ctx.SetData(key, nil)
+	default:
+		L.ArgError(2, "must be a string, number, boolean or nil")
+	}
+	return 0
+}
+
+func (v *vm) ctxAddTag(L *lua.LState) int {
+	v.ctx.AddTag(L.CheckString(1))
+	return 0
+}
+
+// log functions
+
+func (v *vm) logFunc(fn func(template string, args ...interface{})) lua.LGFunction {
+	return func(L *lua.LState) int {
+		fn("script %s: %s", v.name, L.CheckString(1))
+		return 0
+	}
+}
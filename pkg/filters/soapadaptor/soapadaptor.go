@@ -0,0 +1,417 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package soapadaptor implements the SOAPAdaptor filter.
+package soapadaptor
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"text/template"
+
+	sprig "github.com/go-task/slim-sprig"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of SOAPAdaptor.
+	Kind = "SOAPAdaptor"
+
+	// DataSOAPAction is the key of the context data of the SOAP action of
+	// the request.
+	DataSOAPAction = "SOAP_ACTION"
+	// DataSOAPOperation is the key of the context data of the SOAP
+	// operation of the request, which is the name of the first element
+	// in the body of the envelope.
+	DataSOAPOperation = "SOAP_OPERATION"
+
+	resultInvalidEnvelope = "invalidEnvelope"
+	resultConvertFailed   = "convertFailed"
+
+	version11 = "1.1"
+	version12 = "1.2"
+
+	namespace11 = "http://schemas.xmlsoap.org/soap/envelope/"
+	namespace12 = "http://www.w3.org/2003/05/soap-envelope"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "SOAPAdaptor extracts, validates and builds SOAP requests",
+	Results:     []string{resultInvalidEnvelope, resultConvertFailed},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &SOAPAdaptor{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// SOAPAdaptor is filter SOAPAdaptor.
+	SOAPAdaptor struct {
+		spec *Spec
+
+		validator *xsdValidator
+		template  *template.Template
+	}
+
+	// Spec describes the SOAPAdaptor.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// OperationHeader is the header to save the operation of the
+		// request, so the request could be routed by it.
+		OperationHeader string          `json:"operationHeader" jsonschema:"omitempty"`
+		Validation      *ValidationSpec `json:"validation,omitempty" jsonschema:"omitempty"`
+		FromJSON        *FromJSONSpec   `json:"fromJSON,omitempty" jsonschema:"omitempty"`
+	}
+
+	// ValidationSpec describes the validation of the envelopes.
+	ValidationSpec struct {
+		// Schemas are the XSD documents to validate the elements in the
+		// body of the envelopes, the envelope structure is always
+		// validated.
+		Schemas []string `json:"schemas" jsonschema:"omitempty"`
+	}
+
+	// FromJSONSpec describes how to build SOAP requests from the non-SOAP
+	// requests, e.g. REST/JSON calls.
+	FromJSONSpec struct {
+		// Template generates the content of the body of the envelope, it
+		// is executed with the decoded JSON body (as .body), the request
+		// (as .request) and the context data (as .data).
+		Template string `json:"template" jsonschema:"required"`
+		Action   string `json:"action" jsonschema:"omitempty"`
+		Version  string `json:"version" jsonschema:"omitempty,enum=,enum=1.1,enum=1.2"`
+	}
+
+	// envelope is the result of parsing a SOAP envelope.
+	envelope struct {
+		version   string
+		operation *xmlNode
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if spec.Validation != nil {
+		if _, err := newXSDValidator(spec.Validation.Schemas); err != nil {
+			return err
+		}
+	}
+	if spec.FromJSON != nil {
+		if _, err := newTemplate(spec.FromJSON.Template); err != nil {
+			return fmt.Errorf("invalid template: %v", err)
+		}
+	}
+	return nil
+}
+
+func newTemplate(text string) (*template.Template, error) {
+	return template.New("").Funcs(sprig.TxtFuncMap()).Parse(text)
+}
+
+// Name returns the name of the SOAPAdaptor filter instance.
+func (sa *SOAPAdaptor) Name() string {
+	return sa.spec.Name()
+}
+
+// Kind returns the kind of SOAPAdaptor.
+func (sa *SOAPAdaptor) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the SOAPAdaptor.
+func (sa *SOAPAdaptor) Spec() filters.Spec {
+	return sa.spec
+}
+
+// Init initializes SOAPAdaptor.
+func (sa *SOAPAdaptor) Init() {
+	sa.reload()
+}
+
+// Inherit inherits previous generation of SOAPAdaptor.
+func (sa *SOAPAdaptor) Inherit(previousGeneration filters.Filter) {
+	sa.reload()
+}
+
+func (sa *SOAPAdaptor) reload() {
+	// the spec has been validated, so no errors here.
+	if sa.spec.Validation != nil {
+		sa.validator, _ = newXSDValidator(sa.spec.Validation.Schemas)
+	}
+	if sa.spec.FromJSON != nil {
+		sa.template, _ = newTemplate(sa.spec.FromJSON.Template)
+	}
+}
+
+// isSOAP checks whether the media type is a SOAP one.
+func isSOAP(mediaType string) bool {
+	switch mediaType {
+	case "text/xml", "application/xml", "application/soap+xml":
+		return true
+	}
+	return false
+}
+
+// Handle handles the SOAP request.
+func (sa *SOAPAdaptor) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	mediaType, params, _ := mime.ParseMediaType(req.HTTPHeader().Get("Content-Type"))
+	if !isSOAP(mediaType) {
+		if sa.template == nil {
+			if sa.validator != nil {
+				return sa.fault(ctx, version11, "the request is not a SOAP request")
+			}
+			return ""
+		}
+		if result := sa.buildRequest(ctx, req); result != "" {
+			return result
+		}
+		mediaType, params, _ = mime.ParseMediaType(req.HTTPHeader().Get("Content-Type"))
+	}
+
+	if req.IsStream() {
+		if sa.validator != nil {
+			return sa.fault(ctx, version11, "the request body is too large")
+		}
+		logger.Warnf("%s: cannot parse a stream body", sa.Name())
+		return ""
+	}
+
+	env, err := parseEnvelope(req.RawPayload())
+	if err != nil {
+		return sa.fault(ctx, version11, err.Error())
+	}
+
+	action := ""
+	if env.version == version11 {
+		action = strings.Trim(req.HTTPHeader().Get("SOAPAction"), `"`)
+	} else if mediaType == "application/soap+xml" {
+		action = params["action"]
+	}
+	operation := env.operation.name.Local
+
+	ctx.SetData(DataSOAPAction, action)
+	ctx.SetData(DataSOAPOperation, operation)
+	ctx.AddTag("soapOperation: " + operation)
+	if sa.spec.OperationHeader != "" {
+		req.HTTPHeader().Set(sa.spec.OperationHeader, operation)
+	}
+
+	if sa.validator != nil {
+		if err := sa.validator.validate(env.operation); err != nil {
+			return sa.fault(ctx, env.version, err.Error())
+		}
+	}
+
+	return ""
+}
+
+// parseXML parses data into a tree of nodes.
+func parseXML(data []byte) (*xmlNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	var stack []*xmlNode
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no root element")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name, attrs: t.Attr}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			}
+			stack = append(stack, node)
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		case xml.EndElement:
+			node := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return node, nil
+			}
+		}
+	}
+}
+
+// parseEnvelope parses and validates the structure of a SOAP envelope.
+func parseEnvelope(data []byte) (*envelope, error) {
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid XML: %v", err)
+	}
+
+	env := &envelope{}
+	switch root.name.Space {
+	case namespace11:
+		env.version = version11
+	case namespace12:
+		env.version = version12
+	default:
+		return nil, fmt.Errorf("unknown envelope namespace %q", root.name.Space)
+	}
+	if root.name.Local != "Envelope" {
+		return nil, fmt.Errorf("the root element is not an envelope")
+	}
+
+	var body *xmlNode
+	for i, child := range root.children {
+		if child.name.Space != root.name.Space {
+			return nil, fmt.Errorf("unexpected element %s in the envelope", child.name.Local)
+		}
+		switch {
+		case child.name.Local == "Header" && i == 0:
+		case child.name.Local == "Body" && body == nil:
+			body = child
+		default:
+			return nil, fmt.Errorf("unexpected element %s in the envelope", child.name.Local)
+		}
+	}
+	if body == nil {
+		return nil, fmt.Errorf("body is not found in the envelope")
+	}
+	if len(body.children) == 0 {
+		return nil, fmt.Errorf("body of the envelope is empty")
+	}
+
+	env.operation = body.children[0]
+	return env, nil
+}
+
+// buildRequest builds a SOAP request from a non-SOAP request.
+func (sa *SOAPAdaptor) buildRequest(ctx *context.Context, req *httpprot.Request) string {
+	if req.IsStream() {
+		logger.Warnf("%s: cannot build a SOAP request from a stream body", sa.Name())
+		return resultConvertFailed
+	}
+
+	var body interface{}
+	if data := bytes.TrimSpace(req.RawPayload()); len(data) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&body); err != nil {
+			logger.Debugf("%s: failed to decode JSON body: %v", sa.Name(), err)
+			return resultConvertFailed
+		}
+	}
+
+	var content bytes.Buffer
+	err := sa.template.Execute(&content, map[string]interface{}{
+		"body":    body,
+		"request": req.ToBuilderRequest(""),
+		"data":    ctx.Data(),
+	})
+	if err != nil {
+		logger.Debugf("%s: failed to execute template: %v", sa.Name(), err)
+		return resultConvertFailed
+	}
+
+	spec := sa.spec.FromJSON
+	ns, contentType := namespace11, "text/xml; charset=utf-8"
+	if spec.Version == version12 {
+		ns, contentType = namespace12, "application/soap+xml; charset=utf-8"
+		if spec.Action != "" {
+			contentType = mime.FormatMediaType("application/soap+xml", map[string]string{
+				"charset": "utf-8",
+				"action":  spec.Action,
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	fmt.Fprintf(&buf, `<soap:Envelope xmlns:soap="%s"><soap:Body>`, ns)
+	buf.Write(content.Bytes())
+	buf.WriteString(`</soap:Body></soap:Envelope>`)
+
+	h := req.HTTPHeader()
+	h.Set("Content-Type", contentType)
+	h.Del("Content-Length")
+	if spec.Version != version12 {
+		h.Set("SOAPAction", `"`+spec.Action+`"`)
+	}
+	req.SetMethod(http.MethodPost)
+	req.SetPayload(buf.Bytes())
+	return ""
+}
+
+// fault sets a SOAP fault response, the fault is caused by the client.
+func (sa *SOAPAdaptor) fault(ctx *context.Context, version, reason string) string {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	resp, _ := httpprot.NewResponse(nil)
+	if version == version12 {
+		resp.SetStatusCode(http.StatusBadRequest)
+		resp.HTTPHeader().Set("Content-Type", "application/soap+xml; charset=utf-8")
+		fmt.Fprintf(&buf, `<env:Envelope xmlns:env="%s"><env:Body><env:Fault>`, namespace12)
+		buf.WriteString(`<env:Code><env:Value>env:Sender</env:Value></env:Code>`)
+		buf.WriteString(`<env:Reason><env:Text xml:lang="en">`)
+		xml.EscapeText(&buf, []byte(reason))
+		buf.WriteString(`</env:Text></env:Reason></env:Fault></env:Body></env:Envelope>`)
+	} else {
+		resp.SetStatusCode(http.StatusInternalServerError)
+		resp.HTTPHeader().Set("Content-Type", "text/xml; charset=utf-8")
+		fmt.Fprintf(&buf, `<soap:Envelope xmlns:soap="%s"><soap:Body><soap:Fault>`, namespace11)
+		buf.WriteString(`<faultcode>soap:Client</faultcode><faultstring>`)
+		xml.EscapeText(&buf, []byte(reason))
+		buf.WriteString(`</faultstring></soap:Fault></soap:Body></soap:Envelope>`)
+	}
+
+	resp.SetPayload(buf.Bytes())
+	ctx.SetOutputResponse(resp)
+	return resultInvalidEnvelope
+}
+
+// Status returns status.
+func (sa *SOAPAdaptor) Status() interface{} {
+	return nil
+}
+
+// Close closes SOAPAdaptor.
+func (sa *SOAPAdaptor) Close() {
+}
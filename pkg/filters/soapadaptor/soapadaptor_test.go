@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package soapadaptor
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newSOAPAdaptor(t *testing.T, yamlConfig string) *SOAPAdaptor {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	sa := kind.CreateInstance(spec).(*SOAPAdaptor)
+	sa.Init()
+	return sa
+}
+
+func newContext(method, contentType, body string) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(method, "http://megaease.com/orders", strings.NewReader(body))
+	stdr.Header.Set("Content-Type", contentType)
+	req, _ := httpprot.NewRequest(stdr)
+	req.FetchPayload(0)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+const yamlConfig = `
+kind: SOAPAdaptor
+name: soap
+operationHeader: X-SOAP-Operation
+validation:
+  schemas:
+  - |
+    <xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" targetNamespace="urn:orders">
+      <xs:element name="GetOrder">
+        <xs:complexType>
+          <xs:sequence>
+            <xs:element name="id" type="xs:int"/>
+            <xs:element name="tag" type="xs:string" minOccurs="0" maxOccurs="unbounded"/>
+            <xs:element name="item" type="Item" minOccurs="0"/>
+          </xs:sequence>
+        </xs:complexType>
+      </xs:element>
+      <xs:complexType name="Item">
+        <xs:all>
+          <xs:element name="sku" type="xs:string"/>
+          <xs:element name="paid" type="xs:boolean" minOccurs="0"/>
+        </xs:all>
+      </xs:complexType>
+    </xs:schema>
+`
+
+func TestExtractAndValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	sa := newSOAPAdaptor(t, yamlConfig)
+
+	body := `<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">
+  <s:Header/>
+  <s:Body>
+    <o:GetOrder xmlns:o="urn:orders">
+      <id>1</id><tag>a</tag><tag>b</tag>
+      <item><paid>true</paid><sku>x</sku></item>
+    </o:GetOrder>
+  </s:Body>
+</s:Envelope>`
+	ctx := newContext(http.MethodPost, "text/xml; charset=utf-8", body)
+	ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Set("SOAPAction", `"urn:orders/GetOrder"`)
+	assert.Equal("", sa.Handle(ctx))
+	assert.Equal("urn:orders/GetOrder", ctx.GetData(DataSOAPAction))
+	assert.Equal("GetOrder", ctx.GetData(DataSOAPOperation))
+	assert.Equal("GetOrder", ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Get("X-SOAP-Operation"))
+
+	// SOAP 1.2 with an invalid element.
+	body = `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope">
+  <env:Body><GetOrder><id>x</id></GetOrder></env:Body>
+</env:Envelope>`
+	ctx = newContext(http.MethodPost, `application/soap+xml; action="urn:orders/GetOrder"`, body)
+	assert.Equal(resultInvalidEnvelope, sa.Handle(ctx))
+	assert.Equal("urn:orders/GetOrder", ctx.GetData(DataSOAPAction))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode())
+	assert.Contains(string(resp.RawPayload()), `<env:Text xml:lang="en">element id: &#34;x&#34; is not a valid int</env:Text>`)
+
+	// invalid envelopes.
+	for _, body := range []string{
+		`<GetOrder><id>1</id></GetOrder>`,
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body/></s:Envelope>`,
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><Other/></s:Body></s:Envelope>`,
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><GetOrder>`,
+	} {
+		ctx = newContext(http.MethodPost, "text/xml", body)
+		assert.Equal(resultInvalidEnvelope, sa.Handle(ctx), body)
+		resp = ctx.GetOutputResponse().(*httpprot.Response)
+		assert.Equal(http.StatusInternalServerError, resp.StatusCode())
+		assert.Contains(string(resp.RawPayload()), "<faultcode>soap:Client</faultcode>")
+	}
+
+	// not a SOAP request.
+	ctx = newContext(http.MethodGet, "application/json", "{}")
+	assert.Equal(resultInvalidEnvelope, sa.Handle(ctx))
+}
+
+func TestFromJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	sa := newSOAPAdaptor(t, yamlConfig+`
+fromJSON:
+  action: urn:orders/GetOrder
+  template: '<o:GetOrder xmlns:o="urn:orders"><id>{{.body.id}}</id>{{range .body.tags}}<tag>{{.}}</tag>{{end}}</o:GetOrder>'
+`)
+
+	ctx := newContext(http.MethodGet, "application/json", `{"id": 42, "tags": ["a", "b"]}`)
+	assert.Equal("", sa.Handle(ctx))
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal(http.MethodPost, req.Method())
+	assert.Equal("text/xml; charset=utf-8", req.HTTPHeader().Get("Content-Type"))
+	assert.Equal(`"urn:orders/GetOrder"`, req.HTTPHeader().Get("SOAPAction"))
+	assert.Contains(string(req.RawPayload()), `<soap:Body><o:GetOrder xmlns:o="urn:orders"><id>42</id><tag>a</tag><tag>b</tag></o:GetOrder></soap:Body>`)
+	assert.Equal("GetOrder", ctx.GetData(DataSOAPOperation))
+
+	// the generated envelope is validated too.
+	ctx = newContext(http.MethodGet, "application/json", `{"id": "x"}`)
+	assert.Equal(resultInvalidEnvelope, sa.Handle(ctx))
+
+	ctx = newContext(http.MethodPost, "application/json", `{"id":`)
+	assert.Equal(resultConvertFailed, sa.Handle(ctx))
+
+	// invalid spec.
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte("kind: SOAPAdaptor\nname: soap\nfromJSON:\n  template: '{{.body'"), &rawSpec)
+	_, err := filters.NewSpec(nil, "", rawSpec)
+	assert.Error(err)
+}
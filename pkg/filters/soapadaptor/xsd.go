@@ -0,0 +1,310 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package soapadaptor
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The XSD support is a subset of XML Schema, which covers the typical
+// schemas of SOAP services: global elements, named and anonymous complex
+// types with sequence, all or choice of elements, minOccurs/maxOccurs,
+// and the built-in simple types. The unsupported features, like
+// attributes, substitution groups or facets of simple types, are ignored.
+
+type (
+	xsdSchema struct {
+		TargetNamespace string            `xml:"targetNamespace,attr"`
+		Elements        []*xsdElement     `xml:"element"`
+		ComplexTypes    []*xsdComplexType `xml:"complexType"`
+		SimpleTypes     []*xsdSimpleType  `xml:"simpleType"`
+	}
+
+	xsdElement struct {
+		Name        string          `xml:"name,attr"`
+		Ref         string          `xml:"ref,attr"`
+		Type        string          `xml:"type,attr"`
+		MinOccurs   string          `xml:"minOccurs,attr"`
+		MaxOccurs   string          `xml:"maxOccurs,attr"`
+		ComplexType *xsdComplexType `xml:"complexType"`
+		SimpleType  *xsdSimpleType  `xml:"simpleType"`
+	}
+
+	xsdComplexType struct {
+		Name     string    `xml:"name,attr"`
+		Sequence *xsdGroup `xml:"sequence"`
+		All      *xsdGroup `xml:"all"`
+		Choice   *xsdGroup `xml:"choice"`
+	}
+
+	xsdSimpleType struct {
+		Name        string `xml:"name,attr"`
+		Restriction struct {
+			Base string `xml:"base,attr"`
+		} `xml:"restriction"`
+	}
+
+	xsdGroup struct {
+		Elements []*xsdElement `xml:"element"`
+	}
+
+	// xsdValidator validates XML elements against a set of schemas.
+	xsdValidator struct {
+		elements     map[string]*xsdElement
+		complexTypes map[string]*xsdComplexType
+		simpleTypes  map[string]*xsdSimpleType
+	}
+
+	// xmlNode is an element of an XML document.
+	xmlNode struct {
+		name     xml.Name
+		attrs    []xml.Attr
+		children []*xmlNode
+		text     string
+	}
+)
+
+func newXSDValidator(schemas []string) (*xsdValidator, error) {
+	v := &xsdValidator{
+		elements:     map[string]*xsdElement{},
+		complexTypes: map[string]*xsdComplexType{},
+		simpleTypes:  map[string]*xsdSimpleType{},
+	}
+
+	for i, text := range schemas {
+		s := &xsdSchema{}
+		if err := xml.Unmarshal([]byte(text), s); err != nil {
+			return nil, fmt.Errorf("schema %d: %v", i, err)
+		}
+		for _, e := range s.Elements {
+			v.elements[e.Name] = e
+		}
+		for _, t := range s.ComplexTypes {
+			v.complexTypes[t.Name] = t
+		}
+		for _, t := range s.SimpleTypes {
+			v.simpleTypes[t.Name] = t
+		}
+	}
+
+	return v, nil
+}
+
+// localName removes the namespace prefix of a qualified name.
+func localName(name string) string {
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+func parseOccurs(s string, dflt int) int {
+	if s == "" {
+		return dflt
+	}
+	if s == "unbounded" {
+		return math.MaxInt32
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return dflt
+	}
+	return n
+}
+
+// validate validates node against the global element of the same name.
+func (v *xsdValidator) validate(node *xmlNode) error {
+	e := v.elements[node.name.Local]
+	if e == nil {
+		return fmt.Errorf("element %s is not declared", node.name.Local)
+	}
+	return v.validateElement(node, e)
+}
+
+func (v *xsdValidator) validateElement(node *xmlNode, e *xsdElement) error {
+	if e.ComplexType != nil {
+		return v.validateComplex(node, e.ComplexType)
+	}
+	if e.SimpleType != nil {
+		return v.validateSimple(node, e.SimpleType.Restriction.Base)
+	}
+	if e.Type == "" {
+		// anyType
+		return nil
+	}
+	if t := v.complexTypes[localName(e.Type)]; t != nil {
+		return v.validateComplex(node, t)
+	}
+	return v.validateSimple(node, e.Type)
+}
+
+func (v *xsdValidator) validateSimple(node *xmlNode, typ string) error {
+	if len(node.children) > 0 {
+		return fmt.Errorf("element %s must not have child elements", node.name.Local)
+	}
+
+	name := localName(typ)
+	if t := v.simpleTypes[name]; t != nil {
+		return v.validateSimple(node, t.Restriction.Base)
+	}
+
+	if err := checkBuiltinType(name, strings.TrimSpace(node.text)); err != nil {
+		return fmt.Errorf("element %s: %v", node.name.Local, err)
+	}
+	return nil
+}
+
+func checkBuiltinType(typ, text string) error {
+	var err error
+
+	switch typ {
+	case "int", "integer", "long", "short", "byte", "negativeInteger", "nonPositiveInteger":
+		_, err = strconv.ParseInt(text, 10, 64)
+	case "nonNegativeInteger", "positiveInteger", "unsignedLong", "unsignedInt", "unsignedShort", "unsignedByte":
+		_, err = strconv.ParseUint(text, 10, 64)
+	case "decimal", "float", "double":
+		_, err = strconv.ParseFloat(text, 64)
+	case "boolean":
+		if text != "true" && text != "false" && text != "1" && text != "0" {
+			err = fmt.Errorf("invalid boolean")
+		}
+	case "date":
+		_, err = time.Parse("2006-01-02", text)
+	case "dateTime":
+		_, err = time.Parse(time.RFC3339, text)
+		if err != nil {
+			_, err = time.Parse("2006-01-02T15:04:05", text)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("%q is not a valid %s", text, typ)
+	}
+	return nil
+}
+
+// resolve returns the element declaration referenced by e, or e itself.
+func (v *xsdValidator) resolve(e *xsdElement) *xsdElement {
+	if e.Ref == "" {
+		return e
+	}
+	if ref := v.elements[localName(e.Ref)]; ref != nil {
+		return ref
+	}
+	return e
+}
+
+func (v *xsdValidator) validateComplex(node *xmlNode, t *xsdComplexType) error {
+	switch {
+	case t.Sequence != nil:
+		return v.validateSequence(node, t.Sequence)
+	case t.All != nil:
+		return v.validateAll(node, t.All)
+	case t.Choice != nil:
+		return v.validateChoice(node, t.Choice)
+	}
+
+	if len(node.children) > 0 {
+		return fmt.Errorf("element %s must be empty", node.name.Local)
+	}
+	return nil
+}
+
+func (v *xsdValidator) validateSequence(node *xmlNode, g *xsdGroup) error {
+	children := node.children
+	for _, decl := range g.Elements {
+		e := v.resolve(decl)
+		min, max := parseOccurs(decl.MinOccurs, 1), parseOccurs(decl.MaxOccurs, 1)
+
+		count := 0
+		for len(children) > 0 && children[0].name.Local == e.Name && count < max {
+			if err := v.validateElement(children[0], e); err != nil {
+				return err
+			}
+			children = children[1:]
+			count++
+		}
+		if count < min {
+			return fmt.Errorf("element %s requires at least %d %s", node.name.Local, min, e.Name)
+		}
+	}
+
+	if len(children) > 0 {
+		return fmt.Errorf("element %s has unexpected child element %s", node.name.Local, children[0].name.Local)
+	}
+	return nil
+}
+
+func (v *xsdValidator) validateAll(node *xmlNode, g *xsdGroup) error {
+	counts := map[string]int{}
+	for _, child := range node.children {
+		var decl *xsdElement
+		for _, d := range g.Elements {
+			if v.resolve(d).Name == child.name.Local {
+				decl = d
+				break
+			}
+		}
+		if decl == nil {
+			return fmt.Errorf("element %s has unexpected child element %s", node.name.Local, child.name.Local)
+		}
+		if err := v.validateElement(child, v.resolve(decl)); err != nil {
+			return err
+		}
+		counts[child.name.Local]++
+	}
+
+	for _, decl := range g.Elements {
+		name := v.resolve(decl).Name
+		if n := counts[name]; n < parseOccurs(decl.MinOccurs, 1) || n > 1 {
+			return fmt.Errorf("element %s has %d %s", node.name.Local, n, name)
+		}
+	}
+	return nil
+}
+
+func (v *xsdValidator) validateChoice(node *xmlNode, g *xsdGroup) error {
+	if len(node.children) == 0 {
+		return fmt.Errorf("element %s requires one of its choices", node.name.Local)
+	}
+
+	name := node.children[0].name.Local
+	for _, decl := range g.Elements {
+		e := v.resolve(decl)
+		if e.Name != name {
+			continue
+		}
+		max := parseOccurs(decl.MaxOccurs, 1)
+		for i, child := range node.children {
+			if child.name.Local != name || i >= max {
+				return fmt.Errorf("element %s has unexpected child element %s", node.name.Local, child.name.Local)
+			}
+			if err := v.validateElement(child, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("element %s has unexpected child element %s", node.name.Local, name)
+}
@@ -0,0 +1,358 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package staticserver implements the StaticServer filter.
+package staticserver
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of StaticServer.
+	Kind = "StaticServer"
+
+	resultNotFound = "notFound"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "StaticServer serves static files from a directory or a zip archive.",
+	Results:     []string{resultNotFound},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{IndexFiles: []string{"index.html"}}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &StaticServer{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// StaticServer is filter StaticServer.
+	StaticServer struct {
+		spec *Spec
+
+		fsys    fs.FS
+		archive *zip.ReadCloser
+	}
+
+	// Spec describes the StaticServer.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Root             string   `json:"root" jsonschema:"omitempty"`
+		Archive          string   `json:"archive" jsonschema:"omitempty"`
+		PathPrefix       string   `json:"pathPrefix" jsonschema:"omitempty,pattern=^/"`
+		IndexFiles       []string `json:"indexFiles" jsonschema:"omitempty"`
+		DirectoryListing bool     `json:"directoryListing" jsonschema:"omitempty"`
+		SPAFallback      string   `json:"spaFallback" jsonschema:"omitempty"`
+		CacheControl     string   `json:"cacheControl" jsonschema:"omitempty"`
+	}
+
+	// pipeResponseWriter is an http.ResponseWriter which sends the body
+	// to a pipe, so that the body could be read as a stream.
+	pipeResponseWriter struct {
+		header   http.Header
+		status   int
+		pw       *io.PipeWriter
+		once     sync.Once
+		headerCh chan struct{}
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if (spec.Root == "") == (spec.Archive == "") {
+		return fmt.Errorf("one and only one of root and archive must be specified")
+	}
+	return nil
+}
+
+// Name returns the name of the StaticServer filter instance.
+func (ss *StaticServer) Name() string {
+	return ss.spec.Name()
+}
+
+// Kind returns the kind of StaticServer.
+func (ss *StaticServer) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the StaticServer
+func (ss *StaticServer) Spec() filters.Spec {
+	return ss.spec
+}
+
+// Init initializes StaticServer.
+func (ss *StaticServer) Init() {
+	ss.reload()
+}
+
+// Inherit inherits previous generation of StaticServer.
+func (ss *StaticServer) Inherit(previousGeneration filters.Filter) {
+	ss.Init()
+}
+
+func (ss *StaticServer) reload() {
+	if ss.spec.Root != "" {
+		ss.fsys = os.DirFS(ss.spec.Root)
+		return
+	}
+
+	archive, err := zip.OpenReader(ss.spec.Archive)
+	if err != nil {
+		logger.Errorf("%s: failed to open archive %s: %v", ss.Name(), ss.spec.Archive, err)
+		return
+	}
+	ss.archive = archive
+	ss.fsys = archive
+}
+
+// Handle serves the file requested.
+func (ss *StaticServer) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	if req.Method() != http.MethodGet && req.Method() != http.MethodHead {
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(http.StatusMethodNotAllowed)
+		resp.HTTPHeader().Set("Allow", "GET, HEAD")
+		ctx.SetOutputResponse(resp)
+		return ""
+	}
+
+	if ss.fsys == nil {
+		return ss.notFound(ctx)
+	}
+
+	reqPath := req.Path()
+	if !strings.HasPrefix(reqPath, ss.spec.PathPrefix) {
+		return ss.notFound(ctx)
+	}
+	name := cleanName(strings.TrimPrefix(reqPath, ss.spec.PathPrefix))
+
+	f, info, err := ss.open(name)
+	if err == nil && info.IsDir() {
+		f.Close()
+
+		// redirect to the path with a trailing slash, so that the relative
+		// links in the index file or the listing work.
+		if !strings.HasSuffix(reqPath, "/") {
+			ss.redirect(ctx, req, reqPath+"/")
+			return ""
+		}
+
+		var dir string
+		dir, f, info, err = name, nil, nil, fs.ErrNotExist
+		for _, index := range ss.spec.IndexFiles {
+			if f, info, err = ss.open(path.Join(dir, index)); err != nil {
+				continue
+			}
+			if !info.IsDir() {
+				break
+			}
+			f.Close()
+			f, info, err = nil, nil, fs.ErrNotExist
+		}
+
+		if err != nil && ss.spec.DirectoryListing {
+			ss.listDirectory(ctx, dir)
+			return ""
+		}
+	}
+
+	if err != nil && ss.spec.SPAFallback != "" {
+		f, info, err = ss.open(cleanName(ss.spec.SPAFallback))
+	}
+
+	if err != nil || info.IsDir() {
+		if f != nil {
+			f.Close()
+		}
+		return ss.notFound(ctx)
+	}
+
+	ss.serveFile(ctx, req, f, info)
+	return ""
+}
+
+func cleanName(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (ss *StaticServer) open(name string) (fs.File, fs.FileInfo, error) {
+	f, err := ss.fsys.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	return f, info, nil
+}
+
+func (ss *StaticServer) notFound(ctx *context.Context) string {
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusNotFound)
+	ctx.SetOutputResponse(resp)
+	return resultNotFound
+}
+
+func (ss *StaticServer) redirect(ctx *context.Context, req *httpprot.Request, location string) {
+	if q := req.Std().URL.RawQuery; q != "" {
+		location += "?" + q
+	}
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusMovedPermanently)
+	resp.HTTPHeader().Set("Location", location)
+	ctx.SetOutputResponse(resp)
+}
+
+func (ss *StaticServer) listDirectory(ctx *context.Context, dir string) {
+	entries, err := fs.ReadDir(ss.fsys, dir)
+	if err != nil {
+		ss.notFound(ctx)
+		return
+	}
+
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString("<!doctype html>\n<meta name=\"viewport\" content=\"width=device-width\">\n<pre>\n")
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			name += "/"
+		}
+		u := url.URL{Path: name}
+		fmt.Fprintf(buf, "<a href=\"%s\">%s</a>\n", u.String(), html.EscapeString(name))
+	}
+	buf.WriteString("</pre>\n")
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.HTTPHeader().Set("Content-Type", "text/html; charset=utf-8")
+	resp.SetPayload(buf.Bytes())
+	ctx.SetOutputResponse(resp)
+}
+
+// serveFile serves the file with http.ServeContent, which handles the
+// conditional and range requests. The body is streamed through a pipe,
+// so large files are not loaded into memory.
+func (ss *StaticServer) serveFile(ctx *context.Context, req *httpprot.Request, f fs.File, info fs.FileInfo) {
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		// files in a zip archive are not seekable.
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			logger.Errorf("%s: failed to read file %s: %v", ss.Name(), info.Name(), err)
+			ss.notFound(ctx)
+			return
+		}
+		content, f = bytes.NewReader(data), nil
+	}
+
+	pr, pw := io.Pipe()
+	w := &pipeResponseWriter{
+		header:   http.Header{},
+		pw:       pw,
+		headerCh: make(chan struct{}),
+	}
+
+	etag := `"` + strconv.FormatInt(info.ModTime().UnixNano(), 36) + "-" + strconv.FormatInt(info.Size(), 36) + `"`
+	w.header.Set("ETag", etag)
+	if ss.spec.CacheControl != "" {
+		w.header.Set("Cache-Control", ss.spec.CacheControl)
+	}
+
+	go func() {
+		defer func() {
+			if f != nil {
+				f.Close()
+			}
+			w.WriteHeader(http.StatusOK)
+			pw.Close()
+		}()
+		http.ServeContent(w, req.Std(), info.Name(), info.ModTime(), content)
+	}()
+
+	<-w.headerCh
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(w.status)
+	for k, v := range w.header {
+		resp.HTTPHeader()[k] = v
+	}
+	resp.SetPayload(pr)
+	ctx.SetOutputResponse(resp)
+}
+
+func (w *pipeResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *pipeResponseWriter) WriteHeader(statusCode int) {
+	w.once.Do(func() {
+		w.status = statusCode
+		close(w.headerCh)
+	})
+}
+
+func (w *pipeResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	// the write fails with io.ErrClosedPipe if the response is closed
+	// before the body is fully read, which stops http.ServeContent.
+	return w.pw.Write(p)
+}
+
+// Status returns status.
+func (ss *StaticServer) Status() interface{} {
+	return nil
+}
+
+// Close closes StaticServer.
+func (ss *StaticServer) Close() {
+	if ss.archive != nil {
+		ss.archive.Close()
+	}
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package staticserver
+
+import (
+	"archive/zip"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newStaticServer(t *testing.T, yamlConfig string) *StaticServer {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	ss := kind.CreateInstance(spec).(*StaticServer)
+	ss.Init()
+	return ss
+}
+
+func serve(ss *StaticServer, method, url string, header http.Header) (string, *httpprot.Response, string) {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(method, url, nil)
+	for k, v := range header {
+		stdr.Header[k] = v
+	}
+	req, _ := httpprot.NewRequest(stdr)
+	ctx.SetInputRequest(req)
+
+	result := ss.Handle(ctx)
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	body, _ := io.ReadAll(resp.GetPayload())
+	resp.Close()
+	return result, resp, string(body)
+}
+
+func TestStaticServer(t *testing.T) {
+	assert := assert.New(t)
+
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "index.html"), []byte("<html>index</html>"), 0o644)
+	os.MkdirAll(filepath.Join(root, "assets"), 0o755)
+	os.WriteFile(filepath.Join(root, "assets", "app.js"), []byte("console.log('hello')"), 0o644)
+
+	ss := newStaticServer(t, `
+kind: StaticServer
+name: static
+root: `+root+`
+pathPrefix: /static
+spaFallback: /index.html
+cacheControl: max-age=60
+`)
+	defer ss.Close()
+
+	result, resp, body := serve(ss, http.MethodGet, "http://megaease.com/static/assets/app.js", nil)
+	assert.Equal("", result)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Equal("console.log('hello')", body)
+	assert.Equal("max-age=60", resp.HTTPHeader().Get("Cache-Control"))
+	assert.Contains(resp.HTTPHeader().Get("Content-Type"), "javascript")
+	etag := resp.HTTPHeader().Get("ETag")
+	assert.NotEmpty(etag)
+
+	_, resp, _ = serve(ss, http.MethodGet, "http://megaease.com/static/assets/app.js", http.Header{"If-None-Match": {etag}})
+	assert.Equal(http.StatusNotModified, resp.StatusCode())
+
+	_, resp, body = serve(ss, http.MethodGet, "http://megaease.com/static/assets/app.js", http.Header{"Range": {"bytes=0-6"}})
+	assert.Equal(http.StatusPartialContent, resp.StatusCode())
+	assert.Equal("console", body)
+
+	// directory.
+	_, resp, _ = serve(ss, http.MethodGet, "http://megaease.com/static?x=1", nil)
+	assert.Equal(http.StatusMovedPermanently, resp.StatusCode())
+	assert.Equal("/static/?x=1", resp.HTTPHeader().Get("Location"))
+
+	_, resp, body = serve(ss, http.MethodGet, "http://megaease.com/static/", nil)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Equal("<html>index</html>", body)
+
+	// SPA fallback.
+	_, resp, body = serve(ss, http.MethodGet, "http://megaease.com/static/users/1", nil)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Equal("<html>index</html>", body)
+
+	// path traversal is not allowed.
+	_, _, body = serve(ss, http.MethodGet, "http://megaease.com/static/../../etc/passwd", nil)
+	assert.Equal("<html>index</html>", body)
+
+	_, resp, _ = serve(ss, http.MethodPost, "http://megaease.com/static/index.html", nil)
+	assert.Equal(http.StatusMethodNotAllowed, resp.StatusCode())
+
+	result, resp, _ = serve(ss, http.MethodGet, "http://megaease.com/other", nil)
+	assert.Equal(resultNotFound, result)
+	assert.Equal(http.StatusNotFound, resp.StatusCode())
+}
+
+func TestDirectoryListing(t *testing.T) {
+	assert := assert.New(t)
+
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0o644)
+	os.MkdirAll(filepath.Join(root, "b"), 0o755)
+
+	ss := newStaticServer(t, `
+kind: StaticServer
+name: static
+root: `+root+`
+directoryListing: true
+`)
+	defer ss.Close()
+
+	_, resp, body := serve(ss, http.MethodGet, "http://megaease.com/", nil)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Contains(body, `<a href="a.txt">a.txt</a>`)
+	assert.Contains(body, `<a href="b/">b/</a>`)
+
+	result, _, _ := serve(ss, http.MethodGet, "http://megaease.com/c.txt", nil)
+	assert.Equal(resultNotFound, result)
+}
+
+func TestArchive(t *testing.T) {
+	assert := assert.New(t)
+
+	archive := filepath.Join(t.TempDir(), "site.zip")
+	f, _ := os.Create(archive)
+	zw := zip.NewWriter(f)
+	w, _ := zw.Create("index.html")
+	w.Write([]byte("<html>zip</html>"))
+	zw.Close()
+	f.Close()
+
+	ss := newStaticServer(t, `
+kind: StaticServer
+name: static
+archive: `+archive+`
+`)
+	defer ss.Close()
+
+	_, resp, body := serve(ss, http.MethodGet, "http://megaease.com/", nil)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Equal("<html>zip</html>", body)
+}
@@ -31,6 +31,7 @@ import (
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/customdata"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/protocols/httpprot"
 	"github.com/megaease/easegress/pkg/protocols/httpprot/httpheader"
@@ -80,9 +81,7 @@ type (
 		userFileObject *htpasswd.File
 		cluster        cluster.Cluster
 		prefix         string
-		syncInterval   time.Duration
-		stopCtx        context.Context
-		cancel         context.CancelFunc
+		watcher        *customdata.Watcher
 	}
 
 	// BasicAuthValidator defines the Basic Auth validator
@@ -203,47 +202,40 @@ func newEtcdUserCache(cluster cluster.Cluster, etcdPrefix string) *etcdUserCache
 		prefix = customDataPrefix + strings.TrimPrefix(etcdPrefix, "/")
 	}
 	logger.Infof("credentials etcd prefix %s", prefix)
-	kvs, err := cluster.GetPrefix(prefix)
+	// the credentials are loaded by WatchChanges.
+	userFileObject, err := htpasswd.NewFromReader(bytes.NewReader(nil), htpasswd.DefaultSystems, nil)
 	if err != nil {
 		logger.Errorf(err.Error())
 		return &etcdUserCache{}
 	}
-	pwReader := kvsToReader(kvs)
-	userFileObject, err := htpasswd.NewFromReader(pwReader, htpasswd.DefaultSystems, nil)
-	if err != nil {
-		logger.Errorf(err.Error())
-		return &etcdUserCache{}
-	}
-	stopCtx, cancel := context.WithCancel(context.Background())
 	return &etcdUserCache{
 		userFileObject: userFileObject,
 		cluster:        cluster,
 		prefix:         prefix,
-		cancel:         cancel,
-		stopCtx:        stopCtx,
-		// cluster.Syncer updates changes (removed access or updated passwords) immediately.
-		// syncInterval defines data consistency check interval.
-		syncInterval: 30 * time.Minute,
 	}
 }
 
+// decodeCredentials decodes the credentials in etcd to a line of htpasswd.
+func decodeCredentials(value []byte) (string, error) {
+	creds := &etcdCredentials{}
+	if err := codectool.Unmarshal(value, creds); err != nil {
+		return "", err
+	}
+	if creds.Username() == "" || creds.Password() == "" {
+		return "", fmt.Errorf("credentials must contain 'password' and 'key' or 'username' entries")
+	}
+	return creds.Username() + ":" + creds.Password(), nil
+}
+
 func kvsToReader(kvs map[string]string) io.Reader {
 	pwStrSlice := make([]string, 0, len(kvs))
 	for _, item := range kvs {
-		creds := &etcdCredentials{}
-		err := codectool.Unmarshal([]byte(item), creds)
+		line, err := decodeCredentials([]byte(item))
 		if err != nil {
-			logger.Errorf(err.Error())
+			logger.Errorf("parse credentials failed: %v", err)
 			continue
 		}
-		if creds.Username() == "" || creds.Password() == "" {
-			logger.Errorf(
-				"Parsing credential updates failed. " +
-					"Make sure that credentials contains 'key' or 'password' entry for password and 'password' entries.",
-			)
-			continue
-		}
-		pwStrSlice = append(pwStrSlice, creds.Username()+":"+creds.Password())
+		pwStrSlice = append(pwStrSlice, line)
 	}
 	if len(pwStrSlice) == 0 {
 		// no credentials found, let's return empty reader
@@ -253,57 +245,43 @@ func kvsToReader(kvs map[string]string) io.Reader {
 	return strings.NewReader(stringData)
 }
 
+// WatchChanges loads the credentials and watches their changes, the
+// invalid credentials are reported by the status of the watcher.
 func (euc *etcdUserCache) WatchChanges() {
 	if euc.prefix == "" {
 		logger.Errorf("missing etcd prefix, skip watching changes")
 		return
 	}
-	var (
-		syncer cluster.Syncer
-		err    error
-		ch     <-chan map[string]string
-	)
 
-	for {
-		syncer, err = euc.cluster.Syncer(euc.syncInterval)
-		if err != nil {
-			logger.Errorf("failed to create syncer: %v", err)
-		} else if ch, err = syncer.SyncPrefix(euc.prefix); err != nil {
-			logger.Errorf("failed to sync prefix: %v", err)
-			syncer.Close()
-		} else {
-			break
-		}
-
-		select {
-		case <-time.After(10 * time.Second):
-		case <-euc.stopCtx.Done():
-			return
+	layout := euc.cluster.Layout()
+	store := customdata.NewStore(euc.cluster, layout.CustomDataKindPrefix(), layout.CustomDataPrefix())
+	decode := func(key string, value []byte) (interface{}, error) {
+		if _, err := decodeCredentials(value); err != nil {
+			return nil, err
 		}
+		return string(value), nil
 	}
-	// start listening in background
-	go func() {
-		defer syncer.Close()
-
-		for {
-			select {
-			case <-euc.stopCtx.Done():
-				return
-			case kvs := <-ch:
-				logger.Infof("basic auth credentials update")
-				pwReader := kvsToReader(kvs)
-				euc.userFileObject.ReloadFromReader(pwReader, nil)
-			}
+	euc.watcher = store.NewWatcher(strings.TrimPrefix(euc.prefix, customDataPrefix), decode, func(items map[string]interface{}) {
+		logger.Infof("basic auth credentials update")
+		kvs := make(map[string]string, len(items))
+		for k, item := range items {
+			kvs[k] = item.(string)
 		}
-	}()
-	return
+		euc.userFileObject.ReloadFromReader(kvsToReader(kvs), nil)
+	})
+}
+
+func (euc *etcdUserCache) status() *customdata.WatcherStatus {
+	if euc.watcher == nil {
+		return nil
+	}
+	return euc.watcher.Status()
 }
 
 func (euc *etcdUserCache) Close() {
-	if euc.prefix == "" {
-		return
+	if euc.watcher != nil {
+		euc.watcher.Close()
 	}
-	euc.cancel()
 }
 
 func (euc *etcdUserCache) Match(username string, password string) bool {
@@ -370,6 +348,15 @@ func (bav *BasicAuthValidator) Validate(req *httpprot.Request) error {
 	return fmt.Errorf("unauthorized")
 }
 
+// Status returns the status of the credentials in etcd, it is nil in the
+// FILE mode.
+func (bav *BasicAuthValidator) Status() *customdata.WatcherStatus {
+	if euc, ok := bav.authorizedUsersCache.(*etcdUserCache); ok {
+		return euc.status()
+	}
+	return nil
+}
+
 // Close closes authorizedUsersCache.
 func (bav *BasicAuthValidator) Close() {
 	bav.authorizedUsersCache.Close()
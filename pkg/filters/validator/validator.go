@@ -22,6 +22,7 @@ import (
 
 	"fmt"
 
+	"github.com/megaease/easegress/pkg/cluster/customdata"
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/filters"
 	"github.com/megaease/easegress/pkg/protocols/httpprot"
@@ -65,6 +66,13 @@ type (
 		basicAuth *BasicAuthValidator
 	}
 
+	// Status is the status of Validator.
+	Status struct {
+		// BasicAuth lists the invalid credentials in etcd, which are
+		// ignored by the ETCD mode.
+		BasicAuth *customdata.WatcherStatus `json:"basicAuth,omitempty"`
+	}
+
 	// Spec describes the Validator.
 	Spec struct {
 		filters.BaseSpec `json:",inline"`
@@ -182,7 +190,15 @@ func (v *Validator) Handle(ctx *context.Context) string {
 }
 
 // Status returns status.
-func (v *Validator) Status() interface{} { return nil }
+func (v *Validator) Status() interface{} {
+	if v.basicAuth == nil {
+		return nil
+	}
+	if s := v.basicAuth.Status(); s != nil {
+		return &Status{BasicAuth: s}
+	}
+	return nil
+}
 
 // Close closes validations.
 func (v *Validator) Close() {
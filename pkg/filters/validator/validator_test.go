@@ -500,9 +500,15 @@ password: doge
 key: doge
 lastEntry: "byebye"
 `
+		kvs["/custom-data/credentials/broken"] = "key: broken"
 		syncerChannel <- kvs
 		time.Sleep(time.Millisecond * 100)
 
+		status := v.Status().(*Status).BasicAuth
+		assert.Equal(2, status.Valid)
+		assert.Len(status.Invalid, 1)
+		assert.Equal("/custom-data/credentials/broken", status.Invalid[0].Key)
+
 		ctx, header := prepareCtxAndHeader()
 		b64creds := base64.StdEncoding.EncodeToString([]byte(userIds[0] + ":" + passwords[0]))
 		header.Set("Authorization", "Basic "+b64creds)
@@ -29,6 +29,7 @@ import (
 	"math/rand"
 	"net/http"
 	"net/textproto"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -36,6 +37,8 @@ import (
 	"github.com/bytecodealliance/wasmtime-go"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/accesslog"
+	"github.com/megaease/easegress/pkg/util/codectool"
 	"go.etcd.io/etcd/client/v3/concurrency"
 )
 
@@ -120,6 +123,24 @@ func (vm *WasmVM) writeStringArrayToWasm(strs []string) int32 {
 	return addr
 }
 
+func (vm *WasmVM) readStringArrayFromWasm(addr int32) []string {
+	mem := vm.inst.GetExport(vm.store, wasmMemory).Memory().UnsafeData(vm.store)
+	pos := int(addr)
+
+	count := int(binary.LittleEndian.Uint32(mem[pos:]))
+	pos += 4
+
+	strs := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		size := int(binary.LittleEndian.Uint32(mem[pos:]))
+		pos += 4
+		strs = append(strs, string(mem[pos:pos+size-1]))
+		pos += size
+	}
+
+	return strs
+}
+
 func (vm *WasmVM) writeHeaderToWasm(h http.Header) int32 {
 	var buf bytes.Buffer
 	h.Write(&buf)
@@ -500,6 +521,50 @@ func (vm *WasmVM) hostClusterCountKey(prefixAddr int32) int32 {
 	return count
 }
 
+func (vm *WasmVM) hostClusterDelete(addr int32) {
+	key := vm.readClusterKeyFromWasm(addr)
+	if e := vm.host.Cluster().Delete(key); e != nil {
+		panic(e)
+	}
+}
+
+func (vm *WasmVM) hostClusterListKeys(prefixAddr int32) int32 {
+	prefix := vm.readClusterKeyFromWasm(prefixAddr)
+	data := vm.host.Data()
+
+	keys := []string{}
+	for k := range data {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k[len(vm.host.dataPrefix):])
+		}
+	}
+	sort.Strings(keys)
+	return vm.writeStringArrayToWasm(keys)
+}
+
+// http call functions
+
+// hostHTTPCall returns a string array of the status code, the header and
+// the body of the response, the status code is 0 and the body is the
+// error message if the call fails.
+func (vm *WasmVM) hostHTTPCall(methodAddr, urlAddr, headerAddr, bodyAddr, timeoutMs int32) int32 {
+	method := vm.readStringFromWasm(methodAddr)
+	url := vm.readStringFromWasm(urlAddr)
+	header := vm.readHeaderFromWasm(headerAddr)
+	body := vm.readDataFromWasm(bodyAddr)
+
+	timeout := time.Duration(timeoutMs) * time.Millisecond
+	result := vm.host.httpCall(method, url, header, body, timeout)
+
+	var buf bytes.Buffer
+	result.header.Write(&buf)
+	return vm.writeStringArrayToWasm([]string{
+		strconv.Itoa(result.statusCode),
+		buf.String(),
+		string(result.body),
+	})
+}
+
 // misc functions
 
 func (vm *WasmVM) hostAddTag(addr int32) {
@@ -521,6 +586,39 @@ func (vm *WasmVM) hostLog(level int32, addr int32) {
 	}
 }
 
+// hostLogWithFields logs the message with the fields, which are key/value
+// pairs in a string array, the filter, the module and the request ID are
+// added to the fields.
+func (vm *WasmVM) hostLogWithFields(level int32, msgAddr, fieldsAddr int32) {
+	msg := vm.readStringFromWasm(msgAddr)
+	kvs := vm.readStringArrayFromWasm(fieldsAddr)
+
+	fields := map[string]string{
+		"filter": vm.host.Name(),
+		"module": vm.module,
+	}
+	if vm.ctx != nil {
+		if id, ok := vm.ctx.GetData(accesslog.DataRequestID).(string); ok {
+			fields["requestID"] = id
+		}
+	}
+	for i := 0; i+1 < len(kvs); i += 2 {
+		fields[kvs[i]] = kvs[i+1]
+	}
+
+	line := msg + " " + string(codectool.MustMarshalJSON(fields))
+	switch level {
+	case 0:
+		logger.Debugf("%s", line)
+	case 1:
+		logger.Infof("%s", line)
+	case 2:
+		logger.Warnf("%s", line)
+	case 3:
+		logger.Errorf("%s", line)
+	}
+}
+
 func (vm *WasmVM) hostGetUnixTimeInMs() int64 {
 	return time.Now().UnixNano() / 1e6
 }
@@ -602,10 +700,16 @@ func (vm *WasmVM) importHostFuncs(linker *wasmtime.Linker) {
 	defineFunc("host_cluster_add_float", vm.hostClusterAddFloat)
 
 	defineFunc("host_cluster_count_key", vm.hostClusterCountKey)
+	defineFunc("host_cluster_delete", vm.hostClusterDelete)
+	defineFunc("host_cluster_list_keys", vm.hostClusterListKeys)
+
+	// http call functions
+	defineFunc("host_http_call", vm.hostHTTPCall)
 
 	// misc functions
 	defineFunc("host_add_tag", vm.hostAddTag)
 	defineFunc("host_log", vm.hostLog)
+	defineFunc("host_log_with_fields", vm.hostLogWithFields)
 	defineFunc("host_get_unix_time_in_ms", vm.hostGetUnixTimeInMs)
 	defineFunc("host_rand", vm.hostRand)
 }
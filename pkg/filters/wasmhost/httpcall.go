@@ -0,0 +1,125 @@
+//go:build wasmhost
+// +build wasmhost
+
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wasmhost
+
+import (
+	"bytes"
+	stdcontext "context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHTTPCallTimeout = time.Second
+	maxHTTPCallBodySize    = 4 * 1024 * 1024
+)
+
+type (
+	// HTTPCallSpec is the spec of the outbound HTTP calls of the modules,
+	// the calls are disabled if it is not specified.
+	HTTPCallSpec struct {
+		// AllowedHosts are the hosts (host or host:port) the modules could
+		// call.
+		AllowedHosts []string `json:"allowedHosts" jsonschema:"required,minItems=1"`
+		// Timeout is the maximum timeout of a call, the timeout specified by
+		// the modules is capped by it.
+		Timeout string `json:"timeout" jsonschema:"omitempty,format=duration"`
+	}
+
+	// httpCallResult is the result of an HTTP call, the status code is 0
+	// and the body is the error message if the call fails.
+	httpCallResult struct {
+		statusCode int
+		header     http.Header
+		body       []byte
+	}
+)
+
+func (spec *HTTPCallSpec) timeout(requested time.Duration) time.Duration {
+	max, err := time.ParseDuration(spec.Timeout)
+	if err != nil || max <= 0 {
+		max = defaultHTTPCallTimeout
+	}
+	if requested <= 0 || requested > max {
+		return max
+	}
+	return requested
+}
+
+func (spec *HTTPCallSpec) allowed(u *url.URL) bool {
+	for _, h := range spec.AllowedHosts {
+		if strings.EqualFold(h, u.Host) || strings.EqualFold(h, u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+func httpCallError(err error) *httpCallResult {
+	return &httpCallResult{header: http.Header{}, body: []byte(err.Error())}
+}
+
+// httpCall sends an HTTP request for the modules.
+func (wh *WasmHost) httpCall(method, rawURL string, header http.Header, body []byte, timeout time.Duration) *httpCallResult {
+	spec := wh.spec.HTTPCall
+	if spec == nil {
+		return httpCallError(fmt.Errorf("http call is disabled"))
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return httpCallError(err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return httpCallError(fmt.Errorf("unsupported scheme %q", u.Scheme))
+	}
+	if !spec.allowed(u) {
+		return httpCallError(fmt.Errorf("host %s is not allowed", u.Host))
+	}
+
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), spec.timeout(timeout))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return httpCallError(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := wh.httpClient.Do(req)
+	if err != nil {
+		return httpCallError(err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPCallBodySize))
+	if err != nil {
+		return httpCallError(err)
+	}
+
+	return &httpCallResult{statusCode: resp.StatusCode, header: resp.Header, body: respBody}
+}
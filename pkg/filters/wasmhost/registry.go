@@ -0,0 +1,770 @@
+//go:build wasmhost
+// +build wasmhost
+
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wasmhost
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	ociScheme = "oci://"
+
+	defaultRefreshInterval = 5 * time.Minute
+	maxWasmCodeSize        = 64 * 1024 * 1024
+
+	mediaTypeOCIManifest    = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeWasmLayer      = "application/vnd.wasm.content.layer.v1+wasm"
+
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+)
+
+var digestRegexp = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+type (
+	// RegistrySpec is the spec to access the OCI registries and to refresh
+	// the code of OCI tags and URLs.
+	RegistrySpec struct {
+		Username string `json:"username" jsonschema:"omitempty"`
+		Password string `json:"password" jsonschema:"omitempty"`
+		// Insecure accesses the registries in plain HTTP.
+		Insecure bool `json:"insecure" jsonschema:"omitempty"`
+		// RefreshInterval is the interval to check whether the code of the
+		// OCI tags and URLs which are not pinned by digests has changed.
+		RefreshInterval string `json:"refreshInterval" jsonschema:"omitempty,format=duration"`
+	}
+
+	// ociReference is a reference to an OCI artifact, in the format of
+	// registry/repository[:tag][@digest].
+	ociReference struct {
+		registry   string
+		repository string
+		tag        string
+		digest     string
+	}
+
+	ociManifest struct {
+		MediaType string          `json:"mediaType"`
+		Layers    []ociDescriptor `json:"layers"`
+	}
+
+	ociDescriptor struct {
+		MediaType   string            `json:"mediaType"`
+		Digest      string            `json:"digest"`
+		Size        int64             `json:"size"`
+		Annotations map[string]string `json:"annotations"`
+	}
+
+	// cosignPayload is the simple signing payload signed by cosign.
+	cosignPayload struct {
+		Critical struct {
+			Image struct {
+				DockerManifestDigest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+		} `json:"critical"`
+	}
+
+	// codeLoader loads the code of the modules from files, URLs and OCI
+	// registries, the code is cached in the data directory by its digest.
+	codeLoader struct {
+		spec     *RegistrySpec
+		client   *http.Client
+		cacheDir string
+		// auths are the authorization headers of the repositories.
+		auths sync.Map
+	}
+
+	// wasmCode is the code of a module, version identifies the code at
+	// the source, which is the manifest digest of OCI artifacts, the ETag
+	// of URLs, or the digest of pinned code.
+	wasmCode struct {
+		code    []byte
+		version string
+	}
+)
+
+func (spec *RegistrySpec) refreshInterval() time.Duration {
+	if spec == nil {
+		return defaultRefreshInterval
+	}
+	d, err := time.ParseDuration(spec.RefreshInterval)
+	if err != nil || d <= 0 {
+		return defaultRefreshInterval
+	}
+	return d
+}
+
+func validateDigest(digest string) error {
+	if digest != "" && !digestRegexp.MatchString(digest) {
+		return fmt.Errorf("invalid digest %s, must be sha256:<hex>", digest)
+	}
+	return nil
+}
+
+func digestOf(code []byte) string {
+	sum := sha256.Sum256(code)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// isRemote returns whether the code of the module may change at the source
+// without changing the spec, that's OCI tags and URLs not pinned by digests.
+func isRemote(m *ModuleSpec) bool {
+	if m.Digest != "" {
+		return false
+	}
+	if strings.HasPrefix(m.Code, ociScheme) {
+		return !strings.Contains(m.Code, "@")
+	}
+	return isURL(m.Code)
+}
+
+func parseOCIReference(s string) (*ociReference, error) {
+	ref := &ociReference{}
+
+	if i := strings.Index(s, "@"); i >= 0 {
+		s, ref.digest = s[:i], s[i+1:]
+		if err := validateDigest(ref.digest); err != nil {
+			return nil, err
+		}
+	}
+
+	i := strings.Index(s, "/")
+	if i <= 0 {
+		return nil, fmt.Errorf("invalid OCI reference %s, no registry", s)
+	}
+	ref.registry, ref.repository = s[:i], s[i+1:]
+	if ref.registry == "docker.io" {
+		ref.registry = "registry-1.docker.io"
+	}
+
+	if i = strings.LastIndex(ref.repository, ":"); i > strings.LastIndex(ref.repository, "/") {
+		ref.repository, ref.tag = ref.repository[:i], ref.repository[i+1:]
+	}
+	if ref.repository == "" {
+		return nil, fmt.Errorf("invalid OCI reference %s, no repository", s)
+	}
+	if ref.tag == "" && ref.digest == "" {
+		ref.tag = "latest"
+	}
+
+	return ref, nil
+}
+
+// reference returns the digest if present, or the tag otherwise.
+func (ref *ociReference) reference() string {
+	if ref.digest != "" {
+		return ref.digest
+	}
+	return ref.tag
+}
+
+func newCodeLoader(spec *RegistrySpec, cacheDir string) *codeLoader {
+	if spec == nil {
+		spec = &RegistrySpec{}
+	}
+	return &codeLoader{
+		spec:     spec,
+		client:   &http.Client{Timeout: time.Minute},
+		cacheDir: cacheDir,
+	}
+}
+
+// load loads the code of the module, nil is returned if the version of
+// the code is not changed.
+//
+// The signer is part of the version of pinned code and of its cache, so
+// the cached code is used only if it was verified by the same public key.
+func (l *codeLoader) load(m *ModuleSpec, publicKey, version string) (*wasmCode, error) {
+	signer, err := signerOf(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Digest != "" {
+		pinned := pinnedVersion(m.Digest, signer)
+		if version == pinned {
+			return nil, nil
+		}
+		if l.verified(m.Digest, signer) {
+			if code := l.readCache(m.Digest); code != nil {
+				return &wasmCode{code: code, version: pinned}, nil
+			}
+		}
+	}
+
+	var wc *wasmCode
+	switch {
+	case strings.HasPrefix(m.Code, ociScheme):
+		wc, err = l.loadOCI(m.Code[len(ociScheme):], publicKey, version)
+	case isURL(m.Code):
+		wc, err = l.loadURL(m.Code, publicKey, version)
+	default:
+		wc, err = l.loadLocal(m.Code, publicKey)
+	}
+	if err != nil || wc == nil {
+		return nil, err
+	}
+
+	if m.Digest != "" {
+		if digest := digestOf(wc.code); digest != m.Digest {
+			return nil, fmt.Errorf("digest mismatch, expected %s, got %s", m.Digest, digest)
+		}
+		wc.version = pinnedVersion(m.Digest, signer)
+	}
+
+	l.writeCache(wc.code)
+	l.markVerified(digestOf(wc.code), signer)
+	return wc, nil
+}
+
+// signerOf returns the fingerprint of the public key, which is the hex
+// encoded SHA256 of its DER encoding, or empty if there is no public key.
+func signerOf(publicKey string) (string, error) {
+	if publicKey == "" {
+		return "", nil
+	}
+
+	key, err := parsePublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid public key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", fmt.Errorf("invalid public key: %v", err)
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// pinnedVersion returns the version of the code pinned by the digest and
+// verified by the signer.
+func pinnedVersion(digest, signer string) string {
+	if signer == "" {
+		return digest
+	}
+	return digest + "+signer:" + signer
+}
+
+// loadLocal loads the code from a file or the base64 encoded code, the
+// signature of a file is read from the file with the '.sig' suffix.
+func (l *codeLoader) loadLocal(code, publicKey string) (*wasmCode, error) {
+	if _, e := os.Stat(code); e != nil {
+		if publicKey != "" {
+			return nil, fmt.Errorf("signature verification is not supported for inline code")
+		}
+		data, err := base64.StdEncoding.DecodeString(code)
+		if err != nil {
+			return nil, err
+		}
+		return &wasmCode{code: data}, nil
+	}
+
+	data, err := os.ReadFile(code)
+	if err != nil {
+		return nil, err
+	}
+	if publicKey != "" {
+		sig, err := os.ReadFile(code + ".sig")
+		if err != nil {
+			return nil, err
+		}
+		if err = verifyBlobSignature(publicKey, data, sig); err != nil {
+			return nil, err
+		}
+	}
+	return &wasmCode{code: data}, nil
+}
+
+// loadURL loads the code from a URL, the signature is read from the URL
+// with the '.sig' suffix.
+func (l *codeLoader) loadURL(u, publicKey, version string) (*wasmCode, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if version != "" {
+		req.Header.Set("If-None-Match", version)
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+	code, err := readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if publicKey != "" {
+		resp, err := l.client.Get(u + ".sig")
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		sig, err := readBody(resp)
+		if err != nil {
+			return nil, err
+		}
+		if err = verifyBlobSignature(publicKey, code, sig); err != nil {
+			return nil, err
+		}
+	}
+
+	return &wasmCode{code: code, version: resp.Header.Get("ETag")}, nil
+}
+
+// loadOCI loads the code from an OCI artifact, the signature is verified
+// in the way of cosign.
+func (l *codeLoader) loadOCI(s, publicKey, version string) (*wasmCode, error) {
+	ref, err := parseOCIReference(s)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, digest, err := l.fetchManifest(ref, ref.reference())
+	if err != nil {
+		return nil, err
+	}
+	if ref.digest != "" && digest != ref.digest {
+		return nil, fmt.Errorf("manifest digest mismatch, expected %s, got %s", ref.digest, digest)
+	}
+	if digest == version {
+		return nil, nil
+	}
+
+	var layer *ociDescriptor
+	for i := range manifest.Layers {
+		if manifest.Layers[i].MediaType == mediaTypeWasmLayer {
+			layer = &manifest.Layers[i]
+			break
+		}
+	}
+	if layer == nil && len(manifest.Layers) == 1 {
+		layer = &manifest.Layers[0]
+	}
+	if layer == nil {
+		return nil, fmt.Errorf("no wasm layer in %s", s)
+	}
+
+	if publicKey != "" {
+		if err = l.verifyOCISignature(ref, digest, publicKey); err != nil {
+			return nil, err
+		}
+	}
+
+	code := l.readCache(layer.Digest)
+	if code == nil {
+		if code, err = l.fetchBlob(ref, layer.Digest); err != nil {
+			return nil, err
+		}
+	}
+
+	return &wasmCode{code: code, version: digest}, nil
+}
+
+// verifyOCISignature verifies the signatures pushed by cosign, which are
+// stored in the tag 'sha256-<hex>.sig' of the repository.
+func (l *codeLoader) verifyOCISignature(ref *ociReference, digest, publicKey string) error {
+	tag := strings.Replace(digest, ":", "-", 1) + ".sig"
+	manifest, _, err := l.fetchManifest(ref, tag)
+	if err != nil {
+		return fmt.Errorf("failed to fetch signatures: %v", err)
+	}
+
+	for _, layer := range manifest.Layers {
+		encoded := layer.Annotations[cosignSignatureAnnotation]
+		if encoded == "" {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+		payload, err := l.fetchBlob(ref, layer.Digest)
+		if err != nil {
+			return err
+		}
+		if verifySignature(publicKey, payload, sig) != nil {
+			continue
+		}
+
+		p := &cosignPayload{}
+		if json.Unmarshal(payload, p) == nil && p.Critical.Image.DockerManifestDigest == digest {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no valid signature for %s", digest)
+}
+
+func (l *codeLoader) registryURL(ref *ociReference, path string) string {
+	scheme := "https"
+	if l.spec.Insecure {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s/v2/%s/%s", scheme, ref.registry, ref.repository, path)
+}
+
+func (l *codeLoader) fetchManifest(ref *ociReference, reference string) (*ociManifest, string, error) {
+	req, err := http.NewRequest(http.MethodGet, l.registryURL(ref, "manifests/"+reference), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", mediaTypeOCIManifest+", "+mediaTypeDockerManifest)
+
+	resp, err := l.do(ref, req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := readBody(resp)
+	if err != nil {
+		return nil, "", err
+	}
+
+	manifest := &ociManifest{}
+	if err = json.Unmarshal(data, manifest); err != nil {
+		return nil, "", err
+	}
+	return manifest, digestOf(data), nil
+}
+
+func (l *codeLoader) fetchBlob(ref *ociReference, digest string) ([]byte, error) {
+	if err := validateDigest(digest); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, l.registryURL(ref, "blobs/"+digest), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := l.do(ref, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	if d := digestOf(data); d != digest {
+		return nil, fmt.Errorf("blob digest mismatch, expected %s, got %s", digest, d)
+	}
+	return data, nil
+}
+
+// do sends the request to the registry, and authorizes and resends it if
+// the registry requires.
+func (l *codeLoader) do(ref *ociReference, req *http.Request) (*http.Response, error) {
+	key := ref.registry + "/" + ref.repository
+	if auth, ok := l.auths.Load(key); ok {
+		req.Header.Set("Authorization", auth.(string))
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	auth, err := l.authorize(ref, resp.Header.Get("WWW-Authenticate"))
+	if err != nil {
+		return nil, err
+	}
+	l.auths.Store(key, auth)
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", auth)
+	return l.client.Do(req)
+}
+
+// authorize returns the authorization header for the challenge.
+func (l *codeLoader) authorize(ref *ociReference, challenge string) (string, error) {
+	scheme, params := parseChallenge(challenge)
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if l.spec.Username == "" {
+			return "", fmt.Errorf("registry %s requires username and password", ref.registry)
+		}
+		cred := l.spec.Username + ":" + l.spec.Password
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(cred)), nil
+
+	case "bearer":
+		u, err := url.Parse(params["realm"])
+		if err != nil || u.Host == "" {
+			return "", fmt.Errorf("invalid realm %q of registry %s", params["realm"], ref.registry)
+		}
+		q := u.Query()
+		if service := params["service"]; service != "" {
+			q.Set("service", service)
+		}
+		scope := params["scope"]
+		if scope == "" {
+			scope = fmt.Sprintf("repository:%s:pull", ref.repository)
+		}
+		q.Set("scope", scope)
+		u.RawQuery = q.Encode()
+
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return "", err
+		}
+		if l.spec.Username != "" {
+			req.SetBasicAuth(l.spec.Username, l.spec.Password)
+		}
+
+		resp, err := l.client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		data, err := readBody(resp)
+		if err != nil {
+			return "", err
+		}
+
+		token := struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}{}
+		if err = json.Unmarshal(data, &token); err != nil {
+			return "", err
+		}
+		if token.Token == "" {
+			token.Token = token.AccessToken
+		}
+		if token.Token == "" {
+			return "", fmt.Errorf("no token returned by %s", u.Host)
+		}
+		return "Bearer " + token.Token, nil
+	}
+
+	return "", fmt.Errorf("unsupported authentication scheme %q of registry %s", scheme, ref.registry)
+}
+
+// parseChallenge parses the WWW-Authenticate header, e.g.
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+
+	challenge = strings.TrimSpace(challenge)
+	i := strings.IndexByte(challenge, ' ')
+	if i < 0 {
+		return challenge, params
+	}
+	scheme, rest := challenge[:i], challenge[i+1:]
+
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+		i = strings.IndexByte(rest, '=')
+		if i < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:i]))
+		rest = rest[i+1:]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if end := strings.IndexByte(rest, ','); end >= 0 {
+			value, rest = rest[:end], rest[end+1:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+	}
+
+	return scheme, params
+}
+
+func (l *codeLoader) cachePath(digest string) string {
+	if l.cacheDir == "" || !digestRegexp.MatchString(digest) {
+		return ""
+	}
+	return filepath.Join(l.cacheDir, strings.Replace(digest, ":", string(filepath.Separator), 1))
+}
+
+// readCache returns the cached code of the digest, or nil if it is not
+// cached or is corrupted.
+func (l *codeLoader) readCache(digest string) []byte {
+	p := l.cachePath(digest)
+	if p == "" {
+		return nil
+	}
+	code, err := os.ReadFile(p)
+	if err != nil || digestOf(code) != digest {
+		return nil
+	}
+	return code
+}
+
+// verifiedPath returns the path of the marker of the cached code verified
+// by the signer.
+func (l *codeLoader) verifiedPath(digest, signer string) string {
+	p := l.cachePath(digest)
+	if p == "" {
+		return ""
+	}
+	return p + "." + signer + ".verified"
+}
+
+// verified returns whether the cached code of the digest was verified by
+// the signer, the code without a signer needs no verification.
+func (l *codeLoader) verified(digest, signer string) bool {
+	if signer == "" {
+		return true
+	}
+	p := l.verifiedPath(digest, signer)
+	if p == "" {
+		return false
+	}
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+func (l *codeLoader) markVerified(digest, signer string) {
+	if signer == "" {
+		return
+	}
+	p := l.verifiedPath(digest, signer)
+	if p == "" {
+		return
+	}
+	if err := os.WriteFile(p, nil, 0o644); err != nil {
+		logger.Warnf("failed to cache the verification of wasm code: %v", err)
+	}
+}
+
+func (l *codeLoader) writeCache(code []byte) {
+	p := l.cachePath(digestOf(code))
+	if p == "" {
+		return
+	}
+	if _, err := os.Stat(p); err == nil {
+		return
+	}
+
+	err := os.MkdirAll(filepath.Dir(p), 0o755)
+	if err == nil {
+		tmp := p + ".tmp"
+		if err = os.WriteFile(tmp, code, 0o644); err == nil {
+			err = os.Rename(tmp, p)
+		}
+	}
+	if err != nil {
+		logger.Warnf("failed to cache wasm code: %v", err)
+	}
+}
+
+func readBody(resp *http.Response) ([]byte, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returns status code %d", resp.Request.URL, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxWasmCodeSize))
+}
+
+// parsePublicKey parses the PEM encoded public key, or the public key in
+// the PEM file.
+func parsePublicKey(key string) (crypto.PublicKey, error) {
+	data := []byte(key)
+	if !strings.Contains(key, "-----BEGIN") {
+		var err error
+		if data, err = os.ReadFile(key); err != nil {
+			return nil, err
+		}
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid PEM encoded public key")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// verifySignature verifies the signature of the payload by the public key.
+func verifySignature(publicKey string, payload, sig []byte) error {
+	key, err := parsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256(payload)
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest[:], sig) {
+			return fmt.Errorf("invalid signature")
+		}
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, payload, sig) {
+			return fmt.Errorf("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+	return nil
+}
+
+// verifyBlobSignature verifies the base64 encoded signature generated by
+// 'cosign sign-blob'.
+func verifyBlobSignature(publicKey string, code, encoded []byte) error {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fmt.Errorf("invalid signature: %v", err)
+	}
+	return verifySignature(publicKey, code, sig)
+}
@@ -0,0 +1,185 @@
+//go:build wasmhost
+// +build wasmhost
+
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wasmhost
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testSigner struct {
+	publicKey  string
+	privateKey ed25519.PrivateKey
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key failed: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("marshal public key failed: %v", err)
+	}
+	block := &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	return &testSigner{publicKey: string(pem.EncodeToMemory(block)), privateKey: priv}
+}
+
+// sign returns the signature in the format of 'cosign sign-blob'.
+func (s *testSigner) sign(code []byte) []byte {
+	return []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(s.privateKey, code)))
+}
+
+// writeTestCode writes the code and its signature to the directory, and
+// returns the path of the code.
+func writeTestCode(t *testing.T, dir string, code []byte, signer *testSigner) string {
+	p := filepath.Join(dir, "module.wasm")
+	if err := os.WriteFile(p, code, 0o644); err != nil {
+		t.Fatalf("write code failed: %v", err)
+	}
+	if signer != nil {
+		if err := os.WriteFile(p+".sig", signer.sign(code), 0o644); err != nil {
+			t.Fatalf("write signature failed: %v", err)
+		}
+	}
+	return p
+}
+
+func TestLoadBadDigest(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	code := []byte("wasm code")
+	l := newCodeLoader(nil, filepath.Join(dir, "cache"))
+
+	m := &ModuleSpec{Name: "module", Code: writeTestCode(t, dir, code, nil), Digest: digestOf([]byte("other"))}
+	_, err := l.load(m, "", "")
+	assert.Error(err)
+	assert.Nil(l.readCache(digestOf(code)))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(code)
+	}))
+	defer server.Close()
+
+	m.Code = server.URL + "/module.wasm"
+	_, err = l.load(m, "", "")
+	assert.Error(err)
+
+	m.Digest = digestOf(code)
+	wc, err := l.load(m, "", "")
+	assert.NoError(err)
+	assert.Equal(code, wc.code)
+	assert.Equal(m.Digest, wc.version)
+
+	// the pinned code is not changed.
+	wc, err = l.load(m, "", wc.version)
+	assert.NoError(err)
+	assert.Nil(wc)
+}
+
+func TestLoadBadSignature(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	code := []byte("wasm code")
+	signer, other := newTestSigner(t), newTestSigner(t)
+	l := newCodeLoader(nil, filepath.Join(dir, "cache"))
+
+	m := &ModuleSpec{Name: "module", Code: writeTestCode(t, dir, code, other)}
+	_, err := l.load(m, signer.publicKey, "")
+	assert.Error(err)
+
+	assert.NoError(os.WriteFile(m.Code+".sig", []byte("invalid"), 0o644))
+	_, err = l.load(m, signer.publicKey, "")
+	assert.Error(err)
+
+	_, err = l.load(m, "invalid key", "")
+	assert.Error(err)
+
+	writeTestCode(t, dir, code, signer)
+	wc, err := l.load(m, signer.publicKey, "")
+	assert.NoError(err)
+	assert.Equal(code, wc.code)
+
+	// inline code can't be verified.
+	m.Code = base64.StdEncoding.EncodeToString(code)
+	_, err = l.load(m, signer.publicKey, "")
+	assert.Error(err)
+}
+
+func TestLoadCacheWithChangedKey(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	code := []byte("wasm code")
+	signer, other := newTestSigner(t), newTestSigner(t)
+	l := newCodeLoader(nil, filepath.Join(dir, "cache"))
+
+	m := &ModuleSpec{Name: "module", Code: writeTestCode(t, dir, code, signer), Digest: digestOf(code)}
+	wc, err := l.load(m, signer.publicKey, "")
+	assert.NoError(err)
+	assert.NotEqual(m.Digest, wc.version)
+	version := wc.version
+
+	// the signature is not available, but the code is in the cache and was
+	// verified by the same key.
+	assert.NoError(os.Remove(m.Code + ".sig"))
+	wc, err = l.load(m, signer.publicKey, "")
+	assert.NoError(err)
+	assert.Equal(code, wc.code)
+	assert.Equal(version, wc.version)
+
+	wc, err = l.load(m, signer.publicKey, version)
+	assert.NoError(err)
+	assert.Nil(wc)
+
+	// the cached code was not verified by the other key.
+	_, err = l.load(m, other.publicKey, version)
+	assert.Error(err)
+	_, err = l.load(m, other.publicKey, "")
+	assert.Error(err)
+
+	assert.NoError(os.WriteFile(m.Code+".sig", signer.sign(code), 0o644))
+	_, err = l.load(m, other.publicKey, "")
+	assert.Error(err)
+
+	assert.NoError(os.WriteFile(m.Code+".sig", other.sign(code), 0o644))
+	wc, err = l.load(m, other.publicKey, version)
+	assert.NoError(err)
+	assert.Equal(code, wc.code)
+	assert.NotEqual(version, wc.version)
+
+	// the code without a public key needs no verification.
+	wc, err = l.load(m, "", "")
+	assert.NoError(err)
+	assert.Equal(m.Digest, wc.version)
+}
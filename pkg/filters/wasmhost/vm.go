@@ -31,6 +31,7 @@ import (
 // WasmVM represents a wasm VM
 type WasmVM struct {
 	host    *WasmHost
+	module  string
 	ctx     *context.Context
 	store   *wasmtime.Store
 	inst    *wasmtime.Instance
@@ -82,6 +83,21 @@ func (vm *WasmVM) exportWasmFuncs() error {
 	return nil
 }
 
+// callInitialize calls '_initialize' of WASI reactor modules, which must
+// be called before any other exported functions.
+func (vm *WasmVM) callInitialize() error {
+	extern := vm.inst.GetExport(vm.store, "_initialize")
+	if extern == nil {
+		return nil
+	}
+	fn := extern.Func()
+	if fn == nil {
+		return fmt.Errorf("'_initialize' exported by wasm code is not a function")
+	}
+	_, err := fn.Call(vm.store)
+	return err
+}
+
 func (vm *WasmVM) callInit(params []string) (err error) {
 	extern := vm.inst.GetExport(vm.store, "wasm_init")
 	if extern == nil {
@@ -103,14 +119,54 @@ func (vm *WasmVM) callInit(params []string) (err error) {
 	return
 }
 
-func newWasmVM(host *WasmHost, engine *wasmtime.Engine, module *wasmtime.Module, params []string) (*WasmVM, error) {
+// newWasiConfig creates the WASI config of a store, the config could not
+// be shared by stores.
+func newWasiConfig(spec *WASISpec) (*wasmtime.WasiConfig, error) {
+	cfg := wasmtime.NewWasiConfig()
+	if spec == nil {
+		return cfg, nil
+	}
+
+	cfg.SetArgv(spec.Args)
+
+	keys := make([]string, 0, len(spec.Env))
+	values := make([]string, 0, len(spec.Env))
+	for k, v := range spec.Env {
+		keys = append(keys, k)
+		values = append(values, v)
+	}
+	cfg.SetEnv(keys, values)
+
+	if spec.InheritStdout {
+		cfg.InheritStdout()
+	}
+	if spec.InheritStderr {
+		cfg.InheritStderr()
+	}
+
+	for guest, host := range spec.PreopenDirs {
+		if e := cfg.PreopenDir(host, guest); e != nil {
+			return nil, fmt.Errorf("failed to preopen directory %s: %v", host, e)
+		}
+	}
+
+	return cfg, nil
+}
+
+func newWasmVM(host *WasmHost, name string, engine *wasmtime.Engine, module *wasmtime.Module, params []string) (*WasmVM, error) {
 	store := wasmtime.NewStore(engine)
 	ih, e := store.InterruptHandle()
 	if e != nil {
 		return nil, e
 	}
 
-	vm := &WasmVM{host: host, store: store, ih: ih}
+	wasi, e := newWasiConfig(host.spec.WASI)
+	if e != nil {
+		return nil, e
+	}
+	store.SetWasi(wasi)
+
+	vm := &WasmVM{host: host, module: name, store: store, ih: ih}
 
 	linker := wasmtime.NewLinker(engine)
 	vm.importHostFuncs(linker)
@@ -126,6 +182,10 @@ func newWasmVM(host *WasmHost, engine *wasmtime.Engine, module *wasmtime.Module,
 	}
 	vm.inst = inst
 
+	if e = vm.callInitialize(); e != nil {
+		return nil, e
+	}
+
 	if e = vm.exportWasmFuncs(); e != nil {
 		return nil, e
 	}
@@ -141,14 +201,16 @@ func newWasmVM(host *WasmHost, engine *wasmtime.Engine, module *wasmtime.Module,
 // WasmVMPool is a pool of wasm VMs
 type WasmVMPool struct {
 	host   *WasmHost
+	name   string
 	chVM   chan *WasmVM
 	engine *wasmtime.Engine
 	module *wasmtime.Module
 	params []string
 }
 
-// NewWasmVMPool creates a wasm VM pool according the spec of 'host' which execute 'code'
-func NewWasmVMPool(host *WasmHost, code []byte) (*WasmVMPool, error) {
+// NewWasmVMPool creates a wasm VM pool according the spec of 'host' which
+// execute 'code' of the module
+func NewWasmVMPool(host *WasmHost, spec *ModuleSpec, code []byte) (*WasmVMPool, error) {
 	cfg := wasmtime.NewConfig()
 	cfg.SetInterruptable(true)
 	engine := wasmtime.NewEngineWithConfig(cfg)
@@ -158,14 +220,12 @@ func NewWasmVMPool(host *WasmHost, code []byte) (*WasmVMPool, error) {
 		return nil, e
 	}
 
-	p := &WasmVMPool{host: host, engine: engine, module: module}
-	for k, v := range host.spec.Parameters {
-		p.params = append(p.params, k, v)
-	}
+	p := &WasmVMPool{host: host, name: spec.Name, engine: engine, module: module}
+	p.params = host.spec.parameters(spec)
 
 	p.chVM = make(chan *WasmVM, host.spec.MaxConcurrency)
 	for i := int32(0); i < host.spec.MaxConcurrency; i++ {
-		vm, e := newWasmVM(p.host, p.engine, p.module, p.params)
+		vm, e := newWasmVM(p.host, p.name, p.engine, p.module, p.params)
 		if e != nil {
 			logger.Errorf("failed to create wasm VM: %v", e)
 		}
@@ -183,7 +243,7 @@ func (p *WasmVMPool) Get() *WasmVM {
 	}
 
 	// vm is nil, we need create a new one
-	vm, e := newWasmVM(p.host, p.engine, p.module, p.params)
+	vm, e := newWasmVM(p.host, p.name, p.engine, p.module, p.params)
 	if e != nil {
 		p.chVM <- nil
 		logger.Errorf("failed to create wasm VM: %v", e)
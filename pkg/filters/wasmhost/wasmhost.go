@@ -22,11 +22,9 @@ package wasmhost
 
 import (
 	"bytes"
-	"encoding/base64"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -88,27 +86,73 @@ type (
 	Spec struct {
 		filters.BaseSpec `json:",inline"`
 
-		MaxConcurrency int32             `json:"maxConcurrency" jsonschema:"required,minimum=1"`
-		Code           string            `json:"code" jsonschema:"required"`
-		Timeout        string            `json:"timeout" jsonschema:"required,format=duration"`
-		Parameters     map[string]string `json:"parameters" jsonschema:"omitempty"`
-		timeout        time.Duration
+		MaxConcurrency int32 `json:"maxConcurrency" jsonschema:"required,minimum=1"`
+		// Code is the code of the only module, there must be exactly one
+		// of Code and Modules.
+		Code string `json:"code,omitempty" jsonschema:"omitempty"`
+		// CodeDigest pins the digest of Code.
+		CodeDigest string        `json:"codeDigest,omitempty" jsonschema:"omitempty"`
+		Modules    []*ModuleSpec `json:"modules,omitempty" jsonschema:"omitempty"`
+		// PublicKey verifies the signatures of the code of all modules,
+		// unless overridden by the modules.
+		PublicKey  string            `json:"publicKey,omitempty" jsonschema:"omitempty"`
+		Registry   *RegistrySpec     `json:"registry,omitempty" jsonschema:"omitempty"`
+		Timeout    string            `json:"timeout" jsonschema:"required,format=duration"`
+		Parameters map[string]string `json:"parameters" jsonschema:"omitempty"`
+		WASI       *WASISpec         `json:"wasi,omitempty" jsonschema:"omitempty"`
+		HTTPCall   *HTTPCallSpec     `json:"httpCall,omitempty" jsonschema:"omitempty"`
+		timeout    time.Duration
+	}
+
+	// ModuleSpec is the spec of a module, the modules are executed in the
+	// order of the spec until one of them returns a non-zero result.
+	ModuleSpec struct {
+		Name string `json:"name" jsonschema:"required"`
+		// Code is the base64 encoded code, the path of the file, the URL,
+		// or the OCI reference (oci://registry/repository:tag[@digest]).
+		Code string `json:"code" jsonschema:"required"`
+		// Digest pins the digest of the code, in the format of
+		// sha256:<hex>.
+		Digest    string `json:"digest" jsonschema:"omitempty"`
+		PublicKey string `json:"publicKey" jsonschema:"omitempty"`
+		// Parameters override the parameters of the spec.
+		Parameters map[string]string `json:"parameters" jsonschema:"omitempty"`
+	}
+
+	// WASISpec is the spec of the WASI environment of the modules.
+	WASISpec struct {
+		Args          []string          `json:"args" jsonschema:"omitempty"`
+		Env           map[string]string `json:"env" jsonschema:"omitempty"`
+		InheritStdout bool              `json:"inheritStdout" jsonschema:"omitempty"`
+		InheritStderr bool              `json:"inheritStderr" jsonschema:"omitempty"`
+		// PreopenDirs maps the directories in the modules to the
+		// directories of the host.
+		PreopenDirs map[string]string `json:"preopenDirs" jsonschema:"omitempty"`
 	}
 
 	// WasmHost is the WebAssembly filter
 	WasmHost struct {
 		spec *Spec
 
-		code       []byte
+		modules    []*wasmModule
+		loader     *codeLoader
 		dataPrefix string
 		data       atomic.Value
-		vmPool     atomic.Value
+		httpClient *http.Client
 		chStop     chan struct{}
 
 		numOfRequest   int64
 		numOfWasmError int64
 	}
 
+	// wasmModule is a module of WasmHost, which has its own VM pool.
+	wasmModule struct {
+		spec    *ModuleSpec
+		code    []byte
+		version string
+		vmPool  atomic.Value
+	}
+
 	// Status is the status of WasmHost
 	Status struct {
 		Health         string `json:"health"`
@@ -117,6 +161,71 @@ type (
 	}
 )
 
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	if (spec.Code == "") == (len(spec.Modules) == 0) {
+		return fmt.Errorf("there must be exactly one of code and modules")
+	}
+
+	if err := validateDigest(spec.CodeDigest); err != nil {
+		return err
+	}
+
+	names := map[string]bool{}
+	for _, m := range spec.Modules {
+		if names[m.Name] {
+			return fmt.Errorf("duplicated module %s", m.Name)
+		}
+		names[m.Name] = true
+		if err := validateDigest(m.Digest); err != nil {
+			return fmt.Errorf("module %s: %v", m.Name, err)
+		}
+	}
+
+	for _, m := range spec.moduleSpecs() {
+		if strings.HasPrefix(m.Code, ociScheme) {
+			if _, err := parseOCIReference(m.Code[len(ociScheme):]); err != nil {
+				return fmt.Errorf("module %s: %v", m.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// moduleSpecs returns the specs of all modules, the code is converted to a
+// module named after the filter.
+func (spec *Spec) moduleSpecs() []*ModuleSpec {
+	if spec.Code != "" {
+		return []*ModuleSpec{{Name: spec.Name(), Code: spec.Code, Digest: spec.CodeDigest}}
+	}
+	return spec.Modules
+}
+
+// publicKey returns the public key to verify the code of the module.
+func (spec *Spec) publicKey(m *ModuleSpec) string {
+	if m.PublicKey != "" {
+		return m.PublicKey
+	}
+	return spec.PublicKey
+}
+
+// parameters returns the parameters of the module in key/value pairs.
+func (spec *Spec) parameters(m *ModuleSpec) []string {
+	params := map[string]string{}
+	for k, v := range spec.Parameters {
+		params[k] = v
+	}
+	for k, v := range m.Parameters {
+		params[k] = v
+	}
+
+	var result []string
+	for k, v := range params {
+		result = append(result, k, v)
+	}
+	return result
+}
+
 // Name returns the name of the WasmHost filter instance.
 func (wh *WasmHost) Name() string {
 	return wh.spec.Name()
@@ -146,15 +255,6 @@ func (wh *WasmHost) Data() map[string]*mvccpb.KeyValue {
 	return d.(map[string]*mvccpb.KeyValue)
 }
 
-func readWasmCodeFromURL(url string) ([]byte, error) {
-	resp, e := http.DefaultClient.Get(url)
-	if e != nil {
-		return nil, e
-	}
-	defer resp.Body.Close()
-	return io.ReadAll(resp.Body)
-}
-
 func isURL(str string) bool {
 	// we only check the first a few bytes as str could be
 	// the LONG base64 encoded wasm code
@@ -168,38 +268,72 @@ func isURL(str string) bool {
 	return false
 }
 
-func (wh *WasmHost) readWasmCode() ([]byte, error) {
-	if isURL(wh.spec.Code) {
-		return readWasmCodeFromURL(wh.spec.Code)
+// loadWasmCode loads the code of all modules, the VM pool of a module is
+// recreated only if its code changes.
+func (wh *WasmHost) loadWasmCode() error {
+	var err error
+	for _, m := range wh.modules {
+		if e := wh.loadModule(m); e != nil {
+			err = e
+		}
 	}
-	if _, e := os.Stat(wh.spec.Code); e == nil {
-		return os.ReadFile(wh.spec.Code)
+	return err
+}
+
+// refreshWasmCode reloads the code of the modules from the OCI tags and
+// URLs, which may change at the source.
+func (wh *WasmHost) refreshWasmCode() error {
+	var err error
+	for _, m := range wh.modules {
+		if !isRemote(m.spec) {
+			continue
+		}
+		if e := wh.loadModule(m); e != nil {
+			err = e
+		}
 	}
-	return base64.StdEncoding.DecodeString(wh.spec.Code)
+	return err
 }
 
-func (wh *WasmHost) loadWasmCode() error {
-	code, e := wh.readWasmCode()
+func (wh *WasmHost) loadModule(m *wasmModule) error {
+	wc, e := wh.loader.load(m.spec, wh.spec.publicKey(m.spec), m.version)
 	if e != nil {
-		logger.Errorf("failed to load wasm code: %v", e)
+		logger.Errorf("failed to load wasm code of module %s: %v", m.spec.Name, e)
 		return e
 	}
 
-	if len(wh.code) > 0 && bytes.Equal(wh.code, code) {
+	// the version of the code is not changed
+	if wc == nil {
 		return nil
 	}
 
-	p, e := NewWasmVMPool(wh, code)
+	if len(m.code) > 0 && bytes.Equal(m.code, wc.code) {
+		m.version = wc.version
+		return nil
+	}
+
+	p, e := NewWasmVMPool(wh, m.spec, wc.code)
 	if e != nil {
-		logger.Errorf("failed to create wasm VM pool: %v", e)
+		logger.Errorf("failed to create wasm VM pool of module %s: %v", m.spec.Name, e)
 		return e
 	}
-	wh.code = code
+	m.code, m.version = wc.code, wc.version
+	logger.Infof("wasm code of module %s is loaded, version: %s", m.spec.Name, wc.version)
 
-	wh.vmPool.Store(p)
+	m.vmPool.Store(p)
 	return nil
 }
 
+// loaded returns whether the code of all modules are loaded.
+func (wh *WasmHost) loaded() bool {
+	for _, m := range wh.modules {
+		if len(m.code) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
 func (wh *WasmHost) watchWasmCode() {
 	var (
 		chWasm <-chan *string
@@ -224,13 +358,21 @@ func (wh *WasmHost) watchWasmCode() {
 		}
 	}
 
+	refresh := time.NewTicker(wh.spec.Registry.refreshInterval())
+	defer refresh.Stop()
+
 	for {
 		select {
 		case <-chWasm:
 			err = wh.loadWasmCode()
 
+		case <-refresh.C:
+			if e := wh.refreshWasmCode(); e != nil {
+				err = e
+			}
+
 		case <-time.After(30 * time.Second):
-			if err != nil || len(wh.code) == 0 {
+			if err != nil || !wh.loaded() {
 				err = wh.loadWasmCode()
 			}
 
@@ -282,6 +424,14 @@ func (wh *WasmHost) reload() {
 
 	wh.spec.timeout, _ = time.ParseDuration(wh.spec.Timeout)
 	wh.chStop = make(chan struct{})
+	wh.httpClient = &http.Client{}
+	cacheDir := filepath.Join(spec.Super().Options().AbsDataDir, "wasm")
+	wh.loader = newCodeLoader(spec.Registry, cacheDir)
+
+	wh.modules = nil
+	for _, m := range spec.moduleSpecs() {
+		wh.modules = append(wh.modules, &wasmModule{spec: m})
+	}
 
 	wh.loadWasmCode()
 	go wh.watchWasmCode()
@@ -299,12 +449,33 @@ func (wh *WasmHost) Inherit(previousGeneration filters.Filter) {
 }
 
 // Handle handles HTTP request
-func (wh *WasmHost) Handle(ctx *context.Context) (result string) {
+func (wh *WasmHost) Handle(ctx *context.Context) string {
+	atomic.AddInt64(&wh.numOfRequest, 1)
+
+	// the timeout is shared by all modules.
+	deadline := time.Now().Add(wh.spec.timeout)
+	for _, m := range wh.modules {
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			ctx.AddTag(fmt.Sprintf("wasm timeout before module %s", m.spec.Name))
+			atomic.AddInt64(&wh.numOfWasmError, 1)
+			return resultWasmError
+		}
+
+		if result := wh.runModule(ctx, m, timeout); result != "" {
+			return result
+		}
+	}
+
+	return ""
+}
+
+func (wh *WasmHost) runModule(ctx *context.Context, m *wasmModule, timeout time.Duration) (result string) {
 	// we must save the pool to a local variable for later use as it will be
 	// replaced when updating the wasm code
 	var pool *WasmVMPool
-	if p := wh.vmPool.Load(); p == nil {
-		ctx.AddTag("wasm VM pool is not initialized")
+	if p := m.vmPool.Load(); p == nil {
+		ctx.AddTag(fmt.Sprintf("wasm VM pool of module %s is not initialized", m.spec.Name))
 		return resultOutOfVM
 	} else {
 		pool = p.(*WasmVMPool)
@@ -313,11 +484,10 @@ func (wh *WasmHost) Handle(ctx *context.Context) (result string) {
 	// get a free wasm VM and attach the ctx to it
 	vm := pool.Get()
 	if vm == nil {
-		ctx.AddTag("failed to get a wasm VM")
+		ctx.AddTag(fmt.Sprintf("failed to get a wasm VM of module %s", m.spec.Name))
 		return resultOutOfVM
 	}
 	vm.ctx = ctx
-	atomic.AddInt64(&wh.numOfRequest, 1)
 
 	var wg sync.WaitGroup
 	chCancelInterrupt := make(chan struct{})
@@ -328,7 +498,7 @@ func (wh *WasmHost) Handle(ctx *context.Context) (result string) {
 		// the VM is not usable if there's a panic, set it to nil and a new
 		// VM will be created in pool.Get later
 		if e := recover(); e != nil {
-			logger.Errorf("recovered from wasm error: %v", e)
+			logger.Errorf("recovered from wasm error of module %s: %v", m.spec.Name, e)
 			result = resultWasmError
 			atomic.AddInt64(&wh.numOfWasmError, 1)
 			vm = nil
@@ -342,7 +512,7 @@ func (wh *WasmHost) Handle(ctx *context.Context) (result string) {
 	go func() {
 		defer wg.Done()
 
-		timer := time.NewTimer(wh.spec.timeout)
+		timer := time.NewTimer(timeout)
 
 		select {
 		case <-chCancelInterrupt:
@@ -373,12 +543,12 @@ func (wh *WasmHost) Handle(ctx *context.Context) (result string) {
 
 // Status returns Status generated by the filter.
 func (wh *WasmHost) Status() interface{} {
-	p := wh.vmPool.Load()
-	s := &Status{}
-	if p == nil {
-		s.Health = "VM pool is not initialized"
-	} else {
-		s.Health = "ready"
+	s := &Status{Health: "ready"}
+	for _, m := range wh.modules {
+		if m.vmPool.Load() == nil {
+			s.Health = fmt.Sprintf("VM pool of module %s is not initialized", m.spec.Name)
+			break
+		}
 	}
 
 	s.NumOfRequest = atomic.LoadInt64(&wh.numOfRequest)
@@ -389,4 +559,5 @@ func (wh *WasmHost) Status() interface{} {
 // Close closes WasmHost.
 func (wh *WasmHost) Close() {
 	close(wh.chStop)
+	wh.httpClient.CloseIdleConnections()
 }
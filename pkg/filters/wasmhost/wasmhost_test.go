@@ -0,0 +1,169 @@
+//go:build wasmhost
+// +build wasmhost
+
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wasmhost
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{}
+	assert.Error(spec.Validate())
+
+	spec.Code = "AGFzbQEAAAA="
+	assert.NoError(spec.Validate())
+
+	spec.Modules = []*ModuleSpec{{Name: "a", Code: "a.wasm"}}
+	assert.Error(spec.Validate())
+
+	spec.Code = ""
+	assert.NoError(spec.Validate())
+
+	spec.Modules = append(spec.Modules, &ModuleSpec{Name: "a", Code: "b.wasm"})
+	assert.Error(spec.Validate())
+
+	spec.Modules[1].Name = "b"
+	spec.Modules[1].Digest = "md5:1234"
+	assert.Error(spec.Validate())
+
+	spec.Modules[1].Digest = digestOf([]byte("code"))
+	assert.NoError(spec.Validate())
+}
+
+func TestSpecModules(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{
+		Code:       "AGFzbQEAAAA=",
+		PublicKey:  "spec-key",
+		Parameters: map[string]string{"a": "1", "b": "2"},
+	}
+	spec.MetaSpec.Name = "wasm-host"
+
+	modules := spec.moduleSpecs()
+	assert.Len(modules, 1)
+	assert.Equal("wasm-host", modules[0].Name)
+	assert.Equal("spec-key", spec.publicKey(modules[0]))
+
+	m := &ModuleSpec{
+		Name:       "module",
+		PublicKey:  "module-key",
+		Parameters: map[string]string{"b": "3", "c": "4"},
+	}
+	assert.Equal("module-key", spec.publicKey(m))
+
+	params := spec.parameters(m)
+	pairs := []string{}
+	for i := 0; i < len(params); i += 2 {
+		pairs = append(pairs, params[i]+"="+params[i+1])
+	}
+	sort.Strings(pairs)
+	assert.Equal([]string{"a=1", "b=3", "c=4"}, pairs)
+}
+
+func TestHTTPCallSpec(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &HTTPCallSpec{AllowedHosts: []string{"example.com", "127.0.0.1:8080"}}
+	assert.Equal(defaultHTTPCallTimeout, spec.timeout(0))
+	assert.Equal(100*time.Millisecond, spec.timeout(100*time.Millisecond))
+	assert.Equal(defaultHTTPCallTimeout, spec.timeout(time.Minute))
+
+	spec.Timeout = "5s"
+	assert.Equal(5*time.Second, spec.timeout(time.Minute))
+
+	for rawURL, allowed := range map[string]bool{
+		"http://example.com/a":      true,
+		"http://EXAMPLE.com:80/a":   true,
+		"http://127.0.0.1:8080/a":   true,
+		"http://127.0.0.1:8081/a":   false,
+		"http://example.org/a":      false,
+		"http://example.com.cn/a":   false,
+		"https://example.com:443/a": true,
+	} {
+		u, _ := url.Parse(rawURL)
+		assert.Equal(allowed, spec.allowed(u), rawURL)
+	}
+}
+
+func TestHTTPCall(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("X-Token", r.Header.Get("X-Token"))
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	wh := &WasmHost{spec: &Spec{}, httpClient: server.Client()}
+
+	result := wh.httpCall(http.MethodPost, server.URL, nil, nil, 0)
+	assert.Equal(0, result.statusCode)
+	assert.Contains(string(result.body), "disabled")
+
+	wh.spec.HTTPCall = &HTTPCallSpec{AllowedHosts: []string{u.Host}}
+
+	header := http.Header{"X-Token": []string{"token"}}
+	result = wh.httpCall(http.MethodPost, server.URL+"/echo", header, []byte("hello"), 0)
+	assert.Equal(http.StatusCreated, result.statusCode)
+	assert.Equal(http.MethodPost, result.header.Get("X-Method"))
+	assert.Equal("token", result.header.Get("X-Token"))
+	assert.Equal("hello", string(result.body))
+
+	result = wh.httpCall(http.MethodGet, "ftp://"+u.Host+"/echo", nil, nil, 0)
+	assert.Equal(0, result.statusCode)
+	assert.Contains(string(result.body), "unsupported scheme")
+
+	result = wh.httpCall(http.MethodGet, "http://example.com/echo", nil, nil, 0)
+	assert.Equal(0, result.statusCode)
+	assert.Contains(string(result.body), "not allowed")
+
+	result = wh.httpCall(http.MethodGet, server.URL+"/slow", nil, nil, 50*time.Millisecond)
+	assert.Equal(0, result.statusCode)
+	assert.True(strings.Contains(string(result.body), "deadline exceeded"), string(result.body))
+}
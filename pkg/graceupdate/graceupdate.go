@@ -18,7 +18,10 @@
 package graceupdate
 
 import (
+	"net"
 	"os"
+	"sync/atomic"
+	"time"
 
 	"github.com/megaease/grace/gracenet"
 
@@ -26,13 +29,49 @@ import (
 	"github.com/megaease/easegress/pkg/logger"
 )
 
+const defaultDrainTimeout = 30 * time.Second
+
 var (
 	// Global is gracenet Net struct
 	Global     = &gracenet.Net{}
 	didInherit = os.Getenv("LISTEN_FDS") != ""
 	ppid       = os.Getppid()
+
+	// draining is 1 after the new process started, the old process keeps
+	// serving the accepted connections until it is terminated by the new
+	// one, and then drains them within the drain timeout.
+	draining     int32
+	drainTimeout = int64(defaultDrainTimeout)
 )
 
+// Listen announces on the local network address, the listener is inherited
+// from the parent process on gracefully updating, and passed to the child
+// process on the next update. All listeners of the traffic should be created
+// by it, so that the new process could take over the connections without
+// dropping any of them.
+func Listen(network, addr string) (net.Listener, error) {
+	return Global.Listen(network, addr)
+}
+
+// IsDraining returns if the process is draining the connections, i.e. a new
+// process has taken over the listeners.
+func IsDraining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
+// SetDrainTimeout sets the timeout to drain the connections on closing.
+func SetDrainTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultDrainTimeout
+	}
+	atomic.StoreInt64(&drainTimeout, int64(timeout))
+}
+
+// DrainTimeout returns the timeout to drain the connections on closing.
+func DrainTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&drainTimeout))
+}
+
 // IsInherit returns if I am the child process
 // on gracefully updating process.
 func IsInherit() bool {
@@ -70,10 +109,12 @@ func NotifySigUsr2(closeCls func(), restartCls func()) error {
 			// Reset signal usr2 notify
 			NotifySigUsr2(closeCls, restartCls)
 		} else {
+			atomic.StoreInt32(&draining, 1)
 			childdone := make(chan error, 1)
 			go func() {
 				process, err := os.FindProcess(pid)
 				if err != nil {
+					atomic.StoreInt32(&draining, 0)
 					restartCls()
 					NotifySigUsr2(closeCls, restartCls)
 				} else {
@@ -82,6 +123,7 @@ func NotifySigUsr2(closeCls func(), restartCls func()) error {
 					select {
 					case err := <-childdone:
 						logger.Errorf("child proc exited: %v", err)
+						atomic.StoreInt32(&draining, 0)
 						restartCls()
 						NotifySigUsr2(closeCls, restartCls)
 					}
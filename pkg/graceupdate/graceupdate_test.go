@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graceupdate
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// inheritedAddrEnv is the address the child process listens on in the test
+// of inherited listeners.
+const inheritedAddrEnv = "EG_TEST_INHERITED_ADDR"
+
+func TestListenInherited(t *testing.T) {
+	if addr := os.Getenv(inheritedAddrEnv); addr != "" {
+		// the child process, the address is still listened by the parent,
+		// so listening fails if the listener is not inherited.
+		l, err := Listen("tcp", addr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "listen %s failed: %v\n", addr, err)
+			os.Exit(1)
+		}
+		conn, err := l.Accept()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "accept failed: %v\n", err)
+			os.Exit(1)
+		}
+		conn.Write([]byte(fmt.Sprintf("inherited: %v", IsInherit())))
+		conn.Close()
+		return
+	}
+
+	assert := assert.New(t)
+	assert.False(IsInherit())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer l.Close()
+	file, err := l.(*net.TCPListener).File()
+	assert.NoError(err)
+	defer file.Close()
+
+	// pass the listener to the child process the way of gracenet.
+	addr := l.Addr().String()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestListenInherited$")
+	cmd.Env = append(os.Environ(), "LISTEN_FDS=1", inheritedAddrEnv+"="+addr)
+	cmd.ExtraFiles = []*os.File{file}
+	cmd.Stderr = os.Stderr
+	assert.NoError(cmd.Start())
+
+	conn, err := net.Dial("tcp", addr)
+	assert.NoError(err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	data, err := io.ReadAll(conn)
+	assert.NoError(err)
+	assert.Equal("inherited: true", string(data))
+	assert.NoError(cmd.Wait())
+}
+
+func TestListen(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			conn.Write([]byte("hello"))
+			conn.Close()
+		}
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.NoError(err)
+	defer conn.Close()
+	data, err := io.ReadAll(conn)
+	assert.NoError(err)
+	assert.Equal("hello", string(data))
+}
+
+func TestDrainTimeout(t *testing.T) {
+	assert := assert.New(t)
+	defer SetDrainTimeout(0)
+
+	assert.Equal(defaultDrainTimeout, DrainTimeout())
+	SetDrainTimeout(time.Second)
+	assert.Equal(time.Second, DrainTimeout())
+	SetDrainTimeout(-time.Second)
+	assert.Equal(defaultDrainTimeout, DrainTimeout())
+
+	assert.False(IsDraining())
+}
@@ -68,6 +68,7 @@ func Sync() {
 	httpFilterAccessLogger.Sync()
 	httpFilterDumpLogger.Sync()
 	restAPILogger.Sync()
+	adminAuditLogger.Sync()
 }
 
 // APIAccess logs admin api log.
@@ -84,6 +85,11 @@ func APIAccess(
 		fasttime.Format(requestTime, fasttime.RFC3339), processTime)
 }
 
+// AdminAudit logs an audit entry of the administration changes.
+func AdminAudit(entry string) {
+	adminAuditLogger.Info(entry)
+}
+
 // HTTPAccess logs http access log.
 func HTTPAccess(template string, args ...interface{}) {
 	httpFilterAccessLogger.Debugf(template, args...)
@@ -44,6 +44,7 @@ func InitNop() {
 	httpFilterAccessLogger = nop.Sugar()
 	httpFilterDumpLogger = nop.Sugar()
 	restAPILogger = nop.Sugar()
+	adminAuditLogger = nop.Sugar()
 
 	defaultLogger = nop.Sugar()
 	gressLogger = defaultLogger
@@ -56,6 +57,7 @@ func InitMock() {
 	httpFilterAccessLogger = mock.Sugar()
 	httpFilterDumpLogger = mock.Sugar()
 	restAPILogger = mock.Sugar()
+	adminAuditLogger = mock.Sugar()
 
 	defaultLogger = mock.Sugar()
 	gressLogger = defaultLogger
@@ -67,6 +69,7 @@ const (
 	filterHTTPAccessFilename = "filter_http_access.log"
 	filterHTTPDumpFilename   = "filter_http_dump.log"
 	adminAPIFilename         = "admin_api.log"
+	adminAuditFilename       = "admin_audit.log"
 
 	// EtcdClientFilename is the filename of etcd client log.
 	EtcdClientFilename = "etcd_client.log"
@@ -86,6 +89,7 @@ var (
 	httpFilterAccessLogger *zap.SugaredLogger
 	httpFilterDumpLogger   *zap.SugaredLogger
 	restAPILogger          *zap.SugaredLogger
+	adminAuditLogger       *zap.SugaredLogger
 )
 
 // EtcdClientLoggerConfig generates the config of etcd client logger.
@@ -171,6 +175,8 @@ func initHTTPFilter(opt *option.Options) {
 
 func initRestAPI(opt *option.Options) {
 	restAPILogger = newPlainLogger(opt, adminAPIFilename, systemLogMaxCacheCount)
+	// NOTE: The audit log is not an access log, so it can't be disabled.
+	adminAuditLogger = newMessageLogger(opt, adminAuditFilename, systemLogMaxCacheCount)
 }
 
 func newPlainLogger(opt *option.Options, filename string, maxCacheCount uint32) *zap.SugaredLogger {
@@ -178,6 +184,10 @@ func newPlainLogger(opt *option.Options, filename string, maxCacheCount uint32)
 		return zap.NewNop().Sugar()
 	}
 
+	return newMessageLogger(opt, filename, maxCacheCount)
+}
+
+func newMessageLogger(opt *option.Options, filename string, maxCacheCount uint32) *zap.SugaredLogger {
 	encoderConfig := zapcore.EncoderConfig{
 		TimeKey:       "",
 		LevelKey:      "",
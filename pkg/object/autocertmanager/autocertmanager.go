@@ -19,9 +19,6 @@ package autocertmanager
 
 import (
 	"context"
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/tls"
 	"fmt"
 	"net/http"
@@ -52,6 +49,7 @@ type (
 		spec      *Spec
 		storage   *storage
 		client    *acme.Client
+		caClients map[string]*acme.Client
 
 		stopCtx context.Context
 		cancel  context.CancelFunc
@@ -69,18 +67,42 @@ type (
 		EnableTLSALPN01 bool         `json:"enableTLSALPN01"`
 		EnableDNS01     bool         `json:"enableDNS01"`
 		Domains         []DomainSpec `json:"domains" jsonschema:"required"`
+
+		// ExternalAccountBinding is used to register to the CA of
+		// directoryURL, while additional CAs could be used by domains.
+		ExternalAccountBinding *ExternalAccountBinding `json:"externalAccountBinding,omitempty" jsonschema:"omitempty"`
+		CAs                    []*CASpec               `json:"cas,omitempty" jsonschema:"omitempty"`
 	}
 
 	// DomainSpec is the automated certificate management spec for a domain.
 	DomainSpec struct {
 		Name        string            `json:"name" jsonschema:"required"`
 		DNSProvider map[string]string `json:"dnsProvider" jsonschema:"omitempty"`
+		// ChallengeType restricts the challenge of the domain to the given
+		// type, all enabled challenges are tried if it is empty.
+		ChallengeType string `json:"challengeType" jsonschema:"omitempty,enum=,enum=http-01,enum=tls-alpn-01,enum=dns-01"`
+		// CA is the name of the CA issuing the certificate of the domain,
+		// the CA of directoryURL is used if it is empty.
+		CA string `json:"ca" jsonschema:"omitempty"`
 	}
 
 	// CertificateStatus is the certificate status of a domain.
 	CertificateStatus struct {
-		Name       string    `json:"name"`
-		ExpireTime time.Time `json:"expireTime"`
+		Name          string         `json:"name"`
+		CA            string         `json:"ca,omitempty"`
+		ChallengeType string         `json:"challengeType,omitempty"`
+		ExpireTime    time.Time      `json:"expireTime"`
+		RenewTime     time.Time      `json:"renewTime"`
+		LastRenewal   *RenewalStatus `json:"lastRenewal,omitempty"`
+	}
+
+	// RenewalStatus is the result of the last renewal of a certificate,
+	// certificates are only renewed by the leader.
+	RenewalStatus struct {
+		Time       time.Time `json:"time"`
+		Succeeded  bool      `json:"succeeded"`
+		Error      string    `json:"error,omitempty"`
+		Challenges []string  `json:"challenges,omitempty"`
 	}
 
 	// Status is the status of AutoCertManager.
@@ -93,15 +115,40 @@ var (
 	globalACM atomic.Value
 )
 
+// challengeEnabled returns whether the challenge type is enabled.
+func (spec *Spec) challengeEnabled(typ string) bool {
+	switch typ {
+	case challengeHTTP01:
+		return spec.EnableHTTP01
+	case challengeTLSALPN01:
+		return spec.EnableTLSALPN01
+	case challengeDNS01:
+		return spec.EnableDNS01
+	}
+	return false
+}
+
 // Validate validates the spec of AutoCertManager.
 func (spec *Spec) Validate() error {
 	if !(spec.EnableHTTP01 || spec.EnableTLSALPN01 || spec.EnableDNS01) {
 		return fmt.Errorf("at least one challenge type must be enabled")
 	}
 
+	cas := map[string]bool{}
+	for _, ca := range spec.CAs {
+		if cas[ca.Name] {
+			return fmt.Errorf("duplicated CA name: %s", ca.Name)
+		}
+		cas[ca.Name] = true
+	}
+
 	for i := range spec.Domains {
 		d := &spec.Domains[i]
 
+		if d.CA != "" && !cas[d.CA] {
+			return fmt.Errorf("CA %s of domain %s is not defined", d.CA, d.Name)
+		}
+
 		// convert to puny code to support Chinese or other unicode domain names.
 		_, err := idna.Lookup.ToASCII(d.Name)
 		if err != nil && d.Name[0] == '*' {
@@ -111,10 +158,24 @@ func (spec *Spec) Validate() error {
 			return fmt.Errorf("domain name contains invalid characters: %s", d.Name)
 		}
 
+		if d.ChallengeType != "" && !spec.challengeEnabled(d.ChallengeType) {
+			return fmt.Errorf("challenge type %s of domain %s is disabled", d.ChallengeType, d.Name)
+		}
+
 		if d.Name[0] != '*' {
+			if d.ChallengeType != challengeDNS01 {
+				continue
+			}
+			if _, err := newDNSProvider(d); err != nil {
+				return fmt.Errorf("DNS provider configuration is invalid: %v", err)
+			}
 			continue
 		}
 
+		if d.ChallengeType != "" && d.ChallengeType != challengeDNS01 {
+			return fmt.Errorf("wildcard domain name requires DNS-01 challenge: %s", d.Name)
+		}
+
 		if !spec.EnableDNS01 {
 			return fmt.Errorf("find wildcard domain name but DNS-01 challenge is disabled: %s", d.Name)
 		}
@@ -204,6 +265,7 @@ func (acm *AutoCertManager) findDomain(name string, exactMatch bool) *Domain {
 func (acm *AutoCertManager) reload() {
 	acm.stopCtx, acm.cancel = context.WithCancel(context.Background())
 	acm.storage = newStorage(acm.super.Cluster())
+	acm.caClients = map[string]*acme.Client{}
 
 	acm.renewBefore, _ = time.ParseDuration(acm.spec.RenewBefore)
 
@@ -240,10 +302,17 @@ func (acm *AutoCertManager) Status() *supervisor.Status {
 	status := &Status{}
 	for i := range acm.domains {
 		d := &acm.domains[i]
-		status.Domains = append(status.Domains, CertificateStatus{
-			Name:       d.Name,
-			ExpireTime: d.certExpireTime(),
-		})
+		cs := CertificateStatus{
+			Name:          d.Name,
+			CA:            d.CA,
+			ChallengeType: d.ChallengeType,
+			ExpireTime:    d.certExpireTime(),
+			LastRenewal:   d.lastRenewal(),
+		}
+		if !cs.ExpireTime.IsZero() {
+			cs.RenewTime = cs.ExpireTime.Add(-acm.renewBefore)
+		}
+		status.Domains = append(status.Domains, cs)
 	}
 	return &supervisor.Status{ObjectStatus: status}
 }
@@ -275,36 +344,26 @@ func (acm *AutoCertManager) renew() bool {
 			continue
 		}
 
+		// the account of the CA is not registered yet, will retry later.
+		if d.acmeClient(acm) == nil {
+			allSucc = false
+			continue
+		}
+
 		logger.Infof("begin renew certificate for domain %s", d.Name)
-		if err := d.renewCert(acm); err == nil {
+		err := d.renewCert(acm)
+		if err == nil {
 			logger.Infof("certificate for domain %s has been renewed", d.Name)
 		} else {
 			logger.Errorf("failed to renew certificate for domain %s: %v", d.Name, err)
 			allSucc = false
 		}
+		d.setLastRenewal(err)
 	}
 
 	return allSucc
 }
 
-func (acm *AutoCertManager) createAcmeClient() error {
-	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	if err != nil {
-		logger.Errorf("failed to generate new account: %v", err)
-		return err
-	}
-
-	cl := &acme.Client{Key: key, DirectoryURL: acm.spec.DirectoryURL}
-	acct := &acme.Account{Contact: []string{"mailto:" + acm.spec.Email}}
-	if _, err := cl.Register(acm.stopCtx, acct, acme.AcceptTOS); err != nil {
-		logger.Errorf("failed to register: %v", err)
-		return err
-	}
-
-	acm.client = cl
-	return nil
-}
-
 func (acm *AutoCertManager) watchCertificate() {
 	onChange := func(name string, cert *tls.Certificate) {
 		d := acm.findDomain(name, false)
@@ -317,22 +376,16 @@ func (acm *AutoCertManager) watchCertificate() {
 }
 
 func (acm *AutoCertManager) run() {
-	for {
-		if err := acm.createAcmeClient(); err == nil {
-			break
-		}
-		select {
-		case <-acm.stopCtx.Done():
-			return
-		case <-time.After(30 * time.Second):
-		}
-	}
-
 	for {
 		waitDuration := time.Hour
 		if allSucc := acm.renew(); !allSucc {
 			waitDuration = 10 * time.Minute
 		}
+		// retry registering the accounts more frequently, as no
+		// certificates of the CA could be renewed without an account.
+		if err := acm.createAcmeClients(); err != nil {
+			waitDuration = 30 * time.Second
+		}
 
 		select {
 		case <-acm.stopCtx.Done():
@@ -357,6 +410,9 @@ func (acm *AutoCertManager) getCertificate(chi *tls.ClientHelloInfo, tokenOnly b
 		if !acm.spec.EnableTLSALPN01 {
 			return nil, fmt.Errorf("TLS-ALPN01 challenge is disabled")
 		}
+		if d := acm.findDomain(name, false); d != nil && !d.challengeAllowed(acm, challengeTLSALPN01) {
+			return nil, fmt.Errorf("TLS-ALPN01 challenge is disabled for %s", name)
+		}
 		return acm.storage.getTLSALPNCert(name)
 	}
 
@@ -392,6 +448,10 @@ func (acm *AutoCertManager) handleHTTP01Challenge(w http.ResponseWriter, r *http
 		http.Error(w, msg, http.StatusForbidden)
 		return
 	}
+	if !domain.challengeAllowed(acm, challengeHTTP01) {
+		http.Error(w, "HTTP01 challenge is disabled for the host", http.StatusNotFound)
+		return
+	}
 
 	data, err := acm.storage.getHTTPToken(r.Host, r.URL.Path)
 	if err != nil {
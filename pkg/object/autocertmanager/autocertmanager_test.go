@@ -132,6 +132,162 @@ domains:
 		}
 	})
 
+	t.Run("disabled challenge type", func(t *testing.T) {
+		yamlConfig := `
+name: autocert
+kind: AutoCertManager
+email: someone@megaease.com
+renewBefore: 720h
+enableHTTP01: false
+domains:
+  - name: "www.megaease.com"
+    challengeType: http-01
+`
+		_, err := supervisor.NewSpec(yamlConfig)
+		if err == nil {
+			t.Errorf("spec creation should have failed")
+		}
+	})
+
+	t.Run("wildcard with HTTP01", func(t *testing.T) {
+		yamlConfig := `
+name: autocert
+kind: AutoCertManager
+email: someone@megaease.com
+renewBefore: 720h
+domains:
+  - name: "*.megaease.com"
+    challengeType: http-01
+    dnsProvider:
+      name: alidns
+      zone: megaease.com
+      accessKeyId: accessKeyId
+      accessKeySecret: accessKeySecret
+`
+		_, err := supervisor.NewSpec(yamlConfig)
+		if err == nil {
+			t.Errorf("spec creation should have failed")
+		}
+	})
+
+	t.Run("DNS01 without DNS provider", func(t *testing.T) {
+		yamlConfig := `
+name: autocert
+kind: AutoCertManager
+email: someone@megaease.com
+renewBefore: 720h
+domains:
+  - name: "www.megaease.com"
+    challengeType: dns-01
+`
+		_, err := supervisor.NewSpec(yamlConfig)
+		if err == nil {
+			t.Errorf("spec creation should have failed")
+		}
+	})
+
+	t.Run("undefined CA", func(t *testing.T) {
+		yamlConfig := `
+name: autocert
+kind: AutoCertManager
+email: someone@megaease.com
+renewBefore: 720h
+domains:
+  - name: "www.megaease.com"
+    ca: zerossl
+`
+		_, err := supervisor.NewSpec(yamlConfig)
+		if err == nil {
+			t.Errorf("spec creation should have failed")
+		}
+	})
+
+	t.Run("duplicated CA", func(t *testing.T) {
+		yamlConfig := `
+name: autocert
+kind: AutoCertManager
+email: someone@megaease.com
+renewBefore: 720h
+cas:
+  - name: internal
+    directoryURL: https://ca.megaease.com/acme/directory
+  - name: internal
+    directoryURL: https://ca2.megaease.com/acme/directory
+domains:
+  - name: "www.megaease.com"
+`
+		_, err := supervisor.NewSpec(yamlConfig)
+		if err == nil {
+			t.Errorf("spec creation should have failed")
+		}
+	})
+
+	t.Run("bad external account binding", func(t *testing.T) {
+		yamlConfig := `
+name: autocert
+kind: AutoCertManager
+email: someone@megaease.com
+renewBefore: 720h
+externalAccountBinding:
+  keyID: kid
+  hmacKey: "not base64!"
+domains:
+  - name: "www.megaease.com"
+`
+		_, err := supervisor.NewSpec(yamlConfig)
+		if err == nil {
+			t.Errorf("spec creation should have failed")
+		}
+	})
+
+	t.Run("bad root CA", func(t *testing.T) {
+		yamlConfig := `
+name: autocert
+kind: AutoCertManager
+email: someone@megaease.com
+renewBefore: 720h
+cas:
+  - name: internal
+    directoryURL: https://ca.megaease.com/acme/directory
+    rootCABase64: YWJj
+domains:
+  - name: "www.megaease.com"
+    ca: internal
+`
+		_, err := supervisor.NewSpec(yamlConfig)
+		if err == nil {
+			t.Errorf("spec creation should have failed")
+		}
+	})
+
+	t.Run("CAs", func(t *testing.T) {
+		yamlConfig := `
+name: autocert
+kind: AutoCertManager
+email: someone@megaease.com
+renewBefore: 720h
+cas:
+  - name: zerossl
+    directoryURL: https://acme.zerossl.com/v2/DV90
+    externalAccountBinding:
+      keyID: kid
+      hmacKey: c2VjcmV0LWtleQ
+  - name: internal
+    directoryURL: https://ca.megaease.com/acme/directory
+    email: ops@megaease.com
+domains:
+  - name: "www.megaease.com"
+    ca: zerossl
+  - name: "api.megaease.com"
+    ca: internal
+  - name: "megaease.com"
+`
+		_, err := supervisor.NewSpec(yamlConfig)
+		if err != nil {
+			t.Errorf("spec creation should have succeeded: %v", err)
+		}
+	})
+
 	t.Run("normal", func(t *testing.T) {
 		yamlConfig := `
 name: autocert
@@ -140,6 +296,13 @@ email: someone@megaease.com
 renewBefore: 720h
 domains:
   - name: "www.megaease.com"
+  - name: "api.megaease.com"
+    challengeType: dns-01
+    dnsProvider:
+      name: godaddy
+      zone: megaease.com
+      apiKey: apiKey
+      apiSecret: apiSecret
 `
 		_, err := supervisor.NewSpec(yamlConfig)
 		if err != nil {
@@ -267,6 +430,20 @@ func TestDNSProvider(t *testing.T) {
 		})
 	*/
 
+	t.Run("godaddy", func(t *testing.T) {
+		spec.DNSProvider["name"] = "godaddy"
+		spec.DNSProvider["apiKey"] = "apiKey"
+		_, err := newDNSProvider(spec)
+		if err == nil {
+			t.Errorf("DNS provider creation should have failed")
+		}
+		spec.DNSProvider["apiSecret"] = "apiSecret"
+		_, err = newDNSProvider(spec)
+		if err != nil {
+			t.Errorf("DNS provider creation should have succeeded: %v", err)
+		}
+	})
+
 	t.Run("hetzner", func(t *testing.T) {
 		spec.DNSProvider["name"] = "hetzner"
 		spec.DNSProvider["authApiToken"] = "authApiToken"
@@ -855,6 +1032,53 @@ func TestDomain(t *testing.T) {
 		waitDNSRecordTest(t, d)
 	})
 
+	t.Run("challengeRecordName", func(t *testing.T) {
+		cases := []struct {
+			name     string
+			zone     string
+			relative string
+			absolute string
+		}{
+			{"megaease.com", "megaease.com", "_acme-challenge", "_acme-challenge.megaease.com"},
+			{"*.megaease.com", "megaease.com.", "_acme-challenge", "_acme-challenge.megaease.com"},
+			{"www.megaease.com", "megaease.com", "_acme-challenge.www", "_acme-challenge.www.megaease.com"},
+			{"*.api.megaease.com", "megaease.com", "_acme-challenge.api", "_acme-challenge.api.megaease.com"},
+		}
+		for _, c := range cases {
+			d := Domain{
+				DomainSpec:     &DomainSpec{Name: c.name, DNSProvider: map[string]string{"zone": c.zone}},
+				nameInPunyCode: c.name,
+			}
+			if name := d.challengeRecordName(true); name != c.relative {
+				t.Errorf("relative record name of %s should be %s, but got %s", c.name, c.relative, name)
+			}
+			if name := d.challengeRecordName(false); name != c.absolute {
+				t.Errorf("record name of %s should be %s, but got %s", c.name, c.absolute, name)
+			}
+		}
+	})
+
+	t.Run("challengeAllowed", func(t *testing.T) {
+		fakeAcm := &AutoCertManager{spec: &Spec{EnableHTTP01: true, EnableDNS01: true}}
+		d := Domain{DomainSpec: &DomainSpec{Name: "name"}}
+		if !d.challengeAllowed(fakeAcm, challengeHTTP01) || !d.challengeAllowed(fakeAcm, challengeDNS01) {
+			t.Errorf("challenges should be allowed")
+		}
+		if d.challengeAllowed(fakeAcm, challengeTLSALPN01) {
+			t.Errorf("TLS-ALPN01 challenge should not be allowed")
+		}
+		d.ChallengeType = challengeDNS01
+		if d.challengeAllowed(fakeAcm, challengeHTTP01) || !d.challengeAllowed(fakeAcm, challengeDNS01) {
+			t.Errorf("only DNS01 challenge should be allowed")
+		}
+
+		d.fulfilled = []string{challengeDNS01}
+		d.setLastRenewal(fmt.Errorf("failed"))
+		if rs := d.lastRenewal(); rs == nil || rs.Succeeded || rs.Error != "failed" || rs.Challenges[0] != challengeDNS01 {
+			t.Errorf("bad renewal status: %+v", rs)
+		}
+	})
+
 	t.Run("renewCert", func(t *testing.T) {
 		var ca *httptest.Server
 		ca = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,164 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package autocertmanager
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"golang.org/x/crypto/acme"
+)
+
+type (
+	// CASpec describes an ACME CA, e.g. ZeroSSL, Buypass or an internal
+	// CA like step-ca. Domains use the CA by its name.
+	CASpec struct {
+		Name         string `json:"name" jsonschema:"required"`
+		DirectoryURL string `json:"directoryURL" jsonschema:"required,format=url"`
+		// Email is the contact of the account, the email of the
+		// AutoCertManager is used if it is empty.
+		Email                  string                  `json:"email" jsonschema:"omitempty,format=email"`
+		ExternalAccountBinding *ExternalAccountBinding `json:"externalAccountBinding,omitempty" jsonschema:"omitempty"`
+		// RootCABase64 is the root certificate to verify the directory
+		// server, it is required if the server is signed by an internal CA.
+		RootCABase64 string `json:"rootCABase64" jsonschema:"omitempty,format=base64"`
+	}
+
+	// ExternalAccountBinding binds the ACME account to an account of the
+	// CA, which is required by some CAs like ZeroSSL.
+	ExternalAccountBinding struct {
+		KeyID string `json:"keyID" jsonschema:"required"`
+		// HMACKey is the base64url encoded HMAC key provided by the CA.
+		HMACKey string `json:"hmacKey" jsonschema:"required"`
+	}
+)
+
+// Validate validates ExternalAccountBinding.
+func (eab *ExternalAccountBinding) Validate() error {
+	if _, err := eab.key(); err != nil {
+		return fmt.Errorf("invalid hmacKey: %v", err)
+	}
+	return nil
+}
+
+// key decodes the HMAC key, CAs provide the key in base64url encoding,
+// with or without padding.
+func (eab *ExternalAccountBinding) key() ([]byte, error) {
+	key, err := base64.RawURLEncoding.DecodeString(eab.HMACKey)
+	if err != nil {
+		key, err = base64.URLEncoding.DecodeString(eab.HMACKey)
+	}
+	if err == nil && len(key) == 0 {
+		err = fmt.Errorf("empty key")
+	}
+	return key, err
+}
+
+// Validate validates CASpec.
+func (ca *CASpec) Validate() error {
+	if ca.RootCABase64 != "" {
+		pem, _ := base64.StdEncoding.DecodeString(ca.RootCABase64)
+		if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+			return fmt.Errorf("CA %s: invalid rootCABase64", ca.Name)
+		}
+	}
+	return nil
+}
+
+func (ca *CASpec) httpClient() *http.Client {
+	if ca.RootCABase64 == "" {
+		return nil
+	}
+
+	pem, _ := base64.StdEncoding.DecodeString(ca.RootCABase64)
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(pem)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return &http.Client{Transport: transport}
+}
+
+// acmeClient returns the ACME client of the CA of the domain, it is nil if
+// the account is not registered yet.
+func (d *Domain) acmeClient(acm *AutoCertManager) *acme.Client {
+	if d.CA == "" {
+		return acm.client
+	}
+	return acm.caClients[d.CA]
+}
+
+func (acm *AutoCertManager) newAcmeClient(directoryURL, email string, eab *ExternalAccountBinding, hc *http.Client) (*acme.Client, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		logger.Errorf("failed to generate new account: %v", err)
+		return nil, err
+	}
+
+	cl := &acme.Client{Key: key, DirectoryURL: directoryURL, HTTPClient: hc}
+	acct := &acme.Account{Contact: []string{"mailto:" + email}}
+	if eab != nil {
+		hmacKey, _ := eab.key()
+		acct.ExternalAccountBinding = &acme.ExternalAccountBinding{KID: eab.KeyID, Key: hmacKey}
+	}
+	if _, err := cl.Register(acm.stopCtx, acct, acme.AcceptTOS); err != nil {
+		logger.Errorf("failed to register to %s: %v", directoryURL, err)
+		return nil, err
+	}
+
+	return cl, nil
+}
+
+// createAcmeClients registers accounts to the CAs which have no accounts
+// yet, it returns an error if any of the registrations failed.
+func (acm *AutoCertManager) createAcmeClients() error {
+	var lastErr error
+
+	if acm.client == nil {
+		cl, err := acm.newAcmeClient(acm.spec.DirectoryURL, acm.spec.Email, acm.spec.ExternalAccountBinding, nil)
+		if err != nil {
+			lastErr = err
+		} else {
+			acm.client = cl
+		}
+	}
+
+	for _, ca := range acm.spec.CAs {
+		if acm.caClients[ca.Name] != nil {
+			continue
+		}
+		email := ca.Email
+		if email == "" {
+			email = acm.spec.Email
+		}
+		cl, err := acm.newAcmeClient(ca.DirectoryURL, email, ca.ExternalAccountBinding, ca.httpClient())
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		acm.caClients[ca.Name] = cl
+	}
+
+	return lastErr
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package autocertmanager
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/acme"
+)
+
+func TestExternalAccountBindingKey(t *testing.T) {
+	for _, k := range []string{"c2VjcmV0LWtleQ", "c2VjcmV0LWtleQ=="} {
+		eab := &ExternalAccountBinding{KeyID: "kid", HMACKey: k}
+		key, err := eab.key()
+		if err != nil || string(key) != "secret-key" {
+			t.Errorf("key %s should be decoded to secret-key: %s, %v", k, key, err)
+		}
+	}
+
+	for _, k := range []string{"", "not base64!"} {
+		eab := &ExternalAccountBinding{KeyID: "kid", HMACKey: k}
+		if eab.Validate() == nil {
+			t.Errorf("key %q should be invalid", k)
+		}
+	}
+}
+
+func TestDomainAcmeClient(t *testing.T) {
+	acm := &AutoCertManager{
+		client:    &acme.Client{DirectoryURL: "default"},
+		caClients: map[string]*acme.Client{"internal": {DirectoryURL: "internal"}},
+	}
+
+	d := &Domain{DomainSpec: &DomainSpec{Name: "www.megaease.com"}}
+	if cl := d.acmeClient(acm); cl != acm.client {
+		t.Errorf("domain without CA should use the default client")
+	}
+
+	d.CA = "internal"
+	if cl := d.acmeClient(acm); cl == nil || cl.DirectoryURL != "internal" {
+		t.Errorf("domain should use the client of its CA")
+	}
+
+	d.CA = "zerossl"
+	if cl := d.acmeClient(acm); cl != nil {
+		t.Errorf("client should be nil if the account is not registered")
+	}
+
+	ca := &CASpec{Name: "internal", DirectoryURL: "https://ca.megaease.com"}
+	if ca.httpClient() != nil {
+		t.Errorf("http client should be nil without root CA")
+	}
+}
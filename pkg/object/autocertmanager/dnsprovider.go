@@ -126,6 +126,13 @@ var dnsProviderCreators = map[string]*dnsProviderCreator{
 		},
 	},
 
+	"godaddy": {
+		requiredFields: []string{"apiKey", "apiSecret"},
+		creatorFn: func(d *DomainSpec) (dnsProvider, error) {
+			return newGodaddyProvider(d.DNSProvider["apiKey"], d.DNSProvider["apiSecret"]), nil
+		},
+	},
+
 	/*
 		"google": {
 			requiredFields: []string{"project"},
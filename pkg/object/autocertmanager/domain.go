@@ -27,6 +27,7 @@ import (
 	"crypto/x509"
 	"fmt"
 	"net"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -35,6 +36,12 @@ import (
 	"golang.org/x/crypto/acme"
 )
 
+const (
+	challengeHTTP01    = "http-01"
+	challengeTLSALPN01 = "tls-alpn-01"
+	challengeDNS01     = "dns-01"
+)
+
 // Domain represents a domain for automated certificate management
 type Domain struct {
 	*DomainSpec
@@ -42,6 +49,10 @@ type Domain struct {
 	certificate    atomic.Value
 	cleanups       []func() error
 	ctx            context.Context
+
+	// fulfilled are the challenges fulfilled in the current renewal.
+	fulfilled   []string
+	renewStatus atomic.Value
 }
 
 // isWildcard returns whether the domain is for a wildcard one
@@ -65,6 +76,34 @@ func (d *Domain) certExpireTime() time.Time {
 	return cert.Leaf.NotAfter
 }
 
+// challengeAllowed returns whether the challenge type could be used for the
+// domain, that's, it is enabled and matches the challenge type of the domain.
+func (d *Domain) challengeAllowed(acm *AutoCertManager, typ string) bool {
+	if !acm.spec.challengeEnabled(typ) {
+		return false
+	}
+	return d.ChallengeType == "" || d.ChallengeType == typ
+}
+
+func (d *Domain) lastRenewal() *RenewalStatus {
+	if x := d.renewStatus.Load(); x != nil {
+		return x.(*RenewalStatus)
+	}
+	return nil
+}
+
+func (d *Domain) setLastRenewal(err error) {
+	rs := &RenewalStatus{
+		Time:       time.Now(),
+		Succeeded:  err == nil,
+		Challenges: d.fulfilled,
+	}
+	if err != nil {
+		rs.Error = err.Error()
+	}
+	d.renewStatus.Store(rs)
+}
+
 func (d *Domain) updateCert(cert *tls.Certificate) {
 	for {
 		oldCert := d.cert()
@@ -84,7 +123,7 @@ func (d *Domain) updateCert(cert *tls.Certificate) {
 }
 
 func (d *Domain) runHTTP01(acm *AutoCertManager, chal *acme.Challenge) error {
-	client := acm.client
+	client := d.acmeClient(acm)
 
 	path := client.HTTP01ChallengePath(chal.Token)
 	body, err := client.HTTP01ChallengeResponse(chal.Token)
@@ -112,7 +151,7 @@ func (d *Domain) runHTTP01(acm *AutoCertManager, chal *acme.Challenge) error {
 }
 
 func (d *Domain) runTLSALPN01(acm *AutoCertManager, z *acme.Authorization, chal *acme.Challenge) error {
-	client := acm.client
+	client := d.acmeClient(acm)
 
 	cert, err := client.TLSALPN01ChallengeCert(chal.Token, z.Identifier.Value)
 	if err != nil {
@@ -138,13 +177,26 @@ func (d *Domain) runTLSALPN01(acm *AutoCertManager, z *acme.Authorization, chal
 	return err
 }
 
-func (d *Domain) waitDNSRecord(value string) error {
-	name := "_acme-challenge."
+// challengeRecordName returns the name of the DNS-01 challenge record,
+// relative to the zone if relative is true.
+func (d *Domain) challengeRecordName(relative bool) string {
+	name := d.nameInPunyCode
 	if d.isWildcard() {
-		name += d.nameInPunyCode[2:] // skip '*.'
-	} else {
-		name += d.nameInPunyCode
+		name = name[2:] // skip '*.'
+	}
+	if !relative {
+		return "_acme-challenge." + name
+	}
+
+	zone := strings.TrimSuffix(d.Zone(), ".")
+	if name == zone || !strings.HasSuffix(name, "."+zone) {
+		return "_acme-challenge"
 	}
+	return "_acme-challenge." + strings.TrimSuffix(name, "."+zone)
+}
+
+func (d *Domain) waitDNSRecord(value string) error {
+	name := d.challengeRecordName(false)
 
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
@@ -167,7 +219,7 @@ func (d *Domain) waitDNSRecord(value string) error {
 }
 
 func (d *Domain) runDNS01(acm *AutoCertManager, chal *acme.Challenge) error {
-	client := acm.client
+	client := d.acmeClient(acm)
 
 	value, err := client.DNS01ChallengeRecord(chal.Token)
 	if err != nil {
@@ -183,7 +235,7 @@ func (d *Domain) runDNS01(acm *AutoCertManager, chal *acme.Challenge) error {
 
 	record := libdns.Record{
 		Type: "TXT",
-		Name: "_acme-challenge",
+		Name: d.challengeRecordName(true),
 	}
 	// ignore the error of DeleteRecords because the record may not exist
 	dp.DeleteRecords(d.ctx, d.Zone(), []libdns.Record{record})
@@ -225,7 +277,7 @@ func newCSR(id acme.AuthzID) ([]byte, crypto.Signer, error) {
 }
 
 func (d *Domain) fulfill(acm *AutoCertManager, u string) error {
-	client := acm.client
+	client := d.acmeClient(acm)
 
 	z, err := client.GetAuthorization(d.ctx, u)
 	if err != nil {
@@ -246,21 +298,30 @@ func (d *Domain) fulfill(acm *AutoCertManager, u string) error {
 
 	fulfilled := 0
 	for _, chal := range z.Challenges {
+		var err error
 		switch chal.Type {
-		case "http-01":
-			if acm.spec.EnableHTTP01 && d.runHTTP01(acm, chal) == nil {
-				fulfilled++
+		case challengeHTTP01:
+			if !d.challengeAllowed(acm, chal.Type) {
+				continue
 			}
-		case "dns-01":
-			if acm.spec.EnableDNS01 && d.runDNS01(acm, chal) == nil {
-				fulfilled++
+			err = d.runHTTP01(acm, chal)
+		case challengeDNS01:
+			if !d.challengeAllowed(acm, chal.Type) {
+				continue
 			}
-		case "tls-alpn-01":
-			if acm.spec.EnableTLSALPN01 && d.runTLSALPN01(acm, z, chal) == nil {
-				fulfilled++
+			err = d.runDNS01(acm, chal)
+		case challengeTLSALPN01:
+			if !d.challengeAllowed(acm, chal.Type) {
+				continue
 			}
+			err = d.runTLSALPN01(acm, z, chal)
 		default:
 			logger.Errorf("unknown challenge type %q", chal.Type)
+			continue
+		}
+		if err == nil {
+			fulfilled++
+			d.fulfilled = append(d.fulfilled, chal.Type)
 		}
 	}
 	if fulfilled == 0 {
@@ -280,6 +341,7 @@ func (d *Domain) fulfill(acm *AutoCertManager, u string) error {
 func (d *Domain) renewCert(acm *AutoCertManager) error {
 	ctx, cancel := context.WithTimeout(acm.stopCtx, 10*time.Minute)
 	d.ctx = ctx
+	d.fulfilled = nil
 
 	defer func() {
 		cleanups := d.cleanups
@@ -292,7 +354,7 @@ func (d *Domain) renewCert(acm *AutoCertManager) error {
 		cancel()
 	}()
 
-	client := acm.client
+	client := d.acmeClient(acm)
 	ids := acme.DomainIDs(d.nameInPunyCode)
 	order, err := client.AuthorizeOrder(ctx, ids)
 	if err != nil {
@@ -0,0 +1,234 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package autocertmanager
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	godaddyBaseURL = "https://api.godaddy.com"
+	// GoDaddy rejects records with a TTL less than 600 seconds.
+	godaddyMinTTL = 600
+)
+
+// godaddyProvider manages DNS records with the GoDaddy domains API, there's
+// no libdns package for GoDaddy compatible with our dependencies, so we
+// implement it here.
+type godaddyProvider struct {
+	apiKey    string
+	apiSecret string
+	baseURL   string
+	client    *http.Client
+}
+
+type godaddyRecord struct {
+	Type string `json:"type,omitempty"`
+	Name string `json:"name,omitempty"`
+	Data string `json:"data"`
+	TTL  int    `json:"ttl,omitempty"`
+}
+
+var _ dnsProvider = (*godaddyProvider)(nil)
+
+func newGodaddyProvider(apiKey, apiSecret string) *godaddyProvider {
+	return &godaddyProvider{
+		apiKey:    apiKey,
+		apiSecret: apiSecret,
+		baseURL:   godaddyBaseURL,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (p *godaddyProvider) do(ctx context.Context, method, path string, body interface{}, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := codectool.MarshalJSON(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("sso-key %s:%s", p.apiKey, p.apiSecret))
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s %s: status code %d: %s", method, path, resp.StatusCode, data)
+	}
+	if result != nil {
+		return codectool.DecodeJSON(resp.Body, result)
+	}
+	return nil
+}
+
+func godaddyZone(zone string) string {
+	return url.PathEscape(strings.TrimSuffix(zone, "."))
+}
+
+func godaddyRecordsPath(zone, typ, name string) string {
+	return fmt.Sprintf("/v1/domains/%s/records/%s/%s", godaddyZone(zone), url.PathEscape(typ), url.PathEscape(name))
+}
+
+func godaddyTTL(ttl time.Duration) int {
+	if s := int(ttl / time.Second); s > godaddyMinTTL {
+		return s
+	}
+	return godaddyMinTTL
+}
+
+func (r *godaddyRecord) toLibdns() libdns.Record {
+	return libdns.Record{
+		Type:  r.Type,
+		Name:  r.Name,
+		Value: r.Data,
+		TTL:   time.Duration(r.TTL) * time.Second,
+	}
+}
+
+// GetRecords implements libdns.RecordGetter.
+func (p *godaddyProvider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	var records []*godaddyRecord
+	path := fmt.Sprintf("/v1/domains/%s/records", godaddyZone(zone))
+	if err := p.do(ctx, http.MethodGet, path, nil, &records); err != nil {
+		return nil, err
+	}
+
+	result := make([]libdns.Record, 0, len(records))
+	for _, r := range records {
+		result = append(result, r.toLibdns())
+	}
+	return result, nil
+}
+
+// AppendRecords implements libdns.RecordAppender.
+func (p *godaddyProvider) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	body := make([]*godaddyRecord, 0, len(records))
+	for _, r := range records {
+		body = append(body, &godaddyRecord{Type: r.Type, Name: r.Name, Data: r.Value, TTL: godaddyTTL(r.TTL)})
+	}
+
+	path := fmt.Sprintf("/v1/domains/%s/records", godaddyZone(zone))
+	if err := p.do(ctx, http.MethodPatch, path, body, nil); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// groupRecords groups records by type and name, as the GoDaddy API operates
+// on all records of the same type and name.
+func groupRecords(records []libdns.Record) (keys [][2]string, groups map[[2]string][]libdns.Record) {
+	groups = map[[2]string][]libdns.Record{}
+	for _, r := range records {
+		key := [2]string{r.Type, r.Name}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], r)
+	}
+	return keys, groups
+}
+
+// SetRecords implements libdns.RecordSetter, existing records of the same
+// type and name are replaced.
+func (p *godaddyProvider) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	keys, groups := groupRecords(records)
+	for _, key := range keys {
+		body := []*godaddyRecord{}
+		for _, r := range groups[key] {
+			body = append(body, &godaddyRecord{Data: r.Value, TTL: godaddyTTL(r.TTL)})
+		}
+		if err := p.do(ctx, http.MethodPut, godaddyRecordsPath(zone, key[0], key[1]), body, nil); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// DeleteRecords implements libdns.RecordDeleter, a record without value
+// deletes all records of the same type and name.
+func (p *godaddyProvider) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	var deleted []libdns.Record
+
+	keys, groups := groupRecords(records)
+	for _, key := range keys {
+		path := godaddyRecordsPath(zone, key[0], key[1])
+
+		var existing []*godaddyRecord
+		if err := p.do(ctx, http.MethodGet, path, nil, &existing); err != nil {
+			return deleted, err
+		}
+
+		var keep []*godaddyRecord
+		for _, e := range existing {
+			match := false
+			for _, r := range groups[key] {
+				if r.Value == "" || r.Value == e.Data {
+					match = true
+					break
+				}
+			}
+			if match {
+				e.Type, e.Name = key[0], key[1]
+				deleted = append(deleted, e.toLibdns())
+			} else {
+				keep = append(keep, &godaddyRecord{Data: e.Data, TTL: e.TTL})
+			}
+		}
+
+		if len(keep) == len(existing) {
+			continue
+		}
+
+		var err error
+		if len(keep) == 0 {
+			err = p.do(ctx, http.MethodDelete, path, nil, nil)
+		} else {
+			err = p.do(ctx, http.MethodPut, path, keep, nil)
+		}
+		if err != nil {
+			return deleted, err
+		}
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package autocertmanager
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// godaddyStub is a minimal in memory implementation of the GoDaddy API.
+type godaddyStub struct {
+	lock    sync.Mutex
+	records []*godaddyRecord
+}
+
+func (s *godaddyStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if r.Header.Get("Authorization") != "sso-key key:secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/domains/megaease.com/records"), "/")
+	if len(parts) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			w.Write(codectool.MustMarshalJSON(s.records))
+		case http.MethodPatch:
+			var records []*godaddyRecord
+			codectool.DecodeJSON(r.Body, &records)
+			s.records = append(s.records, records...)
+		}
+		return
+	}
+
+	typ, name := parts[1], parts[2]
+	var match, others []*godaddyRecord
+	for _, rec := range s.records {
+		if rec.Type == typ && rec.Name == name {
+			match = append(match, rec)
+		} else {
+			others = append(others, rec)
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Write(codectool.MustMarshalJSON(match))
+	case http.MethodPut:
+		var records []*godaddyRecord
+		codectool.DecodeJSON(r.Body, &records)
+		for _, rec := range records {
+			rec.Type, rec.Name = typ, name
+		}
+		s.records = append(others, records...)
+	case http.MethodDelete:
+		if len(match) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		s.records = others
+	}
+}
+
+func TestGodaddyProvider(t *testing.T) {
+	stub := &godaddyStub{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	p := newGodaddyProvider("key", "secret")
+	p.baseURL = server.URL
+	ctx := context.Background()
+
+	records := []libdns.Record{
+		{Type: "TXT", Name: "_acme-challenge", Value: "v1"},
+		{Type: "TXT", Name: "_acme-challenge", Value: "v2", TTL: time.Hour},
+		{Type: "TXT", Name: "_acme-challenge.www", Value: "v3"},
+	}
+	if _, err := p.AppendRecords(ctx, "megaease.com.", records); err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+
+	got, err := p.GetRecords(ctx, "megaease.com")
+	if err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("there should be 3 records, but got %d", len(got))
+	}
+	if got[0].TTL != godaddyMinTTL*time.Second || got[1].TTL != time.Hour {
+		t.Errorf("bad TTLs: %v, %v", got[0].TTL, got[1].TTL)
+	}
+
+	// delete one of the records with the same name.
+	deleted, err := p.DeleteRecords(ctx, "megaease.com", []libdns.Record{{Type: "TXT", Name: "_acme-challenge", Value: "v1"}})
+	if err != nil || len(deleted) != 1 || deleted[0].Value != "v1" {
+		t.Errorf("DeleteRecords should delete v1: %v, %v", deleted, err)
+	}
+	if got, _ = p.GetRecords(ctx, "megaease.com"); len(got) != 2 {
+		t.Errorf("there should be 2 records, but got %d", len(got))
+	}
+
+	// replace the records of a name.
+	if _, err = p.SetRecords(ctx, "megaease.com", []libdns.Record{{Type: "TXT", Name: "_acme-challenge.www", Value: "v4"}}); err != nil {
+		t.Errorf("SetRecords failed: %v", err)
+	}
+	got, _ = p.GetRecords(ctx, "megaease.com")
+	values := []string{}
+	for _, r := range got {
+		values = append(values, r.Value)
+	}
+	if strings.Join(values, ",") != "v2,v4" {
+		t.Errorf("records should be v2 and v4, but got %v", values)
+	}
+
+	// delete all records of the names, missing records are ignored.
+	deleted, err = p.DeleteRecords(ctx, "megaease.com", []libdns.Record{
+		{Type: "TXT", Name: "_acme-challenge"},
+		{Type: "TXT", Name: "_acme-challenge.www"},
+		{Type: "TXT", Name: "_acme-challenge.api"},
+	})
+	if err != nil || len(deleted) != 2 {
+		t.Errorf("DeleteRecords should delete 2 records: %v, %v", deleted, err)
+	}
+	if got, _ = p.GetRecords(ctx, "megaease.com"); len(got) != 0 {
+		t.Errorf("there should be no records, but got %d", len(got))
+	}
+
+	p.apiSecret = "wrong"
+	if _, err = p.GetRecords(ctx, "megaease.com"); err == nil {
+		t.Errorf("GetRecords should fail")
+	}
+}
@@ -0,0 +1,394 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package canary
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Category is the category of Canary.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of Canary.
+	Kind = "Canary"
+
+	// StateRamping means the weight is being ramped up by steps.
+	StateRamping = "ramping"
+	// StatePaused means the ramp-up is paused.
+	StatePaused = "paused"
+	// StateHolding means the weight doesn't change anymore.
+	StateHolding = "holding"
+	// StateRolledBack means all traffic goes to the stable pipeline.
+	StateRolledBack = "rolledBack"
+
+	tagStable = "stable"
+	tagCanary = "canary"
+
+	// weights are saved in basis points.
+	fullWeight   = 10000
+	tickInterval = time.Second
+)
+
+func init() {
+	supervisor.Register(&Canary{})
+}
+
+type (
+	// Canary splits the traffic of an HTTPServer path between the stable
+	// and the canary pipeline, it is used as the backend of the path.
+	Canary struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		// weight and rolledBack are read by every request.
+		weight     int64
+		rolledBack int32
+
+		mu        sync.Mutex
+		state     string
+		reason    string
+		step      int
+		stepEnd   time.Time
+		remaining time.Duration
+
+		windowEnd      time.Time
+		windowRequests uint64
+		windowErrors   uint64
+
+		stable TargetStatus
+		canary TargetStatus
+
+		done chan struct{}
+	}
+
+	// Status is the status of Canary.
+	Status struct {
+		State      string        `json:"state"`
+		Reason     string        `json:"reason,omitempty"`
+		Weight     float64       `json:"weight"`
+		Step       int           `json:"step,omitempty"`
+		NextStepAt string        `json:"nextStepAt,omitempty"`
+		Stable     *TargetStatus `json:"stable"`
+		Canary     *TargetStatus `json:"canary"`
+	}
+
+	// TargetStatus is the status of a pipeline of the Canary.
+	TargetStatus struct {
+		Pipeline string `json:"pipeline"`
+		Requests uint64 `json:"requests"`
+		Errors   uint64 `json:"errors"`
+	}
+)
+
+// Category returns the category of Canary.
+func (c *Canary) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of Canary.
+func (c *Canary) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of Canary.
+func (c *Canary) DefaultSpec() interface{} {
+	return &Spec{Sticky: StickyRandom}
+}
+
+// Init initializes Canary.
+func (c *Canary) Init(superSpec *supervisor.Spec) {
+	c.superSpec, c.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	c.reload(time.Now())
+	go c.run()
+}
+
+// Inherit inherits previous generation of Canary.
+func (c *Canary) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	previousGeneration.Close()
+	c.Init(superSpec)
+}
+
+func (c *Canary) reload(now time.Time) {
+	for _, r := range c.spec.Rules {
+		r.init()
+	}
+	c.stable.Pipeline = c.spec.Stable
+	c.canary.Pipeline = c.spec.Canary
+	c.done = make(chan struct{})
+
+	if len(c.spec.Steps) > 0 {
+		c.enterStep(0, now)
+	} else {
+		c.setWeight(c.spec.Weight)
+		c.state = StateHolding
+	}
+	if c.spec.Rollback != nil {
+		c.windowEnd = now.Add(c.spec.Rollback.window())
+	}
+}
+
+func (c *Canary) run() {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case now := <-ticker.C:
+			c.tick(now)
+		}
+	}
+}
+
+// tick moves to the next step if the current step is finished, and starts
+// a new window of error rate.
+func (c *Canary) tick(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state == StateRamping && !now.Before(c.stepEnd) {
+		if c.step+1 < len(c.spec.Steps) {
+			c.enterStep(c.step+1, now)
+		} else {
+			c.state = StateHolding
+			c.stepEnd = time.Time{}
+		}
+	}
+
+	if c.spec.Rollback != nil && !now.Before(c.windowEnd) {
+		c.windowRequests, c.windowErrors = 0, 0
+		c.windowEnd = now.Add(c.spec.Rollback.window())
+	}
+}
+
+func (c *Canary) enterStep(i int, now time.Time) {
+	step := c.spec.Steps[i]
+	c.step = i
+	c.setWeight(step.Weight)
+	if d := step.duration(); d > 0 {
+		c.state = StateRamping
+		c.stepEnd = now.Add(d)
+	} else {
+		c.state = StateHolding
+		c.stepEnd = time.Time{}
+	}
+	logger.Infof("%s: step %d, canary weight %.2f%%", c.superSpec.Name(), i+1, step.Weight)
+}
+
+func (c *Canary) setWeight(weight float64) {
+	atomic.StoreInt64(&c.weight, int64(weight*fullWeight/100))
+}
+
+func (c *Canary) getWeight() float64 {
+	return float64(atomic.LoadInt64(&c.weight)) * 100 / fullWeight
+}
+
+// Route chooses the pipeline for the request, and tags the request if
+// tagHeader is specified.
+func (c *Canary) Route(req *httpprot.Request) string {
+	target, tag := c.spec.Stable, tagStable
+	if c.toCanary(req) {
+		target, tag = c.spec.Canary, tagCanary
+	}
+	if c.spec.TagHeader != "" {
+		req.Header().Set(c.spec.TagHeader, tag)
+	}
+	return target
+}
+
+func (c *Canary) toCanary(req *httpprot.Request) bool {
+	if atomic.LoadInt32(&c.rolledBack) == 1 {
+		return false
+	}
+
+	for _, r := range c.spec.Rules {
+		var value string
+		if r.Header != "" {
+			value = req.HTTPHeader().Get(r.Header)
+		} else if cookie, err := req.Cookie(r.Cookie); err == nil {
+			value = cookie.Value
+		}
+		if r.match(value) {
+			return true
+		}
+	}
+
+	weight := atomic.LoadInt64(&c.weight)
+	if weight <= 0 {
+		return false
+	}
+	if weight >= fullWeight {
+		return true
+	}
+	return c.bucket(req) < weight
+}
+
+// bucket returns the bucket of the request in [0, fullWeight), requests
+// without the sticky key are put into random buckets.
+func (c *Canary) bucket(req *httpprot.Request) int64 {
+	var key string
+	switch c.spec.Sticky {
+	case StickyIP:
+		key = req.RealIP()
+	case StickyHeader:
+		key = req.HTTPHeader().Get(c.spec.StickyKey)
+	case StickyCookie:
+		if cookie, err := req.Cookie(c.spec.StickyKey); err == nil {
+			key = cookie.Value
+		}
+	}
+	if key == "" {
+		return rand.Int63n(fullWeight)
+	}
+
+	hash := fnv.New32()
+	hash.Write([]byte(key))
+	return int64(hash.Sum32() % fullWeight)
+}
+
+// Observe records the response status code of the pipeline, and rolls
+// back the canary if its error rate exceeds the limit.
+func (c *Canary) Observe(pipeline string, statusCode int) {
+	failed := statusCode >= 500
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	target := &c.stable
+	if pipeline == c.spec.Canary {
+		target = &c.canary
+	}
+	target.Requests++
+	if failed {
+		target.Errors++
+	}
+
+	if target != &c.canary || c.spec.Rollback == nil || c.state == StateRolledBack {
+		return
+	}
+
+	c.windowRequests++
+	if failed {
+		c.windowErrors++
+	}
+	if c.windowRequests < c.spec.Rollback.minRequests() {
+		return
+	}
+	rate := float64(c.windowErrors) * 100 / float64(c.windowRequests)
+	if rate > c.spec.Rollback.MaxErrorRate {
+		c.rollback(fmt.Sprintf("error rate %.2f%% exceeds %.2f%%", rate, c.spec.Rollback.MaxErrorRate))
+	}
+}
+
+func (c *Canary) rollback(reason string) {
+	atomic.StoreInt32(&c.rolledBack, 1)
+	c.setWeight(0)
+	c.state = StateRolledBack
+	c.reason = reason
+	c.stepEnd = time.Time{}
+	logger.Warnf("%s: canary %s rolled back: %s", c.superSpec.Name(), c.spec.Canary, reason)
+}
+
+// Pause pauses the ramp-up, the remaining duration of the current step is
+// kept for Resume.
+func (c *Canary) Pause(now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state != StateRamping {
+		return fmt.Errorf("can't pause in state %s", c.state)
+	}
+	c.remaining = c.stepEnd.Sub(now)
+	c.stepEnd = time.Time{}
+	c.state = StatePaused
+	return nil
+}
+
+// Resume resumes the paused ramp-up.
+func (c *Canary) Resume(now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state != StatePaused {
+		return fmt.Errorf("can't resume in state %s", c.state)
+	}
+	c.stepEnd = now.Add(c.remaining)
+	c.state = StateRamping
+	return nil
+}
+
+// Promote sends all traffic to the canary pipeline.
+func (c *Canary) Promote() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	atomic.StoreInt32(&c.rolledBack, 0)
+	c.setWeight(100)
+	c.state = StateHolding
+	c.reason = ""
+	c.stepEnd = time.Time{}
+	logger.Infof("%s: canary %s promoted", c.superSpec.Name(), c.spec.Canary)
+}
+
+// Rollback sends all traffic back to the stable pipeline.
+func (c *Canary) Rollback() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rollback("manual rollback")
+}
+
+func (c *Canary) status() *Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := &Status{
+		State:  c.state,
+		Reason: c.reason,
+		Weight: c.getWeight(),
+		Stable: &TargetStatus{},
+		Canary: &TargetStatus{},
+	}
+	if len(c.spec.Steps) > 0 {
+		s.Step = c.step + 1
+	}
+	if !c.stepEnd.IsZero() {
+		s.NextStepAt = c.stepEnd.Format(time.RFC3339)
+	}
+	*s.Stable, *s.Canary = c.stable, c.canary
+	return s
+}
+
+// Status returns the status of Canary.
+func (c *Canary) Status() *supervisor.Status {
+	return &supervisor.Status{ObjectStatus: c.status()}
+}
+
+// Close closes Canary.
+func (c *Canary) Close() {
+	close(c.done)
+}
@@ -0,0 +1,250 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package canary
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newTestCanary(t *testing.T, yamlConfig string, now time.Time) *Canary {
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.Nil(t, err)
+	c := &Canary{superSpec: superSpec, spec: superSpec.ObjectSpec().(*Spec)}
+	c.reload(now)
+	return c
+}
+
+func newRequest(header, cookie string) *httpprot.Request {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	if header != "" {
+		stdr.Header.Set("X-User", header)
+	}
+	if cookie != "" {
+		stdr.AddCookie(&http.Cookie{Name: "group", Value: cookie})
+	}
+	req, _ := httpprot.NewRequest(stdr)
+	return req
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, yamlConfig := range []string{`
+kind: Canary
+name: canary
+stable: p1
+canary: p1
+`, `
+kind: Canary
+name: canary
+stable: p1
+canary: p2
+steps:
+- weight: 1
+- weight: 5
+  duration: 1h
+`, `
+kind: Canary
+name: canary
+stable: p1
+canary: p2
+sticky: header
+`, `
+kind: Canary
+name: canary
+stable: p1
+canary: p2
+rules:
+- header: X-User
+  cookie: group
+  values: ["a"]
+`} {
+		_, err := supervisor.NewSpec(yamlConfig)
+		assert.NotNil(err)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newTestCanary(t, `
+kind: Canary
+name: canary
+stable: p1
+canary: p2
+weight: 30
+sticky: header
+stickyKey: X-User
+tagHeader: X-Canary
+rules:
+- header: X-User
+  values: ["tester"]
+- cookie: group
+  regexp: "^beta"
+`, time.Now())
+
+	req := newRequest("tester", "")
+	assert.Equal("p2", c.Route(req))
+	assert.Equal("canary", req.HTTPHeader().Get("X-Canary"))
+	assert.Equal("p2", c.Route(newRequest("", "beta-1")))
+
+	// sticky by header
+	toCanary := 0
+	for i := 0; i < 1000; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		target := c.Route(newRequest(user, ""))
+		assert.Equal(target, c.Route(newRequest(user, "")))
+		if target == "p2" {
+			toCanary++
+		}
+	}
+	assert.InDelta(300, toCanary, 60)
+
+	req = newRequest("", "")
+	c.setWeight(0)
+	assert.Equal("p1", c.Route(req))
+	assert.Equal("stable", req.HTTPHeader().Get("X-Canary"))
+	c.setWeight(100)
+	assert.Equal("p2", c.Route(req))
+
+	// no traffic to the canary after rolled back, even matching rules.
+	c.Rollback()
+	assert.Equal("p1", c.Route(newRequest("tester", "")))
+	assert.Equal("p1", c.Route(req))
+	c.Promote()
+	assert.Equal("p2", c.Route(req))
+}
+
+func TestRamp(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	c := newTestCanary(t, `
+kind: Canary
+name: canary
+stable: p1
+canary: p2
+steps:
+- weight: 1
+  duration: 1h
+- weight: 5
+  duration: 1h
+- weight: 25
+  duration: 2h
+`, now)
+
+	s := c.status()
+	assert.Equal(StateRamping, s.State)
+	assert.Equal(1, s.Step)
+	assert.Equal(1.0, s.Weight)
+
+	c.tick(now.Add(30 * time.Minute))
+	assert.Equal(1.0, c.status().Weight)
+
+	now = now.Add(time.Hour)
+	c.tick(now)
+	assert.Equal(5.0, c.status().Weight)
+
+	// pause for 3 hours, and the step keeps its remaining time.
+	assert.Nil(c.Pause(now.Add(10 * time.Minute)))
+	assert.NotNil(c.Pause(now))
+	c.tick(now.Add(2 * time.Hour))
+	assert.Equal(StatePaused, c.status().State)
+	assert.Equal(5.0, c.status().Weight)
+	now = now.Add(3 * time.Hour)
+	assert.Nil(c.Resume(now))
+	c.tick(now.Add(49 * time.Minute))
+	assert.Equal(5.0, c.status().Weight)
+	now = now.Add(50 * time.Minute)
+	c.tick(now)
+	s = c.status()
+	assert.Equal(3, s.Step)
+	assert.Equal(25.0, s.Weight)
+
+	c.tick(now.Add(2 * time.Hour))
+	s = c.status()
+	assert.Equal(StateHolding, s.State)
+	assert.Equal(25.0, s.Weight)
+	assert.Equal("", s.NextStepAt)
+	assert.NotNil(c.Resume(now))
+}
+
+func TestRollback(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	c := newTestCanary(t, `
+kind: Canary
+name: canary
+stable: p1
+canary: p2
+weight: 50
+rollback:
+  maxErrorRate: 10
+  window: 1m
+  minRequests: 20
+`, now)
+
+	// errors of the stable pipeline don't matter.
+	for i := 0; i < 100; i++ {
+		c.Observe("p1", http.StatusInternalServerError)
+	}
+	// the error rate is too high, but the requests are not enough.
+	for i := 0; i < 10; i++ {
+		c.Observe("p2", http.StatusBadGateway)
+	}
+	assert.Equal(StateHolding, c.status().State)
+
+	// a new window starts.
+	c.tick(now.Add(time.Minute))
+	for i := 0; i < 100; i++ {
+		if i%20 == 0 {
+			c.Observe("p2", http.StatusInternalServerError)
+		} else {
+			c.Observe("p2", http.StatusOK)
+		}
+	}
+	assert.Equal(StateHolding, c.status().State)
+
+	for i := 0; i < 10; i++ {
+		c.Observe("p2", http.StatusServiceUnavailable)
+	}
+	s := c.status()
+	assert.Equal(StateRolledBack, s.State)
+	assert.Equal(0.0, s.Weight)
+	assert.NotEmpty(s.Reason)
+	assert.Equal(uint64(100), s.Stable.Requests)
+	assert.Equal(uint64(120), s.Canary.Requests)
+	assert.Equal(uint64(25), s.Canary.Errors)
+	assert.Equal("p2", s.Canary.Pipeline)
+}
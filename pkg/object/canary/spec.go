@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package canary
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+const (
+	// StickyRandom splits the traffic randomly.
+	StickyRandom = "random"
+	// StickyIP splits the traffic by the hash of the client IP.
+	StickyIP = "ip"
+	// StickyHeader splits the traffic by the hash of a header.
+	StickyHeader = "header"
+	// StickyCookie splits the traffic by the hash of a cookie.
+	StickyCookie = "cookie"
+
+	defaultWindow      = time.Minute
+	defaultMinRequests = 100
+)
+
+type (
+	// Spec describes the Canary.
+	Spec struct {
+		Stable string `json:"stable" jsonschema:"required"`
+		Canary string `json:"canary" jsonschema:"required"`
+
+		// Weight is the percentage of traffic to the canary pipeline, it
+		// is ignored if steps are specified.
+		Weight    float64 `json:"weight" jsonschema:"omitempty,minimum=0,maximum=100"`
+		Steps     []*Step `json:"steps,omitempty" jsonschema:"omitempty"`
+		Rules     []*Rule `json:"rules,omitempty" jsonschema:"omitempty"`
+		Sticky    string  `json:"sticky" jsonschema:"omitempty,enum=,enum=random,enum=ip,enum=header,enum=cookie"`
+		StickyKey string  `json:"stickyKey" jsonschema:"omitempty"`
+		TagHeader string  `json:"tagHeader" jsonschema:"omitempty"`
+
+		Rollback *RollbackSpec `json:"rollback,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Step is a step of the ramp-up, the weight is applied after the
+	// previous step finished, and lasts for the duration.
+	Step struct {
+		Weight   float64 `json:"weight" jsonschema:"minimum=0,maximum=100"`
+		Duration string  `json:"duration" jsonschema:"omitempty,format=duration"`
+	}
+
+	// Rule routes the matched requests to the canary pipeline regardless
+	// of the weight. There must be exactly one of header and cookie, and
+	// at least one of values and regexp.
+	Rule struct {
+		Header string   `json:"header,omitempty" jsonschema:"omitempty"`
+		Cookie string   `json:"cookie,omitempty" jsonschema:"omitempty"`
+		Values []string `json:"values,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+		Regexp string   `json:"regexp,omitempty" jsonschema:"omitempty,format=regexp"`
+
+		re *regexp.Regexp
+	}
+
+	// RollbackSpec describes when to roll back the canary automatically.
+	RollbackSpec struct {
+		// MaxErrorRate is the max percentage of 5xx responses of the
+		// canary pipeline in a window.
+		MaxErrorRate float64 `json:"maxErrorRate" jsonschema:"required,minimum=0,maximum=100"`
+		Window       string  `json:"window" jsonschema:"omitempty,format=duration"`
+		MinRequests  uint32  `json:"minRequests" jsonschema:"omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	if spec.Stable == spec.Canary {
+		return fmt.Errorf("stable and canary are the same pipeline %s", spec.Stable)
+	}
+
+	for i, s := range spec.Steps {
+		if s.Duration == "" && i != len(spec.Steps)-1 {
+			return fmt.Errorf("duration of step %d is empty, only the last step could be endless", i+1)
+		}
+	}
+
+	switch spec.Sticky {
+	case StickyHeader, StickyCookie:
+		if spec.StickyKey == "" {
+			return fmt.Errorf("stickyKey is required when sticky is %s", spec.Sticky)
+		}
+	}
+
+	return nil
+}
+
+// Dependencies returns the stable and the canary pipelines.
+func (spec *Spec) Dependencies() []string {
+	return []string{spec.Stable, spec.Canary}
+}
+
+// Validate validates Rule.
+func (r *Rule) Validate() error {
+	if (r.Header == "") == (r.Cookie == "") {
+		return fmt.Errorf("there must be exactly one of header and cookie")
+	}
+	if len(r.Values) == 0 && r.Regexp == "" {
+		return fmt.Errorf("both values and regexp are empty")
+	}
+	return nil
+}
+
+func (r *Rule) init() {
+	if r.Regexp != "" {
+		r.re = regexp.MustCompile(r.Regexp)
+	}
+}
+
+func (r *Rule) match(value string) bool {
+	for _, v := range r.Values {
+		if v == value {
+			return true
+		}
+	}
+	return r.re != nil && r.re.MatchString(value)
+}
+
+func (s *Step) duration() time.Duration {
+	d, _ := time.ParseDuration(s.Duration)
+	return d
+}
+
+func (r *RollbackSpec) window() time.Duration {
+	if r.Window == "" {
+		return defaultWindow
+	}
+	d, _ := time.ParseDuration(r.Window)
+	return d
+}
+
+func (r *RollbackSpec) minRequests() uint64 {
+	if r.MinRequests == 0 {
+		return defaultMinRequests
+	}
+	return uint64(r.MinRequests)
+}
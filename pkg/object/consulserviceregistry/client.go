@@ -30,6 +30,12 @@ type (
 		ServiceDeregister(instanceID string) error
 		ListServiceInstances(serviceName string) ([]*api.CatalogService, error)
 		ListAllServiceInstances() ([]*api.CatalogService, error)
+
+		// ListConnectServiceInstances lists the Connect-capable endpoints of
+		// the service, they are the sidecar proxies or the native services.
+		ListConnectServiceInstances(serviceName string) ([]*api.CatalogService, error)
+		ConnectCARoots() (*api.CARootList, error)
+		ConnectCALeaf(serviceName string) (*api.LeafCert, error)
 	}
 
 	consulAPIClient struct {
@@ -79,3 +85,27 @@ func (c *consulAPIClient) ListAllServiceInstances() ([]*api.CatalogService, erro
 
 	return catalogServices, nil
 }
+
+func (c *consulAPIClient) ListConnectServiceInstances(serviceName string) ([]*api.CatalogService, error) {
+	resp, _, err := c.client.Catalog().Connect(serviceName, "", &api.QueryOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("pull connect service %s failed: %v", serviceName, err)
+	}
+	return resp, nil
+}
+
+func (c *consulAPIClient) ConnectCARoots() (*api.CARootList, error) {
+	resp, _, err := c.client.Agent().ConnectCARoots(&api.QueryOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("pull connect CA roots failed: %v", err)
+	}
+	return resp, nil
+}
+
+func (c *consulAPIClient) ConnectCALeaf(serviceName string) (*api.LeafCert, error) {
+	resp, _, err := c.client.Agent().ConnectCALeaf(serviceName, &api.QueryOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("pull connect leaf certificate of %s failed: %v", serviceName, err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package consulserviceregistry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+type (
+	// ConnectSpec is the spec of Consul Connect, with which Easegress acts
+	// as an ingress into the mesh.
+	ConnectSpec struct {
+		// ServiceName is the identity of Easegress in the mesh, the
+		// intentions of Consul authorize the connections by it.
+		ServiceName string `json:"serviceName" jsonschema:"required"`
+	}
+
+	// connectCerts are the leaf certificate of Easegress and the CAs of
+	// the mesh.
+	connectCerts struct {
+		serial        string
+		cert          *tls.Certificate
+		roots         *x509.CertPool
+		intermediates []*x509.Certificate
+		trustDomain   string
+		expireAt      time.Time
+	}
+)
+
+// isSidecarProxy returns whether the catalog service is a sidecar proxy,
+// which is listed as an endpoint of its destination service.
+func isSidecarProxy(catalogService *api.CatalogService) bool {
+	return catalogService.ServiceProxy != nil && catalogService.ServiceProxy.DestinationServiceName != ""
+}
+
+func (c *ConsulServiceRegistry) updateConnectCerts(client consulClient) error {
+	roots, err := client.ConnectCARoots()
+	if err != nil {
+		return err
+	}
+
+	leaf, err := client.ConnectCALeaf(c.spec.Connect.ServiceName)
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.X509KeyPair([]byte(leaf.CertPEM), []byte(leaf.PrivateKeyPEM))
+	if err != nil {
+		return fmt.Errorf("invalid connect leaf certificate: %v", err)
+	}
+
+	certs := &connectCerts{
+		serial:      leaf.SerialNumber,
+		cert:        &cert,
+		roots:       x509.NewCertPool(),
+		trustDomain: roots.TrustDomain,
+		expireAt:    leaf.ValidBefore,
+	}
+	for _, root := range roots.Roots {
+		if !certs.roots.AppendCertsFromPEM([]byte(root.RootCertPEM)) {
+			return fmt.Errorf("invalid connect CA root %s", root.ID)
+		}
+		for _, data := range root.IntermediateCerts {
+			if block, _ := pem.Decode([]byte(data)); block != nil {
+				if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+					certs.intermediates = append(certs.intermediates, cert)
+				}
+			}
+		}
+	}
+
+	if old := c.getConnectCerts(); old == nil || old.serial != certs.serial {
+		logger.Infof("%s got connect leaf certificate of %s, expires at %v",
+			c.Name(), c.spec.Connect.ServiceName, certs.expireAt)
+	}
+	c.connectCerts.Store(certs)
+
+	return nil
+}
+
+func (c *ConsulServiceRegistry) getConnectCerts() *connectCerts {
+	certs, _ := c.connectCerts.Load().(*connectCerts)
+	return certs
+}
+
+// TLSEnabled returns whether the service instances of Connect-enabled
+// services are accessed by mTLS.
+func (c *ConsulServiceRegistry) TLSEnabled() bool {
+	return c.spec.Connect != nil
+}
+
+// ClientCertificate returns the connect leaf certificate of Easegress.
+func (c *ConsulServiceRegistry) ClientCertificate() (*tls.Certificate, error) {
+	certs := c.getConnectCerts()
+	if certs == nil {
+		return nil, fmt.Errorf("%s: connect certificates are not ready", c.Name())
+	}
+	return certs.cert, nil
+}
+
+// VerifyServiceCertificate verifies the certificate chain presented by an
+// instance of a Connect-enabled service, it must be issued by the CAs of
+// the mesh to the service.
+func (c *ConsulServiceRegistry) VerifyServiceCertificate(serviceName string, rawCerts [][]byte) error {
+	certs := c.getConnectCerts()
+	if certs == nil {
+		return fmt.Errorf("%s: connect certificates are not ready", c.Name())
+	}
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("no peer certificate")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs.intermediates {
+		intermediates.AddCert(cert)
+	}
+	var leaf *x509.Certificate
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			leaf = cert
+		} else {
+			intermediates.AddCert(cert)
+		}
+	}
+
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         certs.roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("verify certificate of %s failed: %v", serviceName, err)
+	}
+
+	// the URI is like spiffe://<trust domain>/ns/default/dc/dc1/svc/web.
+	for _, uri := range leaf.URIs {
+		if isServiceURI(uri, certs.trustDomain, serviceName) {
+			return nil
+		}
+	}
+	return fmt.Errorf("certificate is not issued to service %s", serviceName)
+}
+
+func isServiceURI(uri *url.URL, trustDomain, serviceName string) bool {
+	return uri.Scheme == "spiffe" &&
+		strings.EqualFold(uri.Host, trustDomain) &&
+		strings.HasSuffix(uri.Path, "/svc/"+serviceName)
+}
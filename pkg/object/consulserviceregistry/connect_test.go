@@ -0,0 +1,248 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package consulserviceregistry
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const testTrustDomain = "11111111-2222-3333-4444-555555555555.consul"
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+type (
+	testCA struct {
+		cert    *x509.Certificate
+		key     *ecdsa.PrivateKey
+		certPEM string
+	}
+
+	mockConsulClient struct {
+		consulClient
+
+		roots     *api.CARootList
+		leaf      *api.LeafCert
+		instances map[string][]*api.CatalogService
+		connect   map[string][]*api.CatalogService
+	}
+)
+
+func (m *mockConsulClient) ConnectCARoots() (*api.CARootList, error) { return m.roots, nil }
+
+func (m *mockConsulClient) ConnectCALeaf(serviceName string) (*api.LeafCert, error) {
+	return m.leaf, nil
+}
+
+func (m *mockConsulClient) ListConnectServiceInstances(serviceName string) ([]*api.CatalogService, error) {
+	return m.connect[serviceName], nil
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Consul CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{
+		cert:    cert,
+		key:     key,
+		certPEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+	}
+}
+
+// issue issues a leaf certificate of the service, it returns the DER and
+// PEM of the certificate and the PEM of the private key.
+func (ca *testCA) issue(t *testing.T, serial int64, serviceName string) ([]byte, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, _ := url.Parse("spiffe://" + testTrustDomain + "/ns/default/dc/dc1/svc/" + serviceName)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: serviceName},
+		URIs:         []*url.URL{uri},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return der,
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func newTestRegistry(t *testing.T, yamlConfig string) *ConsulServiceRegistry {
+	spec, err := supervisor.NewSpec(yamlConfig)
+	if err != nil {
+		t.Fatalf("failed to create spec: %v", err)
+	}
+	return &ConsulServiceRegistry{superSpec: spec, spec: spec.ObjectSpec().(*Spec)}
+}
+
+func newTestConnectClient(t *testing.T, ca *testCA) *mockConsulClient {
+	_, certPEM, keyPEM := ca.issue(t, 2, "easegress")
+	return &mockConsulClient{
+		roots: &api.CARootList{
+			TrustDomain: testTrustDomain,
+			Roots:       []*api.CARoot{{ID: "root", RootCertPEM: ca.certPEM}},
+		},
+		leaf: &api.LeafCert{
+			SerialNumber:  "02",
+			CertPEM:       certPEM,
+			PrivateKeyPEM: keyPEM,
+			ValidBefore:   time.Now().Add(time.Hour),
+		},
+	}
+}
+
+func TestConnectCerts(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newTestRegistry(t, `
+kind: ConsulServiceRegistry
+name: consul
+connect:
+  serviceName: easegress
+`)
+	assert.True(c.TLSEnabled())
+
+	// certificates are not ready.
+	_, err := c.ClientCertificate()
+	assert.Error(err)
+	assert.Error(c.VerifyServiceCertificate("web", nil))
+
+	ca := newTestCA(t)
+	client := newTestConnectClient(t, ca)
+	assert.NoError(c.updateConnectCerts(client))
+
+	cert, err := c.ClientCertificate()
+	assert.NoError(err)
+	assert.NotNil(cert)
+
+	webDER, _, _ := ca.issue(t, 3, "web")
+	assert.NoError(c.VerifyServiceCertificate("web", [][]byte{webDER}))
+	// the certificate is issued to another service.
+	assert.Error(c.VerifyServiceCertificate("api", [][]byte{webDER}))
+	assert.Error(c.VerifyServiceCertificate("web", nil))
+
+	// the certificate is issued by another CA.
+	otherDER, _, _ := newTestCA(t).issue(t, 4, "web")
+	assert.Error(c.VerifyServiceCertificate("web", [][]byte{otherDER}))
+
+	// bad roots are rejected, and the previous certificates are kept.
+	client.roots.Roots[0].RootCertPEM = "invalid"
+	assert.Error(c.updateConnectCerts(client))
+	assert.NoError(c.VerifyServiceCertificate("web", [][]byte{webDER}))
+
+	c = newTestRegistry(t, "kind: ConsulServiceRegistry\nname: consul\n")
+	assert.False(c.TLSEnabled())
+}
+
+func TestIsServiceURI(t *testing.T) {
+	assert := assert.New(t)
+
+	uri, _ := url.Parse("spiffe://" + testTrustDomain + "/ns/default/dc/dc1/svc/web")
+	assert.True(isServiceURI(uri, testTrustDomain, "web"))
+	assert.False(isServiceURI(uri, testTrustDomain, "api"))
+	assert.False(isServiceURI(uri, "other.consul", "web"))
+
+	uri.Scheme = "https"
+	assert.False(isServiceURI(uri, testTrustDomain, "web"))
+}
+
+func TestConnectServiceInstances(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newTestRegistry(t, `
+kind: ConsulServiceRegistry
+name: consul
+connect:
+  serviceName: easegress
+`)
+
+	web := &api.CatalogService{ServiceName: "web", ServiceID: "web-1", Address: "10.0.0.1", ServicePort: 8080}
+	webProxy := &api.CatalogService{
+		ServiceName:  "web-sidecar-proxy",
+		ServiceID:    "web-1-proxy",
+		Address:      "10.0.0.1",
+		ServicePort:  21000,
+		ServiceProxy: &api.AgentServiceConnectProxyConfig{DestinationServiceName: "web"},
+	}
+	legacy := &api.CatalogService{ServiceName: "legacy", ServiceID: "legacy-1", Address: "10.0.0.2", ServicePort: 8080}
+
+	client := &mockConsulClient{connect: map[string][]*api.CatalogService{"web": {webProxy}}}
+	instances, err := c.catalogServicesToServiceInstances(client, []*api.CatalogService{web, webProxy, legacy})
+	assert.NoError(err)
+	assert.Len(instances, 2)
+
+	for _, instance := range instances {
+		switch instance.ServiceName {
+		case "web":
+			// the sidecar proxy replaces the service instance.
+			assert.Equal("https", instance.Scheme)
+			assert.Equal(uint16(21000), instance.Port)
+		case "legacy":
+			assert.NotEqual("https", instance.Scheme)
+			assert.Equal(uint16(8080), instance.Port)
+		default:
+			t.Errorf("unexpected service %s", instance.ServiceName)
+		}
+	}
+
+	assert.True(isSidecarProxy(webProxy))
+	assert.False(isSidecarProxy(web))
+}
@@ -20,6 +20,7 @@ package consulserviceregistry
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/consul/api"
@@ -40,6 +41,9 @@ const (
 	// NOTE: Namespace is only available for Consul Enterprise,
 	// instead we use this field to work around.
 	MetaKeyRegistryName = "RegistryName"
+
+	healthCheckTimeout             = "5s"
+	deregisterCriticalServiceAfter = "1m"
 )
 
 func init() {
@@ -62,6 +66,11 @@ type (
 
 		statusMutex  sync.Mutex
 		instancesNum map[string]int
+		connectError string
+
+		connectCerts atomic.Value // *connectCerts
+
+		registrar *serviceregistry.SelfRegistrar
 
 		done chan struct{}
 	}
@@ -75,12 +84,20 @@ type (
 		Namespace    string   `json:"namespace" jsonschema:"omitempty"`
 		SyncInterval string   `json:"syncInterval" jsonschema:"required,format=duration"`
 		ServiceTags  []string `json:"serviceTags" jsonschema:"omitempty"`
+
+		// Connect enables the mTLS to Connect-enabled services.
+		Connect *ConnectSpec `json:"connect,omitempty" jsonschema:"omitempty"`
+
+		SelfRegistration *serviceregistry.SelfRegistrationSpec `json:"selfRegistration,omitempty" jsonschema:"omitempty"`
 	}
 
 	// Status is the status of ConsulServiceRegistry.
 	Status struct {
 		Health              string         `json:"health"`
 		ServiceInstancesNum map[string]int `json:"instancesNum"`
+
+		ConnectCertExpireAt string `json:"connectCertExpireAt,omitempty"`
+		ConnectError        string `json:"connectError,omitempty"`
 	}
 )
 
@@ -129,6 +146,11 @@ func (c *ConsulServiceRegistry) reload() {
 		logger.Errorf("%s get consul client failed: %v", c.superSpec.Name(), err)
 	}
 
+	c.registrar = nil
+	if c.spec.SelfRegistration != nil {
+		c.registrar = serviceregistry.NewSelfRegistrar(c.spec.SelfRegistration, c, c.superSpec.Super().Options())
+	}
+
 	c.serviceRegistry.RegisterRegistry(c)
 
 	go c.run()
@@ -215,6 +237,14 @@ func (c *ConsulServiceRegistry) run() {
 }
 
 func (c *ConsulServiceRegistry) update() {
+	if c.spec.Connect != nil {
+		c.updateConnect()
+	}
+
+	if c.registrar != nil {
+		c.registrar.Sync()
+	}
+
 	instances, err := c.ListAllServiceInstances()
 	if err != nil {
 		logger.Errorf("list all service instances failed: %v", err)
@@ -250,6 +280,35 @@ func (c *ConsulServiceRegistry) update() {
 	c.statusMutex.Unlock()
 }
 
+func (c *ConsulServiceRegistry) updateConnect() {
+	client, err := c.getClient()
+	if err == nil {
+		err = c.updateConnectCerts(client)
+	}
+
+	errMsg := ""
+	if err != nil {
+		logger.Errorf("%s update connect certificates failed: %v", c.Name(), err)
+		errMsg = err.Error()
+	}
+
+	c.statusMutex.Lock()
+	c.connectError = errMsg
+	c.statusMutex.Unlock()
+}
+
+// Ready returns nil if the consul client is built, so the pipelines using
+// the registry are ready to serve.
+func (c *ConsulServiceRegistry) Ready() error {
+	c.clientMutex.RLock()
+	defer c.clientMutex.RUnlock()
+
+	if c.client == nil {
+		return fmt.Errorf("consul client is not built")
+	}
+	return nil
+}
+
 // Status returns status of ConsulServiceRegister.
 func (c *ConsulServiceRegistry) Status() *supervisor.Status {
 	s := &Status{}
@@ -263,9 +322,13 @@ func (c *ConsulServiceRegistry) Status() *supervisor.Status {
 
 	c.statusMutex.Lock()
 	serversNum := c.instancesNum
+	s.ConnectError = c.connectError
 	c.statusMutex.Unlock()
 
 	s.ServiceInstancesNum = serversNum
+	if certs := c.getConnectCerts(); certs != nil {
+		s.ConnectCertExpireAt = certs.expireAt.Format(time.RFC3339)
+	}
 
 	return &supervisor.Status{
 		ObjectStatus: s,
@@ -274,6 +337,10 @@ func (c *ConsulServiceRegistry) Status() *supervisor.Status {
 
 // Close closes ConsulServiceRegistry.
 func (c *ConsulServiceRegistry) Close() {
+	if c.registrar != nil {
+		c.registrar.Deregister()
+	}
+
 	c.serviceRegistry.DeregisterRegistry(c.Name())
 
 	if c.superSpec.Super().Cluster().IsLeader() {
@@ -389,18 +456,7 @@ func (c *ConsulServiceRegistry) ListServiceInstances(serviceName string) (map[st
 		return nil, err
 	}
 
-	instances := make(map[string]*serviceregistry.ServiceInstanceSpec)
-	for _, catalog := range catalogServices {
-		serviceInstance := c.catalogServiceToServiceInstance(catalog)
-		err := serviceInstance.Validate()
-		if err != nil {
-			return nil, fmt.Errorf("%+v is invalid: %v", serviceInstance, err)
-		}
-
-		instances[serviceInstance.Key()] = serviceInstance
-	}
-
-	return instances, nil
+	return c.catalogServicesToServiceInstances(client, catalogServices)
 }
 
 // ListAllServiceInstances list all service instances from the registry.
@@ -417,21 +473,67 @@ func (c *ConsulServiceRegistry) ListAllServiceInstances() (map[string]*servicere
 			c.superSpec.Name(), err)
 	}
 
+	return c.catalogServicesToServiceInstances(client, catalogServices)
+}
+
+// catalogServicesToServiceInstances converts catalog services to service
+// instances. If Connect is enabled, the instances of Connect-enabled services
+// are replaced by their Connect-capable endpoints with the https scheme,
+// and the sidecar proxies are not listed as services.
+func (c *ConsulServiceRegistry) catalogServicesToServiceInstances(client consulClient,
+	catalogServices []*api.CatalogService) (map[string]*serviceregistry.ServiceInstanceSpec, error) {
 	instances := make(map[string]*serviceregistry.ServiceInstanceSpec)
-	for _, catalogService := range catalogServices {
-		serviceInstance := c.catalogServiceToServiceInstance(catalogService)
+	addInstance := func(serviceInstance *serviceregistry.ServiceInstanceSpec) error {
 		if err := serviceInstance.Validate(); err != nil {
-			return nil, fmt.Errorf("%+v is invalid: %v", serviceInstance, err)
+			return fmt.Errorf("%+v is invalid: %v", serviceInstance, err)
 		}
-
 		instances[serviceInstance.Key()] = serviceInstance
+		return nil
+	}
+
+	connectEndpoints := map[string][]*api.CatalogService{}
+	for _, catalogService := range catalogServices {
+		if c.spec.Connect != nil {
+			if isSidecarProxy(catalogService) {
+				continue
+			}
+
+			name := catalogService.ServiceName
+			endpoints, exists := connectEndpoints[name]
+			if !exists {
+				var err error
+				endpoints, err = client.ListConnectServiceInstances(name)
+				if err != nil {
+					return nil, err
+				}
+				connectEndpoints[name] = endpoints
+			}
+			if len(endpoints) > 0 {
+				continue
+			}
+		}
+
+		if err := addInstance(c.catalogServiceToServiceInstance(catalogService)); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, endpoints := range connectEndpoints {
+		for _, endpoint := range endpoints {
+			serviceInstance := c.catalogServiceToServiceInstance(endpoint)
+			serviceInstance.ServiceName = name
+			serviceInstance.Scheme = "https"
+			if err := addInstance(serviceInstance); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return instances, nil
 }
 
 func (c *ConsulServiceRegistry) serviceInstanceToRegistration(serviceInstance *serviceregistry.ServiceInstanceSpec) *api.AgentServiceRegistration {
-	return &api.AgentServiceRegistration{
+	registration := &api.AgentServiceRegistration{
 		Kind:    api.ServiceKindTypical,
 		ID:      serviceInstance.InstanceID,
 		Name:    serviceInstance.ServiceName,
@@ -442,6 +544,17 @@ func (c *ConsulServiceRegistry) serviceInstanceToRegistration(serviceInstance *s
 			MetaKeyRegistryName: serviceInstance.RegistryName,
 		},
 	}
+
+	if serviceInstance.HealthCheckURL != "" {
+		registration.Check = &api.AgentServiceCheck{
+			HTTP:                           serviceInstance.HealthCheckURL,
+			Interval:                       c.spec.SyncInterval,
+			Timeout:                        healthCheckTimeout,
+			DeregisterCriticalServiceAfter: deregisterCriticalServiceAfter,
+		}
+	}
+
+	return registration
 }
 
 func (c *ConsulServiceRegistry) catalogServiceToServiceInstance(catalogService *api.CatalogService) *serviceregistry.ServiceInstanceSpec {
@@ -0,0 +1,267 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package dashboard serves the web UI of Easegress on a dedicated port,
+// the UI talks to the admin API of the member through the Dashboard, which
+// authenticates the users and applies the permissions of their roles.
+package dashboard
+
+import (
+	"context"
+	"crypto/subtle"
+	"embed"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/graceupdate"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// Category is the category of Dashboard.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of Dashboard.
+	Kind = "Dashboard"
+
+	// whoamiPath returns the user and the role of the request, so that the
+	// UI could hide the actions not permitted.
+	whoamiPath = "/whoami"
+
+	stateRunning = "running"
+	stateFailed  = "failed"
+
+	shutdownTimeout = 5 * time.Second
+)
+
+//go:embed ui
+var uiFS embed.FS
+
+func init() {
+	supervisor.Register(&Dashboard{})
+}
+
+type (
+	// Dashboard serves the web UI.
+	Dashboard struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		server *http.Server
+
+		mutex  sync.RWMutex
+		status *Status
+	}
+
+	// Status is the status of Dashboard.
+	Status struct {
+		State string `json:"state"`
+		Error string `json:"error,omitempty"`
+	}
+
+	// whoami is the response of whoamiPath.
+	whoami struct {
+		Name string `json:"name,omitempty"`
+		Role string `json:"role"`
+	}
+
+	whoamiKey struct{}
+)
+
+// Category returns the category of Dashboard.
+func (d *Dashboard) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of Dashboard.
+func (d *Dashboard) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of Dashboard.
+func (d *Dashboard) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Init initializes Dashboard.
+func (d *Dashboard) Init(superSpec *supervisor.Spec) {
+	d.superSpec, d.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	d.reload()
+}
+
+// Inherit inherits previous generation of Dashboard.
+func (d *Dashboard) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	// NOTE: The port is likely the same, so the previous server must be
+	// closed before the new one listens.
+	previousGeneration.Close()
+	d.Init(superSpec)
+}
+
+func (d *Dashboard) reload() {
+	d.status = &Status{State: stateRunning}
+
+	handler, err := d.newHandler()
+	if err != nil {
+		d.setFailed(err)
+		return
+	}
+
+	d.server = &http.Server{
+		Addr:    net.JoinHostPort(d.spec.Address, fmt.Sprintf("%d", d.spec.Port)),
+		Handler: handler,
+	}
+	if d.spec.HTTPS {
+		// The error has been checked in Validate.
+		d.server.TLSConfig, _ = d.spec.tlsConfig()
+	}
+
+	go d.run(d.server)
+}
+
+func (d *Dashboard) run(server *http.Server) {
+	logger.Infof("%s dashboard running in %s", d.superSpec.Name(), server.Addr)
+
+	listener, err := graceupdate.Listen("tcp", server.Addr)
+	if err == nil {
+		if server.TLSConfig != nil {
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			err = server.Serve(listener)
+		}
+	}
+	if err != nil && err != http.ErrServerClosed {
+		logger.Errorf("%s dashboard listen failed: %v", d.superSpec.Name(), err)
+		d.setFailed(err)
+	}
+}
+
+func (d *Dashboard) setFailed(err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.status = &Status{State: stateFailed, Error: err.Error()}
+}
+
+// newHandler creates the handler which serves the UI, and forwards the API
+// requests to the admin API of the member.
+func (d *Dashboard) newHandler() (http.Handler, error) {
+	apiAddr := d.superSpec.Super().Options().APIAddr
+	host, port, err := net.SplitHostPort(apiAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid api address %s: %v", apiAddr, err)
+	}
+	if host == "" {
+		host = "localhost"
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(&url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(host, port),
+	})
+	// Flush immediately for the watch and traffic streams.
+	proxy.FlushInterval = -1
+
+	ui, err := fs.Sub(uiFS, "ui")
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(api.APIPrefixV2+"/", proxy)
+	mux.HandleFunc(whoamiPath, d.handleWhoami)
+	mux.Handle("/", http.FileServer(http.FS(ui)))
+
+	return d.authorize(mux), nil
+}
+
+// authorize authenticates the user of the request, and rejects the
+// requests not permitted by the role of the user.
+func (d *Dashboard) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := d.authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s"`, d.superSpec.Name()))
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		if user.Role != RoleAdmin && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("role %s is not permitted to %s", user.Role, r.Method))
+			return
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), whoamiKey{}, user))
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (d *Dashboard) authenticate(r *http.Request) (*whoami, bool) {
+	if len(d.spec.Users) == 0 {
+		return &whoami{Role: d.spec.anonymousRole()}, true
+	}
+
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, false
+	}
+	for _, u := range d.spec.Users {
+		if u.Name == name && subtle.ConstantTimeCompare([]byte(u.Password), []byte(password)) == 1 {
+			return &whoami{Name: u.Name, Role: u.Role}, true
+		}
+	}
+	return nil, false
+}
+
+func (d *Dashboard) handleWhoami(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(whoamiKey{}).(*whoami)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(codectool.MustMarshalJSON(user))
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(codectool.MustMarshalJSON(&api.Err{Code: code, Message: message}))
+}
+
+// Status returns the status of Dashboard.
+func (d *Dashboard) Status() *supervisor.Status {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return &supervisor.Status{ObjectStatus: d.status}
+}
+
+// Close closes Dashboard.
+func (d *Dashboard) Close() {
+	if d.server == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := d.server.Shutdown(ctx); err != nil {
+		logger.Errorf("%s shutdown dashboard failed: %v", d.superSpec.Name(), err)
+	}
+}
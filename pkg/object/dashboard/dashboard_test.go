@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dashboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func newTestDashboard(t *testing.T, yamlConfig string) *Dashboard {
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.NoError(t, err)
+	return &Dashboard{superSpec: superSpec, spec: superSpec.ObjectSpec().(*Spec)}
+}
+
+func TestAuthorize(t *testing.T) {
+	assert := assert.New(t)
+
+	d := newTestDashboard(t, `
+name: dashboard
+kind: Dashboard
+port: 10099
+users:
+- name: alice
+  password: secret
+  role: admin
+- name: bob
+  password: secret
+  role: viewer
+`)
+	handler := d.authorize(http.HandlerFunc(d.handleWhoami))
+
+	serve := func(method, user, password string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, whoamiPath, nil)
+		if user != "" {
+			r.SetBasicAuth(user, password)
+		}
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve(http.MethodGet, "", "")
+	assert.Equal(http.StatusUnauthorized, w.Code)
+	assert.NotEmpty(w.Header().Get("WWW-Authenticate"))
+
+	w = serve(http.MethodGet, "alice", "wrong")
+	assert.Equal(http.StatusUnauthorized, w.Code)
+
+	w = serve(http.MethodGet, "bob", "secret")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.JSONEq(`{"name":"bob","role":"viewer"}`, w.Body.String())
+
+	w = serve(http.MethodPut, "bob", "secret")
+	assert.Equal(http.StatusForbidden, w.Code)
+
+	w = serve(http.MethodPut, "alice", "secret")
+	assert.Equal(http.StatusOK, w.Code)
+}
+
+func TestAnonymous(t *testing.T) {
+	assert := assert.New(t)
+
+	d := newTestDashboard(t, `
+name: dashboard
+kind: Dashboard
+port: 10099
+`)
+	handler := d.authorize(http.HandlerFunc(d.handleWhoami))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, whoamiPath, nil))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.JSONEq(`{"role":"viewer"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, whoamiPath, nil))
+	assert.Equal(http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dashboard
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+)
+
+const (
+	// RoleAdmin can read and change everything.
+	RoleAdmin = "admin"
+	// RoleViewer can only read, i.e. the requests of GET and HEAD.
+	RoleViewer = "viewer"
+)
+
+type (
+	// Spec describes the Dashboard.
+	Spec struct {
+		Port       uint16 `json:"port" jsonschema:"required,minimum=1"`
+		Address    string `json:"address,omitempty" jsonschema:"omitempty"`
+		HTTPS      bool   `json:"https" jsonschema:"omitempty"`
+		CertBase64 string `json:"certBase64,omitempty" jsonschema:"omitempty,format=base64"`
+		KeyBase64  string `json:"keyBase64,omitempty" jsonschema:"omitempty,format=base64"`
+
+		// Users are authenticated by HTTP basic authentication, the
+		// dashboard is open to everyone with the role of AnonymousRole if
+		// there are no users.
+		Users         []*UserSpec `json:"users,omitempty" jsonschema:"omitempty"`
+		AnonymousRole string      `json:"anonymousRole,omitempty" jsonschema:"omitempty,enum=,enum=admin,enum=viewer"`
+	}
+
+	// UserSpec describes a user of the Dashboard.
+	UserSpec struct {
+		Name     string `json:"name" jsonschema:"required"`
+		Password string `json:"password" jsonschema:"required"`
+		Role     string `json:"role" jsonschema:"required,enum=admin,enum=viewer"`
+	}
+)
+
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	if spec.HTTPS {
+		if _, err := spec.tlsConfig(); err != nil {
+			return err
+		}
+	}
+
+	names := map[string]bool{}
+	for _, u := range spec.Users {
+		if names[u.Name] {
+			return fmt.Errorf("duplicated user %s", u.Name)
+		}
+		names[u.Name] = true
+	}
+
+	return nil
+}
+
+func (spec *Spec) anonymousRole() string {
+	if spec.AnonymousRole == "" {
+		return RoleViewer
+	}
+	return spec.AnonymousRole
+}
+
+func (spec *Spec) tlsConfig() (*tls.Config, error) {
+	certPem, _ := base64.StdEncoding.DecodeString(spec.CertBase64)
+	keyPem, _ := base64.StdEncoding.DecodeString(spec.KeyBase64)
+	cert, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		return nil, fmt.Errorf("generate x509 key pair failed: %v", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
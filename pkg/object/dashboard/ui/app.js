@@ -0,0 +1,449 @@
+'use strict';
+
+// The Dashboard forwards /apis/v2 to the admin API of the member.
+const API = '/apis/v2';
+const END = 'END';
+const HISTORY = 60;
+
+const state = {
+  schemas: {},
+  objects: [],
+  selected: null,
+  isNew: false,
+  statuses: {},
+  traffic: [],
+  streams: {},
+};
+
+async function request(method, path, body) {
+  const opts = { method, headers: { Accept: 'application/json' } };
+  if (body !== undefined) {
+    opts.headers['Content-Type'] = 'application/json';
+    opts.body = JSON.stringify(body);
+  }
+  const resp = await fetch(API + path, opts);
+  const text = await resp.text();
+  if (!resp.ok) {
+    let message = text;
+    try {
+      message = JSON.parse(text).message || text;
+    } catch (e) { /* not json */ }
+    throw new Error(`${resp.status}: ${message}`);
+  }
+  return text ? JSON.parse(text) : null;
+}
+
+function el(tag, attrs, ...children) {
+  const node = document.createElement(tag);
+  Object.entries(attrs || {}).forEach(([k, v]) => {
+    if (k === 'onclick') {
+      node.onclick = v;
+    } else {
+      node.setAttribute(k, v);
+    }
+  });
+  children.forEach((c) => node.append(c));
+  return node;
+}
+
+function svg(tag, attrs, text) {
+  const node = document.createElementNS('http://www.w3.org/2000/svg', tag);
+  Object.entries(attrs).forEach(([k, v]) => node.setAttribute(k, v));
+  if (text !== undefined) {
+    node.textContent = text;
+  }
+  return node;
+}
+
+// Views
+
+function showView() {
+  const view = location.hash.slice(1) || 'objects';
+  document.querySelectorAll('.view').forEach((v) => v.classList.toggle('active', v.id === view));
+  document.querySelectorAll('nav a').forEach((a) => a.classList.toggle('active', a.dataset.view === view));
+
+  if (view === 'status') {
+    watchStatuses();
+  } else if (view === 'traffic') {
+    watchTraffic();
+  } else if (view === 'pipelines') {
+    loadObjects().then(renderPipelineList);
+  } else {
+    loadObjects().then(renderObjectList);
+  }
+}
+
+// Objects
+
+async function loadSchemas() {
+  const doc = await request('GET', '/openapi');
+  state.schemas = doc.components.schemas;
+
+  const kinds = Object.keys(state.schemas)
+    .filter((k) => k.startsWith('objects.'))
+    .map((k) => k.slice('objects.'.length));
+  const select = document.getElementById('new-kind');
+  select.replaceChildren(...kinds.map((k) => el('option', { value: k }, k)));
+}
+
+async function loadObjects() {
+  state.objects = await request('GET', '/objects');
+  return state.objects;
+}
+
+function renderObjectList() {
+  const list = document.getElementById('object-list');
+  list.replaceChildren(...state.objects.map((obj) => {
+    const item = el('li', { onclick: () => selectObject(obj, false) }, obj.name, ' ', el('small', {}, obj.kind));
+    item.classList.toggle('selected', !state.isNew && state.selected && state.selected.name === obj.name);
+    return item;
+  }));
+}
+
+// objectSchema merges the properties of the meta and the kind, the
+// schemas of objects are allOf the two in the OpenAPI document.
+function objectSchema(kind) {
+  const schema = state.schemas[`objects.${kind}`] || {};
+  const merged = { properties: {}, required: [] };
+  (schema.allOf || [schema]).forEach((s) => {
+    Object.assign(merged.properties, s.properties || {});
+    merged.required.push(...(s.required || []));
+  });
+  return merged;
+}
+
+function schemaType(prop) {
+  const type = Array.isArray(prop.type) ? prop.type.find((t) => t !== 'null') : prop.type;
+  return type || 'object';
+}
+
+function renderField(name, prop, value, required) {
+  const type = schemaType(prop);
+  const id = `field-${name}`;
+  let input;
+
+  if (prop.enum) {
+    input = el('select', { id }, ...prop.enum.map((v) => el('option', { value: v }, String(v))));
+    input.value = value === undefined ? '' : value;
+  } else if (type === 'boolean') {
+    input = el('input', { id, type: 'checkbox' });
+    input.checked = Boolean(value);
+  } else if (type === 'string' || type === 'integer' || type === 'number') {
+    input = el('input', { id, type: type === 'string' ? 'text' : 'number' });
+    input.value = value === undefined ? '' : value;
+  } else {
+    input = el('textarea', { id });
+    input.value = value === undefined ? '' : JSON.stringify(value, null, 2);
+  }
+  input.dataset.name = name;
+  input.dataset.type = type;
+
+  const label = el('label', { for: id, title: prop.description || '' }, name + (required ? ' *' : ''));
+  return [label, input];
+}
+
+function selectObject(obj, isNew) {
+  state.selected = obj;
+  state.isNew = isNew;
+
+  const schema = objectSchema(obj.kind);
+  const form = document.getElementById('object-form');
+  const fields = Object.keys(schema.properties).sort((a, b) => {
+    const order = ['name', 'kind', 'version'];
+    const ia = order.indexOf(a) < 0 ? order.length : order.indexOf(a);
+    const ib = order.indexOf(b) < 0 ? order.length : order.indexOf(b);
+    return ia - ib || a.localeCompare(b);
+  });
+  form.replaceChildren(...fields.flatMap((name) => renderField(
+    name, schema.properties[name], obj[name], schema.required.includes(name))));
+
+  form.querySelector('[data-name="kind"]').disabled = true;
+  form.querySelector('[data-name="name"]').disabled = !isNew;
+
+  document.getElementById('editor-title').textContent = isNew ? `New ${obj.kind}` : obj.name;
+  document.getElementById('delete-object').disabled = isNew;
+  setMessage('');
+  renderObjectList();
+}
+
+// readForm returns the object edited, the fields not in the schema are kept.
+function readForm() {
+  const obj = Object.assign({}, state.selected);
+  document.querySelectorAll('#object-form [data-name]').forEach((input) => {
+    const { name, type } = input.dataset;
+    let value;
+    if (type === 'boolean') {
+      value = input.checked;
+    } else if (input.tagName === 'TEXTAREA') {
+      value = input.value.trim() ? JSON.parse(input.value) : undefined;
+    } else if (type === 'integer' || type === 'number') {
+      value = input.value === '' ? undefined : Number(input.value);
+    } else {
+      value = input.value === '' ? undefined : input.value;
+    }
+
+    if (value === undefined) {
+      delete obj[name];
+    } else {
+      obj[name] = value;
+    }
+  });
+  return obj;
+}
+
+function setMessage(text, isError) {
+  const msg = document.getElementById('editor-message');
+  msg.textContent = text;
+  msg.classList.toggle('error', Boolean(isError));
+}
+
+async function saveObject() {
+  try {
+    const obj = readForm();
+    if (state.isNew) {
+      await request('POST', '/objects', obj);
+    } else {
+      await request('PUT', `/objects/${encodeURIComponent(obj.name)}`, obj);
+    }
+    setMessage(`${obj.name} saved`);
+    await loadObjects();
+    selectObject(state.objects.find((o) => o.name === obj.name) || obj, false);
+  } catch (e) {
+    setMessage(e.message, true);
+  }
+}
+
+async function deleteObject() {
+  const { name } = state.selected || {};
+  if (!name || !confirm(`Delete ${name}?`)) {
+    return;
+  }
+  try {
+    await request('DELETE', `/objects/${encodeURIComponent(name)}`);
+    state.selected = null;
+    document.getElementById('object-form').replaceChildren();
+    setMessage(`${name} deleted`);
+    await loadObjects();
+    renderObjectList();
+  } catch (e) {
+    setMessage(e.message, true);
+  }
+}
+
+function newObject() {
+  const kind = document.getElementById('new-kind').value;
+  selectObject({ name: '', kind, version: 'easegress.megaease.com/v2' }, true);
+}
+
+// Status
+
+async function watchStatuses() {
+  if (state.streams.status) {
+    return;
+  }
+
+  state.statuses = await request('GET', '/status/objects');
+  renderStatuses();
+
+  const source = new EventSource(`${API}/status/objects?watch=true`);
+  state.streams.status = source;
+  const onEvent = (e) => {
+    const event = JSON.parse(e.data);
+    // The key is namespace/object/member.
+    const [, object, member] = event.key.split('/');
+    state.statuses[object] = state.statuses[object] || {};
+    if (event.type === 'delete') {
+      delete state.statuses[object][member];
+    } else {
+      state.statuses[object][member] = event.status;
+    }
+    renderStatuses();
+  };
+  source.addEventListener('put', onEvent);
+  source.addEventListener('delete', onEvent);
+}
+
+function renderStatuses() {
+  const rows = [];
+  Object.keys(state.statuses).sort().forEach((object) => {
+    Object.keys(state.statuses[object] || {}).sort().forEach((member) => {
+      const status = state.statuses[object][member];
+      rows.push(el('tr', {},
+        el('td', {}, object),
+        el('td', {}, member),
+        el('td', {}, el('pre', {}, JSON.stringify(status, null, 2)))));
+    });
+  });
+  document.getElementById('status-rows').replaceChildren(...rows);
+}
+
+// Traffic
+
+async function watchTraffic() {
+  if (state.streams.traffic) {
+    return;
+  }
+  state.streams.traffic = true;
+
+  try {
+    const resp = await fetch(`${API}/status/traffic?interval=5s`);
+    const reader = resp.body.getReader();
+    const decoder = new TextDecoder();
+    let buffer = '';
+
+    for (;;) {
+      const { value, done } = await reader.read();
+      if (done) {
+        break;
+      }
+      buffer += decoder.decode(value, { stream: true });
+      const lines = buffer.split('\n');
+      buffer = lines.pop();
+      lines.filter((l) => l.trim()).forEach((l) => onTraffic(JSON.parse(l)));
+    }
+  } finally {
+    state.streams.traffic = false;
+  }
+}
+
+function onTraffic(snapshot) {
+  state.traffic.push(snapshot);
+  if (state.traffic.length > HISTORY) {
+    state.traffic.shift();
+  }
+
+  const rows = (snapshot.servers || []).map((s) => el('tr', {},
+    el('td', {}, s.name),
+    el('td', {}, s.rps.toFixed(2)),
+    el('td', {}, `${s.errPercent.toFixed(2)}%`),
+    el('td', {}, `${s.p50}ms`),
+    el('td', {}, `${s.p95}ms`),
+    el('td', {}, `${s.p99}ms`)));
+  document.getElementById('traffic-rows').replaceChildren(...rows);
+
+  drawChart('rps-chart', 'RPS', (s) => s.rps);
+  drawChart('latency-chart', 'P99 (ms)', (s) => s.p99);
+}
+
+function drawChart(id, title, metric) {
+  const canvas = document.getElementById(id);
+  const ctx = canvas.getContext('2d');
+  const { width, height } = canvas;
+  const pad = 30;
+  ctx.clearRect(0, 0, width, height);
+
+  const series = {};
+  state.traffic.forEach((snapshot, i) => {
+    (snapshot.servers || []).forEach((s) => {
+      series[s.name] = series[s.name] || [];
+      series[s.name].push([i, metric(s)]);
+    });
+  });
+
+  const max = Math.max(1, ...Object.values(series).flat().map(([, v]) => v));
+  const x = (i) => pad + (i * (width - 2 * pad)) / (HISTORY - 1);
+  const y = (v) => height - pad - (v * (height - 2 * pad)) / max;
+
+  ctx.fillStyle = '#222';
+  ctx.fillText(`${title}, max ${max.toFixed(2)}`, pad, pad / 2);
+  ctx.strokeStyle = '#ccc';
+  ctx.strokeRect(pad, pad, width - 2 * pad, height - 2 * pad);
+
+  const colors = ['#1890ff', '#52c41a', '#fa541c', '#722ed1', '#faad14', '#13c2c2'];
+  Object.keys(series).sort().forEach((name, n) => {
+    const color = colors[n % colors.length];
+    ctx.strokeStyle = color;
+    ctx.beginPath();
+    series[name].forEach(([i, v], j) => (j ? ctx.lineTo(x(i), y(v)) : ctx.moveTo(x(i), y(v))));
+    ctx.stroke();
+    ctx.fillStyle = color;
+    ctx.fillText(name, width - pad - 120, pad + 14 * (n + 1));
+  });
+}
+
+// Pipelines
+
+function renderPipelineList() {
+  const pipelines = state.objects.filter((o) => o.kind === 'Pipeline');
+  const list = document.getElementById('pipeline-list');
+  list.replaceChildren(...pipelines.map((p) => el('li', {
+    onclick: () => {
+      list.querySelectorAll('li').forEach((li) => li.classList.toggle('selected', li.textContent === p.name));
+      drawPipeline(p);
+    },
+  }, p.name)));
+}
+
+// drawPipeline draws the flow of the pipeline, the filters run in the order
+// of the flow, or the order of the filters if there is no flow. The jumpIf
+// edges are drawn on the right side with the results as the labels.
+function drawPipeline(pipeline) {
+  let flow = pipeline.flow || [];
+  if (flow.length === 0) {
+    flow = (pipeline.filters || []).map((f) => ({ filter: f.name }));
+  }
+  const nodes = flow.map((n) => ({ name: n.alias || n.filter, filter: n.filter, jumpIf: n.jumpIf || {} }));
+  if (!nodes.some((n) => n.filter === END)) {
+    nodes.push({ name: END, filter: END, jumpIf: {} });
+  }
+
+  const kinds = {};
+  (pipeline.filters || []).forEach((f) => { kinds[f.name] = f.kind; });
+
+  const graph = document.getElementById('pipeline-graph');
+  const boxW = 200;
+  const boxH = 36;
+  const gap = 28;
+  const left = 40;
+  const top = 20;
+  const yOf = (i) => top + i * (boxH + gap);
+  graph.replaceChildren();
+  graph.setAttribute('height', yOf(nodes.length) + top);
+
+  const index = {};
+  nodes.forEach((n, i) => { index[n.name] = i; });
+
+  let jumps = 0;
+  nodes.forEach((n, i) => {
+    graph.append(svg('rect', { x: left, y: yOf(i), width: boxW, height: boxH, rx: 6 }));
+    const label = n.filter === END ? END : `${n.name} (${kinds[n.filter] || '?'})`;
+    graph.append(svg('text', { x: left + 10, y: yOf(i) + 22 }, label));
+
+    if (i + 1 < nodes.length && n.filter !== END) {
+      const x = left + boxW / 2;
+      graph.append(svg('path', { d: `M${x},${yOf(i) + boxH} L${x},${yOf(i + 1)}` }));
+    }
+
+    Object.entries(n.jumpIf).forEach(([result, target]) => {
+      const j = index[target];
+      if (j === undefined) {
+        return;
+      }
+      jumps += 1;
+      const x0 = left + boxW;
+      const y0 = yOf(i) + boxH / 2;
+      const y1 = yOf(j) + boxH / 2;
+      const dx = 40 + jumps * 24;
+      graph.append(svg('path', { class: 'jump', d: `M${x0},${y0} C${x0 + dx},${y0} ${x0 + dx},${y1} ${x0},${y1}` }));
+      graph.append(svg('text', { class: 'label', x: x0 + dx * 0.75 + 4, y: (y0 + y1) / 2 }, result));
+    });
+  });
+}
+
+// Startup
+
+async function main() {
+  const me = await fetch('/whoami').then((r) => r.json());
+  document.getElementById('whoami').textContent = `${me.name || 'anonymous'} (${me.role})`;
+  document.body.classList.toggle('readonly', me.role !== 'admin');
+
+  document.getElementById('new-object').onclick = newObject;
+  document.getElementById('save-object').onclick = saveObject;
+  document.getElementById('delete-object').onclick = deleteObject;
+  window.addEventListener('hashchange', showView);
+
+  await loadSchemas();
+  showView();
+}
+
+main();
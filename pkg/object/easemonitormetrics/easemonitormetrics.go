@@ -20,16 +20,11 @@ package easemonitormetrics
 import (
 	"fmt"
 	"net"
-	"sync"
-	"sync/atomic"
 	"time"
 
-	"github.com/Shopify/sarama"
-
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/statussynccontroller"
 	"github.com/megaease/easegress/pkg/supervisor"
-	"github.com/megaease/easegress/pkg/util/codectool"
 	"github.com/megaease/easegress/pkg/util/easemonitor"
 )
 
@@ -56,18 +51,17 @@ type (
 		superSpec *supervisor.Spec
 		spec      *Spec
 
-		ssc *statussynccontroller.StatusSyncController
-
-		// sarama.AsyncProducer
-		client      atomic.Value
-		clientMutex sync.Mutex
+		ssc   *statussynccontroller.StatusSyncController
+		sinks []*namedSink
 
 		done chan struct{}
 	}
 
 	// Spec describes the EaseMonitorMetrics.
 	Spec struct {
-		Kafka *KafkaSpec `json:"kafka" jsonschema:"required"`
+		// Kafka is the EaseMonitor sink, it is kept for compatibility.
+		Kafka *KafkaSpec  `json:"kafka,omitempty" jsonschema:"omitempty"`
+		Sinks []*SinkSpec `json:"sinks,omitempty" jsonschema:"omitempty"`
 	}
 
 	// KafkaSpec is the spec for kafka producer.
@@ -78,10 +72,47 @@ type (
 
 	// Status is the status of EaseMonitorMetrics.
 	Status struct {
-		Health string `json:"health"`
+		Health string            `json:"health"`
+		Sinks  map[string]string `json:"sinks,omitempty"`
+	}
+
+	namedSink struct {
+		spec *SinkSpec
+		sink sink
 	}
 )
 
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	if spec.Kafka == nil && len(spec.Sinks) == 0 {
+		return fmt.Errorf("one of kafka and sinks is required")
+	}
+
+	names := map[string]bool{}
+	for _, s := range spec.Sinks {
+		if names[s.Name] {
+			return fmt.Errorf("duplicated sink %s", s.Name)
+		}
+		names[s.Name] = true
+	}
+
+	return nil
+}
+
+// sinkSpecs returns the specs of all sinks, the legacy kafka is converted
+// to a sink of the EaseMonitor schema.
+func (spec *Spec) sinkSpecs() []*SinkSpec {
+	specs := spec.Sinks
+	if spec.Kafka != nil {
+		specs = append([]*SinkSpec{{
+			Name:  SinkKafka,
+			Kind:  SinkKafka,
+			Kafka: spec.Kafka,
+		}}, specs...)
+	}
+	return specs
+}
+
 // Category returns the category of EaseMonitorMetrics.
 func (emm *EaseMonitorMetrics) Category() supervisor.ObjectCategory {
 	return supervisor.CategoryBusinessController
@@ -122,69 +153,16 @@ func (emm *EaseMonitorMetrics) reload() {
 	emm.ssc = ssc.Instance().(*statussynccontroller.StatusSyncController)
 	emm.done = make(chan struct{})
 
-	_, err := emm.getClient()
-	if err != nil {
-		logger.Errorf("%s get kafka producer client failed: %v", emm.superSpec.Name(), err)
-	}
-
-	go emm.run()
-}
-
-func (emm *EaseMonitorMetrics) getClient() (sarama.AsyncProducer, error) {
-	client := emm.client.Load()
-	if client != nil {
-		return client.(sarama.AsyncProducer), nil
-	}
-
-	emm.clientMutex.Lock()
-	defer emm.clientMutex.Unlock()
-
-	// NOTE: Default config is good enough for now.
-	config := sarama.NewConfig()
-	config.ClientID = emm.superSpec.Name()
-	config.Version = sarama.V0_10_2_0
-
-	producer, err := sarama.NewAsyncProducer(emm.spec.Kafka.Brokers, config)
-	if err != nil {
-		msgFmt := "start sarama producer failed(brokers: %v): %v"
-		return nil, fmt.Errorf(msgFmt, emm.spec.Kafka.Brokers, err)
-	}
-
-	go func() {
-		for {
-			select {
-			case <-emm.done:
-				return
-			case err, ok := <-producer.Errors():
-				if !ok {
-					return
-				}
-				logger.Errorf("produce failed: %v", err)
-			}
+	for _, spec := range emm.spec.sinkSpecs() {
+		name := emm.superSpec.Name() + "/" + spec.Name
+		s := newSink(name, spec)
+		if err := s.health(); err != nil {
+			logger.Errorf("%s sink %s is not ready: %v", emm.superSpec.Name(), spec.Name, err)
 		}
-	}()
-
-	emm.client.Store(producer)
-
-	logger.Infof("%s build kafka producer successfully", emm.superSpec.Name())
-
-	return producer, nil
-}
-
-func (emm *EaseMonitorMetrics) closeClient() {
-	emm.clientMutex.Lock()
-	defer emm.clientMutex.Unlock()
-
-	value := emm.client.Load()
-	if value == nil {
-		return
+		emm.sinks = append(emm.sinks, &namedSink{spec: spec, sink: s})
 	}
-	client := value.(sarama.AsyncProducer)
 
-	err := client.Close()
-	if err != nil {
-		logger.Errorf("%s close kafka producer failed: %v", emm.superSpec.Name(), err)
-	}
+	go emm.run()
 }
 
 func (emm *EaseMonitorMetrics) run() {
@@ -194,7 +172,9 @@ func (emm *EaseMonitorMetrics) run() {
 	for {
 		select {
 		case <-emm.done:
-			emm.closeClient()
+			for _, s := range emm.sinks {
+				s.sink.close()
+			}
 			return
 		case <-time.After(interval):
 			latestTimestamp = emm.sendMetrics(latestTimestamp)
@@ -202,13 +182,8 @@ func (emm *EaseMonitorMetrics) run() {
 	}
 }
 
-func (emm *EaseMonitorMetrics) sendMetrics(latestTimestamp int64) int64 {
-	client, err := emm.getClient()
-	if err != nil {
-		msgFmt := "%s get kafka producer failed: %v"
-		logger.Errorf(msgFmt, emm.superSpec.Name(), err)
-		return latestTimestamp
-	}
+func (emm *EaseMonitorMetrics) collectMetrics(latestTimestamp int64) ([]*easemonitor.Metrics, int64) {
+	var metrics []*easemonitor.Metrics
 
 	for _, record := range emm.ssc.GetStatusSnapshots() {
 		if record.UnixTimestamp <= latestTimestamp {
@@ -228,32 +203,76 @@ func (emm *EaseMonitorMetrics) sendMetrics(latestTimestamp int64) int64 {
 				m.HostIpv4 = hostIPv4
 				m.System = emm.super.Options().ClusterName
 				m.Timestamp = latestTimestamp * 1000
+				metrics = append(metrics, m)
+			}
+		}
+	}
 
-				data, err := codectool.MarshalJSON(m)
-				if err != nil {
-					logger.Errorf("marshal %#v to json failed: %v", m, err)
-				}
+	return metrics, latestTimestamp
+}
+
+func (emm *EaseMonitorMetrics) sendMetrics(latestTimestamp int64) int64 {
+	metrics, latestTimestamp := emm.collectMetrics(latestTimestamp)
+	if len(metrics) == 0 {
+		return latestTimestamp
+	}
 
-				client.Input() <- &sarama.ProducerMessage{
-					Topic: emm.spec.Kafka.Topic,
-					Value: sarama.ByteEncoder(data),
-				}
+	for _, s := range emm.sinks {
+		records := make([][]byte, 0, len(metrics))
+		for _, m := range metrics {
+			data, err := s.spec.Schema.encode(m)
+			if err != nil {
+				logger.Errorf("marshal %#v to json failed: %v", m, err)
+				continue
 			}
+			records = append(records, data)
 		}
+		emm.sendToSink(s, records)
 	}
 
 	return latestTimestamp
 }
 
+// sendToSink sends the records in batches, a batch is retried on failure
+// and dropped after the retries.
+func (emm *EaseMonitorMetrics) sendToSink(s *namedSink, records [][]byte) {
+	size := s.spec.Batch.size()
+
+	for len(records) > 0 {
+		n := size
+		if n > len(records) {
+			n = len(records)
+		}
+		batch := records[:n]
+		records = records[n:]
+
+		err := s.sink.send(batch)
+		for i := 0; err != nil && i < s.spec.Batch.maxRetries(); i++ {
+			select {
+			case <-emm.done:
+				return
+			case <-time.After(s.spec.Batch.retryInterval()):
+			}
+			err = s.sink.send(batch)
+		}
+		if err != nil {
+			logger.Errorf("%s send %d metrics to sink %s failed: %v",
+				emm.superSpec.Name(), len(batch), s.spec.Name, err)
+		}
+	}
+}
+
 // Status returns status of EtcdServiceRegister.
 func (emm *EaseMonitorMetrics) Status() *supervisor.Status {
-	s := &Status{}
-
-	_, err := emm.getClient()
-	if err != nil {
-		s.Health = err.Error()
-	} else {
-		s.Health = "ready"
+	s := &Status{Health: "ready", Sinks: map[string]string{}}
+
+	for _, ns := range emm.sinks {
+		if err := ns.sink.health(); err != nil {
+			s.Sinks[ns.spec.Name] = err.Error()
+			s.Health = err.Error()
+		} else {
+			s.Sinks[ns.spec.Name] = "ready"
+		}
 	}
 
 	return &supervisor.Status{ObjectStatus: s}
@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package easemonitormetrics
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/util/easemonitor"
+)
+
+func newTestMetrics() *easemonitor.Metrics {
+	return &easemonitor.Metrics{
+		CommonFields: easemonitor.CommonFields{
+			Timestamp: 1600000000000,
+			Category:  "application",
+			HostName:  "host-a",
+			HostIpv4:  "192.168.0.1",
+			System:    "easegress",
+			Service:   "pipeline-a",
+			Type:      "eg-http-request",
+			Resource:  "SERVER",
+		},
+		OtherFields: map[string]interface{}{"cnt": 10},
+	}
+}
+
+func decodeRecord(t *testing.T, data []byte) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("decode %s failed: %v", data, err)
+	}
+	return fields
+}
+
+func TestSchemaEaseMonitor(t *testing.T) {
+	assert := assert.New(t)
+
+	var spec *SchemaSpec
+	data, err := spec.encode(newTestMetrics())
+	assert.NoError(err)
+	fields := decodeRecord(t, data)
+	assert.Equal("host-a", fields["host_name"])
+	assert.Equal(float64(10), fields["cnt"])
+
+	spec = &SchemaSpec{FieldMapping: map[string]string{
+		"host_name": "hostname",
+		"host_ipv4": "",
+	}}
+	data, err = spec.encode(newTestMetrics())
+	assert.NoError(err)
+	fields = decodeRecord(t, data)
+	assert.Equal("host-a", fields["hostname"])
+	assert.NotContains(fields, "host_name")
+	assert.NotContains(fields, "host_ipv4")
+	assert.Equal(float64(10), fields["cnt"])
+}
+
+func TestSchemaOTel(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &SchemaSpec{
+		Format:       SchemaOTel,
+		FieldMapping: map[string]string{"cnt": "count", "url": ""},
+	}
+	data, err := spec.encode(newTestMetrics())
+	assert.NoError(err)
+
+	fields := decodeRecord(t, data)
+	assert.Equal("eg-http-request", fields["name"])
+	assert.Equal(float64(1600000000000*1e6), fields["timeUnixNano"])
+
+	resource := fields["resource"].(map[string]interface{})
+	assert.Equal("host-a", resource["host.name"])
+	assert.Equal("192.168.0.1", resource["host.ip"])
+	assert.Equal("easegress", resource["service.namespace"])
+
+	attributes := fields["attributes"].(map[string]interface{})
+	assert.Equal("pipeline-a", attributes["service"])
+	assert.Equal("application", attributes["category"])
+
+	values := fields["values"].(map[string]interface{})
+	assert.Equal(float64(10), values["count"])
+	assert.NotContains(values, "cnt")
+}
+
+func TestSinkSpec(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error((&SinkSpec{Name: "a", Kind: SinkKafka}).Validate())
+	assert.Error((&SinkSpec{Name: "a", Kind: SinkHTTP}).Validate())
+	assert.NoError((&SinkSpec{Name: "a", Kind: SinkStdout}).Validate())
+
+	var batch *BatchSpec
+	assert.Equal(defaultBatchSize, batch.size())
+	assert.Equal(0, batch.maxRetries())
+	assert.Equal(defaultRetryInterval, batch.retryInterval())
+
+	batch = &BatchSpec{Size: 10, MaxRetries: 3, RetryInterval: "5s"}
+	assert.Equal(10, batch.size())
+	assert.Equal(3, batch.maxRetries())
+	assert.Equal(5*time.Second, batch.retryInterval())
+
+	batch.RetryInterval = "invalid"
+	assert.Equal(defaultRetryInterval, batch.retryInterval())
+}
+
+func TestHTTPSink(t *testing.T) {
+	assert := assert.New(t)
+
+	var body []byte
+	var header http.Header
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	s := newSink("test", &SinkSpec{
+		Name: "http",
+		Kind: SinkHTTP,
+		HTTP: &HTTPSinkSpec{
+			URL:     server.URL,
+			Headers: map[string]string{"X-Token": "token"},
+		},
+	})
+	defer s.close()
+	assert.NoError(s.health())
+
+	assert.NoError(s.send([][]byte{[]byte(`{"a":1}`), []byte(`{"b":2}`)}))
+	assert.Equal(`[{"a":1},{"b":2}]`, string(body))
+	assert.Equal("application/json", header.Get("Content-Type"))
+	assert.Equal("token", header.Get("X-Token"))
+
+	status = http.StatusInternalServerError
+	assert.Error(s.send([][]byte{[]byte(`{}`)}))
+}
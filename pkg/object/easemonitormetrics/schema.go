@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package easemonitormetrics
+
+import (
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/easemonitor"
+)
+
+const (
+	// SchemaEaseMonitor is the flat JSON object of EaseMonitor.
+	SchemaEaseMonitor = "easemonitor"
+	// SchemaOTel is a JSON object similar to the OpenTelemetry data model,
+	// the fields are grouped into resource, attributes and values.
+	SchemaOTel = "otel"
+)
+
+type (
+	// SchemaSpec describes the schema of the records sent to a sink.
+	SchemaSpec struct {
+		Format string `json:"format" jsonschema:"omitempty,enum=,enum=easemonitor,enum=otel"`
+		// FieldMapping renames the fields, the field is dropped if the new
+		// name is empty.
+		FieldMapping map[string]string `json:"fieldMapping" jsonschema:"omitempty"`
+	}
+)
+
+// the groups of the common fields in the otel schema, other fields are
+// values.
+var (
+	otelResourceFields = map[string]string{
+		"host_name": "host.name",
+		"host_ipv4": "host.ip",
+		"system":    "service.namespace",
+	}
+	otelAttributeFields = map[string]bool{
+		"category": true,
+		"service":  true,
+		"resource": true,
+		"url":      true,
+	}
+)
+
+func (spec *SchemaSpec) format() string {
+	if spec == nil || spec.Format == "" {
+		return SchemaEaseMonitor
+	}
+	return spec.Format
+}
+
+// rename returns the new name of the field, ok is false if the field is
+// dropped.
+func (spec *SchemaSpec) rename(field string) (string, bool) {
+	if spec == nil {
+		return field, true
+	}
+	name, exists := spec.FieldMapping[field]
+	if !exists {
+		return field, true
+	}
+	return name, name != ""
+}
+
+// encode encodes the metrics by the schema.
+func (spec *SchemaSpec) encode(m *easemonitor.Metrics) ([]byte, error) {
+	data, err := codectool.MarshalJSON(m)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the original encoding for EaseMonitor.
+	if spec.format() == SchemaEaseMonitor && (spec == nil || len(spec.FieldMapping) == 0) {
+		return data, nil
+	}
+
+	fields := map[string]interface{}{}
+	if err = codectool.UnmarshalJSON(data, &fields); err != nil {
+		return nil, err
+	}
+
+	if spec.format() == SchemaOTel {
+		return codectool.MarshalJSON(spec.toOTel(fields))
+	}
+	return codectool.MarshalJSON(spec.renameFields(fields))
+}
+
+func (spec *SchemaSpec) renameFields(fields map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		if name, ok := spec.rename(k); ok {
+			result[name] = v
+		}
+	}
+	return result
+}
+
+func (spec *SchemaSpec) toOTel(fields map[string]interface{}) map[string]interface{} {
+	resource := map[string]interface{}{}
+	attributes := map[string]interface{}{}
+	values := map[string]interface{}{}
+	result := map[string]interface{}{
+		"resource":   resource,
+		"attributes": attributes,
+		"values":     values,
+	}
+
+	for k, v := range fields {
+		switch {
+		case k == "timestamp":
+			// milliseconds to nanoseconds.
+			if ms, ok := v.(float64); ok {
+				result["timeUnixNano"] = int64(ms) * 1e6
+			}
+		case k == "type":
+			result["name"] = v
+		case otelResourceFields[k] != "":
+			if name, ok := spec.rename(otelResourceFields[k]); ok {
+				resource[name] = v
+			}
+		case otelAttributeFields[k]:
+			if name, ok := spec.rename(k); ok {
+				attributes[name] = v
+			}
+		default:
+			if name, ok := spec.rename(k); ok {
+				values[name] = v
+			}
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,286 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package easemonitormetrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	// SinkKafka sends metrics to a Kafka topic, one message per record.
+	SinkKafka = "kafka"
+	// SinkHTTP sends metrics to an HTTP endpoint, a JSON array per batch.
+	SinkHTTP = "http"
+	// SinkStdout writes metrics to the standard output, one line per record.
+	SinkStdout = "stdout"
+
+	defaultBatchSize     = 100
+	defaultRetryInterval = time.Second
+	httpSinkTimeout      = 10 * time.Second
+	kafkaFlushFrequency  = time.Second
+)
+
+type (
+	// SinkSpec describes a sink of metrics.
+	SinkSpec struct {
+		Name   string        `json:"name" jsonschema:"required"`
+		Kind   string        `json:"kind" jsonschema:"required,enum=kafka,enum=http,enum=stdout"`
+		Kafka  *KafkaSpec    `json:"kafka,omitempty" jsonschema:"omitempty"`
+		HTTP   *HTTPSinkSpec `json:"http,omitempty" jsonschema:"omitempty"`
+		Schema *SchemaSpec   `json:"schema,omitempty" jsonschema:"omitempty"`
+		Batch  *BatchSpec    `json:"batch,omitempty" jsonschema:"omitempty"`
+	}
+
+	// HTTPSinkSpec describes the HTTP sink.
+	HTTPSinkSpec struct {
+		URL     string            `json:"url" jsonschema:"required,format=url"`
+		Headers map[string]string `json:"headers" jsonschema:"omitempty"`
+	}
+
+	// BatchSpec describes the batching and retrying of a sink.
+	BatchSpec struct {
+		Size          int    `json:"size" jsonschema:"omitempty,minimum=1"`
+		MaxRetries    int    `json:"maxRetries" jsonschema:"omitempty,minimum=0"`
+		RetryInterval string `json:"retryInterval" jsonschema:"omitempty,format=duration"`
+	}
+
+	// sink sends the encoded records.
+	sink interface {
+		send(records [][]byte) error
+		health() error
+		close()
+	}
+
+	kafkaSink struct {
+		name  string
+		spec  *KafkaSpec
+		batch *BatchSpec
+
+		mutex    sync.Mutex
+		producer sarama.AsyncProducer
+		done     chan struct{}
+	}
+
+	httpSink struct {
+		spec   *HTTPSinkSpec
+		client *http.Client
+	}
+
+	stdoutSink struct{}
+)
+
+// Validate validates SinkSpec.
+func (spec *SinkSpec) Validate() error {
+	switch spec.Kind {
+	case SinkKafka:
+		if spec.Kafka == nil {
+			return fmt.Errorf("kafka is required for sink %s", spec.Name)
+		}
+	case SinkHTTP:
+		if spec.HTTP == nil {
+			return fmt.Errorf("http is required for sink %s", spec.Name)
+		}
+	}
+	return nil
+}
+
+func (spec *BatchSpec) size() int {
+	if spec == nil || spec.Size <= 0 {
+		return defaultBatchSize
+	}
+	return spec.Size
+}
+
+func (spec *BatchSpec) maxRetries() int {
+	if spec == nil {
+		return 0
+	}
+	return spec.MaxRetries
+}
+
+func (spec *BatchSpec) retryInterval() time.Duration {
+	if spec == nil {
+		return defaultRetryInterval
+	}
+	d, err := time.ParseDuration(spec.RetryInterval)
+	if err != nil || d <= 0 {
+		return defaultRetryInterval
+	}
+	return d
+}
+
+func newSink(name string, spec *SinkSpec) sink {
+	switch spec.Kind {
+	case SinkKafka:
+		return &kafkaSink{name: name, spec: spec.Kafka, batch: spec.Batch}
+	case SinkHTTP:
+		return &httpSink{spec: spec.HTTP, client: &http.Client{Timeout: httpSinkTimeout}}
+	default:
+		return stdoutSink{}
+	}
+}
+
+// getProducer creates the producer lazily, as the brokers may be
+// unavailable when the sink is created.
+func (s *kafkaSink) getProducer() (sarama.AsyncProducer, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.producer != nil {
+		return s.producer, nil
+	}
+
+	// NOTE: Default config is good enough for now.
+	config := sarama.NewConfig()
+	config.ClientID = s.name
+	config.Version = sarama.V0_10_2_0
+	// Flush.Frequency must be set with Flush.Messages, otherwise the
+	// messages are sent only after the number of messages is reached.
+	config.Producer.Flush.Messages = s.batch.size()
+	config.Producer.Flush.Frequency = kafkaFlushFrequency
+	config.Producer.Retry.Max = s.batch.maxRetries()
+	config.Producer.Retry.Backoff = s.batch.retryInterval()
+
+	producer, err := sarama.NewAsyncProducer(s.spec.Brokers, config)
+	if err != nil {
+		msgFmt := "start sarama producer failed(brokers: %v): %v"
+		return nil, fmt.Errorf(msgFmt, s.spec.Brokers, err)
+	}
+
+	s.done = make(chan struct{})
+	go func(done chan struct{}) {
+		for {
+			select {
+			case <-done:
+				return
+			case err, ok := <-producer.Errors():
+				if !ok {
+					return
+				}
+				logger.Errorf("produce failed: %v", err)
+			}
+		}
+	}(s.done)
+
+	s.producer = producer
+	logger.Infof("%s build kafka producer successfully", s.name)
+
+	return producer, nil
+}
+
+func (s *kafkaSink) send(records [][]byte) error {
+	producer, err := s.getProducer()
+	if err != nil {
+		return err
+	}
+
+	for _, data := range records {
+		producer.Input() <- &sarama.ProducerMessage{
+			Topic: s.spec.Topic,
+			Value: sarama.ByteEncoder(data),
+		}
+	}
+	return nil
+}
+
+func (s *kafkaSink) health() error {
+	_, err := s.getProducer()
+	return err
+}
+
+func (s *kafkaSink) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.producer == nil {
+		return
+	}
+
+	close(s.done)
+	if err := s.producer.Close(); err != nil {
+		logger.Errorf("%s close kafka producer failed: %v", s.name, err)
+	}
+	s.producer = nil
+}
+
+// send sends the records as a JSON array.
+func (s *httpSink) send(records [][]byte) error {
+	body := bytes.NewBuffer(nil)
+	body.WriteByte('[')
+	for i, data := range records {
+		if i > 0 {
+			body.WriteByte(',')
+		}
+		body.Write(data)
+	}
+	body.WriteByte(']')
+
+	req, err := http.NewRequest(http.MethodPost, s.spec.URL, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.spec.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("send metrics to %s failed: status code %d", s.spec.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *httpSink) health() error {
+	return nil
+}
+
+func (s *httpSink) close() {
+	s.client.CloseIdleConnections()
+}
+
+func (s stdoutSink) send(records [][]byte) error {
+	for _, data := range records {
+		if _, err := fmt.Fprintf(os.Stdout, "%s\n", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s stdoutSink) health() error {
+	return nil
+}
+
+func (s stdoutSink) close() {}
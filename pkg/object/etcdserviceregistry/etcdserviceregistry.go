@@ -240,6 +240,18 @@ func (e *EtcdServiceRegistry) update() {
 	e.statusMutex.Unlock()
 }
 
+// Ready returns nil if the etcd client is built, so the pipelines using
+// the registry are ready to serve.
+func (e *EtcdServiceRegistry) Ready() error {
+	e.clientMutex.RLock()
+	defer e.clientMutex.RUnlock()
+
+	if e.client == nil {
+		return fmt.Errorf("etcd client is not built")
+	}
+	return nil
+}
+
 // Status returns status of EtcdServiceRegister.
 func (e *EtcdServiceRegistry) Status() *supervisor.Status {
 	s := &Status{}
@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eurekaserviceregistry
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	eurekaapi "github.com/ArthurHlt/go-eureka-client/eureka"
+)
+
+const (
+	actionTypeAdded    = "ADDED"
+	actionTypeModified = "MODIFIED"
+	actionTypeDeleted  = "DELETED"
+
+	deltaFetchTimeout = 5 * time.Second
+)
+
+type (
+	// deltaApplications is the response of the delta API of Eureka, the
+	// client library doesn't support the API.
+	deltaApplications struct {
+		XMLName      xml.Name           `xml:"applications"`
+		AppsHashcode string             `xml:"apps__hashcode"`
+		Applications []deltaApplication `xml:"application"`
+	}
+
+	deltaApplication struct {
+		Name      string          `xml:"name"`
+		Instances []deltaInstance `xml:"instance"`
+	}
+
+	deltaInstance struct {
+		eurekaapi.InstanceInfo
+		ActionType string `xml:"actionType"`
+	}
+)
+
+func instanceInfoKey(info *eurekaapi.InstanceInfo) string {
+	return info.App + "/" + info.InstanceID
+}
+
+// appsHashcode calculates the hashcode of the instances in the same way
+// as Eureka, it is the count of instances of every status, ordered by the
+// status, e.g. DOWN_1_UP_3_.
+func appsHashcode(infos map[string]*eurekaapi.InstanceInfo) string {
+	counts := map[string]int{}
+	for _, info := range infos {
+		counts[string(info.Status)]++
+	}
+
+	statuses := make([]string, 0, len(counts))
+	for status := range counts {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+
+	var b strings.Builder
+	for _, status := range statuses {
+		fmt.Fprintf(&b, "%s_%d_", status, counts[status])
+	}
+	return b.String()
+}
+
+// applyDelta applies the delta to the instances, and returns whether the
+// result is consistent with the server.
+func applyDelta(infos map[string]*eurekaapi.InstanceInfo, delta *deltaApplications) bool {
+	for _, app := range delta.Applications {
+		for i := range app.Instances {
+			instance := &app.Instances[i]
+			info := instance.InstanceInfo
+			if info.App == "" {
+				info.App = app.Name
+			}
+
+			switch instance.ActionType {
+			case actionTypeAdded, actionTypeModified:
+				infos[instanceInfoKey(&info)] = &info
+			case actionTypeDeleted:
+				delete(infos, instanceInfoKey(&info))
+			}
+		}
+	}
+
+	return appsHashcode(infos) == delta.AppsHashcode
+}
+
+// fetchDelta fetches the changes of the last few minutes from the first
+// available endpoint.
+func (e *EurekaServiceRegistry) fetchDelta() (*deltaApplications, error) {
+	var lastErr error
+	for _, endpoint := range e.spec.Endpoints {
+		delta, err := e.fetchDeltaFrom(endpoint)
+		if err == nil {
+			return delta, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func (e *EurekaServiceRegistry) fetchDeltaFrom(endpoint string) (*deltaApplications, error) {
+	url := strings.TrimRight(endpoint, "/") + "/apps/delta"
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/xml")
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s failed: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response of %s failed: %v", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s failed: status code %d", url, resp.StatusCode)
+	}
+
+	delta := &deltaApplications{}
+	if err := xml.Unmarshal(body, delta); err != nil {
+		return nil, fmt.Errorf("unmarshal response of %s failed: %v", url, err)
+	}
+	return delta, nil
+}
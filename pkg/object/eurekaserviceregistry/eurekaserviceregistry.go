@@ -19,6 +19,7 @@ package eurekaserviceregistry
 
 import (
 	"fmt"
+	"net/http"
 	"sync"
 	"time"
 
@@ -55,12 +56,19 @@ type (
 		instances       map[string]*serviceregistry.ServiceInstanceSpec
 		notify          chan *serviceregistry.RegistryEvent
 
+		// infos are the instances fetched from Eureka, the key is
+		// app/instanceID, they are kept to apply the deltas.
+		infos      map[string]*eurekaapi.InstanceInfo
+		httpClient *http.Client
+
 		clientMutex sync.RWMutex
 		client      *eurekaapi.Client
 
 		statusMutex  sync.Mutex
 		instancesNum map[string]int
 
+		registrar *serviceregistry.SelfRegistrar
+
 		done chan struct{}
 	}
 
@@ -68,6 +76,11 @@ type (
 	Spec struct {
 		Endpoints    []string `json:"endpoints" jsonschema:"required,uniqueItems=true"`
 		SyncInterval string   `json:"syncInterval" jsonschema:"required,format=duration"`
+		// DeltaInterval is the interval to fetch the changes, all instances
+		// are fetched every SyncInterval only if it is empty.
+		DeltaInterval string `json:"deltaInterval" jsonschema:"omitempty,format=duration"`
+
+		SelfRegistration *serviceregistry.SelfRegistrationSpec `json:"selfRegistration,omitempty" jsonschema:"omitempty"`
 	}
 
 	// Status is the status of EurekaServiceRegistry.
@@ -90,8 +103,9 @@ func (e *EurekaServiceRegistry) Kind() string {
 // DefaultSpec returns the default spec of EurekaServiceRegistry.
 func (e *EurekaServiceRegistry) DefaultSpec() interface{} {
 	return &Spec{
-		Endpoints:    []string{"http://127.0.0.1:8761/eureka"},
-		SyncInterval: "10s",
+		Endpoints:     []string{"http://127.0.0.1:8761/eureka"},
+		SyncInterval:  "10s",
+		DeltaInterval: "1s",
 	}
 }
 
@@ -112,6 +126,8 @@ func (e *EurekaServiceRegistry) reload() {
 		Instance().(*serviceregistry.ServiceRegistry)
 	e.notify = make(chan *serviceregistry.RegistryEvent, 10)
 	e.firstDone = false
+	e.infos = nil
+	e.httpClient = &http.Client{Timeout: deltaFetchTimeout}
 
 	e.instancesNum = make(map[string]int)
 	e.done = make(chan struct{})
@@ -121,6 +137,11 @@ func (e *EurekaServiceRegistry) reload() {
 		logger.Errorf("%s get eureka client failed: %v", e.superSpec.Name(), err)
 	}
 
+	e.registrar = nil
+	if e.spec.SelfRegistration != nil {
+		e.registrar = serviceregistry.NewSelfRegistrar(e.spec.SelfRegistration, e, e.superSpec.Super().Options())
+	}
+
 	e.serviceRegistry.RegisterRegistry(e)
 
 	go e.run()
@@ -175,20 +196,97 @@ func (e *EurekaServiceRegistry) run() {
 		return
 	}
 
+	var deltaCh <-chan time.Time
+	if e.spec.DeltaInterval != "" {
+		deltaInterval, err := time.ParseDuration(e.spec.DeltaInterval)
+		if err != nil {
+			logger.Errorf("BUG: parse duration %s failed: %v",
+				e.spec.DeltaInterval, err)
+			return
+		}
+		ticker := time.NewTicker(deltaInterval)
+		defer ticker.Stop()
+		deltaCh = ticker.C
+	}
+
 	e.update()
 
+	syncTimer := time.NewTimer(serviceregistry.JitterInterval(syncInterval))
+	defer syncTimer.Stop()
+
 	for {
 		select {
 		case <-e.done:
 			return
-		case <-time.After(syncInterval):
+		case <-syncTimer.C:
 			e.update()
+			syncTimer.Reset(serviceregistry.JitterInterval(syncInterval))
+		case <-deltaCh:
+			e.updateDelta()
 		}
 	}
 }
 
+// update renews the self registration and fetches all instances, it is
+// also the fallback if the deltas are missed.
 func (e *EurekaServiceRegistry) update() {
-	instances, err := e.ListAllServiceInstances()
+	if e.registrar != nil {
+		e.registrar.Sync()
+	}
+
+	e.fullSync()
+}
+
+func (e *EurekaServiceRegistry) fullSync() {
+	client, err := e.getClient()
+	if err != nil {
+		logger.Errorf("%s get eureka client failed: %v", e.superSpec.Name(), err)
+		return
+	}
+
+	apps, err := client.GetApplications()
+	if err != nil {
+		logger.Errorf("list all service instances failed: %v", err)
+		return
+	}
+
+	infos := make(map[string]*eurekaapi.InstanceInfo)
+	for _, app := range apps.Applications {
+		for i := range app.Instances {
+			info := &app.Instances[i]
+			infos[instanceInfoKey(info)] = info
+		}
+	}
+	e.infos = infos
+
+	e.notifyInstances()
+}
+
+// updateDelta fetches and applies the changes, all instances are fetched
+// if the result is inconsistent with the server.
+func (e *EurekaServiceRegistry) updateDelta() {
+	if e.infos == nil {
+		e.fullSync()
+		return
+	}
+
+	delta, err := e.fetchDelta()
+	if err != nil {
+		logger.Errorf("%s fetch delta failed: %v", e.superSpec.Name(), err)
+		return
+	}
+
+	if !applyDelta(e.infos, delta) {
+		logger.Debugf("%s apps hashcode mismatched, fetch all instances", e.superSpec.Name())
+		e.fullSync()
+		return
+	}
+
+	e.notifyInstances()
+}
+
+func (e *EurekaServiceRegistry) notifyInstances() {
+	instances, err := e.infosToServiceInstances(e.infos)
 	if err != nil {
 		logger.Errorf("list all service instances failed: %v", err)
 		return
@@ -223,6 +321,18 @@ func (e *EurekaServiceRegistry) update() {
 	e.statusMutex.Unlock()
 }
 
+// Ready returns nil if the eureka client is built, so the pipelines using
+// the registry are ready to serve.
+func (e *EurekaServiceRegistry) Ready() error {
+	e.clientMutex.RLock()
+	defer e.clientMutex.RUnlock()
+
+	if e.client == nil {
+		return fmt.Errorf("eureka client is not built")
+	}
+	return nil
+}
+
 // Status returns status of EurekaServiceRegister.
 func (e *EurekaServiceRegistry) Status() *supervisor.Status {
 	s := &Status{}
@@ -247,6 +357,10 @@ func (e *EurekaServiceRegistry) Status() *supervisor.Status {
 
 // Close closes EurekaServiceRegistry.
 func (e *EurekaServiceRegistry) Close() {
+	if e.registrar != nil {
+		e.registrar.Deregister()
+	}
+
 	e.serviceRegistry.DeregisterRegistry(e.Name())
 
 	close(e.done)
@@ -362,16 +476,26 @@ func (e *EurekaServiceRegistry) ListAllServiceInstances() (map[string]*servicere
 		return nil, err
 	}
 
-	instances := make(map[string]*serviceregistry.ServiceInstanceSpec)
+	infos := make(map[string]*eurekaapi.InstanceInfo)
 	for _, app := range apps.Applications {
-		for _, info := range app.Instances {
-			for _, serviceInstance := range e.instanceInfoToServiceInstances(&info) {
-				err := serviceInstance.Validate()
-				if err != nil {
-					return nil, fmt.Errorf("%+v is invalid: %v", serviceInstance, err)
-				}
-				instances[serviceInstance.Key()] = serviceInstance
+		for i := range app.Instances {
+			info := &app.Instances[i]
+			infos[instanceInfoKey(info)] = info
+		}
+	}
+
+	return e.infosToServiceInstances(infos)
+}
+
+func (e *EurekaServiceRegistry) infosToServiceInstances(infos map[string]*eurekaapi.InstanceInfo) (map[string]*serviceregistry.ServiceInstanceSpec, error) {
+	instances := make(map[string]*serviceregistry.ServiceInstanceSpec)
+	for _, info := range infos {
+		for _, serviceInstance := range e.instanceInfoToServiceInstances(info) {
+			err := serviceInstance.Validate()
+			if err != nil {
+				return nil, fmt.Errorf("%+v is invalid: %v", serviceInstance, err)
 			}
+			instances[serviceInstance.Key()] = serviceInstance
 		}
 	}
 
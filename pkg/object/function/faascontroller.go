@@ -72,11 +72,8 @@ func (f *FaasController) DefaultSpec() interface{} {
 
 // Validate validates the spec
 func (f *FaasController) Validate() error {
-	switch f.spec.Provider {
-	case spec.ProviderKnative:
-		//
-	default:
-		return fmt.Errorf("unknown FaaS provider: %s", f.spec.Provider)
+	if err := f.spec.Validate(); err != nil {
+		return err
 	}
 
 	vr := v.Validate(f.spec.HTTPServer)
@@ -104,7 +101,7 @@ func (f *FaasController) reload() {
 
 // Status returns Status generated by Runtime.
 func (f *FaasController) Status() *supervisor.Status {
-	return &supervisor.Status{}
+	return &supervisor.Status{ObjectStatus: f.worker.Status()}
 }
 
 // Close closes Function.
@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/cio"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/oci"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// the CFS period of the containers in microseconds.
+const cfsPeriod = 100000
+
+// containerdRuntime runs the containers by containerd.
+type containerdRuntime struct {
+	client *containerd.Client
+}
+
+func newContainerdRuntime(address, namespace string) (*containerdRuntime, error) {
+	client, err := containerd.New(address, containerd.WithDefaultNamespace(namespace))
+	if err != nil {
+		return nil, err
+	}
+	return &containerdRuntime{client: client}, nil
+}
+
+func (r *containerdRuntime) pull(ctx context.Context, image string) error {
+	_, err := r.client.Pull(ctx, image, containerd.WithPullUnpack)
+	return err
+}
+
+func (r *containerdRuntime) run(ctx context.Context, c *poolContainer) error {
+	image, err := r.client.GetImage(ctx, c.Image)
+	if err != nil {
+		return err
+	}
+
+	specOpts := []oci.SpecOpts{
+		oci.WithImageConfig(image),
+		oci.WithHostNamespace(specs.NetworkNamespace),
+		oci.WithHostHostsFile,
+		oci.WithHostResolvconf,
+		oci.WithEnv(c.Env),
+	}
+	if c.Memory > 0 {
+		specOpts = append(specOpts, oci.WithMemoryLimit(uint64(c.Memory)))
+	}
+	if c.MilliCPU > 0 {
+		specOpts = append(specOpts, oci.WithCPUCFS(c.MilliCPU*cfsPeriod/1000, cfsPeriod))
+	}
+
+	container, err := r.client.NewContainer(ctx, c.ID,
+		containerd.WithImage(image),
+		containerd.WithNewSnapshot(c.ID, image),
+		containerd.WithNewSpec(specOpts...),
+		containerd.WithContainerLabels(c.Labels),
+	)
+	if err != nil {
+		return err
+	}
+
+	task, err := container.NewTask(ctx, cio.NullIO)
+	if err == nil {
+		if err = task.Start(ctx); err != nil {
+			task.Delete(ctx, containerd.WithProcessKill)
+		}
+	}
+	if err != nil {
+		container.Delete(ctx, containerd.WithSnapshotCleanup)
+		return err
+	}
+	return nil
+}
+
+func (r *containerdRuntime) list(ctx context.Context, labels map[string]string) ([]*poolContainer, error) {
+	filters := make([]string, 0, len(labels))
+	for k, v := range labels {
+		filters = append(filters, fmt.Sprintf("labels.%q==%q", k, v))
+	}
+
+	containers, err := r.client.Containers(ctx, strings.Join(filters, ","))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*poolContainer, 0, len(containers))
+	for _, container := range containers {
+		info, err := container.Info(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c := &poolContainer{
+			ID:     info.ID,
+			Image:  info.Image,
+			Labels: info.Labels,
+			Status: "created",
+		}
+
+		task, err := container.Task(ctx, nil)
+		if err != nil && !errdefs.IsNotFound(err) {
+			return nil, err
+		}
+		if err == nil {
+			status, err := task.Status(ctx)
+			if err != nil {
+				return nil, err
+			}
+			c.Status = string(status.Status)
+			c.Running = status.Status == containerd.Running
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+func (r *containerdRuntime) remove(ctx context.Context, id string) error {
+	container, err := r.client.LoadContainer(ctx, id)
+	if errdefs.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	task, err := container.Task(ctx, nil)
+	if err == nil {
+		_, err = task.Delete(ctx, containerd.WithProcessKill)
+	}
+	if err != nil && !errdefs.IsNotFound(err) {
+		return err
+	}
+	return container.Delete(ctx, containerd.WithSnapshotCleanup)
+}
+
+func (r *containerdRuntime) close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,416 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	k8sresource "k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/google/uuid"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/function/spec"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	defaultContainerdAddress    = "/run/containerd/containerd.sock"
+	defaultContainerdNamespace  = "easegress"
+	defaultContainerPoolHostIP  = "127.0.0.1"
+	defaultContainerPoolTimeout = 30 * time.Second
+
+	// pulling an image may take much longer than other calls.
+	imagePullTimeout = 10 * time.Minute
+
+	labelController  = "easegress.faas.controller"
+	labelFunction    = "easegress.faas.function"
+	labelPort        = "easegress.faas.port"
+	labelLimitCPU    = "easegress.faas.limitCPU"
+	labelLimitMemory = "easegress.faas.limitMemory"
+)
+
+type (
+	// containerPool runs the containers of the functions on a single host
+	// by containerd, the instances of a function are load balanced by the
+	// ingress.
+	//
+	// The containers share the network of the host, so every container
+	// listens on its own port, which is passed to it by the environment
+	// variable PORT.
+	containerPool struct {
+		superSpec *supervisor.Spec
+		spec      *spec.ContainerPool
+		runtime   containerRuntime
+		hostIP    string
+		timeout   time.Duration
+	}
+
+	// containerRuntime runs the containers, it is containerd except in
+	// tests.
+	containerRuntime interface {
+		pull(ctx context.Context, image string) error
+		run(ctx context.Context, c *poolContainer) error
+		// list lists the containers with all of the labels.
+		list(ctx context.Context, labels map[string]string) ([]*poolContainer, error)
+		remove(ctx context.Context, id string) error
+		close() error
+	}
+
+	// poolContainer is a container of a function.
+	poolContainer struct {
+		ID     string
+		Image  string
+		Labels map[string]string
+		// Env is the environment variables of the container.
+		Env []string
+		// Memory is the memory limit in bytes, and MilliCPU is the CPU
+		// limit in millicores, zero means no limit.
+		Memory   int64
+		MilliCPU int64
+		// Running is whether the task of the container is running, and
+		// Status is the status of the task.
+		Running bool
+		Status  string
+	}
+)
+
+// Init initializes the container pool.
+func (cp *containerPool) Init() error {
+	adm := cp.superSpec.ObjectSpec().(*spec.Admin)
+	cp.spec = adm.ContainerPool
+	if cp.spec == nil {
+		cp.spec = &spec.ContainerPool{}
+	}
+
+	cp.hostIP = cp.spec.HostIP
+	if cp.hostIP == "" {
+		cp.hostIP = defaultContainerPoolHostIP
+	}
+
+	var err error
+	cp.timeout, err = parseTimeout(cp.spec.Timeout, defaultContainerPoolTimeout)
+	if err != nil {
+		logger.Errorf("BUG: parse container pool timeout: %s failed: %v", cp.spec.Timeout, err)
+		return err
+	}
+
+	if cp.runtime != nil {
+		return nil
+	}
+
+	address := cp.spec.Address
+	if address == "" {
+		address = defaultContainerdAddress
+	}
+	namespace := cp.spec.Namespace
+	if namespace == "" {
+		namespace = defaultContainerdNamespace
+	}
+	cp.runtime, err = newContainerdRuntime(address, namespace)
+	if err != nil {
+		logger.Errorf("connect to containerd %s failed: %v", address, err)
+		return err
+	}
+	return nil
+}
+
+// Close closes the connection to containerd.
+func (cp *containerPool) Close() error {
+	if cp.runtime == nil {
+		return nil
+	}
+	return cp.runtime.close()
+}
+
+// pullImage pulls the image of the function.
+func (cp *containerPool) pullImage(image string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), imagePullTimeout)
+	defer cancel()
+
+	if err := cp.runtime.pull(ctx, image); err != nil {
+		return fmt.Errorf("pull image %s failed: %v", image, err)
+	}
+	return nil
+}
+
+// list lists the containers of the function, sorted by their IDs.
+func (cp *containerPool) list(name string) ([]*poolContainer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cp.timeout)
+	defer cancel()
+
+	containers, err := cp.runtime.list(ctx, map[string]string{
+		labelController: cp.superSpec.Name(),
+		labelFunction:   name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].ID < containers[j].ID
+	})
+	return containers, nil
+}
+
+// freePort returns a free port of the host IP.
+func (cp *containerPool) freePort() (int, error) {
+	l, err := net.Listen("tcp", net.JoinHostPort(cp.hostIP, "0"))
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// runContainer creates and starts a container of the function.
+func (cp *containerPool) runContainer(funcSpec *spec.Spec) error {
+	port, err := cp.freePort()
+	if err != nil {
+		return fmt.Errorf("allocate port of function %s failed: %v", funcSpec.Name, err)
+	}
+
+	c := &poolContainer{
+		ID:    fmt.Sprintf("easegress-%s-%s", funcSpec.Name, uuid.NewString()[:8]),
+		Image: funcSpec.Image,
+		Labels: map[string]string{
+			labelController:  cp.superSpec.Name(),
+			labelFunction:    funcSpec.Name,
+			labelPort:        strconv.Itoa(port),
+			labelLimitCPU:    funcSpec.LimitCPU,
+			labelLimitMemory: funcSpec.LimitMemory,
+		},
+		Env: []string{"PORT=" + strconv.Itoa(port)},
+	}
+	if q, err := k8sresource.ParseQuantity(funcSpec.LimitMemory); err == nil {
+		c.Memory = q.Value()
+	}
+	if q, err := k8sresource.ParseQuantity(funcSpec.LimitCPU); err == nil {
+		c.MilliCPU = q.MilliValue()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cp.timeout)
+	defer cancel()
+	if err = cp.runtime.run(ctx, c); err != nil {
+		return fmt.Errorf("run container of function %s failed: %v", funcSpec.Name, err)
+	}
+	return nil
+}
+
+func (cp *containerPool) removeContainer(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cp.timeout)
+	defer cancel()
+
+	if err := cp.runtime.remove(ctx, id); err != nil {
+		return fmt.Errorf("remove container %s failed: %v", id, err)
+	}
+	return nil
+}
+
+// initialReplicas returns the initial number of containers of the function.
+func initialReplicas(funcSpec *spec.Spec) int {
+	if funcSpec.MinReplica > 0 {
+		return funcSpec.MinReplica
+	}
+	return 1
+}
+
+// Create pulls the image and runs the containers of the function.
+func (cp *containerPool) Create(funcSpec *spec.Spec) error {
+	if err := cp.pullImage(funcSpec.Image); err != nil {
+		logger.Errorf("create function %s: %v", funcSpec.Name, err)
+		return err
+	}
+
+	for i := 0; i < initialReplicas(funcSpec); i++ {
+		if err := cp.runContainer(funcSpec); err != nil {
+			logger.Errorf("create function %s: %v", funcSpec.Name, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// Update replaces the containers of the function, the new containers are
+// started before the old ones are removed.
+func (cp *containerPool) Update(funcSpec *spec.Spec) error {
+	old, err := cp.list(funcSpec.Name)
+	if err != nil {
+		logger.Errorf("list containers of function %s failed: %v", funcSpec.Name, err)
+		return err
+	}
+
+	if err = cp.pullImage(funcSpec.Image); err != nil {
+		logger.Errorf("update function %s: %v", funcSpec.Name, err)
+		return err
+	}
+
+	n := len(old)
+	if n < initialReplicas(funcSpec) {
+		n = initialReplicas(funcSpec)
+	}
+	if funcSpec.MaxReplica > 0 && n > funcSpec.MaxReplica {
+		n = funcSpec.MaxReplica
+	}
+	for i := 0; i < n; i++ {
+		if err = cp.runContainer(funcSpec); err != nil {
+			logger.Errorf("update function %s: %v", funcSpec.Name, err)
+			return err
+		}
+	}
+
+	for _, c := range old {
+		if err = cp.removeContainer(c.ID); err != nil {
+			logger.Errorf("update function %s: %v", funcSpec.Name, err)
+		}
+	}
+	return nil
+}
+
+// Delete removes all containers of the function.
+func (cp *containerPool) Delete(name string) error {
+	containers, err := cp.list(name)
+	if err != nil {
+		logger.Errorf("list containers of function %s failed: %v", name, err)
+		return err
+	}
+
+	for _, c := range containers {
+		if err = cp.removeContainer(c.ID); err != nil {
+			logger.Errorf("delete function %s: %v", name, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// GetStatus returns the status of the function, which is ready if all of
+// its containers are running.
+func (cp *containerPool) GetStatus(name string) (*spec.Status, error) {
+	containers, err := cp.list(name)
+	if err != nil {
+		logger.Errorf("list containers of function %s failed: %v", name, err)
+		return nil, err
+	}
+
+	status := &spec.Status{ExtData: map[string]string{}}
+	if len(containers) == 0 {
+		status.Event = spec.ErrorEvent
+		status.ExtData["error"] = "no container"
+		return status, nil
+	}
+
+	status.Event = spec.ReadyEvent
+	for _, c := range containers {
+		status.ExtData[c.ID] = c.Status
+		if !c.Running {
+			status.Event = spec.ErrorEvent
+		}
+	}
+	return status, nil
+}
+
+// Scale runs more containers if the function has fewer running containers
+// than replicas, the containers not running are replaced, as containerd
+// doesn't restart them.
+func (cp *containerPool) Scale(name string, replicas int) error {
+	containers, err := cp.list(name)
+	if err != nil {
+		logger.Errorf("list containers of function %s failed: %v", name, err)
+		return err
+	}
+	if len(containers) == 0 {
+		return fmt.Errorf("function %s has no container to scale from", name)
+	}
+
+	// the spec of the function is rebuilt from the existing container.
+	funcSpec := specOfContainer(name, containers[0])
+
+	running := 0
+	for _, c := range containers {
+		if c.Running {
+			running++
+			continue
+		}
+		if err = cp.removeContainer(c.ID); err != nil {
+			logger.Errorf("scale function %s: %v", name, err)
+		}
+	}
+
+	for i := running; i < replicas; i++ {
+		if err = cp.runContainer(funcSpec); err != nil {
+			logger.Errorf("scale function %s: %v", name, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// specOfContainer returns the spec to run more containers of the function
+// from one of its containers.
+func specOfContainer(name string, c *poolContainer) *spec.Spec {
+	return &spec.Spec{
+		Name:        name,
+		Image:       c.Image,
+		LimitCPU:    c.Labels[labelLimitCPU],
+		LimitMemory: c.Labels[labelLimitMemory],
+	}
+}
+
+// Replicas returns the number of running containers of the function.
+func (cp *containerPool) Replicas(name string) (int, error) {
+	containers, err := cp.list(name)
+	if err != nil {
+		logger.Errorf("list containers of function %s failed: %v", name, err)
+		return 0, err
+	}
+
+	replicas := 0
+	for _, c := range containers {
+		if c.Running {
+			replicas++
+		}
+	}
+	return replicas, nil
+}
+
+// Endpoint returns the ports of the running containers of the function.
+func (cp *containerPool) Endpoint(funcSpec *spec.Spec) (*Endpoint, error) {
+	containers, err := cp.list(funcSpec.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	ep := &Endpoint{}
+	for _, c := range containers {
+		port := c.Labels[labelPort]
+		if !c.Running || port == "" {
+			continue
+		}
+		ep.Servers = append(ep.Servers, "http://"+net.JoinHostPort(cp.hostIP, port))
+	}
+
+	if len(ep.Servers) == 0 {
+		return nil, fmt.Errorf("function %s has no running container", funcSpec.Name)
+	}
+	return ep, nil
+}
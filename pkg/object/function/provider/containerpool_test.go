@@ -0,0 +1,250 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/object/function/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+// testRuntime runs the containers as HTTP servers listening on the ports
+// given to the containers.
+type testRuntime struct {
+	mutex      sync.Mutex
+	images     []string
+	containers map[string]*poolContainer
+	servers    map[string]*httptest.Server
+}
+
+func newTestRuntime() *testRuntime {
+	return &testRuntime{
+		containers: map[string]*poolContainer{},
+		servers:    map[string]*httptest.Server{},
+	}
+}
+
+func (r *testRuntime) pull(ctx context.Context, image string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if image == "missing" {
+		return fmt.Errorf("image %s not found", image)
+	}
+	r.images = append(r.images, image)
+	return nil
+}
+
+func (r *testRuntime) run(ctx context.Context, c *poolContainer) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	l, err := net.Listen("tcp", "127.0.0.1:"+c.Labels[labelPort])
+	if err != nil {
+		return err
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("invoked " + c.ID + req.URL.Path))
+	}))
+	server.Listener.Close()
+	server.Listener = l
+	server.Start()
+
+	c.Running, c.Status = true, "running"
+	r.containers[c.ID] = c
+	r.servers[c.ID] = server
+	return nil
+}
+
+func (r *testRuntime) list(ctx context.Context, labels map[string]string) ([]*poolContainer, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var result []*poolContainer
+	for _, c := range r.containers {
+		matched := true
+		for k, v := range labels {
+			if c.Labels[k] != v {
+				matched = false
+			}
+		}
+		if matched {
+			copied := *c
+			result = append(result, &copied)
+		}
+	}
+	return result, nil
+}
+
+// stop stops the container like it exits.
+func (r *testRuntime) stop(id string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.servers[id].Close()
+	r.containers[id].Running, r.containers[id].Status = false, "stopped"
+}
+
+func (r *testRuntime) remove(ctx context.Context, id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if server := r.servers[id]; server != nil {
+		server.Close()
+	}
+	delete(r.servers, id)
+	delete(r.containers, id)
+	return nil
+}
+
+func (r *testRuntime) close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, server := range r.servers {
+		server.Close()
+	}
+	return nil
+}
+
+func (r *testRuntime) container(id string) *poolContainer {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.containers[id]
+}
+
+func TestContainerPool(t *testing.T) {
+	assert := assert.New(t)
+
+	runtime := newTestRuntime()
+
+	// the runtime is set before the initialization, so it isn't replaced
+	// by containerd.
+	p := NewProvider(newTestSuperSpec(t, "provider: containerpool\n")).(*containerPool)
+	p.runtime = runtime
+	assert.NoError(p.Init())
+	defer p.Close()
+	assert.Equal(defaultContainerPoolHostIP, p.hostIP)
+	assert.Equal(defaultContainerPoolTimeout, p.timeout)
+
+	funcSpec := newTestFuncSpec()
+	funcSpec.MinReplica = 2
+	servers := func() []string {
+		ep, err := p.Endpoint(funcSpec)
+		assert.NoError(err)
+		return ep.Servers
+	}
+
+	// deploy
+	funcSpec.Image = "missing"
+	assert.Error(p.Create(funcSpec))
+	funcSpec.Image = "demo:1.0"
+	assert.NoError(p.Create(funcSpec))
+	assert.Equal([]string{"demo:1.0"}, runtime.images)
+
+	containers, err := p.list("demo")
+	assert.NoError(err)
+	assert.Len(containers, 2)
+	for _, c := range containers {
+		c = runtime.container(c.ID)
+		assert.Equal("demo:1.0", c.Image)
+		assert.Equal(int64(128*1024*1024), c.Memory)
+		assert.Equal(int64(500), c.MilliCPU)
+		assert.Equal([]string{"PORT=" + c.Labels[labelPort]}, c.Env)
+		assert.Equal("faas-controller", c.Labels[labelController])
+	}
+
+	status, err := p.GetStatus("demo")
+	assert.NoError(err)
+	assert.Equal(spec.ReadyEvent, status.Event)
+	assert.Len(status.ExtData, 2)
+
+	// invoke
+	ep, err := p.Endpoint(funcSpec)
+	assert.NoError(err)
+	assert.Len(ep.Servers, 2)
+	for i, c := range containers {
+		assert.Equal("http://127.0.0.1:"+c.Labels[labelPort], ep.Servers[i])
+		assert.Equal("invoked "+c.ID+"/hello", invoke(t, ep, i))
+	}
+
+	// scale
+	assert.NoError(p.Scale("demo", 3))
+	replicas, err := p.Replicas("demo")
+	assert.NoError(err)
+	assert.Equal(3, replicas)
+	assert.Len(servers(), 3)
+
+	assert.NoError(p.Scale("demo", 1))
+	replicas, err = p.Replicas("demo")
+	assert.NoError(err)
+	assert.Equal(3, replicas)
+
+	runtime.stop(containers[0].ID)
+	status, err = p.GetStatus("demo")
+	assert.NoError(err)
+	assert.Equal(spec.ErrorEvent, status.Event)
+	assert.Equal("stopped", status.ExtData[containers[0].ID])
+	assert.Len(servers(), 2)
+
+	// the stopped container is replaced.
+	assert.NoError(p.Scale("demo", 3))
+	assert.Nil(runtime.container(containers[0].ID))
+	ep, err = p.Endpoint(funcSpec)
+	assert.NoError(err)
+	assert.Len(ep.Servers, 3)
+	for i := range ep.Servers {
+		invoke(t, ep, i)
+	}
+	containers, err = p.list("demo")
+	assert.NoError(err)
+	for _, c := range containers {
+		assert.Equal("500m", c.Labels[labelLimitCPU])
+		assert.Equal("128Mi", c.Labels[labelLimitMemory])
+	}
+
+	// update
+	funcSpec.Image = "demo:2.0"
+	assert.NoError(p.Update(funcSpec))
+	containers, err = p.list("demo")
+	assert.NoError(err)
+	assert.Len(containers, 3)
+	for _, c := range containers {
+		assert.Equal("demo:2.0", c.Image)
+	}
+
+	// delete
+	assert.NoError(p.Delete("demo"))
+	_, err = p.Endpoint(funcSpec)
+	assert.Error(err)
+	assert.Error(p.Scale("demo", 1))
+	status, err = p.GetStatus("demo")
+	assert.NoError(err)
+	assert.Equal(spec.ErrorEvent, status.Event)
+	for _, c := range containers {
+		_, err = http.Get("http://127.0.0.1:" + c.Labels[labelPort])
+		assert.Error(err)
+	}
+}
@@ -0,0 +1,338 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	k8sapisv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/function/spec"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	defaultFissionTimeout   = 5 * time.Second
+	defaultFissionNamespace = "default"
+	// the namespace Fission runs the instances of functions in.
+	defaultFissionFunctionNamespace = "fission-function"
+
+	fissionAPIVersion = "fission.io/v1"
+)
+
+var (
+	fissionFunctionGVR = schema.GroupVersionResource{Group: "fission.io", Version: "v1", Resource: "functions"}
+	fissionTriggerGVR  = schema.GroupVersionResource{Group: "fission.io", Version: "v1", Resource: "httptriggers"}
+	deploymentGVR      = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+)
+
+type (
+	// fissionClient manages the container functions of Fission by its
+	// custom resources.
+	fissionClient struct {
+		superSpec *supervisor.Spec
+		spec      *spec.Fission
+		dynamic   dynamic.Interface
+		namespace string
+		timeout   time.Duration
+	}
+)
+
+// Init initializes the Fission client.
+func (fc *fissionClient) Init() error {
+	adm := fc.superSpec.ObjectSpec().(*spec.Admin)
+	fc.spec = adm.Fission
+
+	fc.namespace = fc.spec.Namespace
+	if fc.namespace == "" {
+		fc.namespace = defaultFissionNamespace
+	}
+
+	var err error
+	fc.timeout, err = parseTimeout(fc.spec.Timeout, defaultFissionTimeout)
+	if err != nil {
+		logger.Errorf("BUG: parse fission timeout: %s failed: %v", fc.spec.Timeout, err)
+		return err
+	}
+
+	cfg, err := clientcmd.BuildConfigFromFlags(fc.spec.MasterURL, fc.spec.KubeConfig)
+	if err != nil {
+		logger.Errorf("build kubeconfig for fission failed: %v", err)
+		return err
+	}
+	fc.dynamic, err = dynamic.NewForConfig(cfg)
+	if err != nil {
+		logger.Errorf("build kubernetes dynamic client for fission failed: %v", err)
+		return err
+	}
+	return nil
+}
+
+// triggerName returns the name of the HTTP trigger of the function.
+func triggerName(name string) string {
+	return "easegress-" + name
+}
+
+// triggerPrefix returns the URL prefix of the HTTP trigger of the function.
+func triggerPrefix(name string) string {
+	return "/easegress/" + name
+}
+
+// fissionFunctionSpec returns the spec of the Fission function, which runs
+// the image of the function as a container function.
+func (fc *fissionClient) fissionFunctionSpec(funcSpec *spec.Spec) map[string]interface{} {
+	port := funcSpec.Port
+	if port == 0 {
+		port = 8080
+	}
+
+	container := map[string]interface{}{
+		"name":  funcSpec.Name,
+		"image": funcSpec.Image,
+		"ports": []interface{}{
+			map[string]interface{}{"containerPort": int64(port), "name": "http-env"},
+		},
+		"resources": map[string]interface{}{
+			"limits":   map[string]interface{}{"cpu": funcSpec.LimitCPU, "memory": funcSpec.LimitMemory},
+			"requests": map[string]interface{}{"cpu": funcSpec.RequestCPU, "memory": funcSpec.RequestMemory},
+		},
+	}
+
+	strategy := map[string]interface{}{
+		"ExecutorType": "container",
+		"MinScale":     int64(funcSpec.MinReplica),
+		"MaxScale":     int64(funcSpec.MaxReplica),
+	}
+	if funcSpec.AutoScaleType == spec.AutoScaleMetricCPU {
+		if percent, err := strconv.Atoi(funcSpec.AutoScaleValue); err == nil {
+			strategy["TargetCPUPercent"] = int64(percent)
+		}
+	}
+
+	return map[string]interface{}{
+		"environment": map[string]interface{}{"name": "", "namespace": fc.namespace},
+		"InvokeStrategy": map[string]interface{}{
+			"StrategyType":      "execution",
+			"ExecutionStrategy": strategy,
+		},
+		"podspec": map[string]interface{}{
+			"containers": []interface{}{container},
+		},
+	}
+}
+
+func (fc *fissionClient) newFunction(funcSpec *spec.Spec) *unstructured.Unstructured {
+	fn := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": fc.fissionFunctionSpec(funcSpec),
+	}}
+	fn.SetAPIVersion(fissionAPIVersion)
+	fn.SetKind("Function")
+	fn.SetName(funcSpec.Name)
+	fn.SetNamespace(fc.namespace)
+	return fn
+}
+
+func (fc *fissionClient) newTrigger(funcSpec *spec.Spec) *unstructured.Unstructured {
+	trigger := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"prefix":  triggerPrefix(funcSpec.Name),
+			"methods": []interface{}{"GET", "POST", "PUT", "DELETE", "PATCH", "HEAD", "OPTIONS"},
+			"functionref": map[string]interface{}{
+				"type": "name",
+				"name": funcSpec.Name,
+			},
+		},
+	}}
+	trigger.SetAPIVersion(fissionAPIVersion)
+	trigger.SetKind("HTTPTrigger")
+	trigger.SetName(triggerName(funcSpec.Name))
+	trigger.SetNamespace(fc.namespace)
+	return trigger
+}
+
+// Create creates the function and its HTTP trigger.
+func (fc *fissionClient) Create(funcSpec *spec.Spec) error {
+	ctx, cancel := context.WithTimeout(context.Background(), fc.timeout)
+	defer cancel()
+
+	functions := fc.dynamic.Resource(fissionFunctionGVR).Namespace(fc.namespace)
+	if _, err := functions.Create(ctx, fc.newFunction(funcSpec), k8sapisv1.CreateOptions{}); err != nil {
+		logger.Errorf("create fission function: %s failed: %v", funcSpec.Name, err)
+		return err
+	}
+
+	triggers := fc.dynamic.Resource(fissionTriggerGVR).Namespace(fc.namespace)
+	if _, err := triggers.Create(ctx, fc.newTrigger(funcSpec), k8sapisv1.CreateOptions{}); err != nil {
+		logger.Errorf("create fission http trigger of function: %s failed: %v", funcSpec.Name, err)
+		return err
+	}
+	return nil
+}
+
+// Update updates the spec of the function.
+func (fc *fissionClient) Update(funcSpec *spec.Spec) error {
+	ctx, cancel := context.WithTimeout(context.Background(), fc.timeout)
+	defer cancel()
+
+	functions := fc.dynamic.Resource(fissionFunctionGVR).Namespace(fc.namespace)
+	fn, err := functions.Get(ctx, funcSpec.Name, k8sapisv1.GetOptions{})
+	if err != nil {
+		logger.Errorf("get fission function: %s failed: %v", funcSpec.Name, err)
+		return err
+	}
+
+	fn.Object["spec"] = fc.fissionFunctionSpec(funcSpec)
+	if _, err = functions.Update(ctx, fn, k8sapisv1.UpdateOptions{}); err != nil {
+		logger.Errorf("update fission function: %s failed: %v", funcSpec.Name, err)
+		return err
+	}
+	return nil
+}
+
+// Delete deletes the function and its HTTP trigger.
+func (fc *fissionClient) Delete(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), fc.timeout)
+	defer cancel()
+
+	triggers := fc.dynamic.Resource(fissionTriggerGVR).Namespace(fc.namespace)
+	err := triggers.Delete(ctx, triggerName(name), k8sapisv1.DeleteOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		logger.Errorf("delete fission http trigger of function: %s failed: %v", name, err)
+		return err
+	}
+
+	functions := fc.dynamic.Resource(fissionFunctionGVR).Namespace(fc.namespace)
+	err = functions.Delete(ctx, name, k8sapisv1.DeleteOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		logger.Errorf("delete fission function: %s failed: %v", name, err)
+		return err
+	}
+	return nil
+}
+
+// GetStatus returns the status of the function. Fission has no status of
+// functions, the function is ready if both the function and the trigger
+// exist, as the router of Fission starts the function on demand.
+func (fc *fissionClient) GetStatus(name string) (*spec.Status, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), fc.timeout)
+	defer cancel()
+
+	notFound := func(what string) *spec.Status {
+		return &spec.Status{
+			Event:   spec.ErrorEvent,
+			ExtData: map[string]string{"error": what + " not found in Fission"},
+		}
+	}
+
+	_, err := fc.dynamic.Resource(fissionFunctionGVR).Namespace(fc.namespace).Get(ctx, name, k8sapisv1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return notFound("function"), nil
+	}
+	if err != nil {
+		logger.Errorf("fission get function: %s, err: %v", name, err)
+		return nil, err
+	}
+
+	_, err = fc.dynamic.Resource(fissionTriggerGVR).Namespace(fc.namespace).Get(ctx, triggerName(name), k8sapisv1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return notFound("http trigger"), nil
+	}
+	if err != nil {
+		logger.Errorf("fission get http trigger of function: %s, err: %v", name, err)
+		return nil, err
+	}
+
+	return &spec.Status{Event: spec.ReadyEvent}, nil
+}
+
+// Scale keeps at least replicas instances of the function by setting the
+// min scale of the execution strategy, the same as Knative.
+func (fc *fissionClient) Scale(name string, replicas int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), fc.timeout)
+	defer cancel()
+
+	functions := fc.dynamic.Resource(fissionFunctionGVR).Namespace(fc.namespace)
+	fn, err := functions.Get(ctx, name, k8sapisv1.GetOptions{})
+	if err != nil {
+		logger.Errorf("get fission function: %s failed: %v", name, err)
+		return err
+	}
+
+	path := []string{"spec", "InvokeStrategy", "ExecutionStrategy"}
+	min, _, _ := unstructured.NestedInt64(fn.Object, append(path, "MinScale")...)
+	if min == int64(replicas) {
+		return nil
+	}
+	max, _, _ := unstructured.NestedInt64(fn.Object, append(path, "MaxScale")...)
+	if max != 0 && max < int64(replicas) {
+		return fmt.Errorf("replicas %d exceeds the max scale %d of function %s", replicas, max, name)
+	}
+
+	if err = unstructured.SetNestedField(fn.Object, int64(replicas), append(path, "MinScale")...); err != nil {
+		return err
+	}
+	if _, err = functions.Update(ctx, fn, k8sapisv1.UpdateOptions{}); err != nil {
+		logger.Errorf("scale fission function: %s to %d failed: %v", name, replicas, err)
+		return err
+	}
+	return nil
+}
+
+// Replicas returns the ready replicas of the deployments Fission runs the
+// function by.
+func (fc *fissionClient) Replicas(name string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), fc.timeout)
+	defer cancel()
+
+	namespace := fc.spec.FunctionNamespace
+	if namespace == "" {
+		namespace = defaultFissionFunctionNamespace
+	}
+	deployments, err := fc.dynamic.Resource(deploymentGVR).Namespace(namespace).List(ctx,
+		k8sapisv1.ListOptions{LabelSelector: "functionName=" + name})
+	if err != nil {
+		logger.Errorf("fission list deployments of function: %s, err: %v", name, err)
+		return 0, err
+	}
+
+	replicas := int64(0)
+	for _, d := range deployments.Items {
+		n, _, _ := unstructured.NestedInt64(d.Object, "status", "readyReplicas")
+		replicas += n
+	}
+	return int(replicas), nil
+}
+
+// Endpoint returns the router of Fission, which invokes the function by
+// the prefix of its HTTP trigger.
+func (fc *fissionClient) Endpoint(funcSpec *spec.Spec) (*Endpoint, error) {
+	return &Endpoint{
+		Servers:    []string{strings.TrimSuffix(fc.spec.RouterURL, "/")},
+		PathPrefix: triggerPrefix(funcSpec.Name),
+	}, nil
+}
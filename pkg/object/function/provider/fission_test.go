@@ -0,0 +1,238 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	k8sapisv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/megaease/easegress/pkg/object/function/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+// testAPIServer is a Kubernetes API server keeping the resources in
+// memory, the resources are keyed by the path of their collections and
+// their names.
+type testAPIServer struct {
+	mutex     sync.Mutex
+	resources map[string]map[string]map[string]interface{}
+}
+
+func newTestAPIServer() *testAPIServer {
+	return &testAPIServer{resources: map[string]map[string]map[string]interface{}{}}
+}
+
+func (s *testAPIServer) put(collection, name string, obj map[string]interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.resources[collection] == nil {
+		s.resources[collection] = map[string]map[string]interface{}{}
+	}
+	s.resources[collection][name] = obj
+}
+
+func (s *testAPIServer) writeStatus(w http.ResponseWriter, code int, reason string) {
+	status := "Success"
+	if code >= 300 {
+		status = "Failure"
+	}
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"kind":       "Status",
+		"apiVersion": "v1",
+		"metadata":   map[string]interface{}{},
+		"status":     status,
+		"reason":     reason,
+		"code":       code,
+	})
+}
+
+func (s *testAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// /apis/<group>/<version>/namespaces/<namespace>/<resource>[/<name>]
+	collection, name := r.URL.Path, ""
+	if strings.Count(r.URL.Path, "/") == 7 {
+		i := strings.LastIndex(r.URL.Path, "/")
+		collection, name = r.URL.Path[:i], r.URL.Path[i+1:]
+	}
+	objs := s.resources[collection]
+	if objs == nil {
+		objs = map[string]map[string]interface{}{}
+		s.resources[collection] = objs
+	}
+
+	if name == "" && r.Method == http.MethodGet {
+		selector := strings.SplitN(r.URL.Query().Get("labelSelector"), "=", 2)
+		items := []interface{}{}
+		for _, obj := range objs {
+			labels, _, _ := unstructured.NestedStringMap(obj, "metadata", "labels")
+			if len(selector) == 2 && labels[selector[0]] != selector[1] {
+				continue
+			}
+			items = append(items, obj)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "List",
+			"metadata":   map[string]interface{}{},
+			"items":      items,
+		})
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		obj := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&obj)
+		name, _, _ = unstructured.NestedString(obj, "metadata", "name")
+		if objs[name] != nil {
+			s.writeStatus(w, http.StatusConflict, "AlreadyExists")
+			return
+		}
+		objs[name] = obj
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(obj)
+		return
+	}
+
+	if objs[name] == nil {
+		s.writeStatus(w, http.StatusNotFound, "NotFound")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		json.NewEncoder(w).Encode(objs[name])
+	case http.MethodPut:
+		obj := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&obj)
+		objs[name] = obj
+		json.NewEncoder(w).Encode(obj)
+	case http.MethodDelete:
+		delete(objs, name)
+		s.writeStatus(w, http.StatusOK, "")
+	default:
+		s.writeStatus(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func TestFission(t *testing.T) {
+	assert := assert.New(t)
+
+	apiServer := newTestAPIServer()
+	server := httptest.NewServer(apiServer)
+	defer server.Close()
+
+	router := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("invoked " + r.URL.Path))
+	}))
+	defer router.Close()
+
+	p := newTestProvider(t, `
+provider: fission
+fission:
+  routerURL: `+router.URL+`
+  masterURL: `+server.URL+`
+  namespace: fn
+`)
+	fc := p.(*fissionClient)
+	functions := fc.dynamic.Resource(fissionFunctionGVR).Namespace("fn")
+	getFunction := func() *unstructured.Unstructured {
+		fn, err := functions.Get(context.Background(), "demo", k8sapisv1.GetOptions{})
+		assert.NoError(err)
+		return fn
+	}
+	minScale := func() int64 {
+		min, _, _ := unstructured.NestedInt64(getFunction().Object, "spec", "InvokeStrategy", "ExecutionStrategy", "MinScale")
+		return min
+	}
+
+	funcSpec := newTestFuncSpec()
+
+	// deploy
+	assert.NoError(p.Create(funcSpec))
+	assert.Error(p.Create(funcSpec))
+	image, _, _ := unstructured.NestedSlice(getFunction().Object, "spec", "podspec", "containers")
+	assert.Equal("demo:1.0", image[0].(map[string]interface{})["image"])
+	assert.Equal(int64(1), minScale())
+
+	trigger, err := fc.dynamic.Resource(fissionTriggerGVR).Namespace("fn").Get(context.Background(), "easegress-demo", k8sapisv1.GetOptions{})
+	assert.NoError(err)
+	prefix, _, _ := unstructured.NestedString(trigger.Object, "spec", "prefix")
+	assert.Equal("/easegress/demo", prefix)
+
+	status, err := p.GetStatus("demo")
+	assert.NoError(err)
+	assert.Equal(spec.ReadyEvent, status.Event)
+
+	funcSpec.Image = "demo:2.0"
+	assert.NoError(p.Update(funcSpec))
+	image, _, _ = unstructured.NestedSlice(getFunction().Object, "spec", "podspec", "containers")
+	assert.Equal("demo:2.0", image[0].(map[string]interface{})["image"])
+
+	// invoke
+	ep, err := p.Endpoint(funcSpec)
+	assert.NoError(err)
+	assert.Equal("invoked /easegress/demo/hello", invoke(t, ep, 0))
+
+	// scale
+	assert.NoError(p.Scale("demo", 3))
+	assert.Equal(int64(3), minScale())
+	assert.Error(p.Scale("demo", 5))
+	assert.Equal(int64(3), minScale())
+
+	for _, name := range []string{"demo-1", "demo-2", "other"} {
+		function := "demo"
+		if name == "other" {
+			function = name
+		}
+		apiServer.put("/apis/apps/v1/namespaces/fission-function/deployments", name, map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name":   name,
+				"labels": map[string]interface{}{"functionName": function},
+			},
+			"status": map[string]interface{}{"readyReplicas": 2},
+		})
+	}
+	replicas, err := p.Replicas("demo")
+	assert.NoError(err)
+	assert.Equal(4, replicas)
+
+	// delete
+	assert.NoError(p.Delete("demo"))
+	assert.NoError(p.Delete("demo"))
+	assert.Error(p.Scale("demo", 1))
+
+	status, err = p.GetStatus("demo")
+	assert.NoError(err)
+	assert.Equal(spec.ErrorEvent, status.Event)
+}
@@ -0,0 +1,232 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provider
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/function/spec"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	defaultOpenFaaSTimeout = 5 * time.Second
+
+	openFaaSScaleMinLabel = "com.openfaas.scale.min"
+	openFaaSScaleMaxLabel = "com.openfaas.scale.max"
+)
+
+type (
+	// openFaaSClient is client for communicating with the gateway of
+	// OpenFaaS.
+	openFaaSClient struct {
+		superSpec *supervisor.Spec
+		spec      *spec.OpenFaaS
+		client    *http.Client
+		gateway   string
+		timeout   time.Duration
+	}
+
+	// openFaaSResources is the resources of a function of OpenFaaS.
+	openFaaSResources struct {
+		Memory string `json:"memory,omitempty"`
+		CPU    string `json:"cpu,omitempty"`
+	}
+
+	// openFaaSDeployment is the request to deploy a function.
+	openFaaSDeployment struct {
+		Service   string             `json:"service"`
+		Image     string             `json:"image"`
+		Namespace string             `json:"namespace,omitempty"`
+		Labels    map[string]string  `json:"labels,omitempty"`
+		EnvVars   map[string]string  `json:"envVars,omitempty"`
+		Limits    *openFaaSResources `json:"limits,omitempty"`
+		Requests  *openFaaSResources `json:"requests,omitempty"`
+	}
+
+	// openFaaSFunction is the status of a function of OpenFaaS.
+	openFaaSFunction struct {
+		Name              string `json:"name"`
+		Replicas          uint64 `json:"replicas"`
+		AvailableReplicas uint64 `json:"availableReplicas"`
+	}
+)
+
+// Init initializes the OpenFaaS client.
+func (oc *openFaaSClient) Init() error {
+	adm := oc.superSpec.ObjectSpec().(*spec.Admin)
+	oc.spec = adm.OpenFaaS
+	oc.gateway = strings.TrimSuffix(oc.spec.GatewayURL, "/")
+	oc.client = &http.Client{}
+
+	var err error
+	oc.timeout, err = parseTimeout(oc.spec.Timeout, defaultOpenFaaSTimeout)
+	if err != nil {
+		logger.Errorf("BUG: parse openfaas timeout: %s failed: %v", oc.spec.Timeout, err)
+		return err
+	}
+	return nil
+}
+
+func (oc *openFaaSClient) do(method, path string, body, result interface{}) (int, error) {
+	req, err := http.NewRequest(method, oc.gateway+path, nil)
+	if err != nil {
+		return 0, err
+	}
+	if oc.spec.Username != "" {
+		req.SetBasicAuth(oc.spec.Username, oc.spec.Password)
+	}
+	return doJSON(oc.client, oc.timeout, req, body, result)
+}
+
+func (oc *openFaaSClient) deployment(funcSpec *spec.Spec) *openFaaSDeployment {
+	d := &openFaaSDeployment{
+		Service:   funcSpec.Name,
+		Image:     funcSpec.Image,
+		Namespace: oc.spec.Namespace,
+		Labels:    map[string]string{},
+		Limits:    &openFaaSResources{Memory: funcSpec.LimitMemory, CPU: funcSpec.LimitCPU},
+		Requests:  &openFaaSResources{Memory: funcSpec.RequestMemory, CPU: funcSpec.RequestCPU},
+	}
+
+	// the autoscaler of OpenFaaS scales by RPS only.
+	if funcSpec.MinReplica != 0 {
+		d.Labels[openFaaSScaleMinLabel] = strconv.Itoa(funcSpec.MinReplica)
+	}
+	if funcSpec.MaxReplica != 0 {
+		d.Labels[openFaaSScaleMaxLabel] = strconv.Itoa(funcSpec.MaxReplica)
+	}
+
+	// of-watchdog listens on the port specified by the environment.
+	if funcSpec.Port != 0 {
+		d.EnvVars = map[string]string{"port": strconv.Itoa(funcSpec.Port)}
+	}
+	return d
+}
+
+func (oc *openFaaSClient) functionPath(name string) string {
+	path := "/system/function/" + url.PathEscape(name)
+	if oc.spec.Namespace != "" {
+		path += "?namespace=" + url.QueryEscape(oc.spec.Namespace)
+	}
+	return path
+}
+
+// Create deploys the function to OpenFaaS.
+func (oc *openFaaSClient) Create(funcSpec *spec.Spec) error {
+	if _, err := oc.do(http.MethodPost, "/system/functions", oc.deployment(funcSpec), nil); err != nil {
+		logger.Errorf("create openfaas function: %s failed: %v", funcSpec.Name, err)
+		return err
+	}
+	return nil
+}
+
+// Update updates the function of OpenFaaS.
+func (oc *openFaaSClient) Update(funcSpec *spec.Spec) error {
+	if _, err := oc.do(http.MethodPut, "/system/functions", oc.deployment(funcSpec), nil); err != nil {
+		logger.Errorf("update openfaas function: %s failed: %v", funcSpec.Name, err)
+		return err
+	}
+	return nil
+}
+
+// Delete deletes the function of OpenFaaS.
+func (oc *openFaaSClient) Delete(name string) error {
+	body := map[string]string{"functionName": name, "namespace": oc.spec.Namespace}
+	if _, err := oc.do(http.MethodDelete, "/system/functions", body, nil); err != nil {
+		logger.Errorf("delete openfaas function: %s failed: %v", name, err)
+		return err
+	}
+	return nil
+}
+
+// GetStatus returns the status of the function, a function scaled to zero
+// is ready as the gateway scales it from zero when it is invoked.
+func (oc *openFaaSClient) GetStatus(name string) (*spec.Status, error) {
+	fn := &openFaaSFunction{}
+	code, err := oc.do(http.MethodGet, oc.functionPath(name), nil, fn)
+	if code == http.StatusNotFound {
+		return &spec.Status{
+			Event:   spec.ErrorEvent,
+			ExtData: map[string]string{"error": "function not found in OpenFaaS"},
+		}, nil
+	}
+	if err != nil {
+		logger.Errorf("openfaas get function: %s, err: %v", name, err)
+		return nil, err
+	}
+
+	status := &spec.Status{ExtData: map[string]string{
+		"replicas":          strconv.FormatUint(fn.Replicas, 10),
+		"availableReplicas": strconv.FormatUint(fn.AvailableReplicas, 10),
+	}}
+	if fn.Replicas > 0 && fn.AvailableReplicas == 0 {
+		status.Event = spec.PendingEvent
+	} else {
+		status.Event = spec.ReadyEvent
+	}
+	return status, nil
+}
+
+// Scale scales the function to replicas if it has fewer replicas.
+func (oc *openFaaSClient) Scale(name string, replicas int) error {
+	fn := &openFaaSFunction{}
+	if _, err := oc.do(http.MethodGet, oc.functionPath(name), nil, fn); err != nil {
+		logger.Errorf("openfaas get function: %s, err: %v", name, err)
+		return err
+	}
+	if fn.Replicas >= uint64(replicas) {
+		return nil
+	}
+
+	body := map[string]interface{}{
+		"serviceName": name,
+		"namespace":   oc.spec.Namespace,
+		"replicas":    replicas,
+	}
+	if _, err := oc.do(http.MethodPost, "/system/scale-function/"+url.PathEscape(name), body, nil); err != nil {
+		logger.Errorf("scale openfaas function: %s to %d failed: %v", name, replicas, err)
+		return err
+	}
+	return nil
+}
+
+// Replicas returns the available replicas of the function.
+func (oc *openFaaSClient) Replicas(name string) (int, error) {
+	fn := &openFaaSFunction{}
+	if _, err := oc.do(http.MethodGet, oc.functionPath(name), nil, fn); err != nil {
+		logger.Errorf("openfaas get function: %s, err: %v", name, err)
+		return 0, err
+	}
+	return int(fn.AvailableReplicas), nil
+}
+
+// Endpoint returns the gateway of OpenFaaS, which invokes the function by
+// the path /function/<name>[.<namespace>].
+func (oc *openFaaSClient) Endpoint(funcSpec *spec.Spec) (*Endpoint, error) {
+	prefix := "/function/" + funcSpec.Name
+	if oc.spec.Namespace != "" {
+		prefix += "." + oc.spec.Namespace
+	}
+	return &Endpoint{Servers: []string{oc.gateway}, PathPrefix: prefix}, nil
+}
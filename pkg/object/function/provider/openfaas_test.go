@@ -0,0 +1,219 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/object/function/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+// testOpenFaaSGateway is a gateway of OpenFaaS keeping the functions in
+// memory.
+type testOpenFaaSGateway struct {
+	mutex       sync.Mutex
+	deployments map[string]*openFaaSDeployment
+	functions   map[string]*openFaaSFunction
+}
+
+func newTestOpenFaaSGateway() *testOpenFaaSGateway {
+	return &testOpenFaaSGateway{
+		deployments: map[string]*openFaaSDeployment{},
+		functions:   map[string]*openFaaSFunction{},
+	}
+}
+
+func (g *testOpenFaaSGateway) deployment(name string) *openFaaSDeployment {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.deployments[name]
+}
+
+func (g *testOpenFaaSGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if strings.HasPrefix(r.URL.Path, "/function/") {
+		w.Write([]byte("invoked " + r.URL.Path))
+		return
+	}
+
+	if user, password, _ := r.BasicAuth(); user != "admin" || password != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/system/functions" && r.Method == http.MethodDelete:
+		body := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if g.functions[body["functionName"]] == nil {
+			http.Error(w, "function not found", http.StatusNotFound)
+			return
+		}
+		delete(g.functions, body["functionName"])
+		delete(g.deployments, body["functionName"])
+
+	case r.URL.Path == "/system/functions":
+		d := &openFaaSDeployment{}
+		json.NewDecoder(r.Body).Decode(d)
+		fn := g.functions[d.Service]
+		if (r.Method == http.MethodPost) != (fn == nil) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if fn == nil {
+			fn = &openFaaSFunction{Name: d.Service, Replicas: 1, AvailableReplicas: 1}
+			g.functions[d.Service] = fn
+		}
+		g.deployments[d.Service] = d
+		w.WriteHeader(http.StatusAccepted)
+
+	case strings.HasPrefix(r.URL.Path, "/system/function/"):
+		fn := g.functions[strings.TrimPrefix(r.URL.Path, "/system/function/")]
+		if fn == nil {
+			http.Error(w, "function not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(fn)
+
+	case strings.HasPrefix(r.URL.Path, "/system/scale-function/"):
+		fn := g.functions[strings.TrimPrefix(r.URL.Path, "/system/scale-function/")]
+		if fn == nil {
+			http.Error(w, "function not found", http.StatusNotFound)
+			return
+		}
+		body := struct {
+			Replicas uint64 `json:"replicas"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		fn.Replicas, fn.AvailableReplicas = body.Replicas, body.Replicas
+		w.WriteHeader(http.StatusAccepted)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestOpenFaaS(t *testing.T) {
+	assert := assert.New(t)
+
+	gateway := newTestOpenFaaSGateway()
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	p := newTestProvider(t, `
+provider: openfaas
+openFaaS:
+  gatewayURL: `+server.URL+`/
+  username: admin
+  password: secret
+`)
+
+	funcSpec := newTestFuncSpec()
+	funcSpec.MinReplica = 2
+
+	// deploy
+	assert.NoError(p.Create(funcSpec))
+	assert.Error(p.Create(funcSpec))
+	d := gateway.deployment("demo")
+	assert.Equal("demo:1.0", d.Image)
+	assert.Equal("2", d.Labels[openFaaSScaleMinLabel])
+	assert.Equal("4", d.Labels[openFaaSScaleMaxLabel])
+	assert.Equal("8080", d.EnvVars["port"])
+	assert.Equal(&openFaaSResources{Memory: "128Mi", CPU: "500m"}, d.Limits)
+
+	status, err := p.GetStatus("demo")
+	assert.NoError(err)
+	assert.Equal(spec.ReadyEvent, status.Event)
+
+	funcSpec.Image = "demo:2.0"
+	assert.NoError(p.Update(funcSpec))
+	assert.Equal("demo:2.0", gateway.deployment("demo").Image)
+
+	// invoke
+	ep, err := p.Endpoint(funcSpec)
+	assert.NoError(err)
+	assert.Equal("invoked /function/demo/hello", invoke(t, ep, 0))
+
+	// scale
+	assert.NoError(p.Scale("demo", 3))
+	replicas, err := p.Replicas("demo")
+	assert.NoError(err)
+	assert.Equal(3, replicas)
+
+	assert.NoError(p.Scale("demo", 2))
+	replicas, err = p.Replicas("demo")
+	assert.NoError(err)
+	assert.Equal(3, replicas)
+
+	gateway.mutex.Lock()
+	gateway.functions["demo"].AvailableReplicas = 0
+	gateway.mutex.Unlock()
+	status, err = p.GetStatus("demo")
+	assert.NoError(err)
+	assert.Equal(spec.PendingEvent, status.Event)
+
+	// delete
+	assert.NoError(p.Delete("demo"))
+	assert.Error(p.Delete("demo"))
+	assert.Error(p.Scale("demo", 1))
+
+	status, err = p.GetStatus("demo")
+	assert.NoError(err)
+	assert.Equal(spec.ErrorEvent, status.Event)
+}
+
+func TestOpenFaaSNamespace(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		mutex sync.Mutex
+		paths []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		paths = append(paths, r.URL.String())
+		mutex.Unlock()
+		w.Write([]byte(`{"name":"demo","replicas":1,"availableReplicas":1}`))
+	}))
+	defer server.Close()
+
+	p := newTestProvider(t, `
+provider: openfaas
+openFaaS:
+  gatewayURL: `+server.URL+`
+  namespace: fn
+`)
+
+	_, err := p.Replicas("demo")
+	assert.NoError(err)
+	mutex.Lock()
+	assert.Equal([]string{"/system/function/demo?namespace=fn"}, paths)
+	mutex.Unlock()
+
+	ep, err := p.Endpoint(newTestFuncSpec())
+	assert.NoError(err)
+	assert.Equal("/function/demo.fn", ep.PathPrefix)
+}
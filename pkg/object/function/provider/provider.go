@@ -18,24 +18,21 @@
 package provider
 
 import (
+	"bytes"
 	"context"
 	"fmt"
-	"strconv"
+	"io"
+	"net/http"
 	"time"
 
-	corev1 "k8s.io/api/core/v1"
-	k8sresource "k8s.io/apimachinery/pkg/api/resource"
-	k8sapisv1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"knative.dev/client/pkg/kn/commands"
-	clientservingv1 "knative.dev/client/pkg/serving/v1"
-	"knative.dev/serving/pkg/apis/autoscaling"
-	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
-
-	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/function/spec"
 	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
 )
 
+// the max size of the response body of the provider APIs.
+const maxResponseSize = 4 * 1024 * 1024
+
 type (
 	// FaaSProvider is the physical serverless function instance manager
 	FaaSProvider interface {
@@ -44,226 +41,103 @@ type (
 		Create(funcSpec *spec.Spec) error
 		Delete(name string) error
 		Update(funcSpec *spec.Spec) error
-	}
-
-	// knativeClient is client for communicating with Knative type FaaSProvider
-	knativeClient struct {
-		superSpec     *supervisor.Spec
-		serviceClient clientservingv1.KnServingClient
-		namespace     string
-		timeout       time.Duration
+		// Scale keeps at least replicas instances of the function.
+		Scale(name string, replicas int) error
+		// Replicas returns the number of ready instances of the function.
+		Replicas(name string) (int, error)
+		// Endpoint returns how the function is invoked.
+		Endpoint(funcSpec *spec.Spec) (*Endpoint, error)
+	}
+
+	// Endpoint describes how the ingress invokes a function.
+	Endpoint struct {
+		// Servers are the URLs of the servers handling the function.
+		Servers []string
+		// Host is the host the servers recognize the function by, the host
+		// of the requests is kept if it is empty.
+		Host string
+		// PathPrefix is added to the path of the requests.
+		PathPrefix string
 	}
 )
 
-func (kc *knativeClient) Create(funcSpec *spec.Spec) error {
-	return kc.createService(funcSpec)
-}
-
-func (kc *knativeClient) GetStatus(name string) (*spec.Status, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), kc.timeout)
-	defer cancel()
-
-	service, err := kc.serviceClient.GetService(ctx, name)
-	if err != nil {
-		logger.Errorf("knative get service: %s, err: %v", name, err)
-		return nil, err
-	}
-	status := &spec.Status{}
-	extData := map[string]string{}
-	hasErrors := false
-
-	if len(service.Status.LatestReadyRevisionName) == 0 ||
-		service.Status.LatestCreatedRevisionName != service.Status.LatestReadyRevisionName {
-		for _, v := range service.Status.Conditions {
-			// There are three types of condition, false, unknown, true
-			if v.Status == corev1.ConditionFalse {
-				hasErrors = true
-			}
-			key := fmt.Sprintf("%v", v.Type)
-			value := fmt.Sprintf("status: %v, message: %v, reason: %v", v.Status, v.Message, v.Reason)
-			extData[key] = value
-		}
-		status.ExtData = extData
-
-		if hasErrors {
-			status.Event = spec.ErrorEvent
-		} else {
-			status.Event = spec.PendingEvent
-		}
-	} else {
-		// only when latestCreateRevisionName equals with latestReadyRevisionName, then
-		// we can consider this knative service is ready for handling traffic.
-		status.Event = spec.ReadyEvent
-	}
-
-	return status, nil
-}
-
-func (kc *knativeClient) Update(spec *spec.Spec) error {
-	return kc.updateService(spec)
-}
-
-func (kc *knativeClient) Delete(name string) error {
-	return kc.deleteService(name)
-}
-
-// NewProvider returns FaaSProvider client. It only supports Knative now.
+// NewProvider returns FaaSProvider client according to the provider of
+// the spec.
 func NewProvider(superSpec *supervisor.Spec) FaaSProvider {
-	return &knativeClient{
-		superSpec: superSpec,
-	}
-}
-
-// Init initializes knative client.
-func (kc *knativeClient) Init() error {
-	var err error
-	param := &commands.KnParams{}
-	param.Initialize()
-	spec := kc.superSpec.ObjectSpec().(*spec.Admin)
-
-	kc.namespace = spec.Knative.Namespace
-	kc.serviceClient, err = param.NewServingClient(kc.namespace)
-	if err != nil {
-		logger.Errorf("knative new serving client failed: %v", err)
-		return err
-	}
-
-	kc.timeout, err = time.ParseDuration(spec.Knative.Timeout)
-	if err != nil {
-		logger.Errorf("BUG: parse knative timeout interval: %s failed: %v",
-			spec.Knative.Timeout, err)
-		return err
-	}
-	return nil
-}
-
-// For scaling about annotations
-func annotation(funcSpec *spec.Spec) map[string]string {
-	annotation := make(map[string]string)
-	switch funcSpec.AutoScaleType {
-	case spec.AutoScaleMetricCPU:
-		annotation[autoscaling.ClassAnnotationKey] = autoscaling.HPA
-		annotation[autoscaling.MetricAnnotationKey] = autoscaling.CPU
-	case spec.AutoScaleMetricConcurrency:
-		annotation[autoscaling.MetricAnnotationKey] = autoscaling.Concurrency
-	case spec.AutoScaleMetricRPS:
+	adm := superSpec.ObjectSpec().(*spec.Admin)
+	switch adm.Provider {
+	case spec.ProviderOpenFaaS:
+		return &openFaaSClient{superSpec: superSpec}
+	case spec.ProviderFission:
+		return &fissionClient{superSpec: superSpec}
+	case spec.ProviderContainerPool:
+		return &containerPool{superSpec: superSpec}
 	default:
-		// using RPS default
-		annotation[autoscaling.MetricAnnotationKey] = autoscaling.RPS
-	}
-	annotation[autoscaling.TargetAnnotationKey] = funcSpec.AutoScaleValue
-	if funcSpec.MinReplica != 0 {
-		annotation[autoscaling.MinScaleAnnotationKey] = strconv.Itoa(funcSpec.MinReplica)
-	}
-
-	if funcSpec.MaxReplica != 0 {
-		annotation[autoscaling.MaxScaleAnnotationKey] = strconv.Itoa(funcSpec.MaxReplica)
+		return &knativeClient{superSpec: superSpec}
 	}
-
-	return annotation
 }
 
-// container builds a container with a dedicated port and image.
-func container(funcSpec *spec.Spec) corev1.Container {
-	container := corev1.Container{
-		Image:     funcSpec.Image,
-		Resources: requirement(funcSpec),
+// Equals returns whether the endpoints are the same.
+func (e *Endpoint) Equals(other *Endpoint) bool {
+	if other == nil || e.Host != other.Host || e.PathPrefix != other.PathPrefix {
+		return false
 	}
-
-	if funcSpec.Port != 0 {
-		container.Ports = []corev1.ContainerPort{{
-			ContainerPort: int32(funcSpec.Port),
-		}}
+	if len(e.Servers) != len(other.Servers) {
+		return false
 	}
-	return container
-}
-
-// requirement builds requirement according to resource's limitation and requested
-func requirement(funcSpec *spec.Spec) corev1.ResourceRequirements {
-	rr := corev1.ResourceRequirements{
-		Limits: corev1.ResourceList{
-			corev1.ResourceMemory: k8sresource.MustParse(funcSpec.LimitMemory),
-			corev1.ResourceCPU:    k8sresource.MustParse(funcSpec.LimitCPU),
-		},
-		Requests: corev1.ResourceList{
-			corev1.ResourceCPU:    k8sresource.MustParse(funcSpec.RequestCPU),
-			corev1.ResourceMemory: k8sresource.MustParse(funcSpec.RequestMemory),
-		},
+	for i := range e.Servers {
+		if e.Servers[i] != other.Servers[i] {
+			return false
+		}
 	}
-	return rr
-}
-
-func applySpec(funcSpec *spec.Spec, service *servingv1.Service) {
-	container := container(funcSpec)
-	service.Spec.Template.Spec.Containers = []corev1.Container{container}
-	service.Spec.Template.ObjectMeta.Annotations = annotation(funcSpec)
+	return true
 }
 
-// newService generate a knative service resource by giving Spec
-func (kc *knativeClient) newService(funcSpec *spec.Spec) *servingv1.Service {
-	service := &servingv1.Service{
-		ObjectMeta: k8sapisv1.ObjectMeta{
-			Name:      funcSpec.Name,
-			Namespace: kc.namespace,
-		},
+// parseTimeout parses the timeout of a provider, the default is used if it
+// is empty.
+func parseTimeout(timeout string, dflt time.Duration) (time.Duration, error) {
+	if timeout == "" {
+		return dflt, nil
 	}
-
-	service.Spec.Template = servingv1.RevisionTemplateSpec{
-		Spec: servingv1.RevisionSpec{
-			PodSpec: corev1.PodSpec{
-				Containers: []corev1.Container{container(funcSpec)},
-			},
-		},
-		ObjectMeta: k8sapisv1.ObjectMeta{
-			Annotations: annotation(funcSpec),
-		},
-	}
-	return service
+	return time.ParseDuration(timeout)
 }
 
-// createService creates a knative service resource.
-func (kc *knativeClient) createService(funcSpec *spec.Spec) error {
-	service := kc.newService(funcSpec)
-	var err error
-
-	ctx, cancel := context.WithTimeout(context.Background(), kc.timeout)
+// doJSON sends a request with the JSON encoded body to the API of a
+// provider, and decodes the JSON response into result if it is not nil.
+func doJSON(client *http.Client, timeout time.Duration, req *http.Request, body, result interface{}) (int, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
 	defer cancel()
-	err = kc.serviceClient.CreateService(ctx, service)
-	if err != nil {
-		logger.Errorf("create knative service:%s, timeout: %v, failed: %v", funcSpec.Name, kc.timeout, err)
-		return err
-	}
-	return nil
-}
+	req = req.WithContext(ctx)
 
-// deleteService deletes knative service resource.
-func (kc *knativeClient) deleteService(name string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), kc.timeout)
-	defer cancel()
-	if err := kc.serviceClient.DeleteService(ctx, name, 0); err != nil {
-		logger.Errorf("delete knative service: %s, timeout: %v, failed: %v", name, kc.timeout, err)
-		return err
+	if body != nil {
+		data, err := codectool.MarshalJSON(body)
+		if err != nil {
+			return 0, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(data))
+		req.ContentLength = int64(len(data))
+		req.Header.Set("Content-Type", "application/json")
 	}
-	return nil
-}
 
-// updateService updates function's Knative and EG resources
-func (kc *knativeClient) updateService(funcSpec *spec.Spec) error {
-	ctx, cancel := context.WithTimeout(context.Background(), kc.timeout)
-	defer cancel()
-	service, err := kc.serviceClient.GetService(ctx, funcSpec.Name)
+	resp, err := client.Do(req)
 	if err != nil {
-		logger.Errorf("get knative service: %s, timeout: %v, failed: %v", funcSpec.Name, kc.timeout, err)
-		return err
+		return 0, err
 	}
+	defer resp.Body.Close()
 
-	applySpec(funcSpec, service)
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("%s %s: status code %d: %s",
+			req.Method, req.URL.Path, resp.StatusCode, bytes.TrimSpace(data))
+	}
 
-	ctx1, cancel1 := context.WithTimeout(context.Background(), kc.timeout)
-	defer cancel1()
-	if _, err := kc.serviceClient.UpdateService(ctx1, service); err != nil {
-		logger.Errorf("update update service: %s, timeout: %v, failed: %v", funcSpec.Name, kc.timeout, err)
-		return err
+	if result != nil && len(data) > 0 {
+		if err = codectool.UnmarshalJSON(data, result); err != nil {
+			return resp.StatusCode, err
+		}
 	}
-	return nil
+	return resp.StatusCode, nil
 }
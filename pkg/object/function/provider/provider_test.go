@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provider
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/function/spec"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/stretchr/testify/assert"
+)
+
+const testControllerKind = "TestFaaSController"
+
+// testController is a controller with the spec of FaaSController, the
+// providers are tested with its specs, as the FaaSController imports this
+// package.
+type testController struct{}
+
+func (c *testController) Category() supervisor.ObjectCategory {
+	return supervisor.CategoryBusinessController
+}
+
+func (c *testController) Kind() string                                            { return testControllerKind }
+func (c *testController) DefaultSpec() interface{}                                { return &spec.Admin{} }
+func (c *testController) Status() *supervisor.Status                              { return &supervisor.Status{} }
+func (c *testController) Close()                                                  {}
+func (c *testController) Init(superSpec *supervisor.Spec)                         {}
+func (c *testController) Inherit(superSpec *supervisor.Spec, _ supervisor.Object) {}
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	supervisor.Register(&testController{})
+	code := m.Run()
+	os.Exit(code)
+}
+
+// newTestSuperSpec returns the spec of the controller, the yaml is the
+// provider part of the spec.
+func newTestSuperSpec(t *testing.T, yaml string) *supervisor.Spec {
+	superSpec, err := supervisor.NewSpec(`
+kind: TestFaaSController
+name: faas-controller
+syncInterval: 10s
+httpServer:
+  port: 10999
+  keepAlive: true
+  https: false
+` + yaml)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+	return superSpec
+}
+
+// newTestProvider creates and initializes the provider of the spec.
+func newTestProvider(t *testing.T, yaml string) FaaSProvider {
+	p := NewProvider(newTestSuperSpec(t, yaml))
+	if err := p.Init(); err != nil {
+		t.Fatalf("init provider failed: %v", err)
+	}
+	return p
+}
+
+// invoke invokes the function by the endpoint, and returns the body of the
+// response.
+func invoke(t *testing.T, ep *Endpoint, server int) string {
+	resp, err := http.Get(ep.Servers[server] + ep.PathPrefix + "/hello")
+	if err != nil {
+		t.Fatalf("invoke function failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("invoke function failed: status code %d: %s", resp.StatusCode, body)
+	}
+	return string(body)
+}
+
+func newTestFuncSpec() *spec.Spec {
+	return &spec.Spec{
+		Name:           "demo",
+		Image:          "demo:1.0",
+		Port:           8080,
+		AutoScaleType:  spec.AutoScaleMetricConcurrency,
+		AutoScaleValue: "100",
+		MinReplica:     1,
+		MaxReplica:     4,
+		LimitCPU:       "500m",
+		LimitMemory:    "128Mi",
+		RequestCPU:     "100m",
+		RequestMemory:  "64Mi",
+	}
+}
+
+func TestEndpointEquals(t *testing.T) {
+	assert := assert.New(t)
+
+	ep := &Endpoint{Servers: []string{"http://a", "http://b"}, PathPrefix: "/p"}
+	assert.True(ep.Equals(&Endpoint{Servers: []string{"http://a", "http://b"}, PathPrefix: "/p"}))
+	for _, other := range []*Endpoint{
+		nil,
+		{Servers: []string{"http://a"}, PathPrefix: "/p"},
+		{Servers: []string{"http://b", "http://a"}, PathPrefix: "/p"},
+		{Servers: []string{"http://a", "http://b"}},
+		{Servers: []string{"http://a", "http://b"}, PathPrefix: "/p", Host: "h"},
+	} {
+		assert.False(ep.Equals(other), "%+v", other)
+	}
+}
@@ -19,7 +19,9 @@ package spec
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/robfig/cron/v3"
 	k8sresource "k8s.io/apimachinery/pkg/api/resource"
 
 	"github.com/megaease/easegress/pkg/filters/requestadaptor"
@@ -36,6 +38,13 @@ const (
 
 	// ProviderKnative is the FaaS provider Knative.
 	ProviderKnative = "knative"
+	// ProviderOpenFaaS is the FaaS provider OpenFaaS.
+	ProviderOpenFaaS = "openfaas"
+	// ProviderFission is the FaaS provider Fission.
+	ProviderFission = "fission"
+	// ProviderContainerPool is the FaaS provider which manages the
+	// containers of functions directly by the Docker Engine API.
+	ProviderContainerPool = "containerpool"
 )
 
 type (
@@ -45,14 +54,16 @@ type (
 		SyncInterval string `json:"syncInterval" jsonschema:"required,format=duration"`
 
 		// Provider is the FaaSProvider.
-		Provider string `json:"provider" jsonschema:"required"`
+		Provider string `json:"provider" jsonschema:"required,enum=knative,enum=openfaas,enum=fission,enum=containerpool"`
 
 		// HTTPServer is the HTTP traffic gate for accepting ingress traffic.
 		HTTPServer *httpserver.Spec `json:"httpServer" jsonschema:"required"`
 
-		// Currently we only supports knative type faas provider, so this filed should be
-		// "required" right now.
-		Knative *Knative `json:"knative" jsonschema:"required"`
+		// Only the spec of the provider is required.
+		Knative       *Knative       `json:"knative,omitempty" jsonschema:"omitempty"`
+		OpenFaaS      *OpenFaaS      `json:"openFaaS,omitempty" jsonschema:"omitempty"`
+		Fission       *Fission       `json:"fission,omitempty" jsonschema:"omitempty"`
+		ContainerPool *ContainerPool `json:"containerPool,omitempty" jsonschema:"omitempty"`
 	}
 
 	// Function contains the FaaSFunction's spec ,runtime status with a build-in fsm.
@@ -60,6 +71,9 @@ type (
 		Spec   *Spec   `json:"spec" jsonschema:"required"`
 		Status *Status `json:"status" jsonschema:"required"`
 		Fsm    *FSM    `json:"fsm" jsonschema:"omitempty"`
+
+		// ColdStart is filled at runtime, it is not persisted.
+		ColdStart *ColdStartStatus `json:"coldStart,omitempty" jsonschema:"omitempty"`
 	}
 
 	// Spec is the spec of FaaSFunction.
@@ -77,6 +91,47 @@ type (
 		RequestMemory  string `json:"requestMemory" jsonschema:"omitempty"`
 
 		RequestAdaptor *requestadaptor.Spec `json:"requestAdaptor" jsonschema:"required"`
+
+		// ColdStart is the spec to mitigate the cold start of the function.
+		ColdStart *ColdStart `json:"coldStart,omitempty" jsonschema:"omitempty"`
+	}
+
+	// ColdStart keeps instances of the function warm, and queues the
+	// requests while the function scales from zero.
+	ColdStart struct {
+		// MinWarmInstances is the number of instances always kept warm.
+		MinWarmInstances int       `json:"minWarmInstances" jsonschema:"omitempty,minimum=0"`
+		Warmers          []*Warmer `json:"warmers" jsonschema:"omitempty"`
+		Queue            *Queue    `json:"queue,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Warmer pre-warms instances of the function on schedule, e.g. before
+	// the peak hours.
+	Warmer struct {
+		// Schedule is a standard cron expression of when the warmer starts.
+		Schedule  string `json:"schedule" jsonschema:"required"`
+		Duration  string `json:"duration" jsonschema:"required,format=duration"`
+		Instances int    `json:"instances" jsonschema:"required,minimum=1"`
+	}
+
+	// Queue holds the requests while the function has no instance.
+	Queue struct {
+		Size    int    `json:"size" jsonschema:"omitempty,minimum=1"`
+		MaxWait string `json:"maxWait" jsonschema:"omitempty,format=duration"`
+	}
+
+	// ColdStartStatus is the runtime status of the cold start mitigation of
+	// the function, the latencies are in milliseconds.
+	ColdStartStatus struct {
+		Replicas        int     `json:"replicas"`
+		WarmInstances   int     `json:"warmInstances"`
+		ColdStarts      uint64  `json:"coldStarts"`
+		Queued          int     `json:"queued"`
+		TotalQueued     uint64  `json:"totalQueued"`
+		Rejected        uint64  `json:"rejected"`
+		TimedOut        uint64  `json:"timedOut"`
+		AvgQueueLatency float64 `json:"avgQueueLatency"`
+		MaxQueueLatency float64 `json:"maxQueueLatency"`
 	}
 
 	// Status is the status of faas function.
@@ -95,8 +150,72 @@ type (
 		Namespace string `json:"namespace" jsonschema:"omitempty"`
 		Timeout   string `json:"timeout" jsonschema:"omitempty,format=duration"`
 	}
+
+	// OpenFaaS is the faas provider OpenFaaS.
+	OpenFaaS struct {
+		GatewayURL string `json:"gatewayURL" jsonschema:"required,format=uri"`
+		Username   string `json:"username" jsonschema:"omitempty"`
+		Password   string `json:"password" jsonschema:"omitempty"`
+
+		Namespace string `json:"namespace" jsonschema:"omitempty"`
+		Timeout   string `json:"timeout" jsonschema:"omitempty,format=duration"`
+	}
+
+	// Fission is the faas provider Fission, the functions are created as
+	// container functions.
+	Fission struct {
+		// RouterURL is the address of the router of Fission.
+		RouterURL  string `json:"routerURL" jsonschema:"required,format=uri"`
+		KubeConfig string `json:"kubeConfig" jsonschema:"omitempty"`
+		MasterURL  string `json:"masterURL" jsonschema:"omitempty"`
+		// FunctionNamespace is the namespace Fission runs the instances of
+		// functions in, it is fission-function by default.
+		FunctionNamespace string `json:"functionNamespace" jsonschema:"omitempty"`
+
+		Namespace string `json:"namespace" jsonschema:"omitempty"`
+		Timeout   string `json:"timeout" jsonschema:"omitempty,format=duration"`
+	}
+
+	// ContainerPool is the faas provider which runs the containers of the
+	// functions on a single host by containerd.
+	ContainerPool struct {
+		// Address is the address of containerd, which is
+		// /run/containerd/containerd.sock by default.
+		Address string `json:"address" jsonschema:"omitempty"`
+		// Namespace is the containerd namespace of the containers, which is
+		// easegress by default.
+		Namespace string `json:"namespace" jsonschema:"omitempty"`
+		// HostIP is the IP the containers are invoked by, the containers
+		// share the network of the host.
+		HostIP string `json:"hostIP" jsonschema:"omitempty,format=ipv4"`
+		// Timeout is the timeout of the calls to the API, except pulling
+		// images.
+		Timeout string `json:"timeout" jsonschema:"omitempty,format=duration"`
+	}
 )
 
+// Validate validates the spec of the controller.
+func (adm *Admin) Validate() error {
+	missing := false
+	switch adm.Provider {
+	case ProviderKnative:
+		missing = adm.Knative == nil
+	case ProviderOpenFaaS:
+		missing = adm.OpenFaaS == nil
+	case ProviderFission:
+		missing = adm.Fission == nil
+	case ProviderContainerPool:
+		// all fields are optional.
+	default:
+		return fmt.Errorf("unknown FaaS provider: %s", adm.Provider)
+	}
+
+	if missing {
+		return fmt.Errorf("the spec of FaaS provider %s is required", adm.Provider)
+	}
+	return nil
+}
+
 // Validate valid FaaSFunction's spec.
 func (spec *Spec) Validate() error {
 	if spec.MinReplica > spec.MaxReplica {
@@ -110,6 +229,12 @@ func (spec *Spec) Validate() error {
 		return fmt.Errorf("unknown autoscale type: %s", spec.AutoScaleType)
 	}
 
+	if spec.ColdStart != nil {
+		if err := spec.ColdStart.Validate(); err != nil {
+			return err
+		}
+	}
+
 	checkK8s := func() (errMsg error) {
 		defer func() {
 			if err := recover(); err != nil {
@@ -128,6 +253,45 @@ func (spec *Spec) Validate() error {
 	return checkK8s()
 }
 
+// Validate validates the spec of cold start mitigation.
+func (cs *ColdStart) Validate() error {
+	for _, w := range cs.Warmers {
+		if _, err := cron.ParseStandard(w.Schedule); err != nil {
+			return fmt.Errorf("invalid warmer schedule %q: %v", w.Schedule, err)
+		}
+		if _, err := time.ParseDuration(w.Duration); err != nil {
+			return fmt.Errorf("invalid warmer duration %q: %v", w.Duration, err)
+		}
+	}
+
+	if cs.Queue != nil && cs.Queue.MaxWait != "" {
+		if _, err := time.ParseDuration(cs.Queue.MaxWait); err != nil {
+			return fmt.Errorf("invalid queue max wait %q: %v", cs.Queue.MaxWait, err)
+		}
+	}
+	return nil
+}
+
+// WarmInstances returns the number of instances to keep warm at the time.
+// A warmer is active from its scheduled time until its duration elapsed.
+func (cs *ColdStart) WarmInstances(now time.Time) int {
+	n := cs.MinWarmInstances
+	for _, w := range cs.Warmers {
+		schedule, err := cron.ParseStandard(w.Schedule)
+		if err != nil {
+			continue
+		}
+		d, err := time.ParseDuration(w.Duration)
+		if err != nil {
+			continue
+		}
+		if !schedule.Next(now.Add(-d)).After(now) && w.Instances > n {
+			n = w.Instances
+		}
+	}
+	return n
+}
+
 // Next turns function's states into next states by given event.
 func (function *Function) Next(event Event) (updated bool, err error) {
 	updated = false
@@ -20,6 +20,7 @@ package spec
 import (
 	"fmt"
 	"testing"
+	"time"
 )
 
 func TestInValidSpec(t *testing.T) {
@@ -129,6 +130,35 @@ func TestInValidSpecAutoScaleType(t *testing.T) {
 	fmt.Println("err is ", err)
 }
 
+func TestColdStart(t *testing.T) {
+	cs := &ColdStart{
+		MinWarmInstances: 1,
+		Warmers: []*Warmer{
+			{Schedule: "0 9 * * *", Duration: "2h", Instances: 3},
+		},
+		Queue: &Queue{Size: 10, MaxWait: "10s"},
+	}
+	if err := cs.Validate(); err != nil {
+		t.Errorf("test failed cold start should be valid, err: %v", err)
+	}
+
+	cases := []struct {
+		hour int
+		want int
+	}{{8, 1}, {9, 3}, {10, 3}, {11, 1}}
+	for _, c := range cases {
+		now := time.Date(2022, 6, 1, c.hour, 30, 0, 0, time.Local)
+		if got := cs.WarmInstances(now); got != c.want {
+			t.Errorf("warm instances at %d:30 should be %d, got %d", c.hour, c.want, got)
+		}
+	}
+
+	cs.Warmers[0].Schedule = "every morning"
+	if err := cs.Validate(); err == nil {
+		t.Errorf("test failed cold start with invalid schedule should not be valid")
+	}
+}
+
 func TestNext(t *testing.T) {
 	fsm, _ := InitFSM(InitState())
 
@@ -241,6 +241,9 @@ func (worker *Worker) List(w http.ResponseWriter, r *http.Request) {
 		api.HandleAPIError(w, r, http.StatusInternalServerError, err)
 		return
 	}
+	for _, function := range functions {
+		function.ColdStart = worker.coldStartStatus(function.Spec.Name)
+	}
 
 	buff, err := codectool.MarshalJSON(functions)
 	if err != nil {
@@ -323,6 +326,7 @@ func (worker *Worker) Get(w http.ResponseWriter, r *http.Request) {
 
 	// no display
 	function.Fsm = nil
+	function.ColdStart = worker.coldStartStatus(name)
 
 	buff, err := codectool.MarshalJSON(function)
 	if err != nil {
@@ -0,0 +1,294 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/function/provider"
+	"github.com/megaease/easegress/pkg/object/function/spec"
+)
+
+const (
+	defaultQueueSize    = 100
+	defaultQueueMaxWait = 30 * time.Second
+
+	// wakePollInterval is the interval to check whether the function has
+	// instances while it scales from zero.
+	wakePollInterval = 500 * time.Millisecond
+)
+
+// coldStarters are the cold start managers of the functions of all
+// controllers, keyed by <controller>/<function>, the FaaSQueue filters
+// find them by the key.
+var coldStarters sync.Map
+
+type (
+	// coldStarter keeps instances of a function warm, and queues the
+	// requests to the function while it scales from zero.
+	coldStarter struct {
+		provider provider.FaaSProvider
+		ingress  *ingressServer
+
+		mutex    sync.Mutex
+		funcSpec *spec.Spec
+		// replicas is the number of ready instances, -1 means unknown.
+		replicas int
+		// warmInstances is the number of instances the function is
+		// scaled to.
+		warmInstances int
+		waking        bool
+		warm          chan struct{}
+
+		queued       int
+		coldStarts   uint64
+		totalQueued  uint64
+		rejected     uint64
+		timedOut     uint64
+		totalLatency time.Duration
+		maxLatency   time.Duration
+	}
+)
+
+func coldStarterKey(controller, function string) string {
+	return controller + "/" + function
+}
+
+func getColdStarter(controller, function string) *coldStarter {
+	if v, ok := coldStarters.Load(coldStarterKey(controller, function)); ok {
+		return v.(*coldStarter)
+	}
+	return nil
+}
+
+func newColdStarter(funcSpec *spec.Spec, faasProvider provider.FaaSProvider, ingress *ingressServer) *coldStarter {
+	return &coldStarter{
+		provider:      faasProvider,
+		ingress:       ingress,
+		funcSpec:      funcSpec,
+		replicas:      -1,
+		warmInstances: funcSpec.MinReplica,
+	}
+}
+
+// reconcile refreshes the replicas of the function, and scales it to the
+// number of warm instances at the time.
+func (cs *coldStarter) reconcile(funcSpec *spec.Spec, now time.Time) {
+	replicas, err := cs.provider.Replicas(funcSpec.Name)
+	if err != nil {
+		return
+	}
+
+	target := funcSpec.ColdStart.WarmInstances(now)
+	if target < funcSpec.MinReplica {
+		target = funcSpec.MinReplica
+	}
+
+	cs.mutex.Lock()
+	cs.funcSpec = funcSpec
+	cs.replicas = replicas
+	changed := target != cs.warmInstances
+	cs.mutex.Unlock()
+
+	// scaling updates the function in some providers, so it is only
+	// called when the target changed or instances are missing.
+	if !changed && replicas >= target {
+		return
+	}
+	if err = cs.provider.Scale(funcSpec.Name, target); err != nil {
+		logger.Errorf("scale function %s to %d warm instances failed: %v", funcSpec.Name, target, err)
+		return
+	}
+
+	cs.mutex.Lock()
+	cs.warmInstances = target
+	cs.mutex.Unlock()
+}
+
+// wait holds the request while the function has no instance, until the
+// function is warm, the request is done or the max wait elapsed. The
+// first request of a cold start goes on to the provider to trigger the
+// scaling from zero. It returns the result of the FaaSQueue filter.
+func (cs *coldStarter) wait(done <-chan struct{}) string {
+	cs.mutex.Lock()
+	coldStart := cs.funcSpec.ColdStart
+	if coldStart == nil || coldStart.Queue == nil || cs.replicas != 0 {
+		cs.mutex.Unlock()
+		return ""
+	}
+
+	if !cs.waking {
+		cs.waking = true
+		cs.warm = make(chan struct{})
+		cs.coldStarts++
+		go cs.wake()
+		cs.mutex.Unlock()
+		return ""
+	}
+
+	size := coldStart.Queue.Size
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+	if cs.queued >= size {
+		cs.rejected++
+		cs.mutex.Unlock()
+		return resultQueueFull
+	}
+
+	maxWait := defaultQueueMaxWait
+	if coldStart.Queue.MaxWait != "" {
+		maxWait, _ = time.ParseDuration(coldStart.Queue.MaxWait)
+	}
+
+	cs.queued++
+	cs.totalQueued++
+	warm := cs.warm
+	cs.mutex.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+
+	result := ""
+	select {
+	case <-warm:
+	case <-timer.C:
+		result = resultQueueTimeout
+	case <-done:
+		result = resultQueueTimeout
+	}
+	latency := time.Since(start)
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.queued--
+	if result != "" {
+		cs.timedOut++
+	}
+	cs.totalLatency += latency
+	if latency > cs.maxLatency {
+		cs.maxLatency = latency
+	}
+	return result
+}
+
+// wake waits for the function to have instances and then releases the
+// queued requests, it gives up once all queued requests are gone.
+func (cs *coldStarter) wake() {
+	for {
+		time.Sleep(wakePollInterval)
+
+		cs.mutex.Lock()
+		funcSpec := cs.funcSpec
+		if cs.queued == 0 {
+			cs.waking = false
+			cs.mutex.Unlock()
+			return
+		}
+		cs.mutex.Unlock()
+
+		replicas, err := cs.provider.Replicas(funcSpec.Name)
+		if err != nil || replicas == 0 {
+			continue
+		}
+
+		// the endpoint changes as instances start in some providers.
+		cs.ingress.Refresh(funcSpec)
+
+		cs.mutex.Lock()
+		cs.replicas = replicas
+		cs.waking = false
+		close(cs.warm)
+		cs.mutex.Unlock()
+		return
+	}
+}
+
+func (cs *coldStarter) status() *spec.ColdStartStatus {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	s := &spec.ColdStartStatus{
+		Replicas:        cs.replicas,
+		WarmInstances:   cs.warmInstances,
+		ColdStarts:      cs.coldStarts,
+		Queued:          cs.queued,
+		TotalQueued:     cs.totalQueued,
+		Rejected:        cs.rejected,
+		TimedOut:        cs.timedOut,
+		MaxQueueLatency: float64(cs.maxLatency) / float64(time.Millisecond),
+	}
+	// the latencies of the requests in the queue are not recorded yet.
+	if n := cs.totalQueued - uint64(cs.queued); n > 0 {
+		s.AvgQueueLatency = float64(cs.totalLatency) / float64(time.Millisecond) / float64(n)
+	}
+	return s
+}
+
+// reconcileColdStarters creates, updates and removes the cold start
+// managers according to the functions.
+func (worker *Worker) reconcileColdStarters(allFunctions map[string]*spec.Function) {
+	now := time.Now()
+	for _, function := range allFunctions {
+		key := coldStarterKey(worker.name, function.Spec.Name)
+		if function.Spec.ColdStart == nil || function.Status.State != spec.ActiveState {
+			coldStarters.Delete(key)
+			continue
+		}
+
+		v, _ := coldStarters.LoadOrStore(key, newColdStarter(function.Spec, worker.provider, worker.ingress))
+		v.(*coldStarter).reconcile(function.Spec, now)
+	}
+
+	// remove the deleted functions.
+	prefix := coldStarterKey(worker.name, "")
+	coldStarters.Range(func(k, v interface{}) bool {
+		key := k.(string)
+		if !strings.HasPrefix(key, prefix) {
+			return true
+		}
+		if _, ok := allFunctions[strings.TrimPrefix(key, prefix)]; !ok {
+			coldStarters.Delete(k)
+		}
+		return true
+	})
+}
+
+// coldStartStatus returns the cold start status of the function, nil if
+// it has no cold start mitigation.
+func (worker *Worker) coldStartStatus(name string) *spec.ColdStartStatus {
+	if cs := getColdStarter(worker.name, name); cs != nil {
+		return cs.status()
+	}
+	return nil
+}
+
+// closeColdStarters removes the cold start managers of the worker.
+func (worker *Worker) closeColdStarters() {
+	prefix := coldStarterKey(worker.name, "")
+	coldStarters.Range(func(k, v interface{}) bool {
+		if strings.HasPrefix(k.(string), prefix) {
+			coldStarters.Delete(k)
+		}
+		return true
+	})
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/megaease/easegress/pkg/filters/proxy"
 	"github.com/megaease/easegress/pkg/filters/requestadaptor"
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/function/provider"
 	"github.com/megaease/easegress/pkg/object/function/spec"
 	"github.com/megaease/easegress/pkg/object/httpserver"
 	"github.com/megaease/easegress/pkg/object/pipeline"
@@ -38,16 +39,14 @@ type (
 	// ingressServer manages one/many ingress pipelines and one HTTPServer
 	ingressServer struct {
 		superSpec *supervisor.Spec
-
-		faasNetworkLayerURL string
-		faasHostSuffix      string
-		faasNamespace       string
+		provider  provider.FaaSProvider
 
 		namespace string
 		mutex     sync.RWMutex
 
-		tc             *trafficcontroller.TrafficController
-		pipelines      map[string]struct{}
+		tc *trafficcontroller.TrafficController
+		// pipelines records the endpoints the pipelines are built with.
+		pipelines      map[string]*provider.Endpoint
 		httpServer     *supervisor.ObjectEntity
 		httpServerSpec *supervisor.Spec
 	}
@@ -66,7 +65,7 @@ type (
 )
 
 // newIngressServer creates an initialized ingress server
-func newIngressServer(superSpec *supervisor.Spec, controllerName string) *ingressServer {
+func newIngressServer(superSpec *supervisor.Spec, faasProvider provider.FaaSProvider) *ingressServer {
 	entity, exists := superSpec.Super().GetSystemController(trafficcontroller.Kind)
 
 	if !exists {
@@ -78,9 +77,10 @@ func newIngressServer(superSpec *supervisor.Spec, controllerName string) *ingres
 		panic(fmt.Errorf("BUG: want *TrafficController, got %T", entity.Instance()))
 	}
 	return &ingressServer{
-		pipelines:  make(map[string]struct{}),
+		pipelines:  make(map[string]*provider.Endpoint),
 		httpServer: nil,
 		superSpec:  superSpec,
+		provider:   faasProvider,
 		mutex:      sync.RWMutex{},
 		namespace:  fmt.Sprintf("%s/%s", superSpec.Name(), "ingress"),
 		tc:         tc,
@@ -131,30 +131,58 @@ func (b *pipelineSpecBuilder) jsonConfig() string {
 	return string(buff)
 }
 
-func (b *pipelineSpecBuilder) appendReqAdaptor(funcSpec *spec.Spec, faasNamespace, faasHostSuffix string) *pipelineSpecBuilder {
+func (b *pipelineSpecBuilder) appendQueue(controllerName, funcName string) *pipelineSpecBuilder {
+	queueName := "coldStartQueue"
+	b.Flow = append(b.Flow, pipeline.FlowNode{FilterName: queueName})
+	b.Filters = append(b.Filters, map[string]interface{}{
+		"kind":       queueKind,
+		"name":       queueName,
+		"controller": controllerName,
+		"function":   funcName,
+	})
+
+	return b
+}
+
+func (b *pipelineSpecBuilder) appendReqAdaptor(funcSpec *spec.Spec, endpoint *provider.Endpoint) *pipelineSpecBuilder {
 	adaptorName := "requestAdaptor"
 	b.Flow = append(b.Flow, pipeline.FlowNode{FilterName: adaptorName})
 
-	b.Filters = append(b.Filters, map[string]interface{}{
+	adaptor := map[string]interface{}{
 		"kind":   requestadaptor.Kind,
 		"name":   adaptorName,
 		"method": funcSpec.RequestAdaptor.Method,
 		"path":   funcSpec.RequestAdaptor.Path,
 		"header": funcSpec.RequestAdaptor.Header,
-
-		// let faas Provider's gateway recognized this function by Host field
-		"host": funcSpec.Name + "." + faasNamespace + "." + faasHostSuffix,
-	})
+	}
+	// let faas Provider's gateway recognized this function by Host field
+	if endpoint.Host != "" {
+		adaptor["host"] = endpoint.Host
+	}
+	b.Filters = append(b.Filters, adaptor)
+
+	// the prefix is added after the path of the function is adapted.
+	if endpoint.PathPrefix != "" {
+		prefixAdaptorName := "providerAdaptor"
+		b.Flow = append(b.Flow, pipeline.FlowNode{FilterName: prefixAdaptorName})
+		b.Filters = append(b.Filters, map[string]interface{}{
+			"kind": requestadaptor.Kind,
+			"name": prefixAdaptorName,
+			"path": map[string]interface{}{"addPrefix": endpoint.PathPrefix},
+		})
+	}
 
 	return b
 }
 
-func (b *pipelineSpecBuilder) appendProxy(faasNetworkLayerURL string) *pipelineSpecBuilder {
-	mainServers := []*proxy.Server{
-		{
-			URL:      faasNetworkLayerURL,
-			KeepHost: true, // Keep the host of the requests as they route to functions.
-		},
+func (b *pipelineSpecBuilder) appendProxy(endpoint *provider.Endpoint) *pipelineSpecBuilder {
+	mainServers := []*proxy.Server{}
+	for _, url := range endpoint.Servers {
+		mainServers = append(mainServers, &proxy.Server{
+			URL: url,
+			// Keep the host of the requests as they route to functions.
+			KeepHost: endpoint.Host != "",
+		})
 	}
 
 	backendName := "faasBackend"
@@ -184,10 +212,6 @@ func (ings *ingressServer) Init() error {
 	}
 	spec := ings.superSpec.ObjectSpec().(*spec.Admin)
 
-	ings.faasNetworkLayerURL = spec.Knative.NetworkLayerURL
-	ings.faasHostSuffix = spec.Knative.HostSuffix
-	ings.faasNamespace = spec.Knative.Namespace
-
 	builder := newHTTPServerSpecBuilder(ings.superSpec.Name())
 	builder.buildWithOutRules(spec.HTTPServer)
 	superSpec, err := supervisor.NewSpec(builder.jsonConfig())
@@ -275,9 +299,18 @@ func (ings *ingressServer) remove(pipeline string) error {
 
 // Put puts pipeline named by faas function's name with a requestAdaptor and proxy
 func (ings *ingressServer) Put(funcSpec *spec.Spec) error {
+	endpoint, err := ings.provider.Endpoint(funcSpec)
+	if err != nil {
+		return fmt.Errorf("get endpoint of function %s failed: %v", funcSpec.Name, err)
+	}
+	return ings.put(funcSpec, endpoint)
+}
+
+func (ings *ingressServer) put(funcSpec *spec.Spec, endpoint *provider.Endpoint) error {
 	builder := newPipelineSpecBuilder(funcSpec.Name)
-	builder.appendReqAdaptor(funcSpec, ings.faasNamespace, ings.faasHostSuffix)
-	builder.appendProxy(ings.faasNetworkLayerURL)
+	builder.appendQueue(ings.superSpec.Name(), funcSpec.Name)
+	builder.appendReqAdaptor(funcSpec, endpoint)
+	builder.appendProxy(endpoint)
 
 	jsonConfig := builder.jsonConfig()
 	superSpec, err := supervisor.NewSpec(jsonConfig)
@@ -285,15 +318,37 @@ func (ings *ingressServer) Put(funcSpec *spec.Spec) error {
 		logger.Errorf("new spec for %s failed: %v", jsonConfig, err)
 		return err
 	}
-	if _, err = ings.tc.CreatePipelineForSpec(ings.namespace, superSpec); err != nil {
-		return fmt.Errorf("create http pipeline %s failed: %v", superSpec.Name(), err)
+	if _, err = ings.tc.ApplyPipelineForSpec(ings.namespace, superSpec); err != nil {
+		return fmt.Errorf("apply http pipeline %s failed: %v", superSpec.Name(), err)
 	}
 	ings.add(funcSpec.Name)
-	ings.pipelines[funcSpec.Name] = struct{}{}
+	ings.pipelines[funcSpec.Name] = endpoint
 
 	return nil
 }
 
+// Refresh rebuilds the pipeline of the function if its endpoint changed.
+func (ings *ingressServer) Refresh(funcSpec *spec.Spec) {
+	ings.mutex.Lock()
+	defer ings.mutex.Unlock()
+
+	old, exist := ings.pipelines[funcSpec.Name]
+	if !exist {
+		return
+	}
+	endpoint, err := ings.provider.Endpoint(funcSpec)
+	if err != nil {
+		logger.Errorf("get endpoint of function: %s failed: %v", funcSpec.Name, err)
+		return
+	}
+	if endpoint.Equals(old) {
+		return
+	}
+	if err = ings.put(funcSpec, endpoint); err != nil {
+		logger.Errorf("refresh ingress pipeline: %s failed: %v", funcSpec.Name, err)
+	}
+}
+
 // Delete deletes one ingress pipeline according to the function's name.
 func (ings *ingressServer) Delete(functionName string) {
 	ings.mutex.Lock()
@@ -314,13 +369,19 @@ func (ings *ingressServer) Update(allFunctions map[string]*spec.Function) {
 	defer ings.mutex.Unlock()
 	for _, v := range allFunctions {
 		index := ings.find(v.Spec.Name)
-		_, exist := ings.pipelines[v.Spec.Name]
+		old, exist := ings.pipelines[v.Spec.Name]
 
 		if v.Status.State == spec.ActiveState {
+			endpoint, err := ings.provider.Endpoint(v.Spec)
+			if err != nil {
+				logger.Errorf("get endpoint of function: %s failed: %v", v.Spec.Name, err)
+				continue
+			}
 			// need to add rule in HTTPServer or create this pipeline
-			// especially in reboot scenario.
-			if index == -1 || !exist {
-				err := ings.Put(v.Spec)
+			// especially in reboot scenario, or rebuild the pipeline
+			// as the instances of the function changed.
+			if index == -1 || !exist || !endpoint.Equals(old) {
+				err = ings.put(v.Spec, endpoint)
 				if err != nil {
 					logger.Errorf("ingress add back local pipeline: %s, failed: %v",
 						v.Spec.Name, err)
@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"net/http"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// queueKind is the kind of the filter which holds the requests to a
+	// function while it scales from zero, it is only created by the
+	// FaaSController in the ingress pipelines.
+	queueKind = "FaaSQueue"
+
+	resultQueueFull    = "queueFull"
+	resultQueueTimeout = "queueTimeout"
+)
+
+var queueFilterKind = &filters.Kind{
+	Name:        queueKind,
+	Description: "FaaSQueue holds the requests to a FaaS function while it scales from zero",
+	Results:     []string{resultQueueFull, resultQueueTimeout},
+	DefaultSpec: func() filters.Spec {
+		return &queueSpec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &queue{spec: spec.(*queueSpec)}
+	},
+}
+
+func init() {
+	filters.Register(queueFilterKind)
+}
+
+type (
+	// queue is the filter FaaSQueue.
+	queue struct {
+		spec *queueSpec
+	}
+
+	// queueSpec describes the FaaSQueue.
+	queueSpec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Controller string `json:"controller" jsonschema:"required"`
+		Function   string `json:"function" jsonschema:"required"`
+	}
+)
+
+// Name returns the name of the FaaSQueue filter instance.
+func (q *queue) Name() string {
+	return q.spec.Name()
+}
+
+// Kind returns the kind of FaaSQueue.
+func (q *queue) Kind() *filters.Kind {
+	return queueFilterKind
+}
+
+// Spec returns the spec used by the FaaSQueue.
+func (q *queue) Spec() filters.Spec {
+	return q.spec
+}
+
+// Init initializes FaaSQueue.
+func (q *queue) Init() {
+}
+
+// Inherit inherits previous generation of FaaSQueue.
+func (q *queue) Inherit(previousGeneration filters.Filter) {
+}
+
+// Handle holds the request while the function has no instance.
+func (q *queue) Handle(ctx *context.Context) string {
+	cs := getColdStarter(q.spec.Controller, q.spec.Function)
+	if cs == nil {
+		return ""
+	}
+
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	result := cs.wait(req.Context().Done())
+	if result == "" {
+		return ""
+	}
+
+	ctx.AddTag("faas: " + result)
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusServiceUnavailable)
+	ctx.SetOutputResponse(resp)
+	return result
+}
+
+// Status returns Status generated by the filter, the status of the queue
+// is reported by the FaaSController.
+func (q *queue) Status() interface{} {
+	return nil
+}
+
+// Close closes FaaSQueue.
+func (q *queue) Close() {
+}
@@ -18,7 +18,9 @@
 package worker
 
 import (
+	"io"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"time"
 
@@ -54,7 +56,7 @@ type (
 func NewWorker(superSpec *supervisor.Spec) *Worker {
 	store := storage.NewStorage(superSpec.Name(), superSpec.Super().Cluster())
 	faasProvider := provider.NewProvider(superSpec)
-	ingress := newIngressServer(superSpec, superSpec.Name())
+	ingress := newIngressServer(superSpec, faasProvider)
 	adm := superSpec.ObjectSpec().(*spec.Admin)
 
 	w := &Worker{
@@ -159,6 +161,8 @@ func (worker *Worker) updateStatus() {
 
 	// call ingress server reconciling all function pipeline state
 	worker.ingress.Update(allFunctionMap)
+
+	worker.reconcileColdStarters(allFunctionMap)
 }
 
 // syncStatus sync function's status with
@@ -183,11 +187,30 @@ func (worker *Worker) syncStatus(syncInterval time.Duration) {
 	}
 }
 
+// Status returns the cold start status of the functions.
+func (worker *Worker) Status() map[string]*spec.ColdStartStatus {
+	status := map[string]*spec.ColdStartStatus{}
+	prefix := coldStarterKey(worker.name, "")
+	coldStarters.Range(func(k, v interface{}) bool {
+		if key := k.(string); strings.HasPrefix(key, prefix) {
+			status[strings.TrimPrefix(key, prefix)] = v.(*coldStarter).status()
+		}
+		return true
+	})
+	return status
+}
+
 // Close closes the Egress HTTPServer and Pipelines
 func (worker *Worker) Close() {
 	worker.mutex.Lock()
 	defer worker.mutex.Unlock()
 
 	close(worker.done)
+	worker.closeColdStarters()
 	worker.ingress.Close()
+
+	// some providers hold connections to the FaaS products.
+	if c, ok := worker.provider.(io.Closer); ok {
+		c.Close()
+	}
 }
@@ -19,10 +19,14 @@ package globalfilter
 
 import (
 	"fmt"
+	"net/http"
+	"runtime/debug"
 	"sync/atomic"
 
 	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/pipeline"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/util/codectool"
 )
@@ -37,20 +41,49 @@ const (
 
 type (
 	// GlobalFilter is a business controller.
-	// It provides handler before and after pipeline in HTTPServer.
+	// It provides handler before and after pipeline in HTTPServer, and
+	// the onError pipeline which runs when the pipeline fails.
 	GlobalFilter struct {
 		super     *supervisor.Supervisor
 		superSpec *supervisor.Spec
 		spec      *Spec
 
-		beforePipeline atomic.Value
-		afterPipeline  atomic.Value
+		beforePipeline  atomic.Value
+		afterPipeline   atomic.Value
+		onErrorPipeline atomic.Value
+		// serverPipelines is map[string]*serverPipelines, key is the
+		// name of the HTTPServer.
+		serverPipelines atomic.Value
 	}
 
 	// Spec describes the GlobalFilter.
 	Spec struct {
-		BeforePipeline pipeline.Spec `json:"beforePipeline" jsonschema:"omitempty"`
-		AfterPipeline  pipeline.Spec `json:"afterPipeline" jsonschema:"omitempty"`
+		BeforePipeline  pipeline.Spec     `json:"beforePipeline" jsonschema:"omitempty"`
+		AfterPipeline   pipeline.Spec     `json:"afterPipeline" jsonschema:"omitempty"`
+		OnError         pipeline.Spec     `json:"onError" jsonschema:"omitempty"`
+		ServerOverrides []*ServerOverride `json:"serverOverrides,omitempty" jsonschema:"omitempty"`
+	}
+
+	// ServerOverride overrides the pipelines of GlobalFilter for an
+	// HTTPServer, a pipeline is disabled if the corresponding disable
+	// option is true, or replaced if its spec is not nil.
+	ServerOverride struct {
+		Server         string `json:"server" jsonschema:"required"`
+		DisableBefore  bool   `json:"disableBefore" jsonschema:"omitempty"`
+		DisableAfter   bool   `json:"disableAfter" jsonschema:"omitempty"`
+		DisableOnError bool   `json:"disableOnError" jsonschema:"omitempty"`
+
+		BeforePipeline *pipeline.Spec `json:"beforePipeline,omitempty" jsonschema:"omitempty"`
+		AfterPipeline  *pipeline.Spec `json:"afterPipeline,omitempty" jsonschema:"omitempty"`
+		OnError        *pipeline.Spec `json:"onError,omitempty" jsonschema:"omitempty"`
+	}
+
+	// serverPipelines are the pipelines overridden for an HTTPServer.
+	serverPipelines struct {
+		override *ServerOverride
+		before   *pipeline.Pipeline
+		after    *pipeline.Pipeline
+		onError  *pipeline.Pipeline
 	}
 
 	// pipelineSpec defines pipeline spec to create an pipeline entity.
@@ -101,6 +134,24 @@ func (gf *GlobalFilter) CreateAndUpdateAfterPipelineForSpec(spec *Spec, previous
 	return nil
 }
 
+// CreateAndUpdateOnErrorPipelineForSpec creates onErrorPipeline if the spec is nil, otherwise it updates with the spec.
+func (gf *GlobalFilter) CreateAndUpdateOnErrorPipelineForSpec(spec *Spec, previousGeneration *pipeline.Pipeline) error {
+	onErrorPipeline := &pipelineSpec{
+		Kind: pipeline.Kind,
+		Name: "onError",
+		Spec: spec.OnError,
+	}
+	pipeline, err := gf.CreateAndUpdatePipeline(onErrorPipeline, previousGeneration)
+	if err != nil {
+		return err
+	}
+	if pipeline == nil {
+		return fmt.Errorf("onError pipeline is nil, spec: %v", onErrorPipeline)
+	}
+	gf.onErrorPipeline.Store(pipeline)
+	return nil
+}
+
 // CreateAndUpdatePipeline creates and updates GlobalFilter's pipelines.
 func (gf *GlobalFilter) CreateAndUpdatePipeline(spec *pipelineSpec, previousGeneration *pipeline.Pipeline) (*pipeline.Pipeline, error) {
 	// init jsonConfig
@@ -155,22 +206,92 @@ func (gf *GlobalFilter) Inherit(superSpec *supervisor.Spec, previousGeneration s
 	gf.reload(previousGeneration.(*GlobalFilter))
 }
 
-// Handle `beforePipeline` and `afterPipeline` before and after the handler is executed.
-func (gf *GlobalFilter) Handle(ctx *context.Context, handler context.Handler) {
+// Handle `beforePipeline` and `afterPipeline` before and after the handler is executed,
+// and `onError` if the handler panics or responds 5xx. The pipelines could be
+// overridden by the server.
+func (gf *GlobalFilter) Handle(ctx *context.Context, server string, handler context.Handler) {
 	p, ok := handler.(*pipeline.Pipeline)
 	if !ok {
 		panic("handler is not a pipeline")
 	}
 
-	var before, after *pipeline.Pipeline
-	if v := gf.beforePipeline.Load(); v != nil {
-		before, _ = v.(*pipeline.Pipeline)
+	before, after, onError := gf.pipelines(server)
+	if onError == nil {
+		p.HandleWithBeforeAfter(ctx, before, after)
+		return
 	}
-	if v := gf.afterPipeline.Load(); v != nil {
-		after, _ = v.(*pipeline.Pipeline)
+
+	if failed := gf.handleWithRecover(ctx, p, before, after); failed {
+		onError.Handle(ctx)
 	}
+}
+
+// handleWithRecover handles the request, it returns true if the pipeline
+// panics or the response is 5xx.
+func (gf *GlobalFilter) handleWithRecover(ctx *context.Context, p, before, after *pipeline.Pipeline) (failed bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Errorf("%s: pipeline panics: %v\n%s", gf.superSpec.Name(), err, debug.Stack())
+			setFailureResponse(ctx, http.StatusInternalServerError)
+			failed = true
+		}
+	}()
 
 	p.HandleWithBeforeAfter(ctx, before, after)
+
+	// The HTTPServer responds 503 if there's no response.
+	resp, ok := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response)
+	if !ok {
+		setFailureResponse(ctx, http.StatusServiceUnavailable)
+		return true
+	}
+	return resp.StatusCode() >= 500
+}
+
+func setFailureResponse(ctx *context.Context, statusCode int) {
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(statusCode)
+	ctx.SetResponse(context.DefaultNamespace, resp)
+}
+
+// pipelines returns the before, after and onError pipelines for the server.
+func (gf *GlobalFilter) pipelines(server string) (before, after, onError *pipeline.Pipeline) {
+	before = loadPipeline(&gf.beforePipeline)
+	after = loadPipeline(&gf.afterPipeline)
+	onError = loadPipeline(&gf.onErrorPipeline)
+
+	v := gf.serverPipelines.Load()
+	if v == nil {
+		return
+	}
+	sp := v.(map[string]*serverPipelines)[server]
+	if sp == nil {
+		return
+	}
+
+	if sp.override.DisableBefore {
+		before = nil
+	} else if sp.before != nil {
+		before = sp.before
+	}
+	if sp.override.DisableAfter {
+		after = nil
+	} else if sp.after != nil {
+		after = sp.after
+	}
+	if sp.override.DisableOnError {
+		onError = nil
+	} else if sp.onError != nil {
+		onError = sp.onError
+	}
+	return
+}
+
+func loadPipeline(v *atomic.Value) *pipeline.Pipeline {
+	if p := v.Load(); p != nil {
+		return p.(*pipeline.Pipeline)
+	}
+	return nil
 }
 
 // Close closes GlobalFilter itself.
@@ -187,7 +308,46 @@ func (s *Spec) Validate() (err error) {
 	if err != nil {
 		return fmt.Errorf("after pipeline is invalid: %v", err)
 	}
+	err = s.OnError.Validate()
+	if err != nil {
+		return fmt.Errorf("onError pipeline is invalid: %v", err)
+	}
+
+	servers := map[string]bool{}
+	for _, o := range s.ServerOverrides {
+		if servers[o.Server] {
+			return fmt.Errorf("server %s is overridden more than once", o.Server)
+		}
+		servers[o.Server] = true
+	}
+
+	return nil
+}
+
+// Validate validates ServerOverride.
+func (o *ServerOverride) Validate() error {
+	if o.DisableBefore && o.BeforePipeline != nil {
+		return fmt.Errorf("before pipeline of server %s is both disabled and overridden", o.Server)
+	}
+	if o.DisableAfter && o.AfterPipeline != nil {
+		return fmt.Errorf("after pipeline of server %s is both disabled and overridden", o.Server)
+	}
+	if o.DisableOnError && o.OnError != nil {
+		return fmt.Errorf("onError pipeline of server %s is both disabled and overridden", o.Server)
+	}
 
+	for name, spec := range map[string]*pipeline.Spec{
+		"before":  o.BeforePipeline,
+		"after":   o.AfterPipeline,
+		"onError": o.OnError,
+	} {
+		if spec == nil {
+			continue
+		}
+		if err := spec.Validate(); err != nil {
+			return fmt.Errorf("%s pipeline of server %s is invalid: %v", name, o.Server, err)
+		}
+	}
 	return nil
 }
 
@@ -219,4 +379,58 @@ func (gf *GlobalFilter) reload(previousGeneration *GlobalFilter) {
 			panic(fmt.Errorf("create after pipeline failed: %v", err))
 		}
 	}
+	// create and update onErrorPipeline entity
+	if len(gf.spec.OnError.Flow) != 0 {
+		var onErrorPreviousPipeline *pipeline.Pipeline
+		if previousGeneration != nil {
+			onErrorPreviousPipeline = loadPipeline(&previousGeneration.onErrorPipeline)
+		}
+		err := gf.CreateAndUpdateOnErrorPipelineForSpec(gf.spec, onErrorPreviousPipeline)
+		if err != nil {
+			panic(fmt.Errorf("create onError pipeline failed: %v", err))
+		}
+	}
+
+	gf.reloadServerPipelines(previousGeneration)
+}
+
+// reloadServerPipelines creates and updates the pipelines overridden by servers.
+func (gf *GlobalFilter) reloadServerPipelines(previousGeneration *GlobalFilter) {
+	var previous map[string]*serverPipelines
+	if previousGeneration != nil {
+		if v := previousGeneration.serverPipelines.Load(); v != nil {
+			previous = v.(map[string]*serverPipelines)
+		}
+	}
+
+	create := func(server, name string, spec *pipeline.Spec, previous *pipeline.Pipeline) *pipeline.Pipeline {
+		if spec == nil || len(spec.Flow) == 0 {
+			return nil
+		}
+		ps := &pipelineSpec{
+			Kind: pipeline.Kind,
+			Name: fmt.Sprintf("%s-%s", name, server),
+			Spec: *spec,
+		}
+		p, err := gf.CreateAndUpdatePipeline(ps, previous)
+		if err != nil {
+			panic(fmt.Errorf("create %s pipeline of server %s failed: %v", name, server, err))
+		}
+		return p
+	}
+
+	pipelines := make(map[string]*serverPipelines, len(gf.spec.ServerOverrides))
+	for _, o := range gf.spec.ServerOverrides {
+		prev := previous[o.Server]
+		if prev == nil {
+			prev = &serverPipelines{}
+		}
+		pipelines[o.Server] = &serverPipelines{
+			override: o,
+			before:   create(o.Server, "before", o.BeforePipeline, prev.before),
+			after:    create(o.Server, "after", o.AfterPipeline, prev.after),
+			onError:  create(o.Server, "onError", o.OnError, prev.onError),
+		}
+	}
+	gf.serverPipelines.Store(pipelines)
 }
@@ -0,0 +1,216 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package globalfilter
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	_ "github.com/megaease/easegress/pkg/filters/mock"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/pipeline"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newGlobalFilter(t *testing.T, yamlConfig string) *GlobalFilter {
+	spec, err := supervisor.NewSpec(yamlConfig)
+	if err != nil {
+		t.Fatalf("failed to create spec: %v", err)
+	}
+	gf := &GlobalFilter{}
+	gf.Init(spec)
+	return gf
+}
+
+func newPipeline(t *testing.T, yamlConfig string) *pipeline.Pipeline {
+	spec, err := supervisor.NewSpec(yamlConfig)
+	if err != nil {
+		t.Fatalf("failed to create spec: %v", err)
+	}
+	p := &pipeline.Pipeline{}
+	p.Init(spec, nil)
+	return p
+}
+
+func newContext(t *testing.T) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/orders", nil)
+	req, err := httpprot.NewRequest(stdr)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	ctx := context.New(tracing.NoopSpan)
+	ctx.SetRequest(context.DefaultNamespace, req)
+	return ctx
+}
+
+func response(ctx *context.Context) *httpprot.Response {
+	resp, _ := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response)
+	return resp
+}
+
+// mockPipeline returns the config of a pipeline whose only filter mocks
+// the response with the code and the value of the X-Pipeline header.
+func mockPipeline(code, name string) string {
+	return `
+    flow:
+    - filter: mock
+    filters:
+    - name: mock
+      kind: Mock
+      rules:
+      - match:
+          pathPrefix: /
+        code: ` + code + `
+        headers:
+          X-Pipeline: ` + name + `
+`
+}
+
+// passPipeline is the config of a pipeline which never responds.
+const passPipeline = `
+flow:
+- filter: mock
+filters:
+- name: mock
+  kind: Mock
+  rules:
+  - match:
+      path: /never
+    code: 200
+`
+
+func TestServerOverrides(t *testing.T) {
+	assert := assert.New(t)
+
+	gf := newGlobalFilter(t, `
+kind: GlobalFilter
+name: globalfilter
+beforePipeline:`+mockPipeline("200", "before")+`
+afterPipeline:`+mockPipeline("200", "after")+`
+onError:`+mockPipeline("200", "onError")+`
+serverOverrides:
+- server: server-a
+  disableBefore: true
+  afterPipeline:`+mockPipeline("200", "after-a")+`
+- server: server-b
+  disableOnError: true
+`)
+	defer gf.Close()
+
+	name := func(p *pipeline.Pipeline) string {
+		if p == nil {
+			return ""
+		}
+		ctx := newContext(t)
+		p.Handle(ctx)
+		return response(ctx).HTTPHeader().Get("X-Pipeline")
+	}
+
+	// servers without overrides use the global pipelines.
+	before, after, onError := gf.pipelines("server-c")
+	assert.Equal("before", name(before))
+	assert.Equal("after", name(after))
+	assert.Equal("onError", name(onError))
+
+	// before is disabled and after is replaced for server-a.
+	before, after, onError = gf.pipelines("server-a")
+	assert.Nil(before)
+	assert.Equal("after-a", name(after))
+	assert.Equal("onError", name(onError))
+
+	// onError is disabled for server-b.
+	before, after, onError = gf.pipelines("server-b")
+	assert.Equal("before", name(before))
+	assert.Equal("after", name(after))
+	assert.Nil(onError)
+
+	// the overridden pipelines are inherited by the next generation.
+	spec, err := supervisor.NewSpec(gf.superSpec.JSONConfig())
+	assert.NoError(err)
+	gf2 := &GlobalFilter{}
+	gf2.Inherit(spec, gf)
+	defer gf2.Close()
+	_, after, _ = gf2.pipelines("server-a")
+	assert.Equal("after-a", name(after))
+}
+
+func TestOnError(t *testing.T) {
+	assert := assert.New(t)
+
+	gf := newGlobalFilter(t, `
+kind: GlobalFilter
+name: globalfilter
+beforePipeline:`+mockPipeline("503", "before")+`
+onError:`+mockPipeline("200", "onError")+`
+serverOverrides:
+- server: server-a
+  disableBefore: true
+  afterPipeline:`+mockPipeline("502", "after-a")+`
+- server: server-b
+  beforePipeline:`+mockPipeline("200", "before-b")+`
+- server: server-d
+  disableBefore: true
+`)
+	defer gf.Close()
+
+	p := newPipeline(t, `
+kind: Pipeline
+name: pipeline
+`+passPipeline)
+	defer p.Close()
+
+	// the before pipeline fails.
+	ctx := newContext(t)
+	gf.Handle(ctx, "server-c", p)
+	resp := response(ctx)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Equal("onError", resp.HTTPHeader().Get("X-Pipeline"))
+
+	// the after pipeline fails.
+	ctx = newContext(t)
+	gf.Handle(ctx, "server-a", p)
+	resp = response(ctx)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Equal("onError", resp.HTTPHeader().Get("X-Pipeline"))
+
+	// the onError pipeline is not run if nothing fails.
+	ctx = newContext(t)
+	gf.Handle(ctx, "server-b", p)
+	resp = response(ctx)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Equal("before-b", resp.HTTPHeader().Get("X-Pipeline"))
+
+	// no response is a failure too.
+	ctx = newContext(t)
+	gf.Handle(ctx, "server-d", p)
+	resp = response(ctx)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Equal("onError", resp.HTTPHeader().Get("X-Pipeline"))
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/protocols/httpprot/httpstat"
+	"github.com/megaease/easegress/pkg/util/accesslog"
+)
+
+// newAccessLogEntry creates the access log entry of the request, the
+// upstream address, the retry count and the filter results are recorded
+// in the context data by the filters and the pipeline.
+func newAccessLogEntry(ctx *context.Context, stdr *http.Request, req *httpprot.Request,
+	startAt time.Time, metric *httpstat.Metric, backend, route string) *accesslog.Entry {
+	entry := &accesslog.Entry{
+		StartTime:    startAt,
+		Request:      stdr,
+		RealIP:       req.RealIP(),
+		StatusCode:   metric.StatusCode,
+		Duration:     metric.Duration,
+		RequestSize:  metric.ReqSize,
+		ResponseSize: metric.RespSize,
+		Route:        route,
+		Backend:      backend,
+		Tags:         ctx.Tags(),
+	}
+
+	if fn, ok := ctx.GetData(accesslog.DataFilterResults).(func() string); ok {
+		entry.FilterResults = fn()
+	}
+	if addr, ok := ctx.GetData(accesslog.DataUpstreamAddr).(string); ok {
+		entry.UpstreamAddr = addr
+	}
+	if count, ok := ctx.GetData(accesslog.DataRetryCount).(int); ok {
+		entry.RetryCount = count
+	}
+	if id, ok := ctx.GetData(accesslog.DataRequestID).(string); ok {
+		entry.RequestID = id
+	}
+
+	return entry
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/util/accesslog"
+)
+
+const (
+	// DebugHeader is the header enabling the debug mode of a request, its
+	// value is "<unix timestamp>:<signature>", the signature is the hex
+	// encoded HMAC-SHA256 of the timestamp by the secret.
+	DebugHeader = "X-Easegress-Debug"
+
+	// DebugInfoHeader is the response header of the debug info, which
+	// includes the matched route, the chosen backend and the filters
+	// executed with their results and durations.
+	DebugInfoHeader = "X-Easegress-Debug-Info"
+
+	defaultDebugMaxAge = 5 * time.Minute
+)
+
+type (
+	// DebugSpec describes the debug mode of requests.
+	DebugSpec struct {
+		Secret string `json:"secret" jsonschema:"required"`
+		MaxAge string `json:"maxAge" jsonschema:"omitempty,format=duration"`
+	}
+)
+
+// SignDebugHeader returns the value of DebugHeader of the timestamp.
+func SignDebugHeader(secret string, timestamp time.Time) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	return ts + ":" + debugSignature(secret, ts)
+}
+
+func debugSignature(secret, ts string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify verifies the value of DebugHeader, the timestamp in the value
+// must be within maxAge of now, to limit the replay of leaked values.
+func (spec *DebugSpec) verify(value string, now time.Time) bool {
+	if spec == nil || value == "" {
+		return false
+	}
+
+	ts, signature, ok := strings.Cut(value, ":")
+	if !ok {
+		return false
+	}
+
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	maxAge := defaultDebugMaxAge
+	if d, err := time.ParseDuration(spec.MaxAge); err == nil && d > 0 {
+		maxAge = d
+	}
+	age := now.Sub(time.Unix(sec, 0))
+	if age > maxAge || age < -maxAge {
+		return false
+	}
+
+	expected := debugSignature(spec.Secret, ts)
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// takeHeader verifies and removes DebugHeader from the request header,
+// the header is removed even if it is invalid, so that it is never sent to
+// the backends.
+func (spec *DebugSpec) takeHeader(header http.Header, now time.Time) bool {
+	v := header.Get(DebugHeader)
+	if v == "" {
+		return false
+	}
+	header.Del(DebugHeader)
+	return spec.verify(v, now)
+}
+
+// debugInfo returns the debug info of the request, the filter results,
+// the upstream address and the retry count are recorded in the context
+// data by the pipeline and the filters.
+func debugInfo(ctx *context.Context, route, backend string) string {
+	var sb strings.Builder
+
+	sb.WriteString("route=")
+	sb.WriteString(route)
+	sb.WriteString("; backend=")
+	sb.WriteString(backend)
+
+	if addr, ok := ctx.GetData(accesslog.DataUpstreamAddr).(string); ok {
+		sb.WriteString("; upstream=")
+		sb.WriteString(addr)
+	}
+	if count, ok := ctx.GetData(accesslog.DataRetryCount).(int); ok {
+		sb.WriteString("; retries=")
+		sb.WriteString(strconv.Itoa(count))
+	}
+	if fn, ok := ctx.GetData(accesslog.DataFilterResults).(func() string); ok {
+		sb.WriteString("; filters=")
+		sb.WriteString(strings.TrimPrefix(fn(), "pipeline: "))
+	}
+
+	return sb.String()
+}
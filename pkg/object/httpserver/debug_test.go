@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/protocols/httpprot/httpstat"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/accesslog"
+)
+
+func TestDebugVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	spec := &DebugSpec{Secret: "secret"}
+
+	assert.True(spec.verify(SignDebugHeader("secret", now), now))
+	assert.False(spec.verify(SignDebugHeader("other", now), now))
+	assert.False(spec.verify(SignDebugHeader("secret", now.Add(-time.Hour)), now))
+	assert.False(spec.verify("invalid", now))
+	assert.False(spec.verify("abc:def", now))
+
+	spec.MaxAge = "2h"
+	assert.True(spec.verify(SignDebugHeader("secret", now.Add(-time.Hour)), now))
+
+	var nilSpec *DebugSpec
+	assert.False(nilSpec.verify(SignDebugHeader("secret", now), now))
+}
+
+func TestDebugInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.New(tracing.NoopSpan)
+	assert.Equal("route=/api*; backend=pipeline-demo", debugInfo(ctx, "/api*", "pipeline-demo"))
+
+	ctx.SetData(accesslog.DataUpstreamAddr, "http://127.0.0.1:9095")
+	ctx.SetData(accesslog.DataRetryCount, 2)
+	ctx.SetData(accesslog.DataFilterResults, func() string {
+		return "pipeline: proxy(1ms)"
+	})
+	assert.Equal("route=/api*; backend=pipeline-demo; upstream=http://127.0.0.1:9095; retries=2; filters=proxy(1ms)",
+		debugInfo(ctx, "/api*", "pipeline-demo"))
+}
+
+func TestServeHTTPDebugHeader(t *testing.T) {
+	assert := assert.New(t)
+
+	var upstreamHeader http.Header
+	mm := &contexttest.MockedMuxMapper{}
+	mm.MockedGetHandler = func(name string) (context.Handler, bool) {
+		return &contexttest.MockedHandler{
+			MockedHandle: func(ctx *context.Context) string {
+				req := ctx.GetRequest(context.DefaultNamespace).(*httpprot.Request)
+				upstreamHeader = req.Std().Header.Clone()
+				resp, _ := httpprot.NewResponse(nil)
+				ctx.SetResponse(context.DefaultNamespace, resp)
+				return ""
+			},
+		}, true
+	}
+	m := newMux(httpstat.New(), httpstat.NewTopN(10), mm)
+
+	superSpec, err := supervisor.NewSpec(`
+kind: HTTPServer
+name: test
+port: 8080
+keepAlive: true
+https: false
+debug:
+  secret: secret
+rules:
+- paths:
+  - pathPrefix: /
+    backend: pipeline
+`)
+	assert.NoError(err)
+	m.reload(superSpec, mm)
+
+	serve := func(value string) *httptest.ResponseRecorder {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com/", http.NoBody)
+		stdr.Header.Set(DebugHeader, value)
+		stdw := httptest.NewRecorder()
+		m.ServeHTTP(stdw, stdr)
+		return stdw
+	}
+
+	// the verified header is not sent to the backend.
+	w := serve(SignDebugHeader("secret", time.Now()))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.NotEmpty(w.Header().Get(DebugInfoHeader))
+	assert.NotNil(upstreamHeader)
+	assert.Empty(upstreamHeader.Values(DebugHeader))
+
+	// neither is the invalid one.
+	upstreamHeader = nil
+	w = serve(SignDebugHeader("other", time.Now()))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Empty(w.Header().Get(DebugInfoHeader))
+	assert.NotNil(upstreamHeader)
+	assert.Empty(upstreamHeader.Values(DebugHeader))
+}
@@ -0,0 +1,751 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"bytes"
+	stdcontext "context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+// The protocol hardening layer sits between the listener and net/http. It
+// parses the raw HTTP/1.x request stream, because net/http silently fixes
+// ambiguous requests (e.g. it drops Content-Length if Transfer-Encoding is
+// present) which may be interpreted differently by backends. A rejected
+// request is replaced by a placeholder request, so nothing of it reaches
+// net/http, and the mux responds the placeholder with an error and closes
+// the connection.
+
+const (
+	hardeningModeReject    = "reject"
+	hardeningModeNormalize = "normalize"
+
+	defaultMaxHeaderBytes = 32 * 1024
+	maxChunkLineBytes     = 4096
+	tlsHandshakeTimeout   = 10 * time.Second
+
+	ruleConflictingFraming      = "conflictingFraming"
+	ruleInvalidTransferEncoding = "invalidTransferEncoding"
+	ruleInvalidContentLength    = "invalidContentLength"
+	ruleObsFold                 = "obsFold"
+	ruleInvalidHeader           = "invalidHeader"
+	ruleOversizedHeader         = "oversizedHeader"
+	ruleInvalidChunk            = "invalidChunk"
+)
+
+const (
+	streamHead = iota
+	streamBody
+	streamChunkSize
+	streamChunkData
+	streamChunkCRLF
+	streamTrailer
+	streamPassthrough
+	streamClosed
+)
+
+var (
+	hardeningRules = []string{
+		ruleConflictingFraming,
+		ruleInvalidTransferEncoding,
+		ruleInvalidContentLength,
+		ruleObsFold,
+		ruleInvalidHeader,
+		ruleOversizedHeader,
+		ruleInvalidChunk,
+	}
+
+	placeholderRequest = []byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+
+	errInvalidChunk = errors.New("protocol hardening: invalid chunked encoding")
+)
+
+type (
+	// hardening checks the HTTP/1.x connections of an HTTPServer.
+	hardening struct {
+		spec           *ProtocolHardeningSpec
+		maxHeaderBytes int
+		violations     *violationCounter
+	}
+
+	// violationCounter counts the requests violating each rule.
+	violationCounter struct {
+		counts map[string]*uint64
+	}
+
+	// hardenedListener wraps the connections with hardenedConn. For
+	// HTTPS, it also does the TLS handshake, and only the connections
+	// negotiated HTTP/1.x are wrapped, since net/http needs *tls.Conn to
+	// serve HTTP/2.
+	hardenedListener struct {
+		net.Listener
+		h         *hardening
+		tlsConfig *tls.Config
+
+		conns     chan net.Conn
+		errc      chan error
+		done      chan struct{}
+		closeOnce sync.Once
+	}
+
+	// hardenedConn checks the requests read from the connection, Read is
+	// called sequentially by net/http.
+	hardenedConn struct {
+		net.Conn
+		h        *hardening
+		tlsState *tls.ConnectionState
+
+		buf       []byte
+		raw       []byte
+		out       []byte
+		state     int
+		remaining int64
+		upgrade   bool
+		err       error
+
+		// verdicts are the violated rules of the requests passed to
+		// net/http but not served yet, empty for valid requests.
+		mu       sync.Mutex
+		verdicts []string
+	}
+
+	hardenedConnKey struct{}
+
+	headerField struct {
+		name  string
+		value string
+	}
+)
+
+func newViolationCounter() *violationCounter {
+	vc := &violationCounter{counts: make(map[string]*uint64)}
+	for _, rule := range hardeningRules {
+		vc.counts[rule] = new(uint64)
+	}
+	return vc
+}
+
+func (vc *violationCounter) inc(rule string) {
+	atomic.AddUint64(vc.counts[rule], 1)
+}
+
+// status returns the counts of violated rules, it returns nil if there is
+// no violation.
+func (vc *violationCounter) status() map[string]uint64 {
+	var result map[string]uint64
+	for rule, count := range vc.counts {
+		if n := atomic.LoadUint64(count); n > 0 {
+			if result == nil {
+				result = make(map[string]uint64)
+			}
+			result[rule] = n
+		}
+	}
+	return result
+}
+
+func newHardening(spec *ProtocolHardeningSpec, violations *violationCounter) *hardening {
+	h := &hardening{
+		spec:           spec,
+		maxHeaderBytes: spec.MaxHeaderBytes,
+		violations:     violations,
+	}
+	if h.maxHeaderBytes <= 0 {
+		h.maxHeaderBytes = defaultMaxHeaderBytes
+	}
+	return h
+}
+
+func (h *hardening) normalize() bool {
+	return h.spec.Mode == hardeningModeNormalize
+}
+
+// connContext is the ConnContext of http.Server, it saves the hardened
+// connection into the context, so that the mux could get the verdict of
+// the request.
+func connContext(ctx stdcontext.Context, c net.Conn) stdcontext.Context {
+	if hc, ok := c.(*hardenedConn); ok {
+		return stdcontext.WithValue(ctx, hardenedConnKey{}, hc)
+	}
+	return ctx
+}
+
+func newHardenedListener(l net.Listener, h *hardening, tlsConfig *tls.Config) *hardenedListener {
+	hl := &hardenedListener{
+		Listener:  l,
+		h:         h,
+		tlsConfig: tlsConfig,
+		conns:     make(chan net.Conn),
+		errc:      make(chan error, 1),
+		done:      make(chan struct{}),
+	}
+	if tlsConfig != nil {
+		go hl.acceptTLS()
+	}
+	return hl
+}
+
+// Accept accepts a connection.
+func (hl *hardenedListener) Accept() (net.Conn, error) {
+	if hl.tlsConfig == nil {
+		c, err := hl.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		return hl.h.wrap(c, nil), nil
+	}
+
+	select {
+	case c := <-hl.conns:
+		return c, nil
+	case err := <-hl.errc:
+		return nil, err
+	case <-hl.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (hl *hardenedListener) acceptTLS() {
+	for {
+		c, err := hl.Listener.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			select {
+			case hl.errc <- err:
+			case <-hl.done:
+			}
+			return
+		}
+		go hl.handshake(c)
+	}
+}
+
+func (hl *hardenedListener) handshake(c net.Conn) {
+	tc := tls.Server(c, hl.tlsConfig)
+	tc.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	if err := tc.Handshake(); err != nil {
+		logger.Debugf("tls handshake with %s failed: %v", c.RemoteAddr(), err)
+		tc.Close()
+		return
+	}
+	tc.SetDeadline(time.Time{})
+
+	var conn net.Conn = tc
+	state := tc.ConnectionState()
+	if proto := state.NegotiatedProtocol; proto == "" || proto == "http/1.1" {
+		conn = hl.h.wrap(tc, &state)
+	}
+
+	select {
+	case hl.conns <- conn:
+	case <-hl.done:
+		tc.Close()
+	}
+}
+
+// Close closes the listener.
+func (hl *hardenedListener) Close() error {
+	hl.closeOnce.Do(func() { close(hl.done) })
+	return hl.Listener.Close()
+}
+
+func (h *hardening) wrap(c net.Conn, tlsState *tls.ConnectionState) *hardenedConn {
+	return &hardenedConn{
+		Conn:     c,
+		h:        h,
+		tlsState: tlsState,
+		buf:      make([]byte, 4096),
+	}
+}
+
+// Read reads the checked data of the connection.
+func (c *hardenedConn) Read(p []byte) (int, error) {
+	for {
+		c.process()
+		if len(c.out) > 0 {
+			n := copy(p, c.out)
+			c.out = c.out[n:]
+			return n, nil
+		}
+
+		switch c.state {
+		case streamClosed:
+			if c.err != nil {
+				return 0, c.err
+			}
+			return 0, io.EOF
+		case streamPassthrough:
+			return c.Conn.Read(p)
+		}
+
+		// net/http aborts the background read by setting a past read
+		// deadline, so errors of the underlying connection are not sticky.
+		n, err := c.Conn.Read(c.buf)
+		c.raw = append(c.raw, c.buf[:n]...)
+		if err != nil {
+			c.process()
+			if len(c.out) > 0 {
+				n = copy(p, c.out)
+				c.out = c.out[n:]
+				return n, nil
+			}
+			if c.err != nil {
+				return 0, c.err
+			}
+			return 0, err
+		}
+	}
+}
+
+// process moves the checked data from raw to out.
+func (c *hardenedConn) process() {
+	for len(c.raw) > 0 {
+		switch c.state {
+		case streamHead:
+			if !c.processHead() {
+				return
+			}
+
+		case streamBody, streamChunkData:
+			n := int64(len(c.raw))
+			if n > c.remaining {
+				n = c.remaining
+			}
+			c.emit(int(n))
+			c.remaining -= n
+			if c.remaining == 0 {
+				if c.state == streamBody {
+					c.endMessage()
+				} else {
+					c.state = streamChunkCRLF
+				}
+			}
+
+		case streamChunkCRLF:
+			if len(c.raw) < 2 {
+				return
+			}
+			if c.raw[0] != '\r' || c.raw[1] != '\n' {
+				c.rejectBody()
+				return
+			}
+			c.emit(2)
+			c.state = streamChunkSize
+
+		case streamChunkSize, streamTrailer:
+			i := bytes.IndexByte(c.raw, '\n')
+			if i < 0 {
+				if len(c.raw) > maxChunkLineBytes {
+					c.rejectBody()
+					return
+				}
+				return
+			}
+			line := c.raw[:i+1]
+			if c.state == streamTrailer {
+				if !bytes.HasSuffix(line, []byte("\r\n")) {
+					c.rejectBody()
+					return
+				}
+				c.emit(len(line))
+				if len(line) == 2 {
+					c.endMessage()
+				}
+				continue
+			}
+
+			size, ok := c.h.parseChunkLine(line)
+			if !ok {
+				c.rejectBody()
+				return
+			}
+			c.emit(len(line))
+			if size == 0 {
+				c.state = streamTrailer
+			} else {
+				c.remaining = size
+				c.state = streamChunkData
+			}
+
+		case streamPassthrough:
+			c.emit(len(c.raw))
+
+		case streamClosed:
+			c.raw = nil
+		}
+	}
+}
+
+func (c *hardenedConn) emit(n int) {
+	c.out = append(c.out, c.raw[:n]...)
+	c.raw = c.raw[n:]
+}
+
+func (c *hardenedConn) endMessage() {
+	if c.upgrade {
+		c.state = streamPassthrough
+	} else {
+		c.state = streamHead
+	}
+}
+
+func (c *hardenedConn) rejectBody() {
+	c.h.violations.inc(ruleInvalidChunk)
+	c.state = streamClosed
+	c.raw = nil
+	c.err = errInvalidChunk
+}
+
+// processHead processes the request head, it returns false if the head is
+// incomplete.
+func (c *hardenedConn) processHead() bool {
+	// empty lines before the request line are ignored.
+	for bytes.HasPrefix(c.raw, []byte("\r\n")) {
+		c.raw = c.raw[2:]
+	}
+	if len(c.raw) == 0 {
+		return false
+	}
+
+	end := headEnd(c.raw)
+	if end < 0 {
+		if len(c.raw) > c.h.maxHeaderBytes {
+			c.reject(ruleOversizedHeader)
+			return true
+		}
+		return false
+	}
+	if end > c.h.maxHeaderBytes {
+		c.reject(ruleOversizedHeader)
+		return true
+	}
+
+	head := c.raw[:end]
+	c.raw = c.raw[end:]
+	c.checkHead(head)
+	return true
+}
+
+// headEnd returns the length of the head, including the empty line, it
+// returns -1 if the head is incomplete.
+func headEnd(data []byte) int {
+	start := 0
+	for {
+		i := bytes.IndexByte(data[start:], '\n')
+		if i < 0 {
+			return -1
+		}
+		line := data[start : start+i+1]
+		start += i + 1
+		if len(line) == 1 || (len(line) == 2 && line[0] == '\r') {
+			return start
+		}
+	}
+}
+
+func (c *hardenedConn) checkHead(head []byte) {
+	lines := strings.SplitAfter(string(head), "\n")
+	// the last one is the empty string after the empty line.
+	lines = lines[:len(lines)-1]
+	for _, l := range lines {
+		if !strings.HasSuffix(l, "\r\n") {
+			c.reject(ruleInvalidHeader)
+			return
+		}
+	}
+
+	requestLine := strings.TrimSuffix(lines[0], "\r\n")
+	method, _, _ := strings.Cut(requestLine, " ")
+	normalized := false
+
+	var fields []*headerField
+	for _, l := range lines[1 : len(lines)-1] {
+		l = strings.TrimSuffix(l, "\r\n")
+		if l[0] == ' ' || l[0] == '\t' {
+			c.h.violations.inc(ruleObsFold)
+			if !c.h.normalize() || len(fields) == 0 {
+				c.reject(ruleObsFold)
+				return
+			}
+			last := fields[len(fields)-1]
+			last.value = strings.TrimSpace(last.value + " " + strings.Trim(l, " \t"))
+			normalized = true
+			continue
+		}
+
+		name, value, ok := strings.Cut(l, ":")
+		if !ok || !validToken(name) || strings.ContainsAny(value, "\r\x00") {
+			c.reject(ruleInvalidHeader)
+			return
+		}
+		fields = append(fields, &headerField{name: name, value: strings.Trim(value, " \t")})
+	}
+
+	var te, cl []string
+	upgrade := method == http.MethodConnect
+	for _, f := range fields {
+		switch http.CanonicalHeaderKey(f.name) {
+		case "Transfer-Encoding":
+			te = append(te, strings.Split(f.value, ",")...)
+		case "Content-Length":
+			cl = append(cl, strings.Split(f.value, ",")...)
+		case "Upgrade":
+			upgrade = true
+		}
+	}
+
+	if len(te) > 0 {
+		if len(te) != 1 || !strings.EqualFold(strings.Trim(te[0], " \t"), "chunked") {
+			c.reject(ruleInvalidTransferEncoding)
+			return
+		}
+		if len(cl) > 0 {
+			c.h.violations.inc(ruleConflictingFraming)
+			if !c.h.normalize() {
+				c.reject(ruleConflictingFraming)
+				return
+			}
+			fields = removeHeader(fields, "Content-Length")
+			cl = nil
+			normalized = true
+		}
+	}
+
+	var length int64
+	for i, v := range cl {
+		v = strings.Trim(v, " \t")
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || !isDigits(v) || (i > 0 && n != length) {
+			c.reject(ruleInvalidContentLength)
+			return
+		}
+		length = n
+	}
+
+	c.pushVerdict("")
+	if normalized {
+		c.out = append(c.out, requestLine...)
+		c.out = append(c.out, "\r\n"...)
+		for _, f := range fields {
+			c.out = append(c.out, f.name...)
+			c.out = append(c.out, ": "...)
+			c.out = append(c.out, f.value...)
+			c.out = append(c.out, "\r\n"...)
+		}
+		c.out = append(c.out, "\r\n"...)
+	} else {
+		c.out = append(c.out, head...)
+	}
+
+	c.upgrade = upgrade
+	switch {
+	case len(te) > 0:
+		c.state = streamChunkSize
+	case length > 0:
+		c.remaining = length
+		c.state = streamBody
+	default:
+		c.endMessage()
+	}
+}
+
+// reject replaces the request with the placeholder request, and stops
+// reading the connection.
+func (c *hardenedConn) reject(rule string) {
+	if rule != ruleObsFold && rule != ruleConflictingFraming {
+		c.h.violations.inc(rule)
+	}
+	c.pushVerdict(rule)
+	c.out = append(c.out, placeholderRequest...)
+	c.raw = nil
+	c.state = streamClosed
+}
+
+func (c *hardenedConn) pushVerdict(rule string) {
+	c.mu.Lock()
+	c.verdicts = append(c.verdicts, rule)
+	c.mu.Unlock()
+}
+
+func (c *hardenedConn) popVerdict() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.verdicts) == 0 {
+		return ""
+	}
+	rule := c.verdicts[0]
+	c.verdicts = c.verdicts[1:]
+	return rule
+}
+
+// serve responds the request if it is rejected, it returns false if the
+// request shouldn't be handled further.
+func (c *hardenedConn) serve(w http.ResponseWriter, r *http.Request) bool {
+	rule := c.popVerdict()
+	if rule == "" {
+		if r.TLS == nil && c.tlsState != nil {
+			r.TLS = c.tlsState
+		}
+		return true
+	}
+
+	logger.Debugf("reject request from %s: violate protocol hardening rule %s", r.RemoteAddr, rule)
+	w.Header().Set("Connection", "close")
+	if rule == ruleOversizedHeader {
+		w.WriteHeader(http.StatusRequestHeaderFieldsTooLarge)
+	} else {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	return false
+}
+
+// parseChunkLine parses the chunk size line, and validates the chunk
+// extensions.
+func (h *hardening) parseChunkLine(line []byte) (int64, bool) {
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return 0, false
+	}
+	line = line[:len(line)-2]
+
+	i := 0
+	for i < len(line) && isHex(line[i]) {
+		i++
+	}
+	if i == 0 || i > 15 {
+		return 0, false
+	}
+	size, _ := strconv.ParseInt(string(line[:i]), 16, 64)
+
+	ext := string(line[i:])
+	if strings.Trim(ext, " \t") == "" {
+		return size, ext == ""
+	}
+	if h.spec.RejectChunkExtensions {
+		return 0, false
+	}
+	return size, validChunkExtensions(ext)
+}
+
+// validChunkExtensions validates chunk extensions:
+//
+//	chunk-ext = *( BWS ";" BWS ext-name [ BWS "=" BWS ext-val ] )
+//	ext-val   = token / quoted-string
+func validChunkExtensions(ext string) bool {
+	for {
+		ext = strings.TrimLeft(ext, " \t")
+		if ext == "" {
+			return true
+		}
+		if ext[0] != ';' {
+			return false
+		}
+		ext = strings.TrimLeft(ext[1:], " \t")
+
+		n := tokenLen(ext)
+		if n == 0 {
+			return false
+		}
+		ext = strings.TrimLeft(ext[n:], " \t")
+		if ext == "" || ext[0] != '=' {
+			continue
+		}
+
+		ext = strings.TrimLeft(ext[1:], " \t")
+		if ext != "" && ext[0] == '"' {
+			n = quotedStringLen(ext)
+		} else {
+			n = tokenLen(ext)
+		}
+		if n == 0 {
+			return false
+		}
+		ext = ext[n:]
+	}
+}
+
+func removeHeader(fields []*headerField, name string) []*headerField {
+	result := fields[:0]
+	for _, f := range fields {
+		if http.CanonicalHeaderKey(f.name) != name {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+func isHex(b byte) bool {
+	return ('0' <= b && b <= '9') || ('a' <= b && b <= 'f') || ('A' <= b && b <= 'F')
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isTokenChar(b byte) bool {
+	if ('0' <= b && b <= '9') || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') {
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", b) >= 0
+}
+
+func tokenLen(s string) int {
+	i := 0
+	for i < len(s) && isTokenChar(s[i]) {
+		i++
+	}
+	return i
+}
+
+func validToken(s string) bool {
+	return s != "" && tokenLen(s) == len(s)
+}
+
+// quotedStringLen returns the length of the quoted string at the beginning
+// of s, or 0 if it is invalid.
+func quotedStringLen(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch b := s[i]; {
+		case b == '"':
+			return i + 1
+		case b == '\\':
+			i++
+		case b < ' ' && b != '\t', b == 0x7f:
+			return 0
+		}
+	}
+	return 0
+}
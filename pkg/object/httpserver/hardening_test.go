@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readerConn is a net.Conn reading from a string in small pieces.
+type readerConn struct {
+	net.Conn
+	data string
+}
+
+func (c *readerConn) Read(p []byte) (int, error) {
+	if c.data == "" {
+		return 0, io.EOF
+	}
+	if len(p) > 7 {
+		p = p[:7]
+	}
+	n := copy(p, c.data)
+	c.data = c.data[n:]
+	return n, nil
+}
+
+func harden(spec *ProtocolHardeningSpec, data string) (string, []string, error) {
+	h := newHardening(spec, newViolationCounter())
+	c := h.wrap(&readerConn{data: data}, nil)
+	out, err := io.ReadAll(c)
+	return string(out), c.verdicts, err
+}
+
+func TestHardenedConn(t *testing.T) {
+	assert := assert.New(t)
+	spec := &ProtocolHardeningSpec{}
+
+	// valid pipelined requests pass through unchanged.
+	data := "\r\nPOST /a HTTP/1.1\r\nHost: a\r\nContent-Length: 5\r\n\r\nhello" +
+		"POST /b HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"5;name=\"v\\\"x\"\r\nhello\r\n0\r\nTrailer: x\r\n\r\n" +
+		"GET /c HTTP/1.1\r\nHost: a\r\n\r\n"
+	out, verdicts, err := harden(spec, data)
+	assert.Nil(err)
+	assert.Equal(data[2:], out)
+	assert.Equal([]string{"", "", ""}, verdicts)
+
+	// a smuggled request in the body is not treated as a request head.
+	data = "POST /a HTTP/1.1\r\nContent-Length: 41\r\n\r\n" +
+		"GET /x HTTP/1.1\r\nTransfer-Encoding: x\r\n\r\n"
+	out, verdicts, err = harden(spec, data)
+	assert.Nil(err)
+	assert.Equal(data, out)
+	assert.Equal([]string{""}, verdicts)
+
+	cases := []struct {
+		head string
+		rule string
+	}{
+		{"Content-Length: 5\r\nTransfer-Encoding: chunked\r\n", ruleConflictingFraming},
+		{"Transfer-Encoding: gzip, chunked\r\n", ruleInvalidTransferEncoding},
+		{"Transfer-Encoding: chunked\r\nTransfer-Encoding: chunked\r\n", ruleInvalidTransferEncoding},
+		{"Transfer-Encoding: xchunked\r\n", ruleInvalidTransferEncoding},
+		{"Content-Length: +5\r\n", ruleInvalidContentLength},
+		{"Content-Length: 5, 6\r\n", ruleInvalidContentLength},
+		{"X-A: a\r\n b\r\n", ruleObsFold},
+		{"Transfer-Encoding : chunked\r\n", ruleInvalidHeader},
+		{"X-A: a\nX-B: b\r\n", ruleInvalidHeader},
+		{"X-A a\r\n", ruleInvalidHeader},
+	}
+	for _, c := range cases {
+		data = "POST / HTTP/1.1\r\nHost: a\r\n" + c.head + "\r\nGET / HTTP/1.1\r\n\r\n"
+		out, verdicts, err = harden(spec, data)
+		assert.Nil(err)
+		assert.Equal(string(placeholderRequest), out, c.head)
+		assert.Equal([]string{c.rule}, verdicts, c.head)
+	}
+
+	// oversized header
+	spec = &ProtocolHardeningSpec{MaxHeaderBytes: 64}
+	out, verdicts, _ = harden(spec, "GET / HTTP/1.1\r\nX-A: "+strings.Repeat("a", 64))
+	assert.Equal(string(placeholderRequest), out)
+	assert.Equal([]string{ruleOversizedHeader}, verdicts)
+
+	// invalid chunks
+	for _, chunk := range []string{"5\r\nhelloX\r\n", "5;\r\nhello\r\n", "5 x\r\nhello\r\n", "-5\r\n", "5\nhello\r\n"} {
+		_, _, err = harden(spec, "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n"+chunk+"0\r\n\r\n")
+		assert.Equal(errInvalidChunk, err, chunk)
+	}
+	spec = &ProtocolHardeningSpec{RejectChunkExtensions: true}
+	_, _, err = harden(spec, "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5;a=b\r\nhello\r\n0\r\n\r\n")
+	assert.Equal(errInvalidChunk, err)
+
+	// normalize
+	spec = &ProtocolHardeningSpec{Mode: hardeningModeNormalize}
+	data = "POST / HTTP/1.1\r\nX-A: a\r\n\tb\r\nContent-Length: 3\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n"
+	out, verdicts, err = harden(spec, data)
+	assert.Nil(err)
+	assert.Equal("POST / HTTP/1.1\r\nX-A: a b\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", out)
+	assert.Equal([]string{""}, verdicts)
+}
+
+func TestHardenedServer(t *testing.T) {
+	assert := assert.New(t)
+
+	vc := newViolationCounter()
+	h := newHardening(&ProtocolHardeningSpec{}, vc)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+
+	srv := &http.Server{
+		ConnContext: connContext,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hc := r.Context().Value(hardenedConnKey{}).(*hardenedConn)
+			if hc.serve(w, r) {
+				io.Copy(io.Discard, r.Body)
+				w.Write([]byte(r.URL.Path))
+			}
+		}),
+	}
+	go srv.Serve(newHardenedListener(l, h, nil))
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.Nil(err)
+	defer conn.Close()
+
+	conn.Write([]byte("POST /a HTTP/1.1\r\nHost: a\r\nContent-Length: 2\r\n\r\nhi" +
+		"POST /b HTTP/1.1\r\nHost: a\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n"))
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	assert.Nil(err)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal("/a", string(body))
+
+	resp, err = http.ReadResponse(br, nil)
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	assert.True(resp.Close)
+
+	assert.Equal(map[string]uint64{ruleConflictingFraming: 1}, vc.status())
+}
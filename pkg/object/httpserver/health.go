@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"net/http"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+type (
+	// HealthSpec describes the health probes served on the traffic port,
+	// so that load balancers can check the member without access to the
+	// administration port.
+	HealthSpec struct {
+		LivenessPath  string `json:"livenessPath" jsonschema:"omitempty,pattern=^/"`
+		ReadinessPath string `json:"readinessPath" jsonschema:"omitempty,pattern=^/"`
+	}
+)
+
+// serveHealth serves the health probes, it returns false if the request
+// is not a health probe.
+func (mi *muxInstance) serveHealth(w http.ResponseWriter, r *http.Request) bool {
+	spec := mi.spec.Health
+	if spec == nil || r.Method != http.MethodGet {
+		return false
+	}
+
+	switch r.URL.Path {
+	case "":
+		return false
+	case spec.LivenessPath:
+		w.WriteHeader(http.StatusOK)
+		return true
+	case spec.ReadinessPath:
+		var readiness *supervisor.Readiness
+		if super := mi.superSpec.Super(); super != nil {
+			readiness = super.CheckReadiness()
+		} else {
+			readiness = &supervisor.Readiness{Ready: true}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if !readiness.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write(codectool.MustMarshalJSON(readiness))
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func TestServeHealth(t *testing.T) {
+	assert := assert.New(t)
+
+	yamlConfig := `
+kind: HTTPServer
+name: test
+port: 8080
+https: false
+health:
+  livenessPath: /healthz
+  readinessPath: /readyz
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.NoError(err)
+	mi := &muxInstance{superSpec: superSpec, spec: superSpec.ObjectSpec().(*Spec)}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	assert.True(mi.serveHealth(w, r))
+	assert.Equal(http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	assert.True(mi.serveHealth(w, r))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), `"ready":true`)
+
+	r = httptest.NewRequest(http.MethodPost, "/readyz", nil)
+	assert.False(mi.serveHealth(httptest.NewRecorder(), r))
+
+	r = httptest.NewRequest(http.MethodGet, "/api", nil)
+	assert.False(mi.serveHealth(httptest.NewRecorder(), r))
+
+	mi.spec.Health = nil
+	r = httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	assert.False(mi.serveHealth(httptest.NewRecorder(), r))
+}
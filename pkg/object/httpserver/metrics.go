@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot/httpstat"
+	"github.com/megaease/easegress/pkg/util/prometheushelper"
+)
+
+// routeUnmatched is the route label of requests matching no path.
+const routeUnmatched = "unmatched"
+
+// metrics are the Prometheus metrics of an HTTPServer.
+type metrics struct {
+	name   string
+	routes *prometheushelper.LabelGuard
+
+	requests     *prometheus.CounterVec
+	duration     *prometheus.HistogramVec
+	requestSize  *prometheus.CounterVec
+	responseSize *prometheus.CounterVec
+}
+
+func newMetrics(name string) *metrics {
+	labels := []string{"name", "backend", "route", "status_class"}
+	return &metrics{
+		name:   name,
+		routes: prometheushelper.NewLabelGuard(),
+
+		requests: prometheushelper.NewCounter("httpserver_requests_total",
+			"the total count of requests of HTTPServer", labels),
+		duration: prometheushelper.NewHistogram("httpserver_request_duration_seconds",
+			"the duration of requests of HTTPServer", labels, nil),
+		requestSize: prometheushelper.NewCounter("httpserver_request_bytes_total",
+			"the total size of requests of HTTPServer", labels),
+		responseSize: prometheushelper.NewCounter("httpserver_response_bytes_total",
+			"the total size of responses of HTTPServer", labels),
+	}
+}
+
+// routeLabel returns the label of the path in metrics.
+func (mp *MuxPath) routeLabel() string {
+	switch {
+	case mp.path != "":
+		return mp.path
+	case mp.pathPrefix != "":
+		return mp.pathPrefix + "*"
+	case mp.pathRegexp != "":
+		return mp.pathRegexp
+	case mp.pathTemplate != nil:
+		return mp.pathTemplate.String()
+	default:
+		return "*"
+	}
+}
+
+func (m *metrics) stat(backend, route string, metric *httpstat.Metric) {
+	// metrics is nil before the first reload of the mux.
+	if m == nil {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"name":         m.name,
+		"backend":      backend,
+		"route":        m.routes.Value(route),
+		"status_class": prometheushelper.StatusClass(metric.StatusCode),
+	}
+
+	m.requests.With(labels).Inc()
+	m.duration.With(labels).Observe(metric.Duration.Seconds())
+	m.requestSize.With(labels).Add(float64(metric.ReqSize))
+	m.responseSize.With(labels).Add(float64(metric.RespSize))
+}
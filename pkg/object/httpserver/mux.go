@@ -25,7 +25,9 @@ import (
 	"reflect"
 	"regexp"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	lru "github.com/hashicorp/golang-lru"
 	"github.com/megaease/easegress/pkg/object/globalfilter"
@@ -34,11 +36,14 @@ import (
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/autocertmanager"
+	"github.com/megaease/easegress/pkg/object/canary"
 	"github.com/megaease/easegress/pkg/protocols/httpprot/httpstat"
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/accesslog"
 	"github.com/megaease/easegress/pkg/util/fasttime"
 	"github.com/megaease/easegress/pkg/util/ipfilter"
+	"github.com/megaease/easegress/pkg/util/pathadaptor"
 	"github.com/megaease/easegress/pkg/util/readers"
 	"github.com/megaease/easegress/pkg/util/stringtool"
 )
@@ -47,8 +52,13 @@ type (
 	mux struct {
 		httpStat *httpstat.HTTPStat
 		topN     *httpstat.TopN
+		metrics  *metrics
 
 		inst atomic.Value // *muxInstance
+
+		// readyObjects records the backends and the global filter which
+		// have been ready, the requests to them are never gated again.
+		readyObjects *sync.Map
 	}
 
 	muxInstance struct {
@@ -56,12 +66,21 @@ type (
 		spec      *Spec
 		httpStat  *httpstat.HTTPStat
 		topN      *httpstat.TopN
+		metrics   *metrics
 
 		muxMapper context.MuxMapper
+		resources *supervisor.ResourceTracker
+
+		// The requests to the objects not ready yet are shed until
+		// gateDeadline, objectReady is replaced in tests.
+		readyObjects *sync.Map
+		gateDeadline time.Time
+		objectReady  func(name string) bool
 
 		cache *lru.ARCCache
 
 		tracer       *tracing.Tracer
+		accessLog    *accesslog.Logger
 		ipFilter     *ipfilter.IPFilter
 		ipFilterChan *ipfilter.IPFilters
 
@@ -87,6 +106,7 @@ type (
 		pathPrefix        string
 		pathRegexp        string
 		pathRE            *regexp.Regexp
+		pathTemplate      *pathadaptor.Pattern
 		methods           []string
 		rewriteTarget     string
 		backend           string
@@ -215,6 +235,16 @@ func newMuxPath(parentIPFilters *ipfilter.IPFilters, path *Path) *MuxPath {
 		}
 	}
 
+	var pathTemplate *pathadaptor.Pattern
+	if path.PathTemplate != "" {
+		var err error
+		pathTemplate, err = pathadaptor.NewPattern(path.PathTemplate)
+		// defensive programming
+		if err != nil {
+			logger.Errorf("BUG: parse path template %s failed: %v", path.PathTemplate, err)
+		}
+	}
+
 	for _, p := range path.Headers {
 		p.initHeaderRoute()
 	}
@@ -227,6 +257,7 @@ func newMuxPath(parentIPFilters *ipfilter.IPFilters, path *Path) *MuxPath {
 		pathPrefix:        path.PathPrefix,
 		pathRegexp:        path.PathRegexp,
 		pathRE:            pathRE,
+		pathTemplate:      pathTemplate,
 		rewriteTarget:     path.RewriteTarget,
 		methods:           path.Methods,
 		backend:           path.Backend,
@@ -237,7 +268,7 @@ func newMuxPath(parentIPFilters *ipfilter.IPFilters, path *Path) *MuxPath {
 }
 
 func (mp *MuxPath) matchPath(r *httpprot.Request) bool {
-	if mp.path == "" && mp.pathPrefix == "" && mp.pathRE == nil {
+	if mp.path == "" && mp.pathPrefix == "" && mp.pathRE == nil && mp.pathTemplate == nil {
 		return true
 	}
 
@@ -248,13 +279,31 @@ func (mp *MuxPath) matchPath(r *httpprot.Request) bool {
 	if mp.pathPrefix != "" && strings.HasPrefix(path, mp.pathPrefix) {
 		return true
 	}
-	if mp.pathRE != nil {
-		return mp.pathRE.MatchString(path)
+	if mp.pathRE != nil && mp.pathRE.MatchString(path) {
+		return true
+	}
+	if mp.pathTemplate != nil {
+		_, ok := mp.pathTemplate.Match(path)
+		return ok
 	}
 
 	return false
 }
 
+// pathParams returns the values of the parameters of the path template,
+// or of the named groups of the path regexp.
+func (mp *MuxPath) pathParams(path string) map[string]string {
+	if mp.pathTemplate != nil {
+		if params, ok := mp.pathTemplate.Match(path); ok {
+			return params
+		}
+	}
+	if mp.pathRE != nil {
+		return pathadaptor.RegexpParams(mp.pathRE, path)
+	}
+	return nil
+}
+
 func (mp *MuxPath) rewrite(r *httpprot.Request) {
 	if mp.rewriteTarget == "" {
 		return
@@ -273,9 +322,19 @@ func (mp *MuxPath) rewrite(r *httpprot.Request) {
 		return
 	}
 
-	// sure (mp.pathRE != nil && mp.pathRE.MatchString(path)) is true
-	path = mp.pathRE.ReplaceAllString(path, mp.rewriteTarget)
-	r.SetPath(path)
+	if mp.pathRE != nil && mp.pathRE.MatchString(path) {
+		path = mp.pathRE.ReplaceAllString(path, mp.rewriteTarget)
+		r.SetPath(path)
+		return
+	}
+
+	// the parameters in the rewrite target are replaced with their values.
+	if mp.pathTemplate == nil {
+		return
+	}
+	if params, ok := mp.pathTemplate.Match(path); ok {
+		r.SetPath(pathadaptor.Expand(mp.rewriteTarget, params))
+	}
 }
 
 func (mp *MuxPath) matchMethod(r *httpprot.Request) bool {
@@ -316,8 +375,9 @@ func (mp *MuxPath) matchHeaders(r *httpprot.Request) bool {
 
 func newMux(httpStat *httpstat.HTTPStat, topN *httpstat.TopN, mapper context.MuxMapper) *mux {
 	m := &mux{
-		httpStat: httpStat,
-		topN:     topN,
+		httpStat:     httpStat,
+		topN:         topN,
+		readyObjects: &sync.Map{},
 	}
 
 	m.inst.Store(&muxInstance{
@@ -334,6 +394,10 @@ func newMux(httpStat *httpstat.HTTPStat, topN *httpstat.TopN, mapper context.Mux
 func (m *mux) reload(superSpec *supervisor.Spec, muxMapper context.MuxMapper) {
 	spec := superSpec.ObjectSpec().(*Spec)
 
+	if m.metrics == nil {
+		m.metrics = newMetrics(superSpec.Name())
+	}
+
 	tracer := tracing.NoopTracer
 	oldInst := m.inst.Load().(*muxInstance)
 	if !reflect.DeepEqual(oldInst.spec.Tracing, spec.Tracing) {
@@ -353,16 +417,38 @@ func (m *mux) reload(superSpec *supervisor.Spec, muxMapper context.MuxMapper) {
 		tracer = oldInst.tracer
 	}
 
+	accessLog := oldInst.accessLog
+	if !reflect.DeepEqual(oldInst.spec.AccessLog, spec.AccessLog) {
+		if oldInst.accessLog != nil {
+			defer oldInst.accessLog.Close()
+		}
+		accessLog = nil
+		if spec.AccessLog != nil {
+			accessLog0, err := accesslog.New(spec.AccessLog)
+			if err != nil {
+				logger.Errorf("create access log failed: %v", err)
+			} else {
+				accessLog = accessLog0
+			}
+		}
+	}
+
 	inst := &muxInstance{
 		superSpec:    superSpec,
 		spec:         spec,
 		muxMapper:    muxMapper,
+		resources:    superSpec.Super().ResourceTracker(superSpec.Name()),
+		readyObjects: m.readyObjects,
+		gateDeadline: fasttime.Now().Add(spec.dependencyGateTimeout()),
+		objectReady:  superSpec.Super().ObjectReady,
 		httpStat:     m.httpStat,
 		topN:         m.topN,
+		metrics:      m.metrics,
 		ipFilter:     newIPFilter(spec.IPFilter),
 		ipFilterChan: newIPFilterChain(nil, spec.IPFilter),
 		rules:        make([]*muxRule, len(spec.Rules)),
 		tracer:       tracer,
+		accessLog:    accessLog,
 	}
 
 	if spec.CacheSize > 0 {
@@ -391,6 +477,14 @@ func (m *mux) reload(superSpec *supervisor.Spec, muxMapper context.MuxMapper) {
 }
 
 func (m *mux) ServeHTTP(stdw http.ResponseWriter, stdr *http.Request) {
+	// The verdict of protocol hardening must be consumed for every request
+	// of a hardened connection, so it is checked first.
+	if hc, ok := stdr.Context().Value(hardenedConnKey{}).(*hardenedConn); ok {
+		if !hc.serve(stdw, stdr) {
+			return
+		}
+	}
+
 	// HTTP-01 challenges requires HTTP server to listen on port 80, but we
 	// don't know which HTTP server listen on this port (consider there's an
 	// nginx sitting in front of Easegress), so all HTTP servers need to
@@ -401,7 +495,36 @@ func (m *mux) ServeHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 	}
 
 	// Forward to the current muxInstance to handle the request.
-	m.inst.Load().(*muxInstance).serveHTTP(stdw, stdr)
+	inst := m.inst.Load().(*muxInstance)
+	if inst.serveHealth(stdw, stdr) {
+		return
+	}
+
+	// Shed the traffic if the server exceeds its resource limits.
+	if inst.resources.Exceeded() {
+		stdw.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	inst.serveHTTP(stdw, stdr)
+}
+
+// gated returns whether the requests to the object, i.e. a backend or the
+// global filter, are shed because it is not ready. The object is only
+// waited for until it becomes ready for the first time, or the gate
+// timeout of the server expires, the failures after that are handled by
+// the object itself.
+func (mi *muxInstance) gated(name string) bool {
+	if name == "" || mi.objectReady == nil {
+		return false
+	}
+	if _, ok := mi.readyObjects.Load(name); ok {
+		return false
+	}
+	if mi.objectReady(name) {
+		mi.readyObjects.Store(name, struct{}{})
+		return false
+	}
+	return fasttime.Now().Before(mi.gateDeadline)
 }
 
 func buildFailureResponse(ctx *context.Context, statusCode int) *httpprot.Response {
@@ -418,12 +541,32 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 	stdr.Body = body
 
 	startAt := fasttime.Now()
-	span := mi.tracer.NewSpanWithStart(mi.superSpec.Name(), startAt)
-	ctx := context.New(span)
+
+	// The debug header is removed, so that it is not sent to the backends.
+	debug := mi.spec.Debug.takeHeader(stdr.Header, startAt)
+
+	// The request ID is set to the header before creating the request, so
+	// that it is sent to the backends.
+	requestID := mi.spec.RequestID.ensure(stdr, startAt)
 
 	// httpprot.NewRequest never returns an error.
 	req, _ := httpprot.NewRequest(stdr)
 
+	// Search the route before creating the span, as the sampling of the
+	// span depends on the pipeline of the route.
+	route := mi.search(req)
+	pipeline := ""
+	if route.code == 0 {
+		pipeline = route.path.backend
+	}
+	span := mi.tracer.NewServerSpan(stdr, mi.superSpec.Name(), pipeline, startAt)
+	ctx := context.New(span)
+	if requestID != "" {
+		ctx.SetData(accesslog.DataRequestID, requestID)
+		ctx.AddTag("requestID: " + requestID)
+		span.Tag(requestIDSpanTag, requestID)
+	}
+
 	// Calculate the meta size now, as everything could be modified.
 	reqMetaSize := req.MetaSize()
 	ctx.SetRequest(context.DefaultNamespace, req)
@@ -431,6 +574,13 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 	// get topN here, as the path could be modified later.
 	topN := mi.topN.Stat(req.Path())
 
+	// observe reports the status code to the canary if the backend is a
+	// canary.
+	var observe func(statusCode int)
+
+	// the labels of the request in metrics.
+	backendLabel, routeLabel := "", routeUnmatched
+
 	defer func() {
 		var resp *httpprot.Response
 		if v := ctx.GetResponse(context.DefaultNamespace); v == nil {
@@ -443,11 +593,23 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 			resp = r
 		}
 
+		if observe != nil {
+			observe(resp.StatusCode())
+		}
+
 		// Send the response.
 		header := stdw.Header()
 		for k, v := range resp.HTTPHeader() {
 			header[k] = v
 		}
+		if requestID != "" {
+			header.Set(mi.spec.RequestID.header(), requestID)
+		}
+		if debug {
+			info := debugInfo(ctx, routeLabel, backendLabel)
+			header.Set(DebugInfoHeader, info)
+			logger.Infof("%s: debug info of %s %s: %s", mi.superSpec.Name(), stdr.Method, stdr.RequestURI, info)
+		}
 		stdw.WriteHeader(resp.StatusCode())
 		respBodySize, _ := io.Copy(stdw, resp.GetPayload())
 
@@ -465,10 +627,17 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 		}
 		topN.Stat(&metric)
 		mi.httpStat.Stat(&metric)
+		mi.metrics.stat(backendLabel, routeLabel, &metric)
 
 		span.Finish()
 
 		// Write access log.
+		if mi.accessLog != nil {
+			if mi.accessLog.ShouldLog(backendLabel) {
+				mi.accessLog.Log(newAccessLogEntry(ctx, stdr, req, startAt, &metric, backendLabel, routeLabel))
+			}
+			return
+		}
 		logger.LazyHTTPAccess(func() string {
 			// log format:
 			//
@@ -485,20 +654,41 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 		})
 	}()
 
-	route := mi.search(req)
 	if route.code != 0 {
 		logger.Debugf("%s: status code of result route: %d", mi.superSpec.Name(), route.code)
 		buildFailureResponse(ctx, route.code)
 		return
 	}
 
-	handler, ok := mi.muxMapper.GetHandler(route.path.backend)
+	backend := route.path.backend
+	routeLabel = route.path.routeLabel()
+	handler, ok := mi.muxMapper.GetHandler(backend)
+	if !ok {
+		// The backend could be a canary which chooses the pipeline.
+		if c := mi.getCanary(backend); c != nil {
+			backend = c.Route(req)
+			handler, ok = mi.muxMapper.GetHandler(backend)
+			observe = func(statusCode int) {
+				c.Observe(backend, statusCode)
+			}
+		}
+	}
+	backendLabel = backend
 	if !ok {
-		logger.Debugf("%s: backend %q not found", mi.superSpec.Name(), route.path.backend)
+		logger.Debugf("%s: backend %q not found", mi.superSpec.Name(), backend)
+		buildFailureResponse(ctx, http.StatusServiceUnavailable)
+		return
+	}
+	if mi.gated(backend) || mi.gated(mi.spec.GlobalFilter) {
+		logger.Debugf("%s: backend %q is not ready", mi.superSpec.Name(), backend)
 		buildFailureResponse(ctx, http.StatusServiceUnavailable)
 		return
 	}
 
+	// the parameters are extracted before the path is rewritten.
+	if params := route.path.pathParams(req.Path()); len(params) > 0 {
+		ctx.SetData(httpprot.DataPathParams, params)
+	}
 	route.path.rewrite(req)
 	if mi.spec.XForwardedFor {
 		appendXForwardedFor(req)
@@ -520,12 +710,20 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 		return
 	}
 
+	// The body in memory is accounted to the server until the request is
+	// handled.
+	if !req.IsStream() {
+		size := int64(len(req.RawPayload()))
+		mi.resources.AddMemory(size)
+		defer mi.resources.AddMemory(-size)
+	}
+
 	// global filter
 	globalFilter := mi.getGlobalFilter()
 	if globalFilter == nil {
 		handler.Handle(ctx)
 	} else {
-		globalFilter.Handle(ctx, handler)
+		globalFilter.Handle(ctx, mi.superSpec.Name(), handler)
 	}
 }
 
@@ -636,10 +834,26 @@ func (mi *muxInstance) getGlobalFilter() *globalfilter.GlobalFilter {
 	return globalFilterInstance
 }
 
+func (mi *muxInstance) getCanary(name string) *canary.Canary {
+	super := mi.superSpec.Super()
+	if super == nil {
+		return nil
+	}
+	entity, ok := super.GetBusinessController(name)
+	if entity == nil || !ok {
+		return nil
+	}
+	c, _ := entity.Instance().(*canary.Canary)
+	return c
+}
+
 func (mi *muxInstance) close() {
 	if err := mi.tracer.Close(); err != nil {
 		logger.Errorf("%s close tracer failed: %v", mi.superSpec.Name(), err)
 	}
+	if mi.accessLog != nil {
+		mi.accessLog.Close()
+	}
 }
 
 func (m *mux) close() {
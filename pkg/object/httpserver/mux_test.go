@@ -24,6 +24,7 @@ import (
 	"strings"
 	"testing"
 	"testing/iotest"
+	"time"
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/context/contexttest"
@@ -182,6 +183,39 @@ func TestMuxPath(t *testing.T) {
 	assert.Equal("/1abz", req.Path())
 }
 
+func TestMuxPathTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com/users/42/orders/7", nil)
+	req, _ := httpprot.NewRequest(stdr)
+
+	mp := newMuxPath(nil, &Path{PathTemplate: "/users/{id}/orders/{oid}", RewriteTarget: "/v2/orders/{oid}"})
+	assert.True(mp.matchPath(req))
+	assert.Equal(map[string]string{"id": "42", "oid": "7"}, mp.pathParams(req.Path()))
+	assert.Equal("/users/{id}/orders/{oid}", mp.routeLabel())
+
+	mp = newMuxPath(nil, &Path{PathTemplate: "/users/{id}/orders/{oid}", RewriteTarget: "/v2/orders/{oid}/{unknown}"})
+	mp.rewrite(req)
+	assert.Equal("/v2/orders/7/{unknown}", req.Path())
+
+	mp = newMuxPath(nil, &Path{PathTemplate: "/users/{id}"})
+	assert.False(mp.matchPath(req))
+
+	mp = newMuxPath(nil, &Path{PathTemplate: "/v2/{rest*}"})
+	assert.True(mp.matchPath(req))
+	assert.Equal(map[string]string{"rest": "orders/7/{unknown}"}, mp.pathParams(req.Path()))
+
+	// named groups of the path regexp are parameters too.
+	mp = newMuxPath(nil, &Path{PathRegexp: "^/v2/(?P<kind>[a-z]+)/"})
+	assert.Equal(map[string]string{"kind": "orders"}, mp.pathParams(req.Path()))
+	mp = newMuxPath(nil, &Path{PathRegexp: "^/v2/([a-z]+)/"})
+	assert.Nil(mp.pathParams(req.Path()))
+
+	for _, text := range []string{"users/{id}", "/users/{id", "/users/id}", "/users/{}", "/{id}/{id}", "/{rest*}/x"} {
+		assert.Error((&Path{PathTemplate: text}).Validate(), text)
+	}
+}
+
 func TestMuxReload(t *testing.T) {
 	assert := assert.New(t)
 	m := newMux(&httpstat.HTTPStat{}, &httpstat.TopN{}, nil)
@@ -348,6 +382,84 @@ rules:
 	assert.Equal(http.StatusBadRequest, stdw.Code)
 }
 
+func TestServeHTTPDependencyGate(t *testing.T) {
+	assert := assert.New(t)
+
+	mm := &contexttest.MockedMuxMapper{}
+	mm.MockedGetHandler = func(name string) (context.Handler, bool) {
+		return &contexttest.MockedHandler{
+			MockedHandle: func(ctx *context.Context) string {
+				resp, _ := httpprot.NewResponse(nil)
+				ctx.SetResponse(context.DefaultNamespace, resp)
+				return ""
+			},
+		}, true
+	}
+	m := newMux(httpstat.New(), httpstat.NewTopN(10), mm)
+
+	ready := map[string]bool{"abc-pipeline": true}
+	reload := func(yamlConfig string) *muxInstance {
+		superSpec, err := supervisor.NewSpec(yamlConfig)
+		assert.NoError(err)
+		m.reload(superSpec, mm)
+		inst := m.inst.Load().(*muxInstance)
+		inst.objectReady = func(name string) bool { return ready[name] }
+		return inst
+	}
+	serve := func(path string) int {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com"+path, http.NoBody)
+		stdw := httptest.NewRecorder()
+		m.ServeHTTP(stdw, stdr)
+		return stdw.Code
+	}
+
+	yamlConfig := `
+kind: HTTPServer
+name: test
+port: 8080
+keepAlive: true
+https: false
+dependencyGateTimeout: 1m
+rules:
+- paths:
+  - path: /abc
+    backend: abc-pipeline
+  - path: /xyz
+    backend: xyz-pipeline
+`
+	inst := reload(yamlConfig)
+
+	// only the requests to the backend not ready are rejected
+	assert.Equal(http.StatusOK, serve("/abc"))
+	assert.Equal(http.StatusServiceUnavailable, serve("/xyz"))
+
+	// a backend is not waited for once it has been ready
+	ready["xyz-pipeline"] = true
+	assert.Equal(http.StatusOK, serve("/xyz"))
+	ready["xyz-pipeline"] = false
+	assert.Equal(http.StatusOK, serve("/xyz"))
+	assert.False(inst.gated("xyz-pipeline"))
+
+	// the ready backends are kept across updates, the others are not
+	// waited for after the gate timeout
+	inst = reload(strings.Replace(yamlConfig, "xyz-pipeline", "new-pipeline", 1))
+	assert.Equal(http.StatusOK, serve("/abc"))
+	assert.Equal(http.StatusServiceUnavailable, serve("/xyz"))
+	inst.gateDeadline = time.Now().Add(-time.Second)
+	assert.Equal(http.StatusOK, serve("/xyz"))
+
+	// zero disables the gate
+	yamlConfig0 := strings.Replace(yamlConfig, "1m", "0s", 1)
+	reload(strings.Replace(yamlConfig0, "xyz-pipeline", "zero-pipeline", 1))
+	assert.Equal(http.StatusOK, serve("/xyz"))
+
+	// all requests are rejected if the global filter is not ready
+	reload(strings.Replace(yamlConfig, "rules:", "globalFilter: global-filter\nrules:", 1))
+	assert.Equal(http.StatusServiceUnavailable, serve("/abc"))
+	assert.Equal(http.StatusServiceUnavailable, serve("/xyz"))
+	assert.Equal(http.StatusNotFound, serve("/unknown"))
+}
+
 func TestMuxInstanceSearch(t *testing.T) {
 	assert := assert.New(t)
 
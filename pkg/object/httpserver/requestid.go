@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// RequestIDFormatUUID generates request IDs in UUID v4.
+	RequestIDFormatUUID = "uuid"
+	// RequestIDFormatULID generates request IDs in ULID, which are sorted
+	// by the time of generation.
+	RequestIDFormatULID = "ulid"
+
+	defaultRequestIDHeader = "X-Request-Id"
+
+	// requestIDSpanTag is the tag of the request ID in the span.
+	requestIDSpanTag = "easegress.request_id"
+
+	// crockford is the alphabet of the Crockford's Base32 used by ULID.
+	crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+)
+
+type (
+	// RequestIDSpec describes the request ID of requests, which is sent
+	// to the backends and echoed in the response by the header.
+	RequestIDSpec struct {
+		Header string `json:"header" jsonschema:"omitempty"`
+		Format string `json:"format" jsonschema:"omitempty,enum=,enum=uuid,enum=ulid"`
+		// IgnoreIncoming generates a new request ID even if the request
+		// carries one, for servers facing untrusted clients.
+		IgnoreIncoming bool `json:"ignoreIncoming" jsonschema:"omitempty"`
+	}
+)
+
+func (spec *RequestIDSpec) header() string {
+	if spec.Header == "" {
+		return defaultRequestIDHeader
+	}
+	return spec.Header
+}
+
+func (spec *RequestIDSpec) generate(now time.Time) string {
+	if spec.Format == RequestIDFormatULID {
+		return newULID(now)
+	}
+	return uuid.NewString()
+}
+
+// ensure returns the request ID of the request, a new one is generated
+// and set to the header of the request if it is absent.
+func (spec *RequestIDSpec) ensure(r *http.Request, now time.Time) string {
+	if spec == nil {
+		return ""
+	}
+
+	header := spec.header()
+	if !spec.IgnoreIncoming {
+		if id := r.Header.Get(header); id != "" {
+			return id
+		}
+	}
+
+	id := spec.generate(now)
+	r.Header.Set(header, id)
+	return id
+}
+
+// newULID returns a ULID, which is 48 bits of the timestamp in
+// milliseconds followed by 80 random bits, encoded in 26 characters.
+func newULID(now time.Time) string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(now.UnixNano()/int64(time.Millisecond))<<16)
+	rand.Read(b[6:])
+
+	// The 128 bits are encoded as 130 bits with 2 leading zero bits.
+	var out [26]byte
+	for i := range out {
+		var v byte
+		for j := 0; j < 5; j++ {
+			v <<= 1
+			bit := i*5 + j - 2
+			if bit >= 0 && b[bit/8]&(0x80>>(bit%8)) != 0 {
+				v |= 1
+			}
+		}
+		out[i] = crockford[v]
+	}
+	return string(out[:])
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIDEnsure(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	var nilSpec *RequestIDSpec
+	r := httptest.NewRequest("GET", "/", nil)
+	assert.Equal("", nilSpec.ensure(r, now))
+
+	spec := &RequestIDSpec{}
+	id := spec.ensure(r, now)
+	_, err := uuid.Parse(id)
+	assert.NoError(err)
+	assert.Equal(id, r.Header.Get("X-Request-Id"))
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Request-Id", "abc")
+	assert.Equal("abc", spec.ensure(r, now))
+
+	spec.IgnoreIncoming = true
+	assert.NotEqual("abc", spec.ensure(r, now))
+
+	spec = &RequestIDSpec{Header: "X-Trace-Id", Format: RequestIDFormatULID}
+	r = httptest.NewRequest("GET", "/", nil)
+	id = spec.ensure(r, now)
+	assert.Len(id, 26)
+	assert.Equal(id, r.Header.Get("X-Trace-Id"))
+}
+
+func TestNewULID(t *testing.T) {
+	assert := assert.New(t)
+
+	// The timestamp is encoded in the first 10 characters.
+	assert.Equal("0000000000", newULID(time.UnixMilli(0))[:10])
+	assert.Equal("01ARYZ6S41", newULID(time.UnixMilli(1469918176385))[:10])
+
+	now := time.Now()
+	a, b := newULID(now), newULID(now.Add(time.Millisecond))
+	assert.Less(a, b)
+	assert.NotEqual(newULID(now), newULID(now))
+}
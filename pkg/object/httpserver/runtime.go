@@ -22,6 +22,7 @@ import (
 	stdcontext "context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"reflect"
@@ -44,6 +45,8 @@ import (
 const (
 	defaultKeepAliveTimeout = 60 * time.Second
 
+	defaultDependencyGateTimeout = 30 * time.Second
+
 	checkFailedTimeout = 10 * time.Second
 
 	topNum = 10
@@ -89,6 +92,7 @@ type (
 		httpStat      *httpstat.HTTPStat
 		topN          *httpstat.TopN
 		limitListener *limitlistener.LimitListener
+		violations    *violationCounter
 	}
 
 	// Status contains all status generated by runtime, for displaying to users.
@@ -101,15 +105,18 @@ type (
 
 		*httpstat.Status
 		TopN []*httpstat.Item `json:"topN"`
+
+		ProtocolViolations map[string]uint64 `json:"protocolViolations,omitempty"`
 	}
 )
 
 func newRuntime(superSpec *supervisor.Spec, muxMapper context.MuxMapper) *runtime {
 	r := &runtime{
-		superSpec: superSpec,
-		eventChan: make(chan interface{}, 10),
-		httpStat:  httpstat.New(),
-		topN:      httpstat.NewTopN(topNum),
+		superSpec:  superSpec,
+		eventChan:  make(chan interface{}, 10),
+		httpStat:   httpstat.New(),
+		topN:       httpstat.NewTopN(topNum),
+		violations: newViolationCounter(),
 	}
 
 	r.mux = newMux(r.httpStat, r.topN, muxMapper)
@@ -140,6 +147,8 @@ func (r *runtime) Status() *Status {
 		Error:  r.getError().Error(),
 		Status: r.httpStat.Status(),
 		TopN:   r.topN.Status(),
+
+		ProtocolViolations: r.violations.status(),
 	}
 }
 
@@ -304,6 +313,17 @@ func (r *runtime) startHTTP1And2Server() {
 	}
 	r.server.SetKeepAlivesEnabled(r.spec.KeepAlive)
 
+	// The tracker is shared by all generations of the server.
+	resources := r.superSpec.Super().ResourceTracker(r.superSpec.Name())
+	r.server.ConnState = func(conn net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			resources.AddConnections(1)
+		case http.StateHijacked, http.StateClosed:
+			resources.AddConnections(-1)
+		}
+	}
+
 	listener, err := gnet.Listen("tcp", fmt.Sprintf(":%d", r.spec.Port))
 	if err != nil {
 		r.setState(stateFailed)
@@ -313,6 +333,12 @@ func (r *runtime) startHTTP1And2Server() {
 	limitListener := limitlistener.NewLimitListener(listener, r.spec.MaxConnections)
 	r.limitListener = limitListener
 
+	var h *hardening
+	if r.spec.ProtocolHardening != nil {
+		h = newHardening(r.spec.ProtocolHardening, r.violations)
+		r.server.ConnContext = connContext
+	}
+
 	// to avoid data race
 	spec := r.spec
 	startNum := r.startNum
@@ -320,11 +346,21 @@ func (r *runtime) startHTTP1And2Server() {
 
 	go func() {
 		var err error
-		if spec.HTTPS {
+		switch {
+		case h != nil && spec.HTTPS:
+			// The hardened listener does the TLS handshake, and net/http
+			// serves HTTP/2 on the *tls.Conn with h2 negotiated.
+			tlsConfig, _ := spec.tlsConfig()
+			tlsConfig.NextProtos = append(tlsConfig.NextProtos, "h2", "http/1.1")
+			srv.TLSConfig = tlsConfig
+			err = srv.Serve(newHardenedListener(limitListener, h, tlsConfig))
+		case h != nil:
+			err = srv.Serve(newHardenedListener(limitListener, h, nil))
+		case spec.HTTPS:
 			tlsConfig, _ := spec.tlsConfig()
 			srv.TLSConfig = tlsConfig
 			err = srv.ServeTLS(limitListener, "", "")
-		} else {
+		default:
 			err = srv.Serve(limitListener)
 		}
 		if err != http.ErrServerClosed {
@@ -347,7 +383,7 @@ func (r *runtime) closeServer() {
 
 	if r.server != nil {
 		// NOTE: It's safe to shutdown serve failed server.
-		ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), 30*time.Second)
+		ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), graceupdate.DrainTimeout())
 		defer cancel()
 		err := r.server.Shutdown(ctx)
 		if err != nil {
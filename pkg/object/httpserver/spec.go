@@ -23,28 +23,36 @@ import (
 	"encoding/base64"
 	"fmt"
 	"regexp"
+	"time"
 
 	"github.com/megaease/easegress/pkg/object/autocertmanager"
 	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/accesslog"
 	"github.com/megaease/easegress/pkg/util/ipfilter"
+	"github.com/megaease/easegress/pkg/util/pathadaptor"
+	"github.com/megaease/easegress/pkg/util/spiffe"
 	"github.com/megaease/easegress/pkg/util/stringtool"
 )
 
 type (
 	// Spec describes the HTTPServer.
 	Spec struct {
-		HTTP3             bool          `json:"http3" jsonschema:"omitempty"`
-		KeepAlive         bool          `json:"keepAlive" jsonschema:"required"`
-		HTTPS             bool          `json:"https" jsonschema:"required"`
-		AutoCert          bool          `json:"autoCert" jsonschema:"omitempty"`
-		XForwardedFor     bool          `json:"xForwardedFor" jsonschema:"omitempty"`
-		Port              uint16        `json:"port" jsonschema:"required,minimum=1"`
-		ClientMaxBodySize int64         `json:"clientMaxBodySize" jsonschema:"omitempty"`
-		KeepAliveTimeout  string        `json:"keepAliveTimeout" jsonschema:"omitempty,format=duration"`
-		MaxConnections    uint32        `json:"maxConnections" jsonschema:"omitempty,minimum=1"`
-		CacheSize         uint32        `json:"cacheSize" jsonschema:"omitempty"`
-		Tracing           *tracing.Spec `json:"tracing,omitempty" jsonschema:"omitempty"`
-		CaCertBase64      string        `json:"caCertBase64" jsonschema:"omitempty,format=base64"`
+		HTTP3             bool            `json:"http3" jsonschema:"omitempty"`
+		KeepAlive         bool            `json:"keepAlive" jsonschema:"required"`
+		HTTPS             bool            `json:"https" jsonschema:"required"`
+		AutoCert          bool            `json:"autoCert" jsonschema:"omitempty"`
+		XForwardedFor     bool            `json:"xForwardedFor" jsonschema:"omitempty"`
+		Port              uint16          `json:"port" jsonschema:"required,minimum=1"`
+		ClientMaxBodySize int64           `json:"clientMaxBodySize" jsonschema:"omitempty"`
+		KeepAliveTimeout  string          `json:"keepAliveTimeout" jsonschema:"omitempty,format=duration"`
+		MaxConnections    uint32          `json:"maxConnections" jsonschema:"omitempty,minimum=1"`
+		CacheSize         uint32          `json:"cacheSize" jsonschema:"omitempty"`
+		Tracing           *tracing.Spec   `json:"tracing,omitempty" jsonschema:"omitempty"`
+		AccessLog         *accesslog.Spec `json:"accessLog,omitempty" jsonschema:"omitempty"`
+		Debug             *DebugSpec      `json:"debug,omitempty" jsonschema:"omitempty"`
+		Health            *HealthSpec     `json:"health,omitempty" jsonschema:"omitempty"`
+		RequestID         *RequestIDSpec  `json:"requestID,omitempty" jsonschema:"omitempty"`
+		CaCertBase64      string          `json:"caCertBase64" jsonschema:"omitempty,format=base64"`
 
 		// Support multiple certs, preserve the certbase64 and keybase64
 		// for backward compatibility
@@ -60,6 +68,28 @@ type (
 		Rules    []*Rule        `json:"rules" jsonschema:"omitempty"`
 
 		GlobalFilter string `json:"globalFilter,omitempty" jsonschema:"omitempty"`
+
+		// DependencyGateTimeout is how long the requests to a backend, or
+		// the global filter, not ready yet are rejected after the server
+		// is created or updated, 0 means not rejecting them.
+		DependencyGateTimeout string `json:"dependencyGateTimeout,omitempty" jsonschema:"omitempty,format=duration"`
+
+		ProtocolHardening *ProtocolHardeningSpec `json:"protocolHardening,omitempty" jsonschema:"omitempty"`
+
+		// SPIFFE enables mTLS with the X509-SVIDs from the SPIFFE Workload
+		// API, the certs and keys above are not used if it is specified.
+		SPIFFE *spiffe.Spec `json:"spiffe,omitempty" jsonschema:"omitempty"`
+	}
+
+	// ProtocolHardeningSpec describes how to handle the ambiguous HTTP/1.x
+	// requests, which may be used for request smuggling.
+	ProtocolHardeningSpec struct {
+		// Mode is reject or normalize, the normalize mode unfolds the
+		// obs-fold headers and removes Content-Length if Transfer-Encoding
+		// presents, other violations are still rejected.
+		Mode                  string `json:"mode" jsonschema:"omitempty,enum=,enum=reject,enum=normalize"`
+		MaxHeaderBytes        int    `json:"maxHeaderBytes" jsonschema:"omitempty,minimum=0"`
+		RejectChunkExtensions bool   `json:"rejectChunkExtensions" jsonschema:"omitempty"`
 	}
 
 	// Rule is first level entry of router.
@@ -83,6 +113,7 @@ type (
 		Path              string         `json:"path,omitempty" jsonschema:"omitempty,pattern=^/"`
 		PathPrefix        string         `json:"pathPrefix,omitempty" jsonschema:"omitempty,pattern=^/"`
 		PathRegexp        string         `json:"pathRegexp,omitempty" jsonschema:"omitempty,format=regexp"`
+		PathTemplate      string         `json:"pathTemplate,omitempty" jsonschema:"omitempty,pattern=^/"`
 		RewriteTarget     string         `json:"rewriteTarget" jsonschema:"omitempty"`
 		Methods           []string       `json:"methods,omitempty" jsonschema:"omitempty,uniqueItems=true,format=httpmethod-array"`
 		Backend           string         `json:"backend" jsonschema:"required"`
@@ -105,10 +136,27 @@ type (
 
 // Validate validates HTTPServerSpec.
 func (spec *Spec) Validate() error {
+	if spec.HTTP3 && spec.ProtocolHardening != nil {
+		return fmt.Errorf("protocolHardening is not supported when http3 enabled")
+	}
+
 	if !spec.HTTPS {
 		if spec.HTTP3 {
 			return fmt.Errorf("https is disabled when http3 enabled")
 		}
+		if spec.SPIFFE != nil {
+			return fmt.Errorf("https is disabled when spiffe enabled")
+		}
+		return nil
+	}
+
+	if spec.SPIFFE != nil {
+		if spec.AutoCert || spec.CaCertBase64 != "" {
+			return fmt.Errorf("autoCert and caCertBase64 must be empty when spiffe enabled")
+		}
+		if err := spec.SPIFFE.Validate(); err != nil {
+			return fmt.Errorf("spiffe: %v", err)
+		}
 		return nil
 	}
 
@@ -119,6 +167,29 @@ func (spec *Spec) Validate() error {
 	return err
 }
 
+// Dependencies returns the backends and the global filter of the server,
+// the requests to them are rejected until they are ready.
+func (spec *Spec) Dependencies() []string {
+	var deps []string
+	for _, rule := range spec.Rules {
+		for _, path := range rule.Paths {
+			deps = append(deps, path.Backend)
+		}
+	}
+	if spec.GlobalFilter != "" {
+		deps = append(deps, spec.GlobalFilter)
+	}
+	return deps
+}
+
+func (spec *Spec) dependencyGateTimeout() time.Duration {
+	if spec.DependencyGateTimeout == "" {
+		return defaultDependencyGateTimeout
+	}
+	d, _ := time.ParseDuration(spec.DependencyGateTimeout)
+	return d
+}
+
 func tryDecodeBase64Pem(pem string) []byte {
 	// The pem could in base64 encoding or plain text. It starts with '-' if it is
 	// in plain text, and '-' is not a valid character in standard base64 encoding.
@@ -131,6 +202,10 @@ func tryDecodeBase64Pem(pem string) []byte {
 }
 
 func (spec *Spec) tlsConfig() (*tls.Config, error) {
+	if spec.SPIFFE != nil {
+		return spec.SPIFFE.ServerTLSConfig(), nil
+	}
+
 	var certificates []tls.Certificate
 
 	if spec.CertBase64 != "" && spec.KeyBase64 != "" {
@@ -205,9 +280,15 @@ func (h *Header) Validate() error {
 
 // Validate validates Path.
 func (p *Path) Validate() error {
-	if (stringtool.IsAllEmpty(p.Path, p.PathPrefix, p.PathRegexp)) && p.RewriteTarget != "" {
+	if (stringtool.IsAllEmpty(p.Path, p.PathPrefix, p.PathRegexp, p.PathTemplate)) && p.RewriteTarget != "" {
 		return fmt.Errorf("rewriteTarget is specified but path is empty")
 	}
 
+	if p.PathTemplate != "" {
+		if _, err := pathadaptor.NewPattern(p.PathTemplate); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
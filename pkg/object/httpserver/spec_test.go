@@ -75,6 +75,75 @@ rules:
 	superSpec, err = supervisor.NewSpec(yamlConfig)
 	assert.True(strings.Contains(err.Error(), "keepAliveTimeout: invalid duration"))
 	assert.Nil(superSpec)
+
+	yamlConfig = `
+name: http-server-test
+kind: HTTPServer
+port: 10080
+http3: true
+https: true
+autoCert: true
+protocolHardening:
+  mode: normalize`
+	superSpec, err = supervisor.NewSpec(yamlConfig)
+	assert.True(strings.Contains(err.Error(), "protocolHardening is not supported"))
+	assert.Nil(superSpec)
+
+	yamlConfig = `
+name: http-server-test
+kind: HTTPServer
+port: 10080
+https: true
+spiffe:
+  allowedIDs: ["spiffe://megaease.com/client"]`
+	superSpec, err = supervisor.NewSpec(yamlConfig)
+	assert.Nil(err)
+	assert.NotNil(superSpec)
+
+	yamlConfig = `
+name: http-server-test
+kind: HTTPServer
+port: 10080
+https: false
+spiffe: {}`
+	superSpec, err = supervisor.NewSpec(yamlConfig)
+	assert.True(strings.Contains(err.Error(), "https is disabled when spiffe enabled"))
+	assert.Nil(superSpec)
+
+	yamlConfig = `
+name: http-server-test
+kind: HTTPServer
+port: 10080
+https: true
+autoCert: true
+spiffe: {}`
+	superSpec, err = supervisor.NewSpec(yamlConfig)
+	assert.True(strings.Contains(err.Error(), "must be empty when spiffe enabled"))
+	assert.Nil(superSpec)
+}
+
+func TestSpecDependencies(t *testing.T) {
+	assert := assert.New(t)
+	yamlConfig := `
+name: http-server-test
+kind: HTTPServer
+port: 10080
+globalFilter: global
+rules:
+  - paths:
+    - pathPrefix: /api
+      backend: pipeline-api
+    - pathPrefix: /web
+      backend: pipeline-web
+  - host: example.com
+    paths:
+    - pathPrefix: /api
+      backend: pipeline-api
+`
+
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.Nil(err)
+	assert.Equal([]string{"global", "pipeline-api", "pipeline-web"}, superSpec.Dependencies())
 }
 
 func TestTlsConfig(t *testing.T) {
@@ -0,0 +1,223 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ingresscontroller
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	apinetv1 "k8s.io/api/networking/v1"
+
+	"github.com/megaease/easegress/pkg/filters/corsadaptor"
+	"github.com/megaease/easegress/pkg/filters/ratelimiter"
+	"github.com/megaease/easegress/pkg/filters/requestadaptor"
+	"github.com/megaease/easegress/pkg/filters/validator"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// Annotations of Ingress to attach filters to the routes.
+const (
+	annotationPrefix = "easegress.ingress.kubernetes.io/"
+
+	// the number of requests per second.
+	annotationRateLimit = annotationPrefix + "rate-limit"
+
+	// the name of a secret in the namespace of the ingress, whose "secret"
+	// key is the secret to validate JWT.
+	annotationJWTSecret    = annotationPrefix + "jwt-secret"
+	annotationJWTAlgorithm = annotationPrefix + "jwt-algorithm"
+
+	annotationEnableCORS           = annotationPrefix + "enable-cors"
+	annotationCORSAllowOrigins     = annotationPrefix + "cors-allow-origins"
+	annotationCORSAllowMethods     = annotationPrefix + "cors-allow-methods"
+	annotationCORSAllowHeaders     = annotationPrefix + "cors-allow-headers"
+	annotationCORSAllowCredentials = annotationPrefix + "cors-allow-credentials"
+
+	// one "Name: value" per line.
+	annotationRequestHeadersSet = annotationPrefix + "request-headers-set"
+	// comma separated header names.
+	annotationRequestHeadersRemove = annotationPrefix + "request-headers-remove"
+
+	// comma separated keys of the filter templates ConfigMap.
+	annotationFilterTemplates = annotationPrefix + "filter-templates"
+
+	defaultJWTAlgorithm = "HS256"
+)
+
+func splitList(value string) []string {
+	var result []string
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// translateFilterAnnotations returns the filters attached to the routes of
+// the ingress, in the order of CORS, rate limiting, JWT validation, header
+// rewrite and the templates.
+func (st *specTranslator) translateFilterAnnotations(ingress *apinetv1.Ingress) ([]map[string]interface{}, error) {
+	annotations := ingress.Annotations
+	var filters []map[string]interface{}
+
+	if enabled, _ := strconv.ParseBool(annotations[annotationEnableCORS]); enabled {
+		origins := splitList(annotations[annotationCORSAllowOrigins])
+		if len(origins) == 0 {
+			origins = []string{"*"}
+		}
+		credentials, _ := strconv.ParseBool(annotations[annotationCORSAllowCredentials])
+		filters = append(filters, map[string]interface{}{
+			"kind":             corsadaptor.Kind,
+			"name":             "cors",
+			"allowedOrigins":   origins,
+			"allowedMethods":   splitList(annotations[annotationCORSAllowMethods]),
+			"allowedHeaders":   splitList(annotations[annotationCORSAllowHeaders]),
+			"allowCredentials": credentials,
+		})
+	}
+
+	if value, ok := annotations[annotationRateLimit]; ok {
+		rps, err := strconv.Atoi(value)
+		if err != nil || rps <= 0 {
+			return nil, fmt.Errorf("invalid %s: %s", annotationRateLimit, value)
+		}
+		filters = append(filters, map[string]interface{}{
+			"kind": ratelimiter.Kind,
+			"name": "rateLimiter",
+			"policies": []map[string]interface{}{{
+				"name":               "default",
+				"limitRefreshPeriod": "1s",
+				"limitForPeriod":     rps,
+				"timeoutDuration":    "100ms",
+			}},
+			"defaultPolicyRef": "default",
+			"urls": []map[string]interface{}{{
+				"url":       map[string]interface{}{"prefix": "/"},
+				"policyRef": "default",
+			}},
+		})
+	}
+
+	if name, ok := annotations[annotationJWTSecret]; ok {
+		secret, err := st.k8sClient.getSecret(ingress.Namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		if secret == nil || len(secret.Data["secret"]) == 0 {
+			return nil, fmt.Errorf("'secret' is missing or empty in secret %s/%s", ingress.Namespace, name)
+		}
+
+		algorithm := annotations[annotationJWTAlgorithm]
+		if algorithm == "" {
+			algorithm = defaultJWTAlgorithm
+		}
+		filters = append(filters, map[string]interface{}{
+			"kind": validator.Kind,
+			"name": "jwt",
+			"jwt": map[string]interface{}{
+				"algorithm": algorithm,
+				"secret":    hex.EncodeToString(secret.Data["secret"]),
+			},
+		})
+	}
+
+	header := map[string]interface{}{}
+	if value, ok := annotations[annotationRequestHeadersSet]; ok {
+		set := map[string]string{}
+		for _, line := range strings.Split(value, "\n") {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			kv := strings.SplitN(line, ":", 2)
+			if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+				return nil, fmt.Errorf("invalid %s: %s", annotationRequestHeadersSet, line)
+			}
+			set[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+		header["set"] = set
+	}
+	if value, ok := annotations[annotationRequestHeadersRemove]; ok {
+		header["del"] = splitList(value)
+	}
+	if len(header) > 0 {
+		filters = append(filters, map[string]interface{}{
+			"kind":   requestadaptor.Kind,
+			"name":   "requestAdaptor",
+			"header": header,
+		})
+	}
+
+	for _, key := range splitList(annotations[annotationFilterTemplates]) {
+		filter, err := st.filterTemplate(key)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+
+	return filters, nil
+}
+
+// filterTemplate returns the filter of the template in the filter
+// templates ConfigMap, the name of the filter is the key of the template.
+func (st *specTranslator) filterTemplate(key string) (map[string]interface{}, error) {
+	if st.filterTemplates == "" {
+		return nil, fmt.Errorf("filter template %s not found: no filter templates ConfigMap", key)
+	}
+
+	ns, name := splitNamespacedName(st.filterTemplates)
+	cm, err := st.k8sClient.getConfigMap(ns, name)
+	if err != nil {
+		return nil, err
+	}
+	if cm == nil {
+		return nil, fmt.Errorf("filter templates ConfigMap %s does not exist", st.filterTemplates)
+	}
+
+	value, ok := cm.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("filter template %s not found in ConfigMap %s", key, st.filterTemplates)
+	}
+
+	filter := map[string]interface{}{}
+	jsonConfig, err := codectool.YAMLToJSON([]byte(value))
+	if err == nil {
+		err = codectool.UnmarshalJSON(jsonConfig, &filter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter template %s: %v", key, err)
+	}
+	if kind, _ := filter["kind"].(string); kind == "" {
+		return nil, fmt.Errorf("invalid filter template %s: kind not found", key)
+	}
+
+	filter["name"] = key
+	return filter, nil
+}
+
+// splitNamespacedName splits "namespace/name", the namespace is "default"
+// if it is omitted.
+func splitNamespacedName(s string) (string, string) {
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return "default", s
+}
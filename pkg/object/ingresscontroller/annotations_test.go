@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ingresscontroller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apicorev1 "k8s.io/api/core/v1"
+	apinetv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/megaease/easegress/pkg/filters/corsadaptor"
+	"github.com/megaease/easegress/pkg/filters/ratelimiter"
+	"github.com/megaease/easegress/pkg/filters/requestadaptor"
+	"github.com/megaease/easegress/pkg/filters/validator"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+// newTestK8sClient creates a k8s client whose informers hold the objects,
+// the informers are never started.
+func newTestK8sClient(objs ...interface{}) *k8sClient {
+	factory := informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0)
+	for _, obj := range objs {
+		switch o := obj.(type) {
+		case *apicorev1.Secret:
+			factory.Core().V1().Secrets().Informer().GetIndexer().Add(o)
+		case *apicorev1.ConfigMap:
+			factory.Core().V1().ConfigMaps().Informer().GetIndexer().Add(o)
+		}
+	}
+	return &k8sClient{informerFactory: factory, namespaces: []string{"default"}}
+}
+
+func newTestIngress(annotations map[string]string) *apinetv1.Ingress {
+	return &apinetv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "ingress",
+			Annotations: annotations,
+		},
+	}
+}
+
+func TestTranslateFilterAnnotations(t *testing.T) {
+	assert := assert.New(t)
+
+	client := newTestK8sClient(
+		&apicorev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "jwt"},
+			Data:       map[string][]byte{"secret": []byte("my-secret")},
+		},
+		&apicorev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "easegress", Name: "templates"},
+			Data: map[string]string{
+				"adaptor": "kind: RequestAdaptor\nheader:\n  set:\n    X-Template: adaptor\n",
+				"invalid": "name: no-kind\n",
+			},
+		},
+	)
+	st := newSpecTranslator(client, "easegress", nil, "easegress/templates")
+
+	filters, err := st.translateFilterAnnotations(newTestIngress(nil))
+	assert.NoError(err)
+	assert.Empty(filters)
+
+	filters, err = st.translateFilterAnnotations(newTestIngress(map[string]string{
+		annotationEnableCORS:           "true",
+		annotationCORSAllowMethods:     "GET, POST",
+		annotationRateLimit:            "100",
+		annotationJWTSecret:            "jwt",
+		annotationRequestHeadersSet:    "X-Env: prod\nX-Team: infra",
+		annotationRequestHeadersRemove: "X-Debug",
+		annotationFilterTemplates:      "adaptor",
+	}))
+	assert.NoError(err)
+
+	kinds := []string{}
+	for _, f := range filters {
+		kinds = append(kinds, f["kind"].(string))
+	}
+	assert.Equal([]string{corsadaptor.Kind, ratelimiter.Kind, validator.Kind, requestadaptor.Kind, requestadaptor.Kind}, kinds)
+	assert.Equal([]string{"*"}, filters[0]["allowedOrigins"])
+	assert.Equal([]string{"GET", "POST"}, filters[0]["allowedMethods"])
+	assert.Equal("6d792d736563726574", filters[2]["jwt"].(map[string]interface{})["secret"])
+	assert.Equal(map[string]string{"X-Env": "prod", "X-Team": "infra"}, filters[3]["header"].(map[string]interface{})["set"])
+	assert.Equal("adaptor", filters[4]["name"])
+
+	// the filters make a valid pipeline.
+	b := newPipelineSpecBuilder("pipeline")
+	for _, f := range filters {
+		b.addFilter(f)
+	}
+	_, err = supervisor.NewSpec(b.jsonConfig())
+	assert.NoError(err)
+
+	for _, annotations := range []map[string]string{
+		{annotationRateLimit: "0"},
+		{annotationJWTSecret: "missing"},
+		{annotationRequestHeadersSet: "no-colon"},
+		{annotationFilterTemplates: "missing"},
+		{annotationFilterTemplates: "invalid"},
+	} {
+		_, err = st.translateFilterAnnotations(newTestIngress(annotations))
+		assert.Error(err, "%v", annotations)
+	}
+
+	// no filter templates ConfigMap.
+	st = newSpecTranslator(client, "easegress", nil, "")
+	_, err = st.translateFilterAnnotations(newTestIngress(map[string]string{annotationFilterTemplates: "adaptor"}))
+	assert.Error(err)
+}
+
+func TestSplitNamespacedName(t *testing.T) {
+	assert := assert.New(t)
+
+	ns, name := splitNamespacedName("easegress/templates")
+	assert.Equal("easegress", ns)
+	assert.Equal("templates", name)
+
+	ns, name = splitNamespacedName("templates")
+	assert.Equal("default", ns)
+	assert.Equal("templates", name)
+
+	assert.Equal([]string{"a", "b"}, splitList(" a, ,b "))
+	assert.Nil(splitList(""))
+}
@@ -0,0 +1,315 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ingresscontroller
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httpserver"
+	"github.com/megaease/easegress/pkg/object/pipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	crdGroup   = "easegress.megaease.com"
+	crdVersion = "v1"
+)
+
+var (
+	pipelineGVR       = schema.GroupVersionResource{Group: crdGroup, Version: crdVersion, Resource: "easegresspipelines"}
+	httpServerGVR     = schema.GroupVersionResource{Group: crdGroup, Version: crdVersion, Resource: "easegresshttpservers"}
+	filterTemplateGVR = schema.GroupVersionResource{Group: crdGroup, Version: crdVersion, Resource: "easegressfiltertemplates"}
+)
+
+type (
+	// crdClient watches the custom resources of Easegress.
+	crdClient struct {
+		eventHandler
+
+		namespaces []string
+		clientset  *kubernetes.Clientset
+		dynamic    dynamic.Interface
+		factories  []dynamicinformer.DynamicSharedInformerFactory
+	}
+
+	// crdResources are the custom resources of Easegress.
+	crdResources struct {
+		pipelines       []*unstructured.Unstructured
+		httpServers     []*unstructured.Unstructured
+		filterTemplates []*unstructured.Unstructured
+	}
+
+	// crdTranslator translates custom resources to Easegress specs.
+	crdTranslator struct {
+		templates   map[string]map[string]interface{}
+		pipelines   map[string]*supervisor.Spec
+		httpServers map[string]*supervisor.Spec
+		// errors maps the keys of custom resources to translation errors.
+		errors map[string]string
+	}
+)
+
+func newCRDClient(masterURL string, kubeConfig string) (*crdClient, error) {
+	cfg, err := clientcmd.BuildConfigFromFlags(masterURL, kubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("build kubeconfig failed: %v", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("build kubernetes clientset failed: %v", err)
+	}
+
+	dc, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("build kubernetes dynamic client failed: %v", err)
+	}
+
+	return &crdClient{
+		eventHandler: newEventHandler(),
+		clientset:    clientset,
+		dynamic:      dc,
+	}, nil
+}
+
+func (c *crdClient) watch(namespaces []string) (chan struct{}, error) {
+	// NOTE: The informers never sync if the CRDs are not installed.
+	gv := schema.GroupVersion{Group: crdGroup, Version: crdVersion}.String()
+	if _, err := c.clientset.Discovery().ServerResourcesForGroupVersion(gv); err != nil {
+		return nil, fmt.Errorf("CRDs of %s not found: %v", gv, err)
+	}
+
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	c.namespaces = namespaces
+
+	stopCh := make(chan struct{})
+	c.factories = nil
+	for _, ns := range namespaces {
+		factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(c.dynamic, resyncPeriod, ns, nil)
+		for _, gvr := range []schema.GroupVersionResource{pipelineGVR, httpServerGVR, filterTemplateGVR} {
+			factory.ForResource(gvr).Informer().AddEventHandler(c)
+		}
+
+		factory.Start(stopCh)
+		for typ, ok := range factory.WaitForCacheSync(stopCh) {
+			if !ok {
+				close(stopCh)
+				return nil, fmt.Errorf("timed out waiting for caches to sync %s", typ)
+			}
+		}
+		c.factories = append(c.factories, factory)
+	}
+
+	return stopCh, nil
+}
+
+func (c *crdClient) list(gvr schema.GroupVersionResource) []*unstructured.Unstructured {
+	var result []*unstructured.Unstructured
+	for i, factory := range c.factories {
+		objs, err := factory.ForResource(gvr).Lister().List(labels.Everything())
+		if err != nil {
+			logger.Errorf("failed to list %s from namespace %s: %v", gvr.Resource, c.namespaces[i], err)
+			continue
+		}
+		for _, obj := range objs {
+			if u, ok := obj.(*unstructured.Unstructured); ok {
+				result = append(result, u)
+			}
+		}
+	}
+	return result
+}
+
+func (c *crdClient) resources() *crdResources {
+	return &crdResources{
+		pipelines:       c.list(pipelineGVR),
+		httpServers:     c.list(httpServerGVR),
+		filterTemplates: c.list(filterTemplateGVR),
+	}
+}
+
+// updateStatus updates the status of a custom resource if it is changed.
+func (c *crdClient) updateStatus(gvr schema.GroupVersionResource, obj *unstructured.Unstructured, errMsg string) {
+	status := map[string]interface{}{
+		"synced":             errMsg == "",
+		"observedGeneration": obj.GetGeneration(),
+	}
+	if errMsg != "" {
+		status["error"] = errMsg
+	}
+
+	// NOTE: The generation is an int64 in the object from the informer,
+	// compare the JSON to avoid the difference of number types.
+	old, _, _ := unstructured.NestedMap(obj.Object, "status")
+	if string(codectool.MustMarshalJSON(old)) == string(codectool.MustMarshalJSON(status)) {
+		return
+	}
+
+	obj = obj.DeepCopy()
+	obj.Object["status"] = status
+	_, err := c.dynamic.Resource(gvr).Namespace(obj.GetNamespace()).UpdateStatus(context.Background(), obj, metav1.UpdateOptions{})
+	if err != nil {
+		logger.Errorf("failed to update status of %s %s/%s: %v", gvr.Resource, obj.GetNamespace(), obj.GetName(), err)
+	}
+}
+
+// crdObjectName returns the name of the Easegress object of a custom
+// resource, the namespace is a DNS label without dot, so the name is unique.
+func crdObjectName(namespace, name string) string {
+	return namespace + "." + name
+}
+
+// crdKey returns the key of a custom resource in translation errors.
+func crdKey(obj *unstructured.Unstructured) string {
+	return obj.GetKind() + "/" + obj.GetNamespace() + "/" + obj.GetName()
+}
+
+func newCRDTranslator() *crdTranslator {
+	return &crdTranslator{
+		templates:   map[string]map[string]interface{}{},
+		pipelines:   map[string]*supervisor.Spec{},
+		httpServers: map[string]*supervisor.Spec{},
+		errors:      map[string]string{},
+	}
+}
+
+func crdSpec(obj *unstructured.Unstructured) (map[string]interface{}, error) {
+	spec, found, err := unstructured.NestedMap(obj.Object, "spec")
+	if err != nil {
+		return nil, fmt.Errorf("invalid spec: %v", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("spec not found")
+	}
+	return spec, nil
+}
+
+func (ct *crdTranslator) translate(res *crdResources) {
+	for _, obj := range res.filterTemplates {
+		spec, err := crdSpec(obj)
+		if err == nil {
+			if kind, _ := spec["kind"].(string); kind == "" {
+				err = fmt.Errorf("kind of filter not found")
+			}
+		}
+		if err != nil {
+			ct.errors[crdKey(obj)] = err.Error()
+			continue
+		}
+		ct.templates[obj.GetNamespace()+"/"+obj.GetName()] = spec
+	}
+
+	for _, obj := range res.pipelines {
+		spec, err := ct.translatePipeline(obj)
+		if err != nil {
+			ct.errors[crdKey(obj)] = err.Error()
+			continue
+		}
+		ct.pipelines[spec.Name()] = spec
+	}
+
+	for _, obj := range res.httpServers {
+		spec, err := ct.translateHTTPServer(obj)
+		if err != nil {
+			ct.errors[crdKey(obj)] = err.Error()
+			continue
+		}
+		ct.httpServers[spec.Name()] = spec
+	}
+}
+
+// translatePipeline translates an EasegressPipeline to a Pipeline. A filter
+// with a template is the spec of the template in the same namespace,
+// overridden by the other fields of the filter.
+func (ct *crdTranslator) translatePipeline(obj *unstructured.Unstructured) (*supervisor.Spec, error) {
+	spec, err := crdSpec(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	filters, _ := spec["filters"].([]interface{})
+	for i, f := range filters {
+		filter, ok := f.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, ok := filter["template"].(string)
+		if !ok {
+			continue
+		}
+
+		template, ok := ct.templates[obj.GetNamespace()+"/"+name]
+		if !ok {
+			return nil, fmt.Errorf("filter template %s not found", name)
+		}
+
+		merged := map[string]interface{}{}
+		for k, v := range template {
+			merged[k] = v
+		}
+		for k, v := range filter {
+			if k != "template" {
+				merged[k] = v
+			}
+		}
+		filters[i] = merged
+	}
+
+	spec["name"] = crdObjectName(obj.GetNamespace(), obj.GetName())
+	spec["kind"] = pipeline.Kind
+	return supervisor.NewSpec(string(codectool.MustMarshalJSON(spec)))
+}
+
+// translateHTTPServer translates an EasegressHTTPServer to an HTTPServer,
+// the backends are the EasegressPipelines in the same namespace.
+func (ct *crdTranslator) translateHTTPServer(obj *unstructured.Unstructured) (*supervisor.Spec, error) {
+	spec, err := crdSpec(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, _ := spec["rules"].([]interface{})
+	for _, r := range rules {
+		rule, _ := r.(map[string]interface{})
+		paths, _ := rule["paths"].([]interface{})
+		for _, p := range paths {
+			path, _ := p.(map[string]interface{})
+			if backend, ok := path["backend"].(string); ok {
+				path["backend"] = crdObjectName(obj.GetNamespace(), backend)
+			}
+		}
+	}
+
+	spec["name"] = crdObjectName(obj.GetNamespace(), obj.GetName())
+	spec["kind"] = httpserver.Kind
+	return supervisor.NewSpec(string(codectool.MustMarshalJSON(spec)))
+}
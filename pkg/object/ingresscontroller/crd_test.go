@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ingresscontroller
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httpserver"
+	"github.com/megaease/easegress/pkg/object/pipeline"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newTestCR(kind, namespace, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": crdGroup + "/" + crdVersion,
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"namespace": namespace,
+			"name":      name,
+		},
+	}}
+	if spec != nil {
+		obj.Object["spec"] = spec
+	}
+	return obj
+}
+
+func TestCRDTranslate(t *testing.T) {
+	assert := assert.New(t)
+
+	res := &crdResources{
+		filterTemplates: []*unstructured.Unstructured{
+			newTestCR("EasegressFilterTemplate", "team-a", "adaptor", map[string]interface{}{
+				"kind": "RequestAdaptor",
+				"header": map[string]interface{}{
+					"set": map[string]interface{}{"X-Team": "a"},
+				},
+			}),
+			newTestCR("EasegressFilterTemplate", "team-a", "no-kind", map[string]interface{}{}),
+		},
+		pipelines: []*unstructured.Unstructured{
+			newTestCR("EasegressPipeline", "team-a", "orders", map[string]interface{}{
+				"filters": []interface{}{
+					map[string]interface{}{"name": "adaptor", "template": "adaptor", "method": "POST"},
+				},
+			}),
+			// templates are looked up in the same namespace only.
+			newTestCR("EasegressPipeline", "team-b", "orders", map[string]interface{}{
+				"filters": []interface{}{
+					map[string]interface{}{"name": "adaptor", "template": "adaptor"},
+				},
+			}),
+			newTestCR("EasegressPipeline", "team-a", "no-spec", nil),
+		},
+		httpServers: []*unstructured.Unstructured{
+			newTestCR("EasegressHTTPServer", "team-a", "server", map[string]interface{}{
+				"port": int64(10080),
+				"rules": []interface{}{
+					map[string]interface{}{
+						"paths": []interface{}{
+							map[string]interface{}{"pathPrefix": "/orders", "backend": "orders"},
+						},
+					},
+				},
+			}),
+		},
+	}
+
+	ct := newCRDTranslator()
+	ct.translate(res)
+
+	assert.Len(ct.pipelines, 1)
+	p := ct.pipelines["team-a.orders"]
+	if assert.NotNil(p) {
+		assert.Equal(pipeline.Kind, p.Kind())
+		filter := p.ObjectSpec().(*pipeline.Spec).Filters[0]
+		assert.Equal("RequestAdaptor", filter["kind"])
+		assert.Equal("POST", filter["method"])
+		assert.NotContains(filter, "template")
+	}
+
+	assert.Len(ct.httpServers, 1)
+	s := ct.httpServers["team-a.server"]
+	if assert.NotNil(s) {
+		assert.Equal(httpserver.Kind, s.Kind())
+		spec := s.ObjectSpec().(*httpserver.Spec)
+		assert.Equal("team-a.orders", spec.Rules[0].Paths[0].Backend)
+		assert.Equal([]string{"team-a.orders"}, s.Dependencies())
+	}
+
+	assert.Len(ct.errors, 3)
+	assert.Contains(ct.errors["EasegressFilterTemplate/team-a/no-kind"], "kind")
+	assert.Contains(ct.errors["EasegressPipeline/team-b/orders"], "not found")
+	assert.Contains(ct.errors["EasegressPipeline/team-a/no-spec"], "spec not found")
+}
+
+func TestCRDObjectName(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("team-a.orders", crdObjectName("team-a", "orders"))
+	assert.Equal("EasegressPipeline/team-a/orders",
+		crdKey(newTestCR("EasegressPipeline", "team-a", "orders", nil)))
+}
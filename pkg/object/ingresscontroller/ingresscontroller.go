@@ -20,6 +20,7 @@ package ingresscontroller
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/megaease/easegress/pkg/logger"
@@ -46,9 +47,14 @@ type (
 		superSpec *supervisor.Spec
 		spec      *Spec
 
-		tc        *trafficcontroller.TrafficController
-		namespace string
-		k8sClient *k8sClient
+		tc           *trafficcontroller.TrafficController
+		namespace    string
+		crdNamespace string
+		k8sClient    *k8sClient
+		crdClient    *crdClient
+
+		// crdErrors are the translation errors of custom resources.
+		crdErrors atomic.Value
 
 		stopCh chan struct{}
 		wg     sync.WaitGroup
@@ -61,6 +67,19 @@ type (
 		MasterURL    string           `json:"masterURL" jsonschema:"omitempty"`
 		Namespaces   []string         `json:"namespaces" jsonschema:"omitempty"`
 		IngressClass string           `json:"ingressClass" jsonschema:"omitempty"`
+		// FilterTemplates is the namespaced name of a ConfigMap, whose data
+		// are filter specs which can be attached to ingress routes by the
+		// filter-templates annotation.
+		FilterTemplates string `json:"filterTemplates" jsonschema:"omitempty"`
+		// WatchCRDs watches the custom resources of Easegress, and
+		// reconciles them into Easegress objects.
+		WatchCRDs bool `json:"watchCRDs" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of IngressController.
+	Status struct {
+		// CRDErrors maps the custom resources to their translation errors.
+		CRDErrors map[string]string `json:"crdErrors,omitempty"`
 	}
 )
 
@@ -114,10 +133,16 @@ func (ic *IngressController) reload() {
 	}
 
 	ic.namespace = fmt.Sprintf("%s/%s", ic.superSpec.Name(), "ingresscontroller")
+	ic.crdNamespace = fmt.Sprintf("%s/%s", ic.superSpec.Name(), "crd")
 	ic.stopCh = make(chan struct{})
 
 	ic.wg.Add(1)
 	go ic.run()
+
+	if ic.spec.WatchCRDs {
+		ic.wg.Add(1)
+		go ic.runCRDs()
+	}
 }
 
 func (ic *IngressController) run() {
@@ -146,7 +171,7 @@ func (ic *IngressController) run() {
 		err    error
 	)
 	for {
-		stopCh, err = ic.k8sClient.watch(ic.spec.Namespaces)
+		stopCh, err = ic.k8sClient.watch(ic.spec.Namespaces, ic.spec.FilterTemplates)
 		if err == nil {
 			break
 		}
@@ -181,10 +206,108 @@ func (ic *IngressController) run() {
 	}
 }
 
+func (ic *IngressController) runCRDs() {
+	defer ic.wg.Done()
+
+	for {
+		crdClient, err := newCRDClient(ic.spec.MasterURL, ic.spec.KubeConfig)
+		if err == nil {
+			ic.crdClient = crdClient
+			break
+		}
+		logger.Errorf("failed to create kubernetes client for CRDs: %v", err)
+
+		select {
+		case <-ic.stopCh:
+			return
+		case <-time.After(10 * time.Second):
+		}
+	}
+
+	var (
+		stopCh chan struct{}
+		err    error
+	)
+	for {
+		stopCh, err = ic.crdClient.watch(ic.spec.Namespaces)
+		if err == nil {
+			break
+		}
+		logger.Errorf("failed to watch custom resources: %v", err)
+
+		select {
+		case <-ic.stopCh:
+			return
+		case <-time.After(10 * time.Second):
+		}
+	}
+	logger.Infof("successfully watched custom resources")
+
+	for {
+		select {
+		case <-ic.stopCh:
+			close(stopCh)
+			return
+		case <-ic.crdClient.event():
+			ic.reconcileCRDs()
+		}
+	}
+}
+
+// reconcileCRDs makes the objects in the CRD namespace the same as the
+// custom resources.
+func (ic *IngressController) reconcileCRDs() {
+	res := ic.crdClient.resources()
+	ct := newCRDTranslator()
+	ct.translate(res)
+
+	for name, spec := range ct.pipelines {
+		if _, err := ic.tc.ApplyPipelineForSpec(ic.crdNamespace, spec); err != nil {
+			logger.Errorf("failed to apply pipeline %s: %v", name, err)
+		}
+	}
+	for name, spec := range ct.httpServers {
+		if _, err := ic.tc.ApplyTrafficGateForSpec(ic.crdNamespace, spec); err != nil {
+			logger.Errorf("failed to apply http server %s: %v", name, err)
+		}
+	}
+
+	for _, p := range ic.tc.ListPipelines(ic.crdNamespace) {
+		if _, ok := ct.pipelines[p.Spec().Name()]; !ok {
+			ic.tc.DeletePipeline(ic.crdNamespace, p.Spec().Name())
+		}
+	}
+	for _, g := range ic.tc.ListTrafficGates(ic.crdNamespace) {
+		if _, ok := ct.httpServers[g.Spec().Name()]; !ok {
+			ic.tc.DeleteTrafficGate(ic.crdNamespace, g.Spec().Name())
+		}
+	}
+
+	for _, obj := range res.filterTemplates {
+		ic.crdClient.updateStatus(filterTemplateGVR, obj, ct.errors[crdKey(obj)])
+	}
+	for _, obj := range res.pipelines {
+		ic.crdClient.updateStatus(pipelineGVR, obj, ct.errors[crdKey(obj)])
+	}
+	for _, obj := range res.httpServers {
+		ic.crdClient.updateStatus(httpServerGVR, obj, ct.errors[crdKey(obj)])
+	}
+
+	for key, msg := range ct.errors {
+		logger.Errorf("failed to translate %s: %s", key, msg)
+	}
+	ic.crdErrors.Store(ct.errors)
+}
+
 // Status returns the status of IngressController.
 func (ic *IngressController) Status() *supervisor.Status {
+	status := &Status{}
+	if errs, ok := ic.crdErrors.Load().(map[string]string); ok && len(errs) > 0 {
+		status.CRDErrors = errs
+	}
+
 	return &supervisor.Status{
-		ObjectStatus: nil,
+		ObjectStatus: status,
 	}
 }
 
@@ -193,11 +316,12 @@ func (ic *IngressController) Close() {
 	close(ic.stopCh)
 	ic.wg.Wait()
 	ic.tc.Clean(ic.namespace)
+	ic.tc.Clean(ic.crdNamespace)
 }
 
 func (ic *IngressController) translate() error {
 	logger.Debugf("begin translate kubernetes ingress to easegress configuration")
-	st := newSpecTranslator(ic.k8sClient, ic.spec.IngressClass, ic.spec.HTTPServer)
+	st := newSpecTranslator(ic.k8sClient, ic.spec.IngressClass, ic.spec.HTTPServer, ic.spec.FilterTemplates)
 	err := st.translate()
 	if err != nil {
 		logger.Errorf("failed to translate kubernetes ingress: %v", err)
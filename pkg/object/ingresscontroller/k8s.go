@@ -106,44 +106,58 @@ func isSubsetsChanged(a, b apicorev1.EndpointSubset) bool {
 	return false
 }
 
-type k8sClient struct {
-	namespaces      []string
-	clientset       *kubernetes.Clientset
-	informerFactory informers.SharedInformerFactory
-	eventCh         chan interface{}
+// eventHandler notifies resource changes through a channel.
+type eventHandler struct {
+	eventCh chan interface{}
+}
+
+func newEventHandler() eventHandler {
+	return eventHandler{eventCh: make(chan interface{}, 1)}
 }
 
 // OnAdd is called on Resource Add Events.
-func (c *k8sClient) OnAdd(obj interface{}) {
+func (h eventHandler) OnAdd(obj interface{}) {
 	// if there's an event already in the channel, discard this one,
 	// this is fine because IngressController always reload everything
 	// when receiving an event. Same for OnUpdate & OnDelete
 	select {
-	case c.eventCh <- obj:
+	case h.eventCh <- obj:
 	default:
 	}
 }
 
 // OnUpdate is called on Resource Update Events.
-func (c *k8sClient) OnUpdate(oldObj, newObj interface{}) {
+func (h eventHandler) OnUpdate(oldObj, newObj interface{}) {
 	if !isResourceChanged(oldObj, newObj) {
 		return
 	}
 
 	select {
-	case c.eventCh <- newObj:
+	case h.eventCh <- newObj:
 	default:
 	}
 }
 
 // OnDelete is called on Resource Delete Events.
-func (c *k8sClient) OnDelete(obj interface{}) {
+func (h eventHandler) OnDelete(obj interface{}) {
 	select {
-	case c.eventCh <- obj:
+	case h.eventCh <- obj:
 	default:
 	}
 }
 
+func (h eventHandler) event() <-chan interface{} {
+	return h.eventCh
+}
+
+type k8sClient struct {
+	eventHandler
+
+	namespaces      []string
+	clientset       *kubernetes.Clientset
+	informerFactory informers.SharedInformerFactory
+}
+
 func newK8sClient(masterURL string, kubeConfig string) (*k8sClient, error) {
 	cfg, err := clientcmd.BuildConfigFromFlags(masterURL, kubeConfig)
 	if err != nil {
@@ -158,16 +172,12 @@ func newK8sClient(masterURL string, kubeConfig string) (*k8sClient, error) {
 	}
 
 	return &k8sClient{
-		clientset: clientset,
-		eventCh:   make(chan interface{}, 1),
+		eventHandler: newEventHandler(),
+		clientset:    clientset,
 	}, nil
 }
 
-func (c *k8sClient) event() <-chan interface{} {
-	return c.eventCh
-}
-
-func (c *k8sClient) watch(namespaces []string) (chan struct{}, error) {
+func (c *k8sClient) watch(namespaces []string, filterTemplates string) (chan struct{}, error) {
 	stopCh := make(chan struct{})
 
 	if len(namespaces) == 0 {
@@ -194,6 +204,15 @@ func (c *k8sClient) watch(namespaces []string) (chan struct{}, error) {
 		informer.AddEventHandler(c)
 	}
 
+	if filterTemplates != "" {
+		ns, name := splitNamespacedName(filterTemplates)
+		onlyTemplates := func(opts *metav1.ListOptions) {
+			opts.FieldSelector = "metadata.name=" + name
+		}
+		informer := corev1.New(factory, ns, internalinterfaces.TweakListOptionsFunc(onlyTemplates)).ConfigMaps().Informer()
+		informer.AddEventHandler(c)
+	}
+
 	factory.Start(stopCh)
 	for typ, ok := range factory.WaitForCacheSync(stopCh) {
 		if !ok {
@@ -230,6 +249,14 @@ func (c *k8sClient) getSecret(namespace, name string) (*apicorev1.Secret, error)
 	return secret, err
 }
 
+func (c *k8sClient) getConfigMap(namespace, name string) (*apicorev1.ConfigMap, error) {
+	cm, err := c.informerFactory.Core().V1().ConfigMaps().Lister().ConfigMaps(namespace).Get(name)
+	if errors.IsNotFound(err) {
+		err = nil
+	}
+	return cm, err
+}
+
 func (c *k8sClient) getIngresses(ingressClass string) []*apinetv1.Ingress {
 	var result []*apinetv1.Ingress
 
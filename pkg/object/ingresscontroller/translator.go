@@ -47,6 +47,9 @@ type (
 		pipelines    map[string]*supervisor.Spec
 		httpSvrCfg   *httpserver.Spec
 		ingressClass string
+		// filterTemplates is the namespaced name of the filter templates
+		// ConfigMap.
+		filterTemplates string
 	}
 
 	pipelineSpecBuilder struct {
@@ -70,6 +73,11 @@ func newPipelineSpecBuilder(name string) *pipelineSpecBuilder {
 	}
 }
 
+func (b *pipelineSpecBuilder) addFilter(filter map[string]interface{}) {
+	b.Flow = append(b.Flow, pipeline.FlowNode{FilterName: filter["name"].(string)})
+	b.Filters = append(b.Filters, filter)
+}
+
 func (b *pipelineSpecBuilder) addProxy(endpoints []string) {
 	const name = "proxy"
 
@@ -120,12 +128,13 @@ func (b *httpServerSpecBuilder) jsonConfig() string {
 	return string(buff)
 }
 
-func newSpecTranslator(k8sClient *k8sClient, ingressClass string, httpSvrCfg *httpserver.Spec) *specTranslator {
+func newSpecTranslator(k8sClient *k8sClient, ingressClass string, httpSvrCfg *httpserver.Spec, filterTemplates string) *specTranslator {
 	return &specTranslator{
-		k8sClient:    k8sClient,
-		httpSvrCfg:   httpSvrCfg,
-		ingressClass: ingressClass,
-		pipelines:    map[string]*supervisor.Spec{},
+		k8sClient:       k8sClient,
+		httpSvrCfg:      httpSvrCfg,
+		ingressClass:    ingressClass,
+		filterTemplates: filterTemplates,
+		pipelines:       map[string]*supervisor.Spec{},
 	}
 }
 
@@ -137,8 +146,11 @@ func (st *specTranslator) pipelineSpecs() map[string]*supervisor.Spec {
 	return st.pipelines
 }
 
-func generatePipelineSpec(name string, endpoints []string) (*supervisor.Spec, error) {
+func generatePipelineSpec(name string, endpoints []string, filters []map[string]interface{}) (*supervisor.Spec, error) {
 	b := newPipelineSpecBuilder(name)
+	for _, f := range filters {
+		b.addFilter(f)
+	}
 	b.addProxy(endpoints)
 	jsonConfig := b.jsonConfig()
 
@@ -206,7 +218,10 @@ func (st *specTranslator) getEndpoints(namespace string, service *apinetv1.Ingre
 	return result, nil
 }
 
-func (st *specTranslator) serviceToPipeline(namespace string, service *apinetv1.IngressServiceBackend) (*supervisor.Spec, error) {
+// serviceToPipeline returns the pipeline of the service, the pipeline is
+// shared by ingresses without filter annotations.
+func (st *specTranslator) serviceToPipeline(ingress *apinetv1.Ingress, service *apinetv1.IngressServiceBackend, filters []map[string]interface{}) (*supervisor.Spec, error) {
+	namespace := ingress.Namespace
 	if service == nil || len(service.Name) == 0 {
 		err := fmt.Errorf("invalid service name, ingress backend is object ref")
 		logger.Errorf("%v", err)
@@ -218,6 +233,9 @@ func (st *specTranslator) serviceToPipeline(namespace string, service *apinetv1.
 		port = strconv.Itoa(int(service.Port.Number))
 	}
 	pipelineName := fmt.Sprintf("pipeline-%s-%s-%s", namespace, service.Name, port)
+	if len(filters) > 0 {
+		pipelineName = fmt.Sprintf("pipeline-%s-%s-%s-%s", namespace, ingress.Name, service.Name, port)
+	}
 	if st.pipelines[pipelineName] != nil {
 		return st.pipelines[pipelineName], nil
 	}
@@ -228,7 +246,7 @@ func (st *specTranslator) serviceToPipeline(namespace string, service *apinetv1.
 		return nil, err
 	}
 
-	spec, err := generatePipelineSpec(pipelineName, endpoints)
+	spec, err := generatePipelineSpec(pipelineName, endpoints, filters)
 	if err != nil {
 		logger.Errorf("failed to generate pipeline spec: %v", err)
 		return nil, err
@@ -238,7 +256,7 @@ func (st *specTranslator) serviceToPipeline(namespace string, service *apinetv1.
 	return spec, err
 }
 
-func (st *specTranslator) translateDefaultPipeline(ingress *apinetv1.Ingress) error {
+func (st *specTranslator) translateDefaultPipeline(ingress *apinetv1.Ingress, filters []map[string]interface{}) error {
 	if st.pipelines[defaultPipelineName] != nil {
 		err := fmt.Errorf("the default pipeline has already been created")
 		logger.Errorf("%v", err)
@@ -251,7 +269,7 @@ func (st *specTranslator) translateDefaultPipeline(ingress *apinetv1.Ingress) er
 		return err
 	}
 
-	spec, err := generatePipelineSpec(defaultPipelineName, endpoints)
+	spec, err := generatePipelineSpec(defaultPipelineName, endpoints, filters)
 	if err != nil {
 		logger.Errorf("failed to generate pipeline spec: %v", err)
 		return err
@@ -314,7 +332,7 @@ func (st *specTranslator) translateTLSConfig(b *httpServerSpecBuilder, ingresses
 	return nil
 }
 
-func (st *specTranslator) translateIngressRules(b *httpServerSpecBuilder, ingress *apinetv1.Ingress) {
+func (st *specTranslator) translateIngressRules(b *httpServerSpecBuilder, ingress *apinetv1.Ingress, filters []map[string]interface{}) {
 	for _, rule := range ingress.Spec.Rules {
 		if rule.HTTP == nil {
 			continue
@@ -322,7 +340,7 @@ func (st *specTranslator) translateIngressRules(b *httpServerSpecBuilder, ingres
 
 		r := &httpserver.Rule{}
 		for _, path := range rule.HTTP.Paths {
-			pipeline, err := st.serviceToPipeline(ingress.Namespace, path.Backend.Service)
+			pipeline, err := st.serviceToPipeline(ingress, path.Backend.Service, filters)
 			if err != nil {
 				continue
 			}
@@ -381,10 +399,19 @@ func (st *specTranslator) translate() error {
 	}
 
 	for _, ingress := range ingresses {
+		// NOTE: Skip the ingress if its filters are invalid, instead of
+		// exposing the routes without them.
+		filters, err := st.translateFilterAnnotations(ingress)
+		if err != nil {
+			logger.Errorf("failed to translate filter annotations of ingress %s/%s: %v",
+				ingress.Namespace, ingress.Name, err)
+			continue
+		}
+
 		if ingress.Spec.DefaultBackend != nil {
-			st.translateDefaultPipeline(ingress)
+			st.translateDefaultPipeline(ingress, filters)
 		}
-		st.translateIngressRules(b, ingress)
+		st.translateIngressRules(b, ingress, filters)
 	}
 
 	// sort rules by host
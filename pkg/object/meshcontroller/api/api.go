@@ -24,6 +24,7 @@ import (
 
 	"github.com/megaease/easegress/pkg/api"
 	"github.com/megaease/easegress/pkg/object/meshcontroller/service"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/util/codectool"
 	"github.com/megaease/easegress/pkg/v"
@@ -113,12 +114,16 @@ const (
 
 	// MeshServiceCanaryPath is the service canary path.
 	MeshServiceCanaryPath = "/mesh/servicecanaries/{serviceCanaryName}"
+
+	// MeshFederationCatalogPath is the path of the service catalog exported to the federation peers.
+	MeshFederationCatalogPath = "/mesh/federation/catalog"
 )
 
 type (
 	// API is the struct with the service
 	API struct {
-		service *service.Service
+		service    *service.Service
+		federation *spec.Federation
 	}
 )
 
@@ -127,7 +132,8 @@ const apiGroupName = "mesh_admin"
 // New creates a API
 func New(superSpec *supervisor.Spec) *API {
 	api := &API{
-		service: service.New(superSpec),
+		service:    service.New(superSpec),
+		federation: superSpec.ObjectSpec().(*spec.Admin).Federation,
 	}
 
 	api.registerAPIs()
@@ -228,6 +234,8 @@ func (a *API) registerAPIs() {
 			{Path: MeshServiceCanaryPath, Method: "GET", Handler: a.getServiceCanary},
 			{Path: MeshServiceCanaryPath, Method: "PUT", Handler: a.updateServiceCanary},
 			{Path: MeshServiceCanaryPath, Method: "DELETE", Handler: a.deleteServiceCanary},
+
+			{Path: MeshFederationCatalogPath, Method: "GET", Handler: a.getFederationCatalog},
 		},
 	}
 
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// getFederationCatalog returns the exported services with local instances
+// in UP status, the instances from the peers are not counted so that the
+// catalogs never loop between clusters.
+func (a *API) getFederationCatalog(w http.ResponseWriter, r *http.Request) {
+	if a.federation == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("federation not enabled"))
+		return
+	}
+
+	instances := map[string]int{}
+	for _, instance := range a.service.ListAllServiceInstanceSpecs() {
+		if spec.IsFederationRegistryName(instance.RegistryName) {
+			continue
+		}
+		if instance.Status == spec.ServiceStatusUp {
+			instances[instance.ServiceName]++
+		}
+	}
+
+	catalog := &spec.FederationCatalog{
+		ClusterName: a.federation.ClusterName,
+		Region:      a.federation.Region,
+		Zone:        a.federation.Zone,
+		Services:    []*spec.FederationCatalogService{},
+	}
+	for _, s := range a.service.ListServiceSpecs() {
+		if !a.federation.Exported(s.Name) || instances[s.Name] == 0 {
+			continue
+		}
+		catalog.Services = append(catalog.Services, &spec.FederationCatalogService{
+			Name:      s.Name,
+			Instances: instances[s.Name],
+		})
+	}
+	sort.Slice(catalog.Services, func(i, j int) bool {
+		return catalog.Services[i].Name < catalog.Services[j].Name
+	})
+
+	buff := codectool.MustMarshalJSON(catalog)
+	a.writeJSONBody(w, buff)
+}
@@ -52,6 +52,11 @@ type (
 		backendPipelines map[string]*supervisor.ObjectEntity
 		ingressBackends  map[string]struct{}
 		ingressRules     []*spec.IngressRule
+
+		// federationServices are the services exported to the federation
+		// peers which have pipelines in the ingress controller.
+		federationServices []*spec.Service
+		gatewayServer      *supervisor.ObjectEntity
 	}
 
 	// Status is the traffic controller status
@@ -198,6 +203,7 @@ func (ic *IngressController) reloadTraffic() {
 	ic._reloadIngress()
 	ic._reloadPipelines()
 	ic._reloadHTTPServer()
+	ic._reloadFederationGateway()
 }
 
 func (ic *IngressController) _reloadIngress() {
@@ -219,9 +225,14 @@ func (ic *IngressController) _reloadIngress() {
 	ic.ingressBackends, ic.ingressRules = ingressBackends, ingressRules
 }
 
+// exported returns whether the service is exported to the federation peers.
+func (ic *IngressController) exported(serviceName string) bool {
+	return ic.spec.Federation != nil && ic.spec.Federation.Exported(serviceName)
+}
+
 func (ic *IngressController) _reloadPipelines() {
 	for backend, entity := range ic.backendPipelines {
-		if _, exists := ic.ingressBackends[backend]; !exists {
+		if _, exists := ic.ingressBackends[backend]; !exists && !ic.exported(backend) {
 			err := ic.tc.DeletePipeline(ic.namespace, entity.Spec().Name())
 			if err != nil {
 				logger.Errorf("delete http pipeline %s failed: %v",
@@ -234,18 +245,22 @@ func (ic *IngressController) _reloadPipelines() {
 	// if in mTLS strict model, should init pipeline with certificates
 	admSpec := ic.superSpec.ObjectSpec().(*spec.Admin)
 	var cert, rootCert *spec.Certificate
-	if admSpec.EnablemTLS() {
+	if admSpec.EnablemTLS() && !admSpec.EnableSPIFFE() {
 		cert = ic.service.GetIngressControllerInstanceCert(ic.instanceID)
 		rootCert = ic.service.GetRootCert()
 	}
 
 	canaries := ic.service.ListServiceCanaries()
+	federationServices := []*spec.Service{}
 	for _, serviceSpec := range ic.service.ListServiceSpecs() {
-		if _, exists := ic.ingressBackends[serviceSpec.BackendName()]; !exists {
+		_, exists := ic.ingressBackends[serviceSpec.BackendName()]
+		if !exists && !ic.exported(serviceSpec.Name) {
 			continue
 		}
 
-		instanceSpecs := ic.service.ListServiceInstanceSpecs(serviceSpec.Name)
+		// the traffic from the ingress controller never goes to the
+		// federation peers, it avoids routing loops between clusters.
+		instanceSpecs, _ := spec.SplitFederationInstances(ic.service.ListServiceInstanceSpecs(serviceSpec.Name))
 		if len(instanceSpecs) == 0 {
 			continue
 		}
@@ -259,7 +274,7 @@ func (ic *IngressController) _reloadPipelines() {
 			continue
 		}
 
-		superSpec, err := serviceSpec.IngressControllerPipelineSpec(instanceSpecs, canaries, cert, rootCert)
+		superSpec, err := serviceSpec.IngressControllerPipelineSpec(instanceSpecs, canaries, cert, rootCert, admSpec.SPIFFESpec())
 		if err != nil {
 			logger.Errorf("get ingress pipeline for %s failed: %v",
 				serviceSpec.Name, err)
@@ -273,7 +288,12 @@ func (ic *IngressController) _reloadPipelines() {
 		}
 
 		ic.backendPipelines[serviceSpec.BackendName()] = entity
+		if ic.exported(serviceSpec.Name) {
+			federationServices = append(federationServices, serviceSpec)
+		}
 	}
+
+	ic.federationServices = federationServices
 }
 
 func (ic *IngressController) _reloadHTTPServer() {
@@ -292,6 +312,26 @@ func (ic *IngressController) _reloadHTTPServer() {
 	ic.httpServer = entity
 }
 
+func (ic *IngressController) _reloadFederationGateway() {
+	if ic.spec.Federation == nil {
+		return
+	}
+
+	superSpec, err := spec.FederationGatewayHTTPServerSpec(ic.spec.Federation, ic.federationServices)
+	if err != nil {
+		logger.Errorf("get federation gateway http server spec failed: %v", err)
+		return
+	}
+
+	entity, err := ic.tc.ApplyTrafficGateForSpec(ic.namespace, superSpec)
+	if err != nil {
+		logger.Errorf("apply federation gateway http server failed: %v", err)
+		return
+	}
+
+	ic.gatewayServer = entity
+}
+
 // Status returns the status of IngressController.
 func (ic *IngressController) Status() *supervisor.Status {
 	return &supervisor.Status{
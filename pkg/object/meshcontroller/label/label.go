@@ -28,6 +28,9 @@ const (
 	KeyApplicationPort = "mesh-application-port"
 	// KeyAliveProbe is the key of keepalive probe
 	KeyAliveProbe = "mesh-alive-probe"
+	// KeyAppProbes is the key of the application probes rewritten to the
+	// worker, in the format of name1=url1,name2=url2
+	KeyAppProbes = "mesh-app-probes"
 
 	// ValueRoleMaster is the name of master
 	ValueRoleMaster = "master"
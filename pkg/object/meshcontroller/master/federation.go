@@ -0,0 +1,218 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package master
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	meshapi "github.com/megaease/easegress/pkg/object/meshcontroller/api"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/service"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	federationRequestTimeout = 5 * time.Second
+)
+
+type (
+	// federationSyncer syncs the service catalogs of the federation peers
+	// into the local mesh as service instances pointing to the gateways of
+	// the peers.
+	federationSyncer struct {
+		superSpec  *supervisor.Spec
+		federation *spec.Federation
+		service    *service.Service
+		clients    map[string]*http.Client
+
+		done chan struct{}
+	}
+)
+
+func newFederationSyncer(superSpec *supervisor.Spec) *federationSyncer {
+	federation := superSpec.ObjectSpec().(*spec.Admin).Federation
+	if federation == nil {
+		return nil
+	}
+
+	fs := &federationSyncer{
+		superSpec:  superSpec,
+		federation: federation,
+		service:    service.New(superSpec),
+		clients:    make(map[string]*http.Client),
+
+		done: make(chan struct{}),
+	}
+
+	for _, peer := range federation.Peers {
+		tlsConfig, err := federation.TLSSpec(peer).TLSConfig()
+		if err != nil {
+			logger.Errorf("create tls config for federation peer %s failed: %v", peer.Name, err)
+			continue
+		}
+		fs.clients[peer.Name] = &http.Client{
+			Timeout:   federationRequestTimeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		}
+	}
+
+	go fs.run()
+
+	return fs
+}
+
+func (fs *federationSyncer) run() {
+	interval, err := time.ParseDuration(fs.federation.GetSyncInterval())
+	if err != nil {
+		logger.Errorf("BUG: parse federation sync interval %s failed: %v",
+			fs.federation.GetSyncInterval(), err)
+		interval = syncInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-fs.done:
+			return
+		case <-ticker.C:
+			if fs.needSync() {
+				fs.sync()
+			}
+		}
+	}
+}
+
+func (fs *federationSyncer) needSync() bool {
+	// NOTE: Only need one member in the cluster to do sync.
+	return fs.superSpec.Super().Cluster().IsLeader()
+}
+
+func (fs *federationSyncer) sync() {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Errorf("failed to sync federation: %v, stack trace: \n%s\n", err, debug.Stack())
+		}
+	}()
+
+	// only the services also running in the local cluster are federated,
+	// the peers act as the failover of the local instances.
+	localServices := make(map[string]struct{})
+	for _, s := range fs.service.ListServiceSpecs() {
+		localServices[s.Name] = struct{}{}
+	}
+
+	oldInstances := make(map[string]*spec.ServiceInstanceSpec)
+	for _, instance := range fs.service.ListAllServiceInstanceSpecs() {
+		if spec.IsFederationRegistryName(instance.RegistryName) {
+			oldInstances[instance.Key()] = instance
+		}
+	}
+
+	newInstances := make(map[string]*spec.ServiceInstanceSpec)
+	for _, peer := range fs.federation.Peers {
+		catalog, err := fs.fetchCatalog(peer)
+		if err != nil {
+			logger.Errorf("fetch catalog of federation peer %s failed: %v", peer.Name, err)
+			// keep the instances of an unreachable peer but bring them
+			// down, so that the traffic fails over to other peers.
+			for key, instance := range oldInstances {
+				if instance.RegistryName != spec.FederationRegistryName(peer.Name) {
+					continue
+				}
+				down := *instance
+				down.Status = spec.ServiceStatusOutOfService
+				newInstances[key] = &down
+			}
+			continue
+		}
+
+		for _, s := range catalog.Services {
+			if _, ok := localServices[s.Name]; !ok || s.Instances == 0 {
+				continue
+			}
+			instance := fs.federation.FederationInstanceSpec(peer, s.Name)
+			newInstances[instance.Key()] = instance
+		}
+	}
+
+	for key, instance := range oldInstances {
+		if _, ok := newInstances[key]; !ok {
+			logger.Infof("delete federation instance %s/%s", instance.ServiceName, instance.InstanceID)
+			fs.service.DeleteServiceInstanceSpec(instance.ServiceName, instance.InstanceID)
+		}
+	}
+
+	for key, instance := range newInstances {
+		old := oldInstances[key]
+		if old != nil && old.Status == instance.Status && reflect.DeepEqual(old.Labels, instance.Labels) &&
+			old.IP == instance.IP && old.Port == instance.Port {
+			continue
+		}
+		instance.RegistryTime = time.Now().Format(time.RFC3339)
+		fs.service.PutServiceInstanceSpec(instance)
+	}
+}
+
+func (fs *federationSyncer) fetchCatalog(peer *spec.FederationPeer) (*spec.FederationCatalog, error) {
+	client := fs.clients[peer.Name]
+	if client == nil {
+		return nil, fmt.Errorf("no http client")
+	}
+
+	url := strings.TrimSuffix(peer.APIURL, "/") + meshapi.MeshFederationCatalogPath
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code %d: %s", resp.StatusCode, body)
+	}
+
+	catalog := &spec.FederationCatalog{}
+	if err = codectool.UnmarshalJSON(body, catalog); err != nil {
+		return nil, err
+	}
+	if catalog.ClusterName != peer.Name {
+		return nil, fmt.Errorf("cluster name mismatch, want %s, got %s", peer.Name, catalog.ClusterName)
+	}
+
+	return catalog, nil
+}
+
+func (fs *federationSyncer) close() {
+	close(fs.done)
+	for _, client := range fs.clients {
+		client.CloseIdleConnections()
+	}
+}
@@ -45,9 +45,10 @@ type (
 		heartbeatInterval time.Duration
 		certManager       *certmanager.CertManager
 
-		registrySyncer *registrySyncer
-		store          storage.Storage
-		service        *service.Service
+		registrySyncer   *registrySyncer
+		federationSyncer *federationSyncer
+		store            storage.Storage
+		service          *service.Service
 
 		done chan struct{}
 	}
@@ -65,9 +66,10 @@ func New(superSpec *supervisor.Spec) *Master {
 		superSpec: superSpec,
 		spec:      adminSpec,
 
-		store:          store,
-		service:        service.New(superSpec),
-		registrySyncer: newRegistrySyncer(superSpec),
+		store:            store,
+		service:          service.New(superSpec),
+		registrySyncer:   newRegistrySyncer(superSpec),
+		federationSyncer: newFederationSyncer(superSpec),
 
 		done: make(chan struct{}),
 	}
@@ -87,7 +89,8 @@ func New(superSpec *supervisor.Spec) *Master {
 }
 
 func (m *Master) initMTLS() error {
-	if !m.spec.EnablemTLS() {
+	// the certificates are issued by the SPIFFE implementation.
+	if !m.spec.EnablemTLS() || m.spec.EnableSPIFFE() {
 		return nil
 	}
 	appCertTTL, err := time.ParseDuration(m.spec.Security.AppCertTTL)
@@ -240,9 +243,12 @@ func (m *Master) updateInstanceStatus(_spec *spec.ServiceInstanceSpec, status st
 
 // Close closes the master
 func (m *Master) Close() {
-	if m.spec.EnablemTLS() {
+	if m.certManager != nil {
 		m.certManager.Close()
 	}
+	if m.federationSyncer != nil {
+		m.federationSyncer.close()
+	}
 	close(m.done)
 }
 
@@ -97,6 +97,10 @@ func (rs *registrySyncer) cleanExternalRegistry() {
 		case "", meshRegistryName, externalRegistryName:
 			continue
 		}
+		// instances of the federation peers are managed by the federation syncer.
+		if spec.IsFederationRegistryName(instance.RegistryName) {
+			continue
+		}
 
 		rs.service.DeleteServiceInstanceSpec(instance.ServiceName, instance.InstanceID)
 		logger.Infof("clean service instance: %s/%s", instance.ServiceName, instance.InstanceID)
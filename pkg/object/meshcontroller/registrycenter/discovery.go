@@ -53,13 +53,20 @@ func GetServiceName(instanceID string) string {
 	return names[2]
 }
 
-// defaultInstance creates default egress instance point to the sidecar's egress port
+// defaultInstance creates default egress instance point to the sidecar's egress port,
+// or the upstream port of the target if there is one, so that the clients without
+// the Java agent can access the target without the header X-Mesh-Rpc-Service.
 func (rcs *Server) defaultInstance(self, target *spec.Service) *spec.ServiceInstanceSpec {
+	port := self.Sidecar.UpstreamPort(target.Name)
+	if port == 0 {
+		port = self.Sidecar.EgressPort
+	}
+
 	return &spec.ServiceInstanceSpec{
 		ServiceName: target.Name,
 		InstanceID:  UniqInstanceID(target.Name),
 		IP:          self.Sidecar.Address,
-		Port:        uint32(self.Sidecar.EgressPort),
+		Port:        uint32(port),
 	}
 }
 
@@ -31,6 +31,7 @@ import (
 	"github.com/megaease/easegress/pkg/resilience"
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/spiffe"
 )
 
 type (
@@ -38,26 +39,32 @@ type (
 		Kind string `json:"kind"`
 		Name string `json:"name"`
 
-		mockName           string
-		rateLimiterName    string
-		circuitBreakerName string
-		retryName          string
-		meshAdaptorName    string
-		proxyName          string
+		mockName              string
+		rateLimiterName       string
+		circuitBreakerName    string
+		retryName             string
+		meshAdaptorName       string
+		federationAdaptorName string
+		proxyName             string
 
 		pipeline.Spec `json:",inline"`
 	}
 
 	proxyParam struct {
-		instanceSpecs        []*ServiceInstanceSpec
-		canaries             []*ServiceCanary
-		lb                   *proxy.LoadBalanceSpec
-		cert                 *Certificate
-		rootCert             *Certificate
+		instanceSpecs []*ServiceInstanceSpec
+		canaries      []*ServiceCanary
+		lb            *proxy.LoadBalanceSpec
+		cert          *Certificate
+		rootCert      *Certificate
+		spiffe        *spiffe.Spec
+		// tls overrides the mTLS of the mesh if it's not nil.
+		tls                  *proxy.TLSSpec
 		timeout              string
+		timeoutOverrides     []*proxy.TimeoutOverride
 		retryPolicy          string
 		circuitBreakerPolicy string
 		failureCodes         []int
+		outlierDetection     *proxy.OutlierDetectionSpec
 	}
 )
 
@@ -66,12 +73,13 @@ func newPipelineSpecBuilder(name string) *pipelineSpecBuilder {
 		Kind: pipeline.Kind,
 		Name: name,
 
-		mockName:           "mock",
-		rateLimiterName:    "rateLimiter",
-		circuitBreakerName: "circuitBreaker",
-		retryName:          "retry",
-		meshAdaptorName:    "meshAdaptor",
-		proxyName:          "proxy",
+		mockName:              "mock",
+		rateLimiterName:       "rateLimiter",
+		circuitBreakerName:    "circuitBreaker",
+		retryName:             "retry",
+		meshAdaptorName:       "meshAdaptor",
+		federationAdaptorName: "federationAdaptor",
+		proxyName:             "proxy",
 
 		Spec: pipeline.Spec{},
 	}
@@ -206,10 +214,11 @@ func (b *pipelineSpecBuilder) appendProxyWithCanary(param *proxyParam) *pipeline
 	}
 
 	needMTLS := false
-	if param.cert != nil && param.rootCert != nil {
+	if param.spiffe != nil {
+		needMTLS = true
+		proxySpec.SPIFFE = param.spiffe
+	} else if param.cert != nil && param.rootCert != nil {
 		needMTLS = true
-	}
-	if needMTLS {
 		proxySpec.MTLS = &proxy.MTLS{
 			CertBase64:     param.cert.CertBase64,
 			KeyBase64:      param.cert.KeyBase64,
@@ -219,7 +228,7 @@ func (b *pipelineSpecBuilder) appendProxyWithCanary(param *proxyParam) *pipeline
 
 	makeServer := func(instance *ServiceInstanceSpec) *proxy.Server {
 		var protocol string
-		if needMTLS {
+		if needMTLS || param.tls != nil {
 			protocol = "https"
 		} else {
 			protocol = "http"
@@ -232,9 +241,12 @@ func (b *pipelineSpecBuilder) appendProxyWithCanary(param *proxyParam) *pipeline
 	mainPool := &proxy.ServerPoolSpec{
 		LoadBalance:          param.lb,
 		Timeout:              param.timeout,
+		TimeoutOverrides:     param.timeoutOverrides,
 		RetryPolicy:          param.retryPolicy,
 		CircuitBreakerPolicy: param.circuitBreakerPolicy,
 		FailureCodes:         param.failureCodes,
+		OutlierDetection:     param.outlierDetection,
+		TLS:                  param.tls,
 	}
 	candidatePools := make([]*proxy.ServerPoolSpec, len(param.canaries))
 
@@ -264,9 +276,11 @@ func (b *pipelineSpecBuilder) appendProxyWithCanary(param *proxyParam) *pipeline
 					},
 					LoadBalance:          param.lb,
 					Timeout:              param.timeout,
+					TimeoutOverrides:     param.timeoutOverrides,
 					RetryPolicy:          param.retryPolicy,
 					CircuitBreakerPolicy: param.circuitBreakerPolicy,
 					FailureCodes:         param.failureCodes,
+					OutlierDetection:     param.outlierDetection,
 				}
 			}
 
@@ -0,0 +1,403 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/filters/proxy"
+	"github.com/megaease/easegress/pkg/filters/requestadaptor"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/pipeline"
+	"github.com/megaease/easegress/pkg/protocols/httpprot/httpheader"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// FederationGatewayPort is the default port of the federation gateway.
+	FederationGatewayPort = 13012
+
+	// FederationSyncInterval is the default interval to sync the service
+	// catalogs of the peers.
+	FederationSyncInterval = "10s"
+
+	// FederationGatewayServerName is the HTTP server name of the federation gateway.
+	FederationGatewayServerName = "federation-gateway-server"
+
+	// FederationServiceHeaderKey is the http header key carrying the target
+	// service of the cross-cluster requests.
+	FederationServiceHeaderKey = "X-Mesh-Federation-Service"
+
+	// FederationClusterLabel is the label key of the peer cluster of a
+	// federated service instance.
+	FederationClusterLabel = "mesh-federation-cluster"
+
+	// FederationPriorityLabel is the label key of the locality priority of
+	// a federated service instance, the smaller the closer.
+	FederationPriorityLabel = "mesh-federation-priority"
+
+	federationRegistryPrefix = "federation-"
+
+	// locality priorities of the federated service instances.
+	federationPrioritySameZone   = 0
+	federationPrioritySameRegion = 1
+	federationPriorityOther      = 2
+)
+
+type (
+	// Federation is the spec of the mesh federation, which allows the
+	// mesh control planes of different clusters to exchange their service
+	// catalogs and route the traffic across the clusters.
+	Federation struct {
+		// ClusterName is the name of the local cluster in the federation.
+		ClusterName string `json:"clusterName" jsonschema:"required"`
+		Region      string `json:"region" jsonschema:"omitempty"`
+		Zone        string `json:"zone" jsonschema:"omitempty"`
+
+		// GatewayPort is the port of the federation gateway running in
+		// the ingress controllers, which accepts the traffic from peers.
+		GatewayPort  int    `json:"gatewayPort" jsonschema:"omitempty"`
+		SyncInterval string `json:"syncInterval" jsonschema:"omitempty,format=duration"`
+
+		// ExportedServices are the services accessible to the peers,
+		// empty means all services.
+		ExportedServices []string `json:"exportedServices" jsonschema:"omitempty,uniqueItems=true"`
+
+		// The certificates of the mTLS tunnels between the gateways, the
+		// RootCertBase64 must be able to verify the certificates of all peers.
+		CertBase64     string `json:"certBase64" jsonschema:"required,format=base64"`
+		KeyBase64      string `json:"keyBase64" jsonschema:"required,format=base64"`
+		RootCertBase64 string `json:"rootCertBase64" jsonschema:"required,format=base64"`
+
+		Peers []*FederationPeer `json:"peers" jsonschema:"required"`
+	}
+
+	// FederationPeer is a peer cluster of the federation.
+	FederationPeer struct {
+		Name   string `json:"name" jsonschema:"required"`
+		Region string `json:"region" jsonschema:"omitempty"`
+		Zone   string `json:"zone" jsonschema:"omitempty"`
+
+		// APIURL is the URL of the mesh API of the peer, e.g.
+		// https://10.0.0.1:2381/apis/v2, to fetch its service catalog.
+		APIURL string `json:"apiURL" jsonschema:"required,format=url"`
+		// GatewayAddress is the address of the federation gateway of the
+		// peer, e.g. 10.0.0.2:13012.
+		GatewayAddress string `json:"gatewayAddress" jsonschema:"required"`
+		// ServerName is used to verify the certificate of the peer, the
+		// host of GatewayAddress is used if it's empty. Peers with the
+		// same locality should share the same ServerName.
+		ServerName string `json:"serverName" jsonschema:"omitempty"`
+	}
+
+	// FederationCatalog is the service catalog exported to the peers.
+	FederationCatalog struct {
+		ClusterName string                      `json:"clusterName"`
+		Region      string                      `json:"region"`
+		Zone        string                      `json:"zone"`
+		Services    []*FederationCatalogService `json:"services"`
+	}
+
+	// FederationCatalogService is a service in the catalog.
+	FederationCatalogService struct {
+		Name string `json:"name"`
+		// Instances is the number of the instances in UP status.
+		Instances int `json:"instances"`
+	}
+)
+
+// Validate validates Federation.
+func (f *Federation) Validate() error {
+	peers := map[string]struct{}{}
+	for _, p := range f.Peers {
+		if p.Name == f.ClusterName {
+			return fmt.Errorf("peer %s has the same name as the local cluster", p.Name)
+		}
+		if _, ok := peers[p.Name]; ok {
+			return fmt.Errorf("peer %s occurred multiple times", p.Name)
+		}
+		peers[p.Name] = struct{}{}
+
+		if _, _, err := p.gatewayHostPort(); err != nil {
+			return fmt.Errorf("peer %s: %v", p.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// GetGatewayPort returns the port of the federation gateway.
+func (f *Federation) GetGatewayPort() int {
+	if f.GatewayPort == 0 {
+		return FederationGatewayPort
+	}
+	return f.GatewayPort
+}
+
+// GetSyncInterval returns the interval to sync the catalogs of the peers.
+func (f *Federation) GetSyncInterval() string {
+	if f.SyncInterval == "" {
+		return FederationSyncInterval
+	}
+	return f.SyncInterval
+}
+
+// Exported returns whether the service is accessible to the peers.
+func (f *Federation) Exported(serviceName string) bool {
+	if len(f.ExportedServices) == 0 {
+		return true
+	}
+	return stringtool.StrInSlice(serviceName, f.ExportedServices)
+}
+
+// TLSSpec returns the TLS spec to access the gateway of the peer.
+func (f *Federation) TLSSpec(peer *FederationPeer) *proxy.TLSSpec {
+	return &proxy.TLSSpec{
+		CertBase64:     f.CertBase64,
+		KeyBase64:      f.KeyBase64,
+		RootCertBase64: f.RootCertBase64,
+		ServerName:     peer.ServerName,
+	}
+}
+
+// GetPeer returns the peer by name.
+func (f *Federation) GetPeer(name string) *FederationPeer {
+	for _, p := range f.Peers {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// locality returns the locality priority of the peer.
+func (f *Federation) locality(peer *FederationPeer) int {
+	if f.Region == "" || f.Region != peer.Region {
+		return federationPriorityOther
+	}
+	if f.Zone != "" && f.Zone == peer.Zone {
+		return federationPrioritySameZone
+	}
+	return federationPrioritySameRegion
+}
+
+// FederationInstanceSpec returns the service instance standing for the
+// service in the peer, it points to the gateway of the peer.
+func (f *Federation) FederationInstanceSpec(peer *FederationPeer, serviceName string) *ServiceInstanceSpec {
+	host, port, _ := peer.gatewayHostPort()
+
+	return &ServiceInstanceSpec{
+		RegistryName: FederationRegistryName(peer.Name),
+		ServiceName:  serviceName,
+		InstanceID:   FederationRegistryName(peer.Name),
+		IP:           host,
+		Port:         uint32(port),
+		Labels: map[string]string{
+			FederationClusterLabel:  peer.Name,
+			FederationPriorityLabel: strconv.Itoa(f.locality(peer)),
+		},
+		Status: ServiceStatusUp,
+	}
+}
+
+func (p *FederationPeer) gatewayHostPort() (string, int, error) {
+	host, portStr, err := net.SplitHostPort(p.GatewayAddress)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid gateway address %s: %v", p.GatewayAddress, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid gateway port %s", portStr)
+	}
+	return host, port, nil
+}
+
+// FederationRegistryName returns the registry name of the service
+// instances from the peer.
+func FederationRegistryName(peerName string) string {
+	return federationRegistryPrefix + peerName
+}
+
+// IsFederationRegistryName returns whether the registry name belongs to
+// a peer of the federation.
+func IsFederationRegistryName(registryName string) bool {
+	return strings.HasPrefix(registryName, federationRegistryPrefix)
+}
+
+// SplitFederationInstances splits the instances into the local ones and
+// the ones from the peers. Only the closest peers with instance in UP
+// status are kept in the remote ones, so that the traffic fails over to
+// the nearest region first.
+func SplitFederationInstances(instances []*ServiceInstanceSpec) (local, remote []*ServiceInstanceSpec) {
+	minPriority := -1
+	for _, instance := range instances {
+		if !IsFederationRegistryName(instance.RegistryName) {
+			local = append(local, instance)
+			continue
+		}
+		if instance.Status != ServiceStatusUp {
+			continue
+		}
+
+		priority, err := strconv.Atoi(instance.Labels[FederationPriorityLabel])
+		if err != nil {
+			priority = federationPriorityOther
+		}
+
+		switch {
+		case minPriority == -1 || priority < minPriority:
+			minPriority = priority
+			remote = []*ServiceInstanceSpec{instance}
+		case priority == minPriority:
+			remote = append(remote, instance)
+		}
+	}
+
+	return local, remote
+}
+
+// FederationGatewayHTTPServerSpec generates the HTTP server spec of the
+// federation gateway, it dispatches the requests from the peers to the
+// ingress controller pipelines of the services by the header
+// X-Mesh-Federation-Service.
+func FederationGatewayHTTPServerSpec(federation *Federation, services []*Service) (*supervisor.Spec, error) {
+	const specFmt = `
+kind: HTTPServer
+name: %s
+port: %d
+keepAlive: true
+https: true
+certBase64: %s
+keyBase64: %s
+caCertBase64: %s
+rules:`
+
+	const ruleFmt = `
+  - paths:`
+
+	const pathFmt = `
+      - pathPrefix: /
+        headers:
+          - key: %s
+            values: [%s]
+        backend: %s`
+
+	buf := bytes.Buffer{}
+	buf.WriteString(fmt.Sprintf(specFmt, FederationGatewayServerName, federation.GetGatewayPort(),
+		federation.CertBase64, federation.KeyBase64, federation.RootCertBase64))
+
+	if len(services) != 0 {
+		buf.WriteString(ruleFmt)
+	}
+	for _, s := range services {
+		buf.WriteString(fmt.Sprintf(pathFmt, FederationServiceHeaderKey, s.Name, s.IngressControllerPipelineName()))
+	}
+
+	yamlConfig := buf.String()
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	if err != nil {
+		logger.Errorf("new spec for %s failed: %v", yamlConfig, err)
+		return nil, err
+	}
+
+	return superSpec, nil
+}
+
+// SidecarEgressFederationPipelineSpec returns a spec for sidecar egress
+// pipeline which sends the requests to the federation gateways of the
+// peers, it is used when the service has no local instance available.
+func (s *Service) SidecarEgressFederationPipelineSpec(instanceSpecs []*ServiceInstanceSpec,
+	federation *Federation,
+) (*supervisor.Spec, error) {
+	if len(instanceSpecs) == 0 {
+		return nil, fmt.Errorf("no instance")
+	}
+
+	// the certificates are shared by all peers, so the TLS spec of the
+	// first peer is used for the pool.
+	peer := federation.GetPeer(instanceSpecs[0].Labels[FederationClusterLabel])
+	if peer == nil {
+		return nil, fmt.Errorf("peer of instance %s not found", instanceSpecs[0].InstanceID)
+	}
+
+	pipelineSpecBuilder := newPipelineSpecBuilder(s.SidecarEgressPipelineName())
+	pipelineSpecBuilder.appendFederationAdaptor(s.Name)
+
+	var timeout string
+	var failureCodes []int
+	var outlierDetection *proxy.OutlierDetectionSpec
+	if s.Resilience != nil {
+		if s.Resilience.TimeLimiter != nil {
+			timeout = s.Resilience.TimeLimiter.Timeout
+		}
+		failureCodes = s.Resilience.FailureCodes
+		outlierDetection = s.Resilience.OutlierEjection
+	}
+
+	pipelineSpecBuilder.appendProxyWithCanary(&proxyParam{
+		instanceSpecs:    instanceSpecs,
+		lb:               s.LoadBalance,
+		tls:              federation.TLSSpec(peer),
+		timeout:          timeout,
+		failureCodes:     failureCodes,
+		outlierDetection: outlierDetection,
+	})
+
+	jsonConfig := pipelineSpecBuilder.jsonConfig()
+	superSpec, err := supervisor.NewSpec(jsonConfig)
+	if err != nil {
+		logger.Errorf("new spec for %s failed: %v", jsonConfig, err)
+		return nil, err
+	}
+
+	return superSpec, nil
+}
+
+func (b *pipelineSpecBuilder) appendFederationAdaptor(serviceName string) *pipelineSpecBuilder {
+	adaptorSpec := &requestadaptor.Spec{
+		BaseSpec: filters.BaseSpec{
+			MetaSpec: supervisor.MetaSpec{
+				Name: b.federationAdaptorName,
+				Kind: requestadaptor.Kind,
+			},
+		},
+		Header: &httpheader.AdaptSpec{
+			Set: map[string]string{
+				FederationServiceHeaderKey: serviceName,
+			},
+		},
+	}
+
+	m, err := codectool.StructToMap(adaptorSpec)
+	if err != nil {
+		logger.Errorf("BUG: convert %#v to map failed: %v", adaptorSpec, err)
+		return b
+	}
+
+	b.Flow = append(b.Flow, pipeline.FlowNode{FilterName: b.federationAdaptorName})
+	b.Filters = append(b.Filters, m)
+
+	return b
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"strings"
+	"testing"
+)
+
+func newTestFederation() *Federation {
+	return &Federation{
+		ClusterName:    "us-east-1a",
+		Region:         "us-east",
+		Zone:           "1a",
+		CertBase64:     RootCertBase64,
+		KeyBase64:      RootKeyBase64,
+		RootCertBase64: RootCertBase64,
+		Peers: []*FederationPeer{
+			{
+				Name:           "us-east-1b",
+				Region:         "us-east",
+				Zone:           "1b",
+				APIURL:         "https://10.0.1.1:2381/apis/v2",
+				GatewayAddress: "10.0.1.2:13012",
+			},
+			{
+				Name:           "eu-west-1a",
+				Region:         "eu-west",
+				Zone:           "1a",
+				APIURL:         "https://10.0.2.1:2381/apis/v2",
+				GatewayAddress: "10.0.2.2:13012",
+			},
+		},
+	}
+}
+
+func TestFederationValidate(t *testing.T) {
+	f := newTestFederation()
+	if err := f.Validate(); err != nil {
+		t.Errorf("federation validate failed: %v", err)
+	}
+
+	f.Peers[1].GatewayAddress = "10.0.2.2"
+	if err := f.Validate(); err == nil {
+		t.Errorf("federation validate should fail for gateway address without port")
+	}
+
+	f = newTestFederation()
+	f.Peers[1].Name = f.Peers[0].Name
+	if err := f.Validate(); err == nil {
+		t.Errorf("federation validate should fail for duplicated peers")
+	}
+
+	f = newTestFederation()
+	f.Peers[1].Name = f.ClusterName
+	if err := f.Validate(); err == nil {
+		t.Errorf("federation validate should fail for peer with the local cluster name")
+	}
+}
+
+func TestSplitFederationInstances(t *testing.T) {
+	f := newTestFederation()
+
+	instances := []*ServiceInstanceSpec{
+		{ServiceName: "order", InstanceID: "order-1", IP: "192.168.0.1", Port: 80, Status: ServiceStatusOutOfService},
+		f.FederationInstanceSpec(f.Peers[1], "order"),
+		f.FederationInstanceSpec(f.Peers[0], "order"),
+	}
+	if instances[1].IP != "10.0.2.2" || instances[1].Port != 13012 {
+		t.Errorf("federation instance should point to the gateway of the peer: %+v", instances[1])
+	}
+	if !IsFederationRegistryName(instances[1].RegistryName) {
+		t.Errorf("%s should be a federation registry name", instances[1].RegistryName)
+	}
+
+	local, remote := SplitFederationInstances(instances)
+	if len(local) != 1 || local[0].InstanceID != "order-1" {
+		t.Errorf("unexpected local instances: %+v", local)
+	}
+	// the peer in the same region is preferred.
+	if len(remote) != 1 || remote[0].Labels[FederationClusterLabel] != "us-east-1b" {
+		t.Errorf("unexpected remote instances: %+v", remote)
+	}
+
+	instances[2].Status = ServiceStatusOutOfService
+	_, remote = SplitFederationInstances(instances)
+	if len(remote) != 1 || remote[0].Labels[FederationClusterLabel] != "eu-west-1a" {
+		t.Errorf("traffic should fail over to the other region: %+v", remote)
+	}
+}
+
+func TestFederationGatewayHTTPServerSpec(t *testing.T) {
+	f := newTestFederation()
+
+	superSpec, err := FederationGatewayHTTPServerSpec(f, []*Service{{Name: "order"}, {Name: "delivery"}})
+	if err != nil {
+		t.Fatalf("federation gateway http server spec failed: %v", err)
+	}
+	config := superSpec.JSONConfig()
+	if !strings.Contains(config, FederationServiceHeaderKey) {
+		t.Errorf("gateway should route by header %s: %s", FederationServiceHeaderKey, config)
+	}
+
+	_, err = FederationGatewayHTTPServerSpec(f, nil)
+	if err != nil {
+		t.Fatalf("federation gateway http server spec without services failed: %v", err)
+	}
+}
+
+func TestSidecarEgressFederationPipelineSpec(t *testing.T) {
+	f := newTestFederation()
+	s := &Service{
+		Name: "order",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+	}
+
+	if _, err := s.SidecarEgressFederationPipelineSpec(nil, f); err == nil {
+		t.Errorf("federation pipeline spec should fail without instance")
+	}
+
+	instances := []*ServiceInstanceSpec{f.FederationInstanceSpec(f.Peers[0], "order")}
+	superSpec, err := s.SidecarEgressFederationPipelineSpec(instances, f)
+	if err != nil {
+		t.Fatalf("federation pipeline spec failed: %v", err)
+	}
+
+	config := superSpec.JSONConfig()
+	if !strings.Contains(config, "https://10.0.1.2:13012") {
+		t.Errorf("federation pipeline should send requests to the gateway of the peer: %s", config)
+	}
+	if !strings.Contains(config, FederationServiceHeaderKey) {
+		t.Errorf("federation pipeline should set header %s: %s", FederationServiceHeaderKey, config)
+	}
+}
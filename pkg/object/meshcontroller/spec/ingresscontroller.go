@@ -23,6 +23,7 @@ import (
 
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/spiffe"
 )
 
 // IngressControllerServerName returns the server name of ingress controller.
@@ -85,7 +86,7 @@ rules:`
 
 // IngressControllerPipelineSpec generates a spec for ingress controller pipeline spec.
 func (s *Service) IngressControllerPipelineSpec(instanceSpecs []*ServiceInstanceSpec,
-	canaries []*ServiceCanary, cert, rootCert *Certificate,
+	canaries []*ServiceCanary, cert, rootCert *Certificate, spiffeSpec *spiffe.Spec,
 ) (*supervisor.Spec, error) {
 	pipelineSpecBuilder := newPipelineSpecBuilder(s.IngressControllerPipelineName())
 
@@ -96,6 +97,7 @@ func (s *Service) IngressControllerPipelineSpec(instanceSpecs []*ServiceInstance
 		lb:            s.LoadBalance,
 		cert:          cert,
 		rootCert:      rootCert,
+		spiffe:        spiffeSpec,
 	})
 
 	jsonConfig := pipelineSpecBuilder.jsonConfig()
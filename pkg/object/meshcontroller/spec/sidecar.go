@@ -20,8 +20,11 @@ package spec
 import (
 	"fmt"
 
+	"github.com/megaease/easegress/pkg/filters/proxy"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/spiffe"
 )
 
 // SidecarEgressServerName returns egress HTTP server name
@@ -34,6 +37,12 @@ func (s *Service) SidecarEgressPipelineName() string {
 	return fmt.Sprintf("sidecar-egress-pipeline-%s", s.Name)
 }
 
+// SidecarEgressUpstreamServerName returns the egress HTTP server name of
+// the upstream service
+func (s *Service) SidecarEgressUpstreamServerName(upstream string) string {
+	return fmt.Sprintf("sidecar-egress-upstream-server-%s-%s", s.Name, upstream)
+}
+
 // SidecarIngressHTTPServerName returns the ingress server name
 func (s *Service) SidecarIngressHTTPServerName() string {
 	return fmt.Sprintf("sidecar-ingress-server-%s", s.Name)
@@ -81,9 +90,46 @@ https: false
 	return superSpec, nil
 }
 
+// SidecarEgressUpstreamHTTPServerSpec returns a spec for the egress HTTP
+// server of the upstream, which sends all requests to the egress pipeline
+// of the upstream service.
+func (s *Service) SidecarEgressUpstreamHTTPServerSpec(upstream *Upstream, pipelineName string,
+	keepalive bool, timeout string,
+) (*supervisor.Spec, error) {
+	upstreamHTTPServerFormat := `
+kind: HTTPServer
+name: %s
+port: %d
+keepAlive: %v
+keepAliveTimeout: %s
+https: false
+rules:
+  - paths:
+    - pathPrefix: /
+      backend: %s`
+
+	if timeout == "" {
+		timeout = defaultKeepAliveTimeout
+	}
+	yamlConfig := fmt.Sprintf(upstreamHTTPServerFormat,
+		s.SidecarEgressUpstreamServerName(upstream.Service),
+		upstream.Port,
+		keepalive,
+		timeout,
+		pipelineName)
+
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	if err != nil {
+		logger.Errorf("new spec for %s failed: %v", yamlConfig, err)
+		return nil, err
+	}
+
+	return superSpec, nil
+}
+
 // SidecarEgressPipelineSpec returns a spec for sidecar egress pipeline
 func (s *Service) SidecarEgressPipelineSpec(instanceSpecs []*ServiceInstanceSpec,
-	canaries []*ServiceCanary, appCert, rootCert *Certificate,
+	canaries []*ServiceCanary, appCert, rootCert *Certificate, spiffeSpec *spiffe.Spec,
 ) (*supervisor.Spec, error) {
 	if len(instanceSpecs) == 0 {
 		return nil, fmt.Errorf("no instance")
@@ -98,14 +144,17 @@ func (s *Service) SidecarEgressPipelineSpec(instanceSpecs []*ServiceInstanceSpec
 	}
 
 	var timeout string
+	var timeoutOverrides []*proxy.TimeoutOverride
 	var retryPolicy string
 	var circuitBreakerPolicy string
 	var failureCodes []int
+	var outlierDetection *proxy.OutlierDetectionSpec
 	if s.Resilience != nil {
 		pipelineSpecBuilder.appendRetry(s.Resilience.Retry)
 		pipelineSpecBuilder.appendCircuitBreaker(s.Resilience.CircuitBreaker)
 		if s.Resilience.TimeLimiter != nil {
 			timeout = s.Resilience.TimeLimiter.Timeout
+			timeoutOverrides = s.Resilience.TimeLimiter.Routes
 		}
 		if s.Resilience.Retry != nil {
 			retryPolicy = pipelineSpecBuilder.retryName
@@ -115,6 +164,7 @@ func (s *Service) SidecarEgressPipelineSpec(instanceSpecs []*ServiceInstanceSpec
 		}
 
 		failureCodes = s.Resilience.FailureCodes
+		outlierDetection = s.Resilience.OutlierEjection
 	}
 
 	pipelineSpecBuilder.appendProxyWithCanary(&proxyParam{
@@ -123,10 +173,13 @@ func (s *Service) SidecarEgressPipelineSpec(instanceSpecs []*ServiceInstanceSpec
 		lb:                   s.LoadBalance,
 		cert:                 appCert,
 		rootCert:             rootCert,
+		spiffe:               spiffeSpec,
 		timeout:              timeout,
+		timeoutOverrides:     timeoutOverrides,
 		retryPolicy:          retryPolicy,
 		circuitBreakerPolicy: circuitBreakerPolicy,
 		failureCodes:         failureCodes,
+		outlierDetection:     outlierDetection,
 	})
 
 	jsonConfig := pipelineSpecBuilder.jsonConfig()
@@ -141,7 +194,7 @@ func (s *Service) SidecarEgressPipelineSpec(instanceSpecs []*ServiceInstanceSpec
 
 // SidecarIngressHTTPServerSpec generates a spec for sidecar ingress HTTP server
 func (s *Service) SidecarIngressHTTPServerSpec(keepalive bool, timeout string,
-	cert, rootCert *Certificate,
+	cert, rootCert *Certificate, spiffeSpec *spiffe.Spec,
 ) (*supervisor.Spec, error) {
 	ingressHTTPServerFormat := `
 kind: HTTPServer
@@ -161,7 +214,10 @@ rules:
 	name := s.SidecarIngressHTTPServerName()
 	pipelineName := s.SidecarIngressPipelineName()
 	certBase64, keyBase64, rootCertBaser64, needHTTPS := "", "", "", "false"
-	if cert != nil && rootCert != nil {
+	if spiffeSpec != nil {
+		// the SVIDs are used instead of the certificates from the mesh.
+		needHTTPS = "true"
+	} else if cert != nil && rootCert != nil {
 		certBase64 = cert.CertBase64
 		keyBase64 = cert.KeyBase64
 		rootCertBaser64 = rootCert.CertBase64
@@ -174,6 +230,14 @@ rules:
 		s.Sidecar.IngressPort, keepalive, timeout, needHTTPS,
 		certBase64, keyBase64, rootCertBaser64, pipelineName)
 
+	if spiffeSpec != nil {
+		buff, err := codectool.MarshalJSON(spiffeSpec)
+		if err != nil {
+			return nil, err
+		}
+		yamlConfig += fmt.Sprintf("\nspiffe: %s", buff)
+	}
+
 	superSpec, err := supervisor.NewSpec(yamlConfig)
 	if err != nil {
 		logger.Errorf("new spec for %s failed: %v", yamlConfig, err)
@@ -188,17 +252,20 @@ func (s *Service) SidecarIngressPipelineSpec(applicationPort uint32) (*superviso
 	pipelineSpecBuilder := newPipelineSpecBuilder(s.SidecarIngressPipelineName())
 
 	var timeout string
+	var timeoutOverrides []*proxy.TimeoutOverride
 	if s.Resilience != nil {
 		pipelineSpecBuilder.appendRateLimiter(s.Resilience.RateLimiter)
 		if s.Resilience.TimeLimiter != nil {
 			timeout = s.Resilience.TimeLimiter.Timeout
+			timeoutOverrides = s.Resilience.TimeLimiter.Routes
 		}
 	}
 
 	pipelineSpecBuilder.appendProxyWithCanary(&proxyParam{
-		instanceSpecs: []*ServiceInstanceSpec{s.ApplicationInstanceSpec(applicationPort)},
-		lb:            s.LoadBalance,
-		timeout:       timeout,
+		instanceSpecs:    []*ServiceInstanceSpec{s.ApplicationInstanceSpec(applicationPort)},
+		lb:               s.LoadBalance,
+		timeout:          timeout,
+		timeoutOverrides: timeoutOverrides,
 	})
 
 	jsonConfig := pipelineSpecBuilder.jsonConfig()
@@ -26,6 +26,7 @@ import (
 	"github.com/megaease/easegress/pkg/filters/proxy"
 	"github.com/megaease/easegress/pkg/filters/ratelimiter"
 	"github.com/megaease/easegress/pkg/resilience"
+	"github.com/megaease/easegress/pkg/util/spiffe"
 	"github.com/megaease/easegress/pkg/util/urlrule"
 )
 
@@ -53,6 +54,16 @@ const (
 	// IngressPort is the default port for ingress controller
 	IngressPort = 13010
 
+	// ProbePort is the default port for worker's application probe server
+	ProbePort = 13011
+
+	// WorkloadJava is the workload running with the Java agent.
+	WorkloadJava = "java"
+
+	// WorkloadGeneric is the workload without the Java agent, e.g. written
+	// in Go, Node.js or Python.
+	WorkloadGeneric = "generic"
+
 	// HeartbeatInterval is the default heartbeat interval for checking service heartbeat
 	HeartbeatInterval = "5s"
 
@@ -68,6 +79,10 @@ const (
 	// CertProviderSelfSign is the in-memory, self-sign cert provider.
 	CertProviderSelfSign = "selfSign"
 
+	// CertProviderSPIFFE uses the X509-SVIDs from the SPIFFE Workload API,
+	// e.g. the SPIRE agent running on the same node.
+	CertProviderSPIFFE = "spiffe"
+
 	// IngressControllerName is the name of easemesh ingress controller.
 	IngressControllerName = "ingresscontroller"
 
@@ -128,12 +143,18 @@ type (
 
 		MonitorMTLS *MonitorMTLS `json:"monitorMTLS,omitempty" jsonschema:"omitempty"`
 		WorkerSpec  WorkerSpec   `json:"workerSpec" jsonschema:"omitempty"`
+
+		Federation *Federation `json:"federation,omitempty" jsonschema:"omitempty"`
 	}
 
 	// WorkerSpec is the spec of worker
 	WorkerSpec struct {
 		Ingress IngressServerSpec `json:"ingress" jsonschema:"omitempty"`
 		Egress  EgressServerSpec  `json:"egress" jsonschema:"omitempty"`
+
+		// ProbePort is the port for the probes of the application, which
+		// are rewritten to the worker.
+		ProbePort int `json:"probePort" jsonschema:"omitempty"`
 	}
 
 	// IngressServerSpec is the spec of ingress httpserver in worker
@@ -172,8 +193,11 @@ type (
 		MTLSMode     string `json:"mtlsMode" jsonschema:"required"`
 		CertProvider string `json:"certProvider" jsonschema:"required"`
 
-		RootCertTTL string `json:"rootCertTTL" jsonschema:"required,format=duration"`
-		AppCertTTL  string `json:"appCertTTL" jsonschema:"required,format=duration"`
+		// RootCertTTL and AppCertTTL are required by the selfSign provider.
+		RootCertTTL string `json:"rootCertTTL" jsonschema:"omitempty,format=duration"`
+		AppCertTTL  string `json:"appCertTTL" jsonschema:"omitempty,format=duration"`
+
+		SPIFFE *spiffe.Spec `json:"spiffe,omitempty" jsonschema:"omitempty"`
 	}
 
 	// Service contains the information of service.
@@ -206,11 +230,17 @@ type (
 		Retry          *resilience.RetryRule          `json:"retry,omitempty" jsonschema:"omitempty"`
 		TimeLimiter    *TimeLimiterRule               `json:"timeLimiter,omitempty" jsonschema:"omitempty"`
 		FailureCodes   []int                          `json:"failureCodes,omitempty" jsonschema:"required,uniqueItems=true"`
+
+		// OutlierEjection ejects the failing instances of the service from
+		// the load balancing of the sidecars calling it.
+		OutlierEjection *proxy.OutlierDetectionSpec `json:"outlierEjection,omitempty" jsonschema:"omitempty"`
 	}
 
 	// TimeLimiterRule is the spec of TimeLimiter.
 	TimeLimiterRule struct {
 		Timeout string `json:"timeout" jsonschema:"required,format=duration"`
+		// Routes override the timeout for the matched requests.
+		Routes []*proxy.TimeoutOverride `json:"routes,omitempty" jsonschema:"omitempty"`
 	}
 
 	// CanaryRule is one matching rule for canary.
@@ -247,6 +277,19 @@ type (
 		IngressProtocol string `json:"ingressProtocol" jsonschema:"required"`
 		EgressPort      int    `json:"egressPort" jsonschema:"required"`
 		EgressProtocol  string `json:"egressProtocol" jsonschema:"required"`
+
+		// Workload is java or generic, the default is java.
+		Workload string `json:"workload,omitempty" jsonschema:"omitempty"`
+		// Upstreams are local egress ports dedicated to services, so that
+		// applications without the Java agent can access the services
+		// without the header X-Mesh-Rpc-Service.
+		Upstreams []*Upstream `json:"upstreams,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Upstream is a local egress port dedicated to a service.
+	Upstream struct {
+		Service string `json:"service" jsonschema:"required"`
+		Port    int    `json:"port" jsonschema:"required,minimum=1,maximum=65535"`
 	}
 
 	// Observability is the spec of service observability.
@@ -462,6 +505,47 @@ func (sc ServiceCanary) Validate() error {
 	return nil
 }
 
+// Validate validates Sidecar.
+func (s *Sidecar) Validate() error {
+	switch s.Workload {
+	case "", WorkloadJava, WorkloadGeneric:
+	default:
+		return fmt.Errorf("unknown workload: %s", s.Workload)
+	}
+
+	services := map[string]struct{}{}
+	ports := map[int]struct{}{s.IngressPort: {}, s.EgressPort: {}}
+	for _, u := range s.Upstreams {
+		if _, ok := services[u.Service]; ok {
+			return fmt.Errorf("upstream service %s occurred multiple times", u.Service)
+		}
+		services[u.Service] = struct{}{}
+
+		if _, ok := ports[u.Port]; ok {
+			return fmt.Errorf("port %d of upstream service %s conflicts", u.Port, u.Service)
+		}
+		ports[u.Port] = struct{}{}
+	}
+
+	return nil
+}
+
+// GenericWorkload returns whether the workload runs without the Java agent.
+func (s *Sidecar) GenericWorkload() bool {
+	return s.Workload == WorkloadGeneric
+}
+
+// UpstreamPort returns the local egress port of the service, 0 if the
+// service is not an upstream.
+func (s *Sidecar) UpstreamPort(service string) int {
+	for _, u := range s.Upstreams {
+		if u.Service == service {
+			return u.Port
+		}
+	}
+	return 0
+}
+
 // Clone clones TrafficRules.
 func (tr *TrafficRules) Clone() *TrafficRules {
 	headers := map[string]*proxy.StringMatcher{}
@@ -486,6 +570,13 @@ func (a Admin) Validate() error {
 	if a.Security != nil {
 		switch a.Security.CertProvider {
 		case CertProviderSelfSign:
+		case CertProviderSPIFFE:
+			if a.Security.SPIFFE == nil {
+				return fmt.Errorf("spiffe is required by cert provider %s", CertProviderSPIFFE)
+			}
+			if err := a.Security.SPIFFE.Validate(); err != nil {
+				return fmt.Errorf("spiffe: %v", err)
+			}
 		default:
 			return fmt.Errorf("unknown mTLS cert provider type: %s", a.Security.CertProvider)
 		}
@@ -497,7 +588,7 @@ func (a Admin) Validate() error {
 		}
 	}
 
-	if a.EnablemTLS() {
+	if a.EnablemTLS() && !a.EnableSPIFFE() {
 		appCertTTL, err := time.ParseDuration(a.Security.AppCertTTL)
 		if err != nil {
 			return fmt.Errorf("parse appcertTTl: %s failed: %v", a.Security.AppCertTTL, err)
@@ -526,6 +617,12 @@ func (a Admin) Validate() error {
 		}
 	}
 
+	if a.Federation != nil {
+		if err := a.Federation.Validate(); err != nil {
+			return fmt.Errorf("federation: %v", err)
+		}
+	}
+
 	return nil
 }
 
@@ -537,6 +634,20 @@ func (a Admin) EnablemTLS() bool {
 	return false
 }
 
+// EnableSPIFFE indicates whether mTLS is enabled and the certificates are
+// from the SPIFFE Workload API instead of the mesh cert manager.
+func (a Admin) EnableSPIFFE() bool {
+	return a.EnablemTLS() && a.Security.CertProvider == CertProviderSPIFFE
+}
+
+// SPIFFESpec returns the SPIFFE spec if it is enabled, otherwise nil.
+func (a Admin) SPIFFESpec() *spiffe.Spec {
+	if !a.EnableSPIFFE() {
+		return nil
+	}
+	return a.Security.SPIFFE
+}
+
 // Key returns the key of ServiceInstanceSpec.
 func (s *ServiceInstanceSpec) Key() string {
 	return fmt.Sprintf("%s/%s/%s", s.RegistryName, s.ServiceName, s.InstanceID)
@@ -20,6 +20,7 @@ package spec
 import (
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/megaease/easegress/pkg/filters/mock"
@@ -29,6 +30,7 @@ import (
 	_ "github.com/megaease/easegress/pkg/object/httpserver"
 	"github.com/megaease/easegress/pkg/resilience"
 	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/spiffe"
 	"github.com/megaease/easegress/pkg/util/urlrule"
 	v2alpha1 "github.com/megaease/easemesh-api/v2alpha1"
 )
@@ -119,6 +121,34 @@ func TestAdminValidatmTLS(t *testing.T) {
 	}
 }
 
+func TestAdminValidatSPIFFE(t *testing.T) {
+	a := Admin{
+		RegistryType:      RegistryTypeNacos,
+		HeartbeatInterval: "10s",
+		Security: &Security{
+			MTLSMode:     SecurityLevelStrict,
+			CertProvider: CertProviderSPIFFE,
+		},
+	}
+
+	if err := a.Validate(); err == nil {
+		t.Errorf("admin SPIFFE without spiffe spec should invalid")
+	}
+
+	a.Security.SPIFFE = &spiffe.Spec{SocketPath: "unix:///run/spire/sockets/agent.sock"}
+	if err := a.Validate(); err != nil {
+		t.Errorf("admin SPIFFE should valid, err: %v", err)
+	}
+	if !a.EnableSPIFFE() || a.SPIFFESpec() == nil {
+		t.Errorf("SPIFFE should be enabled")
+	}
+
+	a.Security.MTLSMode = SecurityLevelPermissive
+	if a.EnableSPIFFE() || a.SPIFFESpec() != nil {
+		t.Errorf("SPIFFE should be disabled in permissive mode")
+	}
+}
+
 func TestAdminInValidatmTLS3(t *testing.T) {
 	a := Admin{
 		RegistryType:      RegistryTypeNacos,
@@ -247,11 +277,19 @@ func TestSidecarEgressPipelineSpec(t *testing.T) {
 		},
 	}
 
-	superSpec, err := s.SidecarEgressPipelineSpec(instances, canaries, nil, nil)
+	superSpec, err := s.SidecarEgressPipelineSpec(instances, canaries, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("generate sidecar egress pipeline failed: %v", err)
 	}
 	fmt.Println(superSpec.JSONConfig())
+
+	superSpec, err = s.SidecarEgressPipelineSpec(instances, canaries, nil, nil, &spiffe.Spec{})
+	if err != nil {
+		t.Fatalf("generate sidecar egress pipeline with spiffe failed: %v", err)
+	}
+	if !strings.Contains(superSpec.JSONConfig(), "https://") {
+		t.Errorf("servers should use https with spiffe")
+	}
 }
 
 func TestSidecarEgressPipelineWithCanarySpec(t *testing.T) {
@@ -299,7 +337,7 @@ func TestSidecarEgressPipelineWithCanarySpec(t *testing.T) {
 		},
 	}
 
-	superSpec, _ := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil)
+	superSpec, _ := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil, nil)
 	fmt.Println(superSpec.JSONConfig())
 }
 
@@ -333,7 +371,7 @@ func TestSidecarEgressPipelineSpecWithMock(t *testing.T) {
 	}
 
 	instanceSpecs := []*ServiceInstanceSpec{}
-	_, err := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil)
+	_, err := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil, nil)
 	if err == nil {
 		t.Fatalf("mocking service should failed: %v", err)
 	}
@@ -411,7 +449,7 @@ func TestSidecarEgressPipelneNotLoadBalancer(t *testing.T) {
 		},
 	}
 
-	superSpec, err := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil)
+	superSpec, err := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("sidecar egress pipeline spec gen failed: %v", err)
 	}
@@ -463,7 +501,7 @@ func TestSidecarEgressPipelineWithMultipleCanarySpec(t *testing.T) {
 		},
 	}
 
-	superSpec, _ := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil)
+	superSpec, _ := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil, nil)
 	fmt.Println(superSpec.JSONConfig())
 }
 
@@ -512,7 +550,7 @@ func TestSidecarEgressPipelineWithCanaryNoInstanceSpec(t *testing.T) {
 		},
 	}
 
-	superSpec, _ := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil)
+	superSpec, _ := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil, nil)
 	fmt.Println(superSpec.JSONConfig())
 }
 
@@ -562,7 +600,7 @@ func TestSidecarEgressPipelineWithCanaryInstanceMultipleLabelSpec(t *testing.T)
 		},
 	}
 
-	superSpec, _ := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil)
+	superSpec, _ := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil, nil)
 	fmt.Println(superSpec.JSONConfig())
 }
 
@@ -683,7 +721,7 @@ func TestSidecarEgressResiliencePipelineSpec(t *testing.T) {
 		},
 	}
 
-	superSpec, _ := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil)
+	superSpec, _ := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil, nil)
 	fmt.Println(superSpec.JSONConfig())
 }
 
@@ -779,7 +817,7 @@ func TestIngressPipelineSpec(t *testing.T) {
 		TTL:         "10h",
 		SignTime:    "2021-10-13 12:33:10",
 	}
-	superSpec, err := s.IngressControllerPipelineSpec(instanceSpecs, nil, cert, rootCert)
+	superSpec, err := s.IngressControllerPipelineSpec(instanceSpecs, nil, cert, rootCert, nil)
 	if err != nil {
 		t.Fatalf("%v", err)
 	}
@@ -816,7 +854,7 @@ func TestSidecarIngressPipelineSpecCert(t *testing.T) {
 		SignTime:    "2021-10-13 12:33:10",
 	}
 
-	superSpec, err := s.SidecarIngressHTTPServerSpec(false, defaultKeepAliveTimeout, cert, rootCert)
+	superSpec, err := s.SidecarIngressHTTPServerSpec(false, defaultKeepAliveTimeout, cert, rootCert, nil)
 	if err != nil {
 		t.Fatalf("ingress http server spec failed: %v", err)
 	}
@@ -846,12 +884,20 @@ func TestSidecarIngressPipelineSpec(t *testing.T) {
 		},
 	}
 
-	superSpec, err := s.SidecarIngressHTTPServerSpec(true, "", nil, nil)
+	superSpec, err := s.SidecarIngressHTTPServerSpec(true, "", nil, nil, nil)
 	if err != nil {
 		t.Fatalf("ingress http server spec failed: %v", err)
 	}
 	fmt.Println(superSpec.JSONConfig())
 
+	superSpec, err = s.SidecarIngressHTTPServerSpec(true, "", nil, nil, &spiffe.Spec{
+		AllowedIDs: []string{"spiffe://megaease.com/ns/default/sa/order"},
+	})
+	if err != nil {
+		t.Fatalf("ingress http server spec with spiffe failed: %v", err)
+	}
+	fmt.Println(superSpec.JSONConfig())
+
 	superSpec, err = s.SidecarEgressHTTPServerSpec(false, "")
 
 	if err != nil {
@@ -989,3 +1035,127 @@ func TestAppendMeshAdaptor(t *testing.T) {
 	buff, _ := codectool.MarshalJSON(b.Spec)
 	t.Logf("%s", buff)
 }
+
+func TestSidecarValidate(t *testing.T) {
+	s := &Sidecar{
+		Address:         "127.0.0.1",
+		IngressPort:     8080,
+		IngressProtocol: "http",
+		EgressPort:      9090,
+		EgressProtocol:  "http",
+	}
+	if err := s.Validate(); err != nil {
+		t.Errorf("sidecar validate failed: %v", err)
+	}
+	if s.GenericWorkload() {
+		t.Errorf("default workload should be java")
+	}
+
+	s.Workload = "ruby"
+	if err := s.Validate(); err == nil {
+		t.Errorf("sidecar validate should fail for unknown workload")
+	}
+
+	s.Workload = WorkloadGeneric
+	s.Upstreams = []*Upstream{{Service: "delivery-mesh", Port: 9091}}
+	if err := s.Validate(); err != nil {
+		t.Errorf("sidecar validate failed: %v", err)
+	}
+	if !s.GenericWorkload() {
+		t.Errorf("workload should be generic")
+	}
+	if port := s.UpstreamPort("delivery-mesh"); port != 9091 {
+		t.Errorf("upstream port should be 9091, but got %d", port)
+	}
+	if port := s.UpstreamPort("order-mesh"); port != 0 {
+		t.Errorf("upstream port should be 0, but got %d", port)
+	}
+
+	s.Upstreams = append(s.Upstreams, &Upstream{Service: "order-mesh", Port: 9090})
+	if err := s.Validate(); err == nil {
+		t.Errorf("sidecar validate should fail for port conflicting with egress port")
+	}
+
+	s.Upstreams[1] = &Upstream{Service: "delivery-mesh", Port: 9092}
+	if err := s.Validate(); err == nil {
+		t.Errorf("sidecar validate should fail for duplicated upstream service")
+	}
+}
+
+func TestSidecarEgressUpstreamHTTPServerSpec(t *testing.T) {
+	s := &Service{
+		Name: "order-001",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+			Workload:        WorkloadGeneric,
+		},
+	}
+
+	upstream := &Upstream{Service: "delivery-mesh", Port: 9091}
+	superSpec, err := s.SidecarEgressUpstreamHTTPServerSpec(upstream, "sidecar-egress-pipeline-delivery-mesh", true, "")
+	if err != nil {
+		t.Fatalf("egress upstream http server spec failed: %v", err)
+	}
+	if superSpec.Name() != s.SidecarEgressUpstreamServerName("delivery-mesh") {
+		t.Errorf("unexpected egress upstream http server name: %s", superSpec.Name())
+	}
+	fmt.Println(superSpec.JSONConfig())
+}
+
+func TestSidecarEgressTrafficPolicyPipelineSpec(t *testing.T) {
+	s := &Service{
+		Name: "order-001",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+
+		Resilience: &Resilience{
+			TimeLimiter: &TimeLimiterRule{
+				Timeout: "500ms",
+				Routes: []*proxy.TimeoutOverride{
+					{
+						MethodAndURLMatcher: proxy.MethodAndURLMatcher{
+							URL: &proxy.StringMatcher{Prefix: "/reports"},
+						},
+						Timeout: "5s",
+					},
+				},
+			},
+			OutlierEjection: &proxy.OutlierDetectionSpec{
+				ConsecutiveFailures: 3,
+				BaseEjectionTime:    "10s",
+			},
+		},
+	}
+
+	instanceSpecs := []*ServiceInstanceSpec{
+		{
+			ServiceName: "fake-001",
+			InstanceID:  "xxx-89757",
+			IP:          "192.168.0.110",
+			Port:        80,
+			Status:      "UP",
+		},
+	}
+
+	superSpec, err := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("egress pipeline spec failed: %v", err)
+	}
+
+	config := superSpec.JSONConfig()
+	if !strings.Contains(config, `"outlierDetection"`) {
+		t.Errorf("outlier detection is not compiled into the pipeline: %s", config)
+	}
+	if !strings.Contains(config, `"timeoutOverrides"`) {
+		t.Errorf("route timeouts are not compiled into the pipeline: %s", config)
+	}
+}
@@ -42,6 +42,9 @@ type (
 
 		pipelines  map[string]*supervisor.ObjectEntity
 		httpServer *supervisor.ObjectEntity
+		// upstreamServers are the HTTP servers of the upstreams, keyed by
+		// the upstream service name.
+		upstreamServers map[string]*supervisor.ObjectEntity
 
 		tc         *trafficcontroller.TrafficController
 		namespace  string
@@ -92,7 +95,8 @@ func NewEgressServer(superSpec *supervisor.Spec, super *supervisor.Supervisor,
 		service:     service,
 		instanceID:  instanceID,
 
-		chReloadEvent: make(chan struct{}, 1),
+		upstreamServers: make(map[string]*supervisor.ObjectEntity),
+		chReloadEvent:   make(chan struct{}, 1),
 	}
 }
 
@@ -149,7 +153,8 @@ func (egs *EgressServer) InitEgress(service *spec.Service) error {
 		}
 	}
 
-	if admSpec.EnablemTLS() {
+	// the SVIDs are rotated by the SPIFFE Workload API itself.
+	if admSpec.EnablemTLS() && !admSpec.EnableSPIFFE() {
 		logger.Infof("egress in mtls mode, start listen ID: %s's cert", egs.instanceID)
 		if err := egs.inf.OnServerCert(egs.serviceName, egs.instanceID, egs.reloadByCert); err != nil {
 			if err != informer.ErrAlreadyWatched {
@@ -404,6 +409,15 @@ func (egs *EgressServer) listServiceInstances(serviceName string) []*spec.Servic
 	return nil
 }
 
+func hasUpInstance(instances []*spec.ServiceInstanceSpec) bool {
+	for _, inst := range instances {
+		if inst.Status == spec.ServiceStatusUp {
+			return true
+		}
+	}
+	return false
+}
+
 func (egs *EgressServer) reload() {
 	lgSvcs := egs.listLocalAndGlobalServices()
 	tts := egs.listTrafficTargets(lgSvcs)
@@ -415,7 +429,7 @@ func (egs *EgressServer) reload() {
 
 	admSpec := egs.superSpec.ObjectSpec().(*spec.Admin)
 	var cert, rootCert *spec.Certificate
-	if admSpec.EnablemTLS() {
+	if admSpec.EnablemTLS() && !admSpec.EnableSPIFFE() {
 		cert = egs.service.GetServiceInstanceCert(egs.serviceName, egs.instanceID)
 		rootCert = egs.service.GetRootCert()
 		logger.Infof("egress enable TLS")
@@ -432,7 +446,15 @@ func (egs *EgressServer) reload() {
 			return
 		}
 
-		pipelineSpec, err := svc.SidecarEgressPipelineSpec(instances, canaries, cert, rootCert)
+		var pipelineSpec *supervisor.Spec
+		var err error
+		local, remote := spec.SplitFederationInstances(instances)
+		if admSpec.Federation != nil && len(remote) != 0 && !hasUpInstance(local) {
+			logger.Infof("service %s has no local instance in UP status, fail over to federation peers", svc.Name)
+			pipelineSpec, err = svc.SidecarEgressFederationPipelineSpec(remote, admSpec.Federation)
+		} else {
+			pipelineSpec, err = svc.SidecarEgressPipelineSpec(local, canaries, cert, rootCert, admSpec.SPIFFESpec())
+		}
 		if err != nil {
 			logger.Errorf("generate sidecar egress pipeline spec for service %s failed: %v", svc.Name, err)
 			return
@@ -535,6 +557,48 @@ func (egs *EgressServer) reload() {
 	// update local storage
 	egs.pipelines = pipelines
 	egs.httpServer = entity
+
+	egs.reloadUpstreams(serverName2PipelineName)
+}
+
+// reloadUpstreams creates or updates the HTTP servers of the upstreams
+// of the sidecar, and deletes the ones no longer needed.
+func (egs *EgressServer) reloadUpstreams(serverName2PipelineName map[string]string) {
+	self := egs.service.GetServiceSpec(egs.serviceName)
+	if self == nil {
+		return
+	}
+
+	admSpec := egs.superSpec.ObjectSpec().(*spec.Admin)
+	upstreamServers := make(map[string]*supervisor.ObjectEntity)
+	for _, upstream := range self.Sidecar.Upstreams {
+		pipelineName := serverName2PipelineName[upstream.Service]
+		if pipelineName == "" {
+			logger.Warnf("upstream service %s of service %s is not accessible", upstream.Service, egs.serviceName)
+			continue
+		}
+
+		superSpec, err := self.SidecarEgressUpstreamHTTPServerSpec(upstream, pipelineName,
+			admSpec.WorkerSpec.Egress.KeepAlive, admSpec.WorkerSpec.Egress.KeepAliveTimeout)
+		if err != nil {
+			logger.Errorf("generate upstream http server spec for service %s failed: %v", upstream.Service, err)
+			continue
+		}
+
+		entity, err := egs.tc.ApplyTrafficGateForSpec(egs.namespace, superSpec)
+		if err != nil {
+			logger.Errorf("apply upstream http server %s failed: %v", superSpec.Name(), err)
+			continue
+		}
+		upstreamServers[upstream.Service] = entity
+	}
+
+	for name, entity := range egs.upstreamServers {
+		if upstreamServers[name] == nil {
+			egs.tc.DeleteTrafficGate(egs.namespace, entity.Spec().Name())
+		}
+	}
+	egs.upstreamServers = upstreamServers
 }
 
 func (egs *EgressServer) watch() {
@@ -553,6 +617,9 @@ func (egs *EgressServer) Close() {
 
 	if egs._ready() {
 		egs.tc.DeleteTrafficGate(egs.namespace, egs.httpServer.Spec().Name())
+		for _, entity := range egs.upstreamServers {
+			egs.tc.DeleteTrafficGate(egs.namespace, entity.Spec().Name())
+		}
 		for _, entity := range egs.pipelines {
 			egs.tc.DeletePipeline(egs.namespace, entity.Spec().Name())
 		}
@@ -127,14 +127,14 @@ func (ings *IngressServer) InitIngress(service *spec.Service, port uint32) error
 	admSpec := ings.superSpec.ObjectSpec().(*spec.Admin)
 	if ings.httpServer == nil {
 		var cert, rootCert *spec.Certificate
-		if admSpec.EnablemTLS() {
+		if admSpec.EnablemTLS() && !admSpec.EnableSPIFFE() {
 			cert = ings.service.GetServiceInstanceCert(ings.serviceName, ings.instanceID)
 			rootCert = ings.service.GetRootCert()
 			logger.Infof("ingress enable TLS, init httpserver with cert: %#v", cert)
 		}
 
 		superSpec, err := service.SidecarIngressHTTPServerSpec(admSpec.WorkerSpec.Ingress.KeepAlive,
-			admSpec.WorkerSpec.Ingress.KeepAliveTimeout, cert, rootCert)
+			admSpec.WorkerSpec.Ingress.KeepAliveTimeout, cert, rootCert, admSpec.SPIFFESpec())
 		if err != nil {
 			return err
 		}
@@ -154,7 +154,8 @@ func (ings *IngressServer) InitIngress(service *spec.Service, port uint32) error
 		}
 	}
 
-	if admSpec.EnablemTLS() {
+	// the SVIDs are rotated by the SPIFFE Workload API itself.
+	if admSpec.EnablemTLS() && !admSpec.EnableSPIFFE() {
 		logger.Infof("ingress in mtls mode, start listen ID: %s's cert", ings.instanceID)
 		if err := ings.inf.OnServerCert(ings.serviceName, ings.instanceID, ings.reloadHTTPServer); err != nil {
 			if err != informer.ErrAlreadyWatched {
@@ -183,7 +184,7 @@ func (ings *IngressServer) reloadHTTPServer(event informer.Event, value *spec.Ce
 	}
 	admSpec := ings.superSpec.ObjectSpec().(*spec.Admin)
 	rootCert := ings.service.GetRootCert()
-	superSpec, err := serviceSpec.SidecarIngressHTTPServerSpec(admSpec.WorkerSpec.Ingress.KeepAlive, admSpec.WorkerSpec.Ingress.KeepAliveTimeout, value, rootCert)
+	superSpec, err := serviceSpec.SidecarIngressHTTPServerSpec(admSpec.WorkerSpec.Ingress.KeepAlive, admSpec.WorkerSpec.Ingress.KeepAliveTimeout, value, rootCert, nil)
 	if err != nil {
 		logger.Errorf("BUG: update ingress pipeline spec: %s new super spec failed: %v",
 			superSpec.JSONConfig(), err)
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	// appProbePrefix is the url prefix of the rewritten application probes.
+	appProbePrefix = "/app-health"
+
+	appProbeTimeout = 5 * time.Second
+)
+
+type (
+	// probeServer serves the application probes rewritten to the worker,
+	// so that the probes of kubelet reach the application even when the
+	// ingress of the sidecar requires mTLS.
+	probeServer struct {
+		srv    http.Server
+		client *http.Client
+		probes map[string]string
+	}
+)
+
+// decodeAppProbes decodes probes in the format of name1=url1,name2=url2.
+func decodeAppProbes(probesStr string) map[string]string {
+	probes := make(map[string]string)
+	if len(probesStr) == 0 {
+		return probes
+	}
+
+	for _, v := range strings.Split(probesStr, ",") {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 {
+			logger.Errorf("%s: invalid app probe: %s", probesStr, v)
+			continue
+		}
+		if _, err := url.ParseRequestURI(kv[1]); err != nil {
+			logger.Errorf("parse app probe %s to url failed: %v", kv[1], err)
+			continue
+		}
+		probes[kv[0]] = kv[1]
+	}
+
+	return probes
+}
+
+// newProbeServer creates a probe server, it returns nil if there's no
+// application probe.
+func newProbeServer(port int, probes map[string]string) *probeServer {
+	if len(probes) == 0 {
+		return nil
+	}
+
+	r := chi.NewRouter()
+	s := &probeServer{
+		// the probes come from kubelet, so listen on all interfaces.
+		srv:    http.Server{Addr: fmt.Sprintf(":%d", port), Handler: r},
+		client: &http.Client{Timeout: appProbeTimeout},
+		probes: probes,
+	}
+
+	r.Use(newRecoverer)
+	r.Get(appProbePrefix+"/{name}", s.probe)
+
+	go func() {
+		logger.Infof("probe server running in %d", port)
+		if err := s.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Errorf("probe server failed: %v", err)
+		}
+	}()
+
+	return s
+}
+
+func (s *probeServer) probe(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	probeURL, ok := s.probes[name]
+	if !ok {
+		handleAPIError(w, r, http.StatusNotFound, fmt.Errorf("app probe %s not found", name))
+		return
+	}
+
+	resp, err := s.client.Get(probeURL)
+	if err != nil {
+		handleAPIError(w, r, http.StatusServiceUnavailable, fmt.Errorf("app probe %s failed: %v", name, err))
+		return
+	}
+	defer resp.Body.Close()
+
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// Close closes the probe server.
+func (s *probeServer) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), appProbeTimeout)
+	defer cancel()
+
+	if err := s.srv.Shutdown(ctx); err != nil {
+		logger.Errorf("shutdown probe server failed: %v", err)
+	}
+}
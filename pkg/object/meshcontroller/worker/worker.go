@@ -72,6 +72,7 @@ type (
 		egressServer         *EgressServer
 		observabilityManager *ObservabilityManager
 		apiServer            *apiServer
+		probeServer          *probeServer
 
 		done chan struct{}
 	}
@@ -124,6 +125,12 @@ func New(superSpec *supervisor.Spec) *Worker {
 	observabilityManager := NewObservabilityServer(serviceName)
 	apiServer := newAPIServer(_spec.APIPort)
 
+	probePort := _spec.WorkerSpec.ProbePort
+	if probePort == 0 {
+		probePort = spec.ProbePort
+	}
+	probeServer := newProbeServer(probePort, decodeAppProbes(super.Options().Labels[label.KeyAppProbes]))
+
 	worker := &Worker{
 		super:     super,
 		superSpec: superSpec,
@@ -145,6 +152,7 @@ func New(superSpec *supervisor.Spec) *Worker {
 		egressServer:         egressServer,
 		observabilityManager: observabilityManager,
 		apiServer:            apiServer,
+		probeServer:          probeServer,
 
 		done: make(chan struct{}),
 	}
@@ -289,9 +297,13 @@ func (worker *Worker) updateAgentConfig() {
 			return string(result)
 		}
 
-		agentConfig := &jmxtool.AgentConfig{}
-
 		serviceSpec := worker.service.GetServiceSpec(worker.serviceName)
+		// only the Java workload runs the agent.
+		if serviceSpec == nil || serviceSpec.Sidecar.GenericWorkload() {
+			return
+		}
+
+		agentConfig := &jmxtool.AgentConfig{}
 		agentConfig.Service = *serviceSpec
 
 		canaries := worker.service.ListServiceCanaries()
@@ -424,4 +436,7 @@ func (worker *Worker) Close() {
 	worker.ingressServer.Close()
 	worker.registryServer.Close()
 	worker.apiServer.Close()
+	if worker.probeServer != nil {
+		worker.probeServer.Close()
+	}
 }
@@ -0,0 +1,249 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqttproxy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// ACLAllow allows the action on the topics.
+	ACLAllow = "allow"
+	// ACLDeny denies the action on the topics.
+	ACLDeny = "deny"
+
+	// ACLPublish is the action of publishing to topics.
+	ACLPublish = "publish"
+	// ACLSubscribe is the action of subscribing topics.
+	ACLSubscribe = "subscribe"
+	// ACLAll is both publish and subscribe.
+	ACLAll = "all"
+
+	defaultACLReloadInterval = 5 * time.Second
+)
+
+type (
+	// ACLRule is a topic access rule of clients, it is stored in the
+	// cluster and managed by the admin API.
+	// clientID/username: the client the rule applies to, empty means any.
+	// action: publish, subscribe or all, default all.
+	// topics: topic filters, %c and %u are replaced by the client ID and
+	// username of the client.
+	// permission: allow or deny.
+	// priority: rules with smaller priority are checked first.
+	ACLRule struct {
+		Name       string   `json:"name" jsonschema:"required"`
+		ClientID   string   `json:"clientID" jsonschema:"omitempty"`
+		Username   string   `json:"username" jsonschema:"omitempty"`
+		Action     string   `json:"action" jsonschema:"omitempty,enum=,enum=publish,enum=subscribe,enum=all"`
+		Topics     []string `json:"topics" jsonschema:"required"`
+		Permission string   `json:"permission" jsonschema:"required,enum=allow,enum=deny"`
+		Priority   int      `json:"priority" jsonschema:"omitempty"`
+	}
+
+	// aclManager checks the topic permissions of clients by the rules
+	// stored in the cluster, the rules are reloaded periodically so that
+	// changes made on other members take effect.
+	aclManager struct {
+		sync.RWMutex
+		name   string
+		store  storage
+		spec   *ACLSpec
+		rules  []*ACLRule
+		done   chan struct{}
+		ticker *time.Ticker
+	}
+)
+
+// Validate validates the ACLRule.
+func (r *ACLRule) Validate() error {
+	if r.Name == "" || strings.Contains(r.Name, "/") {
+		return fmt.Errorf("invalid rule name %q", r.Name)
+	}
+	switch r.Action {
+	case "", ACLPublish, ACLSubscribe, ACLAll:
+	default:
+		return fmt.Errorf("invalid action %q", r.Action)
+	}
+	if r.Permission != ACLAllow && r.Permission != ACLDeny {
+		return fmt.Errorf("invalid permission %q", r.Permission)
+	}
+	if len(r.Topics) == 0 {
+		return fmt.Errorf("topics of rule %s is empty", r.Name)
+	}
+	for _, t := range r.Topics {
+		if _, ok := splitTopic(t); !ok {
+			return fmt.Errorf("invalid topic filter %q", t)
+		}
+	}
+	return nil
+}
+
+func (r *ACLRule) matchClient(c *Client) bool {
+	if r.ClientID != "" && r.ClientID != c.info.cid {
+		return false
+	}
+	if r.Username != "" && r.Username != c.info.username {
+		return false
+	}
+	return true
+}
+
+func (r *ACLRule) matchAction(action string) bool {
+	return r.Action == "" || r.Action == ACLAll || r.Action == action
+}
+
+func newACLManager(name string, store storage, spec *ACLSpec) *aclManager {
+	am := &aclManager{
+		name:   name,
+		store:  store,
+		spec:   spec,
+		done:   make(chan struct{}),
+		ticker: time.NewTicker(defaultACLReloadInterval),
+	}
+	am.reload()
+	go am.run()
+	return am
+}
+
+func (am *aclManager) run() {
+	for {
+		select {
+		case <-am.done:
+			return
+		case <-am.ticker.C:
+			am.reload()
+		}
+	}
+}
+
+func (am *aclManager) close() {
+	am.ticker.Stop()
+	close(am.done)
+}
+
+// reload loads the rules from the cluster, the previous rules are kept if
+// loading failed.
+func (am *aclManager) reload() {
+	kvs, err := am.store.getPrefix(aclStoreKey(am.name, ""), false)
+	if err != nil {
+		logger.SpanErrorf(nil, "get acl rules of %s failed: %v", am.name, err)
+		return
+	}
+
+	rules := make([]*ACLRule, 0, len(kvs))
+	for key, value := range kvs {
+		rule := &ACLRule{}
+		if err := codectool.Unmarshal([]byte(value), rule); err != nil {
+			logger.SpanErrorf(nil, "decode acl rule %s failed: %v", key, err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority < rules[j].Priority
+		}
+		return rules[i].Name < rules[j].Name
+	})
+
+	am.Lock()
+	am.rules = rules
+	am.Unlock()
+}
+
+func (am *aclManager) list() []*ACLRule {
+	am.RLock()
+	defer am.RUnlock()
+	return am.rules
+}
+
+func (am *aclManager) put(rule *ACLRule) error {
+	data, err := codectool.MarshalJSON(rule)
+	if err != nil {
+		return err
+	}
+	if err = am.store.put(aclStoreKey(am.name, rule.Name), string(data)); err != nil {
+		return err
+	}
+	am.reload()
+	return nil
+}
+
+func (am *aclManager) delete(name string) error {
+	if err := am.store.delete(aclStoreKey(am.name, name)); err != nil {
+		return err
+	}
+	am.reload()
+	return nil
+}
+
+// allowed checks whether client could do action on topic, the first rule
+// matching the client, action and topic decides the result. For subscribe,
+// topic is a topic filter, and it matches a rule only if all the topics
+// it matches are covered by the rule.
+func (am *aclManager) allowed(c *Client, action, topic string) bool {
+	if action == ACLSubscribe {
+		_, topic, _ = parseSharedTopic(topic)
+	}
+	levels, ok := splitTopic(topic)
+	if !ok {
+		return false
+	}
+
+	am.RLock()
+	defer am.RUnlock()
+	for _, rule := range am.rules {
+		if !rule.matchClient(c) || !rule.matchAction(action) {
+			continue
+		}
+		for _, t := range rule.Topics {
+			t = strings.ReplaceAll(t, "%c", c.info.cid)
+			t = strings.ReplaceAll(t, "%u", c.info.username)
+			ruleLevels, ok := splitTopic(t)
+			if ok && coverTopic(ruleLevels, levels) {
+				return rule.Permission == ACLAllow
+			}
+		}
+	}
+	return am.spec.DefaultPermission != ACLDeny
+}
+
+// coverTopic checks whether the topics matched by filter are all matched
+// by rule, both are the levels of topic filters.
+func coverTopic(rule, filter []string) bool {
+	for i, level := range rule {
+		if level == "#" {
+			return true
+		}
+		if i >= len(filter) || filter[i] == "#" {
+			return false
+		}
+		if level != "+" && level != filter[i] {
+			return false
+		}
+	}
+	return len(rule) == len(filter)
+}
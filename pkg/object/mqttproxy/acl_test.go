@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqttproxy
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/go-chi/chi/v5"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoverTopic(t *testing.T) {
+	assert := assert.New(t)
+
+	cover := func(rule, filter string) bool {
+		r, ok := splitTopic(rule)
+		assert.True(ok)
+		f, ok := splitTopic(filter)
+		assert.True(ok)
+		return coverTopic(r, f)
+	}
+	assert.True(cover("a/b", "a/b"))
+	assert.True(cover("a/+", "a/b"))
+	assert.True(cover("a/+", "a/+"))
+	assert.True(cover("a/#", "a/b/c"))
+	assert.True(cover("a/#", "a/#"))
+	assert.True(cover("#", "a/+/c"))
+	assert.False(cover("a/b", "a/+"))
+	assert.False(cover("a/+", "a/#"))
+	assert.False(cover("a/+", "a/b/c"))
+	assert.False(cover("a/b/c", "a/b"))
+}
+
+func TestACLManager(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newStorage(nil)
+	am := newACLManager("test", store, &ACLSpec{DefaultPermission: ACLDeny})
+	defer am.close()
+
+	rules := []*ACLRule{
+		{Name: "own", Topics: []string{"devices/%c/#"}, Permission: ACLAllow},
+		{Name: "tenant", Username: "tenant1", Action: ACLSubscribe, Topics: []string{"tenant1/+/status"}, Permission: ACLAllow},
+		{Name: "readonly", ClientID: "c2", Action: ACLPublish, Topics: []string{"#"}, Permission: ACLDeny, Priority: -1},
+	}
+	for _, r := range rules {
+		assert.Nil(r.Validate())
+		assert.Nil(am.put(r))
+	}
+	assert.Len(am.list(), 3)
+	assert.Equal("readonly", am.list()[0].Name)
+
+	newTestClient := func(cid, username string) *Client {
+		connect := packets.NewControlPacket(packets.Connect).(*packets.ConnectPacket)
+		connect.ClientIdentifier = cid
+		connect.Username = username
+		return newClient(connect, nil, nil, nil)
+	}
+	c1 := newTestClient("c1", "tenant1")
+	c2 := newTestClient("c2", "tenant2")
+
+	assert.True(am.allowed(c1, ACLPublish, "devices/c1/temp"))
+	assert.True(am.allowed(c1, ACLSubscribe, "devices/c1/+"))
+	assert.False(am.allowed(c1, ACLPublish, "devices/c2/temp"))
+	assert.False(am.allowed(c1, ACLSubscribe, "devices/+/temp"))
+	assert.True(am.allowed(c1, ACLSubscribe, "tenant1/+/status"))
+	assert.True(am.allowed(c1, ACLSubscribe, "$share/g/tenant1/d1/status"))
+	assert.False(am.allowed(c1, ACLPublish, "tenant1/d1/status"))
+	assert.False(am.allowed(c2, ACLSubscribe, "tenant1/d1/status"))
+	assert.False(am.allowed(c2, ACLPublish, "devices/c2/temp"))
+	assert.True(am.allowed(c2, ACLSubscribe, "devices/c2/temp"))
+
+	assert.Nil(am.delete("readonly"))
+	assert.True(am.allowed(c2, ACLPublish, "devices/c2/temp"))
+
+	// rules written by other members are loaded when reloading
+	data, _ := codectool.MarshalJSON(&ACLRule{Name: "all", Topics: []string{"#"}, Permission: ACLAllow, Priority: 10})
+	store.put(aclStoreKey("test", "all"), string(data))
+	am.reload()
+	assert.True(am.allowed(c2, ACLPublish, "any/topic"))
+
+	assert.NotNil((&ACLRule{Name: "a", Topics: []string{"a/#/b"}, Permission: ACLAllow}).Validate())
+	assert.NotNil((&ACLRule{Name: "a", Topics: []string{"a"}, Permission: "unknown"}).Validate())
+	assert.NotNil((&ACLRule{Name: "a/b", Topics: []string{"a"}, Permission: ACLAllow}).Validate())
+}
+
+func TestACLBroker(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{
+		Name:              "test-acl",
+		EGName:            "test-acl",
+		Port:              1888,
+		ACL:               &ACLSpec{DefaultPermission: ACLDeny},
+		TopicAliasMaximum: 10,
+	}
+	broker := getBrokerFromSpec(spec, nil)
+	assert.NotNil(broker)
+	defer broker.close()
+
+	rule := &ACLRule{Name: "sensors", Topics: []string{"sensor/#"}, Permission: ACLAllow}
+	body, _ := codectool.MarshalJSON(rule)
+	w := httptest.NewRecorder()
+	broker.httpPutACLHandler(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+	assert.Equal(http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	broker.httpPutACLHandler(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{"name": "bad"}`))))
+	assert.Equal(http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	broker.httpListACLHandler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(http.StatusOK, w.Code)
+	var rules []*ACLRule
+	assert.Nil(codectool.Unmarshal(w.Body.Bytes(), &rules))
+	assert.Equal([]*ACLRule{rule}, rules)
+
+	svcConn, clientConn := net.Pipe()
+	go broker.handleConn(svcConn)
+	defer clientConn.Close()
+
+	go clientConn.Write(encodeConnectV5("cid", true, nil))
+	header, _, err := readRawPacket(clientConn)
+	assert.Nil(err)
+	assert.Equal(byte(packets.Connack), header>>4)
+
+	go clientConn.Write(encodeSubscribeV5(1, []string{"sensor/+", "admin/#"}, []byte{1, 1}))
+	header, data, err := readRawPacket(clientConn)
+	assert.Nil(err)
+	assert.Equal(byte(packets.Suback), header>>4)
+	// message id, empty properties and reason codes
+	assert.Equal([]byte{1, reasonNotAuthorized}, data[3:])
+
+	go clientConn.Write(encodePublishV5(t, "admin/cmd", 2, 1))
+	header, data, err = readRawPacket(clientConn)
+	assert.Nil(err)
+	assert.Equal(byte(packets.Puback), header>>4)
+	assert.Equal([]byte{0, 2, reasonNotAuthorized}, data[:3])
+
+	req := httptest.NewRequest(http.MethodDelete, "/", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("rule", "sensors")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w = httptest.NewRecorder()
+	broker.httpDeleteACLHandler(w, req)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.False(broker.allowed(broker.getClient("cid"), ACLSubscribe, "sensor/1"))
+}
@@ -0,0 +1,218 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqttproxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	bridgeIn  = "in"
+	bridgeOut = "out"
+
+	defaultBridgeMaxReconnectInterval = time.Minute
+)
+
+type (
+	// bridge connects an external MQTT broker, it subscribes the topics
+	// bridged in and delivers the messages to local clients, and publishes
+	// the messages of local clients bridged out to the external broker.
+	bridge struct {
+		broker *Broker
+		spec   *BridgeSpec
+		client paho.Client
+		topics []*bridgeTopic
+	}
+
+	bridgeTopic struct {
+		*BridgeTopic
+		levels []string
+	}
+)
+
+// Validate validates the BridgeSpec.
+func (s *BridgeSpec) Validate() error {
+	if s.MaxReconnectInterval != "" {
+		if _, err := time.ParseDuration(s.MaxReconnectInterval); err != nil {
+			return fmt.Errorf("invalid maxReconnectInterval: %v", err)
+		}
+	}
+	return nil
+}
+
+// Validate validates the BridgeTLSSpec.
+func (s *BridgeTLSSpec) Validate() error {
+	if (s.CertBase64 == "") != (s.KeyBase64 == "") {
+		return fmt.Errorf("certBase64 and keyBase64 must be both empty or both not empty")
+	}
+
+	_, err := s.tlsConfig()
+	return err
+}
+
+func (s *BridgeTLSSpec) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: s.InsecureSkipVerify}
+
+	if s.CertBase64 != "" {
+		certPem, _ := base64.StdEncoding.DecodeString(s.CertBase64)
+		keyPem, _ := base64.StdEncoding.DecodeString(s.KeyBase64)
+		cert, err := tls.X509KeyPair(certPem, keyPem)
+		if err != nil {
+			return nil, fmt.Errorf("generate x509 key pair failed: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if s.RootCertBase64 != "" {
+		rootCertPem, _ := base64.StdEncoding.DecodeString(s.RootCertBase64)
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(rootCertPem) {
+			return nil, fmt.Errorf("no valid certificate found in rootCertBase64")
+		}
+		cfg.RootCAs = pool
+	}
+
+	return cfg, nil
+}
+
+// Validate validates the BridgeTopic.
+func (t *BridgeTopic) Validate() error {
+	if _, ok := splitTopic(t.Filter); !ok {
+		return fmt.Errorf("invalid topic filter %q", t.Filter)
+	}
+	if strings.ContainsAny(t.LocalPrefix+t.RemotePrefix, "+#") {
+		return fmt.Errorf("wildcards are not allowed in topic prefixes")
+	}
+	return nil
+}
+
+func newBridge(b *Broker, spec *BridgeSpec) (*bridge, error) {
+	br := &bridge{broker: b, spec: spec}
+	for _, t := range spec.Topics {
+		levels, _ := splitTopic(t.Filter)
+		br.topics = append(br.topics, &bridgeTopic{BridgeTopic: t, levels: levels})
+	}
+
+	clientID := spec.ClientID
+	if clientID == "" {
+		clientID = fmt.Sprintf("%s-%s-%s", b.egName, b.name, spec.Name)
+	}
+	maxReconnectInterval := defaultBridgeMaxReconnectInterval
+	if spec.MaxReconnectInterval != "" {
+		maxReconnectInterval, _ = time.ParseDuration(spec.MaxReconnectInterval)
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(spec.Server).
+		SetClientID(clientID).
+		SetUsername(spec.Username).
+		SetPassword(spec.Password).
+		SetCleanSession(spec.CleanSession).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(time.Second).
+		SetMaxReconnectInterval(maxReconnectInterval).
+		SetOnConnectHandler(br.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			logger.Warnf("bridge %s of %s lost connection to %s: %v", spec.Name, b.name, spec.Server, err)
+		})
+	if spec.KeepAlive > 0 {
+		opts.SetKeepAlive(time.Duration(spec.KeepAlive) * time.Second)
+	}
+	if spec.TLS != nil {
+		cfg, err := spec.TLS.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(cfg)
+	}
+
+	br.client = paho.NewClient(opts)
+	// the client keeps retrying until connected, so don't wait here.
+	br.client.Connect()
+	return br, nil
+}
+
+// onConnect subscribes the topics bridged in, it is called on every
+// (re)connection.
+func (br *bridge) onConnect(client paho.Client) {
+	logger.Infof("bridge %s of %s connected to %s", br.spec.Name, br.broker.name, br.spec.Server)
+	for _, t := range br.topics {
+		if t.Direction == bridgeOut {
+			continue
+		}
+		filter := t.RemotePrefix + t.Filter
+		token := client.Subscribe(filter, byte(t.QoS), br.messageHandler(t))
+		go func() {
+			if token.Wait() && token.Error() != nil {
+				logger.Errorf("bridge %s of %s subscribe %s failed: %v", br.spec.Name, br.broker.name, filter, token.Error())
+			}
+		}()
+	}
+}
+
+func (br *bridge) messageHandler(t *bridgeTopic) paho.MessageHandler {
+	return func(_ paho.Client, msg paho.Message) {
+		topic := t.LocalPrefix + strings.TrimPrefix(msg.Topic(), t.RemotePrefix)
+		qos := msg.Qos()
+		if qos > byte(t.QoS) {
+			qos = byte(t.QoS)
+		}
+		logger.SpanDebugf(nil, "bridge %s receive message of %s as %s", br.spec.Name, msg.Topic(), topic)
+		br.broker.sendMsgToClient(nil, topic, msg.Payload(), qos)
+	}
+}
+
+// forward publishes the message of a local client to the external broker
+// if the topic is bridged out. Messages are dropped when the bridge is not
+// connected.
+func (br *bridge) forward(topic string, payload []byte, qos byte) {
+	for _, t := range br.topics {
+		if t.Direction == bridgeIn || !strings.HasPrefix(topic, t.LocalPrefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(topic, t.LocalPrefix)
+		if !matchTopic(t.levels, rest) {
+			continue
+		}
+
+		if !br.client.IsConnectionOpen() {
+			logger.SpanDebugf(nil, "bridge %s not connected, drop message of %s", br.spec.Name, topic)
+			return
+		}
+		if qos > byte(t.QoS) {
+			qos = byte(t.QoS)
+		}
+		// the publishing is asynchronous, the message is lost if the
+		// connection is lost before it is sent.
+		br.client.Publish(t.RemotePrefix+rest, qos, false, payload)
+		return
+	}
+}
+
+func (br *bridge) close() {
+	br.client.Disconnect(250)
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqttproxy
+
+import (
+	"net"
+	"testing"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBridgeTopicValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil((&BridgeTopic{Direction: bridgeIn, Filter: "a/#", RemotePrefix: "b/"}).Validate())
+	assert.NotNil((&BridgeTopic{Direction: bridgeIn, Filter: "a/#/b"}).Validate())
+	assert.NotNil((&BridgeTopic{Direction: bridgeOut, Filter: "a", LocalPrefix: "+/"}).Validate())
+	assert.NotNil((&BridgeSpec{MaxReconnectInterval: "1x"}).Validate())
+	assert.NotNil((&BridgeTLSSpec{CertBase64: "YQ=="}).Validate())
+}
+
+func TestBridge(t *testing.T) {
+	assert := assert.New(t)
+
+	// a fake external broker
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	defer ln.Close()
+
+	spec := &Spec{
+		Name:   "test-bridge",
+		EGName: "test-bridge",
+		Port:   1889,
+		Bridges: []*BridgeSpec{{
+			Name:   "cloud",
+			Server: "tcp://" + ln.Addr().String(),
+			Topics: []*BridgeTopic{
+				{Direction: bridgeIn, Filter: "#", LocalPrefix: "edge/", RemotePrefix: "cloud/", QoS: 1},
+				{Direction: bridgeOut, Filter: "+/temp", LocalPrefix: "edge/", RemotePrefix: "up/"},
+			},
+		}},
+	}
+	broker := getBrokerFromSpec(spec, nil)
+	assert.NotNil(broker)
+	defer broker.close()
+
+	remote, err := ln.Accept()
+	assert.Nil(err)
+	defer remote.Close()
+	p, err := packets.ReadPacket(remote)
+	assert.Nil(err)
+	assert.Equal("test-bridge-test-bridge-cloud", p.(*packets.ConnectPacket).ClientIdentifier)
+	assert.Nil(packets.NewControlPacket(packets.Connack).Write(remote))
+
+	p, err = packets.ReadPacket(remote)
+	assert.Nil(err)
+	subscribe := p.(*packets.SubscribePacket)
+	assert.Equal([]string{"cloud/#"}, subscribe.Topics)
+	assert.Equal([]byte{1}, subscribe.Qoss)
+	suback := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+	suback.MessageID = subscribe.MessageID
+	suback.ReturnCodes = []byte{1}
+	assert.Nil(suback.Write(remote))
+
+	// a local client subscribes the topics bridged in
+	svcConn, clientConn := net.Pipe()
+	go broker.handleConn(svcConn)
+	defer clientConn.Close()
+
+	connect := packets.NewControlPacket(packets.Connect).(*packets.ConnectPacket)
+	connect.ProtocolName = "MQTT"
+	connect.ProtocolVersion = 4
+	connect.ClientIdentifier = "local"
+	connect.CleanSession = true
+	go connect.Write(clientConn)
+	p, err = packets.ReadPacket(clientConn)
+	assert.Nil(err)
+	assert.IsType(&packets.ConnackPacket{}, p)
+
+	sub := packets.NewControlPacket(packets.Subscribe).(*packets.SubscribePacket)
+	sub.MessageID = 1
+	sub.Topics = []string{"edge/#"}
+	sub.Qoss = []byte{1}
+	go sub.Write(clientConn)
+	p, err = packets.ReadPacket(clientConn)
+	assert.Nil(err)
+	assert.IsType(&packets.SubackPacket{}, p)
+
+	// messages from the external broker are delivered to local clients
+	publish := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	publish.TopicName = "cloud/d1/cmd"
+	publish.Qos = QoS1
+	publish.MessageID = 5
+	publish.Payload = []byte("reboot")
+	assert.Nil(publish.Write(remote))
+	p, err = packets.ReadPacket(clientConn)
+	assert.Nil(err)
+	assert.Equal("edge/d1/cmd", p.(*packets.PublishPacket).TopicName)
+	assert.Equal("reboot", string(p.(*packets.PublishPacket).Payload))
+
+	// messages of local clients are forwarded to the external broker with
+	// QoS downgraded
+	publish = packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	publish.TopicName = "edge/d1/temp"
+	publish.Qos = QoS1
+	publish.MessageID = 7
+	publish.Payload = []byte("36.5")
+	go publish.Write(clientConn)
+	p, err = packets.ReadPacket(clientConn)
+	assert.Nil(err)
+	assert.IsType(&packets.PubackPacket{}, p)
+
+	for {
+		p, err = packets.ReadPacket(remote)
+		assert.Nil(err)
+		if _, ok := p.(*packets.PublishPacket); ok {
+			break
+		}
+	}
+	forwarded := p.(*packets.PublishPacket)
+	assert.Equal("up/d1/temp", forwarded.TopicName)
+	assert.Equal(QoS0, forwarded.Qos)
+	assert.Equal("36.5", string(forwarded.Payload))
+}
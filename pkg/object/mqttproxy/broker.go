@@ -31,8 +31,11 @@ import (
 	"time"
 
 	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"github.com/megaease/easegress/pkg/api"
 	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/graceupdate"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/protocols/mqttprot"
 	"github.com/megaease/easegress/pkg/tracing"
@@ -57,6 +60,9 @@ type (
 
 		sessMgr           *SessionManager
 		topicMgr          *TopicManager
+		retainMgr         *retainManager
+		aclMgr            *aclManager
+		bridges           []*bridge
 		connectionLimiter *Limiter
 		memberURL         func(string, string) ([]string, error)
 
@@ -71,6 +77,7 @@ type (
 		QoS         int    `json:"qos"`
 		Payload     string `json:"payload"`
 		Base64      bool   `json:"base64"`
+		Retain      bool   `json:"retain"`
 		Distributed bool   `json:"distributed"`
 	}
 
@@ -134,9 +141,22 @@ func newBroker(spec *Spec, store storage, muxMapper context.MuxMapper, memberURL
 	if spec.TopicCacheSize <= 0 {
 		spec.TopicCacheSize = 100000
 	}
+	setRetentionDefaults(spec)
 	broker.topicMgr = newTopicManager(spec.TopicCacheSize)
 	broker.sessMgr = newSessionManager(broker, store)
+	broker.retainMgr = newRetainManager(spec.Name, store, spec.Retention)
+	if spec.ACL != nil {
+		broker.aclMgr = newACLManager(spec.Name, store, spec.ACL)
+	}
 	broker.connectionLimiter = newLimiter(spec.ConnectionLimit)
+	for _, bs := range spec.Bridges {
+		br, err := newBridge(broker, bs)
+		if err != nil {
+			logger.SpanErrorf(nil, "create bridge %s failed: %v", bs.Name, err)
+			continue
+		}
+		broker.bridges = append(broker.bridges, br)
+	}
 	go broker.run()
 	ch, closeFunc, err := broker.sessMgr.store.watchDelete(sessionStoreKey(""))
 	if err != nil {
@@ -158,12 +178,13 @@ func (b *Broker) setListener() error {
 		if err != nil {
 			return fmt.Errorf("invalid tls config for mqtt proxy: %v", err)
 		}
-		l, err = tls.Listen("tcp", addr, cfg)
+		l, err = graceupdate.Listen("tcp", addr)
 		if err != nil {
 			return fmt.Errorf("gen mqtt tls tcp listener with addr %v and cfg %v failed: %v", addr, cfg, err)
 		}
+		l = tls.NewListener(l, cfg)
 	} else {
-		l, err = net.Listen("tcp", addr)
+		l, err = graceupdate.Listen("tcp", addr)
 		if err != nil {
 			return fmt.Errorf("gen mqtt tcp listener with addr %s failed: %v", addr, err)
 		}
@@ -279,9 +300,9 @@ func (b *Broker) checkConnectPermission(connect *packets.ConnectPacket) bool {
 func (b *Broker) connectionValidation(connect *packets.ConnectPacket, conn net.Conn) (*Client, *packets.ConnackPacket, bool) {
 	connack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
 	connack.SessionPresent = connect.CleanSession
-	connack.ReturnCode = connect.Validate()
+	connack.ReturnCode = validateConnect(connect)
 	if connack.ReturnCode != packets.Accepted {
-		err := connack.Write(conn)
+		err := writeConnack(conn, connack, connect.ProtocolVersion, nil)
 		logger.SpanErrorf(nil, "invalid connection %v, write connack failed: %s", connack.ReturnCode, err)
 		return nil, nil, false
 	}
@@ -289,7 +310,7 @@ func (b *Broker) connectionValidation(connect *packets.ConnectPacket, conn net.C
 	if !b.checkConnectPermission(connect) {
 		logger.SpanDebugf(nil, "client %v not get connect permission from rate limiter", connect.ClientIdentifier)
 		connack.ReturnCode = packets.ErrRefusedServerUnavailable
-		err := connack.Write(conn)
+		err := writeConnack(conn, connack, connect.ProtocolVersion, nil)
 		if err != nil {
 			logger.SpanErrorf(nil, "connack back to client %s failed: %s", connect.ClientIdentifier, err)
 		}
@@ -318,7 +339,7 @@ func (b *Broker) connectionValidation(connect *packets.ConnectPacket, conn net.C
 	}
 	if authFail {
 		connack.ReturnCode = packets.ErrRefusedNotAuthorised
-		err := connack.Write(conn)
+		err := writeConnack(conn, connack, connect.ProtocolVersion, nil)
 		if err != nil {
 			logger.SpanErrorf(nil, "connack back to client %s failed: %s", connect.ClientIdentifier, err)
 		}
@@ -328,17 +349,45 @@ func (b *Broker) connectionValidation(connect *packets.ConnectPacket, conn net.C
 	return client, connack, true
 }
 
+// writeConnack writes the CONNACK packet according to the protocol version
+// of the client.
+func writeConnack(conn net.Conn, connack *packets.ConnackPacket, version byte, props properties) error {
+	if version == mqttV5 {
+		return writePacketV5(conn, &packetV5{ControlPacket: connack, props: props})
+	}
+	return connack.Write(conn)
+}
+
+// connackPropertiesV5 returns the CONNACK properties for MQTT 5.0 clients,
+// which tell the clients the features supported by the broker. An
+// identifier is assigned to the client if it doesn't have one.
+func (b *Broker) connackPropertiesV5(connect *packets.ConnectPacket) properties {
+	props := properties{
+		{id: propMaximumQoS, value: QoS1},
+		{id: propRetainAvailable, value: byte(0)},
+		{id: propSharedSubAvailable, value: byte(1)},
+	}
+	if b.spec.TopicAliasMaximum > 0 {
+		props = append(props, property{id: propTopicAliasMaximum, value: b.spec.TopicAliasMaximum})
+	}
+	if connect.ClientIdentifier == "" {
+		connect.ClientIdentifier = uuid.NewString()
+		props = append(props, property{id: propAssignedClientID, value: connect.ClientIdentifier})
+	}
+	return props
+}
+
 func (b *Broker) handleConn(conn net.Conn) {
 	defer conn.Close()
-	packet, err := packets.ReadPacket(conn)
+	connect, props, err := readConnect(conn)
 	if err != nil {
 		logger.SpanErrorf(nil, "read connect packet failed: %s", err)
 		return
 	}
-	connect, ok := packet.(*packets.ConnectPacket)
-	if !ok {
-		logger.SpanErrorf(nil, "first packet received %s that was not Connect", packet.String())
-		return
+
+	var connackProps properties
+	if connect.ProtocolVersion == mqttV5 {
+		connackProps = b.connackPropertiesV5(connect)
 	}
 	logger.SpanDebugf(nil, "connection from client %s", connect.ClientIdentifier)
 
@@ -346,6 +395,7 @@ func (b *Broker) handleConn(conn net.Conn) {
 	if !valid {
 		return
 	}
+	client.info.sessionExpiry, _ = props.uint32(propSessionExpiry)
 	cid := client.info.cid
 
 	b.Lock()
@@ -357,7 +407,7 @@ func (b *Broker) handleConn(conn net.Conn) {
 		if len(b.clients) >= b.spec.MaxAllowedConnection {
 			logger.SpanDebugf(nil, "client %v not get connect permission from rate limiter", connect.ClientIdentifier)
 			connack.ReturnCode = packets.ErrRefusedServerUnavailable
-			err = connack.Write(conn)
+			err = writeConnack(conn, connack, connect.ProtocolVersion, nil)
 			if err != nil {
 				logger.SpanErrorf(nil, "connack back to client %s failed: %s", connect.ClientIdentifier, err)
 			}
@@ -366,10 +416,14 @@ func (b *Broker) handleConn(conn net.Conn) {
 		}
 	}
 	b.clients[client.info.cid] = client
-	b.setSession(client, connect)
+	resumed := b.setSession(client, connect)
 	b.Unlock()
 
-	err = connack.Write(conn)
+	if connect.ProtocolVersion == mqttV5 {
+		connack.SessionPresent = resumed
+		client.session.setExpiry(client.info.sessionExpiry)
+	}
+	err = writeConnack(conn, connack, connect.ProtocolVersion, connackProps)
 	if err != nil {
 		logger.SpanErrorf(nil, "send connack to client %s failed: %s", connect.ClientIdentifier, err)
 		return
@@ -387,18 +441,22 @@ func (b *Broker) handleConn(conn net.Conn) {
 	client.readLoop()
 }
 
-func (b *Broker) setSession(client *Client, connect *packets.ConnectPacket) {
-	// when clean session is false, previous session exist and previous session not clean session,
-	// then we use previous session, otherwise use new session
+// setSession sets the session of client, it returns whether the previous
+// session is resumed.
+func (b *Broker) setSession(client *Client, connect *packets.ConnectPacket) bool {
+	// when clean session is false, previous session exist and previous session not clean session
+	// or expired, then we use previous session, otherwise use new session
 	prevSess := b.sessMgr.get(connect.ClientIdentifier)
-	if !connect.CleanSession && (prevSess != nil) && !prevSess.cleanSession() {
+	if !connect.CleanSession && (prevSess != nil) && !prevSess.cleanSession() && !prevSess.expired() {
 		client.session = prevSess
-	} else {
-		if prevSess != nil {
-			prevSess.close()
-		}
-		client.session = b.sessMgr.newSessionFromConn(connect)
+		return true
+	}
+
+	if prevSess != nil {
+		prevSess.close()
 	}
+	client.session = b.sessMgr.newSessionFromConn(connect)
+	return false
 }
 
 func (b *Broker) requestTransfer(span *model.SpanContext, egName, name string, data HTTPJsonData, header http.Header) {
@@ -450,6 +508,14 @@ func (b *Broker) sendMsgToClient(span *model.SpanContext, topic string, payload
 	}
 }
 
+// forwardToBridges forwards the message published by a local client to
+// the external brokers.
+func (b *Broker) forwardToBridges(topic string, payload []byte, qos byte) {
+	for _, br := range b.bridges {
+		br.forward(topic, payload, qos)
+	}
+}
+
 func (b *Broker) getClient(clientID string) *Client {
 	b.RLock()
 	defer b.RUnlock()
@@ -497,6 +563,17 @@ func (b *Broker) httpTopicsPublishHandler(w http.ResponseWriter, r *http.Request
 
 	span, _ := b3.ExtractHTTP(r)()
 	logger.SpanDebugf(span, "http endpoint received json data: %v", data)
+
+	// the retained message is stored in the cluster by the member receiving
+	// it from the backend, so other members don't store it again.
+	if data.Retain && !data.Distributed {
+		err = b.retainMgr.retain(data.Topic, payload, byte(data.QoS))
+		if err != nil {
+			api.HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("retain message failed: %v", err))
+			return
+		}
+	}
+
 	if !data.Distributed {
 		data.Distributed = true
 		headers := r.Header.Clone()
@@ -626,6 +703,46 @@ func (b *Broker) httpDeleteSessionHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
+// allowed checks the topic permission of client, all actions are allowed
+// if ACL is not enabled.
+func (b *Broker) allowed(c *Client, action, topic string) bool {
+	if b.aclMgr == nil {
+		return true
+	}
+	return b.aclMgr.allowed(c, action, topic)
+}
+
+func (b *Broker) httpListACLHandler(w http.ResponseWriter, r *http.Request) {
+	rules := b.aclMgr.list()
+	if rules == nil {
+		rules = []*ACLRule{}
+	}
+	api.WriteBody(w, r, rules)
+}
+
+func (b *Broker) httpPutACLHandler(w http.ResponseWriter, r *http.Request) {
+	rule := &ACLRule{}
+	err := codectool.DecodeJSON(r.Body, rule)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid json data from request body"))
+		return
+	}
+	if err = rule.Validate(); err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err = b.aclMgr.put(rule); err != nil {
+		api.HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("put acl rule %s failed: %v", rule.Name, err))
+	}
+}
+
+func (b *Broker) httpDeleteACLHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "rule")
+	if err := b.aclMgr.delete(name); err != nil {
+		api.HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("delete acl rule %s failed: %v", name, err))
+	}
+}
+
 func (b *Broker) currentClients() map[string]struct{} {
 	ans := make(map[string]struct{})
 	b.Lock()
@@ -645,6 +762,13 @@ func (b *Broker) registerAPIs() {
 			{Path: b.mqttAPIPrefix(mqttAPISessionDeletePrefix), Method: http.MethodDelete, Handler: b.httpDeleteSessionHandler},
 		},
 	}
+	if b.aclMgr != nil {
+		group.Entries = append(group.Entries,
+			&api.Entry{Path: b.mqttAPIPrefix(mqttAPIACLPrefix), Method: http.MethodGet, Handler: b.httpListACLHandler},
+			&api.Entry{Path: b.mqttAPIPrefix(mqttAPIACLPrefix), Method: http.MethodPost, Handler: b.httpPutACLHandler},
+			&api.Entry{Path: b.mqttAPIPrefix(mqttAPIACLPrefix) + "/{rule}", Method: http.MethodDelete, Handler: b.httpDeleteACLHandler},
+		)
+	}
 
 	api.RegisterAPIs(group)
 }
@@ -663,6 +787,12 @@ func (b *Broker) close() {
 	close(b.done)
 	b.listener.Close()
 	b.sessMgr.close()
+	if b.aclMgr != nil {
+		b.aclMgr.close()
+	}
+	for _, br := range b.bridges {
+		br.close()
+	}
 
 	b.Lock()
 	defer b.Unlock()
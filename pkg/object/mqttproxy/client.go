@@ -18,7 +18,9 @@
 package mqttproxy
 
 import (
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"net"
 	"reflect"
 	"sync"
@@ -43,6 +45,10 @@ const (
 	QoS1 byte = 1
 	// QoS2 for "Exactly once"
 	QoS2 byte = 2
+
+	// subackFailure is the return code of SUBACK for failed subscriptions
+	// of MQTT 3.1.1.
+	subackFailure byte = 0x80
 )
 
 type processFn func(*Client, packets.ControlPacket)
@@ -68,6 +74,11 @@ var processPacketMap = map[string]processFnWithErr{
 			logger.SpanErrorf(nil, "client %v publish limiter drop packet %v", c.info.cid, publish.TopicName)
 			return nil
 		}
+		if !c.broker.allowed(c, ACLPublish, publish.TopicName) {
+			logger.SpanErrorf(nil, "client %v not allowed to publish %v", c.info.cid, publish.TopicName)
+			rejectPublish(c, publish)
+			return nil
+		}
 		return pipelineWrapper(processPublish, Publish)(c, packet)
 	},
 }
@@ -80,6 +91,11 @@ type (
 		password  string
 		keepalive uint16
 		will      *packets.PublishPacket
+
+		// version is the protocol version, and sessionExpiry is the session
+		// expiry interval in seconds, which is for MQTT 5.0 only.
+		version       byte
+		sessionExpiry uint32
 	}
 
 	// Client represents a MQTT client connection in Broker
@@ -96,6 +112,10 @@ type (
 		writeCh    chan packets.ControlPacket
 		done       chan struct{}
 
+		// topicAliases maps the topic aliases of MQTT 5.0 to topics, it is
+		// only accessed in readLoop.
+		topicAliases map[uint16]string
+
 		// kv map is used for pipeline to share messages among filters during whole connection
 		kvMap sync.Map
 	}
@@ -145,6 +165,7 @@ func newClient(connect *packets.ConnectPacket, broker *Broker, conn net.Conn, li
 		password:  string(connect.Password),
 		keepalive: connect.Keepalive,
 		will:      will,
+		version:   connect.ProtocolVersion,
 	}
 	client := &Client{
 		broker:       broker,
@@ -154,13 +175,14 @@ func newClient(connect *packets.ConnectPacket, broker *Broker, conn net.Conn, li
 		writeCh:      make(chan packets.ControlPacket, 50),
 		done:         make(chan struct{}),
 		publishLimit: newLimiter(limitSpec),
+		topicAliases: make(map[uint16]string),
 	}
 	return client
 }
 
 func (c *Client) readLoop() {
 	defer func() {
-		if c.info.will != nil {
+		if c.info.will != nil && c.broker.allowed(c, ACLPublish, c.info.will.TopicName) {
 			c.runPipeline(c.info.will, Publish)
 		}
 		c.closeAndDelSession()
@@ -182,12 +204,17 @@ func (c *Client) readLoop() {
 		}
 
 		logger.SpanDebugf(nil, "client %s readLoop read packet", c.info.cid)
-		packet, err := packets.ReadPacket(c.conn)
+		packet, props, err := c.readPacket()
 		if err != nil {
 			logger.SpanErrorf(nil, "client %s read packet failed: %v", c.info.cid, err)
 			return
 		}
 		if _, ok := packet.(*packets.DisconnectPacket); ok {
+			// MQTT 5.0 clients could change the session expiry interval
+			// when disconnecting.
+			if expiry, ok := props.uint32(propSessionExpiry); ok {
+				c.session.setExpiry(expiry)
+			}
 			c.info.will = nil
 			return
 		}
@@ -199,6 +226,58 @@ func (c *Client) readLoop() {
 	}
 }
 
+func (c *Client) readPacket() (packets.ControlPacket, properties, error) {
+	if c.info.version != mqttV5 {
+		packet, err := packets.ReadPacket(c.conn)
+		return packet, nil, err
+	}
+
+	packet, props, err := readPacketV5(c.conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	if publish, ok := packet.(*packets.PublishPacket); ok {
+		if err := c.resolveTopicAlias(publish, props); err != nil {
+			return nil, nil, err
+		}
+	}
+	return packet, props, nil
+}
+
+// resolveTopicAlias sets the topic of publish if it uses a topic alias of
+// MQTT 5.0, or records the alias if the topic is also present.
+func (c *Client) resolveTopicAlias(publish *packets.PublishPacket, props properties) error {
+	alias, ok := props.uint16(propTopicAlias)
+	if !ok {
+		return nil
+	}
+	if alias == 0 || alias > c.broker.spec.TopicAliasMaximum {
+		return fmt.Errorf("invalid topic alias %d", alias)
+	}
+
+	if publish.TopicName != "" {
+		c.topicAliases[alias] = publish.TopicName
+		return nil
+	}
+
+	topic, ok := c.topicAliases[alias]
+	if !ok {
+		return fmt.Errorf("unknown topic alias %d", alias)
+	}
+	publish.TopicName = topic
+	return nil
+}
+
+func (c *Client) write(packet packets.ControlPacket) error {
+	if c.info.version == mqttV5 {
+		return writePacketV5(c.conn, packet)
+	}
+	if p, ok := packet.(*packetV5); ok {
+		packet = p.ControlPacket
+	}
+	return packet.Write(c.conn)
+}
+
 func (c *Client) processPacket(packet packets.ControlPacket) error {
 	packetType := reflect.TypeOf(packet).String()
 	fn, ok := processPacketMap[packetType]
@@ -248,7 +327,7 @@ func (c *Client) writeLoop() {
 	for {
 		select {
 		case p := <-c.writeCh:
-			err := p.Write(c.conn)
+			err := c.write(p)
 			if err != nil {
 				logger.SpanErrorf(nil, "write packet %v to client %s failed: %s", p.String(), c.info.cid, err)
 				c.closeAndDelSession()
@@ -294,6 +373,8 @@ func (c *Client) closeAndDelSession() {
 	c.broker.sessMgr.delLocal(c.info.cid)
 	if c.session.cleanSession() {
 		c.broker.sessMgr.delDB(c.info.cid)
+	} else if d := c.session.startExpiry(); d > 0 {
+		c.broker.sessMgr.expireAfter(c.info.cid, d)
 	}
 
 	topics, _, _ := c.session.allSubscribes()
@@ -329,6 +410,7 @@ func pipelineWrapper(fn processFn, packetType PacketType) processFnWithErr {
 
 func processPublish(c *Client, packet packets.ControlPacket) {
 	publish := packet.(*packets.PublishPacket)
+	c.broker.forwardToBridges(publish.TopicName, publish.Payload, publish.Qos)
 	switch publish.Qos {
 	case QoS0:
 		// do nothing
@@ -341,6 +423,22 @@ func processPublish(c *Client, packet packets.ControlPacket) {
 	}
 }
 
+// rejectPublish acknowledges the publish denied by ACL, the MQTT 5.0
+// clients are told that they are not authorized, while MQTT 3.1.1 has no
+// way to report it, so the message is silently dropped.
+func rejectPublish(c *Client, publish *packets.PublishPacket) {
+	if publish.Qos != QoS1 {
+		return
+	}
+	puback := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+	puback.MessageID = publish.MessageID
+	if c.info.version == mqttV5 {
+		c.writePacket(&packetV5{ControlPacket: puback, reasonCodes: []byte{reasonNotAuthorized}})
+		return
+	}
+	c.writePacket(puback)
+}
+
 func processPuback(c *Client, packet packets.ControlPacket) {
 	puback := packet.(*packets.PubackPacket)
 	c.session.puback(puback)
@@ -350,20 +448,90 @@ func processSubscribe(c *Client, p packets.ControlPacket) {
 	packet := p.(*packets.SubscribePacket)
 	logger.SpanDebugf(nil, "client %s subscribe %v with qos %v", c.info.cid, packet.Topics, packet.Qoss)
 
-	err := c.broker.topicMgr.subscribe(packet.Topics, packet.Qoss, c.info.cid)
-	if err != nil {
-		logger.SpanErrorf(nil, "client %v subscribe %v failed: %v", c.info.cid, packet.Topics, err)
+	if c.info.version == mqttV5 {
+		processSubscribeV5(c, packet)
 		return
 	}
-	c.session.subscribe(packet.Topics, packet.Qoss)
 
 	suback := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
 	suback.MessageID = packet.MessageID
 	suback.ReturnCodes = make([]byte, len(packet.Topics))
-	for i := range packet.Topics {
+
+	var topics []string
+	var qoss []byte
+	for i, topic := range packet.Topics {
+		if !c.broker.allowed(c, ACLSubscribe, topic) {
+			logger.SpanErrorf(nil, "client %v not allowed to subscribe %v", c.info.cid, topic)
+			suback.ReturnCodes[i] = subackFailure
+			continue
+		}
+		topics = append(topics, topic)
+		qoss = append(qoss, packet.Qoss[i])
 		suback.ReturnCodes[i] = packet.Qos
 	}
+
+	err := c.broker.topicMgr.subscribe(topics, qoss, c.info.cid)
+	if err != nil {
+		logger.SpanErrorf(nil, "client %v subscribe %v failed: %v", c.info.cid, topics, err)
+		return
+	}
+	c.session.subscribe(topics, qoss)
 	c.writePacket(suback)
+	c.sendRetained(topics, qoss)
+}
+
+// processSubscribeV5 subscribes the topics one by one, so that the reason
+// code of each topic is returned to the MQTT 5.0 client.
+func processSubscribeV5(c *Client, packet *packets.SubscribePacket) {
+	suback := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+	suback.MessageID = packet.MessageID
+	suback.ReturnCodes = make([]byte, len(packet.Topics))
+
+	var topics []string
+	var qoss []byte
+	for i, topic := range packet.Topics {
+		qos := packet.Qoss[i]
+		if !c.broker.allowed(c, ACLSubscribe, topic) {
+			logger.SpanErrorf(nil, "client %v not allowed to subscribe %v", c.info.cid, topic)
+			suback.ReturnCodes[i] = reasonNotAuthorized
+			continue
+		}
+		err := c.broker.topicMgr.subscribe([]string{topic}, []byte{qos}, c.info.cid)
+		if err != nil {
+			logger.SpanErrorf(nil, "client %v subscribe %v failed: %v", c.info.cid, topic, err)
+			suback.ReturnCodes[i] = reasonTopicFilterInvalid
+			continue
+		}
+		topics = append(topics, topic)
+		qoss = append(qoss, qos)
+		suback.ReturnCodes[i] = qos
+	}
+	c.session.subscribe(topics, qoss)
+	c.writePacket(suback)
+	c.sendRetained(topics, qoss)
+}
+
+// sendRetained sends the retained messages matching the new subscriptions
+// to the client, the retained messages are not sent for shared
+// subscriptions.
+func (c *Client) sendRetained(topics []string, qoss []byte) {
+	for i, topic := range topics {
+		if _, _, shared := parseSharedTopic(topic); shared {
+			continue
+		}
+		for _, msg := range c.broker.retainMgr.match(topic) {
+			payload, err := base64.StdEncoding.DecodeString(msg.B64Payload)
+			if err != nil {
+				logger.SpanErrorf(nil, "base64 decode error for retained message of %s: %v", msg.Topic, err)
+				continue
+			}
+			qos := byte(msg.QoS)
+			if qos > qoss[i] {
+				qos = qoss[i]
+			}
+			c.session.publishRetained(msg.Topic, payload, qos)
+		}
+	}
 }
 
 func processUnsubscribe(c *Client, p packets.ControlPacket) {
@@ -371,6 +539,16 @@ func processUnsubscribe(c *Client, p packets.ControlPacket) {
 
 	logger.SpanDebugf(nil, "client %s processUnsubscribe %v", c.info.cid, packet.Topics)
 
+	var reasonCodes []byte
+	if c.info.version == mqttV5 {
+		reasonCodes = make([]byte, len(packet.Topics))
+		for i, topic := range packet.Topics {
+			if !c.session.subscribed(topic) {
+				reasonCodes[i] = reasonNoSubscriptionExisted
+			}
+		}
+	}
+
 	err := c.broker.topicMgr.unsubscribe(packet.Topics, c.info.cid)
 	if err != nil {
 		logger.SpanErrorf(nil, "client %v unsubscribe %v failed: %v", c.info.cid, packet.Topics, err)
@@ -379,6 +557,10 @@ func processUnsubscribe(c *Client, p packets.ControlPacket) {
 
 	unsuback := packets.NewControlPacket(packets.Unsuback).(*packets.UnsubackPacket)
 	unsuback.MessageID = packet.MessageID
+	if reasonCodes != nil {
+		c.writePacket(&packetV5{ControlPacket: unsuback, reasonCodes: reasonCodes})
+		return
+	}
 	c.writePacket(unsuback)
 }
 
@@ -49,6 +49,9 @@ func (m *mockCluster) GetRaw(key string) (*mvccpb.KeyValue, error) { return nil,
 func (m *mockCluster) GetRawPrefix(prefix string) (map[string]*mvccpb.KeyValue, error) {
 	return nil, nil
 }
+func (m *mockCluster) GetPrefixBefore(prefix, before string, limit int) ([]*mvccpb.KeyValue, error) {
+	return nil, nil
+}
 func (m *mockCluster) PutUnderLease(key, value string) error                     { return nil }
 func (m *mockCluster) PutAndDelete(map[string]*string) error                     { return nil }
 func (m *mockCluster) PutAndDeleteUnderLease(map[string]*string) error           { return nil }
@@ -60,6 +63,12 @@ func (m *mockCluster) CloseServer(wg *sync.WaitGroup)
 func (m *mockCluster) StartServer() (chan struct{}, chan struct{}, error)        { return nil, nil, nil }
 func (m *mockCluster) Close(wg *sync.WaitGroup)                                  {}
 func (m *mockCluster) PurgeMember(member string) error                           { return nil }
+func (m *mockCluster) EtcdMembers() ([]*cluster.EtcdMember, error)               { return nil, nil }
+func (m *mockCluster) PromoteMember(member string) error                         { return nil }
+func (m *mockCluster) RemoveMember(member string) error                          { return nil }
+func (m *mockCluster) AddLearner(name string, peerURLs []string) ([]*cluster.EtcdMember, error) {
+	return nil, nil
+}
 
 func (m *mockCluster) Watcher() (cluster.Watcher, error) {
 	m.Lock()
@@ -0,0 +1,616 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqttproxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// The packets of MQTT 5.0 clients are decoded into the packets of
+// paho.mqtt.golang, which only supports MQTT 3.1.1, so that they are
+// processed in the same way as the packets of MQTT 3.1.1 clients. The
+// properties are returned separately and the packets sent to MQTT 5.0
+// clients are encoded here.
+
+const (
+	mqttV311 byte = 4
+	mqttV5   byte = 5
+
+	// maxSessionExpiry means the session never expires.
+	maxSessionExpiry uint32 = 0xFFFFFFFF
+)
+
+// MQTT 5.0 property identifiers.
+const (
+	propPayloadFormat        byte = 0x01
+	propMessageExpiry        byte = 0x02
+	propContentType          byte = 0x03
+	propResponseTopic        byte = 0x08
+	propCorrelationData      byte = 0x09
+	propSubscriptionID       byte = 0x0B
+	propSessionExpiry        byte = 0x11
+	propAssignedClientID     byte = 0x12
+	propServerKeepAlive      byte = 0x13
+	propAuthMethod           byte = 0x15
+	propAuthData             byte = 0x16
+	propRequestProblemInfo   byte = 0x17
+	propWillDelay            byte = 0x18
+	propRequestResponseInfo  byte = 0x19
+	propResponseInfo         byte = 0x1A
+	propServerReference      byte = 0x1C
+	propReasonString         byte = 0x1F
+	propReceiveMaximum       byte = 0x21
+	propTopicAliasMaximum    byte = 0x22
+	propTopicAlias           byte = 0x23
+	propMaximumQoS           byte = 0x24
+	propRetainAvailable      byte = 0x25
+	propUserProperty         byte = 0x26
+	propMaximumPacketSize    byte = 0x27
+	propWildcardSubAvailable byte = 0x28
+	propSubIDAvailable       byte = 0x29
+	propSharedSubAvailable   byte = 0x2A
+)
+
+// MQTT 5.0 reason codes.
+const (
+	reasonSuccess               byte = 0x00
+	reasonNoSubscriptionExisted byte = 0x11
+	reasonUnspecifiedError      byte = 0x80
+	reasonProtocolError         byte = 0x82
+	reasonUnsupportedProtocol   byte = 0x84
+	reasonClientIDNotValid      byte = 0x85
+	reasonBadUserNameOrPassword byte = 0x86
+	reasonNotAuthorized         byte = 0x87
+	reasonServerUnavailable     byte = 0x88
+	reasonTopicFilterInvalid    byte = 0x8F
+)
+
+const (
+	propTypeByte = iota
+	propTypeUint16
+	propTypeUint32
+	propTypeVarint
+	propTypeString
+	propTypeBinary
+	propTypeStringPair
+)
+
+var propTypes = map[byte]int{
+	propPayloadFormat:        propTypeByte,
+	propMessageExpiry:        propTypeUint32,
+	propContentType:          propTypeString,
+	propResponseTopic:        propTypeString,
+	propCorrelationData:      propTypeBinary,
+	propSubscriptionID:       propTypeVarint,
+	propSessionExpiry:        propTypeUint32,
+	propAssignedClientID:     propTypeString,
+	propServerKeepAlive:      propTypeUint16,
+	propAuthMethod:           propTypeString,
+	propAuthData:             propTypeBinary,
+	propRequestProblemInfo:   propTypeByte,
+	propWillDelay:            propTypeUint32,
+	propRequestResponseInfo:  propTypeByte,
+	propResponseInfo:         propTypeString,
+	propServerReference:      propTypeString,
+	propReasonString:         propTypeString,
+	propReceiveMaximum:       propTypeUint16,
+	propTopicAliasMaximum:    propTypeUint16,
+	propTopicAlias:           propTypeUint16,
+	propMaximumQoS:           propTypeByte,
+	propRetainAvailable:      propTypeByte,
+	propUserProperty:         propTypeStringPair,
+	propMaximumPacketSize:    propTypeUint32,
+	propWildcardSubAvailable: propTypeByte,
+	propSubIDAvailable:       propTypeByte,
+	propSharedSubAvailable:   propTypeByte,
+}
+
+// connackReasonCodes maps the CONNACK return codes of MQTT 3.1.1 to the
+// reason codes of MQTT 5.0.
+var connackReasonCodes = map[byte]byte{
+	packets.Accepted:                        reasonSuccess,
+	packets.ErrRefusedBadProtocolVersion:    reasonUnsupportedProtocol,
+	packets.ErrRefusedIDRejected:            reasonClientIDNotValid,
+	packets.ErrRefusedServerUnavailable:     reasonServerUnavailable,
+	packets.ErrRefusedBadUsernameOrPassword: reasonBadUserNameOrPassword,
+	packets.ErrRefusedNotAuthorised:         reasonNotAuthorized,
+	packets.ErrProtocolViolation:            reasonProtocolError,
+}
+
+var errMalformedPacket = errors.New("malformed packet")
+
+type (
+	property struct {
+		id    byte
+		value interface{}
+	}
+
+	// properties are the properties of an MQTT 5.0 packet, the value of a
+	// property is byte, uint16, uint32, int (variable byte integer),
+	// string, []byte or [2]string (string pair) according to its type.
+	properties []property
+
+	// packetV5 wraps a packet sent to an MQTT 5.0 client with the fields
+	// which don't exist in MQTT 3.1.1.
+	packetV5 struct {
+		packets.ControlPacket
+		props       properties
+		reasonCodes []byte
+	}
+
+	decoder struct {
+		buf []byte
+		err error
+	}
+)
+
+func (ps properties) get(id byte) (interface{}, bool) {
+	for _, p := range ps {
+		if p.id == id {
+			return p.value, true
+		}
+	}
+	return nil, false
+}
+
+func (ps properties) uint16(id byte) (uint16, bool) {
+	v, ok := ps.get(id)
+	if !ok {
+		return 0, false
+	}
+	n, ok := v.(uint16)
+	return n, ok
+}
+
+func (ps properties) uint32(id byte) (uint32, bool) {
+	v, ok := ps.get(id)
+	if !ok {
+		return 0, false
+	}
+	n, ok := v.(uint32)
+	return n, ok
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.buf) {
+		d.err = errMalformedPacket
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) byte() byte {
+	if b := d.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uint16() uint16 {
+	if b := d.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) varint() int {
+	n := 0
+	for i := 0; i < 4; i++ {
+		b := d.byte()
+		if d.err != nil {
+			return 0
+		}
+		n |= int(b&0x7F) << (7 * i)
+		if b&0x80 == 0 {
+			return n
+		}
+	}
+	d.err = errMalformedPacket
+	return 0
+}
+
+func (d *decoder) binary() []byte {
+	return d.next(int(d.uint16()))
+}
+
+func (d *decoder) string() string {
+	return string(d.binary())
+}
+
+func (d *decoder) properties() properties {
+	sub := &decoder{buf: d.next(d.varint())}
+	if d.err != nil {
+		return nil
+	}
+
+	var ps properties
+	for len(sub.buf) > 0 && sub.err == nil {
+		id := sub.byte()
+		t, ok := propTypes[id]
+		if !ok {
+			d.err = fmt.Errorf("unknown property %#x", id)
+			return nil
+		}
+
+		var v interface{}
+		switch t {
+		case propTypeByte:
+			v = sub.byte()
+		case propTypeUint16:
+			v = sub.uint16()
+		case propTypeUint32:
+			v = sub.uint32()
+		case propTypeVarint:
+			v = sub.varint()
+		case propTypeString:
+			v = sub.string()
+		case propTypeBinary:
+			v = sub.binary()
+		case propTypeStringPair:
+			v = [2]string{sub.string(), sub.string()}
+		}
+		ps = append(ps, property{id: id, value: v})
+	}
+
+	d.err = sub.err
+	return ps
+}
+
+func writeUint16(buf *bytes.Buffer, n uint16) {
+	buf.WriteByte(byte(n >> 8))
+	buf.WriteByte(byte(n))
+}
+
+func writeUint32(buf *bytes.Buffer, n uint32) {
+	writeUint16(buf, uint16(n>>16))
+	writeUint16(buf, uint16(n))
+}
+
+func writeVarint(buf *bytes.Buffer, n int) {
+	for {
+		b := byte(n & 0x7F)
+		n >>= 7
+		if n > 0 {
+			b |= 0x80
+		}
+		buf.WriteByte(b)
+		if n == 0 {
+			return
+		}
+	}
+}
+
+func writeBinary(buf *bytes.Buffer, b []byte) {
+	writeUint16(buf, uint16(len(b)))
+	buf.Write(b)
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	writeBinary(buf, []byte(s))
+}
+
+func writeProperties(buf *bytes.Buffer, ps properties) {
+	props := bytes.NewBuffer(nil)
+	for _, p := range ps {
+		props.WriteByte(p.id)
+		switch v := p.value.(type) {
+		case byte:
+			props.WriteByte(v)
+		case uint16:
+			writeUint16(props, v)
+		case uint32:
+			writeUint32(props, v)
+		case int:
+			writeVarint(props, v)
+		case string:
+			writeString(props, v)
+		case []byte:
+			writeBinary(props, v)
+		case [2]string:
+			writeString(props, v[0])
+			writeString(props, v[1])
+		}
+	}
+	writeVarint(buf, props.Len())
+	buf.Write(props.Bytes())
+}
+
+// readRawPacket reads a packet, it returns the first byte of the fixed
+// header and the bytes after the remaining length.
+func readRawPacket(r io.Reader) (byte, []byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, nil, err
+	}
+	header := b[0]
+
+	length := 0
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errMalformedPacket
+		}
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return 0, nil, err
+		}
+		length |= int(b[0]&0x7F) << (7 * i)
+		if b[0]&0x80 == 0 {
+			break
+		}
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+// readConnect reads the CONNECT packet, and decodes it according to the
+// protocol version of the client.
+func readConnect(r io.Reader) (*packets.ConnectPacket, properties, error) {
+	header, body, err := readRawPacket(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header>>4 != packets.Connect {
+		return nil, nil, fmt.Errorf("first packet received was not connect, packet type %d", header>>4)
+	}
+
+	d := &decoder{buf: body}
+	d.string()
+	if version := d.byte(); d.err == nil && version == mqttV5 {
+		return decodeConnectV5(body)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	buf.WriteByte(header)
+	writeVarint(buf, len(body))
+	buf.Write(body)
+	packet, err := packets.ReadPacket(buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	return packet.(*packets.ConnectPacket), nil, nil
+}
+
+func decodeConnectV5(body []byte) (*packets.ConnectPacket, properties, error) {
+	d := &decoder{buf: body}
+	connect := packets.NewControlPacket(packets.Connect).(*packets.ConnectPacket)
+	connect.RemainingLength = len(body)
+	connect.ProtocolName = d.string()
+	connect.ProtocolVersion = d.byte()
+
+	flags := d.byte()
+	connect.ReservedBit = flags & 0x01
+	connect.CleanSession = flags&0x02 != 0
+	connect.WillFlag = flags&0x04 != 0
+	connect.WillQos = (flags >> 3) & 0x03
+	connect.WillRetain = flags&0x20 != 0
+	connect.PasswordFlag = flags&0x40 != 0
+	connect.UsernameFlag = flags&0x80 != 0
+	connect.Keepalive = d.uint16()
+
+	props := d.properties()
+	connect.ClientIdentifier = d.string()
+	if connect.WillFlag {
+		// will properties are not supported.
+		d.properties()
+		connect.WillTopic = d.string()
+		connect.WillMessage = d.binary()
+	}
+	if connect.UsernameFlag {
+		connect.Username = d.string()
+	}
+	if connect.PasswordFlag {
+		connect.Password = d.binary()
+	}
+
+	if d.err != nil {
+		return nil, nil, d.err
+	}
+	return connect, props, nil
+}
+
+// validateConnect validates the CONNECT packet, it returns the return code
+// of CONNACK.
+func validateConnect(connect *packets.ConnectPacket) byte {
+	if connect.ProtocolVersion != mqttV5 {
+		return connect.Validate()
+	}
+	if connect.ProtocolName != "MQTT" || connect.ReservedBit != 0 {
+		return packets.ErrProtocolViolation
+	}
+	return packets.Accepted
+}
+
+// readPacketV5 reads a packet of an MQTT 5.0 client.
+func readPacketV5(r io.Reader) (packets.ControlPacket, properties, error) {
+	header, body, err := readRawPacket(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var props properties
+	var packet packets.ControlPacket
+	d := &decoder{buf: body}
+
+	switch packetType := header >> 4; packetType {
+	case packets.Publish:
+		p := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+		p.RemainingLength = len(body)
+		p.Dup = header&0x08 != 0
+		p.Qos = (header >> 1) & 0x03
+		p.Retain = header&0x01 != 0
+		p.TopicName = d.string()
+		if p.Qos > QoS0 {
+			p.MessageID = d.uint16()
+		}
+		props = d.properties()
+		p.Payload = d.buf
+		packet = p
+
+	case packets.Puback:
+		// the reason code and properties are ignored.
+		p := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+		p.MessageID = d.uint16()
+		packet = p
+
+	case packets.Subscribe:
+		p := packets.NewControlPacket(packets.Subscribe).(*packets.SubscribePacket)
+		p.MessageID = d.uint16()
+		props = d.properties()
+		for len(d.buf) > 0 && d.err == nil {
+			p.Topics = append(p.Topics, d.string())
+			// only the QoS of the subscription options is supported.
+			p.Qoss = append(p.Qoss, d.byte()&0x03)
+		}
+		packet = p
+
+	case packets.Unsubscribe:
+		p := packets.NewControlPacket(packets.Unsubscribe).(*packets.UnsubscribePacket)
+		p.MessageID = d.uint16()
+		props = d.properties()
+		for len(d.buf) > 0 && d.err == nil {
+			p.Topics = append(p.Topics, d.string())
+		}
+		packet = p
+
+	case packets.Disconnect:
+		packet = packets.NewControlPacket(packets.Disconnect)
+		if len(d.buf) > 0 {
+			d.byte()
+			if len(d.buf) > 0 {
+				props = d.properties()
+			}
+		}
+
+	default:
+		// the other packets have no MQTT 5.0 specific fields we care about,
+		// the unexpected ones are rejected when processing.
+		packet = packets.NewControlPacket(packetType)
+		if packet == nil {
+			return nil, nil, fmt.Errorf("unsupported packet type %d", packetType)
+		}
+	}
+
+	if d.err != nil {
+		return nil, nil, d.err
+	}
+	return packet, props, nil
+}
+
+// writePacketV5 writes a packet to an MQTT 5.0 client.
+func writePacketV5(w io.Writer, packet packets.ControlPacket) error {
+	var props properties
+	var reasonCodes []byte
+	if p, ok := packet.(*packetV5); ok {
+		packet, props, reasonCodes = p.ControlPacket, p.props, p.reasonCodes
+	}
+
+	var header byte
+	body := bytes.NewBuffer(nil)
+
+	switch p := packet.(type) {
+	case *packets.ConnackPacket:
+		header = packets.Connack << 4
+		if p.SessionPresent {
+			body.WriteByte(1)
+		} else {
+			body.WriteByte(0)
+		}
+		code, ok := connackReasonCodes[p.ReturnCode]
+		if !ok {
+			code = reasonUnspecifiedError
+		}
+		body.WriteByte(code)
+		writeProperties(body, props)
+
+	case *packets.PublishPacket:
+		header = packets.Publish<<4 | p.Qos<<1
+		if p.Dup {
+			header |= 0x08
+		}
+		if p.Retain {
+			header |= 0x01
+		}
+		writeString(body, p.TopicName)
+		if p.Qos > QoS0 {
+			writeUint16(body, p.MessageID)
+		}
+		writeProperties(body, props)
+		body.Write(p.Payload)
+
+	case *packets.PubackPacket:
+		header = packets.Puback << 4
+		writeUint16(body, p.MessageID)
+		if len(reasonCodes) > 0 {
+			body.WriteByte(reasonCodes[0])
+			writeProperties(body, props)
+		}
+
+	case *packets.SubackPacket:
+		header = packets.Suback << 4
+		writeUint16(body, p.MessageID)
+		writeProperties(body, props)
+		body.Write(p.ReturnCodes)
+
+	case *packets.UnsubackPacket:
+		header = packets.Unsuback << 4
+		writeUint16(body, p.MessageID)
+		writeProperties(body, props)
+		body.Write(reasonCodes)
+
+	case *packets.PingrespPacket:
+		header = packets.Pingresp << 4
+
+	case *packets.DisconnectPacket:
+		header = packets.Disconnect << 4
+		if len(reasonCodes) > 0 {
+			body.WriteByte(reasonCodes[0])
+			writeProperties(body, props)
+		}
+
+	default:
+		return fmt.Errorf("packet %s is not supported for MQTT 5.0", packet.String())
+	}
+
+	buf := bytes.NewBuffer(nil)
+	buf.WriteByte(header)
+	writeVarint(buf, body.Len())
+	buf.Write(body.Bytes())
+	_, err := w.Write(buf.Bytes())
+	return err
+}
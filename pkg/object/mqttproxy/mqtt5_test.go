@@ -0,0 +1,275 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqttproxy
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeTestPacketV5(header byte, body *bytes.Buffer) []byte {
+	buf := bytes.NewBuffer(nil)
+	buf.WriteByte(header)
+	writeVarint(buf, body.Len())
+	buf.Write(body.Bytes())
+	return buf.Bytes()
+}
+
+func encodeConnectV5(clientID string, cleanStart bool, props properties) []byte {
+	body := bytes.NewBuffer(nil)
+	writeString(body, "MQTT")
+	body.WriteByte(mqttV5)
+	flags := byte(0x80)
+	if cleanStart {
+		flags |= 0x02
+	}
+	body.WriteByte(flags)
+	writeUint16(body, 30)
+	writeProperties(body, props)
+	writeString(body, clientID)
+	writeString(body, "user")
+	return encodeTestPacketV5(packets.Connect<<4, body)
+}
+
+func encodeSubscribeV5(id uint16, topics []string, qoss []byte) []byte {
+	body := bytes.NewBuffer(nil)
+	writeUint16(body, id)
+	writeProperties(body, nil)
+	for i, t := range topics {
+		writeString(body, t)
+		body.WriteByte(qoss[i])
+	}
+	return encodeTestPacketV5(packets.Subscribe<<4|0x02, body)
+}
+
+func encodeUnsubscribeV5(id uint16, topics []string) []byte {
+	body := bytes.NewBuffer(nil)
+	writeUint16(body, id)
+	writeProperties(body, nil)
+	for _, t := range topics {
+		writeString(body, t)
+	}
+	return encodeTestPacketV5(packets.Unsubscribe<<4|0x02, body)
+}
+
+func encodePublishV5(t *testing.T, topic string, id uint16, alias uint16) []byte {
+	publish := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	publish.TopicName = topic
+	publish.Qos = QoS1
+	publish.MessageID = id
+	publish.Payload = []byte("hello")
+
+	buf := bytes.NewBuffer(nil)
+	err := writePacketV5(buf, &packetV5{
+		ControlPacket: publish,
+		props:         properties{{id: propTopicAlias, value: alias}},
+	})
+	assert.Nil(t, err)
+	return buf.Bytes()
+}
+
+func TestReadConnect(t *testing.T) {
+	assert := assert.New(t)
+
+	data := encodeConnectV5("cid", false, properties{
+		{id: propSessionExpiry, value: uint32(60)},
+		{id: propUserProperty, value: [2]string{"k", "v"}},
+	})
+	connect, props, err := readConnect(bytes.NewReader(data))
+	assert.Nil(err)
+	assert.Equal(mqttV5, connect.ProtocolVersion)
+	assert.Equal("cid", connect.ClientIdentifier)
+	assert.Equal("user", connect.Username)
+	assert.Equal(uint16(30), connect.Keepalive)
+	assert.False(connect.CleanSession)
+	assert.Equal(byte(packets.Accepted), validateConnect(connect))
+	expiry, ok := props.uint32(propSessionExpiry)
+	assert.True(ok)
+	assert.Equal(uint32(60), expiry)
+	v, _ := props.get(propUserProperty)
+	assert.Equal([2]string{"k", "v"}, v)
+
+	// MQTT 3.1.1
+	connect = packets.NewControlPacket(packets.Connect).(*packets.ConnectPacket)
+	connect.ProtocolName = "MQTT"
+	connect.ProtocolVersion = mqttV311
+	connect.ClientIdentifier = "cid311"
+	buf := bytes.NewBuffer(nil)
+	connect.Write(buf)
+	connect, props, err = readConnect(buf)
+	assert.Nil(err)
+	assert.Nil(props)
+	assert.Equal("cid311", connect.ClientIdentifier)
+
+	// truncated packet
+	_, _, err = readConnect(bytes.NewReader(data[:len(data)-3]))
+	assert.NotNil(err)
+
+	// not connect
+	_, _, err = readConnect(bytes.NewReader(encodeUnsubscribeV5(1, []string{"a"})))
+	assert.NotNil(err)
+}
+
+func TestBrokerV5(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{
+		Name:              "test-v5",
+		EGName:            "test-v5",
+		Port:              1885,
+		TopicAliasMaximum: 10,
+	}
+	broker := getBrokerFromSpec(spec, nil)
+	assert.NotNil(broker)
+	defer broker.close()
+
+	svcConn, clientConn := net.Pipe()
+	go broker.handleConn(svcConn)
+
+	read := func() (byte, *decoder) {
+		header, body, err := readRawPacket(clientConn)
+		assert.Nil(err)
+		return header >> 4, &decoder{buf: body}
+	}
+
+	// connect without client id
+	go clientConn.Write(encodeConnectV5("", true, properties{{id: propSessionExpiry, value: uint32(60)}}))
+	packetType, d := read()
+	assert.Equal(byte(packets.Connack), packetType)
+	assert.Equal(byte(0), d.byte())
+	assert.Equal(reasonSuccess, d.byte())
+	props := d.properties()
+	v, ok := props.get(propAssignedClientID)
+	assert.True(ok)
+	cid := v.(string)
+	assert.NotEmpty(cid)
+	alias, _ := props.uint16(propTopicAliasMaximum)
+	assert.Equal(uint16(10), alias)
+
+	assert.Eventually(func() bool {
+		return broker.getClient(cid) != nil
+	}, time.Second, 10*time.Millisecond)
+	client := broker.getClient(cid)
+	assert.False(client.session.cleanSession())
+
+	// subscribe
+	go clientConn.Write(encodeSubscribeV5(1, []string{"$share/g/a/+", "a/+/#/b"}, []byte{1, 1}))
+	packetType, d = read()
+	assert.Equal(byte(packets.Suback), packetType)
+	assert.Equal(uint16(1), d.uint16())
+	d.properties()
+	assert.Equal([]byte{1, reasonTopicFilterInvalid}, d.buf)
+
+	// publish with topic alias
+	go clientConn.Write(encodePublishV5(t, "a/b", 2, 1))
+	packetType, d = read()
+	assert.Equal(byte(packets.Puback), packetType)
+	assert.Equal(uint16(2), d.uint16())
+
+	go clientConn.Write(encodePublishV5(t, "", 3, 1))
+	packetType, d = read()
+	assert.Equal(byte(packets.Puback), packetType)
+	assert.Equal(uint16(3), d.uint16())
+
+	// messages of shared subscriptions
+	go broker.sendMsgToClient(nil, "a/b", []byte("world"), QoS1)
+	p, _, err := readPacketV5(clientConn)
+	assert.Nil(err)
+	publish := p.(*packets.PublishPacket)
+	assert.Equal("a/b", publish.TopicName)
+	assert.Equal("world", string(publish.Payload))
+
+	// unsubscribe
+	go clientConn.Write(encodeUnsubscribeV5(4, []string{"$share/g/a/+", "x/y"}))
+	packetType, d = read()
+	assert.Equal(byte(packets.Unsuback), packetType)
+	assert.Equal(uint16(4), d.uint16())
+	d.properties()
+	assert.Equal([]byte{reasonSuccess, reasonNoSubscriptionExisted}, d.buf)
+
+	// unknown topic alias closes the connection
+	go clientConn.Write(encodePublishV5(t, "", 5, 2))
+	_, _, err = readRawPacket(clientConn)
+	assert.NotNil(err)
+
+	assert.Eventually(func() bool {
+		client.session.Lock()
+		defer client.session.Unlock()
+		return client.session.info.ExpireAt != 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSharedSubscription(t *testing.T) {
+	assert := assert.New(t)
+
+	group, filter, shared := parseSharedTopic("$share/g/a/+")
+	assert.True(shared)
+	assert.Equal("g", group)
+	assert.Equal("a/+", filter)
+	_, _, shared = parseSharedTopic("$share/g")
+	assert.False(shared)
+
+	mgr := newTopicManager(100)
+	assert.Nil(mgr.subscribe([]string{"$share/g/a/+"}, []byte{1}, "c1"))
+	assert.Nil(mgr.subscribe([]string{"$share/g/a/+"}, []byte{1}, "c2"))
+	assert.Nil(mgr.subscribe([]string{"a/b"}, []byte{1}, "c3"))
+
+	for i := 0; i < 10; i++ {
+		subscribers, err := mgr.findSubscribers("a/b")
+		assert.Nil(err)
+		assert.Len(subscribers, 2)
+		assert.Contains(subscribers, "c3")
+	}
+
+	assert.Nil(mgr.unsubscribe([]string{"$share/g/a/+"}, "c1"))
+	subscribers, _ := mgr.findSubscribers("a/b")
+	assert.Equal(map[string]byte{"c2": 1, "c3": 1}, subscribers)
+
+	assert.Nil(mgr.unsubscribe([]string{"$share/g/a/+"}, "c2"))
+	assert.Nil(mgr.unsubscribe([]string{"a/b"}, "c3"))
+	assert.Empty(mgr.root.nodes)
+}
+
+func TestSessionExpiry(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &Session{
+		info:    &SessionInfo{ClientID: "cid"},
+		storeCh: make(chan SessionStore, 10),
+	}
+	assert.Equal(time.Duration(0), s.startExpiry())
+
+	s.setExpiry(0)
+	assert.True(s.cleanSession())
+
+	s.setExpiry(maxSessionExpiry)
+	assert.False(s.cleanSession())
+	assert.Equal(time.Duration(0), s.startExpiry())
+
+	s.setExpiry(60)
+	assert.Equal(time.Minute, s.startExpiry())
+	assert.False(s.expired())
+
+	s.info.ExpireAt = time.Now().Add(-time.Second).Unix()
+	assert.True(s.expired())
+}
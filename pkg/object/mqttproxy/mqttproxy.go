@@ -64,7 +64,7 @@ func (mp *MQTTProxy) Kind() string {
 
 // DefaultSpec returns the default spec of MQTTProxy.
 func (mp *MQTTProxy) DefaultSpec() interface{} {
-	return &Spec{}
+	return &Spec{TopicAliasMaximum: 10}
 }
 
 // Status returns the Status of MQTTProxy.
@@ -0,0 +1,168 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqttproxy
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	defaultMaxInflightMessages    = 100
+	defaultMaxRetainedMessages    = 10000
+	defaultMaxRetainedPayloadSize = 64 * 1024
+)
+
+type (
+	// RetainedMessage is the retained message of a topic, it is stored in
+	// the cluster and sent to the clients subscribing the topic later.
+	RetainedMessage struct {
+		Topic      string `json:"topic"`
+		B64Payload string `json:"b64Payload"`
+		QoS        int    `json:"qos"`
+		ExpireAt   int64  `json:"expireAt,omitempty"`
+	}
+
+	// retainManager manages the retained messages of a broker.
+	retainManager struct {
+		name  string
+		store storage
+		spec  *RetentionSpec
+		ttl   time.Duration
+	}
+)
+
+func setRetentionDefaults(spec *Spec) {
+	if spec.Retention == nil {
+		spec.Retention = &RetentionSpec{}
+	}
+	r := spec.Retention
+	if r.MaxInflightMessages <= 0 {
+		r.MaxInflightMessages = defaultMaxInflightMessages
+	}
+	if r.MaxRetainedMessages <= 0 {
+		r.MaxRetainedMessages = defaultMaxRetainedMessages
+	}
+	if r.MaxRetainedPayloadSize <= 0 {
+		r.MaxRetainedPayloadSize = defaultMaxRetainedPayloadSize
+	}
+}
+
+func newRetainManager(name string, store storage, spec *RetentionSpec) *retainManager {
+	rm := &retainManager{
+		name:  name,
+		store: store,
+		spec:  spec,
+	}
+	if spec.RetainedMessageTTL != "" {
+		// the duration has been validated, so no error here.
+		rm.ttl, _ = time.ParseDuration(spec.RetainedMessageTTL)
+	}
+	return rm
+}
+
+// retain stores payload as the retained message of topic, an empty payload
+// deletes the retained message.
+func (rm *retainManager) retain(topic string, payload []byte, qos byte) error {
+	key := retainStoreKey(rm.name, topic)
+	if len(payload) == 0 {
+		return rm.store.delete(key)
+	}
+
+	if len(payload) > rm.spec.MaxRetainedPayloadSize {
+		return fmt.Errorf("payload size %d of retained message exceeds %d", len(payload), rm.spec.MaxRetainedPayloadSize)
+	}
+
+	keys, err := rm.store.getPrefix(retainStoreKey(rm.name, ""), true)
+	if err != nil {
+		return err
+	}
+	if _, ok := keys[key]; !ok && len(keys) >= rm.spec.MaxRetainedMessages {
+		return fmt.Errorf("retained messages exceed %d", rm.spec.MaxRetainedMessages)
+	}
+
+	msg := &RetainedMessage{
+		Topic:      topic,
+		B64Payload: base64.StdEncoding.EncodeToString(payload),
+		QoS:        int(qos),
+	}
+	if rm.ttl > 0 {
+		msg.ExpireAt = time.Now().Add(rm.ttl).Unix()
+	}
+	data, err := codectool.MarshalJSON(msg)
+	if err != nil {
+		return err
+	}
+	return rm.store.put(key, string(data))
+}
+
+// match returns the retained messages whose topics match filter, the
+// expired messages are deleted.
+func (rm *retainManager) match(filter string) []*RetainedMessage {
+	levels, ok := splitTopic(filter)
+	if !ok {
+		return nil
+	}
+
+	kvs, err := rm.store.getPrefix(retainStoreKey(rm.name, ""), false)
+	if err != nil {
+		logger.SpanErrorf(nil, "get retained messages of %s failed: %v", rm.name, err)
+		return nil
+	}
+
+	now := time.Now().Unix()
+	var result []*RetainedMessage
+	for key, value := range kvs {
+		msg := &RetainedMessage{}
+		if err := codectool.Unmarshal([]byte(value), msg); err != nil {
+			logger.SpanErrorf(nil, "decode retained message %s failed: %v", key, err)
+			continue
+		}
+		if msg.ExpireAt != 0 && now >= msg.ExpireAt {
+			rm.store.delete(key)
+			continue
+		}
+		if matchTopic(levels, msg.Topic) {
+			result = append(result, msg)
+		}
+	}
+	return result
+}
+
+// matchTopic checks whether topic matches the topic filter, levels are the
+// levels of the filter.
+func matchTopic(levels []string, topic string) bool {
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range levels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+	return len(levels) == len(topicLevels)
+}
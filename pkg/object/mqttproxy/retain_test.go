@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqttproxy
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchTopic(t *testing.T) {
+	assert := assert.New(t)
+
+	match := func(filter, topic string) bool {
+		levels, ok := splitTopic(filter)
+		assert.True(ok)
+		return matchTopic(levels, topic)
+	}
+	assert.True(match("a/b", "a/b"))
+	assert.True(match("a/+", "a/b"))
+	assert.True(match("a/#", "a/b/c"))
+	assert.True(match("a/#", "a"))
+	assert.True(match("+/+/c", "a/b/c"))
+	assert.False(match("a/+", "a/b/c"))
+	assert.False(match("a/b/c", "a/b"))
+	assert.False(match("a/c", "a/b"))
+}
+
+func TestRetainManager(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Retention: &RetentionSpec{
+		MaxRetainedMessages:    2,
+		MaxRetainedPayloadSize: 5,
+	}}
+	setRetentionDefaults(spec)
+	assert.Equal(defaultMaxInflightMessages, spec.Retention.MaxInflightMessages)
+
+	store := newStorage(nil)
+	rm := newRetainManager("test", store, spec.Retention)
+
+	assert.Nil(rm.retain("a/b", []byte("ab"), QoS1))
+	assert.Nil(rm.retain("a/c", []byte("ac"), QoS0))
+	assert.NotNil(rm.retain("a/d", []byte("ad"), QoS0))
+	assert.NotNil(rm.retain("a/b", []byte("too long"), QoS0))
+
+	// replace an existing one
+	assert.Nil(rm.retain("a/b", []byte("ab2"), QoS1))
+
+	msgs := rm.match("a/+")
+	assert.Len(msgs, 2)
+	msgs = rm.match("a/b")
+	assert.Len(msgs, 1)
+	assert.Equal("YWIy", msgs[0].B64Payload)
+	assert.Equal(1, msgs[0].QoS)
+
+	// an empty payload deletes the retained message
+	assert.Nil(rm.retain("a/b", nil, QoS0))
+	assert.Len(rm.match("a/#"), 1)
+
+	// expired messages are deleted
+	data, _ := codectool.MarshalJSON(&RetainedMessage{
+		Topic:      "a/e",
+		B64Payload: "YWU=",
+		ExpireAt:   time.Now().Add(-time.Second).Unix(),
+	})
+	store.put(retainStoreKey("test", "a/e"), string(data))
+	assert.Len(rm.match("a/#"), 1)
+	_, err := store.get(retainStoreKey("test", "a/e"))
+	assert.NotNil(err)
+
+	rm = newRetainManager("test", store, &RetentionSpec{
+		MaxRetainedMessages:    10,
+		MaxRetainedPayloadSize: 10,
+		RetainedMessageTTL:     "1m",
+	})
+	assert.Nil(rm.retain("a/f", []byte("af"), QoS0))
+	msgs = rm.match("a/f")
+	assert.Len(msgs, 1)
+	assert.NotZero(msgs[0].ExpireAt)
+}
+
+func TestSessionInflight(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{
+		Name:      "test-inflight",
+		EGName:    "test-inflight",
+		Port:      1886,
+		Retention: &RetentionSpec{MaxInflightMessages: 2},
+	}
+	broker := getBrokerFromSpec(spec, nil)
+	assert.NotNil(broker)
+	defer broker.close()
+
+	svcConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	connect := packets.NewControlPacket(packets.Connect).(*packets.ConnectPacket)
+	connect.ClientIdentifier = "cid"
+
+	client := newClient(connect, broker, svcConn, nil)
+	client.session = broker.sessMgr.newSessionFromConn(connect)
+	broker.Lock()
+	broker.clients["cid"] = client
+	broker.Unlock()
+	go func() {
+		for {
+			select {
+			case <-client.writeCh:
+			case <-client.done:
+				return
+			}
+		}
+	}()
+	defer client.close()
+
+	for _, payload := range []string{"m0", "m1", "m2"} {
+		client.session.publish(nil, "topic", []byte(payload), QoS1)
+	}
+
+	stored := func() *SessionInfo {
+		str, err := broker.sessMgr.store.get(sessionStoreKey("cid"))
+		if err != nil {
+			return nil
+		}
+		info := &SessionInfo{}
+		codectool.Unmarshal([]byte(*str), info)
+		return info
+	}
+	assert.Eventually(func() bool {
+		info := stored()
+		return info != nil && len(info.Inflight) == 2 && info.NextID == 3
+	}, time.Second, 10*time.Millisecond)
+
+	// the session is resumed with the pending messages on another member.
+	str, _ := broker.sessMgr.store.get(sessionStoreKey("cid"))
+	sess := broker.sessMgr.newSessionFromJSON(str)
+	defer sess.close()
+	assert.Len(sess.pending, 2)
+	assert.Equal([]uint16{1, 2}, sess.pendingQueue)
+	assert.Equal("bTE=", sess.pending[1].B64Payload)
+	assert.Equal(uint16(3), sess.nextID)
+
+	puback := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+	puback.MessageID = 1
+	client.session.puback(puback)
+	assert.Eventually(func() bool {
+		info := stored()
+		return info != nil && len(info.Inflight) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRetainedMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{
+		Name:   "test-retain",
+		EGName: "test-retain",
+		Port:   1887,
+	}
+	broker := getBrokerFromSpec(spec, nil)
+	assert.NotNil(broker)
+	defer broker.close()
+
+	publish := func(data HTTPJsonData) int {
+		body, _ := codectool.MarshalJSON(data)
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		broker.httpTopicsPublishHandler(w, req)
+		return w.Code
+	}
+	assert.Equal(http.StatusOK, publish(HTTPJsonData{Topic: "sensor/1", QoS: 1, Payload: "on", Retain: true}))
+	assert.Equal(http.StatusBadRequest, publish(HTTPJsonData{
+		Topic: "sensor/2", QoS: 1, Payload: string(make([]byte, defaultMaxRetainedPayloadSize+1)), Retain: true,
+	}))
+
+	svcConn, clientConn := net.Pipe()
+	go broker.handleConn(svcConn)
+	defer clientConn.Close()
+
+	go clientConn.Write(encodeConnectV5("cid", true, nil))
+	header, _, err := readRawPacket(clientConn)
+	assert.Nil(err)
+	assert.Equal(byte(packets.Connack), header>>4)
+
+	go clientConn.Write(encodeSubscribeV5(1, []string{"sensor/+"}, []byte{1}))
+	header, _, err = readRawPacket(clientConn)
+	assert.Nil(err)
+	assert.Equal(byte(packets.Suback), header>>4)
+
+	p, _, err := readPacketV5(clientConn)
+	assert.Nil(err)
+	msg := p.(*packets.PublishPacket)
+	assert.True(msg.Retain)
+	assert.Equal("sensor/1", msg.TopicName)
+	assert.Equal("on", string(msg.Payload))
+	assert.Equal(QoS1, msg.Qos)
+}
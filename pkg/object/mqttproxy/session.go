@@ -38,6 +38,18 @@ type (
 		Topics    map[string]int `json:"topics"`
 		ClientID  string         `json:"clientID"`
 		CleanFlag bool           `json:"cleanFlag"`
+
+		// SessionExpiry is the session expiry interval in seconds of MQTT
+		// 5.0 clients, and ExpireAt is the unix time when the session
+		// expires after the client disconnected, 0 means never.
+		SessionExpiry uint32 `json:"sessionExpiry,omitempty"`
+		ExpireAt      int64  `json:"expireAt,omitempty"`
+
+		// Inflight are the QoS1 messages not acknowledged by the client,
+		// and NextID is the next packet identifier, they are persisted so
+		// that the session could be resumed on another member.
+		Inflight []*Message `json:"inflight,omitempty"`
+		NextID   uint16     `json:"nextID,omitempty"`
 	}
 
 	// Session includes the information about the connect between client and broker,
@@ -58,6 +70,7 @@ type (
 		Topic      string `json:"topic"`
 		B64Payload string `json:"b64Payload"`
 		QoS        int    `json:"qos"`
+		PacketID   uint16 `json:"packetID,omitempty"`
 	}
 )
 
@@ -72,6 +85,7 @@ func newMsg(topic string, payload []byte, qos byte) *Message {
 
 func (s *Session) store() {
 	logger.SpanDebugf(nil, "session %v store", s.info.ClientID)
+	s.syncInflight()
 	str, err := s.encode()
 	if err != nil {
 		logger.SpanErrorf(nil, "encode session %+v failed: %v", s, err)
@@ -81,9 +95,15 @@ func (s *Session) store() {
 		key:   s.info.ClientID,
 		value: str,
 	}
-	go func() {
-		s.storeCh <- ss
-	}()
+	// the sessions are stored in order unless the channel is full, which
+	// matters since the in-flight messages are stored frequently.
+	select {
+	case s.storeCh <- ss:
+	default:
+		go func() {
+			s.storeCh <- ss
+		}()
+	}
 }
 
 func (s *Session) encode() (string, error) {
@@ -98,6 +118,28 @@ func (s *Session) decode(str string) error {
 	return codectool.Unmarshal([]byte(str), s.info)
 }
 
+// syncInflight copies the pending messages to the session info in the
+// order they were sent.
+func (s *Session) syncInflight() {
+	inflight := make([]*Message, 0, len(s.pending))
+	for _, id := range s.pendingQueue {
+		if msg, ok := s.pending[id]; ok && msg.PacketID == id {
+			inflight = append(inflight, msg)
+		}
+	}
+	s.info.Inflight = inflight
+	s.info.NextID = s.nextID
+}
+
+// restoreInflight restores the pending messages from the session info.
+func (s *Session) restoreInflight() {
+	for _, msg := range s.info.Inflight {
+		s.pending[msg.PacketID] = msg
+		s.pendingQueue = append(s.pendingQueue, msg.PacketID)
+	}
+	s.nextID = s.info.NextID
+}
+
 func (s *Session) init(sm *SessionManager, b *Broker, connect *packets.ConnectPacket) error {
 	s.broker = b
 	s.storeCh = sm.storeCh
@@ -144,6 +186,13 @@ func (s *Session) unsubscribe(topics []string) error {
 	return nil
 }
 
+func (s *Session) subscribed(topic string) bool {
+	s.Lock()
+	defer s.Unlock()
+	_, ok := s.info.Topics[topic]
+	return ok
+}
+
 func (s *Session) allSubscribes() ([]string, []byte, error) {
 	s.Lock()
 
@@ -157,9 +206,10 @@ func (s *Session) allSubscribes() ([]string, []byte, error) {
 	return sub, qos, nil
 }
 
-func (s *Session) getPacketFromMsg(topic string, payload []byte, qos byte) *packets.PublishPacket {
+func (s *Session) getPacketFromMsg(topic string, payload []byte, qos byte, retain bool) *packets.PublishPacket {
 	p := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
 	p.Qos = qos
+	p.Retain = retain
 	p.TopicName = topic
 	p.Payload = payload
 	p.MessageID = s.nextID
@@ -170,6 +220,16 @@ func (s *Session) getPacketFromMsg(topic string, payload []byte, qos byte) *pack
 }
 
 func (s *Session) publish(span *model.SpanContext, topic string, payload []byte, qos byte) {
+	s.doPublish(span, topic, payload, qos, false)
+}
+
+// publishRetained publishes a retained message to the client, which is
+// sent when the client subscribes a matching topic.
+func (s *Session) publishRetained(topic string, payload []byte, qos byte) {
+	s.doPublish(nil, topic, payload, qos, true)
+}
+
+func (s *Session) doPublish(span *model.SpanContext, topic string, payload []byte, qos byte, retain bool) {
 	client := s.broker.getClient(s.info.ClientID)
 	if client == nil {
 		logger.SpanErrorf(span, "client %s is offline in eg %v", s.info.ClientID, s.broker.egName)
@@ -180,7 +240,7 @@ func (s *Session) publish(span *model.SpanContext, topic string, payload []byte,
 	defer s.Unlock()
 
 	logger.SpanDebugf(span, "session %v publish %v", s.info.ClientID, topic)
-	p := s.getPacketFromMsg(topic, payload, qos)
+	p := s.getPacketFromMsg(topic, payload, qos, retain)
 	if qos == QoS0 {
 		select {
 		case client.writeCh <- p:
@@ -188,17 +248,37 @@ func (s *Session) publish(span *model.SpanContext, topic string, payload []byte,
 		}
 	} else if qos == QoS1 {
 		msg := newMsg(topic, payload, qos)
+		msg.PacketID = p.MessageID
 		s.pending[p.MessageID] = msg
 		s.pendingQueue = append(s.pendingQueue, p.MessageID)
+		s.dropOverflowPending()
+		s.store()
 		client.writePacket(p)
 	} else {
 		logger.SpanErrorf(span, "publish message with qos=2 is not supported currently")
 	}
 }
 
+// dropOverflowPending drops the oldest pending messages if there are too
+// many of them.
+func (s *Session) dropOverflowPending() {
+	max := s.broker.spec.Retention.MaxInflightMessages
+	for len(s.pending) > max && len(s.pendingQueue) > 0 {
+		id := s.pendingQueue[0]
+		s.pendingQueue = s.pendingQueue[1:]
+		if _, ok := s.pending[id]; ok {
+			logger.SpanDebugf(nil, "session %v drop pending message %d", s.info.ClientID, id)
+			delete(s.pending, id)
+		}
+	}
+}
+
 func (s *Session) puback(p *packets.PubackPacket) {
 	s.Lock()
-	delete(s.pending, p.MessageID)
+	if _, ok := s.pending[p.MessageID]; ok {
+		delete(s.pending, p.MessageID)
+		s.store()
+	}
 	s.Unlock()
 }
 
@@ -206,6 +286,38 @@ func (s *Session) cleanSession() bool {
 	return s.info.CleanFlag
 }
 
+// setExpiry sets the session expiry interval of MQTT 5.0 clients, the
+// session is cleaned when the client disconnects if expiry is 0.
+func (s *Session) setExpiry(expiry uint32) {
+	s.Lock()
+	s.info.CleanFlag = expiry == 0
+	s.info.SessionExpiry = expiry
+	s.info.ExpireAt = 0
+	s.store()
+	s.Unlock()
+}
+
+// startExpiry starts the expiry of the session when the client
+// disconnects, it returns 0 if the session never expires.
+func (s *Session) startExpiry() time.Duration {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.info.SessionExpiry == 0 || s.info.SessionExpiry == maxSessionExpiry {
+		return 0
+	}
+	d := time.Duration(s.info.SessionExpiry) * time.Second
+	s.info.ExpireAt = time.Now().Add(d).Unix()
+	s.store()
+	return d
+}
+
+func (s *Session) expired() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.info.ExpireAt != 0 && time.Now().Unix() >= s.info.ExpireAt
+}
+
 func (s *Session) close() {
 	close(s.done)
 }
@@ -224,6 +336,7 @@ func (s *Session) doResend() {
 			// find first msg need to resend
 			s.pendingQueue = s.pendingQueue[i:]
 			p := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+			p.Dup = true
 			p.Qos = byte(val.QoS)
 			p.TopicName = val.Topic
 			payload, err := base64.StdEncoding.DecodeString(val.B64Payload)
@@ -19,9 +19,11 @@ package mqttproxy
 
 import (
 	"sync"
+	"time"
 
 	"github.com/eclipse/paho.mqtt.golang/packets"
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codectool"
 )
 
 type (
@@ -45,7 +47,7 @@ func newSessionManager(b *Broker, store storage) *SessionManager {
 	sm := &SessionManager{
 		broker:  b,
 		store:   store,
-		storeCh: make(chan SessionStore),
+		storeCh: make(chan SessionStore, 1024),
 		done:    make(chan struct{}),
 	}
 	go sm.doStore()
@@ -92,6 +94,7 @@ func (sm *SessionManager) newSessionFromJSON(str *string) *Session {
 	if err != nil {
 		return nil
 	}
+	sess.restoreInflight()
 	go sess.backgroundResendPending()
 	return sess
 }
@@ -120,6 +123,34 @@ func (sm *SessionManager) delLocal(clientID string) {
 	}
 }
 
+// expireAfter deletes the session of clientID from the storage after d,
+// unless the session is resumed by then.
+func (sm *SessionManager) expireAfter(clientID string, d time.Duration) {
+	time.AfterFunc(d, func() {
+		select {
+		case <-sm.done:
+			return
+		default:
+		}
+
+		if sm.broker.getClient(clientID) != nil {
+			return
+		}
+		str, err := sm.store.get(sessionStoreKey(clientID))
+		if err != nil || str == nil {
+			return
+		}
+		info := &SessionInfo{}
+		if err := codectool.Unmarshal([]byte(*str), info); err != nil {
+			return
+		}
+		if info.ExpireAt != 0 && time.Now().Unix() >= info.ExpireAt {
+			logger.SpanDebugf(nil, "session %v expired", clientID)
+			sm.delDB(clientID)
+		}
+	})
+}
+
 func (sm *SessionManager) delDB(clientID string) {
 	err := sm.store.delete(sessionStoreKey(clientID))
 	if err != nil {
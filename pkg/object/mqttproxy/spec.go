@@ -25,9 +25,12 @@ import (
 const (
 	sessionPrefix              = "/mqtt/sessionMgr/clientID/%s"
 	topicPrefix                = "/mqtt/topicMgr/topic/%s"
+	retainPrefix               = "/mqtt/retainMgr/%s/topic/%s"
+	aclPrefix                  = "/mqtt/aclMgr/%s/rule/%s"
 	mqttAPITopicPublishPrefix  = "/mqttproxy/%s/topics/publish"
 	mqttAPISessionQueryPrefix  = "/mqttproxy/%s/session/query"
 	mqttAPISessionDeletePrefix = "/mqttproxy/%s/sessions"
+	mqttAPIACLPrefix           = "/mqttproxy/%s/acls"
 )
 
 // PacketType is mqtt packet type
@@ -71,6 +74,73 @@ type (
 		ConnectionLimit      *RateLimit    `json:"connectionLimit" jsonschema:"omitempty"`
 		ClientPublishLimit   *RateLimit    `json:"clientPublishLimit" jsonschema:"omitempty"`
 		Rules                []*Rule       `json:"rules" jsonschema:"omitempty"`
+
+		// TopicAliasMaximum is the max topic alias accepted from MQTT 5.0
+		// clients, 0 means topic alias is not supported.
+		TopicAliasMaximum uint16 `json:"topicAliasMaximum" jsonschema:"omitempty"`
+
+		Retention *RetentionSpec `json:"retention" jsonschema:"omitempty"`
+		ACL       *ACLSpec       `json:"acl" jsonschema:"omitempty"`
+		Bridges   []*BridgeSpec  `json:"bridges" jsonschema:"omitempty"`
+	}
+
+	// BridgeSpec describes a bridge to an external MQTT broker.
+	// server: address of the external broker, like tcp://host:1883 or ssl://host:8883
+	// clientID: client ID used to connect the external broker, default {member}-{mqttproxy}-{bridge}
+	// maxReconnectInterval: the reconnect interval doubles from 1 second up to it, default 1m
+	BridgeSpec struct {
+		Name                 string         `json:"name" jsonschema:"required"`
+		Server               string         `json:"server" jsonschema:"required"`
+		ClientID             string         `json:"clientID" jsonschema:"omitempty"`
+		Username             string         `json:"username" jsonschema:"omitempty"`
+		Password             string         `json:"password" jsonschema:"omitempty"`
+		CleanSession         bool           `json:"cleanSession" jsonschema:"omitempty"`
+		KeepAlive            int            `json:"keepAlive" jsonschema:"omitempty,minimum=0"`
+		MaxReconnectInterval string         `json:"maxReconnectInterval" jsonschema:"omitempty,format=duration"`
+		TLS                  *BridgeTLSSpec `json:"tls" jsonschema:"omitempty"`
+		Topics               []*BridgeTopic `json:"topics" jsonschema:"required"`
+	}
+
+	// BridgeTLSSpec is the TLS configuration of the connection to the
+	// external broker.
+	BridgeTLSSpec struct {
+		CertBase64         string `json:"certBase64" jsonschema:"omitempty,format=base64"`
+		KeyBase64          string `json:"keyBase64" jsonschema:"omitempty,format=base64"`
+		RootCertBase64     string `json:"rootCertBase64" jsonschema:"omitempty,format=base64"`
+		InsecureSkipVerify bool   `json:"insecureSkipVerify" jsonschema:"omitempty"`
+	}
+
+	// BridgeTopic describes the topics bridged between Easegress and the
+	// external broker, a topic localPrefix+X is mapped to remotePrefix+X,
+	// where X matches filter.
+	// direction: in for messages from the external broker to local clients,
+	// out for messages from local clients to the external broker, or both.
+	// qos: max QoS of the bridged messages, higher QoS is downgraded.
+	BridgeTopic struct {
+		Direction    string `json:"direction" jsonschema:"required,enum=in,enum=out,enum=both"`
+		Filter       string `json:"filter" jsonschema:"required"`
+		LocalPrefix  string `json:"localPrefix" jsonschema:"omitempty"`
+		RemotePrefix string `json:"remotePrefix" jsonschema:"omitempty"`
+		QoS          int    `json:"qos" jsonschema:"omitempty,enum=0,enum=1"`
+	}
+
+	// ACLSpec enables the topic ACL of clients, the rules are managed by
+	// the admin API.
+	// defaultPermission: permission when no rule matches, allow or deny, default allow
+	ACLSpec struct {
+		DefaultPermission string `json:"defaultPermission" jsonschema:"omitempty,enum=,enum=allow,enum=deny"`
+	}
+
+	// RetentionSpec limits the state persisted in the cluster.
+	// maxInflightMessages: max QoS1 messages not acknowledged by a client kept in its session, default 100
+	// maxRetainedMessages: max retained messages, default 10000
+	// maxRetainedPayloadSize: max payload size in bytes of a retained message, default 65536
+	// retainedMessageTTL: how long a retained message is kept, default forever
+	RetentionSpec struct {
+		MaxInflightMessages    int    `json:"maxInflightMessages" jsonschema:"omitempty,minimum=0"`
+		MaxRetainedMessages    int    `json:"maxRetainedMessages" jsonschema:"omitempty,minimum=0"`
+		MaxRetainedPayloadSize int    `json:"maxRetainedPayloadSize" jsonschema:"omitempty,minimum=0"`
+		RetainedMessageTTL     string `json:"retainedMessageTTL" jsonschema:"omitempty,format=duration"`
 	}
 
 	// Rule used to route MQTT packets to different pipelines
@@ -122,3 +192,11 @@ func (spec *Spec) tlsConfig() (*tls.Config, error) {
 func sessionStoreKey(clientID string) string {
 	return fmt.Sprintf(sessionPrefix, clientID)
 }
+
+func retainStoreKey(name, topic string) string {
+	return fmt.Sprintf(retainPrefix, name, topic)
+}
+
+func aclStoreKey(name, rule string) string {
+	return fmt.Sprintf(aclPrefix, name, rule)
+}
@@ -19,12 +19,16 @@ package mqttproxy
 
 import (
 	"fmt"
+	"math/rand"
 	"strings"
 	"sync"
 
 	lru "github.com/hashicorp/golang-lru"
 )
 
+// sharePrefix is the prefix of the shared subscriptions of MQTT 5.0.
+const sharePrefix = "$share/"
+
 // TopicManager to manage topic subscribe and unsubscribe in MQTT
 type TopicManager struct {
 	sync.RWMutex
@@ -122,7 +126,22 @@ func (mgr *TopicManager) findSubscribers(topic string) (map[string]byte, error)
 	return ans, nil
 }
 
+// parseSharedTopic parses a shared subscription, whose format is
+// $share/{ShareName}/{filter}.
+func parseSharedTopic(topic string) (group, filter string, shared bool) {
+	if !strings.HasPrefix(topic, sharePrefix) {
+		return "", topic, false
+	}
+	rest := topic[len(sharePrefix):]
+	i := strings.IndexByte(rest, '/')
+	if i <= 0 || i == len(rest)-1 {
+		return "", topic, false
+	}
+	return rest[:i], rest[i+1:], true
+}
+
 func (mgr *TopicManager) insert(topic string, qos byte, clientID string) error {
+	group, topic, shared := parseSharedTopic(topic)
 	levels, err := mgr.getLevels(topic)
 	if err != nil {
 		return err
@@ -138,11 +157,21 @@ func (mgr *TopicManager) insert(topic string, qos byte, clientID string) error {
 		}
 		node = nextNode
 	}
-	node.clients[clientID] = qos
+	if shared {
+		members, ok := node.shared[group]
+		if !ok {
+			members = make(map[string]byte)
+			node.shared[group] = members
+		}
+		members[clientID] = qos
+	} else {
+		node.clients[clientID] = qos
+	}
 	return nil
 }
 
 func (mgr *TopicManager) remove(topic string, clientID string) error {
+	group, topic, shared := parseSharedTopic(topic)
 	levels, err := mgr.getLevels(topic)
 	if err != nil {
 		return err
@@ -158,12 +187,21 @@ func (mgr *TopicManager) remove(topic string, clientID string) error {
 		prevNodes = append(prevNodes, node)
 		node = nextNode
 	}
-	delete(node.clients, clientID)
+	if shared {
+		if members, ok := node.shared[group]; ok {
+			delete(members, clientID)
+			if len(members) == 0 {
+				delete(node.shared, group)
+			}
+		}
+	} else {
+		delete(node.clients, clientID)
+	}
 
 	// clear memory
 	for i := len(prevNodes) - 1; i >= 0; i-- {
 		node = prevNodes[i].nodes[levels[i]]
-		if len(node.clients) == 0 && len(node.nodes) == 0 {
+		if len(node.clients) == 0 && len(node.shared) == 0 && len(node.nodes) == 0 {
 			delete(prevNodes[i].nodes, levels[i])
 		} else {
 			return nil
@@ -223,18 +261,34 @@ func (t *topicLevelManager) get(topic string) ([]string, error) {
 type topicNode struct {
 	// client with their qos
 	clients map[string]byte
-	nodes   map[string]*topicNode
+	// shared subscription groups, and clients of the group with their qos
+	shared map[string]map[string]byte
+	nodes  map[string]*topicNode
 }
 
 func newNode() *topicNode {
 	return &topicNode{
 		clients: make(map[string]byte),
+		shared:  make(map[string]map[string]byte),
 		nodes:   make(map[string]*topicNode),
 	}
 }
 
+// addClients adds the subscribed clients to ans, a message of a shared
+// subscription is delivered to only one client of the group, which is
+// chosen randomly.
 func (node *topicNode) addClients(ans map[string]byte) {
 	for client, qos := range node.clients {
 		ans[client] = qos
 	}
+	for _, members := range node.shared {
+		n := rand.Intn(len(members))
+		for client, qos := range members {
+			if n == 0 {
+				ans[client] = qos
+				break
+			}
+			n--
+		}
+	}
 }
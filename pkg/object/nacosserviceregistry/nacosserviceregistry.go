@@ -29,11 +29,11 @@ import (
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/v"
 
-	"github.com/nacos-group/nacos-sdk-go/clients"
-	"github.com/nacos-group/nacos-sdk-go/clients/naming_client"
-	"github.com/nacos-group/nacos-sdk-go/common/constant"
-	"github.com/nacos-group/nacos-sdk-go/model"
-	"github.com/nacos-group/nacos-sdk-go/vo"
+	"github.com/nacos-group/nacos-sdk-go/v2/clients"
+	"github.com/nacos-group/nacos-sdk-go/v2/clients/naming_client"
+	"github.com/nacos-group/nacos-sdk-go/v2/common/constant"
+	"github.com/nacos-group/nacos-sdk-go/v2/model"
+	"github.com/nacos-group/nacos-sdk-go/v2/vo"
 )
 
 const (
@@ -48,6 +48,10 @@ const (
 
 	// MetaKeyInstanceID is the key of service instance ID.
 	MetaKeyInstanceID = "InstanceID"
+
+	// emptyHostsError is in the error reported to the subscriptions by
+	// the client if the service has no instance.
+	emptyHostsError = "hosts is empty"
 )
 
 func init() {
@@ -61,16 +65,25 @@ type (
 		spec      *Spec
 
 		serviceRegistry *serviceregistry.ServiceRegistry
-		firstDone       bool
-		instances       map[string]*serviceregistry.ServiceInstanceSpec
 		notify          chan *serviceregistry.RegistryEvent
 
+		// instancesMutex protects the instances, which are updated by both
+		// the full synchronization and the pushes of subscribed services.
+		instancesMutex sync.Mutex
+		firstDone      bool
+		instances      map[string]*serviceregistry.ServiceInstanceSpec
+		// subscriptions are the subscribed services, the key is the
+		// service name.
+		subscriptions map[string]*vo.SubscribeParam
+
 		clientMutex sync.RWMutex
 		client      naming_client.INamingClient
 
 		statusMutex  sync.Mutex
 		instancesNum map[string]int
 
+		registrar *serviceregistry.SelfRegistrar
+
 		done chan struct{}
 	}
 
@@ -81,6 +94,8 @@ type (
 		Namespace    string        `json:"namespace" jsonschema:"omitempty"`
 		Username     string        `json:"username" jsonschema:"omitempty"`
 		Password     string        `json:"password" jsonschema:"omitempty"`
+
+		SelfRegistration *serviceregistry.SelfRegistrationSpec `json:"selfRegistration,omitempty" jsonschema:"omitempty"`
 	}
 
 	// ServerSpec is the server config of Nacos.
@@ -89,6 +104,10 @@ type (
 		ContextPath string `json:"contextPath" jsonschema:"omitempty"`
 		IPAddr      string `json:"ipAddr" jsonschema:"required"`
 		Port        uint16 `json:"port" jsonschema:"required"`
+		// GRPCPort is the port of the gRPC service of Nacos 2.x, which
+		// pushes the changes of the subscribed services, it defaults to
+		// Port + 1000.
+		GRPCPort uint16 `json:"grpcPort" jsonschema:"omitempty"`
 	}
 
 	// Status is the status of NacosServiceRegistry.
@@ -143,6 +162,8 @@ func (n *NacosServiceRegistry) reload() {
 		Instance().(*serviceregistry.ServiceRegistry)
 	n.notify = make(chan *serviceregistry.RegistryEvent, 10)
 	n.firstDone = false
+	n.instances = nil
+	n.subscriptions = map[string]*vo.SubscribeParam{}
 
 	n.instancesNum = map[string]int{}
 	n.done = make(chan struct{})
@@ -152,6 +173,11 @@ func (n *NacosServiceRegistry) reload() {
 		logger.Errorf("%s get nacos client failed: %v", n.superSpec.Name(), err)
 	}
 
+	n.registrar = nil
+	if n.spec.SelfRegistration != nil {
+		n.registrar = serviceregistry.NewSelfRegistrar(n.spec.SelfRegistration, n, n.superSpec.Super().Options())
+	}
+
 	n.serviceRegistry.RegisterRegistry(n)
 
 	go n.run()
@@ -200,6 +226,7 @@ func (n *NacosServiceRegistry) buildClient() (naming_client.INamingClient, error
 			IpAddr:      serverSpec.IPAddr,
 			ContextPath: serverSpec.ContextPath,
 			Port:        uint64(serverSpec.Port),
+			GrpcPort:    uint64(serverSpec.GRPCPort),
 			Scheme:      serverSpec.Scheme,
 		})
 	}
@@ -227,11 +254,13 @@ func (n *NacosServiceRegistry) closeClient() {
 		return
 	}
 
+	n.client.CloseClient()
 	n.client = nil
 }
 
 func (n *NacosServiceRegistry) run() {
 	defer n.closeClient()
+	defer n.unsubscribeAll()
 
 	syncInterval, err := time.ParseDuration(n.spec.SyncInterval)
 	if err != nil {
@@ -246,19 +275,144 @@ func (n *NacosServiceRegistry) run() {
 		select {
 		case <-n.done:
 			return
-		case <-time.After(syncInterval):
+		case <-time.After(serviceregistry.JitterInterval(syncInterval)):
 			n.update()
 		}
 	}
 }
 
+// update renews the self registration and fetches all instances, the
+// changes between two updates are pushed by Nacos to the subscriptions,
+// so it is the fallback if any push is missed, and subscribes the new
+// services.
 func (n *NacosServiceRegistry) update() {
-	instances, err := n.ListAllServiceInstances()
+	if n.registrar != nil {
+		n.registrar.Sync()
+	}
+
+	serviceNames, err := n.listServiceNames()
 	if err != nil {
 		logger.Errorf("list all service instances failed: %v", err)
 		return
 	}
 
+	instances, err := n.listServicesInstances(serviceNames)
+	if err != nil {
+		logger.Errorf("list all service instances failed: %v", err)
+		return
+	}
+
+	n.instancesMutex.Lock()
+	n.notifyInstances(instances)
+	n.instancesMutex.Unlock()
+
+	n.updateSubscriptions(serviceNames)
+}
+
+// updateSubscriptions subscribes the new services and unsubscribes the
+// removed ones.
+func (n *NacosServiceRegistry) updateSubscriptions(serviceNames []string) {
+	client, err := n.getClient()
+	if err != nil {
+		logger.Errorf("%s get nacos client failed: %v", n.superSpec.Name(), err)
+		return
+	}
+
+	services := make(map[string]struct{}, len(serviceNames))
+	for _, serviceName := range serviceNames {
+		services[serviceName] = struct{}{}
+		if n.subscriptions[serviceName] != nil {
+			continue
+		}
+
+		serviceName := serviceName
+		param := &vo.SubscribeParam{
+			ServiceName: serviceName,
+			SubscribeCallback: func(services []model.Instance, err error) {
+				n.onServiceChanged(serviceName, services, err)
+			},
+		}
+		if err := client.Subscribe(param); err != nil {
+			logger.Errorf("%s subscribe service %s failed: %v", n.superSpec.Name(), serviceName, err)
+			continue
+		}
+		n.subscriptions[serviceName] = param
+	}
+
+	for serviceName, param := range n.subscriptions {
+		if _, exists := services[serviceName]; exists {
+			continue
+		}
+		if err := client.Unsubscribe(param); err != nil {
+			logger.Errorf("%s unsubscribe service %s failed: %v", n.superSpec.Name(), serviceName, err)
+			continue
+		}
+		delete(n.subscriptions, serviceName)
+	}
+}
+
+func (n *NacosServiceRegistry) unsubscribeAll() {
+	client, err := n.getClient()
+	if err != nil {
+		return
+	}
+
+	for serviceName, param := range n.subscriptions {
+		if err := client.Unsubscribe(param); err != nil {
+			logger.Errorf("%s unsubscribe service %s failed: %v", n.superSpec.Name(), serviceName, err)
+		}
+	}
+	n.subscriptions = map[string]*vo.SubscribeParam{}
+}
+
+// onServiceChanged is called when Nacos pushes the instances of a
+// subscribed service.
+func (n *NacosServiceRegistry) onServiceChanged(serviceName string, services []model.Instance, err error) {
+	// The client reports an error if the service has no instance, the
+	// last known instances are kept on other errors.
+	if err != nil {
+		if !strings.Contains(err.Error(), emptyHostsError) {
+			logger.Errorf("%s receive instances of service %s failed: %v", n.superSpec.Name(), serviceName, err)
+			return
+		}
+		services = nil
+	}
+
+	serviceInstances := make(map[string]*serviceregistry.ServiceInstanceSpec)
+	for i := range services {
+		serviceInstance := n.nacosInstanceToServiceInstance(&services[i])
+		if err := serviceInstance.Validate(); err != nil {
+			logger.Errorf("%+v is invalid: %v", serviceInstance, err)
+			return
+		}
+		serviceInstances[serviceInstance.Key()] = serviceInstance
+	}
+
+	n.instancesMutex.Lock()
+	defer n.instancesMutex.Unlock()
+
+	// pushes before the first full synchronization are dropped, the full
+	// synchronization includes them.
+	if !n.firstDone {
+		return
+	}
+
+	instances := make(map[string]*serviceregistry.ServiceInstanceSpec, len(n.instances))
+	for key, instance := range n.instances {
+		if instance.ServiceName != serviceName {
+			instances[key] = instance
+		}
+	}
+	for key, instance := range serviceInstances {
+		instances[key] = instance
+	}
+
+	n.notifyInstances(instances)
+}
+
+// notifyInstances notifies the changes of the instances, the caller must
+// hold instancesMutex.
+func (n *NacosServiceRegistry) notifyInstances(instances map[string]*serviceregistry.ServiceInstanceSpec) {
 	instancesNum := make(map[string]int)
 	for _, instance := range instances {
 		instancesNum[instance.ServiceName]++
@@ -280,7 +434,11 @@ func (n *NacosServiceRegistry) update() {
 		return
 	}
 
-	n.notify <- event
+	select {
+	case n.notify <- event:
+	case <-n.done:
+		return
+	}
 	n.instances = instances
 
 	n.statusMutex.Lock()
@@ -288,6 +446,18 @@ func (n *NacosServiceRegistry) update() {
 	n.statusMutex.Unlock()
 }
 
+// Ready returns nil if the nacos client is built, so the pipelines using
+// the registry are ready to serve.
+func (n *NacosServiceRegistry) Ready() error {
+	n.clientMutex.RLock()
+	defer n.clientMutex.RUnlock()
+
+	if n.client == nil {
+		return fmt.Errorf("nacos client is not built")
+	}
+	return nil
+}
+
 // Status returns status of NacosServiceRegister.
 func (n *NacosServiceRegistry) Status() *supervisor.Status {
 	s := &Status{}
@@ -312,6 +482,10 @@ func (n *NacosServiceRegistry) Status() *supervisor.Status {
 
 // Close closes NacosServiceRegistry.
 func (n *NacosServiceRegistry) Close() {
+	if n.registrar != nil {
+		n.registrar.Deregister()
+	}
+
 	n.serviceRegistry.DeregisterRegistry(n.Name())
 
 	close(n.done)
@@ -419,6 +593,15 @@ func (n *NacosServiceRegistry) ListServiceInstances(serviceName string) (map[str
 
 // ListAllServiceInstances list all service instances from the registry.
 func (n *NacosServiceRegistry) ListAllServiceInstances() (map[string]*serviceregistry.ServiceInstanceSpec, error) {
+	serviceNames, err := n.listServiceNames()
+	if err != nil {
+		return nil, err
+	}
+
+	return n.listServicesInstances(serviceNames)
+}
+
+func (n *NacosServiceRegistry) listServiceNames() ([]string, error) {
 	client, err := n.getClient()
 	if err != nil {
 		return nil, fmt.Errorf("%s get nacos client failed: %v",
@@ -446,6 +629,16 @@ func (n *NacosServiceRegistry) ListAllServiceInstances() (map[string]*servicereg
 		pageNo++
 	}
 
+	return serviceNames, nil
+}
+
+func (n *NacosServiceRegistry) listServicesInstances(serviceNames []string) (map[string]*serviceregistry.ServiceInstanceSpec, error) {
+	client, err := n.getClient()
+	if err != nil {
+		return nil, fmt.Errorf("%s get nacos client failed: %v",
+			n.superSpec.Name(), err)
+	}
+
 	instances := make(map[string]*serviceregistry.ServiceInstanceSpec)
 	for _, serviceName := range serviceNames {
 		service, err := client.GetService(vo.GetServiceParam{
@@ -0,0 +1,254 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nacosserviceregistry
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/nacos-group/nacos-sdk-go/v2/clients/naming_client"
+	"github.com/nacos-group/nacos-sdk-go/v2/model"
+	"github.com/nacos-group/nacos-sdk-go/v2/vo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/serviceregistry"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+type mockNamingClient struct {
+	naming_client.INamingClient
+
+	mutex         sync.Mutex
+	services      map[string][]model.Instance
+	subscriptions map[string]*vo.SubscribeParam
+}
+
+func (c *mockNamingClient) GetAllServicesInfo(param vo.GetAllServiceInfoParam) (model.ServiceList, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	list := model.ServiceList{}
+	if param.PageNo > 1 {
+		return list, nil
+	}
+	for name := range c.services {
+		list.Doms = append(list.Doms, name)
+	}
+	list.Count = int64(len(list.Doms))
+	return list, nil
+}
+
+func (c *mockNamingClient) GetService(param vo.GetServiceParam) (model.Service, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	hosts, ok := c.services[param.ServiceName]
+	if !ok {
+		return model.Service{}, fmt.Errorf("service %s not found", param.ServiceName)
+	}
+	return model.Service{Name: param.ServiceName, Hosts: hosts}, nil
+}
+
+func (c *mockNamingClient) Subscribe(param *vo.SubscribeParam) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.subscriptions[param.ServiceName] = param
+	return nil
+}
+
+func (c *mockNamingClient) Unsubscribe(param *vo.SubscribeParam) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.subscriptions, param.ServiceName)
+	return nil
+}
+
+func (c *mockNamingClient) CloseClient() {}
+
+// push pushes the instances of the service to the subscription.
+func (c *mockNamingClient) push(serviceName string, instances []model.Instance, err error) {
+	c.mutex.Lock()
+	param := c.subscriptions[serviceName]
+	c.mutex.Unlock()
+	param.SubscribeCallback(instances, err)
+}
+
+func newTestInstance(serviceName, id string, port uint64) model.Instance {
+	return model.Instance{
+		InstanceId:  id,
+		Ip:          "127.0.0.1",
+		Port:        port,
+		Weight:      1,
+		ServiceName: "DEFAULT_GROUP@@" + serviceName,
+		Enable:      true,
+		Healthy:     true,
+	}
+}
+
+func newTestRegistry(t *testing.T, client naming_client.INamingClient) *NacosServiceRegistry {
+	spec, err := supervisor.NewSpec(`
+name: nacos-registry
+kind: NacosServiceRegistry
+syncInterval: 10s
+servers:
+- ipAddr: 127.0.0.1
+  port: 8848
+`)
+	if err != nil {
+		t.Fatalf("create spec failed: %v", err)
+	}
+
+	return &NacosServiceRegistry{
+		superSpec:     spec,
+		spec:          spec.ObjectSpec().(*Spec),
+		notify:        make(chan *serviceregistry.RegistryEvent, 10),
+		subscriptions: map[string]*vo.SubscribeParam{},
+		instancesNum:  map[string]int{},
+		client:        client,
+		done:          make(chan struct{}),
+	}
+}
+
+func nextEvent(t *testing.T, n *NacosServiceRegistry) *serviceregistry.RegistryEvent {
+	select {
+	case event := <-n.notify:
+		return event
+	default:
+		t.Fatalf("no event is notified")
+		return nil
+	}
+}
+
+func assertNoEvent(t *testing.T, n *NacosServiceRegistry) {
+	select {
+	case event := <-n.notify:
+		t.Fatalf("unexpected event: %+v", event)
+	default:
+	}
+}
+
+func TestSubscriptionPush(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &mockNamingClient{
+		services: map[string][]model.Instance{
+			"service-a": {newTestInstance("service-a", "a-1", 8080)},
+			"service-b": {newTestInstance("service-b", "b-1", 8081)},
+		},
+		subscriptions: map[string]*vo.SubscribeParam{},
+	}
+	n := newTestRegistry(t, client)
+
+	// pushes before the first full synchronization are dropped.
+	n.updateSubscriptions([]string{"service-a"})
+	client.push("service-a", []model.Instance{newTestInstance("service-a", "a-2", 8082)}, nil)
+	assertNoEvent(t, n)
+
+	n.update()
+	event := nextEvent(t, n)
+	assert.True(event.UseReplace)
+	assert.Len(event.Replace, 2)
+	assert.Contains(event.Replace, "nacos-registry/service-a/a-1")
+	assert.Contains(event.Replace, "nacos-registry/service-b/b-1")
+	assert.Len(client.subscriptions, 2)
+
+	// a push replaces the instances of the service only.
+	client.push("service-a", []model.Instance{
+		newTestInstance("service-a", "a-1", 8080),
+		newTestInstance("service-a", "a-2", 8082),
+	}, nil)
+	event = nextEvent(t, n)
+	assert.False(event.UseReplace)
+	assert.Len(event.Apply, 1)
+	assert.Contains(event.Apply, "nacos-registry/service-a/a-2")
+	assert.Empty(event.Delete)
+	assert.Equal(map[string]int{"service-a": 2, "service-b": 1}, n.instancesNum)
+
+	// the last known instances are kept on errors.
+	client.push("service-a", nil, fmt.Errorf("network is unreachable"))
+	assertNoEvent(t, n)
+	assert.Len(n.instances, 3)
+
+	// the service has no instance.
+	client.push("service-a", nil, fmt.Errorf("[client.Subscribe] subscribe failed,hosts is empty"))
+	event = nextEvent(t, n)
+	assert.Len(event.Delete, 2)
+	assert.Contains(event.Delete, "nacos-registry/service-a/a-1")
+	assert.Contains(event.Delete, "nacos-registry/service-a/a-2")
+	assert.Equal(map[string]int{"service-b": 1}, n.instancesNum)
+}
+
+func TestFullSyncMerge(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &mockNamingClient{
+		services: map[string][]model.Instance{
+			"service-a": {newTestInstance("service-a", "a-1", 8080)},
+			"service-b": {newTestInstance("service-b", "b-1", 8081)},
+		},
+		subscriptions: map[string]*vo.SubscribeParam{},
+	}
+	n := newTestRegistry(t, client)
+
+	n.update()
+	nextEvent(t, n)
+
+	// a missed push is fixed by the next full synchronization, and the
+	// removed service is unsubscribed.
+	client.mutex.Lock()
+	client.services["service-a"] = append(client.services["service-a"], newTestInstance("service-a", "a-2", 8082))
+	delete(client.services, "service-b")
+	client.services["service-c"] = []model.Instance{newTestInstance("service-c", "c-1", 8083)}
+	client.mutex.Unlock()
+
+	n.update()
+	event := nextEvent(t, n)
+	assert.False(event.UseReplace)
+	assert.Len(event.Apply, 2)
+	assert.Contains(event.Apply, "nacos-registry/service-a/a-2")
+	assert.Contains(event.Apply, "nacos-registry/service-c/c-1")
+	assert.Len(event.Delete, 1)
+	assert.Contains(event.Delete, "nacos-registry/service-b/b-1")
+
+	assert.Len(client.subscriptions, 2)
+	assert.Contains(client.subscriptions, "service-a")
+	assert.Contains(client.subscriptions, "service-c")
+	assert.Len(n.subscriptions, 2)
+
+	// nothing is notified if nothing changed.
+	n.update()
+	assertNoEvent(t, n)
+
+	// the pushes after the full synchronization are merged with it.
+	client.push("service-c", []model.Instance{newTestInstance("service-c", "c-2", 8084)}, nil)
+	event = nextEvent(t, n)
+	assert.Len(event.Apply, 1)
+	assert.Contains(event.Apply, "nacos-registry/service-c/c-2")
+	assert.Len(event.Delete, 1)
+	assert.Contains(event.Delete, "nacos-registry/service-c/c-1")
+	assert.Len(n.instances, 3)
+}
@@ -0,0 +1,279 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// GraphFormatDOT is the format of Graphviz DOT.
+	GraphFormatDOT = "dot"
+	// GraphFormatMermaid is the format of Mermaid flowchart.
+	GraphFormatMermaid = "mermaid"
+)
+
+// resiliencePolicyKeys are the fields referencing the resilience policies
+// of the pipeline in the specs of filters, e.g. the pools of Proxy.
+var resiliencePolicyKeys = map[string]string{
+	"retryPolicy":          "retry",
+	"circuitBreakerPolicy": "circuitBreaker",
+}
+
+type (
+	// Graph is the flow of a pipeline.
+	Graph struct {
+		Nodes []*GraphNode
+		Edges []*GraphEdge
+	}
+
+	// GraphNode is a node of the flow, the name is the alias of the filter
+	// if there is one.
+	GraphNode struct {
+		Name   string
+		Filter string
+		Kind   string
+		// Resilience are the resilience policies wrapping the filter, in
+		// the format of type:name.
+		Resilience []string
+	}
+
+	// GraphEdge is an edge of the flow, the label of a jumpIf edge is the
+	// result of the filter.
+	GraphEdge struct {
+		From   string
+		To     string
+		Label  string
+		JumpIf bool
+	}
+)
+
+// Graph returns the flow of the pipeline, the flow is the filters in order
+// if the spec doesn't define one. The filters fall through to the next one,
+// and the last one falls through to END.
+func (s *Spec) Graph() *Graph {
+	kinds := map[string]string{}
+	resilience := map[string][]string{}
+	for _, f := range s.Filters {
+		name, _ := f["name"].(string)
+		kinds[name], _ = f["kind"].(string)
+		resilience[name] = findResiliencePolicies(f)
+	}
+
+	flow := s.Flow
+	if len(flow) == 0 {
+		for _, f := range s.Filters {
+			name, _ := f["name"].(string)
+			flow = append(flow, FlowNode{FilterName: name})
+		}
+	}
+
+	g := &Graph{}
+	for i := range flow {
+		node := &flow[i]
+		name := node.filterAlias()
+		g.Nodes = append(g.Nodes, &GraphNode{
+			Name:       name,
+			Filter:     node.FilterName,
+			Kind:       kinds[node.FilterName],
+			Resilience: resilience[node.FilterName],
+		})
+
+		results := make([]string, 0, len(node.JumpIf))
+		for result := range node.JumpIf {
+			results = append(results, result)
+		}
+		sort.Strings(results)
+		for _, result := range results {
+			label := result
+			if label == "" {
+				label = "any"
+			}
+			g.Edges = append(g.Edges, &GraphEdge{From: name, To: node.JumpIf[result], Label: label, JumpIf: true})
+		}
+
+		if node.FilterName == BuiltInFilterEnd {
+			continue
+		}
+		next := BuiltInFilterEnd
+		if i+1 < len(flow) {
+			next = flow[i+1].filterAlias()
+		}
+		g.Edges = append(g.Edges, &GraphEdge{From: name, To: next})
+	}
+
+	// Add the targets not in the flow, i.e. END, or the invalid ones.
+	nodes := map[string]bool{}
+	for _, n := range g.Nodes {
+		nodes[n.Name] = true
+	}
+	for _, e := range g.Edges {
+		if !nodes[e.To] {
+			nodes[e.To] = true
+			g.Nodes = append(g.Nodes, &GraphNode{Name: e.To, Filter: e.To})
+		}
+	}
+
+	return g
+}
+
+// findResiliencePolicies walks the spec of a filter for the references to
+// the resilience policies.
+func findResiliencePolicies(spec interface{}) []string {
+	set := map[string]struct{}{}
+
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, child := range v {
+				if typ, ok := resiliencePolicyKeys[k]; ok {
+					if name, _ := child.(string); name != "" {
+						set[typ+":"+name] = struct{}{}
+					}
+					continue
+				}
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		case []map[string]interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(spec)
+
+	policies := make([]string, 0, len(set))
+	for p := range set {
+		policies = append(policies, p)
+	}
+	sort.Strings(policies)
+	return policies
+}
+
+// Format formats the graph in the format of GraphFormatDOT or
+// GraphFormatMermaid.
+func (g *Graph) Format(name, format string) (string, error) {
+	switch format {
+	case GraphFormatDOT:
+		return g.DOT(name), nil
+	case GraphFormatMermaid:
+		return g.Mermaid(), nil
+	default:
+		return "", fmt.Errorf("unknown graph format %s, must be %s or %s",
+			format, GraphFormatDOT, GraphFormatMermaid)
+	}
+}
+
+func (n *GraphNode) label() string {
+	if n.Filter == BuiltInFilterEnd {
+		return BuiltInFilterEnd
+	}
+	if n.Kind == "" {
+		return n.Name
+	}
+	return fmt.Sprintf("%s\\n(%s)", n.Name, n.Kind)
+}
+
+// DOT formats the graph in Graphviz DOT, the filters wrapped by resilience
+// policies are put in clusters labelled with the policies.
+func (g *Graph) DOT(name string) string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "digraph %q {\n", name)
+	b.WriteString("  rankdir=TB;\n")
+	b.WriteString("  node [shape=box, style=rounded];\n")
+
+	for i, n := range g.Nodes {
+		attrs := fmt.Sprintf("label=\"%s\"", dotEscape(n.label()))
+		if n.Filter == BuiltInFilterEnd {
+			attrs += ", shape=doublecircle"
+		}
+
+		if len(n.Resilience) == 0 {
+			fmt.Fprintf(b, "  %q [%s];\n", n.Name, attrs)
+			continue
+		}
+		fmt.Fprintf(b, "  subgraph cluster_%d {\n", i)
+		fmt.Fprintf(b, "    label=\"%s\";\n", dotEscape(strings.Join(n.Resilience, ", ")))
+		b.WriteString("    style=dashed;\n")
+		fmt.Fprintf(b, "    %q [%s];\n", n.Name, attrs)
+		b.WriteString("  }\n")
+	}
+
+	for _, e := range g.Edges {
+		if e.JumpIf {
+			fmt.Fprintf(b, "  %q -> %q [label=\"%s\", style=dashed];\n", e.From, e.To, dotEscape(e.Label))
+		} else {
+			fmt.Fprintf(b, "  %q -> %q;\n", e.From, e.To)
+		}
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func dotEscape(s string) string {
+	return strings.ReplaceAll(s, `"`, `\"`)
+}
+
+// Mermaid formats the graph in Mermaid flowchart, the filters wrapped by
+// resilience policies are put in subgraphs titled with the policies.
+func (g *Graph) Mermaid() string {
+	ids := map[string]string{}
+	for i, n := range g.Nodes {
+		ids[n.Name] = fmt.Sprintf("n%d", i)
+	}
+
+	b := &strings.Builder{}
+	b.WriteString("flowchart TD\n")
+	for i, n := range g.Nodes {
+		label := strings.ReplaceAll(n.label(), "\\n", "<br/>")
+		node := fmt.Sprintf("%s[\"%s\"]", ids[n.Name], mermaidEscape(label))
+		if n.Filter == BuiltInFilterEnd {
+			node = fmt.Sprintf("%s((%s))", ids[n.Name], BuiltInFilterEnd)
+		}
+
+		if len(n.Resilience) == 0 {
+			fmt.Fprintf(b, "  %s\n", node)
+			continue
+		}
+		fmt.Fprintf(b, "  subgraph r%d [\"%s\"]\n", i, mermaidEscape(strings.Join(n.Resilience, ", ")))
+		fmt.Fprintf(b, "    %s\n", node)
+		b.WriteString("  end\n")
+	}
+
+	for _, e := range g.Edges {
+		if e.JumpIf {
+			fmt.Fprintf(b, "  %s -.->|%s| %s\n", ids[e.From], mermaidEscape(e.Label), ids[e.To])
+		} else {
+			fmt.Fprintf(b, "  %s --> %s\n", ids[e.From], ids[e.To])
+		}
+	}
+
+	return b.String()
+}
+
+func mermaidEscape(s string) string {
+	return strings.ReplaceAll(s, `"`, "#quot;")
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraph(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{
+		Flow: []FlowNode{
+			{FilterName: "validator", JumpIf: map[string]string{"invalid": "END"}},
+			{FilterName: "proxy", FilterAlias: "backend"},
+		},
+		Filters: []map[string]interface{}{
+			{"name": "validator", "kind": "Validator"},
+			{
+				"name": "proxy",
+				"kind": "Proxy",
+				"pools": []interface{}{
+					map[string]interface{}{"retryPolicy": "retry3", "circuitBreakerPolicy": "cb"},
+				},
+			},
+		},
+	}
+
+	g := spec.Graph()
+	assert.Len(g.Nodes, 3)
+	assert.Equal("backend", g.Nodes[1].Name)
+	assert.Equal([]string{"circuitBreaker:cb", "retry:retry3"}, g.Nodes[1].Resilience)
+	assert.Equal(BuiltInFilterEnd, g.Nodes[2].Name)
+	assert.Equal([]*GraphEdge{
+		{From: "validator", To: "END", Label: "invalid", JumpIf: true},
+		{From: "validator", To: "backend"},
+		{From: "backend", To: "END"},
+	}, g.Edges)
+
+	dot, err := g.Format("demo", GraphFormatDOT)
+	assert.NoError(err)
+	assert.True(strings.Contains(dot, `"validator" -> "END" [label="invalid", style=dashed];`))
+	assert.True(strings.Contains(dot, `label="circuitBreaker:cb, retry:retry3";`))
+
+	mermaid, err := g.Format("demo", GraphFormatMermaid)
+	assert.NoError(err)
+	assert.True(strings.HasPrefix(mermaid, "flowchart TD\n"))
+	assert.True(strings.Contains(mermaid, "n0 -.->|invalid| n2"))
+	assert.True(strings.Contains(mermaid, "n1 --> n2"))
+
+	_, err = g.Format("demo", "svg")
+	assert.Error(err)
+}
+
+func TestGraphWithoutFlow(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{
+		Filters: []map[string]interface{}{
+			{"name": "a", "kind": "Mock"},
+			{"name": "b", "kind": "Mock"},
+		},
+	}
+
+	g := spec.Graph()
+	assert.Len(g.Nodes, 3)
+	assert.Equal([]*GraphEdge{
+		{From: "a", To: "b"},
+		{From: "b", To: "END"},
+	}, g.Edges)
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pipeline
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/megaease/easegress/pkg/util/prometheushelper"
+)
+
+// resultSuccess is the result label of filters returning empty results.
+const resultSuccess = "success"
+
+// metrics are the Prometheus metrics of the filters of a Pipeline.
+type metrics struct {
+	name string
+
+	filterResults  *prometheus.CounterVec
+	filterDuration *prometheus.HistogramVec
+}
+
+func newMetrics(name string) *metrics {
+	return &metrics{
+		name: name,
+		filterResults: prometheushelper.NewCounter("pipeline_filter_results_total",
+			"the total count of results of filters",
+			[]string{"pipeline", "filter", "kind", "result"}),
+		filterDuration: prometheushelper.NewHistogram("pipeline_filter_duration_seconds",
+			"the duration of filters handling requests",
+			[]string{"pipeline", "filter", "kind"}, nil),
+	}
+}
+
+func (m *metrics) stat(stat *FilterStat) {
+	if m == nil {
+		return
+	}
+
+	result := stat.Result
+	if result == "" {
+		result = resultSuccess
+	}
+
+	m.filterResults.WithLabelValues(m.name, stat.Name, stat.Kind, result).Inc()
+	m.filterDuration.WithLabelValues(m.name, stat.Name, stat.Kind).Observe(stat.Duration.Seconds())
+}
@@ -26,6 +26,8 @@ import (
 	"github.com/megaease/easegress/pkg/filters"
 	"github.com/megaease/easegress/pkg/resilience"
 	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/accesslog"
 	"github.com/megaease/easegress/pkg/util/easemonitor"
 	"github.com/megaease/easegress/pkg/util/fasttime"
 	"github.com/megaease/easegress/pkg/util/stringtool"
@@ -40,6 +42,10 @@ const (
 
 	// BuiltInFilterEnd is the name of the build-in end filter.
 	BuiltInFilterEnd = "END"
+
+	// DataFilterStats is the key of the context data of the statistics of
+	// the executed filters, its value is a []FilterStat.
+	DataFilterStats = "PIPELINE_FILTER_STATS"
 )
 
 func init() {
@@ -59,6 +65,7 @@ type (
 		filters    map[string]filters.Filter
 		flow       []FlowNode
 		resilience map[string]resilience.Policy
+		metrics    *metrics
 	}
 
 	// Spec describes the Pipeline.
@@ -174,6 +181,36 @@ func (s *Spec) Validate() (err error) {
 	return nil
 }
 
+// Dependencies returns the service registries used by the filters, i.e.
+// the serviceRegistry of the server pools, at any level of the filter
+// specs, so the filters of all kinds are covered.
+func (s *Spec) Dependencies() []string {
+	var deps []string
+
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, child := range v {
+				if name, ok := child.(string); ok && k == "serviceRegistry" {
+					deps = append(deps, name)
+					continue
+				}
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+
+	for _, f := range s.Filters {
+		walk(f)
+	}
+	return deps
+}
+
 func serializeStats(stats []FilterStat) string {
 	if len(stats) == 0 {
 		return "pipeline: <empty>"
@@ -235,6 +272,7 @@ func (p *Pipeline) reload(previousGeneration *Pipeline) {
 
 	super := p.superSpec.Super()
 	pipelineName := p.superSpec.Name()
+	p.metrics = newMetrics(pipelineName)
 
 	// create resilience
 	for _, r := range p.spec.Resilience {
@@ -330,12 +368,21 @@ func (p *Pipeline) HandleWithBeforeAfter(ctx *context.Context, before, after *Pi
 		result, stats, sawEnd = p.doHandle(ctx, after.flow, stats)
 	}
 
-	ctx.LazyAddTag(func() string {
-		return serializeStats(stats)
-	})
+	p.recordStats(ctx, stats)
 	return result
 }
 
+// recordStats records the stats of filters in the tags of the context and
+// the filter results of the access log.
+func (p *Pipeline) recordStats(ctx *context.Context, stats []FilterStat) {
+	serialize := func() string {
+		return serializeStats(stats)
+	}
+	ctx.LazyAddTag(serialize)
+	ctx.SetData(accesslog.DataFilterResults, serialize)
+	ctx.SetData(DataFilterStats, stats)
+}
+
 // Handle is the handler to deal with the request.
 func (p *Pipeline) Handle(ctx *context.Context) string {
 	if len(p.spec.Data) > 0 {
@@ -345,9 +392,7 @@ func (p *Pipeline) Handle(ctx *context.Context) string {
 	stats := make([]FilterStat, 0, len(p.flow))
 	result, stats, _ := p.doHandle(ctx, p.flow, stats)
 
-	ctx.LazyAddTag(func() string {
-		return serializeStats(stats)
-	})
+	p.recordStats(ctx, stats)
 	return result
 }
 
@@ -377,6 +422,10 @@ func (p *Pipeline) doHandle(ctx *context.Context, flow []FlowNode, stats []Filte
 			Duration: fasttime.Since(start),
 			Result:   result,
 		})
+		p.metrics.stat(&stats[len(stats)-1])
+		if span := ctx.Span(); !span.IsNoop() {
+			tagSpan(span, p.superSpec.Name(), &stats[len(stats)-1])
+		}
 
 		var ok bool
 		if next, ok = node.JumpIf[result]; result != "" && !ok {
@@ -392,6 +441,21 @@ func (p *Pipeline) doHandle(ctx *context.Context, flow []FlowNode, stats []Filte
 	return result, stats, sawEnd
 }
 
+// tagSpan records the filter and its result in the span, the result of a
+// filter returning an empty result is "success".
+func tagSpan(span tracing.Span, pipeline string, stat *FilterStat) {
+	result := stat.Result
+	if result == "" {
+		result = resultSuccess
+	}
+
+	prefix := "easegress.filter." + stat.Name
+	span.Tag(tracing.AttributePipeline, pipeline)
+	span.Tag(prefix+".kind", stat.Kind)
+	span.Tag(prefix+".result", result)
+	span.Tag(prefix+".duration", stat.Duration.String())
+}
+
 // Status returns Status generated by Runtime.
 func (p *Pipeline) Status() *supervisor.Status {
 	s := &Status{
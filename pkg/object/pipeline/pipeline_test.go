@@ -498,3 +498,30 @@ filters:
 	assert.NotContains(tags, "filter2")
 	assert.NotContains(tags, "filter3")
 }
+
+func TestSpecDependencies(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{
+		Filters: []map[string]interface{}{
+			{
+				"name": "proxy",
+				"kind": "Proxy",
+				"pools": []interface{}{
+					map[string]interface{}{"serviceRegistry": "eureka", "serviceName": "order"},
+					map[string]interface{}{"servers": []interface{}{}},
+				},
+			},
+			{
+				"name":       "mirror",
+				"kind":       "Proxy",
+				"mirrorPool": map[string]interface{}{"serviceRegistry": "consul"},
+			},
+			{"name": "validator", "kind": "Validator"},
+		},
+	}
+
+	deps := spec.Dependencies()
+	assert.ElementsMatch([]string{"eureka", "consul"}, deps)
+	assert.Empty((&Spec{}).Dependencies())
+}
@@ -130,9 +130,15 @@ func (rctc *RawConfigTrafficController) run() {
 }
 
 func (rctc *RawConfigTrafficController) handleEvent(event *supervisor.ObjectEntityWatcherEvent) {
-	for name, entity := range event.Delete {
+	// The traffic gates are deleted before the pipelines they use, and
+	// created after them.
+	deleted := supervisor.OrderByDependency(event.Delete)
+	for i := len(deleted) - 1; i >= 0; i-- {
 		var err error
 
+		entity := deleted[i]
+		name := entity.Spec().Name()
+
 		kind := entity.Spec().Kind()
 		if kind == pipeline.Kind {
 			err = rctc.tc.DeletePipeline(DefaultNamespace, name)
@@ -147,7 +153,7 @@ func (rctc *RawConfigTrafficController) handleEvent(event *supervisor.ObjectEnti
 		}
 	}
 
-	for _, entity := range event.Create {
+	for _, entity := range supervisor.OrderByDependency(event.Create) {
 		var err error
 
 		kind := entity.Spec().Kind()
@@ -164,7 +170,7 @@ func (rctc *RawConfigTrafficController) handleEvent(event *supervisor.ObjectEnti
 		}
 	}
 
-	for _, entity := range event.Update {
+	for _, entity := range supervisor.OrderByDependency(event.Update) {
 		var err error
 
 		kind := entity.Instance().Kind()
@@ -0,0 +1,244 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package serviceregistry
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+const portCheckTimeout = time.Second
+
+type (
+	// SelfRegistrationSpec is the spec to register the traffic ports of
+	// the Easegress member itself to the registry, so that other systems
+	// could discover the gateway instances.
+	SelfRegistrationSpec struct {
+		ServiceName string `json:"serviceName" jsonschema:"required"`
+		// Address is the address registered for the member, the first
+		// non-loopback IP of the host is used if it is empty.
+		Address string                  `json:"address" jsonschema:"omitempty"`
+		Ports   []*SelfRegistrationPort `json:"ports" jsonschema:"required,minItems=1"`
+		// Tags are registered with the labels of the member in the form
+		// of key=value.
+		Tags []string `json:"tags" jsonschema:"omitempty"`
+	}
+
+	// SelfRegistrationPort is a traffic port of the member.
+	SelfRegistrationPort struct {
+		Port   uint16 `json:"port" jsonschema:"required"`
+		Scheme string `json:"scheme" jsonschema:"omitempty,enum=,enum=http,enum=https"`
+		// HealthCheckPath is the path for the registry to check the
+		// health of the port, if the registry supports it.
+		HealthCheckPath string `json:"healthCheckPath" jsonschema:"omitempty,pattern=^/"`
+	}
+
+	// SelfRegistrar keeps the member registered to a registry. A port is
+	// registered only if it accepts connections, and deregistered after it
+	// stops accepting connections.
+	SelfRegistrar struct {
+		spec       *SelfRegistrationSpec
+		registry   Registry
+		memberName string
+		labels     map[string]string
+
+		mutex  sync.Mutex
+		closed bool
+		// registered are the registered instances, the key is the port.
+		registered map[uint16]*ServiceInstanceSpec
+	}
+)
+
+// Validate validates SelfRegistrationSpec.
+func (s *SelfRegistrationSpec) Validate() error {
+	ports := map[uint16]bool{}
+	for _, p := range s.Ports {
+		if p.Port == 0 {
+			return fmt.Errorf("port is required")
+		}
+		if ports[p.Port] {
+			return fmt.Errorf("duplicated port %d", p.Port)
+		}
+		ports[p.Port] = true
+	}
+
+	if s.Address != "" && net.ParseIP(s.Address) == nil {
+		return fmt.Errorf("invalid address %s", s.Address)
+	}
+
+	return nil
+}
+
+// NewSelfRegistrar creates a SelfRegistrar.
+func NewSelfRegistrar(spec *SelfRegistrationSpec, registry Registry, opt *option.Options) *SelfRegistrar {
+	return &SelfRegistrar{
+		spec:       spec,
+		registry:   registry,
+		memberName: opt.Name,
+		labels:     opt.Labels,
+		registered: map[uint16]*ServiceInstanceSpec{},
+	}
+}
+
+// hostIP returns the first non-loopback IPv4 address of the host.
+func hostIP() (string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", err
+	}
+
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() {
+			continue
+		}
+		if ip := ipNet.IP.To4(); ip != nil {
+			return ip.String(), nil
+		}
+	}
+
+	return "", fmt.Errorf("no non-loopback IPv4 address found")
+}
+
+func (r *SelfRegistrar) tags() []string {
+	tags := append([]string{}, r.spec.Tags...)
+
+	var labels []string
+	for k, v := range r.labels {
+		labels = append(labels, k+"="+v)
+	}
+	sort.Strings(labels)
+
+	return append(tags, labels...)
+}
+
+func (r *SelfRegistrar) instance(address string, port *SelfRegistrationPort) *ServiceInstanceSpec {
+	instance := &ServiceInstanceSpec{
+		RegistryName: r.registry.Name(),
+		ServiceName:  r.spec.ServiceName,
+		InstanceID:   r.memberName + "-" + strconv.Itoa(int(port.Port)),
+		Address:      address,
+		Port:         port.Port,
+		Scheme:       port.Scheme,
+		Tags:         r.tags(),
+		Weight:       1,
+	}
+
+	if port.HealthCheckPath != "" {
+		instance.HealthCheckURL = instance.URL() + port.HealthCheckPath
+	}
+
+	return instance
+}
+
+func portAvailable(port uint16) bool {
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port)))
+	conn, err := net.DialTimeout("tcp", addr, portCheckTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// Sync registers the available ports, and deregisters the unavailable
+// ones. Registering again also renews the lease in registries like Eureka.
+func (r *SelfRegistrar) Sync() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return
+	}
+
+	address := r.spec.Address
+	if address == "" {
+		var err error
+		if address, err = hostIP(); err != nil {
+			logger.Errorf("%s: get address of the member failed: %v", r.registry.Name(), err)
+			return
+		}
+	}
+
+	apply := map[string]*ServiceInstanceSpec{}
+	del := map[string]*ServiceInstanceSpec{}
+	for _, port := range r.spec.Ports {
+		if portAvailable(port.Port) {
+			instance := r.instance(address, port)
+			apply[instance.Key()] = instance
+		} else if instance := r.registered[port.Port]; instance != nil {
+			del[instance.Key()] = instance
+		}
+	}
+
+	if len(del) > 0 {
+		if err := r.registry.DeleteServiceInstances(del); err != nil {
+			logger.Errorf("%s: deregister unavailable ports failed: %v", r.registry.Name(), err)
+		} else {
+			for _, instance := range del {
+				logger.Infof("%s: deregistered %s", r.registry.Name(), instance.Key())
+				delete(r.registered, instance.Port)
+			}
+		}
+	}
+
+	if len(apply) > 0 {
+		if err := r.registry.ApplyServiceInstances(apply); err != nil {
+			logger.Errorf("%s: register the member failed: %v", r.registry.Name(), err)
+			return
+		}
+		for _, instance := range apply {
+			if r.registered[instance.Port] == nil {
+				logger.Infof("%s: registered %s", r.registry.Name(), instance.Key())
+			}
+			r.registered[instance.Port] = instance
+		}
+	}
+}
+
+// Deregister deregisters all registered ports, it is called when the
+// registry is closed, including the graceful shutdown of the member.
+func (r *SelfRegistrar) Deregister() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.closed = true
+	if len(r.registered) == 0 {
+		return
+	}
+
+	instances := map[string]*ServiceInstanceSpec{}
+	for _, instance := range r.registered {
+		instances[instance.Key()] = instance
+	}
+
+	if err := r.registry.DeleteServiceInstances(instances); err != nil {
+		logger.Errorf("%s: deregister the member failed: %v", r.registry.Name(), err)
+		return
+	}
+
+	logger.Infof("%s: deregistered the member", r.registry.Name())
+	r.registered = map[uint16]*ServiceInstanceSpec{}
+}
@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package serviceregistry
+
+import (
+	"net"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+// mockRegistry records the instances applied to it.
+type mockRegistry struct {
+	Registry
+
+	mutex     sync.Mutex
+	instances map[string]*ServiceInstanceSpec
+}
+
+func newMockRegistry() *mockRegistry {
+	return &mockRegistry{instances: map[string]*ServiceInstanceSpec{}}
+}
+
+func (r *mockRegistry) Name() string { return "registry" }
+
+func (r *mockRegistry) ApplyServiceInstances(instances map[string]*ServiceInstanceSpec) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for k, v := range instances {
+		r.instances[k] = v
+	}
+	return nil
+}
+
+func (r *mockRegistry) DeleteServiceInstances(instances map[string]*ServiceInstanceSpec) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for k := range instances {
+		delete(r.instances, k)
+	}
+	return nil
+}
+
+func (r *mockRegistry) list() []*ServiceInstanceSpec {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	result := []*ServiceInstanceSpec{}
+	for _, v := range r.instances {
+		result = append(result, v)
+	}
+	return result
+}
+
+func listenTestPort(t *testing.T) (net.Listener, uint16) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	return l, uint16(l.Addr().(*net.TCPAddr).Port)
+}
+
+func TestSelfRegistrationSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &SelfRegistrationSpec{
+		ServiceName: "easegress",
+		Ports:       []*SelfRegistrationPort{{Port: 80}, {Port: 443, Scheme: "https"}},
+	}
+	assert.NoError(spec.Validate())
+
+	spec.Address = "not-an-ip"
+	assert.Error(spec.Validate())
+	spec.Address = "10.0.0.1"
+	assert.NoError(spec.Validate())
+
+	spec.Ports = append(spec.Ports, &SelfRegistrationPort{Port: 80})
+	assert.Error(spec.Validate())
+
+	spec.Ports = []*SelfRegistrationPort{{Port: 0}}
+	assert.Error(spec.Validate())
+}
+
+func TestSelfRegistrar(t *testing.T) {
+	assert := assert.New(t)
+
+	l1, port1 := listenTestPort(t)
+	defer l1.Close()
+	l2, port2 := listenTestPort(t)
+	l2.Close()
+
+	registry := newMockRegistry()
+	opt := option.New()
+	opt.Name = "member-1"
+	opt.Labels = map[string]string{"zone": "a", "env": "prod"}
+	r := NewSelfRegistrar(&SelfRegistrationSpec{
+		ServiceName: "easegress",
+		Address:     "10.0.0.1",
+		Ports: []*SelfRegistrationPort{
+			{Port: port1, HealthCheckPath: "/healthz"},
+			{Port: port2, Scheme: "https"},
+		},
+		Tags: []string{"gateway"},
+	}, registry, opt)
+
+	// only the port accepting connections is registered.
+	r.Sync()
+	instances := registry.list()
+	if assert.Len(instances, 1) {
+		instance := instances[0]
+		assert.Equal("registry", instance.RegistryName)
+		assert.Equal("easegress", instance.ServiceName)
+		assert.Equal("10.0.0.1", instance.Address)
+		assert.Equal(port1, instance.Port)
+		assert.Equal([]string{"gateway", "env=prod", "zone=a"}, instance.Tags)
+		assert.Equal(instance.URL()+"/healthz", instance.HealthCheckURL)
+	}
+
+	// the port is deregistered after it stops accepting connections.
+	l1.Close()
+	r.Sync()
+	assert.Empty(registry.list())
+
+	l3, port3 := listenTestPort(t)
+	defer l3.Close()
+	r.spec.Ports = append(r.spec.Ports, &SelfRegistrationPort{Port: port3})
+	r.Sync()
+	assert.Len(registry.list(), 1)
+
+	// nothing is registered after deregistration.
+	r.Deregister()
+	assert.Empty(registry.list())
+	r.Sync()
+	assert.Empty(registry.list())
+}
@@ -19,7 +19,9 @@ package serviceregistry
 
 import (
 	"fmt"
+	"math/rand"
 	"reflect"
+	"time"
 )
 
 type (
@@ -43,6 +45,9 @@ type (
 		Tags []string `json:"tags"`
 		// Weight is optional.
 		Weight int `json:"weight"`
+		// HealthCheckURL is optional, it is the URL for the registry to
+		// check the health of the instance, if the registry supports it.
+		HealthCheckURL string `json:"healthCheckURL,omitempty"`
 	}
 )
 
@@ -150,3 +155,14 @@ func NewRegistryEventFromDiff(registryName string, oldSpecs, newSpecs map[string
 
 	return event
 }
+
+// JitterInterval returns the interval with a random jitter of up to 20%, so
+// that registries synchronizing periodically don't hit the servers at the
+// same time.
+func JitterInterval(interval time.Duration) time.Duration {
+	jitter := int64(interval) / 5
+	if jitter <= 0 {
+		return interval
+	}
+	return interval + time.Duration(rand.Int63n(jitter))
+}
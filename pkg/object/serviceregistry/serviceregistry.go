@@ -18,6 +18,8 @@
 package serviceregistry
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"sync"
 
@@ -100,6 +102,17 @@ type (
 		// ListServiceInstances could return zero elements of instances with nil error.
 		ListAllServiceInstances() (map[string]*ServiceInstanceSpec, error)
 	}
+
+	// TLSProvider is an optional interface of Registry, the registries of
+	// service meshes implement it to provide the mTLS to the service instances.
+	TLSProvider interface {
+		TLSEnabled() bool
+		// ClientCertificate returns the certificate of Easegress in the mesh.
+		ClientCertificate() (*tls.Certificate, error)
+		// VerifyServiceCertificate verifies the certificate chain presented
+		// by an instance of the service.
+		VerifyServiceCertificate(serviceName string, rawCerts [][]byte) error
+	}
 )
 
 // newRegisterBucket creates a registrybucket, the registry could be nil.
@@ -340,6 +353,52 @@ func (sr *ServiceRegistry) _listAllServiceInstances(registryName string) (map[st
 	return bucket.registry.ListAllServiceInstances()
 }
 
+// ClientTLSConfig returns the TLS config to connect to the instances of the
+// service, it is nil if the registry doesn't provide mTLS. The registry is
+// looked up in every handshake, so the config keeps working after the
+// registry is updated.
+func (sr *ServiceRegistry) ClientTLSConfig(registryName, serviceName string) *tls.Config {
+	provider, err := sr.tlsProvider(registryName)
+	if err != nil || !provider.TLSEnabled() {
+		return nil
+	}
+
+	return &tls.Config{
+		// the certificate is verified in VerifyPeerCertificate.
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			provider, err := sr.tlsProvider(registryName)
+			if err != nil {
+				return nil, err
+			}
+			return provider.ClientCertificate()
+		},
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			provider, err := sr.tlsProvider(registryName)
+			if err != nil {
+				return err
+			}
+			return provider.VerifyServiceCertificate(serviceName, rawCerts)
+		},
+	}
+}
+
+func (sr *ServiceRegistry) tlsProvider(registryName string) (TLSProvider, error) {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+
+	bucket, exists := sr.registryBuckets[registryName]
+	if !exists || !bucket.registered {
+		return nil, fmt.Errorf("%s not found", registryName)
+	}
+
+	provider, ok := bucket.registry.(TLSProvider)
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't provide mTLS", registryName)
+	}
+	return provider, nil
+}
+
 // Category returns the category of ServiceRegistry.
 func (sr *ServiceRegistry) Category() supervisor.ObjectCategory {
 	return Category
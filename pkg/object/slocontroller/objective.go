@@ -0,0 +1,227 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package slocontroller
+
+import (
+	"sort"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	// AlertFiring means the burn rates exceed the threshold.
+	AlertFiring = "firing"
+	// AlertResolved means the burn rates drop below the threshold.
+	AlertResolved = "resolved"
+)
+
+type (
+	// objective evaluates a service level objective by the samples of the
+	// cumulative counts of the total and the good requests.
+	objective struct {
+		spec    *ObjectiveSpec
+		samples []sample
+		firing  map[string]time.Time
+	}
+
+	sample struct {
+		time  time.Time
+		total float64
+		good  float64
+	}
+
+	// ObjectiveStatus is the status of an objective, the percentages are
+	// of the window of the objective.
+	ObjectiveStatus struct {
+		Name                 string             `json:"name"`
+		SLI                  float64            `json:"sli"`
+		ErrorBudgetRemaining float64            `json:"errorBudgetRemaining"`
+		BurnRates            map[string]float64 `json:"burnRates"`
+		Alerts               []*AlertStatus     `json:"alerts"`
+	}
+
+	// AlertStatus is the status of a burn rate alert.
+	AlertStatus struct {
+		Name   string `json:"name"`
+		Firing bool   `json:"firing"`
+		Since  string `json:"since,omitempty"`
+	}
+
+	// alertEvent is the change of the state of an alert.
+	alertEvent struct {
+		objective string
+		alert     *AlertSpec
+		state     string
+		longRate  float64
+		shortRate float64
+		time      time.Time
+	}
+)
+
+func newObjective(spec *ObjectiveSpec) *objective {
+	return &objective{spec: spec, firing: map[string]time.Time{}}
+}
+
+// collect collects the sample from the duration histograms of HTTPServer.
+func (o *objective) collect(metrics []*dto.Metric, now time.Time) sample {
+	s := sample{time: now}
+	threshold := o.spec.latencyThreshold().Seconds()
+
+	for _, m := range metrics {
+		labels := map[string]string{}
+		for _, l := range m.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		if labels["name"] != o.spec.HTTPServer {
+			continue
+		}
+		if o.spec.Route != "" && labels["route"] != o.spec.Route {
+			continue
+		}
+		if o.spec.Pipeline != "" && labels["backend"] != o.spec.Pipeline {
+			continue
+		}
+
+		h := m.GetHistogram()
+		count := float64(h.GetSampleCount())
+		s.total += count
+
+		switch o.spec.Type {
+		case ObjectiveLatency:
+			s.good += bucketCount(h, threshold)
+		default:
+			if labels["status_class"] != "5xx" {
+				s.good += count
+			}
+		}
+	}
+
+	return s
+}
+
+// bucketCount returns the count of the largest bucket whose upper bound
+// is not greater than the threshold.
+func bucketCount(h *dto.Histogram, threshold float64) float64 {
+	var count uint64
+	for _, b := range h.GetBucket() {
+		if b.GetUpperBound() <= threshold {
+			count = b.GetCumulativeCount()
+		}
+	}
+	return float64(count)
+}
+
+// addSample adds the sample, and removes the samples out of the window,
+// except the latest one of them, which is the start of the window.
+func (o *objective) addSample(s sample) {
+	o.samples = append(o.samples, s)
+
+	start := s.time.Add(-o.spec.window())
+	i := sort.Search(len(o.samples), func(i int) bool {
+		return o.samples[i].time.After(start)
+	})
+	if i > 1 {
+		o.samples = append(o.samples[:0], o.samples[i-1:]...)
+	}
+}
+
+// errorRate returns the ratio of the bad requests in the window before the
+// latest sample, the window starts from the oldest sample if there are no
+// samples old enough.
+func (o *objective) errorRate(window time.Duration) float64 {
+	if len(o.samples) == 0 {
+		return 0
+	}
+
+	latest := o.samples[len(o.samples)-1]
+	start := latest.time.Add(-window)
+	i := sort.Search(len(o.samples), func(i int) bool {
+		return o.samples[i].time.After(start)
+	})
+	if i > 0 {
+		i--
+	}
+	prev := o.samples[i]
+
+	total, good := latest.total-prev.total, latest.good-prev.good
+	// The counters are reset.
+	if total < 0 || good < 0 {
+		total, good = latest.total, latest.good
+	}
+	if total <= 0 {
+		return 0
+	}
+	return 1 - good/total
+}
+
+// burnRate returns how fast the error budget is consumed in the window,
+// 1 means the budget is exhausted exactly at the end of the window of the
+// objective.
+func (o *objective) burnRate(window time.Duration) float64 {
+	return o.errorRate(window) / o.spec.errorBudget()
+}
+
+// evaluate adds the sample and returns the status of the objective and the
+// changes of the states of the alerts.
+func (o *objective) evaluate(s sample) (*ObjectiveStatus, []*alertEvent) {
+	o.addSample(s)
+
+	window := o.spec.window()
+	status := &ObjectiveStatus{
+		Name:                 o.spec.Name,
+		SLI:                  (1 - o.errorRate(window)) * 100,
+		ErrorBudgetRemaining: (1 - o.burnRate(window)) * 100,
+		BurnRates:            map[string]float64{},
+	}
+
+	var events []*alertEvent
+	for _, a := range o.spec.alerts() {
+		longRate := o.burnRate(a.longWindow())
+		shortRate := o.burnRate(a.shortWindow())
+		status.BurnRates[a.LongWindow] = longRate
+		status.BurnRates[a.ShortWindow] = shortRate
+
+		firing := longRate > a.BurnRate && shortRate > a.BurnRate
+		since, wasFiring := o.firing[a.Name]
+
+		switch {
+		case firing && !wasFiring:
+			since = s.time
+			o.firing[a.Name] = since
+			events = append(events, &alertEvent{
+				objective: o.spec.Name, alert: a, state: AlertFiring,
+				longRate: longRate, shortRate: shortRate, time: s.time,
+			})
+		case !firing && wasFiring:
+			delete(o.firing, a.Name)
+			events = append(events, &alertEvent{
+				objective: o.spec.Name, alert: a, state: AlertResolved,
+				longRate: longRate, shortRate: shortRate, time: s.time,
+			})
+		}
+
+		as := &AlertStatus{Name: a.Name, Firing: firing}
+		if firing {
+			as.Since = since.Format(time.RFC3339)
+		}
+		status.Alerts = append(status.Alerts, as)
+	}
+
+	return status, events
+}
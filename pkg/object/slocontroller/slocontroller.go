@@ -0,0 +1,289 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package slocontroller computes the error budgets and the burn rates of
+// service level objectives from the metrics of HTTPServers.
+package slocontroller
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/prometheushelper"
+)
+
+const (
+	// Category is the category of SLOController.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of SLOController.
+	Kind = "SLOController"
+
+	webhookTimeout = 10 * time.Second
+)
+
+// durationMetricName is the name of the duration histogram of HTTPServer,
+// its sample counts are the counts of requests.
+var durationMetricName = prometheushelper.Namespace + "_httpserver_request_duration_seconds"
+
+func init() {
+	supervisor.Register(&SLOController{})
+}
+
+type (
+	// SLOController evaluates the service level objectives periodically.
+	SLOController struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		objectives []*objective
+		metrics    *metrics
+		client     *http.Client
+
+		mutex  sync.RWMutex
+		status *Status
+
+		done chan struct{}
+	}
+
+	// Status is the status of SLOController.
+	Status struct {
+		Objectives []*ObjectiveStatus `json:"objectives"`
+	}
+
+	// WebhookEvent is the body sent to the webhook when an alert fires
+	// or resolves.
+	WebhookEvent struct {
+		Controller    string  `json:"controller"`
+		Objective     string  `json:"objective"`
+		Alert         string  `json:"alert"`
+		State         string  `json:"state"`
+		LongWindow    string  `json:"longWindow"`
+		ShortWindow   string  `json:"shortWindow"`
+		LongBurnRate  float64 `json:"longBurnRate"`
+		ShortBurnRate float64 `json:"shortBurnRate"`
+		Threshold     float64 `json:"threshold"`
+		Time          string  `json:"time"`
+	}
+
+	metrics struct {
+		name string
+
+		budgetRemaining *prometheus.GaugeVec
+		burnRate        *prometheus.GaugeVec
+		alertFiring     *prometheus.GaugeVec
+	}
+)
+
+// Category returns the category of SLOController.
+func (c *SLOController) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of SLOController.
+func (c *SLOController) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of SLOController.
+func (c *SLOController) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Init initializes SLOController.
+func (c *SLOController) Init(superSpec *supervisor.Spec) {
+	c.superSpec, c.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	c.reload()
+}
+
+// Inherit inherits previous generation of SLOController, the samples of
+// the objectives are discarded, as the objectives may have changed.
+func (c *SLOController) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	previousGeneration.Close()
+	c.Init(superSpec)
+}
+
+func (c *SLOController) reload() {
+	for _, spec := range c.spec.Objectives {
+		c.objectives = append(c.objectives, newObjective(spec))
+	}
+	c.metrics = newMetrics(c.superSpec.Name())
+	c.client = &http.Client{Timeout: webhookTimeout}
+	c.status = &Status{}
+	c.done = make(chan struct{})
+
+	go c.run()
+}
+
+func (c *SLOController) run() {
+	// The first evaluation records the start of the windows.
+	c.evaluate(time.Now())
+
+	ticker := time.NewTicker(c.spec.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case now := <-ticker.C:
+			c.evaluate(now)
+		}
+	}
+}
+
+func (c *SLOController) evaluate(now time.Time) {
+	families, err := prometheushelper.Gather()
+	if err != nil {
+		logger.Errorf("%s gather metrics failed: %v", c.superSpec.Name(), err)
+		return
+	}
+
+	var histograms []*dto.Metric
+	for _, mf := range families {
+		if mf.GetName() == durationMetricName {
+			histograms = mf.GetMetric()
+			break
+		}
+	}
+
+	status := &Status{}
+	for _, o := range c.objectives {
+		st, events := o.evaluate(o.collect(histograms, now))
+		status.Objectives = append(status.Objectives, st)
+		c.metrics.update(o.spec, st)
+
+		for _, e := range events {
+			logger.Warnf("%s alert %s of objective %s is %s, burn rates: %.2f (%s), %.2f (%s)",
+				c.superSpec.Name(), e.alert.Name, e.objective, e.state,
+				e.longRate, e.alert.LongWindow, e.shortRate, e.alert.ShortWindow)
+			if c.spec.Webhook != nil {
+				go c.notify(e)
+			}
+		}
+	}
+
+	c.mutex.Lock()
+	c.status = status
+	c.mutex.Unlock()
+}
+
+// notify sends the alert event to the webhook.
+func (c *SLOController) notify(e *alertEvent) {
+	event := &WebhookEvent{
+		Controller:    c.superSpec.Name(),
+		Objective:     e.objective,
+		Alert:         e.alert.Name,
+		State:         e.state,
+		LongWindow:    e.alert.LongWindow,
+		ShortWindow:   e.alert.ShortWindow,
+		LongBurnRate:  e.longRate,
+		ShortBurnRate: e.shortRate,
+		Threshold:     e.alert.BurnRate,
+		Time:          e.time.Format(time.RFC3339),
+	}
+
+	spec := c.spec.Webhook
+	body := bytes.NewReader(codectool.MustMarshalJSON(event))
+	req, err := http.NewRequest(http.MethodPost, spec.URL, body)
+	if err != nil {
+		logger.Errorf("%s create webhook request failed: %v", c.superSpec.Name(), err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range spec.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.client.Do(req)
+	if err == nil {
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+		if resp.StatusCode >= 300 {
+			err = fmt.Errorf("status code %d", resp.StatusCode)
+		}
+	}
+	if err != nil {
+		logger.Errorf("%s send alert %s of objective %s to webhook failed: %v",
+			c.superSpec.Name(), e.alert.Name, e.objective, err)
+	}
+}
+
+// Status returns the status of SLOController.
+func (c *SLOController) Status() *supervisor.Status {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return &supervisor.Status{ObjectStatus: c.status}
+}
+
+// Close closes SLOController.
+func (c *SLOController) Close() {
+	close(c.done)
+	for _, o := range c.objectives {
+		c.metrics.delete(o.spec)
+	}
+}
+
+func newMetrics(name string) *metrics {
+	return &metrics{
+		name: name,
+		budgetRemaining: prometheushelper.NewGauge("slo_error_budget_remaining_percent",
+			"the percentage of the error budget remaining in the window of the objective",
+			[]string{"name", "objective"}),
+		burnRate: prometheushelper.NewGauge("slo_burn_rate",
+			"the burn rate of the error budget in the window",
+			[]string{"name", "objective", "window"}),
+		alertFiring: prometheushelper.NewGauge("slo_alert_firing",
+			"whether the burn rate alert is firing",
+			[]string{"name", "objective", "alert"}),
+	}
+}
+
+func (m *metrics) update(spec *ObjectiveSpec, status *ObjectiveStatus) {
+	m.budgetRemaining.WithLabelValues(m.name, spec.Name).Set(status.ErrorBudgetRemaining)
+	for window, rate := range status.BurnRates {
+		m.burnRate.WithLabelValues(m.name, spec.Name, window).Set(rate)
+	}
+	for _, a := range status.Alerts {
+		firing := 0.0
+		if a.Firing {
+			firing = 1
+		}
+		m.alertFiring.WithLabelValues(m.name, spec.Name, a.Name).Set(firing)
+	}
+}
+
+// delete deletes the metrics of the objective, as the objective may not
+// exist in the next generation.
+func (m *metrics) delete(spec *ObjectiveSpec) {
+	m.budgetRemaining.DeleteLabelValues(m.name, spec.Name)
+	for _, a := range spec.alerts() {
+		m.burnRate.DeleteLabelValues(m.name, spec.Name, a.LongWindow)
+		m.burnRate.DeleteLabelValues(m.name, spec.Name, a.ShortWindow)
+		m.alertFiring.DeleteLabelValues(m.name, spec.Name, a.Name)
+	}
+}
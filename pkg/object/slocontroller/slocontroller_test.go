@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package slocontroller
+
+import (
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+func newHistogram(labels map[string]string, count uint64, buckets map[float64]uint64) *dto.Metric {
+	m := &dto.Metric{Histogram: &dto.Histogram{SampleCount: proto.Uint64(count)}}
+	for k, v := range labels {
+		m.Label = append(m.Label, &dto.LabelPair{Name: proto.String(k), Value: proto.String(v)})
+	}
+	for _, bound := range []float64{0.1, 0.5, 1} {
+		m.Histogram.Bucket = append(m.Histogram.Bucket, &dto.Bucket{
+			UpperBound:      proto.Float64(bound),
+			CumulativeCount: proto.Uint64(buckets[bound]),
+		})
+	}
+	return m
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Objectives: []*ObjectiveSpec{{Name: "a"}, {Name: "a"}}}
+	assert.Error(spec.Validate())
+	spec.Objectives[1].Name = "b"
+	assert.NoError(spec.Validate())
+
+	o := &ObjectiveSpec{Name: "a", Type: ObjectiveLatency}
+	assert.Error(o.Validate())
+	o.LatencyThreshold = "500ms"
+	assert.NoError(o.Validate())
+
+	o.Alerts = []*AlertSpec{{Name: "a", LongWindow: "5m", ShortWindow: "1h", BurnRate: 1}}
+	assert.Error(o.Validate())
+	o.Alerts[0].LongWindow, o.Alerts[0].ShortWindow = "1000h", "1h"
+	assert.Error(o.Validate())
+	o.Alerts[0].LongWindow = "2h"
+	assert.NoError(o.Validate())
+
+	o = &ObjectiveSpec{Window: "24h"}
+	assert.Len(o.alerts(), 3)
+}
+
+func TestCollect(t *testing.T) {
+	assert := assert.New(t)
+
+	metrics := []*dto.Metric{
+		newHistogram(map[string]string{"name": "server", "route": "/a", "backend": "p1", "status_class": "2xx"},
+			90, map[float64]uint64{0.1: 50, 0.5: 80, 1: 85}),
+		newHistogram(map[string]string{"name": "server", "route": "/a", "backend": "p1", "status_class": "5xx"},
+			10, map[float64]uint64{0.1: 10, 0.5: 10, 1: 10}),
+		newHistogram(map[string]string{"name": "server", "route": "/b", "backend": "p2", "status_class": "2xx"},
+			100, map[float64]uint64{0.1: 100, 0.5: 100, 1: 100}),
+		newHistogram(map[string]string{"name": "other", "route": "/a", "backend": "p1", "status_class": "5xx"},
+			100, nil),
+	}
+
+	now := time.Now()
+	o := newObjective(&ObjectiveSpec{HTTPServer: "server", Type: ObjectiveAvailability})
+	s := o.collect(metrics, now)
+	assert.Equal(200.0, s.total)
+	assert.Equal(190.0, s.good)
+
+	o = newObjective(&ObjectiveSpec{HTTPServer: "server", Route: "/a", Type: ObjectiveAvailability})
+	s = o.collect(metrics, now)
+	assert.Equal(100.0, s.total)
+	assert.Equal(90.0, s.good)
+
+	o = newObjective(&ObjectiveSpec{HTTPServer: "server", Pipeline: "p1", Type: ObjectiveLatency, LatencyThreshold: "700ms"})
+	s = o.collect(metrics, now)
+	assert.Equal(100.0, s.total)
+	assert.Equal(90.0, s.good)
+}
+
+func TestEvaluate(t *testing.T) {
+	assert := assert.New(t)
+
+	o := newObjective(&ObjectiveSpec{
+		Name:   "test",
+		Target: 99,
+		Window: "1h",
+		Alerts: []*AlertSpec{{Name: "fast", LongWindow: "10m", ShortWindow: "1m", BurnRate: 5}},
+	})
+
+	start := time.Now()
+	status, events := o.evaluate(sample{time: start})
+	assert.Equal(100.0, status.SLI)
+	assert.Equal(100.0, status.ErrorBudgetRemaining)
+	assert.Empty(events)
+
+	// 10% errors, the burn rate is 10.
+	status, events = o.evaluate(sample{time: start.Add(time.Minute), total: 1000, good: 900})
+	assert.InDelta(90.0, status.SLI, 1e-9)
+	assert.InDelta(10.0, status.BurnRates["10m"], 1e-9)
+	assert.InDelta(10.0, status.BurnRates["1m"], 1e-9)
+	assert.Len(events, 1)
+	assert.Equal(AlertFiring, events[0].state)
+	assert.True(status.Alerts[0].Firing)
+
+	// no errors in the short window, the alert resolves.
+	status, events = o.evaluate(sample{time: start.Add(2 * time.Minute), total: 2000, good: 1900})
+	assert.InDelta(0.0, status.BurnRates["1m"], 1e-9)
+	assert.InDelta(5.0, status.BurnRates["10m"], 1e-9)
+	assert.Len(events, 1)
+	assert.Equal(AlertResolved, events[0].state)
+	assert.False(status.Alerts[0].Firing)
+
+	// the samples out of the window are removed, except the start.
+	o.evaluate(sample{time: start.Add(2 * time.Hour), total: 2000, good: 1900})
+	assert.Len(o.samples, 2)
+
+	// the counters are reset.
+	status, _ = o.evaluate(sample{time: start.Add(3 * time.Hour), total: 100, good: 100})
+	assert.Equal(100.0, status.SLI)
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package slocontroller
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// ObjectiveAvailability is the percentage of requests not responded
+	// with 5xx status codes.
+	ObjectiveAvailability = "availability"
+	// ObjectiveLatency is the percentage of requests finished within the
+	// latency threshold.
+	ObjectiveLatency = "latency"
+
+	defaultInterval = 30 * time.Second
+	defaultWindow   = 30 * 24 * time.Hour
+)
+
+// defaultAlerts are the multi-window burn rate alerts recommended by the
+// Site Reliability Workbook for a 30 days window.
+var defaultAlerts = []*AlertSpec{
+	{Name: "page-fast", LongWindow: "1h", ShortWindow: "5m", BurnRate: 14.4},
+	{Name: "page-slow", LongWindow: "6h", ShortWindow: "30m", BurnRate: 6},
+	{Name: "ticket-fast", LongWindow: "24h", ShortWindow: "2h", BurnRate: 3},
+	{Name: "ticket-slow", LongWindow: "72h", ShortWindow: "6h", BurnRate: 1},
+}
+
+type (
+	// Spec describes the SLOController.
+	Spec struct {
+		// Interval is the interval to evaluate the objectives.
+		Interval   string           `json:"interval" jsonschema:"omitempty,format=duration"`
+		Objectives []*ObjectiveSpec `json:"objectives" jsonschema:"required,minItems=1"`
+		Webhook    *WebhookSpec     `json:"webhook,omitempty" jsonschema:"omitempty"`
+	}
+
+	// ObjectiveSpec describes a service level objective of the requests of
+	// an HTTPServer, which could be narrowed down to a route or a pipeline.
+	ObjectiveSpec struct {
+		Name       string `json:"name" jsonschema:"required"`
+		HTTPServer string `json:"httpServer" jsonschema:"required"`
+		Route      string `json:"route,omitempty" jsonschema:"omitempty"`
+		Pipeline   string `json:"pipeline,omitempty" jsonschema:"omitempty"`
+		Type       string `json:"type" jsonschema:"required,enum=availability,enum=latency"`
+		// Target is the percentage of good requests, e.g. 99.9.
+		Target float64 `json:"target" jsonschema:"required,exclusiveMinimum=0,exclusiveMaximum=100"`
+		// LatencyThreshold is rounded down to the nearest bucket of the
+		// duration histogram of HTTPServer.
+		LatencyThreshold string       `json:"latencyThreshold,omitempty" jsonschema:"omitempty,format=duration"`
+		Window           string       `json:"window" jsonschema:"omitempty,format=duration"`
+		Alerts           []*AlertSpec `json:"alerts,omitempty" jsonschema:"omitempty"`
+	}
+
+	// AlertSpec describes a burn rate alert, it fires when the burn rates
+	// of both the long and the short window exceed BurnRate.
+	AlertSpec struct {
+		Name        string  `json:"name" jsonschema:"required"`
+		LongWindow  string  `json:"longWindow" jsonschema:"required,format=duration"`
+		ShortWindow string  `json:"shortWindow" jsonschema:"required,format=duration"`
+		BurnRate    float64 `json:"burnRate" jsonschema:"required,exclusiveMinimum=0"`
+	}
+
+	// WebhookSpec describes the webhook notified when alerts fire or
+	// resolve.
+	WebhookSpec struct {
+		URL     string            `json:"url" jsonschema:"required,format=url"`
+		Headers map[string]string `json:"headers,omitempty" jsonschema:"omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	names := map[string]bool{}
+	for _, o := range spec.Objectives {
+		if names[o.Name] {
+			return fmt.Errorf("duplicated objective %s", o.Name)
+		}
+		names[o.Name] = true
+	}
+	return nil
+}
+
+// Validate validates ObjectiveSpec.
+func (o *ObjectiveSpec) Validate() error {
+	if o.Type == ObjectiveLatency && o.LatencyThreshold == "" {
+		return fmt.Errorf("latencyThreshold is required for latency objective %s", o.Name)
+	}
+
+	window := o.window()
+	for _, a := range o.Alerts {
+		long, short := a.longWindow(), a.shortWindow()
+		if short >= long {
+			return fmt.Errorf("shortWindow of alert %s must be shorter than longWindow", a.Name)
+		}
+		if long > window {
+			return fmt.Errorf("longWindow of alert %s must not be longer than the window", a.Name)
+		}
+	}
+	return nil
+}
+
+func (spec *Spec) interval() time.Duration {
+	d, err := time.ParseDuration(spec.Interval)
+	if err != nil || d <= 0 {
+		return defaultInterval
+	}
+	return d
+}
+
+func (o *ObjectiveSpec) window() time.Duration {
+	d, err := time.ParseDuration(o.Window)
+	if err != nil || d <= 0 {
+		return defaultWindow
+	}
+	return d
+}
+
+func (o *ObjectiveSpec) latencyThreshold() time.Duration {
+	d, _ := time.ParseDuration(o.LatencyThreshold)
+	return d
+}
+
+// alerts returns the alerts of the objective, the default alerts longer
+// than the window are ignored.
+func (o *ObjectiveSpec) alerts() []*AlertSpec {
+	if len(o.Alerts) > 0 {
+		return o.Alerts
+	}
+
+	var alerts []*AlertSpec
+	for _, a := range defaultAlerts {
+		if a.longWindow() <= o.window() {
+			alerts = append(alerts, a)
+		}
+	}
+	return alerts
+}
+
+// errorBudget returns the ratio of bad requests allowed.
+func (o *ObjectiveSpec) errorBudget() float64 {
+	return 1 - o.Target/100
+}
+
+func (a *AlertSpec) longWindow() time.Duration {
+	d, _ := time.ParseDuration(a.LongWindow)
+	return d
+}
+
+func (a *AlertSpec) shortWindow() time.Duration {
+	d, _ := time.ParseDuration(a.ShortWindow)
+	return d
+}
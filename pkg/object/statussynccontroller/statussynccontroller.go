@@ -37,6 +37,15 @@ const (
 	Kind = "StatusSyncController"
 
 	maxStatusesRecordCount = 10
+
+	// fullSyncRounds is the number of rounds between two full
+	// synchronizations, only the changed statuses are pushed in the other
+	// rounds, along with the heartbeat.
+	fullSyncRounds = 12
+
+	// StaleAfterSeconds is the age of the heartbeat of a member, after
+	// which the statuses of the member are stale.
+	StaleAfterSeconds = 3 * SyncStatusPaceInUnixSeconds
 )
 
 type (
@@ -49,6 +58,10 @@ type (
 		timer *timetool.DistributedTimer
 
 		lastSyncStatusUnits map[string]*statusUnit
+		// lastSyncStatusData is the statuses pushed to the cluster,
+		// without timestamps, to detect the changed statuses.
+		lastSyncStatusData map[string]string
+		syncRounds         int
 
 		// sorted by timestamp in ascending order
 		statusSnapshots      []*StatusesSnapshot
@@ -74,6 +87,11 @@ type (
 		objectName string
 		timestamp  int64
 		status     interface{}
+		// resources is the resource status of the controllers, the one
+		// of the traffic objects is in their status.
+		resources *supervisor.ResourceStatus
+		// readiness is the readiness of the controllers, like resources.
+		readiness *supervisor.ObjectReadiness
 	}
 )
 
@@ -94,14 +112,11 @@ func (s *statusUnit) id() string {
 	return s.namespace + "/" + s.objectName
 }
 
-func (s *statusUnit) marshal() ([]byte, error) {
-	buff, err := codectool.MarshalJSON(s.status)
-	if err != nil {
-		return nil, err
-	}
-
+// marshal marshals the status with the timestamp, buff is the status
+// marshaled by marshalStatus.
+func (s *statusUnit) marshal(buff []byte) ([]byte, error) {
 	m := map[string]interface{}{}
-	err = codectool.Unmarshal(buff, &m)
+	err := codectool.Unmarshal(buff, &m)
 	if err != nil {
 		return nil, err
 	}
@@ -120,6 +135,29 @@ func (s *statusUnit) marshal() ([]byte, error) {
 	return buff, nil
 }
 
+func (s *statusUnit) marshalStatus() ([]byte, error) {
+	buff, err := codectool.MarshalJSON(s.status)
+	if err != nil || (s.resources == nil && s.readiness == nil) {
+		return buff, err
+	}
+
+	m := map[string]interface{}{}
+	if err = codectool.Unmarshal(buff, &m); err != nil {
+		return nil, err
+	}
+	if m == nil {
+		m = map[string]interface{}{}
+	}
+	if s.resources != nil {
+		m["resources"] = s.resources
+	}
+	if s.readiness != nil {
+		m["readiness"] = s.readiness
+	}
+
+	return codectool.MarshalJSON(m)
+}
+
 func init() {
 	supervisor.Register(&StatusSyncController{})
 }
@@ -217,6 +255,8 @@ func (ssc *StatusSyncController) handleStatus(unixTimestamp int64) {
 			}
 		default:
 			su := newStatusUnit(namespace, objectName, unixTimestamp, status.ObjectStatus)
+			su.resources = entity.ResourceStatus()
+			su.readiness = entity.Readiness()
 			statusUnits[su.id()] = su
 		}
 
@@ -226,56 +266,74 @@ func (ssc *StatusSyncController) handleStatus(unixTimestamp int64) {
 	ssc.superSpec.Super().WalkControllers(walkFn)
 
 	ssc.takeSnapshot(statusUnits, unixTimestamp)
-	ssc.syncStatusToCluster(statusUnits)
+	ssc.syncStatusToCluster(statusUnits, unixTimestamp)
+}
+
+func (ssc *StatusSyncController) putAndDeleteUnderLease(kvs map[string]*string) {
+	err := ssc.superSpec.Super().Cluster().PutAndDeleteUnderLease(kvs)
+	if err != nil {
+		logger.Errorf("sync status failed. If the message size is too large, "+
+			"please increase the value of cluster.MaxCallSendMsgSize in configuration: %v", err)
+	}
 }
 
-func (ssc *StatusSyncController) syncStatusToCluster(statusUnits map[string]*statusUnit) {
+// syncStatusToCluster pushes the changed statuses and the heartbeat to the
+// cluster, the timestamp of a status is the time it changed last time,
+// all statuses are pushed every fullSyncRounds rounds.
+func (ssc *StatusSyncController) syncStatusToCluster(statusUnits map[string]*statusUnit, unixTimestamp int64) {
+	layout := ssc.superSpec.Super().Cluster().Layout()
 	// Delete statuses which disappeared in current status.
 	if ssc.lastSyncStatusUnits != nil {
 		kvs := make(map[string]*string)
 		for k, su := range ssc.lastSyncStatusUnits {
 			if _, exists := statusUnits[k]; !exists {
-				key := su.clusterKey(ssc.superSpec.Super().Cluster().Layout())
-				kvs[key] = nil
+				kvs[su.clusterKey(layout)] = nil
 			}
 		}
-		err := ssc.superSpec.Super().Cluster().PutAndDeleteUnderLease(kvs)
-		if err != nil {
-			logger.Errorf("sync status failed. If the message size is too large, "+
-				"please increase the value of cluster.MaxCallSendMsgSize in configuration: %v", err)
+		if len(kvs) > 0 {
+			ssc.putAndDeleteUnderLease(kvs)
 		}
 	}
 
+	fullSync := ssc.syncRounds%fullSyncRounds == 0 || ssc.lastSyncStatusData == nil
+	ssc.syncRounds++
+
+	lastData := ssc.lastSyncStatusData
 	ssc.lastSyncStatusUnits = statusUnits
+	ssc.lastSyncStatusData = make(map[string]string, len(statusUnits))
 
-	kvs := make(map[string]*string)
-	for _, su := range statusUnits {
-		key := su.clusterKey(ssc.superSpec.Super().Cluster().Layout())
-		buff, err := su.marshal()
+	heartbeat := string(codectool.MustMarshalJSON(map[string]int64{"timestamp": unixTimestamp}))
+	kvs := map[string]*string{layout.StatusHeartbeatKey(): &heartbeat}
+
+	for id, su := range statusUnits {
+		data, err := su.marshalStatus()
+		if err != nil {
+			logger.Errorf("BUG: marshal %#v failed: %v", su, err)
+			continue
+		}
+
+		ssc.lastSyncStatusData[id] = string(data)
+		if !fullSync && lastData[id] == string(data) {
+			continue
+		}
+
+		buff, err := su.marshal(data)
 		if err != nil {
 			logger.Errorf("BUG: marshal %#v failed: %v", su, err)
 			continue
 		}
 
 		value := string(buff)
-		kvs[key] = &value
+		kvs[su.clusterKey(layout)] = &value
 
 		if len(kvs) >= ssc.statusUpdateMaxBatchSize {
-			err := ssc.superSpec.Super().Cluster().PutAndDeleteUnderLease(kvs)
-			if err != nil {
-				logger.Errorf("sync status failed. If the message size is too large, "+
-					"please increase the value of cluster.MaxCallSendMsgSize in configuration: %v", err)
-			}
+			ssc.putAndDeleteUnderLease(kvs)
 			kvs = make(map[string]*string)
 		}
 	}
 
 	if len(kvs) > 0 {
-		err := ssc.superSpec.Super().Cluster().PutAndDeleteUnderLease(kvs)
-		if err != nil {
-			logger.Errorf("sync status failed. If the message size is too large, "+
-				"please increase the value of cluster.MaxCallSendMsgSize in configuration: %v", err)
-		}
+		ssc.putAndDeleteUnderLease(kvs)
 	}
 }
 
@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package statussynccontroller
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newTestController(t *testing.T, cls *clustertest.MockedCluster) *StatusSyncController {
+	var mockMap sync.Map
+	super := supervisor.NewMock(nil, cls, mockMap, mockMap, nil, nil, false, nil, nil)
+	spec, err := super.NewSpec("name: status-sync-controller\nkind: StatusSyncController\n")
+	if err != nil {
+		t.Fatalf("create spec failed: %v", err)
+	}
+	return &StatusSyncController{superSpec: spec, statusUpdateMaxBatchSize: 10}
+}
+
+func newTestStatusUnits(timestamp int64, health string) map[string]*statusUnit {
+	units := map[string]*statusUnit{}
+	for _, name := range []string{"object-a", "object-b"} {
+		su := newStatusUnit("default", name, timestamp, map[string]string{"health": health})
+		units[su.id()] = su
+	}
+	return units
+}
+
+func TestSyncStatusToCluster(t *testing.T) {
+	assert := assert.New(t)
+
+	layout := &cluster.Layout{}
+	cls := clustertest.NewMockedCluster()
+	cls.MockedLayout = func() *cluster.Layout {
+		return layout
+	}
+
+	var pushed []map[string]*string
+	cls.MockedPutAndDeleteUnderLease = func(kvs map[string]*string) error {
+		pushed = append(pushed, kvs)
+		return nil
+	}
+
+	ssc := newTestController(t, cls)
+	keyA := layout.StatusObjectKey("default", "object-a")
+	keyB := layout.StatusObjectKey("default", "object-b")
+
+	// the first round is a full synchronization.
+	ssc.syncStatusToCluster(newTestStatusUnits(1, "ok"), 1)
+	assert.Len(pushed, 1)
+	assert.Len(pushed[0], 3)
+	assert.Contains(pushed[0], layout.StatusHeartbeatKey())
+	assert.Contains(pushed[0], keyA)
+	assert.Contains(pushed[0], keyB)
+	assert.JSONEq(`{"timestamp":1}`, *pushed[0][layout.StatusHeartbeatKey()])
+
+	// only the heartbeat is pushed if no status changed.
+	pushed = nil
+	ssc.syncStatusToCluster(newTestStatusUnits(2, "ok"), 2)
+	assert.Len(pushed, 1)
+	assert.Len(pushed[0], 1)
+	assert.JSONEq(`{"timestamp":2}`, *pushed[0][layout.StatusHeartbeatKey()])
+
+	// the changed status is pushed.
+	pushed = nil
+	units := newTestStatusUnits(3, "ok")
+	units["default/object-b"].status = map[string]string{"health": "down"}
+	ssc.syncStatusToCluster(units, 3)
+	assert.Len(pushed, 1)
+	assert.Len(pushed[0], 2)
+	assert.JSONEq(`{"health":"down","timestamp":3}`, *pushed[0][keyB])
+
+	// the disappeared status is deleted.
+	pushed = nil
+	delete(units, "default/object-b")
+	ssc.syncStatusToCluster(units, 4)
+	assert.Len(pushed, 2)
+	assert.Equal(map[string]*string{keyB: nil}, pushed[0])
+	assert.Len(pushed[1], 1)
+
+	// all statuses are pushed every fullSyncRounds rounds.
+	for i := ssc.syncRounds; i%fullSyncRounds != 0; i++ {
+		ssc.syncStatusToCluster(units, 5)
+	}
+	pushed = nil
+	ssc.syncStatusToCluster(units, 6)
+	assert.Len(pushed, 1)
+	assert.Len(pushed[0], 2)
+	assert.Contains(pushed[0], keyA)
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tcpserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+type (
+	// ServerStatus is the status of a backend server.
+	ServerStatus struct {
+		Address           string `json:"address"`
+		Connections       uint64 `json:"connections"`
+		ActiveConnections int64  `json:"activeConnections"`
+		Failures          uint64 `json:"failures"`
+	}
+
+	// pool chooses a backend server and connects it.
+	pool struct {
+		servers []*ServerStatus
+		policy  string
+		counter uint64
+		dialer  *net.Dialer
+		tlsCfg  *tls.Config
+	}
+)
+
+func newPool(spec *PoolSpec, connectTimeout time.Duration) *pool {
+	p := &pool{
+		policy: spec.LoadBalance,
+		dialer: &net.Dialer{Timeout: connectTimeout},
+	}
+	for _, s := range spec.Servers {
+		p.servers = append(p.servers, &ServerStatus{Address: s.Address})
+	}
+	if spec.TLS != nil {
+		// the spec has been validated, so no error here.
+		p.tlsCfg, _ = spec.TLS.tlsConfig()
+	}
+	return p
+}
+
+// candidates returns the servers in the order to be tried.
+func (p *pool) candidates() []*ServerStatus {
+	n := len(p.servers)
+	result := make([]*ServerStatus, n)
+
+	if p.policy == LoadBalancePolicyLeastConn {
+		copy(result, p.servers)
+		active := make(map[*ServerStatus]int64, n)
+		for _, s := range result {
+			active[s] = atomic.LoadInt64(&s.ActiveConnections)
+		}
+		sort.SliceStable(result, func(i, j int) bool {
+			return active[result[i]] < active[result[j]]
+		})
+		return result
+	}
+
+	start := int((atomic.AddUint64(&p.counter, 1) - 1) % uint64(n))
+	for i := range result {
+		result[i] = p.servers[(start+i)%n]
+	}
+	return result
+}
+
+// dial connects a backend server, the next server is tried if it failed.
+// The active connections of the returned server has been increased.
+func (p *pool) dial() (net.Conn, *ServerStatus, error) {
+	var err error
+	for _, s := range p.candidates() {
+		var conn net.Conn
+		if p.tlsCfg != nil {
+			conn, err = tls.DialWithDialer(p.dialer, "tcp", s.Address, p.tlsCfg)
+		} else {
+			conn, err = p.dialer.Dial("tcp", s.Address)
+		}
+		if err != nil {
+			atomic.AddUint64(&s.Failures, 1)
+			logger.Warnf("connect backend server %s failed: %v", s.Address, err)
+			continue
+		}
+		atomic.AddUint64(&s.Connections, 1)
+		atomic.AddInt64(&s.ActiveConnections, 1)
+		return conn, s, nil
+	}
+	return nil, nil, fmt.Errorf("no available backend server, last error: %v", err)
+}
+
+func (p *pool) release(s *ServerStatus) {
+	atomic.AddInt64(&s.ActiveConnections, -1)
+}
+
+func (p *pool) status() []*ServerStatus {
+	result := make([]*ServerStatus, 0, len(p.servers))
+	for _, s := range p.servers {
+		result = append(result, &ServerStatus{
+			Address:           s.Address,
+			Connections:       atomic.LoadUint64(&s.Connections),
+			ActiveConnections: atomic.LoadInt64(&s.ActiveConnections),
+			Failures:          atomic.LoadUint64(&s.Failures),
+		})
+	}
+	return result
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tcpserver
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolCandidates(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &PoolSpec{Servers: []*ServerSpec{{Address: "a:1"}, {Address: "b:1"}, {Address: "c:1"}}}
+	p := newPool(spec, time.Second)
+	addresses := func() []string {
+		var result []string
+		for _, s := range p.candidates() {
+			result = append(result, s.Address)
+		}
+		return result
+	}
+	assert.Equal([]string{"a:1", "b:1", "c:1"}, addresses())
+	assert.Equal([]string{"b:1", "c:1", "a:1"}, addresses())
+	assert.Equal([]string{"c:1", "a:1", "b:1"}, addresses())
+
+	spec.LoadBalance = LoadBalancePolicyLeastConn
+	p = newPool(spec, time.Second)
+	p.servers[0].ActiveConnections = 2
+	p.servers[1].ActiveConnections = 1
+	assert.Equal([]string{"c:1", "b:1", "a:1"}, addresses())
+	p.servers[2].ActiveConnections = 3
+	assert.Equal([]string{"b:1", "a:1", "c:1"}, addresses())
+}
+
+func TestPoolDial(t *testing.T) {
+	assert := assert.New(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	defer ln.Close()
+
+	// a closed port, the dial fails
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	closed.Close()
+
+	spec := &PoolSpec{Servers: []*ServerSpec{
+		{Address: closed.Addr().String()},
+		{Address: ln.Addr().String()},
+	}}
+	p := newPool(spec, time.Second)
+	conn, server, err := p.dial()
+	assert.Nil(err)
+	defer conn.Close()
+	assert.Equal(ln.Addr().String(), server.Address)
+
+	status := p.status()
+	assert.Equal(uint64(1), status[0].Failures)
+	assert.Equal(int64(1), status[1].ActiveConnections)
+	p.release(server)
+	assert.Equal(int64(0), p.status()[1].ActiveConnections)
+
+	p = newPool(&PoolSpec{Servers: []*ServerSpec{{Address: closed.Addr().String()}}}, time.Second)
+	_, _, err = p.dial()
+	assert.NotNil(err)
+}
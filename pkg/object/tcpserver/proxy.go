@@ -0,0 +1,273 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tcpserver
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/graceupdate"
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	defaultConnectTimeout = 10 * time.Second
+	copyBufferSize        = 32 * 1024
+)
+
+type (
+	// Status is the status of TCPServer.
+	Status struct {
+		Connections         uint64          `json:"connections"`
+		ActiveConnections   int64           `json:"activeConnections"`
+		RejectedConnections uint64          `json:"rejectedConnections"`
+		ClientBytes         uint64          `json:"clientBytes"`
+		BackendBytes        uint64          `json:"backendBytes"`
+		Servers             []*ServerStatus `json:"servers"`
+	}
+
+	// proxy accepts client connections and proxies them to the backend
+	// servers.
+	proxy struct {
+		name        string
+		spec        *Spec
+		listener    net.Listener
+		pool        *pool
+		idleTimeout time.Duration
+
+		stat  *Status
+		conns sync.Map
+		wg    sync.WaitGroup
+		done  chan struct{}
+	}
+
+	// connection is a proxied connection, the bytes are counted per
+	// connection.
+	connection struct {
+		client       net.Conn
+		backend      net.Conn
+		clientBytes  uint64
+		backendBytes uint64
+		lastActive   int64
+	}
+
+	closeWriter interface {
+		CloseWrite() error
+	}
+)
+
+func newProxy(name string, spec *Spec) (*proxy, error) {
+	connectTimeout := defaultConnectTimeout
+	if spec.ConnectTimeout != "" {
+		connectTimeout, _ = time.ParseDuration(spec.ConnectTimeout)
+	}
+
+	p := &proxy{
+		name: name,
+		spec: spec,
+		pool: newPool(&spec.Pool, connectTimeout),
+		stat: &Status{},
+		done: make(chan struct{}),
+	}
+	if spec.IdleTimeout != "" {
+		p.idleTimeout, _ = time.ParseDuration(spec.IdleTimeout)
+	}
+
+	l, err := graceupdate.Listen("tcp", fmt.Sprintf(":%d", spec.Port))
+	if err != nil {
+		return nil, fmt.Errorf("listen on port %d failed: %v", spec.Port, err)
+	}
+	if spec.TLS != nil {
+		cfg, err := spec.TLS.tlsConfig()
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l = tls.NewListener(l, cfg)
+	}
+	p.listener = l
+
+	go p.run()
+	return p, nil
+}
+
+func (p *proxy) run() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			select {
+			case <-p.done:
+				return
+			default:
+			}
+			logger.Errorf("%s accept connection failed: %v", p.name, err)
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+
+		if max := p.spec.MaxConnections; max > 0 && atomic.LoadInt64(&p.stat.ActiveConnections) >= int64(max) {
+			atomic.AddUint64(&p.stat.RejectedConnections, 1)
+			logger.Warnf("%s reject connection from %s: exceed max connections %d", p.name, conn.RemoteAddr(), max)
+			conn.Close()
+			continue
+		}
+
+		atomic.AddUint64(&p.stat.Connections, 1)
+		atomic.AddInt64(&p.stat.ActiveConnections, 1)
+		p.wg.Add(1)
+		go p.handle(conn)
+	}
+}
+
+func (p *proxy) handle(client net.Conn) {
+	defer func() {
+		atomic.AddInt64(&p.stat.ActiveConnections, -1)
+		p.wg.Done()
+	}()
+
+	p.conns.Store(client, struct{}{})
+	defer p.conns.Delete(client)
+	defer client.Close()
+
+	backend, server, err := p.pool.dial()
+	if err != nil {
+		logger.Errorf("%s proxy connection from %s failed: %v", p.name, client.RemoteAddr(), err)
+		return
+	}
+	defer p.pool.release(server)
+	p.conns.Store(backend, struct{}{})
+	defer p.conns.Delete(backend)
+	defer backend.Close()
+
+	c := &connection{client: client, backend: backend}
+	c.touch()
+	start := time.Now()
+
+	errc := make(chan error, 2)
+	go func() { errc <- p.pipe(c, backend, client, &c.clientBytes, &p.stat.ClientBytes) }()
+	go func() { errc <- p.pipe(c, client, backend, &c.backendBytes, &p.stat.BackendBytes) }()
+
+	// half close the connection when one direction finished normally, and
+	// close the connection when an error occurred.
+	for i := 0; i < 2; i++ {
+		err = <-errc
+		if err != nil {
+			client.Close()
+			backend.Close()
+		}
+	}
+
+	logger.Debugf("%s connection %s -> %s closed after %v, client bytes: %d, backend bytes: %d",
+		p.name, client.RemoteAddr(), server.Address, time.Since(start),
+		atomic.LoadUint64(&c.clientBytes), atomic.LoadUint64(&c.backendBytes))
+}
+
+// pipe copies data from src to dst, the byte counters are updated while
+// copying so that the status of long connections is up to date.
+func (p *proxy) pipe(c *connection, dst, src net.Conn, connCounter, counter *uint64) error {
+	buf := make([]byte, copyBufferSize)
+	for {
+		if p.idleTimeout > 0 {
+			src.SetReadDeadline(time.Now().Add(p.idleTimeout))
+		}
+
+		n, err := src.Read(buf)
+		if n > 0 {
+			c.touch()
+			atomic.AddUint64(connCounter, uint64(n))
+			atomic.AddUint64(counter, uint64(n))
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+
+		if err == nil {
+			continue
+		}
+		if err == io.EOF {
+			if cw, ok := dst.(closeWriter); ok {
+				return cw.CloseWrite()
+			}
+			return err
+		}
+		// the other direction is still active.
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() && !c.idle(p.idleTimeout) {
+			continue
+		}
+		return err
+	}
+}
+
+func (c *connection) touch() {
+	atomic.StoreInt64(&c.lastActive, time.Now().UnixNano())
+}
+
+func (c *connection) idle(timeout time.Duration) bool {
+	last := atomic.LoadInt64(&c.lastActive)
+	return time.Since(time.Unix(0, last)) >= timeout
+}
+
+func (p *proxy) status() *Status {
+	return &Status{
+		Connections:         atomic.LoadUint64(&p.stat.Connections),
+		ActiveConnections:   atomic.LoadInt64(&p.stat.ActiveConnections),
+		RejectedConnections: atomic.LoadUint64(&p.stat.RejectedConnections),
+		ClientBytes:         atomic.LoadUint64(&p.stat.ClientBytes),
+		BackendBytes:        atomic.LoadUint64(&p.stat.BackendBytes),
+		Servers:             p.pool.status(),
+	}
+}
+
+// close stops accepting connections and closes all the connections, the
+// connections are drained first if a new process has taken over the
+// listener in a graceful upgrade.
+func (p *proxy) close() {
+	close(p.done)
+	p.listener.Close()
+	if graceupdate.IsDraining() {
+		p.drain(graceupdate.DrainTimeout())
+	}
+	p.conns.Range(func(key, value interface{}) bool {
+		key.(net.Conn).Close()
+		return true
+	})
+	p.wg.Wait()
+}
+
+// drain waits for the connections to finish within the timeout.
+func (p *proxy) drain(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		logger.Warnf("%s drain connections timeout, %d connections are closed",
+			p.name, atomic.LoadInt64(&p.stat.ActiveConnections))
+	}
+}
@@ -0,0 +1,234 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tcpserver
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// startEchoServer starts a server which writes back the data received
+// after the prefix.
+func startEchoServer(t *testing.T, prefix string) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Write([]byte(prefix))
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln
+}
+
+func echo(conn net.Conn, msg string, prefix string) (string, error) {
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		return "", err
+	}
+	buf := make([]byte, len(prefix)+len(msg))
+	_, err := io.ReadFull(conn, buf)
+	return string(buf), err
+}
+
+func TestProxy(t *testing.T) {
+	assert := assert.New(t)
+
+	b1 := startEchoServer(t, "b1:")
+	defer b1.Close()
+	b2 := startEchoServer(t, "b2:")
+	defer b2.Close()
+
+	spec := &Spec{
+		Port:           10091,
+		MaxConnections: 2,
+		Pool: PoolSpec{Servers: []*ServerSpec{
+			{Address: b1.Addr().String()},
+			{Address: b2.Addr().String()},
+		}},
+	}
+	p, err := newProxy("test", spec)
+	assert.Nil(err)
+	defer p.close()
+
+	addr := fmt.Sprintf("127.0.0.1:%d", spec.Port)
+	c1, err := net.Dial("tcp", addr)
+	assert.Nil(err)
+	defer c1.Close()
+	resp, err := echo(c1, "hello", "b1:")
+	assert.Nil(err)
+	assert.Equal("b1:hello", resp)
+
+	c2, err := net.Dial("tcp", addr)
+	assert.Nil(err)
+	resp, err = echo(c2, "world", "b2:")
+	assert.Nil(err)
+	assert.Equal("b2:world", resp)
+
+	// exceeds max connections
+	c3, err := net.Dial("tcp", addr)
+	assert.Nil(err)
+	c3.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = c3.Read(make([]byte, 1))
+	assert.Equal(io.EOF, err)
+	c3.Close()
+
+	status := p.status()
+	assert.Equal(uint64(2), status.Connections)
+	assert.Equal(int64(2), status.ActiveConnections)
+	assert.Equal(uint64(1), status.RejectedConnections)
+	assert.Equal(uint64(10), status.ClientBytes)
+	assert.Equal(uint64(16), status.BackendBytes)
+	assert.Equal(int64(1), status.Servers[0].ActiveConnections)
+
+	// the client closes its writing, and the response is still received
+	c2.(*net.TCPConn).CloseWrite()
+	_, err = c2.Read(make([]byte, 1))
+	assert.Equal(io.EOF, err)
+	c2.Close()
+	assert.Eventually(func() bool {
+		return p.status().ActiveConnections == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestProxyIdleTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	b := startEchoServer(t, "")
+	defer b.Close()
+
+	spec := &Spec{
+		Port:        10092,
+		IdleTimeout: "200ms",
+		Pool:        PoolSpec{Servers: []*ServerSpec{{Address: b.Addr().String()}}},
+	}
+	p, err := newProxy("test", spec)
+	assert.Nil(err)
+	defer p.close()
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", spec.Port))
+	assert.Nil(err)
+	defer conn.Close()
+
+	// keep active
+	for i := 0; i < 3; i++ {
+		resp, err := echo(conn, "ping", "")
+		assert.Nil(err)
+		assert.Equal("ping", resp)
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	start := time.Now()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.Equal(io.EOF, err)
+	assert.Less(time.Since(start), time.Second)
+}
+
+func TestProxyTLS(t *testing.T) {
+	assert := assert.New(t)
+
+	b := startEchoServer(t, "")
+	defer b.Close()
+
+	spec := &Spec{
+		Port: 10093,
+		TLS: &TLSSpec{
+			CertBase64: base64.StdEncoding.EncodeToString([]byte(certPem)),
+			KeyBase64:  base64.StdEncoding.EncodeToString([]byte(keyPem)),
+		},
+		Pool: PoolSpec{Servers: []*ServerSpec{{Address: b.Addr().String()}}},
+	}
+	p, err := newProxy("test", spec)
+	assert.Nil(err)
+	defer p.close()
+
+	conn, err := tls.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", spec.Port), &tls.Config{InsecureSkipVerify: true})
+	assert.Nil(err)
+	defer conn.Close()
+	resp, err := echo(conn, "secret", "")
+	assert.Nil(err)
+	assert.Equal("secret", resp)
+}
+
+func TestProxyDrain(t *testing.T) {
+	assert := assert.New(t)
+
+	b := startEchoServer(t, "")
+	defer b.Close()
+
+	spec := &Spec{
+		Port: 10094,
+		Pool: PoolSpec{Servers: []*ServerSpec{{Address: b.Addr().String()}}},
+	}
+	p, err := newProxy("test", spec)
+	assert.Nil(err)
+
+	addr := fmt.Sprintf("127.0.0.1:%d", spec.Port)
+	c1, err := net.Dial("tcp", addr)
+	assert.Nil(err)
+	defer c1.Close()
+	resp, err := echo(c1, "hello", "")
+	assert.Nil(err)
+	assert.Equal("hello", resp)
+
+	// the connection finishes while draining.
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		c1.Close()
+	}()
+	start := time.Now()
+	p.drain(5 * time.Second)
+	assert.Less(time.Since(start), 2*time.Second)
+	assert.Equal(int64(0), p.status().ActiveConnections)
+
+	c2, err := net.Dial("tcp", addr)
+	assert.Nil(err)
+	defer c2.Close()
+	resp, err = echo(c2, "world", "")
+	assert.Nil(err)
+	assert.Equal("world", resp)
+
+	// the drain timeout expires, and the connection is still served.
+	start = time.Now()
+	p.drain(200 * time.Millisecond)
+	assert.GreaterOrEqual(time.Since(start), 200*time.Millisecond)
+	assert.Equal(int64(1), p.status().ActiveConnections)
+	resp, err = echo(c2, "again", "")
+	assert.Nil(err)
+	assert.Equal("again", resp)
+
+	// the connections not drained are closed.
+	p.close()
+	c2.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = c2.Read(make([]byte, 1))
+	assert.Equal(io.EOF, err)
+}
@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tcpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// LoadBalancePolicyRoundRobin is the load balance policy of round robin.
+	LoadBalancePolicyRoundRobin = "roundRobin"
+	// LoadBalancePolicyLeastConn is the load balance policy of least connections.
+	LoadBalancePolicyLeastConn = "leastConn"
+)
+
+type (
+	// Spec describes the TCPServer.
+	// maxConnections: max concurrent client connections, 0 means no limit
+	// connectTimeout: timeout of connecting a backend server, default 10s
+	// idleTimeout: the connection is closed if no data is transferred in
+	// either direction within it, default no timeout
+	Spec struct {
+		Port           uint16   `json:"port" jsonschema:"required,minimum=1"`
+		MaxConnections int      `json:"maxConnections" jsonschema:"omitempty,minimum=0"`
+		ConnectTimeout string   `json:"connectTimeout" jsonschema:"omitempty,format=duration"`
+		IdleTimeout    string   `json:"idleTimeout" jsonschema:"omitempty,format=duration"`
+		TLS            *TLSSpec `json:"tls" jsonschema:"omitempty"`
+		Pool           PoolSpec `json:"pool" jsonschema:"required"`
+	}
+
+	// TLSSpec is the certificate to terminate TLS of client connections.
+	TLSSpec struct {
+		CertBase64 string `json:"certBase64" jsonschema:"required,format=base64"`
+		KeyBase64  string `json:"keyBase64" jsonschema:"required,format=base64"`
+	}
+
+	// PoolSpec describes the backend servers.
+	PoolSpec struct {
+		Servers     []*ServerSpec   `json:"servers" jsonschema:"required,minItems=1"`
+		LoadBalance string          `json:"loadBalance" jsonschema:"omitempty,enum=,enum=roundRobin,enum=leastConn"`
+		TLS         *BackendTLSSpec `json:"tls" jsonschema:"omitempty"`
+	}
+
+	// ServerSpec is a backend server.
+	ServerSpec struct {
+		Address string `json:"address" jsonschema:"required"`
+	}
+
+	// BackendTLSSpec is the configuration to connect backend servers with
+	// TLS, serverName defaults to the host of the server address.
+	BackendTLSSpec struct {
+		ServerName         string `json:"serverName" jsonschema:"omitempty"`
+		CertBase64         string `json:"certBase64" jsonschema:"omitempty,format=base64"`
+		KeyBase64          string `json:"keyBase64" jsonschema:"omitempty,format=base64"`
+		RootCertBase64     string `json:"rootCertBase64" jsonschema:"omitempty,format=base64"`
+		InsecureSkipVerify bool   `json:"insecureSkipVerify" jsonschema:"omitempty"`
+	}
+)
+
+// Validate validates the Spec.
+func (spec *Spec) Validate() error {
+	for _, d := range []string{spec.ConnectTimeout, spec.IdleTimeout} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d); err != nil {
+			return fmt.Errorf("invalid duration %s: %v", d, err)
+		}
+	}
+	return nil
+}
+
+// Validate validates the TLSSpec.
+func (s *TLSSpec) Validate() error {
+	_, err := s.tlsConfig()
+	return err
+}
+
+func (s *TLSSpec) tlsConfig() (*tls.Config, error) {
+	certPem, _ := base64.StdEncoding.DecodeString(s.CertBase64)
+	keyPem, _ := base64.StdEncoding.DecodeString(s.KeyBase64)
+	cert, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		return nil, fmt.Errorf("generate x509 key pair failed: %v", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+// Validate validates the ServerSpec.
+func (s *ServerSpec) Validate() error {
+	if _, _, err := net.SplitHostPort(s.Address); err != nil {
+		return fmt.Errorf("invalid server address %s: %v", s.Address, err)
+	}
+	return nil
+}
+
+// Validate validates the BackendTLSSpec.
+func (s *BackendTLSSpec) Validate() error {
+	if (s.CertBase64 == "") != (s.KeyBase64 == "") {
+		return fmt.Errorf("certBase64 and keyBase64 must be both empty or both not empty")
+	}
+
+	_, err := s.tlsConfig()
+	return err
+}
+
+func (s *BackendTLSSpec) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         s.ServerName,
+		InsecureSkipVerify: s.InsecureSkipVerify,
+	}
+
+	if s.CertBase64 != "" {
+		certPem, _ := base64.StdEncoding.DecodeString(s.CertBase64)
+		keyPem, _ := base64.StdEncoding.DecodeString(s.KeyBase64)
+		cert, err := tls.X509KeyPair(certPem, keyPem)
+		if err != nil {
+			return nil, fmt.Errorf("generate x509 key pair failed: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if s.RootCertBase64 != "" {
+		rootCertPem, _ := base64.StdEncoding.DecodeString(s.RootCertBase64)
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(rootCertPem) {
+			return nil, fmt.Errorf("no valid certificate found in rootCertBase64")
+		}
+		cfg.RootCAs = pool
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tcpserver
+
+import (
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Category is the category of TCPServer.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of TCPServer.
+	Kind = "TCPServer"
+)
+
+func init() {
+	supervisor.Register(&TCPServer{})
+}
+
+type (
+	// TCPServer proxies TCP connections to backend servers.
+	TCPServer struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+		proxy     *proxy
+	}
+)
+
+// Category returns the category of TCPServer.
+func (ts *TCPServer) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of TCPServer.
+func (ts *TCPServer) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of TCPServer.
+func (ts *TCPServer) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Init initializes TCPServer.
+func (ts *TCPServer) Init(superSpec *supervisor.Spec) {
+	ts.superSpec, ts.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	ts.reload()
+}
+
+// Inherit inherits previous generation of TCPServer.
+func (ts *TCPServer) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	previousGeneration.Close()
+	ts.Init(superSpec)
+}
+
+func (ts *TCPServer) reload() {
+	p, err := newProxy(ts.superSpec.Name(), ts.spec)
+	if err != nil {
+		logger.Errorf("%s start failed: %v", ts.superSpec.Name(), err)
+		return
+	}
+	ts.proxy = p
+}
+
+// Status returns the status of TCPServer.
+func (ts *TCPServer) Status() *supervisor.Status {
+	if ts.proxy == nil {
+		return &supervisor.Status{ObjectStatus: &Status{}}
+	}
+	return &supervisor.Status{ObjectStatus: ts.proxy.status()}
+}
+
+// Close closes TCPServer.
+func (ts *TCPServer) Close() {
+	if ts.proxy != nil {
+		ts.proxy.close()
+	}
+}
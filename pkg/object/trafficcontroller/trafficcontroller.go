@@ -86,8 +86,10 @@ type (
 
 	// TrafficObjectStatus is the status of traffic object.
 	TrafficObjectStatus struct {
-		Spec   interface{} `json:"spec"`
-		Status interface{} `json:"status"`
+		Spec      interface{}                 `json:"spec"`
+		Status    interface{}                 `json:"status"`
+		Resources *supervisor.ResourceStatus  `json:"resources,omitempty"`
+		Readiness *supervisor.ObjectReadiness `json:"readiness,omitempty"`
 	}
 )
 
@@ -113,6 +115,12 @@ func (ns *Namespace) GetHandler(name string) (context.Handler, bool) {
 		return nil, false
 	}
 
+	// The traffic of the pipeline exceeding its resource limits is shed as
+	// if the pipeline doesn't exist.
+	if entity.(*supervisor.ObjectEntity).Resources().Exceeded() {
+		return nil, false
+	}
+
 	handler := entity.(*supervisor.ObjectEntity).Instance().(context.Handler)
 	return handler, true
 }
@@ -647,11 +655,15 @@ func (tc *TrafficController) Status() *supervisor.Status {
 			k := key.(string)
 			v := value.(*supervisor.ObjectEntity)
 
+			// NOTE: the raw spec keeps the secret references, while the
+			// object spec holds the resolved values of the secrets.
 			trafficObject := &TrafficObject{
 				Name: k,
 				TrafficObjectStatus: TrafficObjectStatus{
-					Spec:   v.Spec().ObjectSpec(),
-					Status: v.Instance().Status().ObjectStatus,
+					Spec:      v.Spec().RawSpec(),
+					Status:    v.Instance().Status().ObjectStatus,
+					Resources: v.ResourceStatus(),
+					Readiness: v.Readiness(),
 				},
 			}
 
@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webhookdispatcher
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/v"
+)
+
+const (
+	webhookAPIPrefix = "/webhookdispatchers/%s"
+
+	sourceSpec = "spec"
+	sourceAPI  = "api"
+
+	maskedSecret = "******"
+)
+
+// subscriberInfo is a subscriber returned by the admin API, the secret is
+// masked.
+type subscriberInfo struct {
+	SubscriberSpec `json:",inline"`
+	// Source is spec or api, only the subscribers added by the admin API
+	// could be deleted by it.
+	Source string `json:"source"`
+}
+
+func (d *WebhookDispatcher) apiPath(action string) string {
+	path := fmt.Sprintf(webhookAPIPrefix, d.superSpec.Name())
+	if action != "" {
+		path += "/" + action
+	}
+	return path
+}
+
+func (d *WebhookDispatcher) registerAPIs() {
+	group := &api.Group{
+		Group: d.superSpec.Name(),
+		Entries: []*api.Entry{
+			{Path: d.apiPath("subscribers"), Method: http.MethodGet, Handler: d.listSubscribers},
+			{Path: d.apiPath("subscribers"), Method: http.MethodPost, Handler: d.putSubscriber},
+			{Path: d.apiPath("subscribers/{subscriber}"), Method: http.MethodGet, Handler: d.getSubscriberHandler},
+			{Path: d.apiPath("subscribers/{subscriber}"), Method: http.MethodDelete, Handler: d.deleteSubscriber},
+			{Path: d.apiPath("deliveries"), Method: http.MethodGet, Handler: d.listDeliveries},
+		},
+	}
+	api.RegisterAPIs(group)
+}
+
+func (d *WebhookDispatcher) unregisterAPIs() {
+	api.UnregisterAPIs(d.superSpec.Name())
+}
+
+func (d *WebhookDispatcher) subscriberInfo(s *SubscriberSpec, source string) *subscriberInfo {
+	info := &subscriberInfo{SubscriberSpec: *s, Source: source}
+	if info.Secret != "" {
+		info.Secret = maskedSecret
+	}
+	return info
+}
+
+func (d *WebhookDispatcher) listSubscribers(w http.ResponseWriter, r *http.Request) {
+	d.mutex.RLock()
+	result := []*subscriberInfo{}
+	for _, s := range d.subscribers {
+		result = append(result, d.subscriberInfo(s, sourceSpec))
+	}
+	for name, s := range d.dynamic {
+		if d.subscribers[name] == nil {
+			result = append(result, d.subscriberInfo(s, sourceAPI))
+		}
+	}
+	d.mutex.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	api.WriteBody(w, r, result)
+}
+
+func (d *WebhookDispatcher) getSubscriberHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "subscriber")
+
+	d.mutex.RLock()
+	var info *subscriberInfo
+	if s := d.subscribers[name]; s != nil {
+		info = d.subscriberInfo(s, sourceSpec)
+	} else if s := d.dynamic[name]; s != nil {
+		info = d.subscriberInfo(s, sourceAPI)
+	}
+	d.mutex.RUnlock()
+
+	if info == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("subscriber %s not found", name))
+		return
+	}
+	api.WriteBody(w, r, info)
+}
+
+// putSubscriber creates or replaces a subscriber, the subscribers in the
+// spec could not be replaced.
+func (d *WebhookDispatcher) putSubscriber(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	s := &SubscriberSpec{}
+	if err = codectool.Unmarshal(body, s); err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if vr := v.Validate(s); !vr.Valid() {
+		api.HandleAPIError(w, r, http.StatusBadRequest, vr)
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.subscribers[s.Name] != nil {
+		api.HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("subscriber %s is defined in the spec", s.Name))
+		return
+	}
+	if d.cluster != nil {
+		key := d.cluster.Layout().WebhookSubscriberKey(d.superSpec.Name(), s.Name)
+		if err = d.cluster.Put(key, string(codectool.MustMarshalJSON(s))); err != nil {
+			api.HandleAPIError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	d.dynamic[s.Name] = s
+
+	api.WriteBody(w, r, d.subscriberInfo(s, sourceAPI))
+}
+
+func (d *WebhookDispatcher) deleteSubscriber(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "subscriber")
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.subscribers[name] != nil {
+		api.HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("subscriber %s is defined in the spec", name))
+		return
+	}
+	if d.dynamic[name] == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("subscriber %s not found", name))
+		return
+	}
+	if d.cluster != nil {
+		key := d.cluster.Layout().WebhookSubscriberKey(d.superSpec.Name(), name)
+		if err := d.cluster.Delete(key); err != nil {
+			api.HandleAPIError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	delete(d.dynamic, name)
+}
+
+// listDeliveries returns the delivery logs of this member, which could be
+// filtered by the query parameters: event, subscriber, success and limit.
+func (d *WebhookDispatcher) listDeliveries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	f := &logFilter{
+		EventID:    query.Get("event"),
+		Subscriber: query.Get("subscriber"),
+		Success:    query.Get("success"),
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			api.HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid limit %s", limit))
+			return
+		}
+		f.Limit = n
+	}
+	api.WriteBody(w, r, d.logs.query(f))
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webhookdispatcher
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// DeliveryLog is the log of a delivery attempt.
+	DeliveryLog struct {
+		EventID    string    `json:"eventID"`
+		Event      string    `json:"event,omitempty"`
+		Subscriber string    `json:"subscriber"`
+		Attempt    int       `json:"attempt"`
+		Success    bool      `json:"success"`
+		StatusCode int       `json:"statusCode,omitempty"`
+		Error      string    `json:"error,omitempty"`
+		Time       time.Time `json:"time"`
+		Duration   string    `json:"duration"`
+		// NextAttempt is the backoff before the next attempt, it is empty
+		// if the delivery is not retried.
+		NextAttempt string `json:"nextAttempt,omitempty"`
+	}
+
+	// deliveryLogs keeps the latest logs in a ring.
+	deliveryLogs struct {
+		mutex sync.Mutex
+		logs  []*DeliveryLog
+		next  int
+		full  bool
+	}
+
+	// logFilter filters the logs, empty fields match everything.
+	logFilter struct {
+		EventID    string
+		Subscriber string
+		// Success is "true" or "false".
+		Success string
+		Limit   int
+	}
+)
+
+func newDeliveryLogs(size int) *deliveryLogs {
+	return &deliveryLogs{logs: make([]*DeliveryLog, size)}
+}
+
+func (dl *deliveryLogs) add(l *DeliveryLog) {
+	dl.mutex.Lock()
+	defer dl.mutex.Unlock()
+
+	dl.logs[dl.next] = l
+	dl.next++
+	if dl.next == len(dl.logs) {
+		dl.next, dl.full = 0, true
+	}
+}
+
+// latest returns the logs from the newest to the oldest.
+func (dl *deliveryLogs) latest() []*DeliveryLog {
+	result := make([]*DeliveryLog, 0, len(dl.logs))
+	for i := dl.next - 1; i >= 0; i-- {
+		result = append(result, dl.logs[i])
+	}
+	if dl.full {
+		for i := len(dl.logs) - 1; i >= dl.next; i-- {
+			result = append(result, dl.logs[i])
+		}
+	}
+	return result
+}
+
+// resize changes the size of the ring, the oldest logs are dropped if it
+// shrinks.
+func (dl *deliveryLogs) resize(size int) {
+	dl.mutex.Lock()
+	defer dl.mutex.Unlock()
+
+	if size == len(dl.logs) {
+		return
+	}
+
+	logs := dl.latest()
+	if len(logs) > size {
+		logs = logs[:size]
+	}
+	dl.logs = make([]*DeliveryLog, size)
+	dl.next, dl.full = 0, false
+	for i := len(logs) - 1; i >= 0; i-- {
+		dl.logs[dl.next] = logs[i]
+		dl.next++
+	}
+	if dl.next == size {
+		dl.next, dl.full = 0, true
+	}
+}
+
+// query returns the logs matching the filter from the newest to the
+// oldest.
+func (dl *deliveryLogs) query(f *logFilter) []*DeliveryLog {
+	dl.mutex.Lock()
+	defer dl.mutex.Unlock()
+
+	result := []*DeliveryLog{}
+	for _, l := range dl.latest() {
+		if f.Limit > 0 && len(result) >= f.Limit {
+			break
+		}
+		if f.EventID != "" && l.EventID != f.EventID {
+			continue
+		}
+		if f.Subscriber != "" && l.Subscriber != f.Subscriber {
+			continue
+		}
+		if f.Success == "true" && !l.Success || f.Success == "false" && l.Success {
+			continue
+		}
+		result = append(result, l)
+	}
+	return result
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webhookdispatcher
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPath           = "/"
+	defaultEventHeader    = "X-Event-Type"
+	defaultMaxBodySize    = 1024 * 1024
+	defaultQueueSize      = 1000
+	defaultWorkers        = 8
+	defaultMaxLogs        = 1000
+	defaultTimeout        = 10 * time.Second
+	defaultMaxAttempts    = 5
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = 5 * time.Minute
+)
+
+type (
+	// Spec describes the WebhookDispatcher.
+	Spec struct {
+		Port    uint16 `json:"port" jsonschema:"required,minimum=1"`
+		Address string `json:"address,omitempty" jsonschema:"omitempty"`
+		// Path is the path to receive the events.
+		Path string `json:"path,omitempty" jsonschema:"omitempty,pattern=^/"`
+		// Token authenticates the event sources by bearer token if it is
+		// not empty.
+		Token string `json:"token,omitempty" jsonschema:"omitempty"`
+		// EventHeader is the header of the event type, which decides the
+		// subscribers of the event.
+		EventHeader string `json:"eventHeader,omitempty" jsonschema:"omitempty"`
+		MaxBodySize int64  `json:"maxBodySize,omitempty" jsonschema:"omitempty,minimum=1"`
+		QueueSize   int    `json:"queueSize,omitempty" jsonschema:"omitempty,minimum=1"`
+		Workers     int    `json:"workers,omitempty" jsonschema:"omitempty,minimum=1"`
+		// MaxLogs is the number of the latest delivery logs kept.
+		MaxLogs int `json:"maxLogs,omitempty" jsonschema:"omitempty,minimum=1"`
+		// Retry is the default retry policy of the subscribers.
+		Retry       *RetrySpec        `json:"retry,omitempty" jsonschema:"omitempty"`
+		Subscribers []*SubscriberSpec `json:"subscribers,omitempty" jsonschema:"omitempty"`
+	}
+
+	// SubscriberSpec describes a subscriber of the events.
+	SubscriberSpec struct {
+		Name string `json:"name" jsonschema:"required,format=urlname"`
+		URL  string `json:"url" jsonschema:"required,format=uri"`
+		// Secret signs the deliveries with HMAC-SHA256 if it is not empty.
+		Secret string `json:"secret,omitempty" jsonschema:"omitempty"`
+		// Events are the event types subscribed, all events are subscribed
+		// if it is empty. A type ending with '*' matches the types with
+		// the prefix, e.g. order.* matches order.created.
+		Events  []string          `json:"events,omitempty" jsonschema:"omitempty"`
+		Headers map[string]string `json:"headers,omitempty" jsonschema:"omitempty"`
+		Timeout string            `json:"timeout,omitempty" jsonschema:"omitempty,format=duration"`
+		Retry   *RetrySpec        `json:"retry,omitempty" jsonschema:"omitempty"`
+	}
+
+	// RetrySpec describes how the failed deliveries are retried, the
+	// backoff is doubled after each failure.
+	RetrySpec struct {
+		MaxAttempts    int    `json:"maxAttempts,omitempty" jsonschema:"omitempty,minimum=1"`
+		InitialBackoff string `json:"initialBackoff,omitempty" jsonschema:"omitempty,format=duration"`
+		MaxBackoff     string `json:"maxBackoff,omitempty" jsonschema:"omitempty,format=duration"`
+	}
+)
+
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	names := map[string]bool{}
+	for _, s := range spec.Subscribers {
+		if names[s.Name] {
+			return fmt.Errorf("duplicated subscriber %s", s.Name)
+		}
+		names[s.Name] = true
+	}
+	return nil
+}
+
+// Validate validates SubscriberSpec.
+func (s *SubscriberSpec) Validate() error {
+	if !strings.HasPrefix(s.URL, "http://") && !strings.HasPrefix(s.URL, "https://") {
+		return fmt.Errorf("url of subscriber %s must be http or https", s.Name)
+	}
+	for _, e := range s.Events {
+		if i := strings.IndexByte(e, '*'); i >= 0 && i != len(e)-1 {
+			return fmt.Errorf("'*' must be the last character of event %s", e)
+		}
+	}
+	return nil
+}
+
+func parseDuration(s string, defaultValue time.Duration) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return defaultValue
+	}
+	return d
+}
+
+func (spec *Spec) path() string {
+	if spec.Path == "" {
+		return defaultPath
+	}
+	return spec.Path
+}
+
+func (spec *Spec) eventHeader() string {
+	if spec.EventHeader == "" {
+		return defaultEventHeader
+	}
+	return spec.EventHeader
+}
+
+func (spec *Spec) maxBodySize() int64 {
+	if spec.MaxBodySize == 0 {
+		return defaultMaxBodySize
+	}
+	return spec.MaxBodySize
+}
+
+func (spec *Spec) queueSize() int {
+	if spec.QueueSize == 0 {
+		return defaultQueueSize
+	}
+	return spec.QueueSize
+}
+
+func (spec *Spec) workers() int {
+	if spec.Workers == 0 {
+		return defaultWorkers
+	}
+	return spec.Workers
+}
+
+func (spec *Spec) maxLogs() int {
+	if spec.MaxLogs == 0 {
+		return defaultMaxLogs
+	}
+	return spec.MaxLogs
+}
+
+// subscribes returns whether the subscriber subscribes the event type.
+func (s *SubscriberSpec) subscribes(event string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if strings.HasSuffix(e, "*") {
+			if strings.HasPrefix(event, e[:len(e)-1]) {
+				return true
+			}
+		} else if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *SubscriberSpec) timeout() time.Duration {
+	return parseDuration(s.Timeout, defaultTimeout)
+}
+
+// retry returns the retry policy of the subscriber, the policy of the
+// dispatcher is used if the subscriber doesn't have one.
+func (s *SubscriberSpec) retry(defaultRetry *RetrySpec) *RetrySpec {
+	if s.Retry != nil {
+		return s.Retry
+	}
+	if defaultRetry != nil {
+		return defaultRetry
+	}
+	return &RetrySpec{}
+}
+
+func (r *RetrySpec) maxAttempts() int {
+	if r.MaxAttempts == 0 {
+		return defaultMaxAttempts
+	}
+	return r.MaxAttempts
+}
+
+// backoff returns the backoff after the attempts.
+func (r *RetrySpec) backoff(attempts int) time.Duration {
+	d := parseDuration(r.InitialBackoff, defaultInitialBackoff)
+	maxBackoff := parseDuration(r.MaxBackoff, defaultMaxBackoff)
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
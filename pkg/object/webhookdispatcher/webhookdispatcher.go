@@ -0,0 +1,538 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package webhookdispatcher receives events on an HTTP endpoint, and fans
+// them out to the subscribers.
+package webhookdispatcher
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/graceupdate"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// Category is the category of WebhookDispatcher.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of WebhookDispatcher.
+	Kind = "WebhookDispatcher"
+
+	stateRunning = "running"
+	stateFailed  = "failed"
+
+	// eventIDHeader carries the ID of the event, it is generated if the
+	// event source doesn't specify one.
+	eventIDHeader   = "X-Event-ID"
+	webhookIDHeader = "X-Webhook-ID"
+	// signatureHeader is "sha256=" + hex of HMAC-SHA256 of the timestamp,
+	// a dot and the body, with the secret of the subscriber.
+	signatureHeader = "X-Webhook-Signature"
+	timestampHeader = "X-Webhook-Timestamp"
+	eventHeader     = "X-Webhook-Event"
+	attemptHeader   = "X-Webhook-Attempt"
+
+	syncInterval    = 10 * time.Second
+	shutdownTimeout = 5 * time.Second
+)
+
+func init() {
+	supervisor.Register(&WebhookDispatcher{})
+}
+
+type (
+	// WebhookDispatcher receives events on an HTTP endpoint, and delivers
+	// them to the subscribers with retries.
+	//
+	// The event counters are read by Status while the workers update
+	// them with sync/atomic, they precede the spec pointers so that they
+	// start at offset zero and stay 64-bit aligned on 32-bit platforms.
+	WebhookDispatcher struct {
+		received  uint64
+		delivered uint64
+		retried   uint64
+		failed    uint64
+		dropped   uint64
+
+		superSpec *supervisor.Spec
+		spec      *Spec
+		cluster   cluster.Cluster
+		server    *http.Server
+		client    *http.Client
+		jobs      chan *delivery
+		logs      *deliveryLogs
+
+		mutex sync.RWMutex
+		// subscribers are the subscribers in the spec, dynamic ones are
+		// managed by the admin API, and saved in the cluster.
+		subscribers map[string]*SubscriberSpec
+		dynamic     map[string]*SubscriberSpec
+		err         error
+
+		done chan struct{}
+		wg   sync.WaitGroup
+	}
+
+	// Status is the status of WebhookDispatcher.
+	Status struct {
+		State       string `json:"state"`
+		Error       string `json:"error,omitempty"`
+		Subscribers int    `json:"subscribers"`
+		Queued      int    `json:"queued"`
+		Received    uint64 `json:"received"`
+		Delivered   uint64 `json:"delivered"`
+		Retried     uint64 `json:"retried"`
+		Failed      uint64 `json:"failed"`
+		Dropped     uint64 `json:"dropped"`
+	}
+
+	event struct {
+		ID          string
+		Type        string
+		ContentType string
+		Body        []byte
+	}
+
+	delivery struct {
+		event      *event
+		subscriber string
+		attempt    int
+	}
+
+	// accepted is the response to the event source.
+	accepted struct {
+		ID          string   `json:"id"`
+		Subscribers []string `json:"subscribers"`
+	}
+)
+
+// Category returns the category of WebhookDispatcher.
+func (d *WebhookDispatcher) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of WebhookDispatcher.
+func (d *WebhookDispatcher) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of WebhookDispatcher.
+func (d *WebhookDispatcher) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Init initializes WebhookDispatcher.
+func (d *WebhookDispatcher) Init(superSpec *supervisor.Spec) {
+	d.superSpec, d.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	d.reload(nil)
+	d.registerAPIs()
+	d.start()
+}
+
+// Inherit inherits previous generation of WebhookDispatcher.
+func (d *WebhookDispatcher) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	// NOTE: The port is likely the same, so the previous server must be
+	// closed before the new one listens.
+	prev := previousGeneration.(*WebhookDispatcher)
+	prev.Close()
+	d.superSpec, d.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	d.reload(prev)
+	d.registerAPIs()
+	d.start()
+}
+
+func (d *WebhookDispatcher) reload(prev *WebhookDispatcher) {
+	d.client = &http.Client{}
+	d.done = make(chan struct{})
+
+	// the queued deliveries and the logs survive updates.
+	if prev != nil && cap(prev.jobs) == d.spec.queueSize() {
+		d.jobs = prev.jobs
+	} else {
+		d.jobs = make(chan *delivery, d.spec.queueSize())
+	}
+	if prev != nil {
+		d.logs = prev.logs
+		d.logs.resize(d.spec.maxLogs())
+	} else {
+		d.logs = newDeliveryLogs(d.spec.maxLogs())
+	}
+
+	d.subscribers = map[string]*SubscriberSpec{}
+	for _, s := range d.spec.Subscribers {
+		d.subscribers[s.Name] = s
+	}
+	d.dynamic = map[string]*SubscriberSpec{}
+
+	if super := d.superSpec.Super(); super != nil && super.Cluster() != nil {
+		d.cluster = super.Cluster()
+		d.syncSubscribers()
+	} else {
+		logger.Warnf("%s: cluster is not available, subscribers added by API are not persisted", d.superSpec.Name())
+	}
+}
+
+// start starts the workers and the server.
+func (d *WebhookDispatcher) start() {
+	d.server = &http.Server{
+		Addr:    net.JoinHostPort(d.spec.Address, fmt.Sprintf("%d", d.spec.Port)),
+		Handler: http.HandlerFunc(d.handleEvent),
+	}
+	d.wg.Add(d.spec.workers() + 1)
+	for i := 0; i < d.spec.workers(); i++ {
+		go d.work()
+	}
+	go d.run()
+	go d.serve(d.server)
+}
+
+func (d *WebhookDispatcher) serve(server *http.Server) {
+	logger.Infof("%s webhook dispatcher running in %s", d.superSpec.Name(), server.Addr)
+
+	listener, err := graceupdate.Listen("tcp", server.Addr)
+	if err == nil {
+		err = server.Serve(listener)
+	}
+	if err != nil && err != http.ErrServerClosed {
+		logger.Errorf("%s webhook dispatcher listen failed: %v", d.superSpec.Name(), err)
+		d.mutex.Lock()
+		d.err = err
+		d.mutex.Unlock()
+	}
+}
+
+// run synchronizes the subscribers added by the admin API on other
+// members periodically.
+func (d *WebhookDispatcher) run() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+			if d.cluster != nil {
+				d.syncSubscribers()
+			}
+		}
+	}
+}
+
+func (d *WebhookDispatcher) syncSubscribers() {
+	kvs, err := d.cluster.GetPrefix(d.cluster.Layout().WebhookSubscriberPrefix(d.superSpec.Name()))
+	if err != nil {
+		logger.Errorf("%s: failed to get subscribers: %v", d.superSpec.Name(), err)
+		return
+	}
+
+	dynamic := map[string]*SubscriberSpec{}
+	for k, v := range kvs {
+		s := &SubscriberSpec{}
+		if err = codectool.UnmarshalJSON([]byte(v), s); err != nil {
+			logger.Errorf("%s: failed to decode subscriber %s: %v", d.superSpec.Name(), k, err)
+			continue
+		}
+		dynamic[s.Name] = s
+	}
+
+	d.mutex.Lock()
+	d.dynamic = dynamic
+	d.mutex.Unlock()
+}
+
+// getSubscriber returns the subscriber, the one in the spec takes
+// precedence.
+func (d *WebhookDispatcher) getSubscriber(name string) *SubscriberSpec {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if s := d.subscribers[name]; s != nil {
+		return s
+	}
+	return d.dynamic[name]
+}
+
+// matchSubscribers returns the names of the subscribers of the event type
+// in order.
+func (d *WebhookDispatcher) matchSubscribers(eventType string) []string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	names := []string{}
+	for name, s := range d.subscribers {
+		if s.subscribes(eventType) {
+			names = append(names, name)
+		}
+	}
+	for name, s := range d.dynamic {
+		if d.subscribers[name] == nil && s.subscribes(eventType) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (d *WebhookDispatcher) handleEvent(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != d.spec.path() {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if d.spec.Token != "" {
+		token := []byte("Bearer " + d.spec.Token)
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), token) != 1 {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+	}
+
+	maxBodySize := d.spec.maxBodySize()
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if int64(len(body)) > maxBodySize {
+		writeError(w, http.StatusRequestEntityTooLarge, "event too large")
+		return
+	}
+
+	e := &event{
+		ID:          r.Header.Get(eventIDHeader),
+		Type:        r.Header.Get(d.spec.eventHeader()),
+		ContentType: r.Header.Get("Content-Type"),
+		Body:        body,
+	}
+	if e.ID == "" {
+		e.ID = uuid.NewString()
+	}
+	atomic.AddUint64(&d.received, 1)
+
+	// the event is rejected if it could not be queued for all
+	// subscribers, so that the event source could retry it.
+	names := d.matchSubscribers(e.Type)
+	if cap(d.jobs)-len(d.jobs) < len(names) {
+		writeError(w, http.StatusServiceUnavailable, "queue is full")
+		return
+	}
+	for _, name := range names {
+		d.enqueue(&delivery{event: e, subscriber: name, attempt: 1})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(codectool.MustMarshalJSON(&accepted{ID: e.ID, Subscribers: names}))
+}
+
+func (d *WebhookDispatcher) enqueue(job *delivery) {
+	select {
+	case d.jobs <- job:
+	default:
+		atomic.AddUint64(&d.dropped, 1)
+		logger.Warnf("%s: queue is full, event %s to %s is dropped", d.superSpec.Name(), job.event.ID, job.subscriber)
+	}
+}
+
+func (d *WebhookDispatcher) work() {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.done:
+			return
+		case job := <-d.jobs:
+			d.deliver(job)
+		}
+	}
+}
+
+// deliver delivers the event to the subscriber, and schedules a retry if
+// it fails.
+func (d *WebhookDispatcher) deliver(job *delivery) {
+	s := d.getSubscriber(job.subscriber)
+	if s == nil {
+		// the subscriber has been deleted.
+		return
+	}
+
+	start := time.Now()
+	code, err := d.send(s, job)
+	l := &DeliveryLog{
+		EventID:    job.event.ID,
+		Event:      job.event.Type,
+		Subscriber: s.Name,
+		Attempt:    job.attempt,
+		StatusCode: code,
+		Time:       start,
+		Duration:   time.Since(start).String(),
+	}
+
+	retryable := true
+	if err == nil {
+		switch {
+		case code/100 == 2:
+			l.Success = true
+		case code == http.StatusRequestTimeout, code == http.StatusTooManyRequests, code >= 500:
+			err = fmt.Errorf("subscriber responded %d", code)
+		default:
+			// other client errors would never succeed.
+			err = fmt.Errorf("subscriber responded %d", code)
+			retryable = false
+		}
+	}
+
+	if l.Success {
+		atomic.AddUint64(&d.delivered, 1)
+		d.logs.add(l)
+		return
+	}
+
+	l.Error = err.Error()
+	retry := s.retry(d.spec.Retry)
+	if retryable && job.attempt < retry.maxAttempts() {
+		l.NextAttempt = retry.backoff(job.attempt).String()
+		atomic.AddUint64(&d.retried, 1)
+		next := &delivery{event: job.event, subscriber: job.subscriber, attempt: job.attempt + 1}
+		time.AfterFunc(retry.backoff(job.attempt), func() {
+			d.enqueue(next)
+		})
+	} else {
+		atomic.AddUint64(&d.failed, 1)
+		logger.Warnf("%s: failed to deliver event %s to %s after %d attempts: %v",
+			d.superSpec.Name(), job.event.ID, s.Name, job.attempt, err)
+	}
+	d.logs.add(l)
+}
+
+func (d *WebhookDispatcher) send(s *SubscriberSpec, job *delivery) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(job.event.Body))
+	if err != nil {
+		return 0, err
+	}
+
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+	if job.event.ContentType != "" {
+		req.Header.Set("Content-Type", job.event.ContentType)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(webhookIDHeader, job.event.ID)
+	req.Header.Set(eventHeader, job.event.Type)
+	req.Header.Set(attemptHeader, strconv.Itoa(job.attempt))
+	req.Header.Set(timestampHeader, timestamp)
+	if s.Secret != "" {
+		req.Header.Set(signatureHeader, sign(s.Secret, timestamp, job.event.Body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// sign signs the body with the secret, the timestamp is signed too to
+// prevent replay attacks.
+func sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(codectool.MustMarshalJSON(&api.Err{Code: code, Message: message}))
+}
+
+// Status returns the status of WebhookDispatcher.
+func (d *WebhookDispatcher) Status() *supervisor.Status {
+	s := &Status{
+		State:     stateRunning,
+		Queued:    len(d.jobs),
+		Received:  atomic.LoadUint64(&d.received),
+		Delivered: atomic.LoadUint64(&d.delivered),
+		Retried:   atomic.LoadUint64(&d.retried),
+		Failed:    atomic.LoadUint64(&d.failed),
+		Dropped:   atomic.LoadUint64(&d.dropped),
+	}
+
+	d.mutex.RLock()
+	if d.err != nil {
+		s.State, s.Error = stateFailed, d.err.Error()
+	}
+	s.Subscribers = len(d.subscribers)
+	for name := range d.dynamic {
+		if d.subscribers[name] == nil {
+			s.Subscribers++
+		}
+	}
+	d.mutex.RUnlock()
+
+	return &supervisor.Status{ObjectStatus: s}
+}
+
+// Close closes WebhookDispatcher.
+func (d *WebhookDispatcher) Close() {
+	d.unregisterAPIs()
+
+	if d.server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := d.server.Shutdown(ctx); err != nil {
+			logger.Errorf("%s shutdown webhook dispatcher failed: %v", d.superSpec.Name(), err)
+		}
+	}
+
+	close(d.done)
+	d.wg.Wait()
+	d.client.CloseIdleConnections()
+}
@@ -0,0 +1,307 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webhookdispatcher
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newTestDispatcher(t *testing.T, yamlConfig string) *WebhookDispatcher {
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.Nil(t, err)
+	d := &WebhookDispatcher{superSpec: superSpec, spec: superSpec.ObjectSpec().(*Spec)}
+	d.reload(nil)
+	return d
+}
+
+func postEvent(d *WebhookDispatcher, token, eventType, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Event-Type", eventType)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	d.handleEvent(w, r)
+	return w
+}
+
+// deliver delivers n queued deliveries, it waits for the retries which are
+// queued after the backoff.
+func deliver(d *WebhookDispatcher, n int) {
+	for i := 0; i < n; i++ {
+		d.deliver(<-d.jobs)
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, yamlConfig := range []string{`
+kind: WebhookDispatcher
+name: webhooks
+port: 10098
+subscribers:
+- name: a
+  url: http://127.0.0.1:8080
+- name: a
+  url: http://127.0.0.1:8081
+`, `
+kind: WebhookDispatcher
+name: webhooks
+port: 10098
+subscribers:
+- name: a
+  url: ftp://127.0.0.1:8080
+`, `
+kind: WebhookDispatcher
+name: webhooks
+port: 10098
+subscribers:
+- name: a
+  url: http://127.0.0.1:8080
+  events: ["order.*.created"]
+`} {
+		_, err := supervisor.NewSpec(yamlConfig)
+		assert.Error(err)
+	}
+
+	s := &SubscriberSpec{Events: []string{"order.*", "user.created"}}
+	assert.True(s.subscribes("order.created"))
+	assert.True(s.subscribes("user.created"))
+	assert.False(s.subscribes("user.deleted"))
+	assert.True((&SubscriberSpec{}).subscribes("anything"))
+
+	r := &RetrySpec{InitialBackoff: "1s", MaxBackoff: "5s"}
+	assert.Equal("1s", r.backoff(1).String())
+	assert.Equal("4s", r.backoff(3).String())
+	assert.Equal("5s", r.backoff(10).String())
+}
+
+func TestDispatch(t *testing.T) {
+	assert := assert.New(t)
+
+	var lock sync.Mutex
+	received := map[string][]*http.Request{}
+	bodies := map[string]string{}
+	fail := map[string]int{"flaky": 1, "broken": 100}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		body, _ := io.ReadAll(r.Body)
+
+		lock.Lock()
+		defer lock.Unlock()
+		received[name] = append(received[name], r)
+		bodies[name] = string(body)
+		if fail[name] > 0 {
+			fail[name]--
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	d := newTestDispatcher(t, `
+kind: WebhookDispatcher
+name: webhooks
+port: 10098
+path: /events
+token: token
+retry:
+  maxAttempts: 2
+  initialBackoff: 1ms
+subscribers:
+- name: orders
+  url: `+server.URL+`/orders
+  secret: s3cret
+  events: ["order.*"]
+  headers:
+    X-Source: easegress
+- name: flaky
+  url: `+server.URL+`/flaky
+- name: broken
+  url: `+server.URL+`/broken
+  events: ["user.created"]
+`)
+
+	assert.Equal(http.StatusUnauthorized, postEvent(d, "", "order.created", "{}").Code)
+
+	w := postEvent(d, "token", "order.created", `{"id":1}`)
+	assert.Equal(http.StatusAccepted, w.Code)
+	resp := &accepted{}
+	codectool.MustUnmarshalJSON(w.Body.Bytes(), resp)
+	assert.Equal([]string{"flaky", "orders"}, resp.Subscribers)
+
+	// flaky fails and is retried after orders.
+	deliver(d, 3)
+	lock.Lock()
+	assert.Len(received["orders"], 1)
+	r := received["orders"][0]
+	assert.Equal(`{"id":1}`, bodies["orders"])
+	assert.Equal(resp.ID, r.Header.Get(webhookIDHeader))
+	assert.Equal("order.created", r.Header.Get(eventHeader))
+	assert.Equal("easegress", r.Header.Get("X-Source"))
+	assert.Equal("application/json", r.Header.Get("Content-Type"))
+	assert.Equal(sign("s3cret", r.Header.Get(timestampHeader), []byte(`{"id":1}`)), r.Header.Get(signatureHeader))
+	assert.Empty(received["flaky"][0].Header.Get(signatureHeader))
+	lock.Unlock()
+
+	w = postEvent(d, "token", "user.created", `{"id":2}`)
+	assert.Equal(http.StatusAccepted, w.Code)
+	// broken fails twice.
+	deliver(d, 3)
+
+	lock.Lock()
+	assert.Len(received["flaky"], 3)
+	assert.Equal("2", received["flaky"][1].Header.Get(attemptHeader))
+	assert.Len(received["broken"], 2)
+	lock.Unlock()
+
+	logs := d.logs.query(&logFilter{Subscriber: "broken"})
+	assert.Len(logs, 2)
+	assert.False(logs[0].Success)
+	assert.Equal(2, logs[0].Attempt)
+	assert.Empty(logs[0].NextAttempt)
+	assert.Equal(http.StatusBadGateway, logs[1].StatusCode)
+	assert.NotEmpty(logs[1].NextAttempt)
+	assert.Len(d.logs.query(&logFilter{Success: "true"}), 3)
+
+	status := d.Status().ObjectStatus.(*Status)
+	assert.Equal(uint64(2), status.Received)
+	assert.Equal(uint64(3), status.Delivered)
+	assert.Equal(uint64(2), status.Retried)
+	assert.Equal(uint64(1), status.Failed)
+	assert.Equal(3, status.Subscribers)
+}
+
+func TestSubscriberAPI(t *testing.T) {
+	assert := assert.New(t)
+
+	var lock sync.Mutex
+	kvs := map[string]string{}
+	mc := clustertest.NewMockedCluster()
+	mc.MockedLayout = func() *cluster.Layout {
+		return &cluster.Layout{}
+	}
+	mc.MockedPut = func(key, value string) error {
+		lock.Lock()
+		defer lock.Unlock()
+		kvs[key] = value
+		return nil
+	}
+	mc.MockedDelete = func(key string) error {
+		lock.Lock()
+		defer lock.Unlock()
+		delete(kvs, key)
+		return nil
+	}
+	mc.MockedGetPrefix = func(prefix string) (map[string]string, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		result := map[string]string{}
+		for k, v := range kvs {
+			if strings.HasPrefix(k, prefix) {
+				result[k] = v
+			}
+		}
+		return result, nil
+	}
+
+	d := newTestDispatcher(t, `
+kind: WebhookDispatcher
+name: webhooks
+port: 10098
+path: /events
+queueSize: 1
+subscribers:
+- name: orders
+  url: http://127.0.0.1:8080
+`)
+	d.cluster = mc
+
+	call := func(handler http.HandlerFunc, method, subscriber, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/", strings.NewReader(body))
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("subscriber", subscriber)
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	w := call(d.putSubscriber, http.MethodPost, "", "name: orders\nurl: http://127.0.0.1:8081\n")
+	assert.Equal(http.StatusConflict, w.Code)
+	w = call(d.putSubscriber, http.MethodPost, "", "name: audit\nurl: invalid\n")
+	assert.Equal(http.StatusBadRequest, w.Code)
+	w = call(d.putSubscriber, http.MethodPost, "", "name: audit\nurl: http://127.0.0.1:8081\nsecret: s3cret\n")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Len(kvs, 1)
+	assert.Contains(kvs, (&cluster.Layout{}).WebhookSubscriberKey("webhooks", "audit"))
+
+	w = call(d.listSubscribers, http.MethodGet, "", "")
+	infos := []*subscriberInfo{}
+	codectool.MustUnmarshalJSON(w.Body.Bytes(), &infos)
+	assert.Len(infos, 2)
+	assert.Equal("audit", infos[0].Name)
+	assert.Equal(sourceAPI, infos[0].Source)
+	assert.Equal(maskedSecret, infos[0].Secret)
+	assert.Equal(sourceSpec, infos[1].Source)
+
+	// the queue could not hold the deliveries to both subscribers.
+	assert.Equal(http.StatusServiceUnavailable, postEvent(d, "", "order.created", "{}").Code)
+
+	// other members load the subscriber from the cluster.
+	d2 := newTestDispatcher(t, `
+kind: WebhookDispatcher
+name: webhooks
+port: 10098
+`)
+	d2.cluster = mc
+	d2.syncSubscribers()
+	assert.NotNil(d2.getSubscriber("audit"))
+	assert.Equal("s3cret", d2.getSubscriber("audit").Secret)
+
+	w = call(d.deleteSubscriber, http.MethodDelete, "orders", "")
+	assert.Equal(http.StatusConflict, w.Code)
+	w = call(d.deleteSubscriber, http.MethodDelete, "audit", "")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Len(kvs, 0)
+	w = call(d.getSubscriberHandler, http.MethodGet, "audit", "")
+	assert.Equal(http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package websocketserver
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/megaease/easegress/pkg/util/ratelimiter"
+)
+
+type (
+	// MessageFilterSpec describes the policies applied to every message
+	// sent by clients, the connection is closed on policy violation.
+	MessageFilterSpec struct {
+		// MaxMessageSize is the max size of a message in bytes, 0 means
+		// no limit.
+		MaxMessageSize int64 `json:"maxMessageSize" jsonschema:"omitempty,minimum=0"`
+		// MessageRate is the max number of messages per second of a
+		// connection, 0 means no limit.
+		MessageRate int `json:"messageRate" jsonschema:"omitempty,minimum=0"`
+		// ByteRate is the max number of bytes per second of a connection,
+		// 0 means no limit.
+		ByteRate int `json:"byteRate" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// Status is the status of WebSocketServer.
+	Status struct {
+		Connections       uint64 `json:"connections"`
+		ActiveConnections int64  `json:"activeConnections"`
+		ClientMessages    uint64 `json:"clientMessages"`
+		ClientBytes       uint64 `json:"clientBytes"`
+		BackendMessages   uint64 `json:"backendMessages"`
+		BackendBytes      uint64 `json:"backendBytes"`
+		PolicyViolations  uint64 `json:"policyViolations"`
+	}
+
+	// messageFilter checks the messages of a single connection.
+	messageFilter struct {
+		messageLimiter *ratelimiter.RateLimiter
+		byteLimiter    *ratelimiter.RateLimiter
+	}
+)
+
+func newMessageFilter(spec *MessageFilterSpec) *messageFilter {
+	mf := &messageFilter{}
+	if spec == nil {
+		return mf
+	}
+
+	if spec.MessageRate > 0 {
+		policy := ratelimiter.NewPolicy(0, time.Second, spec.MessageRate)
+		mf.messageLimiter = ratelimiter.New(policy)
+	}
+	if spec.ByteRate > 0 {
+		policy := ratelimiter.NewPolicy(0, time.Second, spec.ByteRate)
+		mf.byteLimiter = ratelimiter.New(policy)
+	}
+
+	return mf
+}
+
+// check checks the message, it returns a close code and true if the
+// message violates the policies.
+func (mf *messageFilter) check(msg []byte) (int, bool) {
+	if mf.messageLimiter != nil {
+		if permitted, _ := mf.messageLimiter.AcquirePermission(); !permitted {
+			return websocket.ClosePolicyViolation, true
+		}
+	}
+	if mf.byteLimiter != nil {
+		if permitted, _ := mf.byteLimiter.AcquireNPermission(len(msg)); !permitted {
+			return websocket.ClosePolicyViolation, true
+		}
+	}
+	return 0, false
+}
+
+func (s *Status) addMessage(fromClient bool, size int) {
+	if fromClient {
+		atomic.AddUint64(&s.ClientMessages, 1)
+		atomic.AddUint64(&s.ClientBytes, uint64(size))
+	} else {
+		atomic.AddUint64(&s.BackendMessages, 1)
+		atomic.AddUint64(&s.BackendBytes, uint64(size))
+	}
+}
+
+func (s *Status) snapshot() *Status {
+	return &Status{
+		Connections:       atomic.LoadUint64(&s.Connections),
+		ActiveConnections: atomic.LoadInt64(&s.ActiveConnections),
+		ClientMessages:    atomic.LoadUint64(&s.ClientMessages),
+		ClientBytes:       atomic.LoadUint64(&s.ClientBytes),
+		BackendMessages:   atomic.LoadUint64(&s.BackendMessages),
+		BackendBytes:      atomic.LoadUint64(&s.BackendBytes),
+		PolicyViolations:  atomic.LoadUint64(&s.PolicyViolations),
+	}
+}
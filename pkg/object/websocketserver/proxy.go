@@ -25,10 +25,12 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 
+	"github.com/megaease/easegress/pkg/graceupdate"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/supervisor"
 )
@@ -65,6 +67,10 @@ var (
 	// defaultInterval is the default interval for polling websocket client and server which is
 	//  200ms right now.
 	defaultInterval = 200 * time.Millisecond
+
+	// closeTimeout is the timeout of writing a close message to a
+	// connection written by another goroutine.
+	closeTimeout = time.Second
 )
 
 // Proxy is a handler that takes an incoming WebSocket
@@ -86,6 +92,9 @@ type Proxy struct {
 
 	// done is the channel for shutdowning this proxy.
 	done chan struct{}
+
+	// stat is the message and connection counters.
+	stat *Status
 }
 
 // NewProxy returns a new Websocket proxy.
@@ -93,6 +102,7 @@ func newProxy(superSpec *supervisor.Spec) *Proxy {
 	proxy := &Proxy{
 		superSpec: superSpec,
 		done:      make(chan struct{}),
+		stat:      &Status{},
 	}
 	go proxy.run()
 	return proxy
@@ -107,11 +117,38 @@ func (p *Proxy) buildRequestURL(r *http.Request) *url.URL {
 	return &u
 }
 
-// passMsg passes websocket message from src to dst.
-func (p *Proxy) passMsg(src, dst *websocket.Conn, errc chan error, stop chan struct{}) {
+// selectSubprotocols returns the subprotocols requested by the client
+// which are allowed to be sent to the backend.
+func (p *Proxy) selectSubprotocols(req *http.Request) []string {
+	requested := websocket.Subprotocols(req)
+	allowed := p.superSpec.ObjectSpec().(*Spec).Subprotocols
+	if len(allowed) == 0 {
+		return requested
+	}
+
+	var result []string
+	for _, protocol := range requested {
+		for _, a := range allowed {
+			if protocol == a {
+				result = append(result, protocol)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// passMsg passes websocket message from src to dst, filter is used to check
+// the messages from clients, it is nil if src is the backend.
+func (p *Proxy) passMsg(src, dst *websocket.Conn, errc chan error, stop chan struct{}, filter *messageFilter) {
+	fromClient := filter != nil
+
 	handle := func() bool {
 		msgType, msg, err := src.ReadMessage()
 		if err != nil {
+			if err == websocket.ErrReadLimit {
+				atomic.AddUint64(&p.stat.PolicyViolations, 1)
+			}
 			m := websocket.FormatCloseMessage(websocket.CloseNormalClosure, fmt.Sprintf("%v", err))
 			if e, ok := err.(*websocket.CloseError); ok {
 				if e.Code != websocket.CloseNoStatusReceived {
@@ -122,6 +159,22 @@ func (p *Proxy) passMsg(src, dst *websocket.Conn, errc chan error, stop chan str
 			errc <- err
 			return false
 		}
+
+		if fromClient {
+			if code, violated := filter.check(msg); violated {
+				atomic.AddUint64(&p.stat.PolicyViolations, 1)
+				// src is written by the goroutine passing the messages
+				// to it, and WriteControl is safe to call concurrently.
+				m := websocket.FormatCloseMessage(code, "message policy violation")
+				src.WriteControl(websocket.CloseMessage, m, time.Now().Add(closeTimeout))
+				m = websocket.FormatCloseMessage(websocket.CloseNormalClosure, "client closed")
+				dst.WriteMessage(websocket.CloseMessage, m)
+				errc <- &websocket.CloseError{Code: code, Text: "message policy violation"}
+				return false
+			}
+		}
+
+		p.stat.addMessage(fromClient, len(msg))
 		err = dst.WriteMessage(msgType, msg)
 		if err != nil {
 			errc <- err
@@ -154,7 +207,9 @@ func (p *Proxy) run() {
 	}
 
 	p.backendURL = backendURL
-	dialer := defaultDialer
+	// copy the defaults to avoid modifying them.
+	dialer := *defaultDialer
+	dialer.EnableCompression = spec.EnableCompression
 	if strings.HasPrefix(spec.Backend, "wss") {
 		tlsConfig, err := spec.wssTLSConfig()
 		if err != nil {
@@ -164,8 +219,10 @@ func (p *Proxy) run() {
 		}
 		dialer.TLSClientConfig = tlsConfig
 	}
-	p.dialer = dialer
-	p.upgrader = defaultUpgrader
+	p.dialer = &dialer
+	upgrader := *defaultUpgrader
+	upgrader.EnableCompression = spec.EnableCompression
+	p.upgrader = &upgrader
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", p.handle)
@@ -183,13 +240,19 @@ func (p *Proxy) run() {
 		p.server.TLSConfig = tlsConfig
 	}
 
+	listener, err := graceupdate.Listen("tcp", addr)
+	if err != nil {
+		logger.Errorf("%s websocketserver listen failed: %v", p.superSpec.Name(), err)
+		return
+	}
+
 	if p.server.TLSConfig != nil {
-		if err := p.server.ListenAndServeTLS("", ""); err != nil {
-			logger.Errorf("%s websocketserver ListenAndServeTLS failed: %v", p.superSpec.Name(), err)
+		if err := p.server.ServeTLS(listener, "", ""); err != nil {
+			logger.Errorf("%s websocketserver ServeTLS failed: %v", p.superSpec.Name(), err)
 		}
 	} else {
-		if err := p.server.ListenAndServe(); err != nil {
-			logger.Errorf("%s websocketserver ListenAndServe failed: %v", p.superSpec.Name(), err)
+		if err := p.server.Serve(listener); err != nil {
+			logger.Errorf("%s websocketserver Serve failed: %v", p.superSpec.Name(), err)
 		}
 	}
 }
@@ -251,7 +314,14 @@ func (p *Proxy) upgradeRspHeader(resp *http.Response) http.Header {
 
 // handle implements the http.Handler that proxies WebSocket connections.
 func (p *Proxy) handle(rw http.ResponseWriter, req *http.Request) {
-	connBackend, resp, err := p.dialer.Dial(p.buildRequestURL(req).String(), p.copyHeader(req))
+	spec := p.superSpec.ObjectSpec().(*Spec)
+
+	// the dialer is shared by all connections, copy it before setting the
+	// subprotocols of this connection.
+	dialer := *p.dialer
+	dialer.Subprotocols = p.selectSubprotocols(req)
+
+	connBackend, resp, err := dialer.Dial(p.buildRequestURL(req).String(), p.copyHeader(req))
 	if err != nil {
 		logger.Errorf("%s dials %s failed: %v", p.superSpec.Name(), p.backendURL.String(), err)
 		if resp != nil {
@@ -278,6 +348,14 @@ func (p *Proxy) handle(rw http.ResponseWriter, req *http.Request) {
 	}
 	defer connClient.Close()
 
+	atomic.AddUint64(&p.stat.Connections, 1)
+	atomic.AddInt64(&p.stat.ActiveConnections, 1)
+	defer atomic.AddInt64(&p.stat.ActiveConnections, -1)
+
+	if spec.MessageFilter != nil && spec.MessageFilter.MaxMessageSize > 0 {
+		connClient.SetReadLimit(spec.MessageFilter.MaxMessageSize)
+	}
+
 	errClient := make(chan error, 1)
 	errBackend := make(chan error, 1)
 	stop := make(chan struct{})
@@ -285,9 +363,9 @@ func (p *Proxy) handle(rw http.ResponseWriter, req *http.Request) {
 	defer close(stop)
 
 	// pass msg from backend to client via WebSocket protocol.
-	go p.passMsg(connBackend, connClient, errBackend, stop)
+	go p.passMsg(connBackend, connClient, errBackend, stop, nil)
 	// pass msg from client to backend via WebSocket protocol.
-	go p.passMsg(connClient, connBackend, errClient, stop)
+	go p.passMsg(connClient, connBackend, errClient, stop, newMessageFilter(spec.MessageFilter))
 
 	var errMsg string
 	select {
@@ -300,17 +378,21 @@ func (p *Proxy) handle(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if e, ok := err.(*websocket.CloseError); !ok || e.Code == websocket.CloseAbnormalClosure {
+	if e, ok := err.(*websocket.CloseError); (!ok && err != websocket.ErrReadLimit) || (ok && e.Code == websocket.CloseAbnormalClosure) {
 		logger.Errorf(errMsg, p.superSpec.Name(), p.backendURL.String(), err)
 	}
 	// other error type is expected, not need to log
 }
 
+func (p *Proxy) status() *Status {
+	return p.stat.snapshot()
+}
+
 // Close closes websocket proxy.
 func (p *Proxy) Close() {
 	close(p.done)
 
-	ctx, cancelFunc := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancelFunc := context.WithTimeout(context.Background(), graceupdate.DrainTimeout())
 	defer cancelFunc()
 	err := p.server.Shutdown(ctx)
 	if err != nil {
@@ -21,8 +21,13 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gorilla/websocket"
+	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -75,3 +80,136 @@ func TestCopyResponse(t *testing.T) {
 	copyResponse(copyResp, resp)
 	assert.Equal(t, copyResp.Header(), resp.Header)
 }
+
+func TestProxySelectSubprotocols(t *testing.T) {
+	assert := assert.New(t)
+
+	req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1", nil)
+	require.Nil(t, err)
+	req.Header.Add("Sec-WebSocket-Protocol", "mqtt, graphql-ws")
+
+	yamlConfig := `
+kind: WebSocketServer
+name: websocket-demo
+port: 10081
+https: false
+backend: ws://127.0.0.1:8000
+`
+	superSpec, err := supervisor.NewDefaultMock().NewSpec(yamlConfig)
+	require.Nil(t, err)
+	spec := superSpec.ObjectSpec().(*Spec)
+	p := &Proxy{superSpec: superSpec}
+	assert.Equal([]string{"mqtt", "graphql-ws"}, p.selectSubprotocols(req))
+
+	spec.Subprotocols = []string{"graphql-ws", "soap"}
+	assert.Equal([]string{"graphql-ws"}, p.selectSubprotocols(req))
+
+	spec.Subprotocols = []string{"soap"}
+	assert.Empty(p.selectSubprotocols(req))
+}
+
+func TestMessageFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	mf := newMessageFilter(nil)
+	_, violated := mf.check([]byte("hello"))
+	assert.False(violated)
+
+	mf = newMessageFilter(&MessageFilterSpec{MessageRate: 2})
+	for i := 0; i < 2; i++ {
+		_, violated = mf.check([]byte("hello"))
+		assert.False(violated)
+	}
+	code, violated := mf.check([]byte("hello"))
+	assert.True(violated)
+	assert.Equal(websocket.ClosePolicyViolation, code)
+
+	mf = newMessageFilter(&MessageFilterSpec{ByteRate: 8})
+	_, violated = mf.check([]byte("hello"))
+	assert.False(violated)
+	_, violated = mf.check([]byte("hello"))
+	assert.True(violated)
+
+	s := &Status{}
+	s.addMessage(true, 5)
+	s.addMessage(false, 3)
+	snapshot := s.snapshot()
+	assert.Equal(uint64(1), snapshot.ClientMessages)
+	assert.Equal(uint64(5), snapshot.ClientBytes)
+	assert.Equal(uint64(1), snapshot.BackendMessages)
+	assert.Equal(uint64(3), snapshot.BackendBytes)
+}
+
+func TestProxyPolicyViolationWhileStreaming(t *testing.T) {
+	assert := assert.New(t)
+
+	// the backend streams messages to the client until it is closed.
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := testUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		go func() {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+		for {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte("stream")); err != nil {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}))
+	defer backend.Close()
+
+	yamlConfig := `
+kind: WebSocketServer
+name: websocket-demo
+port: 10081
+https: false
+backend: ws://127.0.0.1:8000
+messageFilter:
+  messageRate: 1
+`
+	superSpec, err := supervisor.NewDefaultMock().NewSpec(yamlConfig)
+	require.Nil(t, err)
+	backendURL, err := url.Parse(strings.Replace(backend.URL, "http", "ws", 1))
+	require.Nil(t, err)
+
+	p := &Proxy{
+		superSpec:  superSpec,
+		backendURL: backendURL,
+		upgrader:   defaultUpgrader,
+		dialer:     defaultDialer,
+		done:       make(chan struct{}),
+		stat:       &Status{},
+	}
+	proxy := httptest.NewServer(http.HandlerFunc(p.handle))
+	defer proxy.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial(strings.Replace(proxy.URL, "http", "ws", 1), nil)
+	require.Nil(t, err)
+	defer conn.Close()
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(conn.WriteMessage(websocket.TextMessage, []byte("hello")))
+	}
+
+	// the close message is received among the streamed messages.
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	streamed := 0
+	for {
+		_, _, err = conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		streamed++
+	}
+	assert.Greater(streamed, 0)
+	assert.True(websocket.IsCloseError(err, websocket.ClosePolicyViolation), "%v", err)
+	assert.Equal(uint64(1), p.status().PolicyViolations)
+}
@@ -37,6 +37,12 @@ type (
 
 		WssCertBase64 string `json:"wssCertBase64" jsonschema:"omitempty,format=base64"`
 		WssKeyBase64  string `json:"wssKeyBase64" jsonschema:"omitempty,format=base64"`
+
+		// Subprotocols is the allowed subprotocols, all subprotocols
+		// requested by clients are sent to the backend if it is empty.
+		Subprotocols      []string           `json:"subprotocols" jsonschema:"omitempty,uniqueItems=true"`
+		EnableCompression bool               `json:"enableCompression" jsonschema:"omitempty"`
+		MessageFilter     *MessageFilterSpec `json:"messageFilter,omitempty" jsonschema:"omitempty"`
 	}
 )
 
@@ -80,7 +80,7 @@ func (ws *WebSocketServer) reload() {
 
 // Status returns Status generated by proxy.
 func (ws *WebSocketServer) Status() *supervisor.Status {
-	return &supervisor.Status{}
+	return &supervisor.Status{ObjectStatus: ws.proxy.status()}
 }
 
 // Close closes WebSocketServer.
@@ -250,6 +250,18 @@ func (zk *ZookeeperServiceRegistry) update() {
 	zk.statusMutex.Unlock()
 }
 
+// Ready returns nil if the zookeeper client is built, so the pipelines using
+// the registry are ready to serve.
+func (zk *ZookeeperServiceRegistry) Ready() error {
+	zk.clientMutex.RLock()
+	defer zk.clientMutex.RUnlock()
+
+	if zk.client == nil {
+		return fmt.Errorf("zookeeper client is not built")
+	}
+	return nil
+}
+
 // Status returns status of EurekaServiceRegister.
 func (zk *ZookeeperServiceRegistry) Status() *supervisor.Status {
 	s := &Status{}
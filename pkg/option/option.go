@@ -23,6 +23,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
@@ -35,6 +36,9 @@ import (
 	"github.com/megaease/easegress/pkg/version"
 )
 
+// labelNameRegexp is the valid name of Prometheus labels.
+var labelNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
 // ClusterOptions defines the cluster members.
 type ClusterOptions struct {
 	// Primary members define following URLs to form a cluster.
@@ -47,6 +51,25 @@ type ClusterOptions struct {
 	// Secondary members define URLs to connect to cluster formed by primary members.
 	PrimaryListenPeerURLs []string `yaml:"primary-listen-peer-urls"`
 	MaxCallSendMsgSize    int      `yaml:"max-call-send-msg-size"`
+	// Primary members of a secondary region define following items to
+	// mirror the configuration from the cluster of the primary region.
+	UpstreamClientURLs    []string `yaml:"upstream-client-urls"`
+	UpstreamCertFile      string   `yaml:"upstream-cert-file"`
+	UpstreamKeyFile       string   `yaml:"upstream-key-file"`
+	UpstreamTrustedCAFile string   `yaml:"upstream-trusted-ca-file"`
+	// ReadOnly rejects configuration changes from the administration API,
+	// it is implied by UpstreamClientURLs.
+	ReadOnly bool `yaml:"read-only"`
+	// Members define following items to use an external etcd cluster
+	// instead of the embedded one, in both primary and secondary roles.
+	// All keys are put under ExternalEtcdNamespace if it is specified.
+	ExternalEtcdEndpoints     []string `yaml:"external-etcd-endpoints"`
+	ExternalEtcdCertFile      string   `yaml:"external-etcd-cert-file"`
+	ExternalEtcdKeyFile       string   `yaml:"external-etcd-key-file"`
+	ExternalEtcdTrustedCAFile string   `yaml:"external-etcd-trusted-ca-file"`
+	ExternalEtcdUsername      string   `yaml:"external-etcd-username"`
+	ExternalEtcdPasswordFile  string   `yaml:"external-etcd-password-file"`
+	ExternalEtcdNamespace     string   `yaml:"external-etcd-namespace"`
 }
 
 // Options is the start-up options.
@@ -71,12 +94,26 @@ type Options struct {
 	APIAddr                  string            `yaml:"api-addr"`
 	Debug                    bool              `yaml:"debug"`
 	DisableAccessLog         bool              `yaml:"disable-access-log"`
+	AuditRetention           string            `yaml:"audit-retention"`
+	UpgradeDrainTimeout      string            `yaml:"upgrade-drain-timeout"`
+	ResourceSampleInterval   string            `yaml:"resource-sample-interval"`
 	InitialObjectConfigFiles []string          `yaml:"initial-object-config-files"`
+	// Plugins are the Go plugins of filters loaded at startup.
+	Plugins []string `yaml:"plugins"`
+
+	// Standalone runs the member alone without etcd, the configuration is
+	// kept in memory, and is loaded from the objects in ObjectsDir if it is
+	// specified, which makes the configuration read-only. StandaloneStore
+	// persists the configuration in the data dir if it is bbolt.
+	Standalone      bool   `yaml:"standalone"`
+	StandaloneStore string `yaml:"standalone-store"`
+	ObjectsDir      string `yaml:"objects-dir"`
 
 	// cluster options
 	UseStandaloneEtcd     bool           `yaml:"use-standalone-etcd"`
 	ClusterName           string         `yaml:"cluster-name"`
 	ClusterRole           string         `yaml:"cluster-role"`
+	ClusterRegion         string         `yaml:"cluster-region"`
 	ClusterRequestTimeout string         `yaml:"cluster-request-timeout"`
 	Cluster               ClusterOptions `yaml:"cluster"`
 
@@ -94,18 +131,49 @@ type Options struct {
 	// Status
 	StatusUpdateMaxBatchSize int `yaml:"status-update-max-batch-size"`
 
+	// Secrets, the data keys of secrets are encrypted with the key
+	// encryption key (KEK) in secret-kek-file, or by the transit engine
+	// of Vault if secret-vault-addr is specified.
+	SecretKEKFile         string `yaml:"secret-kek-file"`
+	SecretVaultAddr       string `yaml:"secret-vault-addr"`
+	SecretVaultTokenFile  string `yaml:"secret-vault-token-file"`
+	SecretVaultTransitKey string `yaml:"secret-vault-transit-key"`
+
+	// Metrics exported by the /metrics API in the Prometheus format.
+	MetricsLabels         map[string]string `yaml:"metrics-labels"`
+	MetricsMaxLabelValues int               `yaml:"metrics-max-label-values"`
+
+	// Health, the member is ready only if all the upstreams respond to
+	// GET requests with status codes less than 400.
+	ReadinessProbeURLs []string `yaml:"readiness-probe-urls"`
+
+	// Snapshots of the configuration in the cluster, they are taken by the
+	// leader every snapshot-interval, and are stored in snapshot-dir, or
+	// in the S3-compatible bucket if snapshot-s3-bucket is specified.
+	SnapshotInterval              string `yaml:"snapshot-interval"`
+	SnapshotRetention             int    `yaml:"snapshot-retention"`
+	SnapshotDir                   string `yaml:"snapshot-dir"`
+	SnapshotS3Endpoint            string `yaml:"snapshot-s3-endpoint"`
+	SnapshotS3Region              string `yaml:"snapshot-s3-region"`
+	SnapshotS3Bucket              string `yaml:"snapshot-s3-bucket"`
+	SnapshotS3Prefix              string `yaml:"snapshot-s3-prefix"`
+	SnapshotS3AccessKeyID         string `yaml:"snapshot-s3-access-key-id"`
+	SnapshotS3SecretAccessKeyFile string `yaml:"snapshot-s3-secret-access-key-file"`
+
 	// Prepare the items below in advance.
-	AbsHomeDir   string `yaml:"-"`
-	AbsDataDir   string `yaml:"-"`
-	AbsWALDir    string `yaml:"-"`
-	AbsLogDir    string `yaml:"-"`
-	AbsMemberDir string `yaml:"-"`
+	AbsHomeDir     string `yaml:"-"`
+	AbsDataDir     string `yaml:"-"`
+	AbsWALDir      string `yaml:"-"`
+	AbsLogDir      string `yaml:"-"`
+	AbsMemberDir   string `yaml:"-"`
+	AbsSnapshotDir string `yaml:"-"`
 }
 
 // addClusterVars introduces cluster arguments.
 func addClusterVars(opt *Options) {
 	opt.flags.StringVar(&opt.ClusterName, "cluster-name", "eg-cluster-default-name", "Human-readable name for the new cluster, ignored while joining an existed cluster.")
 	opt.flags.StringVar(&opt.ClusterRole, "cluster-role", "primary", "Cluster role for this member (primary, secondary).")
+	opt.flags.StringVar(&opt.ClusterRegion, "cluster-region", "", "Region of the cluster, e.g. us-east-1, it is for information only.")
 	opt.flags.StringVar(&opt.ClusterRequestTimeout, "cluster-request-timeout", "10s", "Timeout to handle request in the cluster.")
 
 	// Cluster connection configuration
@@ -117,6 +185,22 @@ func addClusterVars(opt *Options) {
 	opt.flags.StringVar(&opt.Cluster.StateFlag, "state-flag", "new", "Cluster state (new, existing)")
 	opt.flags.StringSliceVar(&opt.Cluster.PrimaryListenPeerURLs, "primary-listen-peer-urls", []string{"http://localhost:2380"}, "List of peer URLs of primary members. Define this only, when cluster-role is secondary.")
 	opt.flags.IntVar(&opt.Cluster.MaxCallSendMsgSize, "max-call-send-msg-size", 10*1024*1024, "Maximum size in bytes for cluster synchronization messages.")
+
+	// Multi-region configuration
+	opt.flags.StringSliceVar(&opt.Cluster.UpstreamClientURLs, "upstream-client-urls", nil, "List of client URLs of the cluster in the primary region, the configuration is mirrored from it and is read-only in this cluster. Define this only in primary members of a secondary region.")
+	opt.flags.StringVar(&opt.Cluster.UpstreamCertFile, "upstream-cert-file", "", "Path to the client certificate file to connect to the upstream cluster.")
+	opt.flags.StringVar(&opt.Cluster.UpstreamKeyFile, "upstream-key-file", "", "Path to the client key file to connect to the upstream cluster.")
+	opt.flags.StringVar(&opt.Cluster.UpstreamTrustedCAFile, "upstream-trusted-ca-file", "", "Path to the CA file to verify the upstream cluster.")
+	opt.flags.BoolVar(&opt.Cluster.ReadOnly, "read-only", false, "Reject configuration changes from the administration API, use it when the configuration is replicated to this cluster by an external bridge.")
+
+	// External etcd configuration
+	opt.flags.StringSliceVar(&opt.Cluster.ExternalEtcdEndpoints, "external-etcd-endpoints", nil, "List of client URLs of an external etcd cluster to use instead of the embedded one.")
+	opt.flags.StringVar(&opt.Cluster.ExternalEtcdCertFile, "external-etcd-cert-file", "", "Path to the client certificate file to connect to the external etcd cluster.")
+	opt.flags.StringVar(&opt.Cluster.ExternalEtcdKeyFile, "external-etcd-key-file", "", "Path to the client key file to connect to the external etcd cluster.")
+	opt.flags.StringVar(&opt.Cluster.ExternalEtcdTrustedCAFile, "external-etcd-trusted-ca-file", "", "Path to the CA file to verify the external etcd cluster.")
+	opt.flags.StringVar(&opt.Cluster.ExternalEtcdUsername, "external-etcd-username", "", "User name to authenticate to the external etcd cluster.")
+	opt.flags.StringVar(&opt.Cluster.ExternalEtcdPasswordFile, "external-etcd-password-file", "", "Path to the file of the password of the external etcd user, the EG_ETCD_PASSWORD environment variable is used if empty.")
+	opt.flags.StringVar(&opt.Cluster.ExternalEtcdNamespace, "external-etcd-namespace", "", "Prefix of all keys in the external etcd cluster, e.g. /easegress/, so several clusters can share one etcd cluster.")
 }
 
 // New creates a default Options.
@@ -134,11 +218,18 @@ func New() *Options {
 	opt.flags.BoolVar(&opt.SignalUpgrade, "signal-upgrade", false, "Send an upgrade signal to the server based on the local pid file, then exit. The original server will start a graceful upgrade after signal received.")
 	opt.flags.StringVar(&opt.Name, "name", "eg-default-name", "Human-readable name for this member.")
 	opt.flags.StringToStringVar(&opt.Labels, "labels", nil, "The labels for the instance of Easegress.")
-	opt.flags.BoolVar(&opt.UseStandaloneEtcd, "use-standalone-etcd", false, "Use standalone etcd instead of embedded .")
+	opt.flags.BoolVar(&opt.UseStandaloneEtcd, "use-standalone-etcd", false, "Use standalone etcd instead of embedded, deprecated, please use external-etcd-endpoints instead.")
+	opt.flags.BoolVar(&opt.Standalone, "standalone", false, "Run as a single member without etcd, the configuration is kept in memory unless standalone-store is bbolt, the cluster options are ignored.")
+	opt.flags.StringVar(&opt.StandaloneStore, "standalone-store", "memory", "The store of the standalone mode: memory, bbolt, the configuration is persisted in the data dir if it is bbolt.")
+	opt.flags.StringVar(&opt.ObjectsDir, "objects-dir", "", "Directory of the yaml files of the objects, which are watched and reloaded on changes, the configuration is read-only from the administration API. Only for standalone mode.")
 	addClusterVars(opt)
 	opt.flags.StringVar(&opt.APIAddr, "api-addr", "localhost:2381", "Address([host]:port) to listen on for administration traffic.")
 	opt.flags.BoolVar(&opt.Debug, "debug", false, "Flag to set lowest log level from INFO downgrade DEBUG.")
+	opt.flags.StringVar(&opt.AuditRetention, "audit-retention", "168h", "Retention of the audit entries of the administration changes stored in the cluster, 0 means not storing them.")
+	opt.flags.StringVar(&opt.UpgradeDrainTimeout, "upgrade-drain-timeout", "30s", "Timeout for the original server to drain the connections after the new server took over the listeners in a graceful upgrade.")
+	opt.flags.StringVar(&opt.ResourceSampleInterval, "resource-sample-interval", "", "Interval to count the goroutines of the objects for their resource limits, e.g. 10s, empty or 0 means not counting them, as it stops the world for a short while.")
 	opt.flags.StringSliceVar(&opt.InitialObjectConfigFiles, "initial-object-config-files", nil, "List of configuration files for initial objects, these objects will be created at startup if not already exist.")
+	opt.flags.StringSliceVar(&opt.Plugins, "plugins", nil, "List of Go plugin files of filters to load at startup, they must be built with the same Go version and dependencies as Easegress.")
 
 	opt.flags.StringVar(&opt.HomeDir, "home-dir", "./", "Path to the home directory.")
 	opt.flags.StringVar(&opt.DataDir, "data-dir", "data", "Path to the data directory.")
@@ -151,6 +242,26 @@ func New() *Options {
 
 	opt.flags.IntVar(&opt.StatusUpdateMaxBatchSize, "status-update-max-batch-size", 20, "Number of object statuses to update at maximum in one transaction.")
 
+	opt.flags.StringVar(&opt.SecretKEKFile, "secret-kek-file", "", "Path to the file of the base64 encoded 32 bytes key encryption key of secrets, it must be the same in all members.")
+	opt.flags.StringVar(&opt.SecretVaultAddr, "secret-vault-addr", "", "Address of Vault to encrypt the data keys of secrets with its transit engine, instead of the key in secret-kek-file.")
+	opt.flags.StringVar(&opt.SecretVaultTokenFile, "secret-vault-token-file", "", "Path to the file of the Vault token, the VAULT_TOKEN environment variable is used if empty.")
+	opt.flags.StringVar(&opt.SecretVaultTransitKey, "secret-vault-transit-key", "easegress", "Name of the key in the Vault transit engine.")
+
+	opt.flags.StringToStringVar(&opt.MetricsLabels, "metrics-labels", nil, "The constant labels added to all Prometheus metrics, e.g. region=us-east-1.")
+	opt.flags.IntVar(&opt.MetricsMaxLabelValues, "metrics-max-label-values", 1000, "Number of values at maximum of a Prometheus label with unbounded values like routes, the values beyond it are replaced by __overflow__.")
+
+	opt.flags.StringSliceVar(&opt.ReadinessProbeURLs, "readiness-probe-urls", nil, "List of URLs of upstreams checked by the readiness API, the member is not ready if any of them responds with an error.")
+
+	opt.flags.StringVar(&opt.SnapshotInterval, "snapshot-interval", "", "Interval to take snapshots of the configuration in the cluster, e.g. 6h, empty or 0 means no scheduled snapshots.")
+	opt.flags.IntVar(&opt.SnapshotRetention, "snapshot-retention", 7, "Number of snapshots to keep at maximum, the oldest ones are removed first.")
+	opt.flags.StringVar(&opt.SnapshotDir, "snapshot-dir", "snapshots", "Path to the directory of the snapshots, ignored if snapshot-s3-bucket is specified.")
+	opt.flags.StringVar(&opt.SnapshotS3Endpoint, "snapshot-s3-endpoint", "", "Endpoint of the S3-compatible storage of the snapshots, e.g. https://s3.us-east-1.amazonaws.com.")
+	opt.flags.StringVar(&opt.SnapshotS3Region, "snapshot-s3-region", "us-east-1", "Region of the S3-compatible storage of the snapshots.")
+	opt.flags.StringVar(&opt.SnapshotS3Bucket, "snapshot-s3-bucket", "", "Bucket of the S3-compatible storage to store the snapshots.")
+	opt.flags.StringVar(&opt.SnapshotS3Prefix, "snapshot-s3-prefix", "", "Prefix of the object keys of the snapshots in the bucket.")
+	opt.flags.StringVar(&opt.SnapshotS3AccessKeyID, "snapshot-s3-access-key-id", "", "Access key ID of the S3-compatible storage, the AWS_ACCESS_KEY_ID environment variable is used if empty.")
+	opt.flags.StringVar(&opt.SnapshotS3SecretAccessKeyFile, "snapshot-s3-secret-access-key-file", "", "Path to the file of the secret access key of the S3-compatible storage, the AWS_SECRET_ACCESS_KEY environment variable is used if empty.")
+
 	opt.viper.BindPFlags(opt.flags)
 
 	return opt
@@ -183,7 +294,13 @@ func (opt *Options) renameLegacyClusterRoles() {
 
 // Parse parses all arguments, returns normal message without error if --help/--version set.
 func (opt *Options) Parse() (string, error) {
-	err := opt.flags.Parse(os.Args[1:])
+	return opt.ParseArgs(os.Args[1:])
+}
+
+// ParseArgs is like Parse, but parses the given arguments instead of the
+// ones of the command line.
+func (opt *Options) ParseArgs(args []string) (string, error) {
+	err := opt.flags.Parse(args)
 	if err != nil {
 		return "", err
 	}
@@ -231,10 +348,11 @@ func (opt *Options) Parse() (string, error) {
 
 	opt.renameLegacyClusterRoles()
 
-	if opt.UseStandaloneEtcd {
-		opt.ClusterRole = "secondary" // when using external standalone etcd, the cluster role cannot be "primary"
+	if opt.UseStandaloneEtcd && len(opt.Cluster.ExternalEtcdEndpoints) == 0 {
+		// the legacy way to define the endpoints of the external etcd.
+		opt.Cluster.ExternalEtcdEndpoints = opt.Cluster.PrimaryListenPeerURLs
 	}
-	if opt.ClusterRole == "primary" && len(opt.Cluster.InitialCluster) == 0 {
+	if opt.ClusterRole == "primary" && !opt.UseExternalEtcd() && len(opt.Cluster.InitialCluster) == 0 {
 		opt.Cluster.InitialCluster = map[string]string{opt.Name: opt.Cluster.InitialAdvertisePeerURLs[0]}
 	}
 
@@ -261,6 +379,19 @@ func (opt *Options) Parse() (string, error) {
 	return "", nil
 }
 
+// validateDuration validates the duration of the option if it is not
+// empty, negative durations are invalid, and so is zero if not allowed.
+func validateDuration(name, value string, allowZero bool) error {
+	if value == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 || (d == 0 && !allowZero) {
+		return fmt.Errorf("invalid %s: %s", name, value)
+	}
+	return nil
+}
+
 // ParseURLs parses list of strings to url.URL objects.
 func ParseURLs(urlStrings []string) ([]url.URL, error) {
 	urls := make([]url.URL, len(urlStrings))
@@ -275,21 +406,38 @@ func ParseURLs(urlStrings []string) ([]url.URL, error) {
 }
 
 func (opt *Options) validate() error {
+	if opt.ObjectsDir != "" && !opt.Standalone {
+		return fmt.Errorf("objects-dir is only for standalone mode")
+	}
+	switch opt.StandaloneStore {
+	case "", "memory":
+	case "bbolt":
+		if opt.ObjectsDir != "" {
+			return fmt.Errorf("standalone-store bbolt conflicts with objects-dir")
+		}
+	default:
+		return fmt.Errorf("invalid standalone-store %s", opt.StandaloneStore)
+	}
+
 	if opt.ClusterName == "" {
 		return fmt.Errorf("empty cluster-name")
 	} else if err := common.ValidateName(opt.ClusterName); err != nil {
 		return err
 	}
 
-	switch opt.ClusterRole {
-	case "secondary":
+	switch {
+	case opt.UseExternalEtcd():
+		if err := opt.validateExternalEtcd(); err != nil {
+			return err
+		}
+	case opt.ClusterRole == "secondary":
 		if opt.ForceNewCluster {
 			return fmt.Errorf("secondary got force-new-cluster")
 		}
 		if len(opt.Cluster.PrimaryListenPeerURLs) == 0 {
 			return fmt.Errorf("secondary got empty cluster.primary-listen-peer-urls")
 		}
-	case "primary":
+	case opt.ClusterRole == "primary":
 		argumentsToValidate := map[string][]string{
 			"listen-client-urls":          opt.Cluster.ListenClientURLs,
 			"listen-peer-urls":            opt.Cluster.ListenPeerURLs,
@@ -315,6 +463,18 @@ func (opt *Options) validate() error {
 		return fmt.Errorf("invalid cluster-role: supported roles are primary/secondary")
 	}
 
+	if len(opt.Cluster.UpstreamClientURLs) > 0 {
+		if opt.ClusterRole != "primary" || opt.UseExternalEtcd() {
+			return fmt.Errorf("upstream-client-urls is only for primary members with embedded etcd")
+		}
+		if _, err := ParseURLs(opt.Cluster.UpstreamClientURLs); err != nil {
+			return fmt.Errorf("invalid upstream-client-urls: %v", err)
+		}
+		if (opt.Cluster.UpstreamCertFile == "") != (opt.Cluster.UpstreamKeyFile == "") {
+			return fmt.Errorf("upstream-cert-file and upstream-key-file must be specified together")
+		}
+	}
+
 	_, err := time.ParseDuration(opt.ClusterRequestTimeout)
 	if err != nil {
 		return fmt.Errorf("invalid cluster-request-timeout: %v", err)
@@ -325,8 +485,37 @@ func (opt *Options) validate() error {
 		return fmt.Errorf("invalid api-addr: %v", err)
 	}
 
-	if err != nil {
-		return fmt.Errorf("invalid api-url: %v", err)
+	for name := range opt.MetricsLabels {
+		if !labelNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid metrics-labels: invalid label name %s", name)
+		}
+	}
+	if opt.MetricsMaxLabelValues < 0 {
+		return fmt.Errorf("invalid metrics-max-label-values: %d", opt.MetricsMaxLabelValues)
+	}
+
+	// the optional durations, zero disables the audit, the snapshot and
+	// the goroutine sampling.
+	for _, d := range []struct {
+		name      string
+		value     string
+		allowZero bool
+	}{
+		{"audit-retention", opt.AuditRetention, true},
+		{"upgrade-drain-timeout", opt.UpgradeDrainTimeout, false},
+		{"snapshot-interval", opt.SnapshotInterval, true},
+		{"resource-sample-interval", opt.ResourceSampleInterval, true},
+	} {
+		if err := validateDuration(d.name, d.value, d.allowZero); err != nil {
+			return err
+		}
+	}
+
+	if opt.SnapshotRetention < 0 {
+		return fmt.Errorf("invalid snapshot-retention: %d", opt.SnapshotRetention)
+	}
+	if opt.SnapshotS3Bucket != "" && opt.SnapshotS3Endpoint == "" {
+		return fmt.Errorf("snapshot-s3-endpoint is required if snapshot-s3-bucket is specified")
 	}
 
 	// dirs
@@ -342,6 +531,10 @@ func (opt *Options) validate() error {
 
 	// profile: nothing to validate
 
+	if opt.SecretKEKFile != "" && opt.SecretVaultAddr != "" {
+		return fmt.Errorf("secret-kek-file and secret-vault-addr are mutually exclusive")
+	}
+
 	// meta
 	if opt.Name == "" {
 		name, err := generateMemberName(opt.APIAddr)
@@ -354,6 +547,30 @@ func (opt *Options) validate() error {
 	return common.ValidateName(opt.Name)
 }
 
+func (opt *Options) validateExternalEtcd() error {
+	if opt.ClusterRole != "primary" && opt.ClusterRole != "secondary" {
+		return fmt.Errorf("invalid cluster-role: supported roles are primary/secondary")
+	}
+	if opt.ForceNewCluster {
+		return fmt.Errorf("force-new-cluster is not supported with external etcd")
+	}
+
+	c := &opt.Cluster
+	if _, err := ParseURLs(c.ExternalEtcdEndpoints); err != nil {
+		return fmt.Errorf("invalid external-etcd-endpoints: %v", err)
+	}
+	if (c.ExternalEtcdCertFile == "") != (c.ExternalEtcdKeyFile == "") {
+		return fmt.Errorf("external-etcd-cert-file and external-etcd-key-file must be specified together")
+	}
+	if c.ExternalEtcdPasswordFile != "" && c.ExternalEtcdUsername == "" {
+		return fmt.Errorf("external-etcd-password-file requires external-etcd-username")
+	}
+	if ns := c.ExternalEtcdNamespace; ns != "" && !strings.HasPrefix(ns, "/") {
+		return fmt.Errorf("invalid external-etcd-namespace: %s, it must start with /", ns)
+	}
+	return nil
+}
+
 func (opt *Options) prepare() error {
 	abs, isAbs, clean, join := filepath.Abs, filepath.IsAbs, filepath.Clean, filepath.Join
 	if isAbs(opt.HomeDir) {
@@ -374,6 +591,7 @@ func (opt *Options) prepare() error {
 		{dir: opt.DataDir, absDir: &opt.AbsDataDir},
 		{dir: opt.WALDir, absDir: &opt.AbsWALDir},
 		{dir: opt.MemberDir, absDir: &opt.AbsMemberDir},
+		{dir: opt.SnapshotDir, absDir: &opt.AbsSnapshotDir},
 	}
 	if opt.LogDir != "" {
 		table = append(table, dirItem{dir: opt.LogDir, absDir: &opt.AbsLogDir})
@@ -392,6 +610,46 @@ func (opt *Options) prepare() error {
 	return nil
 }
 
+// IsConfigReadOnly returns true if the configuration can't be changed by
+// the administration API of this cluster.
+func (opt *Options) IsConfigReadOnly() bool {
+	return opt.Cluster.ReadOnly || len(opt.Cluster.UpstreamClientURLs) > 0 || opt.ObjectsDir != ""
+}
+
+// UseExternalEtcd returns true if the members use an external etcd cluster
+// instead of the embedded one.
+func (opt *Options) UseExternalEtcd() bool {
+	return len(opt.Cluster.ExternalEtcdEndpoints) > 0
+}
+
+// GetAuditRetention returns the retention of audit entries, 0 means
+// audit entries are not stored in the cluster.
+func (opt *Options) GetAuditRetention() time.Duration {
+	d, _ := time.ParseDuration(opt.AuditRetention)
+	return d
+}
+
+// GetSnapshotInterval returns the interval of scheduled snapshots, 0 means
+// no snapshots are taken automatically.
+func (opt *Options) GetSnapshotInterval() time.Duration {
+	d, _ := time.ParseDuration(opt.SnapshotInterval)
+	return d
+}
+
+// GetResourceSampleInterval returns the interval of counting the goroutines
+// of the objects, 0 means they are not counted.
+func (opt *Options) GetResourceSampleInterval() time.Duration {
+	d, _ := time.ParseDuration(opt.ResourceSampleInterval)
+	return d
+}
+
+// GetUpgradeDrainTimeout returns the timeout to drain the connections in a
+// graceful upgrade, 0 means the default one.
+func (opt *Options) GetUpgradeDrainTimeout() time.Duration {
+	d, _ := time.ParseDuration(opt.UpgradeDrainTimeout)
+	return d
+}
+
 // InitialClusterToString returns initial clusters string representation.
 func (opt *Options) InitialClusterToString() string {
 	ss := make([]string, 0)
@@ -19,6 +19,7 @@ package httpprot
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -30,10 +31,36 @@ import (
 // DefaultMaxPayloadSize is the default max allowed payload size.
 const DefaultMaxPayloadSize = 4 * 1024 * 1024
 
+// DataHostRewritten is the key of the context data of the request whose
+// Host is rewritten by a filter, the proxy keeps the Host of this request
+// even if the server address is a host name.
+const DataHostRewritten = "HTTP_HOST_REWRITTEN"
+
+// DataPathParams is the key of the context data of the parameters of the
+// matched path, which is a map[string]string.
+const DataPathParams = "PATH_PARAMS"
+
 func init() {
 	protocols.Register("http", &Protocol{})
 }
 
+// decodeBody decodes the body of a request info or a response info
+// according to the encoding.
+func decodeBody(body, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(body), nil
+	case "base64":
+		data, err := base64.StdEncoding.DecodeString(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode base64 body: %v", err)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unknown body encoding: %s", encoding)
+	}
+}
+
 // Header wraps the http header.
 type Header struct {
 	http.Header
@@ -170,6 +170,27 @@ func TestProtocol(t *testing.T) {
 		_, err := p.BuildResponse(info)
 		assert.NotNil(err)
 	}
+
+	{
+		// build request and response with base64 encoded body
+		reqInfo := p.NewRequestInfo().(*requestInfo)
+		reqInfo.Body = "AAEC"
+		reqInfo.BodyEncoding = "base64"
+		req, err := p.BuildRequest(reqInfo)
+		assert.Nil(err)
+		assert.Equal([]byte{0, 1, 2}, req.(*Request).RawPayload())
+
+		respInfo := p.NewResponseInfo().(*responseInfo)
+		respInfo.Body = "AAEC"
+		respInfo.BodyEncoding = "base64"
+		resp, err := p.BuildResponse(respInfo)
+		assert.Nil(err)
+		assert.Equal([]byte{0, 1, 2}, resp.(*Response).RawPayload())
+
+		respInfo.BodyEncoding = "unknown"
+		_, err = p.BuildResponse(respInfo)
+		assert.NotNil(err)
+	}
 }
 
 func TestParseYAMLBody(t *testing.T) {
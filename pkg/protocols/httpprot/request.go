@@ -409,11 +409,14 @@ func (r *builderRequest) YAMLBody() (interface{}, error) {
 // filter, so it is a `YAML in YAML` or `YAML in JSON` case. To make it
 // explicit, we use both json & yaml tags in its fields.
 type requestInfo struct {
-	Method   string              `json:"method" yaml:"method" jsonschema:"omitempty"`
-	URL      string              `json:"url" yaml:"url" jsonschema:"omitempty"`
-	Headers  map[string][]string `json:"headers" yaml:"headers" jsonschema:"omitempty"`
-	Body     string              `json:"body" yaml:"body" jsonschema:"omitempty"`
-	FormData map[string]field    `json:"formData" yaml:"formData" jsonschema:"omitempty"`
+	Method  string              `json:"method" yaml:"method" jsonschema:"omitempty"`
+	URL     string              `json:"url" yaml:"url" jsonschema:"omitempty"`
+	Headers map[string][]string `json:"headers" yaml:"headers" jsonschema:"omitempty"`
+	Body    string              `json:"body" yaml:"body" jsonschema:"omitempty"`
+	// BodyEncoding is the encoding of Body, it could be empty or base64,
+	// base64 is for binary bodies.
+	BodyEncoding string           `json:"bodyEncoding" yaml:"bodyEncoding" jsonschema:"omitempty"`
+	FormData     map[string]field `json:"formData" yaml:"formData" jsonschema:"omitempty"`
 }
 
 // field stores the information of a form field.
@@ -460,7 +463,11 @@ func (p *Protocol) BuildRequest(reqInfo interface{}) (protocols.Request, error)
 
 	req, _ := NewRequest(stdReq)
 	if ri.Body != "" {
-		req.SetPayload([]byte(ri.Body))
+		body, err := decodeBody(ri.Body, ri.BodyEncoding)
+		if err != nil {
+			return nil, err
+		}
+		req.SetPayload(body)
 		return req, nil
 	}
 
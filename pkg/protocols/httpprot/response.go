@@ -334,6 +334,9 @@ type responseInfo struct {
 	StatusCode int                 `json:"statusCode" jsonshema:"omitempty"`
 	Headers    map[string][]string `json:"headers" jsonschema:"omitempty"`
 	Body       string              `json:"body" jsonschema:"omitempty"`
+	// BodyEncoding is the encoding of Body, it could be empty or base64,
+	// base64 is for binary bodies.
+	BodyEncoding string `json:"bodyEncoding" jsonschema:"omitempty"`
 }
 
 // NewResponseInfo returns a new responseInfo.
@@ -364,8 +367,12 @@ func (p *Protocol) BuildResponse(respInfo interface{}) (protocols.Response, erro
 	}
 
 	// build body
+	body, err := decodeBody(ri.Body, ri.BodyEncoding)
+	if err != nil {
+		return nil, err
+	}
 	resp, _ := NewResponse(stdResp)
-	resp.SetPayload([]byte(ri.Body))
+	resp.SetPayload(body)
 
 	return resp, nil
 }
@@ -21,28 +21,46 @@ import (
 	// Filters
 	_ "github.com/megaease/easegress/pkg/filters/builder"
 	_ "github.com/megaease/easegress/pkg/filters/certextractor"
+	_ "github.com/megaease/easegress/pkg/filters/compression"
 	_ "github.com/megaease/easegress/pkg/filters/connectcontrol"
 	_ "github.com/megaease/easegress/pkg/filters/corsadaptor"
+	_ "github.com/megaease/easegress/pkg/filters/extauth"
+	_ "github.com/megaease/easegress/pkg/filters/externalfilter"
 	_ "github.com/megaease/easegress/pkg/filters/fallback"
+	_ "github.com/megaease/easegress/pkg/filters/formatconverter"
 	_ "github.com/megaease/easegress/pkg/filters/headerlookup"
 	_ "github.com/megaease/easegress/pkg/filters/headertojson"
+	_ "github.com/megaease/easegress/pkg/filters/idempotency"
+	_ "github.com/megaease/easegress/pkg/filters/jsontransformer"
 	_ "github.com/megaease/easegress/pkg/filters/kafka"
 	_ "github.com/megaease/easegress/pkg/filters/kafkabackend"
+	_ "github.com/megaease/easegress/pkg/filters/llmguardrail"
+	_ "github.com/megaease/easegress/pkg/filters/llmproxy"
 	_ "github.com/megaease/easegress/pkg/filters/meshadaptor"
 	_ "github.com/megaease/easegress/pkg/filters/mock"
 	_ "github.com/megaease/easegress/pkg/filters/mqttclientauth"
+	_ "github.com/megaease/easegress/pkg/filters/opa"
+	_ "github.com/megaease/easegress/pkg/filters/outbox"
 	_ "github.com/megaease/easegress/pkg/filters/proxy"
+	_ "github.com/megaease/easegress/pkg/filters/quota"
 	_ "github.com/megaease/easegress/pkg/filters/ratelimiter"
+	_ "github.com/megaease/easegress/pkg/filters/redirect"
 	_ "github.com/megaease/easegress/pkg/filters/remotefilter"
 	_ "github.com/megaease/easegress/pkg/filters/requestadaptor"
 	_ "github.com/megaease/easegress/pkg/filters/responseadaptor"
+	_ "github.com/megaease/easegress/pkg/filters/responsecache"
+	_ "github.com/megaease/easegress/pkg/filters/script"
+	_ "github.com/megaease/easegress/pkg/filters/soapadaptor"
+	_ "github.com/megaease/easegress/pkg/filters/staticserver"
 	_ "github.com/megaease/easegress/pkg/filters/topicmapper"
 	_ "github.com/megaease/easegress/pkg/filters/validator"
 	_ "github.com/megaease/easegress/pkg/filters/wasmhost"
 
 	// Objects
 	_ "github.com/megaease/easegress/pkg/object/autocertmanager"
+	_ "github.com/megaease/easegress/pkg/object/canary"
 	_ "github.com/megaease/easegress/pkg/object/consulserviceregistry"
+	_ "github.com/megaease/easegress/pkg/object/dashboard"
 	_ "github.com/megaease/easegress/pkg/object/easemonitormetrics"
 	_ "github.com/megaease/easegress/pkg/object/etcdserviceregistry"
 	_ "github.com/megaease/easegress/pkg/object/eurekaserviceregistry"
@@ -55,7 +73,10 @@ import (
 	_ "github.com/megaease/easegress/pkg/object/nacosserviceregistry"
 	_ "github.com/megaease/easegress/pkg/object/pipeline"
 	_ "github.com/megaease/easegress/pkg/object/rawconfigtrafficcontroller"
+	_ "github.com/megaease/easegress/pkg/object/slocontroller"
+	_ "github.com/megaease/easegress/pkg/object/tcpserver"
 	_ "github.com/megaease/easegress/pkg/object/trafficcontroller"
+	_ "github.com/megaease/easegress/pkg/object/webhookdispatcher"
 	_ "github.com/megaease/easegress/pkg/object/websocketserver"
 	_ "github.com/megaease/easegress/pkg/object/zookeeperserviceregistry"
 )
@@ -20,9 +20,13 @@ package resilience
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/megaease/easegress/pkg/logger"
 	libcb "github.com/megaease/easegress/pkg/util/circuitbreaker"
 )
 
@@ -70,15 +74,65 @@ type (
 		SlowCallDurationThreshold        string `json:"slowCallDurationThreshold" jsonschema:"omitempty,format=duration"`
 		MaxWaitDurationInHalfOpen        string `json:"maxWaitDurationInHalfOpenState" jsonschema:"omitempty,format=duration"`
 		WaitDurationInOpen               string `json:"waitDurationInOpenState" jsonschema:"omitempty,format=duration"`
+
+		HalfOpenProbe *CircuitBreakerProbe `json:"halfOpenProbe,omitempty" jsonschema:"omitempty"`
+	}
+
+	// CircuitBreakerProbe is the template of the probe requests. If it is
+	// configured, the CircuitBreaker sends probe requests instead of
+	// permitting real requests to decide whether the target recovers,
+	// and all real requests are short-circuited until the state transits
+	// back to CLOSED.
+	CircuitBreakerProbe struct {
+		Method   string            `json:"method" jsonschema:"omitempty,format=httpmethod"`
+		Path     string            `json:"path" jsonschema:"required,pattern=^/"`
+		Headers  map[string]string `json:"headers" jsonschema:"omitempty"`
+		Body     string            `json:"body" jsonschema:"omitempty"`
+		Interval string            `json:"interval" jsonschema:"omitempty,format=duration"`
+		Timeout  string            `json:"timeout" jsonschema:"omitempty,format=duration"`
+	}
+
+	// CircuitBreakerEvent is a state transition event of a CircuitBreaker.
+	CircuitBreakerEvent struct {
+		Time     time.Time `json:"time"`
+		OldState string    `json:"oldState"`
+		NewState string    `json:"newState"`
+		Reason   string    `json:"reason"`
+	}
+
+	// CircuitBreakerStatus is the status of a CircuitBreaker.
+	CircuitBreakerStatus struct {
+		State       string                 `json:"state"`
+		Transitions uint64                 `json:"transitions"`
+		Events      []*CircuitBreakerEvent `json:"events"`
 	}
 )
 
+// maxCircuitBreakerEvents is the max number of recent events kept.
+const maxCircuitBreakerEvents = 10
+
 // Validate validates the CircuitBreakPolicy.
 func (p *CircuitBreakerPolicy) Validate() error {
-	// TODO
+	if p.HalfOpenProbe != nil && p.PermittedNumberOfCallsInHalfOpen == 0 {
+		return fmt.Errorf("permittedNumberOfCallsInHalfOpenState must be greater than 0 if halfOpenProbe is configured")
+	}
 	return nil
 }
 
+func (probe *CircuitBreakerProbe) interval() time.Duration {
+	if d, err := time.ParseDuration(probe.Interval); err == nil && d > 0 {
+		return d
+	}
+	return time.Second
+}
+
+func (probe *CircuitBreakerProbe) timeout() time.Duration {
+	if d, err := time.ParseDuration(probe.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return 3 * time.Second
+}
+
 // CreateWrapper creates a Wrapper.
 func (p *CircuitBreakerPolicy) CreateWrapper() Wrapper {
 	policy := &libcb.Policy{
@@ -110,18 +164,136 @@ func (p *CircuitBreakerPolicy) CreateWrapper() Wrapper {
 		policy.WaitDurationInOpen = time.Minute
 	}
 
-	return circuitBreakerWrapper{CircuitBreaker: libcb.New(policy)}
+	w := &CircuitBreakerWrapper{
+		CircuitBreaker: libcb.New(policy),
+		name:           p.Name(),
+		probe:          p.HalfOpenProbe,
+		done:           make(chan struct{}),
+	}
+	w.SetStateListener(w.onStateTransition)
+	return w
 }
 
-type circuitBreakerWrapper struct {
+// ProberFunc sends a probe request built from the template, a non-nil
+// error means the probe failed.
+type ProberFunc func(ctx context.Context, probe *CircuitBreakerProbe) error
+
+// CircuitBreakerWrapper is the Wrapper of CircuitBreaker policies.
+type CircuitBreakerWrapper struct {
 	*libcb.CircuitBreaker
+
+	name    string
+	probe   *CircuitBreakerProbe
+	prober  ProberFunc
+	probing int32
+	done    chan struct{}
+	once    sync.Once
+
+	lock        sync.Mutex
+	transitions uint64
+	events      []*CircuitBreakerEvent
+}
+
+// SetProber sets the function to send probe requests, it takes effect
+// only if the probe template is configured, and must be called before
+// the wrapper is used.
+func (w *CircuitBreakerWrapper) SetProber(prober ProberFunc) {
+	if w.probe != nil {
+		w.prober = prober
+	}
+}
+
+func (w *CircuitBreakerWrapper) onStateTransition(event *libcb.Event) {
+	logger.Infof("state of circuit breaker %s transited from %s to %s at %d, reason: %s",
+		w.name, event.OldState, event.NewState, event.Time.UnixNano()/1e6, event.Reason)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.transitions++
+	w.events = append(w.events, &CircuitBreakerEvent{
+		Time:     event.Time,
+		OldState: event.OldState,
+		NewState: event.NewState,
+		Reason:   event.Reason,
+	})
+	if len(w.events) > maxCircuitBreakerEvents {
+		w.events = w.events[len(w.events)-maxCircuitBreakerEvents:]
+	}
+}
+
+// Status returns the status of the CircuitBreaker.
+func (w *CircuitBreakerWrapper) Status() *CircuitBreakerStatus {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return &CircuitBreakerStatus{
+		State:       w.State().String(),
+		Transitions: w.transitions,
+		Events:      append([]*CircuitBreakerEvent(nil), w.events...),
+	}
+}
+
+// Close stops probing.
+func (w *CircuitBreakerWrapper) Close() {
+	w.once.Do(func() {
+		close(w.done)
+	})
+}
+
+// startProbing starts probing the target if it is not being probed.
+func (w *CircuitBreakerWrapper) startProbing() {
+	if atomic.CompareAndSwapInt32(&w.probing, 0, 1) {
+		go w.runProbes()
+	}
+}
+
+// runProbes sends probe requests until the state transits back to CLOSED,
+// the CircuitBreaker permits probes just like real requests, so the state
+// transits from OPEN to HALF_OPEN and then to CLOSED or OPEN as usual.
+func (w *CircuitBreakerWrapper) runProbes() {
+	defer atomic.StoreInt32(&w.probing, 0)
+
+	interval, timeout := w.probe.interval(), w.probe.timeout()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-time.After(interval):
+		}
+
+		if state := w.State(); state != libcb.StateOpen && state != libcb.StateHalfOpen {
+			return
+		}
+
+		permitted, stateID := w.AcquirePermission()
+		if !permitted {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		start := time.Now()
+		err := w.prober(ctx, w.probe)
+		cancel()
+		if err != nil {
+			logger.Debugf("circuit breaker %s: probe failed: %v", w.name, err)
+		}
+		w.RecordResult(stateID, err != nil, time.Since(start))
+	}
 }
 
 // Wrap wraps the handler function.
-func (w circuitBreakerWrapper) Wrap(handler HandlerFunc) HandlerFunc {
+func (w *CircuitBreakerWrapper) Wrap(handler HandlerFunc) HandlerFunc {
 	return func(ctx context.Context) error {
 		var err error
 
+		if w.prober != nil {
+			if state := w.State(); state == libcb.StateOpen || state == libcb.StateHalfOpen {
+				w.startProbing()
+				return ErrShortCircuited
+			}
+		}
+
 		permitted, stateID := w.AcquirePermission()
 		if !permitted {
 			return ErrShortCircuited
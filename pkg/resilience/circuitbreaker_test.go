@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resilience
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func TestCircuitBreakerProbe(t *testing.T) {
+	assert := assert.New(t)
+
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(`
+name: cb
+kind: CircuitBreaker
+slidingWindowSize: 2
+minimumNumberOfCalls: 2
+permittedNumberOfCallsInHalfOpenState: 2
+waitDurationInOpenState: 10ms
+halfOpenProbe:
+  path: /healthz
+  interval: 5ms
+`), &rawSpec)
+
+	policy, err := NewPolicy(rawSpec)
+	assert.NoError(err)
+
+	w := policy.CreateWrapper().(*CircuitBreakerWrapper)
+	defer w.Close()
+
+	var probes, healthy int32
+	w.SetProber(func(ctx context.Context, probe *CircuitBreakerProbe) error {
+		assert.Equal("/healthz", probe.Path)
+		atomic.AddInt32(&probes, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			return fmt.Errorf("unhealthy")
+		}
+		return nil
+	})
+
+	var calls int32
+	handler := w.Wrap(func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return fmt.Errorf("failed")
+	})
+
+	assert.Error(handler(context.Background()))
+	assert.Error(handler(context.Background()))
+	assert.Equal("Open", w.Status().State)
+
+	// real requests are short-circuited, and probes are sent instead.
+	assert.Equal(ErrShortCircuited, handler(context.Background()))
+	assert.Eventually(func() bool {
+		return atomic.LoadInt32(&probes) > 2
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(int32(2), atomic.LoadInt32(&calls))
+
+	atomic.StoreInt32(&healthy, 1)
+	assert.Eventually(func() bool {
+		return w.Status().State == "Closed"
+	}, time.Second, 5*time.Millisecond)
+
+	assert.Eventually(func() bool {
+		status := w.Status()
+		n := len(status.Events)
+		return n > 0 && status.Events[n-1].NewState == "Closed"
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestCircuitBreakerValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &CircuitBreakerPolicy{}
+	p.HalfOpenProbe = &CircuitBreakerProbe{Path: "/"}
+	assert.Error(p.Validate())
+
+	p.PermittedNumberOfCallsInHalfOpen = 1
+	assert.NoError(p.Validate())
+}
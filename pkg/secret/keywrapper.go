@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secret
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	keyWrapperLocal = "local"
+	keyWrapperVault = "vault"
+)
+
+// keyWrapper encrypts and decrypts the data keys of secrets.
+type keyWrapper interface {
+	name() string
+	wrap(ctx context.Context, key []byte) ([]byte, error)
+	unwrap(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// newKeyWrapper creates the key wrapper from the options, it returns nil if
+// secrets are not configured.
+func newKeyWrapper(opt *option.Options) (keyWrapper, error) {
+	if opt.SecretVaultAddr != "" {
+		return newVaultKeyWrapper(opt)
+	}
+	if opt.SecretKEKFile != "" {
+		return newLocalKeyWrapper(opt.SecretKEKFile)
+	}
+	return nil, nil
+}
+
+// localKeyWrapper encrypts data keys with the key encryption key (KEK)
+// shared by all members of the cluster.
+type localKeyWrapper struct {
+	kek []byte
+}
+
+func newLocalKeyWrapper(path string) (*localKeyWrapper, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read secret-kek-file failed: %v", err)
+	}
+	kek, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("decode secret-kek-file failed: %v", err)
+	}
+	if len(kek) != dataKeySize {
+		return nil, fmt.Errorf("the key in secret-kek-file must be %d bytes, but got %d", dataKeySize, len(kek))
+	}
+	return &localKeyWrapper{kek: kek}, nil
+}
+
+func (w *localKeyWrapper) name() string {
+	return keyWrapperLocal
+}
+
+func (w *localKeyWrapper) wrap(ctx context.Context, key []byte) ([]byte, error) {
+	aead, err := newAEAD(w.kek)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, key, nil), nil
+}
+
+func (w *localKeyWrapper) unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	aead, err := newAEAD(w.kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, fmt.Errorf("invalid wrapped key")
+	}
+	nonce, ciphertext := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// vaultKeyWrapper encrypts data keys with the transit secrets engine of
+// Vault, so the key encryption key never leaves Vault.
+type vaultKeyWrapper struct {
+	addr       string
+	token      string
+	transitKey string
+	client     *http.Client
+}
+
+func newVaultKeyWrapper(opt *option.Options) (*vaultKeyWrapper, error) {
+	token := os.Getenv("VAULT_TOKEN")
+	if opt.SecretVaultTokenFile != "" {
+		data, err := os.ReadFile(opt.SecretVaultTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("read secret-vault-token-file failed: %v", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token == "" {
+		return nil, fmt.Errorf("no Vault token, please set secret-vault-token-file or VAULT_TOKEN")
+	}
+
+	transitKey := opt.SecretVaultTransitKey
+	if transitKey == "" {
+		transitKey = "easegress"
+	}
+
+	return &vaultKeyWrapper{
+		addr:       strings.TrimSuffix(opt.SecretVaultAddr, "/"),
+		token:      token,
+		transitKey: transitKey,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (w *vaultKeyWrapper) name() string {
+	return keyWrapperVault
+}
+
+type vaultTransitResponse struct {
+	Data struct {
+		Plaintext  string `json:"plaintext"`
+		Ciphertext string `json:"ciphertext"`
+	} `json:"data"`
+}
+
+func (w *vaultKeyWrapper) do(ctx context.Context, op string, body map[string]string) (*vaultTransitResponse, error) {
+	data, err := codectool.MarshalJSON(body)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/v1/transit/%s/%s", w.addr, op, w.transitKey)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", w.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("vault transit %s: status code %d: %s", op, resp.StatusCode, msg)
+	}
+
+	result := &vaultTransitResponse{}
+	if err = codectool.DecodeJSON(resp.Body, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (w *vaultKeyWrapper) wrap(ctx context.Context, key []byte) ([]byte, error) {
+	resp, err := w.do(ctx, "encrypt", map[string]string{
+		"plaintext": base64.StdEncoding.EncodeToString(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []byte(resp.Data.Ciphertext), nil
+}
+
+func (w *vaultKeyWrapper) unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	resp, err := w.do(ctx, "decrypt", map[string]string{
+		"ciphertext": string(wrapped),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+}
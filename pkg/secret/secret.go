@@ -0,0 +1,318 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package secret implements the storage of secrets, the values of secrets
+// are encrypted before saving to the cluster, and could be referenced in
+// the specs of objects and filters by `$secret:name`.
+package secret
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// ReferencePrefix is the prefix of a string value in specs which references
+// a secret, e.g. `$secret:db-password`.
+const ReferencePrefix = "$secret:"
+
+const dataKeySize = 32
+
+type (
+	// Secret is a secret with its plain value.
+	Secret struct {
+		Name  string `json:"name" jsonschema:"required,format=urlname"`
+		Value string `json:"value" jsonschema:"required"`
+	}
+
+	// Info is the information of a secret, it never contains the value.
+	Info struct {
+		Name       string    `json:"name"`
+		KeyWrapper string    `json:"keyWrapper"`
+		UpdatedAt  time.Time `json:"updatedAt"`
+	}
+
+	// record is a secret saved in the cluster, the value is encrypted with
+	// a data key, and the data key is encrypted by the key wrapper.
+	record struct {
+		Info
+		WrappedKey []byte `json:"wrappedKey"`
+		Nonce      []byte `json:"nonce"`
+		Ciphertext []byte `json:"ciphertext"`
+	}
+
+	// Store is the storage of secrets.
+	Store struct {
+		cluster cluster.Cluster
+		prefix  string
+		wrapper keyWrapper
+		err     error
+	}
+)
+
+// NewStore creates a secret store. The store is still created if the key
+// wrapper is misconfigured, but all operations return the error.
+func NewStore(cls cluster.Cluster, opt *option.Options) *Store {
+	s := &Store{cluster: cls, prefix: cls.Layout().SecretPrefix()}
+	s.wrapper, s.err = newKeyWrapper(opt)
+	if s.err != nil {
+		logger.Errorf("secrets are not available: %v", s.err)
+	} else if s.wrapper == nil {
+		s.err = fmt.Errorf("secrets are disabled, please configure secret-kek-file or secret-vault-addr")
+	}
+	return s
+}
+
+func (s *Store) key(name string) string {
+	return s.prefix + name
+}
+
+func (s *Store) getRecord(name string) (*record, error) {
+	value, err := s.cluster.Get(s.key(name))
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	r := &record{}
+	if err = codectool.UnmarshalJSON([]byte(*value), r); err != nil {
+		return nil, fmt.Errorf("BUG: unmarshal secret %s failed: %v", name, err)
+	}
+	return r, nil
+}
+
+// Info gets the information of a secret, it returns nil if the secret
+// doesn't exist.
+func (s *Store) Info(name string) (*Info, error) {
+	r, err := s.getRecord(name)
+	if err != nil || r == nil {
+		return nil, err
+	}
+	return &r.Info, nil
+}
+
+// List lists the information of all secrets.
+func (s *Store) List() ([]*Info, error) {
+	kvs, err := s.cluster.GetPrefix(s.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]*Info, 0, len(kvs))
+	for k, v := range kvs {
+		r := &record{}
+		if err = codectool.UnmarshalJSON([]byte(v), r); err != nil {
+			return nil, fmt.Errorf("BUG: unmarshal secret %s failed: %v", k, err)
+		}
+		infos = append(infos, &r.Info)
+	}
+	return infos, nil
+}
+
+// Get gets the plain value of a secret.
+func (s *Store) Get(name string) (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+
+	r, err := s.getRecord(name)
+	if err != nil {
+		return "", err
+	}
+	if r == nil {
+		return "", fmt.Errorf("secret %s not found", name)
+	}
+	if r.KeyWrapper != s.wrapper.name() {
+		return "", fmt.Errorf("secret %s is encrypted by %s, but %s is configured", name, r.KeyWrapper, s.wrapper.name())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	dataKey, err := s.wrapper.unwrap(ctx, r.WrappedKey)
+	if err != nil {
+		return "", fmt.Errorf("decrypt data key of secret %s failed: %v", name, err)
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plain, err := aead.Open(nil, r.Nonce, r.Ciphertext, []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("decrypt secret %s failed: %v", name, err)
+	}
+	return string(plain), nil
+}
+
+// Put creates or updates a secret.
+func (s *Store) Put(secret *Secret, update bool) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	old, err := s.getRecord(secret.Name)
+	if err != nil {
+		return err
+	}
+	if update && old == nil {
+		return fmt.Errorf("%s not found", secret.Name)
+	}
+	if !update && old != nil {
+		return fmt.Errorf("%s existed", secret.Name)
+	}
+
+	// every secret has its own data key, so the key encryption key or
+	// the remote KMS is only used to encrypt the data keys.
+	dataKey := make([]byte, dataKeySize)
+	if _, err = rand.Read(dataKey); err != nil {
+		return err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	wrappedKey, err := s.wrapper.wrap(ctx, dataKey)
+	if err != nil {
+		return fmt.Errorf("encrypt data key failed: %v", err)
+	}
+
+	r := &record{
+		Info: Info{
+			Name:       secret.Name,
+			KeyWrapper: s.wrapper.name(),
+			UpdatedAt:  time.Now(),
+		},
+		WrappedKey: wrappedKey,
+		Nonce:      nonce,
+		// the name is the additional data, so that the value could not be
+		// moved to another secret.
+		Ciphertext: aead.Seal(nil, nonce, []byte(secret.Value), []byte(secret.Name)),
+	}
+
+	buf, err := codectool.MarshalJSON(r)
+	if err != nil {
+		return fmt.Errorf("BUG: marshal secret %s failed: %v", secret.Name, err)
+	}
+	return s.cluster.Put(s.key(secret.Name), string(buf))
+}
+
+// Delete deletes a secret.
+func (s *Store) Delete(name string) error {
+	r, err := s.getRecord(name)
+	if err != nil {
+		return err
+	}
+	if r == nil {
+		return fmt.Errorf("%s not found", name)
+	}
+	return s.cluster.Delete(s.key(name))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ParseReference returns the name of the referenced secret if str is a
+// secret reference.
+func ParseReference(str string) (string, bool) {
+	if !strings.HasPrefix(str, ReferencePrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(str, ReferencePrefix), true
+}
+
+// HasReference reports whether there are secret references in doc, which
+// is a value unmarshalled from JSON.
+func HasReference(doc interface{}) bool {
+	switch v := doc.(type) {
+	case string:
+		_, ok := ParseReference(v)
+		return ok
+	case map[string]interface{}:
+		for _, e := range v {
+			if HasReference(e) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, e := range v {
+			if HasReference(e) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Resolve replaces the secret references in doc, which is a value
+// unmarshalled from JSON, with the values of the secrets.
+func (s *Store) Resolve(doc interface{}) (interface{}, error) {
+	switch v := doc.(type) {
+	case string:
+		name, ok := ParseReference(v)
+		if !ok {
+			return v, nil
+		}
+		return s.Get(name)
+
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			r, err := s.Resolve(e)
+			if err != nil {
+				return nil, err
+			}
+			result[k] = r
+		}
+		return result, nil
+
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+		for _, e := range v {
+			r, err := s.Resolve(e)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, r)
+		}
+		return result, nil
+	}
+
+	return doc, nil
+}
@@ -0,0 +1,227 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secret
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockedCluster() (*clustertest.MockedCluster, map[string]string) {
+	var lock sync.Mutex
+	kvs := map[string]string{}
+
+	cls := clustertest.NewMockedCluster()
+	cls.MockedLayout = func() *cluster.Layout {
+		return &cluster.Layout{}
+	}
+	cls.MockedGet = func(key string) (*string, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if v, ok := kvs[key]; ok {
+			return &v, nil
+		}
+		return nil, nil
+	}
+	cls.MockedGetPrefix = func(prefix string) (map[string]string, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		result := map[string]string{}
+		for k, v := range kvs {
+			if strings.HasPrefix(k, prefix) {
+				result[k] = v
+			}
+		}
+		return result, nil
+	}
+	cls.MockedPut = func(key, value string) error {
+		lock.Lock()
+		defer lock.Unlock()
+		kvs[key] = value
+		return nil
+	}
+	cls.MockedDelete = func(key string) error {
+		lock.Lock()
+		defer lock.Unlock()
+		delete(kvs, key)
+		return nil
+	}
+	return cls, kvs
+}
+
+func writeKEK(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "kek")
+	kek := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	os.WriteFile(path, []byte(kek+"\n"), 0o600)
+	return path
+}
+
+func TestStore(t *testing.T) {
+	assert := assert.New(t)
+
+	cls, kvs := newMockedCluster()
+	s := NewStore(cls, &option.Options{SecretKEKFile: writeKEK(t)})
+	assert.NoError(s.err)
+
+	assert.NoError(s.Put(&Secret{Name: "db-password", Value: "p@ssw0rd"}, false))
+	assert.Error(s.Put(&Secret{Name: "db-password", Value: "p@ssw0rd"}, false))
+	assert.Error(s.Put(&Secret{Name: "client-secret", Value: "abc"}, true))
+
+	// the value is never saved in plain text.
+	raw := kvs[cls.Layout().SecretPrefix()+"db-password"]
+	assert.NotEmpty(raw)
+	assert.NotContains(raw, "p@ssw0rd")
+
+	value, err := s.Get("db-password")
+	assert.NoError(err)
+	assert.Equal("p@ssw0rd", value)
+
+	assert.NoError(s.Put(&Secret{Name: "db-password", Value: "new"}, true))
+	value, _ = s.Get("db-password")
+	assert.Equal("new", value)
+
+	info, err := s.Info("db-password")
+	assert.NoError(err)
+	assert.Equal(keyWrapperLocal, info.KeyWrapper)
+	infos, err := s.List()
+	assert.NoError(err)
+	assert.Len(infos, 1)
+
+	// the ciphertext can't be moved to another secret.
+	kvs[cls.Layout().SecretPrefix()+"other"] = strings.Replace(raw, `"name":"db-password"`, `"name":"other"`, 1)
+	_, err = s.Get("other")
+	assert.Error(err)
+
+	// another KEK can't decrypt the secret.
+	path := filepath.Join(t.TempDir(), "kek")
+	os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210"))), 0o600)
+	s2 := NewStore(cls, &option.Options{SecretKEKFile: path})
+	_, err = s2.Get("db-password")
+	assert.Error(err)
+
+	assert.NoError(s.Delete("db-password"))
+	assert.Error(s.Delete("db-password"))
+	_, err = s.Get("db-password")
+	assert.Error(err)
+
+	// misconfigured stores.
+	s = NewStore(cls, &option.Options{})
+	assert.Error(s.Put(&Secret{Name: "a", Value: "b"}, false))
+	os.WriteFile(path, []byte("c2hvcnQ="), 0o600)
+	s = NewStore(cls, &option.Options{SecretKEKFile: path})
+	assert.Error(s.err)
+}
+
+func TestVaultKeyWrapper(t *testing.T) {
+	assert := assert.New(t)
+
+	// the stub reverses the base64 plaintext as the ciphertext.
+	reverse := func(s string) string {
+		b := []byte(s)
+		for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+			b[i], b[j] = b[j], b[i]
+		}
+		return string(b)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		body := map[string]string{}
+		codectool.DecodeJSON(r.Body, &body)
+		resp := vaultTransitResponse{}
+		switch r.URL.Path {
+		case "/v1/transit/encrypt/eg":
+			resp.Data.Ciphertext = "vault:v1:" + reverse(body["plaintext"])
+		case "/v1/transit/decrypt/eg":
+			resp.Data.Plaintext = reverse(strings.TrimPrefix(body["ciphertext"], "vault:v1:"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		codectool.MustEncodeJSON(w, resp)
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(tokenFile, []byte("token"), 0o600)
+
+	cls, _ := newMockedCluster()
+	s := NewStore(cls, &option.Options{
+		SecretVaultAddr:       server.URL + "/",
+		SecretVaultTokenFile:  tokenFile,
+		SecretVaultTransitKey: "eg",
+	})
+	assert.NoError(s.err)
+
+	assert.NoError(s.Put(&Secret{Name: "token", Value: "s3cr3t"}, false))
+	value, err := s.Get("token")
+	assert.NoError(err)
+	assert.Equal("s3cr3t", value)
+
+	// the secret is encrypted by vault, it can't be decrypted locally.
+	local := NewStore(cls, &option.Options{SecretKEKFile: writeKEK(t)})
+	_, err = local.Get("token")
+	assert.Error(err)
+
+	s.wrapper.(*vaultKeyWrapper).token = "bad"
+	_, err = s.Get("token")
+	assert.Error(err)
+}
+
+func TestResolve(t *testing.T) {
+	assert := assert.New(t)
+
+	cls, _ := newMockedCluster()
+	s := NewStore(cls, &option.Options{SecretKEKFile: writeKEK(t)})
+	s.Put(&Secret{Name: "password", Value: "p@ssw0rd"}, false)
+
+	doc := map[string]interface{}{
+		"name":     "$secretary",
+		"password": "$secret:password",
+		"list":     []interface{}{"a", "$secret:password", 1.0},
+	}
+	assert.True(HasReference(doc))
+	assert.False(HasReference(map[string]interface{}{"name": "$secretary"}))
+
+	resolved, err := s.Resolve(doc)
+	assert.NoError(err)
+	assert.Equal(map[string]interface{}{
+		"name":     "$secretary",
+		"password": "p@ssw0rd",
+		"list":     []interface{}{"a", "p@ssw0rd", 1.0},
+	}, resolved)
+	// the original doc is not changed.
+	assert.Equal("$secret:password", doc["password"])
+
+	_, err = s.Resolve(map[string]interface{}{"password": "$secret:missing"})
+	assert.Error(err)
+}
@@ -0,0 +1,347 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package supervisor
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const dependencyRefreshInterval = 1 * time.Second
+
+type (
+	// Dependent is the optional interface of object specs, Dependencies
+	// returns the names of the objects the object depends on, e.g. the
+	// pipelines of an HTTPServer. The supervisor starts them before the
+	// object, and the object doesn't accept traffic until they are ready.
+	Dependent interface {
+		Dependencies() []string
+	}
+
+	// ReadinessReporter is the optional interface of objects, Ready
+	// returns nil if the object is ready to serve, otherwise the reason.
+	// Objects not implementing it are ready once they are created.
+	ReadinessReporter interface {
+		Ready() error
+	}
+
+	// ObjectReadiness is the readiness of an object, it is ready only if
+	// itself and all its existing dependencies are ready.
+	ObjectReadiness struct {
+		Ready        bool     `json:"ready"`
+		Dependencies []string `json:"dependencies,omitempty"`
+		// Missing are the dependencies which don't exist, they are not
+		// waited for, as they may never be created.
+		Missing []string `json:"missing,omitempty"`
+		// Cycle are the dependencies in a dependency cycle with the
+		// object, they are not waited for either, as they would never be
+		// ready otherwise.
+		Cycle []string `json:"cycle,omitempty"`
+		Error string   `json:"error,omitempty"`
+	}
+
+	// DependencyNode is an object in the dependency graph.
+	DependencyNode struct {
+		Name string `json:"name"`
+		Kind string `json:"kind"`
+		ObjectReadiness
+	}
+
+	// DependencyGraph is the dependency graph of the objects of the
+	// member, the nodes are in the startup order.
+	DependencyGraph struct {
+		Timestamp int64             `json:"timestamp"`
+		Nodes     []*DependencyNode `json:"nodes"`
+
+		nodes map[string]*DependencyNode
+	}
+
+	// dependencyTracker evaluates the readiness of the objects when they
+	// change, and periodically for the ones implementing ReadinessReporter.
+	dependencyTracker struct {
+		// created records the created objects, the key is the name and
+		// the value is the live entity.
+		created sync.Map
+		graph   atomic.Value // *DependencyGraph
+		changed chan struct{}
+
+		// cycles records the reported dependencies in cycles, the key is
+		// "dependent -> dependency", it is only accessed by refresh.
+		cycles map[string]bool
+	}
+)
+
+// OrderByDependency returns the entities in the startup order, i.e. an
+// entity is after the ones it depends on. The entities in a dependency
+// cycle, and the independent ones, are in the order of their categories
+// and names.
+func OrderByDependency(entities map[string]*ObjectEntity) []*ObjectEntity {
+	specs := make(map[string]*Spec, len(entities))
+	for name, entity := range entities {
+		specs[name] = entity.Spec()
+	}
+
+	names := orderByDependency(specs)
+	result := make([]*ObjectEntity, len(names))
+	for i, name := range names {
+		result[i] = entities[name]
+	}
+	return result
+}
+
+func orderByDependency(specs map[string]*Spec) []string {
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ci, cj := categoryPriority(specs[names[i]]), categoryPriority(specs[names[j]])
+		if ci != cj {
+			return ci < cj
+		}
+		return names[i] < names[j]
+	})
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	states := make(map[string]int, len(names))
+	order := make([]string, 0, len(names))
+
+	var visit func(name string)
+	visit = func(name string) {
+		// A visiting object means a cycle, which is broken here.
+		if states[name] != 0 {
+			return
+		}
+		states[name] = visiting
+		for _, dep := range specs[name].Dependencies() {
+			if _, exists := specs[dep]; exists {
+				visit(dep)
+			}
+		}
+		states[name] = visited
+		order = append(order, name)
+	}
+
+	for _, name := range names {
+		visit(name)
+	}
+	return order
+}
+
+func categoryPriority(spec *Spec) int {
+	if o, exists := objectRegistry[spec.Kind()]; exists {
+		for i, category := range objectOrderedCategories {
+			if category == o.Category() {
+				return i
+			}
+		}
+	}
+	return len(objectOrderedCategories)
+}
+
+func newDependencyTracker() *dependencyTracker {
+	return &dependencyTracker{
+		changed: make(chan struct{}, 1),
+		cycles:  map[string]bool{},
+	}
+}
+
+func (dt *dependencyTracker) run(s *Supervisor, done chan struct{}) {
+	ticker := time.NewTicker(dependencyRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		dt.refresh(s)
+
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		case <-dt.changed:
+		}
+	}
+}
+
+// notify notifies the tracker to refresh the graph, it never blocks.
+func (dt *dependencyTracker) notify() {
+	select {
+	case dt.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (dt *dependencyTracker) setCreated(entity *ObjectEntity) {
+	if dt == nil {
+		return
+	}
+	dt.created.Store(entity.Spec().Name(), entity)
+	dt.notify()
+}
+
+func (dt *dependencyTracker) setClosed(entity *ObjectEntity) {
+	if dt == nil {
+		return
+	}
+	dt.created.Delete(entity.Spec().Name())
+	dt.notify()
+}
+
+func (dt *dependencyTracker) refresh(s *Supervisor) {
+	entities := s.objectRegistry.snapshot()
+	specs := make(map[string]*Spec, len(entities))
+	for name, entity := range entities {
+		specs[name] = entity.Spec()
+	}
+
+	nodes := make(map[string]*DependencyNode, len(specs))
+	graph := &DependencyGraph{Timestamp: time.Now().Unix(), nodes: nodes}
+	cycles := map[string]bool{}
+
+	// The dependencies are evaluated before their dependents, except the
+	// ones in cycles, which are reported and not waited for.
+	for _, name := range orderByDependency(specs) {
+		spec := specs[name]
+		node := &DependencyNode{
+			Name: name,
+			Kind: spec.Kind(),
+			ObjectReadiness: ObjectReadiness{
+				Ready:        true,
+				Dependencies: spec.Dependencies(),
+			},
+		}
+
+		if err := dt.objectReady(s, name); err != nil {
+			node.Ready, node.Error = false, err.Error()
+		}
+
+		for _, dep := range node.Dependencies {
+			if _, exists := specs[dep]; !exists {
+				node.Missing = append(node.Missing, dep)
+				continue
+			}
+
+			depNode := nodes[dep]
+			if depNode == nil {
+				node.Cycle = append(node.Cycle, dep)
+				key := name + " -> " + dep
+				if !dt.cycles[key] {
+					logger.Warnf("dependency cycle: %s depends on %s, which depends on it directly or not", name, dep)
+				}
+				cycles[key] = true
+				continue
+			}
+			if !depNode.Ready && node.Ready {
+				node.Ready, node.Error = false, fmt.Sprintf("dependency %s is not ready", dep)
+			}
+		}
+
+		nodes[name] = node
+		graph.Nodes = append(graph.Nodes, node)
+	}
+
+	dt.cycles = cycles
+	dt.graph.Store(graph)
+}
+
+// objectReady checks the readiness of the object itself.
+func (dt *dependencyTracker) objectReady(s *Supervisor, name string) (err error) {
+	if v, exists := s.objectErrors.Load(name); exists {
+		return fmt.Errorf("%v", v)
+	}
+
+	value, exists := dt.created.Load(name)
+	if !exists {
+		return fmt.Errorf("not created yet")
+	}
+
+	reporter, ok := value.(*ObjectEntity).Instance().(ReadinessReporter)
+	if !ok {
+		return nil
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("%s: recover from Ready, err: %v, stack trace:\n%s\n",
+				name, r, debug.Stack())
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return reporter.Ready()
+}
+
+func (dt *dependencyTracker) getGraph() *DependencyGraph {
+	graph, _ := dt.graph.Load().(*DependencyGraph)
+	return graph
+}
+
+func (dt *dependencyTracker) readiness(name string) *ObjectReadiness {
+	graph := dt.getGraph()
+	if graph == nil {
+		return nil
+	}
+	if node := graph.nodes[name]; node != nil {
+		return &node.ObjectReadiness
+	}
+	return nil
+}
+
+// dependencyTracker returns the dependency tracker, it is nil for the
+// mocked supervisors.
+func (s *Supervisor) dependencyTracker() *dependencyTracker {
+	if s == nil {
+		return nil
+	}
+	return s.dependencies
+}
+
+// DependencyGraph returns the dependency graph of the objects, it is nil
+// before the first evaluation or for the mocked supervisors.
+func (s *Supervisor) DependencyGraph() *DependencyGraph {
+	dt := s.dependencyTracker()
+	if dt == nil {
+		return nil
+	}
+	return dt.getGraph()
+}
+
+// ObjectReady returns whether the object and its dependencies are ready.
+// The objects not in the object registry, e.g. the ones created by other
+// controllers in their own namespaces, are always ready, so are the ones
+// of the mocked supervisors.
+func (s *Supervisor) ObjectReady(name string) bool {
+	dt := s.dependencyTracker()
+	if dt == nil {
+		return true
+	}
+	if readiness := dt.readiness(name); readiness != nil {
+		return readiness.Ready
+	}
+
+	// The object is not evaluated yet.
+	_, exists := s.objectRegistry.getEntity(name)
+	return !exists
+}
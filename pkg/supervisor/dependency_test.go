@@ -0,0 +1,190 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package supervisor
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	testDependentSpec struct {
+		deps []string
+	}
+
+	testReadyObject struct {
+		err error
+	}
+)
+
+func (s *testDependentSpec) Dependencies() []string { return s.deps }
+
+func (o *testReadyObject) Category() ObjectCategory { return CategoryBusinessController }
+func (o *testReadyObject) Kind() string             { return "TestReadyObject" }
+func (o *testReadyObject) DefaultSpec() interface{} { return &testDependentSpec{} }
+func (o *testReadyObject) Status() *Status          { return &Status{} }
+func (o *testReadyObject) Close()                   {}
+func (o *testReadyObject) Ready() error             { return o.err }
+
+func newTestDependentSpec(name string, deps ...string) *Spec {
+	return &Spec{
+		meta:       &MetaSpec{Name: name, Kind: "TestReadyObject"},
+		objectSpec: &testDependentSpec{deps: deps},
+	}
+}
+
+func newTestDependentSpecs(deps map[string][]string) map[string]*Spec {
+	specs := map[string]*Spec{}
+	for name, d := range deps {
+		specs[name] = newTestDependentSpec(name, d...)
+	}
+	return specs
+}
+
+func TestOrderByDependency(t *testing.T) {
+	assert := assert.New(t)
+
+	// linear chain
+	specs := newTestDependentSpecs(map[string][]string{
+		"a-server":   {"b-pipeline"},
+		"b-pipeline": {"c-registry"},
+		"c-registry": nil,
+	})
+	assert.Equal([]string{"c-registry", "b-pipeline", "a-server"}, orderByDependency(specs))
+
+	// diamond, the missing dependency is ignored
+	specs = newTestDependentSpecs(map[string][]string{
+		"api":        {"c-pipeline", "b-pipeline", "missing"},
+		"b-pipeline": {"z-registry"},
+		"c-pipeline": {"z-registry"},
+		"z-registry": nil,
+	})
+	assert.Equal([]string{"z-registry", "b-pipeline", "c-pipeline", "api"}, orderByDependency(specs))
+
+	// cycle, which is broken at the first visited object
+	specs = newTestDependentSpecs(map[string][]string{
+		"a": {"b"},
+		"b": {"c"},
+		"c": {"a"},
+		"d": {"a"},
+		"e": nil,
+	})
+	assert.Equal([]string{"c", "b", "a", "d", "e"}, orderByDependency(specs))
+
+	// the entities are in the same order
+	entities := map[string]*ObjectEntity{}
+	for name, spec := range specs {
+		entities[name] = &ObjectEntity{spec: spec}
+	}
+	names := []string{}
+	for _, entity := range OrderByDependency(entities) {
+		names = append(names, entity.Spec().Name())
+	}
+	assert.Equal([]string{"c", "b", "a", "d", "e"}, names)
+}
+
+func TestDependencyTrackerRefresh(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &Supervisor{
+		dependencies:   newDependencyTracker(),
+		objectRegistry: &ObjectRegistry{entities: map[string]*ObjectEntity{}},
+	}
+	dt := s.dependencies
+
+	objects := map[string]*testReadyObject{}
+	add := func(name string, created bool, deps ...string) {
+		objects[name] = &testReadyObject{}
+		entity := &ObjectEntity{
+			super:    s,
+			spec:     newTestDependentSpec(name, deps...),
+			instance: objects[name],
+		}
+		s.objectRegistry.entities[name] = entity
+		if created {
+			dt.setCreated(entity)
+		}
+	}
+	add("registry", true)
+	add("pipeline", true, "registry")
+	add("server", true, "pipeline", "missing")
+	add("pending", false)
+	add("cycle-a", true, "cycle-b")
+	add("cycle-b", true, "cycle-a")
+
+	assert.Nil(s.DependencyGraph())
+	objects["registry"].err = fmt.Errorf("not connected")
+	dt.refresh(s)
+
+	readiness := dt.readiness("registry")
+	assert.False(readiness.Ready)
+	assert.Equal("not connected", readiness.Error)
+
+	readiness = dt.readiness("pipeline")
+	assert.False(readiness.Ready)
+	assert.Equal("dependency registry is not ready", readiness.Error)
+
+	readiness = dt.readiness("server")
+	assert.False(readiness.Ready)
+	assert.Equal([]string{"missing", "pipeline"}, readiness.Dependencies)
+	assert.Equal([]string{"missing"}, readiness.Missing)
+
+	readiness = dt.readiness("pending")
+	assert.False(readiness.Ready)
+	assert.Equal("not created yet", readiness.Error)
+
+	// the cycle is reported, but doesn't block the readiness
+	assert.True(s.ObjectReady("cycle-a"))
+	assert.True(s.ObjectReady("cycle-b"))
+	assert.Empty(dt.readiness("cycle-a").Cycle)
+	assert.Equal([]string{"cycle-a"}, dt.readiness("cycle-b").Cycle)
+	assert.Equal(map[string]bool{"cycle-b -> cycle-a": true}, dt.cycles)
+
+	graph := s.DependencyGraph()
+	names := []string{}
+	for _, node := range graph.Nodes {
+		names = append(names, node.Name)
+	}
+	assert.Equal([]string{"cycle-b", "cycle-a", "pending", "registry", "pipeline", "server"}, names)
+
+	// the readiness is propagated to the dependents
+	objects["registry"].err = nil
+	dt.refresh(s)
+	assert.True(s.ObjectReady("registry"))
+	assert.True(s.ObjectReady("pipeline"))
+	assert.True(s.ObjectReady("server"))
+
+	// the errors of creating or updating objects make them unready
+	s.objectErrors.Store("pipeline", "bad spec")
+	dt.refresh(s)
+	assert.False(s.ObjectReady("pipeline"))
+	assert.Equal("bad spec", dt.readiness("pipeline").Error)
+	assert.False(s.ObjectReady("server"))
+
+	// the objects not in the object registry are always ready
+	assert.True(s.ObjectReady("unknown"))
+
+	// the closed objects are not ready
+	s.objectErrors.Delete("pipeline")
+	dt.setClosed(s.objectRegistry.entities["registry"])
+	dt.refresh(s)
+	assert.Equal("not created yet", dt.readiness("registry").Error)
+	assert.False(s.ObjectReady("server"))
+}
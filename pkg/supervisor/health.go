@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package supervisor
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const readinessCheckTimeout = 3 * time.Second
+
+type (
+	// HealthCheck is the result of a readiness check.
+	HealthCheck struct {
+		Name    string `json:"name"`
+		Healthy bool   `json:"healthy"`
+		Error   string `json:"error,omitempty"`
+	}
+
+	// Readiness is the readiness of the member, it is ready only if all
+	// the checks are healthy.
+	Readiness struct {
+		Ready  bool           `json:"ready"`
+		Checks []*HealthCheck `json:"checks"`
+	}
+)
+
+// recordObjectError records the error of creating or updating an object.
+func (s *Supervisor) recordObjectError(name string, err interface{}) {
+	if s == nil {
+		return
+	}
+	s.objectErrors.Store(name, fmt.Sprint(err))
+}
+
+func (s *Supervisor) clearObjectError(name string) {
+	if s == nil {
+		return
+	}
+	s.objectErrors.Delete(name)
+}
+
+// CheckReadiness checks the connectivity of the cluster, the creation of
+// the objects and the health of the upstreams in readiness-probe-urls.
+func (s *Supervisor) CheckReadiness() *Readiness {
+	checks := []*HealthCheck{s.checkCluster(), s.checkObjects()}
+
+	// Upstreams are checked concurrently, as some of them may be slow.
+	urls := s.options.ReadinessProbeURLs
+	upstreams := make([]*HealthCheck, len(urls))
+	wg := &sync.WaitGroup{}
+	for i, url := range urls {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			upstreams[i] = checkUpstream(url)
+		}(i, url)
+	}
+	wg.Wait()
+	checks = append(checks, upstreams...)
+
+	readiness := &Readiness{Ready: true, Checks: checks}
+	for _, check := range checks {
+		if !check.Healthy {
+			readiness.Ready = false
+		}
+	}
+	return readiness
+}
+
+func (s *Supervisor) checkCluster() *HealthCheck {
+	check := &HealthCheck{Name: "cluster", Healthy: true}
+	if s.cls == nil {
+		return check
+	}
+
+	// The request to the cluster may block until the request timeout of
+	// the cluster, which is usually longer than the timeout of the probes.
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := s.cls.Get(s.cls.Layout().StatusMemberKey())
+		errCh <- err
+	}()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-time.After(readinessCheckTimeout):
+		err = fmt.Errorf("timeout after %v", readinessCheckTimeout)
+	}
+
+	if err != nil {
+		check.Healthy = false
+		check.Error = err.Error()
+	}
+	return check
+}
+
+func (s *Supervisor) checkObjects() *HealthCheck {
+	check := &HealthCheck{Name: "objects", Healthy: true}
+
+	select {
+	case <-s.firstHandleDone:
+	default:
+		check.Healthy = false
+		check.Error = "objects are not created yet"
+		return check
+	}
+
+	var failures []string
+	s.objectErrors.Range(func(k, v interface{}) bool {
+		failures = append(failures, fmt.Sprintf("%s: %s", k, v))
+		return true
+	})
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		check.Healthy = false
+		check.Error = "failed objects: " + strings.Join(failures, "; ")
+	}
+	return check
+}
+
+// checkUpstream checks the upstream is healthy, i.e. it responds to a GET
+// request with a status code less than 400.
+func checkUpstream(url string) *HealthCheck {
+	check := &HealthCheck{Name: "upstream " + url, Healthy: true}
+
+	client := &http.Client{Timeout: readinessCheckTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		check.Healthy = false
+		check.Error = err.Error()
+		return check
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 400 {
+		check.Healthy = false
+		check.Error = fmt.Sprintf("status code %d", resp.StatusCode)
+	}
+	return check
+}
@@ -19,11 +19,13 @@ package supervisor
 
 import (
 	"bytes"
+	stdcontext "context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
 	"runtime/debug"
+	"runtime/pprof"
 	"strings"
 	"sync"
 	"time"
@@ -42,6 +44,9 @@ type (
 		generation uint64
 		instance   Object
 		spec       *Spec
+
+		// resources is shared by all generations of the object.
+		resources *ResourceTracker
 	}
 
 	// ObjectEntityWatcher is the watcher for object entity
@@ -288,6 +293,26 @@ func (or *ObjectRegistry) CloseWatcher(name string) {
 	delete(or.watchers, name)
 }
 
+// snapshot returns the snapshot of the object entities.
+func (or *ObjectRegistry) snapshot() map[string]*ObjectEntity {
+	or.mutex.Lock()
+	defer or.mutex.Unlock()
+
+	entities := make(map[string]*ObjectEntity, len(or.entities))
+	for name, entity := range or.entities {
+		entities[name] = entity
+	}
+	return entities
+}
+
+func (or *ObjectRegistry) getEntity(name string) (*ObjectEntity, bool) {
+	or.mutex.Lock()
+	defer or.mutex.Unlock()
+
+	entity, exists := or.entities[name]
+	return entity, exists
+}
+
 func (or *ObjectRegistry) storeConfigInLocal(config map[string]string) {
 	buff := bytes.NewBuffer(nil)
 	buff.WriteString(fmt.Sprintf("# %s\n", time.Now().Format(time.RFC3339)))
@@ -382,19 +407,27 @@ func (e *ObjectEntity) InitWithRecovery(muxMapper context.MuxMapper) {
 		if err := recover(); err != nil {
 			logger.Errorf("%s: recover from Init, err: %v, stack trace:\n%s\n",
 				e.spec.Name(), err, debug.Stack())
+			e.super.recordObjectError(e.spec.Name(), err)
 		}
 	}()
 
-	switch instance := e.Instance().(type) {
-	case Controller:
-		instance.Init(e.Spec())
-	case TrafficObject:
-		instance.Init(e.Spec(), muxMapper)
-	default:
-		panic(fmt.Errorf("BUG: unsupported object type %T", instance))
-	}
+	e.resources = e.super.resourceAccountant().newTracker(e.spec.Name())
+	e.resources.setLimits(e.spec.resource.ResourceLimits)
+
+	e.withResourceLabel(func() {
+		switch instance := e.Instance().(type) {
+		case Controller:
+			instance.Init(e.Spec())
+		case TrafficObject:
+			instance.Init(e.Spec(), muxMapper)
+		default:
+			panic(fmt.Errorf("BUG: unsupported object type %T", instance))
+		}
+	})
 
 	e.generation = 1
+	e.super.clearObjectError(e.spec.Name())
+	e.super.dependencyTracker().setCreated(e)
 }
 
 // InheritWithRecovery inherits the object with built-in recovery.
@@ -403,19 +436,32 @@ func (e *ObjectEntity) InheritWithRecovery(previousEntity *ObjectEntity, muxMapp
 		if err := recover(); err != nil {
 			logger.Errorf("%s: recover from Inherit, err: %v, stack trace:\n%s\n",
 				e.spec.Name(), err, debug.Stack())
+			e.super.recordObjectError(e.spec.Name(), err)
 		}
 	}()
 
-	switch instance := e.Instance().(type) {
-	case Controller:
-		instance.Inherit(e.Spec(), previousEntity.Instance())
-	case TrafficObject:
-		instance.Inherit(e.Spec(), previousEntity.Instance(), muxMapper)
-	default:
-		panic(fmt.Errorf("BUG: unsupported object type %T", instance))
+	// The goroutines of the previous generation may be inherited, so the
+	// tracker is shared by all generations.
+	e.resources = previousEntity.resources
+	if e.resources == nil {
+		e.resources = e.super.resourceAccountant().newTracker(e.spec.Name())
 	}
+	e.resources.setLimits(e.spec.resource.ResourceLimits)
+
+	e.withResourceLabel(func() {
+		switch instance := e.Instance().(type) {
+		case Controller:
+			instance.Inherit(e.Spec(), previousEntity.Instance())
+		case TrafficObject:
+			instance.Inherit(e.Spec(), previousEntity.Instance(), muxMapper)
+		default:
+			panic(fmt.Errorf("BUG: unsupported object type %T", instance))
+		}
+	})
 
 	e.generation++
+	e.super.clearObjectError(e.spec.Name())
+	e.super.dependencyTracker().setCreated(e)
 }
 
 // CloseWithRecovery closes the object with built-in recovery.
@@ -427,5 +473,38 @@ func (e *ObjectEntity) CloseWithRecovery() {
 		}
 	}()
 
+	e.super.clearObjectError(e.spec.Name())
+	e.super.dependencyTracker().setClosed(e)
+	e.super.resourceAccountant().removeTracker(e.resources)
 	e.instance.Close()
 }
+
+// withResourceLabel calls fn with the profiler label of the resource
+// tracker, so the goroutines created by fn are counted for the object.
+func (e *ObjectEntity) withResourceLabel(fn func()) {
+	labels := pprof.Labels(resourceLabel, e.resources.id)
+	pprof.Do(stdcontext.Background(), labels, func(stdcontext.Context) {
+		fn()
+	})
+}
+
+// Resources returns the resource tracker of the object, it is nil before
+// the object is initialized.
+func (e *ObjectEntity) Resources() *ResourceTracker {
+	return e.resources
+}
+
+// ResourceStatus returns the resource status of the object.
+func (e *ObjectEntity) ResourceStatus() *ResourceStatus {
+	return e.resources.Status()
+}
+
+// Readiness returns the readiness of the object, it is nil if the object
+// is not evaluated yet.
+func (e *ObjectEntity) Readiness() *ObjectReadiness {
+	dt := e.super.dependencyTracker()
+	if dt == nil {
+		return nil
+	}
+	return dt.readiness(e.spec.Name())
+}
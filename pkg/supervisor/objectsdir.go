@@ -0,0 +1,223 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package supervisor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+// objectsDirReloadDelay is the delay to reload the objects after the last
+// change of the files, editors usually change a file more than once when
+// saving it.
+const objectsDirReloadDelay = 500 * time.Millisecond
+
+// objectsDirLoader loads the objects in the yaml files of the objects
+// directory into the configuration, and reloads them when the files change.
+type objectsDirLoader struct {
+	super   *Supervisor
+	dir     string
+	watcher *fsnotify.Watcher
+
+	// loaded is the json configs of the objects loaded last time.
+	loaded map[string]string
+	done   chan struct{}
+}
+
+func newObjectsDirLoader(super *Supervisor, dir string) (*objectsDirLoader, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("create watcher failed: %v", err)
+	}
+	if err = watcher.Add(dir); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("watch %s failed: %v", dir, err)
+	}
+
+	l := &objectsDirLoader{
+		super:   super,
+		dir:     dir,
+		watcher: watcher,
+		loaded:  map[string]string{},
+		done:    make(chan struct{}),
+	}
+	if err = l.reload(); err != nil {
+		logger.Errorf("load objects from %s failed: %v", dir, err)
+	}
+
+	go l.run()
+
+	return l, nil
+}
+
+func (l *objectsDirLoader) run() {
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-l.done:
+			return
+		case event, ok := <-l.watcher.Events:
+			if !ok {
+				return
+			}
+			if isObjectsFile(event.Name) {
+				timer = time.After(objectsDirReloadDelay)
+			}
+		case err, ok := <-l.watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Errorf("watch %s failed: %v", l.dir, err)
+		case <-timer:
+			timer = nil
+			if err := l.reload(); err != nil {
+				logger.Errorf("reload objects from %s failed, keep the running ones: %v", l.dir, err)
+			}
+		}
+	}
+}
+
+func isObjectsFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return !strings.HasPrefix(filepath.Base(path), ".")
+	}
+	return false
+}
+
+// load reads the specs of all objects in the directory, it fails if any
+// of the specs is invalid, so the objects are never half-updated.
+func (l *objectsDirLoader) load() (map[string]string, error) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	objs := map[string]string{}
+	for _, entry := range entries {
+		if entry.IsDir() || !isObjectsFile(entry.Name()) {
+			continue
+		}
+
+		path := filepath.Join(l.dir, entry.Name())
+		docs, err := readYAMLDocs(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		for _, doc := range docs {
+			spec, err := l.super.NewSpec(doc)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			if _, exists := objs[spec.Name()]; exists {
+				return nil, fmt.Errorf("%s: duplicated name %s", path, spec.Name())
+			}
+			objs[spec.Name()] = spec.JSONConfig()
+		}
+	}
+
+	return objs, nil
+}
+
+func readYAMLDocs(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var docs []string
+	r := k8syaml.NewYAMLReader(bufio.NewReader(f))
+	for {
+		data, err := r.Read()
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if doc := strings.TrimSpace(string(data)); doc != "" {
+			docs = append(docs, doc)
+		}
+	}
+}
+
+// reload loads the objects and applies the changes to the configuration
+// in one transaction, the config version is upgraded if anything changes.
+func (l *objectsDirLoader) reload() error {
+	objs, err := l.load()
+	if err != nil {
+		return err
+	}
+
+	cls := l.super.Cluster()
+	layout := cls.Layout()
+
+	kvs := map[string]*string{}
+	for name := range l.loaded {
+		if _, exists := objs[name]; !exists {
+			kvs[layout.ConfigObjectKey(name)] = nil
+			logger.Infof("object %s is removed from %s", name, l.dir)
+		}
+	}
+	for name, config := range objs {
+		if old, exists := l.loaded[name]; exists && old == config {
+			continue
+		}
+		config := config
+		kvs[layout.ConfigObjectKey(name)] = &config
+		logger.Infof("object %s is loaded from %s", name, l.dir)
+	}
+	if len(kvs) == 0 {
+		return nil
+	}
+
+	version := int64(0)
+	value, err := cls.Get(layout.ConfigVersion())
+	if err != nil {
+		return err
+	}
+	if value != nil {
+		version, _ = strconv.ParseInt(*value, 10, 64)
+	}
+	versionStr := strconv.FormatInt(version+1, 10)
+	kvs[layout.ConfigVersion()] = &versionStr
+
+	if err = cls.PutAndDelete(kvs); err != nil {
+		return err
+	}
+
+	l.loaded = objs
+	return nil
+}
+
+func (l *objectsDirLoader) close() {
+	close(l.done)
+	l.watcher.Close()
+}
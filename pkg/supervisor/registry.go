@@ -148,6 +148,15 @@ func ObjectKinds() []string {
 	return kinds
 }
 
+// ObjectDefaultSpec returns the default spec of the object kind.
+func ObjectDefaultSpec(kind string) (interface{}, bool) {
+	o, exists := objectRegistry[kind]
+	if !exists {
+		return nil, false
+	}
+	return o.DefaultSpec(), true
+}
+
 // TrafficObjectKinds is a map that contains all kinds of TrafficObject.
 var TrafficObjectKinds = make(map[string]struct{})
 
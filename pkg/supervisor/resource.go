@@ -0,0 +1,406 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package supervisor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"runtime/pprof"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+// resourceLabel is the profiler label of the goroutines of an object, the
+// goroutines created by a goroutine inherit its labels, so the goroutines
+// created by the object, directly or not, are counted.
+const resourceLabel = "easegress.object"
+
+type (
+	// ResourceSpec is the resource part of the specs of all objects.
+	ResourceSpec struct {
+		ResourceLimits *ResourceLimits `json:"resourceLimits,omitempty" jsonschema:"omitempty"`
+	}
+
+	// ResourceLimits are the hard limits of the resources attributable to
+	// an object, zero means unlimited. The object exceeding any of them is
+	// unhealthy, and its traffic is shed until it recovers.
+	ResourceLimits struct {
+		MaxGoroutines  int64 `json:"maxGoroutines,omitempty" jsonschema:"omitempty,minimum=0"`
+		MaxConnections int64 `json:"maxConnections,omitempty" jsonschema:"omitempty,minimum=0"`
+		// MaxMemoryBytes limits the memory reported by the object, e.g.
+		// the bodies of the in-flight requests of an HTTPServer.
+		MaxMemoryBytes int64 `json:"maxMemoryBytes,omitempty" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// ResourceUsage is the resource usage attributable to an object.
+	ResourceUsage struct {
+		Goroutines  int64 `json:"goroutines"`
+		Connections int64 `json:"connections"`
+		MemoryBytes int64 `json:"memoryBytes"`
+	}
+
+	// ResourceStatus is the resource status of an object.
+	ResourceStatus struct {
+		ResourceUsage `json:",inline"`
+		Limits        *ResourceLimits `json:"limits,omitempty"`
+		Healthy       bool            `json:"healthy"`
+		Error         string          `json:"error,omitempty"`
+	}
+
+	// ResourceTracker accounts the resources of an object, it is owned by
+	// the object entity and shared by all generations of the object. The
+	// goroutines are counted by the supervisor if sampling is enabled,
+	// while the connections and memory are reported by the object. All
+	// methods are safe to call on a nil tracker.
+	ResourceTracker struct {
+		id     string
+		name   string
+		limits atomic.Value // *ResourceLimits
+
+		goroutines  int64
+		connections int64
+		memory      int64
+
+		// unhealthy is the last state logged by the supervisor.
+		unhealthy bool
+	}
+
+	// resourceAccountant samples the goroutines of the trackers, the key
+	// of trackers is the object name.
+	resourceAccountant struct {
+		mutex    sync.Mutex
+		nextID   uint64
+		trackers map[string]*ResourceTracker
+	}
+)
+
+// check returns the error describing the first exceeded limit.
+func (l *ResourceLimits) check(u *ResourceUsage) error {
+	if l == nil {
+		return nil
+	}
+	switch {
+	case l.MaxGoroutines > 0 && u.Goroutines > l.MaxGoroutines:
+		return fmt.Errorf("goroutines %d exceed the limit %d", u.Goroutines, l.MaxGoroutines)
+	case l.MaxConnections > 0 && u.Connections > l.MaxConnections:
+		return fmt.Errorf("connections %d exceed the limit %d", u.Connections, l.MaxConnections)
+	case l.MaxMemoryBytes > 0 && u.MemoryBytes > l.MaxMemoryBytes:
+		return fmt.Errorf("memory %d bytes exceeds the limit %d", u.MemoryBytes, l.MaxMemoryBytes)
+	}
+	return nil
+}
+
+func newResourceAccountant() *resourceAccountant {
+	return &resourceAccountant{trackers: map[string]*ResourceTracker{}}
+}
+
+// newTracker creates a tracker of the object, it is not registered if the
+// accountant is nil, e.g. in tests, and its goroutines are not counted.
+func (a *resourceAccountant) newTracker(name string) *ResourceTracker {
+	t := &ResourceTracker{name: name}
+	t.limits.Store((*ResourceLimits)(nil))
+	if a == nil {
+		return t
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.nextID++
+	t.id = strconv.FormatUint(a.nextID, 10)
+	a.trackers[name] = t
+	return t
+}
+
+func (a *resourceAccountant) removeTracker(t *ResourceTracker) {
+	if a == nil || t == nil {
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.trackers[t.name] == t {
+		delete(a.trackers, t.name)
+	}
+}
+
+func (a *resourceAccountant) getTracker(name string) *ResourceTracker {
+	if a == nil {
+		return nil
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.trackers[name]
+}
+
+func (a *resourceAccountant) run(interval time.Duration, done chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			a.sample()
+		}
+	}
+}
+
+// sample counts the goroutines of the trackers and logs the objects
+// becoming unhealthy or recovering.
+func (a *resourceAccountant) sample() {
+	counts, err := countGoroutines()
+	if err != nil {
+		logger.Errorf("count goroutines of objects failed: %v", err)
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for _, t := range a.trackers {
+		atomic.StoreInt64(&t.goroutines, counts[t.id])
+
+		err := t.check()
+		if err != nil && !t.unhealthy {
+			logger.Warnf("%s is unhealthy and its traffic is shed: %v", t.name, err)
+		} else if err == nil && t.unhealthy {
+			logger.Infof("%s recovered from exceeding its resource limits", t.name)
+		}
+		t.unhealthy = err != nil
+	}
+}
+
+// countGoroutines returns the number of goroutines of each tracker ID. It
+// reads the gzipped protobuf profile, instead of the text one, whose
+// samples are the groups of the goroutines with the same stack and labels.
+func countGoroutines() (map[string]int64, error) {
+	buff := &bytes.Buffer{}
+	if err := pprof.Lookup("goroutine").WriteTo(buff, 0); err != nil {
+		return nil, err
+	}
+
+	r, err := gzip.NewReader(buff)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return countLabelValues(profile, resourceLabel)
+}
+
+// countLabelValues sums the first values of the samples of the profile by
+// the values of their label key. The fields are numbered as profile.proto
+// of pprof.
+func countLabelValues(profile []byte, key string) (map[string]int64, error) {
+	type sample struct {
+		value  int64
+		labels [][2]uint64 // the indexes of the key and the value
+	}
+
+	samples := []*sample{}
+	strs := []string{}
+	err := walkProfile(profile, func(num protowire.Number, _ protowire.Type, b []byte, _ uint64) error {
+		switch num {
+		case 2: // Profile.sample
+			s := &sample{}
+			values := 0
+			err := walkProfile(b, func(num protowire.Number, typ protowire.Type, b []byte, v uint64) error {
+				switch num {
+				case 2: // Sample.value, packed or not
+					if typ == protowire.VarintType {
+						if values == 0 {
+							s.value = int64(v)
+						}
+						values++
+						return nil
+					}
+					for len(b) > 0 {
+						v, n := protowire.ConsumeVarint(b)
+						if n < 0 {
+							return protowire.ParseError(n)
+						}
+						if values == 0 {
+							s.value = int64(v)
+						}
+						values++
+						b = b[n:]
+					}
+				case 3: // Sample.label
+					label := [2]uint64{}
+					err := walkProfile(b, func(num protowire.Number, _ protowire.Type, _ []byte, v uint64) error {
+						if num == 1 || num == 2 { // Label.key, Label.str
+							label[num-1] = v
+						}
+						return nil
+					})
+					if err != nil {
+						return err
+					}
+					s.labels = append(s.labels, label)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			samples = append(samples, s)
+		case 6: // Profile.string_table
+			strs = append(strs, string(b))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int64{}
+	for _, s := range samples {
+		for _, label := range s.labels {
+			if label[0] >= uint64(len(strs)) || label[1] >= uint64(len(strs)) {
+				return nil, fmt.Errorf("label index out of the string table")
+			}
+			if strs[label[0]] == key {
+				counts[strs[label[1]]] += s.value
+			}
+		}
+	}
+	return counts, nil
+}
+
+// walkProfile calls fn with the fields of the protobuf message, b is the
+// value of a length-delimited field, and v is the one of a varint field.
+// The fields of other types are skipped.
+func walkProfile(b []byte, fn func(num protowire.Number, typ protowire.Type, b []byte, v uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var err error
+		switch typ {
+		case protowire.BytesType:
+			var value []byte
+			value, n = protowire.ConsumeBytes(b)
+			if n >= 0 {
+				err = fn(num, typ, value, 0)
+			}
+		case protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			if n >= 0 {
+				err = fn(num, typ, nil, v)
+			}
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func (t *ResourceTracker) setLimits(limits *ResourceLimits) {
+	if t != nil {
+		t.limits.Store(limits)
+	}
+}
+
+// AddConnections adds delta to the number of connections.
+func (t *ResourceTracker) AddConnections(delta int64) {
+	if t != nil {
+		atomic.AddInt64(&t.connections, delta)
+	}
+}
+
+// AddMemory adds delta to the memory in bytes.
+func (t *ResourceTracker) AddMemory(delta int64) {
+	if t != nil {
+		atomic.AddInt64(&t.memory, delta)
+	}
+}
+
+// Usage returns the resource usage, the goroutines are the number of the
+// last sample.
+func (t *ResourceTracker) Usage() *ResourceUsage {
+	if t == nil {
+		return &ResourceUsage{}
+	}
+	return &ResourceUsage{
+		Goroutines:  atomic.LoadInt64(&t.goroutines),
+		Connections: atomic.LoadInt64(&t.connections),
+		MemoryBytes: atomic.LoadInt64(&t.memory),
+	}
+}
+
+func (t *ResourceTracker) check() error {
+	return t.limits.Load().(*ResourceLimits).check(t.Usage())
+}
+
+// Exceeded returns whether the object exceeds any of its resource limits,
+// the traffic of the object should be shed if it does.
+func (t *ResourceTracker) Exceeded() bool {
+	if t == nil || t.limits.Load().(*ResourceLimits) == nil {
+		return false
+	}
+	return t.check() != nil
+}
+
+// Status returns the resource status.
+func (t *ResourceTracker) Status() *ResourceStatus {
+	if t == nil {
+		return nil
+	}
+
+	s := &ResourceStatus{
+		ResourceUsage: *t.Usage(),
+		Limits:        t.limits.Load().(*ResourceLimits),
+		Healthy:       true,
+	}
+	if err := s.Limits.check(&s.ResourceUsage); err != nil {
+		s.Healthy = false
+		s.Error = err.Error()
+	}
+	return s
+}
+
+// ResourceTracker returns the resource tracker of the running object, it is
+// nil if the object doesn't exist, or for the mocked supervisors.
+func (s *Supervisor) ResourceTracker(name string) *ResourceTracker {
+	return s.resourceAccountant().getTracker(name)
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package supervisor
+
+import (
+	stdcontext "context"
+	"os"
+	"runtime/pprof"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+// startLabeledGoroutines starts n goroutines counted for the tracker, they
+// exit when the returned function is called.
+func startLabeledGoroutines(t *ResourceTracker, n int) func() {
+	stop := make(chan struct{})
+	started := &sync.WaitGroup{}
+	started.Add(n)
+
+	labels := pprof.Labels(resourceLabel, t.id)
+	pprof.Do(stdcontext.Background(), labels, func(stdcontext.Context) {
+		for i := 0; i < n; i++ {
+			go func() {
+				started.Done()
+				<-stop
+			}()
+		}
+	})
+
+	started.Wait()
+	return func() { close(stop) }
+}
+
+func TestResourceLimits(t *testing.T) {
+	assert := assert.New(t)
+
+	tracker := newResourceAccountant().newTracker("server")
+	tracker.AddConnections(100)
+	tracker.AddMemory(1 << 20)
+	assert.False(tracker.Exceeded(), "no limits")
+	assert.True(tracker.Status().Healthy)
+
+	tracker.setLimits(&ResourceLimits{MaxConnections: 100, MaxMemoryBytes: 1 << 20})
+	assert.False(tracker.Exceeded(), "usage at the limits")
+
+	tracker.AddConnections(1)
+	assert.True(tracker.Exceeded())
+	status := tracker.Status()
+	assert.False(status.Healthy)
+	assert.Equal("connections 101 exceed the limit 100", status.Error)
+	assert.Equal(int64(101), status.Connections)
+	assert.Equal(int64(100), status.Limits.MaxConnections)
+
+	tracker.AddConnections(-1)
+	tracker.AddMemory(1)
+	assert.True(tracker.Exceeded())
+	assert.Equal("memory 1048577 bytes exceeds the limit 1048576", tracker.Status().Error)
+
+	tracker.AddMemory(-1)
+	assert.False(tracker.Exceeded(), "recovered")
+	assert.True(tracker.Status().Healthy)
+
+	// Zero means unlimited.
+	tracker.setLimits(&ResourceLimits{MaxMemoryBytes: 1})
+	assert.True(tracker.Exceeded())
+	tracker.setLimits(nil)
+	assert.False(tracker.Exceeded())
+
+	// All methods are safe on a nil tracker.
+	var nilTracker *ResourceTracker
+	nilTracker.setLimits(&ResourceLimits{MaxConnections: 1})
+	nilTracker.AddConnections(10)
+	nilTracker.AddMemory(10)
+	assert.False(nilTracker.Exceeded())
+	assert.Nil(nilTracker.Status())
+	assert.Equal(&ResourceUsage{}, nilTracker.Usage())
+}
+
+func TestResourceAccounting(t *testing.T) {
+	assert := assert.New(t)
+
+	a := newResourceAccountant()
+	server := a.newTracker("server")
+	pipeline := a.newTracker("pipeline")
+	server.setLimits(&ResourceLimits{MaxGoroutines: 3})
+
+	a.sample()
+	assert.Equal(int64(0), server.Usage().Goroutines)
+	assert.False(server.Exceeded())
+
+	stopServer := startLabeledGoroutines(server, 5)
+	stopPipeline := startLabeledGoroutines(pipeline, 2)
+	a.sample()
+	assert.Equal(int64(5), server.Usage().Goroutines)
+	assert.Equal(int64(2), pipeline.Usage().Goroutines)
+	assert.True(server.Exceeded())
+	assert.False(pipeline.Exceeded())
+
+	// The goroutines may not exit immediately.
+	stopServer()
+	assert.Eventually(func() bool {
+		a.sample()
+		return server.Usage().Goroutines == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.False(server.Exceeded())
+	assert.Equal(int64(2), pipeline.Usage().Goroutines)
+	stopPipeline()
+
+	// A removed tracker is not sampled any more.
+	stopServer = startLabeledGoroutines(server, 1)
+	defer stopServer()
+	a.removeTracker(server)
+	a.sample()
+	assert.Equal(int64(0), server.Usage().Goroutines)
+}
+
+func TestResourceTrackerLookup(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &Supervisor{resources: newResourceAccountant()}
+	assert.Nil(s.ResourceTracker("server"))
+
+	previous := s.resourceAccountant().newTracker("server")
+	assert.Same(previous, s.ResourceTracker("server"))
+
+	// Removing a stale tracker doesn't remove the current one.
+	current := s.resourceAccountant().newTracker("server")
+	s.resourceAccountant().removeTracker(previous)
+	assert.Same(current, s.ResourceTracker("server"))
+	s.resourceAccountant().removeTracker(current)
+	assert.Nil(s.ResourceTracker("server"))
+
+	// The trackers of the mocked supervisors are not registered.
+	assert.Nil(NewDefaultMock().ResourceTracker("server"))
+	assert.NotNil(NewDefaultMock().resourceAccountant().newTracker("server"))
+	var nilSuper *Supervisor
+	assert.Nil(nilSuper.ResourceTracker("server"))
+}
+
+func TestCountLabelValues(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := countLabelValues([]byte{0xff}, resourceLabel)
+	assert.Error(err)
+
+	counts, err := countLabelValues(nil, resourceLabel)
+	assert.NoError(err)
+	assert.Empty(counts)
+}
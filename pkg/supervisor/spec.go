@@ -20,7 +20,9 @@ package supervisor
 import (
 	"fmt"
 	"reflect"
+	"sort"
 
+	"github.com/megaease/easegress/pkg/secret"
 	"github.com/megaease/easegress/pkg/util/codectool"
 	"github.com/megaease/easegress/pkg/v"
 )
@@ -35,6 +37,7 @@ type (
 
 		jsonConfig string
 		meta       *MetaSpec
+		resource   *ResourceSpec
 		rawSpec    map[string]interface{}
 		objectSpec interface{}
 	}
@@ -93,29 +96,45 @@ func (s *Supervisor) NewSpec(config string) (spec *Spec, err error) {
 		panic(verr)
 	}
 
+	// Resource part, which is common to all objects.
+	resource := &ResourceSpec{}
+	codectool.MustUnmarshal(buff, resource)
+	verr = v.Validate(resource)
+	if !verr.Valid() {
+		panic(verr)
+	}
+
 	// Object self part.
 	rootObject, exists := objectRegistry[meta.Kind]
 	if !exists {
 		panic(fmt.Errorf("kind %s not found", meta.Kind))
 	}
 	objectSpec := rootObject.DefaultSpec()
-	codectool.MustUnmarshal(buff, objectSpec)
+	codectool.MustUnmarshal(s.resolveSecrets(buff), objectSpec)
 	verr = v.Validate(objectSpec)
 	if !verr.Valid() {
 		panic(verr)
 	}
 
-	// Build final json config and raw spec.
+	// Build final json config and raw spec, secret references are kept in
+	// them, so that the values of secrets never appear in the config.
+	rawObjectSpec := rootObject.DefaultSpec()
+	codectool.MustUnmarshal(buff, rawObjectSpec)
+
 	var rawSpec map[string]interface{}
-	objectBuff := codectool.MustMarshalJSON(objectSpec)
+	objectBuff := codectool.MustMarshalJSON(rawObjectSpec)
 	codectool.MustUnmarshal(objectBuff, &rawSpec)
 
 	metaBuff := codectool.MustMarshalJSON(meta)
 	codectool.MustUnmarshal(metaBuff, &rawSpec)
 
+	resourceBuff := codectool.MustMarshalJSON(resource)
+	codectool.MustUnmarshal(resourceBuff, &rawSpec)
+
 	jsonConfig := string(codectool.MustMarshalJSON(rawSpec))
 
 	spec.meta = meta
+	spec.resource = resource
 	spec.objectSpec = objectSpec
 	spec.rawSpec = rawSpec
 	spec.jsonConfig = jsonConfig
@@ -123,6 +142,25 @@ func (s *Supervisor) NewSpec(config string) (spec *Spec, err error) {
 	return
 }
 
+// resolveSecrets replaces the secret references in the config with the
+// values of the secrets, it panics if any of the secrets is unavailable.
+func (s *Supervisor) resolveSecrets(buff []byte) []byte {
+	var doc interface{}
+	codectool.MustUnmarshal(buff, &doc)
+	if !secret.HasReference(doc) {
+		return buff
+	}
+
+	if s.secrets == nil {
+		panic(fmt.Errorf("secrets are not available"))
+	}
+	doc, err := s.secrets.Resolve(doc)
+	if err != nil {
+		panic(err)
+	}
+	return codectool.MustMarshalJSON(doc)
+}
+
 // Super returns supervisor
 func (s *Spec) Super() *Supervisor {
 	return s.super
@@ -152,11 +190,32 @@ func (s *Spec) RawSpec() map[string]interface{} {
 	return s.rawSpec
 }
 
-// ObjectSpec returns the object spec in its own type.
+// ObjectSpec returns the object spec in its own type, the secret references
+// in it are resolved, so it must not be exposed, use RawSpec instead.
 func (s *Spec) ObjectSpec() interface{} {
 	return s.objectSpec
 }
 
+// Dependencies returns the sorted names of the objects the object depends
+// on, it is empty if the object spec doesn't implement Dependent.
+func (s *Spec) Dependencies() []string {
+	d, ok := s.objectSpec.(Dependent)
+	if !ok {
+		return nil
+	}
+
+	var deps []string
+	seen := map[string]bool{s.Name(): true}
+	for _, name := range d.Dependencies() {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			deps = append(deps, name)
+		}
+	}
+	sort.Strings(deps)
+	return deps
+}
+
 // Equals compares two Specs.
 func (s *Spec) Equals(other *Spec) bool {
 	return reflect.DeepEqual(s.RawSpec(), other.RawSpec())
@@ -26,6 +26,7 @@ import (
 	"github.com/megaease/easegress/pkg/cluster"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/secret"
 )
 
 const watcherName = "__SUPERVISOR__"
@@ -35,6 +36,7 @@ type (
 	Supervisor struct {
 		options *option.Options
 		cls     cluster.Cluster
+		secrets *secret.Store
 
 		// The scenario here satisfies the first common case:
 		// When the entry for a given key is only ever written once but read many times.
@@ -42,7 +44,21 @@ type (
 		businessControllers sync.Map
 		systemControllers   sync.Map
 
+		// objectErrors records the errors of creating or updating objects,
+		// the key is the name of the object.
+		objectErrors sync.Map
+
+		// resources accounts the resources of the objects.
+		resources     *resourceAccountant
+		resourcesDone chan struct{}
+
+		// dependencies evaluates the dependencies and the readiness of
+		// the objects.
+		dependencies     *dependencyTracker
+		dependenciesDone chan struct{}
+
 		objectRegistry  *ObjectRegistry
+		objectsDir      *objectsDirLoader
 		watcher         *ObjectEntityWatcher
 		firstHandle     bool
 		firstHandleDone chan struct{}
@@ -83,9 +99,34 @@ func MustNew(opt *option.Options, cls cluster.Cluster) *Supervisor {
 		firstHandle:     true,
 		firstHandleDone: make(chan struct{}),
 		done:            make(chan struct{}),
+
+		resources:     newResourceAccountant(),
+		resourcesDone: make(chan struct{}),
+
+		dependencies:     newDependencyTracker(),
+		dependenciesDone: make(chan struct{}),
+	}
+	if interval := opt.GetResourceSampleInterval(); interval > 0 {
+		go s.resources.run(interval, s.resourcesDone)
+	}
+	if cls != nil {
+		s.secrets = secret.NewStore(cls, opt)
 	}
 
-	initObjs := loadInitialObjects(s, opt.InitialObjectConfigFiles)
+	var initObjs map[string]string
+	if opt.IsConfigReadOnly() && len(opt.InitialObjectConfigFiles) > 0 {
+		logger.Warnf("initial objects are ignored because the configuration is read-only")
+	} else {
+		initObjs = loadInitialObjects(s, opt.InitialObjectConfigFiles)
+	}
+
+	if opt.Standalone && opt.ObjectsDir != "" {
+		loader, err := newObjectsDirLoader(s, opt.ObjectsDir)
+		if err != nil {
+			panic(fmt.Errorf("load objects from %s failed: %v", opt.ObjectsDir, err))
+		}
+		s.objectsDir = loader
+	}
 
 	s.objectRegistry = newObjectRegistry(s, initObjs)
 	s.watcher = s.objectRegistry.NewWatcher(watcherName, FilterCategory(
@@ -95,6 +136,7 @@ func MustNew(opt *option.Options, cls cluster.Cluster) *Supervisor {
 
 	globalSuper = s
 
+	go s.dependencies.run(s, s.dependenciesDone)
 	s.initSystemControllers()
 
 	go s.run()
@@ -102,6 +144,15 @@ func MustNew(opt *option.Options, cls cluster.Cluster) *Supervisor {
 	return s
 }
 
+// resourceAccountant returns the resource accountant, it is nil for the
+// mocked supervisors.
+func (s *Supervisor) resourceAccountant() *resourceAccountant {
+	if s == nil {
+		return nil
+	}
+	return s.resources
+}
+
 // Options returns the options applied to supervisor.
 func (s *Supervisor) Options() *option.Options {
 	return s.options
@@ -112,6 +163,11 @@ func (s *Supervisor) Cluster() cluster.Cluster {
 	return s.cls
 }
 
+// Secrets returns the secret store, it is nil if there's no cluster.
+func (s *Supervisor) Secrets() *secret.Store {
+	return s.secrets
+}
+
 func (s *Supervisor) initSystemControllers() {
 	for _, rootObject := range objectRegistryOrderByDependency {
 		kind := rootObject.Kind()
@@ -159,7 +215,10 @@ func (s *Supervisor) handleEvent(event *ObjectEntityWatcherEvent) {
 		}()
 	}
 
-	for name := range event.Delete {
+	// The dependents are deleted before their dependencies.
+	deleted := OrderByDependency(event.Delete)
+	for i := len(deleted) - 1; i >= 0; i-- {
+		name := deleted[i].Spec().Name()
 		entity, exists := s.businessControllers.LoadAndDelete(name)
 		if !exists {
 			logger.Errorf("BUG: delete %s not found", name)
@@ -170,7 +229,9 @@ func (s *Supervisor) handleEvent(event *ObjectEntityWatcherEvent) {
 		entity.(*ObjectEntity).CloseWithRecovery()
 	}
 
-	for name, entity := range event.Create {
+	// The dependencies are created before their dependents.
+	for _, entity := range OrderByDependency(event.Create) {
+		name := entity.Spec().Name()
 		_, exists := s.businessControllers.Load(name)
 		if exists {
 			logger.Errorf("BUG: create %s already existed", name)
@@ -182,7 +243,8 @@ func (s *Supervisor) handleEvent(event *ObjectEntityWatcherEvent) {
 		s.businessControllers.Store(name, entity)
 	}
 
-	for name, entity := range event.Update {
+	for _, entity := range OrderByDependency(event.Update) {
+		name := entity.Spec().Name()
 		previousEntity, exists := s.businessControllers.Load(name)
 		if !exists {
 			logger.Errorf("BUG: update %s not found", name)
@@ -261,15 +323,22 @@ func (s *Supervisor) Close(wg *sync.WaitGroup) {
 }
 
 func (s *Supervisor) close() {
+	if s.objectsDir != nil {
+		s.objectsDir.close()
+	}
 	s.objectRegistry.CloseWatcher(watcherName)
 	s.objectRegistry.close()
 
+	entities := map[string]*ObjectEntity{}
 	s.businessControllers.Range(func(k, v interface{}) bool {
-		entity := v.(*ObjectEntity)
-		logger.Infof("delete %s", k)
-		entity.CloseWithRecovery()
+		entities[k.(string)] = v.(*ObjectEntity)
 		return true
 	})
+	closing := OrderByDependency(entities)
+	for i := len(closing) - 1; i >= 0; i-- {
+		logger.Infof("delete %s", closing[i].Spec().Name())
+		closing[i].CloseWithRecovery()
+	}
 
 	for i := len(objectRegistryOrderByDependency) - 1; i >= 0; i-- {
 		rootObject := objectRegistryOrderByDependency[i]
@@ -288,5 +357,7 @@ func (s *Supervisor) close() {
 		value.(*ObjectEntity).CloseWithRecovery()
 	}
 
+	close(s.resourcesDone)
+	close(s.dependenciesDone)
 	close(s.done)
 }
@@ -0,0 +1,231 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlphttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+const (
+	// OTLPProtocolGRPC exports spans by OTLP/gRPC.
+	OTLPProtocolGRPC = "grpc"
+	// OTLPProtocolHTTP exports spans by OTLP/HTTP.
+	OTLPProtocolHTTP = "http"
+
+	// AttributePipeline is the attribute of the pipeline handling the
+	// request, it is set when the span is started for sampling.
+	AttributePipeline = "easegress.pipeline"
+
+	instrumentationName = "github.com/megaease/easegress"
+	otlpShutdownTimeout = 5 * time.Second
+)
+
+type (
+	// OTLPSpec describes the OpenTelemetry protocol exporter.
+	OTLPSpec struct {
+		Protocol            string             `json:"protocol" jsonschema:"omitempty,enum=,enum=grpc,enum=http"`
+		Endpoint            string             `json:"endpoint" jsonschema:"required"`
+		URLPath             string             `json:"urlPath" jsonschema:"omitempty"`
+		Insecure            bool               `json:"insecure" jsonschema:"omitempty"`
+		Headers             map[string]string  `json:"headers" jsonschema:"omitempty"`
+		SampleRate          float64            `json:"sampleRate" jsonschema:"required,minimum=0,maximum=1"`
+		PipelineSampleRates map[string]float64 `json:"pipelineSampleRates" jsonschema:"omitempty"`
+	}
+
+	// pipelineSampler samples the root spans by the sample rate of the
+	// pipeline, falls back to the default sample rate.
+	pipelineSampler struct {
+		defaultSampler sdktrace.Sampler
+		pipelines      map[string]sdktrace.Sampler
+	}
+
+	otlpSpan struct {
+		ctx    context.Context
+		span   trace.Span
+		tracer *Tracer
+	}
+)
+
+var otlpPropagator = propagation.TraceContext{}
+
+// Validate validates OTLPSpec.
+func (spec *OTLPSpec) Validate() error {
+	if _, _, err := net.SplitHostPort(spec.Endpoint); err != nil {
+		return fmt.Errorf("invalid endpoint %s: %v", spec.Endpoint, err)
+	}
+
+	for pipeline, rate := range spec.PipelineSampleRates {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("sample rate %v of pipeline %s is out of [0, 1]", rate, pipeline)
+		}
+	}
+
+	return nil
+}
+
+func (s *pipelineSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	for _, attr := range p.Attributes {
+		if attr.Key != AttributePipeline {
+			continue
+		}
+		if sampler := s.pipelines[attr.Value.AsString()]; sampler != nil {
+			return sampler.ShouldSample(p)
+		}
+		break
+	}
+	return s.defaultSampler.ShouldSample(p)
+}
+
+func (s *pipelineSampler) Description() string {
+	return fmt.Sprintf("PipelineSampler{%s,pipelines:%d}",
+		s.defaultSampler.Description(), len(s.pipelines))
+}
+
+func newOTLPDriver(spec *OTLPSpec) otlp.ProtocolDriver {
+	if spec.Protocol == OTLPProtocolHTTP {
+		opts := []otlphttp.Option{
+			otlphttp.WithEndpoint(spec.Endpoint),
+			otlphttp.WithHeaders(spec.Headers),
+		}
+		if spec.URLPath != "" {
+			opts = append(opts, otlphttp.WithTracesURLPath(spec.URLPath))
+		}
+		if spec.Insecure {
+			opts = append(opts, otlphttp.WithInsecure())
+		}
+		return otlphttp.NewDriver(opts...)
+	}
+
+	opts := []otlpgrpc.Option{
+		otlpgrpc.WithEndpoint(spec.Endpoint),
+		otlpgrpc.WithHeaders(spec.Headers),
+	}
+	if spec.Insecure {
+		opts = append(opts, otlpgrpc.WithInsecure())
+	}
+	return otlpgrpc.NewDriver(opts...)
+}
+
+func newOTLPTracer(spec *Spec) (*Tracer, error) {
+	exporter, err := otlp.NewExporter(context.Background(), newOTLPDriver(spec.OTLP))
+	if err != nil {
+		return nil, fmt.Errorf("create otlp exporter failed: %v", err)
+	}
+
+	attrs := []attribute.KeyValue{attribute.String("service.name", spec.ServiceName)}
+	for k, v := range spec.Tags {
+		attrs = append(attrs, attribute.String(k, v))
+	}
+
+	sampler := &pipelineSampler{
+		defaultSampler: sdktrace.TraceIDRatioBased(spec.OTLP.SampleRate),
+		pipelines:      map[string]sdktrace.Sampler{},
+	}
+	for pipeline, rate := range spec.OTLP.PipelineSampleRates {
+		sampler.pipelines[pipeline] = sdktrace.TraceIDRatioBased(rate)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+		sdktrace.WithResource(resource.NewWithAttributes(attrs...)),
+	)
+
+	return &Tracer{
+		tags:       spec.Tags,
+		provider:   provider,
+		otelTracer: provider.Tracer(instrumentationName),
+	}, nil
+}
+
+func (t *Tracer) closeOTLP() error {
+	ctx, cancel := context.WithTimeout(context.Background(), otlpShutdownTimeout)
+	defer cancel()
+	return t.provider.Shutdown(ctx)
+}
+
+// newOTLPSpan creates a root span, the span is a server span joining the
+// trace of the request if r is not nil.
+func (t *Tracer) newOTLPSpan(r *http.Request, name, pipeline string, startAt time.Time) Span {
+	ctx := context.Background()
+	opts := []trace.SpanOption{trace.WithTimestamp(startAt)}
+
+	if r != nil {
+		ctx = otlpPropagator.Extract(ctx, propagation.HeaderCarrier(r.Header))
+		opts = append(opts, trace.WithSpanKind(trace.SpanKindServer))
+	}
+	if pipeline != "" {
+		opts = append(opts, trace.WithAttributes(attribute.String(AttributePipeline, pipeline)))
+	}
+
+	ctx, s := t.otelTracer.Start(ctx, name, opts...)
+	return &otlpSpan{ctx: ctx, span: s, tracer: t}
+}
+
+// IsNoop returns whether the span is a noop span.
+func (s *otlpSpan) IsNoop() bool {
+	return false
+}
+
+// Tracer returns the tracer of the span.
+func (s *otlpSpan) Tracer() *Tracer {
+	return s.tracer
+}
+
+// NewChild creates a new child span.
+func (s *otlpSpan) NewChild(name string) Span {
+	return s.NewChildWithStart(name, fasttime.Now())
+}
+
+// NewChildWithStart creates a new child span with specified start time.
+func (s *otlpSpan) NewChildWithStart(name string, startAt time.Time) Span {
+	ctx, child := s.tracer.otelTracer.Start(s.ctx, name,
+		trace.WithTimestamp(startAt),
+		trace.WithSpanKind(trace.SpanKindClient))
+	return &otlpSpan{ctx: ctx, span: child, tracer: s.tracer}
+}
+
+// InjectHTTP injects the W3C trace context into an HTTP request.
+func (s *otlpSpan) InjectHTTP(r *http.Request) {
+	otlpPropagator.Inject(s.ctx, propagation.HeaderCarrier(r.Header))
+}
+
+// Tag sets an attribute of the span.
+func (s *otlpSpan) Tag(key, value string) {
+	s.span.SetAttributes(attribute.String(key, value))
+}
+
+// Finish finishes the span.
+func (s *otlpSpan) Finish() {
+	s.span.End()
+}
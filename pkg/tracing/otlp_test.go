@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const testTraceParent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+
+func newTestOTLPTracer() *Tracer {
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSampler(sdktrace.AlwaysSample()))
+	return &Tracer{
+		provider:   provider,
+		otelTracer: provider.Tracer(instrumentationName),
+	}
+}
+
+func TestOTLPSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &OTLPSpec{Endpoint: "127.0.0.1:4317", SampleRate: 0.5}
+	assert.NoError(spec.Validate())
+
+	spec.Endpoint = "127.0.0.1"
+	assert.Error(spec.Validate())
+
+	spec.Endpoint = "127.0.0.1:4317"
+	spec.PipelineSampleRates = map[string]float64{"pipeline-a": 1.5}
+	assert.Error(spec.Validate())
+
+	spec.PipelineSampleRates = map[string]float64{"pipeline-a": 0}
+	assert.NoError(spec.Validate())
+}
+
+func TestPipelineSampler(t *testing.T) {
+	assert := assert.New(t)
+
+	sampler := &pipelineSampler{
+		defaultSampler: sdktrace.AlwaysSample(),
+		pipelines: map[string]sdktrace.Sampler{
+			"pipeline-a": sdktrace.NeverSample(),
+		},
+	}
+
+	params := func(pipeline string) sdktrace.SamplingParameters {
+		p := sdktrace.SamplingParameters{Name: "test"}
+		if pipeline != "" {
+			p.Attributes = []attribute.KeyValue{attribute.String(AttributePipeline, pipeline)}
+		}
+		return p
+	}
+
+	assert.Equal(sdktrace.Drop, sampler.ShouldSample(params("pipeline-a")).Decision)
+	assert.Equal(sdktrace.RecordAndSample, sampler.ShouldSample(params("pipeline-b")).Decision)
+	assert.Equal(sdktrace.RecordAndSample, sampler.ShouldSample(params("")).Decision)
+	assert.Contains(sampler.Description(), "pipelines:1")
+}
+
+func TestOTLPTraceContext(t *testing.T) {
+	assert := assert.New(t)
+
+	tracer := newTestOTLPTracer()
+	defer tracer.Close()
+
+	// the server span joins the trace of the incoming request.
+	r, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	r.Header.Set("traceparent", testTraceParent)
+	span := tracer.NewServerSpan(r, "server", "pipeline-a", time.Now())
+	assert.False(span.IsNoop())
+	assert.Equal(tracer, span.Tracer())
+
+	child := span.NewChild("client")
+	out, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	child.InjectHTTP(out)
+
+	traceParent := out.Header.Get("traceparent")
+	assert.Len(traceParent, len(testTraceParent))
+	assert.Equal(testTraceParent[:36], traceParent[:36])
+	assert.NotEqual(testTraceParent[36:52], traceParent[36:52])
+
+	child.Tag("key", "value")
+	child.Finish()
+	span.Finish()
+
+	// a span without an incoming trace context starts a new trace.
+	span = tracer.NewSpan("root")
+	out, _ = http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	span.InjectHTTP(out)
+	assert.NotEmpty(out.Header.Get("traceparent"))
+	assert.NotEqual(testTraceParent[3:35], out.Header.Get("traceparent")[3:35])
+	span.Finish()
+}
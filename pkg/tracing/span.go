@@ -30,7 +30,8 @@ import (
 type (
 	// Span is the span of the Tracing.
 	Span interface {
-		zipkingo.Span
+		// IsNoop returns whether the span is a noop span.
+		IsNoop() bool
 
 		// Tracer returns the Tracer that created this Span.
 		Tracer() *Tracer
@@ -43,6 +44,12 @@ type (
 
 		// InjectHTTP injects span context into an HTTP request.
 		InjectHTTP(r *http.Request)
+
+		// Tag sets a tag of the span, it is an attribute in OpenTelemetry.
+		Tag(key, value string)
+
+		// Finish finishes the span.
+		Finish()
 	}
 
 	span struct {
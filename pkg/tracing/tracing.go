@@ -18,14 +18,20 @@
 package tracing
 
 import (
+	"fmt"
 	"io"
+	"net/http"
 	"time"
 
 	"github.com/megaease/easegress/pkg/util/fasttime"
 
 	zipkingo "github.com/openzipkin/zipkin-go"
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/openzipkin/zipkin-go/propagation/b3"
 	zipkinreporter "github.com/openzipkin/zipkin-go/reporter"
 	zipkingohttp "github.com/openzipkin/zipkin-go/reporter/http"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type (
@@ -33,7 +39,8 @@ type (
 	Spec struct {
 		ServiceName string            `json:"serviceName" jsonschema:"required"`
 		Tags        map[string]string `json:"tags" jsonschema:"omitempty"`
-		Zipkin      *ZipkinSpec       `json:"zipkin" jsonschema:"required"`
+		Zipkin      *ZipkinSpec       `json:"zipkin,omitempty" jsonschema:"omitempty"`
+		OTLP        *OTLPSpec         `json:"otlp,omitempty" jsonschema:"omitempty"`
 	}
 
 	// ZipkinSpec describes Zipkin.
@@ -46,17 +53,31 @@ type (
 		ID128Bit      bool    `json:"id128Bit" jsonschema:"omitempty"`
 	}
 
-	// Tracer is the tracer.
+	// Tracer is the tracer, spans are exported by either Zipkin or OTLP.
 	Tracer struct {
 		tracer *zipkingo.Tracer
 		tags   map[string]string
 		closer io.Closer
+
+		provider   *sdktrace.TracerProvider
+		otelTracer trace.Tracer
 	}
 
 	noopCloser struct{}
 )
 
 // Validate validates Spec.
+func (spec *Spec) Validate() error {
+	if spec.Zipkin == nil && spec.OTLP == nil {
+		return fmt.Errorf("one of zipkin and otlp is required")
+	}
+	if spec.Zipkin != nil && spec.OTLP != nil {
+		return fmt.Errorf("zipkin and otlp are mutually exclusive")
+	}
+	return nil
+}
+
+// Validate validates ZipkinSpec.
 func (spec *ZipkinSpec) Validate() error {
 	if spec.Hostport != "" {
 		_, err := zipkingo.NewEndpoint("", spec.Hostport)
@@ -83,6 +104,10 @@ func New(spec *Spec) (*Tracer, error) {
 		return NoopTracer, nil
 	}
 
+	if spec.OTLP != nil {
+		return newOTLPTracer(spec)
+	}
+
 	endpoint, err := zipkingo.NewEndpoint(spec.ServiceName, spec.Zipkin.Hostport)
 	if err != nil {
 		return nil, err
@@ -124,6 +149,10 @@ func (t *Tracer) IsNoopTracer() bool {
 
 // Close closes Tracing.
 func (t *Tracer) Close() error {
+	if t.provider != nil {
+		return t.closeOTLP()
+	}
+
 	if t.closer != nil {
 		return t.closer.Close()
 	}
@@ -148,6 +177,32 @@ func (t *Tracer) NewSpanWithStart(name string, startAt time.Time) Span {
 }
 
 func (t *Tracer) newSpanWithStart(name string, startAt time.Time) Span {
+	if t.provider != nil {
+		return t.newOTLPSpan(nil, name, "", startAt)
+	}
+
 	s := t.tracer.StartSpan(name, zipkingo.StartTime(startAt))
 	return &span{Span: s, tracer: t}
 }
+
+// NewServerSpan creates a span for the request received by a server, the
+// span joins the trace of the request if the request carries a trace
+// context, which is W3C traceparent for OTLP and B3 for Zipkin. pipeline is
+// the pipeline the request is routed to, it is used for the sampling of
+// OTLP.
+func (t *Tracer) NewServerSpan(r *http.Request, name, pipeline string, startAt time.Time) Span {
+	if t.IsNoopTracer() {
+		return NoopSpan
+	}
+
+	if t.provider != nil {
+		return t.newOTLPSpan(r, name, pipeline, startAt)
+	}
+
+	opts := []zipkingo.SpanOption{zipkingo.StartTime(startAt), zipkingo.Kind(model.Server)}
+	if sc, err := b3.ExtractHTTP(r)(); err == nil && sc != nil {
+		opts = append(opts, zipkingo.Parent(*sc))
+	}
+	s := t.tracer.StartSpan(name, opts...)
+	return &span{Span: s, tracer: t}
+}
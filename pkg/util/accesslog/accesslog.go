@@ -0,0 +1,259 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package accesslog provides the structured access log of HTTP servers,
+// the fields, the format, the destinations and the sampling of the log are
+// configurable.
+package accesslog
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	// DataUpstreamAddr is the key of the context data of the address of
+	// the upstream server.
+	DataUpstreamAddr = "ACCESSLOG_UPSTREAM_ADDR"
+	// DataRetryCount is the key of the context data of the retry count of
+	// the request to the upstream.
+	DataRetryCount = "ACCESSLOG_RETRY_COUNT"
+	// DataFilterResults is the key of the context data of a function
+	// returning the results of the filters.
+	DataFilterResults = "ACCESSLOG_FILTER_RESULTS"
+	// DataRequestID is the key of the context data of the request ID.
+	DataRequestID = "ACCESSLOG_REQUEST_ID"
+
+	entryChanSize = 10240
+)
+
+type (
+	// Spec describes the access log.
+	Spec struct {
+		Fields              []string           `json:"fields" jsonschema:"omitempty,uniqueItems=true"`
+		Format              string             `json:"format" jsonschema:"omitempty,enum=,enum=json,enum=clf,enum=template"`
+		Template            string             `json:"template" jsonschema:"omitempty"`
+		SampleRate          float64            `json:"sampleRate" jsonschema:"omitempty,minimum=0,maximum=1"`
+		PipelineSampleRates map[string]float64 `json:"pipelineSampleRates" jsonschema:"omitempty"`
+
+		File   *FileSpec   `json:"file,omitempty" jsonschema:"omitempty"`
+		Syslog *SyslogSpec `json:"syslog,omitempty" jsonschema:"omitempty"`
+		Kafka  *KafkaSpec  `json:"kafka,omitempty" jsonschema:"omitempty"`
+		HTTP   *HTTPSpec   `json:"http,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Entry is an entry of the access log, it is the record of a request.
+	Entry struct {
+		StartTime     time.Time
+		Request       *http.Request
+		RealIP        string
+		StatusCode    int
+		Duration      time.Duration
+		RequestSize   uint64
+		ResponseSize  uint64
+		Route         string
+		Backend       string
+		FilterResults string
+		UpstreamAddr  string
+		RetryCount    int
+		RequestID     string
+		Tags          string
+	}
+
+	// Logger writes the access log to its destinations asynchronously.
+	Logger struct {
+		spec      *Spec
+		formatter formatter
+		writers   []writer
+
+		entries chan []byte
+		done    chan struct{}
+		wg      sync.WaitGroup
+	}
+
+	writer interface {
+		Write(line []byte) error
+		Close() error
+	}
+)
+
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	for _, field := range spec.Fields {
+		if !isValidField(field) {
+			return fmt.Errorf("unknown field %s", field)
+		}
+	}
+
+	if spec.Format == FormatTemplate {
+		if spec.Template == "" {
+			return fmt.Errorf("template is required for format template")
+		}
+		if _, err := newTemplateFormatter(spec); err != nil {
+			return err
+		}
+	}
+
+	for pipeline, rate := range spec.PipelineSampleRates {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("sample rate %v of pipeline %s is out of [0, 1]", rate, pipeline)
+		}
+	}
+
+	return nil
+}
+
+// New creates a Logger, the log is written to the HTTP access log of
+// Easegress if no destination is specified.
+func New(spec *Spec) (*Logger, error) {
+	f, err := newFormatter(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Logger{
+		spec:      spec,
+		formatter: f,
+		entries:   make(chan []byte, entryChanSize),
+		done:      make(chan struct{}),
+	}
+
+	if err = l.createWriters(); err != nil {
+		l.closeWriters()
+		return nil, err
+	}
+
+	l.wg.Add(1)
+	go l.run()
+	return l, nil
+}
+
+func (l *Logger) createWriters() error {
+	if l.spec.File != nil {
+		l.writers = append(l.writers, newFileWriter(l.spec.File))
+	}
+
+	if l.spec.Syslog != nil {
+		w, err := newSyslogWriter(l.spec.Syslog)
+		if err != nil {
+			return fmt.Errorf("create syslog writer failed: %v", err)
+		}
+		l.writers = append(l.writers, w)
+	}
+
+	if l.spec.Kafka != nil {
+		w, err := newKafkaWriter(l.spec.Kafka)
+		if err != nil {
+			return fmt.Errorf("create kafka writer failed: %v", err)
+		}
+		l.writers = append(l.writers, w)
+	}
+
+	if l.spec.HTTP != nil {
+		l.writers = append(l.writers, newHTTPWriter(l.spec.HTTP))
+	}
+
+	if len(l.writers) == 0 {
+		l.writers = append(l.writers, defaultWriter{})
+	}
+
+	return nil
+}
+
+// ShouldLog returns whether to log the request routed to the pipeline,
+// according to the sample rates.
+func (l *Logger) ShouldLog(pipeline string) bool {
+	rate, ok := l.spec.PipelineSampleRates[pipeline]
+	if !ok {
+		rate = l.spec.SampleRate
+		// zero means logging all requests.
+		if rate == 0 {
+			return true
+		}
+	}
+
+	if rate >= 1 {
+		return true
+	}
+	return rand.Float64() < rate
+}
+
+// Log formats the entry and writes it asynchronously, the entry is
+// dropped if the destinations can't keep up.
+func (l *Logger) Log(entry *Entry) {
+	line := l.formatter.format(entry)
+
+	select {
+	case l.entries <- line:
+	default:
+		logger.Debugf("access log is dropped as the destinations are too slow")
+	}
+}
+
+func (l *Logger) run() {
+	defer l.wg.Done()
+
+	for {
+		select {
+		case <-l.done:
+			l.drain()
+			return
+		case line := <-l.entries:
+			l.write(line)
+		}
+	}
+}
+
+// drain writes the pending entries.
+func (l *Logger) drain() {
+	for {
+		select {
+		case line := <-l.entries:
+			l.write(line)
+		default:
+			return
+		}
+	}
+}
+
+func (l *Logger) write(line []byte) {
+	for _, w := range l.writers {
+		if err := w.Write(line); err != nil {
+			logger.Errorf("write access log failed: %v", err)
+		}
+	}
+}
+
+func (l *Logger) closeWriters() {
+	for _, w := range l.writers {
+		if err := w.Close(); err != nil {
+			logger.Errorf("close access log writer failed: %v", err)
+		}
+	}
+}
+
+// Close closes the Logger after writing the pending entries.
+func (l *Logger) Close() {
+	close(l.done)
+	l.wg.Wait()
+	l.closeWriters()
+}
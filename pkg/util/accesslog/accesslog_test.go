@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestEntry() *Entry {
+	r := httptest.NewRequest(http.MethodGet, "/users?id=1", nil)
+	r.Header.Set("X-Request-Id", "abc")
+	return &Entry{
+		StartTime:    time.Date(2022, 7, 1, 8, 0, 0, 0, time.UTC),
+		Request:      r,
+		RealIP:       "10.0.0.1",
+		StatusCode:   200,
+		Duration:     10 * time.Millisecond,
+		ResponseSize: 100,
+		Backend:      "pipeline-demo",
+		UpstreamAddr: "http://127.0.0.1:9095",
+		RetryCount:   1,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Fields: []string{FieldMethod, "header.X-Request-Id"}}
+	assert.NoError(spec.Validate())
+
+	spec = &Spec{Fields: []string{"unknown"}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Format: FormatTemplate}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Format: FormatTemplate, Template: "{{.method"}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{PipelineSampleRates: map[string]float64{"demo": 2}}
+	assert.Error(spec.Validate())
+}
+
+func TestFormat(t *testing.T) {
+	assert := assert.New(t)
+	entry := newTestEntry()
+
+	f, err := newFormatter(&Spec{
+		Fields: []string{FieldMethod, FieldStatusCode, FieldRetryCount, "header.X-Request-Id"},
+	})
+	assert.NoError(err)
+	assert.Equal(`{"method":"GET","statusCode":200,"retryCount":1,"header.X-Request-Id":"abc"}`,
+		string(f.format(entry)))
+
+	f, err = newFormatter(&Spec{Format: FormatCLF})
+	assert.NoError(err)
+	assert.Equal(`10.0.0.1 - - [01/Jul/2022:08:00:00 +0000] "GET /users?id=1 HTTP/1.1" 200 100`,
+		string(f.format(entry)))
+
+	f, err = newFormatter(&Spec{
+		Format:   FormatTemplate,
+		Fields:   []string{FieldMethod, FieldUpstreamAddr, "header.X-Request-Id"},
+		Template: `{{.method}} {{.upstreamAddr}} {{index . "header.X-Request-Id"}}`,
+	})
+	assert.NoError(err)
+	assert.Equal("GET http://127.0.0.1:9095 abc", string(f.format(entry)))
+}
+
+func TestShouldLog(t *testing.T) {
+	assert := assert.New(t)
+
+	l := &Logger{spec: &Spec{
+		PipelineSampleRates: map[string]float64{"none": 0, "all": 1},
+	}}
+	assert.True(l.ShouldLog("other"))
+	assert.True(l.ShouldLog("all"))
+	assert.False(l.ShouldLog("none"))
+}
+
+func TestDestinations(t *testing.T) {
+	assert := assert.New(t)
+
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "access.log")
+	l, err := New(&Spec{
+		Fields: []string{FieldMethod},
+		File:   &FileSpec{Path: path},
+		HTTP:   &HTTPSpec{URL: server.URL, FlushInterval: "10ms"},
+	})
+	assert.NoError(err)
+
+	l.Log(newTestEntry())
+
+	select {
+	case body := <-received:
+		assert.Equal("{\"method\":\"GET\"}\n", body)
+	case <-time.After(5 * time.Second):
+		t.Fatal("access log is not sent")
+	}
+
+	l.Close()
+	data, err := os.ReadFile(path)
+	assert.NoError(err)
+	assert.True(strings.HasPrefix(string(data), `{"method":"GET"}`))
+}
@@ -0,0 +1,301 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/syslog"
+	"net/http"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	defaultHTTPBatchSize     = 100
+	defaultHTTPFlushInterval = time.Second
+	httpSendTimeout          = 5 * time.Second
+)
+
+type (
+	// FileSpec describes the file destination, the file is rotated when
+	// its size reaches maxSize.
+	FileSpec struct {
+		Path       string `json:"path" jsonschema:"required"`
+		MaxSize    int    `json:"maxSize" jsonschema:"omitempty,minimum=0"`
+		MaxBackups int    `json:"maxBackups" jsonschema:"omitempty,minimum=0"`
+		MaxAge     int    `json:"maxAge" jsonschema:"omitempty,minimum=0"`
+		Compress   bool   `json:"compress" jsonschema:"omitempty"`
+	}
+
+	// SyslogSpec describes the syslog destination, the local syslog is
+	// used if address is empty.
+	SyslogSpec struct {
+		Network string `json:"network" jsonschema:"omitempty,enum=,enum=udp,enum=tcp"`
+		Address string `json:"address" jsonschema:"omitempty"`
+		Tag     string `json:"tag" jsonschema:"omitempty"`
+	}
+
+	// KafkaSpec describes the Kafka destination.
+	KafkaSpec struct {
+		Brokers []string `json:"brokers" jsonschema:"required,uniqueItems=true"`
+		Topic   string   `json:"topic" jsonschema:"required"`
+	}
+
+	// HTTPSpec describes the HTTP destination, the log lines are sent in
+	// batches by POST requests, one line per entry.
+	HTTPSpec struct {
+		URL           string            `json:"url" jsonschema:"required,format=url"`
+		Headers       map[string]string `json:"headers" jsonschema:"omitempty"`
+		BatchSize     int               `json:"batchSize" jsonschema:"omitempty,minimum=1"`
+		FlushInterval string            `json:"flushInterval" jsonschema:"omitempty,format=duration"`
+	}
+
+	defaultWriter struct{}
+
+	fileWriter struct {
+		logger *lumberjack.Logger
+	}
+
+	syslogWriter struct {
+		writer *syslog.Writer
+	}
+
+	kafkaWriter struct {
+		topic    string
+		producer sarama.AsyncProducer
+		done     chan struct{}
+	}
+
+	httpWriter struct {
+		spec          *HTTPSpec
+		client        *http.Client
+		batchSize     int
+		flushInterval time.Duration
+
+		lines chan []byte
+		done  chan struct{}
+	}
+)
+
+// Write writes the line to the HTTP access log of Easegress.
+func (w defaultWriter) Write(line []byte) error {
+	logger.HTTPAccess("%s", line)
+	return nil
+}
+
+func (w defaultWriter) Close() error {
+	return nil
+}
+
+func newFileWriter(spec *FileSpec) *fileWriter {
+	return &fileWriter{
+		logger: &lumberjack.Logger{
+			Filename:   spec.Path,
+			MaxSize:    spec.MaxSize,
+			MaxBackups: spec.MaxBackups,
+			MaxAge:     spec.MaxAge,
+			Compress:   spec.Compress,
+			LocalTime:  true,
+		},
+	}
+}
+
+func (w *fileWriter) Write(line []byte) error {
+	_, err := w.logger.Write(append(line, '\n'))
+	return err
+}
+
+func (w *fileWriter) Close() error {
+	return w.logger.Close()
+}
+
+func newSyslogWriter(spec *SyslogSpec) (*syslogWriter, error) {
+	tag := spec.Tag
+	if tag == "" {
+		tag = "easegress"
+	}
+
+	network := spec.Network
+	if spec.Address != "" && network == "" {
+		network = "udp"
+	}
+
+	w, err := syslog.Dial(network, spec.Address, syslog.LOG_INFO|syslog.LOG_LOCAL0, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogWriter{writer: w}, nil
+}
+
+func (w *syslogWriter) Write(line []byte) error {
+	return w.writer.Info(string(line))
+}
+
+func (w *syslogWriter) Close() error {
+	return w.writer.Close()
+}
+
+func newKafkaWriter(spec *KafkaSpec) (*kafkaWriter, error) {
+	config := sarama.NewConfig()
+	config.ClientID = "easegress-accesslog"
+	config.Version = sarama.V0_10_2_0
+
+	producer, err := sarama.NewAsyncProducer(spec.Brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("start sarama producer failed(brokers: %v): %v", spec.Brokers, err)
+	}
+
+	w := &kafkaWriter{
+		topic:    spec.Topic,
+		producer: producer,
+		done:     make(chan struct{}),
+	}
+
+	go func() {
+		for {
+			select {
+			case <-w.done:
+				return
+			case err, ok := <-producer.Errors():
+				if !ok {
+					return
+				}
+				logger.Errorf("produce access log failed: %v", err)
+			}
+		}
+	}()
+
+	return w, nil
+}
+
+func (w *kafkaWriter) Write(line []byte) error {
+	w.producer.Input() <- &sarama.ProducerMessage{
+		Topic: w.topic,
+		Value: sarama.ByteEncoder(line),
+	}
+	return nil
+}
+
+func (w *kafkaWriter) Close() error {
+	close(w.done)
+	return w.producer.Close()
+}
+
+func newHTTPWriter(spec *HTTPSpec) *httpWriter {
+	w := &httpWriter{
+		spec:          spec,
+		client:        &http.Client{Timeout: httpSendTimeout},
+		batchSize:     spec.BatchSize,
+		flushInterval: defaultHTTPFlushInterval,
+		done:          make(chan struct{}),
+	}
+
+	if w.batchSize <= 0 {
+		w.batchSize = defaultHTTPBatchSize
+	}
+	if d, err := time.ParseDuration(spec.FlushInterval); err == nil && d > 0 {
+		w.flushInterval = d
+	}
+	w.lines = make(chan []byte, w.batchSize*2)
+
+	go w.run()
+	return w
+}
+
+func (w *httpWriter) Write(line []byte) error {
+	w.lines <- line
+	return nil
+}
+
+func (w *httpWriter) run() {
+	batch := bytes.NewBuffer(nil)
+	count := 0
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	flush := func() {
+		if count == 0 {
+			return
+		}
+		if err := w.send(batch.Bytes()); err != nil {
+			logger.Errorf("send access log to %s failed: %v", w.spec.URL, err)
+		}
+		batch.Reset()
+		count = 0
+	}
+
+	for {
+		select {
+		case <-w.done:
+			for {
+				select {
+				case line := <-w.lines:
+					batch.Write(line)
+					batch.WriteByte('\n')
+					count++
+				default:
+					flush()
+					return
+				}
+			}
+		case line := <-w.lines:
+			batch.Write(line)
+			batch.WriteByte('\n')
+			count++
+			if count >= w.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (w *httpWriter) send(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.spec.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	for k, v := range w.spec.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (w *httpWriter) Close() error {
+	close(w.done)
+	return nil
+}
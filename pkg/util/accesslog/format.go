@@ -0,0 +1,266 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+const (
+	// FormatJSON formats the entry as a JSON object of the fields.
+	FormatJSON = "json"
+	// FormatCLF formats the entry in the Common Log Format, the fields
+	// are ignored.
+	FormatCLF = "clf"
+	// FormatTemplate formats the entry by a Go template of the fields.
+	FormatTemplate = "template"
+
+	// headerFieldPrefix is the prefix of the fields of request headers,
+	// e.g. header.X-Request-Id.
+	headerFieldPrefix = "header."
+
+	clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+)
+
+// The fields of the access log.
+const (
+	FieldStartTime     = "startTime"
+	FieldRemoteAddr    = "remoteAddr"
+	FieldRealIP        = "realIP"
+	FieldMethod        = "method"
+	FieldHost          = "host"
+	FieldURL           = "url"
+	FieldProto         = "proto"
+	FieldStatusCode    = "statusCode"
+	FieldDuration      = "duration"
+	FieldRequestSize   = "requestSize"
+	FieldResponseSize  = "responseSize"
+	FieldUserAgent     = "userAgent"
+	FieldReferer       = "referer"
+	FieldRoute         = "route"
+	FieldBackend       = "backend"
+	FieldFilterResults = "filterResults"
+	FieldUpstreamAddr  = "upstreamAddr"
+	FieldRetryCount    = "retryCount"
+	FieldRequestID     = "requestID"
+	FieldTLSVersion    = "tlsVersion"
+	FieldTLSCipher     = "tlsCipher"
+	FieldTLSServerName = "tlsServerName"
+	FieldTags          = "tags"
+)
+
+type (
+	formatter interface {
+		format(entry *Entry) []byte
+	}
+
+	jsonFormatter struct {
+		fields []string
+	}
+
+	clfFormatter struct{}
+
+	templateFormatter struct {
+		fields []string
+		tmpl   *template.Template
+	}
+
+	fieldFunc func(entry *Entry) interface{}
+)
+
+var fieldFuncs = map[string]fieldFunc{
+	FieldStartTime: func(e *Entry) interface{} {
+		return fasttime.Format(e.StartTime, fasttime.RFC3339Milli)
+	},
+	FieldRemoteAddr: func(e *Entry) interface{} { return e.Request.RemoteAddr },
+	FieldRealIP:     func(e *Entry) interface{} { return e.RealIP },
+	FieldMethod:     func(e *Entry) interface{} { return e.Request.Method },
+	FieldHost:       func(e *Entry) interface{} { return e.Request.Host },
+	FieldURL:        func(e *Entry) interface{} { return e.Request.RequestURI },
+	FieldProto:      func(e *Entry) interface{} { return e.Request.Proto },
+	FieldStatusCode: func(e *Entry) interface{} { return e.StatusCode },
+	FieldDuration: func(e *Entry) interface{} {
+		return e.Duration.String()
+	},
+	FieldRequestSize:   func(e *Entry) interface{} { return e.RequestSize },
+	FieldResponseSize:  func(e *Entry) interface{} { return e.ResponseSize },
+	FieldUserAgent:     func(e *Entry) interface{} { return e.Request.UserAgent() },
+	FieldReferer:       func(e *Entry) interface{} { return e.Request.Referer() },
+	FieldRoute:         func(e *Entry) interface{} { return e.Route },
+	FieldBackend:       func(e *Entry) interface{} { return e.Backend },
+	FieldFilterResults: func(e *Entry) interface{} { return e.FilterResults },
+	FieldUpstreamAddr:  func(e *Entry) interface{} { return e.UpstreamAddr },
+	FieldRetryCount:    func(e *Entry) interface{} { return e.RetryCount },
+	FieldRequestID:     func(e *Entry) interface{} { return e.RequestID },
+	FieldTLSVersion: func(e *Entry) interface{} {
+		if e.Request.TLS == nil {
+			return ""
+		}
+		return tlsVersionName(e.Request.TLS.Version)
+	},
+	FieldTLSCipher: func(e *Entry) interface{} {
+		if e.Request.TLS == nil {
+			return ""
+		}
+		return tls.CipherSuiteName(e.Request.TLS.CipherSuite)
+	},
+	FieldTLSServerName: func(e *Entry) interface{} {
+		if e.Request.TLS == nil {
+			return ""
+		}
+		return e.Request.TLS.ServerName
+	},
+	FieldTags: func(e *Entry) interface{} { return e.Tags },
+}
+
+// DefaultFields are the fields used if no field is specified.
+var DefaultFields = []string{
+	FieldStartTime, FieldRequestID, FieldRemoteAddr, FieldRealIP, FieldMethod,
+	FieldURL, FieldProto, FieldStatusCode, FieldDuration, FieldRequestSize,
+	FieldResponseSize, FieldRoute, FieldBackend, FieldUpstreamAddr,
+	FieldRetryCount, FieldFilterResults,
+}
+
+func isValidField(field string) bool {
+	if strings.HasPrefix(field, headerFieldPrefix) {
+		return len(field) > len(headerFieldPrefix)
+	}
+	return fieldFuncs[field] != nil
+}
+
+func fieldValue(entry *Entry, field string) interface{} {
+	if strings.HasPrefix(field, headerFieldPrefix) {
+		return entry.Request.Header.Get(field[len(headerFieldPrefix):])
+	}
+	if fn := fieldFuncs[field]; fn != nil {
+		return fn(entry)
+	}
+	return ""
+}
+
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS1.0"
+	case tls.VersionTLS11:
+		return "TLS1.1"
+	case tls.VersionTLS12:
+		return "TLS1.2"
+	case tls.VersionTLS13:
+		return "TLS1.3"
+	default:
+		return fmt.Sprintf("0x%04x", version)
+	}
+}
+
+func specFields(spec *Spec) []string {
+	if len(spec.Fields) == 0 {
+		return DefaultFields
+	}
+	return spec.Fields
+}
+
+func newFormatter(spec *Spec) (formatter, error) {
+	switch spec.Format {
+	case FormatCLF:
+		return clfFormatter{}, nil
+	case FormatTemplate:
+		return newTemplateFormatter(spec)
+	default:
+		return &jsonFormatter{fields: specFields(spec)}, nil
+	}
+}
+
+// format keeps the order of the fields, which is lost if the fields are
+// marshaled as a map.
+func (f *jsonFormatter) format(entry *Entry) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, 512))
+	buf.WriteByte('{')
+	for i, field := range f.fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(field)
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(fieldValue(entry, field))
+		if err != nil {
+			value = []byte(`""`)
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+// format formats the entry as:
+// host ident authuser [date] "request" status bytes
+func (f clfFormatter) format(entry *Entry) []byte {
+	r := entry.Request
+
+	host := entry.RealIP
+	if host == "" {
+		host = r.RemoteAddr
+	}
+
+	user := "-"
+	if u, _, ok := r.BasicAuth(); ok && u != "" {
+		user = u
+	}
+
+	size := "-"
+	if entry.ResponseSize > 0 {
+		size = strconv.FormatUint(entry.ResponseSize, 10)
+	}
+
+	line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s",
+		host, user, entry.StartTime.Format(clfTimeLayout),
+		r.Method, r.RequestURI, r.Proto, entry.StatusCode, size)
+	return []byte(line)
+}
+
+func newTemplateFormatter(spec *Spec) (*templateFormatter, error) {
+	tmpl, err := template.New("accesslog").Option("missingkey=zero").Parse(spec.Template)
+	if err != nil {
+		return nil, fmt.Errorf("parse template failed: %v", err)
+	}
+	return &templateFormatter{fields: specFields(spec), tmpl: tmpl}, nil
+}
+
+// format executes the template with a map of the fields, header fields
+// could be accessed by index, e.g. {{index . "header.X-Request-Id"}}.
+func (f *templateFormatter) format(entry *Entry) []byte {
+	data := make(map[string]interface{}, len(f.fields))
+	for _, field := range f.fields {
+		data[field] = fieldValue(entry, field)
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, 256))
+	if err := f.tmpl.Execute(buf, data); err != nil {
+		return []byte(fmt.Sprintf("execute access log template failed: %v", err))
+	}
+	return buf.Bytes()
+}
@@ -387,8 +387,18 @@ func (cb *CircuitBreaker) transitTo(state State, reason string) {
 	}
 }
 
+// String returns the string representation of the state
+func (s State) String() string {
+	if int(s) < len(stateStrings) {
+		return stateStrings[s]
+	}
+	return "Unknown"
+}
+
 // State returns the state of the circuit breaker
 func (cb *CircuitBreaker) State() State {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
 	return cb.state
 }
 
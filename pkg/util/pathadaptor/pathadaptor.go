@@ -18,9 +18,12 @@
 package pathadaptor
 
 import (
+	"bytes"
 	"regexp"
 	"strings"
+	"text/template"
 
+	sprig "github.com/go-task/slim-sprig"
 	"github.com/megaease/easegress/pkg/logger"
 )
 
@@ -44,6 +47,9 @@ type (
 	// PathAdaptor is the path Adaptor.
 	PathAdaptor struct {
 		spec *Spec
+
+		replace   *template.Template
+		addPrefix *template.Template
 	}
 )
 
@@ -63,14 +69,66 @@ func New(spec *Spec) *PathAdaptor {
 	}
 }
 
+// NewWithTemplate creates a pathAdaptor whose Replace and AddPrefix are
+// templates, which are executed with the data passed to AdaptWithData.
+func NewWithTemplate(spec *Spec) (*PathAdaptor, error) {
+	pa := New(spec)
+
+	var err error
+	if len(spec.Replace) != 0 {
+		if pa.replace, err = newTemplate(spec.Replace); err != nil {
+			return nil, err
+		}
+	}
+	if len(spec.AddPrefix) != 0 {
+		if pa.addPrefix, err = newTemplate(spec.AddPrefix); err != nil {
+			return nil, err
+		}
+	}
+
+	return pa, nil
+}
+
+func newTemplate(text string) (*template.Template, error) {
+	return template.New("").Funcs(sprig.TxtFuncMap()).Parse(text)
+}
+
+func executeTemplate(t *template.Template, data interface{}) (string, bool) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		logger.Warnf("failed to execute path template: %v", err)
+		return "", false
+	}
+	return buf.String(), true
+}
+
 // Adapt adapts path.
 func (pa *PathAdaptor) Adapt(path string) string {
+	return pa.AdaptWithData(path, nil)
+}
+
+// AdaptWithData adapts path, data is used to execute the templates if the
+// PathAdaptor is created by NewWithTemplate. The path is kept unchanged if
+// a template fails.
+func (pa *PathAdaptor) AdaptWithData(path string, data interface{}) string {
 	if len(pa.spec.Replace) != 0 {
-		return pa.spec.Replace
+		if pa.replace == nil {
+			return pa.spec.Replace
+		}
+		if replace, ok := executeTemplate(pa.replace, data); ok {
+			return replace
+		}
+		return path
 	}
 
 	if len(pa.spec.AddPrefix) != 0 {
-		return pa.spec.AddPrefix + path
+		if pa.addPrefix == nil {
+			return pa.spec.AddPrefix + path
+		}
+		if prefix, ok := executeTemplate(pa.addPrefix, data); ok {
+			return prefix + path
+		}
+		return path
 	}
 
 	if len(pa.spec.TrimPrefix) != 0 {
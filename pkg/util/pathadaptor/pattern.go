@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pathadaptor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Pattern is a path with named parameters, e.g. /users/{id}/orders/{oid}.
+// A parameter matches a non-empty path segment, and the last parameter
+// matches the rest of the path if it is written as {name*}.
+type Pattern struct {
+	text  string
+	re    *regexp.Regexp
+	names []string
+}
+
+var paramNameRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// NewPattern creates a Pattern from text.
+func NewPattern(text string) (*Pattern, error) {
+	if !strings.HasPrefix(text, "/") {
+		return nil, fmt.Errorf("pattern %q does not start with /", text)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("^")
+
+	names := []string{}
+	seen := map[string]bool{}
+	rest := text
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			if strings.IndexByte(rest, '}') >= 0 {
+				return nil, fmt.Errorf("pattern %q has unmatched }", text)
+			}
+			sb.WriteString(regexp.QuoteMeta(rest))
+			break
+		}
+
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("pattern %q has unmatched {", text)
+		}
+		end += start
+
+		sb.WriteString(regexp.QuoteMeta(rest[:start]))
+		name, wildcard := rest[start+1:end], false
+		if strings.HasSuffix(name, "*") {
+			name, wildcard = name[:len(name)-1], true
+		}
+		if !paramNameRE.MatchString(name) {
+			return nil, fmt.Errorf("pattern %q has invalid parameter name %q", text, name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("pattern %q has duplicated parameter %q", text, name)
+		}
+		seen[name] = true
+		names = append(names, name)
+
+		rest = rest[end+1:]
+		if wildcard {
+			if rest != "" {
+				return nil, fmt.Errorf("pattern %q has wildcard parameter %q which is not the last", text, name)
+			}
+			sb.WriteString("(.*)")
+		} else {
+			sb.WriteString("([^/]+)")
+		}
+	}
+
+	sb.WriteString("$")
+	return &Pattern{
+		text:  text,
+		re:    regexp.MustCompile(sb.String()),
+		names: names,
+	}, nil
+}
+
+// String returns the text of the pattern.
+func (p *Pattern) String() string {
+	return p.text
+}
+
+// Match reports whether path matches the pattern, and returns the values
+// of the parameters if it does.
+func (p *Pattern) Match(path string) (map[string]string, bool) {
+	m := p.re.FindStringSubmatch(path)
+	if m == nil {
+		return nil, false
+	}
+
+	params := make(map[string]string, len(p.names))
+	for i, name := range p.names {
+		params[name] = m[i+1]
+	}
+	return params, true
+}
+
+// RegexpParams returns the values of the named groups of re in path, it
+// returns nil if path doesn't match re or re has no named groups.
+func RegexpParams(re *regexp.Regexp, path string) map[string]string {
+	var params map[string]string
+
+	m := re.FindStringSubmatch(path)
+	if m == nil {
+		return nil
+	}
+	for i, name := range re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		if params == nil {
+			params = map[string]string{}
+		}
+		params[name] = m[i]
+	}
+	return params
+}
+
+// Expand replaces the parameters in text, which are written as {name},
+// with their values, unknown parameters are kept as is.
+func Expand(text string, params map[string]string) string {
+	if len(params) == 0 || strings.IndexByte(text, '{') < 0 {
+		return text
+	}
+
+	var sb strings.Builder
+	for {
+		start := strings.IndexByte(text, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(text[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+
+		value, ok := params[text[start+1:end]]
+		if !ok {
+			sb.WriteString(text[:end+1])
+		} else {
+			sb.WriteString(text[:start])
+			sb.WriteString(value)
+		}
+		text = text[end+1:]
+	}
+	sb.WriteString(text)
+
+	return sb.String()
+}
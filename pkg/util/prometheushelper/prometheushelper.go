@@ -0,0 +1,185 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package prometheushelper provides helper functions to create Prometheus
+// metrics, which are exported by the /metrics API.
+package prometheushelper
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	// Namespace is the namespace of all metrics of Easegress.
+	Namespace = "easegress"
+
+	// OverflowLabelValue replaces the label values beyond the limit.
+	OverflowLabelValue = "__overflow__"
+
+	// DefaultMaxLabelValues is the default maximum number of values of a
+	// label with unbounded values, like routes and servers.
+	DefaultMaxLabelValues = 1000
+)
+
+var (
+	lock           sync.Mutex
+	registerer     prometheus.Registerer = prometheus.DefaultRegisterer
+	maxLabelValues                       = DefaultMaxLabelValues
+	collectors                           = map[string]prometheus.Collector{}
+)
+
+type (
+	// LabelGuard limits the number of values of a label, it prevents
+	// the cardinality explosion caused by labels like paths.
+	LabelGuard struct {
+		max    int
+		mutex  sync.RWMutex
+		values map[string]struct{}
+	}
+)
+
+// Init initializes the helper with the constant labels added to all
+// metrics, and the maximum number of values of a guarded label, it must be
+// called before creating any metric.
+func Init(labels map[string]string, maxValues int) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if len(labels) > 0 {
+		registerer = prometheus.WrapRegistererWith(labels, prometheus.DefaultRegisterer)
+	}
+	if maxValues > 0 {
+		maxLabelValues = maxValues
+	}
+}
+
+// register registers the collector, the one registered before is returned
+// if there is a collector of the same name, as objects are recreated when
+// their specs are updated.
+func register(name string, c prometheus.Collector) prometheus.Collector {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if exist := collectors[name]; exist != nil {
+		return exist
+	}
+
+	if err := registerer.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			c = are.ExistingCollector
+		} else {
+			logger.Errorf("register prometheus metric %s failed: %v", name, err)
+		}
+	}
+
+	collectors[name] = c
+	return c
+}
+
+// NewCounter creates or gets the counter of the name.
+func NewCounter(name, help string, labels []string) *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      name,
+		Help:      help,
+	}, labels)
+	return register(name, c).(*prometheus.CounterVec)
+}
+
+// NewGauge creates or gets the gauge of the name.
+func NewGauge(name, help string, labels []string) *prometheus.GaugeVec {
+	g := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      name,
+		Help:      help,
+	}, labels)
+	return register(name, g).(*prometheus.GaugeVec)
+}
+
+// NewHistogram creates or gets the histogram of the name, the default
+// buckets of Prometheus are used if buckets is nil.
+func NewHistogram(name, help string, labels []string, buckets []float64) *prometheus.HistogramVec {
+	h := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      name,
+		Help:      help,
+		Buckets:   buckets,
+	}, labels)
+	return register(name, h).(*prometheus.HistogramVec)
+}
+
+// Handler returns the handler of the /metrics API.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Gather gathers the current values of the metrics, it is used by objects
+// computing on the metrics of Easegress itself.
+func Gather() ([]*dto.MetricFamily, error) {
+	return prometheus.DefaultGatherer.Gather()
+}
+
+// StatusClass returns the class of the status code, e.g. 2xx.
+func StatusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// NewLabelGuard creates a LabelGuard.
+func NewLabelGuard() *LabelGuard {
+	lock.Lock()
+	max := maxLabelValues
+	lock.Unlock()
+
+	return &LabelGuard{
+		max:    max,
+		values: map[string]struct{}{},
+	}
+}
+
+// Value returns the value itself if it is a known value or the number of
+// values is under the limit, otherwise, it returns OverflowLabelValue.
+func (g *LabelGuard) Value(v string) string {
+	g.mutex.RLock()
+	_, ok := g.values[v]
+	g.mutex.RUnlock()
+	if ok {
+		return v
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if _, ok = g.values[v]; ok {
+		return v
+	}
+	if len(g.values) >= g.max {
+		return OverflowLabelValue
+	}
+	g.values[v] = struct{}{}
+	return v
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package prometheushelper
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	c1 := NewCounter("test_requests_total", "test counter", []string{"name"})
+	c2 := NewCounter("test_requests_total", "test counter", []string{"name"})
+	assert.Same(c1, c2)
+	c1.WithLabelValues("a").Inc()
+
+	g := NewGauge("test_servers", "test gauge", []string{"name"})
+	g.WithLabelValues("a").Set(3)
+
+	h := NewHistogram("test_duration_seconds", "test histogram", []string{"name"}, nil)
+	h.WithLabelValues("a").Observe(0.1)
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	assert.True(strings.Contains(body, `easegress_test_requests_total{name="a"} 1`))
+	assert.True(strings.Contains(body, `easegress_test_servers{name="a"} 3`))
+	assert.True(strings.Contains(body, `easegress_test_duration_seconds_count{name="a"} 1`))
+}
+
+func TestLabelGuard(t *testing.T) {
+	assert := assert.New(t)
+
+	g := &LabelGuard{max: 2, values: map[string]struct{}{}}
+	assert.Equal("a", g.Value("a"))
+	assert.Equal("b", g.Value("b"))
+	assert.Equal(OverflowLabelValue, g.Value("c"))
+	assert.Equal("a", g.Value("a"))
+}
+
+func TestStatusClass(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("2xx", StatusClass(200))
+	assert.Equal("5xx", StatusClass(503))
+	assert.Equal("unknown", StatusClass(0))
+}
@@ -33,8 +33,16 @@ func NewByteCountReader(r io.Reader) *ByteCountReader {
 	return &ByteCountReader{r: r}
 }
 
-// Read implements io.Reader.
+// Read implements io.Reader. Once the EOF is reached, the underlying
+// io.Reader is rewound if it is an io.Seeker, so that it can be read again.
 func (r *ByteCountReader) Read(p []byte) (int, error) {
+	if r.err == io.EOF {
+		if s, ok := r.r.(io.Seeker); ok {
+			if _, err := s.Seek(0, io.SeekStart); err == nil {
+				r.err = nil
+			}
+		}
+	}
 	if r.err != nil {
 		return 0, r.err
 	}
@@ -38,3 +38,16 @@ func TestByteCountReader(t *testing.T) {
 	assert.Nil(br.Error())
 	assert.Nil(br.Close())
 }
+
+func TestByteCountReaderRewind(t *testing.T) {
+	assert := assert.New(t)
+
+	br := NewByteCountReader(strings.NewReader("123"))
+	for i := 0; i < 2; i++ {
+		data, err := io.ReadAll(br)
+		assert.Nil(err)
+		assert.Equal("123", string(data))
+		assert.True(br.SawEOF())
+	}
+	assert.Equal(6, br.BytesRead())
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package readers
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressReader(t *testing.T) {
+	assert := assert.New(t)
+
+	str := strings.Repeat("123123123124234asdjflasjflasfjlaksnvalknfaslkfnalkfnaslfjasfasfasfas", 200)
+	compressReader := NewCompressReader(strings.NewReader(str), func(w io.Writer) io.WriteCloser {
+		return zlib.NewWriter(w)
+	})
+	data, err := io.ReadAll(compressReader)
+	assert.Nil(err)
+	assert.Nil(compressReader.Close())
+	assert.Less(10*len(data), len(str))
+
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	assert.Nil(err)
+	data, err = io.ReadAll(zr)
+	assert.Nil(err)
+	assert.Equal(str, string(data))
+}
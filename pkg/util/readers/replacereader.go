@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package readers
+
+import (
+	"io"
+	"regexp"
+)
+
+// ReplaceReader wraps an io.Reader, and replaces the matches of a regular
+// expression in the data read from it.
+//
+// The data is processed in a sliding window, so the reader doesn't need
+// to buffer all the data, but a match longer than the window size could
+// be missed, and the anchors (^, $, \b etc.) are evaluated against the
+// data in the window instead of all the data.
+type ReplaceReader struct {
+	r       io.Reader
+	re      *regexp.Regexp
+	repl    []byte
+	literal bool
+	window  int
+
+	buf []byte
+	out []byte
+	err error
+}
+
+const defaultReplaceWindow = 4 * 1024
+
+// NewReplaceReader creates a ReplaceReader which replaces the matches of
+// re with repl, $ signs in repl are interpreted as in Regexp.Expand unless
+// literal is true. window is the max length of the matches, a default
+// value is used if it is not positive.
+func NewReplaceReader(r io.Reader, re *regexp.Regexp, repl string, literal bool, window int) *ReplaceReader {
+	if window <= 0 {
+		window = defaultReplaceWindow
+	}
+	return &ReplaceReader{
+		r:       r,
+		re:      re,
+		repl:    []byte(repl),
+		literal: literal,
+		window:  window,
+	}
+}
+
+// ReplaceAll replaces the matches of re in src with repl, $ signs in repl
+// are interpreted as in Regexp.Expand unless literal is true.
+func ReplaceAll(src []byte, re *regexp.Regexp, repl string, literal bool) []byte {
+	if literal {
+		return re.ReplaceAllLiteral(src, []byte(repl))
+	}
+	return re.ReplaceAll(src, []byte(repl))
+}
+
+func (rr *ReplaceReader) Read(p []byte) (int, error) {
+	for len(rr.out) == 0 {
+		if rr.err != nil {
+			return 0, rr.err
+		}
+		rr.fill()
+		rr.process()
+	}
+
+	n := copy(p, rr.out)
+	rr.out = rr.out[n:]
+	return n, nil
+}
+
+// fill reads data until there are two windows of data in the buffer, or
+// an error occurs.
+func (rr *ReplaceReader) fill() {
+	for len(rr.buf) < 2*rr.window {
+		if cap(rr.buf)-len(rr.buf) < rr.window {
+			buf := make([]byte, len(rr.buf), 2*len(rr.buf)+rr.window)
+			copy(buf, rr.buf)
+			rr.buf = buf
+		}
+
+		n, err := rr.r.Read(rr.buf[len(rr.buf):cap(rr.buf)])
+		rr.buf = rr.buf[:len(rr.buf)+n]
+		if err != nil {
+			rr.err = err
+			return
+		}
+	}
+}
+
+// process replaces the matches in the buffer, and moves the result to the
+// output. The last window of data is kept in the buffer unless there's
+// no more data, as it may be the beginning of a match.
+func (rr *ReplaceReader) process() {
+	if rr.err != nil {
+		rr.out = ReplaceAll(rr.buf, rr.re, string(rr.repl), rr.literal)
+		rr.buf = nil
+		return
+	}
+
+	limit := len(rr.buf) - rr.window
+	out, pos := make([]byte, 0, len(rr.buf)), 0
+	for _, m := range rr.re.FindAllSubmatchIndex(rr.buf, -1) {
+		if m[0] >= limit {
+			break
+		}
+		out = append(out, rr.buf[pos:m[0]]...)
+		if rr.literal {
+			out = append(out, rr.repl...)
+		} else {
+			out = rr.re.Expand(out, rr.repl, rr.buf, m)
+		}
+		pos = m[1]
+	}
+
+	if pos < limit {
+		out = append(out, rr.buf[pos:limit]...)
+		pos = limit
+	}
+
+	rr.out = out
+	rr.buf = append(rr.buf[:0], rr.buf[pos:]...)
+}
+
+// Close implements io.Closer.
+func (rr *ReplaceReader) Close() error {
+	if c, ok := rr.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
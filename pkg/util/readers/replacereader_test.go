@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package readers
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaceReader(t *testing.T) {
+	assert := assert.New(t)
+
+	re := regexp.MustCompile(regexp.QuoteMeta("http://backend:8080"))
+	src := "http://backend:8080/a " + strings.Repeat("xyz http://backend:8080/", 100)
+	want := strings.ReplaceAll(src, "http://backend:8080", "https://$gw")
+
+	// the matches crossing the windows are replaced too.
+	for _, window := range []int{19, 20, 33, 1000, 0} {
+		rr := NewReplaceReader(iotest.OneByteReader(strings.NewReader(src)), re, "https://$gw", true, window)
+		data, err := io.ReadAll(rr)
+		assert.Nil(err)
+		assert.Equal(want, string(data), window)
+		assert.Nil(rr.Close())
+	}
+
+	re = regexp.MustCompile(`id=(\d+)`)
+	src = strings.Repeat("id=12 ", 100)
+	rr := NewReplaceReader(iotest.HalfReader(strings.NewReader(src)), re, "uid=${1}0", false, 8)
+	data, err := io.ReadAll(rr)
+	assert.Nil(err)
+	assert.Equal(strings.Repeat("uid=120 ", 100), string(data))
+	assert.Equal(string(data), string(ReplaceAll([]byte(src), re, "uid=${1}0", false)))
+
+	// errors are returned after the data.
+	rr = NewReplaceReader(iotest.TimeoutReader(strings.NewReader("id=1")), re, "x", false, 8)
+	data, err = io.ReadAll(rr)
+	assert.Equal(iotest.ErrTimeout, err)
+	assert.Equal("x", string(data))
+}
@@ -0,0 +1,314 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spiffe
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	fetchX509SVIDMethod = "/SpiffeWorkloadAPI/FetchX509SVID"
+
+	minRetryInterval = time.Second
+	maxRetryInterval = 30 * time.Second
+)
+
+type (
+	// svid is an X509-SVID with the trust bundle of its trust domain.
+	svid struct {
+		id       string
+		cert     *tls.Certificate
+		bundle   *x509.CertPool
+		expireAt time.Time
+	}
+
+	// Source keeps fetching X509-SVIDs from the SPIFFE Workload API, the
+	// agent pushes new SVIDs before the old ones expire, so the TLS configs
+	// using the source always get the latest SVID.
+	Source struct {
+		socketPath string
+		current    atomic.Value // *svid
+		ready      chan struct{}
+		readyOnce  sync.Once
+	}
+
+	// rawCodec passes through the messages which are encoded by protowire,
+	// so there's no need of the generated code of the Workload API. The
+	// name must be proto to be accepted by the agent.
+	rawCodec struct{}
+)
+
+var (
+	sourcesLock sync.Mutex
+	sources     = map[string]*Source{}
+)
+
+// getSource returns the source of the socket path, sources are shared by
+// all users of the same socket and live as long as the process.
+func getSource(socketPath string) *Source {
+	sourcesLock.Lock()
+	defer sourcesLock.Unlock()
+
+	if s := sources[socketPath]; s != nil {
+		return s
+	}
+
+	s := &Source{socketPath: socketPath, ready: make(chan struct{})}
+	sources[socketPath] = s
+	go s.run()
+	return s
+}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	return *(v.(*[]byte)), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	*(v.(*[]byte)) = append([]byte(nil), data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+func (s *Source) run() {
+	interval := minRetryInterval
+	for {
+		err := s.watch()
+		logger.Errorf("watch X509-SVIDs from %s failed: %v, retry in %v", s.socketPath, err, interval)
+		time.Sleep(interval)
+		if interval *= 2; interval > maxRetryInterval {
+			interval = maxRetryInterval
+		}
+	}
+}
+
+func (s *Source) watch() error {
+	conn, err := grpc.Dial(s.socketPath, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the header is required by the Workload API to prevent SSRF attacks.
+	ctx = metadata.AppendToOutgoingContext(ctx, "workload.spiffe.io", "true")
+
+	desc := &grpc.StreamDesc{StreamName: "FetchX509SVID", ServerStreams: true}
+	stream, err := conn.NewStream(ctx, desc, fetchX509SVIDMethod, grpc.ForceCodec(rawCodec{}))
+	if err != nil {
+		return err
+	}
+
+	// X509SVIDRequest is an empty message.
+	req := []byte{}
+	if err = stream.SendMsg(&req); err != nil {
+		return err
+	}
+	if err = stream.CloseSend(); err != nil {
+		return err
+	}
+
+	for {
+		var resp []byte
+		if err = stream.RecvMsg(&resp); err != nil {
+			return err
+		}
+
+		sv, err := parseX509SVIDResponse(resp)
+		if err != nil {
+			logger.Errorf("invalid X509-SVID response from %s: %v", s.socketPath, err)
+			continue
+		}
+
+		s.update(sv)
+	}
+}
+
+func (s *Source) update(sv *svid) {
+	s.current.Store(sv)
+	s.readyOnce.Do(func() { close(s.ready) })
+	logger.Infof("got X509-SVID %s from %s, expires at %v", sv.id, s.socketPath, sv.expireAt)
+}
+
+func (s *Source) svid() *svid {
+	sv, _ := s.current.Load().(*svid)
+	return sv
+}
+
+// waitSVID waits for the first SVID, so that the first connections don't
+// fail when the source is just created.
+func (s *Source) waitSVID(timeout time.Duration) (*svid, error) {
+	if sv := s.svid(); sv != nil {
+		return sv, nil
+	}
+
+	select {
+	case <-s.ready:
+		return s.svid(), nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("no X509-SVID from %s", s.socketPath)
+	}
+}
+
+// parseX509SVIDResponse parses the X509SVIDResponse message, the first SVID
+// is the default one according to the specification, others are ignored.
+//
+//	message X509SVIDResponse {
+//	  repeated X509SVID svids = 1;
+//	  ...
+//	}
+func parseX509SVIDResponse(b []byte) (*svid, error) {
+	var first []byte
+	err := walkFields(b, func(num protowire.Number, value []byte) {
+		if num == 1 && first == nil {
+			first = value
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if first == nil {
+		return nil, fmt.Errorf("no SVID in response")
+	}
+	return parseX509SVID(first)
+}
+
+// parseX509SVID parses the X509SVID message.
+//
+//	message X509SVID {
+//	  string spiffe_id = 1;
+//	  bytes x509_svid = 2;     // ASN.1 DER certificates, leaf first
+//	  bytes x509_svid_key = 3; // ASN.1 DER PKCS#8 private key
+//	  bytes bundle = 4;        // ASN.1 DER certificates
+//	  ...
+//	}
+func parseX509SVID(b []byte) (*svid, error) {
+	var id string
+	var certsDER, keyDER, bundleDER []byte
+	err := walkFields(b, func(num protowire.Number, value []byte) {
+		switch num {
+		case 1:
+			id = string(value)
+		case 2:
+			certsDER = value
+		case 3:
+			keyDER = value
+		case 4:
+			bundleDER = value
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := x509.ParseCertificates(certsDER)
+	if err != nil || len(certs) == 0 {
+		return nil, fmt.Errorf("invalid SVID certificates: %v", err)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyDER)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SVID private key: %v", err)
+	}
+	if _, ok := key.(crypto.Signer); !ok {
+		return nil, fmt.Errorf("SVID private key is not a signer")
+	}
+	roots, err := x509.ParseCertificates(bundleDER)
+	if err != nil || len(roots) == 0 {
+		return nil, fmt.Errorf("invalid trust bundle: %v", err)
+	}
+
+	if leafID, err := idOf(certs[0]); err != nil {
+		return nil, err
+	} else if leafID != id {
+		return nil, fmt.Errorf("SPIFFE ID mismatch: %s and %s", id, leafID)
+	}
+
+	cert := &tls.Certificate{PrivateKey: key, Leaf: certs[0]}
+	for _, c := range certs {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+	bundle := x509.NewCertPool()
+	for _, c := range roots {
+		bundle.AddCert(c)
+	}
+
+	return &svid{id: id, cert: cert, bundle: bundle, expireAt: certs[0].NotAfter}, nil
+}
+
+// walkFields calls fn for each length delimited field of a message, fields
+// of other wire types are skipped.
+func walkFields(b []byte, fn func(num protowire.Number, value []byte)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if typ == protowire.BytesType {
+			value, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			fn(num, value)
+			b = b[n:]
+			continue
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// idOf returns the SPIFFE ID of an X509-SVID, which is the only URI SAN.
+func idOf(cert *x509.Certificate) (string, error) {
+	if len(cert.URIs) != 1 || cert.URIs[0].Scheme != "spiffe" {
+		return "", fmt.Errorf("certificate has no valid SPIFFE ID")
+	}
+	return cert.URIs[0].String(), nil
+}
+
+func trustDomainOf(id string) string {
+	u, err := url.Parse(id)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package spiffe provides mTLS configurations using the X509-SVIDs obtained
+// from the SPIFFE Workload API, e.g. the SPIRE agent.
+package spiffe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultSocketPath is the default address of the Workload API, it
+	// could be overridden by the SPIFFE_ENDPOINT_SOCKET environment variable.
+	DefaultSocketPath = "unix:///tmp/spire-agent/public/api.sock"
+
+	svidWaitTimeout = 5 * time.Second
+)
+
+// Spec is the spec of SPIFFE based mTLS.
+type Spec struct {
+	// SocketPath is the address of the Workload API, e.g.
+	// unix:///run/spire/sockets/agent.sock.
+	SocketPath string `json:"socketPath" jsonschema:"omitempty"`
+	// AllowedIDs are the SPIFFE IDs of the peers allowed to connect, peers
+	// in the same trust domain are allowed if it is empty.
+	AllowedIDs []string `json:"allowedIDs" jsonschema:"omitempty"`
+}
+
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	if spec.SocketPath != "" && !strings.HasPrefix(spec.SocketPath, "unix://") {
+		return fmt.Errorf("socketPath must be a unix socket address like unix:///path/to/socket")
+	}
+	for _, id := range spec.AllowedIDs {
+		if !strings.HasPrefix(id, "spiffe://") {
+			return fmt.Errorf("invalid SPIFFE ID %s", id)
+		}
+	}
+	return nil
+}
+
+func (spec *Spec) socketPath() string {
+	if spec.SocketPath != "" {
+		return spec.SocketPath
+	}
+	if path := os.Getenv("SPIFFE_ENDPOINT_SOCKET"); path != "" {
+		return path
+	}
+	return DefaultSocketPath
+}
+
+// ClientTLSConfig returns the TLS config for the client side of mTLS, the
+// server certificate is verified by the trust bundle and the SPIFFE ID
+// instead of the host name.
+func (spec *Spec) ClientTLSConfig() *tls.Config {
+	return spec.clientTLSConfig(getSource(spec.socketPath()))
+}
+
+func (spec *Spec) clientTLSConfig(src *Source) *tls.Config {
+	return &tls.Config{
+		// the certificate is verified in VerifyPeerCertificate.
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			sv, err := src.waitSVID(svidWaitTimeout)
+			if err != nil {
+				return nil, err
+			}
+			return sv.cert, nil
+		},
+		VerifyPeerCertificate: spec.verifier(src),
+	}
+}
+
+// ServerTLSConfig returns the TLS config for the server side of mTLS, the
+// client must present an X509-SVID allowed by the spec.
+func (spec *Spec) ServerTLSConfig() *tls.Config {
+	return spec.serverTLSConfig(getSource(spec.socketPath()))
+}
+
+func (spec *Spec) serverTLSConfig(src *Source) *tls.Config {
+	return &tls.Config{
+		// the certificate is verified in VerifyPeerCertificate.
+		ClientAuth: tls.RequireAnyClientCert,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			sv, err := src.waitSVID(svidWaitTimeout)
+			if err != nil {
+				return nil, err
+			}
+			return sv.cert, nil
+		},
+		VerifyPeerCertificate: spec.verifier(src),
+	}
+}
+
+func (spec *Spec) verifier(src *Source) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		sv, err := src.waitSVID(svidWaitTimeout)
+		if err != nil {
+			return err
+		}
+
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("no peer certificate")
+		}
+		certs := make([]*x509.Certificate, 0, len(rawCerts))
+		for _, raw := range rawCerts {
+			c, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs = append(certs, c)
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, c := range certs[1:] {
+			intermediates.AddCert(c)
+		}
+		_, err = certs[0].Verify(x509.VerifyOptions{
+			Roots:         sv.bundle,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			return fmt.Errorf("verify peer X509-SVID failed: %v", err)
+		}
+
+		id, err := idOf(certs[0])
+		if err != nil {
+			return err
+		}
+		if !spec.allowed(id, sv.id) {
+			return fmt.Errorf("SPIFFE ID %s is not allowed", id)
+		}
+		return nil
+	}
+}
+
+func (spec *Spec) allowed(peerID, localID string) bool {
+	if len(spec.AllowedIDs) == 0 {
+		return trustDomainOf(peerID) == trustDomainOf(localID)
+	}
+	for _, id := range spec.AllowedIDs {
+		if id == peerID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spiffe
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, trustDomain string) *testCA {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: trustDomain},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		URIs:                  []*url.URL{{Scheme: "spiffe", Host: trustDomain}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key}
+}
+
+// issue returns the X509SVID message of the SPIFFE ID.
+func (ca *testCA) issue(t *testing.T, id string) []byte {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	u, _ := url.Parse(id)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		URIs:         []*url.URL{u},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	var msg []byte
+	msg = protowire.AppendTag(msg, 1, protowire.BytesType)
+	msg = protowire.AppendString(msg, id)
+	msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+	msg = protowire.AppendBytes(msg, der)
+	msg = protowire.AppendTag(msg, 3, protowire.BytesType)
+	msg = protowire.AppendBytes(msg, keyDER)
+	msg = protowire.AppendTag(msg, 4, protowire.BytesType)
+	msg = protowire.AppendBytes(msg, ca.cert.Raw)
+	return msg
+}
+
+func response(svids ...[]byte) []byte {
+	var msg []byte
+	for _, sv := range svids {
+		msg = protowire.AppendTag(msg, 1, protowire.BytesType)
+		msg = protowire.AppendBytes(msg, sv)
+	}
+	// federated bundles are ignored.
+	msg = protowire.AppendTag(msg, 3, protowire.BytesType)
+	msg = protowire.AppendBytes(msg, []byte("ignored"))
+	return msg
+}
+
+func newTestSource(t *testing.T, msg []byte) *Source {
+	sv, err := parseX509SVIDResponse(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &Source{socketPath: "test", ready: make(chan struct{})}
+	src.update(sv)
+	return src
+}
+
+func handshake(client, server *tls.Config) (error, error) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer ln.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		s, err := ln.Accept()
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer s.Close()
+		errCh <- tls.Server(s, server).Handshake()
+	}()
+
+	c, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		return err, err
+	}
+	defer c.Close()
+	conn := tls.Client(c, client)
+	err = conn.Handshake()
+	// the server verifies the client certificate after the client
+	// finished the handshake in TLS 1.3, read to get the alert.
+	if err == nil {
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		conn.Read(make([]byte, 1))
+	}
+	return err, <-errCh
+}
+
+func TestParseX509SVIDResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	ca := newTestCA(t, "megaease.com")
+	sv, err := parseX509SVIDResponse(response(ca.issue(t, "spiffe://megaease.com/a"), ca.issue(t, "spiffe://megaease.com/b")))
+	assert.NoError(err)
+	assert.Equal("spiffe://megaease.com/a", sv.id)
+	assert.Equal(sv.cert.Leaf.NotAfter, sv.expireAt)
+
+	_, err = parseX509SVIDResponse(response())
+	assert.Error(err)
+
+	_, err = parseX509SVIDResponse([]byte{0xff})
+	assert.Error(err)
+
+	// the ID doesn't match the certificate.
+	msg := ca.issue(t, "spiffe://megaease.com/a")
+	msg = protowire.AppendTag(msg, 1, protowire.BytesType)
+	msg = protowire.AppendString(msg, "spiffe://megaease.com/c")
+	_, err = parseX509SVIDResponse(response(msg))
+	assert.Error(err)
+}
+
+func TestMTLS(t *testing.T) {
+	assert := assert.New(t)
+
+	ca := newTestCA(t, "megaease.com")
+	clientSrc := newTestSource(t, response(ca.issue(t, "spiffe://megaease.com/client")))
+	serverSrc := newTestSource(t, response(ca.issue(t, "spiffe://megaease.com/server")))
+
+	// peers in the same trust domain are allowed by default.
+	spec := &Spec{}
+	cerr, serr := handshake(spec.clientTLSConfig(clientSrc), spec.serverTLSConfig(serverSrc))
+	assert.NoError(cerr)
+	assert.NoError(serr)
+
+	// the server only allows another client.
+	serverSpec := &Spec{AllowedIDs: []string{"spiffe://megaease.com/other"}}
+	_, serr = handshake(spec.clientTLSConfig(clientSrc), serverSpec.serverTLSConfig(serverSrc))
+	assert.Error(serr)
+
+	// the client only allows the server.
+	clientSpec := &Spec{AllowedIDs: []string{"spiffe://megaease.com/server"}}
+	cerr, serr = handshake(clientSpec.clientTLSConfig(clientSrc), spec.serverTLSConfig(serverSrc))
+	assert.NoError(cerr)
+	assert.NoError(serr)
+
+	// the server in another trust domain is rejected.
+	other := newTestCA(t, "example.com")
+	otherSrc := newTestSource(t, response(other.issue(t, "spiffe://example.com/server")))
+	cerr, _ = handshake(spec.clientTLSConfig(clientSrc), spec.serverTLSConfig(otherSrc))
+	assert.Error(cerr)
+
+	// rotation: the new SVID is used by new connections.
+	sv, _ := parseX509SVIDResponse(response(ca.issue(t, "spiffe://megaease.com/client2")))
+	clientSrc.update(sv)
+	serverSpec = &Spec{AllowedIDs: []string{"spiffe://megaease.com/client2"}}
+	cerr, serr = handshake(spec.clientTLSConfig(clientSrc), serverSpec.serverTLSConfig(serverSrc))
+	assert.NoError(cerr)
+	assert.NoError(serr)
+
+	// no SVID.
+	src := &Source{socketPath: "test", ready: make(chan struct{})}
+	_, err := src.waitSVID(10 * time.Millisecond)
+	assert.Error(err)
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&Spec{}).Validate())
+	assert.NoError((&Spec{SocketPath: "unix:///run/spire/agent.sock", AllowedIDs: []string{"spiffe://megaease.com/a"}}).Validate())
+	assert.Error((&Spec{SocketPath: "/run/spire/agent.sock"}).Validate())
+	assert.Error((&Spec{AllowedIDs: []string{"megaease.com/a"}}).Validate())
+
+	t.Setenv("SPIFFE_ENDPOINT_SOCKET", "unix:///env.sock")
+	assert.Equal("unix:///env.sock", (&Spec{}).socketPath())
+	assert.Equal("unix:///a.sock", (&Spec{SocketPath: "unix:///a.sock"}).socketPath())
+}